@@ -0,0 +1,1185 @@
+# Code generated by bindgen from the RPC API description. DO NOT EDIT.
+
+import json
+import urllib.error
+import urllib.request
+from typing import Any, Dict, List, Optional
+
+try:
+    from typing import TypedDict
+except ImportError:  # Python < 3.8
+    from typing_extensions import TypedDict
+
+AddWebhookResp = TypedDict("AddWebhookResp", {
+    "id": str,
+    "secret": str,
+}, total=False)
+
+AddressTotals = TypedDict("AddressTotals", {
+    "transactions": int,
+    "internalTransactions": int,
+    "events": int,
+    "options": Optional["QueryOptions"],
+}, total=False)
+
+AddressWithBlockNumbers = TypedDict("AddressWithBlockNumbers", {
+    "Address": Optional[str],
+    "FromBlock": int,
+    "ToBlock": int,
+}, total=False)
+
+AddressWithBlockRange = TypedDict("AddressWithBlockRange", {
+    "Address": Optional[str],
+    "Options": Optional["PageOptions"],
+}, total=False)
+
+AddressWithData = TypedDict("AddressWithData", {
+    "Address": Optional[str],
+    "Data": str,
+}, total=False)
+
+AddressWithEnrichment = TypedDict("AddressWithEnrichment", {
+    "Address": Optional[str],
+    "Mapping": Optional[Dict[str, str]],
+}, total=False)
+
+AddressWithOptionalBlock = TypedDict("AddressWithOptionalBlock", {
+    "Address": Optional[str],
+    "BlockNumber": Optional[int],
+}, total=False)
+
+AddressWithOptions = TypedDict("AddressWithOptions", {
+    "Address": Optional[str],
+    "Options": Optional["QueryOptions"],
+}, total=False)
+
+AddressWithSeverityRules = TypedDict("AddressWithSeverityRules", {
+    "Address": Optional[str],
+    "Rules": Optional[List[Optional["SeverityRule"]]],
+}, total=False)
+
+Anomaly = TypedDict("Anomaly", {
+    "address": str,
+    "metric": str,
+    "kind": str,
+    "value": int,
+    "average": float,
+    "stdDev": float,
+    "since": int,
+}, total=False)
+
+Block = TypedDict("Block", {
+    "hash": str,
+    "parentHash": str,
+    "stateRoot": str,
+    "txRoot": str,
+    "receiptRoot": str,
+    "number": int,
+    "gasLimit": int,
+    "gasUsed": int,
+    "timestamp": int,
+    "extraData": str,
+    "transactions": Optional[List[str]],
+}, total=False)
+
+BlockRange = TypedDict("BlockRange", {
+    "from": int,
+    "to": int,
+}, total=False)
+
+BlockRangeArgs = TypedDict("BlockRangeArgs", {
+    "From": int,
+    "To": int,
+}, total=False)
+
+BlockRangeDeletion = TypedDict("BlockRangeDeletion", {
+    "fromBlock": int,
+    "toBlock": int,
+    "dryRun": bool,
+    "documents": Optional[Dict[str, int]],
+    "total": int,
+}, total=False)
+
+BlockRangeWithOptions = TypedDict("BlockRangeWithOptions", {
+    "From": int,
+    "To": int,
+    "Options": Optional["PageOptions"],
+    "IncludeEvents": bool,
+    "EventsPerTransaction": int,
+}, total=False)
+
+BlockSummariesResp = TypedDict("BlockSummariesResp", {
+    "blocks": Optional[List["BlockSummary"]],
+    "total": int,
+    "options": Optional["PageOptions"],
+}, total=False)
+
+BlockSummary = TypedDict("BlockSummary", {
+    "number": int,
+    "hash": str,
+    "parentHash": str,
+    "timestamp": int,
+    "timestampISO": str,
+    "transactionCount": int,
+}, total=False)
+
+CallFrame = TypedDict("CallFrame", {
+    "from": str,
+    "to": str,
+    "gas": int,
+    "gasUsed": int,
+    "value": int,
+    "input": str,
+    "output": str,
+    "type": str,
+    "calls": Optional[List[Optional["CallFrame"]]],
+}, total=False)
+
+CallTree = TypedDict("CallTree", {
+    "transactionHash": str,
+    "blockNumber": int,
+    "calls": Optional[List[Optional["CallFrame"]]],
+}, total=False)
+
+ChecksumMismatch = TypedDict("ChecksumMismatch", {
+    "kind": str,
+    "id": str,
+    "blockNumber": int,
+    "stored": str,
+    "computed": str,
+}, total=False)
+
+CodeMatchRequest = TypedDict("CodeMatchRequest", {
+    "template": str,
+    "codeHash": str,
+    "address": str,
+    "ignoreMetadata": bool,
+}, total=False)
+
+ContractCost = TypedDict("ContractCost", {
+    "address": str,
+    "blocksFiltered": int,
+    "processingSeconds": float,
+    "nodeCalls": int,
+    "documents": int,
+    "throttled": bool,
+}, total=False)
+
+ContractCostsArgs = TypedDict("ContractCostsArgs", {
+    "SortBy": str,
+    "Limit": int,
+}, total=False)
+
+ContractStatus = TypedDict("ContractStatus", {
+    "address": str,
+    "status": str,
+    "creationTransaction": str,
+    "destroyedAt": int,
+}, total=False)
+
+CounterpartiesArgs = TypedDict("CounterpartiesArgs", {
+    "Address": Optional[str],
+    "Options": Optional["CounterpartyQueryOptions"],
+}, total=False)
+
+Counterparty = TypedDict("Counterparty", {
+    "address": str,
+    "firstSeenBlock": int,
+    "firstSeenTimestamp": int,
+    "lastSeenBlock": int,
+    "lastSeenTimestamp": int,
+    "interactions": int,
+}, total=False)
+
+CounterpartyQueryOptions = TypedDict("CounterpartyQueryOptions", {
+    "sortBy": str,
+    "pageSize": int,
+    "pageNumber": int,
+}, total=False)
+
+DecodeLogsArgs = TypedDict("DecodeLogsArgs", {
+    "Logs": Optional[List[Optional["Event"]]],
+}, total=False)
+
+DeleteAddressArgs = TypedDict("DeleteAddressArgs", {
+    "Address": Optional[str],
+    "Purge": bool,
+}, total=False)
+
+DeleteBlockRangeArgs = TypedDict("DeleteBlockRangeArgs", {
+    "From": int,
+    "To": int,
+    "DryRun": bool,
+}, total=False)
+
+ERC1155TokenQuery = TypedDict("ERC1155TokenQuery", {
+    "Contract": Optional[str],
+    "Holder": Optional[str],
+    "TokenId": Optional[int],
+    "Block": int,
+    "Options": Optional["TokenQueryOptions"],
+}, total=False)
+
+ERC20Allowance = TypedDict("ERC20Allowance", {
+    "owner": str,
+    "spender": str,
+    "amount": Optional[int],
+    "blockNumber": int,
+}, total=False)
+
+ERC20AllowanceQuery = TypedDict("ERC20AllowanceQuery", {
+    "Contract": Optional[str],
+    "Owner": Optional[str],
+    "Spender": Optional[str],
+    "Options": Optional["TokenQueryOptions"],
+}, total=False)
+
+ERC20AllowancesQuery = TypedDict("ERC20AllowancesQuery", {
+    "Contract": Optional[str],
+    "Owner": Optional[str],
+    "Block": int,
+    "Options": Optional["QueryOptions"],
+}, total=False)
+
+ERC20Holding = TypedDict("ERC20Holding", {
+    "holder": str,
+    "balance": Optional[int],
+}, total=False)
+
+ERC20TokenHoldersQuery = TypedDict("ERC20TokenHoldersQuery", {
+    "Contract": Optional[str],
+    "Block": int,
+    "Options": Optional["QueryOptions"],
+}, total=False)
+
+ERC20TokenQuery = TypedDict("ERC20TokenQuery", {
+    "Contract": Optional[str],
+    "Holder": Optional[str],
+    "Block": int,
+    "Options": Optional["TokenQueryOptions"],
+}, total=False)
+
+ERC721Token = TypedDict("ERC721Token", {
+    "contract": str,
+    "holder": str,
+    "token": str,
+    "heldFrom": int,
+    "heldUntil": Optional[int],
+}, total=False)
+
+ERC721TokenQuery = TypedDict("ERC721TokenQuery", {
+    "Contract": Optional[str],
+    "Holder": Optional[str],
+    "TokenId": Optional[int],
+    "Block": int,
+    "Options": Optional["TokenQueryOptions"],
+}, total=False)
+
+Event = TypedDict("Event", {
+    "index": int,
+    "address": str,
+    "topics": Optional[List[str]],
+    "data": str,
+    "blockNumber": int,
+    "blockHash": str,
+    "transactionHash": str,
+    "transactionIndex": int,
+    "timestamp": int,
+}, total=False)
+
+EventsBySeverityArgs = TypedDict("EventsBySeverityArgs", {
+    "Address": Optional[str],
+    "Severity": str,
+    "Options": Optional["QueryOptions"],
+}, total=False)
+
+EventsByTopicsArgs = TypedDict("EventsByTopicsArgs", {
+    "Address": Optional[str],
+    "EventSignature": str,
+    "Topics": Optional[List[Optional[str]]],
+    "Options": Optional["QueryOptions"],
+}, total=False)
+
+EventsResp = TypedDict("EventsResp", {
+    "events": Optional[List[Optional["ParsedEvent"]]],
+    "total": int,
+    "options": Optional["QueryOptions"],
+    "nextCursor": str,
+}, total=False)
+
+ExportRequest = TypedDict("ExportRequest", {
+    "address": str,
+    "startBlock": int,
+    "endBlock": int,
+    "datasets": Optional[List[str]],
+    "format": str,
+}, total=False)
+
+GasUsage = TypedDict("GasUsage", {
+    "key": str,
+    "transactions": int,
+    "totalGasUsed": int,
+    "averageGasUsed": int,
+}, total=False)
+
+GasUsageQuery = TypedDict("GasUsageQuery", {
+    "contract": Optional[str],
+    "startBlock": int,
+    "endBlock": int,
+    "limit": int,
+}, total=False)
+
+HighAvailabilityStatus = TypedDict("HighAvailabilityStatus", {
+    "instanceId": str,
+    "leader": bool,
+    "lease": Optional["Lease"],
+    "sharding": Optional["ShardingStatus"],
+}, total=False)
+
+IndexStats = TypedDict("IndexStats", {
+    "name": str,
+    "documentCount": int,
+    "storageSize": int,
+    "oldestBlock": int,
+    "newestBlock": int,
+}, total=False)
+
+InferredVariable = TypedDict("InferredVariable", {
+    "label": str,
+    "slot": int,
+    "type": str,
+    "confidence": str,
+    "evidence": str,
+}, total=False)
+
+IntegrityReport = TypedDict("IntegrityReport", {
+    "jobId": str,
+    "startBlock": int,
+    "endBlock": int,
+    "verified": int,
+    "unverified": int,
+    "mismatchCount": int,
+    "mismatches": Optional[List[Optional["ChecksumMismatch"]]],
+    "complete": bool,
+}, total=False)
+
+InternalCall = TypedDict("InternalCall", {
+    "from": str,
+    "to": str,
+    "gas": int,
+    "gasUsed": int,
+    "value": int,
+    "input": str,
+    "output": str,
+    "type": str,
+}, total=False)
+
+Job = TypedDict("Job", {
+    "id": str,
+    "type": str,
+    "address": str,
+    "startBlock": int,
+    "endBlock": int,
+    "template": str,
+    "matched": Optional[List[str]],
+    "files": Optional[List[str]],
+    "status": str,
+    "step": str,
+    "deleted": int,
+    "total": int,
+    "versionConflicts": int,
+    "processed": int,
+    "error": str,
+    "startedAt": int,
+    "finishedAt": int,
+}, total=False)
+
+JournalArgs = TypedDict("JournalArgs", {
+    "stage": str,
+    "errorsOnly": bool,
+    "minDuration": int,
+    "Options": Optional["PageOptions"],
+}, total=False)
+
+JournalEntry = TypedDict("JournalEntry", {
+    "blockNumber": int,
+    "stage": str,
+    "timestamp": int,
+    "duration": int,
+    "transactions": int,
+    "events": int,
+    "tokenRecords": int,
+    "errors": Optional[List[str]],
+}, total=False)
+
+LayoutProposal = TypedDict("LayoutProposal", {
+    "jobId": str,
+    "address": str,
+    "states": int,
+    "unexplainedSlots": int,
+    "variables": Optional[List[Optional["InferredVariable"]]],
+    "layout": str,
+    "complete": bool,
+    "accepted": bool,
+}, total=False)
+
+Lease = TypedDict("Lease", {
+    "name": str,
+    "holder": str,
+    "acquiredAt": int,
+    "expiresAt": int,
+}, total=False)
+
+LegalHold = TypedDict("LegalHold", {
+    "id": str,
+    "address": Optional[str],
+    "transactionHash": Optional[str],
+    "fromBlock": Optional[int],
+    "toBlock": Optional[int],
+    "reason": str,
+    "createdAt": int,
+}, total=False)
+
+NetworkActivity = TypedDict("NetworkActivity", {
+    "from": int,
+    "to": int,
+    "transactions": int,
+    "privateTransactions": int,
+    "publicTransactions": int,
+    "privateRatio": float,
+    "activeContracts": int,
+    "activeAccounts": int,
+    "gasUsed": int,
+}, total=False)
+
+PageOptions = TypedDict("PageOptions", {
+    "beginBlockNumber": Optional[int],
+    "endBlockNumber": Optional[int],
+    "pageSize": int,
+    "pageNumber": int,
+    "snapshotId": str,
+}, total=False)
+
+ParsedEvent = TypedDict("ParsedEvent", {
+    "eventSig": str,
+    "parsedData": Any,
+    "rawEvent": Optional["Event"],
+    "timestamp": int,
+    "timestampISO": str,
+}, total=False)
+
+ParsedState = TypedDict("ParsedState", {
+    "blockNumber": int,
+    "historicStorage": Optional[List[Optional["StorageItem"]]],
+}, total=False)
+
+ParsedTransaction = TypedDict("ParsedTransaction", {
+    "txSig": str,
+    "func4Bytes": str,
+    "parsedData": Any,
+    "parsedEvents": Optional[List[Optional["ParsedEvent"]]],
+    "rawTransaction": Optional["Transaction"],
+    "timestamp": int,
+    "timestampISO": str,
+}, total=False)
+
+PendingActivityArgs = TypedDict("PendingActivityArgs", {
+    "Address": Optional[str],
+}, total=False)
+
+PendingTransaction = TypedDict("PendingTransaction", {
+    "hash": str,
+    "from": str,
+    "to": str,
+    "nonce": int,
+    "gas": int,
+    "gasPrice": int,
+    "value": str,
+    "data": str,
+    "isPrivate": bool,
+    "txSig": str,
+    "func4Bytes": str,
+    "parsedData": Any,
+    "seenAt": int,
+    "seenAtISO": str,
+}, total=False)
+
+QueryOptions = TypedDict("QueryOptions", {
+    "beginBlockNumber": Optional[int],
+    "endBlockNumber": Optional[int],
+    "beginTimestamp": Optional[int],
+    "endTimestamp": Optional[int],
+    "pageSize": int,
+    "pageNumber": int,
+    "snapshotId": str,
+    "cursor": str,
+}, total=False)
+
+RangeQueryResult = TypedDict("RangeQueryResult", {
+    "ranges": Optional[List["RangeResult"]],
+}, total=False)
+
+RangeResult = TypedDict("RangeResult", {
+    "start": int,
+    "end": int,
+    "resultCount": int,
+}, total=False)
+
+RefilterContractArgs = TypedDict("RefilterContractArgs", {
+    "Address": Optional[str],
+    "FromBlock": int,
+}, total=False)
+
+RegisteredName = TypedDict("RegisteredName", {
+    "name": str,
+    "address": str,
+}, total=False)
+
+ReplayEventsArgs = TypedDict("ReplayEventsArgs", {
+    "Address": Optional[str],
+    "Group": str,
+    "FromSequence": str,
+    "BatchSize": int,
+}, total=False)
+
+ReplayEventsResp = TypedDict("ReplayEventsResp", {
+    "events": Optional[List[Optional["ParsedEvent"]]],
+    "nextSequence": str,
+    "filteredTo": int,
+    "caughtUp": bool,
+}, total=False)
+
+ReportingResponseTemplate = TypedDict("ReportingResponseTemplate", {
+    "address": str,
+    "historicState": Optional[List[Optional["ParsedState"]]],
+    "total": int,
+    "options": Optional["PageOptions"],
+}, total=False)
+
+ScreenAddressesArgs = TypedDict("ScreenAddressesArgs", {
+    "Addresses": Optional[List[str]],
+}, total=False)
+
+ScreeningMatch = TypedDict("ScreeningMatch", {
+    "address": str,
+    "list": str,
+    "reason": str,
+}, total=False)
+
+SearchArgs = TypedDict("SearchArgs", {
+    "Term": str,
+    "Limit": int,
+}, total=False)
+
+SearchResult = TypedDict("SearchResult", {
+    "type": str,
+    "blockNumber": Optional[int],
+    "hash": Optional[str],
+    "address": Optional[str],
+    "transactionHash": Optional[str],
+    "index": Optional[int],
+}, total=False)
+
+SeverityRule = TypedDict("SeverityRule", {
+    "event": str,
+    "parameter": str,
+    "operator": str,
+    "value": str,
+    "severity": str,
+}, total=False)
+
+ShardingStatus = TypedDict("ShardingStatus", {
+    "mode": str,
+    "shards": int,
+    "owned": Optional[List[int]],
+    "instances": int,
+}, total=False)
+
+SnapshotArgs = TypedDict("SnapshotArgs", {
+    "TTL": int,
+}, total=False)
+
+SnapshotResp = TypedDict("SnapshotResp", {
+    "id": str,
+    "blockNumber": int,
+    "expiresAt": int,
+}, total=False)
+
+StorageArgs = TypedDict("StorageArgs", {
+    "Address": Optional[str],
+    "BlockNumber": Optional[int],
+    "SlotPrefix": str,
+    "Variable": str,
+    "MappingKeys": Optional[Dict[str, Optional[List[str]]]],
+    "Options": Optional["PageOptions"],
+}, total=False)
+
+StorageAverageArgs = TypedDict("StorageAverageArgs", {
+    "Address": Optional[str],
+    "Variable": str,
+    "WeightBy": str,
+    "Options": Optional["PageOptions"],
+}, total=False)
+
+StorageAverageResp = TypedDict("StorageAverageResp", {
+    "average": str,
+    "weight": int,
+    "weightBy": str,
+    "options": Optional["PageOptions"],
+}, total=False)
+
+StorageHistoryArgs = TypedDict("StorageHistoryArgs", {
+    "Address": Optional[str],
+    "Options": Optional["PageOptions"],
+    "MappingKeys": Optional[Dict[str, Optional[List[str]]]],
+}, total=False)
+
+StorageItem = TypedDict("StorageItem", {
+    "name": str,
+    "index": int,
+    "type": str,
+    "value": Any,
+}, total=False)
+
+StorageLayoutArgs = TypedDict("StorageLayoutArgs", {
+    "Address": Optional[str],
+    "Layout": str,
+    "Contract": str,
+}, total=False)
+
+StoragePage = TypedDict("StoragePage", {
+    "Storage": Optional[Dict[str, str]],
+    "StorageRoot": str,
+    "BlockNumber": int,
+    "Total": int,
+}, total=False)
+
+StorageSearchArgs = TypedDict("StorageSearchArgs", {
+    "Address": Optional[str],
+    "Variable": str,
+    "Operator": str,
+    "Value": str,
+    "Options": Optional["PageOptions"],
+}, total=False)
+
+StorageSearchResp = TypedDict("StorageSearchResp", {
+    "ranges": Optional[List[Optional["BlockRange"]]],
+    "options": Optional["PageOptions"],
+}, total=False)
+
+SubscriberStats = TypedDict("SubscriberStats", {
+    "id": str,
+    "remoteAddress": str,
+    "connectedAt": int,
+    "subscriptions": Optional[Dict[str, int]],
+    "sent": int,
+    "dropped": int,
+    "queued": int,
+    "lagBlocks": int,
+}, total=False)
+
+SubscriptionStats = TypedDict("SubscriptionStats", {
+    "connections": int,
+    "subscriptions": Optional[Dict[str, int]],
+    "sent": int,
+    "dropped": int,
+    "subscribers": Optional[List[Optional["SubscriberStats"]]],
+}, total=False)
+
+Template = TypedDict("Template", {
+    "templateName": str,
+    "abi": str,
+    "storageLayout": str,
+}, total=False)
+
+TemplateArgs = TypedDict("TemplateArgs", {
+    "Name": str,
+    "Abi": str,
+    "StorageLayout": str,
+}, total=False)
+
+ThrottleContractArgs = TypedDict("ThrottleContractArgs", {
+    "Address": Optional[str],
+    "Throttled": bool,
+}, total=False)
+
+TimeRange = TypedDict("TimeRange", {
+    "From": int,
+    "To": int,
+}, total=False)
+
+TimeRangeWithOptions = TypedDict("TimeRangeWithOptions", {
+    "From": int,
+    "To": int,
+    "Options": Optional["PageOptions"],
+}, total=False)
+
+TokenQueryOptions = TypedDict("TokenQueryOptions", {
+    "beginBlockNumber": Optional[int],
+    "endBlockNumber": Optional[int],
+    "after": str,
+    "pageSize": int,
+    "pageNumber": int,
+}, total=False)
+
+TokenRule = TypedDict("TokenRule", {
+    "id": str,
+    "scope": str,
+    "deployer": str,
+    "templateName": str,
+    "eip165": str,
+    "abi": str,
+    "eventTemplate": str,
+    "event": str,
+    "parameter": str,
+    "emitter": str,
+    "createdAt": int,
+}, total=False)
+
+TokenTransfer = TypedDict("TokenTransfer", {
+    "standard": str,
+    "contract": str,
+    "from": str,
+    "to": str,
+    "tokenId": Optional[int],
+    "amount": Optional[int],
+    "blockNumber": int,
+    "transactionHash": str,
+    "transactionIndex": int,
+    "eventIndex": int,
+    "timestamp": int,
+}, total=False)
+
+TokenTransfersArgs = TypedDict("TokenTransfersArgs", {
+    "Contract": Optional[str],
+    "Holder": Optional[str],
+    "Options": Optional["QueryOptions"],
+}, total=False)
+
+TokenTransfersResp = TypedDict("TokenTransfersResp", {
+    "transfers": Optional[List[Optional["TokenTransfer"]]],
+    "options": Optional["QueryOptions"],
+    "nextCursor": str,
+}, total=False)
+
+Transaction = TypedDict("Transaction", {
+    "hash": str,
+    "status": bool,
+    "blockNumber": int,
+    "blockHash": str,
+    "index": int,
+    "nonce": int,
+    "from": str,
+    "to": str,
+    "value": int,
+    "gas": int,
+    "gasPrice": int,
+    "gasUsed": int,
+    "cumulativeGasUsed": int,
+    "createdContract": str,
+    "data": str,
+    "privateData": str,
+    "dataTruncated": bool,
+    "returnData": str,
+    "returnTruncated": bool,
+    "isPrivate": bool,
+    "timestamp": int,
+    "events": Optional[List[Optional["Event"]]],
+    "internalCalls": Optional[List[Optional["InternalCall"]]],
+}, total=False)
+
+TransactionSummariesResp = TypedDict("TransactionSummariesResp", {
+    "transactions": Optional[List["TransactionSummary"]],
+    "total": int,
+    "options": Optional["PageOptions"],
+}, total=False)
+
+TransactionSummary = TypedDict("TransactionSummary", {
+    "hash": str,
+    "blockNumber": int,
+    "index": int,
+    "from": str,
+    "to": str,
+    "createdContract": str,
+    "status": bool,
+    "timestamp": int,
+    "timestampISO": str,
+    "events": Optional[List[Optional["ParsedEvent"]]],
+}, total=False)
+
+TransactionsArgs = TypedDict("TransactionsArgs", {
+    "Address": Optional[str],
+    "Options": Optional["QueryOptions"],
+    "IncludeEvents": bool,
+    "EventsPerTransaction": int,
+}, total=False)
+
+TransactionsResp = TypedDict("TransactionsResp", {
+    "transactions": Optional[List[str]],
+    "total": int,
+    "options": Optional["QueryOptions"],
+    "nextCursor": str,
+    "events": Optional[Dict[str, Optional[List[Optional["ParsedEvent"]]]]],
+}, total=False)
+
+Webhook = TypedDict("Webhook", {
+    "id": str,
+    "url": str,
+    "address": Optional[str],
+    "eventSignature": str,
+    "topic": Optional[str],
+    "secret": str,
+}, total=False)
+
+
+class RPCError(Exception):
+    def __init__(self, error: Any) -> None:
+        super().__init__(error if isinstance(error, str) else json.dumps(error))
+        self.error = error
+
+
+class _Transport:
+    def __init__(self, url: str, headers: Dict[str, str], timeout: float) -> None:
+        self._url = url
+        self._headers = dict(headers, **{"Content-Type": "application/json"})
+        self._timeout = timeout
+        self._id = 0
+
+    def call(self, method: str, params: List[Any]) -> Any:
+        self._id += 1
+        body = json.dumps({"jsonrpc": "2.0", "id": self._id, "method": method, "params": params})
+        request = urllib.request.Request(self._url, data=body.encode(), headers=self._headers, method="POST")
+        try:
+            with urllib.request.urlopen(request, timeout=self._timeout) as response:
+                result = json.loads(response.read())
+        except urllib.error.HTTPError as e:
+            raise RPCError(e.read().decode()) from e
+        if result.get("error"):
+            raise RPCError(result["error"])
+        return result.get("result")
+
+
+class ReportingAPI:
+    def __init__(self, transport: _Transport) -> None:
+        self._transport = transport
+
+    def accept_layout_proposal(self, params: str) -> None:
+        return self._transport.call("reporting.AcceptLayoutProposal", [params])
+
+    def add_abi(self, params: "AddressWithData") -> None:
+        return self._transport.call("reporting.AddABI", [params])
+
+    def add_address(self, params: "AddressWithOptionalBlock") -> None:
+        return self._transport.call("reporting.AddAddress", [params])
+
+    def add_legal_hold(self, params: "LegalHold") -> str:
+        return self._transport.call("reporting.AddLegalHold", [params])
+
+    def add_storage_abi(self, params: "AddressWithData") -> None:
+        return self._transport.call("reporting.AddStorageABI", [params])
+
+    def add_storage_layout(self, params: "StorageLayoutArgs") -> None:
+        return self._transport.call("reporting.AddStorageLayout", [params])
+
+    def add_template(self, params: "TemplateArgs") -> None:
+        return self._transport.call("reporting.AddTemplate", [params])
+
+    def add_token_rule(self, params: "TokenRule") -> str:
+        return self._transport.call("reporting.AddTokenRule", [params])
+
+    def add_webhook(self, params: "Webhook") -> "AddWebhookResp":
+        return self._transport.call("reporting.AddWebhook", [params])
+
+    def assign_template(self, params: "AddressWithData") -> None:
+        return self._transport.call("reporting.AssignTemplate", [params])
+
+    def assign_template_by_code(self, params: "CodeMatchRequest") -> str:
+        return self._transport.call("reporting.AssignTemplateByCode", [params])
+
+    def backfill(self, params: "BlockRangeArgs") -> str:
+        return self._transport.call("reporting.Backfill", [params])
+
+    def close_snapshot(self, params: str) -> None:
+        return self._transport.call("reporting.CloseSnapshot", [params])
+
+    def decode_logs(self, params: "DecodeLogsArgs") -> Optional[List[Optional["ParsedEvent"]]]:
+        return self._transport.call("reporting.DecodeLogs", [params])
+
+    def delete_address(self, params: "DeleteAddressArgs") -> None:
+        return self._transport.call("reporting.DeleteAddress", [params])
+
+    def delete_block_range(self, params: "DeleteBlockRangeArgs") -> "BlockRangeDeletion":
+        return self._transport.call("reporting.DeleteBlockRange", [params])
+
+    def delete_token_rule(self, params: str) -> None:
+        return self._transport.call("reporting.DeleteTokenRule", [params])
+
+    def delete_webhook(self, params: str) -> None:
+        return self._transport.call("reporting.DeleteWebhook", [params])
+
+    def export(self, params: "ExportRequest") -> str:
+        return self._transport.call("reporting.Export", [params])
+
+    def get_abi(self, params: str) -> str:
+        return self._transport.call("reporting.GetABI", [params])
+
+    def get_address_totals(self, params: "AddressWithOptions") -> "AddressTotals":
+        return self._transport.call("reporting.GetAddressTotals", [params])
+
+    def get_addresses(self) -> Optional[List[str]]:
+        return self._transport.call("reporting.GetAddresses", [])
+
+    def get_all_events_from_address(self, params: "AddressWithOptions") -> "EventsResp":
+        return self._transport.call("reporting.GetAllEventsFromAddress", [params])
+
+    def get_all_transactions_internal_to_address(self, params: "TransactionsArgs") -> "TransactionsResp":
+        return self._transport.call("reporting.GetAllTransactionsInternalToAddress", [params])
+
+    def get_all_transactions_to_address(self, params: "TransactionsArgs") -> "TransactionsResp":
+        return self._transport.call("reporting.GetAllTransactionsToAddress", [params])
+
+    def get_anomalies(self) -> Optional[List[Optional["Anomaly"]]]:
+        return self._transport.call("reporting.GetAnomalies", [])
+
+    def get_block(self, params: int) -> "Block":
+        return self._transport.call("reporting.GetBlock", [params])
+
+    def get_block_for_transaction(self, params: str) -> "BlockSummary":
+        return self._transport.call("reporting.GetBlockForTransaction", [params])
+
+    def get_blocks_by_time_range(self, params: "TimeRangeWithOptions") -> "BlockSummariesResp":
+        return self._transport.call("reporting.GetBlocksByTimeRange", [params])
+
+    def get_contract_costs(self, params: "ContractCostsArgs") -> Optional[List[Optional["ContractCost"]]]:
+        return self._transport.call("reporting.GetContractCosts", [params])
+
+    def get_contract_creation_transaction(self, params: str) -> str:
+        return self._transport.call("reporting.GetContractCreationTransaction", [params])
+
+    def get_contract_enrichment(self, params: str) -> Optional[Dict[str, str]]:
+        return self._transport.call("reporting.GetContractEnrichment", [params])
+
+    def get_contract_severity_rules(self, params: str) -> Optional[List[Optional["SeverityRule"]]]:
+        return self._transport.call("reporting.GetContractSeverityRules", [params])
+
+    def get_contract_status(self, params: str) -> "ContractStatus":
+        return self._transport.call("reporting.GetContractStatus", [params])
+
+    def get_contract_template(self, params: str) -> str:
+        return self._transport.call("reporting.GetContractTemplate", [params])
+
+    def get_counterparties(self, params: "CounterpartiesArgs") -> Optional[List[Optional["Counterparty"]]]:
+        return self._transport.call("reporting.GetCounterparties", [params])
+
+    def get_event_severity_counts(self, params: "AddressWithOptions") -> Optional[Dict[str, int]]:
+        return self._transport.call("reporting.GetEventSeverityCounts", [params])
+
+    def get_events_by_severity(self, params: "EventsBySeverityArgs") -> "EventsResp":
+        return self._transport.call("reporting.GetEventsBySeverity", [params])
+
+    def get_events_by_topics(self, params: "EventsByTopicsArgs") -> "EventsResp":
+        return self._transport.call("reporting.GetEventsByTopics", [params])
+
+    def get_gas_usage_by_contract(self, params: "GasUsageQuery") -> Optional[List[Optional["GasUsage"]]]:
+        return self._transport.call("reporting.GetGasUsageByContract", [params])
+
+    def get_gas_usage_by_day(self, params: "GasUsageQuery") -> Optional[List[Optional["GasUsage"]]]:
+        return self._transport.call("reporting.GetGasUsageByDay", [params])
+
+    def get_gas_usage_by_function(self, params: "GasUsageQuery") -> Optional[List[Optional["GasUsage"]]]:
+        return self._transport.call("reporting.GetGasUsageByFunction", [params])
+
+    def get_high_availability_status(self) -> "HighAvailabilityStatus":
+        return self._transport.call("reporting.GetHighAvailabilityStatus", [])
+
+    def get_index_stats(self) -> Optional[List["IndexStats"]]:
+        return self._transport.call("reporting.GetIndexStats", [])
+
+    def get_integrity_report(self, params: str) -> "IntegrityReport":
+        return self._transport.call("reporting.GetIntegrityReport", [params])
+
+    def get_job(self, params: str) -> "Job":
+        return self._transport.call("reporting.GetJob", [params])
+
+    def get_jobs(self) -> Optional[List[Optional["Job"]]]:
+        return self._transport.call("reporting.GetJobs", [])
+
+    def get_last_filtered(self, params: str) -> int:
+        return self._transport.call("reporting.GetLastFiltered", [params])
+
+    def get_last_persisted_block_number(self) -> int:
+        return self._transport.call("reporting.GetLastPersistedBlockNumber", [])
+
+    def get_layout_proposal(self, params: str) -> "LayoutProposal":
+        return self._transport.call("reporting.GetLayoutProposal", [params])
+
+    def get_legal_holds(self) -> Optional[List[Optional["LegalHold"]]]:
+        return self._transport.call("reporting.GetLegalHolds", [])
+
+    def get_names(self, params: str) -> Optional[List[str]]:
+        return self._transport.call("reporting.GetNames", [params])
+
+    def get_network_activity(self, params: "TimeRange") -> "NetworkActivity":
+        return self._transport.call("reporting.GetNetworkActivity", [params])
+
+    def get_pending_activity(self, params: "PendingActivityArgs") -> Optional[List[Optional["PendingTransaction"]]]:
+        return self._transport.call("reporting.GetPendingActivity", [params])
+
+    def get_processing_journal(self, params: "JournalArgs") -> Optional[List[Optional["JournalEntry"]]]:
+        return self._transport.call("reporting.GetProcessingJournal", [params])
+
+    def get_registered_names(self) -> Optional[List[Optional["RegisteredName"]]]:
+        return self._transport.call("reporting.GetRegisteredNames", [])
+
+    def get_storage(self, params: "StorageArgs") -> "StoragePage":
+        return self._transport.call("reporting.GetStorage", [params])
+
+    def get_storage_abi(self, params: str) -> str:
+        return self._transport.call("reporting.GetStorageABI", [params])
+
+    def get_storage_average(self, params: "StorageAverageArgs") -> "StorageAverageResp":
+        return self._transport.call("reporting.GetStorageAverage", [params])
+
+    def get_storage_history(self, params: "StorageHistoryArgs") -> "ReportingResponseTemplate":
+        return self._transport.call("reporting.GetStorageHistory", [params])
+
+    def get_storage_history_count(self, params: "AddressWithBlockRange") -> "RangeQueryResult":
+        return self._transport.call("reporting.GetStorageHistoryCount", [params])
+
+    def get_subscription_stats(self) -> "SubscriptionStats":
+        return self._transport.call("reporting.GetSubscriptionStats", [])
+
+    def get_template_details(self, params: str) -> "Template":
+        return self._transport.call("reporting.GetTemplateDetails", [params])
+
+    def get_templates(self) -> Optional[List[str]]:
+        return self._transport.call("reporting.GetTemplates", [])
+
+    def get_terminal_block(self, params: str) -> int:
+        return self._transport.call("reporting.GetTerminalBlock", [params])
+
+    def get_token_rules(self) -> Optional[List[Optional["TokenRule"]]]:
+        return self._transport.call("reporting.GetTokenRules", [])
+
+    def get_token_transfers(self, params: "TokenTransfersArgs") -> "TokenTransfersResp":
+        return self._transport.call("reporting.GetTokenTransfers", [params])
+
+    def get_transaction(self, params: str) -> "ParsedTransaction":
+        return self._transport.call("reporting.GetTransaction", [params])
+
+    def get_transaction_call_tree(self, params: str) -> "CallTree":
+        return self._transport.call("reporting.GetTransactionCallTree", [params])
+
+    def get_transactions_for_block_range(self, params: "BlockRangeWithOptions") -> "TransactionSummariesResp":
+        return self._transport.call("reporting.GetTransactionsForBlockRange", [params])
+
+    def get_webhooks(self) -> Optional[List[Optional["Webhook"]]]:
+        return self._transport.call("reporting.GetWebhooks", [])
+
+    def has_activity(self, params: "AddressWithBlockNumbers") -> bool:
+        return self._transport.call("reporting.HasActivity", [params])
+
+    def infer_storage_layout(self, params: str) -> str:
+        return self._transport.call("reporting.InferStorageLayout", [params])
+
+    def open_snapshot(self, params: "SnapshotArgs") -> "SnapshotResp":
+        return self._transport.call("reporting.OpenSnapshot", [params])
+
+    def pause_ingestion(self) -> None:
+        return self._transport.call("reporting.PauseIngestion", [])
+
+    def refilter_contract(self, params: "RefilterContractArgs") -> None:
+        return self._transport.call("reporting.RefilterContract", [params])
+
+    def release_legal_hold(self, params: str) -> None:
+        return self._transport.call("reporting.ReleaseLegalHold", [params])
+
+    def replay_events(self, params: "ReplayEventsArgs") -> "ReplayEventsResp":
+        return self._transport.call("reporting.ReplayEvents", [params])
+
+    def resolve_name(self, params: str) -> str:
+        return self._transport.call("reporting.ResolveName", [params])
+
+    def resume_ingestion(self) -> None:
+        return self._transport.call("reporting.ResumeIngestion", [])
+
+    def retry_job(self, params: str) -> None:
+        return self._transport.call("reporting.RetryJob", [params])
+
+    def screen_addresses(self, params: "ScreenAddressesArgs") -> Optional[List[Optional["ScreeningMatch"]]]:
+        return self._transport.call("reporting.ScreenAddresses", [params])
+
+    def search(self, params: "SearchArgs") -> Optional[List[Optional["SearchResult"]]]:
+        return self._transport.call("reporting.Search", [params])
+
+    def search_storage(self, params: "StorageSearchArgs") -> "StorageSearchResp":
+        return self._transport.call("reporting.SearchStorage", [params])
+
+    def set_contract_enrichment(self, params: "AddressWithEnrichment") -> None:
+        return self._transport.call("reporting.SetContractEnrichment", [params])
+
+    def set_contract_severity_rules(self, params: "AddressWithSeverityRules") -> None:
+        return self._transport.call("reporting.SetContractSeverityRules", [params])
+
+    def set_terminal_block(self, params: "AddressWithOptionalBlock") -> None:
+        return self._transport.call("reporting.SetTerminalBlock", [params])
+
+    def throttle_contract(self, params: "ThrottleContractArgs") -> None:
+        return self._transport.call("reporting.ThrottleContract", [params])
+
+    def verify_integrity(self, params: "BlockRangeArgs") -> str:
+        return self._transport.call("reporting.VerifyIntegrity", [params])
+
+
+class TokenAPI:
+    def __init__(self, transport: _Transport) -> None:
+        self._transport = transport
+
+    def all_erc721_holders_at_block(self, params: "ERC721TokenQuery") -> Optional[List[str]]:
+        return self._transport.call("token.AllERC721HoldersAtBlock", [params])
+
+    def all_erc721_tokens_at_block(self, params: "ERC721TokenQuery") -> Optional[List["ERC721Token"]]:
+        return self._transport.call("token.AllERC721TokensAtBlock", [params])
+
+    def erc721_tokens_for_account_at_block(self, params: "ERC721TokenQuery") -> Optional[List["ERC721Token"]]:
+        return self._transport.call("token.ERC721TokensForAccountAtBlock", [params])
+
+    def get_erc1155_token_balance(self, params: "ERC1155TokenQuery") -> Optional[Dict[str, Optional[int]]]:
+        return self._transport.call("token.GetERC1155TokenBalance", [params])
+
+    def get_erc1155_token_balance_at_block(self, params: "ERC1155TokenQuery") -> int:
+        return self._transport.call("token.GetERC1155TokenBalanceAtBlock", [params])
+
+    def get_erc1155_token_holders_at_block(self, params: "ERC1155TokenQuery") -> Optional[List[str]]:
+        return self._transport.call("token.GetERC1155TokenHoldersAtBlock", [params])
+
+    def get_erc20_allowance(self, params: "ERC20AllowanceQuery") -> Optional[Dict[str, Optional[int]]]:
+        return self._transport.call("token.GetERC20Allowance", [params])
+
+    def get_erc20_allowances(self, params: "ERC20AllowancesQuery") -> Optional[List[Optional["ERC20Allowance"]]]:
+        return self._transport.call("token.GetERC20Allowances", [params])
+
+    def get_erc20_token_balance(self, params: "ERC20TokenQuery") -> Optional[Dict[str, Optional[int]]]:
+        return self._transport.call("token.GetERC20TokenBalance", [params])
+
+    def get_erc20_token_holders(self, params: "ERC20TokenHoldersQuery") -> Optional[List[Optional["ERC20Holding"]]]:
+        return self._transport.call("token.GetERC20TokenHolders", [params])
+
+    def get_erc20_token_holders_at_block(self, params: "ERC20TokenQuery") -> Optional[List[str]]:
+        return self._transport.call("token.GetERC20TokenHoldersAtBlock", [params])
+
+    def get_erc721_token_history(self, params: "ERC721TokenQuery") -> Optional[List["ERC721Token"]]:
+        return self._transport.call("token.GetERC721TokenHistory", [params])
+
+    def get_holder_for_erc721_token_at_block(self, params: "ERC721TokenQuery") -> str:
+        return self._transport.call("token.GetHolderForERC721TokenAtBlock", [params])
+
+
+class Client:
+    """Calls the RPC API at the given URL, sending the headers with each request, e.g. an
+    X-API-Key or Authorization header."""
+
+    def __init__(self, url: str, headers: Optional[Dict[str, str]] = None, timeout: float = 30) -> None:
+        transport = _Transport(url, headers or {}, timeout)
+        self.reporting = ReportingAPI(transport)
+        self.token = TokenAPI(transport)
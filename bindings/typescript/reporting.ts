@@ -0,0 +1,1280 @@
+// Code generated by bindgen from the RPC API description. DO NOT EDIT.
+
+export interface AddWebhookResp {
+  id: string;
+  secret?: string;
+}
+
+export interface AddressTotals {
+  transactions: number;
+  internalTransactions: number;
+  events: number;
+  options?: QueryOptions | null;
+}
+
+export interface AddressWithBlockNumbers {
+  Address?: string | null;
+  FromBlock?: number;
+  ToBlock?: number;
+}
+
+export interface AddressWithBlockRange {
+  Address?: string | null;
+  Options?: PageOptions | null;
+}
+
+export interface AddressWithData {
+  Address?: string | null;
+  Data?: string;
+}
+
+export interface AddressWithEnrichment {
+  Address?: string | null;
+  Mapping?: Record<string, string> | null;
+}
+
+export interface AddressWithOptionalBlock {
+  Address?: string | null;
+  BlockNumber?: number | null;
+}
+
+export interface AddressWithOptions {
+  Address?: string | null;
+  Options?: QueryOptions | null;
+}
+
+export interface AddressWithSeverityRules {
+  Address?: string | null;
+  Rules?: (SeverityRule | null)[] | null;
+}
+
+export interface Anomaly {
+  address: string;
+  metric: string;
+  kind: string;
+  value: number;
+  average: number;
+  stdDev: number;
+  since: number;
+}
+
+export interface Block {
+  hash: string;
+  parentHash: string;
+  stateRoot: string;
+  txRoot: string;
+  receiptRoot: string;
+  number: number;
+  gasLimit: number;
+  gasUsed: number;
+  timestamp: number;
+  extraData: string;
+  transactions: string[] | null;
+}
+
+export interface BlockRange {
+  from: number;
+  to: number;
+}
+
+export interface BlockRangeArgs {
+  From?: number;
+  To?: number;
+}
+
+export interface BlockRangeDeletion {
+  fromBlock: number;
+  toBlock: number;
+  dryRun: boolean;
+  documents: Record<string, number> | null;
+  total: number;
+}
+
+export interface BlockRangeWithOptions {
+  From?: number;
+  To?: number;
+  Options?: PageOptions | null;
+  IncludeEvents?: boolean;
+  EventsPerTransaction?: number;
+}
+
+export interface BlockSummariesResp {
+  blocks: BlockSummary[] | null;
+  total: number;
+  options?: PageOptions | null;
+}
+
+export interface BlockSummary {
+  number: number;
+  hash: string;
+  parentHash: string;
+  timestamp: number;
+  timestampISO: string;
+  transactionCount: number;
+}
+
+export interface CallFrame {
+  from: string;
+  to: string;
+  gas: number;
+  gasUsed: number;
+  value: number;
+  input: string;
+  output: string;
+  type: string;
+  calls: (CallFrame | null)[] | null;
+}
+
+export interface CallTree {
+  transactionHash: string;
+  blockNumber: number;
+  calls: (CallFrame | null)[] | null;
+}
+
+export interface ChecksumMismatch {
+  kind: string;
+  id: string;
+  blockNumber: number;
+  stored: string;
+  computed: string;
+}
+
+export interface CodeMatchRequest {
+  template?: string;
+  codeHash?: string;
+  address?: string;
+  ignoreMetadata?: boolean;
+}
+
+export interface ContractCost {
+  address: string;
+  blocksFiltered: number;
+  processingSeconds: number;
+  nodeCalls: number;
+  documents: number;
+  throttled: boolean;
+}
+
+export interface ContractCostsArgs {
+  SortBy?: string;
+  Limit?: number;
+}
+
+export interface ContractStatus {
+  address: string;
+  status: string;
+  creationTransaction: string;
+  destroyedAt: number;
+}
+
+export interface CounterpartiesArgs {
+  Address?: string | null;
+  Options?: CounterpartyQueryOptions | null;
+}
+
+export interface Counterparty {
+  address: string;
+  firstSeenBlock: number;
+  firstSeenTimestamp: number;
+  lastSeenBlock: number;
+  lastSeenTimestamp: number;
+  interactions: number;
+}
+
+export interface CounterpartyQueryOptions {
+  sortBy?: string;
+  pageSize?: number;
+  pageNumber?: number;
+}
+
+export interface DecodeLogsArgs {
+  Logs?: (Event | null)[] | null;
+}
+
+export interface DeleteAddressArgs {
+  Address?: string | null;
+  Purge?: boolean;
+}
+
+export interface DeleteBlockRangeArgs {
+  From?: number;
+  To?: number;
+  DryRun?: boolean;
+}
+
+export interface ERC1155TokenQuery {
+  Contract?: string | null;
+  Holder?: string | null;
+  TokenId?: number | null;
+  Block?: number;
+  Options?: TokenQueryOptions | null;
+}
+
+export interface ERC20Allowance {
+  owner: string;
+  spender: string;
+  amount?: number | null;
+  blockNumber: number;
+}
+
+export interface ERC20AllowanceQuery {
+  Contract?: string | null;
+  Owner?: string | null;
+  Spender?: string | null;
+  Options?: TokenQueryOptions | null;
+}
+
+export interface ERC20AllowancesQuery {
+  Contract?: string | null;
+  Owner?: string | null;
+  Block?: number;
+  Options?: QueryOptions | null;
+}
+
+export interface ERC20Holding {
+  holder: string;
+  balance?: number | null;
+}
+
+export interface ERC20TokenHoldersQuery {
+  Contract?: string | null;
+  Block?: number;
+  Options?: QueryOptions | null;
+}
+
+export interface ERC20TokenQuery {
+  Contract?: string | null;
+  Holder?: string | null;
+  Block?: number;
+  Options?: TokenQueryOptions | null;
+}
+
+export interface ERC721Token {
+  contract: string;
+  holder: string;
+  token: string;
+  heldFrom: number;
+  heldUntil?: number | null;
+}
+
+export interface ERC721TokenQuery {
+  Contract?: string | null;
+  Holder?: string | null;
+  TokenId?: number | null;
+  Block?: number;
+  Options?: TokenQueryOptions | null;
+}
+
+export interface Event {
+  index?: number;
+  address?: string;
+  topics?: string[] | null;
+  data?: string;
+  blockNumber?: number;
+  blockHash?: string;
+  transactionHash?: string;
+  transactionIndex?: number;
+  timestamp?: number;
+}
+
+export interface EventsBySeverityArgs {
+  Address?: string | null;
+  Severity?: string;
+  Options?: QueryOptions | null;
+}
+
+export interface EventsByTopicsArgs {
+  Address?: string | null;
+  EventSignature?: string;
+  Topics?: (string | null)[] | null;
+  Options?: QueryOptions | null;
+}
+
+export interface EventsResp {
+  events: (ParsedEvent | null)[] | null;
+  total: number;
+  options?: QueryOptions | null;
+  nextCursor?: string;
+}
+
+export interface ExportRequest {
+  address?: string;
+  startBlock?: number;
+  endBlock?: number;
+  datasets?: string[] | null;
+  format?: string;
+}
+
+export interface GasUsage {
+  key: string;
+  transactions: number;
+  totalGasUsed: number;
+  averageGasUsed: number;
+}
+
+export interface GasUsageQuery {
+  contract?: string | null;
+  startBlock?: number;
+  endBlock?: number;
+  limit?: number;
+}
+
+export interface HighAvailabilityStatus {
+  instanceId: string;
+  leader: boolean;
+  lease?: Lease | null;
+  sharding?: ShardingStatus | null;
+}
+
+export interface IndexStats {
+  name: string;
+  documentCount: number;
+  storageSize: number;
+  oldestBlock: number;
+  newestBlock: number;
+}
+
+export interface InferredVariable {
+  label: string;
+  slot: number;
+  type: string;
+  confidence: string;
+  evidence: string;
+}
+
+export interface IntegrityReport {
+  jobId: string;
+  startBlock: number;
+  endBlock: number;
+  verified: number;
+  unverified: number;
+  mismatchCount: number;
+  mismatches: (ChecksumMismatch | null)[] | null;
+  complete: boolean;
+}
+
+export interface InternalCall {
+  from: string;
+  to: string;
+  gas: number;
+  gasUsed: number;
+  value: number;
+  input: string;
+  output: string;
+  type: string;
+}
+
+export interface Job {
+  id: string;
+  type: string;
+  address?: string;
+  startBlock?: number;
+  endBlock?: number;
+  template?: string;
+  matched?: string[] | null;
+  files?: string[] | null;
+  status: string;
+  step?: string;
+  deleted: number;
+  total: number;
+  versionConflicts: number;
+  processed?: number;
+  error?: string;
+  startedAt: number;
+  finishedAt?: number;
+}
+
+export interface JournalArgs {
+  stage?: string;
+  errorsOnly?: boolean;
+  minDuration?: number;
+  Options?: PageOptions | null;
+}
+
+export interface JournalEntry {
+  blockNumber: number;
+  stage: string;
+  timestamp: number;
+  duration: number;
+  transactions: number;
+  events: number;
+  tokenRecords: number;
+  errors?: string[] | null;
+}
+
+export interface LayoutProposal {
+  jobId: string;
+  address: string;
+  states: number;
+  unexplainedSlots: number;
+  variables: (InferredVariable | null)[] | null;
+  layout: string;
+  complete: boolean;
+  accepted: boolean;
+}
+
+export interface Lease {
+  name: string;
+  holder: string;
+  acquiredAt: number;
+  expiresAt: number;
+}
+
+export interface LegalHold {
+  id?: string;
+  address?: string | null;
+  transactionHash?: string | null;
+  fromBlock?: number | null;
+  toBlock?: number | null;
+  reason?: string;
+  createdAt?: number;
+}
+
+export interface NetworkActivity {
+  from: number;
+  to: number;
+  transactions: number;
+  privateTransactions: number;
+  publicTransactions: number;
+  privateRatio: number;
+  activeContracts: number;
+  activeAccounts: number;
+  gasUsed: number;
+}
+
+export interface PageOptions {
+  beginBlockNumber?: number | null;
+  endBlockNumber?: number | null;
+  pageSize?: number;
+  pageNumber?: number;
+  snapshotId?: string;
+}
+
+export interface ParsedEvent {
+  eventSig: string;
+  parsedData: any;
+  rawEvent?: Event | null;
+  timestamp: number;
+  timestampISO: string;
+}
+
+export interface ParsedState {
+  blockNumber: number;
+  historicStorage: (StorageItem | null)[] | null;
+}
+
+export interface ParsedTransaction {
+  txSig: string;
+  func4Bytes: string;
+  parsedData: any;
+  parsedEvents: (ParsedEvent | null)[] | null;
+  rawTransaction?: Transaction | null;
+  timestamp: number;
+  timestampISO: string;
+}
+
+export interface PendingActivityArgs {
+  Address?: string | null;
+}
+
+export interface PendingTransaction {
+  hash: string;
+  from: string;
+  to: string;
+  nonce: number;
+  gas: number;
+  gasPrice: number;
+  value: string;
+  data: string;
+  isPrivate: boolean;
+  txSig: string;
+  func4Bytes: string;
+  parsedData: any;
+  seenAt: number;
+  seenAtISO: string;
+}
+
+export interface QueryOptions {
+  beginBlockNumber?: number | null;
+  endBlockNumber?: number | null;
+  beginTimestamp?: number | null;
+  endTimestamp?: number | null;
+  pageSize?: number;
+  pageNumber?: number;
+  snapshotId?: string;
+  cursor?: string;
+}
+
+export interface RangeQueryResult {
+  ranges: RangeResult[] | null;
+}
+
+export interface RangeResult {
+  start: number;
+  end: number;
+  resultCount: number;
+}
+
+export interface RefilterContractArgs {
+  Address?: string | null;
+  FromBlock?: number;
+}
+
+export interface RegisteredName {
+  name: string;
+  address: string;
+}
+
+export interface ReplayEventsArgs {
+  Address?: string | null;
+  Group?: string;
+  FromSequence?: string;
+  BatchSize?: number;
+}
+
+export interface ReplayEventsResp {
+  events: (ParsedEvent | null)[] | null;
+  nextSequence: string;
+  filteredTo: number;
+  caughtUp: boolean;
+}
+
+export interface ReportingResponseTemplate {
+  address: string;
+  historicState: (ParsedState | null)[] | null;
+  total: number;
+  options?: PageOptions | null;
+}
+
+export interface ScreenAddressesArgs {
+  Addresses?: string[] | null;
+}
+
+export interface ScreeningMatch {
+  address: string;
+  list: string;
+  reason?: string;
+}
+
+export interface SearchArgs {
+  Term?: string;
+  Limit?: number;
+}
+
+export interface SearchResult {
+  type: string;
+  blockNumber?: number | null;
+  hash?: string | null;
+  address?: string | null;
+  transactionHash?: string | null;
+  index?: number | null;
+}
+
+export interface SeverityRule {
+  event?: string;
+  parameter?: string;
+  operator?: string;
+  value?: string;
+  severity?: string;
+}
+
+export interface ShardingStatus {
+  mode: string;
+  shards: number;
+  owned: number[] | null;
+  instances: number;
+}
+
+export interface SnapshotArgs {
+  TTL?: number;
+}
+
+export interface SnapshotResp {
+  id: string;
+  blockNumber: number;
+  expiresAt: number;
+}
+
+export interface StorageArgs {
+  Address?: string | null;
+  BlockNumber?: number | null;
+  SlotPrefix?: string;
+  Variable?: string;
+  MappingKeys?: Record<string, string[] | null> | null;
+  Options?: PageOptions | null;
+}
+
+export interface StorageAverageArgs {
+  Address?: string | null;
+  Variable?: string;
+  WeightBy?: string;
+  Options?: PageOptions | null;
+}
+
+export interface StorageAverageResp {
+  average: string;
+  weight: number;
+  weightBy: string;
+  options?: PageOptions | null;
+}
+
+export interface StorageHistoryArgs {
+  Address?: string | null;
+  Options?: PageOptions | null;
+  MappingKeys?: Record<string, string[] | null> | null;
+}
+
+export interface StorageItem {
+  name: string;
+  index: number;
+  type: string;
+  value?: any;
+}
+
+export interface StorageLayoutArgs {
+  Address?: string | null;
+  Layout?: string;
+  Contract?: string;
+}
+
+export interface StoragePage {
+  Storage: Record<string, string> | null;
+  StorageRoot: string;
+  BlockNumber: number;
+  Total: number;
+}
+
+export interface StorageSearchArgs {
+  Address?: string | null;
+  Variable?: string;
+  Operator?: string;
+  Value?: string;
+  Options?: PageOptions | null;
+}
+
+export interface StorageSearchResp {
+  ranges: (BlockRange | null)[] | null;
+  options?: PageOptions | null;
+}
+
+export interface SubscriberStats {
+  id: string;
+  remoteAddress: string;
+  connectedAt: number;
+  subscriptions: Record<string, number> | null;
+  sent: number;
+  dropped: number;
+  queued: number;
+  lagBlocks: number;
+}
+
+export interface SubscriptionStats {
+  connections: number;
+  subscriptions: Record<string, number> | null;
+  sent: number;
+  dropped: number;
+  subscribers: (SubscriberStats | null)[] | null;
+}
+
+export interface Template {
+  templateName: string;
+  abi: string;
+  storageLayout: string;
+}
+
+export interface TemplateArgs {
+  Name?: string;
+  Abi?: string;
+  StorageLayout?: string;
+}
+
+export interface ThrottleContractArgs {
+  Address?: string | null;
+  Throttled?: boolean;
+}
+
+export interface TimeRange {
+  From?: number;
+  To?: number;
+}
+
+export interface TimeRangeWithOptions {
+  From?: number;
+  To?: number;
+  Options?: PageOptions | null;
+}
+
+export interface TokenQueryOptions {
+  beginBlockNumber?: number | null;
+  endBlockNumber?: number | null;
+  after?: string;
+  pageSize?: number;
+  pageNumber?: number;
+}
+
+export interface TokenRule {
+  id?: string;
+  scope?: string;
+  deployer?: string;
+  templateName?: string;
+  eip165?: string;
+  abi?: string;
+  eventTemplate?: string;
+  event?: string;
+  parameter?: string;
+  emitter?: string;
+  createdAt?: number;
+}
+
+export interface TokenTransfer {
+  standard: string;
+  contract: string;
+  from: string;
+  to: string;
+  tokenId?: number | null;
+  amount?: number | null;
+  blockNumber: number;
+  transactionHash: string;
+  transactionIndex: number;
+  eventIndex: number;
+  timestamp: number;
+}
+
+export interface TokenTransfersArgs {
+  Contract?: string | null;
+  Holder?: string | null;
+  Options?: QueryOptions | null;
+}
+
+export interface TokenTransfersResp {
+  transfers: (TokenTransfer | null)[] | null;
+  options?: QueryOptions | null;
+  nextCursor?: string;
+}
+
+export interface Transaction {
+  hash: string;
+  status: boolean;
+  blockNumber: number;
+  blockHash: string;
+  index: number;
+  nonce: number;
+  from: string;
+  to: string;
+  value: number;
+  gas: number;
+  gasPrice: number;
+  gasUsed: number;
+  cumulativeGasUsed: number;
+  createdContract: string;
+  data: string;
+  privateData: string;
+  dataTruncated: boolean;
+  returnData: string;
+  returnTruncated: boolean;
+  isPrivate: boolean;
+  timestamp: number;
+  events: (Event | null)[] | null;
+  internalCalls: (InternalCall | null)[] | null;
+}
+
+export interface TransactionSummariesResp {
+  transactions: TransactionSummary[] | null;
+  total: number;
+  options?: PageOptions | null;
+}
+
+export interface TransactionSummary {
+  hash: string;
+  blockNumber: number;
+  index: number;
+  from: string;
+  to: string;
+  createdContract: string;
+  status: boolean;
+  timestamp: number;
+  timestampISO: string;
+  events?: (ParsedEvent | null)[] | null;
+}
+
+export interface TransactionsArgs {
+  Address?: string | null;
+  Options?: QueryOptions | null;
+  IncludeEvents?: boolean;
+  EventsPerTransaction?: number;
+}
+
+export interface TransactionsResp {
+  transactions: string[] | null;
+  total: number;
+  options?: QueryOptions | null;
+  nextCursor?: string;
+  events?: Record<string, (ParsedEvent | null)[] | null> | null;
+}
+
+export interface Webhook {
+  id?: string;
+  url?: string;
+  address?: string | null;
+  eventSignature?: string;
+  topic?: string | null;
+  secret?: string;
+}
+
+export class RPCError extends Error {
+  constructor(readonly error: unknown) {
+    super(typeof error === 'string' ? error : JSON.stringify(error));
+    this.name = 'RPCError';
+  }
+}
+
+class Transport {
+  private id = 0;
+
+  constructor(private readonly url: string, private readonly headers: Record<string, string>) {}
+
+  async call<T>(method: string, params: unknown[]): Promise<T> {
+    const response = await fetch(this.url, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', ...this.headers },
+      body: JSON.stringify({ jsonrpc: '2.0', id: ++this.id, method, params }),
+    });
+    if (!response.ok) {
+      throw new RPCError(await response.text());
+    }
+    const body = await response.json();
+    if (body.error) {
+      throw new RPCError(body.error);
+    }
+    return body.result as T;
+  }
+}
+
+export class ReportingAPI {
+  constructor(private readonly transport: Transport) {}
+
+  acceptLayoutProposal(params: string): Promise<null> {
+    return this.transport.call('reporting.AcceptLayoutProposal', [params]);
+  }
+
+  addABI(params: AddressWithData): Promise<null> {
+    return this.transport.call('reporting.AddABI', [params]);
+  }
+
+  addAddress(params: AddressWithOptionalBlock): Promise<null> {
+    return this.transport.call('reporting.AddAddress', [params]);
+  }
+
+  addLegalHold(params: LegalHold): Promise<string> {
+    return this.transport.call('reporting.AddLegalHold', [params]);
+  }
+
+  addStorageABI(params: AddressWithData): Promise<null> {
+    return this.transport.call('reporting.AddStorageABI', [params]);
+  }
+
+  addStorageLayout(params: StorageLayoutArgs): Promise<null> {
+    return this.transport.call('reporting.AddStorageLayout', [params]);
+  }
+
+  addTemplate(params: TemplateArgs): Promise<null> {
+    return this.transport.call('reporting.AddTemplate', [params]);
+  }
+
+  addTokenRule(params: TokenRule): Promise<string> {
+    return this.transport.call('reporting.AddTokenRule', [params]);
+  }
+
+  addWebhook(params: Webhook): Promise<AddWebhookResp> {
+    return this.transport.call('reporting.AddWebhook', [params]);
+  }
+
+  assignTemplate(params: AddressWithData): Promise<null> {
+    return this.transport.call('reporting.AssignTemplate', [params]);
+  }
+
+  assignTemplateByCode(params: CodeMatchRequest): Promise<string> {
+    return this.transport.call('reporting.AssignTemplateByCode', [params]);
+  }
+
+  backfill(params: BlockRangeArgs): Promise<string> {
+    return this.transport.call('reporting.Backfill', [params]);
+  }
+
+  closeSnapshot(params: string): Promise<null> {
+    return this.transport.call('reporting.CloseSnapshot', [params]);
+  }
+
+  decodeLogs(params: DecodeLogsArgs): Promise<(ParsedEvent | null)[] | null> {
+    return this.transport.call('reporting.DecodeLogs', [params]);
+  }
+
+  deleteAddress(params: DeleteAddressArgs): Promise<null> {
+    return this.transport.call('reporting.DeleteAddress', [params]);
+  }
+
+  deleteBlockRange(params: DeleteBlockRangeArgs): Promise<BlockRangeDeletion> {
+    return this.transport.call('reporting.DeleteBlockRange', [params]);
+  }
+
+  deleteTokenRule(params: string): Promise<null> {
+    return this.transport.call('reporting.DeleteTokenRule', [params]);
+  }
+
+  deleteWebhook(params: string): Promise<null> {
+    return this.transport.call('reporting.DeleteWebhook', [params]);
+  }
+
+  export(params: ExportRequest): Promise<string> {
+    return this.transport.call('reporting.Export', [params]);
+  }
+
+  getABI(params: string): Promise<string> {
+    return this.transport.call('reporting.GetABI', [params]);
+  }
+
+  getAddressTotals(params: AddressWithOptions): Promise<AddressTotals> {
+    return this.transport.call('reporting.GetAddressTotals', [params]);
+  }
+
+  getAddresses(): Promise<string[] | null> {
+    return this.transport.call('reporting.GetAddresses', []);
+  }
+
+  getAllEventsFromAddress(params: AddressWithOptions): Promise<EventsResp> {
+    return this.transport.call('reporting.GetAllEventsFromAddress', [params]);
+  }
+
+  getAllTransactionsInternalToAddress(params: TransactionsArgs): Promise<TransactionsResp> {
+    return this.transport.call('reporting.GetAllTransactionsInternalToAddress', [params]);
+  }
+
+  getAllTransactionsToAddress(params: TransactionsArgs): Promise<TransactionsResp> {
+    return this.transport.call('reporting.GetAllTransactionsToAddress', [params]);
+  }
+
+  getAnomalies(): Promise<(Anomaly | null)[] | null> {
+    return this.transport.call('reporting.GetAnomalies', []);
+  }
+
+  getBlock(params: number): Promise<Block> {
+    return this.transport.call('reporting.GetBlock', [params]);
+  }
+
+  getBlockForTransaction(params: string): Promise<BlockSummary> {
+    return this.transport.call('reporting.GetBlockForTransaction', [params]);
+  }
+
+  getBlocksByTimeRange(params: TimeRangeWithOptions): Promise<BlockSummariesResp> {
+    return this.transport.call('reporting.GetBlocksByTimeRange', [params]);
+  }
+
+  getContractCosts(params: ContractCostsArgs): Promise<(ContractCost | null)[] | null> {
+    return this.transport.call('reporting.GetContractCosts', [params]);
+  }
+
+  getContractCreationTransaction(params: string): Promise<string> {
+    return this.transport.call('reporting.GetContractCreationTransaction', [params]);
+  }
+
+  getContractEnrichment(params: string): Promise<Record<string, string> | null> {
+    return this.transport.call('reporting.GetContractEnrichment', [params]);
+  }
+
+  getContractSeverityRules(params: string): Promise<(SeverityRule | null)[] | null> {
+    return this.transport.call('reporting.GetContractSeverityRules', [params]);
+  }
+
+  getContractStatus(params: string): Promise<ContractStatus> {
+    return this.transport.call('reporting.GetContractStatus', [params]);
+  }
+
+  getContractTemplate(params: string): Promise<string> {
+    return this.transport.call('reporting.GetContractTemplate', [params]);
+  }
+
+  getCounterparties(params: CounterpartiesArgs): Promise<(Counterparty | null)[] | null> {
+    return this.transport.call('reporting.GetCounterparties', [params]);
+  }
+
+  getEventSeverityCounts(params: AddressWithOptions): Promise<Record<string, number> | null> {
+    return this.transport.call('reporting.GetEventSeverityCounts', [params]);
+  }
+
+  getEventsBySeverity(params: EventsBySeverityArgs): Promise<EventsResp> {
+    return this.transport.call('reporting.GetEventsBySeverity', [params]);
+  }
+
+  getEventsByTopics(params: EventsByTopicsArgs): Promise<EventsResp> {
+    return this.transport.call('reporting.GetEventsByTopics', [params]);
+  }
+
+  getGasUsageByContract(params: GasUsageQuery): Promise<(GasUsage | null)[] | null> {
+    return this.transport.call('reporting.GetGasUsageByContract', [params]);
+  }
+
+  getGasUsageByDay(params: GasUsageQuery): Promise<(GasUsage | null)[] | null> {
+    return this.transport.call('reporting.GetGasUsageByDay', [params]);
+  }
+
+  getGasUsageByFunction(params: GasUsageQuery): Promise<(GasUsage | null)[] | null> {
+    return this.transport.call('reporting.GetGasUsageByFunction', [params]);
+  }
+
+  getHighAvailabilityStatus(): Promise<HighAvailabilityStatus> {
+    return this.transport.call('reporting.GetHighAvailabilityStatus', []);
+  }
+
+  getIndexStats(): Promise<IndexStats[] | null> {
+    return this.transport.call('reporting.GetIndexStats', []);
+  }
+
+  getIntegrityReport(params: string): Promise<IntegrityReport> {
+    return this.transport.call('reporting.GetIntegrityReport', [params]);
+  }
+
+  getJob(params: string): Promise<Job> {
+    return this.transport.call('reporting.GetJob', [params]);
+  }
+
+  getJobs(): Promise<(Job | null)[] | null> {
+    return this.transport.call('reporting.GetJobs', []);
+  }
+
+  getLastFiltered(params: string): Promise<number> {
+    return this.transport.call('reporting.GetLastFiltered', [params]);
+  }
+
+  getLastPersistedBlockNumber(): Promise<number> {
+    return this.transport.call('reporting.GetLastPersistedBlockNumber', []);
+  }
+
+  getLayoutProposal(params: string): Promise<LayoutProposal> {
+    return this.transport.call('reporting.GetLayoutProposal', [params]);
+  }
+
+  getLegalHolds(): Promise<(LegalHold | null)[] | null> {
+    return this.transport.call('reporting.GetLegalHolds', []);
+  }
+
+  getNames(params: string): Promise<string[] | null> {
+    return this.transport.call('reporting.GetNames', [params]);
+  }
+
+  getNetworkActivity(params: TimeRange): Promise<NetworkActivity> {
+    return this.transport.call('reporting.GetNetworkActivity', [params]);
+  }
+
+  getPendingActivity(params: PendingActivityArgs): Promise<(PendingTransaction | null)[] | null> {
+    return this.transport.call('reporting.GetPendingActivity', [params]);
+  }
+
+  getProcessingJournal(params: JournalArgs): Promise<(JournalEntry | null)[] | null> {
+    return this.transport.call('reporting.GetProcessingJournal', [params]);
+  }
+
+  getRegisteredNames(): Promise<(RegisteredName | null)[] | null> {
+    return this.transport.call('reporting.GetRegisteredNames', []);
+  }
+
+  getStorage(params: StorageArgs): Promise<StoragePage> {
+    return this.transport.call('reporting.GetStorage', [params]);
+  }
+
+  getStorageABI(params: string): Promise<string> {
+    return this.transport.call('reporting.GetStorageABI', [params]);
+  }
+
+  getStorageAverage(params: StorageAverageArgs): Promise<StorageAverageResp> {
+    return this.transport.call('reporting.GetStorageAverage', [params]);
+  }
+
+  getStorageHistory(params: StorageHistoryArgs): Promise<ReportingResponseTemplate> {
+    return this.transport.call('reporting.GetStorageHistory', [params]);
+  }
+
+  getStorageHistoryCount(params: AddressWithBlockRange): Promise<RangeQueryResult> {
+    return this.transport.call('reporting.GetStorageHistoryCount', [params]);
+  }
+
+  getSubscriptionStats(): Promise<SubscriptionStats> {
+    return this.transport.call('reporting.GetSubscriptionStats', []);
+  }
+
+  getTemplateDetails(params: string): Promise<Template> {
+    return this.transport.call('reporting.GetTemplateDetails', [params]);
+  }
+
+  getTemplates(): Promise<string[] | null> {
+    return this.transport.call('reporting.GetTemplates', []);
+  }
+
+  getTerminalBlock(params: string): Promise<number> {
+    return this.transport.call('reporting.GetTerminalBlock', [params]);
+  }
+
+  getTokenRules(): Promise<(TokenRule | null)[] | null> {
+    return this.transport.call('reporting.GetTokenRules', []);
+  }
+
+  getTokenTransfers(params: TokenTransfersArgs): Promise<TokenTransfersResp> {
+    return this.transport.call('reporting.GetTokenTransfers', [params]);
+  }
+
+  getTransaction(params: string): Promise<ParsedTransaction> {
+    return this.transport.call('reporting.GetTransaction', [params]);
+  }
+
+  getTransactionCallTree(params: string): Promise<CallTree> {
+    return this.transport.call('reporting.GetTransactionCallTree', [params]);
+  }
+
+  getTransactionsForBlockRange(params: BlockRangeWithOptions): Promise<TransactionSummariesResp> {
+    return this.transport.call('reporting.GetTransactionsForBlockRange', [params]);
+  }
+
+  getWebhooks(): Promise<(Webhook | null)[] | null> {
+    return this.transport.call('reporting.GetWebhooks', []);
+  }
+
+  hasActivity(params: AddressWithBlockNumbers): Promise<boolean> {
+    return this.transport.call('reporting.HasActivity', [params]);
+  }
+
+  inferStorageLayout(params: string): Promise<string> {
+    return this.transport.call('reporting.InferStorageLayout', [params]);
+  }
+
+  openSnapshot(params: SnapshotArgs): Promise<SnapshotResp> {
+    return this.transport.call('reporting.OpenSnapshot', [params]);
+  }
+
+  pauseIngestion(): Promise<null> {
+    return this.transport.call('reporting.PauseIngestion', []);
+  }
+
+  refilterContract(params: RefilterContractArgs): Promise<null> {
+    return this.transport.call('reporting.RefilterContract', [params]);
+  }
+
+  releaseLegalHold(params: string): Promise<null> {
+    return this.transport.call('reporting.ReleaseLegalHold', [params]);
+  }
+
+  replayEvents(params: ReplayEventsArgs): Promise<ReplayEventsResp> {
+    return this.transport.call('reporting.ReplayEvents', [params]);
+  }
+
+  resolveName(params: string): Promise<string> {
+    return this.transport.call('reporting.ResolveName', [params]);
+  }
+
+  resumeIngestion(): Promise<null> {
+    return this.transport.call('reporting.ResumeIngestion', []);
+  }
+
+  retryJob(params: string): Promise<null> {
+    return this.transport.call('reporting.RetryJob', [params]);
+  }
+
+  screenAddresses(params: ScreenAddressesArgs): Promise<(ScreeningMatch | null)[] | null> {
+    return this.transport.call('reporting.ScreenAddresses', [params]);
+  }
+
+  search(params: SearchArgs): Promise<(SearchResult | null)[] | null> {
+    return this.transport.call('reporting.Search', [params]);
+  }
+
+  searchStorage(params: StorageSearchArgs): Promise<StorageSearchResp> {
+    return this.transport.call('reporting.SearchStorage', [params]);
+  }
+
+  setContractEnrichment(params: AddressWithEnrichment): Promise<null> {
+    return this.transport.call('reporting.SetContractEnrichment', [params]);
+  }
+
+  setContractSeverityRules(params: AddressWithSeverityRules): Promise<null> {
+    return this.transport.call('reporting.SetContractSeverityRules', [params]);
+  }
+
+  setTerminalBlock(params: AddressWithOptionalBlock): Promise<null> {
+    return this.transport.call('reporting.SetTerminalBlock', [params]);
+  }
+
+  throttleContract(params: ThrottleContractArgs): Promise<null> {
+    return this.transport.call('reporting.ThrottleContract', [params]);
+  }
+
+  verifyIntegrity(params: BlockRangeArgs): Promise<string> {
+    return this.transport.call('reporting.VerifyIntegrity', [params]);
+  }
+}
+
+export class TokenAPI {
+  constructor(private readonly transport: Transport) {}
+
+  allERC721HoldersAtBlock(params: ERC721TokenQuery): Promise<string[] | null> {
+    return this.transport.call('token.AllERC721HoldersAtBlock', [params]);
+  }
+
+  allERC721TokensAtBlock(params: ERC721TokenQuery): Promise<ERC721Token[] | null> {
+    return this.transport.call('token.AllERC721TokensAtBlock', [params]);
+  }
+
+  erc721TokensForAccountAtBlock(params: ERC721TokenQuery): Promise<ERC721Token[] | null> {
+    return this.transport.call('token.ERC721TokensForAccountAtBlock', [params]);
+  }
+
+  getERC1155TokenBalance(params: ERC1155TokenQuery): Promise<Record<string, number | null> | null> {
+    return this.transport.call('token.GetERC1155TokenBalance', [params]);
+  }
+
+  getERC1155TokenBalanceAtBlock(params: ERC1155TokenQuery): Promise<number> {
+    return this.transport.call('token.GetERC1155TokenBalanceAtBlock', [params]);
+  }
+
+  getERC1155TokenHoldersAtBlock(params: ERC1155TokenQuery): Promise<string[] | null> {
+    return this.transport.call('token.GetERC1155TokenHoldersAtBlock', [params]);
+  }
+
+  getERC20Allowance(params: ERC20AllowanceQuery): Promise<Record<string, number | null> | null> {
+    return this.transport.call('token.GetERC20Allowance', [params]);
+  }
+
+  getERC20Allowances(params: ERC20AllowancesQuery): Promise<(ERC20Allowance | null)[] | null> {
+    return this.transport.call('token.GetERC20Allowances', [params]);
+  }
+
+  getERC20TokenBalance(params: ERC20TokenQuery): Promise<Record<string, number | null> | null> {
+    return this.transport.call('token.GetERC20TokenBalance', [params]);
+  }
+
+  getERC20TokenHolders(params: ERC20TokenHoldersQuery): Promise<(ERC20Holding | null)[] | null> {
+    return this.transport.call('token.GetERC20TokenHolders', [params]);
+  }
+
+  getERC20TokenHoldersAtBlock(params: ERC20TokenQuery): Promise<string[] | null> {
+    return this.transport.call('token.GetERC20TokenHoldersAtBlock', [params]);
+  }
+
+  getERC721TokenHistory(params: ERC721TokenQuery): Promise<ERC721Token[] | null> {
+    return this.transport.call('token.GetERC721TokenHistory', [params]);
+  }
+
+  getHolderForERC721TokenAtBlock(params: ERC721TokenQuery): Promise<string> {
+    return this.transport.call('token.GetHolderForERC721TokenAtBlock', [params]);
+  }
+}
+
+// Client calls the RPC API at the given URL, sending the headers with each request, e.g. an
+// X-API-Key or Authorization header.
+export class Client {
+  readonly reporting: ReportingAPI;
+  readonly token: TokenAPI;
+
+  constructor(url: string, headers: Record<string, string> = {}) {
+    const transport = new Transport(url, headers);
+    this.reporting = new ReportingAPI(transport);
+    this.token = new TokenAPI(transport);
+  }
+}
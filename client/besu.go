@@ -0,0 +1,289 @@
+package client
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	besuTraceTransaction      = "trace_transaction"
+	besuStorageRangeAt        = "debug_storageRangeAt"
+	besuGetProof              = "eth_getProof"
+	besuGetPrivateTransaction = "priv_getPrivateTransaction"
+	besuGetPrivateTxReceipt   = "priv_getTransactionReceipt"
+	besuQBFTGetValidators     = "qbft_getValidatorsByBlockNumber"
+	besuIBFTGetValidators     = "ibft_getValidatorsByBlockNumber"
+	besuCliqueGetSigners      = "clique_getSigners"
+	besuStorageRangePageSize  = 1000
+)
+
+// BesuPrivacyPrecompile is the address privacy marker transactions are sent to
+var BesuPrivacyPrecompile = types.NewAddress("0x000000000000000000000000000000000000007e")
+
+// BesuClient provides access to a Hyperledger Besu node. The connection is the
+// same as for GoQuorum, but the GoQuorum specific APIs are replaced with their
+// Besu equivalents.
+type BesuClient struct {
+	Client
+}
+
+func NewBesuClient(rawUrl, qgUrl string) (*BesuClient, error) {
+	quorumClient, err := NewQuorumClient(rawUrl, qgUrl)
+	if err != nil {
+		return nil, err
+	}
+	return &BesuClient{Client: quorumClient}, nil
+}
+
+// DumpAddress pages through the account storage at the end of the given block
+// and fetches the storage root from the account proof.
+func (bc *BesuClient) DumpAddress(address types.Address, blockNumber uint64) (*types.AccountState, error) {
+	log.Debug("Fetching account storage range", "account", address.String(), "blocknumber", blockNumber)
+	block, err := BlockByNumber(bc, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	root, err := bc.StorageRoot(address, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	// a transaction index past the end of the block gives the state after the
+	// whole block has been processed
+	txIndex := len(block.Transactions)
+	storage := make(map[types.Hash]string)
+	startKey := types.NewHash("")
+	for {
+		var resp BesuStorageRange
+		err := bc.RPCCall(&resp, besuStorageRangeAt, block.Hash.String(), txIndex, address.String(), startKey.String(), besuStorageRangePageSize)
+		if err != nil {
+			return nil, err
+		}
+		for hashedKey, entry := range resp.Storage {
+			key := types.NewHash(hashedKey)
+			if entry.Key != nil {
+				key = *entry.Key
+			}
+			storage[key] = trimStorageValue(entry.Value)
+		}
+		if resp.NextKey == nil {
+			break
+		}
+		startKey = *resp.NextKey
+	}
+	return &types.AccountState{Root: root, Storage: storage}, nil
+}
+
+func (bc *BesuClient) StorageRoot(account types.Address, blockNum uint64) (types.Hash, error) {
+	var res BesuAccountProof
+	if err := bc.RPCCall(&res, besuGetProof, account.String(), []string{}, fmtBlockNum(blockNum)); err != nil {
+		return "", err
+	}
+	return res.StorageHash, nil
+}
+
+// TraceTransaction converts the flat list of Parity style traces into the
+// nested call structure returned by the GoQuorum call tracer.
+func (bc *BesuClient) TraceTransaction(txHash types.Hash) (types.RawOuterCall, error) {
+	log.Debug("Tracing transaction", "tx", txHash.String())
+
+	var traces []BesuTrace
+	if err := bc.RPCCall(&traces, besuTraceTransaction, txHash.String()); err != nil {
+		return types.RawOuterCall{}, err
+	}
+
+	var resp types.RawOuterCall
+	for _, trace := range traces {
+		if len(trace.TraceAddress) == 0 {
+			resp.Output = trace.Result.Output
+			continue
+		}
+		// traces are ordered depth first, so the parent call is always present
+		calls := &resp.Calls
+		for _, idx := range trace.TraceAddress[:len(trace.TraceAddress)-1] {
+			calls = &(*calls)[idx].Calls
+		}
+		*calls = append(*calls, trace.toInnerCall())
+	}
+	return resp, nil
+}
+
+// TransactionWithReceipt fetches the public transaction over GraphQL, then
+// fills in the private payload and logs of privacy marker transactions.
+func (bc *BesuClient) TransactionWithReceipt(transactionHash types.Hash) (Transaction, error) {
+	var txResult TransactionResult
+	if err := bc.ExecuteGraphQLQuery(&txResult, BesuTransactionDetailQuery(transactionHash)); err != nil {
+		return Transaction{}, err
+	}
+	tx := txResult.Transaction
+	if tx.To.Address != BesuPrivacyPrecompile {
+		return tx, nil
+	}
+	tx.IsPrivate = true
+
+	// the node may not be a party to the private transaction
+	var privateTx *BesuPrivateTransaction
+	if err := bc.RPCCall(&privateTx, besuGetPrivateTransaction, transactionHash.String()); err != nil {
+		return Transaction{}, err
+	}
+	if privateTx == nil {
+		return tx, nil
+	}
+	tx.PrivateInputData = privateTx.Input
+
+	var privateReceipt *BesuPrivateReceipt
+	if err := bc.RPCCall(&privateReceipt, besuGetPrivateTxReceipt, transactionHash.String()); err != nil {
+		return Transaction{}, err
+	}
+	if privateReceipt == nil {
+		return tx, nil
+	}
+	if privateReceipt.ContractAddress != nil {
+		tx.CreatedContract = Address{Address: *privateReceipt.ContractAddress}
+	}
+	tx.Logs = make([]Event, len(privateReceipt.Logs))
+	for i, l := range privateReceipt.Logs {
+		tx.Logs[i] = Event{
+			Index:   l.LogIndex.ToUint64(),
+			Account: Address{Address: l.Address},
+			Topics:  l.Topics,
+			Data:    l.Data,
+		}
+	}
+	return tx, nil
+}
+
+// Consensus detects the consensus algorithm from which of the consensus
+// specific RPC APIs the node responds to.
+func (bc *BesuClient) Consensus() (string, error) {
+	log.Debug("Fetching consensus info")
+
+	for _, api := range []struct {
+		method    string
+		consensus string
+	}{
+		{besuQBFTGetValidators, "qbft"},
+		{besuIBFTGetValidators, "ibft2"},
+		{besuCliqueGetSigners, "clique"},
+	} {
+		var resp []types.Address
+		if err := bc.RPCCall(&resp, api.method, "latest"); err == nil {
+			return api.consensus, nil
+		}
+	}
+	return "ethash", nil
+}
+
+func (trace BesuTrace) toInnerCall() types.RawInnerCall {
+	switch trace.Type {
+	case "create":
+		callType := "CREATE"
+		if trace.Action.CreationMethod != "" {
+			callType = strings.ToUpper(trace.Action.CreationMethod)
+		}
+		return types.RawInnerCall{
+			Type:    callType,
+			From:    trace.Action.From,
+			To:      trace.Result.Address,
+			Input:   trace.Action.Init,
+			Value:   trace.Action.Value,
+			Gas:     trace.Action.Gas,
+			GasUsed: trace.Result.GasUsed,
+			Output:  trace.Result.Code,
+		}
+	case "suicide":
+		return types.RawInnerCall{
+			Type:  "SELFDESTRUCT",
+			From:  trace.Action.Address,
+			To:    trace.Action.RefundAddress,
+			Value: trace.Action.Balance,
+		}
+	default:
+		return types.RawInnerCall{
+			Type:    strings.ToUpper(trace.Action.CallType),
+			From:    trace.Action.From,
+			To:      trace.Action.To,
+			Input:   trace.Action.Input,
+			Value:   trace.Action.Value,
+			Gas:     trace.Action.Gas,
+			GasUsed: trace.Result.GasUsed,
+			Output:  trace.Result.Output,
+		}
+	}
+}
+
+// trimStorageValue formats a storage value the same way as the GoQuorum
+// account dump, as un-prefixed hex with leading zero bytes removed
+func trimStorageValue(value string) string {
+	value = strings.TrimPrefix(value, "0x")
+	if len(value)%2 == 1 {
+		value = "0" + value
+	}
+	asBytes, err := hex.DecodeString(value)
+	if err != nil {
+		return value
+	}
+	for len(asBytes) > 0 && asBytes[0] == 0 {
+		asBytes = asBytes[1:]
+	}
+	return hex.EncodeToString(asBytes)
+}
+
+// Besu RPC responses
+
+type BesuStorageRange struct {
+	Storage map[string]BesuStorageEntry `json:"storage"`
+	NextKey *types.Hash                 `json:"nextKey"`
+}
+
+type BesuStorageEntry struct {
+	Key   *types.Hash `json:"key"`
+	Value string      `json:"value"`
+}
+
+type BesuAccountProof struct {
+	StorageHash types.Hash `json:"storageHash"`
+}
+
+type BesuTrace struct {
+	Action struct {
+		CallType       string          `json:"callType"`
+		CreationMethod string          `json:"creationMethod"`
+		From           types.Address   `json:"from"`
+		To             types.Address   `json:"to"`
+		Gas            types.HexNumber `json:"gas"`
+		Input          types.HexData   `json:"input"`
+		Init           types.HexData   `json:"init"`
+		Value          types.HexNumber `json:"value"`
+		Address        types.Address   `json:"address"`
+		RefundAddress  types.Address   `json:"refundAddress"`
+		Balance        types.HexNumber `json:"balance"`
+	} `json:"action"`
+	Result struct {
+		Address types.Address   `json:"address"`
+		Code    types.HexData   `json:"code"`
+		GasUsed types.HexNumber `json:"gasUsed"`
+		Output  types.HexData   `json:"output"`
+	} `json:"result"`
+	TraceAddress []int  `json:"traceAddress"`
+	Type         string `json:"type"`
+}
+
+type BesuPrivateTransaction struct {
+	Input types.HexData `json:"input"`
+}
+
+type BesuPrivateReceipt struct {
+	ContractAddress *types.Address `json:"contractAddress"`
+	Logs            []BesuLog      `json:"logs"`
+}
+
+type BesuLog struct {
+	LogIndex types.HexNumber `json:"logIndex"`
+	Address  types.Address   `json:"address"`
+	Topics   []types.Hash    `json:"topics"`
+	Data     types.HexData   `json:"data"`
+}
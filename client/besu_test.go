@@ -0,0 +1,134 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const besuTestTxHash = "0x1a6f4292bac138df9a7854a07c93fd14ca7de53265e8fe01b6c986f97d6c1ee7"
+
+func TestBesuClient_TraceTransaction(t *testing.T) {
+	var traces []BesuTrace
+	err := json.Unmarshal([]byte(`[
+		{"action": {"callType": "call", "from": "0x01", "to": "0x02", "gas": "0x100", "input": "0x", "value": "0x0"}, "result": {"gasUsed": "0x50", "output": "0x2a"}, "traceAddress": [], "type": "call"},
+		{"action": {"callType": "delegatecall", "from": "0x02", "to": "0x03", "gas": "0x80", "input": "0x60fe47b1", "value": "0x0"}, "result": {"gasUsed": "0x10", "output": "0x"}, "traceAddress": [0], "type": "call"},
+		{"action": {"from": "0x03", "gas": "0x40", "init": "0x6080", "value": "0x1"}, "result": {"address": "0x04", "code": "0x60", "gasUsed": "0x20"}, "traceAddress": [0, 0], "type": "create"},
+		{"action": {"address": "0x02", "refundAddress": "0x01", "balance": "0x5"}, "result": null, "traceAddress": [1], "type": "suicide"}
+	]`), &traces)
+	assert.Nil(t, err)
+
+	mockRPC := map[string]interface{}{
+		"trace_transaction" + besuTestTxHash: traces,
+	}
+	besuClient := &BesuClient{Client: NewStubQuorumClient(nil, mockRPC)}
+
+	trace, err := TraceTransaction(besuClient, types.NewHash(besuTestTxHash))
+	assert.Nil(t, err)
+	assert.Equal(t, types.NewHexData("0x2a"), trace.Output)
+	assert.Len(t, trace.Calls, 2)
+	assert.Equal(t, "DELEGATECALL", trace.Calls[0].Type)
+	assert.Equal(t, types.NewAddress("0x03"), trace.Calls[0].To)
+	assert.Len(t, trace.Calls[0].Calls, 1)
+	assert.Equal(t, types.RawInnerCall{
+		Type:    "CREATE",
+		From:    types.NewAddress("0x03"),
+		To:      types.NewAddress("0x04"),
+		Input:   types.NewHexData("0x6080"),
+		Value:   1,
+		Gas:     0x40,
+		GasUsed: 0x20,
+		Output:  types.NewHexData("0x60"),
+	}, trace.Calls[0].Calls[0])
+	assert.Equal(t, "SELFDESTRUCT", trace.Calls[1].Type)
+	assert.Equal(t, types.NewAddress("0x01"), trace.Calls[1].To)
+}
+
+func TestBesuClient_DumpAddress(t *testing.T) {
+	address := types.NewAddress("0x0000000000000000000000000000000000000001")
+	blockHash := types.NewHash("0x4b603921305ebaa48d863b9f577059a63c653cd8e952372622923708fb657806")
+	slot0 := types.NewHash("0x00")
+	slot1 := types.NewHash("0x01")
+	startKey := types.NewHash("")
+	nextKey := types.NewHash("0xaa")
+
+	mockRPC := map[string]interface{}{
+		"eth_getBlockByNumber0x5<bool Value>": types.RawBlock{
+			Hash:         blockHash,
+			Transactions: []types.Hash{types.NewHash("0x01"), types.NewHash("0x02")},
+		},
+		"eth_getProof" + address.String() + "<[]string Value>0x5": BesuAccountProof{
+			StorageHash: types.NewHash("0xbb"),
+		},
+		"debug_storageRangeAt" + blockHash.String() + "<int Value>" + address.String() + startKey.String() + "<int Value>": BesuStorageRange{
+			Storage: map[string]BesuStorageEntry{
+				"0x290decd9548b62a8d60345a988386fc84ba6bc95484008f6362f93160ef3e563": {Key: &slot0, Value: "0x000000000000000000000000000000000000000000000000000000000000002a"},
+			},
+			NextKey: &nextKey,
+		},
+		"debug_storageRangeAt" + blockHash.String() + "<int Value>" + address.String() + nextKey.String() + "<int Value>": BesuStorageRange{
+			Storage: map[string]BesuStorageEntry{
+				"0xb10e2d527612073b26eecdfd717e6a320cf44b4afac2b0732d9fcbe2b7fa0cf6": {Key: &slot1, Value: "0x1234"},
+			},
+		},
+	}
+	besuClient := &BesuClient{Client: NewStubQuorumClient(nil, mockRPC)}
+
+	dump, err := DumpAddress(besuClient, address, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, &types.AccountState{
+		Root: types.NewHash("0xbb"),
+		Storage: map[types.Hash]string{
+			slot0: "2a",
+			slot1: "1234",
+		},
+	}, dump)
+}
+
+func TestBesuClient_TransactionWithReceipt_Private(t *testing.T) {
+	query := BesuTransactionDetailQuery(types.NewHash(besuTestTxHash))
+	mockGraphQL := map[string]map[string]interface{}{
+		query: {
+			"transaction": map[string]interface{}{
+				"hash": besuTestTxHash,
+				"to":   map[string]interface{}{"address": BesuPrivacyPrecompile.String()},
+			},
+		},
+	}
+	contract := types.NewAddress("0x05")
+	mockRPC := map[string]interface{}{
+		"priv_getPrivateTransaction" + besuTestTxHash: &BesuPrivateTransaction{Input: types.NewHexData("0x6080")},
+		"priv_getTransactionReceipt" + besuTestTxHash: &BesuPrivateReceipt{
+			ContractAddress: &contract,
+			Logs: []BesuLog{
+				{LogIndex: 1, Address: contract, Data: types.NewHexData("0x2a")},
+			},
+		},
+	}
+	besuClient := &BesuClient{Client: NewStubQuorumClient(mockGraphQL, mockRPC)}
+
+	tx, err := TransactionWithReceipt(besuClient, types.NewHash(besuTestTxHash))
+	assert.Nil(t, err)
+	assert.True(t, tx.IsPrivate)
+	assert.Equal(t, types.NewHexData("0x6080"), tx.PrivateInputData)
+	assert.Equal(t, contract, tx.CreatedContract.Address)
+	assert.Equal(t, []Event{{Index: 1, Account: Address{contract}, Data: types.NewHexData("0x2a")}}, tx.Logs)
+}
+
+func TestBesuClient_Consensus(t *testing.T) {
+	mockRPC := map[string]interface{}{
+		"ibft_getValidatorsByBlockNumberlatest": []types.Address{types.NewAddress("0x01")},
+	}
+	besuClient := &BesuClient{Client: NewStubQuorumClient(nil, mockRPC)}
+
+	consensus, err := Consensus(besuClient)
+	assert.Nil(t, err)
+	assert.Equal(t, "ibft2", consensus)
+
+	consensus, err = Consensus(&BesuClient{Client: NewStubQuorumClient(nil, nil)})
+	assert.Nil(t, err)
+	assert.Equal(t, "ethash", consensus)
+}
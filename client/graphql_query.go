@@ -39,3 +39,29 @@ func TransactionDetailQuery(hash types.Hash) string {
 		}
     } }`
 }
+
+// BesuTransactionDetailQuery omits the GoQuorum specific privacy fields, which
+// are not part of the Besu GraphQL schema
+func BesuTransactionDetailQuery(hash types.Hash) string {
+	return `query { transaction(hash:"` + hash.Hex() + `") {
+        hash
+        status
+		index
+        nonce
+        from { address }
+        to { address }
+        value
+        gasPrice
+        gas
+        gasUsed
+        cumulativeGasUsed
+        createdContract { address }
+		inputData
+		logs {
+			index
+			account { address }
+			topics
+			data
+		}
+    } }`
+}
@@ -1,6 +1,8 @@
 package client
 
 import (
+	"context"
+
 	"quorumengineering/quorum-report/types"
 )
 
@@ -15,3 +17,27 @@ type Client interface {
 	// Stop quorum client connection
 	Stop()
 }
+
+// ContextClient is implemented by clients that pass the trace context of a
+// GraphQL query on to the node. JSON RPC calls are made over a websocket,
+// which has no headers to carry it.
+type ContextClient interface {
+	ExecuteGraphQLQueryContext(context.Context, interface{}, string) error
+}
+
+// NodeClient is implemented by clients for nodes that don't support the
+// GoQuorum specific APIs. The node specific calls in this package are delegated
+// to it when implemented, and use the GoQuorum APIs otherwise.
+type NodeClient interface {
+	Client
+	// DumpAddress fetches the full storage of an account at the given block
+	DumpAddress(types.Address, uint64) (*types.AccountState, error)
+	// StorageRoot fetches the storage root of an account at the given block
+	StorageRoot(types.Address, uint64) (types.Hash, error)
+	// TraceTransaction fetches the internal calls made by a transaction
+	TraceTransaction(types.Hash) (types.RawOuterCall, error)
+	// TransactionWithReceipt fetches a transaction along with its receipt
+	TransactionWithReceipt(types.Hash) (Transaction, error)
+	// Consensus returns the name of the consensus algorithm the node runs
+	Consensus() (string, error)
+}
@@ -0,0 +1,316 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// seenHeadersLimit is how many chain head hashes are remembered, so the same
+// header received from several nodes is only passed on once
+const seenHeadersLimit = 256
+
+var ErrNoHealthyNode = errors.New("no node is available")
+
+type node struct {
+	wsUrl      string
+	graphQLUrl string
+	// nil until connected
+	client  Client
+	healthy bool
+	// set once the node is subscribed to chain heads
+	subscribed bool
+}
+
+// MultiClient spreads calls over several nodes of the same network, so a node
+// restarting is survived without intervention. Calls go to the first healthy
+// node, or to each healthy node in turn if round robin is set, and move on to
+// the next node if the connection fails. Nodes are health checked on an
+// interval, and those that could not be connected to are retried then.
+//
+// Chain heads are subscribed to on every node, and each header is passed on
+// the first time any node sends it.
+type MultiClient struct {
+	nodes      []*node
+	roundRobin bool
+	next       uint32
+	mux        sync.RWMutex
+	connect    func(wsUrl, graphQLUrl string) (Client, error)
+
+	headChan   chan<- types.RawHeader
+	seen       map[types.Hash]bool
+	seenOrder  []types.Hash
+	headersMux sync.Mutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	healthWg     sync.WaitGroup
+	// closed once all nodes are stopped, so header forwarders can return
+	stoppedChan chan struct{}
+	shutdownWg  sync.WaitGroup
+}
+
+func NewMultiClient(nodes []*types.NodeConfig, roundRobin bool, healthCheckInterval time.Duration) (*MultiClient, error) {
+	mc := newMultiClient(nodes, roundRobin, func(wsUrl, graphQLUrl string) (Client, error) {
+		return NewQuorumClient(wsUrl, graphQLUrl)
+	})
+	if err := mc.start(healthCheckInterval); err != nil {
+		return nil, err
+	}
+	return mc, nil
+}
+
+func newMultiClient(nodes []*types.NodeConfig, roundRobin bool, connect func(wsUrl, graphQLUrl string) (Client, error)) *MultiClient {
+	mc := &MultiClient{
+		roundRobin:   roundRobin,
+		connect:      connect,
+		seen:         make(map[types.Hash]bool),
+		shutdownChan: make(chan struct{}),
+		stoppedChan:  make(chan struct{}),
+	}
+	for _, n := range nodes {
+		mc.nodes = append(mc.nodes, &node{wsUrl: n.WSUrl, graphQLUrl: n.GraphQLUrl})
+	}
+	return mc
+}
+
+// start connects to the nodes, needing at least one to succeed, and starts
+// health checking them
+func (mc *MultiClient) start(healthCheckInterval time.Duration) error {
+	mc.checkNodes()
+	if len(mc.healthyNodes()) == 0 {
+		mc.Stop()
+		return errors.New("connect to any node failed")
+	}
+
+	mc.healthWg.Add(1)
+	go func() {
+		defer mc.healthWg.Done()
+		ticker := time.NewTicker(healthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				mc.checkNodes()
+			case <-mc.shutdownChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// checkNodes connects to the nodes that are not connected, subscribes them to
+// chain heads if needed, and checks each node answers calls
+func (mc *MultiClient) checkNodes() {
+	for _, n := range mc.nodes {
+		mc.mux.RLock()
+		client := n.client
+		mc.mux.RUnlock()
+		if client == nil {
+			connected, err := mc.connect(n.wsUrl, n.graphQLUrl)
+			if err != nil {
+				log.Warn("Connecting to node failed", "url", n.wsUrl, "err", err)
+				continue
+			}
+			log.Info("Connected to node", "url", n.wsUrl)
+			client = connected
+			mc.mux.Lock()
+			n.client = client
+			mc.mux.Unlock()
+		}
+		if _, err := mc.subscribe(n); err != nil {
+			log.Warn("Subscribing node to chain head failed", "url", n.wsUrl, "err", err)
+		}
+
+		var blockNumber types.HexNumber
+		err := client.RPCCall(&blockNumber, "eth_blockNumber")
+		mc.setHealthy(n, err)
+	}
+}
+
+func (mc *MultiClient) setHealthy(n *node, err error) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	if err == nil && !n.healthy {
+		log.Info("Node is healthy", "url", n.wsUrl)
+	}
+	if err != nil && n.healthy {
+		log.Warn("Node is unhealthy", "url", n.wsUrl, "err", err)
+	}
+	n.healthy = err == nil
+}
+
+// healthyNodes returns the healthy nodes in the order to try them
+func (mc *MultiClient) healthyNodes() []*node {
+	mc.mux.RLock()
+	defer mc.mux.RUnlock()
+	var healthy []*node
+	for _, n := range mc.nodes {
+		if n.client != nil && n.healthy {
+			healthy = append(healthy, n)
+		}
+	}
+	if mc.roundRobin && len(healthy) > 1 {
+		start := int(atomic.AddUint32(&mc.next, 1) % uint32(len(healthy)))
+		healthy = append(append([]*node{}, healthy[start:]...), healthy[:start]...)
+	}
+	return healthy
+}
+
+// connectedNodes returns all nodes that have been connected to, healthy or not
+func (mc *MultiClient) connectedNodes() []*node {
+	mc.mux.RLock()
+	defer mc.mux.RUnlock()
+	var connected []*node
+	for _, n := range mc.nodes {
+		if n.client != nil {
+			connected = append(connected, n)
+		}
+	}
+	return connected
+}
+
+// call makes the call on each healthy node in turn until one answers. Errors
+// returned by the node itself are not retried on other nodes. If no node is
+// healthy, all are tried, as they may have recovered since they were checked.
+func (mc *MultiClient) call(f func(Client) error, isNodeError func(error) bool) error {
+	nodes := mc.healthyNodes()
+	if len(nodes) == 0 {
+		nodes = mc.connectedNodes()
+	}
+	err := ErrNoHealthyNode
+	for _, n := range nodes {
+		if err = f(n.client); err == nil || isNodeError(err) {
+			return err
+		}
+		mc.setHealthy(n, err)
+	}
+	return err
+}
+
+// SubscribeChainHead subscribes to new chain heads on all connected nodes,
+// and on nodes connected to later.
+func (mc *MultiClient) SubscribeChainHead(ch chan<- types.RawHeader) error {
+	mc.mux.Lock()
+	mc.headChan = ch
+	mc.mux.Unlock()
+
+	var subscribed bool
+	var err error
+	for _, n := range mc.nodes {
+		ok, subErr := mc.subscribe(n)
+		if subErr != nil {
+			err = subErr
+		}
+		subscribed = subscribed || ok
+	}
+	if !subscribed {
+		if err == nil {
+			err = ErrNoHealthyNode
+		}
+		return err
+	}
+	return nil
+}
+
+// subscribe subscribes the node to chain heads if it is connected and there
+// is a subscription that it is not part of yet, returning whether it is
+// subscribed
+func (mc *MultiClient) subscribe(n *node) (bool, error) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	if mc.headChan == nil || n.client == nil || n.subscribed {
+		return n.subscribed, nil
+	}
+	heads := make(chan types.RawHeader)
+	if err := n.client.SubscribeChainHead(heads); err != nil {
+		return false, err
+	}
+	n.subscribed = true
+
+	mc.shutdownWg.Add(1)
+	go func() {
+		defer mc.shutdownWg.Done()
+		mc.forwardHeaders(heads)
+	}()
+	return true, nil
+}
+
+// forwardHeaders passes on the headers a node sends that no other node has
+// sent already. Once shutting down, headers are dropped until the nodes have
+// stopped sending.
+func (mc *MultiClient) forwardHeaders(heads <-chan types.RawHeader) {
+	for {
+		select {
+		case head := <-heads:
+			if !mc.firstSeen(head.Hash) {
+				continue
+			}
+			select {
+			case mc.headChan <- head:
+			case <-mc.shutdownChan:
+			}
+		case <-mc.stoppedChan:
+			return
+		}
+	}
+}
+
+func (mc *MultiClient) firstSeen(hash types.Hash) bool {
+	mc.headersMux.Lock()
+	defer mc.headersMux.Unlock()
+	if mc.seen[hash] {
+		return false
+	}
+	mc.seen[hash] = true
+	mc.seenOrder = append(mc.seenOrder, hash)
+	if len(mc.seenOrder) > seenHeadersLimit {
+		delete(mc.seen, mc.seenOrder[0])
+		mc.seenOrder = mc.seenOrder[1:]
+	}
+	return true
+}
+
+// Execute customized graphql query.
+func (mc *MultiClient) ExecuteGraphQLQuery(result interface{}, query string) error {
+	return mc.ExecuteGraphQLQueryContext(context.Background(), result, query)
+}
+
+// Execute customized graphql query, passing the trace context on to the node.
+func (mc *MultiClient) ExecuteGraphQLQueryContext(ctx context.Context, result interface{}, query string) error {
+	return mc.call(func(c Client) error {
+		return executeGraphQLQuery(ctx, c, result, query)
+	}, func(err error) bool {
+		// errors in the response, rather than failing to get one
+		return strings.HasPrefix(err.Error(), "graphql: ")
+	})
+}
+
+// Execute customized rpc call.
+func (mc *MultiClient) RPCCall(result interface{}, method string, args ...interface{}) error {
+	return mc.call(func(c Client) error {
+		return c.RPCCall(result, method, args...)
+	}, func(err error) bool {
+		_, ok := err.(*msgError)
+		return ok
+	})
+}
+
+func (mc *MultiClient) Stop() {
+	close(mc.shutdownChan)
+	// no nodes are connected to once health checks have stopped
+	mc.healthWg.Wait()
+	for _, n := range mc.connectedNodes() {
+		n.client.Stop()
+	}
+	close(mc.stoppedChan)
+	mc.shutdownWg.Wait()
+	log.Info("Multi-node client stopped")
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// fakeNode answers calls with its name, or fails them with err
+type fakeNode struct {
+	name  string
+	mux   sync.Mutex
+	err   error
+	calls int
+	heads chan<- types.RawHeader
+}
+
+func (f *fakeNode) setErr(err error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.err = err
+}
+
+func (f *fakeNode) SubscribeChainHead(ch chan<- types.RawHeader) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.heads = ch
+	return nil
+}
+
+func (f *fakeNode) ExecuteGraphQLQuery(result interface{}, query string) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.calls++
+	if f.err != nil {
+		return f.err
+	}
+	*result.(*string) = f.name
+	return nil
+}
+
+func (f *fakeNode) RPCCall(result interface{}, method string, args ...interface{}) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.calls++
+	if f.err != nil {
+		return f.err
+	}
+	if name, ok := result.(*string); ok {
+		*name = f.name
+	}
+	return nil
+}
+
+func (f *fakeNode) Stop() {}
+
+func newTestMultiClient(t *testing.T, roundRobin bool, fakes ...*fakeNode) *MultiClient {
+	var nodes []*types.NodeConfig
+	byUrl := make(map[string]*fakeNode)
+	for _, fake := range fakes {
+		nodes = append(nodes, &types.NodeConfig{WSUrl: fake.name, GraphQLUrl: fake.name})
+		byUrl[fake.name] = fake
+	}
+	mc := newMultiClient(nodes, roundRobin, func(wsUrl, graphQLUrl string) (Client, error) {
+		fake := byUrl[wsUrl]
+		if fake.err != nil {
+			return nil, fake.err
+		}
+		return fake, nil
+	})
+	assert.Nil(t, mc.start(time.Hour))
+	return mc
+}
+
+func TestMultiClient_Failover(t *testing.T) {
+	first, second := &fakeNode{name: "first"}, &fakeNode{name: "second"}
+	mc := newTestMultiClient(t, false, first, second)
+	defer mc.Stop()
+
+	var name string
+	assert.Nil(t, mc.RPCCall(&name, "eth_chainId"))
+	assert.Equal(t, "first", name)
+	assert.Nil(t, mc.ExecuteGraphQLQuery(&name, "{block {number}}"))
+	assert.Equal(t, "first", name)
+
+	// the first node going down fails over to the second
+	first.setErr(errors.New("no WebSocket connection"))
+	assert.Nil(t, mc.RPCCall(&name, "eth_chainId"))
+	assert.Equal(t, "second", name)
+	assert.Equal(t, []*node{mc.nodes[1]}, mc.healthyNodes())
+
+	// and it is used again once it is healthy
+	first.setErr(nil)
+	mc.checkNodes()
+	assert.Nil(t, mc.RPCCall(&name, "eth_chainId"))
+	assert.Equal(t, "first", name)
+}
+
+func TestMultiClient_NodeErrorNotRetried(t *testing.T) {
+	first, second := &fakeNode{name: "first"}, &fakeNode{name: "second"}
+	mc := newTestMultiClient(t, false, first, second)
+	defer mc.Stop()
+
+	first.setErr(&msgError{Code: -32000, Message: "execution reverted"})
+	var name string
+	assert.EqualError(t, mc.RPCCall(&name, "eth_call"), "execution reverted")
+	first.setErr(errors.New("graphql: block not found"))
+	assert.EqualError(t, mc.ExecuteGraphQLQuery(&name, "{block {number}}"), "graphql: block not found")
+
+	assert.Equal(t, 1, second.calls)
+	assert.Len(t, mc.healthyNodes(), 2)
+}
+
+func TestMultiClient_RoundRobin(t *testing.T) {
+	first, second := &fakeNode{name: "first"}, &fakeNode{name: "second"}
+	mc := newTestMultiClient(t, true, first, second)
+	defer mc.Stop()
+
+	var names []string
+	for i := 0; i < 4; i++ {
+		var name string
+		assert.Nil(t, mc.RPCCall(&name, "eth_chainId"))
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"first", "second", "first", "second"}, names)
+}
+
+func TestMultiClient_NoHealthyNode(t *testing.T) {
+	fake := &fakeNode{name: "first", err: errors.New("connection refused")}
+	mc := newMultiClient([]*types.NodeConfig{{WSUrl: "first", GraphQLUrl: "first"}}, false, func(string, string) (Client, error) {
+		return nil, fake.err
+	})
+	assert.EqualError(t, mc.start(time.Hour), "connect to any node failed")
+
+	mc = newTestMultiClient(t, false, &fakeNode{name: "first"})
+	defer mc.Stop()
+	mc.nodes[0].client.(*fakeNode).setErr(errors.New("connection refused"))
+	mc.checkNodes()
+	// unhealthy nodes are still tried
+	var name string
+	assert.EqualError(t, mc.RPCCall(&name, "eth_chainId"), "connection refused")
+}
+
+func TestMultiClient_LateNode(t *testing.T) {
+	first, second := &fakeNode{name: "first"}, &fakeNode{name: "second", err: errors.New("connection refused")}
+	mc := newTestMultiClient(t, false, first, second)
+	defer mc.Stop()
+	assert.Len(t, mc.healthyNodes(), 1)
+
+	heads := make(chan types.RawHeader, 1)
+	assert.Nil(t, mc.SubscribeChainHead(heads))
+
+	// nodes connected to later are subscribed too
+	second.setErr(nil)
+	mc.checkNodes()
+	assert.Len(t, mc.healthyNodes(), 2)
+	assert.NotNil(t, second.heads)
+}
+
+func TestMultiClient_SubscribeChainHead(t *testing.T) {
+	first, second := &fakeNode{name: "first"}, &fakeNode{name: "second"}
+	mc := newTestMultiClient(t, false, first, second)
+
+	heads := make(chan types.RawHeader, 10)
+	assert.Nil(t, mc.SubscribeChainHead(heads))
+
+	// each header is passed on once, whichever node sends it first
+	first.heads <- types.RawHeader{Hash: types.NewHash("0x01")}
+	second.heads <- types.RawHeader{Hash: types.NewHash("0x01")}
+	second.heads <- types.RawHeader{Hash: types.NewHash("0x02")}
+	first.heads <- types.RawHeader{Hash: types.NewHash("0x02")}
+	first.heads <- types.RawHeader{Hash: types.NewHash("0x03")}
+	assert.Eventually(t, func() bool { return len(heads) == 3 }, time.Second, time.Millisecond)
+	mc.Stop()
+
+	close(heads)
+	var hashes []types.Hash
+	for head := range heads {
+		hashes = append(hashes, head.Hash)
+	}
+	assert.Equal(t, []types.Hash{types.NewHash("0x01"), types.NewHash("0x02"), types.NewHash("0x03")}, hashes)
+}
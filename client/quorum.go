@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
 	"reflect"
 	"sync"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/machinebox/graphql"
 
 	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/tracing"
 	"quorumengineering/quorum-report/types"
 )
 
@@ -26,7 +28,7 @@ type QuorumClient struct {
 
 func NewQuorumClient(rawUrl, qgUrl string) (*QuorumClient, error) {
 	quorumClient := &QuorumClient{
-		graphqlClient: graphql.NewClient(qgUrl),
+		graphqlClient: graphql.NewClient(qgUrl, graphql.WithHTTPClient(&http.Client{Transport: tracing.Transport(nil)})),
 		shutdownChan:  make(chan struct{}),
 	}
 	var err error
@@ -63,10 +65,15 @@ func (qc *QuorumClient) SubscribeChainHead(ch chan<- types.RawHeader) error {
 
 // Execute customized graphql query.
 func (qc *QuorumClient) ExecuteGraphQLQuery(result interface{}, query string) error {
+	return qc.ExecuteGraphQLQueryContext(context.Background(), result, query)
+}
+
+// Execute customized graphql query, passing the trace context on to the node.
+func (qc *QuorumClient) ExecuteGraphQLQueryContext(ctx context.Context, result interface{}, query string) error {
 	// Build a request from query.
 	req := graphql.NewRequest(query)
 	// Run it and capture the response.
-	return qc.graphqlClient.Run(context.Background(), req, &result)
+	return qc.graphqlClient.Run(ctx, req, &result)
 }
 
 // Execute customized rpc call.
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
@@ -99,3 +100,22 @@ func TestStubQuorumClient(t *testing.T) {
 	err = c.RPCCall(&res, "rpc_nil")
 	assert.EqualError(t, err, "not found", "unexpected error message")
 }
+
+func TestReconnectDelay(t *testing.T) {
+	delay := minReconnectDelay
+	var delays []time.Duration
+	for i := 0; i < 8; i++ {
+		delay = nextReconnectDelay(delay)
+		delays = append(delays, delay)
+	}
+	assert.Equal(t, []time.Duration{
+		2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second,
+		32 * time.Second, time.Minute, time.Minute, time.Minute,
+	}, delays)
+
+	shutdownChan := make(chan struct{})
+	close(shutdownChan)
+	delay = minReconnectDelay
+	assert.False(t, waitToReconnect(&delay, shutdownChan))
+	assert.Equal(t, minReconnectDelay, delay)
+}
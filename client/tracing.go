@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+
+	"quorumengineering/quorum-report/tracing"
+)
+
+// tracedClient records a span for each call it makes to the node, as a child
+// of the span in its context
+type tracedClient struct {
+	Client
+	ctx context.Context
+}
+
+// WithContext returns a client whose calls to the node are traced as part of
+// the span in the context. The client is returned as it is if the context
+// carries no span, or if it is for a node other than GoQuorum, as the node
+// specific calls are found on it directly.
+func WithContext(ctx context.Context, c Client) Client {
+	if tracing.FromContext(ctx) == nil {
+		return c
+	}
+	if _, ok := c.(NodeClient); ok {
+		return c
+	}
+	return &tracedClient{Client: c, ctx: ctx}
+}
+
+func (tc *tracedClient) ExecuteGraphQLQuery(result interface{}, query string) error {
+	ctx, span := tracing.StartClient(tc.ctx, "graphql", tracing.String("rpc.system", "graphql"))
+	defer span.End()
+	err := executeGraphQLQuery(ctx, tc.Client, result, query)
+	span.RecordError(err)
+	return err
+}
+
+func (tc *tracedClient) RPCCall(result interface{}, method string, args ...interface{}) error {
+	_, span := tracing.StartClient(tc.ctx, method, tracing.String("rpc.system", "jsonrpc"), tracing.String("rpc.method", method))
+	defer span.End()
+	err := tc.Client.RPCCall(result, method, args...)
+	span.RecordError(err)
+	return err
+}
+
+// executeGraphQLQuery runs the query in the context, if the client can pass
+// the trace context on to the node
+func executeGraphQLQuery(ctx context.Context, c Client, result interface{}, query string) error {
+	if cc, ok := c.(ContextClient); ok {
+		return cc.ExecuteGraphQLQueryContext(ctx, result, query)
+	}
+	return c.ExecuteGraphQLQuery(result, query)
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/tracing"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestWithContext(t *testing.T) {
+	address := types.NewAddress("0x0000000000000000000000000000000000000010")
+	stub := NewStubQuorumClient(nil, map[string]interface{}{"eth_getCode" + address.String() + "0x0": types.NewHexData("6080")})
+	// untraced calls are made on the client itself
+	assert.Equal(t, stub, WithContext(context.Background(), stub))
+
+	collector := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer collector.Close()
+	exporter := tracing.NewExporter(&types.TracingConfig{Endpoint: collector.URL, SampleRatio: 1})
+	assert.Nil(t, exporter.Start())
+	defer exporter.Stop()
+	ctx, span := tracing.Start(context.Background(), "process block")
+	defer span.End()
+
+	traced := WithContext(ctx, stub)
+	assert.NotEqual(t, stub, traced)
+	code, err := GetCode(traced, address, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, types.NewHexData("6080"), code)
+
+	// node specific calls are only found on the client itself
+	besu := &BesuClient{Client: stub}
+	assert.Equal(t, besu, WithContext(ctx, besu))
+}
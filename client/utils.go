@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math/big"
 
 	"quorumengineering/quorum-report/log"
 	"quorumengineering/quorum-report/types"
@@ -16,7 +17,14 @@ const (
 	traceTransaction = "debug_traceTransaction"
 	getCode          = "eth_getCode"
 	getBlockByNumber = "eth_getBlockByNumber"
+	getBlockByHash   = "eth_getBlockByHash"
+	getTxByHash      = "eth_getTransactionByHash"
+	newPendingFilter = "eth_newPendingTransactionFilter"
+	newBlockFilter   = "eth_newBlockFilter"
+	getFilterChanges = "eth_getFilterChanges"
 	ethStorageRoot   = "eth_storageRoot"
+	chainID          = "eth_chainId"
+	getQuorumPayload = "eth_getQuorumPayload"
 	protocolKey      = "protocols"
 	istanbulKey      = "istanbul"
 	consensusKey     = "consensus"
@@ -24,6 +32,9 @@ const (
 )
 
 func DumpAddress(c Client, address types.Address, blockNumber uint64) (*types.AccountState, error) {
+	if nc, ok := c.(NodeClient); ok {
+		return nc.DumpAddress(address, blockNumber)
+	}
 	log.Debug("Fetching account dump", "account", address.String(), "blocknumber", blockNumber)
 	dumpAccount := &types.RawAccountState{}
 	err := c.RPCCall(&dumpAccount, dumpAddress, address.String(), fmtBlockNum(blockNumber))
@@ -43,6 +54,9 @@ func fmtBlockNum(blockNumber uint64) string {
 }
 
 func TraceTransaction(c Client, txHash types.Hash) (types.RawOuterCall, error) {
+	if nc, ok := c.(NodeClient); ok {
+		return nc.TraceTransaction(txHash)
+	}
 	log.Debug("Tracing transaction", "tx", txHash.String())
 
 	// Trace internal calls of the transaction
@@ -69,7 +83,26 @@ func GetCode(c Client, address types.Address, blockNumber uint64) (types.HexData
 	return res, nil
 }
 
+// QuorumPayload fetches the private payload of a private transaction from the
+// node's private transaction manager, by the hash the transaction has as its
+// input. The payload is empty if the node isn't a party to the transaction,
+// and for nodes without GoQuorum's private transaction APIs.
+func QuorumPayload(c Client, payloadHash types.HexData) (types.HexData, error) {
+	if _, ok := c.(NodeClient); ok {
+		return "", nil
+	}
+	log.Debug("Fetching private payload", "hash", payloadHash.String())
+	var res types.HexData
+	if err := c.RPCCall(&res, getQuorumPayload, payloadHash.String()); err != nil {
+		return "", err
+	}
+	return res, nil
+}
+
 func Consensus(c Client) (string, error) {
+	if nc, ok := c.(NodeClient); ok {
+		return nc.Consensus()
+	}
 	log.Debug("Fetching consensus info")
 
 	var resp map[string]interface{}
@@ -128,6 +161,54 @@ func BlockByNumber(c Client, blockNum uint64) (types.RawBlock, error) {
 	return blockOrigin, err
 }
 
+func BlockByHash(c Client, blockHash types.Hash) (types.RawBlock, error) {
+	var blockOrigin types.RawBlock
+	err := c.RPCCall(&blockOrigin, getBlockByHash, blockHash.String(), false)
+
+	return blockOrigin, err
+}
+
+// PendingTransaction fetches a transaction from the node, which may still be
+// waiting in its transaction pool
+func PendingTransaction(c Client, transactionHash types.Hash) (types.RawPendingTransaction, error) {
+	var tx types.RawPendingTransaction
+	err := c.RPCCall(&tx, getTxByHash, transactionHash.String())
+	return tx, err
+}
+
+// NewPendingTransactionFilter installs a filter on the node for the hashes of
+// transactions added to its pool, returning the filter's ID
+func NewPendingTransactionFilter(c Client) (string, error) {
+	var id string
+	err := c.RPCCall(&id, newPendingFilter)
+	return id, err
+}
+
+// NewBlockFilter installs a filter on the node for the hashes of new blocks,
+// returning the filter's ID
+func NewBlockFilter(c Client) (string, error) {
+	var id string
+	err := c.RPCCall(&id, newBlockFilter)
+	return id, err
+}
+
+// FilterChanges returns the hashes a pending transaction or block filter has
+// found since it was last asked. The node removes filters that aren't asked
+// for a while, after which this fails.
+func FilterChanges(c Client, filterID string) ([]types.Hash, error) {
+	var hashes []types.Hash
+	err := c.RPCCall(&hashes, getFilterChanges, filterID)
+	return hashes, err
+}
+
+func ChainID(c Client) (uint64, error) {
+	var res types.HexNumber
+	if err := c.RPCCall(&res, chainID); err != nil {
+		return 0, err
+	}
+	return uint64(res), nil
+}
+
 func CurrentBlock(c Client) (uint64, error) {
 	log.Debug("Fetching current block number")
 
@@ -141,6 +222,9 @@ func CurrentBlock(c Client) (uint64, error) {
 }
 
 func TransactionWithReceipt(c Client, transactionHash types.Hash) (Transaction, error) {
+	if nc, ok := c.(NodeClient); ok {
+		return nc.TransactionWithReceipt(transactionHash)
+	}
 	var txResult TransactionResult
 	if err := c.ExecuteGraphQLQuery(&txResult, TransactionDetailQuery(transactionHash)); err != nil {
 		return Transaction{}, err
@@ -163,7 +247,25 @@ func CallBalanceOfERC20(c Client, contract types.Address, holder types.Address,
 	return res, err
 }
 
+func CallBalanceOfERC1155(c Client, contract types.Address, holder types.Address, tokenId *big.Int, blockNum uint64) (types.HexData, error) {
+	// 00fdd58e is the 4byte function sig for `balanceOf(address,uint256)`
+	// the holder address and token ID are both padded to 32 bytes
+
+	blockAsHex := fmtBlockNum(blockNum)
+	msg := types.EIP165Call{
+		To:   contract,
+		Data: types.NewHexData("0x00fdd58e" + "000000000000000000000000" + string(holder) + fmt.Sprintf("%064x", tokenId)),
+	}
+
+	var res types.HexData
+	err := c.RPCCall(&res, ethCall, msg, blockAsHex)
+	return res, err
+}
+
 func StorageRoot(c Client, account types.Address, blockNum uint64) (types.Hash, error) {
+	if nc, ok := c.(NodeClient); ok {
+		return nc.StorageRoot(account, blockNum)
+	}
 	var res types.Hash
 	err := c.RPCCall(&res, ethStorageRoot, account.String(), fmt.Sprintf("0x%x", blockNum))
 	if err != nil && err.Error() == "can't find state object" {
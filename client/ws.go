@@ -16,6 +16,13 @@ import (
 	"quorumengineering/quorum-report/log"
 )
 
+// the delay before reconnecting doubles after each failed attempt, from
+// minReconnectDelay up to maxReconnectDelay
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
 type message struct {
 	Version string          `json:"jsonrpc,omitempty"`
 	ID      string          `json:"id,omitempty"`
@@ -153,6 +160,7 @@ func (c *webSocketClient) sendRPCMsg(ch chan<- *message, method string, args ...
 
 // listen and handle message
 func (c *webSocketClient) listen(shutdownChan <-chan struct{}) {
+	reconnectDelay := minReconnectDelay
 	for {
 		// check shutdown channel
 		select {
@@ -168,17 +176,21 @@ func (c *webSocketClient) listen(shutdownChan <-chan struct{}) {
 		if c.conn == nil {
 			if err := c.dial(c.rawUrl); err != nil {
 				log.Error("Dialing failed", "error", err)
-				log.Debug("Retry connection in 1 second")
-				// retry connection in one second
-				ticker := time.NewTicker(time.Second)
-				<-ticker.C
-				ticker.Stop()
+				if !waitToReconnect(&reconnectDelay, shutdownChan) {
+					log.Debug("WebSocket listener stopped")
+					return
+				}
 				continue
 			}
-			if c.chainHeadSubscriptionId != "" {
+			// re-subscribe, even if the node never confirmed the last subscription
+			if c.chainHeadChan != nil {
 				if err := c.subscribeChainHead(c.chainHeadChan); err != nil {
 					log.Debug("Reconnect subscribe to chain head failed")
 					c.resetConn()
+					if !waitToReconnect(&reconnectDelay, shutdownChan) {
+						log.Debug("WebSocket listener stopped")
+						return
+					}
 					continue
 				}
 			}
@@ -191,6 +203,7 @@ func (c *webSocketClient) listen(shutdownChan <-chan struct{}) {
 			c.resetConn()
 			continue
 		}
+		reconnectDelay = minReconnectDelay
 		log.Debug("WebSocket message received", "msg", string(msg))
 		var receivedMsg message
 		if err = json.Unmarshal(msg, &receivedMsg); err != nil {
@@ -232,6 +245,28 @@ func (c *webSocketClient) listen(shutdownChan <-chan struct{}) {
 	}
 }
 
+// waitToReconnect waits for the delay and doubles it for the next attempt,
+// returning false if shutting down
+func waitToReconnect(delay *time.Duration, shutdownChan <-chan struct{}) bool {
+	log.Debug("Retry connection", "delay", *delay)
+	timer := time.NewTimer(*delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-shutdownChan:
+		return false
+	}
+	*delay = nextReconnectDelay(*delay)
+	return true
+}
+
+func nextReconnectDelay(delay time.Duration) time.Duration {
+	if delay*2 > maxReconnectDelay {
+		return maxReconnectDelay
+	}
+	return delay * 2
+}
+
 // rpc pending message map update
 func (c *webSocketClient) setPendingRPC(id string, ch chan<- *message) {
 	c.rpcMux.Lock()
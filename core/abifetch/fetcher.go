@@ -0,0 +1,218 @@
+package abifetch
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// queueSize is how many contracts can wait to be looked up, after which new
+// ones are left for the next check
+const queueSize = 1000
+
+type FetcherDB interface {
+	GetAddresses() ([]types.Address, error)
+	GetContractABI(types.Address) (string, error)
+}
+
+// ABIStore stores the ABI of a registered contract
+type ABIStore interface {
+	AddContractABI(address types.Address, abi string) error
+}
+
+// Fetcher looks up the verified ABIs of registered contracts that don't have
+// one, so they don't need to be added by hand. Contracts are looked up as the
+// monitor sees them deployed, and registered contracts are checked for a
+// missing ABI on start and every poll interval after. A contract that isn't
+// verified is only looked up once per run.
+type Fetcher struct {
+	db           FetcherDB
+	store        ABIStore
+	quorumClient client.Client
+	source       Source
+	pollInterval time.Duration
+
+	queue chan types.Address
+	// contracts already looked up, whether or not an ABI was found
+	looked    map[types.Address]bool
+	lookedMux sync.Mutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewFetcher(db FetcherDB, store ABIStore, quorumClient client.Client, config *types.ABIFetchConfig) (*Fetcher, error) {
+	var source Source
+	switch config.Source {
+	case types.SourcifySource:
+		chainID := config.ChainID
+		if chainID == 0 {
+			var err error
+			if chainID, err = client.ChainID(quorumClient); err != nil {
+				return nil, fmt.Errorf("unable to find the chain ID for Sourcify: %v", err)
+			}
+		}
+		source = NewSourcifySource(config.URL, chainID)
+	case types.RegistrySource:
+		source = NewRegistrySource(config.URL)
+	default:
+		return nil, errors.New("invalid ABI fetch source: " + config.Source)
+	}
+	return newFetcher(db, store, quorumClient, source, time.Duration(config.PollInterval)*time.Second), nil
+}
+
+func newFetcher(db FetcherDB, store ABIStore, quorumClient client.Client, source Source, pollInterval time.Duration) *Fetcher {
+	return &Fetcher{
+		db:           db,
+		store:        store,
+		quorumClient: quorumClient,
+		source:       source,
+		pollInterval: pollInterval,
+		queue:        make(chan types.Address, queueSize),
+		looked:       make(map[types.Address]bool),
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (f *Fetcher) Start() error {
+	log.Info("Starting ABI fetcher")
+	f.shutdownWg.Add(2)
+	go f.poll()
+	go f.work()
+	log.Info("ABI fetcher started")
+	return nil
+}
+
+func (f *Fetcher) Stop() {
+	close(f.shutdownChan)
+	f.shutdownWg.Wait()
+	log.Info("ABI fetcher stopped")
+}
+
+// Lookup queues a contract to have its ABI looked up, if it is registered
+// without one by the time it comes up. It doesn't wait for the lookup.
+func (f *Fetcher) Lookup(address types.Address) {
+	select {
+	case f.queue <- address:
+	default:
+		log.Warn("ABI lookup queue full, leaving the contract for the next check", "address", address.String())
+	}
+}
+
+// poll queues the registered contracts without an ABI, on start and every
+// poll interval after
+func (f *Fetcher) poll() {
+	defer f.shutdownWg.Done()
+	ticker := time.NewTicker(f.pollInterval)
+	defer ticker.Stop()
+	for {
+		addresses, err := f.db.GetAddresses()
+		if err != nil {
+			log.Warn("Unable to check registered contracts for missing ABIs", "err", err)
+		}
+		for _, address := range addresses {
+			if !f.wasLooked(address) {
+				f.Lookup(address)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-f.shutdownChan:
+			return
+		}
+	}
+}
+
+func (f *Fetcher) work() {
+	defer f.shutdownWg.Done()
+	for {
+		select {
+		case address := <-f.queue:
+			if err := f.fetch(address); err != nil {
+				log.Warn("Unable to look up contract ABI", "address", address.String(), "err", err)
+			}
+		case <-f.shutdownChan:
+			return
+		}
+	}
+}
+
+func (f *Fetcher) wasLooked(address types.Address) bool {
+	f.lookedMux.Lock()
+	defer f.lookedMux.Unlock()
+	return f.looked[address]
+}
+
+// fetch looks up and stores the ABI of the contract, unless it isn't
+// registered or already has one. A contract whose lookup fails is looked up
+// again on the next check.
+func (f *Fetcher) fetch(address types.Address) error {
+	if f.wasLooked(address) {
+		return nil
+	}
+	registered, err := f.db.GetAddresses()
+	if err != nil {
+		return err
+	}
+	if !containsAddress(registered, address) {
+		return nil
+	}
+	contractABI, err := f.db.GetContractABI(address)
+	if err != nil {
+		return err
+	}
+	if contractABI != "" {
+		f.markLooked(address)
+		return nil
+	}
+
+	currentBlock, err := client.CurrentBlock(f.quorumClient)
+	if err != nil {
+		return err
+	}
+	code, err := client.GetCode(f.quorumClient, address, currentBlock)
+	if err != nil {
+		return err
+	}
+	if len(code.AsBytes()) == 0 {
+		// not deployed yet, or self-destructed
+		return nil
+	}
+	if contractABI, err = f.source.ABI(address, code.AsBytes()); err != nil {
+		return err
+	}
+	f.markLooked(address)
+	if contractABI == "" {
+		log.Debug("Contract is not verified", "address", address.String())
+		return nil
+	}
+	if _, err := types.NewABIStructureFromJSON(contractABI); err != nil {
+		return fmt.Errorf("invalid ABI: %v", err)
+	}
+	if err := f.store.AddContractABI(address, contractABI); err != nil {
+		return err
+	}
+	log.Info("Added verified contract ABI", "address", address.String())
+	return nil
+}
+
+func (f *Fetcher) markLooked(address types.Address) {
+	f.lookedMux.Lock()
+	defer f.lookedMux.Unlock()
+	f.looked[address] = true
+}
+
+func containsAddress(addresses []types.Address, address types.Address) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
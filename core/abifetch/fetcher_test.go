@@ -0,0 +1,114 @@
+package abifetch
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/types"
+)
+
+var (
+	verified     = types.NewAddress("0x0000000000000000000000000000000000000001")
+	unverified   = types.NewAddress("0x0000000000000000000000000000000000000002")
+	withABI      = types.NewAddress("0x0000000000000000000000000000000000000003")
+	notDeployed  = types.NewAddress("0x0000000000000000000000000000000000000004")
+	unregistered = types.NewAddress("0x0000000000000000000000000000000000000005")
+)
+
+type fakeDB struct {
+	abis map[types.Address]string
+	mux  sync.Mutex
+}
+
+func (f *fakeDB) GetAddresses() ([]types.Address, error) {
+	return []types.Address{verified, unverified, withABI, notDeployed}, nil
+}
+
+func (f *fakeDB) GetContractABI(address types.Address) (string, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.abis[address], nil
+}
+
+func (f *fakeDB) AddContractABI(address types.Address, abi string) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.abis[address] = abi
+	return nil
+}
+
+type fakeSource struct {
+	abis   map[types.Address]string
+	looked []types.Address
+	err    error
+	mux    sync.Mutex
+}
+
+func (f *fakeSource) ABI(address types.Address, code []byte) (string, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.looked = append(f.looked, address)
+	return f.abis[address], f.err
+}
+
+func newTestFetcher(db *fakeDB, source *fakeSource) *Fetcher {
+	quorumClient := client.NewStubQuorumClient(map[string]map[string]interface{}{
+		client.CurrentBlockQuery(): {"block": map[string]interface{}{"number": "0x10"}},
+	}, map[string]interface{}{
+		"eth_getCode0x00000000000000000000000000000000000000010x10": types.NewHexData("0x6080"),
+		"eth_getCode0x00000000000000000000000000000000000000020x10": types.NewHexData("0x6080"),
+		"eth_getCode0x00000000000000000000000000000000000000040x10": types.NewHexData("0x"),
+	})
+	return newFetcher(db, db, quorumClient, source, time.Hour)
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	db := &fakeDB{abis: map[types.Address]string{withABI: testABI}}
+	source := &fakeSource{abis: map[types.Address]string{verified: testABI}}
+	f := newTestFetcher(db, source)
+
+	for _, address := range []types.Address{verified, unverified, withABI, notDeployed, unregistered} {
+		assert.Nil(t, f.fetch(address))
+	}
+	// only registered and deployed contracts without an ABI are looked up
+	assert.Equal(t, []types.Address{verified, unverified}, source.looked)
+	assert.Equal(t, map[types.Address]string{verified: testABI, withABI: testABI}, db.abis)
+
+	// and only once
+	assert.Nil(t, f.fetch(unverified))
+	assert.Len(t, source.looked, 2)
+}
+
+func TestFetcher_FetchError(t *testing.T) {
+	db := &fakeDB{abis: map[types.Address]string{}}
+	source := &fakeSource{err: errors.New("connection refused")}
+	f := newTestFetcher(db, source)
+
+	assert.EqualError(t, f.fetch(verified), "connection refused")
+	// a failed lookup is tried again
+	source.err = nil
+	source.abis = map[types.Address]string{verified: "not an ABI"}
+	assert.EqualError(t, f.fetch(verified), "invalid ABI: invalid character 'o' in literal null (expecting 'u')")
+	assert.Empty(t, db.abis)
+}
+
+func TestFetcher_StartLooksUpRegisteredContracts(t *testing.T) {
+	db := &fakeDB{abis: map[types.Address]string{}}
+	source := &fakeSource{abis: map[types.Address]string{verified: testABI}}
+	f := newTestFetcher(db, source)
+
+	assert.Nil(t, f.Start())
+	defer f.Stop()
+	for i := 0; i < 100; i++ {
+		if abi, _ := db.GetContractABI(verified); abi != "" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("ABI was not fetched")
+}
@@ -0,0 +1,125 @@
+package abifetch
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+
+	"quorumengineering/quorum-report/types"
+)
+
+var errNoMetadataHash = errors.New("no metadata hash in bytecode")
+
+// metadataHash returns the hash of the contract metadata that Solidity appends
+// to the runtime bytecode: a CBOR map ending the code, followed by its length
+// in two bytes, that has an "ipfs", "bzzr1" or "bzzr0" entry
+func metadataHash(code []byte) ([]byte, error) {
+	if len(code) < 2 {
+		return nil, errNoMetadataHash
+	}
+	length := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	if length == 0 || length+2 > len(code) {
+		return nil, errNoMetadataHash
+	}
+	r := &cborReader{data: code[len(code)-2-length : len(code)-2]}
+
+	major, entries, ok := r.header()
+	if !ok || major != cborMap {
+		return nil, errNoMetadataHash
+	}
+	for i := uint64(0); i < entries; i++ {
+		major, keyLength, ok := r.header()
+		if !ok || major != cborText {
+			return nil, errNoMetadataHash
+		}
+		key, ok := r.bytes(keyLength)
+		if !ok {
+			return nil, errNoMetadataHash
+		}
+		major, valueLength, ok := r.header()
+		if !ok {
+			return nil, errNoMetadataHash
+		}
+		// other entries are the compiler version and experimental flag
+		if major != cborBytes && major != cborText {
+			continue
+		}
+		value, ok := r.bytes(valueLength)
+		if !ok {
+			return nil, errNoMetadataHash
+		}
+		switch string(key) {
+		case "ipfs", "bzzr1", "bzzr0":
+			return value, nil
+		}
+	}
+	return nil, errNoMetadataHash
+}
+
+// CBOR major types used in the metadata
+const (
+	cborBytes = 2
+	cborText  = 3
+	cborMap   = 5
+)
+
+// cborReader reads the few CBOR items the metadata is made of
+type cborReader struct {
+	data   []byte
+	offset int
+}
+
+// header reads the major type of the next item and its argument, which is
+// the length of strings, the number of entries of maps, or the value of
+// simple values
+func (r *cborReader) header() (byte, uint64, bool) {
+	if r.offset >= len(r.data) {
+		return 0, 0, false
+	}
+	major, info := r.data[r.offset]>>5, r.data[r.offset]&0x1f
+	r.offset++
+	switch {
+	case info < 24:
+		return major, uint64(info), true
+	case info == 24:
+		value, ok := r.bytes(1)
+		if !ok {
+			return 0, 0, false
+		}
+		return major, uint64(value[0]), true
+	case info == 25:
+		value, ok := r.bytes(2)
+		if !ok {
+			return 0, 0, false
+		}
+		return major, uint64(value[0])<<8 | uint64(value[1]), true
+	}
+	return 0, 0, false
+}
+
+func (r *cborReader) bytes(n uint64) ([]byte, bool) {
+	if uint64(len(r.data)-r.offset) < n {
+		return nil, false
+	}
+	value := r.data[r.offset : r.offset+int(n)]
+	r.offset += int(n)
+	return value, true
+}
+
+// checksumAddress returns the address in its EIP-55 mixed case form
+func checksumAddress(address types.Address) string {
+	lower := strings.TrimPrefix(strings.ToLower(address.String()), "0x")
+	d := sha3.NewLegacyKeccak256()
+	d.Write([]byte(lower))
+	hash := hex.EncodeToString(d.Sum(nil))
+
+	checksummed := []byte(lower)
+	for i, c := range checksummed {
+		if c >= 'a' && c <= 'f' && hash[i] >= '8' {
+			checksummed[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(checksummed)
+}
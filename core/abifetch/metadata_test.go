@@ -0,0 +1,49 @@
+package abifetch
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	assert.Nil(t, err)
+	return b
+}
+
+func TestMetadataHash(t *testing.T) {
+	// solc 0.5, with a bzzr0 hash
+	code := mustDecodeHex(t, "6080604052600080fdfea165627a7a7230582061f6956b053dbf99873b363ab3ba7bca70853ba5efbaff898cd840d71c54fc1d0029")
+	hash, err := metadataHash(code)
+	assert.Nil(t, err)
+	assert.Equal(t, "61f6956b053dbf99873b363ab3ba7bca70853ba5efbaff898cd840d71c54fc1d", hex.EncodeToString(hash))
+
+	// solc 0.6 and later, with an ipfs hash and the compiler version
+	code = mustDecodeHex(t, "6080604052600080fdfea264697066735822122012c9ed3a8d7d4f25d0c1a8b2bd8fd4e5dd8d5a6ebbd9f6eec36aa8ac57b0aa1e64736f6c634300060c0033")
+	hash, err = metadataHash(code)
+	assert.Nil(t, err)
+	assert.Equal(t, "122012c9ed3a8d7d4f25d0c1a8b2bd8fd4e5dd8d5a6ebbd9f6eec36aa8ac57b0aa1e", hex.EncodeToString(hash))
+
+	// no metadata, or a length running past the start of the code
+	_, err = metadataHash(mustDecodeHex(t, "6080604052600080fd"))
+	assert.Equal(t, errNoMetadataHash, err)
+	_, err = metadataHash(mustDecodeHex(t, "a1ffff"))
+	assert.Equal(t, errNoMetadataHash, err)
+	_, err = metadataHash(nil)
+	assert.Equal(t, errNoMetadataHash, err)
+}
+
+func TestChecksumAddress(t *testing.T) {
+	for _, expected := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		assert.Equal(t, expected, checksumAddress(types.NewAddress(expected)))
+	}
+}
@@ -0,0 +1,122 @@
+package abifetch
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Source looks up the verified ABIs of contracts
+type Source interface {
+	// ABI returns the ABI of the contract with the runtime bytecode, or an
+	// empty string if the source doesn't know it
+	ABI(address types.Address, code []byte) (string, error)
+}
+
+// errNotFound is returned by get for a 404 response
+var errNotFound = errors.New("not found")
+
+// SourcifySource looks contracts up in a Sourcify repository by chain ID and
+// address, preferring full matches, whose metadata is identical to that the
+// contract was compiled with, over partial ones.
+type SourcifySource struct {
+	url     string
+	chainID uint64
+	client  *http.Client
+}
+
+func NewSourcifySource(url string, chainID uint64) *SourcifySource {
+	return &SourcifySource{
+		url:     strings.TrimSuffix(url, "/"),
+		chainID: chainID,
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (s *SourcifySource) ABI(address types.Address, code []byte) (string, error) {
+	for _, match := range []string{"full_match", "partial_match"} {
+		url := fmt.Sprintf("%s/contracts/%s/%d/%s/metadata.json", s.url, match, s.chainID, checksumAddress(address))
+		body, err := get(s.client, url)
+		if err == errNotFound {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return abiFromMetadata(body)
+	}
+	return "", nil
+}
+
+// RegistrySource looks contracts up in an internal registry by the hex
+// encoded metadata hash in their bytecode, at <url>/<hash>. The registry
+// responds with either the contract metadata or just the ABI.
+type RegistrySource struct {
+	url    string
+	client *http.Client
+}
+
+func NewRegistrySource(url string) *RegistrySource {
+	return &RegistrySource{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (s *RegistrySource) ABI(address types.Address, code []byte) (string, error) {
+	hash, err := metadataHash(code)
+	if err == errNoMetadataHash {
+		return "", nil
+	}
+	body, err := get(s.client, s.url+"/"+hex.EncodeToString(hash))
+	if err == errNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+		return trimmed, nil
+	}
+	return abiFromMetadata(body)
+}
+
+// abiFromMetadata extracts the ABI from the contract metadata
+func abiFromMetadata(body []byte) (string, error) {
+	var metadata struct {
+		Output struct {
+			ABI json.RawMessage `json:"abi"`
+		} `json:"output"`
+	}
+	if err := json.Unmarshal(body, &metadata); err != nil {
+		return "", fmt.Errorf("invalid contract metadata: %v", err)
+	}
+	if len(metadata.Output.ABI) == 0 {
+		return "", errors.New("contract metadata has no ABI")
+	}
+	return string(metadata.Output.ABI), nil
+}
+
+func get(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with status %d", url, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
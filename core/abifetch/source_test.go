@@ -0,0 +1,82 @@
+package abifetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const testABI = `[{"anonymous":false,"inputs":[{"indexed":false,"name":"_value","type":"uint256"}],"name":"valueSet","type":"event"}]`
+
+func TestSourcifySource(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requested = append(requested, req.URL.Path)
+		switch req.URL.Path {
+		case "/contracts/partial_match/10/0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed/metadata.json":
+			w.Write([]byte(`{"compiler":{"version":"0.6.12"},"output":{"abi":` + testABI + `}}`))
+		case "/contracts/full_match/10/0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359/metadata.json":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	source := NewSourcifySource(server.URL+"/", 10)
+
+	// only a partial match
+	contractABI, err := source.ABI(types.NewAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, testABI, contractABI)
+	assert.Equal(t, []string{
+		"/contracts/full_match/10/0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed/metadata.json",
+		"/contracts/partial_match/10/0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed/metadata.json",
+	}, requested)
+
+	// not verified
+	contractABI, err = source.ABI(types.NewAddress("1"), nil)
+	assert.Nil(t, err)
+	assert.Empty(t, contractABI)
+
+	_, err = source.ABI(types.NewAddress("0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359"), nil)
+	assert.EqualError(t, err, server.URL+"/contracts/full_match/10/0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359/metadata.json responded with status 500")
+}
+
+func TestRegistrySource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/abis/61f6956b053dbf99873b363ab3ba7bca70853ba5efbaff898cd840d71c54fc1d":
+			w.Write([]byte(testABI))
+		case "/abis/122012c9ed3a8d7d4f25d0c1a8b2bd8fd4e5dd8d5a6ebbd9f6eec36aa8ac57b0aa1e":
+			w.Write([]byte(`{"output":{"abi":` + testABI + `}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	source := NewRegistrySource(server.URL + "/abis")
+
+	// the registry responds with the ABI
+	contractABI, err := source.ABI(types.NewAddress("1"), mustDecodeHex(t, "6080604052600080fdfea165627a7a7230582061f6956b053dbf99873b363ab3ba7bca70853ba5efbaff898cd840d71c54fc1d0029"))
+	assert.Nil(t, err)
+	assert.Equal(t, testABI, contractABI)
+
+	// the registry responds with the metadata
+	contractABI, err = source.ABI(types.NewAddress("1"), mustDecodeHex(t, "6080604052600080fdfea264697066735822122012c9ed3a8d7d4f25d0c1a8b2bd8fd4e5dd8d5a6ebbd9f6eec36aa8ac57b0aa1e64736f6c634300060c0033"))
+	assert.Nil(t, err)
+	assert.Equal(t, testABI, contractABI)
+
+	// code without a metadata hash isn't looked up
+	contractABI, err = source.ABI(types.NewAddress("1"), mustDecodeHex(t, "6080604052600080fd"))
+	assert.Nil(t, err)
+	assert.Empty(t, contractABI)
+
+	// not in the registry
+	contractABI, err = source.ABI(types.NewAddress("1"), mustDecodeHex(t, "6080604052600080fdfea165627a7a7230582000000000000000000000000000000000000000000000000000000000000000000029"))
+	assert.Nil(t, err)
+	assert.Empty(t, contractABI)
+}
@@ -0,0 +1,260 @@
+package anomaly
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// maxFilterLag is how far behind the last persisted block an address can be
+// indexed and still be sampled; counts for an address that is catching up
+// would otherwise all look like spikes
+const maxFilterLag = 100
+
+type seriesKey struct {
+	address types.Address
+	metric  string
+}
+
+// series is the recent per-interval counts of one metric for one address
+type series struct {
+	samples   []uint64
+	lastTotal uint64
+	hasTotal  bool
+	anomaly   *types.Anomaly
+}
+
+// AnomalyDetector periodically samples how many events and transactions each
+// registered contract had since the last sample, and flags counts that are
+// far from the moving average: spikes, or silence from a usually busy
+// contract. Alerts are sent to the sinks when an anomaly starts and when it
+// is resolved.
+//
+// Spikes are added to the moving average, so a lasting increase becomes the
+// new normal. Silent samples are not, so a contract that stops stays flagged
+// until its activity returns.
+type AnomalyDetector struct {
+	db         database.Database
+	sinks      []AlertSink
+	interval   time.Duration
+	window     int
+	minSamples int
+	threshold  float64
+
+	series map[seriesKey]*series
+	mux    sync.RWMutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewAnomalyDetector(db database.Database, config *types.AnomalyDetectionConfig) *AnomalyDetector {
+	sinks := []AlertSink{&LogSink{}}
+	for _, url := range config.Webhooks {
+		sinks = append(sinks, NewWebhookSink(url))
+	}
+	return &AnomalyDetector{
+		db:           db,
+		sinks:        sinks,
+		interval:     time.Duration(config.Interval) * time.Second,
+		window:       config.Window,
+		minSamples:   config.MinSamples,
+		threshold:    config.Threshold,
+		series:       make(map[seriesKey]*series),
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (d *AnomalyDetector) Start() error {
+	log.Info("Starting anomaly detector", "interval", d.interval)
+
+	d.shutdownWg.Add(1)
+	go func() {
+		defer d.shutdownWg.Done()
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := d.Sample(time.Now()); err != nil {
+					log.Warn("Sampling contract activity failed", "err", err)
+				}
+			case <-d.shutdownChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *AnomalyDetector) Stop() {
+	close(d.shutdownChan)
+	d.shutdownWg.Wait()
+	log.Info("Anomaly detector stopped")
+}
+
+// Anomalies returns all current anomalies, ordered by address and metric.
+func (d *AnomalyDetector) Anomalies() []*types.Anomaly {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	anomalies := make([]*types.Anomaly, 0)
+	for _, s := range d.series {
+		if s.anomaly != nil {
+			anomaly := *s.anomaly
+			anomalies = append(anomalies, &anomaly)
+		}
+	}
+	sort.Slice(anomalies, func(i, j int) bool {
+		if anomalies[i].Address != anomalies[j].Address {
+			return anomalies[i].Address < anomalies[j].Address
+		}
+		return anomalies[i].Metric < anomalies[j].Metric
+	})
+	return anomalies
+}
+
+// Sample takes the event and transaction counts of all registered addresses
+// since the previous sample, and alerts on any anomalies.
+func (d *AnomalyDetector) Sample(now time.Time) error {
+	lastPersisted, err := d.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		return err
+	}
+	addresses, err := d.db.GetAddresses()
+	if err != nil {
+		return err
+	}
+
+	totals := make(map[seriesKey]uint64)
+	caughtUp := make(map[types.Address]bool)
+	for _, address := range addresses {
+		lastFiltered, err := d.db.GetLastFiltered(address)
+		if err != nil {
+			return err
+		}
+		caughtUp[address] = lastFiltered+maxFilterLag >= lastPersisted
+
+		options := &types.QueryOptions{}
+		options.SetDefaults()
+		txTotal, err := d.db.GetTransactionsToAddressTotal(address, options)
+		if err != nil {
+			return err
+		}
+		eventTotal, err := d.db.GetEventsFromAddressTotal(address, options)
+		if err != nil {
+			return err
+		}
+		totals[seriesKey{address, types.TransactionsMetric}] = txTotal
+		totals[seriesKey{address, types.EventsMetric}] = eventTotal
+	}
+
+	var alerts []*Alert
+	d.mux.Lock()
+	for key := range d.series {
+		if _, ok := totals[key]; !ok {
+			// the address was deleted
+			delete(d.series, key)
+		}
+	}
+	for key, total := range totals {
+		if alert := d.observe(key, total, caughtUp[key.address], now); alert != nil {
+			alerts = append(alerts, alert)
+		}
+	}
+	d.mux.Unlock()
+
+	for _, alert := range alerts {
+		for _, sink := range d.sinks {
+			if err := sink.Send(alert); err != nil {
+				log.Warn("Unable to send anomaly alert", "sink", sink.Name(), "err", err)
+			}
+		}
+	}
+	return nil
+}
+
+// observe adds the count since the last total to the series, returning an
+// alert if an anomaly started or was resolved.
+func (d *AnomalyDetector) observe(key seriesKey, total uint64, caughtUp bool, now time.Time) *Alert {
+	s, ok := d.series[key]
+	if !ok {
+		s = &series{}
+		d.series[key] = s
+	}
+	if !caughtUp {
+		s.hasTotal = false
+		return nil
+	}
+	if !s.hasTotal || total < s.lastTotal {
+		// the first sample, or data was rolled back, so there is no count yet
+		s.lastTotal = total
+		s.hasTotal = true
+		return nil
+	}
+	value := total - s.lastTotal
+	s.lastTotal = total
+
+	kind := ""
+	var average, stdDev float64
+	if len(s.samples) >= d.minSamples {
+		average, stdDev = meanAndStdDev(s.samples)
+		// quiet contracts have no deviation, so any activity would be a spike
+		deviation := math.Max(stdDev, 1)
+		if float64(value) > average+d.threshold*deviation {
+			kind = types.SpikeAnomaly
+		} else if float64(value) < average-d.threshold*deviation {
+			kind = types.SilenceAnomaly
+		}
+	}
+
+	if kind != types.SilenceAnomaly {
+		s.samples = append(s.samples, value)
+		if len(s.samples) > d.window {
+			s.samples = s.samples[len(s.samples)-d.window:]
+		}
+	}
+
+	if kind == "" {
+		if s.anomaly == nil {
+			return nil
+		}
+		resolved := *s.anomaly
+		s.anomaly = nil
+		return &Alert{Anomaly: resolved, Resolved: true}
+	}
+	if s.anomaly != nil && s.anomaly.Kind == kind {
+		s.anomaly.Value = value
+		return nil
+	}
+	s.anomaly = &types.Anomaly{
+		Address: key.address,
+		Metric:  key.metric,
+		Kind:    kind,
+		Value:   value,
+		Average: average,
+		StdDev:  stdDev,
+		Since:   now.Unix(),
+	}
+	return &Alert{Anomaly: *s.anomaly}
+}
+
+func meanAndStdDev(samples []uint64) (float64, float64) {
+	var sum float64
+	for _, sample := range samples {
+		sum += float64(sample)
+	}
+	mean := sum / float64(len(samples))
+
+	var squares float64
+	for _, sample := range samples {
+		squares += (float64(sample) - mean) * (float64(sample) - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(samples)))
+}
@@ -0,0 +1,125 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+var (
+	testAddress = types.NewAddress("0x0000000000000000000000000000000000000001")
+	testConfig  = &types.AnomalyDetectionConfig{Interval: 60, Window: 5, MinSamples: 3, Threshold: 3}
+)
+
+type fakeSink struct {
+	alerts []*Alert
+}
+
+func (s *fakeSink) Name() string {
+	return "fake"
+}
+
+func (s *fakeSink) Send(alert *Alert) error {
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
+
+func TestAnomalyDetector_Observe(t *testing.T) {
+	detector := NewAnomalyDetector(memory.NewMemoryDB(), testConfig)
+	key := seriesKey{testAddress, types.EventsMetric}
+	now := time.Unix(1000, 0)
+
+	// the first total has nothing to compare against, then 10 per interval
+	// until there are enough samples
+	var total uint64
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, detector.observe(key, total, true, now))
+		total += 10
+	}
+
+	total += 40
+	alert := detector.observe(key, total, true, now)
+	assert.Equal(t, &Alert{Anomaly: types.Anomaly{
+		Address: testAddress,
+		Metric:  types.EventsMetric,
+		Kind:    types.SpikeAnomaly,
+		Value:   50,
+		Average: 10,
+		StdDev:  0,
+		Since:   1000,
+	}}, alert)
+	assert.Len(t, detector.Anomalies(), 1)
+
+	total += 10
+	alert = detector.observe(key, total, true, now)
+	assert.True(t, alert.Resolved)
+	assert.Len(t, detector.Anomalies(), 0)
+
+	// the spike is part of the average until it leaves the window
+	for i := 0; i < 4; i++ {
+		total += 10
+		assert.Nil(t, detector.observe(key, total, true, now))
+	}
+
+	// silence stays flagged until activity returns
+	alert = detector.observe(key, total, true, now)
+	assert.Equal(t, types.SilenceAnomaly, alert.Anomaly.Kind)
+	assert.False(t, alert.Resolved)
+	assert.Nil(t, detector.observe(key, total, true, now))
+	assert.Nil(t, detector.observe(key, total, true, now))
+	assert.Len(t, detector.Anomalies(), 1)
+
+	total += 10
+	alert = detector.observe(key, total, true, now)
+	assert.Equal(t, types.SilenceAnomaly, alert.Anomaly.Kind)
+	assert.True(t, alert.Resolved)
+
+	// no samples are taken while the address is catching up
+	assert.Nil(t, detector.observe(key, total+1000, false, now))
+	assert.Nil(t, detector.observe(key, total+1010, true, now))
+	assert.Len(t, detector.Anomalies(), 0)
+}
+
+func TestAnomalyDetector_Sample(t *testing.T) {
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{testAddress}))
+	detector := NewAnomalyDetector(db, testConfig)
+	sink := &fakeSink{}
+	detector.sinks = []AlertSink{sink}
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, detector.Sample(time.Now()))
+	}
+	assert.Len(t, detector.series, 2)
+	assert.Len(t, sink.alerts, 0)
+
+	// series for deleted addresses are dropped
+	assert.Nil(t, db.DeleteAddress(testAddress, true))
+	assert.Nil(t, detector.Sample(time.Now()))
+	assert.Len(t, detector.series, 0)
+}
+
+func TestWebhookSink_Send(t *testing.T) {
+	var received Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	alert := &Alert{Anomaly: types.Anomaly{Address: testAddress, Metric: types.TransactionsMetric, Kind: types.SpikeAnomaly, Value: 5}}
+	assert.Nil(t, NewWebhookSink(server.URL).Send(alert))
+	assert.Equal(t, *alert, received)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	assert.EqualError(t, NewWebhookSink(failing.URL).Send(alert), "webhook responded with status 500")
+}
@@ -0,0 +1,74 @@
+package anomaly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// Alert is sent when an anomaly starts, and again when it is resolved.
+type Alert struct {
+	Anomaly  types.Anomaly `json:"anomaly"`
+	Resolved bool          `json:"resolved"`
+}
+
+// AlertSink delivers alerts somewhere they will be seen.
+type AlertSink interface {
+	Name() string
+	Send(alert *Alert) error
+}
+
+// LogSink writes alerts to the application log.
+type LogSink struct{}
+
+func (s *LogSink) Name() string {
+	return "log"
+}
+
+func (s *LogSink) Send(alert *Alert) error {
+	anomaly := alert.Anomaly
+	if alert.Resolved {
+		log.Info("Contract activity back to normal", "address", anomaly.Address.Hex(), "metric", anomaly.Metric, "kind", anomaly.Kind)
+		return nil
+	}
+	log.Warn("Unusual contract activity", "address", anomaly.Address.Hex(), "metric", anomaly.Metric, "kind", anomaly.Kind,
+		"value", anomaly.Value, "average", anomaly.Average, "stdDev", anomaly.StdDev)
+	return nil
+}
+
+// WebhookSink POSTs alerts as JSON to a URL.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+func (s *WebhookSink) Name() string {
+	return s.url
+}
+
+func (s *WebhookSink) Send(alert *Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package archiver
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/database/archive"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// errBlocksRead stops reading the stored documents of a batch once its blocks
+// and transactions have been read, as events are not archived
+var errBlocksRead = errors.New("blocks and transactions read")
+
+type ArchiverDB interface {
+	database.ArchiveDB
+	database.IntegrityDB
+	ReadBlock(uint64) (*types.Block, error)
+	GetLastPersistedBlockNumber() (uint64, error)
+	GetAddresses() ([]types.Address, error)
+	GetLastFiltered(types.Address) (uint64, error)
+}
+
+// Archiver periodically moves the oldest blocks and their transactions out of
+// the database into the object store, a batch of blocks at a time, in order.
+// A batch is archived once its newest block is older than the maximum age,
+// and every registered contract has been indexed past it. Events stay in the
+// database.
+//
+// Each batch is uploaded before it is recorded in the database and deleted
+// from it, so blocks are always either in the database or archived. If
+// archiving fails, it is tried again at the next check.
+type Archiver struct {
+	db        ArchiverDB
+	store     archive.ObjectStore
+	prefix    string
+	maxAge    time.Duration
+	batchSize uint64
+	interval  time.Duration
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewArchiver(db ArchiverDB, store archive.ObjectStore, config *types.ArchiveConfig) *Archiver {
+	return &Archiver{
+		db:           db,
+		store:        store,
+		prefix:       config.Prefix,
+		maxAge:       time.Duration(config.MaxAgeDays) * 24 * time.Hour,
+		batchSize:    uint64(config.BatchSize),
+		interval:     time.Duration(config.Interval) * time.Second,
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (a *Archiver) Start() error {
+	log.Info("Starting archiver", "max age", a.maxAge, "batch size", a.batchSize)
+
+	a.shutdownWg.Add(1)
+	go func() {
+		defer a.shutdownWg.Done()
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			a.archive(time.Now())
+			select {
+			case <-ticker.C:
+			case <-a.shutdownChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (a *Archiver) Stop() {
+	close(a.shutdownChan)
+	a.shutdownWg.Wait()
+	log.Info("Archiver stopped")
+}
+
+// archive archives the batches that are old enough at the given time, until
+// shut down
+func (a *Archiver) archive(now time.Time) {
+	for {
+		select {
+		case <-a.shutdownChan:
+			return
+		default:
+		}
+		archived, err := a.archiveNext(now)
+		if err != nil {
+			log.Warn("Archiving blocks failed", "err", err)
+			return
+		}
+		if !archived {
+			return
+		}
+	}
+}
+
+// archiveNext archives the batch after the last archived one, if it is old
+// enough, reporting whether it was archived
+func (a *Archiver) archiveNext(now time.Time) (bool, error) {
+	// the genesis block is never stored
+	start := uint64(1)
+	last, err := a.db.GetLastArchivedBatch()
+	switch {
+	case err == nil:
+		start = last.EndBlock + 1
+	case err != database.ErrNotFound:
+		return false, err
+	}
+	end := start + a.batchSize - 1
+
+	indexed, err := a.lastIndexed()
+	if err != nil {
+		return false, err
+	}
+	if end > indexed {
+		return false, nil
+	}
+	newest, err := a.db.ReadBlock(end)
+	if err != nil {
+		return false, err
+	}
+	if time.Unix(int64(newest.Timestamp), 0).After(now.Add(-a.maxAge)) {
+		return false, nil
+	}
+
+	content := &types.ArchivedBlocks{}
+	err = a.db.ExportStoredDocuments(start, end, func(document *types.StoredDocument) error {
+		switch document.Kind {
+		case types.BlockDocument:
+			content.Blocks = append(content.Blocks, document.Content.(*types.Block))
+		case types.TransactionDocument:
+			content.Transactions = append(content.Transactions, document.Content.(*types.Transaction))
+		default:
+			return errBlocksRead
+		}
+		return nil
+	})
+	if err != nil && err != errBlocksRead {
+		return false, err
+	}
+	if uint64(len(content.Blocks)) != a.batchSize {
+		return false, fmt.Errorf("only %d of blocks %d to %d are stored", len(content.Blocks), start, end)
+	}
+
+	encoded, err := archive.EncodeBatch(content)
+	if err != nil {
+		return false, err
+	}
+	key := archive.BatchKey(a.prefix, start, end)
+	if err := a.store.Put(key, encoded); err != nil {
+		return false, fmt.Errorf("uploading batch %s: %v", key, err)
+	}
+
+	var transactions []types.Hash
+	for _, block := range content.Blocks {
+		transactions = append(transactions, block.Transactions...)
+	}
+	batch := &types.ArchivedBatch{
+		Key:          key,
+		StartBlock:   start,
+		EndBlock:     end,
+		Transactions: transactions,
+		ArchivedAt:   uint64(now.Unix()),
+	}
+	if err := a.db.ArchiveBlocks(batch); err != nil {
+		return false, err
+	}
+	log.Info("Archived batch", "key", key, "start", start, "end", end, "transactions", len(transactions), "bytes", len(encoded))
+	return true, nil
+}
+
+// lastIndexed returns the last block that has been persisted, and that every
+// registered contract has been indexed up to
+func (a *Archiver) lastIndexed() (uint64, error) {
+	indexed, err := a.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		return 0, err
+	}
+	addresses, err := a.db.GetAddresses()
+	if err != nil {
+		return 0, err
+	}
+	for _, address := range addresses {
+		lastFiltered, err := a.db.GetLastFiltered(address)
+		if err != nil {
+			return 0, err
+		}
+		if lastFiltered < indexed {
+			indexed = lastFiltered
+		}
+	}
+	return indexed, nil
+}
@@ -0,0 +1,109 @@
+package archiver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/database/archive"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+type fakeStore struct {
+	objects map[string][]byte
+	err     error
+}
+
+func (s *fakeStore) Put(key string, content []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.objects[key] = content
+	return nil
+}
+
+func (s *fakeStore) Get(key string) ([]byte, error) {
+	return s.objects[key], nil
+}
+
+var now = time.Unix(10*24*3600, 0)
+
+// writeBlocks writes blocks 1 to 10, a day apart, each with a transaction
+func writeBlocks(t *testing.T, db *memory.MemoryDB) {
+	for number := uint64(1); number <= 10; number++ {
+		tx := &types.Transaction{Hash: types.NewHash("0x" + string(rune('a'+number-1))), BlockNumber: number}
+		assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx}))
+		assert.Nil(t, db.WriteBlocks([]*types.Block{{Number: number, Timestamp: number * 24 * 3600, Transactions: []types.Hash{tx.Hash}}}))
+	}
+}
+
+func TestArchiver_Archive(t *testing.T) {
+	db := memory.NewMemoryDB()
+	writeBlocks(t, db)
+	store := &fakeStore{objects: make(map[string][]byte)}
+	archiver := NewArchiver(db, store, &types.ArchiveConfig{Prefix: "reporting/", MaxAgeDays: 5, BatchSize: 2})
+
+	// blocks 1 to 4 are more than 5 days old
+	archiver.archive(now)
+
+	assert.Len(t, store.objects, 2)
+	content, err := archive.DecodeBatch(store.objects["reporting/blocks-3-4.json.gz"])
+	assert.Nil(t, err)
+	assert.Len(t, content.Blocks, 2)
+	assert.EqualValues(t, 3, content.Blocks[0].Number)
+	assert.Len(t, content.Transactions, 2)
+
+	batch, err := db.GetLastArchivedBatch()
+	assert.Nil(t, err)
+	assert.Equal(t, &types.ArchivedBatch{
+		Key:          "reporting/blocks-3-4.json.gz",
+		StartBlock:   3,
+		EndBlock:     4,
+		Transactions: []types.Hash{types.NewHash("0xc"), types.NewHash("0xd")},
+		ArchivedAt:   uint64(now.Unix()),
+	}, batch)
+	_, err = db.ReadBlock(4)
+	assert.NotNil(t, err)
+	_, err = db.ReadBlock(5)
+	assert.Nil(t, err)
+
+	// the next batch is archived once it is old enough
+	archiver.archive(now.Add(24 * time.Hour))
+	assert.Len(t, store.objects, 3)
+	assert.Contains(t, store.objects, "reporting/blocks-5-6.json.gz")
+}
+
+func TestArchiver_Archive_NotIndexed(t *testing.T) {
+	db := memory.NewMemoryDB()
+	writeBlocks(t, db)
+	address := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	assert.Nil(t, db.AddAddresses([]types.Address{address}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{address}, []*types.Block{{Number: 1}, {Number: 2}, {Number: 3}}))
+	store := &fakeStore{objects: make(map[string][]byte)}
+	archiver := NewArchiver(db, store, &types.ArchiveConfig{MaxAgeDays: 5, BatchSize: 2})
+
+	// blocks are only archived once the contract has been indexed past them
+	archiver.archive(now)
+
+	assert.Len(t, store.objects, 1)
+	assert.Contains(t, store.objects, "blocks-1-2.json.gz")
+}
+
+func TestArchiver_Archive_UploadFails(t *testing.T) {
+	db := memory.NewMemoryDB()
+	writeBlocks(t, db)
+	store := &fakeStore{objects: make(map[string][]byte), err: errors.New("access denied")}
+	archiver := NewArchiver(db, store, &types.ArchiveConfig{MaxAgeDays: 5, BatchSize: 2})
+
+	archiver.archive(now)
+
+	// nothing is deleted from the database
+	_, err := db.GetLastArchivedBatch()
+	assert.Equal(t, database.ErrNotFound, err)
+	_, err = db.ReadBlock(1)
+	assert.Nil(t, err)
+}
@@ -1,16 +1,40 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"sync"
 	"time"
 
 	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/core/abifetch"
+	"quorumengineering/quorum-report/core/anomaly"
+	"quorumengineering/quorum-report/core/archiver"
+	"quorumengineering/quorum-report/core/backfill"
+	"quorumengineering/quorum-report/core/codematch"
+	"quorumengineering/quorum-report/core/configsync"
+	"quorumengineering/quorum-report/core/election"
+	"quorumengineering/quorum-report/core/export"
 	"quorumengineering/quorum-report/core/filter"
+	"quorumengineering/quorum-report/core/inference"
+	"quorumengineering/quorum-report/core/integrity"
+	"quorumengineering/quorum-report/core/maintenance"
 	"quorumengineering/quorum-report/core/monitor"
+	"quorumengineering/quorum-report/core/naming"
+	"quorumengineering/quorum-report/core/pending"
+	"quorumengineering/quorum-report/core/publisher"
+	"quorumengineering/quorum-report/core/retention"
 	"quorumengineering/quorum-report/core/rpc"
+	"quorumengineering/quorum-report/core/screening"
+	"quorumengineering/quorum-report/core/sharding"
+	"quorumengineering/quorum-report/core/webhook"
 	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/database/archive"
 	"quorumengineering/quorum-report/database/factory"
 	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/tracing"
 	"quorumengineering/quorum-report/types"
 )
 
@@ -18,15 +42,43 @@ import (
 type Backend struct {
 	monitor      *monitor.MonitorService
 	filter       *filter.FilterService
+	configSync   *configsync.ConfigSyncService
+	anomalies    *anomaly.AnomalyDetector
+	publisher    *publisher.Publisher
+	abiFetcher   *abifetch.Fetcher
+	notifier     *webhook.Notifier
+	backfills    *backfill.Service
+	exports      *export.Service
+	integrity    *integrity.Service
+	inference    *inference.Service
+	matcher      *codematch.Service
+	maintenance  *maintenance.Scheduler
+	archiver     *archiver.Archiver
+	retention    *retention.Janitor
+	names        *naming.Directory
+	pending      *pending.Monitor
+	screening    *screening.Service
+	tracer       *tracing.Exporter
+	elector      *election.Elector
+	sharder      *sharding.Sharder
 	rpc          *rpc.RPCService
 	db           database.Database
 	quorumClient client.Client
 
+	// the configuration last applied, and reloads happen one at a time
+	config    types.ReportingConfig
+	reloadMux sync.Mutex
+	// whether the services writing to the database have been started, which
+	// happens once elected leader in high availability mode; a reload whilst
+	// standing by is applied then
+	writing       bool
+	reloadPending bool
+
 	backendErrorChan chan error
 }
 
 func New(config types.ReportingConfig) (*Backend, error) {
-	quorumClient, err := client.NewQuorumClient(config.Connection.WSUrl, config.Connection.GraphQLUrl)
+	quorumClient, err := newClient(config)
 	if err != nil {
 		log.Error("Failed to initialize Quorum Client", "err", err)
 		// auto reconnect
@@ -36,7 +88,7 @@ func New(config types.ReportingConfig) (*Backend, error) {
 		for i := 0; i < config.Connection.MaxReconnectTries && err != nil; i++ {
 			log.Error("Trying to reconnect", "wait-time", config.Connection.ReconnectInterval)
 			time.Sleep(time.Duration(config.Connection.ReconnectInterval) * time.Second)
-			quorumClient, err = client.NewQuorumClient(config.Connection.WSUrl, config.Connection.GraphQLUrl)
+			quorumClient, err = newClient(config)
 		}
 		// max retries reached but still erroring, abort
 		if err != nil {
@@ -56,11 +108,216 @@ func New(config types.ReportingConfig) (*Backend, error) {
 		return nil, err
 	}
 
+	var archiveService *archiver.Archiver
+	if config.Archive != nil {
+		// archived blocks and transactions are read back by everything using
+		// the database
+		store := archive.NewS3Store(config.Archive)
+		archiveDB := archive.NewDatabase(db, store, config.Archive.CacheSize)
+		archiveService = archiver.NewArchiver(archiveDB, store, config.Archive)
+		db = archiveDB
+	}
+
+	if config.HighAvailability == nil {
+		if err := registerConfigured(db, config); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info("Ingestion profile", "profile", config.Profile)
+	monitorService, err := monitor.NewMonitorService(db, quorumClient, consensus, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var configSync *configsync.ConfigSyncService
+	if config.ConfigSync != nil {
+		configSync = configsync.NewConfigSyncService(db, monitorService, config)
+	}
+
+	var (
+		anomalies       *anomaly.AnomalyDetector
+		anomalyReporter rpc.AnomalyReporter
+	)
+	if config.AnomalyDetection != nil {
+		anomalies = anomaly.NewAnomalyDetector(db, config.AnomalyDetection)
+		anomalyReporter = anomalies
+	}
+
+	var kafkaPublisher *publisher.Publisher
+	if config.Kafka != nil {
+		kafkaPublisher = publisher.NewPublisher(db, config.Kafka)
+	}
+
+	var abiFetcher *abifetch.Fetcher
+	if config.ABIFetch != nil {
+		if config.Profile == types.HeadersProfile {
+			log.Warn("ABIs are not fetched with the headers profile, which doesn't index contracts")
+		} else {
+			abiFetcher, err = abifetch.NewFetcher(db, rpc.NewDefaultContractManager(db), quorumClient, config.ABIFetch)
+			if err != nil {
+				return nil, err
+			}
+			monitorService.SetABILookup(abiFetcher)
+		}
+	}
+
+	var maintenanceScheduler *maintenance.Scheduler
+	if config.Maintenance != nil {
+		maintenanceScheduler = maintenance.NewScheduler(db, config.Maintenance)
+	}
+
+	var (
+		janitor           *retention.Janitor
+		retentionReporter rpc.RetentionReporter
+	)
+	if config.Retention != nil {
+		janitor = retention.NewJanitor(db, config.Retention)
+		retentionReporter = janitor
+	}
+
+	var (
+		names         *naming.Directory
+		nameDirectory rpc.NameDirectory
+	)
+	if config.Naming != nil {
+		if config.Profile == types.HeadersProfile {
+			log.Warn("Names are not read with the headers profile, which doesn't index contracts")
+		} else {
+			names = naming.NewDirectory(db, config.Naming)
+			nameDirectory = names
+			types.SetNameResolver(names.Resolve)
+		}
+	}
+
+	var (
+		pendingMonitor *pending.Monitor
+		pendingReader  rpc.PendingMonitor
+	)
+	if config.Pending != nil {
+		if config.Profile == types.HeadersProfile {
+			log.Warn("Pending transactions are not monitored with the headers profile, which doesn't index contracts")
+		} else {
+			pendingMonitor = pending.NewMonitor(db, quorumClient, config.Pending)
+			pendingReader = pendingMonitor
+		}
+	}
+
+	var tracer *tracing.Exporter
+	if config.Tracing != nil {
+		tracer = tracing.NewExporter(config.Tracing)
+	}
+
+	var (
+		exports  *export.Service
+		exporter rpc.Exporter
+	)
+	if config.Export != nil {
+		exports = export.NewService(db, config.Export.Directory)
+		exporter = exports
+	}
+
+	var (
+		screeningService *screening.Service
+		screener         rpc.AddressScreener
+	)
+	if config.Screening != nil {
+		screeningService = screening.NewService(db, config.Screening)
+		screener = screeningService
+	}
+
+	notifier := webhook.NewNotifier(db)
+	var eventNotifier filter.EventNotifier = notifier
+	if screeningService != nil {
+		// the counterparties of indexed blocks are screened too
+		eventNotifier = filter.EventNotifiers{notifier, screeningService}
+	}
+	filterService := filter.NewFilterService(db, quorumClient, eventNotifier)
+	backfills := backfill.NewService(db, monitorService, filterService)
+	verifier := integrity.NewService(db)
+	inferrer := inference.NewService(db)
+
+	ingestion := newIngestionPause(monitorService, filterService)
+	ingestion.contracts = filterService
+	matcher := codematch.NewService(db, quorumClient, ingestion)
+	health := newHealthChecker(quorumClient, db, filterService, ingestion, config.Server.Health)
+
+	backendErrorChan := make(chan error)
+	backend := &Backend{
+		monitor:          monitorService,
+		configSync:       configSync,
+		anomalies:        anomalies,
+		publisher:        kafkaPublisher,
+		abiFetcher:       abiFetcher,
+		notifier:         notifier,
+		filter:           filterService,
+		backfills:        backfills,
+		exports:          exports,
+		integrity:        verifier,
+		inference:        inferrer,
+		matcher:          matcher,
+		maintenance:      maintenanceScheduler,
+		archiver:         archiveService,
+		retention:        janitor,
+		names:            names,
+		pending:          pendingMonitor,
+		screening:        screeningService,
+		tracer:           tracer,
+		db:               db,
+		quorumClient:     quorumClient,
+		config:           config,
+		backendErrorChan: backendErrorChan,
+	}
+
+	var leadership rpc.Leadership
+	if config.HighAvailability != nil {
+		// only the leader writes to the database, and registers the addresses
+		// and templates of the configuration once elected
+		backend.elector, err = election.NewElector(db, config.HighAvailability, backend.startWriting, backend.deposed)
+		if err != nil {
+			return nil, err
+		}
+		leadership = backend.elector
+		health.leader = backend.elector
+		if config.HighAvailability.Sharding != nil {
+			// every instance filters its shard of the contracts, and the
+			// leader does the rest of the writing
+			backend.sharder = sharding.NewSharder(db, backend.elector.Status().InstanceID, config.HighAvailability, filterService.Drain)
+			filterService.SetShard(backend.sharder)
+			ingestion.sharded = true
+			leadership = &shardedLeadership{Elector: backend.elector, sharder: backend.sharder}
+			health.sharded = true
+		}
+	}
+	backend.rpc = rpc.NewRPCService(db, config, rpc.Dependencies{
+		Anomalies:  anomalyReporter,
+		Backfills:  backfills,
+		Exports:    exporter,
+		Integrity:  verifier,
+		Inference:  inferrer,
+		Matcher:    matcher,
+		Health:     health,
+		Ingestion:  ingestion,
+		Names:      nameDirectory,
+		Pending:    pendingReader,
+		Retention:  retentionReporter,
+		Rules:      monitorService,
+		Leadership: leadership,
+		Screening:  screener,
+		Webhooks:   notifier,
+	}, backendErrorChan)
+	return backend, nil
+}
+
+// registerConfigured stores the templates and addresses of the configuration
+// file, and assigns the addresses their templates. Addresses that are already
+// registered keep the block they are filtered up to.
+func registerConfigured(db database.Database, config types.ReportingConfig) error {
 	// store all templates
 	log.Info("Adding templates from configuration file to database")
 	for _, template := range config.Templates {
 		if err := db.AddTemplate(template.TemplateName, template.ABI, template.StorageLayout); err != nil {
-			return nil, err
+			return err
 		}
 	}
 	// store all addresses
@@ -70,7 +327,7 @@ func New(config types.ReportingConfig) (*Backend, error) {
 		if address.From > 0 {
 			// register address from a given block number
 			if err := db.AddAddressFrom(address.Address, address.From); err != nil {
-				return nil, err
+				return err
 			}
 		} else {
 			initialAddresses = append(initialAddresses, address.Address)
@@ -78,33 +335,126 @@ func New(config types.ReportingConfig) (*Backend, error) {
 	}
 	// bulk update initial addresses without from
 	if err := db.AddAddresses(initialAddresses); err != nil {
-		return nil, err
+		return err
 	}
 	log.Info("Assigning address templates from configuration file to database")
 	// assign all addresses
 	for _, address := range config.Addresses {
 		if address.TemplateName != "" {
 			if err := db.AssignTemplate(address.Address, address.TemplateName); err != nil {
-				return nil, err
+				return err
 			}
 			log.Info("Assign template to initial registered contract", "template", address.TemplateName, "address", address.Address.Hex())
 		}
+		if address.TerminalBlock > 0 {
+			if err := db.SetTerminalBlock(address.Address, address.TerminalBlock); err != nil {
+				return err
+			}
+			log.Info("Freeze initial registered contract", "terminal-block", address.TerminalBlock, "address", address.Address.Hex())
+		}
 	}
+	return nil
+}
 
-	monitorService, err := monitor.NewMonitorService(db, quorumClient, consensus, config)
+// Reload applies the addresses, templates, rules and RPC origins of the
+// configuration file after it is read again, without interrupting syncing.
+// Other settings only take effect once restarted. As on a restart, addresses
+// removed from the file stay registered, unless config sync is enabled, in
+// which case they are deleted like those removed from the definition files.
+func (b *Backend) Reload(config types.ReportingConfig) error {
+	b.reloadMux.Lock()
+	defer b.reloadMux.Unlock()
+
+	if config.Profile != b.config.Profile {
+		return errors.New("the ingestion profile can't be changed without a restart")
+	}
+	if !reloadable(b.config, config) {
+		log.Warn("Configuration changes other than addresses, templates, rules and RPC origins need a restart")
+	}
+
+	if b.elector != nil && !b.writing {
+		b.rpc.UpdateOrigins(config.Server.RPCCorsList, config.Server.RPCVHosts)
+		b.config = config
+		b.reloadPending = true
+		log.Info("Configuration reloaded, addresses, templates and rules are applied once elected leader")
+		return nil
+	}
+	if err := b.apply(config); err != nil {
+		return err
+	}
+	b.rpc.UpdateOrigins(config.Server.RPCCorsList, config.Server.RPCVHosts)
+
+	b.config = config
+	log.Info("Configuration reloaded")
+	return nil
+}
+
+// apply registers the addresses, templates and rules of the configuration
+func (b *Backend) apply(config types.ReportingConfig) error {
+	if b.configSync != nil {
+		err := b.configSync.SetBase(configsync.Definitions{
+			Addresses: config.Addresses,
+			Templates: config.Templates,
+			Rules:     config.Rules,
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		if err := registerConfigured(b.db, config); err != nil {
+			return err
+		}
+		if err := b.monitor.UpdateRules(config.Rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reloadable checks whether the configurations only differ in the settings
+// that can be reloaded
+func reloadable(current, updated types.ReportingConfig) bool {
+	for _, config := range []*types.ReportingConfig{&current, &updated} {
+		config.Addresses, config.Templates, config.Rules = nil, nil, nil
+		config.Server.RPCCorsList, config.Server.RPCVHosts = nil, nil
+	}
+	return reflect.DeepEqual(current, updated)
+}
+
+// newClient connects to the node, or nodes if several are configured, using the client for the configured node type
+func newClient(config types.ReportingConfig) (client.Client, error) {
+	if len(config.Connection.Nodes) > 0 {
+		multiClient, err := client.NewMultiClient(
+			config.Connection.Nodes,
+			config.Connection.LoadBalancing == types.RoundRobinLoadBalancing,
+			time.Duration(config.Connection.HealthCheckInterval)*time.Second,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if config.Connection.NodeType == types.BesuNodeType {
+			return &client.BesuClient{Client: multiClient}, nil
+		}
+		return multiClient, nil
+	}
+	if config.Connection.NodeType == types.BesuNodeType {
+		besuClient, err := client.NewBesuClient(config.Connection.WSUrl, config.Connection.GraphQLUrl)
+		if err != nil {
+			return nil, err
+		}
+		return besuClient, nil
+	}
+	quorumClient, err := client.NewQuorumClient(config.Connection.WSUrl, config.Connection.GraphQLUrl)
 	if err != nil {
 		return nil, err
 	}
+	return quorumClient, nil
+}
 
-	backendErrorChan := make(chan error)
-	return &Backend{
-		monitor:          monitorService,
-		filter:           filter.NewFilterService(db, quorumClient),
-		rpc:              rpc.NewRPCService(db, config, backendErrorChan),
-		db:               db,
-		quorumClient:     quorumClient,
-		backendErrorChan: backendErrorChan,
-	}, nil
+// Backfill starts re-processing the blocks in the range in the background,
+// returning the ID of its job.
+func (b *Backend) Backfill(from, to uint64) (string, error) {
+	return b.backfills.Backfill(from, to)
 }
 
 func (b *Backend) GetBackendErrorChannel() chan error {
@@ -112,11 +462,44 @@ func (b *Backend) GetBackendErrorChannel() chan error {
 }
 
 func (b *Backend) Start() error {
-	for _, f := range []func() error{
-		b.monitor.Start, // monitor service
-		b.filter.Start,  // filter service
-		b.rpc.Start,     // RPC service
-	} {
+	var services []func() error
+	if b.tracer != nil {
+		// spans are only recorded once the exporter is running
+		services = append(services, b.tracer.Start)
+	}
+	// services that only read the database run on every instance
+	if b.anomalies != nil {
+		services = append(services, b.anomalies.Start)
+	}
+	if b.names != nil {
+		services = append(services, b.names.Start)
+	}
+	if b.pending != nil {
+		services = append(services, b.pending.Start)
+	}
+	if b.screening != nil {
+		// before the filter, which screens counterparties with it
+		services = append(services, b.screening.Start)
+	}
+	if b.exports != nil {
+		services = append(services, b.exports.Start)
+	}
+	services = append(services,
+		b.integrity.Start, // integrity service, which verifies the checksums of stored documents
+		b.inference.Start, // inference service, which proposes storage layouts
+	)
+	if b.sharder != nil {
+		// filtering starts once the shards are claimed, on every instance
+		services = append(services, b.notifier.Start, b.sharder.Start, b.filter.Start)
+	}
+	if b.elector != nil {
+		// the rest start once elected leader, whilst reads are served from
+		// the start
+		services = append(services, b.rpc.Start, b.elector.Start)
+	} else {
+		services = append(services, b.startWriting, b.rpc.Start)
+	}
+	for _, f := range services {
 		if err := f(); err != nil {
 			return fmt.Errorf("start up failed: %v", err)
 		}
@@ -124,13 +507,223 @@ func (b *Backend) Start() error {
 	return nil
 }
 
-func (b *Backend) Stop() {
+// startWriting starts the services that write to the database, or act on what
+// is written, such as sending webhooks. In high availability mode, they only
+// run on the leader, and the configuration is registered once elected. When
+// filtering is sharded, the filter and notifier run on every instance
+// instead.
+func (b *Backend) startWriting() error {
+	b.reloadMux.Lock()
+	defer b.reloadMux.Unlock()
+	if b.elector != nil {
+		if err := registerConfigured(b.db, b.config); err != nil {
+			return err
+		}
+	}
+
+	// the filter and monitor are given the shutdown timeout to finish what is
+	// in flight, should a later service fail to start
+	stopCtx := func(stop func(context.Context)) func() {
+		return func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(b.config.Tuning.ShutdownTimeout)*time.Second)
+			defer cancel()
+			stop(ctx)
+		}
+	}
+	var services []writingService
+	if b.sharder == nil {
+		services = append(services,
+			writingService{b.notifier.Start, b.notifier.Stop},      // webhook notifier, which the filter service sends events to
+			writingService{b.filter.Start, stopCtx(b.filter.Stop)}, // filter service
+		)
+	}
+	if b.configSync != nil {
+		// synced rules need to be in place before any blocks are processed, and
+		// deleting addresses needs the filter service running
+		services = append(services, writingService{b.configSync.Start, b.configSync.Stop})
+	}
+	if b.maintenance != nil {
+		services = append(services, writingService{b.maintenance.Start, b.maintenance.Stop})
+	}
+	if b.archiver != nil {
+		services = append(services, writingService{b.archiver.Start, b.archiver.Stop})
+	}
+	if b.retention != nil {
+		services = append(services, writingService{b.retention.Start, b.retention.Stop})
+	}
+	if b.abiFetcher != nil {
+		// started before the monitor, which queues newly created contracts
+		services = append(services, writingService{b.abiFetcher.Start, b.abiFetcher.Stop})
+	}
+	if b.publisher != nil {
+		// the first time, publishing starts after the last block persisted
+		// before the monitor starts
+		services = append(services, writingService{b.publisher.Start, b.publisher.Stop})
+	}
+	services = append(services,
+		writingService{b.monitor.Start, stopCtx(b.monitor.Stop)}, // monitor service
+		writingService{b.backfills.Start, b.backfills.Stop},      // backfill service, which runs blocks through the monitor and filter
+		writingService{b.matcher.Start, b.matcher.Stop},          // template assignment by code, which refilters the contracts it assigns
+	)
+	if err := startAll(services); err != nil {
+		return err
+	}
+	b.writing = true
+
+	if b.reloadPending {
+		// the configuration was reloaded whilst standing by
+		b.reloadPending = false
+		if err := b.apply(b.config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writingService starts a service writing to the database, and stops it again
+type writingService struct {
+	start func() error
+	stop  func()
+}
+
+// startAll starts the services in order. If one fails to start, those already
+// started are stopped again, in reverse order, so none are left writing.
+func startAll(services []writingService) error {
+	for i, service := range services {
+		if err := service.start(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				services[j].stop()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// deposed shuts the instance down once it stops leading, as the services
+// writing to the database can't be started again. It starts again as a
+// standby once restarted. The writing services are stopped straight away,
+// before the lease is released, rather than once the instance shuts down, so
+// they don't keep writing while another instance leads. Those in flight are
+// given until the lease expires to finish, and none if it has been lost.
+func (b *Backend) deposed(err error, deadline time.Time) {
+	b.reloadMux.Lock()
+	if b.writing {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		b.stopWriting(ctx)
+		cancel()
+		b.writing = false
+	}
+	b.reloadMux.Unlock()
+	go func() {
+		b.backendErrorChan <- fmt.Errorf("no longer the leader: %v", err)
+	}()
+}
+
+// shardedLeadership reports the shards of the contracts the instance filters
+// along with its leadership
+type shardedLeadership struct {
+	*election.Elector
+	sharder *sharding.Sharder
+}
+
+func (l *shardedLeadership) Status() *types.HighAvailabilityStatus {
+	status := l.Elector.Status()
+	status.Sharding = l.sharder.Status()
+	return status
+}
+
+// Stop shuts down all services. Blocks already fetched are persisted and
+// indexed before the database is closed, unless the context is done first.
+// The database's buffered writes are then flushed within a deadline of their
+// own, so they aren't lost to services that used up the context.
+func (b *Backend) Stop(ctx context.Context) {
+	// no more services start writing once election has stopped
+	if b.elector != nil {
+		b.elector.Stop()
+	}
 	// stop services
 	b.rpc.Stop()
-	b.filter.Stop()
-	b.monitor.Stop()
+	if b.anomalies != nil {
+		b.anomalies.Stop()
+	}
+	if b.exports != nil {
+		b.exports.Stop()
+	}
+	if b.names != nil {
+		b.names.Stop()
+	}
+	if b.pending != nil {
+		b.pending.Stop()
+	}
+	if b.writing {
+		b.stopWriting(ctx)
+	}
+	if b.sharder != nil {
+		// every instance filters its shards, whether leading or not
+		b.filter.Stop(ctx)
+		b.notifier.Stop()
+	}
+	// the shards are taken over once the last of their batches is done
+	if b.sharder != nil {
+		b.sharder.Stop()
+	}
+	// after the filter, which screens counterparties with it
+	if b.screening != nil {
+		b.screening.Stop()
+	}
+	b.integrity.Stop()
+	b.inference.Stop()
+	// a standby can take over once the last writes are done
+	if b.elector != nil {
+		b.elector.Release()
+	}
 	// stop db connection
-	b.db.Stop()
+	flushCtx, cancel := context.WithTimeout(context.Background(), time.Duration(b.config.Tuning.ShutdownTimeout)*time.Second)
+	defer cancel()
+	if err := b.db.Stop(flushCtx); err != nil {
+		log.Error("Flushing database writes failed", "err", err)
+	}
 	// stop quorum client
 	b.quorumClient.Stop()
+	// the spans of the last writes are exported
+	if b.tracer != nil {
+		b.tracer.Stop()
+	}
+}
+
+// stopWriting stops the services started by startWriting
+func (b *Backend) stopWriting(ctx context.Context) {
+	if b.publisher != nil {
+		b.publisher.Stop()
+	}
+	if b.maintenance != nil {
+		b.maintenance.Stop()
+	}
+	if b.archiver != nil {
+		b.archiver.Stop()
+	}
+	if b.retention != nil {
+		b.retention.Stop()
+	}
+	if b.abiFetcher != nil {
+		b.abiFetcher.Stop()
+	}
+	if b.configSync != nil {
+		b.configSync.Stop()
+	}
+	// a running assignment by code pauses ingestion to refilter contracts
+	b.matcher.Stop()
+	// the monitor persists the blocks in flight before the filter indexes the
+	// last of them
+	b.monitor.Stop(ctx)
+	if lastPersisted, err := b.db.GetLastPersistedBlockNumber(); err == nil {
+		log.Info("Blocks persisted before shutdown", "last persisted", lastPersisted)
+	}
+	if b.sharder == nil {
+		b.filter.Stop(ctx)
+		b.notifier.Stop()
+	}
+	// a running backfill stops once the filter and monitor have
+	b.backfills.Stop()
 }
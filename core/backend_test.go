@@ -0,0 +1,88 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/core/monitor"
+	"quorumengineering/quorum-report/core/rpc"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestBackend_Reload(t *testing.T) {
+	db := memory.NewMemoryDB()
+	var config types.ReportingConfig
+	config.SetDefaults()
+	monitorService, err := monitor.NewMonitorService(db, client.NewStubQuorumClient(nil, nil), "raft", config)
+	assert.Nil(t, err)
+	backend := &Backend{
+		monitor: monitorService,
+		rpc:     rpc.NewRPCService(db, config, rpc.Dependencies{}, nil),
+		db:      db,
+		config:  config,
+	}
+
+	address := types.NewAddress("0x0000000000000000000000000000000000000001")
+	updated := config
+	updated.Templates = []*types.TemplateConfig{{TemplateName: "Simple", ABI: "[]", StorageLayout: "{}"}}
+	updated.Addresses = []*types.AddressConfig{{Address: address, TemplateName: "Simple", From: 10, TerminalBlock: 20}}
+	updated.Server.RPCCorsList = []string{"http://example.com"}
+	assert.Nil(t, backend.Reload(updated))
+
+	addresses, _ := db.GetAddresses()
+	assert.Equal(t, []types.Address{address}, addresses)
+	template, _ := db.GetContractTemplate(address)
+	assert.Equal(t, "Simple", template)
+	lastFiltered, _ := db.GetLastFiltered(address)
+	assert.EqualValues(t, 9, lastFiltered)
+	terminalBlock, _ := db.GetTerminalBlock(address)
+	assert.EqualValues(t, 20, terminalBlock)
+
+	// the profile decides what has been indexed so far
+	updated.Profile = types.HeadersProfile
+	assert.EqualError(t, backend.Reload(updated), "the ingestion profile can't be changed without a restart")
+}
+
+func TestReloadable(t *testing.T) {
+	var current types.ReportingConfig
+	current.SetDefaults()
+
+	updated := current
+	updated.Rules = []*types.RuleConfig{{Scope: types.AllScope, TemplateName: "Simple"}}
+	updated.Server.RPCVHosts = []string{"localhost"}
+	assert.True(t, reloadable(current, updated))
+	// the configurations are left as they were
+	assert.Len(t, updated.Rules, 1)
+
+	updated.Server.RPCAddr = "localhost:5000"
+	assert.False(t, reloadable(current, updated))
+}
+
+func TestStartAll_StopsStartedOnFailure(t *testing.T) {
+	var events []string
+	service := func(name string, err error) writingService {
+		return writingService{
+			start: func() error {
+				events = append(events, "start "+name)
+				return err
+			},
+			stop: func() { events = append(events, "stop "+name) },
+		}
+	}
+
+	err := startAll([]writingService{
+		service("filter", nil),
+		service("monitor", nil),
+		service("backfills", errors.New("failed")),
+		service("matcher", nil),
+	})
+	assert.EqualError(t, err, "failed")
+	// the services already started are stopped again, the last one first
+	assert.Equal(t, []string{
+		"start filter", "start monitor", "start backfills", "stop monitor", "stop filter",
+	}, events)
+}
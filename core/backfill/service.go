@@ -0,0 +1,188 @@
+package backfill
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// backfill steps, run in order
+const (
+	blocksStep    = "blocks"
+	filteringStep = "filtering"
+)
+
+var ErrBackfillRunning = errors.New("a backfill is already running")
+
+// BlockProcessor processes an explicit range of blocks again, passing the
+// number of the last block done to progress as it goes.
+type BlockProcessor interface {
+	Backfill(from, to uint64, progress func(uint64)) error
+}
+
+type BackfillDB interface {
+	GetLastPersistedBlockNumber() (uint64, error)
+}
+
+// Service runs backfills: it re-fetches a range of blocks through the
+// monitor, and then filters them again for the registered addresses. Both
+// replace the documents already stored for the blocks, so a range can be
+// backfilled any number of times. Blocks after the range are not touched.
+//
+// Backfills are tracked as jobs, one running at a time, and a failed backfill
+// can be retried from the start of its range.
+type Service struct {
+	db      BackfillDB
+	monitor BlockProcessor
+	filter  BlockProcessor
+
+	jobs *database.JobTracker
+	mux  sync.Mutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewService(db BackfillDB, monitor BlockProcessor, filter BlockProcessor) *Service {
+	return &Service{
+		db:           db,
+		monitor:      monitor,
+		filter:       filter,
+		jobs:         database.NewJobTracker(),
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (s *Service) Start() error {
+	log.Info("Starting backfill service")
+	return nil
+}
+
+// Stop waits for a running backfill to reach the end of its current block or
+// chunk, after which it fails and can be retried.
+func (s *Service) Stop() {
+	close(s.shutdownChan)
+	s.shutdownWg.Wait()
+	log.Info("Backfill service stopped")
+}
+
+// Backfill starts processing the blocks from and to (inclusive) again in the
+// background, returning the ID of its job. The range must already have been
+// synced.
+func (s *Service) Backfill(from, to uint64) (string, error) {
+	if from == 0 || from > to {
+		return "", errors.New("backfill range must start after the genesis block, and not end before it starts")
+	}
+	lastPersisted, err := s.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		return "", err
+	}
+	if to > lastPersisted {
+		return "", fmt.Errorf("backfill range ends after the last persisted block %d", lastPersisted)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running() {
+		return "", ErrBackfillRunning
+	}
+	id := s.jobs.Start(types.BackfillJob, "")
+	s.jobs.Update(id, func(job *types.Job) {
+		job.StartBlock = from
+		job.EndBlock = to
+	})
+	s.run(id, from, to)
+	return id, nil
+}
+
+// Run processes the blocks from and to again like Backfill, returning once it
+// is done, for one-off backfills outside of the running service.
+func (s *Service) Run(from, to uint64) error {
+	id, err := s.Backfill(from, to)
+	if err != nil {
+		return err
+	}
+	s.shutdownWg.Wait()
+	job, err := s.jobs.Get(id)
+	if err != nil {
+		return err
+	}
+	if job.Error != "" {
+		return errors.New(job.Error)
+	}
+	return nil
+}
+
+// Retry runs a failed backfill again from the start of its range.
+func (s *Service) Retry(id string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running() {
+		return ErrBackfillRunning
+	}
+	job, err := s.jobs.Restart(id)
+	if err != nil {
+		return err
+	}
+	s.run(id, job.StartBlock, job.EndBlock)
+	return nil
+}
+
+func (s *Service) GetJobs() []*types.Job {
+	return s.jobs.All()
+}
+
+func (s *Service) GetJob(id string) (*types.Job, error) {
+	return s.jobs.Get(id)
+}
+
+// running reports whether a backfill is in progress; the lock must be held
+func (s *Service) running() bool {
+	for _, job := range s.jobs.All() {
+		if job.Status == types.JobRunning {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) run(id string, from, to uint64) {
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		log.Info("Backfill started", "job", id, "start", from, "end", to)
+		err := s.runStep(id, blocksStep, s.monitor, from, to)
+		if err == nil {
+			err = s.runStep(id, filteringStep, s.filter, from, to)
+		}
+		if err != nil {
+			log.Error("Backfill failed", "job", id, "start", from, "end", to, "err", err)
+		} else {
+			log.Info("Backfill completed", "job", id, "start", from, "end", to)
+		}
+		s.jobs.Finish(id, err)
+	}()
+}
+
+func (s *Service) runStep(id string, step string, processor BlockProcessor, from, to uint64) error {
+	select {
+	case <-s.shutdownChan:
+		return errors.New("backfill service is shutting down")
+	default:
+	}
+	s.jobs.Update(id, func(job *types.Job) {
+		job.Step = step
+		job.Processed = 0
+		job.Total = to - from + 1
+	})
+	return processor.Backfill(from, to, func(number uint64) {
+		s.jobs.Update(id, func(job *types.Job) {
+			job.Processed = number - from + 1
+		})
+	})
+}
@@ -0,0 +1,127 @@
+package backfill
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/core/jobtest"
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/types"
+)
+
+type fakeDB struct {
+	lastPersisted uint64
+}
+
+func (f *fakeDB) GetLastPersistedBlockNumber() (uint64, error) {
+	return f.lastPersisted, nil
+}
+
+// fakeProcessor records the blocks it is given, failing the first time if
+// err is set
+type fakeProcessor struct {
+	processed []uint64
+	err       error
+	mux       sync.Mutex
+}
+
+func (f *fakeProcessor) Backfill(from, to uint64, progress func(uint64)) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.err != nil {
+		err := f.err
+		f.err = nil
+		return err
+	}
+	for number := from; number <= to; number++ {
+		f.processed = append(f.processed, number)
+		progress(number)
+	}
+	return nil
+}
+
+func TestBackfill(t *testing.T) {
+	monitor, filter := &fakeProcessor{}, &fakeProcessor{}
+	s := NewService(&fakeDB{lastPersisted: 10}, monitor, filter)
+
+	id, err := s.Backfill(3, 5)
+	assert.Nil(t, err)
+	job := jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.BackfillJob, job.Type)
+	assert.Equal(t, types.JobCompleted, job.Status)
+	assert.EqualValues(t, 3, job.StartBlock)
+	assert.EqualValues(t, 5, job.EndBlock)
+	assert.EqualValues(t, 3, job.Processed)
+	assert.EqualValues(t, 3, job.Total)
+	assert.Equal(t, []uint64{3, 4, 5}, monitor.processed)
+	assert.Equal(t, []uint64{3, 4, 5}, filter.processed)
+	assert.Equal(t, []*types.Job{job}, s.GetJobs())
+
+	s.Stop()
+}
+
+func TestBackfill_InvalidRange(t *testing.T) {
+	s := NewService(&fakeDB{lastPersisted: 10}, &fakeProcessor{}, &fakeProcessor{})
+
+	_, err := s.Backfill(0, 5)
+	assert.EqualError(t, err, "backfill range must start after the genesis block, and not end before it starts")
+	_, err = s.Backfill(6, 5)
+	assert.EqualError(t, err, "backfill range must start after the genesis block, and not end before it starts")
+	_, err = s.Backfill(5, 11)
+	assert.EqualError(t, err, "backfill range ends after the last persisted block 10")
+	assert.Empty(t, s.GetJobs())
+}
+
+func TestBackfill_Retry(t *testing.T) {
+	monitor, filter := &fakeProcessor{}, &fakeProcessor{err: errors.New("filtering failed")}
+	s := NewService(&fakeDB{lastPersisted: 10}, monitor, filter)
+
+	id, err := s.Backfill(1, 2)
+	assert.Nil(t, err)
+	job := jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobFailed, job.Status)
+	assert.Equal(t, filteringStep, job.Step)
+	assert.Equal(t, "filtering failed", job.Error)
+
+	assert.Nil(t, s.Retry(id))
+	job = jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobCompleted, job.Status)
+	// the blocks are processed again from the start
+	assert.Equal(t, []uint64{1, 2, 1, 2}, monitor.processed)
+	assert.Equal(t, []uint64{1, 2}, filter.processed)
+
+	assert.Equal(t, database.ErrJobNotFailed, s.Retry(id))
+	assert.Equal(t, database.ErrNotFound, s.Retry("backfill-100"))
+}
+
+func TestBackfill_AlreadyRunning(t *testing.T) {
+	monitor := &fakeProcessor{}
+	s := NewService(&fakeDB{lastPersisted: 10}, monitor, &fakeProcessor{})
+
+	// hold the monitor so the first backfill keeps running
+	monitor.mux.Lock()
+	id, err := s.Backfill(1, 2)
+	assert.Nil(t, err)
+	_, err = s.Backfill(3, 4)
+	assert.Equal(t, ErrBackfillRunning, err)
+	monitor.mux.Unlock()
+
+	assert.Equal(t, types.JobCompleted, jobtest.WaitForJob(t, s, id).Status)
+	_, err = s.Backfill(3, 4)
+	assert.Nil(t, err)
+}
+
+func TestRun(t *testing.T) {
+	monitor := &fakeProcessor{}
+	s := NewService(&fakeDB{lastPersisted: 10}, monitor, &fakeProcessor{})
+
+	assert.Nil(t, s.Run(2, 4))
+	assert.Equal(t, []uint64{2, 3, 4}, monitor.processed)
+
+	s = NewService(&fakeDB{lastPersisted: 10}, &fakeProcessor{}, &fakeProcessor{err: errors.New("filtering failed")})
+	assert.EqualError(t, s.Run(2, 4), "filtering failed")
+	assert.EqualError(t, s.Run(5, 11), "backfill range ends after the last persisted block 10")
+}
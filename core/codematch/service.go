@@ -0,0 +1,335 @@
+package codematch
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/sha3"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	matchStep    = "match"
+	refilterStep = "refilter"
+)
+
+var ErrAssignmentRunning = errors.New("a template assignment by code is already running")
+
+type MatchDB interface {
+	GetAddresses() ([]types.Address, error)
+	GetTemplates() ([]string, error)
+	GetContractTemplate(types.Address) (string, error)
+	AssignTemplate(types.Address, string) error
+	GetContractCreationTransaction(types.Address) (types.Hash, error)
+	ReadTransaction(types.Hash) (*types.Transaction, error)
+	GetLastPersistedBlockNumber() (uint64, error)
+}
+
+// Refilterer filters the blocks of a contract again from a block, with its
+// current template
+type Refilterer interface {
+	RefilterContract(ctx context.Context, address types.Address, from uint64) error
+}
+
+// Service assigns a template to every registered contract whose runtime
+// bytecode matches, as read from the node at the last persisted block, then
+// filters each contract it assigned again from the block it was created at,
+// so its events, storage and tokens are recorded with the template. Contracts
+// that already have the template are left as they are.
+//
+// Assignments are tracked as jobs, one running at a time. A failed assignment
+// can be retried, matching the contracts again and refiltering those it
+// hasn't yet.
+type Service struct {
+	db         MatchDB
+	client     client.Client
+	refilterer Refilterer
+	jobs       *database.JobTracker
+	requests   map[string]*types.CodeMatchRequest
+	// how many of the matched contracts of each job have been refiltered
+	refiltered map[string]int
+	mux        sync.Mutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewService(db MatchDB, quorumClient client.Client, refilterer Refilterer) *Service {
+	return &Service{
+		db:           db,
+		client:       quorumClient,
+		refilterer:   refilterer,
+		jobs:         database.NewJobTracker(),
+		requests:     make(map[string]*types.CodeMatchRequest),
+		refiltered:   make(map[string]int),
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (s *Service) Start() error {
+	log.Info("Starting template assignment by code service")
+	return nil
+}
+
+// Stop stops a running assignment at its next contract, after which it fails
+// and can be retried.
+func (s *Service) Stop() {
+	close(s.shutdownChan)
+	s.shutdownWg.Wait()
+	log.Info("Template assignment by code service stopped")
+}
+
+// Assign starts assigning the template to the contracts matching the request
+// in the background, returning the ID of its job.
+func (s *Service) Assign(request *types.CodeMatchRequest) (string, error) {
+	if err := s.check(request); err != nil {
+		return "", err
+	}
+	copied := *request
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running() {
+		return "", ErrAssignmentRunning
+	}
+	id := s.jobs.Start(types.CodeMatchJob, request.Address)
+	s.jobs.Update(id, func(job *types.Job) {
+		job.Template = request.Template
+	})
+	s.requests[id] = &copied
+	s.run(id, &copied)
+	return id, nil
+}
+
+// Retry runs a failed assignment again.
+func (s *Service) Retry(id string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running() {
+		return ErrAssignmentRunning
+	}
+	if _, err := s.jobs.Restart(id); err != nil {
+		return err
+	}
+	s.run(id, s.requests[id])
+	return nil
+}
+
+func (s *Service) GetJobs() []*types.Job {
+	return s.jobs.All()
+}
+
+func (s *Service) GetJob(id string) (*types.Job, error) {
+	return s.jobs.Get(id)
+}
+
+// check checks the request names a stored template, and either a code hash
+// or a contract to match the code of
+func (s *Service) check(request *types.CodeMatchRequest) error {
+	if request.Template == "" {
+		return errors.New("no template given")
+	}
+	if request.CodeHash.IsEmpty() == request.Address.IsEmpty() {
+		return errors.New("either a code hash or a contract address must be given")
+	}
+	templates, err := s.db.GetTemplates()
+	if err != nil {
+		return err
+	}
+	for _, template := range templates {
+		if template == request.Template {
+			return nil
+		}
+	}
+	return fmt.Errorf("template %s not found", request.Template)
+}
+
+// running reports whether an assignment is in progress; the lock must be held
+func (s *Service) running() bool {
+	for _, job := range s.jobs.All() {
+		if job.Status == types.JobRunning {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) run(id string, request *types.CodeMatchRequest) {
+	s.jobs.Update(id, func(job *types.Job) {
+		job.Processed = 0
+	})
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		log.Info("Template assignment by code started", "job", id, "template", request.Template)
+		err := s.assign(id, request)
+		if err != nil {
+			log.Error("Template assignment by code failed", "job", id, "template", request.Template, "err", err)
+		} else {
+			log.Info("Template assignment by code completed", "job", id, "template", request.Template)
+		}
+		s.jobs.Finish(id, err)
+	}()
+}
+
+func (s *Service) assign(id string, request *types.CodeMatchRequest) error {
+	blockNumber, err := s.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		return err
+	}
+	codeHash := request.CodeHash
+	if codeHash.IsEmpty() {
+		code, err := client.GetCode(s.client, request.Address, blockNumber)
+		if err != nil {
+			return err
+		}
+		if len(code) == 0 {
+			return fmt.Errorf("no contract code at %s", request.Address.Hex())
+		}
+		codeHash = hashCode(code.AsBytes(), request.IgnoreMetadata)
+	}
+
+	s.step(id, matchStep)
+	addresses, err := s.db.GetAddresses()
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if err := s.checkShutdown(); err != nil {
+			return err
+		}
+		template, err := s.db.GetContractTemplate(address)
+		if err != nil {
+			return err
+		}
+		if template != request.Template {
+			code, err := client.GetCode(s.client, address, blockNumber)
+			if err != nil {
+				return err
+			}
+			// contracts that self-destructed have no code
+			if len(code) > 0 && hashCode(code.AsBytes(), request.IgnoreMetadata) == codeHash {
+				if err := s.db.AssignTemplate(address, request.Template); err != nil {
+					return err
+				}
+				log.Info("Assigned template to contract with matching code", "job", id, "template", request.Template, "address", address.Hex())
+				s.jobs.Update(id, func(job *types.Job) {
+					job.Matched = append(job.Matched, address)
+				})
+			}
+		}
+		s.jobs.Update(id, func(job *types.Job) {
+			job.Processed++
+		})
+	}
+
+	s.step(id, refilterStep)
+	job, err := s.jobs.Get(id)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.shutdownChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for i := s.refilteredCount(id); i < len(job.Matched); i++ {
+		if err := s.checkShutdown(); err != nil {
+			return err
+		}
+		from, err := s.creationBlock(job.Matched[i])
+		if err != nil {
+			return err
+		}
+		if err := s.refilterer.RefilterContract(ctx, job.Matched[i], from); err != nil {
+			return err
+		}
+		s.mux.Lock()
+		s.refiltered[id] = i + 1
+		s.mux.Unlock()
+	}
+	return nil
+}
+
+func (s *Service) refilteredCount(id string) int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.refiltered[id]
+}
+
+// creationBlock returns the block the contract was created at, or 0 if its
+// creation hasn't been seen
+func (s *Service) creationBlock(address types.Address) (uint64, error) {
+	txHash, err := s.db.GetContractCreationTransaction(address)
+	if err != nil {
+		return 0, err
+	}
+	if txHash.IsEmpty() {
+		return 0, nil
+	}
+	tx, err := s.db.ReadTransaction(txHash)
+	if err == database.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return tx.BlockNumber, nil
+}
+
+func (s *Service) checkShutdown() error {
+	select {
+	case <-s.shutdownChan:
+		return errors.New("template assignment by code service is shutting down")
+	default:
+		return nil
+	}
+}
+
+func (s *Service) step(id string, step string) {
+	s.jobs.Update(id, func(job *types.Job) {
+		job.Step = step
+	})
+}
+
+// hashCode returns the keccak256 hash of the runtime bytecode, as returned by
+// EXTCODEHASH, optionally leaving out the metadata
+func hashCode(code []byte, ignoreMetadata bool) types.Hash {
+	if ignoreMetadata {
+		code = withoutMetadata(code)
+	}
+	d := sha3.NewLegacyKeccak256()
+	d.Write(code)
+	return types.NewHash(hex.EncodeToString(d.Sum(nil)))
+}
+
+// withoutMetadata returns the code without the metadata Solidity appends to
+// it: a CBOR map, followed by its length in two bytes. Code without metadata
+// is returned as it is.
+func withoutMetadata(code []byte) []byte {
+	if len(code) < 2 {
+		return code
+	}
+	length := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	if length == 0 || length+2 > len(code) {
+		return code
+	}
+	start := len(code) - 2 - length
+	// the major type of a CBOR map is 5
+	if code[start]>>5 != 5 {
+		return code
+	}
+	return code[:start]
+}
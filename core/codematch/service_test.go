@@ -0,0 +1,151 @@
+package codematch
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/core/jobtest"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// the runtime code of a token, ending with metadata that differs between
+	// builds
+	tokenCode      = "6080604052600080fd" + "a264697066735822" + "1220" + "aa" + "000b"
+	otherBuildCode = "6080604052600080fd" + "a264697066735822" + "1220" + "bb" + "000b"
+)
+
+var (
+	verified  = types.NewAddress("0x0000000000000000000000000000000000000010")
+	instance  = types.NewAddress("0x0000000000000000000000000000000000000020")
+	rebuilt   = types.NewAddress("0x0000000000000000000000000000000000000030")
+	different = types.NewAddress("0x0000000000000000000000000000000000000040")
+)
+
+func codeBytes(code string) []byte {
+	decoded, _ := hex.DecodeString(code)
+	return decoded
+}
+
+type refiltered struct {
+	address types.Address
+	from    uint64
+}
+
+type fakeRefilterer struct {
+	refiltered []refiltered
+	fail       bool
+}
+
+func (f *fakeRefilterer) RefilterContract(ctx context.Context, address types.Address, from uint64) error {
+	if f.fail {
+		f.fail = false
+		return errors.New("ingestion could not be paused")
+	}
+	f.refiltered = append(f.refiltered, refiltered{address, from})
+	return nil
+}
+
+func newTestService(t *testing.T) (*Service, *memory.MemoryDB, *fakeRefilterer) {
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{verified, instance, rebuilt, different}))
+	assert.Nil(t, db.AddTemplate("token", "[]", ""))
+	assert.Nil(t, db.AssignTemplate(verified, "token"))
+	creation := types.NewHash("0x01")
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{{Hash: creation, BlockNumber: 7, CreatedContract: instance}}))
+	assert.Nil(t, db.SetContractCreationTransaction(map[types.Hash][]types.Address{creation: {instance}}))
+
+	mockRPC := map[string]interface{}{
+		"eth_getCode" + verified.String() + "0x0":  types.NewHexData(tokenCode),
+		"eth_getCode" + instance.String() + "0x0":  types.NewHexData(tokenCode),
+		"eth_getCode" + rebuilt.String() + "0x0":   types.NewHexData(otherBuildCode),
+		"eth_getCode" + different.String() + "0x0": types.NewHexData("6080604052"),
+	}
+	refilterer := &fakeRefilterer{}
+	return NewService(db, client.NewStubQuorumClient(nil, mockRPC), refilterer), db, refilterer
+}
+
+func TestAssign_CodeHash(t *testing.T) {
+	s, db, refilterer := newTestService(t)
+	defer s.Stop()
+
+	id, err := s.Assign(&types.CodeMatchRequest{Template: "token", CodeHash: hashCode(codeBytes(tokenCode), false)})
+	assert.Nil(t, err)
+	assert.Equal(t, "assignTemplateByCode-1", id)
+	job := jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobCompleted, job.Status)
+	assert.Equal(t, "token", job.Template)
+	assert.Equal(t, []types.Address{instance}, job.Matched)
+	assert.EqualValues(t, 4, job.Processed)
+
+	template, err := db.GetContractTemplate(instance)
+	assert.Nil(t, err)
+	assert.Equal(t, "token", template)
+	template, err = db.GetContractTemplate(rebuilt)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "token", template)
+	// refiltered from the block it was created at
+	assert.Equal(t, []refiltered{{instance, 7}}, refilterer.refiltered)
+}
+
+func TestAssign_ReferenceIgnoringMetadata(t *testing.T) {
+	s, _, refilterer := newTestService(t)
+	defer s.Stop()
+
+	id, err := s.Assign(&types.CodeMatchRequest{Template: "token", Address: verified, IgnoreMetadata: true})
+	assert.Nil(t, err)
+	job := jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobCompleted, job.Status)
+	assert.Equal(t, []types.Address{instance, rebuilt}, job.Matched)
+	// the creation of rebuilt wasn't seen, so it is refiltered from the start
+	assert.Equal(t, []refiltered{{instance, 7}, {rebuilt, 0}}, refilterer.refiltered)
+}
+
+func TestAssign_Retry(t *testing.T) {
+	s, _, refilterer := newTestService(t)
+	defer s.Stop()
+	refilterer.fail = true
+
+	id, err := s.Assign(&types.CodeMatchRequest{Template: "token", Address: verified})
+	assert.Nil(t, err)
+	job := jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobFailed, job.Status)
+	assert.Equal(t, refilterStep, job.Step)
+	assert.Equal(t, "ingestion could not be paused", job.Error)
+
+	// the contract already has the template, but is still refiltered
+	assert.Nil(t, s.Retry(id))
+	job = jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobCompleted, job.Status)
+	assert.Equal(t, []types.Address{instance}, job.Matched)
+	assert.Equal(t, []refiltered{{instance, 7}}, refilterer.refiltered)
+}
+
+func TestAssign_InvalidRequest(t *testing.T) {
+	s, _, _ := newTestService(t)
+	defer s.Stop()
+
+	_, err := s.Assign(&types.CodeMatchRequest{CodeHash: types.NewHash("0x01")})
+	assert.EqualError(t, err, "no template given")
+	_, err = s.Assign(&types.CodeMatchRequest{Template: "token"})
+	assert.EqualError(t, err, "either a code hash or a contract address must be given")
+	_, err = s.Assign(&types.CodeMatchRequest{Template: "token", CodeHash: types.NewHash("0x01"), Address: verified})
+	assert.EqualError(t, err, "either a code hash or a contract address must be given")
+	_, err = s.Assign(&types.CodeMatchRequest{Template: "erc20", Address: verified})
+	assert.EqualError(t, err, "template erc20 not found")
+	assert.Empty(t, s.GetJobs())
+}
+
+func TestWithoutMetadata(t *testing.T) {
+	code := codeBytes(tokenCode)
+	assert.Equal(t, "6080604052600080fd", hex.EncodeToString(withoutMetadata(code)))
+	// code without metadata is hashed as it is
+	plain := codeBytes("6080604052")
+	assert.Equal(t, plain, withoutMetadata(plain))
+}
@@ -0,0 +1,396 @@
+package configsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/naoina/toml"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+var ErrNoDirectory = errors.New("config sync directory does not exist")
+
+// checkpointName is the checkpoint the applied definitions are stored under
+const checkpointName = "configsync"
+
+// Definitions are the addresses, templates and rules declared in a definition
+// file, in the same format as the main configuration file.
+type Definitions struct {
+	Addresses []*types.AddressConfig  `toml:"addresses,omitempty"`
+	Templates []*types.TemplateConfig `toml:"templates,omitempty"`
+	Rules     []*types.RuleConfig     `toml:"rules,omitempty"`
+}
+
+// appliedDefinitions are the addresses and templates that were last applied,
+// which are deleted once they are removed from the definitions
+type appliedDefinitions struct {
+	Addresses []types.Address `json:"addresses"`
+	Templates []string        `json:"templates"`
+}
+
+// RuleUpdater replaces the rules used to register newly created contracts.
+type RuleUpdater interface {
+	UpdateRules([]*types.RuleConfig) error
+}
+
+// ConfigSyncService watches a directory of definition files, and reconciles
+// the registered addresses, templates and rules with them. The definitions in
+// the directory plus those in the main configuration file replace all rules.
+// Addresses and templates that were removed from the files since they were
+// last applied are deleted, including while the service wasn't running, as
+// the applied definitions are stored in the database; those added through the
+// RPC API or by rules are left alone. Templates still assigned to a contract
+// are kept until they no longer are.
+type ConfigSyncService struct {
+	db           database.Database
+	ruleUpdater  RuleUpdater
+	directory    string
+	pollInterval time.Duration
+	// definitions from the main configuration file, which are always kept
+	base Definitions
+	// digest of the definition files that were last applied, and the
+	// definitions applied, which are loaded from the database on the first
+	// sync
+	lastDigest    string
+	applied       *appliedDefinitions
+	appliedLoaded bool
+	// syncs from the poll loop and configuration reloads run one at a time
+	syncMux sync.Mutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewConfigSyncService(db database.Database, ruleUpdater RuleUpdater, config types.ReportingConfig) *ConfigSyncService {
+	return &ConfigSyncService{
+		db:           db,
+		ruleUpdater:  ruleUpdater,
+		directory:    config.ConfigSync.Directory,
+		pollInterval: time.Duration(config.ConfigSync.PollInterval) * time.Second,
+		base: Definitions{
+			Addresses: config.Addresses,
+			Templates: config.Templates,
+			Rules:     config.Rules,
+		},
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+// Start applies the current definitions, then keeps checking the directory for
+// changes in the background.
+func (s *ConfigSyncService) Start() error {
+	log.Info("Starting config sync service", "directory", s.directory)
+	if err := s.Sync(); err != nil {
+		return err
+	}
+
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// the previous definitions stay in place until the files are fixed
+				if err := s.Sync(); err != nil {
+					log.Error("Config sync failed", "directory", s.directory, "err", err)
+				}
+			case <-s.shutdownChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *ConfigSyncService) Stop() {
+	close(s.shutdownChan)
+	s.shutdownWg.Wait()
+	log.Info("Config sync service stopped")
+}
+
+// Sync reads the definition files, and reconciles the configuration with them
+// if they have changed since they were last applied.
+func (s *ConfigSyncService) Sync() error {
+	s.syncMux.Lock()
+	defer s.syncMux.Unlock()
+	return s.sync()
+}
+
+// SetBase replaces the definitions from the main configuration file, after it
+// is reloaded, and reconciles the configuration with them and the definition
+// files. Addresses removed from the main configuration file are deleted, as
+// are those removed from the definition files.
+func (s *ConfigSyncService) SetBase(base Definitions) error {
+	s.syncMux.Lock()
+	defer s.syncMux.Unlock()
+	s.base = base
+	// the files may not have changed
+	s.lastDigest = ""
+	return s.sync()
+}
+
+func (s *ConfigSyncService) sync() error {
+	definitions, digest, err := ReadDefinitions(s.directory)
+	if err != nil {
+		return err
+	}
+	if digest == s.lastDigest {
+		return nil
+	}
+
+	log.Info("Definition files changed, reconciling configuration", "directory", s.directory)
+	desired, err := mergeDefinitions(&s.base, definitions)
+	if err != nil {
+		return err
+	}
+	if err := s.loadApplied(); err != nil {
+		return err
+	}
+	applied, err := s.reconcile(desired)
+	if err != nil {
+		return err
+	}
+	if err := s.storeApplied(applied); err != nil {
+		return err
+	}
+	s.lastDigest = digest
+	s.applied = applied
+	return nil
+}
+
+// loadApplied reads the definitions applied before the service was started,
+// if any were
+func (s *ConfigSyncService) loadApplied() error {
+	if s.appliedLoaded {
+		return nil
+	}
+	stored, err := s.db.GetCheckpoint(checkpointName)
+	if err == database.ErrNotFound {
+		s.appliedLoaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var applied appliedDefinitions
+	if err := json.Unmarshal([]byte(stored), &applied); err != nil {
+		return fmt.Errorf("could not read applied definitions: %s", err.Error())
+	}
+	s.applied = &applied
+	s.appliedLoaded = true
+	return nil
+}
+
+func (s *ConfigSyncService) storeApplied(applied *appliedDefinitions) error {
+	stored, err := json.Marshal(applied)
+	if err != nil {
+		return err
+	}
+	return s.db.SetCheckpoint(checkpointName, string(stored))
+}
+
+// ReadDefinitions reads all the .toml files in a directory, in name order,
+// returning their definitions and a digest of their contents.
+func ReadDefinitions(directory string) ([]*Definitions, string, error) {
+	// a missing directory must not be mistaken for one with no definitions,
+	// which would delete everything
+	if info, err := os.Stat(directory); err != nil || !info.IsDir() {
+		return nil, "", ErrNoDirectory
+	}
+	files, err := filepath.Glob(filepath.Join(directory, "*.toml"))
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Strings(files)
+
+	hash := sha256.New()
+	allDefinitions := make([]*Definitions, 0, len(files))
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, "", err
+		}
+		hash.Write([]byte(filepath.Base(file)))
+		hash.Write(contents)
+
+		var definitions Definitions
+		if err := toml.Unmarshal(contents, &definitions); err != nil {
+			return nil, "", fmt.Errorf("could not parse %s: %s", file, err.Error())
+		}
+		validate := types.ReportingConfig{Templates: definitions.Templates, Rules: definitions.Rules}
+		if err := validate.Validate(); err != nil {
+			return nil, "", fmt.Errorf("invalid definitions in %s: %s", file, err.Error())
+		}
+		allDefinitions = append(allDefinitions, &definitions)
+	}
+	return allDefinitions, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// mergeDefinitions combines all definitions into one, rejecting any address or
+// template that is defined more than once.
+func mergeDefinitions(base *Definitions, definitions []*Definitions) (*Definitions, error) {
+	merged := &Definitions{}
+	addresses := make(map[types.Address]bool)
+	templates := make(map[string]bool)
+	for _, d := range append([]*Definitions{base}, definitions...) {
+		for _, address := range d.Addresses {
+			if addresses[address.Address] {
+				return nil, fmt.Errorf("address %s defined more than once", address.Address.Hex())
+			}
+			addresses[address.Address] = true
+			merged.Addresses = append(merged.Addresses, address)
+		}
+		for _, template := range d.Templates {
+			if templates[template.TemplateName] {
+				return nil, fmt.Errorf("template %s defined more than once", template.TemplateName)
+			}
+			templates[template.TemplateName] = true
+			merged.Templates = append(merged.Templates, template)
+		}
+		merged.Rules = append(merged.Rules, d.Rules...)
+	}
+	return merged, nil
+}
+
+// reconcile applies the desired definitions, returning those that are now
+// applied
+func (s *ConfigSyncService) reconcile(desired *Definitions) (*appliedDefinitions, error) {
+	applied := &appliedDefinitions{}
+
+	// templates are created first and deleted last, so they exist for as long
+	// as the addresses and rules that use them
+	desiredTemplates := make(map[string]bool)
+	for _, template := range desired.Templates {
+		desiredTemplates[template.TemplateName] = true
+		applied.Templates = append(applied.Templates, template.TemplateName)
+		existing, err := s.db.GetTemplateDetails(template.TemplateName)
+		if err != nil && err != database.ErrNotFound {
+			return nil, err
+		}
+		if existing != nil && existing.ABI == template.ABI && existing.StorageLayout == template.StorageLayout {
+			continue
+		}
+		log.Info("Saving template from definition files", "template", template.TemplateName)
+		if err := s.db.AddTemplate(template.TemplateName, template.ABI, template.StorageLayout); err != nil {
+			return nil, err
+		}
+	}
+
+	existingAddresses, err := s.db.GetAddresses()
+	if err != nil {
+		return nil, err
+	}
+	registered := make(map[types.Address]bool)
+	for _, address := range existingAddresses {
+		registered[address] = true
+	}
+	desiredAddresses := make(map[types.Address]bool)
+	for _, address := range desired.Addresses {
+		desiredAddresses[address.Address] = true
+		applied.Addresses = append(applied.Addresses, address.Address)
+		if !registered[address.Address] {
+			log.Info("Adding address from definition files", "address", address.Address.Hex())
+			if address.From > 0 {
+				err = s.db.AddAddressFrom(address.Address, address.From)
+			} else {
+				err = s.db.AddAddresses([]types.Address{address.Address})
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if address.TerminalBlock > 0 {
+			if err := s.db.SetTerminalBlock(address.Address, address.TerminalBlock); err != nil {
+				return nil, err
+			}
+		}
+		if address.TemplateName == "" {
+			continue
+		}
+		current, err := s.db.GetContractTemplate(address.Address)
+		if err != nil && err != database.ErrNotFound {
+			return nil, err
+		}
+		if current != address.TemplateName {
+			log.Info("Assigning template from definition files", "address", address.Address.Hex(), "template", address.TemplateName)
+			if err := s.db.AssignTemplate(address.Address, address.TemplateName); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := s.ruleUpdater.UpdateRules(desired.Rules); err != nil {
+		return nil, err
+	}
+
+	if s.applied == nil {
+		return applied, nil
+	}
+	deleted := make(map[types.Address]bool)
+	for _, address := range s.applied.Addresses {
+		if !desiredAddresses[address] && registered[address] {
+			log.Info("Deleting address removed from definition files", "address", address.Hex())
+			if err := s.db.DeleteAddress(address, true); err != nil {
+				return nil, err
+			}
+			deleted[address] = true
+		}
+	}
+
+	var assigned map[string]bool
+	for _, template := range s.applied.Templates {
+		if desiredTemplates[template] {
+			continue
+		}
+		if assigned == nil {
+			if assigned, err = s.assignedTemplates(existingAddresses, deleted); err != nil {
+				return nil, err
+			}
+		}
+		// a template still in use is kept, and deleted once it no longer is
+		if assigned[template] {
+			log.Warn("Not deleting template removed from definition files, as it is still assigned", "template", template)
+			applied.Templates = append(applied.Templates, template)
+			continue
+		}
+		log.Info("Deleting template removed from definition files", "template", template)
+		if err := s.db.DeleteTemplate(template); err != nil {
+			return nil, err
+		}
+	}
+	return applied, nil
+}
+
+// assignedTemplates returns the templates assigned to the registered
+// addresses, other than those being deleted
+func (s *ConfigSyncService) assignedTemplates(addresses []types.Address, deleted map[types.Address]bool) (map[string]bool, error) {
+	assigned := make(map[string]bool)
+	for _, address := range addresses {
+		if deleted[address] {
+			continue
+		}
+		template, err := s.db.GetContractTemplate(address)
+		if err != nil && err != database.ErrNotFound {
+			return nil, err
+		}
+		if template != "" {
+			assigned[template] = true
+		}
+	}
+	return assigned, nil
+}
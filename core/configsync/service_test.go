@@ -0,0 +1,178 @@
+package configsync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+const testDefinitions = `
+templates = [
+    { templateName = "Simple", abi = "[]", storageLayout = "{}" }
+]
+addresses = [
+    { address = "0x0000000000000000000000000000000000000001", templateName = "Simple" },
+    { address = "0x0000000000000000000000000000000000000002", from = 10 }
+]
+rules = [
+    { scope = "all", templateName = "Simple" }
+]
+`
+
+type fakeRuleUpdater struct {
+	rules []*types.RuleConfig
+}
+
+func (f *fakeRuleUpdater) UpdateRules(rules []*types.RuleConfig) error {
+	f.rules = rules
+	return nil
+}
+
+func TestConfigSyncService_Sync(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "configsync")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "contracts.toml")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(testDefinitions), 0644))
+
+	db := memory.NewMemoryDB()
+	rpcAddress := types.NewAddress("0x0000000000000000000000000000000000000009")
+	assert.Nil(t, db.AddAddresses([]types.Address{rpcAddress}))
+	ruleUpdater := &fakeRuleUpdater{}
+	config := types.ReportingConfig{ConfigSync: &types.ConfigSyncConfig{Directory: dir, PollInterval: 1}}
+	syncService := NewConfigSyncService(db, ruleUpdater, config)
+
+	// create
+	assert.Nil(t, syncService.Sync())
+	addresses, _ := db.GetAddresses()
+	assert.ElementsMatch(t, []types.Address{rpcAddress, types.NewAddress("0x01"), types.NewAddress("0x02")}, addresses)
+	template, _ := db.GetContractTemplate(types.NewAddress("0x01"))
+	assert.Equal(t, "Simple", template)
+	lastFiltered, _ := db.GetLastFiltered(types.NewAddress("0x02"))
+	assert.EqualValues(t, 9, lastFiltered)
+	assert.Len(t, ruleUpdater.rules, 1)
+
+	// update the template and delete an address and the rule
+	updated := `
+templates = [
+    { templateName = "Simple", abi = "[]", storageLayout = "{\"storage\":[]}" }
+]
+addresses = [
+    { address = "0x0000000000000000000000000000000000000001", templateName = "Simple" }
+]
+`
+	assert.Nil(t, ioutil.WriteFile(file, []byte(updated), 0644))
+	assert.Nil(t, syncService.Sync())
+	addresses, _ = db.GetAddresses()
+	assert.ElementsMatch(t, []types.Address{rpcAddress, types.NewAddress("0x01")}, addresses)
+	details, _ := db.GetTemplateDetails("Simple")
+	assert.Equal(t, `{"storage":[]}`, details.StorageLayout)
+	assert.Len(t, ruleUpdater.rules, 0)
+
+	// delete the template
+	assert.Nil(t, os.Remove(file))
+	assert.Nil(t, syncService.Sync())
+	templates, _ := db.GetTemplates()
+	assert.Empty(t, templates)
+	addresses, _ = db.GetAddresses()
+	assert.ElementsMatch(t, []types.Address{rpcAddress}, addresses)
+}
+
+func TestConfigSyncService_Sync_Invalid(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "configsync")
+	defer os.RemoveAll(dir)
+
+	db := memory.NewMemoryDB()
+	syncService := NewConfigSyncService(db, &fakeRuleUpdater{}, types.ReportingConfig{ConfigSync: &types.ConfigSyncConfig{Directory: filepath.Join(dir, "missing")}})
+	assert.Equal(t, ErrNoDirectory, syncService.Sync())
+
+	duplicate := `addresses = [{ address = "0x0000000000000000000000000000000000000001" }]`
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a.toml"), []byte(duplicate), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "b.toml"), []byte(duplicate), 0644))
+	syncService = NewConfigSyncService(db, &fakeRuleUpdater{}, types.ReportingConfig{ConfigSync: &types.ConfigSyncConfig{Directory: dir}})
+	assert.EqualError(t, syncService.Sync(), "address 0x0000000000000000000000000000000000000001 defined more than once")
+	addresses, _ := db.GetAddresses()
+	assert.Empty(t, addresses)
+}
+
+func TestConfigSyncService_SetBase(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "configsync")
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "contracts.toml"), []byte(testDefinitions), 0644))
+
+	db := memory.NewMemoryDB()
+	ruleUpdater := &fakeRuleUpdater{}
+	syncService := NewConfigSyncService(db, ruleUpdater, types.ReportingConfig{ConfigSync: &types.ConfigSyncConfig{Directory: dir}})
+	assert.Nil(t, syncService.Sync())
+
+	// the main configuration file adds an address and a rule, without the
+	// definition files changing
+	baseAddress := types.NewAddress("0x0000000000000000000000000000000000000003")
+	assert.Nil(t, syncService.SetBase(Definitions{
+		Addresses: []*types.AddressConfig{{Address: baseAddress, TemplateName: "Simple"}},
+		Rules:     []*types.RuleConfig{{Scope: types.EventScope, TemplateName: "Simple"}},
+	}))
+	addresses, _ := db.GetAddresses()
+	assert.ElementsMatch(t, []types.Address{types.NewAddress("0x01"), types.NewAddress("0x02"), baseAddress}, addresses)
+	template, _ := db.GetContractTemplate(baseAddress)
+	assert.Equal(t, "Simple", template)
+	assert.Len(t, ruleUpdater.rules, 2)
+
+	// and removes them again
+	assert.Nil(t, syncService.SetBase(Definitions{}))
+	addresses, _ = db.GetAddresses()
+	assert.ElementsMatch(t, []types.Address{types.NewAddress("0x01"), types.NewAddress("0x02")}, addresses)
+	assert.Len(t, ruleUpdater.rules, 1)
+}
+
+func TestConfigSyncService_Sync_RemovedWhileStopped(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "configsync")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "contracts.toml")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(testDefinitions), 0644))
+
+	db := memory.NewMemoryDB()
+	config := types.ReportingConfig{ConfigSync: &types.ConfigSyncConfig{Directory: dir}}
+	assert.Nil(t, NewConfigSyncService(db, &fakeRuleUpdater{}, config).Sync())
+
+	// the definitions applied before a restart are deleted once removed
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`addresses = [{ address = "0x0000000000000000000000000000000000000002" }]`), 0644))
+	assert.Nil(t, NewConfigSyncService(db, &fakeRuleUpdater{}, config).Sync())
+	addresses, _ := db.GetAddresses()
+	assert.ElementsMatch(t, []types.Address{types.NewAddress("0x02")}, addresses)
+	templates, _ := db.GetTemplates()
+	assert.Empty(t, templates)
+}
+
+func TestConfigSyncService_Sync_TemplateStillAssigned(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "configsync")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "contracts.toml")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(testDefinitions), 0644))
+
+	db := memory.NewMemoryDB()
+	syncService := NewConfigSyncService(db, &fakeRuleUpdater{}, types.ReportingConfig{ConfigSync: &types.ConfigSyncConfig{Directory: dir}})
+	assert.Nil(t, syncService.Sync())
+
+	// an address registered through the RPC API uses the template
+	rpcAddress := types.NewAddress("0x0000000000000000000000000000000000000009")
+	assert.Nil(t, db.AddAddresses([]types.Address{rpcAddress}))
+	assert.Nil(t, db.AssignTemplate(rpcAddress, "Simple"))
+
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`addresses = [{ address = "0x0000000000000000000000000000000000000002" }]`), 0644))
+	assert.Nil(t, syncService.Sync())
+	templates, _ := db.GetTemplates()
+	assert.Equal(t, []string{"Simple"}, templates)
+
+	// and is deleted once it is no longer assigned
+	assert.Nil(t, db.AssignTemplate(rpcAddress, "Other"))
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`addresses = [{ address = "0x0000000000000000000000000000000000000003" }]`), 0644))
+	assert.Nil(t, syncService.Sync())
+	templates, _ = db.GetTemplates()
+	assert.Empty(t, templates)
+}
@@ -0,0 +1,232 @@
+package election
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+var (
+	ErrLeaseLost     = errors.New("another instance took the leader lease")
+	ErrLeaseExpiring = errors.New("the leader lease couldn't be renewed before expiring")
+)
+
+// Elector campaigns for the leader lease of a database shared by several
+// instances. Standbys try to take the lease on each interval, which they can
+// once the leader has released it or it has expired. The leader renews it on
+// each interval, and steps down if it can't before the lease would expire,
+// as another instance may then take it. Expiry is checked again once each
+// lease request returns, so a request held up for longer than the lease
+// doesn't keep a leader writing past its expiry.
+//
+// Leading starts once the lease is taken, by calling elected, and ends for
+// good, by calling deposed, as the services writing to the database can't be
+// started again once stopped. deposed is given until when the lease is still
+// held, and must stop the writing services by then, before the lease is
+// released. There is no fencing of the writes themselves: a write already
+// sent to the database when the lease runs out may still land after another
+// instance has taken over, so leaders can overlap by as long as one write
+// takes, and by up to the rest of the lease if it was lost to a clock skewed
+// instance or one that took it while a renewal was held up.
+type Elector struct {
+	db            database.LeaseDB
+	instanceID    string
+	leaseDuration time.Duration
+	renewInterval time.Duration
+	elected       func() error
+	deposed       func(err error, deadline time.Time)
+	clock         func() time.Time
+
+	leader bool
+	// when the lease held by the instance runs out, unless renewed
+	expiresAt time.Time
+	// the lease as last read
+	lease *types.Lease
+	// leadership has ended, so isn't campaigned for again
+	stepped bool
+	mux     sync.RWMutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+// NewElector campaigns as the configured instance, defaulting to the
+// hostname. elected is called once the lease is taken, and deposed once it
+// is lost, or if elected fails, with until when the lease is held; a zero
+// deadline means it already isn't.
+func NewElector(db database.LeaseDB, config *types.HighAvailabilityConfig, elected func() error, deposed func(err error, deadline time.Time)) (*Elector, error) {
+	instanceID := config.InstanceID
+	if instanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		instanceID = hostname
+	}
+	return &Elector{
+		db:            db,
+		instanceID:    instanceID,
+		leaseDuration: time.Duration(config.LeaseDuration) * time.Second,
+		renewInterval: time.Duration(config.RenewInterval) * time.Second,
+		elected:       elected,
+		deposed:       deposed,
+		clock:         time.Now,
+		shutdownChan:  make(chan struct{}),
+	}, nil
+}
+
+func (e *Elector) Start() error {
+	log.Info("Starting leader election", "instance", e.instanceID, "lease", e.leaseDuration, "renew interval", e.renewInterval)
+
+	e.shutdownWg.Add(1)
+	go func() {
+		defer e.shutdownWg.Done()
+		ticker := time.NewTicker(e.renewInterval)
+		defer ticker.Stop()
+		for {
+			e.campaign(e.clock())
+			select {
+			case <-ticker.C:
+			case <-e.shutdownChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops campaigning, returning once the instance is no longer about to
+// start leading. A leader keeps the lease until it is released.
+func (e *Elector) Stop() {
+	close(e.shutdownChan)
+	e.shutdownWg.Wait()
+	log.Info("Leader election stopped")
+}
+
+// Release gives up the lease if the instance is leading, so a standby can
+// take over without waiting for it to expire. The services writing to the
+// database must have stopped first.
+func (e *Elector) Release() {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if !e.leader {
+		return
+	}
+	e.leader = false
+	if err := e.db.ReleaseLease(types.LeaderLease, e.instanceID); err != nil {
+		log.Warn("Releasing the leader lease failed", "err", err)
+		return
+	}
+	log.Info("Released the leader lease", "instance", e.instanceID)
+}
+
+// IsLeader checks whether the instance holds the lease, so is the one writing
+// to the database
+func (e *Elector) IsLeader() bool {
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+	return e.leader
+}
+
+func (e *Elector) Status() *types.HighAvailabilityStatus {
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+	status := &types.HighAvailabilityStatus{InstanceID: e.instanceID, Leader: e.leader}
+	if e.lease != nil {
+		lease := *e.lease
+		status.Lease = &lease
+	}
+	return status
+}
+
+// campaign takes or renews the lease as of the given time, and starts or ends
+// leading if that changed who holds it
+func (e *Elector) campaign(now time.Time) {
+	e.mux.RLock()
+	stepped := e.stepped
+	e.mux.RUnlock()
+	if stepped {
+		return
+	}
+
+	started := e.clock()
+	lease, err := e.db.AcquireLease(types.LeaderLease, e.instanceID, e.leaseDuration)
+	// expiry is checked as of when the request returned, which may be long
+	// after it was sent
+	answered := now.Add(e.clock().Sub(started))
+	if err != nil {
+		log.Warn("Acquiring the leader lease failed", "err", err)
+		e.mux.RLock()
+		// the next attempt would be too late to keep it
+		expiring := e.leader && !answered.Add(e.renewInterval).Before(e.expiresAt)
+		e.mux.RUnlock()
+		if expiring {
+			e.stepDown(ErrLeaseExpiring)
+		}
+		return
+	}
+
+	holds := lease.Holder == e.instanceID
+	e.mux.Lock()
+	e.lease = lease
+	wasLeader := e.leader
+	// the lease ran out while the request was held up, so another instance
+	// may have taken it meanwhile
+	lapsed := wasLeader && !answered.Before(e.expiresAt)
+	if holds {
+		// timed from before the request, as the lease may have been written
+		// any time after
+		e.expiresAt = now.Add(e.leaseDuration)
+	}
+	// the next attempt would be too late to keep it
+	expiring := holds && !answered.Add(e.renewInterval).Before(e.expiresAt)
+	e.mux.Unlock()
+
+	switch {
+	case wasLeader && (lapsed || expiring):
+		e.stepDown(ErrLeaseExpiring)
+	case holds && !wasLeader && expiring:
+		log.Warn("Taking the leader lease took too long to lead with it", "took", answered.Sub(now))
+	case holds && !wasLeader:
+		log.Info("Elected leader", "instance", e.instanceID)
+		if err := e.elected(); err != nil {
+			e.stepDown(err)
+			return
+		}
+		// writes are only accepted once the services making them are running
+		e.mux.Lock()
+		e.leader = true
+		e.mux.Unlock()
+	case !holds && wasLeader:
+		e.stepDown(ErrLeaseLost)
+	case !holds:
+		log.Debug("Standing by", "leader", lease.Holder)
+	}
+}
+
+// stepDown ends leading for the reason given, releasing the lease if it is
+// still held once the writing services have stopped
+func (e *Elector) stepDown(reason error) {
+	e.mux.Lock()
+	e.leader = false
+	e.stepped = true
+	var deadline time.Time
+	if reason != ErrLeaseLost {
+		deadline = e.expiresAt
+	}
+	e.mux.Unlock()
+
+	log.Error("Stepping down as leader", "instance", e.instanceID, "reason", reason)
+	e.deposed(reason, deadline)
+	if reason != ErrLeaseLost {
+		if err := e.db.ReleaseLease(types.LeaderLease, e.instanceID); err != nil {
+			log.Warn("Releasing the leader lease failed", "err", err)
+		}
+	}
+}
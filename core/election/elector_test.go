@@ -0,0 +1,164 @@
+package election
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+// fakeDB fails to acquire leases while err is set, and takes delay to answer
+// as told by clock
+type fakeDB struct {
+	*memory.MemoryDB
+	err   error
+	delay time.Duration
+	clock time.Time
+}
+
+func (f *fakeDB) AcquireLease(name string, holder string, duration time.Duration) (*types.Lease, error) {
+	f.clock = f.clock.Add(f.delay)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.MemoryDB.AcquireLease(name, holder, duration)
+}
+
+type candidate struct {
+	*Elector
+	elected   int
+	deposed   []error
+	deadlines []time.Time
+	fail      error
+}
+
+func newCandidate(t *testing.T, db *fakeDB, instanceID string) *candidate {
+	c := &candidate{}
+	elector, err := NewElector(db, &types.HighAvailabilityConfig{InstanceID: instanceID, LeaseDuration: 15, RenewInterval: 5}, func() error {
+		c.elected++
+		return c.fail
+	}, func(err error, deadline time.Time) {
+		c.deposed = append(c.deposed, err)
+		c.deadlines = append(c.deadlines, deadline)
+	})
+	assert.Nil(t, err)
+	elector.clock = func() time.Time { return db.clock }
+	c.Elector = elector
+	return c
+}
+
+func TestElector_Failover(t *testing.T) {
+	db := &fakeDB{MemoryDB: memory.NewMemoryDB()}
+	first := newCandidate(t, db, "reporting-1")
+	second := newCandidate(t, db, "reporting-2")
+	now := time.Now()
+
+	first.campaign(now)
+	second.campaign(now)
+	assert.True(t, first.IsLeader())
+	assert.False(t, second.IsLeader())
+	assert.Equal(t, "reporting-1", second.Status().Lease.Holder)
+
+	// renewing doesn't elect the leader again
+	first.campaign(now.Add(5 * time.Second))
+	assert.Equal(t, 1, first.elected)
+
+	// a standby takes over once the leader releases the lease
+	first.Release()
+	second.campaign(now.Add(10 * time.Second))
+	assert.False(t, first.IsLeader())
+	assert.True(t, second.IsLeader())
+	assert.Equal(t, 1, second.elected)
+	assert.Empty(t, first.deposed)
+}
+
+func TestElector_LeaseLost(t *testing.T) {
+	db := &fakeDB{MemoryDB: memory.NewMemoryDB()}
+	leader := newCandidate(t, db, "reporting-1")
+	now := time.Now()
+	leader.campaign(now)
+	assert.True(t, leader.IsLeader())
+
+	// another instance took the lease after it expired
+	assert.Nil(t, db.ReleaseLease(types.LeaderLease, "reporting-1"))
+	_, err := db.AcquireLease(types.LeaderLease, "reporting-2", time.Minute)
+	assert.Nil(t, err)
+	leader.campaign(now.Add(5 * time.Second))
+	assert.False(t, leader.IsLeader())
+	assert.Equal(t, []error{ErrLeaseLost}, leader.deposed)
+	// the writing services don't get to finish
+	assert.Equal(t, []time.Time{{}}, leader.deadlines)
+
+	// it doesn't campaign again
+	assert.Nil(t, db.ReleaseLease(types.LeaderLease, "reporting-2"))
+	leader.campaign(now.Add(10 * time.Second))
+	assert.False(t, leader.IsLeader())
+	assert.Equal(t, 1, leader.elected)
+}
+
+func TestElector_RenewalFailing(t *testing.T) {
+	db := &fakeDB{MemoryDB: memory.NewMemoryDB()}
+	leader := newCandidate(t, db, "reporting-1")
+	now := time.Now()
+	leader.campaign(now)
+
+	// the lease is kept while there is time to renew it
+	db.err = errors.New("timed out")
+	leader.campaign(now.Add(5 * time.Second))
+	assert.True(t, leader.IsLeader())
+	// but not once the next attempt would be too late
+	leader.campaign(now.Add(10 * time.Second))
+	assert.False(t, leader.IsLeader())
+	assert.Equal(t, []error{ErrLeaseExpiring}, leader.deposed)
+	// the writing services have until the lease expires to finish
+	assert.Equal(t, []time.Time{now.Add(15 * time.Second)}, leader.deadlines)
+}
+
+func TestElector_RenewalHeldUp(t *testing.T) {
+	db := &fakeDB{MemoryDB: memory.NewMemoryDB()}
+	leader := newCandidate(t, db, "reporting-1")
+	now := time.Now()
+	leader.campaign(now)
+
+	// a renewal answered after the lease has run out doesn't keep it
+	db.delay = 20 * time.Second
+	leader.campaign(now.Add(5 * time.Second))
+	assert.False(t, leader.IsLeader())
+	assert.Equal(t, []error{ErrLeaseExpiring}, leader.deposed)
+	_, err := db.GetLease(types.LeaderLease)
+	assert.Equal(t, database.ErrNotFound, err)
+}
+
+func TestElector_ElectionHeldUp(t *testing.T) {
+	db := &fakeDB{MemoryDB: memory.NewMemoryDB(), delay: 12 * time.Second}
+	candidate := newCandidate(t, db, "reporting-1")
+
+	// a lease taken too late to renew isn't led with
+	candidate.campaign(time.Now())
+	assert.False(t, candidate.IsLeader())
+	assert.Equal(t, 0, candidate.elected)
+
+	// but is once taken in time
+	db.delay = 0
+	candidate.campaign(time.Now())
+	assert.True(t, candidate.IsLeader())
+	assert.Equal(t, 1, candidate.elected)
+}
+
+func TestElector_StartingFailed(t *testing.T) {
+	db := &fakeDB{MemoryDB: memory.NewMemoryDB()}
+	leader := newCandidate(t, db, "reporting-1")
+	leader.fail = errors.New("start up failed")
+	leader.campaign(time.Now())
+
+	// the lease is released for another instance to take
+	assert.False(t, leader.IsLeader())
+	assert.Equal(t, []error{leader.fail}, leader.deposed)
+	_, err := db.GetLease(types.LeaderLease)
+	assert.Equal(t, database.ErrNotFound, err)
+}
@@ -0,0 +1,225 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// tokenPageSize is how many token holders or tokens are read at a time
+const tokenPageSize = 1000
+
+// dataset is a table of the data of a contract, exported to its own file.
+// Decoded parameters are written as a JSON object in a single column, so every
+// row has the same columns whatever the function or event.
+type dataset struct {
+	columns []column
+	// rows passes each row of the request's block range to write, oldest
+	// first
+	rows func(db ExportDB, request *types.ExportRequest, write func(row []interface{}) error) error
+}
+
+var datasets = map[string]*dataset{
+	types.TransactionsDataset: {
+		columns: []column{
+			{"blockNumber", true}, {"timestamp", true}, {"timestampISO", false}, {"hash", false}, {"index", true},
+			{"from", false}, {"to", false}, {"status", false}, {"value", true}, {"gasUsed", true}, {"txSig", false}, {"parameters", false},
+		},
+		rows: transactionRows,
+	},
+	types.EventsDataset: {
+		columns: []column{
+			{"blockNumber", true}, {"timestamp", true}, {"timestampISO", false}, {"transactionHash", false}, {"transactionIndex", true},
+			{"index", true}, {"eventSig", false}, {"parameters", false},
+		},
+		rows: eventRows,
+	},
+	// the storage after each block it changed in, with the storage it held at
+	// the start of the range as of the block it last changed before it
+	types.StorageDataset: {
+		columns: []column{{"blockNumber", true}, {"variable", false}, {"value", false}},
+		rows:    storageRows,
+	},
+	// the ERC20 balances and ERC721 tokens held at the end of the range; the
+	// token ID is empty for ERC20 balances, and the balance 1 for ERC721 tokens
+	types.BalancesDataset: {
+		columns: []column{{"blockNumber", true}, {"holder", false}, {"tokenId", false}, {"balance", false}},
+		rows:    balanceRows,
+	},
+}
+
+func blockRange(request *types.ExportRequest) *types.QueryOptions {
+	options := &types.QueryOptions{
+		BeginBlockNumber: new(big.Int).SetUint64(request.StartBlock),
+		EndBlockNumber:   new(big.Int).SetUint64(request.EndBlock),
+	}
+	options.SetDefaults()
+	return options
+}
+
+func transactionRows(db ExportDB, request *types.ExportRequest, write func(row []interface{}) error) error {
+	contractABI, err := db.GetContractABI(request.Address)
+	if err != nil {
+		return err
+	}
+	timestamps := newBlockTimestamps(db)
+	return db.ExportTransactionsToAddress(request.Address, blockRange(request), func(tx *types.Transaction) error {
+		parsed := &types.ParsedTransaction{RawTransaction: tx}
+		if contractABI != "" {
+			if err := parsed.ParseTransaction(contractABI); err != nil {
+				return err
+			}
+		}
+		parsed.SetTimestamp(timestamps.lookup(tx.BlockNumber, tx.Timestamp))
+		parameters, err := json.Marshal(parsed.ParsedData)
+		if err != nil {
+			return err
+		}
+		return write([]interface{}{
+			tx.BlockNumber, parsed.Timestamp, parsed.TimestampISO, tx.Hash.Hex(), tx.Index,
+			tx.From.Hex(), tx.To.Hex(), fmt.Sprint(tx.Status), tx.Value, tx.GasUsed, parsed.Sig, string(parameters),
+		})
+	})
+}
+
+func eventRows(db ExportDB, request *types.ExportRequest, write func(row []interface{}) error) error {
+	contractABI, err := db.GetContractABI(request.Address)
+	if err != nil {
+		return err
+	}
+	timestamps := newBlockTimestamps(db)
+	return db.ExportEventsFromAddress(request.Address, blockRange(request), func(e *types.Event) error {
+		parsed := &types.ParsedEvent{RawEvent: e}
+		if contractABI != "" {
+			if err := parsed.ParseEvent(contractABI); err != nil {
+				return err
+			}
+		}
+		parsed.SetTimestamp(timestamps.lookup(e.BlockNumber, e.Timestamp))
+		parameters, err := json.Marshal(parsed.ParsedData)
+		if err != nil {
+			return err
+		}
+		return write([]interface{}{
+			e.BlockNumber, parsed.Timestamp, parsed.TimestampISO, e.TransactionHash.Hex(), e.TransactionIndex,
+			e.Index, parsed.Sig, string(parameters),
+		})
+	})
+}
+
+// storageRows writes a row for each variable of the storage, or for each slot
+// of storage indexed without a layout to decode it with
+func storageRows(db ExportDB, request *types.ExportRequest, write func(row []interface{}) error) error {
+	options := &types.PageOptions{
+		BeginBlockNumber: new(big.Int).SetUint64(request.StartBlock),
+		EndBlockNumber:   new(big.Int).SetUint64(request.EndBlock),
+	}
+	changes, err := db.GetStorageValues(request.Address, options)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		for _, value := range change.Values {
+			if err := write([]interface{}{change.BlockNumber, value.Variable, value.Value}); err != nil {
+				return err
+			}
+		}
+		slots := make([]string, 0, len(change.Storage))
+		values := make(map[string]string, len(change.Storage))
+		for slot, value := range change.Storage {
+			slots = append(slots, slot.Hex())
+			values[slot.Hex()] = value
+		}
+		sort.Strings(slots)
+		for _, slot := range slots {
+			if err := write([]interface{}{change.BlockNumber, slot, values[slot]}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func balanceRows(db ExportDB, request *types.ExportRequest, write func(row []interface{}) error) error {
+	block := request.EndBlock
+	holdersOptions := &types.TokenQueryOptions{PageSize: tokenPageSize}
+	holdersOptions.SetDefaults()
+	for {
+		holders, err := db.GetAllTokenHolders(request.Address, block, holdersOptions)
+		if err != nil {
+			return err
+		}
+		for _, holder := range holders {
+			balanceOptions := &types.TokenQueryOptions{
+				BeginBlockNumber: new(big.Int).SetUint64(block),
+				EndBlockNumber:   new(big.Int).SetUint64(block),
+			}
+			balances, err := db.GetERC20Balance(request.Address, holder, balanceOptions)
+			if err != nil {
+				return err
+			}
+			balance, ok := balances[block]
+			if !ok || balance.Sign() == 0 {
+				continue
+			}
+			if err := write([]interface{}{block, holder.Hex(), "", balance.String()}); err != nil {
+				return err
+			}
+		}
+		if len(holders) < tokenPageSize {
+			break
+		}
+		holdersOptions.After = holders[len(holders)-1].String()
+	}
+
+	tokensOptions := &types.TokenQueryOptions{PageSize: tokenPageSize}
+	tokensOptions.SetDefaults()
+	for {
+		tokens, err := db.AllERC721TokensAtBlock(request.Address, block, tokensOptions)
+		if err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			if err := write([]interface{}{block, token.Holder.Hex(), token.Token, "1"}); err != nil {
+				return err
+			}
+		}
+		if len(tokens) < tokenPageSize {
+			break
+		}
+		tokensOptions.After = tokens[len(tokens)-1].Token
+	}
+	return nil
+}
+
+// blockTimestamps finds the block time of transactions and events, joining it
+// from the block, once per block, for data written by older versions that
+// doesn't have it.
+type blockTimestamps struct {
+	db     ExportDB
+	blocks map[uint64]uint64
+}
+
+func newBlockTimestamps(db ExportDB) *blockTimestamps {
+	return &blockTimestamps{db: db, blocks: make(map[uint64]uint64)}
+}
+
+func (bt *blockTimestamps) lookup(blockNumber uint64, timestamp uint64) uint64 {
+	if timestamp != 0 {
+		return timestamp
+	}
+	if blockTimestamp, ok := bt.blocks[blockNumber]; ok {
+		return blockTimestamp
+	}
+	block, err := bt.db.ReadBlock(blockNumber)
+	if err != nil {
+		log.Debug("Unable to read block for timestamp", "number", blockNumber, "err", err)
+		return 0
+	}
+	bt.blocks[blockNumber] = block.Timestamp
+	return block.Timestamp
+}
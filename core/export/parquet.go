@@ -0,0 +1,293 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// parquetRowGroupSize is how many rows are buffered before they are written
+// out as a row group
+const parquetRowGroupSize = 10000
+
+var parquetMagic = []byte("PAR1")
+
+// Parquet enum values, as numbered in parquet.thrift
+const (
+	parquetInt64        = 2
+	parquetByteArray    = 6
+	parquetRequired     = 0
+	parquetUTF8         = 0
+	parquetPlain        = 0
+	parquetRLE          = 3
+	parquetUncompressed = 0
+	parquetDataPage     = 0
+)
+
+// parquetWriter writes rows as a Parquet file. The columns are all required,
+// each either a 64 bit integer or a UTF-8 string, and are plain encoded
+// without compression, which every Parquet reader supports. Each row group has
+// a single data page per column.
+type parquetWriter struct {
+	w            io.Writer
+	offset       int64
+	columns      []column
+	rowGroupSize int
+
+	// the values of each column buffered for the next row group, plain encoded
+	values    []bytes.Buffer
+	rows      int
+	rowGroups []parquetRowGroup
+	totalRows int64
+}
+
+type parquetRowGroup struct {
+	chunks []parquetChunk
+	rows   int64
+	size   int64
+}
+
+// parquetChunk is where the page of a column chunk was written, and its size
+// including the page header
+type parquetChunk struct {
+	offset int64
+	size   int64
+}
+
+func newParquetWriter(w io.Writer, columns []column) (*parquetWriter, error) {
+	pw := &parquetWriter{
+		w:            w,
+		columns:      columns,
+		rowGroupSize: parquetRowGroupSize,
+		values:       make([]bytes.Buffer, len(columns)),
+	}
+	return pw, pw.write(parquetMagic)
+}
+
+func (pw *parquetWriter) Write(row []interface{}) error {
+	var scratch [8]byte
+	for i, c := range pw.columns {
+		if c.integer {
+			binary.LittleEndian.PutUint64(scratch[:], row[i].(uint64))
+			pw.values[i].Write(scratch[:8])
+			continue
+		}
+		value := row[i].(string)
+		binary.LittleEndian.PutUint32(scratch[:], uint32(len(value)))
+		pw.values[i].Write(scratch[:4])
+		pw.values[i].WriteString(value)
+	}
+	pw.rows++
+	if pw.rows == pw.rowGroupSize {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+// Close writes out the buffered rows and the file metadata, without closing
+// the underlying writer.
+func (pw *parquetWriter) Close() error {
+	if pw.rows > 0 {
+		if err := pw.flushRowGroup(); err != nil {
+			return err
+		}
+	}
+	metadata := pw.fileMetadata()
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(metadata)))
+	for _, p := range [][]byte{metadata, length[:], parquetMagic} {
+		if err := pw.write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pw *parquetWriter) write(p []byte) error {
+	n, err := pw.w.Write(p)
+	pw.offset += int64(n)
+	return err
+}
+
+func (pw *parquetWriter) flushRowGroup() error {
+	group := parquetRowGroup{rows: int64(pw.rows)}
+	for i := range pw.columns {
+		data := pw.values[i].Bytes()
+		header := parquetPageHeader(len(data), pw.rows)
+		chunk := parquetChunk{offset: pw.offset, size: int64(len(header) + len(data))}
+		if err := pw.write(header); err != nil {
+			return err
+		}
+		if err := pw.write(data); err != nil {
+			return err
+		}
+		pw.values[i].Reset()
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.size
+	}
+	pw.rowGroups = append(pw.rowGroups, group)
+	pw.totalRows += group.rows
+	pw.rows = 0
+	return nil
+}
+
+// parquetPageHeader is the PageHeader of a data page of the size holding the
+// values of the rows. Required columns have no definition or repetition
+// levels, so the page only holds the values.
+func parquetPageHeader(size int, rows int) []byte {
+	t := &thriftWriter{}
+	t.begin()
+	t.i32(1, parquetDataPage)
+	t.i32(2, int32(size)) // uncompressed
+	t.i32(3, int32(size)) // compressed
+	t.beginStruct(5)      // DataPageHeader
+	t.i32(1, int32(rows))
+	t.i32(2, parquetPlain)
+	t.i32(3, parquetRLE)
+	t.i32(4, parquetRLE)
+	t.end()
+	t.end()
+	return t.buf.Bytes()
+}
+
+// fileMetadata is the FileMetaData of the file, with the schema and where
+// each column chunk of the row groups was written
+func (pw *parquetWriter) fileMetadata() []byte {
+	t := &thriftWriter{}
+	t.begin()
+	t.i32(1, 1) // version
+	t.list(2, thriftStruct, len(pw.columns)+1)
+	// the root of the schema, with the columns as its children
+	t.begin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(pw.columns)))
+	t.end()
+	for _, c := range pw.columns {
+		t.begin()
+		t.i32(1, c.parquetType())
+		t.i32(3, parquetRequired)
+		t.binary(4, c.name)
+		if !c.integer {
+			t.i32(6, parquetUTF8)
+		}
+		t.end()
+	}
+	t.i64(3, pw.totalRows)
+	t.list(4, thriftStruct, len(pw.rowGroups))
+	for _, group := range pw.rowGroups {
+		t.begin()
+		t.list(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			t.begin()
+			t.i64(2, chunk.offset)
+			t.beginStruct(3) // ColumnMetaData
+			t.i32(1, pw.columns[i].parquetType())
+			t.list(2, thriftI32, 1)
+			t.varint(zigzag(parquetPlain))
+			t.list(3, thriftBinary, 1)
+			t.varint(uint64(len(pw.columns[i].name)))
+			t.buf.WriteString(pw.columns[i].name)
+			t.i32(4, parquetUncompressed)
+			t.i64(5, group.rows)
+			t.i64(6, chunk.size) // uncompressed
+			t.i64(7, chunk.size) // compressed
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, group.size)
+		t.i64(3, group.rows)
+		t.end()
+	}
+	t.binary(6, "quorum-reporting")
+	t.end()
+	return t.buf.Bytes()
+}
+
+func (c column) parquetType() int32 {
+	if c.integer {
+		return parquetInt64
+	}
+	return parquetByteArray
+}
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the Thrift compact protocol, which Parquet
+// uses for its page headers and file metadata. The fields of a struct must be
+// written in order of their IDs.
+type thriftWriter struct {
+	buf bytes.Buffer
+	// the ID of the last field written in each struct being written
+	lastField []int16
+}
+
+// begin starts a struct, either the outermost one or an element of a list
+func (t *thriftWriter) begin() {
+	t.lastField = append(t.lastField, 0)
+}
+
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.lastField = t.lastField[:len(t.lastField)-1]
+}
+
+func (t *thriftWriter) field(id int16, fieldType byte) {
+	last := &t.lastField[len(t.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		t.buf.WriteByte(fieldType)
+		t.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, value int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(value)))
+}
+
+func (t *thriftWriter) i64(id int16, value int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(value))
+}
+
+func (t *thriftWriter) binary(id int16, value string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(value)))
+	t.buf.WriteString(value)
+}
+
+// list starts a list of size elements of the type, which are written next
+func (t *thriftWriter) list(id int16, elementType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elementType)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elementType)
+	t.varint(uint64(size))
+}
+
+func (t *thriftWriter) varint(value uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], value)
+	t.buf.Write(scratch[:n])
+}
+
+func zigzag(value int64) uint64 {
+	return uint64((value << 1) ^ (value >> 63))
+}
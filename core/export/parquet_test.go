@@ -0,0 +1,76 @@
+package export
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata with the current output")
+
+// The golden file has been checked to read back with the Parquet readers of
+// Apache Arrow and parquet-go. After a change to the writer, run
+// `go test -run TestParquetWriter -update` and read the file back with one
+// of them before committing it.
+func TestParquetWriter(t *testing.T) {
+	var buf bytes.Buffer
+	pw, err := newParquetWriter(&buf, []column{{"blockNumber", true}, {"holder", false}})
+	require.Nil(t, err)
+	// two row groups, the second not full
+	pw.rowGroupSize = 3
+	for i := uint64(1); i <= 5; i++ {
+		assert.Nil(t, pw.Write([]interface{}{i, fmt.Sprintf("holder-%d", i)}))
+	}
+	assert.Nil(t, pw.Close())
+	assert.Len(t, pw.rowGroups, 2)
+
+	golden := filepath.Join("testdata", "rows.parquet")
+	if *update {
+		require.Nil(t, ioutil.WriteFile(golden, buf.Bytes(), 0644))
+	}
+	expected, err := ioutil.ReadFile(golden)
+	require.Nil(t, err, "run with -update to create the golden file")
+	assert.Equal(t, expected, buf.Bytes())
+}
+
+func TestParquetWriter_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	pw, err := newParquetWriter(&buf, []column{{"blockNumber", true}})
+	require.Nil(t, err)
+	assert.Nil(t, pw.Close())
+
+	contents := buf.Bytes()
+	assert.Equal(t, parquetMagic, contents[:4])
+	assert.Equal(t, parquetMagic, contents[len(contents)-4:])
+	// version, schema, no rows and no row groups
+	metadata := contents[4 : len(contents)-8]
+	assert.Equal(t, []byte{
+		0x15, 0x02,
+		0x19, 0x2c,
+		0x48, 0x06, 's', 'c', 'h', 'e', 'm', 'a', 0x15, 0x02, 0x00,
+		0x15, 0x04, 0x25, 0x00, 0x18, 0x0b, 'b', 'l', 'o', 'c', 'k', 'N', 'u', 'm', 'b', 'e', 'r', 0x00,
+		0x16, 0x00,
+		0x19, 0x0c,
+		0x28, 0x10, 'q', 'u', 'o', 'r', 'u', 'm', '-', 'r', 'e', 'p', 'o', 'r', 't', 'i', 'n', 'g',
+		0x00,
+	}, metadata)
+	assert.Equal(t, []byte{byte(len(metadata)), 0, 0, 0}, contents[len(contents)-8:len(contents)-4])
+}
+
+func TestThriftWriter(t *testing.T) {
+	tw := &thriftWriter{}
+	tw.begin()
+	tw.i32(1, 1)
+	tw.i64(3, -1)
+	// too far from the last field for its ID to be a delta
+	tw.binary(20, "a")
+	tw.list(21, thriftI32, 20)
+	tw.end()
+	assert.Equal(t, []byte{0x15, 0x02, 0x26, 0x01, 0x08, 0x28, 0x01, 'a', 0x19, 0xf5, 0x14, 0x00}, tw.buf.Bytes())
+}
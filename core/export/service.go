@@ -0,0 +1,272 @@
+package export
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// progressInterval is how many rows are written between job progress updates
+const progressInterval = 1000
+
+var ErrExportRunning = errors.New("an export is already running")
+
+// ExportDB reads the data of a contract to export
+type ExportDB interface {
+	database.ExportDB
+	GetLastFiltered(types.Address) (uint64, error)
+	GetContractABI(types.Address) (string, error)
+	ReadBlock(uint64) (*types.Block, error)
+	GetStorageValues(types.Address, *types.PageOptions) ([]*types.StorageValues, error)
+	GetAllTokenHolders(contract types.Address, block uint64, options *types.TokenQueryOptions) ([]types.Address, error)
+	GetERC20Balance(contract types.Address, holder types.Address, options *types.TokenQueryOptions) (map[uint64]*big.Int, error)
+	AllERC721TokensAtBlock(contract types.Address, block uint64, options *types.TokenQueryOptions) ([]types.ERC721Token, error)
+}
+
+// Service exports the transactions, events, storage history and token
+// balances of a contract in a block range to files in a directory, one file
+// per dataset, as CSV or Parquet. Files are named after the address, dataset
+// and block range, and are written under a temporary name until complete, so
+// a file with the final name is never partial.
+//
+// Exports are tracked as jobs, one running at a time, and a failed export can
+// be retried, writing all its files again.
+type Service struct {
+	db        ExportDB
+	directory string
+
+	jobs *database.JobTracker
+	// the request of each job, to retry it with
+	requests map[string]*types.ExportRequest
+	mux      sync.Mutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewService(db ExportDB, directory string) *Service {
+	return &Service{
+		db:           db,
+		directory:    directory,
+		jobs:         database.NewJobTracker(),
+		requests:     make(map[string]*types.ExportRequest),
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (s *Service) Start() error {
+	log.Info("Starting export service", "directory", s.directory)
+	return nil
+}
+
+// Stop stops a running export at its next row, after which it fails and can
+// be retried.
+func (s *Service) Stop() {
+	close(s.shutdownChan)
+	s.shutdownWg.Wait()
+	log.Info("Export service stopped")
+}
+
+// Export starts writing the files of the request in the background, returning
+// the ID of its job.
+func (s *Service) Export(request *types.ExportRequest) (string, error) {
+	prepared, err := s.prepare(request)
+	if err != nil {
+		return "", err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running() {
+		return "", ErrExportRunning
+	}
+	id := s.jobs.Start(types.ExportJob, prepared.Address)
+	s.jobs.Update(id, func(job *types.Job) {
+		job.StartBlock = prepared.StartBlock
+		job.EndBlock = prepared.EndBlock
+	})
+	s.requests[id] = prepared
+	s.run(id, prepared)
+	return id, nil
+}
+
+// Run writes the files of the request like Export, returning the files once
+// it is done, for one-off exports outside of the running service.
+func (s *Service) Run(request *types.ExportRequest) ([]string, error) {
+	id, err := s.Export(request)
+	if err != nil {
+		return nil, err
+	}
+	s.shutdownWg.Wait()
+	job, err := s.jobs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Error != "" {
+		return nil, errors.New(job.Error)
+	}
+	return job.Files, nil
+}
+
+// Retry runs a failed export again, writing all its files again.
+func (s *Service) Retry(id string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running() {
+		return ErrExportRunning
+	}
+	if _, err := s.jobs.Restart(id); err != nil {
+		return err
+	}
+	s.run(id, s.requests[id])
+	return nil
+}
+
+func (s *Service) GetJobs() []*types.Job {
+	return s.jobs.All()
+}
+
+func (s *Service) GetJob(id string) (*types.Job, error) {
+	return s.jobs.Get(id)
+}
+
+// running reports whether an export is in progress; the lock must be held
+func (s *Service) running() bool {
+	for _, job := range s.jobs.All() {
+		if job.Status == types.JobRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// prepare checks the request, returning a copy with the defaults filled in and
+// the end block no later than the block the address has been filtered to
+func (s *Service) prepare(request *types.ExportRequest) (*types.ExportRequest, error) {
+	if request.Address.IsEmpty() {
+		return nil, errors.New("no address to export")
+	}
+	prepared := *request
+	if prepared.Format == "" {
+		prepared.Format = types.CSVFormat
+	}
+	if prepared.Format != types.CSVFormat && prepared.Format != types.ParquetFormat {
+		return nil, fmt.Errorf("unknown export format %q", prepared.Format)
+	}
+	if len(prepared.Datasets) == 0 {
+		prepared.Datasets = types.ExportDatasets
+	}
+	for _, name := range prepared.Datasets {
+		if _, ok := datasets[name]; !ok {
+			return nil, fmt.Errorf("unknown export dataset %q", name)
+		}
+	}
+
+	lastFiltered, err := s.db.GetLastFiltered(prepared.Address)
+	if err != nil {
+		return nil, err
+	}
+	if prepared.EndBlock == 0 || prepared.EndBlock > lastFiltered {
+		prepared.EndBlock = lastFiltered
+	}
+	if prepared.StartBlock > prepared.EndBlock {
+		return nil, fmt.Errorf("nothing to export: address %s has been filtered to block %d", prepared.Address.String(), lastFiltered)
+	}
+	return &prepared, nil
+}
+
+func (s *Service) run(id string, request *types.ExportRequest) {
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		log.Info("Export started", "job", id, "address", request.Address.String(), "start", request.StartBlock, "end", request.EndBlock, "format", request.Format)
+		s.jobs.Update(id, func(job *types.Job) {
+			job.Files = nil
+		})
+		var err error
+		for _, name := range request.Datasets {
+			var file string
+			if file, err = s.exportDataset(id, request, name); err != nil {
+				break
+			}
+			s.jobs.Update(id, func(job *types.Job) {
+				job.Files = append(job.Files, file)
+			})
+		}
+		if err != nil {
+			log.Error("Export failed", "job", id, "address", request.Address.String(), "err", err)
+		} else {
+			log.Info("Export completed", "job", id, "address", request.Address.String())
+		}
+		s.jobs.Finish(id, err)
+	}()
+}
+
+// exportDataset writes the dataset to its file, returning the file's path
+func (s *Service) exportDataset(id string, request *types.ExportRequest, name string) (string, error) {
+	s.jobs.Update(id, func(job *types.Job) {
+		job.Step = name
+		job.Processed = 0
+	})
+	path := filepath.Join(s.directory, fmt.Sprintf("%s-%s-%d-%d.%s", request.Address.String(), name, request.StartBlock, request.EndBlock, request.Format))
+	partial := path + ".tmp"
+	file, err := os.Create(partial)
+	if err != nil {
+		return "", err
+	}
+	err = s.writeDataset(id, file, request, datasets[name])
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	return path, os.Rename(partial, path)
+}
+
+func (s *Service) writeDataset(id string, w io.Writer, request *types.ExportRequest, ds *dataset) error {
+	buffered := bufio.NewWriter(w)
+	rows, err := newRowWriter(request.Format, buffered, ds.columns)
+	if err != nil {
+		return err
+	}
+	var written uint64
+	err = ds.rows(s.db, request, func(row []interface{}) error {
+		select {
+		case <-s.shutdownChan:
+			return errors.New("export service is shutting down")
+		default:
+		}
+		if err := rows.Write(row); err != nil {
+			return err
+		}
+		written++
+		if written%progressInterval == 0 {
+			s.jobs.Update(id, func(job *types.Job) {
+				job.Processed = written
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	s.jobs.Update(id, func(job *types.Job) {
+		job.Processed = written
+	})
+	return buffered.Flush()
+}
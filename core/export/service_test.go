@@ -0,0 +1,183 @@
+package export
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/core/jobtest"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+const transferABI = `[
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"},
+	{"inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"}
+]`
+
+var (
+	contract = types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	sender   = types.NewAddress("0x9d13c6d3afe1721beef56b55d303b09e021e27ab")
+	receiver = types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+)
+
+// newExportDB has a token contract that was sent a transfer in each of blocks
+// 1 to 3, with its storage set in block 1 and changed in block 2
+func newExportDB(t *testing.T) *memory.MemoryDB {
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{contract}))
+	assert.Nil(t, db.AddTemplate("token", transferABI, ""))
+	assert.Nil(t, db.AssignTemplate(contract, "token"))
+
+	var blocks []*types.Block
+	for number := uint64(1); number <= 3; number++ {
+		tx := &types.Transaction{
+			Hash:        types.NewHash("0x" + big.NewInt(int64(number)).Text(16)),
+			Status:      true,
+			BlockNumber: number,
+			From:        sender,
+			To:          contract,
+			GasUsed:     21000,
+			Data:        types.NewHexData("0xa9059cbb0000000000000000000000001932c48b2bf8102ba33b4a6b545c32236e342f34000000000000000000000000000000000000000000000000000000000000000a"),
+			Timestamp:   1000 + number,
+			Events: []*types.Event{{
+				Address: contract,
+				Topics: []types.Hash{
+					types.NewHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"),
+					types.NewHash("0x0000000000000000000000009d13c6d3afe1721beef56b55d303b09e021e27ab"),
+					types.NewHash("0x0000000000000000000000001932c48b2bf8102ba33b4a6b545c32236e342f34"),
+				},
+				Data:            types.NewHexData("0x000000000000000000000000000000000000000000000000000000000000000a"),
+				BlockNumber:     number,
+				TransactionHash: types.NewHash("0x" + big.NewInt(int64(number)).Text(16)),
+				Timestamp:       1000 + number,
+			}},
+		}
+		assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx}))
+		blocks = append(blocks, &types.Block{Number: number, Timestamp: 1000 + number, Transactions: []types.Hash{tx.Hash}})
+	}
+	assert.Nil(t, db.WriteBlocks(blocks))
+	assert.Nil(t, db.IndexBlocks([]types.Address{contract}, blocks))
+
+	slot := types.NewHash("0x0")
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{contract: {Root: types.NewHash("0x1"), Storage: map[types.Hash]string{slot: "01"}}}, 1))
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{contract: {Root: types.NewHash("0x2"), Storage: map[types.Hash]string{slot: "02"}}}, 2))
+
+	assert.Nil(t, db.RecordNewERC20Balance(contract, sender, 1, big.NewInt(90)))
+	assert.Nil(t, db.RecordNewERC20Balance(contract, receiver, 1, big.NewInt(10)))
+	assert.Nil(t, db.RecordNewERC20Balance(contract, sender, 2, big.NewInt(0)))
+	return db
+}
+
+func readFile(t *testing.T, path string) string {
+	contents, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	return string(contents)
+}
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s := NewService(newExportDB(t), dir)
+	defer s.Stop()
+
+	id, err := s.Export(&types.ExportRequest{Address: contract, StartBlock: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, "export-1", id)
+	job := jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobCompleted, job.Status)
+	assert.EqualValues(t, 2, job.StartBlock)
+	assert.EqualValues(t, 3, job.EndBlock)
+
+	prefix := filepath.Join(dir, "0x1349f3e1b8d71effb47b840594ff27da7e603d17-")
+	assert.Equal(t, []string{
+		prefix + "transactions-2-3.csv",
+		prefix + "events-2-3.csv",
+		prefix + "storage-2-3.csv",
+		prefix + "balances-2-3.csv",
+	}, job.Files)
+
+	assert.Equal(t, "blockNumber,timestamp,timestampISO,hash,index,from,to,status,value,gasUsed,txSig,parameters\n"+
+		`2,1002,1970-01-01T00:16:42Z,0x0000000000000000000000000000000000000000000000000000000000000002,0,0x9d13c6d3afe1721beef56b55d303b09e021e27ab,0x1349f3e1b8d71effb47b840594ff27da7e603d17,true,0,21000,"transfer(address to,uint256 value)","{""to"":""0x1932c48b2bf8102ba33b4a6b545c32236e342f34"",""value"":10}"`+"\n"+
+		`3,1003,1970-01-01T00:16:43Z,0x0000000000000000000000000000000000000000000000000000000000000003,0,0x9d13c6d3afe1721beef56b55d303b09e021e27ab,0x1349f3e1b8d71effb47b840594ff27da7e603d17,true,0,21000,"transfer(address to,uint256 value)","{""to"":""0x1932c48b2bf8102ba33b4a6b545c32236e342f34"",""value"":10}"`+"\n",
+		readFile(t, job.Files[0]))
+	assert.Equal(t, "blockNumber,timestamp,timestampISO,transactionHash,transactionIndex,index,eventSig,parameters\n"+
+		`2,1002,1970-01-01T00:16:42Z,0x0000000000000000000000000000000000000000000000000000000000000002,0,0,"event Transfer(address from,address to,uint256 value)","{""value"":10}"`+"\n"+
+		`3,1003,1970-01-01T00:16:43Z,0x0000000000000000000000000000000000000000000000000000000000000003,0,0,"event Transfer(address from,address to,uint256 value)","{""value"":10}"`+"\n",
+		readFile(t, job.Files[1]))
+	// the storage is as of the block it last changed at by the start of the range
+	assert.Equal(t, "blockNumber,variable,value\n"+
+		"2,0x0000000000000000000000000000000000000000000000000000000000000000,02\n",
+		readFile(t, job.Files[2]))
+	// holders without a balance at the end of the range are left out
+	assert.Equal(t, "blockNumber,holder,tokenId,balance\n"+
+		"3,0x1932c48b2bf8102ba33b4a6b545c32236e342f34,,10\n",
+		readFile(t, job.Files[3]))
+
+	_, err = os.Stat(job.Files[0] + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExport_Parquet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s := NewService(newExportDB(t), dir)
+	defer s.Stop()
+
+	files, err := s.Run(&types.ExportRequest{Address: contract, Datasets: []string{types.EventsDataset}, Format: types.ParquetFormat})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "0x1349f3e1b8d71effb47b840594ff27da7e603d17-events-0-3.parquet")}, files)
+	contents := readFile(t, files[0])
+	assert.Equal(t, "PAR1", contents[:4])
+	assert.Equal(t, "PAR1", contents[len(contents)-4:])
+	job, err := s.GetJob("export-1")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, job.Processed)
+}
+
+func TestExport_InvalidRequest(t *testing.T) {
+	s := NewService(newExportDB(t), "")
+	defer s.Stop()
+
+	_, err := s.Export(&types.ExportRequest{})
+	assert.EqualError(t, err, "no address to export")
+	_, err = s.Export(&types.ExportRequest{Address: contract, Format: "xlsx"})
+	assert.EqualError(t, err, `unknown export format "xlsx"`)
+	_, err = s.Export(&types.ExportRequest{Address: contract, Datasets: []string{"blocks"}})
+	assert.EqualError(t, err, `unknown export dataset "blocks"`)
+	_, err = s.Export(&types.ExportRequest{Address: contract, StartBlock: 4})
+	assert.EqualError(t, err, "nothing to export: address 0x1349f3e1b8d71effb47b840594ff27da7e603d17 has been filtered to block 3")
+	assert.Empty(t, s.GetJobs())
+}
+
+func TestExport_Retry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s := NewService(newExportDB(t), filepath.Join(dir, "missing"))
+	defer s.Stop()
+
+	// fails while the directory doesn't exist, without leaving a partial file
+	id, err := s.Export(&types.ExportRequest{Address: contract, Datasets: []string{types.StorageDataset}})
+	assert.Nil(t, err)
+	job := jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobFailed, job.Status)
+	assert.Equal(t, types.StorageDataset, job.Step)
+	assert.Empty(t, job.Files)
+
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "missing"), 0755))
+	assert.Nil(t, s.Retry(id))
+	job = jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobCompleted, job.Status)
+	assert.Len(t, job.Files, 1)
+	assert.Equal(t, "blockNumber,variable,value\n"+
+		"1,0x0000000000000000000000000000000000000000000000000000000000000000,01\n"+
+		"2,0x0000000000000000000000000000000000000000000000000000000000000000,02\n",
+		readFile(t, job.Files[0]))
+}
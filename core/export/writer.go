@@ -0,0 +1,66 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// column is a field of a dataset, holding either unsigned integers or strings
+type column struct {
+	name    string
+	integer bool
+}
+
+// rowWriter writes the rows of a dataset to a file, with the values of each
+// row in the order of the columns
+type rowWriter interface {
+	Write(row []interface{}) error
+	// Close writes out any buffered rows, without closing the file
+	Close() error
+}
+
+func newRowWriter(format string, w io.Writer, columns []column) (rowWriter, error) {
+	switch format {
+	case types.CSVFormat:
+		return newCSVWriter(w, columns)
+	case types.ParquetFormat:
+		return newParquetWriter(w, columns)
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// csvWriter writes the rows as CSV, with a header of the column names
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer, columns []column) (*csvWriter, error) {
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+	cw := &csvWriter{w: csv.NewWriter(w), record: make([]string, len(columns))}
+	return cw, cw.w.Write(header)
+}
+
+func (cw *csvWriter) Write(row []interface{}) error {
+	for i, value := range row {
+		switch value := value.(type) {
+		case uint64:
+			cw.record[i] = strconv.FormatUint(value, 10)
+		case string:
+			cw.record[i] = value
+		}
+	}
+	return cw.w.Write(cw.record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
@@ -10,6 +10,8 @@ import (
 
 var ContractExtensionTopic = types.NewHash("0x67a92539f3cbd7c5a9b36c23c0e2beceb27d2e1b3cd8eda02c623689267ae71e")
 
+// ContractCreationFilter records the transactions that created the indexed
+// contracts, and the blocks that they self-destructed at
 type ContractCreationFilter struct {
 	db           FilterServiceDB
 	quorumClient client.Client
@@ -32,6 +34,7 @@ func (ccFilter *ContractCreationFilter) ProcessBlocks(indexedAddresses []types.A
 	}
 
 	allDeployedContacts := make(map[types.Hash][]types.Address)
+	destroyedContracts := make(map[types.Address]uint64)
 	for _, block := range blocks {
 		for _, txHash := range block.Transactions {
 			tx, err := ccFilter.db.ReadTransaction(txHash)
@@ -47,11 +50,35 @@ func (ccFilter *ContractCreationFilter) ProcessBlocks(indexedAddresses []types.A
 			if len(filteredDeployed) != 0 {
 				allDeployedContacts[tx.Hash] = filteredDeployed
 			}
+
+			for _, address := range findDestroyedContracts(tx) {
+				if _, ok := destroyedContracts[address]; addrMap[address] && !ok {
+					destroyedContracts[address] = block.Number
+				}
+			}
 		}
 	}
 
 	//save all the deployed contract updates
-	return ccFilter.db.SetContractCreationTransaction(allDeployedContacts)
+	if err := ccFilter.db.SetContractCreationTransaction(allDeployedContacts); err != nil {
+		return err
+	}
+	if len(destroyedContracts) == 0 {
+		return nil
+	}
+	return ccFilter.db.SetContractsDestroyed(destroyedContracts)
+}
+
+// findDestroyedContracts lists the contracts that self-destructed in the
+// internal calls of the transaction
+func findDestroyedContracts(tx *types.Transaction) []types.Address {
+	destroyed := make([]types.Address, 0)
+	for _, internalCall := range tx.InternalCalls {
+		if internalCall.Type == "SELFDESTRUCT" {
+			destroyed = append(destroyed, internalCall.From)
+		}
+	}
+	return destroyed
 }
 
 func (ccFilter *ContractCreationFilter) findDeployedContracts(tx *types.Transaction) ([]types.Address, error) {
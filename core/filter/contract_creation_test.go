@@ -105,6 +105,34 @@ func TestContractCreationFilter_ProcessBlocks(t *testing.T) {
 	}
 }
 
+func TestContractCreationFilter_ProcessBlocks_SelfDestruct(t *testing.T) {
+	destroyed := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	notIndexed := types.NewAddress("0x9d13c6d3afe1721beef56b55d303b09e021e27ab")
+	tx := &types.Transaction{
+		Hash:        types.NewHash("0x01"),
+		BlockNumber: 10,
+		InternalCalls: []*types.InternalCall{
+			{Type: "CALL", From: notIndexed, To: destroyed},
+			{Type: "SELFDESTRUCT", From: destroyed, To: notIndexed},
+			{Type: "SELFDESTRUCT", From: notIndexed, To: destroyed},
+		},
+	}
+	db := memory.NewMemoryDB()
+	_ = db.AddAddresses([]types.Address{destroyed, notIndexed})
+	_ = db.WriteTransactions([]*types.Transaction{tx})
+	ccFilter := NewContractCreationFilter(db, client.NewStubQuorumClient(nil, nil))
+
+	block := &types.Block{Number: 10, Transactions: []types.Hash{tx.Hash}}
+	assert.Nil(t, ccFilter.ProcessBlocks([]types.Address{destroyed}, []*types.Block{block}))
+
+	destroyedAt, err := db.GetContractDestroyed(destroyed)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 10, destroyedAt)
+	destroyedAt, err = db.GetContractDestroyed(notIndexed)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, destroyedAt)
+}
+
 func TestContractCreationFilter_ProcessBlocks_NonIndexedContracts(t *testing.T) {
 	testAddresses := []types.Address{
 		"1349f3e1b8d71effb47b840594ff27da7e603d17", "9d13c6d3afe1721beef56b55d303b09e021e27ab",
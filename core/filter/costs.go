@@ -0,0 +1,163 @@
+package filter
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// throttledCheckpoint is the checkpoint the throttled contracts are stored
+// under, so every instance filtering contracts leaves them out
+const throttledCheckpoint = "throttled"
+
+// contractCosts tracks the processing time and node calls filtering each
+// contract takes, since the service started, and which contracts are
+// throttled
+type contractCosts struct {
+	mux       sync.Mutex
+	costs     map[types.Address]*types.ContractCost
+	throttled map[types.Address]bool
+}
+
+func newContractCosts() *contractCosts {
+	return &contractCosts{
+		costs:     make(map[types.Address]*types.ContractCost),
+		throttled: make(map[types.Address]bool),
+	}
+}
+
+// cost returns the costs of the address, adding it if it has none; the lock
+// must be held
+func (c *contractCosts) cost(address types.Address) *types.ContractCost {
+	cost, ok := c.costs[address]
+	if !ok {
+		cost = &types.ContractCost{Address: address}
+		c.costs[address] = cost
+	}
+	return cost
+}
+
+// addStorage records the node calls and time taken to read the storage of
+// the address at a block
+func (c *contractCosts) addStorage(address types.Address, nodeCalls uint64, elapsed time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	cost := c.cost(address)
+	cost.NodeCalls += nodeCalls
+	cost.ProcessingSeconds += elapsed.Seconds()
+}
+
+// addBatch records the blocks filtered for the addresses, sharing the time
+// taken to index them equally between them
+func (c *contractCosts) addBatch(addresses []types.Address, blocks int, elapsed time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, address := range addresses {
+		cost := c.cost(address)
+		cost.BlocksFiltered += uint64(blocks)
+		cost.ProcessingSeconds += elapsed.Seconds() / float64(len(addresses))
+	}
+}
+
+func (c *contractCosts) all() []*types.ContractCost {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	all := make([]*types.ContractCost, 0, len(c.costs))
+	for address, cost := range c.costs {
+		copied := *cost
+		copied.Throttled = c.throttled[address]
+		all = append(all, &copied)
+	}
+	for address := range c.throttled {
+		if _, ok := c.costs[address]; !ok {
+			all = append(all, &types.ContractCost{Address: address, Throttled: true})
+		}
+	}
+	return all
+}
+
+func (c *contractCosts) setThrottled(addresses []types.Address) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.throttled = make(map[types.Address]bool, len(addresses))
+	for _, address := range addresses {
+		c.throttled[address] = true
+	}
+}
+
+func (c *contractCosts) isThrottled(address types.Address) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.throttled[address]
+}
+
+// ContractCosts returns the processing time, node calls and blocks filtering
+// each contract has taken since the service started.
+func (fs *FilterService) ContractCosts() []*types.ContractCost {
+	return fs.costs.all()
+}
+
+// ThrottleContract leaves the contract out of filtering until it is
+// unthrottled, so it stops consuming node calls and processing time. Once
+// unthrottled, it catches up on the blocks it missed. The throttled contracts
+// are stored, so they stay throttled across restarts, and are left out by
+// every instance filtering contracts.
+func (fs *FilterService) ThrottleContract(address types.Address, throttled bool) error {
+	addresses, err := fs.throttledContracts()
+	if err != nil {
+		return err
+	}
+	kept := make([]types.Address, 0, len(addresses)+1)
+	for _, throttledAddress := range addresses {
+		if throttledAddress != address {
+			kept = append(kept, throttledAddress)
+		}
+	}
+	if throttled {
+		kept = append(kept, address)
+	}
+	stored, err := json.Marshal(kept)
+	if err != nil {
+		return err
+	}
+	if err := fs.db.SetCheckpoint(throttledCheckpoint, string(stored)); err != nil {
+		return err
+	}
+	fs.costs.setThrottled(kept)
+	if throttled {
+		log.Info("Contract throttled", "address", address.Hex())
+	} else {
+		log.Info("Contract unthrottled", "address", address.Hex())
+	}
+	return nil
+}
+
+// loadThrottled reads the throttled contracts, which may have been changed by
+// another instance
+func (fs *FilterService) loadThrottled() error {
+	addresses, err := fs.throttledContracts()
+	if err != nil {
+		return err
+	}
+	fs.costs.setThrottled(addresses)
+	return nil
+}
+
+func (fs *FilterService) throttledContracts() ([]types.Address, error) {
+	stored, err := fs.db.GetCheckpoint(throttledCheckpoint)
+	if err == database.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var addresses []types.Address
+	if err := json.Unmarshal([]byte(stored), &addresses); err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
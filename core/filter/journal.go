@@ -0,0 +1,151 @@
+package filter
+
+import (
+	"math/big"
+	"time"
+
+	"quorumengineering/quorum-report/core/filter/token"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// maxJournalErrors is the most failed attempts kept for a block until it is
+// filtered, so a batch that keeps failing doesn't grow without bound
+const maxJournalErrors = 10
+
+// blockCounts is what was indexed in a block for the contracts of a batch
+type blockCounts struct {
+	transactions int
+	events       int
+	tokenRecords int
+}
+
+// blockRecorder counts the token records written through it for the block
+// being processed, and keeps the transactions of the block read through it, so
+// the token processors share a single read of each and the journal can count
+// them without reading them again
+type blockRecorder struct {
+	token.TokenFilterDatabase
+	count        int
+	transactions map[types.Hash]*types.Transaction
+}
+
+// startBlock clears what was recorded for the last block
+func (c *blockRecorder) startBlock() {
+	c.count = 0
+	c.transactions = make(map[types.Hash]*types.Transaction)
+}
+
+// blockCounts returns what was indexed for the addresses in the block being
+// processed
+func (c *blockRecorder) blockCounts(addresses map[types.Address]bool) *blockCounts {
+	counts := &blockCounts{tokenRecords: c.count}
+	for _, tx := range c.transactions {
+		if involvesAddresses(tx, addresses) {
+			counts.transactions++
+		}
+		for _, event := range tx.Events {
+			if addresses[event.Address] {
+				counts.events++
+			}
+		}
+	}
+	return counts
+}
+
+func (c *blockRecorder) ReadTransaction(hash types.Hash) (*types.Transaction, error) {
+	if tx, ok := c.transactions[hash]; ok {
+		return tx, nil
+	}
+	tx, err := c.TokenFilterDatabase.ReadTransaction(hash)
+	if err != nil {
+		return nil, err
+	}
+	if c.transactions != nil {
+		c.transactions[hash] = tx
+	}
+	return tx, nil
+}
+
+func (c *blockRecorder) RecordNewERC20Balance(contract types.Address, holder types.Address, block uint64, amount *big.Int) error {
+	if err := c.TokenFilterDatabase.RecordNewERC20Balance(contract, holder, block, amount); err != nil {
+		return err
+	}
+	c.count++
+	return nil
+}
+
+func (c *blockRecorder) RecordERC20Allowance(contract types.Address, owner types.Address, spender types.Address, block uint64, amount *big.Int) error {
+	if err := c.TokenFilterDatabase.RecordERC20Allowance(contract, owner, spender, block, amount); err != nil {
+		return err
+	}
+	c.count++
+	return nil
+}
+
+func (c *blockRecorder) RecordERC721Token(contract types.Address, holder types.Address, block uint64, tokenId *big.Int) error {
+	if err := c.TokenFilterDatabase.RecordERC721Token(contract, holder, block, tokenId); err != nil {
+		return err
+	}
+	c.count++
+	return nil
+}
+
+func (c *blockRecorder) RecordNewERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, block uint64, amount *big.Int) error {
+	if err := c.TokenFilterDatabase.RecordNewERC1155Balance(contract, holder, tokenId, block, amount); err != nil {
+		return err
+	}
+	c.count++
+	return nil
+}
+
+// recordFailure keeps the error for each block in the batch, to be journaled
+// once the block is filtered
+func (fs *FilterService) recordFailure(batch IndexBatch, err error) {
+	for _, block := range batch.blocks {
+		if len(fs.failures[block.Number]) < maxJournalErrors {
+			fs.failures[block.Number] = append(fs.failures[block.Number], err.Error())
+		}
+	}
+}
+
+// writeJournal records a filter stage entry for each block in the batch. The
+// blocks share the duration of the batch, as they are filtered together.
+// Failing to write the journal doesn't fail the batch, as the blocks have been
+// filtered.
+func (fs *FilterService) writeJournal(batch IndexBatch, started time.Time, counts map[uint64]*blockCounts) {
+	finished := time.Now()
+	entries := make([]*types.JournalEntry, 0, len(batch.blocks))
+	for _, block := range batch.blocks {
+		entry := &types.JournalEntry{
+			BlockNumber: block.Number,
+			Stage:       types.FilterStage,
+			Timestamp:   uint64(finished.Unix()),
+			Duration:    uint64(finished.Sub(started) / time.Millisecond),
+			Errors:      fs.failures[block.Number],
+		}
+		delete(fs.failures, block.Number)
+		if c, ok := counts[block.Number]; ok {
+			entry.Transactions, entry.Events, entry.TokenRecords = c.transactions, c.events, c.tokenRecords
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := fs.db.WriteJournalEntries(entries); err != nil {
+		log.Warn("Writing processing journal failed", "start", batch.blocks[0].Number, "end", batch.blocks[len(batch.blocks)-1].Number, "err", err)
+	}
+}
+
+// involvesAddresses returns whether the transaction is to, creates, or
+// internally calls one of the addresses
+func involvesAddresses(tx *types.Transaction, addresses map[types.Address]bool) bool {
+	if addresses[tx.To] || addresses[tx.CreatedContract] {
+		return true
+	}
+	for _, call := range tx.InternalCalls {
+		if addresses[call.To] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package filter
+
+import (
+	"sync"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// headLaneWindow is how many of the newest blocks are filtered first when the
+// filter service is further behind than it, with the blocks before them left
+// to the backfill lane
+const headLaneWindow = 1000
+
+// backfillLaneChunkSize is how many blocks the backfill lane filters at a
+// time, which is the longest the head lane waits for it
+const backfillLaneChunkSize = 100
+
+// laneScheduler lets the head and backfill lanes filter one at a time, with
+// the head lane going first whenever it is waiting. It also keeps the
+// progress of the head lane while it is ahead of the last filtered block.
+type laneScheduler struct {
+	mux         sync.Mutex
+	cond        *sync.Cond
+	busy        bool
+	headWaiting bool
+
+	// the first block the head lane filtered ahead, and the block it has
+	// filtered up to, both 0 while it isn't ahead
+	aheadFrom    uint64
+	headFiltered uint64
+}
+
+func newLaneScheduler() *laneScheduler {
+	s := &laneScheduler{}
+	s.cond = sync.NewCond(&s.mux)
+	return s
+}
+
+// acquireHead waits for the chunk the backfill lane is filtering, if any,
+// and keeps the backfill lane from starting another until released
+func (s *laneScheduler) acquireHead() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.headWaiting = true
+	for s.busy {
+		s.cond.Wait()
+	}
+	s.busy, s.headWaiting = true, false
+}
+
+// acquireBackfill waits until the head lane is neither filtering nor waiting
+// to
+func (s *laneScheduler) acquireBackfill() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for s.busy || s.headWaiting {
+		s.cond.Wait()
+	}
+	s.busy = true
+}
+
+func (s *laneScheduler) release() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.busy = false
+	s.cond.Broadcast()
+}
+
+func (s *laneScheduler) ahead() (uint64, uint64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.aheadFrom, s.headFiltered
+}
+
+func (s *laneScheduler) setAhead(aheadFrom uint64, headFiltered uint64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.aheadFrom, s.headFiltered = aheadFrom, headFiltered
+}
+
+// HeadFiltered returns the block new blocks have been filtered up to, which
+// is ahead of LastFiltered while older blocks are filtered in the background,
+// and false if the filter loop hasn't found it yet
+func (fs *FilterService) HeadFiltered() (uint64, bool) {
+	lastFiltered, known := fs.LastFiltered()
+	if _, headFiltered := fs.lanes.ahead(); headFiltered > lastFiltered {
+		return headFiltered, known
+	}
+	return lastFiltered, known
+}
+
+// filterNewBlocks is the head lane, filtering the blocks up to current. If
+// there are more than the head lane window to filter, only the newest are
+// filtered, ahead of the last filtered block, and the backfill lane is woken
+// to filter the blocks before them. Returns false if the service is shutting
+// down.
+func (fs *FilterService) filterNewBlocks(current uint64) bool {
+	fs.lanes.acquireHead()
+	defer fs.lanes.release()
+
+	lastFilteredAll, lastFiltered, err := fs.getLastFiltered(current)
+	if err != nil {
+		log.Warn("Fetching last filtered failed", "err", err)
+		return true
+	}
+	fs.setLastFiltered(lastFiltered)
+
+	aheadFrom, headFiltered := fs.lanes.ahead()
+	if aheadFrom != 0 && current < headFiltered {
+		// blocks the head lane filtered have been rolled back
+		headFiltered = current
+		if current < aheadFrom {
+			aheadFrom, headFiltered = 0, 0
+		}
+	}
+	if aheadFrom == 0 && current > lastFiltered+headLaneWindow {
+		aheadFrom, headFiltered = current-headLaneWindow+1, current-headLaneWindow
+		log.Info("Filtering the newest blocks first, with older blocks in the background", "lastFiltered", lastFiltered, "from", aheadFrom, "current", current)
+	}
+	fs.lanes.setAhead(aheadFrom, headFiltered)
+	if aheadFrom != 0 || fs.refiltersPending() {
+		fs.wakeBackfillLane()
+	}
+	if aheadFrom == 0 {
+		return fs.filterUpTo(lastFilteredAll, lastFiltered, current, false)
+	}
+	return fs.filterUpTo(lastFilteredAll, headFiltered, current, true)
+}
+
+func (fs *FilterService) wakeBackfillLane() {
+	select {
+	case fs.backfillWake <- struct{}{}:
+	default:
+	}
+}
+
+// filterUpTo filters the blocks after from up to current, 1000 at a time,
+// stopping early to pause. Blocks filtered ahead are recorded as the progress
+// of the head lane. Returns false if the service is shutting down.
+func (fs *FilterService) filterUpTo(lastFilteredAll map[types.Address]uint64, from uint64, current uint64, ahead bool) bool {
+	for current > from {
+		//check if we are shutting down or pausing before next round
+		select {
+		case <-fs.shutdownChan:
+			return false
+		case request := <-fs.pauseChan:
+			// addresses may have been added while paused, so the blocks are
+			// left to the next tick
+			return fs.pauseFiltering(request)
+		default:
+		}
+		//index 1000 blocks at a time
+		//TODO: make configurable
+		endBlock := from + 1000
+		if endBlock > current {
+			endBlock = current
+		}
+		err := fs.indexRange(lastFilteredAll, from+1, endBlock, true, ahead)
+		if err == errShuttingDown {
+			return false
+		}
+		if err != nil {
+			log.Warn("Index block failed", "lastFiltered", from, "ahead", ahead, "err", err)
+			return true
+		}
+		from = endBlock
+		if ahead {
+			aheadFrom, _ := fs.lanes.ahead()
+			fs.lanes.setAhead(aheadFrom, from)
+		} else {
+			fs.setLastFiltered(from)
+		}
+	}
+	return true
+}
+
+// runBackfillLane filters the contracts waiting to be filtered again, and then
+// the blocks before those the head lane filtered ahead, oldest first,
+// whenever it is woken, until it catches up with the head lane. The last
+// filtered block of each address is only raised by this lane
+// while the head lane is ahead, so after a restart filtering carries on from
+// the start of the blocks it hadn't reached.
+func (fs *FilterService) runBackfillLane() {
+	defer fs.shutdownWg.Done()
+	for {
+		select {
+		case <-fs.backfillWake:
+		case <-fs.shutdownChan:
+			return
+		}
+		if err := fs.runRefilters(); err == errShuttingDown {
+			return
+		} else if err != nil {
+			// tried again when the head lane next wakes the lane
+			log.Warn("Filtering contracts again failed", "err", err)
+		}
+		for {
+			done, err := fs.backfillChunk()
+			if err == errShuttingDown {
+				return
+			}
+			if err != nil {
+				// tried again when the head lane next wakes the lane
+				log.Warn("Filtering older blocks failed", "err", err)
+				break
+			}
+			if done {
+				break
+			}
+		}
+	}
+}
+
+// backfillChunk filters the next chunk of blocks after the last filtered
+// block, returning true once it has reached the head lane. The blocks the head
+// lane filtered ahead are filtered again to raise the last filtered block past
+// them, without notifying their events a second time.
+func (fs *FilterService) backfillChunk() (bool, error) {
+	fs.lanes.acquireBackfill()
+	defer fs.lanes.release()
+	select {
+	case <-fs.shutdownChan:
+		return false, errShuttingDown
+	default:
+	}
+
+	aheadFrom, headFiltered := fs.lanes.ahead()
+	if aheadFrom == 0 {
+		return true, nil
+	}
+	lastFilteredAll, lastFiltered, err := fs.getLastFiltered(headFiltered)
+	if err != nil {
+		return false, err
+	}
+	fs.setLastFiltered(lastFiltered)
+	if lastFiltered >= headFiltered {
+		fs.lanes.setAhead(0, 0)
+		log.Info("Older blocks filtered, caught up with the newest blocks", "lastFiltered", lastFiltered)
+		return true, nil
+	}
+
+	end := lastFiltered + backfillLaneChunkSize
+	if end > headFiltered {
+		end = headFiltered
+	}
+	notify := lastFiltered+1 < aheadFrom
+	if notify && end >= aheadFrom {
+		end = aheadFrom - 1
+	}
+	if err := fs.indexRange(lastFilteredAll, lastFiltered+1, end, notify, false); err != nil {
+		return false, err
+	}
+	fs.setLastFiltered(end)
+	return false, nil
+}
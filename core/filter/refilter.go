@@ -0,0 +1,171 @@
+package filter
+
+import (
+	"encoding/json"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// refilterCheckpoint is the checkpoint the contracts waiting to be filtered
+// again are stored under, so they are still filtered after a restart
+const refilterCheckpoint = "refilter"
+
+// refilterRequest is a contract waiting to be filtered again from From up to
+// To, the block it had been filtered to when asked
+type refilterRequest struct {
+	Address types.Address `json:"address"`
+	From    uint64        `json:"from"`
+	To      uint64        `json:"to"`
+}
+
+// RefilterContract queues the blocks of one address from the given block up
+// to the block it has been filtered to, to be filtered again by the backfill
+// lane, recording the address's events, storage and tokens with its current
+// template. As with a reindex, what was indexed for the blocks is replaced,
+// and their events aren't sent to the notifier again. Later blocks are
+// filtered with the current template anyway.
+func (fs *FilterService) RefilterContract(address types.Address, from uint64) error {
+	addresses, err := fs.db.GetAddresses()
+	if err != nil {
+		return err
+	}
+	registered := false
+	for _, registeredAddress := range addresses {
+		registered = registered || registeredAddress == address
+	}
+	if !registered {
+		return database.ErrNotFound
+	}
+	if from == 0 {
+		from = 1
+	}
+	to, err := fs.db.GetLastFiltered(address)
+	if err != nil {
+		return err
+	}
+	if from > to {
+		log.Info("Address not yet filtered up to the block to refilter from", "address", address.String(), "start", from, "lastFiltered", to)
+		return nil
+	}
+
+	fs.refilterMux.Lock()
+	if err := fs.loadRefilters(); err != nil {
+		fs.refilterMux.Unlock()
+		return err
+	}
+	fs.refilters = append(fs.refilters, &refilterRequest{Address: address, From: from, To: to})
+	err = fs.storeRefilters()
+	fs.refilterMux.Unlock()
+	if err != nil {
+		return err
+	}
+	log.Info("Refiltering address", "address", address.String(), "start", from, "end", to)
+	fs.wakeBackfillLane()
+	return nil
+}
+
+// runRefilters filters the contracts waiting to be filtered again, oldest
+// request first, a chunk at a time, taking turns with the head lane. The
+// progress of each is stored after each chunk.
+func (fs *FilterService) runRefilters() error {
+	for {
+		fs.refilterMux.Lock()
+		if err := fs.loadRefilters(); err != nil {
+			fs.refilterMux.Unlock()
+			return err
+		}
+		if len(fs.refilters) == 0 {
+			fs.refilterMux.Unlock()
+			return nil
+		}
+		request := *fs.refilters[0]
+		fs.refilterMux.Unlock()
+
+		end := request.From + backfillLaneChunkSize - 1
+		if end > request.To {
+			end = request.To
+		}
+		if err := fs.refilterChunk(request, end); err != nil {
+			return err
+		}
+
+		fs.refilterMux.Lock()
+		if end >= request.To {
+			fs.refilters = fs.refilters[1:]
+			log.Info("Refiltered address", "address", request.Address.String(), "start", request.From, "end", request.To)
+		} else {
+			fs.refilters[0].From = end + 1
+		}
+		err := fs.storeRefilters()
+		fs.refilterMux.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// refilterChunk reindexes the blocks of the request up to end
+func (fs *FilterService) refilterChunk(request refilterRequest, end uint64) error {
+	fs.lanes.acquireBackfill()
+	defer fs.lanes.release()
+	select {
+	case <-fs.shutdownChan:
+		return errShuttingDown
+	default:
+	}
+
+	batches, err := fs.backfillBatches(map[types.Address]uint64{request.Address: request.To}, request.From, end)
+	if err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		if err := fs.processBatch(batch, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refiltersPending checks whether any contracts are waiting to be filtered
+// again
+func (fs *FilterService) refiltersPending() bool {
+	fs.refilterMux.Lock()
+	defer fs.refilterMux.Unlock()
+	if err := fs.loadRefilters(); err != nil {
+		log.Warn("Loading the contracts to refilter failed", "err", err)
+		return false
+	}
+	return len(fs.refilters) > 0
+}
+
+// loadRefilters reads the stored requests the first time they are needed;
+// the lock must be held
+func (fs *FilterService) loadRefilters() error {
+	if fs.refiltersLoaded {
+		return nil
+	}
+	stored, err := fs.db.GetCheckpoint(refilterCheckpoint)
+	if err == database.ErrNotFound {
+		fs.refiltersLoaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(stored), &fs.refilters); err != nil {
+		return err
+	}
+	fs.refiltersLoaded = true
+	return nil
+}
+
+// storeRefilters writes the requests still waiting; the lock must be held
+func (fs *FilterService) storeRefilters() error {
+	stored, err := json.Marshal(fs.refilters)
+	if err != nil {
+		return err
+	}
+	return fs.db.SetCheckpoint(refilterCheckpoint, string(stored))
+}
@@ -1,6 +1,8 @@
 package filter
 
 import (
+	"context"
+	"errors"
 	"math/big"
 	"sync"
 	"time"
@@ -14,22 +16,79 @@ import (
 //TODO: clean this type up, find a better way to pass specific methods to needed pieces
 type FilterServiceDB interface {
 	RecordNewERC20Balance(contract types.Address, holder types.Address, block uint64, amount *big.Int) error
+	RecordERC20Allowance(contract types.Address, owner types.Address, spender types.Address, block uint64, amount *big.Int) error
 	RecordERC721Token(contract types.Address, holder types.Address, block uint64, tokenId *big.Int) error
+	RecordNewERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, block uint64, amount *big.Int) error
 
 	ReadTransaction(types.Hash) (*types.Transaction, error)
 	ReadBlock(uint64) (*types.Block, error)
 	GetLastPersistedBlockNumber() (uint64, error)
 	GetLastFiltered(types.Address) (uint64, error)
+	ResetLastFiltered(types.Address, uint64) error
+	GetTerminalBlock(types.Address) (uint64, error)
 
 	GetAddresses() ([]types.Address, error)
 	GetContractABI(types.Address) (string, error)
+	GetStorageLayout(types.Address) (string, error)
 
 	IndexBlocks([]types.Address, []*types.Block) error
+	IndexBlocksAhead([]types.Address, []*types.Block) error
+	ReindexBlocks([]types.Address, []*types.Block) error
 	IndexStorage(map[types.Address]*types.AccountState, uint64) error
 	SetContractCreationTransaction(map[types.Hash][]types.Address) error
+	SetContractsDestroyed(map[types.Address]uint64) error
+	GetContractDestroyed(types.Address) (uint64, error)
+
+	WriteJournalEntries([]*types.JournalEntry) error
+
+	GetCheckpoint(service string) (string, error)
+	SetCheckpoint(service string, checkpoint string) error
+}
+
+// backfillChunkSize is how many blocks are read at a time when backfilling
+const backfillChunkSize = 1000
+
+var errShuttingDown = errors.New("filter service is shutting down")
+
+// EventNotifier is told about the blocks indexed for the addresses, once their
+// events are stored, so it can pass them on
+type EventNotifier interface {
+	Notify([]types.Address, []*types.Block) error
+}
+
+// EventNotifiers tells each of the notifiers about the blocks, returning the
+// first error once all have been told
+type EventNotifiers []EventNotifier
+
+func (notifiers EventNotifiers) Notify(addresses []types.Address, blocks []*types.Block) error {
+	var first error
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(addresses, blocks); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// ContractShard decides which of the registered contracts the instance
+// filters, when several instances share them
+type ContractShard interface {
+	Owns(types.Address) bool
+}
+
+// pauseRequest asks for filtering to stop until resume is closed. paused is
+// closed once the batch being filtered is done.
+type pauseRequest struct {
+	paused chan struct{}
+	resume <-chan struct{}
 }
 
 // FilterService filters transactions and storage based on registered address list.
+//
+// New blocks are filtered by the head lane. When the service is far behind,
+// such as when catching up after downtime, the head lane filters only the
+// newest blocks, so live data stays current, and the backfill lane filters the
+// older blocks in the background, giving way to the head lane between chunks.
 type FilterService struct {
 	db FilterServiceDB
 
@@ -37,27 +96,93 @@ type FilterService struct {
 	contractCreationFilter *ContractCreationFilter
 	erc20processor         *token.ERC20Processor
 	erc721processor        *token.ERC721Processor
+	erc1155processor       *token.ERC1155Processor
+	notifier               EventNotifier
+	// if set, only the contracts it owns are filtered by the filter loop
+	shard ContractShard
+
+	// batches from the filter loop and backfills are processed one at a time
+	batchMux sync.Mutex
+	// for the processing journal, what is recorded for the block being
+	// processed, and the failed attempts to filter each block
+	recorder *blockRecorder
+	failures map[uint64][]string
+	// what filtering each contract costs, and the contracts left out
+	costs *contractCosts
+
+	// the block every address has been filtered up to, as of the last tick
+	lastFilteredMux   sync.RWMutex
+	lastFiltered      uint64
+	lastFilteredKnown bool
+
+	// the head and backfill lanes take turns to filter, and the backfill lane
+	// is woken whenever the head lane is ahead or contracts are waiting to be
+	// filtered again
+	lanes        *laneScheduler
+	backfillWake chan struct{}
+
+	// the contracts waiting to be filtered again by the backfill lane, read
+	// from the database when first needed
+	refilters       []*refilterRequest
+	refiltersLoaded bool
+	refilterMux     sync.Mutex
+
+	// requests to pause filtering, until resumed
+	pauseChan chan pauseRequest
 
 	// To check we have actually shut down before returning
 	shutdownChan chan struct{}
 	shutdownWg   sync.WaitGroup
+	// closed once shutdown has run out of time, to give up on the batch
+	// being filtered between its writes
+	abortChan chan struct{}
 }
 
-func NewFilterService(db FilterServiceDB, client client.Client) *FilterService {
+// NewFilterService creates a filter service, which tells the notifier about
+// indexed blocks if it isn't nil
+func NewFilterService(db FilterServiceDB, client client.Client, notifier EventNotifier) *FilterService {
+	recorder := &blockRecorder{TokenFilterDatabase: db}
+	costs := newContractCosts()
+	storageFilter := NewStorageFilter(db, client)
+	storageFilter.costs = costs
 	return &FilterService{
 		db:                     db,
-		storageFilter:          NewStorageFilter(db, client),
+		storageFilter:          storageFilter,
 		contractCreationFilter: NewContractCreationFilter(db, client),
+		lanes:                  newLaneScheduler(),
+		backfillWake:           make(chan struct{}, 1),
+		pauseChan:              make(chan pauseRequest),
 		shutdownChan:           make(chan struct{}),
-		erc20processor:         token.NewERC20Processor(db, client),
-		erc721processor:        token.NewERC721Processor(db),
+		abortChan:              make(chan struct{}),
+		erc20processor:         token.NewERC20Processor(recorder, client),
+		erc721processor:        token.NewERC721Processor(recorder),
+		erc1155processor:       token.NewERC1155Processor(recorder, client),
+		notifier:               notifier,
+		recorder:               recorder,
+		failures:               make(map[uint64][]string),
+		costs:                  costs,
 	}
 }
 
+// SetShard limits the filter loop to the contracts of the shard, leaving the
+// others to the instances owning them. Backfills and reindexes filter all the
+// contracts they are asked to.
+func (fs *FilterService) SetShard(shard ContractShard) {
+	fs.shard = shard
+}
+
+// Drain waits for the batch being filtered, if any, so once a contract is no
+// longer owned by the shard, nothing more is written for it.
+func (fs *FilterService) Drain() {
+	fs.batchMux.Lock()
+	defer fs.batchMux.Unlock()
+}
+
 func (fs *FilterService) Start() error {
 	log.Info("Starting filter service")
 
-	fs.shutdownWg.Add(1)
+	fs.shutdownWg.Add(2)
+	go fs.runBackfillLane()
 
 	go func() {
 		// Filter tick every 2 seconds to index transactions/ storage
@@ -73,30 +198,16 @@ func (fs *FilterService) Start() error {
 					continue
 				}
 				log.Debug("Last persisted block number found", "block number", current)
-				lastFilteredAll, lastFiltered, err := fs.getLastFiltered(current)
-				if err != nil {
-					log.Warn("Fetching last filtered failed", "err", err)
-					continue
+				if !fs.filterNewBlocks(current) {
+					return
 				}
-				for current > lastFiltered {
-					//check if we are shutting down before next round
-					select {
-					case <-fs.shutdownChan:
-						return
-					default:
-					}
-					//index 1000 blocks at a time
-					//TODO: make configurable
-					endBlock := lastFiltered + 1000
-					if endBlock > current {
-						endBlock = current
-					}
-					err := fs.index(lastFilteredAll, lastFiltered+1, endBlock)
-					if err != nil {
-						log.Warn("Index block failed", "lastFiltered", lastFiltered, "err", err)
-						break
-					}
-					lastFiltered = endBlock
+			case request := <-fs.pauseChan:
+				// the backfill lane is held up until resumed
+				fs.lanes.acquireHead()
+				resumed := fs.pauseFiltering(request)
+				fs.lanes.release()
+				if !resumed {
+					return
 				}
 			case <-fs.shutdownChan:
 				return
@@ -106,26 +217,125 @@ func (fs *FilterService) Start() error {
 	return nil
 }
 
-func (fs *FilterService) Stop() {
+// Pause stops filtering new blocks until resume is closed, returning once
+// the batch being filtered is done. If the context is done first, filtering
+// may still be paused.
+func (fs *FilterService) Pause(ctx context.Context, resume <-chan struct{}) error {
+	request := pauseRequest{paused: make(chan struct{}), resume: resume}
+	select {
+	case fs.pauseChan <- request:
+	case <-fs.shutdownChan:
+		return errShuttingDown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-request.paused:
+		return nil
+	case <-fs.shutdownChan:
+		return errShuttingDown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pauseFiltering waits for the request to be resumed, returning false if the
+// service is shutting down instead
+func (fs *FilterService) pauseFiltering(request pauseRequest) bool {
+	close(request.paused)
+	log.Info("Filtering paused")
+	select {
+	case <-request.resume:
+		log.Info("Filtering resumed")
+		return true
+	case <-fs.shutdownChan:
+		return false
+	}
+}
+
+// Stop waits for the batch being filtered to finish, so the last filtered
+// block of each address is up to date. If the context is done first, the
+// batch is given up on if its blocks aren't indexed yet, and filtered again
+// on the next start, but it still waits for the filter to return, so nothing
+// is written once it has.
+func (fs *FilterService) Stop(ctx context.Context) {
 	close(fs.shutdownChan)
-	fs.shutdownWg.Wait()
+	done := make(chan struct{})
+	go func() {
+		fs.shutdownWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn("Filter service did not finish in time, abandoning the batch being filtered", "err", ctx.Err())
+		close(fs.abortChan)
+		<-done
+	}
 	fs.storageFilter.Stop()
 	log.Info("Filter service stopped")
 }
 
-// getLastFiltered finds the minimum value of "lastFiltered" across all addresses
+// aborted checks whether shutdown has run out of time
+func (fs *FilterService) aborted() bool {
+	select {
+	case <-fs.abortChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// LastFiltered returns the block every registered address has been filtered
+// up to, and false if the filter loop hasn't found it yet
+func (fs *FilterService) LastFiltered() (uint64, bool) {
+	fs.lastFilteredMux.RLock()
+	defer fs.lastFilteredMux.RUnlock()
+	return fs.lastFiltered, fs.lastFilteredKnown
+}
+
+func (fs *FilterService) setLastFiltered(lastFiltered uint64) {
+	fs.lastFilteredMux.Lock()
+	defer fs.lastFilteredMux.Unlock()
+	fs.lastFiltered, fs.lastFilteredKnown = lastFiltered, true
+}
+
+// getLastFiltered finds the minimum value of "lastFiltered" across all
+// addresses, leaving out throttled addresses, those of other shards and those
+// already filtered up to their terminal block or the block they
+// self-destructed at
 func (fs *FilterService) getLastFiltered(current uint64) (map[types.Address]uint64, uint64, error) {
 	addresses, err := fs.db.GetAddresses()
 	if err != nil {
 		return nil, current, err
 	}
+	if err := fs.loadThrottled(); err != nil {
+		return nil, current, err
+	}
 
 	lastFiltered := make(map[types.Address]uint64)
 	for _, address := range addresses {
+		if fs.costs.isThrottled(address) || !fs.owns(address) {
+			continue
+		}
 		curLastFiltered, err := fs.db.GetLastFiltered(address)
 		if err != nil {
 			return nil, current, err
 		}
+		terminalBlock, err := fs.db.GetTerminalBlock(address)
+		if err != nil {
+			return nil, current, err
+		}
+		if terminalBlock > 0 && curLastFiltered >= terminalBlock {
+			continue
+		}
+		destroyedAt, err := fs.db.GetContractDestroyed(address)
+		if err != nil {
+			return nil, current, err
+		}
+		if destroyedAt > 0 && curLastFiltered >= destroyedAt {
+			continue
+		}
 		if curLastFiltered < current {
 			current = curLastFiltered
 		}
@@ -138,36 +348,72 @@ func (fs *FilterService) getLastFiltered(current uint64) (map[types.Address]uint
 type IndexBatch struct {
 	addresses []types.Address
 	blocks    []*types.Block
+	// the blocks are indexed ahead of the last filtered block of the
+	// addresses, which isn't raised
+	ahead bool
+	// the blocks have already been filtered for the addresses, and what was
+	// indexed for them is replaced
+	reindex bool
+	// only the addresses still owned when the batch is processed are
+	// filtered, as the shard may have given some up since it was made
+	owned bool
+}
+
+func (fs *FilterService) owns(address types.Address) bool {
+	return fs.shard == nil || fs.shard.Owns(address)
 }
 
 func (fs *FilterService) index(lastFiltered map[types.Address]uint64, blockNumber uint64, endBlockNumber uint64) error {
-	log.Debug("Index registered address", "start-block", blockNumber, "end-block", endBlockNumber)
+	return fs.indexRange(lastFiltered, blockNumber, endBlockNumber, true, false)
+}
+
+// indexRange indexes the blocks for the addresses not yet filtered up to
+// them, telling the notifier about their events if notify is set, and
+// indexing them ahead of the last filtered block if ahead is set. Frozen
+// addresses are only filtered up to their terminal block.
+func (fs *FilterService) indexRange(lastFiltered map[types.Address]uint64, blockNumber uint64, endBlockNumber uint64, notify bool, ahead bool) error {
+	log.Debug("Index registered address", "start-block", blockNumber, "end-block", endBlockNumber, "ahead", ahead)
+	terminal := make(map[types.Address]uint64)
+	for address := range lastFiltered {
+		terminalBlock, err := fs.db.GetTerminalBlock(address)
+		if err != nil {
+			return err
+		}
+		terminal[address] = terminalBlock
+	}
+
+	// a new batch is started whenever an address starts or stops being
+	// filtered, as the addresses of each are filtered up to its end
 	indexBatches := make([]IndexBatch, 0)
-	curBatch := IndexBatch{
-		addresses: make([]types.Address, 0),
-		blocks:    make([]*types.Block, 0),
-	}
-	addressInBatch := make(map[types.Address]bool)
-	for blockNumber <= endBlockNumber {
-		// check if a new batch should be created
-		oldBatch := curBatch
+	var curBatch IndexBatch
+	inBatch := make(map[types.Address]bool)
+	for ; blockNumber <= endBlockNumber; blockNumber++ {
+		filtered := make(map[types.Address]bool)
 		for address, curLastFiltered := range lastFiltered {
-			if curLastFiltered < blockNumber {
-				if !addressInBatch[address] {
-					addrList := curBatch.addresses
-					curBatch = IndexBatch{
-						addresses: []types.Address{address},
-						blocks:    make([]*types.Block, 0),
-					}
-					curBatch.addresses = append(curBatch.addresses, addrList...)
-					addressInBatch[address] = true
+			if curLastFiltered < blockNumber && (terminal[address] == 0 || blockNumber <= terminal[address]) {
+				filtered[address] = true
+			}
+		}
+		if !sameAddresses(filtered, inBatch) {
+			if len(curBatch.addresses) > 0 {
+				indexBatches = append(indexBatches, curBatch)
+			}
+			curBatch = IndexBatch{
+				addresses: make([]types.Address, 0, len(filtered)),
+				blocks:    make([]*types.Block, 0),
+				ahead:     ahead,
+				owned:     true,
+			}
+			for address := range filtered {
+				if !inBatch[address] {
+					log.Info("Indexing registered address", "address", address.Hex(), "blocknumber", blockNumber)
 				}
-				log.Info("Indexing registered address", "address", address.Hex(), "blocknumber", blockNumber)
+				curBatch.addresses = append(curBatch.addresses, address)
 			}
+			inBatch = filtered
 		}
-		// if new batch is created, append old batch to indexBatches
-		if len(oldBatch.addresses) > 0 && len(curBatch.addresses) > len(oldBatch.addresses) {
-			indexBatches = append(indexBatches, oldBatch)
+		if len(filtered) == 0 {
+			continue
 		}
 		// appending block to current batch
 		block, err := fs.db.ReadBlock(blockNumber)
@@ -175,29 +421,198 @@ func (fs *FilterService) index(lastFiltered map[types.Address]uint64, blockNumbe
 			return err
 		}
 		curBatch.blocks = append(curBatch.blocks, block)
-		blockNumber++
 	}
 	if len(curBatch.addresses) > 0 {
 		indexBatches = append(indexBatches, curBatch)
 	}
 
-	// index storage and blocks for all batches
+	// index storage and blocks for all batches, stopping between them if
+	// shutting down, as the addresses of each are filtered up to its end
 	for _, batch := range indexBatches {
-		if err := fs.processBatch(batch); err != nil {
+		select {
+		case <-fs.shutdownChan:
+			return errShuttingDown
+		default:
+		}
+		if err := fs.processBatch(batch, notify); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameAddresses checks whether both sets hold the same addresses
+func sameAddresses(a, b map[types.Address]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for address := range a {
+		if !b[address] {
+			return false
+		}
+	}
+	return true
+}
+
+// Backfill filters the blocks in the range again, for each address that has
+// already been filtered past them, replacing what was indexed for the blocks
+// and recreating documents missing for them. Events are not sent to webhooks
+// again. Blocks an address has not been filtered up to yet are left
+// to the filter loop. The last block of each chunk is passed to progress once
+// it is filtered.
+func (fs *FilterService) Backfill(from, to uint64, progress func(uint64)) error {
+	addresses, err := fs.db.GetAddresses()
+	if err != nil {
+		return err
+	}
+	lastFiltered := make(map[types.Address]uint64, len(addresses))
+	for _, address := range addresses {
+		if lastFiltered[address], err = fs.db.GetLastFiltered(address); err != nil {
+			return err
+		}
+	}
+
+	log.Info("Backfilling registered addresses", "start", from, "end", to)
+	if err := fs.refilter(lastFiltered, from, to, progress); err != nil {
+		return err
+	}
+	log.Info("Backfilled registered addresses", "start", from, "end", to)
+	return nil
+}
+
+// Reindex filters the blocks from and to (inclusive) again for one address,
+// up to the block it has been filtered to. As with a backfill, the documents
+// already stored for the blocks are kept.
+func (fs *FilterService) Reindex(address types.Address, from, to uint64, progress func(uint64)) error {
+	lastFiltered, err := fs.db.GetLastFiltered(address)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Reindexing address", "address", address.String(), "start", from, "end", to)
+	if err := fs.refilter(map[types.Address]uint64{address: lastFiltered}, from, to, progress); err != nil {
+		return err
+	}
+	log.Info("Reindexed address", "address", address.String(), "start", from, "end", to)
+	return nil
+}
+
+// refilter filters the blocks from and to again for the addresses that have
+// been filtered past them, a chunk at a time
+func (fs *FilterService) refilter(lastFiltered map[types.Address]uint64, from, to uint64, progress func(uint64)) error {
+	for start := from; start <= to; start += backfillChunkSize {
+		select {
+		case <-fs.shutdownChan:
+			return errShuttingDown
+		default:
+		}
+		end := start + backfillChunkSize - 1
+		if end > to {
+			end = to
+		}
+		batches, err := fs.backfillBatches(lastFiltered, start, end)
+		if err != nil {
 			return err
 		}
+		for _, batch := range batches {
+			if err := fs.processBatch(batch, false); err != nil {
+				return err
+			}
+		}
+		progress(end)
+	}
+	return nil
+}
+
+// backfillBatches groups the blocks in the range by the addresses that have
+// been filtered past them. Fewer addresses qualify as the blocks get higher,
+// so a new batch starts each time the number changes.
+func (fs *FilterService) backfillBatches(lastFiltered map[types.Address]uint64, blockNumber uint64, endBlockNumber uint64) ([]IndexBatch, error) {
+	indexBatches := make([]IndexBatch, 0)
+	var curBatch IndexBatch
+	for ; blockNumber <= endBlockNumber; blockNumber++ {
+		addresses := make([]types.Address, 0, len(lastFiltered))
+		for address, curLastFiltered := range lastFiltered {
+			if curLastFiltered >= blockNumber {
+				addresses = append(addresses, address)
+			}
+		}
+		if len(addresses) == 0 {
+			break
+		}
+		if len(addresses) != len(curBatch.addresses) {
+			if len(curBatch.blocks) > 0 {
+				indexBatches = append(indexBatches, curBatch)
+			}
+			curBatch = IndexBatch{addresses: addresses, reindex: true}
+		}
+		block, err := fs.db.ReadBlock(blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		curBatch.blocks = append(curBatch.blocks, block)
+	}
+	if len(curBatch.blocks) > 0 {
+		indexBatches = append(indexBatches, curBatch)
+	}
+	return indexBatches, nil
+}
+
+// processBatch indexes the blocks for the addresses, telling the notifier
+// about their events if notify is set, and journals how it went
+func (fs *FilterService) processBatch(batch IndexBatch, notify bool) error {
+	fs.batchMux.Lock()
+	defer fs.batchMux.Unlock()
+
+	if batch.owned && fs.shard != nil {
+		owned := make([]types.Address, 0, len(batch.addresses))
+		for _, address := range batch.addresses {
+			if fs.shard.Owns(address) {
+				owned = append(owned, address)
+			}
+		}
+		if len(owned) == 0 {
+			return nil
+		}
+		batch.addresses = owned
 	}
+
+	started := time.Now()
+	counts := make(map[uint64]*blockCounts)
+	if err := fs.filterBatch(batch, notify, counts); err != nil {
+		fs.recordFailure(batch, err)
+		return err
+	}
+	fs.writeJournal(batch, started, counts)
 	return nil
 }
 
-func (fs *FilterService) processBatch(batch IndexBatch) error {
+// filterBatch indexes the blocks for the addresses, counting what was indexed
+// in each block
+func (fs *FilterService) filterBatch(batch IndexBatch, notify bool, counts map[uint64]*blockCounts) error {
 	log.Info("Processing batch", "start", batch.blocks[0].Number, "end", batch.blocks[len(batch.blocks)-1].Number)
 	if err := fs.storageFilter.IndexStorage(batch.addresses, batch.blocks[0].Number, batch.blocks[len(batch.blocks)-1].Number); err != nil {
 		return err
 	}
+	// the storage costs are tracked per contract as it is read, and the rest
+	// is shared between the contracts of the batch
+	started := time.Now()
 
+	// given up on before the blocks are indexed, as that raises the last
+	// filtered block of the addresses, which the rest must then be done for
+	if fs.aborted() {
+		return errShuttingDown
+	}
 	// if IndexStorage has an error, IndexBlocks is never called, last filtered will not be updated
-	if err := fs.db.IndexBlocks(batch.addresses, batch.blocks); err != nil {
+	if batch.ahead {
+		if err := fs.db.IndexBlocksAhead(batch.addresses, batch.blocks); err != nil {
+			return err
+		}
+	} else if batch.reindex {
+		if err := fs.db.ReindexBlocks(batch.addresses, batch.blocks); err != nil {
+			return err
+		}
+	} else if err := fs.db.IndexBlocks(batch.addresses, batch.blocks); err != nil {
 		return err
 	}
 
@@ -205,22 +620,39 @@ func (fs *FilterService) processBatch(batch IndexBatch) error {
 		return err
 	}
 
+	if fs.notifier != nil && notify {
+		// the blocks are indexed, so a failure here shouldn't index them again
+		if err := fs.notifier.Notify(batch.addresses, batch.blocks); err != nil {
+			log.Warn("Notifying of indexed events failed", "start", batch.blocks[0].Number, "end", batch.blocks[len(batch.blocks)-1].Number, "err", err)
+		}
+	}
+
+	addresses := make(map[types.Address]bool, len(batch.addresses))
 	addressesWithAbi := make(map[types.Address]string)
 	for _, address := range batch.addresses {
 		abi, err := fs.db.GetContractABI(address)
 		if err != nil {
 			return err
 		}
+		addresses[address] = true
 		addressesWithAbi[address] = abi
 	}
+	// the transactions are only kept while their block is processed
+	defer func() { fs.recorder.transactions = nil }()
 	for _, b := range batch.blocks {
+		fs.recorder.startBlock()
 		if err := fs.erc20processor.ProcessBlock(addressesWithAbi, b); err != nil {
 			return err
 		}
 		if err := fs.erc721processor.ProcessBlock(addressesWithAbi, b); err != nil {
 			return err
 		}
+		if err := fs.erc1155processor.ProcessBlock(addressesWithAbi, b); err != nil {
+			return err
+		}
+		counts[b.Number] = fs.recorder.blockCounts(addresses)
 	}
+	fs.costs.addBatch(batch.addresses, len(batch.blocks), time.Since(started))
 
 	log.Info("Processed batch", "start", batch.blocks[0].Number, "end", batch.blocks[len(batch.blocks)-1].Number)
 	return nil
@@ -1,13 +1,17 @@
 package filter
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math/big"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/database"
 	"quorumengineering/quorum-report/types"
 )
 
@@ -22,10 +26,10 @@ func TestIndexBlock(t *testing.T) {
 		"eth_storageRoot0x00000000000000000000000000000000000000020x6": types.NewHash("1"),
 	}
 	db := &FakeDB{
-		[]types.Address{types.NewAddress("1"), types.NewAddress("2")},
-		map[types.Address]uint64{types.NewAddress("1"): 3, types.NewAddress("2"): 5},
+		addresses:    []types.Address{types.NewAddress("1"), types.NewAddress("2")},
+		lastFiltered: map[types.Address]uint64{types.NewAddress("1"): 3, types.NewAddress("2"): 5},
 	}
-	fs := NewFilterService(db, client.NewStubQuorumClient(nil, mockRPC))
+	fs := NewFilterService(db, client.NewStubQuorumClient(nil, mockRPC), nil)
 
 	// test fs.getLastFiltered
 	lastFilteredAll, lastFiltered, err := fs.getLastFiltered(6)
@@ -45,11 +49,274 @@ func TestIndexBlock(t *testing.T) {
 	assert.Nil(t, err)
 	assert.EqualValues(t, 6, db.lastFiltered[types.NewAddress("1")])
 	assert.EqualValues(t, 6, db.lastFiltered[types.NewAddress("2")])
+
+	// each filtered block is journaled
+	assert.Len(t, db.journal, 3)
+	for i, entry := range db.journal {
+		assert.EqualValues(t, 4+i, entry.BlockNumber)
+		assert.Equal(t, types.FilterStage, entry.Stage)
+	}
+}
+
+func TestContractCosts(t *testing.T) {
+	mockRPC := map[string]interface{}{
+		"eth_storageRoot0x00000000000000000000000000000000000000010x3": types.NewHash("1"),
+		"eth_storageRoot0x00000000000000000000000000000000000000010x4": types.NewHash("1"),
+		"eth_storageRoot0x00000000000000000000000000000000000000010x5": types.NewHash("1"),
+		"eth_storageRoot0x00000000000000000000000000000000000000020x4": types.NewHash("1"),
+		"eth_storageRoot0x00000000000000000000000000000000000000020x5": types.NewHash("1"),
+	}
+	db := &FakeDB{
+		addresses:    []types.Address{types.NewAddress("1"), types.NewAddress("2")},
+		lastFiltered: map[types.Address]uint64{types.NewAddress("1"): 3, types.NewAddress("2"): 4},
+	}
+	fs := NewFilterService(db, client.NewStubQuorumClient(nil, mockRPC), nil)
+
+	lastFilteredAll, _, err := fs.getLastFiltered(5)
+	assert.Nil(t, err)
+	assert.Nil(t, fs.index(lastFilteredAll, 4, 5))
+
+	costs := make(map[types.Address]*types.ContractCost)
+	for _, cost := range fs.ContractCosts() {
+		costs[cost.Address] = cost
+	}
+	assert.Len(t, costs, 2)
+	// the storage root is read at each block, and the one before it
+	assert.EqualValues(t, 2, costs[types.NewAddress("1")].BlocksFiltered)
+	assert.EqualValues(t, 4, costs[types.NewAddress("1")].NodeCalls)
+	assert.EqualValues(t, 1, costs[types.NewAddress("2")].BlocksFiltered)
+	assert.EqualValues(t, 2, costs[types.NewAddress("2")].NodeCalls)
+
+	// throttled contracts are left out of filtering until unthrottled
+	assert.Nil(t, fs.ThrottleContract(types.NewAddress("1"), true))
+	lastFilteredAll, lastFiltered, err := fs.getLastFiltered(5)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 5, lastFiltered)
+	assert.NotContains(t, lastFilteredAll, types.NewAddress("1"))
+	for _, cost := range fs.ContractCosts() {
+		assert.Equal(t, cost.Address == types.NewAddress("1"), cost.Throttled)
+	}
+
+	// by every instance sharing the database, and across restarts
+	other := NewFilterService(db, client.NewStubQuorumClient(nil, mockRPC), nil)
+	lastFilteredAll, _, err = other.getLastFiltered(5)
+	assert.Nil(t, err)
+	assert.NotContains(t, lastFilteredAll, types.NewAddress("1"))
+
+	assert.Nil(t, fs.ThrottleContract(types.NewAddress("1"), false))
+	lastFilteredAll, _, err = other.getLastFiltered(5)
+	assert.Nil(t, err)
+	assert.Contains(t, lastFilteredAll, types.NewAddress("1"))
+}
+
+func TestFrozenContract(t *testing.T) {
+	db := &FakeDB{
+		addresses:    []types.Address{types.NewAddress("1"), types.NewAddress("2"), types.NewAddress("3")},
+		lastFiltered: map[types.Address]uint64{types.NewAddress("1"): 3, types.NewAddress("2"): 5, types.NewAddress("3"): 2},
+		terminal:     map[types.Address]uint64{types.NewAddress("1"): 3, types.NewAddress("3"): 4},
+	}
+	fs := NewFilterService(db, client.NewStubQuorumClient(nil, nil), nil)
+
+	// contracts filtered up to their terminal block are no longer filtered,
+	// those not yet there still are
+	lastFilteredAll, lastFiltered, err := fs.getLastFiltered(6)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, lastFiltered)
+	assert.NotContains(t, lastFilteredAll, types.NewAddress("1"))
+	assert.Contains(t, lastFilteredAll, types.NewAddress("2"))
+	assert.Contains(t, lastFilteredAll, types.NewAddress("3"))
+
+	db.lastFiltered[types.NewAddress("3")] = 4
+	lastFilteredAll, lastFiltered, err = fs.getLastFiltered(6)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 5, lastFiltered)
+	assert.Len(t, lastFilteredAll, 1)
+}
+
+func TestFrozenContract_FilteredUpToTerminalBlock(t *testing.T) {
+	mockRPC := make(map[string]interface{})
+	for block := 3; block <= 8; block++ {
+		for _, address := range []types.Address{types.NewAddress("1"), types.NewAddress("2")} {
+			mockRPC[fmt.Sprintf("eth_storageRoot%s0x%x", address.String(), block)] = types.NewHash("1")
+		}
+	}
+	db := &FakeDB{
+		addresses:    []types.Address{types.NewAddress("1"), types.NewAddress("2")},
+		lastFiltered: map[types.Address]uint64{types.NewAddress("1"): 3, types.NewAddress("2"): 3},
+		terminal:     map[types.Address]uint64{types.NewAddress("1"): 5},
+	}
+	fs := NewFilterService(db, client.NewStubQuorumClient(nil, mockRPC), nil)
+
+	// the frozen contract is filtered up to its terminal block, and no further
+	lastFilteredAll, lastFiltered, err := fs.getLastFiltered(8)
+	assert.Nil(t, err)
+	assert.Nil(t, fs.index(lastFilteredAll, lastFiltered+1, 8))
+	assert.EqualValues(t, 5, db.lastFiltered[types.NewAddress("1")])
+	assert.EqualValues(t, 8, db.lastFiltered[types.NewAddress("2")])
+	assert.Len(t, db.journal, 5)
+
+	lastFilteredAll, _, err = fs.getLastFiltered(8)
+	assert.Nil(t, err)
+	assert.NotContains(t, lastFilteredAll, types.NewAddress("1"))
+}
+
+func TestDestroyedContract(t *testing.T) {
+	db := &FakeDB{
+		addresses:    []types.Address{types.NewAddress("1"), types.NewAddress("2")},
+		lastFiltered: map[types.Address]uint64{types.NewAddress("1"): 3, types.NewAddress("2"): 5},
+		destroyed:    map[types.Address]uint64{types.NewAddress("1"): 3},
+	}
+	fs := NewFilterService(db, client.NewStubQuorumClient(nil, nil), nil)
+
+	lastFilteredAll, lastFiltered, err := fs.getLastFiltered(6)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 5, lastFiltered)
+	assert.NotContains(t, lastFilteredAll, types.NewAddress("1"))
+}
+
+// shard owns a fixed set of addresses
+type shard map[types.Address]bool
+
+func (s shard) Owns(address types.Address) bool {
+	return s[address]
+}
+
+func TestShardedContracts(t *testing.T) {
+	mockRPC := map[string]interface{}{
+		"eth_storageRoot0x00000000000000000000000000000000000000020x3": types.NewHash("1"),
+		"eth_storageRoot0x00000000000000000000000000000000000000020x4": types.NewHash("1"),
+	}
+	db := &FakeDB{
+		addresses:    []types.Address{types.NewAddress("1"), types.NewAddress("2")},
+		lastFiltered: map[types.Address]uint64{types.NewAddress("1"): 3, types.NewAddress("2"): 3},
+	}
+	fs := NewFilterService(db, client.NewStubQuorumClient(nil, mockRPC), nil)
+	owned := shard{types.NewAddress("1"): true, types.NewAddress("2"): true}
+	fs.SetShard(owned)
+
+	lastFilteredAll, _, err := fs.getLastFiltered(6)
+	assert.Nil(t, err)
+	assert.Len(t, lastFilteredAll, 2)
+
+	// an address given up after its batch was made is left to its new owner
+	delete(owned, types.NewAddress("1"))
+	assert.Nil(t, fs.index(lastFilteredAll, 4, 4))
+	assert.EqualValues(t, 3, db.lastFiltered[types.NewAddress("1")])
+	assert.EqualValues(t, 4, db.lastFiltered[types.NewAddress("2")])
+
+	lastFilteredAll, lastFiltered, err := fs.getLastFiltered(6)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 4, lastFiltered)
+	assert.NotContains(t, lastFilteredAll, types.NewAddress("1"))
+}
+
+func TestRefilterContract(t *testing.T) {
+	mockRPC := map[string]interface{}{
+		"eth_storageRoot0x00000000000000000000000000000000000000010x4": types.NewHash("1"),
+		"eth_storageRoot0x00000000000000000000000000000000000000010x5": types.NewHash("1"),
+		"eth_storageRoot0x00000000000000000000000000000000000000010x6": types.NewHash("1"),
+	}
+	db := &FakeDB{
+		addresses:    []types.Address{types.NewAddress("1"), types.NewAddress("2")},
+		lastFiltered: map[types.Address]uint64{types.NewAddress("1"): 6, types.NewAddress("2"): 6},
+	}
+	notifier := &fakeNotifier{blocks: make(map[uint64]int)}
+	fs := NewFilterService(db, client.NewStubQuorumClient(nil, mockRPC), notifier)
+
+	// the blocks are queued up, surviving a restart
+	assert.Nil(t, fs.RefilterContract(types.NewAddress("1"), 5))
+	assert.True(t, fs.refiltersPending())
+	fs = NewFilterService(db, client.NewStubQuorumClient(nil, mockRPC), notifier)
+	assert.True(t, fs.refiltersPending())
+
+	// only the refiltered address is reindexed, without raising its last
+	// filtered block or sending its events again
+	assert.Nil(t, fs.runRefilters())
+	assert.Equal(t, []uint64{5, 6}, db.reindexed)
+	assert.Len(t, db.journal, 2)
+	assert.EqualValues(t, 6, db.lastFiltered[types.NewAddress("1")])
+	assert.EqualValues(t, 6, db.lastFiltered[types.NewAddress("2")])
+	assert.Empty(t, notifier.blocks)
+	assert.False(t, fs.refiltersPending())
+
+	// blocks not filtered yet are left to the filter loop
+	assert.Nil(t, fs.RefilterContract(types.NewAddress("2"), 7))
+	assert.False(t, fs.refiltersPending())
+	assert.Equal(t, database.ErrNotFound, fs.RefilterContract(types.NewAddress("3"), 0))
+}
+
+func TestWriteJournal(t *testing.T) {
+	contract := types.NewAddress("1")
+	db := &FakeDB{
+		transactions: map[types.Hash]*types.Transaction{
+			types.NewHash("a"): {To: contract, Events: []*types.Event{{Address: contract}, {Address: types.NewAddress("2")}}},
+			types.NewHash("b"): {To: types.NewAddress("3"), InternalCalls: []*types.InternalCall{{To: contract}}},
+			types.NewHash("c"): {To: types.NewAddress("3")},
+		},
+	}
+	fs := NewFilterService(db, client.NewStubQuorumClient(nil, nil), nil)
+	batch := IndexBatch{
+		addresses: []types.Address{contract},
+		blocks: []*types.Block{
+			{Number: 4, Transactions: []types.Hash{types.NewHash("a"), types.NewHash("b"), types.NewHash("c")}},
+			{Number: 5},
+		},
+	}
+
+	// the transactions read while processing a block are counted
+	fs.recorder.startBlock()
+	for _, hash := range batch.blocks[0].Transactions {
+		_, err := fs.recorder.ReadTransaction(hash)
+		assert.Nil(t, err)
+	}
+	fs.recorder.count = 2
+	counts := map[uint64]*blockCounts{4: fs.recorder.blockCounts(map[types.Address]bool{contract: true})}
+	// and each is read from the database once
+	db.transactions = nil
+	_, err := fs.recorder.ReadTransaction(types.NewHash("a"))
+	assert.Nil(t, err)
+
+	// failed attempts are journaled once the blocks are filtered
+	fs.recordFailure(batch, errors.New("node unavailable"))
+	fs.writeJournal(batch, time.Now(), counts)
+
+	assert.Len(t, db.journal, 2)
+	assert.Equal(t, 4, int(db.journal[0].BlockNumber))
+	assert.Equal(t, 2, db.journal[0].Transactions)
+	assert.Equal(t, 1, db.journal[0].Events)
+	assert.Equal(t, 2, db.journal[0].TokenRecords)
+	assert.Equal(t, []string{"node unavailable"}, db.journal[0].Errors)
+	assert.Equal(t, 5, int(db.journal[1].BlockNumber))
+	assert.Equal(t, 0, db.journal[1].TokenRecords)
+	assert.Empty(t, fs.failures)
 }
 
 type FakeDB struct {
 	addresses    []types.Address
 	lastFiltered map[types.Address]uint64
+	terminal     map[types.Address]uint64
+	destroyed    map[types.Address]uint64
+	transactions map[types.Hash]*types.Transaction
+	journal      []*types.JournalEntry
+	indexedAhead []uint64
+	reindexed    []uint64
+	checkpoints  map[string]string
+}
+
+func (f *FakeDB) GetCheckpoint(service string) (string, error) {
+	checkpoint, ok := f.checkpoints[service]
+	if !ok {
+		return "", database.ErrNotFound
+	}
+	return checkpoint, nil
+}
+
+func (f *FakeDB) SetCheckpoint(service string, checkpoint string) error {
+	if f.checkpoints == nil {
+		f.checkpoints = make(map[string]string)
+	}
+	f.checkpoints[service] = checkpoint
+	return nil
 }
 
 func (f *FakeDB) GetAddresses() ([]types.Address, error) {
@@ -84,11 +351,39 @@ func (f *FakeDB) IndexBlocks(addresses []types.Address, blocks []*types.Block) e
 	return nil
 }
 
+func (f *FakeDB) ReindexBlocks(addresses []types.Address, blocks []*types.Block) error {
+	for _, block := range blocks {
+		f.reindexed = append(f.reindexed, block.Number)
+	}
+	return nil
+}
+
+func (f *FakeDB) IndexBlocksAhead(addresses []types.Address, blocks []*types.Block) error {
+	for _, block := range blocks {
+		f.indexedAhead = append(f.indexedAhead, block.Number)
+	}
+	return nil
+}
+
 func (f *FakeDB) GetLastFiltered(address types.Address) (uint64, error) {
 	return f.lastFiltered[address], nil
 }
 
+func (f *FakeDB) GetTerminalBlock(address types.Address) (uint64, error) {
+	return f.terminal[address], nil
+}
+
+func (f *FakeDB) ResetLastFiltered(address types.Address, lastFiltered uint64) error {
+	if f.lastFiltered[address] > lastFiltered {
+		f.lastFiltered[address] = lastFiltered
+	}
+	return nil
+}
+
 func (f *FakeDB) ReadTransaction(txHash types.Hash) (*types.Transaction, error) {
+	if tx, ok := f.transactions[txHash]; ok {
+		return tx, nil
+	}
 	return nil, errors.New("not implemented")
 }
 
@@ -96,14 +391,250 @@ func (f *FakeDB) RecordNewERC20Balance(contract types.Address, holder types.Addr
 	return errors.New("not implemented")
 }
 
+func (f *FakeDB) RecordERC20Allowance(contract types.Address, owner types.Address, spender types.Address, block uint64, amount *big.Int) error {
+	return errors.New("not implemented")
+}
+
 func (f *FakeDB) RecordERC721Token(contract types.Address, holder types.Address, block uint64, tokenId *big.Int) error {
 	return errors.New("not implemented")
 }
 
+func (f *FakeDB) RecordNewERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, block uint64, amount *big.Int) error {
+	return errors.New("not implemented")
+}
+
 func (f *FakeDB) GetContractABI(types.Address) (string, error) {
 	return "{}", nil
 }
 
+func (f *FakeDB) GetStorageLayout(types.Address) (string, error) {
+	return "", nil
+}
+
 func (f *FakeDB) SetContractCreationTransaction(creationTxns map[types.Hash][]types.Address) error {
 	return nil
 }
+
+func (f *FakeDB) SetContractsDestroyed(destroyed map[types.Address]uint64) error {
+	for address, blockNumber := range destroyed {
+		f.destroyed[address] = blockNumber
+	}
+	return nil
+}
+
+func (f *FakeDB) GetContractDestroyed(address types.Address) (uint64, error) {
+	return f.destroyed[address], nil
+}
+
+func (f *FakeDB) WriteJournalEntries(entries []*types.JournalEntry) error {
+	f.journal = append(f.journal, entries...)
+	return nil
+}
+
+func TestBackfillBatches(t *testing.T) {
+	db := &FakeDB{
+		addresses:    []types.Address{types.NewAddress("1"), types.NewAddress("2")},
+		lastFiltered: map[types.Address]uint64{types.NewAddress("1"): 3, types.NewAddress("2"): 5},
+	}
+	fs := NewFilterService(db, client.NewStubQuorumClient(nil, nil), nil)
+
+	batches, err := fs.backfillBatches(db.lastFiltered, 2, 7)
+	assert.Nil(t, err)
+	assert.Len(t, batches, 2)
+	// both addresses were filtered past blocks 2 and 3
+	assert.ElementsMatch(t, []types.Address{types.NewAddress("1"), types.NewAddress("2")}, batches[0].addresses)
+	assert.Equal(t, []*types.Block{{Number: 2}, {Number: 3}}, batches[0].blocks)
+	// blocks after 5 are left to the filter loop
+	assert.Equal(t, []types.Address{types.NewAddress("2")}, batches[1].addresses)
+	assert.Equal(t, []*types.Block{{Number: 4}, {Number: 5}}, batches[1].blocks)
+
+	batches, err = fs.backfillBatches(db.lastFiltered, 6, 7)
+	assert.Nil(t, err)
+	assert.Empty(t, batches)
+}
+
+func TestReindex(t *testing.T) {
+	mockRPC := map[string]interface{}{
+		"eth_storageRoot0x00000000000000000000000000000000000000010x1": types.NewHash("1"),
+		"eth_storageRoot0x00000000000000000000000000000000000000010x2": types.NewHash("1"),
+		"eth_storageRoot0x00000000000000000000000000000000000000010x3": types.NewHash("1"),
+	}
+	db := &FakeDB{
+		addresses:    []types.Address{types.NewAddress("1"), types.NewAddress("2")},
+		lastFiltered: map[types.Address]uint64{types.NewAddress("1"): 3, types.NewAddress("2"): 5},
+	}
+	fs := NewFilterService(db, client.NewStubQuorumClient(nil, mockRPC), nil)
+
+	var progress []uint64
+	err := fs.Reindex(types.NewAddress("1"), 2, 5, func(done uint64) { progress = append(progress, done) })
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{5}, progress)
+	// only the blocks the address was filtered to are reindexed, replacing
+	// what was indexed for them
+	assert.Equal(t, []uint64{2, 3}, db.reindexed)
+	assert.Len(t, db.journal, 2)
+	for i, entry := range db.journal {
+		assert.EqualValues(t, 2+i, entry.BlockNumber)
+	}
+	assert.EqualValues(t, 3, db.lastFiltered[types.NewAddress("1")])
+}
+
+func TestPause(t *testing.T) {
+	fs := NewFilterService(&FakeDB{}, client.NewStubQuorumClient(nil, nil), nil)
+	assert.Nil(t, fs.Start())
+
+	resume := make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, fs.Pause(ctx, resume))
+
+	// the filter loop is waiting to be resumed
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer shortCancel()
+	assert.Equal(t, context.DeadlineExceeded, fs.Pause(shortCtx, make(chan struct{})))
+
+	close(resume)
+	assert.Nil(t, fs.Pause(ctx, make(chan struct{})))
+
+	// stopping while paused doesn't wait to be resumed
+	fs.Stop(ctx)
+	assert.Equal(t, errShuttingDown, fs.Pause(ctx, make(chan struct{})))
+}
+
+func TestProcessBatch_Aborted(t *testing.T) {
+	mockRPC := map[string]interface{}{
+		"eth_storageRoot0x00000000000000000000000000000000000000010x3": types.NewHash("1"),
+		"eth_storageRoot0x00000000000000000000000000000000000000010x4": types.NewHash("1"),
+	}
+	db := &FakeDB{
+		addresses:    []types.Address{types.NewAddress("1")},
+		lastFiltered: map[types.Address]uint64{types.NewAddress("1"): 3},
+	}
+	fs := NewFilterService(db, client.NewStubQuorumClient(nil, mockRPC), nil)
+	// shutdown ran out of time
+	close(fs.abortChan)
+
+	// a batch still being filtered is given up on before its blocks are indexed
+	err := fs.processBatch(IndexBatch{addresses: db.addresses, blocks: []*types.Block{{Number: 4}}}, false)
+	assert.Equal(t, errShuttingDown, err)
+	assert.EqualValues(t, 3, db.lastFiltered[types.NewAddress("1")])
+	assert.Empty(t, db.journal)
+}
+
+type fakeNotifier struct {
+	blocks map[uint64]int
+}
+
+func (n *fakeNotifier) Notify(addresses []types.Address, blocks []*types.Block) error {
+	for _, block := range blocks {
+		n.blocks[block.Number]++
+	}
+	return nil
+}
+
+type failingNotifier struct{}
+
+func (n *failingNotifier) Notify(addresses []types.Address, blocks []*types.Block) error {
+	return errors.New("webhook unavailable")
+}
+
+func TestEventNotifiers(t *testing.T) {
+	first, second := &fakeNotifier{blocks: make(map[uint64]int)}, &fakeNotifier{blocks: make(map[uint64]int)}
+	notifiers := EventNotifiers{first, &failingNotifier{}, second}
+
+	// the notifiers after one that fails are still told
+	assert.EqualError(t, notifiers.Notify(nil, []*types.Block{{Number: 1}}), "webhook unavailable")
+	assert.Equal(t, map[uint64]int{1: 1}, first.blocks)
+	assert.Equal(t, map[uint64]int{1: 1}, second.blocks)
+}
+
+func TestLanes(t *testing.T) {
+	address := types.NewAddress("1")
+	mockRPC := make(map[string]interface{})
+	for i := uint64(0); i <= 1510; i++ {
+		mockRPC[fmt.Sprintf("eth_storageRoot%s0x%x", address.String(), i)] = types.NewHash("1")
+	}
+	db := &FakeDB{
+		addresses:    []types.Address{address},
+		lastFiltered: map[types.Address]uint64{address: 0},
+	}
+	notifier := &fakeNotifier{blocks: make(map[uint64]int)}
+	fs := NewFilterService(db, client.NewStubQuorumClient(nil, mockRPC), notifier)
+
+	// far behind, so only the newest blocks are filtered, ahead of the last
+	// filtered block
+	assert.True(t, fs.filterNewBlocks(1500))
+	assert.EqualValues(t, 0, db.lastFiltered[address])
+	assert.Len(t, db.indexedAhead, headLaneWindow)
+	assert.EqualValues(t, 501, db.indexedAhead[0])
+	headFiltered, known := fs.HeadFiltered()
+	assert.True(t, known)
+	assert.EqualValues(t, 1500, headFiltered)
+	lastFiltered, _ := fs.LastFiltered()
+	assert.EqualValues(t, 0, lastFiltered)
+
+	// new blocks are still filtered ahead
+	assert.True(t, fs.filterNewBlocks(1505))
+	headFiltered, _ = fs.HeadFiltered()
+	assert.EqualValues(t, 1505, headFiltered)
+	assert.Len(t, db.indexedAhead, headLaneWindow+5)
+
+	// the backfill lane fills in the older blocks a chunk at a time
+	done, err := fs.backfillChunk()
+	assert.Nil(t, err)
+	assert.False(t, done)
+	assert.EqualValues(t, backfillLaneChunkSize, db.lastFiltered[address])
+	for !done {
+		done, err = fs.backfillChunk()
+		assert.Nil(t, err)
+	}
+	assert.EqualValues(t, 1505, db.lastFiltered[address])
+	lastFiltered, _ = fs.LastFiltered()
+	assert.EqualValues(t, 1505, lastFiltered)
+	aheadFrom, _ := fs.lanes.ahead()
+	assert.Zero(t, aheadFrom)
+
+	// every block is notified once
+	assert.Len(t, notifier.blocks, 1505)
+	for number, count := range notifier.blocks {
+		assert.Equal(t, 1, count, "block %d", number)
+	}
+
+	// caught up, so new blocks raise the last filtered block again
+	assert.True(t, fs.filterNewBlocks(1510))
+	assert.EqualValues(t, 1510, db.lastFiltered[address])
+	assert.Len(t, db.indexedAhead, headLaneWindow+5)
+}
+
+func TestLanes_Priority(t *testing.T) {
+	lanes := newLaneScheduler()
+	lanes.acquireBackfill()
+
+	// the head lane waits for the backfill lane's chunk, and goes before it
+	// takes another
+	order := make(chan string, 2)
+	headDone := make(chan struct{})
+	go func() {
+		lanes.acquireHead()
+		order <- "head"
+		lanes.release()
+		close(headDone)
+	}()
+	for {
+		lanes.mux.Lock()
+		waiting := lanes.headWaiting
+		lanes.mux.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	lanes.release()
+	lanes.acquireBackfill()
+	order <- "backfill"
+	lanes.release()
+	<-headDone
+
+	assert.Equal(t, "head", <-order)
+	assert.Equal(t, "backfill", <-order)
+}
@@ -1,11 +1,13 @@
 package filter
 
 import (
+	"encoding/json"
 	"runtime"
 	"sync"
 	"time"
 
 	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/core/storageparsing"
 	"quorumengineering/quorum-report/log"
 	"quorumengineering/quorum-report/types"
 )
@@ -13,6 +15,8 @@ import (
 type StorageFilter struct {
 	db           FilterServiceDB
 	quorumClient client.Client
+	// what reading each contract's storage costs, if tracked
+	costs *contractCosts
 
 	outstandingBlocks sync.WaitGroup
 	maxEntriesToSave  int
@@ -28,6 +32,9 @@ type AccountStateWithBlock struct {
 	BlockNumber  uint64
 	AccountState map[types.Address]*types.AccountState
 	Addresses    []types.Address
+	// Layouts are the storage layouts to decode the storage of each address
+	// with, if it has one
+	Layouts map[types.Address]*types.SolidityStorageDocument
 }
 
 func NewStorageFilter(db FilterServiceDB, quorumClient client.Client) *StorageFilter {
@@ -59,12 +66,14 @@ func NewStorageFilter(db FilterServiceDB, quorumClient client.Client) *StorageFi
 
 func (sf *StorageFilter) IndexStorage(addresses []types.Address, startBlockNumber, endBlockNumber uint64) error {
 	log.Info("Indexing storage", "start", startBlockNumber, "end", endBlockNumber)
+	layouts := sf.storageLayouts(addresses)
 	for i := startBlockNumber; i <= endBlockNumber; i++ {
 		sf.outstandingBlocks.Add(1)
 		emptyStorage := AccountStateWithBlock{
 			BlockNumber:  i,
 			AccountState: make(map[types.Address]*types.AccountState),
 			Addresses:    addresses,
+			Layouts:      layouts,
 		}
 		sf.incomingBlockChan <- emptyStorage
 	}
@@ -85,21 +94,35 @@ func (sf *StorageFilter) StateFetchWorker() {
 			case blockToPull := <-sf.incomingBlockChan:
 				log.Debug("Fetching contract storage", "block number", blockToPull.BlockNumber)
 				for _, address := range blockToPull.Addresses {
+					started := time.Now()
+					// two storage roots are read for each check
+					nodeCalls := uint64(2)
 					changed, err := sf.didStorageRootChange(address, blockToPull.BlockNumber)
 					for err != nil {
+						nodeCalls += 2
 						changed, err = sf.didStorageRootChange(address, blockToPull.BlockNumber)
 					}
 					if !changed {
+						sf.addCost(address, nodeCalls, started)
 						continue
 					}
 
 					log.Debug("Fetching contract storage", "address", address.String(), "block number", blockToPull.BlockNumber)
+					nodeCalls++
 					dumpAccount, err := client.DumpAddress(sf.quorumClient, address, blockToPull.BlockNumber)
 					for err != nil {
 						log.Error("Unable to fetch contract state", "address", address.String(), "block number", blockToPull.BlockNumber, "err", err)
 						time.Sleep(time.Second) //TODO: make adaptive or block until websocket available
+						nodeCalls++
 						dumpAccount, err = client.DumpAddress(sf.quorumClient, address, blockToPull.BlockNumber)
 					}
+					if layout, ok := blockToPull.Layouts[address]; ok {
+						decoded, err := storageparsing.DecodeStorageValues(dumpAccount.Storage, *layout)
+						if err != nil {
+							log.Warn("Unable to decode contract storage", "address", address.String(), "block number", blockToPull.BlockNumber, "err", err)
+						}
+						dumpAccount.Decoded = decoded
+					}
 					blockToPull.AccountState[address] = dumpAccount
 				}
 				sf.pulledStateChan <- blockToPull
@@ -108,6 +131,14 @@ func (sf *StorageFilter) StateFetchWorker() {
 	}()
 }
 
+// addCost records the node calls made for the address since started, and the
+// time taken, if costs are tracked
+func (sf *StorageFilter) addCost(address types.Address, nodeCalls uint64, started time.Time) {
+	if sf.costs != nil {
+		sf.costs.addStorage(address, nodeCalls, time.Since(started))
+	}
+}
+
 func (sf *StorageFilter) StateSavingWorker() {
 	go func() {
 		defer sf.shutdownWg.Done()
@@ -177,6 +208,25 @@ func (sf *StorageFilter) Stop() {
 	log.Info("Finished stopping storage filter")
 }
 
+// storageLayouts fetches the storage layouts of the addresses, leaving out
+// those without a usable one, whose storage is then only indexed raw
+func (sf *StorageFilter) storageLayouts(addresses []types.Address) map[types.Address]*types.SolidityStorageDocument {
+	layouts := make(map[types.Address]*types.SolidityStorageDocument)
+	for _, address := range addresses {
+		rawLayout, err := sf.db.GetStorageLayout(address)
+		if err != nil || rawLayout == "" {
+			continue
+		}
+		var layout types.SolidityStorageDocument
+		if err := json.Unmarshal([]byte(rawLayout), &layout); err != nil {
+			log.Warn("Unable to decode storage layout", "address", address.String(), "err", err)
+			continue
+		}
+		layouts[address] = &layout
+	}
+	return layouts
+}
+
 func (sf *StorageFilter) didStorageRootChange(contract types.Address, blockNum uint64) (bool, error) {
 	storageRootThisBlock, err := client.StorageRoot(sf.quorumClient, contract, blockNum)
 	if err != nil {
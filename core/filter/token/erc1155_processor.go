@@ -0,0 +1,211 @@
+package token
+
+import (
+	"math/big"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const erc1155AbiString = `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"_owner","type":"address"},{"indexed":true,"internalType":"address","name":"_operator","type":"address"},{"indexed":false,"internalType":"bool","name":"_approved","type":"bool"}],"name":"ApprovalForAll","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"_operator","type":"address"},{"indexed":true,"internalType":"address","name":"_from","type":"address"},{"indexed":true,"internalType":"address","name":"_to","type":"address"},{"indexed":false,"internalType":"uint256[]","name":"_ids","type":"uint256[]"},{"indexed":false,"internalType":"uint256[]","name":"_values","type":"uint256[]"}],"name":"TransferBatch","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"_operator","type":"address"},{"indexed":true,"internalType":"address","name":"_from","type":"address"},{"indexed":true,"internalType":"address","name":"_to","type":"address"},{"indexed":false,"internalType":"uint256","name":"_id","type":"uint256"},{"indexed":false,"internalType":"uint256","name":"_value","type":"uint256"}],"name":"TransferSingle","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"string","name":"_value","type":"string"},{"indexed":true,"internalType":"uint256","name":"_id","type":"uint256"}],"name":"URI","type":"event"},{"inputs":[{"internalType":"address","name":"_owner","type":"address"},{"internalType":"uint256","name":"_id","type":"uint256"}],"name":"balanceOf","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address[]","name":"_owners","type":"address[]"},{"internalType":"uint256[]","name":"_ids","type":"uint256[]"}],"name":"balanceOfBatch","outputs":[{"internalType":"uint256[]","name":"","type":"uint256[]"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"_owner","type":"address"},{"internalType":"address","name":"_operator","type":"address"}],"name":"isApprovedForAll","outputs":[{"internalType":"bool","name":"","type":"bool"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"_from","type":"address"},{"internalType":"address","name":"_to","type":"address"},{"internalType":"uint256[]","name":"_ids","type":"uint256[]"},{"internalType":"uint256[]","name":"_values","type":"uint256[]"},{"internalType":"bytes","name":"_data","type":"bytes"}],"name":"safeBatchTransferFrom","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"address","name":"_from","type":"address"},{"internalType":"address","name":"_to","type":"address"},{"internalType":"uint256","name":"_id","type":"uint256"},{"internalType":"uint256","name":"_value","type":"uint256"},{"internalType":"bytes","name":"_data","type":"bytes"}],"name":"safeTransferFrom","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"address","name":"_operator","type":"address"},{"internalType":"bool","name":"_approved","type":"bool"}],"name":"setApprovalForAll","outputs":[],"stateMutability":"nonpayable","type":"function"}]`
+
+var (
+	// erc1155TransferSingleTopicHash is the topic hash for an ERC1155 TransferSingle event
+	erc1155TransferSingleTopicHash = types.NewHash("0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62")
+	// erc1155TransferBatchTopicHash is the topic hash for an ERC1155 TransferBatch event
+	erc1155TransferBatchTopicHash = types.NewHash("0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb")
+	erc1155Abi, _                 = types.NewABIStructureFromJSON(erc1155AbiString)
+
+	zeroAddress = types.NewAddress("0x0000000000000000000000000000000000000000")
+)
+
+// ERC1155Balance identifies a single token balance of a holder on an ERC1155 contract
+type ERC1155Balance struct {
+	Contract types.Address
+	Holder   types.Address
+	TokenId  string
+}
+
+type ERC1155Processor struct {
+	db     TokenFilterDatabase
+	client client.Client
+}
+
+func NewERC1155Processor(database TokenFilterDatabase, client client.Client) *ERC1155Processor {
+	return &ERC1155Processor{db: database, client: client}
+}
+
+func (p *ERC1155Processor) ProcessBlock(lastFilteredWithAbi map[types.Address]string, block *types.Block) error {
+	erc1155Contracts := p.filterForErc1155Contracts(lastFilteredWithAbi)
+
+	changedBalances := make(map[ERC1155Balance]bool)
+	for _, tx := range block.Transactions {
+		transaction, err := p.db.ReadTransaction(tx)
+		if err != nil {
+			return err
+		}
+
+		erc1155Events := p.filterForErc1155Events(erc1155Contracts, transaction.Events)
+		for balance := range p.ChangedBalances(erc1155Events) {
+			changedBalances[balance] = true
+		}
+	}
+
+	return p.UpdateBalances(changedBalances, block.Number)
+}
+
+func (p *ERC1155Processor) UpdateBalances(changedBalances map[ERC1155Balance]bool, blockNum uint64) error {
+	for changed := range changedBalances {
+		tokenId, _ := new(big.Int).SetString(changed.TokenId, 10)
+
+		bal, err := client.CallBalanceOfERC1155(p.client, changed.Contract, changed.Holder, tokenId, blockNum)
+		if err != nil {
+			return err
+		}
+
+		balance := new(big.Int).SetBytes(bal.AsBytes())
+		if err := p.db.RecordNewERC1155Balance(changed.Contract, changed.Holder, tokenId, blockNum, balance); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChangedBalances returns the sender and recipient balances of every token
+// moved by the given TransferSingle and TransferBatch events
+func (p *ERC1155Processor) ChangedBalances(erc1155TransferEvents []*types.Event) map[ERC1155Balance]bool {
+	changedBalances := make(map[ERC1155Balance]bool)
+
+	for _, event := range erc1155TransferEvents {
+		fromAddress := types.NewAddress(string(event.Topics[2])[24:64]) //only take the last 40 chars (20 bytes)
+		toAddress := types.NewAddress(string(event.Topics[3])[24:64])   //only take the last 40 chars (20 bytes)
+
+		var tokenIds []*big.Int
+		if event.Topics[0] == erc1155TransferSingleTopicHash {
+			tokenIds = decodeTransferSingleIds(event.Data.AsBytes())
+		} else {
+			tokenIds = decodeTransferBatchIds(event.Data.AsBytes())
+		}
+		if tokenIds == nil {
+			log.Warn("Could not decode ERC1155 transfer event", "contract", event.Address.String(), "tx", event.TransactionHash.String())
+			continue
+		}
+
+		// mints and burns are transfers from/to the zero address, which
+		// cannot hold tokens and whose balance cannot be queried
+		for _, holder := range []types.Address{fromAddress, toAddress} {
+			if holder == zeroAddress {
+				continue
+			}
+			for _, tokenId := range tokenIds {
+				changedBalances[ERC1155Balance{Contract: event.Address, Holder: holder, TokenId: tokenId.String()}] = true
+			}
+		}
+	}
+
+	return changedBalances
+}
+
+// filterForErc1155Events filters out all non-ERC1155 transfer events, returning
+// on the events we are interested in processing further
+func (p *ERC1155Processor) filterForErc1155Events(lastFiltered map[types.Address]bool, events []*types.Event) []*types.Event {
+	erc1155TransferEvents := make([]*types.Event, 0, len(events))
+	for _, event := range events {
+		isErc1155Transfer := (len(event.Topics) == 4) &&
+			(event.Topics[0] == erc1155TransferSingleTopicHash || event.Topics[0] == erc1155TransferBatchTopicHash)
+		if lastFiltered[event.Address] && isErc1155Transfer {
+			erc1155TransferEvents = append(erc1155TransferEvents, event)
+		}
+	}
+	return erc1155TransferEvents
+}
+
+func (p *ERC1155Processor) filterForErc1155Contracts(contractsWithAbi map[types.Address]string) map[types.Address]bool {
+	erc1155Contracts := make(map[types.Address]bool)
+
+	for address, abi := range contractsWithAbi {
+		contractAbi, _ := types.NewABIStructureFromJSON(abi)
+		isErc1155 := isErc1155(contractAbi)
+
+		if isErc1155 {
+			erc1155Contracts[address] = true
+		}
+	}
+
+	return erc1155Contracts
+}
+
+// decodeTransferSingleIds reads the token ID from TransferSingle event data,
+// which is the ABI encoding of (uint256 id, uint256 value)
+func decodeTransferSingleIds(data []byte) []*big.Int {
+	if len(data) < 64 {
+		return nil
+	}
+	return []*big.Int{new(big.Int).SetBytes(data[0:32])}
+}
+
+// decodeTransferBatchIds reads the token IDs from TransferBatch event data,
+// which is the ABI encoding of (uint256[] ids, uint256[] values)
+func decodeTransferBatchIds(data []byte) []*big.Int {
+	return decodeUint256Array(data, 0)
+}
+
+// decodeTransferBatchValues reads the amounts from TransferBatch event data
+func decodeTransferBatchValues(data []byte) []*big.Int {
+	return decodeUint256Array(data, 1)
+}
+
+// decodeUint256Array reads the uint256[] that is the given argument of ABI
+// encoded data
+func decodeUint256Array(data []byte, argument int) []*big.Int {
+	if len(data) < 64 {
+		return nil
+	}
+	// the argument's word is the offset of the array, which starts with its length
+	offset := new(big.Int).SetBytes(data[argument*32 : argument*32+32])
+	if !offset.IsUint64() || offset.Uint64()+32 > uint64(len(data)) {
+		return nil
+	}
+	start := offset.Uint64()
+	length := new(big.Int).SetBytes(data[start : start+32])
+	start += 32
+	if !length.IsUint64() || length.Uint64() > (uint64(len(data))-start)/32 {
+		return nil
+	}
+
+	values := make([]*big.Int, length.Uint64())
+	for i := range values {
+		values[i] = new(big.Int).SetBytes(data[start : start+32])
+		start += 32
+	}
+	return values
+}
+
+func isErc1155(contractAbi types.ABIStructure) bool {
+	for _, erc1155Event := range erc1155Abi.ToInternalABI().Events {
+		found := false
+		for _, contractEvent := range contractAbi.ToInternalABI().Events {
+			if erc1155Event.Signature() == contractEvent.Signature() {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for _, erc1155Method := range erc1155Abi.ToInternalABI().Functions {
+		found := false
+		for _, contractMethod := range contractAbi.ToInternalABI().Functions {
+			if erc1155Method.Signature() == contractMethod.Signature() {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
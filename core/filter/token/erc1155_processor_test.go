@@ -0,0 +1,129 @@
+package token
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/types"
+)
+
+var testErc1155TokenBlock = &types.Block{
+	Number:       1,
+	Hash:         types.NewHash("0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8"),
+	Transactions: []types.Hash{"f4f803b8d6c6b38e0b15d6cfe80fd1dcea4270ad24e93385fca36512bb9c2c59"},
+}
+
+func TestERC1155Processor_ProcessBlock_TxReadFail(t *testing.T) {
+	db := NewFakeTestTokenDatabase(errors.New("test tx read fail"), []*types.Transaction{})
+	processor := NewERC1155Processor(db, nil)
+
+	err := processor.ProcessBlock(map[types.Address]string{}, testErc1155TokenBlock)
+
+	assert.EqualError(t, err, "test tx read fail")
+}
+
+func TestERC1155Processor_ProcessBlock_TransferSingle(t *testing.T) {
+	tokenAddress := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	tx := &types.Transaction{
+		Hash:        types.NewHash("0xf4f803b8d6c6b38e0b15d6cfe80fd1dcea4270ad24e93385fca36512bb9c2c59"),
+		BlockNumber: 1,
+		Events: []*types.Event{
+			{
+				// id 5, value 1000
+				Data:    types.NewHexData("0x000000000000000000000000000000000000000000000000000000000000000500000000000000000000000000000000000000000000000000000000000003e8"),
+				Address: tokenAddress,
+				Topics: []types.Hash{
+					"c3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62",
+					"000000000000000000000000ed9d02e382b34818e88b88a309c7fe71e65f419d",
+					"000000000000000000000000ed9d02e382b34818e88b88a309c7fe71e65f419d",
+					"0000000000000000000000001349f3e1b8d71effb47b840594ff27da7e603d17",
+				},
+			},
+		},
+	}
+
+	db := NewFakeTestTokenDatabase(nil, []*types.Transaction{tx})
+	stubClient := client.NewStubQuorumClient(nil, map[string]interface{}{
+		"eth_call<types.EIP165Call Value>0x1": types.NewHexData("0x12345"),
+	})
+	processor := NewERC1155Processor(db, stubClient)
+
+	err := processor.ProcessBlock(map[types.Address]string{tokenAddress: erc1155AbiString}, testErc1155TokenBlock)
+
+	assert.Nil(t, err)
+	assert.Len(t, db.RecordedHolder, 2)
+	assert.Contains(t, db.RecordedHolder, types.NewAddress("ed9d02e382b34818e88b88a309c7fe71e65f419d"))
+	assert.Contains(t, db.RecordedHolder, types.NewAddress("1349f3e1b8d71effb47b840594ff27da7e603d17"))
+	assert.EqualValues(t, 1, db.RecordedBlock)
+	assert.EqualValues(t, big.NewInt(4660), db.RecordedToken[0])
+}
+
+func TestERC1155Processor_ChangedBalances_TransferBatchMint(t *testing.T) {
+	tokenAddress := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	tx := &types.Transaction{
+		Hash:        types.NewHash("0xf4f803b8d6c6b38e0b15d6cfe80fd1dcea4270ad24e93385fca36512bb9c2c59"),
+		BlockNumber: 1,
+		Events: []*types.Event{
+			{
+				// ids [1, 2], values [10, 20]
+				Data: types.NewHexData("0x" +
+					"0000000000000000000000000000000000000000000000000000000000000040" +
+					"00000000000000000000000000000000000000000000000000000000000000a0" +
+					"0000000000000000000000000000000000000000000000000000000000000002" +
+					"0000000000000000000000000000000000000000000000000000000000000001" +
+					"0000000000000000000000000000000000000000000000000000000000000002" +
+					"0000000000000000000000000000000000000000000000000000000000000002" +
+					"000000000000000000000000000000000000000000000000000000000000000a" +
+					"0000000000000000000000000000000000000000000000000000000000000014"),
+				Address: tokenAddress,
+				Topics: []types.Hash{
+					"4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb",
+					"000000000000000000000000ed9d02e382b34818e88b88a309c7fe71e65f419d",
+					"0000000000000000000000000000000000000000000000000000000000000000",
+					"0000000000000000000000001349f3e1b8d71effb47b840594ff27da7e603d17",
+				},
+			},
+		},
+	}
+
+	processor := NewERC1155Processor(nil, nil)
+
+	// the zero address sender is skipped, so only the recipient's balances change
+	changed := processor.ChangedBalances(tx.Events)
+	assert.Equal(t, map[ERC1155Balance]bool{
+		{Contract: tokenAddress, Holder: types.NewAddress("1349f3e1b8d71effb47b840594ff27da7e603d17"), TokenId: "1"}: true,
+		{Contract: tokenAddress, Holder: types.NewAddress("1349f3e1b8d71effb47b840594ff27da7e603d17"), TokenId: "2"}: true,
+	}, changed)
+}
+
+func TestERC1155Processor_ProcessBlock_NonErc1155Contract(t *testing.T) {
+	tokenAddress := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	tx := &types.Transaction{
+		Hash:        types.NewHash("0xf4f803b8d6c6b38e0b15d6cfe80fd1dcea4270ad24e93385fca36512bb9c2c59"),
+		BlockNumber: 1,
+		Events: []*types.Event{
+			{
+				Data:    types.NewHexData("0x000000000000000000000000000000000000000000000000000000000000000500000000000000000000000000000000000000000000000000000000000003e8"),
+				Address: tokenAddress,
+				Topics: []types.Hash{
+					"c3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62",
+					"000000000000000000000000ed9d02e382b34818e88b88a309c7fe71e65f419d",
+					"000000000000000000000000ed9d02e382b34818e88b88a309c7fe71e65f419d",
+					"0000000000000000000000001349f3e1b8d71effb47b840594ff27da7e603d17",
+				},
+			},
+		},
+	}
+
+	db := NewFakeTestTokenDatabase(nil, []*types.Transaction{tx})
+	processor := NewERC1155Processor(db, nil)
+
+	err := processor.ProcessBlock(map[types.Address]string{tokenAddress: erc20AbiString}, testErc1155TokenBlock)
+
+	assert.Nil(t, err)
+	assert.Len(t, db.RecordedHolder, 0)
+}
@@ -12,9 +12,17 @@ const erc20AbiString = `[{"constant":false,"inputs":[{"name":"_spender","type":"
 var (
 	// erc20TransferTopicHash is the topic hash for an ERC20 Transfer event
 	erc20TransferTopicHash = types.NewHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	// erc20ApprovalTopicHash is the topic hash for an ERC20 Approval event
+	erc20ApprovalTopicHash = types.NewHash("0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925")
 	erc20Abi, _            = types.NewABIStructureFromJSON(erc20AbiString)
 )
 
+// allowanceKey is the owner and spender of an allowance
+type allowanceKey struct {
+	owner   types.Address
+	spender types.Address
+}
+
 type ERC20Processor struct {
 	db     TokenFilterDatabase
 	client client.Client
@@ -26,6 +34,8 @@ func NewERC20Processor(database TokenFilterDatabase, client client.Client) *ERC2
 
 func (p *ERC20Processor) ProcessBlock(lastFilteredWithAbi map[types.Address]string, block *types.Block) error {
 	addressesWithChangedBalances := make(map[types.Address]map[types.Address]bool)
+	// the last approval in the block is the allowance at the end of it
+	approvedAllowances := make(map[types.Address]map[allowanceKey]*big.Int)
 	erc20Contracts := p.filterForErc20Contracts(lastFilteredWithAbi)
 
 	for _, tx := range block.Transactions {
@@ -44,9 +54,23 @@ func (p *ERC20Processor) ProcessBlock(lastFilteredWithAbi map[types.Address]stri
 				addressesWithChangedBalances[contract][holder] = true
 			}
 		}
+
+		for _, event := range p.filterForErc20Approvals(erc20Contracts, transaction.Events) {
+			if approvedAllowances[event.Address] == nil {
+				approvedAllowances[event.Address] = make(map[allowanceKey]*big.Int)
+			}
+			key := allowanceKey{
+				owner:   types.NewAddress(string(event.Topics[1])[24:64]),
+				spender: types.NewAddress(string(event.Topics[2])[24:64]),
+			}
+			approvedAllowances[event.Address][key] = new(big.Int).SetBytes(event.Data.AsBytes())
+		}
 	}
 
-	return p.UpdateBalances(addressesWithChangedBalances, block.Number)
+	if err := p.UpdateBalances(addressesWithChangedBalances, block.Number); err != nil {
+		return err
+	}
+	return p.UpdateAllowances(approvedAllowances, block.Number)
 }
 
 func (p *ERC20Processor) filterForErc20Contracts(contractsWithAbi map[types.Address]string) map[types.Address]bool {
@@ -81,6 +105,18 @@ func (p *ERC20Processor) UpdateBalances(addressesWithChangedBalances map[types.A
 	return nil
 }
 
+// UpdateAllowances records the allowances approved in the block
+func (p *ERC20Processor) UpdateAllowances(approvedAllowances map[types.Address]map[allowanceKey]*big.Int, blockNum uint64) error {
+	for contract, allowances := range approvedAllowances {
+		for key, amount := range allowances {
+			if err := p.db.RecordERC20Allowance(contract, key.owner, key.spender, blockNum, amount); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // ChangedTokenHolders filters through all events in the transaction and
 // returns a list of all the token holders who have had a balance change
 func (p *ERC20Processor) ChangedTokenHolders(lastFilteredWithAbi map[types.Address]bool, tx *types.Transaction) map[types.Address]map[types.Address]bool {
@@ -123,6 +159,19 @@ func (p *ERC20Processor) filterForErc20Events(lastFiltered map[types.Address]boo
 	return erc20TransferEvents
 }
 
+// filterForErc20Approvals returns the ERC20 Approval events of the tracked
+// contracts, in the order they were emitted
+func (p *ERC20Processor) filterForErc20Approvals(lastFiltered map[types.Address]bool, events []*types.Event) []*types.Event {
+	approvalEvents := make([]*types.Event, 0, len(events))
+	for _, event := range events {
+		isErc20Approval := (len(event.Topics) == 3) && (event.Topics[0] == erc20ApprovalTopicHash)
+		if lastFiltered[event.Address] && isErc20Approval {
+			approvalEvents = append(approvalEvents, event)
+		}
+	}
+	return approvalEvents
+}
+
 func isErc20(contractAbi types.ABIStructure) bool {
 	for _, erc20Event := range erc20Abi.ToInternalABI().Events {
 		found := false
@@ -127,6 +127,45 @@ func TestERC20Processor_ProcessBlock_SingleErc20Event(t *testing.T) {
 	assert.EqualValues(t, db.RecordedToken[1], big.NewInt(4660)) //TODO: improve stub client to return different value for second account
 }
 
+func TestERC20Processor_ProcessBlock_Approvals(t *testing.T) {
+	tokenAddress := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	approval := func(amount string) *types.Event {
+		return &types.Event{
+			Data:    types.NewHexData(amount),
+			Address: tokenAddress,
+			Topics: []types.Hash{
+				"8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925",
+				"000000000000000000000000ed9d02e382b34818e88b88a309c7fe71e65f419d",
+				"0000000000000000000000001349f3e1b8d71effb47b840594ff27da7e603d17",
+			},
+		}
+	}
+	tx := &types.Transaction{
+		Hash:        types.NewHash("0xf4f803b8d6c6b38e0b15d6cfe80fd1dcea4270ad24e93385fca36512bb9c2c59"),
+		BlockNumber: 1,
+		Events: []*types.Event{
+			approval("0x00000000000000000000000000000000000000000000000000000000000003e8"),
+			approval("0x00000000000000000000000000000000000000000000000000000000000001f4"),
+		},
+	}
+
+	db := NewFakeTestTokenDatabase(nil, []*types.Transaction{tx})
+	processor := NewERC20Processor(db, nil)
+
+	err := processor.ProcessBlock(map[types.Address]string{tokenAddress: erc20AbiString}, testErc20TokenBlock)
+
+	// only the last approval in the block is recorded, and no balances
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Address{tokenAddress}, db.RecordedContract)
+	assert.Empty(t, db.RecordedToken)
+	assert.Equal(t, []*types.ERC20Allowance{{
+		Owner:       types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d"),
+		Spender:     types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17"),
+		Amount:      big.NewInt(500),
+		BlockNumber: 1,
+	}}, db.RecordedAllowances)
+}
+
 func TestERC20Processor_ProcessBlock_SingleErc20EventOnNonErc20Contract(t *testing.T) {
 	tokenAddress := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
 	tx := &types.Transaction{
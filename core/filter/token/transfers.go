@@ -0,0 +1,66 @@
+package token
+
+import (
+	"math/big"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// TokenTransfers decodes the token movements recorded by an ERC20 or ERC721
+// Transfer event, or an ERC1155 TransferSingle or TransferBatch event. Other
+// events, and transfer events that can't be decoded, give no transfers.
+func TokenTransfers(event *types.Event) []*types.TokenTransfer {
+	if len(event.Topics) < 3 {
+		return nil
+	}
+	newTransfer := func(standard string, from, to types.Hash, tokenId *big.Int, amount *big.Int) *types.TokenTransfer {
+		return &types.TokenTransfer{
+			Standard:         standard,
+			Contract:         event.Address,
+			From:             types.NewAddress(string(from)[24:64]), //only take the last 40 chars (20 bytes)
+			To:               types.NewAddress(string(to)[24:64]),
+			TokenId:          tokenId,
+			Amount:           amount,
+			BlockNumber:      event.BlockNumber,
+			TransactionHash:  event.TransactionHash,
+			TransactionIndex: event.TransactionIndex,
+			EventIndex:       event.Index,
+			Timestamp:        event.Timestamp,
+		}
+	}
+
+	data := event.Data.AsBytes()
+	switch {
+	case len(event.Topics) == 3 && event.Topics[0] == erc20TransferTopicHash:
+		// the amount is the only data of an ERC20 transfer
+		if len(data) < 32 {
+			return nil
+		}
+		amount := new(big.Int).SetBytes(data[0:32])
+		return []*types.TokenTransfer{newTransfer(types.ERC20Standard, event.Topics[1], event.Topics[2], nil, amount)}
+	case len(event.Topics) == 4 && event.Topics[0] == erc721TransferTopicHash:
+		// the token ID is indexed for an ERC721 transfer
+		tokenIdHex := types.NewHexData(event.Topics[3].String())
+		tokenId := new(big.Int).SetBytes(tokenIdHex.AsBytes())
+		return []*types.TokenTransfer{newTransfer(types.ERC721Standard, event.Topics[1], event.Topics[2], tokenId, big.NewInt(1))}
+	case len(event.Topics) == 4 && event.Topics[0] == erc1155TransferSingleTopicHash:
+		if len(data) < 64 {
+			return nil
+		}
+		tokenId := new(big.Int).SetBytes(data[0:32])
+		amount := new(big.Int).SetBytes(data[32:64])
+		return []*types.TokenTransfer{newTransfer(types.ERC1155Standard, event.Topics[2], event.Topics[3], tokenId, amount)}
+	case len(event.Topics) == 4 && event.Topics[0] == erc1155TransferBatchTopicHash:
+		tokenIds := decodeTransferBatchIds(data)
+		amounts := decodeTransferBatchValues(data)
+		if tokenIds == nil || len(tokenIds) != len(amounts) {
+			return nil
+		}
+		transfers := make([]*types.TokenTransfer, len(tokenIds))
+		for i := range tokenIds {
+			transfers[i] = newTransfer(types.ERC1155Standard, event.Topics[2], event.Topics[3], tokenIds[i], amounts[i])
+		}
+		return transfers
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package token
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+func TestTokenTransfers(t *testing.T) {
+	from := types.NewHash("0x000000000000000000000000000000000000000000000000000000000000000a")
+	to := types.NewHash("0x000000000000000000000000000000000000000000000000000000000000000b")
+
+	erc721 := &types.Event{
+		Topics: []types.Hash{erc721TransferTopicHash, from, to, types.NewHash("0x0000000000000000000000000000000000000000000000000000000000000007")},
+	}
+	transfers := TokenTransfers(erc721)
+	assert.Len(t, transfers, 1)
+	assert.Equal(t, types.ERC721Standard, transfers[0].Standard)
+	assert.Equal(t, types.NewAddress("0x000000000000000000000000000000000000000a"), transfers[0].From)
+	assert.Equal(t, big.NewInt(7), transfers[0].TokenId)
+	assert.Equal(t, big.NewInt(1), transfers[0].Amount)
+
+	// ids [1, 2] and values [10, 20]
+	batch := &types.Event{
+		Topics: []types.Hash{erc1155TransferBatchTopicHash, from, from, to},
+		Data: types.NewHexData("0x" +
+			"0000000000000000000000000000000000000000000000000000000000000040" +
+			"00000000000000000000000000000000000000000000000000000000000000a0" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"000000000000000000000000000000000000000000000000000000000000000a" +
+			"0000000000000000000000000000000000000000000000000000000000000014"),
+	}
+	transfers = TokenTransfers(batch)
+	assert.Len(t, transfers, 2)
+	assert.Equal(t, types.ERC1155Standard, transfers[1].Standard)
+	assert.Equal(t, types.NewAddress("0x000000000000000000000000000000000000000b"), transfers[1].To)
+	assert.Equal(t, big.NewInt(2), transfers[1].TokenId)
+	assert.Equal(t, big.NewInt(20), transfers[1].Amount)
+
+	// not a transfer, or not decodable
+	assert.Len(t, TokenTransfers(&types.Event{Topics: []types.Hash{erc1155TransferSingleTopicHash, from, from, to}}), 0)
+	assert.Len(t, TokenTransfers(&types.Event{Topics: []types.Hash{erc20TransferTopicHash, from, to}}), 0)
+}
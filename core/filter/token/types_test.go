@@ -26,6 +26,8 @@ type FakeTestTokenDatabase struct {
 	RecordedHolder   []types.Address
 	RecordedBlock    uint64
 	RecordedToken    []*big.Int
+
+	RecordedAllowances []*types.ERC20Allowance
 }
 
 func (db *FakeTestTokenDatabase) RecordNewERC20Balance(contract types.Address, holder types.Address, block uint64, amount *big.Int) error {
@@ -39,6 +41,16 @@ func (db *FakeTestTokenDatabase) RecordNewERC20Balance(contract types.Address, h
 	return nil
 }
 
+func (db *FakeTestTokenDatabase) RecordERC20Allowance(contract types.Address, owner types.Address, spender types.Address, block uint64, amount *big.Int) error {
+	if db.testErr != nil {
+		return db.testErr
+	}
+	db.RecordedContract = append(db.RecordedContract, contract)
+	db.RecordedBlock = block
+	db.RecordedAllowances = append(db.RecordedAllowances, &types.ERC20Allowance{Owner: owner, Spender: spender, Amount: amount, BlockNumber: block})
+	return nil
+}
+
 func (db *FakeTestTokenDatabase) RecordERC721Token(contract types.Address, holder types.Address, block uint64, tokenId *big.Int) error {
 	if db.testErr != nil {
 		return db.testErr
@@ -50,6 +62,17 @@ func (db *FakeTestTokenDatabase) RecordERC721Token(contract types.Address, holde
 	return nil
 }
 
+func (db *FakeTestTokenDatabase) RecordNewERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, block uint64, amount *big.Int) error {
+	if db.testErr != nil {
+		return db.testErr
+	}
+	db.RecordedContract = append(db.RecordedContract, contract)
+	db.RecordedHolder = append(db.RecordedHolder, holder)
+	db.RecordedBlock = block
+	db.RecordedToken = append(db.RecordedToken, amount)
+	return nil
+}
+
 func (db *FakeTestTokenDatabase) ReadTransaction(hash types.Hash) (*types.Transaction, error) {
 	if db.testErr != nil {
 		return nil, db.testErr
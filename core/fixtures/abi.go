@@ -0,0 +1,166 @@
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// dynamicArrayLength is the number of elements generated for T[] values
+const dynamicArrayLength = 2
+
+var twoTo256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// argumentEncoder ABI encodes synthetic values derived from a seed. Addresses
+// are picked from the accounts if there are any, as on a network with a set
+// of users, or are derived from the seed too.
+type argumentEncoder struct {
+	accounts []types.Address
+}
+
+// encodeArguments ABI encodes synthetic values for the arguments, the heads of
+// all arguments followed by the tails of the dynamic ones. Each argument's
+// value is derived from the seed and its position.
+func (e argumentEncoder) encodeArguments(args []types.ContractABIArgument, seed uint64) ([]byte, error) {
+	encoded := make([][]byte, 0, len(args))
+	headSize := 0
+	for i, arg := range args {
+		value, err := e.encodeArgument(arg, seed+uint64(i))
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, value)
+		if arg.IsDynamic() {
+			headSize += 32
+		} else {
+			headSize += len(value)
+		}
+	}
+
+	var head, tail []byte
+	for i, arg := range args {
+		if arg.IsDynamic() {
+			head = append(head, word(big.NewInt(int64(headSize+len(tail))))...)
+			tail = append(tail, encoded[i]...)
+		} else {
+			head = append(head, encoded[i]...)
+		}
+	}
+	return append(head, tail...), nil
+}
+
+// encodeArgument ABI encodes a synthetic value for a single argument, as it
+// would appear in the tail if it is dynamic
+func (e argumentEncoder) encodeArgument(arg types.ContractABIArgument, seed uint64) ([]byte, error) {
+	// arrays are encoded as a tuple of their elements, prefixed with the
+	// number of elements if they are dynamically sized
+	if strings.HasSuffix(arg.Type, "]") {
+		start := strings.LastIndex(arg.Type, "[")
+		length := uint64(dynamicArrayLength)
+		if size := arg.Type[start+1 : len(arg.Type)-1]; size != "" {
+			var err error
+			if length, err = strconv.ParseUint(size, 10, 0); err != nil {
+				return nil, fmt.Errorf("invalid array size in type %s", arg.Type)
+			}
+		}
+		elements := make([]types.ContractABIArgument, length)
+		for i := range elements {
+			elements[i] = types.ContractABIArgument{Name: arg.Name, Type: arg.Type[:start], Components: arg.Components}
+		}
+		encoded, err := e.encodeArguments(elements, seed)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(arg.Type, "[]") {
+			return append(word(new(big.Int).SetUint64(length)), encoded...), nil
+		}
+		return encoded, nil
+	}
+
+	switch {
+	case arg.Type == "tuple":
+		return e.encodeArguments(arg.Components, seed)
+	case arg.Type == "string":
+		return encodeBytes([]byte(fmt.Sprintf("%s %d", valueName(arg), seed))), nil
+	case arg.Type == "bytes":
+		return encodeBytes([]byte{byte(seed), byte(seed + 1), byte(seed + 2)}), nil
+	case arg.Type == "bool":
+		return word(big.NewInt(int64(seed % 2))), nil
+	case strings.HasPrefix(arg.Type, "address"):
+		return word(e.address(seed)), nil
+	case strings.HasPrefix(arg.Type, "uint"):
+		return word(uintValue(seed)), nil
+	case strings.HasPrefix(arg.Type, "int"):
+		// negative values are two's complement
+		value := intValue(seed)
+		if value.Sign() < 0 {
+			value.Add(value, twoTo256)
+		}
+		return word(value), nil
+	case strings.HasPrefix(arg.Type, "bytes"):
+		size, err := strconv.ParseUint(arg.Type[5:], 10, 0)
+		if err != nil || size == 0 || size > 32 {
+			return nil, fmt.Errorf("invalid fixed size bytes type %s", arg.Type)
+		}
+		// fixed size bytes are right padded
+		encoded := make([]byte, 32)
+		for i := uint64(0); i < size; i++ {
+			encoded[i] = byte(seed + 1)
+		}
+		return encoded, nil
+	}
+	return nil, errors.New("unsupported type: " + arg.Type)
+}
+
+// encodeBytes encodes the length of the data, followed by the data right
+// padded to a multiple of 32 bytes
+func encodeBytes(data []byte) []byte {
+	padded := make([]byte, (len(data)+31)/32*32)
+	copy(padded, data)
+	return append(word(big.NewInt(int64(len(data)))), padded...)
+}
+
+// word left pads a non-negative value to 32 bytes
+func word(value *big.Int) []byte {
+	encoded := make([]byte, 32)
+	bytes := value.Bytes()
+	copy(encoded[32-len(bytes):], bytes)
+	return encoded
+}
+
+func valueName(arg types.ContractABIArgument) string {
+	if arg.Name == "" {
+		return "value"
+	}
+	return arg.Name
+}
+
+// the synthetic values are small, so they fit any size of integer
+
+func uintValue(seed uint64) *big.Int {
+	return new(big.Int).SetUint64(seed%100 + 1)
+}
+
+func intValue(seed uint64) *big.Int {
+	value := uintValue(seed)
+	if seed%2 == 1 {
+		value.Neg(value)
+	}
+	return value
+}
+
+func (e argumentEncoder) address(seed uint64) *big.Int {
+	if len(e.accounts) == 0 {
+		return addressValue(seed)
+	}
+	value, _ := new(big.Int).SetString(string(e.accounts[seed%uint64(len(e.accounts))]), 16)
+	return value
+}
+
+func addressValue(seed uint64) *big.Int {
+	return new(big.Int).SetUint64(0xa000 + seed)
+}
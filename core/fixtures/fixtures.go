@@ -0,0 +1,343 @@
+package fixtures
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/types"
+)
+
+// BlockPeriod is how many seconds apart generated blocks are
+const BlockPeriod = 5
+
+const (
+	// blocks generated by Generate start from the base timestamp
+	baseTimestamp = 1600000000
+
+	gasLimit = 10000000
+	gasUsed  = 50000
+
+	// deployBytecode stands in for the contract code in deployment
+	// transactions, ending in the solc < 0.5.10 metadata that the constructor
+	// arguments are expected after
+	deployBytecode = "6080604052348015600f57600080fd5b50" + "a165627a7a72305820" +
+		"00000000000000000000000000000000000000000000000000000000000000000029"
+)
+
+// sender sends all generated transactions
+var sender = types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d")
+
+// Contract is a contract to generate data for, deployed at the address.
+type Contract struct {
+	Address  types.Address
+	Template *types.Template
+}
+
+// Fixtures is synthetic chain data for a set of contracts.
+type Fixtures struct {
+	Blocks       []*types.Block
+	Transactions []*types.Transaction
+	// the storage of each contract at each block
+	Storage map[uint64]map[types.Address]*types.AccountState
+	// the transaction each contract was deployed in
+	CreationTransactions map[types.Hash][]types.Address
+	// the token balances and holders that changed in each block, for the
+	// tokens the generated transfers keep track of
+	ERC20Balances []*ERC20Balance
+	ERC721Tokens  []*ERC721Token
+}
+
+// ERC20Balance is the balance of a holder of a token from a block
+type ERC20Balance struct {
+	Contract types.Address
+	Holder   types.Address
+	Block    uint64
+	Balance  *big.Int
+}
+
+// ERC721Token is the holder of a token from a block
+type ERC721Token struct {
+	Contract types.Address
+	Holder   types.Address
+	Block    uint64
+	TokenID  *big.Int
+}
+
+// contractTemplate is a contract with its parsed template
+type contractTemplate struct {
+	address types.Address
+	abi     *types.ContractABI
+	layout  *types.SolidityStorageDocument
+}
+
+type generator struct {
+	fixtures *Fixtures
+	encoder  argumentEncoder
+	nonce    uint64
+	// index of the next event in the block
+	logIndex uint64
+}
+
+// Generate creates blocks of synthetic data for the contracts. The contracts
+// are deployed in the first block, with constructor arguments generated from
+// their ABI. Each block after has a transaction calling every function of
+// each contract, the first of which emits every event in the ABI. Storage
+// variables in the layout are set at each block, with values changing from
+// block to block. Values are derived from the block and position, so the same
+// templates always generate the same data.
+func Generate(contracts []Contract, blockCount uint64) (*Fixtures, error) {
+	if blockCount == 0 {
+		return nil, errors.New("at least one block must be generated")
+	}
+	parsed, err := parseContracts(contracts)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{fixtures: newFixtures()}
+	parentHash := types.NewHash("")
+	for number := uint64(1); number <= blockCount; number++ {
+		block := g.block(number, parentHash, baseTimestamp+number*BlockPeriod)
+		for _, contract := range parsed {
+			var err error
+			if number == 1 {
+				err = g.deploy(block, contract)
+			} else {
+				err = g.call(block, contract)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if contract.layout != nil {
+				g.fixtures.Storage[number][contract.address] = &types.AccountState{
+					Root:    hashOf("storage-%s-%d", contract.address, number),
+					Storage: generateStorage(*contract.layout, number),
+				}
+			}
+		}
+		block.GasUsed = gasUsed * uint64(len(block.Transactions))
+		g.fixtures.Blocks = append(g.fixtures.Blocks, block)
+		parentHash = block.Hash
+	}
+	return g.fixtures, nil
+}
+
+func parseContracts(contracts []Contract) ([]*contractTemplate, error) {
+	parsed := make([]*contractTemplate, 0, len(contracts))
+	for _, contract := range contracts {
+		structure, err := types.NewABIStructureFromJSON(contract.Template.ABI)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse ABI of template %s: %v", contract.Template.TemplateName, err)
+		}
+		parsedContract := &contractTemplate{address: contract.Address, abi: structure.ToInternalABI()}
+		if contract.Template.StorageLayout != "" {
+			parsedContract.layout = &types.SolidityStorageDocument{}
+			if err := json.Unmarshal([]byte(contract.Template.StorageLayout), parsedContract.layout); err != nil {
+				return nil, fmt.Errorf("could not parse storage layout of template %s: %v", contract.Template.TemplateName, err)
+			}
+		}
+		parsed = append(parsed, parsedContract)
+	}
+	return parsed, nil
+}
+
+func newFixtures() *Fixtures {
+	return &Fixtures{
+		Storage:              make(map[uint64]map[types.Address]*types.AccountState),
+		CreationTransactions: make(map[types.Hash][]types.Address),
+	}
+}
+
+// block starts a block without transactions
+func (g *generator) block(number uint64, parentHash types.Hash, timestamp uint64) *types.Block {
+	g.fixtures.Storage[number] = make(map[types.Address]*types.AccountState)
+	g.logIndex = 0
+	return &types.Block{
+		Hash:         hashOf("block-%d", number),
+		ParentHash:   parentHash,
+		StateRoot:    hashOf("state-%d", number),
+		TxRoot:       hashOf("transactions-%d", number),
+		ReceiptRoot:  hashOf("receipts-%d", number),
+		Number:       number,
+		GasLimit:     gasLimit,
+		Timestamp:    timestamp,
+		Transactions: []types.Hash{},
+	}
+}
+
+func (g *generator) deploy(block *types.Block, contract *contractTemplate) error {
+	args, err := g.encoder.encodeArguments(contract.abi.Constructor.Inputs, block.Number)
+	if err != nil {
+		return fmt.Errorf("could not generate constructor arguments: %v", err)
+	}
+	tx := g.transaction(block, "", deployBytecode+hex.EncodeToString(args))
+	tx.CreatedContract = contract.address
+	g.fixtures.CreationTransactions[tx.Hash] = append(g.fixtures.CreationTransactions[tx.Hash], contract.address)
+	return nil
+}
+
+func (g *generator) call(block *types.Block, contract *contractTemplate) error {
+	var txs []*types.Transaction
+	for i, function := range contract.abi.Functions {
+		args, err := g.encoder.encodeArguments(function.Inputs, block.Number+uint64(i))
+		if err != nil {
+			return fmt.Errorf("could not generate arguments of function %s: %v", function.Name, err)
+		}
+		txs = append(txs, g.transaction(block, contract.address, function.Signature()+hex.EncodeToString(args)))
+	}
+	if len(txs) == 0 {
+		// a contract without functions still emits its events
+		txs = append(txs, g.transaction(block, contract.address, ""))
+	}
+
+	for i, event := range contract.abi.Events {
+		generated, err := g.event(block, txs[0], contract.address, event, block.Number+uint64(i))
+		if err != nil {
+			return fmt.Errorf("could not generate event %s: %v", event.Name, err)
+		}
+		txs[0].Events = append(txs[0].Events, generated)
+	}
+	return nil
+}
+
+func (g *generator) transaction(block *types.Block, to types.Address, data string) *types.Transaction {
+	index := uint64(len(block.Transactions))
+	tx := &types.Transaction{
+		Hash:              hashOf("transaction-%d-%d", block.Number, index),
+		Status:            true,
+		BlockNumber:       block.Number,
+		BlockHash:         block.Hash,
+		Index:             index,
+		Nonce:             g.nonce,
+		From:              sender,
+		To:                to,
+		Gas:               2 * gasUsed,
+		GasUsed:           gasUsed,
+		CumulativeGasUsed: gasUsed * (index + 1),
+		Data:              types.NewHexData(data),
+		Timestamp:         block.Timestamp,
+		Events:            []*types.Event{},
+		InternalCalls:     []*types.InternalCall{},
+	}
+	g.nonce++
+	block.Transactions = append(block.Transactions, tx.Hash)
+	g.fixtures.Transactions = append(g.fixtures.Transactions, tx)
+	return tx
+}
+
+// event generates the event with indexed arguments as topics, and the rest
+// ABI encoded as its data
+func (g *generator) event(block *types.Block, tx *types.Transaction, address types.Address, event types.ContractABIEvent, seed uint64) (*types.Event, error) {
+	var topics []types.Hash
+	if !event.Anonymous {
+		topics = append(topics, types.NewHash(event.Signature()))
+	}
+	var nonIndexed []types.ContractABIArgument
+	for i, arg := range event.Inputs {
+		if !arg.Indexed {
+			nonIndexed = append(nonIndexed, arg.ContractABIArgument)
+			continue
+		}
+		encoded, err := g.encoder.encodeArgument(arg.ContractABIArgument, seed+uint64(i))
+		if err != nil {
+			return nil, err
+		}
+		// arrays, tuples and dynamic values are hashed
+		if arg.IsDynamic() || strings.HasSuffix(arg.Type, "]") || strings.HasPrefix(arg.Type, "tuple") {
+			encoded = keccak(encoded)
+		}
+		topics = append(topics, types.NewHash(hex.EncodeToString(encoded)))
+	}
+	data, err := g.encoder.encodeArguments(nonIndexed, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	generated := &types.Event{
+		Index:            g.logIndex,
+		Address:          address,
+		Topics:           topics,
+		Data:             types.NewHexData(hex.EncodeToString(data)),
+		BlockNumber:      block.Number,
+		BlockHash:        block.Hash,
+		TransactionHash:  tx.Hash,
+		TransactionIndex: tx.Index,
+		Timestamp:        block.Timestamp,
+	}
+	g.logIndex++
+	return generated, nil
+}
+
+// Load stores the fixtures in the database, registering the contracts with
+// their templates and indexing their data as the filter would.
+func Load(db database.Database, contracts []Contract, fixtures *Fixtures) error {
+	addresses := make([]types.Address, 0, len(contracts))
+	for _, contract := range contracts {
+		addresses = append(addresses, contract.Address)
+	}
+	if err := db.AddAddresses(addresses); err != nil {
+		return err
+	}
+	for _, contract := range contracts {
+		template := contract.Template
+		if err := db.AddTemplate(template.TemplateName, template.ABI, template.StorageLayout); err != nil {
+			return err
+		}
+		if err := db.AssignTemplate(contract.Address, template.TemplateName); err != nil {
+			return err
+		}
+	}
+	return LoadBlocks(db, addresses, fixtures)
+}
+
+// LoadBlocks stores more blocks of fixtures for contracts that are already
+// registered, indexing their data as the filter would.
+func LoadBlocks(db database.Database, addresses []types.Address, fixtures *Fixtures) error {
+	if err := db.WriteTransactions(fixtures.Transactions); err != nil {
+		return err
+	}
+	if err := db.WriteBlocks(fixtures.Blocks); err != nil {
+		return err
+	}
+	for _, block := range fixtures.Blocks {
+		if storage := fixtures.Storage[block.Number]; len(storage) > 0 {
+			if err := db.IndexStorage(storage, block.Number); err != nil {
+				return err
+			}
+		}
+	}
+	for _, balance := range fixtures.ERC20Balances {
+		if err := db.RecordNewERC20Balance(balance.Contract, balance.Holder, balance.Block, balance.Balance); err != nil {
+			return err
+		}
+	}
+	for _, token := range fixtures.ERC721Tokens {
+		if err := db.RecordERC721Token(token.Contract, token.Holder, token.Block, token.TokenID); err != nil {
+			return err
+		}
+	}
+	if err := db.IndexBlocks(addresses, fixtures.Blocks); err != nil {
+		return err
+	}
+	if len(fixtures.CreationTransactions) == 0 {
+		return nil
+	}
+	return db.SetContractCreationTransaction(fixtures.CreationTransactions)
+}
+
+func keccak(data []byte) []byte {
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(data)
+	return hasher.Sum(nil)
+}
+
+func hashOf(format string, args ...interface{}) types.Hash {
+	return types.NewHash(hex.EncodeToString(keccak([]byte(fmt.Sprintf(format, args...)))))
+}
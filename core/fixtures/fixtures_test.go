@@ -0,0 +1,166 @@
+package fixtures
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/core/storageparsing"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+const testABI = `[
+	{"inputs":[{"name":"_initVal","type":"uint256"}],"stateMutability":"nonpayable","type":"constructor"},
+	{"inputs":[{"name":"_x","type":"uint256"}],"name":"set","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"name":"name","type":"string"},{"name":"owners","type":"address[]"},{"name":"id","type":"bytes4"},{"name":"delta","type":"int8"},{"name":"flags","type":"bool[2]"}],"name":"setMany","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"name","type":"string"},{"indexed":false,"name":"label","type":"string"},{"indexed":false,"name":"values","type":"uint256[2]"}],"name":"Named","type":"event"}
+]`
+
+const testStorageLayout = `{
+	"storage":[
+		{"label":"a","offset":0,"slot":"0","type":"t_uint256"},
+		{"label":"b","offset":0,"slot":"1","type":"t_int8"},
+		{"label":"c","offset":1,"slot":"1","type":"t_bool"},
+		{"label":"d","offset":2,"slot":"1","type":"t_address"},
+		{"label":"e","offset":0,"slot":"2","type":"t_string_storage"},
+		{"label":"f","offset":0,"slot":"3","type":"t_struct(Funder)_storage"},
+		{"label":"g","offset":0,"slot":"5","type":"t_array(t_uint256)dyn_storage"}
+	],
+	"types":{
+		"t_uint256":{"encoding":"inplace","label":"uint256","numberOfBytes":"32"},
+		"t_int8":{"encoding":"inplace","label":"int8","numberOfBytes":"1"},
+		"t_bool":{"encoding":"inplace","label":"bool","numberOfBytes":"1"},
+		"t_address":{"encoding":"inplace","label":"address","numberOfBytes":"20"},
+		"t_string_storage":{"encoding":"bytes","label":"string","numberOfBytes":"32"},
+		"t_struct(Funder)_storage":{"encoding":"inplace","label":"struct Funder","numberOfBytes":"64","members":[
+			{"label":"name","offset":0,"slot":"0","type":"t_string_storage"},
+			{"label":"amount","offset":0,"slot":"1","type":"t_uint256"}
+		]},
+		"t_array(t_uint256)dyn_storage":{"base":"t_uint256","encoding":"dynamic_array","label":"uint256[]","numberOfBytes":"32"}
+	}
+}`
+
+var testContract = Contract{
+	Address:  types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17"),
+	Template: &types.Template{TemplateName: "test", ABI: testABI, StorageLayout: testStorageLayout},
+}
+
+func TestGenerate_NoBlocks(t *testing.T) {
+	_, err := Generate([]Contract{testContract}, 0)
+	assert.EqualError(t, err, "at least one block must be generated")
+}
+
+func TestGenerate_UnsupportedType(t *testing.T) {
+	contract := Contract{
+		Address:  testContract.Address,
+		Template: &types.Template{TemplateName: "fixed", ABI: `[{"inputs":[{"name":"x","type":"fixed128x18"}],"name":"set","type":"function"}]`},
+	}
+	_, err := Generate([]Contract{contract}, 2)
+	assert.EqualError(t, err, "could not generate arguments of function set: unsupported type: fixed128x18")
+}
+
+func TestGenerateAndLoad(t *testing.T) {
+	fixtures, err := Generate([]Contract{testContract}, 3)
+	assert.Nil(t, err)
+	assert.Len(t, fixtures.Blocks, 3)
+	assert.Equal(t, fixtures.Blocks[0].Hash, fixtures.Blocks[1].ParentHash)
+	// a deployment, then a call to each function in each block
+	assert.Len(t, fixtures.Transactions, 5)
+
+	db := memory.NewMemoryDB()
+	assert.Nil(t, Load(db, []Contract{testContract}, fixtures))
+
+	lastPersisted, err := db.GetLastPersistedBlockNumber()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, lastPersisted)
+	lastFiltered, err := db.GetLastFiltered(testContract.Address)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, lastFiltered)
+	templateName, err := db.GetContractTemplate(testContract.Address)
+	assert.Nil(t, err)
+	assert.Equal(t, "test", templateName)
+
+	// the deployment is parsed with the constructor arguments
+	creationTx, err := db.GetContractCreationTransaction(testContract.Address)
+	assert.Nil(t, err)
+	deployment, err := db.ReadTransaction(creationTx)
+	assert.Nil(t, err)
+	parsedDeployment := &types.ParsedTransaction{RawTransaction: deployment}
+	assert.Nil(t, parsedDeployment.ParseTransaction(testABI))
+	assert.Equal(t, "constructor(uint256 _initVal)", parsedDeployment.Sig)
+	assert.Equal(t, types.ParsedData{"_initVal": big.NewInt(2)}, parsedDeployment.ParsedData)
+
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	txHashes, err := db.GetAllTransactionsToAddress(testContract.Address, options)
+	assert.Nil(t, err)
+	assert.Len(t, txHashes, 4)
+	for _, txHash := range txHashes {
+		tx, err := db.ReadTransaction(txHash)
+		assert.Nil(t, err)
+		parsedTx := &types.ParsedTransaction{RawTransaction: tx}
+		assert.Nil(t, parsedTx.ParseTransaction(testABI))
+		if tx.BlockNumber == 3 && parsedTx.Sig == "setMany(string name,address[] owners,bytes4 id,int8 delta,bool[2] flags)" {
+			assert.Equal(t, "name 4", parsedTx.ParsedData["name"])
+			assert.Equal(t, []interface{}{"0x000000000000000000000000000000000000a005", "0x000000000000000000000000000000000000a006"}, parsedTx.ParsedData["owners"])
+			assert.Equal(t, "0x07070707", parsedTx.ParsedData["id"])
+			assert.Equal(t, big.NewInt(-8), parsedTx.ParsedData["delta"])
+			assert.Equal(t, []interface{}{false, true}, parsedTx.ParsedData["flags"])
+		}
+	}
+
+	events, err := db.GetAllEventsFromAddress(testContract.Address, options)
+	assert.Nil(t, err)
+	assert.Len(t, events, 4)
+	for _, event := range events {
+		parsedEvent := &types.ParsedEvent{RawEvent: event}
+		assert.Nil(t, parsedEvent.ParseEvent(testABI))
+		if event.BlockNumber != 2 {
+			continue
+		}
+		switch parsedEvent.Sig {
+		case "event Transfer(address from,address to,uint256 value)":
+			assert.Len(t, event.Topics, 3)
+			assert.Equal(t, types.NewHash("a002"), event.Topics[1])
+			assert.Equal(t, types.ParsedData{"value": big.NewInt(3)}, parsedEvent.ParsedData)
+		case "event Named(string name,string label,uint256[2] values)":
+			assert.Len(t, event.Topics, 2)
+			assert.Equal(t, "label 3", parsedEvent.ParsedData["label"])
+			assert.Equal(t, []interface{}{big.NewInt(5), big.NewInt(6)}, parsedEvent.ParsedData["values"])
+		default:
+			t.Fatalf("unexpected event %s", parsedEvent.Sig)
+		}
+	}
+
+	// storage changes from block to block
+	var layout types.SolidityStorageDocument
+	assert.Nil(t, json.Unmarshal([]byte(testStorageLayout), &layout))
+	storage, err := db.GetStorage(testContract.Address, 2)
+	assert.Nil(t, err)
+	parsedStorage, err := storageparsing.ParseRawStorage(storage.Storage, layout)
+	assert.Nil(t, err)
+	values := make(map[string]interface{})
+	for _, item := range parsedStorage {
+		values[item.VarName] = item.Value
+	}
+	assert.Equal(t, "3", values["a"])
+	assert.Equal(t, "-4", values["b"])
+	assert.Equal(t, false, values["c"])
+	assert.Equal(t, types.NewAddress("a005"), values["d"])
+	assert.Equal(t, "e 6", values["e"])
+	assert.Equal(t, []*types.StorageItem{
+		{VarName: "name", VarType: "string", Value: "name 7"},
+		{VarName: "amount", VarType: "uint256", Value: "9"},
+	}, values["f"])
+	assert.Equal(t, []interface{}{}, values["g"])
+
+	storage, err = db.GetStorage(testContract.Address, 3)
+	assert.Nil(t, err)
+	parsedStorage, err = storageparsing.ParseRawStorage(storage.Storage, layout)
+	assert.Nil(t, err)
+	assert.Equal(t, "4", parsedStorage[0].Value)
+}
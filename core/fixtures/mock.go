@@ -0,0 +1,308 @@
+package fixtures
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// mockAccounts is how many accounts send the generated transactions, and
+	// are picked for address arguments
+	mockAccounts = 12
+	// mockMaxTransactions is the most transactions sent to each contract in a
+	// block
+	mockMaxTransactions = 3
+	// mockFailurePercent is the chance of a transaction failing
+	mockFailurePercent = 5
+	// mockMintPercent is the chance of a token transfer minting a new ERC721
+	// token, rather than moving an existing one
+	mockMintPercent = 30
+
+	mockMinGasUsed = 21000
+	mockMaxGasUsed = 250000
+)
+
+// MockGenerator generates data that resembles a live network, to develop
+// against the shape of the API before the network exists. Unlike Generate,
+// each block calls a few random functions of each contract, from a set of
+// accounts, some of which fail, and emits random events of the ABI. Storage
+// only changes in blocks a contract is called in. Transfer events of ERC20
+// and ERC721 tokens move balances and tokens between the accounts, which are
+// tracked as the token processors would. The same seed always generates the
+// same data.
+type MockGenerator struct {
+	generator
+	contracts  []*contractTemplate
+	rand       *rand.Rand
+	accounts   []types.Address
+	nonces     map[types.Address]uint64
+	number     uint64
+	parentHash types.Hash
+	timestamp  uint64
+
+	// the balance of each holder of each ERC20 token, and the holder of each
+	// ERC721 token, in minting order
+	balances    map[types.Address]map[types.Address]*big.Int
+	tokens      map[types.Address][]uint64
+	holders     map[types.Address]map[uint64]types.Address
+	nextTokenID map[types.Address]uint64
+}
+
+func NewMockGenerator(contracts []Contract, seed int64) (*MockGenerator, error) {
+	parsed, err := parseContracts(contracts)
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]types.Address, mockAccounts)
+	for i := range accounts {
+		accounts[i] = types.NewAddress(hex.EncodeToString(keccak([]byte(fmt.Sprintf("account-%d-%d", seed, i))))[24:])
+	}
+	return &MockGenerator{
+		generator:   generator{encoder: argumentEncoder{accounts: accounts}},
+		contracts:   parsed,
+		rand:        rand.New(rand.NewSource(seed)),
+		accounts:    accounts,
+		nonces:      make(map[types.Address]uint64),
+		parentHash:  types.NewHash(""),
+		balances:    make(map[types.Address]map[types.Address]*big.Int),
+		tokens:      make(map[types.Address][]uint64),
+		holders:     make(map[types.Address]map[uint64]types.Address),
+		nextTokenID: make(map[types.Address]uint64),
+	}, nil
+}
+
+// Accounts are the accounts that send transactions and hold tokens
+func (m *MockGenerator) Accounts() []types.Address {
+	return m.accounts
+}
+
+// Next generates the next blocks, the last produced at the timestamp, or a
+// block period after the previous block if that is later. The contracts are
+// deployed in the first block generated.
+func (m *MockGenerator) Next(blockCount uint64, endTimestamp uint64) (*Fixtures, error) {
+	if blockCount == 0 {
+		return nil, errors.New("at least one block must be generated")
+	}
+	timestamp := m.timestamp + BlockPeriod
+	if span := (blockCount - 1) * BlockPeriod; endTimestamp > span && endTimestamp-span > timestamp {
+		timestamp = endTimestamp - span
+	}
+
+	m.fixtures = newFixtures()
+	for i := uint64(0); i < blockCount; i++ {
+		m.number++
+		block := m.block(m.number, m.parentHash, timestamp)
+		for _, contract := range m.contracts {
+			var err error
+			if m.number == 1 {
+				err = m.deploy(block, contract)
+				block.GasUsed += gasUsed
+			} else {
+				err = m.calls(block, contract)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		m.fixtures.Blocks = append(m.fixtures.Blocks, block)
+		m.parentHash = block.Hash
+		m.timestamp = timestamp
+		timestamp += BlockPeriod
+	}
+	return m.fixtures, nil
+}
+
+// calls sends the contract up to mockMaxTransactions transactions, each
+// calling a random function, and each that succeeds emitting a random event
+func (m *MockGenerator) calls(block *types.Block, contract *contractTemplate) error {
+	called := false
+	count := m.rand.Intn(mockMaxTransactions + 1)
+	for i := 0; i < count; i++ {
+		var data string
+		if len(contract.abi.Functions) > 0 {
+			function := contract.abi.Functions[m.rand.Intn(len(contract.abi.Functions))]
+			args, err := m.encoder.encodeArguments(function.Inputs, m.seed())
+			if err != nil {
+				return fmt.Errorf("could not generate arguments of function %s: %v", function.Name, err)
+			}
+			data = function.Signature() + hex.EncodeToString(args)
+		}
+		tx := m.transaction(block, contract.address, data)
+		m.send(block, tx, m.accounts[m.rand.Intn(len(m.accounts))])
+		if m.rand.Intn(100) < mockFailurePercent {
+			tx.Status = false
+			continue
+		}
+		called = true
+
+		if len(contract.abi.Events) == 0 || m.rand.Intn(2) == 0 {
+			continue
+		}
+		event := contract.abi.Events[m.rand.Intn(len(contract.abi.Events))]
+		var generated *types.Event
+		var err error
+		switch transferKind(event) {
+		case erc20Transfer:
+			generated = m.erc20Transfer(block, tx, contract.address, event)
+		case erc721Transfer:
+			generated = m.erc721Transfer(block, tx, contract.address, event)
+		default:
+			generated, err = m.event(block, tx, contract.address, event, m.seed())
+		}
+		if err != nil {
+			return fmt.Errorf("could not generate event %s: %v", event.Name, err)
+		}
+		tx.Events = append(tx.Events, generated)
+	}
+
+	if called && contract.layout != nil {
+		m.fixtures.Storage[block.Number][contract.address] = &types.AccountState{
+			Root:    hashOf("storage-%s-%d", contract.address, block.Number),
+			Storage: generateStorage(*contract.layout, m.seed()),
+		}
+	}
+	return nil
+}
+
+// send sets the sender and gas of the transaction, the last in the block
+func (m *MockGenerator) send(block *types.Block, tx *types.Transaction, from types.Address) {
+	tx.From = from
+	tx.Nonce = m.nonces[from]
+	m.nonces[from]++
+	tx.GasUsed = uint64(mockMinGasUsed + m.rand.Intn(mockMaxGasUsed-mockMinGasUsed))
+	tx.Gas = tx.GasUsed * 3 / 2
+	tx.CumulativeGasUsed = block.GasUsed + tx.GasUsed
+	block.GasUsed = tx.CumulativeGasUsed
+}
+
+// seed is a random seed for generated values, small enough to read
+func (m *MockGenerator) seed() uint64 {
+	return uint64(m.rand.Intn(1000000))
+}
+
+// erc20Transfer moves a random amount of the token from a holder with enough
+// of it to another account, or mints it if no holder picked has enough
+func (m *MockGenerator) erc20Transfer(block *types.Block, tx *types.Transaction, contract types.Address, event types.ContractABIEvent) *types.Event {
+	if m.balances[contract] == nil {
+		m.balances[contract] = make(map[types.Address]*big.Int)
+	}
+	balances := m.balances[contract]
+	amount := new(big.Int).Mul(big.NewInt(int64(1+m.rand.Intn(1000))), big.NewInt(1000))
+	from := types.NewAddress("")
+	if candidate := m.accounts[m.rand.Intn(len(m.accounts))]; balances[candidate] != nil && balances[candidate].Cmp(amount) >= 0 {
+		from = candidate
+	}
+	to := m.accounts[m.rand.Intn(len(m.accounts))]
+
+	if !from.IsEmpty() {
+		balances[from] = new(big.Int).Sub(balances[from], amount)
+		m.recordBalance(contract, from, block.Number, balances[from])
+	}
+	if balances[to] == nil {
+		balances[to] = new(big.Int)
+	}
+	balances[to] = new(big.Int).Add(balances[to], amount)
+	m.recordBalance(contract, to, block.Number, balances[to])
+
+	topics := []types.Hash{types.NewHash(event.Signature()), types.NewHash(string(from)), types.NewHash(string(to))}
+	return m.log(block, tx, contract, topics, word(amount))
+}
+
+// erc721Transfer mints a new token to an account, or moves an existing token
+// from its holder to another account
+func (m *MockGenerator) erc721Transfer(block *types.Block, tx *types.Transaction, contract types.Address, event types.ContractABIEvent) *types.Event {
+	if m.holders[contract] == nil {
+		m.holders[contract] = make(map[uint64]types.Address)
+	}
+	holders := m.holders[contract]
+	to := m.accounts[m.rand.Intn(len(m.accounts))]
+
+	var tokenID uint64
+	from := types.NewAddress("")
+	if tokens := m.tokens[contract]; len(tokens) == 0 || m.rand.Intn(100) < mockMintPercent {
+		m.nextTokenID[contract]++
+		tokenID = m.nextTokenID[contract]
+		m.tokens[contract] = append(tokens, tokenID)
+	} else {
+		tokenID = tokens[m.rand.Intn(len(tokens))]
+		from = holders[tokenID]
+	}
+	holders[tokenID] = to
+	m.recordToken(contract, to, block.Number, tokenID)
+
+	topics := []types.Hash{
+		types.NewHash(event.Signature()),
+		types.NewHash(string(from)),
+		types.NewHash(string(to)),
+		types.NewHash(hex.EncodeToString(word(new(big.Int).SetUint64(tokenID)))),
+	}
+	return m.log(block, tx, contract, topics, nil)
+}
+
+// recordBalance records the balance of the holder at the end of the block,
+// replacing the balance after an earlier transfer in the block, as the token
+// processors only record one balance per block
+func (m *MockGenerator) recordBalance(contract types.Address, holder types.Address, block uint64, balance *big.Int) {
+	for _, recorded := range m.fixtures.ERC20Balances {
+		if recorded.Contract == contract && recorded.Holder == holder && recorded.Block == block {
+			recorded.Balance = balance
+			return
+		}
+	}
+	m.fixtures.ERC20Balances = append(m.fixtures.ERC20Balances, &ERC20Balance{Contract: contract, Holder: holder, Block: block, Balance: balance})
+}
+
+// recordToken records the holder of the token at the end of the block, in the
+// same way as recordBalance
+func (m *MockGenerator) recordToken(contract types.Address, holder types.Address, block uint64, tokenID uint64) {
+	for _, recorded := range m.fixtures.ERC721Tokens {
+		if recorded.Contract == contract && recorded.Block == block && recorded.TokenID.Uint64() == tokenID {
+			recorded.Holder = holder
+			return
+		}
+	}
+	m.fixtures.ERC721Tokens = append(m.fixtures.ERC721Tokens, &ERC721Token{Contract: contract, Holder: holder, Block: block, TokenID: new(big.Int).SetUint64(tokenID)})
+}
+
+func (m *MockGenerator) log(block *types.Block, tx *types.Transaction, address types.Address, topics []types.Hash, data []byte) *types.Event {
+	generated := &types.Event{
+		Index:            m.logIndex,
+		Address:          address,
+		Topics:           topics,
+		Data:             types.NewHexData(hex.EncodeToString(data)),
+		BlockNumber:      block.Number,
+		BlockHash:        block.Hash,
+		TransactionHash:  tx.Hash,
+		TransactionIndex: tx.Index,
+		Timestamp:        block.Timestamp,
+	}
+	m.logIndex++
+	return generated
+}
+
+const (
+	notTransfer = iota
+	erc20Transfer
+	erc721Transfer
+)
+
+// transferKind reports whether the event is the Transfer event of ERC20 or
+// ERC721, which differ only in whether the last argument is indexed
+func transferKind(event types.ContractABIEvent) int {
+	if event.Name != "Transfer" || event.Anonymous || len(event.Inputs) != 3 {
+		return notTransfer
+	}
+	inputs := event.Inputs
+	if inputs[0].Type != "address" || !inputs[0].Indexed || inputs[1].Type != "address" || !inputs[1].Indexed || inputs[2].Type != "uint256" {
+		return notTransfer
+	}
+	if inputs[2].Indexed {
+		return erc721Transfer
+	}
+	return erc20Transfer
+}
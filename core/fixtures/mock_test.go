@@ -0,0 +1,133 @@
+package fixtures
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+const testERC721ABI = `[
+	{"inputs":[{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"}],"name":"mint","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":true,"name":"tokenId","type":"uint256"}],"name":"Transfer","type":"event"}
+]`
+
+var testERC721Contract = Contract{
+	Address:  types.NewAddress("0x9d13c6d3afe1721beef56b55d303b09e021e27ab"),
+	Template: &types.Template{TemplateName: "erc721", ABI: testERC721ABI},
+}
+
+func TestMockGenerator_NoBlocks(t *testing.T) {
+	generator, err := NewMockGenerator([]Contract{testContract}, 1)
+	assert.Nil(t, err)
+	_, err = generator.Next(0, 1000)
+	assert.EqualError(t, err, "at least one block must be generated")
+}
+
+func TestMockGenerator_Deterministic(t *testing.T) {
+	first, err := NewMockGenerator([]Contract{testContract, testERC721Contract}, 7)
+	assert.Nil(t, err)
+	second, err := NewMockGenerator([]Contract{testContract, testERC721Contract}, 7)
+	assert.Nil(t, err)
+
+	firstFixtures, err := first.Next(20, 10000)
+	assert.Nil(t, err)
+	secondFixtures, err := second.Next(20, 10000)
+	assert.Nil(t, err)
+	assert.Equal(t, firstFixtures, secondFixtures)
+}
+
+func TestMockGenerator_Next(t *testing.T) {
+	generator, err := NewMockGenerator([]Contract{testContract, testERC721Contract}, 1)
+	assert.Nil(t, err)
+
+	history, err := generator.Next(50, 10000)
+	assert.Nil(t, err)
+	assert.Len(t, history.Blocks, 50)
+	assert.EqualValues(t, 1, history.Blocks[0].Number)
+	assert.EqualValues(t, 10000-49*BlockPeriod, history.Blocks[0].Timestamp)
+	assert.EqualValues(t, 10000, history.Blocks[49].Timestamp)
+	for i := 1; i < len(history.Blocks); i++ {
+		assert.Equal(t, history.Blocks[i-1].Hash, history.Blocks[i].ParentHash)
+	}
+
+	// the contracts are deployed, then called by varied accounts, some of
+	// which fail
+	assert.Equal(t, testContract.Address, history.Transactions[0].CreatedContract)
+	assert.Equal(t, testERC721Contract.Address, history.Transactions[1].CreatedContract)
+	senders := make(map[types.Address]bool)
+	failed := 0
+	for _, tx := range history.Transactions[2:] {
+		assert.Contains(t, generator.Accounts(), tx.From)
+		senders[tx.From] = true
+		if !tx.Status {
+			failed++
+			assert.Empty(t, tx.Events)
+		}
+	}
+	assert.True(t, len(senders) > 1)
+	assert.True(t, failed > 0)
+	assert.NotEmpty(t, history.ERC20Balances)
+	assert.NotEmpty(t, history.ERC721Tokens)
+
+	// the next block follows on from the history, even if it is produced
+	// sooner than a block period later
+	next, err := generator.Next(1, 10001)
+	assert.Nil(t, err)
+	assert.Len(t, next.Blocks, 1)
+	assert.EqualValues(t, 51, next.Blocks[0].Number)
+	assert.Equal(t, history.Blocks[49].Hash, next.Blocks[0].ParentHash)
+	assert.EqualValues(t, 10000+BlockPeriod, next.Blocks[0].Timestamp)
+}
+
+func TestMockGenerator_LoadTokens(t *testing.T) {
+	contracts := []Contract{testContract, testERC721Contract}
+	generator, err := NewMockGenerator(contracts, 1)
+	assert.Nil(t, err)
+	history, err := generator.Next(100, 10000)
+	assert.Nil(t, err)
+
+	db := memory.NewMemoryDB()
+	assert.Nil(t, Load(db, contracts, history))
+	next, err := generator.Next(1, 10005)
+	assert.Nil(t, err)
+	assert.Nil(t, LoadBlocks(db, []types.Address{testContract.Address, testERC721Contract.Address}, next))
+	lastPersisted, err := db.GetLastPersistedBlockNumber()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 101, lastPersisted)
+
+	// the balances held add up to the amount minted
+	minted := new(big.Int)
+	for _, tx := range append(history.Transactions, next.Transactions...) {
+		for _, event := range tx.Events {
+			if event.Address == testContract.Address && len(event.Topics) == 3 && event.Topics[1] == types.NewHash("") {
+				minted.Add(minted, new(big.Int).SetBytes(event.Data.AsBytes()))
+			}
+		}
+	}
+	assert.True(t, minted.Sign() > 0)
+	options := &types.QueryOptions{PageSize: 100}
+	options.SetDefaults()
+	holders, err := db.GetERC20TokenHolders(testContract.Address, 101, options)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, holders)
+	held := new(big.Int)
+	for _, holding := range holders {
+		assert.Contains(t, generator.Accounts(), holding.Holder)
+		held.Add(held, holding.Balance)
+	}
+	assert.Equal(t, minted, held)
+
+	// each token is held by one of the accounts
+	tokenOptions := &types.TokenQueryOptions{}
+	tokenOptions.SetDefaults()
+	tokens, err := db.AllERC721TokensAtBlock(testERC721Contract.Address, 101, tokenOptions)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens)
+	for _, token := range tokens {
+		assert.Contains(t, generator.Accounts(), token.Holder)
+	}
+}
@@ -0,0 +1,120 @@
+package fixtures
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// storageWriter sets the variables of a storage layout to synthetic values.
+// Only variables stored in place are set: value types, short strings and
+// bytes, and structs of these. Arrays and mappings are left empty.
+type storageWriter struct {
+	types map[string]types.SolidityTypeEntry
+	slots map[uint64][]byte
+}
+
+// generateStorage returns the contract storage with the layout's variables
+// set to values derived from the seed, keyed by slot
+func generateStorage(layout types.SolidityStorageDocument, seed uint64) map[types.Hash]string {
+	writer := &storageWriter{types: layout.Types, slots: make(map[uint64][]byte)}
+	writer.write(layout.Storage, 0, seed)
+
+	storage := make(map[types.Hash]string, len(writer.slots))
+	for slot, value := range writer.slots {
+		key := types.NewHash(hex.EncodeToString(new(big.Int).SetUint64(slot).Bytes()))
+		storage[key] = hex.EncodeToString(value)
+	}
+	return storage
+}
+
+func (w *storageWriter) write(entries types.SolidityStorageEntries, baseSlot uint64, seed uint64) {
+	for i, entry := range entries {
+		slot := baseSlot + entry.Slot
+		entrySeed := seed + uint64(i)
+		namedType := w.types[entry.Type]
+
+		switch {
+		case strings.HasPrefix(entry.Type, "t_struct"):
+			w.write(namedType.Members, slot, entrySeed)
+		case strings.HasPrefix(entry.Type, "t_string_storage"):
+			w.writeShortBytes(slot, []byte(fmt.Sprintf("%s %d", entry.Label, entrySeed)))
+		case strings.HasPrefix(entry.Type, "t_bytes_storage"):
+			w.writeShortBytes(slot, []byte{byte(entrySeed), byte(entrySeed + 1), byte(entrySeed + 2)})
+		case strings.HasPrefix(entry.Type, "t_array"), strings.HasPrefix(entry.Type, "t_mapping"):
+		default:
+			if value := inPlaceValue(entry.Type, namedType.NumberOfBytes, entrySeed); value != nil {
+				w.writeInPlace(slot, entry.Offset, value)
+			}
+		}
+	}
+}
+
+// inPlaceValue returns the big endian value of a type stored in place, or nil
+// if the type is not supported
+func inPlaceValue(typeName string, numberOfBytes uint64, seed uint64) []byte {
+	if numberOfBytes == 0 || numberOfBytes > 32 {
+		return nil
+	}
+	var value *big.Int
+	switch {
+	case strings.HasPrefix(typeName, "t_uint"):
+		value = uintValue(seed)
+	case strings.HasPrefix(typeName, "t_int"):
+		value = intValue(seed)
+		if value.Sign() < 0 {
+			// two's complement in the size of the type
+			value.Add(value, new(big.Int).Lsh(big.NewInt(1), uint(8*numberOfBytes)))
+		}
+	case strings.HasPrefix(typeName, "t_bool"):
+		value = big.NewInt(int64(seed % 2))
+	case strings.HasPrefix(typeName, "t_address"), strings.HasPrefix(typeName, "t_contract"):
+		value = addressValue(seed)
+	case strings.HasPrefix(typeName, "t_bytes"):
+		bytes := make([]byte, numberOfBytes)
+		for i := range bytes {
+			bytes[i] = byte(seed + 1)
+		}
+		return bytes
+	case strings.HasPrefix(typeName, "t_enum"):
+		// the first option is the only one every enum has
+		value = big.NewInt(0)
+	default:
+		return nil
+	}
+	bytes := make([]byte, numberOfBytes)
+	valueBytes := value.Bytes()
+	copy(bytes[len(bytes)-len(valueBytes):], valueBytes)
+	return bytes
+}
+
+// writeInPlace sets the bytes of the slot that start offset bytes from the
+// right, as variables are packed into slots
+func (w *storageWriter) writeInPlace(slot uint64, offset uint64, value []byte) {
+	if offset+uint64(len(value)) > 32 {
+		return
+	}
+	word := w.slot(slot)
+	copy(word[32-offset-uint64(len(value)):32-offset], value)
+}
+
+// writeShortBytes stores up to 31 bytes of data in the slot itself, left
+// aligned, with twice the length in the lowest byte
+func (w *storageWriter) writeShortBytes(slot uint64, data []byte) {
+	if len(data) > 31 {
+		data = data[:31]
+	}
+	word := w.slot(slot)
+	copy(word, data)
+	word[31] = byte(2 * len(data))
+}
+
+func (w *storageWriter) slot(slot uint64) []byte {
+	if _, ok := w.slots[slot]; !ok {
+		w.slots[slot] = make([]byte, 32)
+	}
+	return w.slots[slot]
+}
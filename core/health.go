@@ -0,0 +1,155 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/types"
+)
+
+// healthDB is the part of the database the health checker reads
+type healthDB interface {
+	GetLastPersistedBlockNumber() (uint64, error)
+}
+
+// filterProgress is the block the filter service has indexed every address up
+// to, and false if it hasn't been found yet
+type filterProgress interface {
+	LastFiltered() (uint64, bool)
+}
+
+// ingestionState reports whether ingestion has been paused
+type ingestionState interface {
+	Paused() bool
+}
+
+// leaderState reports whether the instance is the leader of several sharing
+// the database
+type leaderState interface {
+	IsLeader() bool
+}
+
+// healthChecker reports on the connection to the node, the database, and how
+// far the monitor and filter services are behind. The service is ready while
+// all of them are healthy, and stops being live once it has been behind the
+// chain head without persisting a new block for the stall timeout. While
+// ingestion is paused, the monitor and filter are allowed to fall behind.
+//
+// A standby in high availability mode doesn't filter, unless filtering is
+// sharded, and reports how far behind the leader's monitor is, which
+// restarting the standby won't help.
+type healthChecker struct {
+	quorumClient client.Client
+	db           healthDB
+	filter       filterProgress
+	ingestion    ingestionState
+	// nil unless in high availability mode
+	leader leaderState
+	config types.HealthConfig
+	now    func() time.Time
+	// standbys filter their shard of the contracts too
+	sharded bool
+
+	mux sync.Mutex
+	// the last persisted block found, and when it was first found
+	lastPersisted uint64
+	lastProgress  time.Time
+}
+
+func newHealthChecker(quorumClient client.Client, db healthDB, filter filterProgress, ingestion ingestionState, config types.HealthConfig) *healthChecker {
+	return &healthChecker{
+		quorumClient: quorumClient,
+		db:           db,
+		filter:       filter,
+		ingestion:    ingestion,
+		config:       config,
+		now:          time.Now,
+		lastProgress: time.Now(),
+	}
+}
+
+func (hc *healthChecker) Health() *types.HealthReport {
+	paused := hc.ingestion.Paused()
+	standby := hc.leader != nil && !hc.leader.IsLeader()
+
+	quorum := &types.ComponentHealth{Name: types.QuorumComponent, Healthy: true}
+	var head types.HexNumber
+	if err := hc.quorumClient.RPCCall(&head, "eth_blockNumber"); err != nil {
+		quorum.Healthy, quorum.Error = false, err.Error()
+	}
+
+	database := &types.ComponentHealth{Name: types.DatabaseComponent, Healthy: true}
+	lastPersisted, err := hc.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		database.Healthy, database.Error = false, err.Error()
+	}
+
+	monitor := &types.ComponentHealth{Name: types.MonitorComponent, Healthy: quorum.Healthy && database.Healthy}
+	if monitor.Healthy {
+		lag := lag(head.ToUint64(), lastPersisted)
+		monitor.Lag = &lag
+		if lag > hc.config.MaxMonitorLag && !paused {
+			monitor.Healthy, monitor.Error = false, "too far behind the chain head"
+		}
+	} else {
+		monitor.Error = "lag unknown"
+	}
+
+	filter := &types.ComponentHealth{Name: types.FilterComponent, Healthy: database.Healthy}
+	lastFiltered, known := hc.filter.LastFiltered()
+	switch {
+	case standby && !hc.sharded:
+		// the leader filters
+	case filter.Healthy && known:
+		lag := lag(lastPersisted, lastFiltered)
+		filter.Lag = &lag
+		if lag > hc.config.MaxFilterLag && !paused {
+			filter.Healthy, filter.Error = false, "too far behind the last persisted block"
+		}
+	default:
+		filter.Healthy, filter.Error = false, "lag unknown"
+	}
+
+	report := &types.HealthReport{
+		Live:       !hc.stalled(head.ToUint64(), lastPersisted, quorum.Healthy && database.Healthy && !paused && !standby),
+		Ready:      true,
+		Paused:     paused,
+		Standby:    standby,
+		Components: []*types.ComponentHealth{quorum, database, monitor, filter},
+	}
+	for _, component := range report.Components {
+		report.Ready = report.Ready && component.Healthy
+	}
+	return report
+}
+
+// stalled checks if no new block has been persisted for the stall timeout
+// while the chain head is ahead. Unreachable components are left to the
+// readiness check, as restarting the service won't bring them back, and the
+// timeout starts again once they are reachable, as it does once ingestion is
+// resumed.
+func (hc *healthChecker) stalled(head, lastPersisted uint64, known bool) bool {
+	hc.mux.Lock()
+	defer hc.mux.Unlock()
+
+	now := hc.now()
+	if !known {
+		hc.lastProgress = now
+		return false
+	}
+	if lastPersisted != hc.lastPersisted || head <= lastPersisted {
+		hc.lastPersisted = lastPersisted
+		hc.lastProgress = now
+		return false
+	}
+	return now.Sub(hc.lastProgress) > time.Duration(hc.config.StallTimeout)*time.Second
+}
+
+// lag is how many blocks behind is, or 0 if it is ahead
+func lag(ahead, behind uint64) uint64 {
+	if behind >= ahead {
+		return 0
+	}
+	return ahead - behind
+}
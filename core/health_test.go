@@ -0,0 +1,185 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/types"
+)
+
+type fakeHealthDB struct {
+	lastPersisted uint64
+	err           error
+}
+
+func (db *fakeHealthDB) GetLastPersistedBlockNumber() (uint64, error) {
+	return db.lastPersisted, db.err
+}
+
+type fakeFilterProgress struct {
+	lastFiltered uint64
+	known        bool
+}
+
+func (f *fakeFilterProgress) LastFiltered() (uint64, bool) {
+	return f.lastFiltered, f.known
+}
+
+type fakeIngestionState struct {
+	paused bool
+}
+
+func (f *fakeIngestionState) Paused() bool {
+	return f.paused
+}
+
+var healthConfig = types.HealthConfig{MaxMonitorLag: 10, MaxFilterLag: 100, StallTimeout: 300}
+
+func newTestHealthChecker(head uint64, db *fakeHealthDB, filter *fakeFilterProgress) *healthChecker {
+	mockRPC := map[string]interface{}{"eth_blockNumber": types.HexNumber(head)}
+	return newHealthChecker(client.NewStubQuorumClient(nil, mockRPC), db, filter, &fakeIngestionState{}, healthConfig)
+}
+
+func lagOf(lag uint64) *uint64 {
+	return &lag
+}
+
+func TestHealth_Ready(t *testing.T) {
+	checker := newTestHealthChecker(105, &fakeHealthDB{lastPersisted: 100}, &fakeFilterProgress{lastFiltered: 50, known: true})
+
+	assert.Equal(t, &types.HealthReport{
+		Live:  true,
+		Ready: true,
+		Components: []*types.ComponentHealth{
+			{Name: types.QuorumComponent, Healthy: true},
+			{Name: types.DatabaseComponent, Healthy: true},
+			{Name: types.MonitorComponent, Healthy: true, Lag: lagOf(5)},
+			{Name: types.FilterComponent, Healthy: true, Lag: lagOf(50)},
+		},
+	}, checker.Health())
+}
+
+func TestHealth_Lagging(t *testing.T) {
+	checker := newTestHealthChecker(200, &fakeHealthDB{lastPersisted: 150}, &fakeFilterProgress{lastFiltered: 10, known: true})
+
+	report := checker.Health()
+	assert.True(t, report.Live)
+	assert.False(t, report.Ready)
+	assert.Equal(t, &types.ComponentHealth{Name: types.MonitorComponent, Error: "too far behind the chain head", Lag: lagOf(50)}, report.Components[2])
+	assert.Equal(t, &types.ComponentHealth{Name: types.FilterComponent, Error: "too far behind the last persisted block", Lag: lagOf(140)}, report.Components[3])
+
+	// the filter hasn't started
+	checker.filter = &fakeFilterProgress{}
+	report = checker.Health()
+	assert.Equal(t, &types.ComponentHealth{Name: types.FilterComponent, Error: "lag unknown"}, report.Components[3])
+}
+
+func TestHealth_Unreachable(t *testing.T) {
+	checker := newHealthChecker(client.NewStubQuorumClient(nil, nil), &fakeHealthDB{err: errors.New("connection refused")}, &fakeFilterProgress{known: true}, &fakeIngestionState{}, healthConfig)
+
+	report := checker.Health()
+	assert.True(t, report.Live)
+	assert.False(t, report.Ready)
+	assert.Equal(t, []*types.ComponentHealth{
+		{Name: types.QuorumComponent, Error: "not found"},
+		{Name: types.DatabaseComponent, Error: "connection refused"},
+		{Name: types.MonitorComponent, Error: "lag unknown"},
+		{Name: types.FilterComponent, Error: "lag unknown"},
+	}, report.Components)
+}
+
+func TestHealth_Stalled(t *testing.T) {
+	db := &fakeHealthDB{lastPersisted: 100}
+	checker := newTestHealthChecker(105, db, &fakeFilterProgress{lastFiltered: 100, known: true})
+	now := time.Unix(1000, 0)
+	checker.now = func() time.Time { return now }
+
+	assert.True(t, checker.Health().Live)
+	now = now.Add(299 * time.Second)
+	assert.True(t, checker.Health().Live)
+	now = now.Add(2 * time.Second)
+	assert.False(t, checker.Health().Live)
+
+	// persisting a block starts the timeout again
+	db.lastPersisted = 101
+	assert.True(t, checker.Health().Live)
+	now = now.Add(299 * time.Second)
+	assert.True(t, checker.Health().Live)
+
+	// as does catching up with the chain head
+	db.lastPersisted = 105
+	now = now.Add(time.Hour)
+	assert.True(t, checker.Health().Live)
+}
+
+func TestHealth_Paused(t *testing.T) {
+	db := &fakeHealthDB{lastPersisted: 100}
+	checker := newTestHealthChecker(200, db, &fakeFilterProgress{lastFiltered: 0, known: true})
+	ingestion := &fakeIngestionState{paused: true}
+	checker.ingestion = ingestion
+	now := time.Unix(1000, 0)
+	checker.now = func() time.Time { return now }
+
+	// falling behind is expected while paused
+	report := checker.Health()
+	assert.True(t, report.Ready)
+	assert.True(t, report.Paused)
+	assert.Equal(t, &types.ComponentHealth{Name: types.MonitorComponent, Healthy: true, Lag: lagOf(100)}, report.Components[2])
+	assert.Equal(t, &types.ComponentHealth{Name: types.FilterComponent, Healthy: true, Lag: lagOf(100)}, report.Components[3])
+	now = now.Add(time.Hour)
+	assert.True(t, checker.Health().Live)
+
+	// the stall timeout starts once resumed
+	ingestion.paused = false
+	report = checker.Health()
+	assert.True(t, report.Live)
+	assert.False(t, report.Ready)
+	assert.False(t, report.Paused)
+	now = now.Add(301 * time.Second)
+	assert.False(t, checker.Health().Live)
+}
+
+type fakeLeaderState struct {
+	leader bool
+}
+
+func (l *fakeLeaderState) IsLeader() bool {
+	return l.leader
+}
+
+func TestHealth_Standby(t *testing.T) {
+	db := &fakeHealthDB{lastPersisted: 100}
+	checker := newTestHealthChecker(100, db, &fakeFilterProgress{})
+	leader := &fakeLeaderState{}
+	checker.leader = leader
+	now := time.Unix(1000, 0)
+	checker.now = func() time.Time { return now }
+
+	// a standby doesn't filter
+	report := checker.Health()
+	assert.True(t, report.Ready)
+	assert.True(t, report.Standby)
+	assert.Equal(t, &types.ComponentHealth{Name: types.FilterComponent, Healthy: true}, report.Components[3])
+
+	// nor is restarted if the leader stalls
+	db.lastPersisted = 90
+	now = now.Add(time.Hour)
+	assert.True(t, checker.Health().Live)
+
+	// once elected, it filters
+	leader.leader = true
+	report = checker.Health()
+	assert.False(t, report.Standby)
+	assert.Equal(t, "lag unknown", report.Components[3].Error)
+
+	// a standby filtering a shard of the contracts reports on it
+	leader.leader = false
+	checker.sharded = true
+	report = checker.Health()
+	assert.True(t, report.Standby)
+	assert.Equal(t, "lag unknown", report.Components[3].Error)
+}
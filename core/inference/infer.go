@@ -0,0 +1,616 @@
+package inference
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// maxBaseSlot is the highest slot a mapping, dynamic array or long string
+	// is looked for at
+	maxBaseSlot = 64
+	// maxStaticSlot is the highest slot taken as a variable of its own, rather
+	// than as one derived from another variable by hashing
+	maxStaticSlot = 1 << 16
+	// maxArrayLength is the most elements a dynamic array, or 32-byte words a
+	// long string, is looked for up to
+	maxArrayLength = 1 << 16
+	// maxNestedKeys is how many address keys are combined in pairs when
+	// looking for mappings of mappings
+	maxNestedKeys = 100
+	// maxSmallKey is the highest integer key always tried, as small counters
+	// and enum values are used as keys without appearing in call data
+	maxSmallKey = 255
+)
+
+// the kinds of mapping key, by their Solidity type
+const (
+	addressKey = "address"
+	uintKey    = "uint256"
+	bytes32Key = "bytes32"
+)
+
+var keyKinds = []string{addressKey, uintKey, bytes32Key}
+
+// observations are the storage a contract was seen to write, and the words
+// seen in its transactions and events that could be the keys of its mappings
+type observations struct {
+	// the distinct values written to each slot
+	slots map[types.Hash][][]byte
+	// the candidate keys of each kind
+	keys   map[string]map[types.Hash]bool
+	abi    *types.ContractABI
+	states uint64
+}
+
+func newObservations() *observations {
+	o := &observations{
+		slots: make(map[types.Hash][][]byte),
+		keys:  make(map[string]map[types.Hash]bool),
+	}
+	for _, kind := range keyKinds {
+		o.keys[kind] = make(map[types.Hash]bool)
+	}
+	for i := 1; i <= maxSmallKey; i++ {
+		o.keys[uintKey][wordHash(uint64(i))] = true
+	}
+	return o
+}
+
+// addState records the values of a storage state
+func (o *observations) addState(storage map[types.Hash]string) {
+	o.states++
+	for slot, value := range storage {
+		decoded := decodeWord(value)
+		seen := false
+		for _, existing := range o.slots[slot] {
+			if string(existing) == string(decoded) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			o.slots[slot] = append(o.slots[slot], decoded)
+		}
+	}
+}
+
+// addTransaction records the addresses of the transaction and the words of
+// its call data as candidate keys
+func (o *observations) addTransaction(tx *types.Transaction) {
+	o.addKey(decodeWord(string(tx.From)), false)
+	o.addKey(decodeWord(string(tx.To)), false)
+	data := tx.Data.AsBytes()
+	if len(tx.PrivateData) > 0 {
+		data = tx.PrivateData.AsBytes()
+	}
+	if len(data) > 4 {
+		o.addWords(data[4:])
+	}
+}
+
+// addEvent records the indexed arguments and the words of the data of the
+// event as candidate keys
+func (o *observations) addEvent(event *types.Event) {
+	for i := 1; i < len(event.Topics); i++ {
+		o.addKey(decodeWord(string(event.Topics[i])), true)
+	}
+	o.addWords(event.Data.AsBytes())
+}
+
+func (o *observations) addWords(data []byte) {
+	for i := 0; i+32 <= len(data); i += 32 {
+		o.addKey(data[i:i+32], false)
+	}
+}
+
+// addKey classifies the word as an address or integer key; other words are
+// only taken as bytes32 keys from indexed event arguments, as call data is
+// full of offsets and lengths that would never be keys
+func (o *observations) addKey(word []byte, indexed bool) {
+	value := new(big.Int).SetBytes(word)
+	switch {
+	case value.Sign() == 0:
+	case isAddress(word):
+		o.keys[addressKey][types.NewHash(hex.EncodeToString(word))] = true
+	case value.BitLen() <= 64:
+		o.keys[uintKey][types.NewHash(hex.EncodeToString(word))] = true
+	case indexed:
+		o.keys[bytes32Key][types.NewHash(hex.EncodeToString(word))] = true
+	}
+}
+
+// variable is an inferred variable and the layout type it is stored as
+type variable struct {
+	*types.InferredVariable
+	typeID string
+	// the key types a getter of the variable takes, and the type it returns,
+	// to name it after a function of the ABI
+	getterInputs []string
+	getterOutput string
+}
+
+// analysis is the result of inferring a layout
+type analysis struct {
+	variables   []*variable
+	unexplained uint64
+	// layout types by their ID
+	types map[string]layoutType
+}
+
+// infer proposes the variables of the observed storage. Mappings are found
+// by hashing the candidate keys with each base slot, and arrays and long
+// strings by their data slots lying just after the hash of a base slot. The
+// slots left over below maxStaticSlot are taken as variables of their own,
+// typed by the values written to them.
+func infer(o *observations) *analysis {
+	result := &analysis{types: make(map[string]layoutType)}
+
+	static := make(map[uint64][][]byte)
+	hashed := make(map[types.Hash][][]byte)
+	limit := big.NewInt(maxStaticSlot)
+	for slot, values := range o.slots {
+		position := new(big.Int).SetBytes(decodeWord(string(slot)))
+		if position.Cmp(limit) < 0 {
+			static[position.Uint64()] = values
+		} else {
+			hashed[slot] = values
+		}
+	}
+	claimed := make(map[types.Hash]bool)
+
+	// mappings keyed by each kind of candidate key
+	mappingHits := make(map[uint64]map[string][]types.Hash)
+	for _, kind := range keyKinds {
+		for key := range o.keys[kind] {
+			for p := uint64(0); p <= maxBaseSlot; p++ {
+				slot := mappingSlot(key, wordHash(p))
+				if _, ok := hashed[slot]; !ok {
+					continue
+				}
+				if mappingHits[p] == nil {
+					mappingHits[p] = make(map[string][]types.Hash)
+				}
+				mappingHits[p][kind] = append(mappingHits[p][kind], slot)
+			}
+		}
+	}
+
+	// mappings of mappings keyed by pairs of addresses
+	nestedHits := make(map[uint64][]types.Hash)
+	addresses := sortedKeys(o.keys[addressKey])
+	if len(addresses) > maxNestedKeys {
+		addresses = addresses[:maxNestedKeys]
+	}
+	for _, outer := range addresses {
+		for p := uint64(0); p <= maxBaseSlot; p++ {
+			inner := mappingSlot(outer, wordHash(p))
+			for _, key := range addresses {
+				slot := mappingSlot(key, inner)
+				if _, ok := hashed[slot]; ok {
+					nestedHits[p] = append(nestedHits[p], slot)
+				}
+			}
+		}
+	}
+
+	for p := uint64(0); p <= maxBaseSlot; p++ {
+		var v *variable
+		var slots []types.Hash
+		switch {
+		case len(nestedHits[p]) > 0:
+			slots = nestedHits[p]
+			valueType := result.valueType(valuesOf(hashed, slots))
+			v = result.mapping(p, []string{addressKey, addressKey}, valueType)
+			v.Evidence = fmt.Sprintf("%d slots are entries keyed by pairs of addresses seen in the contract's transactions and events", len(slots))
+		case len(mappingHits[p]) > 0:
+			// the kind of key with the most entries, ties going to the
+			// kind listed first
+			kind := ""
+			for _, candidate := range keyKinds {
+				if len(mappingHits[p][candidate]) > len(mappingHits[p][kind]) {
+					kind = candidate
+				}
+			}
+			slots = mappingHits[p][kind]
+			valueType := result.valueType(valuesOf(hashed, slots))
+			v = result.mapping(p, []string{kind}, valueType)
+			v.Evidence = fmt.Sprintf("%d slots are entries keyed by %s values seen in the contract's transactions and events", len(slots), kind)
+		default:
+			v, slots = result.dynamic(p, static[p], hashed, claimed)
+		}
+		if v == nil {
+			continue
+		}
+		for _, slot := range slots {
+			claimed[slot] = true
+		}
+		if _, ok := static[p]; ok {
+			// the base slot of a mapping is never written, so anything written
+			// there can't be explained; that of an array or long string holds
+			// its length
+			if strings.HasPrefix(v.typeID, "t_mapping") {
+				result.unexplained++
+			}
+			delete(static, p)
+		}
+		result.variables = append(result.variables, v)
+	}
+
+	for slot := range hashed {
+		if !claimed[slot] {
+			result.unexplained++
+		}
+	}
+
+	for p, values := range static {
+		valueType := result.valueType(values)
+		result.variables = append(result.variables, &variable{
+			InferredVariable: &types.InferredVariable{
+				Slot:       p,
+				Type:       valueType.label,
+				Confidence: valueType.confidence,
+				Evidence:   valueType.evidence,
+			},
+			typeID:       valueType.id,
+			getterOutput: valueType.label,
+		})
+	}
+
+	sort.Slice(result.variables, func(i, j int) bool {
+		return result.variables[i].Slot < result.variables[j].Slot
+	})
+	for _, v := range result.variables {
+		v.Label = fmt.Sprintf("slot%d", v.Slot)
+	}
+	if o.abi != nil {
+		nameVariables(result.variables, o.abi)
+	}
+	return result
+}
+
+// dynamic looks for the data of a dynamic array or long string stored at the
+// base slot, which lies in the slots after the hash of the base slot
+func (a *analysis) dynamic(p uint64, heads [][]byte, hashed map[types.Hash][][]byte, claimed map[types.Hash]bool) (*variable, []types.Hash) {
+	start := new(big.Int).SetBytes(decodeWord(string(keccak(decodeWord(string(wordHash(p)))))))
+	end := new(big.Int).Add(start, big.NewInt(maxArrayLength))
+	var slots []types.Hash
+	var highest uint64
+	for slot := range hashed {
+		if claimed[slot] {
+			continue
+		}
+		position := new(big.Int).SetBytes(decodeWord(string(slot)))
+		if position.Cmp(start) < 0 || position.Cmp(end) >= 0 {
+			continue
+		}
+		slots = append(slots, slot)
+		if offset := new(big.Int).Sub(position, start).Uint64(); offset > highest {
+			highest = offset
+		}
+	}
+	if len(slots) == 0 {
+		return nil, nil
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+
+	// the base slot of a long string or bytes holds twice its length plus
+	// one, which is odd, and that of an array its length
+	long := false
+	var longest uint64
+	for _, head := range heads {
+		value := new(big.Int).SetBytes(head)
+		if value.Bit(0) == 1 {
+			long = true
+		}
+		if value.IsUint64() && value.Uint64() > longest {
+			longest = value.Uint64()
+		}
+	}
+
+	v := &variable{InferredVariable: &types.InferredVariable{Slot: p}}
+	if long {
+		bytesType := a.add(layoutType{id: "t_bytes_storage", label: "bytes", encoding: "bytes", numberOfBytes: 32})
+		if printable(valuesOf(hashed, slots)) {
+			bytesType = a.add(layoutType{id: "t_string_storage", label: "string", encoding: "bytes", numberOfBytes: 32})
+		}
+		v.Type, v.typeID, v.getterOutput = bytesType.label, bytesType.id, bytesType.label
+		v.Confidence = types.MediumConfidence
+		if (longest-1)/2 > highest*32 {
+			v.Confidence = types.HighConfidence
+		}
+		v.Evidence = fmt.Sprintf("the slot holds the length of %s whose data was written to %d slots after its hash", bytesType.label, len(slots))
+		return v, slots
+	}
+
+	element := a.valueType(valuesOf(hashed, slots))
+	arrayType := a.add(layoutType{
+		id:            "t_array(" + element.id + ")dyn_storage",
+		label:         element.label + "[]",
+		encoding:      "dynamic_array",
+		base:          element.id,
+		numberOfBytes: 32,
+	})
+	v.Type, v.typeID = arrayType.label, arrayType.id
+	v.getterInputs, v.getterOutput = []string{uintKey}, element.label
+	v.Confidence = types.MediumConfidence
+	if longest > highest {
+		v.Confidence = types.HighConfidence
+	}
+	v.Evidence = fmt.Sprintf("%d elements were written after the hash of the slot, which holds a length of up to %d", len(slots), longest)
+	return v, slots
+}
+
+// mapping adds the type of a mapping from the keys, outermost first, to the
+// value type
+func (a *analysis) mapping(p uint64, keys []string, value layoutType) *variable {
+	mapped := value
+	for i := len(keys) - 1; i >= 0; i-- {
+		key := a.add(elementaryType(keys[i]))
+		mapped = a.add(layoutType{
+			id:            "t_mapping(" + key.id + "," + mapped.id + ")",
+			label:         "mapping(" + key.label + " => " + mapped.label + ")",
+			encoding:      "mapping",
+			key:           key.id,
+			value:         mapped.id,
+			numberOfBytes: 32,
+		})
+	}
+	return &variable{
+		InferredVariable: &types.InferredVariable{
+			Slot:       p,
+			Type:       mapped.label,
+			Confidence: types.HighConfidence,
+		},
+		typeID:       mapped.id,
+		getterInputs: keys,
+		getterOutput: value.label,
+	}
+}
+
+// valueType is the type every one of the values has the shape of, and
+// records it in the layout
+func (a *analysis) valueType(values [][]byte) layoutType {
+	var nonZero [][]byte
+	for _, value := range values {
+		if new(big.Int).SetBytes(value).Sign() != 0 {
+			nonZero = append(nonZero, value)
+		}
+	}
+	all := func(test func([]byte) bool) bool {
+		for _, value := range nonZero {
+			if !test(value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var inferred layoutType
+	switch {
+	case len(nonZero) == 0:
+		inferred = elementaryType(uintKey)
+		inferred.confidence, inferred.evidence = types.LowConfidence, "only zero was written"
+	case all(isAddress):
+		inferred = elementaryType(addressKey)
+		inferred.confidence, inferred.evidence = types.MediumConfidence, "every value written is an address"
+	case all(isShortString):
+		inferred = layoutType{id: "t_string_storage", label: "string", encoding: "bytes", numberOfBytes: 32}
+		inferred.confidence, inferred.evidence = types.MediumConfidence, "every value written is a short string"
+	case all(func(value []byte) bool { return new(big.Int).SetBytes(value).Cmp(big.NewInt(1)) == 0 }):
+		inferred = elementaryType("bool")
+		inferred.confidence, inferred.evidence = types.LowConfidence, "every value written is 0 or 1"
+	default:
+		inferred = elementaryType(uintKey)
+		inferred.confidence, inferred.evidence = types.LowConfidence, "the values written are numbers"
+	}
+	return a.add(inferred)
+}
+
+func (a *analysis) add(t layoutType) layoutType {
+	a.types[t.id] = t
+	return t
+}
+
+// nameVariables names variables after the public getters of the ABI that take
+// their keys and return their value type, where only one function and one
+// variable share the signature
+func nameVariables(variables []*variable, abi *types.ContractABI) {
+	signature := func(inputs []string, output string) string {
+		return strings.Join(inputs, ",") + ":" + output
+	}
+	functions := make(map[string][]string)
+	for _, function := range abi.Functions {
+		if len(function.Outputs) != 1 {
+			continue
+		}
+		var inputs []string
+		for _, input := range function.Inputs {
+			inputs = append(inputs, input.Type)
+		}
+		key := signature(inputs, function.Outputs[0].Type)
+		functions[key] = append(functions[key], function.Name)
+	}
+	shared := make(map[string]int)
+	for _, v := range variables {
+		shared[signature(v.getterInputs, v.getterOutput)]++
+	}
+	for _, v := range variables {
+		key := signature(v.getterInputs, v.getterOutput)
+		if names := functions[key]; len(names) == 1 && shared[key] == 1 {
+			v.Label = names[0]
+			v.Evidence += "; named after the " + names[0] + " function of the ABI"
+		}
+	}
+}
+
+// layoutType is a type of the layout, along with how sure inference is of it
+// when inferred from values
+type layoutType struct {
+	id            string
+	label         string
+	encoding      string
+	key           string
+	value         string
+	base          string
+	numberOfBytes uint64
+
+	confidence string
+	evidence   string
+}
+
+func elementaryType(label string) layoutType {
+	numberOfBytes := uint64(32)
+	switch label {
+	case addressKey:
+		numberOfBytes = 20
+	case "bool":
+		numberOfBytes = 1
+	}
+	return layoutType{id: "t_" + label, label: label, encoding: "inplace", numberOfBytes: numberOfBytes}
+}
+
+// the storage layout format of solc, which gives slots and sizes as strings
+type layoutDocument struct {
+	Storage []layoutEntry          `json:"storage"`
+	Types   map[string]layoutEntry `json:"types"`
+}
+
+type layoutEntry struct {
+	Label         string `json:"label"`
+	Offset        uint64 `json:"offset,omitempty"`
+	Slot          string `json:"slot,omitempty"`
+	Type          string `json:"type,omitempty"`
+	Encoding      string `json:"encoding,omitempty"`
+	Key           string `json:"key,omitempty"`
+	Value         string `json:"value,omitempty"`
+	Base          string `json:"base,omitempty"`
+	NumberOfBytes string `json:"numberOfBytes,omitempty"`
+}
+
+// layout is the analysis in the storage layout format of solc
+func (a *analysis) layout() (string, error) {
+	document := layoutDocument{Storage: []layoutEntry{}, Types: make(map[string]layoutEntry)}
+	for _, v := range a.variables {
+		document.Storage = append(document.Storage, layoutEntry{
+			Label: v.Label,
+			Slot:  fmt.Sprintf("%d", v.Slot),
+			Type:  v.typeID,
+		})
+	}
+	for id, t := range a.types {
+		document.Types[id] = layoutEntry{
+			Label:         t.label,
+			Encoding:      t.encoding,
+			Key:           t.key,
+			Value:         t.value,
+			Base:          t.base,
+			NumberOfBytes: fmt.Sprintf("%d", t.numberOfBytes),
+		}
+	}
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return "", err
+	}
+	// the layout must be one the storage parser reads
+	var parsed types.SolidityStorageDocument
+	if err := json.Unmarshal(encoded, &parsed); err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// isAddress reports whether the word is an address, which has 12 leading
+// zero bytes and is too large to be a plausible integer
+func isAddress(word []byte) bool {
+	for _, b := range word[:12] {
+		if b != 0 {
+			return false
+		}
+	}
+	return new(big.Int).SetBytes(word).BitLen() > 128
+}
+
+// isShortString reports whether the word is a string of up to 31 printable
+// characters, stored with twice its length in the last byte
+func isShortString(word []byte) bool {
+	length := word[31]
+	if length == 0 || length%2 == 1 || length/2 > 31 {
+		return false
+	}
+	for i, b := range word[:31] {
+		if i < int(length/2) && (b < 0x20 || b > 0x7e) {
+			return false
+		}
+		if i >= int(length/2) && b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// printable reports whether the words are printable text, padded with zeros
+func printable(words [][]byte) bool {
+	for _, word := range words {
+		for _, b := range word {
+			if b != 0 && (b < 0x20 || b > 0x7e) && b != '\n' && b != '\t' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func valuesOf(slots map[types.Hash][][]byte, keys []types.Hash) [][]byte {
+	var values [][]byte
+	for _, key := range keys {
+		values = append(values, slots[key]...)
+	}
+	return values
+}
+
+func sortedKeys(set map[types.Hash]bool) []types.Hash {
+	keys := make([]types.Hash, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// mappingSlot is the slot of the key of a mapping at the position, the
+// keccak256 of the key and position
+func mappingSlot(key types.Hash, position types.Hash) types.Hash {
+	return keccak(append(decodeWord(string(key)), decodeWord(string(position))...))
+}
+
+func wordHash(value uint64) types.Hash {
+	return types.NewHash(fmt.Sprintf("%x", value))
+}
+
+func keccak(data []byte) types.Hash {
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(data)
+	return types.NewHash(hex.EncodeToString(hasher.Sum(nil)))
+}
+
+// decodeWord decodes the hex value as a 32-byte word, left padded with zeros
+func decodeWord(value string) []byte {
+	value = strings.TrimPrefix(value, "0x")
+	if len(value) > 64 {
+		value = value[len(value)-64:]
+	}
+	decoded, _ := hex.DecodeString(fmt.Sprintf("%064v", value))
+	if len(decoded) != 32 {
+		return make([]byte, 32)
+	}
+	return decoded
+}
@@ -0,0 +1,172 @@
+package inference
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const tokenABI = `[
+	{"inputs":[{"name":"account","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"name":"allowance","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"inputs":[],"name":"totalSupply","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"inputs":[],"name":"name","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"inputs":[],"name":"owner","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"inputs":[{"name":"","type":"uint256"}],"name":"holders","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"}
+]`
+
+var (
+	alice = types.NewHash("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	bob   = types.NewHash("0x9d13c6d3afe1721beef56b55d303b09e021e27ab")
+)
+
+// offsetSlot is the slot the offset after the start
+func offsetSlot(start types.Hash, offset int64) types.Hash {
+	position := new(big.Int).SetBytes(decodeWord(string(start)))
+	return types.NewHash(hex.EncodeToString(position.Add(position, big.NewInt(offset)).Bytes()))
+}
+
+func shortString(value string) string {
+	word := make([]byte, 32)
+	copy(word, value)
+	word[31] = byte(len(value) * 2)
+	return hex.EncodeToString(word)
+}
+
+// tokenStorage is the storage of a token with balances at slot 0, allowances
+// at slot 1, the total supply at 2, its name at 3, its owner at 4 and an
+// array of holders at 5
+func tokenStorage(aliceBalance int) map[types.Hash]string {
+	return map[types.Hash]string{
+		mappingSlot(alice, wordHash(0)):                   fmt.Sprintf("%x", aliceBalance),
+		mappingSlot(bob, wordHash(0)):                     fmt.Sprintf("%x", 150-aliceBalance),
+		mappingSlot(bob, mappingSlot(alice, wordHash(1))): "0a",
+		wordHash(2): "96",
+		wordHash(3): shortString("Token"),
+		wordHash(4): string(alice),
+		wordHash(5): "02",
+		offsetSlot(keccak(decodeWord(string(wordHash(5)))), 0): string(alice),
+		offsetSlot(keccak(decodeWord(string(wordHash(5)))), 1): string(bob),
+	}
+}
+
+func tokenObservations(t *testing.T, withABI bool) *observations {
+	o := newObservations()
+	o.addState(tokenStorage(100))
+	o.addState(tokenStorage(150))
+	o.addEvent(&types.Event{
+		Topics: []types.Hash{types.NewHash("ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"), alice, bob},
+		Data:   types.NewHexData(string(wordHash(50))),
+	})
+	if withABI {
+		parsed, err := types.NewABIStructureFromJSON(tokenABI)
+		assert.Nil(t, err)
+		o.abi = parsed.ToInternalABI()
+	}
+	return o
+}
+
+func TestInfer(t *testing.T) {
+	result := infer(tokenObservations(t, false))
+
+	var inferred []types.InferredVariable
+	for _, v := range result.variables {
+		inferred = append(inferred, *v.InferredVariable)
+	}
+	assert.Len(t, inferred, 6)
+	expected := []struct {
+		label      string
+		typ        string
+		confidence string
+	}{
+		{"slot0", "mapping(address => uint256)", types.HighConfidence},
+		{"slot1", "mapping(address => mapping(address => uint256))", types.HighConfidence},
+		{"slot2", "uint256", types.LowConfidence},
+		{"slot3", "string", types.MediumConfidence},
+		{"slot4", "address", types.MediumConfidence},
+		{"slot5", "address[]", types.HighConfidence},
+	}
+	for i, variable := range expected {
+		assert.EqualValues(t, i, inferred[i].Slot)
+		assert.Equal(t, variable.label, inferred[i].Label)
+		assert.Equal(t, variable.typ, inferred[i].Type)
+		assert.Equal(t, variable.confidence, inferred[i].Confidence)
+		assert.NotEmpty(t, inferred[i].Evidence)
+	}
+	assert.EqualValues(t, 0, result.unexplained)
+}
+
+func TestInfer_NamedFromABI(t *testing.T) {
+	result := infer(tokenObservations(t, true))
+
+	var labels []string
+	for _, v := range result.variables {
+		labels = append(labels, v.Label)
+	}
+	assert.Equal(t, []string{"balanceOf", "allowance", "totalSupply", "name", "owner", "holders"}, labels)
+	assert.Contains(t, result.variables[0].Evidence, "named after the balanceOf function of the ABI")
+}
+
+func TestInfer_UnexplainedSlots(t *testing.T) {
+	o := newObservations()
+	// a mapping entry whose key was never seen
+	o.addState(map[types.Hash]string{
+		mappingSlot(alice, wordHash(0)): "01",
+		wordHash(1):                     "01",
+	})
+	result := infer(o)
+
+	assert.Len(t, result.variables, 1)
+	assert.Equal(t, "bool", result.variables[0].Type)
+	assert.Equal(t, types.LowConfidence, result.variables[0].Confidence)
+	assert.EqualValues(t, 1, result.unexplained)
+}
+
+func TestInfer_LongString(t *testing.T) {
+	text := "a string that is too long to be stored in its own slot"
+	data := make([]byte, 64)
+	copy(data, text)
+	start := keccak(decodeWord(string(wordHash(0))))
+
+	o := newObservations()
+	o.addState(map[types.Hash]string{
+		wordHash(0):          fmt.Sprintf("%x", len(text)*2+1),
+		start:                hex.EncodeToString(data[:32]),
+		offsetSlot(start, 1): hex.EncodeToString(data[32:]),
+	})
+	result := infer(o)
+
+	assert.Len(t, result.variables, 1)
+	assert.Equal(t, "string", result.variables[0].Type)
+	assert.Equal(t, types.HighConfidence, result.variables[0].Confidence)
+	assert.EqualValues(t, 0, result.unexplained)
+}
+
+func TestAnalysis_Layout(t *testing.T) {
+	result := infer(tokenObservations(t, true))
+	layout, err := result.layout()
+	assert.Nil(t, err)
+
+	var document types.SolidityStorageDocument
+	assert.Nil(t, json.Unmarshal([]byte(layout), &document))
+	assert.Len(t, document.Storage, 6)
+	assert.Equal(t, "allowance", document.Storage[1].Label)
+	assert.EqualValues(t, 1, document.Storage[1].Slot)
+	assert.Equal(t, "t_mapping(t_address,t_mapping(t_address,t_uint256))", document.Storage[1].Type)
+
+	nested := document.Types["t_mapping(t_address,t_mapping(t_address,t_uint256))"]
+	assert.Equal(t, "mapping", nested.Encoding)
+	assert.Equal(t, "t_address", nested.Key)
+	assert.Equal(t, "t_mapping(t_address,t_uint256)", nested.Value)
+	assert.EqualValues(t, 32, nested.NumberOfBytes)
+	assert.EqualValues(t, 20, document.Types["t_address"].NumberOfBytes)
+	assert.Equal(t, "t_address", document.Types["t_array(t_address)dyn_storage"].Base)
+	assert.Equal(t, "bytes", document.Types["t_string_storage"].Encoding)
+}
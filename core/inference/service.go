@@ -0,0 +1,320 @@
+package inference
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// maxStorageStates is how many of the newest storage states of the
+	// contract are analysed
+	maxStorageStates = 1000
+	// maxSampled is how many of the newest transactions to, and events of,
+	// the contract are sampled for mapping keys
+	maxSampled = 1000
+	// pageSize is how many documents are read at a time
+	pageSize = 100
+
+	storageStep      = "storage"
+	transactionsStep = "transactions"
+	eventsStep       = "events"
+	analysisStep     = "analysis"
+)
+
+var ErrInferenceRunning = errors.New("a storage layout inference is already running")
+
+type InferenceDB interface {
+	GetContractABI(types.Address) (string, error)
+	GetStorageLayout(types.Address) (string, error)
+	GetStorageWithOptions(types.Address, *types.PageOptions) ([]*types.StorageResult, error)
+	GetAllTransactionsToAddress(types.Address, *types.QueryOptions) ([]types.Hash, error)
+	GetAllEventsFromAddress(types.Address, *types.QueryOptions) ([]*types.Event, error)
+	ReadTransaction(types.Hash) (*types.Transaction, error)
+}
+
+// Service infers storage layouts for contracts registered without one, from
+// the storage they have been seen to write, proposing a variable for each
+// slot or group of slots: mappings keyed by the addresses and values seen in
+// the contract's transactions and events, dynamic arrays and long strings
+// found after the hash of their slot, and plain variables typed by the values
+// written to them. Where the contract has an ABI, variables are named after
+// the public getters matching them.
+//
+// Inferences are tracked as jobs, one running at a time, each with a proposal
+// for a user to review and accept as the contract's layout.
+type Service struct {
+	db InferenceDB
+
+	jobs      *database.JobTracker
+	proposals map[string]*types.LayoutProposal
+	mux       sync.Mutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewService(db InferenceDB) *Service {
+	return &Service{
+		db:           db,
+		jobs:         database.NewJobTracker(),
+		proposals:    make(map[string]*types.LayoutProposal),
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (s *Service) Start() error {
+	log.Info("Starting storage layout inference service")
+	return nil
+}
+
+// Stop stops a running inference at its next page, after which it fails and
+// can be retried.
+func (s *Service) Stop() {
+	close(s.shutdownChan)
+	s.shutdownWg.Wait()
+	log.Info("Storage layout inference service stopped")
+}
+
+// Infer starts inferring the storage layout of the contract in the background,
+// returning the ID of its job. Contracts that already have a layout are not
+// inferred.
+func (s *Service) Infer(address types.Address) (string, error) {
+	layout, err := s.db.GetStorageLayout(address)
+	if err != nil {
+		return "", err
+	}
+	if layout != "" {
+		return "", fmt.Errorf("contract %s already has a storage layout", address.Hex())
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running() {
+		return "", ErrInferenceRunning
+	}
+	id := s.jobs.Start(types.InferLayoutJob, address)
+	s.run(id, address)
+	return id, nil
+}
+
+// Retry runs a failed inference again, starting its proposal again.
+func (s *Service) Retry(id string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running() {
+		return ErrInferenceRunning
+	}
+	job, err := s.jobs.Restart(id)
+	if err != nil {
+		return err
+	}
+	s.run(id, job.Address)
+	return nil
+}
+
+func (s *Service) GetJobs() []*types.Job {
+	return s.jobs.All()
+}
+
+func (s *Service) GetJob(id string) (*types.Job, error) {
+	return s.jobs.Get(id)
+}
+
+// GetProposal returns a copy of the proposal of the inference, which is
+// empty until it completes.
+func (s *Service) GetProposal(id string) (*types.LayoutProposal, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	proposal, ok := s.proposals[id]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	copied := *proposal
+	copied.Variables = make([]*types.InferredVariable, len(proposal.Variables))
+	for i, variable := range proposal.Variables {
+		copiedVariable := *variable
+		copied.Variables[i] = &copiedVariable
+	}
+	return &copied, nil
+}
+
+// Accepted records that the layout of the proposal was accepted as the
+// layout of its contract.
+func (s *Service) Accepted(id string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	proposal, ok := s.proposals[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	proposal.Accepted = true
+	return nil
+}
+
+// running reports whether an inference is in progress; the lock must be held
+func (s *Service) running() bool {
+	for _, job := range s.jobs.All() {
+		if job.Status == types.JobRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// run infers the layout in the background; the lock must be held
+func (s *Service) run(id string, address types.Address) {
+	proposal := &types.LayoutProposal{JobID: id, Address: address, Variables: []*types.InferredVariable{}}
+	s.proposals[id] = proposal
+	s.jobs.Update(id, func(job *types.Job) {
+		job.Processed = 0
+	})
+
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		log.Info("Storage layout inference started", "job", id, "address", address.Hex())
+		err := s.infer(id, proposal)
+		if err != nil {
+			log.Error("Storage layout inference failed", "job", id, "address", address.Hex(), "err", err)
+		} else {
+			log.Info("Storage layout inference completed", "job", id, "address", address.Hex())
+		}
+		s.jobs.Finish(id, err)
+	}()
+}
+
+func (s *Service) infer(id string, proposal *types.LayoutProposal) error {
+	observed := newObservations()
+	address := proposal.Address
+
+	abi, err := s.db.GetContractABI(address)
+	if err != nil {
+		return err
+	}
+	if abi != "" {
+		// a contract's ABI only helps name the variables, so one that doesn't
+		// parse is ignored
+		if parsed, err := types.NewABIStructureFromJSON(abi); err == nil {
+			observed.abi = parsed.ToInternalABI()
+		}
+	}
+
+	s.step(id, storageStep)
+	seen := make(map[uint64]bool)
+	for page := 0; len(seen) < maxStorageStates; page++ {
+		if err := s.checkShutdown(); err != nil {
+			return err
+		}
+		options := &types.PageOptions{PageSize: pageSize, PageNumber: page}
+		options.SetDefaults()
+		states, err := s.db.GetStorageWithOptions(address, options)
+		if err != nil {
+			return err
+		}
+		added := 0
+		for _, state := range states {
+			if seen[state.BlockNumber] || len(seen) >= maxStorageStates {
+				continue
+			}
+			seen[state.BlockNumber] = true
+			observed.addState(state.Storage)
+			added++
+		}
+		s.progress(id, uint64(added))
+		// a page of only states already seen is the end of a database that
+		// doesn't page storage
+		if len(states) < pageSize || added == 0 {
+			break
+		}
+	}
+
+	s.step(id, transactionsStep)
+	for page := 0; page*pageSize < maxSampled; page++ {
+		if err := s.checkShutdown(); err != nil {
+			return err
+		}
+		options := &types.QueryOptions{PageSize: pageSize, PageNumber: page}
+		options.SetDefaults()
+		hashes, err := s.db.GetAllTransactionsToAddress(address, options)
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			tx, err := s.db.ReadTransaction(hash)
+			if err != nil {
+				return err
+			}
+			observed.addTransaction(tx)
+		}
+		s.progress(id, uint64(len(hashes)))
+		if len(hashes) < pageSize {
+			break
+		}
+	}
+
+	s.step(id, eventsStep)
+	for page := 0; page*pageSize < maxSampled; page++ {
+		if err := s.checkShutdown(); err != nil {
+			return err
+		}
+		options := &types.QueryOptions{PageSize: pageSize, PageNumber: page}
+		options.SetDefaults()
+		events, err := s.db.GetAllEventsFromAddress(address, options)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			observed.addEvent(event)
+		}
+		s.progress(id, uint64(len(events)))
+		if len(events) < pageSize {
+			break
+		}
+	}
+
+	s.step(id, analysisStep)
+	result := infer(observed)
+	layout, err := result.layout()
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	proposal.States = observed.states
+	proposal.UnexplainedSlots = result.unexplained
+	for _, v := range result.variables {
+		proposal.Variables = append(proposal.Variables, v.InferredVariable)
+	}
+	proposal.Layout = layout
+	proposal.Complete = true
+	return nil
+}
+
+func (s *Service) checkShutdown() error {
+	select {
+	case <-s.shutdownChan:
+		return errors.New("storage layout inference service is shutting down")
+	default:
+		return nil
+	}
+}
+
+func (s *Service) step(id string, step string) {
+	s.jobs.Update(id, func(job *types.Job) {
+		job.Step = step
+	})
+}
+
+// progress counts the documents read, over all the steps
+func (s *Service) progress(id string, read uint64) {
+	s.jobs.Update(id, func(job *types.Job) {
+		job.Processed += read
+	})
+}
@@ -0,0 +1,133 @@
+package inference
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/core/jobtest"
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+var tokenAddress = types.NewAddress("0x0000000000000000000000000000000000000010")
+
+// tokenDB stores two states of the token, and a transfer from alice to bob
+func tokenDB(t *testing.T) *memory.MemoryDB {
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{tokenAddress}))
+	assert.Nil(t, db.AddTemplate("token", tokenABI, ""))
+	assert.Nil(t, db.AssignTemplate(tokenAddress, "token"))
+
+	tx := &types.Transaction{
+		Hash:        types.NewHash("0x01"),
+		BlockNumber: 1,
+		From:        types.NewAddress(string(alice)[24:]),
+		To:          tokenAddress,
+		Data:        types.NewHexData("a9059cbb" + string(bob) + string(wordHash(50))),
+	}
+	block := &types.Block{Number: 1, Transactions: []types.Hash{tx.Hash}}
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{tokenAddress}, []*types.Block{block}))
+
+	for number, balance := range map[uint64]int{1: 100, 2: 150} {
+		state := map[types.Address]*types.AccountState{
+			tokenAddress: {Root: types.NewHash(string(wordHash(number))), Storage: tokenStorage(balance)},
+		}
+		assert.Nil(t, db.IndexStorage(state, number))
+	}
+	return db
+}
+
+func TestInfer_Service(t *testing.T) {
+	s := NewService(tokenDB(t))
+	defer s.Stop()
+
+	id, err := s.Infer(tokenAddress)
+	assert.Nil(t, err)
+	assert.Equal(t, "inferStorageLayout-1", id)
+	job := jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobCompleted, job.Status)
+	assert.Equal(t, tokenAddress, job.Address)
+	// two states, a transaction and no events
+	assert.EqualValues(t, 3, job.Processed)
+
+	proposal, err := s.GetProposal(id)
+	assert.Nil(t, err)
+	assert.True(t, proposal.Complete)
+	assert.False(t, proposal.Accepted)
+	assert.Equal(t, tokenAddress, proposal.Address)
+	assert.EqualValues(t, 2, proposal.States)
+	assert.EqualValues(t, 0, proposal.UnexplainedSlots)
+	assert.Len(t, proposal.Variables, 6)
+	assert.Equal(t, "balanceOf", proposal.Variables[0].Label)
+	assert.Equal(t, "mapping(address => uint256)", proposal.Variables[0].Type)
+	var document types.SolidityStorageDocument
+	assert.Nil(t, json.Unmarshal([]byte(proposal.Layout), &document))
+	assert.Len(t, document.Storage, 6)
+
+	// the proposal returned is a copy
+	proposal.Variables[0].Label = "changed"
+	proposal, _ = s.GetProposal(id)
+	assert.Equal(t, "balanceOf", proposal.Variables[0].Label)
+
+	assert.Nil(t, s.Accepted(id))
+	proposal, _ = s.GetProposal(id)
+	assert.True(t, proposal.Accepted)
+
+	_, err = s.GetProposal("inferStorageLayout-2")
+	assert.Equal(t, database.ErrNotFound, err)
+	assert.Equal(t, database.ErrNotFound, s.Accepted("inferStorageLayout-2"))
+}
+
+func TestInfer_ExistingLayout(t *testing.T) {
+	db := tokenDB(t)
+	assert.Nil(t, db.AddTemplate("token", tokenABI, `{"storage":[],"types":{}}`))
+	s := NewService(db)
+	defer s.Stop()
+
+	_, err := s.Infer(tokenAddress)
+	assert.EqualError(t, err, "contract 0x0000000000000000000000000000000000000010 already has a storage layout")
+	assert.Empty(t, s.GetJobs())
+}
+
+// failingDB fails to read the first page of storage
+type failingDB struct {
+	*memory.MemoryDB
+	failed bool
+}
+
+func (f *failingDB) GetStorageWithOptions(address types.Address, options *types.PageOptions) ([]*types.StorageResult, error) {
+	if !f.failed {
+		f.failed = true
+		return nil, errors.New("search timed out")
+	}
+	return f.MemoryDB.GetStorageWithOptions(address, options)
+}
+
+func TestInfer_Retry(t *testing.T) {
+	s := NewService(&failingDB{MemoryDB: tokenDB(t)})
+	defer s.Stop()
+
+	id, err := s.Infer(tokenAddress)
+	assert.Nil(t, err)
+	job := jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobFailed, job.Status)
+	assert.Equal(t, "search timed out", job.Error)
+	assert.Equal(t, storageStep, job.Step)
+	proposal, err := s.GetProposal(id)
+	assert.Nil(t, err)
+	assert.False(t, proposal.Complete)
+
+	assert.Nil(t, s.Retry(id))
+	job = jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobCompleted, job.Status)
+	proposal, err = s.GetProposal(id)
+	assert.Nil(t, err)
+	assert.True(t, proposal.Complete)
+	assert.Len(t, proposal.Variables, 6)
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// pausable is a service that can stop ingesting blocks until resume is closed
+type pausable interface {
+	Pause(ctx context.Context, resume <-chan struct{}) error
+}
+
+// contractThrottler tracks what ingesting each contract costs, and can leave
+// contracts out of ingestion, or filter one again
+type contractThrottler interface {
+	ContractCosts() []*types.ContractCost
+	ThrottleContract(address types.Address, throttled bool) error
+	RefilterContract(address types.Address, from uint64) error
+}
+
+var (
+	errCostsSharded    = errors.New("contract costs can't be reported when filtering is sharded, as each instance only tracks its own shards")
+	errRefilterSharded = errors.New("contracts can't be refiltered when filtering is sharded, as only the leader would refilter them")
+)
+
+// ingestionPause pauses and resumes the monitor and filter services together,
+// for maintenance windows. Backfills are explicit jobs, so keep running.
+type ingestionPause struct {
+	services  []pausable
+	contracts contractThrottler
+	// filtering is shared between instances, which only track the costs of
+	// their own shards
+	sharded bool
+
+	// pausing and resuming happen one at a time
+	mux sync.Mutex
+	// closed to resume ingestion, nil while not paused
+	resume    chan struct{}
+	resumeMux sync.RWMutex
+}
+
+func newIngestionPause(services ...pausable) *ingestionPause {
+	return &ingestionPause{services: services}
+}
+
+// PauseIngestion stops syncing and filtering new blocks, returning once the
+// blocks already fetched have been persisted and the batch being filtered is
+// done. Pausing while paused does nothing. If the context is done first,
+// ingestion is resumed.
+func (p *ingestionPause) PauseIngestion(ctx context.Context) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.Paused() {
+		return nil
+	}
+	return p.pauseIngestion(ctx)
+}
+
+// pauseIngestion pauses all the services; the lock must be held
+func (p *ingestionPause) pauseIngestion(ctx context.Context) error {
+	resume := make(chan struct{})
+	for _, service := range p.services {
+		if err := service.Pause(ctx, resume); err != nil {
+			close(resume)
+			return fmt.Errorf("pausing ingestion failed: %v", err)
+		}
+	}
+	p.resumeMux.Lock()
+	p.resume = resume
+	p.resumeMux.Unlock()
+	log.Info("Ingestion paused")
+	return nil
+}
+
+// ResumeIngestion starts syncing and filtering blocks again, from the last
+// persisted and filtered blocks. Resuming while not paused does nothing.
+func (p *ingestionPause) ResumeIngestion() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if !p.Paused() {
+		return
+	}
+	p.resumeIngestion()
+}
+
+// resumeIngestion resumes all the services; the lock must be held
+func (p *ingestionPause) resumeIngestion() {
+	p.resumeMux.Lock()
+	close(p.resume)
+	p.resume = nil
+	p.resumeMux.Unlock()
+	log.Info("Ingestion resumed")
+}
+
+// ContractCosts returns what ingesting each contract has cost since starting
+func (p *ingestionPause) ContractCosts() ([]*types.ContractCost, error) {
+	if p.sharded {
+		return nil, errCostsSharded
+	}
+	if p.contracts == nil {
+		return nil, nil
+	}
+	return p.contracts.ContractCosts(), nil
+}
+
+// ThrottleContract leaves a contract out of ingestion, or includes it again
+func (p *ingestionPause) ThrottleContract(address types.Address, throttled bool) error {
+	if p.contracts == nil {
+		return nil
+	}
+	return p.contracts.ThrottleContract(address, throttled)
+}
+
+// RefilterContract queues the blocks from the given block to be filtered
+// again for one contract. They are reindexed alongside ingestion, which isn't
+// paused, as the contract's last filtered block is left as it is.
+func (p *ingestionPause) RefilterContract(ctx context.Context, address types.Address, from uint64) error {
+	if p.contracts == nil {
+		return errors.New("contracts can not be refiltered")
+	}
+	if p.sharded {
+		return errRefilterSharded
+	}
+	return p.contracts.RefilterContract(address, from)
+}
+
+// Paused checks if ingestion has been paused, and not resumed since
+func (p *ingestionPause) Paused() bool {
+	p.resumeMux.RLock()
+	defer p.resumeMux.RUnlock()
+	return p.resume != nil
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// fakePausable records the channel it was last told to resume on
+type fakePausable struct {
+	resume <-chan struct{}
+	err    error
+	pauses int
+}
+
+func (f *fakePausable) Pause(ctx context.Context, resume <-chan struct{}) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.resume = resume
+	f.pauses++
+	return nil
+}
+
+func resumed(resume <-chan struct{}) bool {
+	select {
+	case <-resume:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestIngestionPause(t *testing.T) {
+	monitor, filter := &fakePausable{}, &fakePausable{}
+	ingestion := newIngestionPause(monitor, filter)
+
+	assert.Nil(t, ingestion.PauseIngestion(context.Background()))
+	assert.True(t, ingestion.Paused())
+	assert.Equal(t, monitor.resume, filter.resume)
+	assert.False(t, resumed(monitor.resume))
+
+	// pausing again does nothing
+	assert.Nil(t, ingestion.PauseIngestion(context.Background()))
+	assert.Equal(t, 1, monitor.pauses)
+
+	ingestion.ResumeIngestion()
+	assert.False(t, ingestion.Paused())
+	assert.True(t, resumed(monitor.resume))
+
+	// resuming again does nothing
+	ingestion.ResumeIngestion()
+	assert.False(t, ingestion.Paused())
+}
+
+func TestIngestionPause_Failure(t *testing.T) {
+	monitor, filter := &fakePausable{}, &fakePausable{err: context.DeadlineExceeded}
+	ingestion := newIngestionPause(monitor, filter)
+
+	err := ingestion.PauseIngestion(context.Background())
+	assert.Equal(t, errors.New("pausing ingestion failed: context deadline exceeded"), err)
+	assert.False(t, ingestion.Paused())
+	// the services already paused are resumed
+	assert.True(t, resumed(monitor.resume))
+}
+
+// fakeContracts records the contracts refiltered, and whether ingestion was
+// paused when they were
+type fakeContracts struct {
+	ingestion  *ingestionPause
+	refiltered map[types.Address]uint64
+	paused     bool
+}
+
+func (f *fakeContracts) ContractCosts() []*types.ContractCost {
+	return nil
+}
+
+func (f *fakeContracts) ThrottleContract(address types.Address, throttled bool) error {
+	return nil
+}
+
+func (f *fakeContracts) RefilterContract(address types.Address, from uint64) error {
+	f.refiltered[address] = from
+	f.paused = f.ingestion.Paused()
+	return nil
+}
+
+func TestIngestionPause_RefilterContract(t *testing.T) {
+	monitor, filter := &fakePausable{}, &fakePausable{}
+	ingestion := newIngestionPause(monitor, filter)
+	contracts := &fakeContracts{ingestion: ingestion, refiltered: make(map[types.Address]uint64)}
+	ingestion.contracts = contracts
+	address := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+
+	// ingestion carries on while refiltering
+	assert.Nil(t, ingestion.RefilterContract(context.Background(), address, 10))
+	assert.EqualValues(t, 10, contracts.refiltered[address])
+	assert.False(t, contracts.paused)
+	assert.Equal(t, 0, filter.pauses)
+
+	// and is left paused if it already was
+	assert.Nil(t, ingestion.PauseIngestion(context.Background()))
+	assert.Nil(t, ingestion.RefilterContract(context.Background(), address, 20))
+	assert.EqualValues(t, 20, contracts.refiltered[address])
+	assert.True(t, ingestion.Paused())
+	assert.Equal(t, 1, filter.pauses)
+}
+
+func TestIngestionPause_Sharded(t *testing.T) {
+	ingestion := newIngestionPause(&fakePausable{}, &fakePausable{})
+	contracts := &fakeContracts{ingestion: ingestion, refiltered: make(map[types.Address]uint64)}
+	ingestion.contracts = contracts
+	ingestion.sharded = true
+	address := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+
+	// the leader doesn't filter the contracts of other shards
+	assert.Equal(t, errRefilterSharded, ingestion.RefilterContract(context.Background(), address, 10))
+	assert.Empty(t, contracts.refiltered)
+	_, err := ingestion.ContractCosts()
+	assert.Equal(t, errCostsSharded, err)
+	// throttling is stored, so followed by every instance
+	assert.Nil(t, ingestion.ThrottleContract(address, true))
+}
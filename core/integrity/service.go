@@ -0,0 +1,225 @@
+package integrity
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// progressInterval is how many documents are verified between job
+	// progress updates
+	progressInterval = 1000
+	// maxListedMismatches is how many mismatching documents a report lists;
+	// any more are only counted
+	maxListedMismatches = 1000
+)
+
+var ErrVerificationRunning = errors.New("an integrity verification is already running")
+
+type IntegrityDB interface {
+	database.IntegrityDB
+	GetLastPersistedBlockNumber() (uint64, error)
+}
+
+// Service verifies the checksums of the blocks, transactions and events
+// stored in a block range, reporting the documents whose content no longer
+// matches the checksum it was stored with, which have been corrupted or
+// changed outside of the application since. Documents stored before
+// checksums were computed are counted, but can't be verified.
+//
+// Verifications are tracked as jobs, one running at a time, each with a
+// report that is filled in as it goes. A failed verification can be retried,
+// which starts its report again.
+type Service struct {
+	db IntegrityDB
+
+	jobs    *database.JobTracker
+	reports map[string]*types.IntegrityReport
+	mux     sync.Mutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewService(db IntegrityDB) *Service {
+	return &Service{
+		db:           db,
+		jobs:         database.NewJobTracker(),
+		reports:      make(map[string]*types.IntegrityReport),
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (s *Service) Start() error {
+	log.Info("Starting integrity service")
+	return nil
+}
+
+// Stop stops a running verification at its next document, after which it
+// fails and can be retried.
+func (s *Service) Stop() {
+	close(s.shutdownChan)
+	s.shutdownWg.Wait()
+	log.Info("Integrity service stopped")
+}
+
+// Verify starts verifying the documents stored from and to (inclusive) in the
+// background, returning the ID of its job. A range ending at 0 ends at the
+// last persisted block.
+func (s *Service) Verify(from, to uint64) (string, error) {
+	lastPersisted, err := s.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		return "", err
+	}
+	if to == 0 || to > lastPersisted {
+		to = lastPersisted
+	}
+	if from > to {
+		return "", fmt.Errorf("nothing to verify: blocks have been persisted to block %d", lastPersisted)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running() {
+		return "", ErrVerificationRunning
+	}
+	id := s.jobs.Start(types.IntegrityJob, "")
+	s.jobs.Update(id, func(job *types.Job) {
+		job.StartBlock = from
+		job.EndBlock = to
+	})
+	s.run(id, from, to)
+	return id, nil
+}
+
+// Retry runs a failed verification again, starting its report again.
+func (s *Service) Retry(id string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running() {
+		return ErrVerificationRunning
+	}
+	job, err := s.jobs.Restart(id)
+	if err != nil {
+		return err
+	}
+	s.run(id, job.StartBlock, job.EndBlock)
+	return nil
+}
+
+func (s *Service) GetJobs() []*types.Job {
+	return s.jobs.All()
+}
+
+func (s *Service) GetJob(id string) (*types.Job, error) {
+	return s.jobs.Get(id)
+}
+
+// GetReport returns a copy of the report of the verification, which is
+// incomplete while it is running or if it failed.
+func (s *Service) GetReport(id string) (*types.IntegrityReport, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	report, ok := s.reports[id]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	copied := *report
+	copied.Mismatches = append([]*types.ChecksumMismatch{}, report.Mismatches...)
+	return &copied, nil
+}
+
+// running reports whether a verification is in progress; the lock must be
+// held
+func (s *Service) running() bool {
+	for _, job := range s.jobs.All() {
+		if job.Status == types.JobRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// run verifies the range in the background; the lock must be held
+func (s *Service) run(id string, from, to uint64) {
+	report := &types.IntegrityReport{JobID: id, StartBlock: from, EndBlock: to, Mismatches: []*types.ChecksumMismatch{}}
+	s.reports[id] = report
+
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		log.Info("Integrity verification started", "job", id, "start", from, "end", to)
+		err := s.verify(id, report)
+		s.mux.Lock()
+		report.Complete = err == nil
+		verified, mismatches := report.Verified, report.MismatchCount
+		s.mux.Unlock()
+		if err != nil {
+			log.Error("Integrity verification failed", "job", id, "err", err)
+		} else {
+			log.Info("Integrity verification completed", "job", id, "verified", verified, "mismatches", mismatches)
+		}
+		s.jobs.Finish(id, err)
+	}()
+}
+
+func (s *Service) verify(id string, report *types.IntegrityReport) error {
+	var processed uint64
+	err := s.db.ExportStoredDocuments(report.StartBlock, report.EndBlock, func(document *types.StoredDocument) error {
+		select {
+		case <-s.shutdownChan:
+			return errors.New("integrity service is shutting down")
+		default:
+		}
+		var mismatch *types.ChecksumMismatch
+		if document.Checksum != "" {
+			computed, err := types.Checksum(document.Content)
+			if err != nil {
+				return err
+			}
+			if computed != document.Checksum {
+				mismatch = &types.ChecksumMismatch{
+					Kind:        document.Kind,
+					ID:          document.ID,
+					BlockNumber: document.BlockNumber,
+					Stored:      document.Checksum,
+					Computed:    computed,
+				}
+				log.Warn("Stored document does not match its checksum", "kind", document.Kind, "id", document.ID, "block", document.BlockNumber)
+			}
+		}
+
+		s.mux.Lock()
+		switch {
+		case document.Checksum == "":
+			report.Unverified++
+		case mismatch != nil:
+			report.Verified++
+			report.MismatchCount++
+			if len(report.Mismatches) < maxListedMismatches {
+				report.Mismatches = append(report.Mismatches, mismatch)
+			}
+		default:
+			report.Verified++
+		}
+		s.mux.Unlock()
+
+		processed++
+		if processed%progressInterval == 0 {
+			s.jobs.Update(id, func(job *types.Job) {
+				job.Processed = processed
+			})
+		}
+		return nil
+	})
+	s.jobs.Update(id, func(job *types.Job) {
+		job.Processed = processed
+	})
+	return err
+}
@@ -0,0 +1,120 @@
+package integrity
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/core/jobtest"
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestVerify(t *testing.T) {
+	db := memory.NewMemoryDB()
+	var txs []*types.Transaction
+	for number := uint64(1); number <= 3; number++ {
+		tx := &types.Transaction{Hash: types.NewHash(fmt.Sprintf("0x%x", number)), BlockNumber: number, Value: 10}
+		assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx}))
+		assert.Nil(t, db.WriteBlocks([]*types.Block{{Number: number, Transactions: []types.Hash{tx.Hash}}}))
+		txs = append(txs, tx)
+	}
+	// the memory database stores the transaction itself, so changing it
+	// changes what is stored
+	txs[1].Value = 1000
+
+	s := NewService(db)
+	defer s.Stop()
+
+	id, err := s.Verify(0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "verifyIntegrity-1", id)
+	job := jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobCompleted, job.Status)
+	assert.EqualValues(t, 3, job.EndBlock)
+	assert.EqualValues(t, 6, job.Processed)
+
+	report, err := s.GetReport(id)
+	assert.Nil(t, err)
+	assert.True(t, report.Complete)
+	assert.EqualValues(t, 6, report.Verified)
+	assert.EqualValues(t, 0, report.Unverified)
+	assert.EqualValues(t, 1, report.MismatchCount)
+	assert.Len(t, report.Mismatches, 1)
+	computed, _ := types.Checksum(txs[1])
+	assert.Equal(t, types.TransactionDocument, report.Mismatches[0].Kind)
+	assert.Equal(t, txs[1].Hash.String(), report.Mismatches[0].ID)
+	assert.EqualValues(t, 2, report.Mismatches[0].BlockNumber)
+	assert.Equal(t, computed, report.Mismatches[0].Computed)
+	assert.NotEqual(t, computed, report.Mismatches[0].Stored)
+
+	// a range outside of the tampered block has no mismatches
+	id, err = s.Verify(3, 10)
+	assert.Nil(t, err)
+	jobtest.WaitForJob(t, s, id)
+	report, err = s.GetReport(id)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, report.Verified)
+	assert.Empty(t, report.Mismatches)
+}
+
+func TestVerify_InvalidRange(t *testing.T) {
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.WriteBlocks([]*types.Block{{Number: 1}}))
+	s := NewService(db)
+	defer s.Stop()
+
+	_, err := s.Verify(2, 5)
+	assert.EqualError(t, err, "nothing to verify: blocks have been persisted to block 1")
+	_, err = s.GetReport("verifyIntegrity-1")
+	assert.Equal(t, database.ErrNotFound, err)
+	assert.Empty(t, s.GetJobs())
+}
+
+// failingDB fails the first export, after passing a document stored without a
+// checksum
+type failingDB struct {
+	failed bool
+}
+
+func (f *failingDB) GetLastPersistedBlockNumber() (uint64, error) {
+	return 10, nil
+}
+
+func (f *failingDB) ExportStoredDocuments(start uint64, end uint64, fn func(*types.StoredDocument) error) error {
+	if err := fn(&types.StoredDocument{Kind: types.BlockDocument, ID: "1", BlockNumber: 1, Content: &types.Block{Number: 1}}); err != nil {
+		return err
+	}
+	if !f.failed {
+		f.failed = true
+		return errors.New("scroll expired")
+	}
+	return nil
+}
+
+func TestVerify_Retry(t *testing.T) {
+	s := NewService(&failingDB{})
+	defer s.Stop()
+
+	id, err := s.Verify(1, 10)
+	assert.Nil(t, err)
+	job := jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobFailed, job.Status)
+	assert.Equal(t, "scroll expired", job.Error)
+	report, err := s.GetReport(id)
+	assert.Nil(t, err)
+	assert.False(t, report.Complete)
+	assert.EqualValues(t, 1, report.Unverified)
+
+	assert.Nil(t, s.Retry(id))
+	job = jobtest.WaitForJob(t, s, id)
+	assert.Equal(t, types.JobCompleted, job.Status)
+	report, err = s.GetReport(id)
+	assert.Nil(t, err)
+	assert.True(t, report.Complete)
+	assert.EqualValues(t, 0, report.Verified)
+	assert.EqualValues(t, 1, report.Unverified)
+}
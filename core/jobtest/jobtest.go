@@ -0,0 +1,33 @@
+// Package jobtest helps test the services running jobs in the background,
+// such as backfills and exports.
+package jobtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// JobGetter looks up the jobs a service started
+type JobGetter interface {
+	GetJob(id string) (*types.Job, error)
+}
+
+// WaitForJob polls the service until the job is no longer running, and
+// returns it. The test fails if it is still running after 5 seconds.
+func WaitForJob(t *testing.T, jobs JobGetter, id string) *types.Job {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		job, err := jobs.GetJob(id)
+		assert.Nil(t, err)
+		if job.Status != types.JobRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
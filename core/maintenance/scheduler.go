@@ -0,0 +1,102 @@
+package maintenance
+
+import (
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// checkInterval is how often the scheduler checks whether it is in the quiet
+// hours
+const checkInterval = time.Minute
+
+// Scheduler compacts the database indices once a day, during the configured
+// quiet hours. If compacting fails, it is tried again at the next check while
+// still in the quiet hours.
+type Scheduler struct {
+	db             database.MaintenanceDB
+	quietStart     int
+	quietEnd       int
+	mergeIndices   []string
+	maxNumSegments int
+
+	// the start of the quiet hours compaction last completed in
+	lastCompacted time.Time
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewScheduler(db database.MaintenanceDB, config *types.MaintenanceConfig) *Scheduler {
+	return &Scheduler{
+		db:             db,
+		quietStart:     config.QuietHoursStart,
+		quietEnd:       config.QuietHoursEnd,
+		mergeIndices:   config.MergeIndices,
+		maxNumSegments: config.MaxNumSegments,
+		shutdownChan:   make(chan struct{}),
+	}
+}
+
+func (s *Scheduler) Start() error {
+	log.Info("Starting maintenance scheduler", "quiet hours start", s.quietStart, "quiet hours end", s.quietEnd)
+
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.check(time.Now())
+			case <-s.shutdownChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *Scheduler) Stop() {
+	close(s.shutdownChan)
+	s.shutdownWg.Wait()
+	log.Info("Maintenance scheduler stopped")
+}
+
+// check compacts the indices if the given time is in the quiet hours, and
+// they have not already been compacted in these quiet hours
+func (s *Scheduler) check(now time.Time) {
+	quietStart, ok := s.quietHoursStart(now)
+	if !ok || quietStart.Equal(s.lastCompacted) {
+		return
+	}
+
+	log.Info("Compacting indices", "merged indices", s.mergeIndices, "max segments", s.maxNumSegments)
+	if err := s.db.Compact(s.mergeIndices, s.maxNumSegments); err != nil {
+		log.Warn("Compacting indices failed", "err", err)
+		return
+	}
+	s.lastCompacted = quietStart
+	log.Info("Compacted indices", "took", time.Since(now))
+}
+
+// quietHoursStart returns when the quiet hours the given time is in started,
+// or false if it is not in the quiet hours
+func (s *Scheduler) quietHoursStart(now time.Time) (time.Time, bool) {
+	now = now.UTC()
+	hour := now.Hour()
+	today := time.Date(now.Year(), now.Month(), now.Day(), s.quietStart, 0, 0, 0, time.UTC)
+	if s.quietStart < s.quietEnd {
+		return today, hour >= s.quietStart && hour < s.quietEnd
+	}
+	// the quiet hours run past midnight
+	if hour >= s.quietStart {
+		return today, true
+	}
+	return today.AddDate(0, 0, -1), hour < s.quietEnd
+}
@@ -0,0 +1,80 @@
+package maintenance
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+type fakeDB struct {
+	compactions int
+	err         error
+}
+
+func (f *fakeDB) Compact(mergeIndices []string, maxNumSegments int) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.compactions++
+	return nil
+}
+
+func at(day, hour int) time.Time {
+	return time.Date(2020, time.September, day, hour, 30, 0, 0, time.UTC)
+}
+
+func TestQuietHoursStart(t *testing.T) {
+	daytime := NewScheduler(&fakeDB{}, &types.MaintenanceConfig{QuietHoursStart: 2, QuietHoursEnd: 5})
+	overnight := NewScheduler(&fakeDB{}, &types.MaintenanceConfig{QuietHoursStart: 22, QuietHoursEnd: 4})
+
+	cases := []struct {
+		scheduler *Scheduler
+		now       time.Time
+		start     time.Time
+		quiet     bool
+	}{
+		{daytime, at(10, 1), at(10, 2), false},
+		{daytime, at(10, 2), at(10, 2), true},
+		{daytime, at(10, 4), at(10, 2), true},
+		{daytime, at(10, 5), at(10, 2), false},
+		{overnight, at(10, 21), at(10, 22), false},
+		{overnight, at(10, 22), at(10, 22), true},
+		{overnight, at(11, 3), at(10, 22), true},
+		{overnight, at(11, 4), at(10, 22), false},
+	}
+	for _, tc := range cases {
+		start, quiet := tc.scheduler.quietHoursStart(tc.now)
+		assert.Equal(t, tc.quiet, quiet, "at %v", tc.now)
+		if quiet {
+			assert.Equal(t, tc.start.Truncate(time.Hour), start, "at %v", tc.now)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	db := &fakeDB{}
+	s := NewScheduler(db, &types.MaintenanceConfig{QuietHoursStart: 22, QuietHoursEnd: 4})
+
+	s.check(at(10, 12))
+	assert.Equal(t, 0, db.compactions)
+
+	// once in each quiet hours, which run past midnight
+	s.check(at(10, 22))
+	s.check(at(10, 23))
+	s.check(at(11, 1))
+	assert.Equal(t, 1, db.compactions)
+
+	// retried while still in the quiet hours if it fails
+	db.err = errors.New("compaction failed")
+	s.check(at(11, 22))
+	assert.Equal(t, 1, db.compactions)
+	db.err = nil
+	s.check(at(12, 2))
+	assert.Equal(t, 2, db.compactions)
+	s.check(at(12, 3))
+	assert.Equal(t, 2, db.compactions)
+}
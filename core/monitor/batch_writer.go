@@ -1,10 +1,13 @@
 package monitor
 
 import (
+	"context"
+	"sort"
 	"time"
 
 	"quorumengineering/quorum-report/database"
 	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/tracing"
 	"quorumengineering/quorum-report/types"
 )
 
@@ -14,6 +17,11 @@ const maxTransactionMultiplier = 10
 type BlockAndTransactions struct {
 	block *types.Block
 	txs   []*types.Transaction
+	// for the processing journal
+	started  time.Time
+	failures []string
+	// ended once the block is written
+	span *tracing.Span
 }
 
 type BatchWriter struct {
@@ -25,6 +33,7 @@ type BatchWriter struct {
 	currentTransactionCount int
 
 	BatchWorkChan chan *BlockAndTransactions
+	flushChan     chan chan struct{}
 	db            database.Database
 }
 
@@ -36,11 +45,14 @@ func NewBatchWriter(db database.Database, batchWorkChan chan *BlockAndTransactio
 		currentWorkUnits:        make([]*BlockAndTransactions, 0, cap(batchWorkChan)),
 		currentTransactionCount: 0,
 		BatchWorkChan:           batchWorkChan,
+		flushChan:               make(chan chan struct{}),
 		db:                      db,
 	}
 }
 
-func (bw *BatchWriter) Run(stopChan <-chan struct{}) {
+// Run writes the blocks it is sent in batches. Once stopped, it writes all
+// blocks waiting to be written before returning, unless aborted.
+func (bw *BatchWriter) Run(stopChan <-chan struct{}, abortChan <-chan struct{}) {
 	log.Info("Starting batch block processor", "timeout period", time.Duration(bw.flushPeriod)*time.Second, "max blocks", bw.maxBlocks, "max txns", bw.maxTransactions)
 
 	ticker := time.NewTicker(time.Duration(bw.flushPeriod) * time.Second)
@@ -59,7 +71,11 @@ func (bw *BatchWriter) Run(stopChan <-chan struct{}) {
 				//the defined timeout period between attempts
 				for err := bw.BatchWrite(); err != nil; err = bw.BatchWrite() {
 					log.Warn("Batch write failed", "err", err)
-					<-ticker.C
+					select {
+					case <-ticker.C:
+					case <-abortChan:
+						return
+					}
 				}
 			}
 		case <-ticker.C:
@@ -68,18 +84,77 @@ func (bw *BatchWriter) Run(stopChan <-chan struct{}) {
 			if err := bw.BatchWrite(); err != nil {
 				log.Warn("Batch write failed", "err", err)
 			}
+		case done := <-bw.flushChan:
+			bw.drainWorkChan()
+			if err := bw.BatchWrite(); err != nil {
+				// the blocks have not been persisted, so will be synced again
+				log.Warn("Batch write failed, discarding blocks", "err", err)
+				bw.discard(err)
+			}
+			close(done)
 		case <-stopChan:
+			bw.drainWorkChan()
+			if err := bw.BatchWrite(); err != nil {
+				// the blocks have not been persisted, so will be synced again
+				log.Warn("Final batch write failed, discarding blocks", "err", err)
+				bw.discard(err)
+			}
+			return
+		case <-abortChan:
+			return
+		}
+	}
+}
+
+// Flush writes all blocks and transactions that are waiting to be written,
+// returning once the write has been attempted.
+func (bw *BatchWriter) Flush(stopChan <-chan struct{}) {
+	done := make(chan struct{})
+	select {
+	case bw.flushChan <- done:
+	case <-stopChan:
+		return
+	}
+	select {
+	case <-done:
+	case <-stopChan:
+	}
+}
+
+func (bw *BatchWriter) drainWorkChan() {
+	for {
+		select {
+		case newWorkUnit := <-bw.BatchWorkChan:
+			bw.currentWorkUnits = append(bw.currentWorkUnits, newWorkUnit)
+			bw.currentTransactionCount += len(newWorkUnit.txs)
+		default:
 			return
 		}
 	}
 }
 
-func (bw *BatchWriter) BatchWrite() error {
+func (bw *BatchWriter) BatchWrite() (err error) {
 	if len(bw.currentWorkUnits) == 0 {
 		log.Debug("No blocks/transaction to write")
 		return nil
 	}
 
+	// a batch holds several blocks, so its write is traced on its own, linked
+	// to the processing of each block
+	_, span := tracing.Start(context.Background(), "write batch", tracing.Int("blocks", len(bw.currentWorkUnits)), tracing.Int("transactions", bw.currentTransactionCount))
+	for _, workUnit := range bw.currentWorkUnits {
+		span.Link(workUnit.span)
+	}
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	// blocks are processed concurrently, so are written in block order
+	sort.Slice(bw.currentWorkUnits, func(i, j int) bool {
+		return bw.currentWorkUnits[i].block.Number < bw.currentWorkUnits[j].block.Number
+	})
+
 	allTxns := make([]*types.Transaction, 0, bw.currentTransactionCount)
 	allBlocks := make([]*types.Block, 0, len(bw.currentWorkUnits))
 	for _, workUnit := range bw.currentWorkUnits {
@@ -96,8 +171,32 @@ func (bw *BatchWriter) BatchWrite() error {
 		return err
 	}
 
-	// reset
+	// the blocks are written, so failing to journal them doesn't fail the batch
+	entries := make([]*types.JournalEntry, 0, len(bw.currentWorkUnits))
+	for _, workUnit := range bw.currentWorkUnits {
+		entries = append(entries, newIngestEntry(workUnit.block, workUnit.txs, workUnit.started, workUnit.failures))
+	}
+	if err := bw.db.WriteJournalEntries(entries); err != nil {
+		log.Warn("Writing processing journal failed", "block count", len(entries), "err", err)
+	}
+
+	for _, workUnit := range bw.currentWorkUnits {
+		workUnit.span.End()
+	}
+	bw.reset()
+	return nil
+}
+
+// discard drops the blocks waiting to be written, after they failed to be
+func (bw *BatchWriter) discard(err error) {
+	for _, workUnit := range bw.currentWorkUnits {
+		workUnit.span.RecordError(err)
+		workUnit.span.End()
+	}
+	bw.reset()
+}
+
+func (bw *BatchWriter) reset() {
 	bw.currentTransactionCount = 0
 	bw.currentWorkUnits = make([]*BlockAndTransactions, 0, bw.maxBlocks)
-	return nil
 }
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestBatchWrite_Journal(t *testing.T) {
+	db := memory.NewMemoryDB()
+	bw := NewBatchWriter(db, make(chan *BlockAndTransactions, 10), 1)
+
+	tx := &types.Transaction{Hash: types.NewHash("a"), BlockNumber: 1, Events: []*types.Event{{}, {}}}
+	bw.currentWorkUnits = []*BlockAndTransactions{
+		{block: &types.Block{Number: 2, Hash: types.NewHash("2")}, started: time.Now()},
+		{block: &types.Block{Number: 1, Hash: types.NewHash("1"), Transactions: []types.Hash{tx.Hash}}, txs: []*types.Transaction{tx}, started: time.Now(), failures: []string{"node unavailable"}},
+	}
+	bw.currentTransactionCount = 1
+	assert.Nil(t, bw.BatchWrite())
+
+	options := &types.PageOptions{}
+	options.SetDefaults()
+	entries, err := db.GetJournalEntries(&types.JournalQuery{}, options)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.EqualValues(t, 2, entries[0].BlockNumber)
+	assert.Equal(t, types.IngestStage, entries[1].Stage)
+	assert.Equal(t, 1, entries[1].Transactions)
+	assert.Equal(t, 2, entries[1].Events)
+	assert.Equal(t, []string{"node unavailable"}, entries[1].Errors)
+}
+
+func TestBatchWriter_StopWritesQueuedBlocks(t *testing.T) {
+	db := memory.NewMemoryDB()
+	workChan := make(chan *BlockAndTransactions, 10)
+	bw := NewBatchWriter(db, workChan, 60)
+
+	for i := uint64(0); i < 3; i++ {
+		workChan <- &BlockAndTransactions{block: &types.Block{Number: i, Hash: types.NewHash(string(rune('a' + i)))}, started: time.Now()}
+	}
+	stopChan := make(chan struct{})
+	close(stopChan)
+	bw.Run(stopChan, make(chan struct{}))
+
+	for i := uint64(0); i < 3; i++ {
+		_, err := db.ReadBlock(i)
+		assert.Nil(t, err)
+	}
+	lastPersisted, err := db.GetLastPersistedBlockNumber()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, lastPersisted)
+}
+
+func TestBatchWriter_AbortDiscardsQueuedBlocks(t *testing.T) {
+	db := memory.NewMemoryDB()
+	workChan := make(chan *BlockAndTransactions, 10)
+	bw := NewBatchWriter(db, workChan, 60)
+
+	workChan <- &BlockAndTransactions{block: &types.Block{Number: 0, Hash: types.NewHash("a")}, started: time.Now()}
+	abortChan := make(chan struct{})
+	close(abortChan)
+	bw.Run(make(chan struct{}), abortChan)
+
+	_, err := db.ReadBlock(0)
+	assert.NotNil(t, err)
+}
@@ -6,28 +6,65 @@ import (
 
 	"quorumengineering/quorum-report/client"
 	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/tracing"
 	"quorumengineering/quorum-report/types"
 )
 
+// recentBlockCount is the number of recent block hashes kept to detect reorgs
+const recentBlockCount = 128
+
 type BlockMonitor interface {
 	ListenToChainHead(cancelChan chan bool, stopChan chan bool) error
 	SyncHistoricBlocks(lastPersisted uint64, cancelChan chan bool, wg *sync.WaitGroup) error
+	// Reorgs receives the number of any block that does not match the
+	// previously seen blocks
+	Reorgs() <-chan uint64
+	// ResetRecentBlocks forgets all previously seen blocks
+	ResetRecentBlocks()
+	// FetchBlock fetches a single block, without checking it against the
+	// recently seen blocks
+	FetchBlock(number uint64) (*types.Block, error)
 }
 
 type DefaultBlockMonitor struct {
 	quorumClient client.Client
 	newBlockChan chan *types.Block
 	consensus    string
+	// number of historic blocks fetched at once
+	fetchWorkers int
+
+	// hashes of recently seen blocks, to check new blocks build on them
+	recentHashes map[uint64]types.Hash
+	highestSeen  uint64
+	reorgChan    chan uint64
+	mux          sync.Mutex
 }
 
-func NewDefaultBlockMonitor(quorumClient client.Client, newBlockChan chan *types.Block, consensus string) *DefaultBlockMonitor {
+func NewDefaultBlockMonitor(quorumClient client.Client, newBlockChan chan *types.Block, consensus string, fetchWorkers int) *DefaultBlockMonitor {
+	if fetchWorkers < 1 {
+		fetchWorkers = 1
+	}
 	return &DefaultBlockMonitor{
 		quorumClient: quorumClient,
 		newBlockChan: newBlockChan,
 		consensus:    consensus,
+		fetchWorkers: fetchWorkers,
+		recentHashes: make(map[uint64]types.Hash),
+		reorgChan:    make(chan uint64, 1),
 	}
 }
 
+func (bm *DefaultBlockMonitor) Reorgs() <-chan uint64 {
+	return bm.reorgChan
+}
+
+func (bm *DefaultBlockMonitor) ResetRecentBlocks() {
+	bm.mux.Lock()
+	defer bm.mux.Unlock()
+	bm.recentHashes = make(map[uint64]types.Hash)
+	bm.highestSeen = 0
+}
+
 func (bm *DefaultBlockMonitor) ListenToChainHead(cancelChan chan bool, stopChan chan bool) error {
 	// make headers channel buffered so that it doesn't block websocket listener
 	headers := make(chan types.RawHeader, 10)
@@ -38,12 +75,27 @@ func (bm *DefaultBlockMonitor) ListenToChainHead(cancelChan chan bool, stopChan
 	go func() {
 		defer close(cancelChan)
 		log.Info("Starting chain head listener.")
+		var lastHead uint64
+		var gapsWg sync.WaitGroup
 		for {
 			select {
 			case header := <-headers:
+				// blocks were missed, most likely whilst reconnecting to the node
+				number := header.Number.ToUint64()
+				if lastHead > 0 && number > lastHead+1 {
+					gapsWg.Add(1)
+					go func(start, end uint64) {
+						defer gapsWg.Done()
+						bm.syncMissedBlocks(start, end, stopChan)
+					}(lastHead+1, number-1)
+				}
+				if number > lastHead {
+					lastHead = number
+				}
 				bm.processChainHead(header)
 			case <-stopChan:
 				log.Info("Stopping chain head listener.")
+				gapsWg.Wait()
 				return
 			}
 		}
@@ -74,6 +126,30 @@ func (bm *DefaultBlockMonitor) SyncHistoricBlocks(lastPersisted uint64, cancelCh
 	return nil
 }
 
+// syncMissedBlocks fetches the blocks between two chain heads, which were
+// missed whilst the subscription was down, retrying until they are synced
+func (bm *DefaultBlockMonitor) syncMissedBlocks(start, end uint64, stopChan chan bool) {
+	log.Warn("Chain heads were missed, syncing missed blocks", "start", start, "end", end)
+	err := bm.syncBlocks(start, end, stopChan)
+	for err != nil {
+		log.Info("Sync missed blocks failed", "end-block", end, "err", err)
+		select {
+		case <-stopChan:
+			return
+		case <-time.After(time.Second):
+		}
+		err = bm.syncBlocks(err.EndBlockNumber(), end, stopChan)
+	}
+}
+
+func (bm *DefaultBlockMonitor) FetchBlock(number uint64) (*types.Block, error) {
+	blockOrigin, err := bm.tryFetchingBlock(number, 10)
+	if err != nil {
+		return nil, err
+	}
+	return bm.createBlock(blockOrigin), nil
+}
+
 func (bm *DefaultBlockMonitor) processChainHead(header types.RawHeader) {
 	log.Info("Processing chain head", "block hash", header.Hash.String(), "block number", header.Number)
 	blockOrigin, err := bm.tryFetchingBlock(header.Number.ToUint64(), 10)
@@ -81,7 +157,11 @@ func (bm *DefaultBlockMonitor) processChainHead(header types.RawHeader) {
 		log.Error("Error - fetching block from Quorum failed", "block hash", header.Hash, "block number", header.Number, "err", err)
 		return
 	}
-	bm.newBlockChan <- bm.createBlock(blockOrigin)
+	block := bm.createBlock(blockOrigin)
+	if !bm.checkRecentBlocks(block) {
+		return
+	}
+	bm.newBlockChan <- block
 }
 
 func (bm *DefaultBlockMonitor) createBlock(block *types.RawBlock) *types.Block {
@@ -105,28 +185,78 @@ func (bm *DefaultBlockMonitor) createBlock(block *types.RawBlock) *types.Block {
 	}
 }
 
+// checkRecentBlocks records the hash of the given block, returning false and
+// signalling a reorg if the block does not match the recently seen blocks
+func (bm *DefaultBlockMonitor) checkRecentBlocks(block *types.Block) bool {
+	bm.mux.Lock()
+	defer bm.mux.Unlock()
+
+	parentHash, hasParent := bm.recentHashes[block.Number-1]
+	existingHash, hasExisting := bm.recentHashes[block.Number]
+	if (hasParent && parentHash != block.ParentHash) || (hasExisting && existingHash != block.Hash) {
+		log.Warn("Chain reorg detected", "block number", block.Number, "block hash", block.Hash.String())
+		// a pending notification already covers this reorg
+		select {
+		case bm.reorgChan <- block.Number:
+		default:
+		}
+		return false
+	}
+
+	bm.recentHashes[block.Number] = block.Hash
+	if block.Number > bm.highestSeen {
+		bm.highestSeen = block.Number
+	}
+	if len(bm.recentHashes) > recentBlockCount {
+		for number := range bm.recentHashes {
+			if number+recentBlockCount <= bm.highestSeen {
+				delete(bm.recentHashes, number)
+			}
+		}
+	}
+	return true
+}
+
+// fetchResult is a block fetched from the node, or the error fetching it
+type fetchResult struct {
+	block *types.RawBlock
+	err   error
+}
+
+// syncBlocks fetches the blocks in the range, up to fetchWorkers at a time,
+// and sends them for processing in order. The blocks fetched ahead are
+// discarded if the sync stops early.
 func (bm *DefaultBlockMonitor) syncBlocks(start, end uint64, stopChan chan bool) *SyncError {
 	if start > end {
 		return nil
 	}
 
-	log.Info("Syncing historic blocks", "start", start, "end", end)
+	log.Info("Syncing historic blocks", "start", start, "end", end, "fetch workers", bm.fetchWorkers)
+	done := make(chan struct{})
+	defer close(done)
+	fetches := bm.fetchBlocks(start, end, done)
 	for i := start; i <= end; i++ {
+		// the fetch of each block in the range is started in order
+		resultChan := <-fetches
+		var result fetchResult
 		select {
 		case <-stopChan:
 			return nil
-		default:
+		case result = <-resultChan:
+		}
+		if result.err != nil {
+			return NewSyncError(result.err.Error(), i)
 		}
 
-		blockOrigin, err := bm.tryFetchingBlock(i, 10)
-		if err != nil {
-			return NewSyncError(err.Error(), i)
+		block := bm.createBlock(result.block)
+		if !bm.checkRecentBlocks(block) {
+			return nil
 		}
 
 		select {
 		case <-stopChan:
 			return nil
-		case bm.newBlockChan <- bm.createBlock(blockOrigin):
+		case bm.newBlockChan <- block:
 		}
 	}
 
@@ -134,7 +264,31 @@ func (bm *DefaultBlockMonitor) syncBlocks(start, end uint64, stopChan chan bool)
 	return nil
 }
 
+// fetchBlocks starts fetching the blocks in the range in the background,
+// returning a channel that receives a channel for the result of each block in
+// order. No more than fetchWorkers blocks are fetched ahead of the block
+// being waited on, and no more are fetched once done is closed.
+func (bm *DefaultBlockMonitor) fetchBlocks(start, end uint64, done <-chan struct{}) <-chan chan fetchResult {
+	fetches := make(chan chan fetchResult, bm.fetchWorkers-1)
+	go func() {
+		for i := start; i <= end; i++ {
+			result := make(chan fetchResult, 1)
+			select {
+			case fetches <- result:
+			case <-done:
+				return
+			}
+			go func(number uint64) {
+				block, err := bm.tryFetchingBlock(number, 10)
+				result <- fetchResult{block: block, err: err}
+			}(i)
+		}
+	}()
+	return fetches
+}
+
 func (bm *DefaultBlockMonitor) tryFetchingBlock(number uint64, tryCount int) (*types.RawBlock, error) {
+	started := time.Now()
 	var err error
 	var block types.RawBlock
 	for tryCount > 0 {
@@ -154,5 +308,23 @@ func (bm *DefaultBlockMonitor) tryFetchingBlock(number uint64, tryCount int) (*t
 	if err != nil {
 		return nil, err
 	}
+	// the hash is only known once fetched, so the span is recorded afterwards
+	// in the trace of the block
+	tracing.Record(tracing.IDContext(blockTraceID(block.Hash)), "fetch block", started, tracing.Uint64("block.number", number))
 	return &block, err
 }
+
+// blockTraceID identifies the trace of the processing of a block, so its
+// fetch, processing and write are traced together, even though they happen
+// in separate goroutines
+func blockTraceID(hash types.Hash) []byte {
+	return []byte(hash.String())
+}
+
+func blockAttributes(block *types.Block) []tracing.Attribute {
+	return []tracing.Attribute{
+		tracing.Uint64("block.number", block.Number),
+		tracing.String("block.hash", block.Hash.Hex()),
+		tracing.Int("block.transactions", len(block.Transactions)),
+	}
+}
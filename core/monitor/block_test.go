@@ -1,6 +1,7 @@
 package monitor
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -84,7 +85,7 @@ func TestCreateBlock(t *testing.T) {
 	}
 
 	for _, tc := range cases {
-		bm := NewDefaultBlockMonitor(client.NewStubQuorumClient(nil, nil), nil, tc.consensus)
+		bm := NewDefaultBlockMonitor(client.NewStubQuorumClient(nil, nil), nil, tc.consensus, 1)
 
 		actual := bm.createBlock(tc.originalBlock)
 
@@ -95,3 +96,91 @@ func TestCreateBlock(t *testing.T) {
 		assert.EqualValues(t, len(tc.expectedBlock.Transactions), len(actual.Transactions))
 	}
 }
+
+func TestCheckRecentBlocks(t *testing.T) {
+	bm := NewDefaultBlockMonitor(client.NewStubQuorumClient(nil, nil), nil, "istanbul", 1)
+
+	block1 := &types.Block{Number: 1, Hash: types.NewHash("0x1"), ParentHash: types.NewHash("0x0")}
+	block2 := &types.Block{Number: 2, Hash: types.NewHash("0x2"), ParentHash: types.NewHash("0x1")}
+	assert.True(t, bm.checkRecentBlocks(block1))
+	assert.True(t, bm.checkRecentBlocks(block2))
+	// seeing the same block again is not a reorg
+	assert.True(t, bm.checkRecentBlocks(block2))
+
+	// a block that does not build on block 2
+	block3 := &types.Block{Number: 3, Hash: types.NewHash("0x3"), ParentHash: types.NewHash("0x22")}
+	assert.False(t, bm.checkRecentBlocks(block3))
+	// a different block at a seen height
+	replaced := &types.Block{Number: 2, Hash: types.NewHash("0x22"), ParentHash: types.NewHash("0x1")}
+	assert.False(t, bm.checkRecentBlocks(replaced))
+
+	// only one notification is queued
+	assert.EqualValues(t, 3, <-bm.Reorgs())
+	assert.Len(t, bm.Reorgs(), 0)
+
+	bm.ResetRecentBlocks()
+	assert.True(t, bm.checkRecentBlocks(block3))
+}
+
+func TestSyncBlocks_InOrder(t *testing.T) {
+	mockRPC := make(map[string]interface{})
+	for i := uint64(1); i <= 10; i++ {
+		mockRPC[fmt.Sprintf("eth_getBlockByNumber0x%x<bool Value>", i)] = types.RawBlock{
+			Number:     types.HexNumber(i),
+			Hash:       types.NewHash(fmt.Sprintf("0x%x", i)),
+			ParentHash: types.NewHash(fmt.Sprintf("0x%x", i-1)),
+		}
+	}
+	newBlockChan := make(chan *types.Block, 10)
+	bm := NewDefaultBlockMonitor(client.NewStubQuorumClient(nil, mockRPC), newBlockChan, "istanbul", 4)
+
+	assert.Nil(t, bm.syncBlocks(1, 10, make(chan bool)))
+	assert.Len(t, newBlockChan, 10)
+	for i := uint64(1); i <= 10; i++ {
+		assert.EqualValues(t, i, (<-newBlockChan).Number)
+	}
+}
+
+// subscribingClient hands out the chain head channel it is subscribed with
+type subscribingClient struct {
+	*client.StubQuorumClient
+	heads chan chan<- types.RawHeader
+}
+
+func (c *subscribingClient) SubscribeChainHead(ch chan<- types.RawHeader) error {
+	c.heads <- ch
+	return nil
+}
+
+func TestListenToChainHead_MissedBlocks(t *testing.T) {
+	mockRPC := make(map[string]interface{})
+	for i := uint64(1); i <= 5; i++ {
+		mockRPC[fmt.Sprintf("eth_getBlockByNumber0x%x<bool Value>", i)] = types.RawBlock{
+			Number:     types.HexNumber(i),
+			Hash:       types.NewHash(fmt.Sprintf("0x%x", i)),
+			ParentHash: types.NewHash(fmt.Sprintf("0x%x", i-1)),
+		}
+	}
+	quorumClient := &subscribingClient{client.NewStubQuorumClient(nil, mockRPC), make(chan chan<- types.RawHeader, 1)}
+	newBlockChan := make(chan *types.Block, 10)
+	bm := NewDefaultBlockMonitor(quorumClient, newBlockChan, "istanbul", 1)
+
+	cancelChan, stopChan := make(chan bool), make(chan bool)
+	assert.Nil(t, bm.ListenToChainHead(cancelChan, stopChan))
+	heads := <-quorumClient.heads
+	heads <- types.RawHeader{Number: 1, Hash: types.NewHash("0x1")}
+	assert.EqualValues(t, 1, (<-newBlockChan).Number)
+
+	// the blocks between the heads are synced in the background
+	heads <- types.RawHeader{Number: 4, Hash: types.NewHash("0x4")}
+	heads <- types.RawHeader{Number: 5, Hash: types.NewHash("0x5")}
+	var numbers []uint64
+	for i := 0; i < 4; i++ {
+		numbers = append(numbers, (<-newBlockChan).Number)
+	}
+	assert.ElementsMatch(t, []uint64{2, 3, 4, 5}, numbers)
+
+	close(stopChan)
+	<-cancelChan
+	assert.Len(t, newBlockChan, 0)
+}
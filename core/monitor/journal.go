@@ -0,0 +1,29 @@
+package monitor
+
+import (
+	"time"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// maxJournalErrors is the most failed attempts kept for a block until it is
+// ingested, so a block that keeps failing doesn't grow without bound
+const maxJournalErrors = 10
+
+// newIngestEntry records how the block was ingested, once it and its
+// transactions have been written
+func newIngestEntry(block *types.Block, txs []*types.Transaction, started time.Time, failures []string) *types.JournalEntry {
+	finished := time.Now()
+	entry := &types.JournalEntry{
+		BlockNumber:  block.Number,
+		Stage:        types.IngestStage,
+		Timestamp:    uint64(finished.Unix()),
+		Duration:     uint64(finished.Sub(started) / time.Millisecond),
+		Transactions: len(txs),
+		Errors:       failures,
+	}
+	for _, tx := range txs {
+		entry.Events += len(tx.Events)
+	}
+	return entry
+}
@@ -1,69 +1,226 @@
 package monitor
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"runtime"
+	"strings"
 	"sync"
 	"time"
 
 	"quorumengineering/quorum-report/client"
 	"quorumengineering/quorum-report/database"
 	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/tracing"
 	"quorumengineering/quorum-report/types"
 )
 
+// maxReorgDepth is the number of blocks searched back for the point a reorg
+// forked from the persisted chain
+const maxReorgDepth = 1000
+
+var (
+	errReorgTooDeep = fmt.Errorf("chain fork is more than %d blocks deep", maxReorgDepth)
+	errShuttingDown = errors.New("monitor service is shutting down")
+)
+
+// pauseRequest asks for syncing to stop until resume is closed. paused is
+// closed once the blocks already fetched have been written.
+type pauseRequest struct {
+	paused chan struct{}
+	resume <-chan struct{}
+}
+
 // MonitorService starts all monitors. It pulls data from Quorum node and update the database.
+// ABILookup looks up the ABI of a contract in the background, if it is
+// registered without one
+type ABILookup interface {
+	Lookup(address types.Address)
+}
+
 type MonitorService struct {
-	db database.Database
+	db           database.Database
+	quorumClient client.Client
 
 	// monitors
 	blockMonitor       BlockMonitor
 	transactionMonitor TransactionMonitor
 	tokenMonitor       TokenMonitor
+	// contracts are not registered by rules with the headers profile
+	registerContracts bool
+	// looks up the ABIs of newly created contracts, if set
+	abiLookup ABILookup
+	// the rules of the configuration, which the token rules stored in the
+	// database are used alongside
+	ruleConfigs []*types.RuleConfig
+	rulesMux    sync.Mutex
 
 	// concurrent block processing
 	newBlockChan   chan *types.Block
 	batchWriteChan chan *BlockAndTransactions
 	batchWriter    *BatchWriter
 	totalWorkers   int
+	// workers receive a channel to wait on until they can continue
+	pauseChan chan chan struct{}
+	// requests to pause syncing, until resumed
+	pauseSyncChan chan pauseRequest
 
-	// To check we have actually shut down before returning
-	shutdownChan chan struct{}
-	shutdownWg   sync.WaitGroup
+	// Shutting down stops the block sources first, then the workers once
+	// they have processed the blocks they were given, then the batch writer
+	// once it has written them. Aborting abandons the work still in flight.
+	shutdownChan    chan struct{}
+	workersStopChan chan struct{}
+	writerStopChan  chan struct{}
+	abortChan       chan struct{}
+	sourcesWg       sync.WaitGroup
+	workersWg       sync.WaitGroup
+	writerWg        sync.WaitGroup
 }
 
 func NewMonitorService(db database.Database, quorumClient client.Client, consensus string, config types.ReportingConfig) (*MonitorService, error) {
-	// rules are only parsed once during monitor service initialization
+	// rules are parsed once during monitor service initialization, and again
+	// only if they are updated
+	rules, err := loadTokenRules(db, config.Rules)
+	if err != nil {
+		return nil, err
+	}
+	newBlockChan := make(chan *types.Block)
+	batchWriteChan := make(chan *BlockAndTransactions, config.Tuning.BlockProcessingQueueSize)
+	return &MonitorService{
+		db:                 db,
+		quorumClient:       quorumClient,
+		blockMonitor:       NewDefaultBlockMonitor(quorumClient, newBlockChan, consensus, config.Tuning.BlockFetchWorkers),
+		transactionMonitor: NewDefaultTransactionMonitor(quorumClient, config.Tuning.MaxInputDataSize, config.Tuning.MaxReturnDataSize, config.Profile == types.HeadersProfile, !config.Connection.DisablePrivatePayloads),
+		tokenMonitor:       NewDefaultTokenMonitor(quorumClient, rules),
+		ruleConfigs:        config.Rules,
+		registerContracts:  config.Profile != types.HeadersProfile,
+		newBlockChan:       newBlockChan,
+		batchWriteChan:     batchWriteChan,
+		batchWriter:        NewBatchWriter(db, batchWriteChan, config.Tuning.BlockProcessingFlushPeriod),
+		totalWorkers:       config.Tuning.BlockProcessingWorkers,
+		pauseChan:          make(chan chan struct{}),
+		pauseSyncChan:      make(chan pauseRequest),
+		shutdownChan:       make(chan struct{}),
+		workersStopChan:    make(chan struct{}),
+		writerStopChan:     make(chan struct{}),
+		abortChan:          make(chan struct{}),
+	}, nil
+}
+
+// SetABILookup has the ABIs of contracts looked up as they are created.
+func (m *MonitorService) SetABILookup(abiLookup ABILookup) {
+	m.abiLookup = abiLookup
+}
+
+// UpdateRules replaces the rules of the configuration used to register newly
+// created contracts.
+func (m *MonitorService) UpdateRules(ruleConfigs []*types.RuleConfig) error {
+	m.rulesMux.Lock()
+	defer m.rulesMux.Unlock()
+	rules, err := loadTokenRules(m.db, ruleConfigs)
+	if err != nil {
+		return err
+	}
+	m.tokenMonitor.SetRules(rules)
+	m.ruleConfigs = ruleConfigs
+	return nil
+}
+
+// ReloadTokenRules reads the token rules stored in the database again, after
+// they are added or deleted.
+func (m *MonitorService) ReloadTokenRules() error {
+	m.rulesMux.Lock()
+	defer m.rulesMux.Unlock()
+	rules, err := loadTokenRules(m.db, m.ruleConfigs)
+	if err != nil {
+		return err
+	}
+	m.tokenMonitor.SetRules(rules)
+	return nil
+}
+
+// loadTokenRules parses the rules of the configuration, followed by the
+// token rules stored in the database
+func loadTokenRules(db database.Database, ruleConfigs []*types.RuleConfig) ([]TokenRule, error) {
+	stored, err := db.GetTokenRules()
+	if err != nil {
+		return nil, err
+	}
+	all := append([]*types.RuleConfig{}, ruleConfigs...)
+	for _, rule := range stored {
+		all = append(all, rule.RuleConfig())
+	}
+	return parseTokenRules(db, all)
+}
+
+// parseTokenRules fetches the template for each rule, and the event of event
+// rules. Rules with a template that does not exist are skipped.
+func parseTokenRules(db database.Database, ruleConfigs []*types.RuleConfig) ([]TokenRule, error) {
 	var rules []TokenRule
-	for _, rule := range config.Rules {
+	for _, rule := range ruleConfigs {
 		template, _ := db.GetTemplateDetails(rule.TemplateName)
 		if template != nil {
-			abi, err := types.NewABIStructureFromJSON(template.ABI)
+			ruleABI := template.ABI
+			if rule.ABI != "" {
+				ruleABI = rule.ABI
+			}
+			abi, err := types.NewABIStructureFromJSON(ruleABI)
 			if err != nil {
 				return nil, fmt.Errorf("could not parse ABI: %s", err.Error())
 			}
-			rules = append(rules, TokenRule{
+			tokenRule := TokenRule{
 				scope:        rule.Scope,
 				deployer:     rule.Deployer,
 				templateName: rule.TemplateName,
 				eip165:       rule.EIP165,
 				abi:          abi.ToInternalABI(),
-			})
+			}
+			if rule.Scope == types.EventScope {
+				event, err := findRuleEvent(db, rule)
+				if err != nil {
+					return nil, err
+				}
+				if event == nil {
+					continue
+				}
+				tokenRule.event = event
+				tokenRule.topic = types.NewHash(event.Signature())
+				tokenRule.parameter = rule.Parameter
+				tokenRule.emitter = rule.Emitter
+			}
+			rules = append(rules, tokenRule)
 		}
 	}
-	newBlockChan := make(chan *types.Block)
-	batchWriteChan := make(chan *BlockAndTransactions, config.Tuning.BlockProcessingQueueSize)
-	return &MonitorService{
-		db:                 db,
-		blockMonitor:       NewDefaultBlockMonitor(quorumClient, newBlockChan, consensus),
-		transactionMonitor: NewDefaultTransactionMonitor(quorumClient),
-		tokenMonitor:       NewDefaultTokenMonitor(quorumClient, rules),
-		newBlockChan:       newBlockChan,
-		batchWriteChan:     batchWriteChan,
-		batchWriter:        NewBatchWriter(db, batchWriteChan, config.Tuning.BlockProcessingFlushPeriod),
-		totalWorkers:       3 * runtime.NumCPU(),
-		shutdownChan:       make(chan struct{}),
-	}, nil
+	return rules, nil
+}
+
+// findRuleEvent looks up the event of an event rule, by name or signature, in
+// its event template, returning nil if the template does not exist. The
+// parameter must be an address, or an array of addresses that is not indexed.
+func findRuleEvent(db database.Database, rule *types.RuleConfig) (*types.ContractABIEvent, error) {
+	template, _ := db.GetTemplateDetails(rule.EventTemplate)
+	if template == nil {
+		return nil, nil
+	}
+	abi, err := types.NewABIStructureFromJSON(template.ABI)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse ABI: %s", err.Error())
+	}
+	for _, event := range abi.ToInternalABI().Events {
+		if event.Name != rule.Event && event.StringNoName() != rule.Event {
+			continue
+		}
+		for _, input := range event.Inputs {
+			if input.Name != rule.Parameter {
+				continue
+			}
+			if input.Type != "address" && (input.Indexed || !strings.HasPrefix(input.Type, "address[")) {
+				return nil, fmt.Errorf("parameter %s of event %s is not an address", rule.Parameter, rule.Event)
+			}
+			return &event, nil
+		}
+	}
+	return nil, fmt.Errorf("event %s with parameter %s not found in template %s", rule.Event, rule.Parameter, rule.EventTemplate)
 }
 
 func (m *MonitorService) Start() error {
@@ -73,51 +230,140 @@ func (m *MonitorService) Start() error {
 	m.startBatchWriter()
 	m.startWorkers()
 
+	m.sourcesWg.Add(1)
 	go m.run()
 
 	return nil
 }
 
-func (m *MonitorService) Stop() {
+// Stop stops syncing new blocks, and waits for the blocks already fetched to
+// be processed and written, so the last persisted block is up to date when
+// the service starts again. If the context is done first, the blocks still in
+// flight are abandoned, and are synced again on the next start, though it
+// still waits for the workers and batch writer to give up on them, so they
+// don't write once it has returned. The block sources are left to stop on
+// their own, as they may be waiting to hand on blocks no worker takes any
+// more; the database turns away what they write once it is closed.
+func (m *MonitorService) Stop(ctx context.Context) {
 	close(m.shutdownChan)
-	m.shutdownWg.Wait()
+	stages := []struct {
+		wg       *sync.WaitGroup
+		nextStop chan struct{}
+	}{
+		{&m.sourcesWg, m.workersStopChan},
+		{&m.workersWg, m.writerStopChan},
+		{&m.writerWg, nil},
+	}
+	for _, stage := range stages {
+		select {
+		case <-waitGroupDone(stage.wg):
+		case <-ctx.Done():
+			log.Warn("Monitor service did not finish in time, abandoning blocks in flight", "err", ctx.Err())
+			close(m.abortChan)
+			m.workersWg.Wait()
+			m.writerWg.Wait()
+			log.Info("Monitor service stopped")
+			return
+		}
+		if stage.nextStop != nil {
+			close(stage.nextStop)
+		}
+	}
 	log.Info("Monitor service stopped")
 }
 
+// Pause stops syncing new blocks until resume is closed, returning once the
+// blocks already fetched have been written, so the last persisted block is
+// up to date. If the context is done first, syncing may still be paused.
+func (m *MonitorService) Pause(ctx context.Context, resume <-chan struct{}) error {
+	request := pauseRequest{paused: make(chan struct{}), resume: resume}
+	select {
+	case m.pauseSyncChan <- request:
+	case <-m.shutdownChan:
+		return errShuttingDown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-request.paused:
+		return nil
+	case <-m.shutdownChan:
+		return errShuttingDown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitGroupDone returns a channel that is closed once the wait group is done
+func waitGroupDone(wg *sync.WaitGroup) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
 func (m *MonitorService) startBatchWriter() {
 	log.Info("Starting batch writer")
+	m.writerWg.Add(1)
 	go func() {
-		m.shutdownWg.Add(1)
-		m.batchWriter.Run(m.shutdownChan)
-		m.shutdownWg.Done()
+		defer m.writerWg.Done()
+		m.batchWriter.Run(m.writerStopChan, m.abortChan)
 	}()
 }
 
 func (m *MonitorService) startWorkers() {
 	log.Info("Starting block processor workers")
 	for i := 0; i < m.totalWorkers; i++ {
+		m.workersWg.Add(1)
 		go func() {
-			m.shutdownWg.Add(1)
-			m.startWorker(m.shutdownChan)
-			m.shutdownWg.Done()
+			defer m.workersWg.Done()
+			m.startWorker(m.workersStopChan)
 		}()
 	}
 }
 
+// startWorker processes the blocks it is given until told to stop, which
+// happens once no more blocks are being sent
 func (m *MonitorService) startWorker(stopChan <-chan struct{}) {
 	for {
 		select {
 		case block := <-m.newBlockChan:
 			// Listen to new block channel and process if new block comes.
-			err := m.processBlock(block)
+			started := time.Now()
+			// the span ends once the block is written
+			ctx, span := tracing.StartWithID(blockTraceID(block.Hash), "process block", blockAttributes(block)...)
+			var failures []string
+			err := m.processBlock(ctx, span, block, started, failures)
 			for err != nil {
 				log.Warn("Error processing block", "block number", block.Number, "err", err)
-				time.Sleep(time.Second)
-				err = m.processBlock(block)
+				if len(failures) < maxJournalErrors {
+					failures = append(failures, err.Error())
+				}
+				select {
+				case <-m.abortChan:
+					span.RecordError(err)
+					span.End()
+					return
+				case <-time.After(time.Second):
+				}
+				err = m.processBlock(ctx, span, block, started, failures)
+			}
+		case resumeChan := <-m.pauseChan:
+			select {
+			case <-resumeChan:
+			case <-stopChan:
+				log.Debug("Stop message received", "location", "core/monitor/service::startWorker")
+				return
+			case <-m.abortChan:
+				return
 			}
 		case <-stopChan:
 			log.Debug("Stop message received", "location", "core/monitor/service::startWorker")
 			return
+		case <-m.abortChan:
+			return
 		}
 	}
 }
@@ -133,6 +379,10 @@ func (m *MonitorService) run() {
 			b) if an error occurs setting up the historical block sync, cancel the chain head sub, wait and try again
 		2. If we receive a shutdown message, cancel the chain head listener, wait for the historical block sync to finish and return
 		3. If the chain head sub has an error, close the "cancelChan" which will stop the historical sync
+		4. If a chain reorg is detected, stop syncing, roll back the blocks that are no longer part of
+			the chain, and start syncing again
+		5. If asked to pause, stop syncing, wait for the blocks already fetched to be written, and start
+			syncing again once resumed
 
 		Note: 	errors in the historical sync *after* it is set up will not propagate up to here, but instead be
 				handled internally. If the historical sync is cancelled, it returns without giving an error, allowing
@@ -143,9 +393,22 @@ func (m *MonitorService) run() {
 	*/
 
 	log.Info("Start to sync blocks...")
-	m.shutdownWg.Add(1)
+	defer m.sourcesWg.Done()
 
+	// the chain may have reorganised whilst we were not running
+	checkedPersisted := false
 	for {
+		if !checkedPersisted {
+			if err := m.rollbackOrphanedBlocks(false); err != nil {
+				log.Error("Check persisted blocks against chain error, retrying in 1 second", "err", err)
+				if !m.waitToRetry() {
+					return
+				}
+				continue
+			}
+			checkedPersisted = true
+		}
+
 		chStopChan := make(chan bool)
 		cancelChan := make(chan bool)
 		var wg sync.WaitGroup
@@ -154,7 +417,9 @@ func (m *MonitorService) run() {
 		// listen to chain head
 		if err := m.blockMonitor.ListenToChainHead(cancelChan, chStopChan); err != nil {
 			log.Error("Subscribe to chain head event error, retrying in 1 second", "err", err)
-			time.Sleep(time.Second)
+			if !m.waitToRetry() {
+				return
+			}
 			continue
 		}
 
@@ -163,7 +428,10 @@ func (m *MonitorService) run() {
 		if err != nil {
 			log.Error("Get last persisted block number error, retrying in 1 second", "err", err)
 			close(chStopChan)
-			time.Sleep(time.Second)
+			<-cancelChan
+			if !m.waitToRetry() {
+				return
+			}
 			continue
 		}
 
@@ -172,7 +440,10 @@ func (m *MonitorService) run() {
 		if err := m.blockMonitor.SyncHistoricBlocks(lastPersisted, cancelChan, &wg); err != nil {
 			log.Error("Sync historic blocks error, retrying in 1 second", "err", err)
 			close(chStopChan)
-			time.Sleep(time.Second)
+			<-cancelChan
+			if !m.waitToRetry() {
+				return
+			}
 			continue
 		}
 
@@ -181,42 +452,288 @@ func (m *MonitorService) run() {
 			close(chStopChan)
 			<-cancelChan
 			wg.Wait()
-			m.shutdownWg.Done()
 			return
 		case <-cancelChan:
 			wg.Wait()
 			log.Info("Retry in 1 second...")
-			time.Sleep(time.Second)
+			if !m.waitToRetry() {
+				return
+			}
+		case blockNumber := <-m.blockMonitor.Reorgs():
+			log.Info("Stopping sync to handle chain reorg", "block number", blockNumber)
+			close(chStopChan)
+			<-cancelChan
+			wg.Wait()
+			if err := m.handleReorg(); err != nil {
+				log.Error("Handle chain reorg error", "err", err)
+				checkedPersisted = false
+			}
+		case request := <-m.pauseSyncChan:
+			close(chStopChan)
+			<-cancelChan
+			wg.Wait()
+			if !m.pauseSync(request) {
+				return
+			}
 		}
 	}
 }
 
-func (m *MonitorService) processBlock(block *types.Block) error {
-	// Transaction monitor pulls all transactions for the given block.
-	fetchedTxns, err := m.transactionMonitor.PullTransactions(block)
+// waitToRetry waits a second before retrying, returning false if the service
+// is shutting down instead. If asked to pause, it retries once resumed.
+func (m *MonitorService) waitToRetry() bool {
+	select {
+	case <-m.shutdownChan:
+		return false
+	case request := <-m.pauseSyncChan:
+		return m.pauseSync(request)
+	case <-time.After(time.Second):
+		return true
+	}
+}
+
+// pauseSync waits for the blocks already fetched to be written, and then for
+// the request to be resumed. It returns false if the service is shutting down
+// instead.
+func (m *MonitorService) pauseSync(request pauseRequest) bool {
+	resumeWorkers, ok := m.pauseWorkers()
+	if !ok {
+		return false
+	}
+	m.batchWriter.Flush(m.shutdownChan)
+	resumeWorkers()
+	close(request.paused)
+	log.Info("Block sync paused")
+
+	select {
+	case <-request.resume:
+		log.Info("Block sync resumed")
+		return true
+	case <-m.shutdownChan:
+		return false
+	}
+}
+
+// handleReorg waits for all blocks being processed to be written, and then
+// rolls back all blocks that are no longer part of the chain.
+func (m *MonitorService) handleReorg() error {
+	resume, ok := m.pauseWorkers()
+	if !ok {
+		return nil
+	}
+	defer resume()
+
+	m.batchWriter.Flush(m.shutdownChan)
+	m.blockMonitor.ResetRecentBlocks()
+	return m.rollbackOrphanedBlocks(true)
+}
+
+// pauseWorkers waits for all workers to finish their current block, and
+// returns a function to let them continue. It returns false if the service is
+// shutting down.
+func (m *MonitorService) pauseWorkers() (func(), bool) {
+	resumeChan := make(chan struct{})
+	for i := 0; i < m.totalWorkers; i++ {
+		select {
+		case m.pauseChan <- resumeChan:
+		case <-m.shutdownChan:
+			close(resumeChan)
+			return nil, false
+		}
+	}
+	return func() { close(resumeChan) }, true
+}
+
+// rollbackOrphanedBlocks finds the last persisted block that is still part of
+// the chain, and removes all data after it. Blocks after the last persisted
+// block may be from before a reorg, so are always removed if force is set.
+func (m *MonitorService) rollbackOrphanedBlocks(force bool) error {
+	lastPersisted, err := m.db.GetLastPersistedBlockNumber()
 	if err != nil {
 		return err
 	}
+	forkPoint, err := m.findForkPoint(lastPersisted)
+	if err == errReorgTooDeep {
+		log.Error("Unable to find where the chain forked, not rolling back", "last persisted", lastPersisted, "err", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if forkPoint == lastPersisted && !force {
+		return nil
+	}
+	log.Info("Rolling back blocks no longer part of the chain", "last persisted", lastPersisted, "fork point", forkPoint)
+	return m.db.RollbackToBlock(forkPoint)
+}
 
-	// Token monitor checks if transaction deploys a contract matching auto registration rules.
-	for _, tx := range fetchedTxns {
-		tokenContracts, err := m.tokenMonitor.InspectTransaction(tx)
+// findForkPoint searches back from the given block for the highest persisted
+// block that matches the block at the same height on the chain.
+func (m *MonitorService) findForkPoint(from uint64) (uint64, error) {
+	for blockNumber := from; blockNumber > 0; blockNumber-- {
+		if from-blockNumber >= maxReorgDepth {
+			return 0, errReorgTooDeep
+		}
+		persisted, err := m.db.ReadBlock(blockNumber)
 		if err != nil {
-			return err
+			return 0, err
+		}
+		if persisted == nil {
+			return 0, errors.New("persisted block not found")
 		}
-		for addr, contractType := range tokenContracts {
-			// TODO: error handling?
-			m.db.AddAddresses([]types.Address{addr})
-			m.db.AssignTemplate(addr, contractType)
+		onChain, err := client.BlockByNumber(m.quorumClient, blockNumber)
+		if err != nil {
+			return 0, err
+		}
+		if persisted.Hash == onChain.Hash {
+			return blockNumber, nil
 		}
 	}
+	return 0, nil
+}
+
+// Backfill fetches the blocks in the range from the node again, and writes
+// them with their transactions, replacing those already stored. The range
+// must not go past the last persisted block, which is left unchanged. The
+// number of each block is passed to progress once it is written.
+func (m *MonitorService) Backfill(from, to uint64, progress func(uint64)) error {
+	addresses, err := m.db.GetAddresses()
+	if err != nil {
+		return err
+	}
+	// contracts already registered keep the template they have, which may
+	// have been changed since they were registered
+	registered := make(map[types.Address]bool, len(addresses))
+	for _, address := range addresses {
+		registered[address] = true
+	}
+
+	log.Info("Backfilling blocks", "start", from, "end", to)
+	for number := from; number <= to; number++ {
+		select {
+		case <-m.shutdownChan:
+			return errShuttingDown
+		default:
+		}
+		if err := m.backfillBlock(number, registered); err != nil {
+			return err
+		}
+		progress(number)
+	}
+	log.Info("Backfilled blocks", "start", from, "end", to)
+	return nil
+}
+
+// backfillBlock fetches the block and its transactions and writes them
+func (m *MonitorService) backfillBlock(number uint64, registered map[types.Address]bool) (err error) {
+	started := time.Now()
+	block, err := m.blockMonitor.FetchBlock(number)
+	if err != nil {
+		return err
+	}
+	ctx, span := tracing.StartWithID(blockTraceID(block.Hash), "backfill block", blockAttributes(block)...)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	fetchedTxns, err := m.pullTransactions(ctx, block, registered)
+	if err != nil {
+		return err
+	}
+	_, writeSpan := tracing.Start(ctx, "write block", tracing.Int("transactions", len(fetchedTxns)))
+	defer writeSpan.End()
+	if err := m.db.WriteTransactions(fetchedTxns); err != nil {
+		writeSpan.RecordError(err)
+		return err
+	}
+	if err := m.db.WriteBlocks([]*types.Block{block}); err != nil {
+		writeSpan.RecordError(err)
+		return err
+	}
+	if err := m.db.WriteJournalEntries([]*types.JournalEntry{newIngestEntry(block, fetchedTxns, started, nil)}); err != nil {
+		log.Warn("Writing processing journal failed", "block number", number, "err", err)
+	}
+	return nil
+}
+
+// processBlock pulls the transactions of the block, and queues them to be
+// written, along with the span of its processing. The time processing started
+// and the failed attempts so far are kept for the processing journal.
+func (m *MonitorService) processBlock(ctx context.Context, span *tracing.Span, block *types.Block, started time.Time, failures []string) error {
+	fetchedTxns, err := m.pullTransactions(ctx, block, nil)
+	if err != nil {
+		return err
+	}
 
 	// batch write txs and blocks
 	workUnit := &BlockAndTransactions{
-		block: block,
-		txs:   fetchedTxns,
+		block:    block,
+		txs:      fetchedTxns,
+		started:  started,
+		failures: failures,
+		span:     span,
+	}
+	select {
+	case m.batchWriteChan <- workUnit:
+	case <-m.abortChan:
+		return errShuttingDown
 	}
-	m.batchWriteChan <- workUnit
-
 	return nil
 }
+
+// pullTransactions pulls all transactions for the given block, and registers
+// the contracts they deploy that match the auto registration rules, skipping
+// those in registered.
+func (m *MonitorService) pullTransactions(ctx context.Context, block *types.Block, registered map[types.Address]bool) ([]*types.Transaction, error) {
+	// Transaction monitor pulls all transactions for the given block.
+	fetchedTxns, err := m.transactionMonitor.PullTransactions(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Token monitor checks if transaction deploys a contract matching auto registration rules.
+	if m.registerContracts {
+		for _, tx := range fetchedTxns {
+			inspectCtx, span := tracing.Start(ctx, "inspect token", tracing.String("tx.hash", tx.Hash.Hex()))
+			tokenContracts, err := m.tokenMonitor.InspectTransaction(inspectCtx, tx)
+			span.RecordError(err)
+			span.End()
+			if err != nil {
+				return nil, err
+			}
+			for addr, contractType := range tokenContracts {
+				if registered[addr] {
+					continue
+				}
+				// TODO: error handling?
+				m.db.AddAddresses([]types.Address{addr})
+				m.db.AssignTemplate(addr, contractType)
+			}
+		}
+	}
+
+	if m.abiLookup != nil && m.registerContracts {
+		for _, tx := range fetchedTxns {
+			for _, addr := range createdContracts(tx) {
+				m.abiLookup.Lookup(addr)
+			}
+		}
+	}
+	return fetchedTxns, nil
+}
+
+// createdContracts returns the contracts the transaction deployed, directly or
+// through internal calls
+func createdContracts(tx *types.Transaction) []types.Address {
+	var created []types.Address
+	if !tx.CreatedContract.IsEmpty() {
+		created = append(created, tx.CreatedContract)
+	}
+	for _, ic := range tx.InternalCalls {
+		if ic.Type == "CREATE" || ic.Type == "CREATE2" {
+			created = append(created, ic.To)
+		}
+	}
+	return created
+}
@@ -0,0 +1,48 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+type fakeTransactionMonitor []*types.Transaction
+
+func (f fakeTransactionMonitor) PullTransactions(context.Context, *types.Block) ([]*types.Transaction, error) {
+	return f, nil
+}
+
+type fakeTokenMonitor struct{}
+
+func (fakeTokenMonitor) InspectTransaction(context.Context, *types.Transaction) (map[types.Address]string, error) {
+	return nil, nil
+}
+
+func (fakeTokenMonitor) SetRules([]TokenRule) {}
+
+type recordingABILookup []types.Address
+
+func (r *recordingABILookup) Lookup(address types.Address) {
+	*r = append(*r, address)
+}
+
+func TestPullTransactions_LooksUpCreatedContracts(t *testing.T) {
+	txs := fakeTransactionMonitor{
+		{CreatedContract: types.NewAddress("1")},
+		{To: types.NewAddress("2"), InternalCalls: []*types.InternalCall{
+			{Type: "CALL", To: types.NewAddress("3")},
+			{Type: "CREATE2", To: types.NewAddress("4")},
+		}},
+	}
+	lookup := &recordingABILookup{}
+	m := &MonitorService{transactionMonitor: txs, tokenMonitor: fakeTokenMonitor{}, registerContracts: true}
+	m.SetABILookup(lookup)
+
+	fetched, err := m.pullTransactions(context.Background(), &types.Block{Number: 1}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, fetched, 2)
+	assert.Equal(t, []types.Address{types.NewAddress("1"), types.NewAddress("4")}, []types.Address(*lookup))
+}
@@ -1,8 +1,11 @@
 package monitor
 
 import (
+	"context"
 	"encoding/hex"
+	"fmt"
 	"strings"
+	"sync"
 
 	"quorumengineering/quorum-report/client"
 	"quorumengineering/quorum-report/log"
@@ -21,6 +24,12 @@ type TokenRule struct {
 	templateName string
 	eip165       string
 	abi          *types.ContractABI
+
+	// set for event scope rules
+	event     *types.ContractABIEvent
+	topic     types.Hash
+	parameter string
+	emitter   types.Address
 }
 
 type AddressWithMeta struct {
@@ -30,12 +39,14 @@ type AddressWithMeta struct {
 }
 
 type TokenMonitor interface {
-	InspectTransaction(tx *types.Transaction) (map[types.Address]string, error)
+	InspectTransaction(ctx context.Context, tx *types.Transaction) (map[types.Address]string, error)
+	SetRules(rules []TokenRule)
 }
 
 type DefaultTokenMonitor struct {
 	quorumClient client.Client
 	rules        []TokenRule
+	mux          sync.RWMutex
 }
 
 func NewDefaultTokenMonitor(quorumClient client.Client, rules []TokenRule) *DefaultTokenMonitor {
@@ -45,7 +56,15 @@ func NewDefaultTokenMonitor(quorumClient client.Client, rules []TokenRule) *Defa
 	}
 }
 
-func (tm *DefaultTokenMonitor) InspectTransaction(tx *types.Transaction) (map[types.Address]string, error) {
+// SetRules replaces the rules that newly created contracts are checked against
+func (tm *DefaultTokenMonitor) SetRules(rules []TokenRule) {
+	tm.mux.Lock()
+	defer tm.mux.Unlock()
+	tm.rules = rules
+}
+
+func (tm *DefaultTokenMonitor) InspectTransaction(ctx context.Context, tx *types.Transaction) (map[types.Address]string, error) {
+	quorumClient := client.WithContext(ctx, tm.quorumClient)
 	var addresses []AddressWithMeta
 	if !tx.CreatedContract.IsEmpty() {
 		addresses = append(addresses, AddressWithMeta{
@@ -61,7 +80,7 @@ func (tm *DefaultTokenMonitor) InspectTransaction(tx *types.Transaction) (map[ty
 			addressBytes := event.Data.AsBytes()[12:32]
 			address := types.NewAddress(hex.EncodeToString(addressBytes))
 
-			code, err := client.GetCode(tm.quorumClient, address, tx.BlockNumber-1)
+			code, err := client.GetCode(quorumClient, address, tx.BlockNumber-1)
 			if err != nil {
 				return nil, err
 			}
@@ -88,13 +107,33 @@ func (tm *DefaultTokenMonitor) InspectTransaction(tx *types.Transaction) (map[ty
 
 	tokenContracts := make(map[types.Address]string)
 
+	tm.mux.RLock()
+	rules := tm.rules
+	tm.mux.RUnlock()
+	for _, rule := range rules {
+		if rule.scope != types.EventScope {
+			continue
+		}
+		for _, event := range tx.Events {
+			// an event that can't be decoded doesn't hold up the block
+			addresses, err := rule.eventAddresses(event)
+			if err != nil {
+				log.Warn("Unable to decode event for registration rule", "template", rule.templateName, "event", rule.event.Name, "tx", tx.Hash.Hex(), "err", err)
+				continue
+			}
+			for _, address := range addresses {
+				log.Info("Event emits address to register", "template", rule.templateName, "event", rule.event.Name, "tx", tx.Hash.Hex(), "address", address.Hex())
+				tokenContracts[address] = rule.templateName
+			}
+		}
+	}
 	for _, addressWithMeta := range addresses {
-		for _, rule := range tm.rules {
+		for _, rule := range rules {
 			if !tm.checkRuleMeta(rule, addressWithMeta) {
 				continue
 			}
 			// EIP165
-			contractType, err := tm.checkEIP165(rule, addressWithMeta.address, tx.BlockNumber)
+			contractType, err := tm.checkEIP165(quorumClient, rule, addressWithMeta.address, tx.BlockNumber)
 			if err != nil {
 				return nil, err
 			}
@@ -105,7 +144,7 @@ func (tm *DefaultTokenMonitor) InspectTransaction(tx *types.Transaction) (map[ty
 			}
 
 			// Check contract bytecode directly for all 4bytes presented in abi
-			contractBytecode, err := client.GetCode(tm.quorumClient, addressWithMeta.address, tx.BlockNumber)
+			contractBytecode, err := client.GetCode(quorumClient, addressWithMeta.address, tx.BlockNumber)
 			if err != nil {
 				return nil, err
 			}
@@ -121,6 +160,86 @@ func (tm *DefaultTokenMonitor) InspectTransaction(tx *types.Transaction) (map[ty
 	return tokenContracts, nil
 }
 
+// eventAddresses returns the addresses in the rule's event parameter, if the
+// event is the rule's event. Events with the same signature but other
+// parameters indexed, such as ERC721 transfers for an ERC20 transfer rule,
+// aren't the rule's event.
+func (rule TokenRule) eventAddresses(event *types.Event) ([]types.Address, error) {
+	if len(event.Topics) == 0 || event.Topics[0] != rule.topic {
+		return nil, nil
+	}
+	if !rule.emitter.IsEmpty() && event.Address != rule.emitter {
+		return nil, nil
+	}
+	indexed, unindexed := 0, 0
+	for _, input := range rule.event.Inputs {
+		if input.Indexed {
+			indexed++
+		} else {
+			unindexed++
+		}
+	}
+	if len(event.Topics) != indexed+1 {
+		return nil, nil
+	}
+
+	// indexed addresses are topics, after the event signature
+	topic := 1
+	for _, input := range rule.event.Inputs {
+		if !input.Indexed {
+			continue
+		}
+		if input.Name == rule.parameter {
+			value := string(event.Topics[topic])
+			if len(value) != 64 {
+				return nil, fmt.Errorf("topic %d is %d hex characters long, not 64", topic, len(value))
+			}
+			return []types.Address{types.NewAddress(value[24:])}, nil
+		}
+		topic++
+	}
+
+	// each unindexed parameter takes up at least one word
+	data := event.Data.AsBytes()
+	if len(data) < unindexed*32 {
+		return nil, fmt.Errorf("data of %d bytes is too short for %d parameters", len(data), unindexed)
+	}
+	parsed, err := parseEventData(rule.event, data)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []types.Address
+	switch value := parsed[rule.parameter].(type) {
+	case string:
+		addresses = append(addresses, types.NewAddress(value))
+	case []interface{}:
+		for _, element := range value {
+			if str, ok := element.(string); ok {
+				addresses = append(addresses, types.NewAddress(str))
+			}
+		}
+	}
+	var nonEmpty []types.Address
+	for _, address := range addresses {
+		if !address.IsEmpty() {
+			nonEmpty = append(nonEmpty, address)
+		}
+	}
+	return nonEmpty, nil
+}
+
+// parseEventData parses the event's unindexed parameters. The ABI parser
+// doesn't check the data is long enough for them, so reading past the end is
+// turned into an error.
+func parseEventData(event *types.ContractABIEvent, data []byte) (parsed map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("data too short: %v", r)
+		}
+	}()
+	return event.Parse(data)
+}
+
 func (tm *DefaultTokenMonitor) checkRuleMeta(rule TokenRule, meta AddressWithMeta) bool {
 	// check scope & deployer
 	if rule.scope != types.AllScope {
@@ -134,10 +253,10 @@ func (tm *DefaultTokenMonitor) checkRuleMeta(rule TokenRule, meta AddressWithMet
 	return true
 }
 
-func (tm *DefaultTokenMonitor) checkEIP165(rule TokenRule, address types.Address, blockNum uint64) (string, error) {
+func (tm *DefaultTokenMonitor) checkEIP165(quorumClient client.Client, rule TokenRule, address types.Address, blockNum uint64) (string, error) {
 	if rule.eip165 != "" {
 		//check if the contract implements EIP165
-		eip165Call, err := client.CallEIP165(tm.quorumClient, address, eip165Sig, blockNum)
+		eip165Call, err := client.CallEIP165(quorumClient, address, eip165Sig, blockNum)
 		if err != nil {
 			return "", err
 		}
@@ -145,7 +264,7 @@ func (tm *DefaultTokenMonitor) checkEIP165(rule TokenRule, address types.Address
 			return "", nil
 		}
 
-		eip165CallCheck, err := client.CallEIP165(tm.quorumClient, address, eip165Check, blockNum)
+		eip165CallCheck, err := client.CallEIP165(quorumClient, address, eip165Check, blockNum)
 		if err != nil {
 			return "", err
 		}
@@ -158,7 +277,7 @@ func (tm *DefaultTokenMonitor) checkEIP165(rule TokenRule, address types.Address
 		if err != nil {
 			return "", err
 		}
-		detected, err := client.CallEIP165(tm.quorumClient, address, funcSig, blockNum)
+		detected, err := client.CallEIP165(quorumClient, address, funcSig, blockNum)
 		if err != nil {
 			return "", err
 		}
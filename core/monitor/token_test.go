@@ -1,13 +1,16 @@
 package monitor
 
 import (
+	"context"
 	"encoding/json"
 	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/database/memory"
 	"quorumengineering/quorum-report/types"
 )
 
@@ -52,7 +55,7 @@ func TestDefaultTokenMonitor_InspectTransaction_EIP165WithERC20_External(t *test
 	}
 
 	tokenMonitor := NewDefaultTokenMonitor(stubClient, []TokenRule{{scope: types.AllScope, templateName: "ERC20", eip165: "36372b07"}})
-	res, err := tokenMonitor.InspectTransaction(tx)
+	res, err := tokenMonitor.InspectTransaction(context.Background(), tx)
 
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(res))
@@ -106,7 +109,7 @@ func TestDefaultTokenMonitor_InspectTransaction_EIP165WithERC20_Internal(t *test
 
 	for _, tst := range testMatrix {
 		tokenMonitor := NewDefaultTokenMonitor(stubClient, []TokenRule{tst.rule})
-		res, err := tokenMonitor.InspectTransaction(tx)
+		res, err := tokenMonitor.InspectTransaction(context.Background(), tx)
 
 		assert.Nil(t, err)
 		assert.Equal(t, len(res), len(tst.result))
@@ -167,7 +170,7 @@ func TestDefaultTokenMonitor_InspectTransaction_EIP165WithERC20_ContractExtensio
 
 	for _, tst := range testMatrix {
 		tokenMonitor := NewDefaultTokenMonitor(stubClient, []TokenRule{tst.rule})
-		res, err := tokenMonitor.InspectTransaction(tx)
+		res, err := tokenMonitor.InspectTransaction(context.Background(), tx)
 
 		assert.Nil(t, err)
 		assert.Equal(t, len(res), len(tst.result))
@@ -189,7 +192,7 @@ func TestDefaultTokenMonitor_InspectTransaction_EIP165WithERC721_External(t *tes
 	}
 
 	tokenMonitor := NewDefaultTokenMonitor(stubClient, []TokenRule{{scope: types.AllScope, templateName: "ERC721", eip165: "80ac58cd"}})
-	res, err := tokenMonitor.InspectTransaction(tx)
+	res, err := tokenMonitor.InspectTransaction(context.Background(), tx)
 
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(res))
@@ -243,7 +246,7 @@ func TestDefaultTokenMonitor_InspectTransaction_EIP165WithERC721(t *testing.T) {
 
 	for _, tst := range testMatrix {
 		tokenMonitor := NewDefaultTokenMonitor(stubClient, []TokenRule{tst.rule})
-		res, err := tokenMonitor.InspectTransaction(tx)
+		res, err := tokenMonitor.InspectTransaction(context.Background(), tx)
 
 		assert.Nil(t, err)
 		assert.Equal(t, len(res), len(tst.result))
@@ -307,10 +310,160 @@ func TestDefaultTokenMonitor_InspectTransaction_BytecodeInspection(t *testing.T)
 
 	for _, tst := range testMatrix {
 		tokenMonitor := NewDefaultTokenMonitor(stubClient, []TokenRule{tst.rule})
-		res, err := tokenMonitor.InspectTransaction(tx)
+		res, err := tokenMonitor.InspectTransaction(context.Background(), tx)
 
 		assert.Nil(t, err)
 		assert.Equal(t, len(tst.result), len(res))
 		assert.EqualValues(t, tst.result, res)
 	}
 }
+
+const walletFactoryABI = `[{"anonymous":false,"inputs":[{"indexed":true,"name":"owner","type":"address"},{"indexed":false,"name":"wallet","type":"address"},{"indexed":false,"name":"signers","type":"address[]"}],"name":"WalletCreated","type":"event"}]`
+
+func TestDefaultTokenMonitor_InspectTransaction_EventRules(t *testing.T) {
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddTemplate("WalletFactory", walletFactoryABI, ""))
+	assert.Nil(t, db.AddTemplate("Wallet", "[]", ""))
+
+	factory := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	other := types.NewAddress("0x9d13c6d3afe1721beef56b55d303b09e021e27ab")
+	owner := "00000000000000000000000065a3a5e8e9b5b53a9f5ec1c95f2d6e8e3d4d7e01"
+	wallet := "000000000000000000000000cc11df45aba0a4ff198b18300d0b148ad2468834"
+	signer := "000000000000000000000000586e8164bc8863013fe8f1b82092b028a5f8afad"
+	// the wallet, the offset of the signers, and the signers
+	data := types.NewHexData(wallet + "0000000000000000000000000000000000000000000000000000000000000040" +
+		"0000000000000000000000000000000000000000000000000000000000000001" + signer)
+
+	rules, err := parseTokenRules(db, []*types.RuleConfig{
+		{Scope: types.EventScope, TemplateName: "Wallet", EventTemplate: "WalletFactory", Event: "WalletCreated", Parameter: "wallet", Emitter: factory},
+	})
+	assert.Nil(t, err)
+	require.Len(t, rules, 1)
+	topic := rules[0].topic
+
+	tx := &types.Transaction{
+		Hash:        types.NewHash("0xf4f803b8d6c6b38e0b15d6cfe80fd1dcea4270ad24e93385fca36512bb9c2c59"),
+		BlockNumber: 1,
+		Events: []*types.Event{
+			{Address: factory, Topics: []types.Hash{topic, types.NewHash(owner)}, Data: data},
+			// events from other contracts are not checked, as an emitter is given
+			{Address: other, Topics: []types.Hash{topic, types.NewHash(owner)}, Data: data},
+		},
+	}
+	tokenMonitor := NewDefaultTokenMonitor(client.NewStubQuorumClient(nil, nil), rules)
+	res, err := tokenMonitor.InspectTransaction(context.Background(), tx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[types.Address]string{types.NewAddress(wallet[24:]): "Wallet"}, res)
+
+	// indexed parameters and arrays of addresses, emitted by any contract
+	rules, err = parseTokenRules(db, []*types.RuleConfig{
+		{Scope: types.EventScope, TemplateName: "Wallet", EventTemplate: "WalletFactory", Event: "WalletCreated(address,address,address[])", Parameter: "owner"},
+		{Scope: types.EventScope, TemplateName: "Wallet", EventTemplate: "WalletFactory", Event: "WalletCreated", Parameter: "signers"},
+	})
+	assert.Nil(t, err)
+	tx.Events = tx.Events[:1]
+	tokenMonitor.SetRules(rules)
+	res, err = tokenMonitor.InspectTransaction(context.Background(), tx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[types.Address]string{types.NewAddress(owner[24:]): "Wallet", types.NewAddress(signer[24:]): "Wallet"}, res)
+}
+
+func TestParseTokenRules_EventRules(t *testing.T) {
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddTemplate("WalletFactory", walletFactoryABI, ""))
+	assert.Nil(t, db.AddTemplate("Wallet", "[]", ""))
+
+	_, err := parseTokenRules(db, []*types.RuleConfig{
+		{Scope: types.EventScope, TemplateName: "Wallet", EventTemplate: "WalletFactory", Event: "WalletRemoved", Parameter: "wallet"},
+	})
+	assert.EqualError(t, err, "event WalletRemoved with parameter wallet not found in template WalletFactory")
+
+	// indexed arrays are hashed, so the addresses can't be read from them
+	assert.Nil(t, db.AddTemplate("Registry", `[{"anonymous":false,"inputs":[{"indexed":true,"name":"members","type":"address[]"}],"name":"Registered","type":"event"}]`, ""))
+	_, err = parseTokenRules(db, []*types.RuleConfig{
+		{Scope: types.EventScope, TemplateName: "Wallet", EventTemplate: "Registry", Event: "Registered", Parameter: "members"},
+	})
+	assert.EqualError(t, err, "parameter members of event Registered is not an address")
+
+	// rules with an event template that does not exist are skipped
+	rules, err := parseTokenRules(db, []*types.RuleConfig{
+		{Scope: types.EventScope, TemplateName: "Wallet", EventTemplate: "Missing", Event: "WalletCreated", Parameter: "wallet"},
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, rules)
+}
+
+func TestMonitorService_ReloadTokenRules(t *testing.T) {
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddTemplate("Wallet", "[]", ""))
+	assert.Nil(t, db.AddTokenRule(&types.TokenRule{ID: "stored", Scope: types.ExternalScope, TemplateName: "Wallet", EIP165: "36372b07"}))
+	var config types.ReportingConfig
+	config.SetDefaults()
+	config.Rules = []*types.RuleConfig{{Scope: types.InternalScope, TemplateName: "Wallet"}}
+
+	// the stored rules are used after the configured ones
+	monitorService, err := NewMonitorService(db, client.NewStubQuorumClient(nil, nil), "raft", config)
+	require.Nil(t, err)
+	rules := monitorService.tokenMonitor.(*DefaultTokenMonitor).rules
+	require.Len(t, rules, 2)
+	assert.Equal(t, types.InternalScope, rules[0].scope)
+	assert.Equal(t, "36372b07", rules[1].eip165)
+
+	// a rule with its own ABI is checked against the bytecode with it
+	abi := `[{"inputs":[],"name":"totalSupply","outputs":[{"name":"","type":"uint256"}],"type":"function"}]`
+	assert.Nil(t, db.AddTokenRule(&types.TokenRule{ID: "added", Scope: types.AllScope, TemplateName: "Wallet", ABI: abi}))
+	assert.Nil(t, monitorService.ReloadTokenRules())
+	rules = monitorService.tokenMonitor.(*DefaultTokenMonitor).rules
+	require.Len(t, rules, 3)
+	require.Len(t, rules[2].abi.Functions, 1)
+	assert.Equal(t, "totalSupply", rules[2].abi.Functions[0].Name)
+
+	// updating the configured rules keeps the stored ones
+	assert.Nil(t, monitorService.UpdateRules(nil))
+	rules = monitorService.tokenMonitor.(*DefaultTokenMonitor).rules
+	require.Len(t, rules, 2)
+	assert.Equal(t, types.ExternalScope, rules[0].scope)
+
+	assert.Nil(t, db.DeleteTokenRule("stored"))
+	assert.Nil(t, monitorService.ReloadTokenRules())
+	assert.Len(t, monitorService.tokenMonitor.(*DefaultTokenMonitor).rules, 1)
+}
+
+func TestDefaultTokenMonitor_InspectTransaction_EventRulesOtherLayouts(t *testing.T) {
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddTemplate("ERC20", `[{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"}]`, ""))
+	assert.Nil(t, db.AddTemplate("WalletFactory", walletFactoryABI, ""))
+	assert.Nil(t, db.AddTemplate("Wallet", "[]", ""))
+
+	rules, err := parseTokenRules(db, []*types.RuleConfig{
+		{Scope: types.EventScope, TemplateName: "Wallet", EventTemplate: "ERC20", Event: "Transfer", Parameter: "to"},
+		{Scope: types.EventScope, TemplateName: "Wallet", EventTemplate: "WalletFactory", Event: "WalletCreated", Parameter: "wallet"},
+	})
+	assert.Nil(t, err)
+	require.Len(t, rules, 2)
+
+	from := types.NewHash("00000000000000000000000065a3a5e8e9b5b53a9f5ec1c95f2d6e8e3d4d7e01")
+	to := types.NewHash("000000000000000000000000cc11df45aba0a4ff198b18300d0b148ad2468834")
+	tx := &types.Transaction{
+		Hash:        types.NewHash("0xf4f803b8d6c6b38e0b15d6cfe80fd1dcea4270ad24e93385fca36512bb9c2c59"),
+		BlockNumber: 1,
+		Events: []*types.Event{
+			// an ERC721 transfer, with every parameter indexed and no data
+			{Topics: []types.Hash{rules[0].topic, from, to, types.NewHash("1")}},
+			// a malformed topic
+			{Topics: []types.Hash{rules[0].topic, from, "cc11df45"}, Data: types.NewHexData(string(from))},
+			// data too short for the parameters
+			{Topics: []types.Hash{rules[1].topic, from}},
+		},
+	}
+	tokenMonitor := NewDefaultTokenMonitor(client.NewStubQuorumClient(nil, nil), rules)
+	res, err := tokenMonitor.InspectTransaction(context.Background(), tx)
+	assert.Nil(t, err)
+	assert.Empty(t, res)
+
+	// the ERC20 transfer is still found
+	tx.Events = append(tx.Events, &types.Event{Topics: []types.Hash{rules[0].topic, from, to}, Data: types.NewHexData(string(from))})
+	res, err = tokenMonitor.InspectTransaction(context.Background(), tx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[types.Address]string{types.NewAddress(string(to)[24:]): "Wallet"}, res)
+}
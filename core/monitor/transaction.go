@@ -1,32 +1,51 @@
 package monitor
 
 import (
+	"context"
+
 	"quorumengineering/quorum-report/client"
 	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/tracing"
 	"quorumengineering/quorum-report/types"
 )
 
 type TransactionMonitor interface {
-	PullTransactions(block *types.Block) ([]*types.Transaction, error)
+	PullTransactions(ctx context.Context, block *types.Block) ([]*types.Transaction, error)
 }
 
 type DefaultTransactionMonitor struct {
 	quorumClient client.Client
+
+	// size caps (in bytes) for stored input/ return data, 0 means no limit
+	maxInputDataSize  int
+	maxReturnDataSize int
+	// only keep the transaction summary, without input data, events or a trace
+	summariesOnly bool
+	// fetch the payloads of private transactions the node didn't return from
+	// the private transaction manager
+	resolvePrivatePayloads bool
 }
 
-func NewDefaultTransactionMonitor(quorumClient client.Client) *DefaultTransactionMonitor {
+func NewDefaultTransactionMonitor(quorumClient client.Client, maxInputDataSize, maxReturnDataSize int, summariesOnly, resolvePrivatePayloads bool) *DefaultTransactionMonitor {
 	return &DefaultTransactionMonitor{
-		quorumClient: quorumClient,
+		quorumClient:           quorumClient,
+		maxInputDataSize:       maxInputDataSize,
+		maxReturnDataSize:      maxReturnDataSize,
+		summariesOnly:          summariesOnly,
+		resolvePrivatePayloads: resolvePrivatePayloads,
 	}
 }
 
-func (tm *DefaultTransactionMonitor) PullTransactions(block *types.Block) ([]*types.Transaction, error) {
+func (tm *DefaultTransactionMonitor) PullTransactions(ctx context.Context, block *types.Block) ([]*types.Transaction, error) {
 	log.Info("Fetching transactions", "block", block.Hash.String(), "blockNumber", block.Number)
 
 	fetchedTransactions := make([]*types.Transaction, 0, len(block.Transactions))
 	for _, txHash := range block.Transactions {
 		// Query transaction details by graphql.
-		tx, err := tm.fetchTransaction(block, txHash)
+		txCtx, span := tracing.Start(ctx, "fetch transaction", tracing.String("tx.hash", txHash.Hex()))
+		tx, err := tm.fetchTransaction(txCtx, block, txHash)
+		span.RecordError(err)
+		span.End()
 		if err != nil {
 			return nil, err
 		}
@@ -35,10 +54,11 @@ func (tm *DefaultTransactionMonitor) PullTransactions(block *types.Block) ([]*ty
 	return fetchedTransactions, nil
 }
 
-func (tm *DefaultTransactionMonitor) fetchTransaction(block *types.Block, hash types.Hash) (*types.Transaction, error) {
+func (tm *DefaultTransactionMonitor) fetchTransaction(ctx context.Context, block *types.Block, hash types.Hash) (*types.Transaction, error) {
 	log.Debug("Processing transaction", "hash", hash.String())
 
-	txOrigin, err := client.TransactionWithReceipt(tm.quorumClient, hash)
+	quorumClient := client.WithContext(ctx, tm.quorumClient)
+	txOrigin, err := client.TransactionWithReceipt(quorumClient, hash)
 	if err != nil {
 		return nil, err
 	}
@@ -64,6 +84,24 @@ func (tm *DefaultTransactionMonitor) fetchTransaction(block *types.Block, hash t
 		Timestamp:         block.Timestamp,
 	}
 
+	if tm.summariesOnly {
+		// tracing is the most expensive call to the node, and input data and
+		// events are most of the stored size
+		tx.Data = ""
+		tx.PrivateData = ""
+		tx.Events = []*types.Event{}
+		tx.InternalCalls = []*types.InternalCall{}
+		return tx, nil
+	}
+
+	// the input of a private transaction is the hash of its payload, which
+	// only the parties to it can fetch
+	if tm.resolvePrivatePayloads && tx.IsPrivate && tx.PrivateData.IsEmpty() && !tx.Data.IsEmpty() {
+		if tx.PrivateData, err = client.QuorumPayload(quorumClient, tx.Data); err != nil {
+			return nil, err
+		}
+	}
+
 	tx.Events = make([]*types.Event, len(txOrigin.Logs))
 	for i, l := range txOrigin.Logs {
 		tx.Events[i] = &types.Event{
@@ -79,28 +117,66 @@ func (tm *DefaultTransactionMonitor) fetchTransaction(block *types.Block, hash t
 		}
 	}
 
-	traceResp, err := client.TraceTransaction(tm.quorumClient, tx.Hash)
+	traceCtx, span := tracing.Start(ctx, "trace transaction", tracing.String("tx.hash", tx.Hash.Hex()))
+	traceResp, err := client.TraceTransaction(client.WithContext(traceCtx, tm.quorumClient), tx.Hash)
+	span.RecordError(err)
+	span.End()
 	if err != nil {
 		return nil, err
 	}
+	tx.ReturnData = traceResp.Output
+
+	// apply configured size caps on stored input/ return data
+	var dataTruncated, privateDataTruncated bool
+	tx.Data, dataTruncated = truncateData(tx.Data, tm.maxInputDataSize)
+	tx.PrivateData, privateDataTruncated = truncateData(tx.PrivateData, tm.maxInputDataSize)
+	tx.DataTruncated = dataTruncated || privateDataTruncated
+	tx.ReturnData, tx.ReturnTruncated = truncateData(tx.ReturnData, tm.maxReturnDataSize)
+	if tx.DataTruncated || tx.ReturnTruncated {
+		log.Debug("Truncated transaction data", "hash", tx.Hash.Hex(), "input", tx.DataTruncated, "return", tx.ReturnTruncated)
+	}
 
 	calls := flattenCalls(traceResp.Calls)
 	tx.InternalCalls = make([]*types.InternalCall, len(calls))
 	for i, respCall := range calls {
-		tx.InternalCalls[i] = &types.InternalCall{
-			From:    respCall.From,
-			To:      respCall.To,
-			Gas:     respCall.Gas.ToUint64(),
-			GasUsed: respCall.GasUsed.ToUint64(),
-			Value:   respCall.Value.ToUint64(),
-			Input:   respCall.Input,
-			Output:  respCall.Output,
-			Type:    respCall.Type,
-		}
+		tx.InternalCalls[i] = newInternalCall(respCall)
 	}
+	tx.CallTree = buildCallTree(traceResp.Calls)
 	return tx, nil
 }
 
+func newInternalCall(call types.RawInnerCall) *types.InternalCall {
+	return &types.InternalCall{
+		From:    call.From,
+		To:      call.To,
+		Gas:     call.Gas.ToUint64(),
+		GasUsed: call.GasUsed.ToUint64(),
+		Value:   call.Value.ToUint64(),
+		Input:   call.Input,
+		Output:  call.Output,
+		Type:    call.Type,
+	}
+}
+
+// buildCallTree converts the internal calls of a trace, keeping the calls
+// each one made nested under it
+func buildCallTree(calls []types.RawInnerCall) []*types.CallFrame {
+	frames := make([]*types.CallFrame, len(calls))
+	for i, call := range calls {
+		frames[i] = &types.CallFrame{InternalCall: *newInternalCall(call), Calls: buildCallTree(call.Calls)}
+	}
+	return frames
+}
+
+// truncateData cuts the given data down to maxSize bytes, reporting whether
+// any data was removed. A maxSize of 0 means no limit.
+func truncateData(data types.HexData, maxSize int) (types.HexData, bool) {
+	if maxSize <= 0 || len(data) <= 2*maxSize {
+		return data, false
+	}
+	return data[:2*maxSize], true
+}
+
 //flattens the list of internal calls to a single list
 //e.g [1 [2 3 [4 5] 6 [7]]] -> [1 2 3 4 5 6 7]
 func flattenCalls(calls []types.RawInnerCall) []types.RawInnerCall {
@@ -1,6 +1,8 @@
 package monitor
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -63,8 +65,8 @@ func TestCreateTransaction(t *testing.T) {
 		},
 	}
 
-	tm := NewDefaultTransactionMonitor(client.NewStubQuorumClient(mockGraphQL, mockRPC))
-	tx, err := tm.fetchTransaction(testBlock, types.NewHash("0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8"))
+	tm := NewDefaultTransactionMonitor(client.NewStubQuorumClient(mockGraphQL, mockRPC), 0, 0, false, true)
+	tx, err := tm.fetchTransaction(context.Background(), testBlock, types.NewHash("0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8"))
 	assert.Nil(t, err)
 	assert.EqualValues(t, types.NewHash("0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8"), tx.Hash)
 	assert.True(t, tx.Status)
@@ -79,6 +81,8 @@ func TestCreateTransaction(t *testing.T) {
 	assert.Len(t, tx.Events, 1)
 	assert.EqualValues(t, types.NewHash("0xefe5cb8d23d632b5d2cdd9f0a151c4b1a84ccb7afa1c57331009aa922d5e4f36"), tx.Events[0].Topics[0])
 	assert.Len(t, tx.InternalCalls, 1)
+	assert.Len(t, tx.CallTree, 1)
+	assert.Equal(t, *tx.InternalCalls[0], tx.CallTree[0].InternalCall)
 }
 
 func TestTransactionMonitor_PullTransactions(t *testing.T) {
@@ -111,9 +115,9 @@ func TestTransactionMonitor_PullTransactions(t *testing.T) {
 		},
 	}
 
-	tm := NewDefaultTransactionMonitor(client.NewStubQuorumClient(mockGraphQL, mockRPC))
+	tm := NewDefaultTransactionMonitor(client.NewStubQuorumClient(mockGraphQL, mockRPC), 0, 0, false, true)
 
-	txs, err := tm.PullTransactions(block)
+	txs, err := tm.PullTransactions(context.Background(), block)
 	assert.Nil(t, err, "unexpected error")
 	assert.Len(t, txs, 1)
 
@@ -132,3 +136,118 @@ func TestTransactionMonitor_PullTransactions(t *testing.T) {
 	assert.EqualValues(t, types.NewHash("0xefe5cb8d23d632b5d2cdd9f0a151c4b1a84ccb7afa1c57331009aa922d5e4f36"), tx.Events[0].Topics[0])
 	assert.Len(t, tx.InternalCalls, 1)
 }
+
+func TestTransactionMonitor_SummariesOnly(t *testing.T) {
+	// no trace is requested, so there is no mock for it
+	mockGraphQL := map[string]map[string]interface{}{
+		client.TransactionDetailQuery(types.NewHash("0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8")): {
+			"transaction": interface{}(graphqlResp),
+		},
+	}
+	testBlock := &types.Block{
+		Number:    2,
+		Timestamp: uint64(0x1000),
+	}
+
+	tm := NewDefaultTransactionMonitor(client.NewStubQuorumClient(mockGraphQL, nil), 0, 0, true, true)
+	tx, err := tm.fetchTransaction(context.Background(), testBlock, types.NewHash("0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8"))
+	assert.Nil(t, err)
+	assert.True(t, tx.Status)
+	assert.EqualValues(t, types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d"), tx.From)
+	assert.EqualValues(t, 4700000, tx.Gas)
+	assert.EqualValues(t, 0x1000, tx.Timestamp)
+	assert.EqualValues(t, "0x", tx.Data.String())
+	assert.Len(t, tx.Events, 0)
+	assert.Len(t, tx.InternalCalls, 0)
+}
+
+func TestTransactionMonitor_TruncatesData(t *testing.T) {
+	testBlock := &types.Block{
+		Number:    2,
+		Timestamp: uint64(0x1000),
+	}
+	mockGraphQL := map[string]map[string]interface{}{
+		client.TransactionDetailQuery(types.NewHash("0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8")): {
+			"transaction": interface{}(graphqlResp),
+		},
+	}
+	mockRPC := map[string]interface{}{
+		"debug_traceTransaction0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8<*client.TraceConfig Value>": types.RawOuterCall{
+			Output: "0000000000000000000000000000000000000000000000000000000000000001",
+		},
+	}
+
+	tm := NewDefaultTransactionMonitor(client.NewStubQuorumClient(mockGraphQL, mockRPC), 4, 0, false, true)
+	tx, err := tm.fetchTransaction(context.Background(), testBlock, types.NewHash("0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, "0x60806040", tx.Data.String())
+	assert.True(t, tx.DataTruncated)
+	assert.EqualValues(t, "0x0000000000000000000000000000000000000000000000000000000000000001", tx.ReturnData.String())
+	assert.False(t, tx.ReturnTruncated)
+
+	tm = NewDefaultTransactionMonitor(client.NewStubQuorumClient(mockGraphQL, mockRPC), 0, 16, false, true)
+	tx, err = tm.fetchTransaction(context.Background(), testBlock, types.NewHash("0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8"))
+	assert.Nil(t, err)
+	assert.False(t, tx.DataTruncated)
+	assert.EqualValues(t, "0x00000000000000000000000000000000", tx.ReturnData.String())
+	assert.True(t, tx.ReturnTruncated)
+}
+
+func TestBuildCallTree(t *testing.T) {
+	calls := []types.RawInnerCall{
+		{To: "01", Type: "CALL", Calls: []types.RawInnerCall{
+			{To: "02", Type: "STATICCALL"},
+			{To: "03", Type: "DELEGATECALL", Calls: []types.RawInnerCall{{To: "04", Type: "CREATE"}}},
+		}},
+		{To: "05", Type: "CALL"},
+	}
+
+	tree := buildCallTree(calls)
+	assert.Len(t, tree, 2)
+	assert.EqualValues(t, "01", tree[0].To)
+	assert.Len(t, tree[0].Calls, 2)
+	assert.Equal(t, "STATICCALL", tree[0].Calls[0].Type)
+	assert.Empty(t, tree[0].Calls[0].Calls)
+	assert.Len(t, tree[0].Calls[1].Calls, 1)
+	assert.Equal(t, "CREATE", tree[0].Calls[1].Calls[0].Type)
+	assert.Empty(t, tree[1].Calls)
+	// the same calls are flattened, in the order they were made
+	assert.Len(t, flattenCalls(calls), 5)
+}
+
+func TestTransactionMonitor_PrivatePayload(t *testing.T) {
+	testBlock := &types.Block{
+		Number:    2,
+		Timestamp: uint64(0x1000),
+	}
+	payloadHash := "0x" + strings.Repeat("ab", 64)
+	privateResp := make(map[string]interface{})
+	for k, v := range graphqlResp {
+		privateResp[k] = v
+	}
+	privateResp["inputData"] = payloadHash
+	privateResp["isPrivate"] = true
+	mockGraphQL := map[string]map[string]interface{}{
+		client.TransactionDetailQuery(types.NewHash("0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8")): {
+			"transaction": interface{}(privateResp),
+		},
+	}
+	mockRPC := map[string]interface{}{
+		"debug_traceTransaction0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8<*client.TraceConfig Value>": types.RawOuterCall{},
+		"eth_getQuorumPayload" + payloadHash: types.NewHexData("0x60fe47b10000000000000000000000000000000000000000000000000000000000000042"),
+	}
+
+	// the payload the node didn't return is fetched by its hash
+	tm := NewDefaultTransactionMonitor(client.NewStubQuorumClient(mockGraphQL, mockRPC), 0, 0, false, true)
+	tx, err := tm.fetchTransaction(context.Background(), testBlock, types.NewHash("0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8"))
+	assert.Nil(t, err)
+	assert.True(t, tx.IsPrivate)
+	assert.EqualValues(t, payloadHash, tx.Data.String())
+	assert.EqualValues(t, "0x60fe47b10000000000000000000000000000000000000000000000000000000000000042", tx.PrivateData.String())
+
+	// unless disabled
+	tm = NewDefaultTransactionMonitor(client.NewStubQuorumClient(mockGraphQL, mockRPC), 0, 0, false, false)
+	tx, err = tm.fetchTransaction(context.Background(), testBlock, types.NewHash("0xe625ba9f14eed0671508966080fb01374d0a3a16b9cee545a324179b75f30aa8"))
+	assert.Nil(t, err)
+	assert.True(t, tx.PrivateData.IsEmpty())
+}
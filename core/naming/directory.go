@@ -0,0 +1,290 @@
+package naming
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// pageSize is the most registry events fetched at once, the deepest page of
+// events that can be fetched
+const pageSize = 1000
+
+type DirectoryDB interface {
+	GetContractABI(types.Address) (string, error)
+	GetLastFiltered(types.Address) (uint64, error)
+	GetEventsByTopics(*types.EventTopicQuery, *types.QueryOptions) ([]*types.Event, error)
+	GetEventsByTopicsTotal(*types.EventTopicQuery, *types.QueryOptions) (uint64, error)
+}
+
+// Directory keeps the names set in a naming registry contract, read from the
+// registry's indexed events, so names can be used in place of addresses. The
+// events are checked on start and every poll interval after, and all names
+// are read again if the registry is rolled back.
+type Directory struct {
+	db           DirectoryDB
+	config       *types.NamingConfig
+	pollInterval time.Duration
+
+	// found in the registry's ABI on the first refresh it has one
+	event *types.ContractABIEvent
+	topic types.Hash
+
+	names        map[string]types.Address
+	addressNames map[types.Address]map[string]bool
+	// the block the registry's events have been read up to
+	lastBlock uint64
+	mux       sync.RWMutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewDirectory(db DirectoryDB, config *types.NamingConfig) *Directory {
+	return &Directory{
+		db:           db,
+		config:       config,
+		pollInterval: time.Duration(config.PollInterval) * time.Second,
+		names:        make(map[string]types.Address),
+		addressNames: make(map[types.Address]map[string]bool),
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (d *Directory) Start() error {
+	log.Info("Starting naming directory", "registry", d.config.Registry.String())
+	d.shutdownWg.Add(1)
+	go func() {
+		defer d.shutdownWg.Done()
+		ticker := time.NewTicker(d.pollInterval)
+		defer ticker.Stop()
+		for {
+			if err := d.Refresh(); err != nil {
+				log.Warn("Unable to read names from the naming registry", "registry", d.config.Registry.String(), "err", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-d.shutdownChan:
+				return
+			}
+		}
+	}()
+	log.Info("Naming directory started")
+	return nil
+}
+
+func (d *Directory) Stop() {
+	close(d.shutdownChan)
+	d.shutdownWg.Wait()
+	log.Info("Naming directory stopped")
+}
+
+// Resolve returns the address a name is set to.
+func (d *Directory) Resolve(name string) (types.Address, bool) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	address, ok := d.names[name]
+	return address, ok
+}
+
+// Names returns the names set to an address, in alphabetical order.
+func (d *Directory) Names(address types.Address) []string {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	names := make([]string, 0, len(d.addressNames[address]))
+	for name := range d.addressNames[address] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// All returns every name that is set, in alphabetical order.
+func (d *Directory) All() []*types.RegisteredName {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	all := make([]*types.RegisteredName, 0, len(d.names))
+	for name, address := range d.names {
+		all = append(all, &types.RegisteredName{Name: name, Address: address})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Refresh applies the registry events indexed since the last refresh.
+func (d *Directory) Refresh() error {
+	if d.event == nil {
+		if err := d.findEvent(); err != nil {
+			return err
+		}
+	}
+	lastFiltered, err := d.db.GetLastFiltered(d.config.Registry)
+	if err != nil {
+		return err
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if lastFiltered < d.lastBlock {
+		log.Info("Naming registry rolled back, reading all names again", "from", d.lastBlock, "to", lastFiltered)
+		d.names = make(map[string]types.Address)
+		d.addressNames = make(map[types.Address]map[string]bool)
+		d.lastBlock = 0
+	}
+	for d.lastBlock < lastFiltered {
+		events, end, err := d.nextEvents(d.lastBlock+1, lastFiltered)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := d.apply(event); err != nil {
+				return fmt.Errorf("event in transaction %s: %v", event.TransactionHash.String(), err)
+			}
+		}
+		d.lastBlock = end
+	}
+	return nil
+}
+
+// findEvent looks up the configured event in the registry's ABI, checking its
+// parameters
+func (d *Directory) findEvent() error {
+	rawABI, err := d.db.GetContractABI(d.config.Registry)
+	if err != nil {
+		return err
+	}
+	if rawABI == "" {
+		return errors.New("naming registry has no ABI")
+	}
+	abi, err := types.NewABIStructureFromJSON(rawABI)
+	if err != nil {
+		return fmt.Errorf("could not parse ABI: %s", err.Error())
+	}
+	for _, event := range abi.ToInternalABI().Events {
+		if event.Name != d.config.Event && event.StringNoName() != d.config.Event {
+			continue
+		}
+		var nameFound, addressFound bool
+		for _, input := range event.Inputs {
+			switch input.Name {
+			case d.config.NameParameter:
+				if input.Type != "string" || input.Indexed {
+					return fmt.Errorf("parameter %s of event %s must be a string that is not indexed", input.Name, d.config.Event)
+				}
+				nameFound = true
+			case d.config.AddressParameter:
+				if input.Type != "address" {
+					return fmt.Errorf("parameter %s of event %s must be an address", input.Name, d.config.Event)
+				}
+				addressFound = true
+			}
+		}
+		if !nameFound || !addressFound {
+			return fmt.Errorf("event %s has no %s and %s parameters", d.config.Event, d.config.NameParameter, d.config.AddressParameter)
+		}
+		d.event = &event
+		d.topic = types.NewHash(event.Signature())
+		return nil
+	}
+	return fmt.Errorf("event %s not found in the naming registry ABI", d.config.Event)
+}
+
+// nextEvents returns the registry events from the start block, up to an end
+// block chosen so they fit in a page, in the order they were emitted, along
+// with the end block
+func (d *Directory) nextEvents(start uint64, end uint64) ([]*types.Event, uint64, error) {
+	query := &types.EventTopicQuery{Address: &d.config.Registry, Topics: []*types.Hash{&d.topic}}
+	var options *types.QueryOptions
+	for {
+		options = &types.QueryOptions{
+			BeginBlockNumber: new(big.Int).SetUint64(start),
+			EndBlockNumber:   new(big.Int).SetUint64(end),
+			PageSize:         pageSize,
+		}
+		options.SetDefaults()
+		total, err := d.db.GetEventsByTopicsTotal(query, options)
+		if err != nil {
+			return nil, 0, err
+		}
+		if total <= pageSize {
+			break
+		}
+		if start == end {
+			log.Warn("Too many naming registry events in a block, only reading some of them", "block", start, "events", total)
+			break
+		}
+		end = start + (end-start)/2
+	}
+
+	events, err := d.db.GetEventsByTopics(query, options)
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].BlockNumber != events[j].BlockNumber {
+			return events[i].BlockNumber < events[j].BlockNumber
+		}
+		return events[i].Index < events[j].Index
+	})
+	return events, end, nil
+}
+
+// apply sets the name in the event to its address, or removes it if the
+// address is zero
+func (d *Directory) apply(event *types.Event) error {
+	parsed, err := d.event.Parse(event.Data.AsBytes())
+	if err != nil {
+		return err
+	}
+	name, ok := parsed[d.config.NameParameter].(string)
+	if !ok {
+		return fmt.Errorf("parameter %s is not a string", d.config.NameParameter)
+	}
+
+	var address types.Address
+	// indexed addresses are topics, after the event signature
+	topic := 1
+	for _, input := range d.event.Inputs {
+		if !input.Indexed {
+			continue
+		}
+		if input.Name == d.config.AddressParameter {
+			if topic >= len(event.Topics) {
+				return fmt.Errorf("parameter %s is missing", d.config.AddressParameter)
+			}
+			address = types.NewAddress(string(event.Topics[topic])[24:])
+		}
+		topic++
+	}
+	if address == "" {
+		value, ok := parsed[d.config.AddressParameter].(string)
+		if !ok {
+			return fmt.Errorf("parameter %s is not an address", d.config.AddressParameter)
+		}
+		address = types.NewAddress(value)
+	}
+
+	if previous, ok := d.names[name]; ok {
+		delete(d.addressNames[previous], name)
+		if len(d.addressNames[previous]) == 0 {
+			delete(d.addressNames, previous)
+		}
+		delete(d.names, name)
+	}
+	if address.IsEmpty() {
+		return nil
+	}
+	d.names[name] = address
+	if d.addressNames[address] == nil {
+		d.addressNames[address] = make(map[string]bool)
+	}
+	d.addressNames[address][name] = true
+	return nil
+}
@@ -0,0 +1,198 @@
+package naming
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	registryABI = `[{"anonymous":false,"inputs":[{"indexed":false,"name":"name","type":"string"},{"indexed":true,"name":"addr","type":"address"}],"name":"AddrChanged","type":"event"}]`
+	// the address is not indexed, so comes after the name offset in the data
+	unindexedABI = `[{"anonymous":false,"inputs":[{"indexed":false,"name":"label","type":"string"},{"indexed":false,"name":"owner","type":"address"}],"name":"NameSet","type":"event"}]`
+)
+
+var (
+	registry = types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	alice    = types.NewAddress("0x0000000000000000000000000000000000000a11")
+	bob      = types.NewAddress("0x0000000000000000000000000000000000000b0b")
+)
+
+type stubDirectoryDB struct {
+	abi          string
+	lastFiltered uint64
+	events       []*types.Event
+	totalCalls   int
+}
+
+func (db *stubDirectoryDB) GetContractABI(types.Address) (string, error) {
+	return db.abi, nil
+}
+
+func (db *stubDirectoryDB) GetLastFiltered(types.Address) (uint64, error) {
+	return db.lastFiltered, nil
+}
+
+// GetEventsByTopics returns the matching events newest first, as the
+// databases do
+func (db *stubDirectoryDB) GetEventsByTopics(query *types.EventTopicQuery, options *types.QueryOptions) ([]*types.Event, error) {
+	var events []*types.Event
+	for i := len(db.events) - 1; i >= 0; i-- {
+		event := db.events[i]
+		if query.Matches(event) && event.BlockNumber >= options.BeginBlockNumber.Uint64() && event.BlockNumber <= options.EndBlockNumber.Uint64() {
+			events = append(events, event)
+		}
+	}
+	if len(events) > options.PageSize {
+		events = events[:options.PageSize]
+	}
+	return events, nil
+}
+
+func (db *stubDirectoryDB) GetEventsByTopicsTotal(query *types.EventTopicQuery, options *types.QueryOptions) (uint64, error) {
+	db.totalCalls++
+	var total uint64
+	for _, event := range db.events {
+		if query.Matches(event) && event.BlockNumber >= options.BeginBlockNumber.Uint64() && event.BlockNumber <= options.EndBlockNumber.Uint64() {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func word(value uint64) string {
+	return fmt.Sprintf("%064x", value)
+}
+
+// encodeName ABI encodes a string in 32 byte words, without its offset
+func encodeName(name string) string {
+	padded := make([]byte, (len(name)+31)/32*32)
+	copy(padded, name)
+	return word(uint64(len(name))) + hex.EncodeToString(padded)
+}
+
+func signature(t *testing.T, rawABI string) types.Hash {
+	abi, err := types.NewABIStructureFromJSON(rawABI)
+	require.Nil(t, err)
+	return types.NewHash(abi.ToInternalABI().Events[0].Signature())
+}
+
+func (db *stubDirectoryDB) addrChanged(t *testing.T, block uint64, index uint64, name string, address types.Address) {
+	db.events = append(db.events, &types.Event{
+		Address:     registry,
+		BlockNumber: block,
+		Index:       index,
+		Data:        types.NewHexData(word(32) + encodeName(name)),
+		Topics:      []types.Hash{signature(t, registryABI), types.NewHash("0x000000000000000000000000" + address.String()[2:])},
+	})
+}
+
+func newConfig() *types.NamingConfig {
+	return &types.NamingConfig{Registry: registry, Event: "AddrChanged", NameParameter: "name", AddressParameter: "addr", PollInterval: 10}
+}
+
+func TestDirectory_Refresh(t *testing.T) {
+	db := &stubDirectoryDB{abi: registryABI, lastFiltered: 3}
+	// out of order within a block, to check they are applied in order
+	db.addrChanged(t, 1, 0, "alice", alice)
+	db.addrChanged(t, 2, 1, "shared", bob)
+	db.addrChanged(t, 2, 0, "shared", alice)
+	db.addrChanged(t, 3, 0, "bob", bob)
+	// not yet filtered
+	db.addrChanged(t, 4, 0, "late", bob)
+
+	dir := NewDirectory(db, newConfig())
+	require.Nil(t, dir.Refresh())
+
+	address, ok := dir.Resolve("alice")
+	assert.True(t, ok)
+	assert.Equal(t, alice, address)
+	address, ok = dir.Resolve("shared")
+	assert.True(t, ok)
+	assert.Equal(t, bob, address)
+	_, ok = dir.Resolve("late")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"alice"}, dir.Names(alice))
+	assert.Equal(t, []string{"bob", "shared"}, dir.Names(bob))
+	assert.Equal(t, []*types.RegisteredName{{Name: "alice", Address: alice}, {Name: "bob", Address: bob}, {Name: "shared", Address: bob}}, dir.All())
+
+	// only the new blocks are read, and the zero address removes a name
+	db.addrChanged(t, 5, 0, "bob", types.NewAddress("0x0000000000000000000000000000000000000000"))
+	db.lastFiltered = 5
+	require.Nil(t, dir.Refresh())
+	_, ok = dir.Resolve("bob")
+	assert.False(t, ok)
+	address, ok = dir.Resolve("late")
+	assert.True(t, ok)
+	assert.Equal(t, bob, address)
+	assert.Equal(t, []string{"late", "shared"}, dir.Names(bob))
+
+	// a rollback reads all names again
+	db.events = db.events[:1]
+	db.lastFiltered = 2
+	require.Nil(t, dir.Refresh())
+	assert.Equal(t, []*types.RegisteredName{{Name: "alice", Address: alice}}, dir.All())
+	assert.Empty(t, dir.Names(bob))
+}
+
+func TestDirectory_Refresh_UnindexedAddress(t *testing.T) {
+	db := &stubDirectoryDB{abi: unindexedABI, lastFiltered: 1}
+	db.events = []*types.Event{{
+		Address:     registry,
+		BlockNumber: 1,
+		Data:        types.NewHexData(word(64) + "0000000000000000000000000000000000000000000000000000000000000a11" + encodeName("alice")),
+		Topics:      []types.Hash{signature(t, unindexedABI)},
+	}}
+	config := newConfig()
+	config.Event, config.NameParameter, config.AddressParameter = "NameSet(string,address)", "label", "owner"
+
+	dir := NewDirectory(db, config)
+	require.Nil(t, dir.Refresh())
+	address, ok := dir.Resolve("alice")
+	assert.True(t, ok)
+	assert.Equal(t, alice, address)
+}
+
+func TestDirectory_Refresh_Paged(t *testing.T) {
+	db := &stubDirectoryDB{abi: registryABI, lastFiltered: 1500}
+	for block := uint64(1); block <= 1500; block++ {
+		db.addrChanged(t, block, 0, "counter", types.NewAddress(fmt.Sprintf("0x%040x", block)))
+	}
+
+	dir := NewDirectory(db, newConfig())
+	require.Nil(t, dir.Refresh())
+	address, ok := dir.Resolve("counter")
+	assert.True(t, ok)
+	assert.Equal(t, types.NewAddress(fmt.Sprintf("0x%040x", 1500)), address)
+	// 1-1500 is too many, then 1-750 and 751-1500 fit
+	assert.Equal(t, 3, db.totalCalls)
+}
+
+func TestDirectory_Refresh_InvalidEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		abi    string
+		config func(*types.NamingConfig)
+		err    string
+	}{
+		{"no ABI", "", func(*types.NamingConfig) {}, "naming registry has no ABI"},
+		{"missing event", registryABI, func(c *types.NamingConfig) { c.Event = "NameSet" }, "event NameSet not found in the naming registry ABI"},
+		{"missing parameter", registryABI, func(c *types.NamingConfig) { c.NameParameter = "label" }, "event AddrChanged has no label and addr parameters"},
+		{"swapped parameters", registryABI, func(c *types.NamingConfig) { c.NameParameter = "addr"; c.AddressParameter = "name" }, "parameter name of event AddrChanged must be an address"},
+		{"indexed name", `[{"inputs":[{"indexed":true,"name":"name","type":"string"},{"indexed":true,"name":"addr","type":"address"}],"name":"AddrChanged","type":"event"}]`, func(*types.NamingConfig) {}, "parameter name of event AddrChanged must be a string that is not indexed"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newConfig()
+			tc.config(config)
+			dir := NewDirectory(&stubDirectoryDB{abi: tc.abi, lastFiltered: 1}, config)
+			err := dir.Refresh()
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package pending
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+type MonitorDB interface {
+	GetAddresses() ([]types.Address, error)
+	GetContractABI(types.Address) (string, error)
+}
+
+// Listener is told of each pending transaction to a registered contract when
+// it is first seen
+type Listener func(*types.PendingTransaction)
+
+// Monitor follows the transactions added to the node's pool through a pending
+// transaction filter, keeping those sent to registered contracts, with their
+// calls decoded, until they are mined or expire. Mined transactions are found
+// through a block filter. Filters the node has removed, such as after it
+// restarts, are installed again on the next poll, so transactions added in
+// between are missed.
+type Monitor struct {
+	db           MonitorDB
+	client       client.Client
+	pollInterval time.Duration
+	expiry       time.Duration
+	max          int
+
+	pendingFilter string
+	blockFilter   string
+
+	// in the order they were seen
+	transactions []*types.PendingTransaction
+	listeners    []Listener
+	mux          sync.RWMutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewMonitor(db MonitorDB, quorumClient client.Client, config *types.PendingConfig) *Monitor {
+	return &Monitor{
+		db:           db,
+		client:       quorumClient,
+		pollInterval: time.Duration(config.PollInterval) * time.Second,
+		expiry:       time.Duration(config.Expiry) * time.Second,
+		max:          config.MaxTransactions,
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (m *Monitor) Start() error {
+	log.Info("Starting pending transaction monitor")
+	m.shutdownWg.Add(1)
+	go func() {
+		defer m.shutdownWg.Done()
+		ticker := time.NewTicker(m.pollInterval)
+		defer ticker.Stop()
+		for {
+			if err := m.Poll(); err != nil {
+				log.Warn("Unable to read pending transactions", "err", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-m.shutdownChan:
+				return
+			}
+		}
+	}()
+	log.Info("Pending transaction monitor started")
+	return nil
+}
+
+func (m *Monitor) Stop() {
+	close(m.shutdownChan)
+	m.shutdownWg.Wait()
+	log.Info("Pending transaction monitor stopped")
+}
+
+// AddListener tells the listener of the pending transactions seen from then
+// on.
+func (m *Monitor) AddListener(listener Listener) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+// Pending returns the pending transactions to the contract, or to all
+// registered contracts if no address is given, in the order they were seen.
+func (m *Monitor) Pending(address types.Address) []*types.PendingTransaction {
+	cutoff := uint64(time.Now().Add(-m.expiry).Unix())
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	pending := make([]*types.PendingTransaction, 0, len(m.transactions))
+	for _, tx := range m.transactions {
+		if tx.SeenAt < cutoff || (!address.IsEmpty() && tx.To != address) {
+			continue
+		}
+		pending = append(pending, tx)
+	}
+	return pending
+}
+
+// Poll removes the transactions mined in new blocks, then adds the pending
+// transactions to registered contracts added to the pool since the last poll.
+func (m *Monitor) Poll() error {
+	if err := m.removeMined(); err != nil {
+		return err
+	}
+
+	if m.pendingFilter == "" {
+		id, err := client.NewPendingTransactionFilter(m.client)
+		if err != nil {
+			return err
+		}
+		m.pendingFilter = id
+	}
+	hashes, err := client.FilterChanges(m.client, m.pendingFilter)
+	if err != nil {
+		m.pendingFilter = ""
+		return err
+	}
+	if len(hashes) == 0 {
+		m.expire()
+		return nil
+	}
+
+	addresses, err := m.db.GetAddresses()
+	if err != nil {
+		return err
+	}
+	registered := make(map[types.Address]bool, len(addresses))
+	for _, address := range addresses {
+		registered[address] = true
+	}
+
+	var seen []*types.PendingTransaction
+	for _, hash := range hashes {
+		raw, err := client.PendingTransaction(m.client, hash)
+		if err != nil {
+			// dropped from the pool since
+			log.Debug("Unable to fetch pending transaction", "tx", hash.Hex(), "err", err)
+			continue
+		}
+		if raw.BlockNumber != nil || !registered[raw.To] {
+			continue
+		}
+		tx, err := m.decode(raw)
+		if err != nil {
+			return err
+		}
+		seen = append(seen, tx)
+	}
+
+	m.mux.Lock()
+	m.transactions = append(m.transactions, seen...)
+	listeners := m.listeners
+	m.mux.Unlock()
+	m.expire()
+
+	for _, tx := range seen {
+		for _, listener := range listeners {
+			listener(tx)
+		}
+	}
+	return nil
+}
+
+// removeMined drops the pending transactions included in the blocks found
+// since the last poll.
+func (m *Monitor) removeMined() error {
+	if m.blockFilter == "" {
+		id, err := client.NewBlockFilter(m.client)
+		if err != nil {
+			return err
+		}
+		m.blockFilter = id
+	}
+	blockHashes, err := client.FilterChanges(m.client, m.blockFilter)
+	if err != nil {
+		m.blockFilter = ""
+		return err
+	}
+
+	mined := make(map[types.Hash]bool)
+	for _, blockHash := range blockHashes {
+		block, err := client.BlockByHash(m.client, blockHash)
+		if err != nil {
+			return err
+		}
+		for _, txHash := range block.Transactions {
+			mined[txHash] = true
+		}
+	}
+	if len(mined) == 0 {
+		return nil
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	remaining := make([]*types.PendingTransaction, 0, len(m.transactions))
+	for _, tx := range m.transactions {
+		if !mined[tx.Hash] {
+			remaining = append(remaining, tx)
+		}
+	}
+	m.transactions = remaining
+	return nil
+}
+
+// expire drops the transactions seen longer ago than the expiry, and the
+// oldest beyond the most kept.
+func (m *Monitor) expire() {
+	cutoff := uint64(time.Now().Add(-m.expiry).Unix())
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	first := 0
+	for first < len(m.transactions) && m.transactions[first].SeenAt < cutoff {
+		first++
+	}
+	if len(m.transactions)-first > m.max {
+		first = len(m.transactions) - m.max
+	}
+	m.transactions = append([]*types.PendingTransaction(nil), m.transactions[first:]...)
+}
+
+// decode decodes the call of the transaction with the ABI of the contract it
+// is sent to. Private transactions are decoded from their payload, where the
+// node's private transaction manager has it.
+func (m *Monitor) decode(raw types.RawPendingTransaction) (*types.PendingTransaction, error) {
+	seenAt := uint64(time.Now().Unix())
+	tx := &types.PendingTransaction{
+		Hash:      raw.Hash,
+		From:      raw.From,
+		To:        raw.To,
+		Nonce:     raw.Nonce.ToUint64(),
+		Gas:       raw.Gas.ToUint64(),
+		GasPrice:  raw.GasPrice.ToUint64(),
+		Value:     "0",
+		Data:      raw.Input,
+		IsPrivate: raw.V == 37 || raw.V == 38,
+		SeenAt:    seenAt,
+		SeenAtISO: types.FormatTimestamp(seenAt),
+	}
+	if value, ok := new(big.Int).SetString(raw.Value, 0); ok {
+		tx.Value = value.String()
+	}
+
+	contractABI, err := m.db.GetContractABI(raw.To)
+	if err != nil {
+		return nil, err
+	}
+	data := raw.Input
+	if tx.IsPrivate {
+		payload, err := client.QuorumPayload(m.client, raw.Input)
+		if err != nil {
+			log.Debug("Unable to fetch private payload of pending transaction", "tx", raw.Hash.Hex(), "err", err)
+		}
+		data = payload
+	}
+	if contractABI == "" || len(data) < 8 {
+		return tx, nil
+	}
+
+	parsed := &types.ParsedTransaction{RawTransaction: &types.Transaction{Hash: raw.Hash, To: raw.To, Data: data}}
+	if err := parsed.ParseTransaction(contractABI); err != nil {
+		// calls the ABI doesn't describe are kept undecoded
+		log.Debug("Unable to decode pending transaction", "tx", raw.Hash.Hex(), "err", err)
+		return tx, nil
+	}
+	tx.Sig = parsed.Sig
+	tx.Func4Bytes = parsed.Func4Bytes
+	tx.ParsedData = parsed.ParsedData
+	return tx, nil
+}
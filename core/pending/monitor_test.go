@@ -0,0 +1,109 @@
+package pending
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+const tokenABI = `[{"inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"type":"function"}]`
+
+var (
+	token   = types.NewAddress("0x0000000000000000000000000000000000000010")
+	other   = types.NewAddress("0x0000000000000000000000000000000000000020")
+	alice   = types.NewAddress("0x0000000000000000000000000000000000000a11")
+	bob     = "0000000000000000000000000000000000000000000000000000000000000b0b"
+	ten     = "000000000000000000000000000000000000000000000000000000000000000a"
+	payload = types.NewHexData("0xab")
+
+	publicTx     = types.NewHash("0x01")
+	privateTx    = types.NewHash("0x02")
+	unregistered = types.NewHash("0x03")
+)
+
+func newTestMonitor(t *testing.T, maxTransactions int) (*Monitor, map[string]interface{}) {
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{token}))
+	assert.Nil(t, db.AddTemplate("token", tokenABI, ""))
+	assert.Nil(t, db.AssignTemplate(token, "token"))
+
+	mockRPC := map[string]interface{}{
+		"eth_newBlockFilter":              "0xb",
+		"eth_newPendingTransactionFilter": "0xp",
+		"eth_getFilterChanges0xb":         []types.Hash{},
+		"eth_getFilterChanges0xp":         []types.Hash{publicTx, privateTx, unregistered},
+		"eth_getTransactionByHash" + publicTx.String(): types.RawPendingTransaction{
+			Hash: publicTx, From: alice, To: token, Nonce: 1, Gas: 50000, Value: "0x0",
+			Input: types.NewHexData("a9059cbb" + bob + ten), V: 27,
+		},
+		"eth_getTransactionByHash" + privateTx.String(): types.RawPendingTransaction{
+			Hash: privateTx, From: alice, To: token, Nonce: 2, Value: "0x0", Input: payload, V: 37,
+		},
+		"eth_getTransactionByHash" + unregistered.String(): types.RawPendingTransaction{
+			Hash: unregistered, From: alice, To: other, Nonce: 3, Value: "0xde0b6b3a7640000",
+		},
+		"eth_getQuorumPayload" + payload.String(): types.NewHexData("a9059cbb" + bob + ten),
+	}
+	config := &types.PendingConfig{PollInterval: 1, Expiry: 60, MaxTransactions: maxTransactions}
+	return NewMonitor(db, client.NewStubQuorumClient(nil, mockRPC), config), mockRPC
+}
+
+func TestMonitor_Poll(t *testing.T) {
+	m, mockRPC := newTestMonitor(t, 10)
+	var notified []types.Hash
+	m.AddListener(func(tx *types.PendingTransaction) {
+		notified = append(notified, tx.Hash)
+	})
+
+	assert.Nil(t, m.Poll())
+	assert.Equal(t, []types.Hash{publicTx, privateTx}, notified)
+	pending := m.Pending("")
+	assert.Len(t, pending, 2)
+	assert.Equal(t, token, pending[0].To)
+	assert.EqualValues(t, 50000, pending[0].Gas)
+	assert.Equal(t, "0", pending[0].Value)
+	assert.False(t, pending[0].IsPrivate)
+	assert.Equal(t, types.HexData("a9059cbb"), pending[0].Func4Bytes)
+	assert.Equal(t, "transfer(address to,uint256 value)", pending[0].Sig)
+	assert.NotNil(t, pending[0].ParsedData["value"])
+	// private transactions are decoded from their payload
+	assert.True(t, pending[1].IsPrivate)
+	assert.Equal(t, pending[0].Sig, pending[1].Sig)
+	assert.NotZero(t, pending[1].SeenAt)
+	assert.Empty(t, m.Pending(other))
+
+	// the public transaction is mined
+	mockRPC["eth_getFilterChanges0xb"] = []types.Hash{types.NewHash("0xbb")}
+	mockRPC["eth_getBlockByHash0x00000000000000000000000000000000000000000000000000000000000000bb<bool Value>"] = types.RawBlock{Transactions: []types.Hash{publicTx}}
+	mockRPC["eth_getFilterChanges0xp"] = []types.Hash{}
+	assert.Nil(t, m.Poll())
+	pending = m.Pending(token)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, privateTx, pending[0].Hash)
+	assert.Len(t, notified, 2)
+}
+
+func TestMonitor_FilterRemoved(t *testing.T) {
+	m, mockRPC := newTestMonitor(t, 10)
+	delete(mockRPC, "eth_getFilterChanges0xp")
+	assert.EqualError(t, m.Poll(), "not found")
+	assert.Empty(t, m.Pending(""))
+
+	// the filter is installed again on the next poll
+	mockRPC["eth_newPendingTransactionFilter"] = "0xq"
+	mockRPC["eth_getFilterChanges0xq"] = []types.Hash{publicTx}
+	assert.Nil(t, m.Poll())
+	assert.Len(t, m.Pending(""), 1)
+}
+
+func TestMonitor_MaxTransactions(t *testing.T) {
+	m, _ := newTestMonitor(t, 1)
+	assert.Nil(t, m.Poll())
+	pending := m.Pending("")
+	assert.Len(t, pending, 1)
+	assert.Equal(t, privateTx, pending[0].Hash)
+}
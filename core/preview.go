@@ -0,0 +1,184 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"quorumengineering/quorum-report/core/fixtures"
+	"quorumengineering/quorum-report/core/rpc"
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// previewBlocks is the number of blocks of synthetic data generated to preview
+const previewBlocks = 10
+
+// mockSeed seeds the mock data, so the same history is served after a restart
+const mockSeed = 1
+
+// Preview serves the RPC API over synthetic data generated from the configured
+// templates, without connecting to a node, to show how contract data will
+// appear before indexing a real network.
+//
+// In mock mode the data resembles a live network instead, for frontend
+// development before the network exists: a history of varied blocks up to
+// now, with a new block generated every block period while running.
+type Preview struct {
+	rpc *rpc.RPCService
+	db  database.Database
+
+	mock      *fixtures.MockGenerator
+	addresses []types.Address
+	stop      chan struct{}
+	done      chan struct{}
+
+	backendErrorChan chan error
+}
+
+func NewPreview(config types.ReportingConfig) (*Preview, error) {
+	contracts, err := previewContracts(config)
+	if err != nil {
+		return nil, err
+	}
+	generated, err := fixtures.Generate(contracts, previewBlocks)
+	if err != nil {
+		return nil, err
+	}
+	db := memory.NewMemoryDB()
+	if err := fixtures.Load(db, contracts, generated); err != nil {
+		return nil, err
+	}
+	for _, contract := range contracts {
+		log.Info("Generated preview data", "template", contract.Template.TemplateName, "address", contract.Address.Hex(), "blocks", previewBlocks)
+	}
+	return newPreview(config, db), nil
+}
+
+// NewMock generates the given number of blocks of mock data, the last
+// produced now, to serve in mock mode.
+func NewMock(config types.ReportingConfig, historyBlocks uint64) (*Preview, error) {
+	contracts, err := previewContracts(config)
+	if err != nil {
+		return nil, err
+	}
+	generator, err := fixtures.NewMockGenerator(contracts, mockSeed)
+	if err != nil {
+		return nil, err
+	}
+	generated, err := generator.Next(historyBlocks, uint64(time.Now().Unix()))
+	if err != nil {
+		return nil, err
+	}
+	db := memory.NewMemoryDB()
+	if err := fixtures.Load(db, contracts, generated); err != nil {
+		return nil, err
+	}
+	for _, contract := range contracts {
+		log.Info("Generated mock data", "template", contract.Template.TemplateName, "address", contract.Address.Hex(), "blocks", historyBlocks)
+	}
+
+	p := newPreview(config, db)
+	p.mock = generator
+	for _, contract := range contracts {
+		p.addresses = append(p.addresses, contract.Address)
+	}
+	return p, nil
+}
+
+func newPreview(config types.ReportingConfig, db database.Database) *Preview {
+	backendErrorChan := make(chan error)
+	return &Preview{
+		rpc:              rpc.NewRPCService(db, config, rpc.Dependencies{}, backendErrorChan),
+		db:               db,
+		stop:             make(chan struct{}),
+		done:             make(chan struct{}),
+		backendErrorChan: backendErrorChan,
+	}
+}
+
+// previewContracts are the configured templates, deployed at their assigned
+// addresses
+func previewContracts(config types.ReportingConfig) ([]fixtures.Contract, error) {
+	templates := make(map[string]*types.Template, len(config.Templates))
+	for _, template := range config.Templates {
+		templates[template.TemplateName] = &types.Template{
+			TemplateName:  template.TemplateName,
+			ABI:           template.ABI,
+			StorageLayout: template.StorageLayout,
+		}
+	}
+
+	// configured contracts keep their address, and templates without one are
+	// deployed at a generated address
+	var contracts []fixtures.Contract
+	assigned := make(map[string]bool)
+	for _, address := range config.Addresses {
+		template, ok := templates[address.TemplateName]
+		if !ok {
+			continue
+		}
+		contracts = append(contracts, fixtures.Contract{Address: address.Address, Template: template})
+		assigned[address.TemplateName] = true
+	}
+	for i, template := range config.Templates {
+		if !assigned[template.TemplateName] {
+			address := types.NewAddress(fmt.Sprintf("%x", 0x1000+i))
+			contracts = append(contracts, fixtures.Contract{Address: address, Template: templates[template.TemplateName]})
+		}
+	}
+	if len(contracts) == 0 {
+		return nil, errors.New("no templates configured to preview")
+	}
+	return contracts, nil
+}
+
+func (p *Preview) GetBackendErrorChannel() chan error {
+	return p.backendErrorChan
+}
+
+func (p *Preview) Start() error {
+	if err := p.rpc.Start(); err != nil {
+		close(p.done)
+		return fmt.Errorf("start up failed: %v", err)
+	}
+	if p.mock == nil {
+		close(p.done)
+		return nil
+	}
+	go p.generateBlocks()
+	return nil
+}
+
+// generateBlocks adds a block of mock data every block period until stopped
+func (p *Preview) generateBlocks() {
+	defer close(p.done)
+	ticker := time.NewTicker(fixtures.BlockPeriod * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			generated, err := p.mock.Next(1, uint64(now.Unix()))
+			if err == nil {
+				err = fixtures.LoadBlocks(p.db, p.addresses, generated)
+			}
+			if err != nil {
+				log.Error("Generating mock block failed", "err", err)
+				continue
+			}
+			log.Debug("Generated mock block", "number", generated.Blocks[0].Number)
+		}
+	}
+}
+
+func (p *Preview) Stop() {
+	close(p.stop)
+	<-p.done
+	p.rpc.Stop()
+	p.db.Stop(context.Background())
+}
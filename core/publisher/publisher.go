@@ -0,0 +1,280 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/core/filter/token"
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// checkpointName is the checkpoint the last published block is stored
+	// under
+	checkpointName = "publisher"
+	// maxBatchBlocks is how many blocks are published together, so a backlog
+	// is sent in a few large writes
+	maxBatchBlocks = 100
+)
+
+// Publisher sends each newly persisted block to the sink, along with all of
+// its transactions, and the parsed events and token transfers of registered
+// contracts, so downstream systems can consume them without polling the
+// database.
+//
+// The data of a block is published before the block itself, so a consumer
+// that sees a block has seen everything in it. If publishing fails, the
+// blocks are tried again on the next poll, so messages may be repeated. The
+// last block published is stored in the database, and publishing carries on
+// from it after a restart; the first time the publisher starts, it starts
+// from the blocks persisted after then.
+type Publisher struct {
+	db       database.Database
+	sink     Sink
+	topics   *types.KafkaConfig
+	interval time.Duration
+
+	// the last block that was published
+	lastPublished uint64
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewPublisher(db database.Database, config *types.KafkaConfig) *Publisher {
+	return &Publisher{
+		db:           db,
+		sink:         NewKafkaSink(config.Brokers),
+		topics:       config,
+		interval:     time.Duration(config.PollInterval) * time.Second,
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (p *Publisher) Start() error {
+	log.Info("Starting Kafka publisher", "brokers", p.topics.Brokers)
+
+	lastPublished, err := p.loadCheckpoint()
+	if err != nil {
+		return err
+	}
+	p.lastPublished = lastPublished
+
+	p.shutdownWg.Add(1)
+	go func() {
+		defer p.shutdownWg.Done()
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.PublishNewBlocks(); err != nil {
+					log.Warn("Publishing new blocks failed", "err", err)
+				}
+			case <-p.shutdownChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (p *Publisher) Stop() {
+	close(p.shutdownChan)
+	p.shutdownWg.Wait()
+	if err := p.sink.Close(); err != nil {
+		log.Warn("Closing Kafka writers failed", "err", err)
+	}
+	log.Info("Kafka publisher stopped")
+}
+
+// loadCheckpoint returns the last block published before the publisher was
+// started, or the last persisted block if it has never run
+func (p *Publisher) loadCheckpoint() (uint64, error) {
+	checkpoint, err := p.db.GetCheckpoint(checkpointName)
+	if err == database.ErrNotFound {
+		lastPersisted, err := p.db.GetLastPersistedBlockNumber()
+		if err != nil {
+			return 0, err
+		}
+		return lastPersisted, p.setLastPublished(lastPersisted)
+	}
+	if err != nil {
+		return 0, err
+	}
+	lastPublished, err := strconv.ParseUint(checkpoint, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid publisher checkpoint %q: %v", checkpoint, err)
+	}
+	return lastPublished, nil
+}
+
+func (p *Publisher) setLastPublished(blockNumber uint64) error {
+	if err := p.db.SetCheckpoint(checkpointName, strconv.FormatUint(blockNumber, 10)); err != nil {
+		return err
+	}
+	p.lastPublished = blockNumber
+	return nil
+}
+
+// PublishNewBlocks publishes all blocks persisted since the last check.
+func (p *Publisher) PublishNewBlocks() error {
+	lastPersisted, err := p.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		return err
+	}
+	if p.lastPublished > lastPersisted {
+		// blocks were rolled back after a reorg, and will be published again
+		// once they are synced
+		if err := p.setLastPublished(lastPersisted); err != nil {
+			return err
+		}
+	}
+	if p.lastPublished == lastPersisted {
+		return nil
+	}
+
+	addresses, err := p.db.GetAddresses()
+	if err != nil {
+		return err
+	}
+	registered := make(map[types.Address]bool, len(addresses))
+	for _, address := range addresses {
+		registered[address] = true
+	}
+
+	for start := p.lastPublished + 1; start <= lastPersisted; start += maxBatchBlocks {
+		end := start + maxBatchBlocks - 1
+		if end > lastPersisted {
+			end = lastPersisted
+		}
+		if err := p.publishBlocks(start, end, registered); err != nil {
+			return err
+		}
+		if err := p.setLastPublished(end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messages are the messages of a batch of blocks, by topic
+type messages struct {
+	transactions []*Message
+	events       []*Message
+	transfers    []*Message
+	blocks       []*Message
+}
+
+// publishBlocks publishes the blocks from start to end (inclusive) together,
+// with their blocks last
+func (p *Publisher) publishBlocks(start uint64, end uint64, registered map[types.Address]bool) error {
+	batch := &messages{}
+	abis := make(map[types.Address]string)
+	for blockNumber := start; blockNumber <= end; blockNumber++ {
+		block, err := p.db.ReadBlock(blockNumber)
+		if err != nil {
+			return err
+		}
+		if err := p.addBlock(batch, block, registered, abis); err != nil {
+			return err
+		}
+	}
+
+	for _, publish := range []struct {
+		topic    string
+		messages []*Message
+	}{
+		{p.topics.TransactionsTopic, batch.transactions},
+		{p.topics.EventsTopic, batch.events},
+		{p.topics.TokenTransfersTopic, batch.transfers},
+		{p.topics.BlocksTopic, batch.blocks},
+	} {
+		if err := p.sink.Publish(publish.topic, publish.messages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addBlock adds the messages of a block to the batch
+func (p *Publisher) addBlock(batch *messages, block *types.Block, registered map[types.Address]bool, abis map[types.Address]string) error {
+	for _, txHash := range block.Transactions {
+		tx, err := p.db.ReadTransaction(txHash)
+		if err != nil {
+			return err
+		}
+		message, err := newMessage(tx.Hash.Hex(), tx)
+		if err != nil {
+			return err
+		}
+		batch.transactions = append(batch.transactions, message)
+
+		for _, event := range tx.Events {
+			if !registered[event.Address] {
+				continue
+			}
+			parsedEvent, err := p.parseEvent(event, block.Timestamp, abis)
+			if err != nil {
+				return err
+			}
+			// keyed by contract, so each contract's events stay in order
+			message, err := newMessage(event.Address.Hex(), parsedEvent)
+			if err != nil {
+				return err
+			}
+			batch.events = append(batch.events, message)
+
+			for _, transfer := range token.TokenTransfers(event) {
+				transfer.Timestamp = block.Timestamp
+				message, err := newMessage(transfer.Contract.Hex(), transfer)
+				if err != nil {
+					return err
+				}
+				batch.transfers = append(batch.transfers, message)
+			}
+		}
+	}
+
+	blockMessage, err := newMessage(strconv.FormatUint(block.Number, 10), block)
+	if err != nil {
+		return err
+	}
+	batch.blocks = append(batch.blocks, blockMessage)
+	return nil
+}
+
+// parseEvent decodes the event with its contract's ABI, if it has one
+func (p *Publisher) parseEvent(event *types.Event, timestamp uint64, abis map[types.Address]string) (*types.ParsedEvent, error) {
+	parsedEvent := &types.ParsedEvent{RawEvent: event}
+	parsedEvent.SetTimestamp(timestamp)
+	contractABI, ok := abis[event.Address]
+	if !ok {
+		var err error
+		if contractABI, err = p.db.GetContractABI(event.Address); err != nil {
+			return nil, err
+		}
+		abis[event.Address] = contractABI
+	}
+	if contractABI != "" {
+		if err := parsedEvent.ParseEvent(contractABI); err != nil {
+			// an event the ABI doesn't describe is still published undecoded
+			log.Debug("Unable to parse event", "address", event.Address.Hex(), "tx", event.TransactionHash.Hex(), "err", err)
+		}
+	}
+	return parsedEvent, nil
+}
+
+func newMessage(key string, value interface{}) (*Message, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Key: []byte(key), Value: encoded}, nil
+}
@@ -0,0 +1,135 @@
+package publisher
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+var (
+	tokenAddress = types.NewAddress("0x0000000000000000000000000000000000000001")
+	otherAddress = types.NewAddress("0x0000000000000000000000000000000000000002")
+	topics       = &types.KafkaConfig{
+		BlocksTopic:         "blocks",
+		TransactionsTopic:   "transactions",
+		EventsTopic:         "events",
+		TokenTransfersTopic: "transfers",
+	}
+)
+
+type fakeSink struct {
+	published map[string][]*Message
+	writes    map[string]int
+	err       error
+}
+
+func (s *fakeSink) Publish(topic string, messages []*Message) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.writes != nil {
+		s.writes[topic]++
+	}
+	s.published[topic] = append(s.published[topic], messages...)
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	return nil
+}
+
+func TestPublisher_PublishNewBlocks(t *testing.T) {
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{tokenAddress}))
+
+	transfer := &types.Event{
+		Address: tokenAddress,
+		Topics: []types.Hash{
+			types.NewHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"),
+			types.NewHash("0x000000000000000000000000000000000000000000000000000000000000000a"),
+			types.NewHash("0x000000000000000000000000000000000000000000000000000000000000000b"),
+		},
+		Data:        types.NewHexData("0x0000000000000000000000000000000000000000000000000000000000000064"),
+		BlockNumber: 1,
+	}
+	unregistered := &types.Event{Address: otherAddress, Topics: transfer.Topics, Data: transfer.Data, BlockNumber: 1}
+	tx := &types.Transaction{
+		Hash:        types.NewHash("0x1a6f4292bac138df9a7854a07c93fd14ca7de53265e8fe01b6c986f97d6c1ee7"),
+		BlockNumber: 1,
+		Events:      []*types.Event{transfer, unregistered},
+	}
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{{Number: 1, Timestamp: 1000, Transactions: []types.Hash{tx.Hash}}}))
+
+	sink := &fakeSink{published: make(map[string][]*Message), err: errors.New("unavailable")}
+	publisher := &Publisher{db: db, sink: sink, topics: topics}
+
+	// failed blocks are published on the next attempt
+	assert.EqualError(t, publisher.PublishNewBlocks(), "unavailable")
+	assert.Equal(t, uint64(0), publisher.lastPublished)
+	sink.err = nil
+	assert.Nil(t, publisher.PublishNewBlocks())
+	assert.Equal(t, uint64(1), publisher.lastPublished)
+
+	assert.Len(t, sink.published["blocks"], 1)
+	assert.Equal(t, "1", string(sink.published["blocks"][0].Key))
+	assert.Len(t, sink.published["transactions"], 1)
+	assert.Equal(t, tx.Hash.Hex(), string(sink.published["transactions"][0].Key))
+
+	// only the events of registered contracts
+	assert.Len(t, sink.published["events"], 1)
+	var event types.ParsedEvent
+	assert.Nil(t, json.Unmarshal(sink.published["events"][0].Value, &event))
+	assert.Equal(t, tokenAddress, event.RawEvent.Address)
+	assert.Equal(t, uint64(1000), event.Timestamp)
+
+	assert.Len(t, sink.published["transfers"], 1)
+	assert.Equal(t, tokenAddress.Hex(), string(sink.published["transfers"][0].Key))
+	var published types.TokenTransfer
+	assert.Nil(t, json.Unmarshal(sink.published["transfers"][0].Value, &published))
+	assert.Equal(t, types.ERC20Standard, published.Standard)
+	assert.Equal(t, types.NewAddress("0x000000000000000000000000000000000000000b"), published.To)
+	assert.Equal(t, "100", published.Amount.String())
+
+	// nothing new
+	assert.Nil(t, publisher.PublishNewBlocks())
+	assert.Len(t, sink.published["blocks"], 1)
+}
+
+func TestPublisher_Checkpoint(t *testing.T) {
+	db := memory.NewMemoryDB()
+	writeBlocks := func(from, to uint64) {
+		for number := from; number <= to; number++ {
+			assert.Nil(t, db.WriteBlocks([]*types.Block{{Number: number, Timestamp: 1000 + number}}))
+		}
+	}
+	writeBlocks(1, 2)
+
+	// the first time, publishing starts after the blocks already persisted
+	sink := &fakeSink{published: make(map[string][]*Message), writes: make(map[string]int)}
+	publisher := &Publisher{db: db, sink: sink, topics: topics}
+	lastPublished, err := publisher.loadCheckpoint()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, lastPublished)
+
+	// blocks persisted while the publisher isn't running are published once
+	// it starts again, all in one write
+	writeBlocks(3, 5)
+	publisher = &Publisher{db: db, sink: sink, topics: topics}
+	publisher.lastPublished, err = publisher.loadCheckpoint()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, publisher.lastPublished)
+	assert.Nil(t, publisher.PublishNewBlocks())
+	assert.Len(t, sink.published["blocks"], 3)
+	assert.Equal(t, "3", string(sink.published["blocks"][0].Key))
+	assert.Equal(t, 1, sink.writes["blocks"])
+
+	checkpoint, err := db.GetCheckpoint(checkpointName)
+	assert.Nil(t, err)
+	assert.Equal(t, "5", checkpoint)
+}
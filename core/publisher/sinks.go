@@ -0,0 +1,84 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// each publish is written synchronously, so a batch that doesn't fill up
+	// is sent after a short wait, rather than the writer's default of a
+	// second
+	writerBatchTimeout = 10 * time.Millisecond
+	writerBatchSize    = 1000
+)
+
+// Message is a JSON payload, and the key that decides its partition.
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// Sink delivers messages to the topics downstream systems consume from.
+type Sink interface {
+	Publish(topic string, messages []*Message) error
+	Close() error
+}
+
+// KafkaSink writes messages to Kafka topics, with messages of the same key
+// going to the same partition.
+type KafkaSink struct {
+	brokers []string
+	writers map[string]*kafka.Writer
+	mux     sync.Mutex
+}
+
+func NewKafkaSink(brokers []string) *KafkaSink {
+	return &KafkaSink{brokers: brokers, writers: make(map[string]*kafka.Writer)}
+}
+
+func (s *KafkaSink) Publish(topic string, messages []*Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	kafkaMessages := make([]kafka.Message, len(messages))
+	for i, message := range messages {
+		kafkaMessages[i] = kafka.Message{Key: message.Key, Value: message.Value}
+	}
+	return s.writer(topic).WriteMessages(context.Background(), kafkaMessages...)
+}
+
+func (s *KafkaSink) writer(topic string) *kafka.Writer {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if writer, ok := s.writers[topic]; ok {
+		return writer
+	}
+	writer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:  s.brokers,
+		Topic:    topic,
+		Balancer: &kafka.Hash{},
+		// the messages of a publish are sent in batches of up to
+		// writerBatchSize per partition
+		BatchSize:    writerBatchSize,
+		BatchTimeout: writerBatchTimeout,
+	})
+	s.writers[topic] = writer
+	return writer
+}
+
+func (s *KafkaSink) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var firstErr error
+	for topic, writer := range s.writers {
+		if err := writer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.writers, topic)
+	}
+	return firstErr
+}
@@ -0,0 +1,170 @@
+package retention
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+type RetentionDB interface {
+	database.RetentionDB
+	database.StatsDB
+	ReadBlock(uint64) (*types.Block, error)
+	GetLastPersistedBlockNumber() (uint64, error)
+}
+
+// Janitor periodically applies the retention policies, deleting the documents
+// of each index recorded before the first block that is younger than the
+// index's maximum age. It keeps totals of what it has deleted, and an
+// estimate of the space reclaimed, to be reported as metrics. If applying a
+// policy fails, it is tried again at the next check.
+type Janitor struct {
+	db       RetentionDB
+	policies []types.RetentionPolicy
+	interval time.Duration
+
+	stats *types.RetentionStats
+	mux   sync.Mutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewJanitor(db RetentionDB, config *types.RetentionConfig) *Janitor {
+	stats := &types.RetentionStats{Indices: make(map[string]*types.IndexRetention, len(config.Policies))}
+	for _, policy := range config.Policies {
+		stats.Indices[policy.Index] = &types.IndexRetention{MaxAgeDays: policy.MaxAgeDays}
+	}
+	return &Janitor{
+		db:           db,
+		policies:     config.Policies,
+		interval:     time.Duration(config.Interval) * time.Second,
+		stats:        stats,
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (j *Janitor) Start() error {
+	log.Info("Starting retention janitor", "policies", len(j.policies), "interval", j.interval)
+
+	j.shutdownWg.Add(1)
+	go func() {
+		defer j.shutdownWg.Done()
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			j.apply(time.Now())
+			select {
+			case <-ticker.C:
+			case <-j.shutdownChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (j *Janitor) Stop() {
+	close(j.shutdownChan)
+	j.shutdownWg.Wait()
+	log.Info("Retention janitor stopped")
+}
+
+// Stats returns a copy of the totals of what has been deleted
+func (j *Janitor) Stats() *types.RetentionStats {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	stats := &types.RetentionStats{Runs: j.stats.Runs, Failures: j.stats.Failures, Indices: make(map[string]*types.IndexRetention, len(j.stats.Indices))}
+	for index, retention := range j.stats.Indices {
+		copied := *retention
+		stats.Indices[index] = &copied
+	}
+	return stats
+}
+
+// apply applies each policy as of the given time, until shut down
+func (j *Janitor) apply(now time.Time) {
+	j.mux.Lock()
+	j.stats.Runs++
+	j.mux.Unlock()
+
+	// the average size of the documents is taken before deleting any
+	indexStats, err := j.db.GetIndexStats()
+	if err != nil {
+		log.Warn("Reading index stats failed", "err", err)
+		j.fail()
+		return
+	}
+	documentSizes := make(map[string]uint64, len(indexStats))
+	for _, stats := range indexStats {
+		if stats.DocumentCount > 0 {
+			documentSizes[stats.Name] = stats.StorageSize / stats.DocumentCount
+		}
+	}
+
+	for _, policy := range j.policies {
+		select {
+		case <-j.shutdownChan:
+			return
+		default:
+		}
+		beforeBlock, err := j.firstBlockAfter(now.Add(-time.Duration(policy.MaxAgeDays) * 24 * time.Hour))
+		if err != nil {
+			log.Warn("Finding retained blocks failed", "index", policy.Index, "err", err)
+			j.fail()
+			continue
+		}
+		deletion, err := j.db.ApplyRetention(policy.Index, beforeBlock)
+		if err != nil {
+			log.Warn("Applying retention failed", "index", policy.Index, "err", err)
+			j.fail()
+			continue
+		}
+
+		j.mux.Lock()
+		retention := j.stats.Indices[policy.Index]
+		retention.BeforeBlock = deletion.BeforeBlock
+		retention.Deleted += deletion.Deleted
+		retention.ReclaimedBytes += deletion.Deleted * documentSizes[policy.Index]
+		retention.LastApplied = uint64(now.Unix())
+		j.mux.Unlock()
+	}
+}
+
+func (j *Janitor) fail() {
+	j.mux.Lock()
+	j.stats.Failures++
+	j.mux.Unlock()
+}
+
+// firstBlockAfter returns the first persisted block from after the given
+// time, or the block after the last persisted one if they are all older.
+// Block times only go up, so it is searched for.
+func (j *Janitor) firstBlockAfter(cutoff time.Time) (uint64, error) {
+	lastPersisted, err := j.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		return 0, err
+	}
+	// the genesis block is never stored
+	var searchErr error
+	offset := sort.Search(int(lastPersisted), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		block, err := j.db.ReadBlock(uint64(i) + 1)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return time.Unix(int64(block.Timestamp), 0).After(cutoff)
+	})
+	if searchErr != nil {
+		return 0, searchErr
+	}
+	return uint64(offset) + 1, nil
+}
@@ -0,0 +1,91 @@
+package retention
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+type fakeDB struct {
+	*memory.MemoryDB
+	applied []*types.RetentionDeletion
+	err     error
+}
+
+func (f *fakeDB) ApplyRetention(index string, beforeBlock uint64) (*types.RetentionDeletion, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	deletion := &types.RetentionDeletion{Index: index, BeforeBlock: beforeBlock, Deleted: beforeBlock - 1}
+	f.applied = append(f.applied, deletion)
+	return deletion, nil
+}
+
+func (f *fakeDB) GetIndexStats() ([]types.IndexStats, error) {
+	return []types.IndexStats{
+		{Name: "event", DocumentCount: 10, StorageSize: 1000},
+		{Name: "storage", DocumentCount: 0},
+	}, nil
+}
+
+func day(n int) time.Time {
+	return time.Date(2020, time.September, n, 12, 0, 0, 0, time.UTC)
+}
+
+func newFakeDB(t *testing.T) *fakeDB {
+	db := &fakeDB{MemoryDB: memory.NewMemoryDB()}
+	// a block a day, from the 1st
+	for number := uint64(1); number <= 5; number++ {
+		assert.Nil(t, db.WriteBlocks([]*types.Block{{Number: number, Timestamp: uint64(day(int(number)).Unix())}}))
+	}
+	return db
+}
+
+func TestApply(t *testing.T) {
+	db := newFakeDB(t)
+	j := NewJanitor(db, &types.RetentionConfig{Policies: []types.RetentionPolicy{
+		{Index: "event", MaxAgeDays: 2},
+		{Index: "storage", MaxAgeDays: 30},
+	}})
+
+	// the blocks from the 3rd and before are more than 2 days old
+	j.apply(day(5).Add(time.Hour))
+	assert.Equal(t, []*types.RetentionDeletion{
+		{Index: "event", BeforeBlock: 4, Deleted: 3},
+		{Index: "storage", BeforeBlock: 1, Deleted: 0},
+	}, db.applied)
+
+	stats := j.Stats()
+	assert.EqualValues(t, 1, stats.Runs)
+	assert.EqualValues(t, 0, stats.Failures)
+	assert.Equal(t, &types.IndexRetention{
+		MaxAgeDays:     2,
+		BeforeBlock:    4,
+		Deleted:        3,
+		ReclaimedBytes: 300,
+		LastApplied:    uint64(day(5).Add(time.Hour).Unix()),
+	}, stats.Indices["event"])
+	assert.EqualValues(t, 0, stats.Indices["storage"].ReclaimedBytes)
+
+	// once every block is old enough, all of them are covered
+	j.apply(day(20))
+	assert.EqualValues(t, 6, db.applied[2].BeforeBlock)
+	assert.EqualValues(t, 3+5, j.Stats().Indices["event"].Deleted)
+}
+
+func TestApply_Failure(t *testing.T) {
+	db := newFakeDB(t)
+	db.err = errors.New("cluster unavailable")
+	j := NewJanitor(db, &types.RetentionConfig{Policies: []types.RetentionPolicy{{Index: "event", MaxAgeDays: 2}}})
+
+	j.apply(day(5))
+	stats := j.Stats()
+	assert.EqualValues(t, 1, stats.Runs)
+	assert.EqualValues(t, 1, stats.Failures)
+	assert.EqualValues(t, 0, stats.Indices["event"].LastApplied)
+}
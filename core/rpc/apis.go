@@ -1,21 +1,87 @@
 package rpc
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"math/big"
 	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
 	"quorumengineering/quorum-report/core/storageparsing"
 	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/database/scoped"
+	"quorumengineering/quorum-report/log"
 	"quorumengineering/quorum-report/types"
 )
 
 type RPCAPIs struct {
 	db                      database.Database
 	contractTemplateManager ContractTemplateManager
+	// the contracts the API key is restricted to, which db is limited to;
+	// nil if the key isn't restricted
+	scope     *scoped.Database
+	snapshots *SnapshotManager
+	// nil if anomaly detection is not enabled
+	anomalies AnomalyReporter
+	backfills Backfiller
+	// nil if no export directory is configured
+	exports   Exporter
+	integrity IntegrityVerifier
+	// nil in preview mode, where no storage is ingested
+	inference LayoutInferrer
+	// nil in preview mode, where no contracts are filtered
+	matcher TemplateMatcher
+	// nil in preview mode, where nothing is ingested
+	ingestion IngestionController
+	// nil until the websocket subscriptions are started
+	subscriptions SubscriptionReporter
+	// nil if no naming registry is configured
+	names NameDirectory
+	// nil if pending transactions aren't monitored
+	pending PendingMonitor
+	// nil if address screening is not enabled
+	screening AddressScreener
+	// nil in preview mode, where no contracts are created
+	rules RuleReloader
+	// nil unless in high availability mode
+	leadership Leadership
+	// nil in preview mode, where no webhooks are sent
+	webhooks WebhookNotifier
+	// set with the headers profile, which doesn't index contracts
+	headersOnly bool
+	// configured templates that map CSV export columns, keyed by name
+	csvTemplates map[string]*types.TemplateConfig
+	// configured contract groups, whose events can be replayed together
+	contractGroups []*types.ContractGroupConfig
+	// nil if queries aren't guarded
+	queryGuard *types.QueryGuardConfig
 }
 
 func NewRPCAPIs(db database.Database, contractTemplateManager ContractTemplateManager) *RPCAPIs {
-	return &RPCAPIs{db, contractTemplateManager}
+	return &RPCAPIs{db: db, contractTemplateManager: contractTemplateManager, snapshots: NewSnapshotManager(db)}
+}
+
+func (r *RPCAPIs) OpenSnapshot(req *http.Request, args *SnapshotArgs, reply *SnapshotResp) error {
+	id, blockNumber, expiresAt, err := r.snapshots.Open(time.Duration(args.TTL) * time.Second)
+	if err != nil {
+		return err
+	}
+	*reply = SnapshotResp{
+		Id:          id,
+		BlockNumber: blockNumber,
+		ExpiresAt:   expiresAt.Unix(),
+	}
+	return nil
+}
+
+func (r *RPCAPIs) CloseSnapshot(req *http.Request, id *string, reply *NullArgs) error {
+	return r.snapshots.Close(*id)
 }
 
 func (r *RPCAPIs) GetLastPersistedBlockNumber(req *http.Request, args *NullArgs, reply *uint64) error {
@@ -36,6 +102,122 @@ func (r *RPCAPIs) GetLastFiltered(req *http.Request, args *types.Address, reply
 	return nil
 }
 
+func (r *RPCAPIs) GetIndexStats(req *http.Request, args *NullArgs, reply *[]types.IndexStats) error {
+	stats, err := r.db.GetIndexStats()
+	if err != nil {
+		return err
+	}
+	*reply = stats
+	return nil
+}
+
+func (r *RPCAPIs) GetAnomalies(req *http.Request, args *NullArgs, reply *[]*types.Anomaly) error {
+	if r.anomalies == nil {
+		return ErrAnomalyDetectionNotEnabled
+	}
+	anomalies := r.anomalies.Anomalies()
+	if r.scope != nil {
+		inScope := make([]*types.Anomaly, 0, len(anomalies))
+		for _, anomaly := range anomalies {
+			if r.scope.Contains(anomaly.Address) {
+				inScope = append(inScope, anomaly)
+			}
+		}
+		anomalies = inScope
+	}
+	*reply = anomalies
+	return nil
+}
+
+// GetSubscriptionStats reports the connected websocket subscribers, their
+// subscriptions and how far behind they are
+func (r *RPCAPIs) GetSubscriptionStats(req *http.Request, args *NullArgs, reply *types.SubscriptionStats) error {
+	if r.subscriptions == nil {
+		return ErrSubscriptionsNotRunning
+	}
+	*reply = *r.subscriptions.Stats()
+	return nil
+}
+
+// GetHighAvailabilityStatus reports whether the instance is the leader, which
+// writes to the database, or a standby, and which instance holds the lease
+func (r *RPCAPIs) GetHighAvailabilityStatus(req *http.Request, args *NullArgs, reply *types.HighAvailabilityStatus) error {
+	if r.leadership == nil {
+		return ErrHighAvailabilityNotEnabled
+	}
+	*reply = *r.leadership.Status()
+	return nil
+}
+
+// ResolveName returns the address a name in the naming registry is set to
+func (r *RPCAPIs) ResolveName(req *http.Request, name *string, reply *types.Address) error {
+	if r.names == nil {
+		return ErrNamingNotEnabled
+	}
+	address, ok := r.names.Resolve(*name)
+	if !ok {
+		return ErrNameNotFound
+	}
+	*reply = address
+	return nil
+}
+
+// GetNames returns the names in the naming registry set to an address
+func (r *RPCAPIs) GetNames(req *http.Request, address *types.Address, reply *[]string) error {
+	if r.names == nil {
+		return ErrNamingNotEnabled
+	}
+	*reply = r.names.Names(*address)
+	return nil
+}
+
+func (r *RPCAPIs) GetRegisteredNames(req *http.Request, args *NullArgs, reply *[]*types.RegisteredName) error {
+	if r.names == nil {
+		return ErrNamingNotEnabled
+	}
+	*reply = r.names.All()
+	return nil
+}
+
+// ScreenAddresses checks the addresses against the screening lists, returning
+// a match for each list an address is on
+func (r *RPCAPIs) ScreenAddresses(req *http.Request, args *ScreenAddressesArgs, reply *[]*types.ScreeningMatch) error {
+	if r.screening == nil {
+		return ErrScreeningNotEnabled
+	}
+	matches, err := r.screening.Screen(args.Addresses)
+	if err != nil {
+		return err
+	}
+	if matches == nil {
+		matches = []*types.ScreeningMatch{}
+	}
+	*reply = matches
+	return nil
+}
+
+// Search finds what a term identifies: the block with a number or hash, the
+// transaction with a hash and its indexed events, or the registered contract
+// with an address or name
+func (r *RPCAPIs) Search(req *http.Request, args *SearchArgs, reply *[]*types.SearchResult) error {
+	if args.Limit < 0 || args.Limit > MaxSearchResults {
+		return ErrInvalidSearchLimit
+	}
+	if args.Limit == 0 {
+		args.Limit = DefaultSearchResults
+	}
+	query, err := r.searchQuery(args.Term)
+	if err != nil {
+		return err
+	}
+	results, err := r.db.Search(query, args.Limit)
+	if err != nil {
+		return err
+	}
+	*reply = results
+	return nil
+}
+
 func (r *RPCAPIs) GetBlock(req *http.Request, blockNumber *uint64, reply *types.Block) error {
 	block, err := r.db.ReadBlock(*blockNumber)
 	if err != nil {
@@ -53,38 +235,204 @@ func (r *RPCAPIs) GetTransaction(req *http.Request, hash *types.Hash, reply *typ
 	if err != nil {
 		return err
 	}
+	parsedTx, err := r.parseTransaction(tx, newBlockTimestamps(r.db))
+	if err != nil {
+		return err
+	}
+	*reply = *parsedTx
+	return nil
+}
+
+// GetTransactionCallTree returns the internal calls made by a transaction,
+// each with the calls it made nested under it, to follow flows across
+// contracts.
+func (r *RPCAPIs) GetTransactionCallTree(req *http.Request, hash *types.Hash, reply *types.CallTree) error {
+	if hash.IsEmpty() {
+		return errors.New("no transaction hash given")
+	}
+	tree, err := r.db.GetTransactionCallTree(*hash)
+	if err == nil {
+		*reply = *tree
+		return nil
+	}
+	if err != database.ErrNotFound {
+		return err
+	}
+
+	// transactions without internal calls have no stored tree
+	tx, err := r.db.ReadTransaction(*hash)
+	if err != nil {
+		return err
+	}
+	if len(tx.InternalCalls) > 0 {
+		return errors.New("no call tree stored, as the transaction was indexed before call trees were")
+	}
+	*reply = types.CallTree{TransactionHash: tx.Hash, BlockNumber: tx.BlockNumber, Calls: []*types.CallFrame{}}
+	return nil
+}
+
+// parseTransaction decodes the transaction and its events with the ABIs of
+// the contracts they were sent to and emitted by.
+func (r *RPCAPIs) parseTransaction(tx *types.Transaction, timestamps *blockTimestamps) (*types.ParsedTransaction, error) {
 	address := tx.To
 	if address.IsEmpty() {
 		address = tx.CreatedContract
 	}
 	contractABI, err := r.db.GetContractABI(address)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	parsedTx := &types.ParsedTransaction{
 		RawTransaction: tx,
 	}
 	if contractABI != "" {
 		if err = parsedTx.ParseTransaction(contractABI); err != nil {
-			return err
+			return nil, err
 		}
 	}
+	timestamp := timestamps.lookup(tx.BlockNumber, tx.Timestamp)
+	parsedTx.SetTimestamp(timestamp)
 	parsedTx.ParsedEvents = make([]*types.ParsedEvent, len(parsedTx.RawTransaction.Events))
 	for i, e := range parsedTx.RawTransaction.Events {
 		parsedTx.ParsedEvents[i] = &types.ParsedEvent{
 			RawEvent: e,
 		}
+		parsedTx.ParsedEvents[i].SetTimestamp(timestamp)
 		contractABI, err := r.db.GetContractABI(e.Address)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if contractABI != "" {
 			if err := parsedTx.ParsedEvents[i].ParseEvent(contractABI); err != nil {
-				return err
+				return nil, err
 			}
 		}
 	}
-	*reply = *parsedTx
+	return parsedTx, nil
+}
+
+func (r *RPCAPIs) GetBlockForTransaction(req *http.Request, hash *types.Hash, reply *BlockSummary) error {
+	if hash.IsEmpty() {
+		return errors.New("no transaction hash given")
+	}
+	tx, err := r.db.ReadTransaction(*hash)
+	if err != nil {
+		return err
+	}
+	block, err := r.db.ReadBlock(tx.BlockNumber)
+	if err != nil {
+		return err
+	}
+	*reply = newBlockSummary(block)
+	return nil
+}
+
+// GetBlocksByTimeRange lists summaries of the blocks with a timestamp in the
+// inclusive range, oldest first, to find the blocks of a period of time such
+// as a business date.
+func (r *RPCAPIs) GetBlocksByTimeRange(req *http.Request, args *TimeRangeWithOptions, reply *BlockSummariesResp) error {
+	if args.To < args.From {
+		return errors.New("end timestamp is before start timestamp")
+	}
+	if args.Options == nil {
+		args.Options = &types.PageOptions{}
+	}
+	args.Options.SetDefaults()
+
+	total, err := r.db.GetBlocksByTimeRangeTotal(args.From, args.To)
+	if err != nil {
+		return err
+	}
+	blocks, err := r.db.GetBlocksByTimeRange(args.From, args.To, args.Options)
+	if err != nil {
+		return err
+	}
+	summaries := make([]BlockSummary, len(blocks))
+	for i, block := range blocks {
+		summaries[i] = newBlockSummary(block)
+	}
+	*reply = BlockSummariesResp{
+		Blocks:  summaries,
+		Total:   total,
+		Options: args.Options,
+	}
+	return nil
+}
+
+func newBlockSummary(block *types.Block) BlockSummary {
+	return BlockSummary{
+		Number:           block.Number,
+		Hash:             block.Hash,
+		ParentHash:       block.ParentHash,
+		Timestamp:        block.Timestamp,
+		TimestampISO:     types.FormatTimestamp(block.Timestamp),
+		TransactionCount: len(block.Transactions),
+	}
+}
+
+func (r *RPCAPIs) GetTransactionsForBlockRange(req *http.Request, args *BlockRangeWithOptions, reply *TransactionSummariesResp) error {
+	if args.To < args.From {
+		return errors.New("end block is before start block")
+	}
+	if args.Options == nil {
+		args.Options = &types.PageOptions{}
+	}
+	args.Options.SetDefaults()
+
+	// blocks after the last persisted block may not have been stored yet
+	lastPersisted, err := r.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		return err
+	}
+	to := args.To
+	if to > lastPersisted {
+		to = lastPersisted
+	}
+
+	summaries := make([]TransactionSummary, 0, args.Options.PageSize)
+	var total uint64
+	if args.From <= to {
+		if total, err = r.db.GetTransactionsInBlockRangeTotal(args.From, to); err != nil {
+			return err
+		}
+		txs, err := r.db.GetTransactionsInBlockRange(args.From, to, args.Options)
+		if err != nil {
+			return err
+		}
+		timestamps := newBlockTimestamps(r.db)
+		for _, tx := range txs {
+			timestamp := timestamps.lookup(tx.BlockNumber, tx.Timestamp)
+			summaries = append(summaries, TransactionSummary{
+				Hash:            tx.Hash,
+				BlockNumber:     tx.BlockNumber,
+				Index:           tx.Index,
+				From:            tx.From,
+				To:              tx.To,
+				CreatedContract: tx.CreatedContract,
+				Status:          tx.Status,
+				Timestamp:       timestamp,
+				TimestampISO:    types.FormatTimestamp(timestamp),
+			})
+		}
+	}
+
+	hashes := make([]types.Hash, len(summaries))
+	for i, summary := range summaries {
+		hashes[i] = summary.Hash
+	}
+	events, err := r.transactionEvents(hashes, &args.IncludeEventsArgs)
+	if err != nil {
+		return err
+	}
+	for i := range summaries {
+		summaries[i].Events = events[summaries[i].Hash]
+	}
+
+	*reply = TransactionSummariesResp{
+		Transactions: summaries,
+		Total:        total,
+		Options:      args.Options,
+	}
 	return nil
 }
 
@@ -100,7 +448,26 @@ func (r *RPCAPIs) GetContractCreationTransaction(req *http.Request, address *typ
 	return nil
 }
 
-func (r *RPCAPIs) GetAllTransactionsToAddress(req *http.Request, args *AddressWithOptions, reply *TransactionsResp) error {
+// GetContractStatus returns whether the contract is active or has
+// self-destructed, and the transaction that created it
+func (r *RPCAPIs) GetContractStatus(req *http.Request, address *types.Address, reply *types.ContractStatus) error {
+	creationTx, err := r.db.GetContractCreationTransaction(*address)
+	if err != nil {
+		return err
+	}
+	destroyedAt, err := r.db.GetContractDestroyed(*address)
+	if err != nil {
+		return err
+	}
+	status := types.ContractActive
+	if destroyedAt > 0 {
+		status = types.ContractDestroyed
+	}
+	*reply = types.ContractStatus{Address: *address, Status: status, CreationTransaction: creationTx, DestroyedAt: destroyedAt}
+	return nil
+}
+
+func (r *RPCAPIs) GetAllTransactionsToAddress(req *http.Request, args *TransactionsArgs, reply *TransactionsResp) error {
 	if args.Address == nil {
 		return ErrNoAddress
 	}
@@ -108,6 +475,11 @@ func (r *RPCAPIs) GetAllTransactionsToAddress(req *http.Request, args *AddressWi
 		args.Options = &types.QueryOptions{}
 	}
 	args.Options.SetDefaults()
+	endBlockNumber, err := r.snapshots.EndBlockNumber(args.Options.SnapshotId, *args.Address, args.Options.EndBlockNumber)
+	if err != nil {
+		return err
+	}
+	args.Options.EndBlockNumber = endBlockNumber
 
 	total, err := r.db.GetTransactionsToAddressTotal(*args.Address, args.Options)
 	if err != nil {
@@ -117,16 +489,26 @@ func (r *RPCAPIs) GetAllTransactionsToAddress(req *http.Request, args *AddressWi
 	if err != nil {
 		return err
 	}
+	events, err := r.transactionEvents(txs, &args.IncludeEventsArgs)
+	if err != nil {
+		return err
+	}
+	cursor, err := r.transactionsCursor(txs, args.Options)
+	if err != nil {
+		return err
+	}
 
 	*reply = TransactionsResp{
 		Transactions: txs,
 		Total:        total,
 		Options:      args.Options,
+		Events:       eventsByHex(events),
+		NextCursor:   cursor,
 	}
 	return nil
 }
 
-func (r *RPCAPIs) GetAllTransactionsInternalToAddress(req *http.Request, args *AddressWithOptions, reply *TransactionsResp) error {
+func (r *RPCAPIs) GetAllTransactionsInternalToAddress(req *http.Request, args *TransactionsArgs, reply *TransactionsResp) error {
 	if args.Address == nil {
 		return ErrNoAddress
 	}
@@ -134,6 +516,11 @@ func (r *RPCAPIs) GetAllTransactionsInternalToAddress(req *http.Request, args *A
 		args.Options = &types.QueryOptions{}
 	}
 	args.Options.SetDefaults()
+	endBlockNumber, err := r.snapshots.EndBlockNumber(args.Options.SnapshotId, *args.Address, args.Options.EndBlockNumber)
+	if err != nil {
+		return err
+	}
+	args.Options.EndBlockNumber = endBlockNumber
 
 	total, err := r.db.GetTransactionsInternalToAddressTotal(*args.Address, args.Options)
 	if err != nil {
@@ -143,11 +530,21 @@ func (r *RPCAPIs) GetAllTransactionsInternalToAddress(req *http.Request, args *A
 	if err != nil {
 		return err
 	}
+	events, err := r.transactionEvents(txs, &args.IncludeEventsArgs)
+	if err != nil {
+		return err
+	}
+	cursor, err := r.transactionsCursor(txs, args.Options)
+	if err != nil {
+		return err
+	}
 
 	*reply = TransactionsResp{
 		Transactions: txs,
 		Total:        total,
 		Options:      args.Options,
+		Events:       eventsByHex(events),
+		NextCursor:   cursor,
 	}
 	return nil
 }
@@ -160,6 +557,11 @@ func (r *RPCAPIs) GetAllEventsFromAddress(req *http.Request, args *AddressWithOp
 		args.Options = &types.QueryOptions{}
 	}
 	args.Options.SetDefaults()
+	endBlockNumber, err := r.snapshots.EndBlockNumber(args.Options.SnapshotId, *args.Address, args.Options.EndBlockNumber)
+	if err != nil {
+		return err
+	}
+	args.Options.EndBlockNumber = endBlockNumber
 
 	total, err := r.db.GetEventsFromAddressTotal(*args.Address, args.Options)
 	if err != nil {
@@ -173,11 +575,13 @@ func (r *RPCAPIs) GetAllEventsFromAddress(req *http.Request, args *AddressWithOp
 	if err != nil {
 		return err
 	}
+	timestamps := newBlockTimestamps(r.db)
 	parsedEvents := make([]*types.ParsedEvent, len(events))
 	for i, e := range events {
 		parsedEvents[i] = &types.ParsedEvent{
 			RawEvent: e,
 		}
+		parsedEvents[i].SetTimestamp(timestamps.lookup(e.BlockNumber, e.Timestamp))
 		if contractABI != "" {
 			if err = parsedEvents[i].ParseEvent(contractABI); err != nil {
 				return err
@@ -186,104 +590,395 @@ func (r *RPCAPIs) GetAllEventsFromAddress(req *http.Request, args *AddressWithOp
 	}
 
 	*reply = EventsResp{
-		Events:  parsedEvents,
-		Total:   total,
-		Options: args.Options,
+		Events:     parsedEvents,
+		Total:      total,
+		Options:    args.Options,
+		NextCursor: eventsCursor(events, args.Options),
 	}
 	return nil
 }
 
-func (r *RPCAPIs) GetStorage(req *http.Request, args *AddressWithOptionalBlock, reply *types.StorageResult) error {
-	if args.Address == nil {
-		return ErrNoAddress
-	}
-	if args.BlockNumber == nil {
-		lastFiltered, err := r.db.GetLastFiltered(*args.Address)
-		if err != nil {
-			if err == database.ErrNotFound {
-				return errors.New("address is not indexed")
-			}
-			return err
-		}
-		args.BlockNumber = &lastFiltered
+func (r *RPCAPIs) GetEventsByTopics(req *http.Request, args *EventsByTopicsArgs, reply *EventsResp) error {
+	query := &types.EventTopicQuery{Address: args.Address, EventSignature: args.EventSignature, Topics: args.Topics}
+	if err := query.Resolve(); err != nil {
+		return err
 	}
-	result, err := r.db.GetStorage(*args.Address, *args.BlockNumber)
+	options, err := r.eventQueryOptions(args.Address, args.Options)
 	if err != nil {
 		return err
 	}
-	*reply = *result
-	return nil
-}
+	args.Options = options
 
-func (r *RPCAPIs) GetStorageHistoryCount(req *http.Request, args *AddressWithBlockRange, reply *RangeQueryResult) error {
-	if args.Address == nil {
-		return ErrNoAddress
+	total, err := r.db.GetEventsByTopicsTotal(query, args.Options)
+	if err != nil {
+		return err
 	}
-
-	if args.Options == nil {
-		args.Options = &types.PageOptions{}
+	events, err := r.db.GetEventsByTopics(query, args.Options)
+	if err != nil {
+		return err
 	}
-	args.Options.SetDefaults()
-
-	ranges, err := r.db.GetStorageRanges(*args.Address, args.Options)
+	parsedEvents, err := r.parseEvents(events)
 	if err != nil {
 		return err
 	}
 
-	*reply = RangeQueryResult{Ranges: ranges}
+	*reply = EventsResp{
+		Events:     parsedEvents,
+		Total:      total,
+		Options:    args.Options,
+		NextCursor: eventsCursor(events, args.Options),
+	}
 	return nil
 }
 
-func (r *RPCAPIs) GetStorageHistory(req *http.Request, args *AddressWithBlockRange, reply *types.ReportingResponseTemplate) error {
-	if args.Address == nil {
-		return ErrNoAddress
+// GetEventsBySeverity returns the events classified with a severity when
+// indexed, from one contract or from all registered contracts
+func (r *RPCAPIs) GetEventsBySeverity(req *http.Request, args *EventsBySeverityArgs, reply *EventsResp) error {
+	query := &types.EventSeverityQuery{Address: args.Address, Severity: args.Severity}
+	if err := query.Validate(); err != nil {
+		return err
 	}
-
-	if args.Options == nil {
-		args.Options = &types.PageOptions{}
+	options, err := r.eventQueryOptions(args.Address, args.Options)
+	if err != nil {
+		return err
 	}
-	args.Options.SetDefaults()
+	args.Options = options
 
-	rawAbi, err := r.db.GetStorageLayout(*args.Address)
+	total, err := r.db.GetEventsBySeverityTotal(query, args.Options)
 	if err != nil {
 		return err
 	}
-	if rawAbi == "" {
-		return errors.New("no Storage Layout present to parse with")
+	events, err := r.db.GetEventsBySeverity(query, args.Options)
+	if err != nil {
+		return err
 	}
-	var parsedAbi types.SolidityStorageDocument
-	if err = json.Unmarshal([]byte(rawAbi), &parsedAbi); err != nil {
-		return errors.New("unable to decode Storage Layout: " + err.Error())
+	parsedEvents, err := r.parseEvents(events)
+	if err != nil {
+		return err
 	}
 
-	total, err := r.db.GetStorageTotal(*args.Address, args.Options)
+	*reply = EventsResp{
+		Events:     parsedEvents,
+		Total:      total,
+		Options:    args.Options,
+		NextCursor: eventsCursor(events, args.Options),
+	}
+	return nil
+}
 
+// GetEventSeverityCounts counts the events classified with each severity,
+// of one contract or of all registered contracts
+func (r *RPCAPIs) GetEventSeverityCounts(req *http.Request, args *AddressWithOptions, reply *types.SeverityCounts) error {
+	options, err := r.eventQueryOptions(args.Address, args.Options)
 	if err != nil {
 		return err
 	}
-
-	historicStates := []*types.ParsedState{}
-	results, err := r.db.GetStorageWithOptions(*args.Address, args.Options)
+	counts, err := r.db.GetEventSeverityCounts(&types.EventSeverityQuery{Address: args.Address}, options)
 	if err != nil {
 		return err
 	}
-	for _, rawStorage := range results {
-
-		if rawStorage == nil {
-			continue
-		}
+	*reply = counts
+	return nil
+}
 
-		historicStorage, err := storageparsing.ParseRawStorage(rawStorage.Storage, parsedAbi)
-		if err != nil {
-			return err
-		}
-		historicStates = append(historicStates, &types.ParsedState{
-			BlockNumber:     rawStorage.BlockNumber,
-			HistoricStorage: historicStorage,
-		})
+// eventQueryOptions defaults the options of a query of the contract's events,
+// or of all registered contracts' if no address is given, limiting it to the
+// blocks of its snapshot
+func (r *RPCAPIs) eventQueryOptions(address *types.Address, options *types.QueryOptions) (*types.QueryOptions, error) {
+	if options == nil {
+		options = &types.QueryOptions{}
 	}
-	*reply = types.ReportingResponseTemplate{
-		Address:       *args.Address,
+	options.SetDefaults()
+	var endBlockNumber *big.Int
+	var err error
+	if address != nil {
+		endBlockNumber, err = r.snapshots.EndBlockNumber(options.SnapshotId, *address, options.EndBlockNumber)
+	} else {
+		endBlockNumber, err = r.snapshots.GlobalEndBlockNumber(options.SnapshotId, options.EndBlockNumber)
+	}
+	if err != nil {
+		return nil, err
+	}
+	options.EndBlockNumber = endBlockNumber
+	return options, nil
+}
+
+// parseEvents decodes the events, which may come from several contracts,
+// each with its own ABI
+func (r *RPCAPIs) parseEvents(events []*types.Event) ([]*types.ParsedEvent, error) {
+	contractABIs := make(map[types.Address]string)
+	timestamps := newBlockTimestamps(r.db)
+	parsedEvents := make([]*types.ParsedEvent, len(events))
+	for i, e := range events {
+		contractABI, ok := contractABIs[e.Address]
+		if !ok {
+			var err error
+			if contractABI, err = r.db.GetContractABI(e.Address); err != nil {
+				return nil, err
+			}
+			contractABIs[e.Address] = contractABI
+		}
+		parsedEvents[i] = &types.ParsedEvent{
+			RawEvent: e,
+		}
+		parsedEvents[i].SetTimestamp(timestamps.lookup(e.BlockNumber, e.Timestamp))
+		if contractABI != "" {
+			if err := parsedEvents[i].ParseEvent(contractABI); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return parsedEvents, nil
+}
+
+// DecodeLogs decodes raw logs supplied by the caller, which don't need to have
+// been indexed, with the ABIs registered for their contracts or, failing
+// that, any template's ABI with a matching event
+func (r *RPCAPIs) DecodeLogs(req *http.Request, args *DecodeLogsArgs, reply *[]*types.ParsedEvent) error {
+	if err := validateDecodeLogs(args.Logs); err != nil {
+		return err
+	}
+	decoder := newLogDecoder(r.db)
+	decoded := make([]*types.ParsedEvent, len(args.Logs))
+	for i, raw := range args.Logs {
+		parsed, err := decoder.decode(raw)
+		if err != nil {
+			return err
+		}
+		decoded[i] = parsed
+	}
+	*reply = decoded
+	return nil
+}
+
+// HasActivity returns whether the address had any transactions, internal
+// transactions or events in the block range, without counting them, so
+// listing them can be skipped for idle contracts
+func (r *RPCAPIs) HasActivity(req *http.Request, args *AddressWithBlockNumbers, reply *bool) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+	if args.ToBlock < args.FromBlock {
+		return errors.New("end block is before start block")
+	}
+	active, err := r.db.HasActivity(*args.Address, args.FromBlock, args.ToBlock)
+	if err != nil {
+		return err
+	}
+	*reply = active
+	return nil
+}
+
+// GetCounterparties lists the addresses that have interacted with a contract,
+// with when they were first and last seen, most recent or most active first
+func (r *RPCAPIs) GetCounterparties(req *http.Request, args *CounterpartiesArgs, reply *[]*types.Counterparty) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+	if args.Options == nil {
+		args.Options = &types.CounterpartyQueryOptions{}
+	}
+	args.Options.SetDefaults()
+	if err := args.Options.Validate(); err != nil {
+		return err
+	}
+
+	counterparties, err := r.db.GetCounterparties(*args.Address, args.Options)
+	if err != nil {
+		return err
+	}
+	*reply = counterparties
+	return nil
+}
+
+// GetAddressTotals counts the transactions, internal transactions and events
+// for an address, without returning any of them
+func (r *RPCAPIs) GetAddressTotals(req *http.Request, args *AddressWithOptions, reply *AddressTotals) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+	if args.Options == nil {
+		args.Options = &types.QueryOptions{}
+	}
+	args.Options.SetDefaults()
+	endBlockNumber, err := r.snapshots.EndBlockNumber(args.Options.SnapshotId, *args.Address, args.Options.EndBlockNumber)
+	if err != nil {
+		return err
+	}
+	args.Options.EndBlockNumber = endBlockNumber
+
+	txTotal, err := r.db.GetTransactionsToAddressTotal(*args.Address, args.Options)
+	if err != nil {
+		return err
+	}
+	internalTxTotal, err := r.db.GetTransactionsInternalToAddressTotal(*args.Address, args.Options)
+	if err != nil {
+		return err
+	}
+	eventTotal, err := r.db.GetEventsFromAddressTotal(*args.Address, args.Options)
+	if err != nil {
+		return err
+	}
+
+	*reply = AddressTotals{
+		Transactions:         txTotal,
+		InternalTransactions: internalTxTotal,
+		Events:               eventTotal,
+		Options:              args.Options,
+	}
+	return nil
+}
+
+func (r *RPCAPIs) GetStorage(req *http.Request, args *StorageArgs, reply *StoragePage) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+	if args.BlockNumber == nil {
+		lastFiltered, err := r.db.GetLastFiltered(*args.Address)
+		if err != nil {
+			if err == database.ErrNotFound {
+				return errors.New("address is not indexed")
+			}
+			return err
+		}
+		// contracts can be filtered past the block they were frozen at
+		terminalBlock, err := r.db.GetTerminalBlock(*args.Address)
+		if err != nil {
+			return err
+		}
+		if terminalBlock > 0 && lastFiltered > terminalBlock {
+			lastFiltered = terminalBlock
+		}
+		args.BlockNumber = &lastFiltered
+	}
+	if err := checkFrozen(r.db, *args.Address, *args.BlockNumber); err != nil {
+		return err
+	}
+	prefix := strings.ToLower(strings.TrimPrefix(args.SlotPrefix, "0x"))
+	if strings.Trim(prefix, "0123456789abcdef") != "" || len(prefix) > 64 {
+		return errors.New("invalid slot prefix: " + args.SlotPrefix)
+	}
+	result, err := r.db.GetStorage(*args.Address, *args.BlockNumber)
+	if err != nil {
+		return err
+	}
+
+	var variableSlots map[types.Hash]bool
+	if args.Variable != "" {
+		layout, err := r.storageLayoutLoader(*args.Address)()
+		if err != nil {
+			return err
+		}
+		variableSlots, err = storageparsing.VariableSlots(result.Storage, *layout, args.Variable, args.MappingKeys)
+		if err != nil {
+			return err
+		}
+	}
+	slots := make([]types.Hash, 0, len(result.Storage))
+	for slot := range result.Storage {
+		if strings.HasPrefix(string(slot), prefix) && (variableSlots == nil || variableSlots[slot]) {
+			slots = append(slots, slot)
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+	total := uint64(len(slots))
+	if args.Options != nil {
+		args.Options.SetDefaults()
+		start := args.Options.PageNumber * args.Options.PageSize
+		switch {
+		case start >= len(slots):
+			slots = nil
+		case start+args.Options.PageSize < len(slots):
+			slots = slots[start : start+args.Options.PageSize]
+		default:
+			slots = slots[start:]
+		}
+	}
+
+	storage := make(map[types.Hash]string, len(slots))
+	for _, slot := range slots {
+		storage[slot] = result.Storage[slot]
+	}
+	*reply = StoragePage{
+		StorageResult: types.StorageResult{Storage: storage, StorageRoot: result.StorageRoot, BlockNumber: result.BlockNumber},
+		Total:         total,
+	}
+	return nil
+}
+
+func (r *RPCAPIs) GetStorageHistoryCount(req *http.Request, args *AddressWithBlockRange, reply *RangeQueryResult) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+
+	if args.Options == nil {
+		args.Options = &types.PageOptions{}
+	}
+	args.Options.SetDefaults()
+	endBlockNumber, err := r.snapshots.EndBlockNumber(args.Options.SnapshotId, *args.Address, args.Options.EndBlockNumber)
+	if err != nil {
+		return err
+	}
+	args.Options.EndBlockNumber = endBlockNumber
+	if err := r.guardStorage(*args.Address, args.Options); err != nil {
+		return err
+	}
+
+	ranges, err := r.db.GetStorageRanges(*args.Address, args.Options)
+	if err != nil {
+		return err
+	}
+
+	*reply = RangeQueryResult{Ranges: ranges}
+	return nil
+}
+
+func (r *RPCAPIs) GetStorageHistory(req *http.Request, args *StorageHistoryArgs, reply *types.ReportingResponseTemplate) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+
+	if args.Options == nil {
+		args.Options = &types.PageOptions{}
+	}
+	args.Options.SetDefaults()
+	endBlockNumber, err := r.snapshots.EndBlockNumber(args.Options.SnapshotId, *args.Address, args.Options.EndBlockNumber)
+	if err != nil {
+		return err
+	}
+	args.Options.EndBlockNumber = endBlockNumber
+	if err := r.guardStorage(*args.Address, args.Options); err != nil {
+		return err
+	}
+
+	rawAbi, err := r.db.GetStorageLayout(*args.Address)
+	if err != nil {
+		return err
+	}
+	if rawAbi == "" {
+		return errors.New("no Storage Layout present to parse with")
+	}
+	var parsedAbi types.SolidityStorageDocument
+	if err = json.Unmarshal([]byte(rawAbi), &parsedAbi); err != nil {
+		return errors.New("unable to decode Storage Layout: " + err.Error())
+	}
+
+	total, err := r.db.GetStorageTotal(*args.Address, args.Options)
+
+	if err != nil {
+		return err
+	}
+
+	results, err := r.db.GetStorageWithOptions(*args.Address, args.Options)
+	if err != nil {
+		return err
+	}
+	historicStates, err := parseStorageHistory(results, parsedAbi, args.MappingKeys)
+	if err != nil {
+		return err
+	}
+	*reply = types.ReportingResponseTemplate{
+		Address:       *args.Address,
 		HistoricState: historicStates,
 		Total:         total,
 		Options:       args.Options,
@@ -291,10 +986,186 @@ func (r *RPCAPIs) GetStorageHistory(req *http.Request, args *AddressWithBlockRan
 	return nil
 }
 
+// SearchStorage finds the block ranges in which a storage variable of the
+// contract compared to the value with the operator
+func (r *RPCAPIs) SearchStorage(req *http.Request, args *StorageSearchArgs, reply *StorageSearchResp) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+	matcher, err := newStorageMatcher(args.Variable, args.Operator, args.Value)
+	if err != nil {
+		return err
+	}
+
+	if args.Options == nil {
+		args.Options = &types.PageOptions{}
+	}
+	begin, end, err := r.storageBlockRange(*args.Address, args.Options)
+	if err != nil {
+		return err
+	}
+	ranges := []*BlockRange{}
+	if begin <= end {
+		storage, err := r.db.GetStorageValues(*args.Address, args.Options)
+		if err != nil {
+			return err
+		}
+		if ranges, err = matchingRanges(storage, matcher, r.storageLayoutLoader(*args.Address), begin, end); err != nil {
+			return err
+		}
+	}
+
+	*reply = StorageSearchResp{Ranges: ranges, Options: args.Options}
+	return nil
+}
+
+// GetStorageAverage computes the time-weighted average of a numeric storage
+// variable of the contract over the block range
+func (r *RPCAPIs) GetStorageAverage(req *http.Request, args *StorageAverageArgs, reply *StorageAverageResp) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+	if args.Variable == "" {
+		return ErrNoVariable
+	}
+	if args.WeightBy == "" {
+		args.WeightBy = WeightByBlocks
+	}
+	if args.WeightBy != WeightByBlocks && args.WeightBy != WeightBySeconds {
+		return ErrInvalidWeighting
+	}
+
+	if args.Options == nil {
+		args.Options = &types.PageOptions{}
+	}
+	begin, end, err := r.storageBlockRange(*args.Address, args.Options)
+	if err != nil {
+		return err
+	}
+	if begin > end {
+		return errors.New("begin block number is after the end block number")
+	}
+	storage, err := r.db.GetStorageValues(*args.Address, args.Options)
+	if err != nil {
+		return err
+	}
+	spans, err := numericSpans(storage, args.Variable, r.storageLayoutLoader(*args.Address), begin, end)
+	if err != nil {
+		return err
+	}
+	if args.WeightBy == WeightBySeconds {
+		if err := r.weighBySeconds(spans, end); err != nil {
+			return err
+		}
+	}
+
+	average, weight := weightedAverage(spans)
+	*reply = StorageAverageResp{Average: average, Weight: weight, WeightBy: args.WeightBy, Options: args.Options}
+	return nil
+}
+
+// storageBlockRange sets the defaults of the options for querying the storage
+// history of the address, resolving the latest end block, and returns the
+// blocks of the range, once checked against the query guard
+func (r *RPCAPIs) storageBlockRange(address types.Address, options *types.PageOptions) (uint64, uint64, error) {
+	options.SetDefaults()
+	endBlockNumber, err := r.snapshots.EndBlockNumber(options.SnapshotId, address, options.EndBlockNumber)
+	if err != nil {
+		return 0, 0, err
+	}
+	if endBlockNumber.Cmp(big.NewInt(-1)) == 0 {
+		lastFiltered, err := r.db.GetLastFiltered(address)
+		if err != nil {
+			return 0, 0, err
+		}
+		endBlockNumber = new(big.Int).SetUint64(lastFiltered)
+	}
+	options.EndBlockNumber = endBlockNumber
+	if err := r.guardStorage(address, options); err != nil {
+		return 0, 0, err
+	}
+	return options.BeginBlockNumber.Uint64(), options.EndBlockNumber.Uint64(), nil
+}
+
+// storageLayoutLoader reads the storage layout of the address when it is
+// first needed
+func (r *RPCAPIs) storageLayoutLoader(address types.Address) func() (*types.SolidityStorageDocument, error) {
+	return func() (*types.SolidityStorageDocument, error) {
+		rawLayout, err := r.db.GetStorageLayout(address)
+		if err != nil {
+			return nil, err
+		}
+		if rawLayout == "" {
+			return nil, errors.New("no Storage Layout present to parse with")
+		}
+		var parsedLayout types.SolidityStorageDocument
+		if err := json.Unmarshal([]byte(rawLayout), &parsedLayout); err != nil {
+			return nil, errors.New("unable to decode Storage Layout: " + err.Error())
+		}
+		return &parsedLayout, nil
+	}
+}
+
+// parseStorageHistory decodes the storage of each block using a bounded pool
+// of workers, keeping the results in the same order as the blocks.
+func parseStorageHistory(results []*types.StorageResult, layout types.SolidityStorageDocument, mappingKeys storageparsing.MappingKeys) ([]*types.ParsedState, error) {
+	parsed := make([]*types.ParsedState, len(results))
+	errs := make([]error, len(results))
+
+	workers := runtime.NumCPU()
+	if workers > len(results) {
+		workers = len(results)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the parser sorts the storage layout in place, so each worker
+			// needs its own copy
+			workerLayout := layout
+			workerLayout.Storage = append(layout.Storage[:0:0], layout.Storage...)
+			for i := range jobs {
+				historicStorage, err := storageparsing.ParseRawStorageWithKeys(results[i].Storage, workerLayout, mappingKeys)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				parsed[i] = &types.ParsedState{
+					BlockNumber:     results[i].BlockNumber,
+					HistoricStorage: historicStorage,
+				}
+			}
+		}()
+	}
+	for i, rawStorage := range results {
+		if rawStorage != nil {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	historicStates := []*types.ParsedState{}
+	for i := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if parsed[i] != nil {
+			historicStates = append(historicStates, parsed[i])
+		}
+	}
+	return historicStates, nil
+}
+
 func (r *RPCAPIs) AddAddress(req *http.Request, args *AddressWithOptionalBlock, reply *NullArgs) error {
 	if args.Address == nil {
 		return ErrNoAddress
 	}
+	if r.headersOnly {
+		return ErrContractIndexingDisabled
+	}
 
 	if args.BlockNumber != nil && *args.BlockNumber > 0 {
 		// add address from
@@ -303,8 +1174,11 @@ func (r *RPCAPIs) AddAddress(req *http.Request, args *AddressWithOptionalBlock,
 	return r.db.AddAddresses([]types.Address{*args.Address})
 }
 
-func (r *RPCAPIs) DeleteAddress(req *http.Request, address *types.Address, reply *NullArgs) error {
-	return r.db.DeleteAddress(*address)
+func (r *RPCAPIs) DeleteAddress(req *http.Request, args *DeleteAddressArgs, reply *NullArgs) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+	return r.db.DeleteAddress(*args.Address, args.Purge)
 }
 
 func (r *RPCAPIs) GetAddresses(req *http.Request, args *NullArgs, reply *[]types.Address) error {
@@ -358,6 +1232,19 @@ func (r *RPCAPIs) AddStorageABI(req *http.Request, args *AddressWithData, reply
 	return r.contractTemplateManager.AddStorageLayout(*args.Address, args.Data)
 }
 
+// AddStorageLayout assigns the storage layout of a contract given as solc
+// output, in any of the formats solc can give it.
+func (r *RPCAPIs) AddStorageLayout(req *http.Request, args *StorageLayoutArgs, reply *NullArgs) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+	layout, err := storageparsing.ImportStorageLayout(args.Layout, args.Contract)
+	if err != nil {
+		return err
+	}
+	return r.contractTemplateManager.AddStorageLayout(*args.Address, layout)
+}
+
 func (r *RPCAPIs) GetStorageABI(req *http.Request, address *types.Address, reply *string) error {
 	result, err := r.db.GetStorageLayout(*address)
 	if err != nil {
@@ -387,6 +1274,527 @@ func (r *RPCAPIs) AssignTemplate(req *http.Request, args *AddressWithData, reply
 	return r.db.AssignTemplate(*args.Address, args.Data)
 }
 
+// AssignTemplateByCode assigns a template to every registered contract whose
+// runtime bytecode matches the code hash, or the code of the reference
+// contract, then filters each newly assigned contract again, as a background
+// job, returning the job ID.
+func (r *RPCAPIs) AssignTemplateByCode(req *http.Request, args *types.CodeMatchRequest, reply *string) error {
+	if r.matcher == nil {
+		return ErrCodeMatchNotEnabled
+	}
+	id, err := r.matcher.Assign(args)
+	if err != nil {
+		return err
+	}
+	*reply = id
+	return nil
+}
+
+func (r *RPCAPIs) SetContractEnrichment(req *http.Request, args *AddressWithEnrichment, reply *NullArgs) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+	if err := args.Mapping.Validate(); err != nil {
+		return err
+	}
+	return r.db.SetContractEnrichment(*args.Address, args.Mapping)
+}
+
+func (r *RPCAPIs) GetContractEnrichment(req *http.Request, address *types.Address, reply *types.EnrichmentMapping) error {
+	mapping, err := r.db.GetContractEnrichment(*address)
+	if err != nil {
+		return err
+	}
+	if mapping == nil {
+		mapping = types.EnrichmentMapping{}
+	}
+	*reply = mapping
+	return nil
+}
+
+// SetContractSeverityRules replaces the rules classifying the contract's
+// events by severity, which are checked against its ABI if it has one
+func (r *RPCAPIs) SetContractSeverityRules(req *http.Request, args *AddressWithSeverityRules, reply *NullArgs) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+	if err := args.Rules.Validate(); err != nil {
+		return err
+	}
+	contractABI, err := r.db.GetContractABI(*args.Address)
+	if err != nil {
+		return err
+	}
+	if contractABI != "" && len(args.Rules) > 0 {
+		structure, err := types.NewABIStructureFromJSON(contractABI)
+		if err != nil {
+			return err
+		}
+		if _, err := types.NewSeverityClassifier(args.Rules, structure.ToInternalABI()); err != nil {
+			return err
+		}
+	}
+	return r.db.SetContractSeverityRules(*args.Address, args.Rules)
+}
+
+func (r *RPCAPIs) GetContractSeverityRules(req *http.Request, address *types.Address, reply *types.SeverityRules) error {
+	rules, err := r.db.GetContractSeverityRules(*address)
+	if err != nil {
+		return err
+	}
+	if rules == nil {
+		rules = types.SeverityRules{}
+	}
+	*reply = rules
+	return nil
+}
+
+// SetTerminalBlock freezes the contract's data at the block, or unfreezes it
+// if no block is given
+func (r *RPCAPIs) SetTerminalBlock(req *http.Request, args *AddressWithOptionalBlock, reply *NullArgs) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+	var terminalBlock uint64
+	if args.BlockNumber != nil {
+		terminalBlock = *args.BlockNumber
+	}
+	return r.db.SetTerminalBlock(*args.Address, terminalBlock)
+}
+
+func (r *RPCAPIs) GetTerminalBlock(req *http.Request, address *types.Address, reply *uint64) error {
+	terminalBlock, err := r.db.GetTerminalBlock(*address)
+	if err != nil {
+		return err
+	}
+	*reply = terminalBlock
+	return nil
+}
+
+func (r *RPCAPIs) GetJobs(req *http.Request, args *NullArgs, reply *[]*types.Job) error {
+	jobs, err := r.db.GetJobs()
+	if err != nil {
+		return err
+	}
+	if r.backfills != nil {
+		jobs = append(jobs, r.backfills.GetJobs()...)
+	}
+	if r.exports != nil {
+		jobs = append(jobs, r.exports.GetJobs()...)
+	}
+	if r.integrity != nil {
+		jobs = append(jobs, r.integrity.GetJobs()...)
+	}
+	if r.inference != nil {
+		jobs = append(jobs, r.inference.GetJobs()...)
+	}
+	if r.matcher != nil {
+		jobs = append(jobs, r.matcher.GetJobs()...)
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt > jobs[j].StartedAt
+	})
+	*reply = jobs
+	return nil
+}
+
+func (r *RPCAPIs) GetJob(req *http.Request, id *string, reply *types.Job) error {
+	var (
+		job *types.Job
+		err error
+	)
+	switch {
+	case r.isBackfillJob(*id):
+		job, err = r.backfills.GetJob(*id)
+	case r.isExportJob(*id):
+		job, err = r.exports.GetJob(*id)
+	case r.isIntegrityJob(*id):
+		job, err = r.integrity.GetJob(*id)
+	case r.isInferenceJob(*id):
+		job, err = r.inference.GetJob(*id)
+	case r.isCodeMatchJob(*id):
+		job, err = r.matcher.GetJob(*id)
+	default:
+		job, err = r.db.GetJob(*id)
+	}
+	if err != nil {
+		return err
+	}
+	*reply = *job
+	return nil
+}
+
+// GetProcessingJournal returns how the blocks in the range were processed,
+// newest block first
+func (r *RPCAPIs) GetProcessingJournal(req *http.Request, args *JournalArgs, reply *[]*types.JournalEntry) error {
+	if args.Stage != "" && args.Stage != types.IngestStage && args.Stage != types.FilterStage && args.Stage != types.ScreenStage {
+		return errors.New("invalid journal stage")
+	}
+	if args.Options == nil {
+		args.Options = &types.PageOptions{}
+	}
+	args.Options.SetDefaults()
+
+	entries, err := r.db.GetJournalEntries(&args.JournalQuery, args.Options)
+	if err != nil {
+		return err
+	}
+	*reply = entries
+	return nil
+}
+
+func (r *RPCAPIs) RetryJob(req *http.Request, id *string, reply *NullArgs) error {
+	if r.isBackfillJob(*id) {
+		return r.backfills.Retry(*id)
+	}
+	if r.isExportJob(*id) {
+		return r.exports.Retry(*id)
+	}
+	if r.isIntegrityJob(*id) {
+		return r.integrity.Retry(*id)
+	}
+	if r.isInferenceJob(*id) {
+		return r.inference.Retry(*id)
+	}
+	if r.isCodeMatchJob(*id) {
+		return r.matcher.Retry(*id)
+	}
+	return r.db.RetryJob(*id)
+}
+
+// isBackfillJob checks whether the job ID is of a backfill, which is tracked
+// apart from the database jobs
+func (r *RPCAPIs) isBackfillJob(id string) bool {
+	return r.backfills != nil && strings.HasPrefix(id, types.BackfillJob+"-")
+}
+
+// isExportJob checks whether the job ID is of an export, which is tracked
+// apart from the database jobs
+func (r *RPCAPIs) isExportJob(id string) bool {
+	return r.exports != nil && strings.HasPrefix(id, types.ExportJob+"-")
+}
+
+// isIntegrityJob checks whether the job ID is of an integrity verification,
+// which is tracked apart from the database jobs
+func (r *RPCAPIs) isIntegrityJob(id string) bool {
+	return r.integrity != nil && strings.HasPrefix(id, types.IntegrityJob+"-")
+}
+
+// isInferenceJob checks whether the job ID is of a storage layout inference,
+// which is tracked apart from the database jobs
+func (r *RPCAPIs) isInferenceJob(id string) bool {
+	return r.inference != nil && strings.HasPrefix(id, types.InferLayoutJob+"-")
+}
+
+// isCodeMatchJob checks whether the job ID is of a template assignment by
+// code, which is tracked apart from the database jobs
+func (r *RPCAPIs) isCodeMatchJob(id string) bool {
+	return r.matcher != nil && strings.HasPrefix(id, types.CodeMatchJob+"-")
+}
+
+// Backfill re-processes the blocks in the range as a background job,
+// returning the job ID.
+func (r *RPCAPIs) Backfill(req *http.Request, args *BlockRangeArgs, reply *string) error {
+	if r.backfills == nil {
+		return ErrBackfillNotEnabled
+	}
+	id, err := r.backfills.Backfill(args.From, args.To)
+	if err != nil {
+		return err
+	}
+	*reply = id
+	return nil
+}
+
+// Export writes the transactions, events, storage history or token balances
+// of a contract in a block range to files in the configured export directory,
+// as a background job, returning the job ID.
+func (r *RPCAPIs) Export(req *http.Request, args *types.ExportRequest, reply *string) error {
+	if r.exports == nil {
+		return ErrExportNotEnabled
+	}
+	if r.scope != nil && !r.scope.Contains(args.Address) {
+		return scoped.ErrContractNotInScope
+	}
+	id, err := r.exports.Export(args)
+	if err != nil {
+		return err
+	}
+	*reply = id
+	return nil
+}
+
+// VerifyIntegrity checks that the blocks, transactions and events stored in
+// the range still match the checksums they were stored with, as a background
+// job, returning the job ID. A range ending at 0 ends at the last persisted
+// block.
+func (r *RPCAPIs) VerifyIntegrity(req *http.Request, args *BlockRangeArgs, reply *string) error {
+	if r.integrity == nil {
+		return ErrIntegrityNotEnabled
+	}
+	id, err := r.integrity.Verify(args.From, args.To)
+	if err != nil {
+		return err
+	}
+	*reply = id
+	return nil
+}
+
+// GetIntegrityReport returns the documents an integrity verification found
+// not to match their checksums, so far if it is still running.
+func (r *RPCAPIs) GetIntegrityReport(req *http.Request, id *string, reply *types.IntegrityReport) error {
+	if r.integrity == nil {
+		return ErrIntegrityNotEnabled
+	}
+	report, err := r.integrity.GetReport(*id)
+	if err != nil {
+		return err
+	}
+	*reply = *report
+	return nil
+}
+
+// InferStorageLayout infers a storage layout for a contract that has none,
+// from the storage it has been seen to write, as a background job, returning
+// the job ID.
+func (r *RPCAPIs) InferStorageLayout(req *http.Request, address *types.Address, reply *string) error {
+	if r.inference == nil {
+		return ErrLayoutInferenceNotEnabled
+	}
+	if address == nil {
+		return ErrNoAddress
+	}
+	if r.scope != nil && !r.scope.Contains(*address) {
+		return scoped.ErrContractNotInScope
+	}
+	id, err := r.inference.Infer(*address)
+	if err != nil {
+		return err
+	}
+	*reply = id
+	return nil
+}
+
+// GetLayoutProposal returns the variables, and the layout, a storage layout
+// inference proposes, which are empty until it completes.
+func (r *RPCAPIs) GetLayoutProposal(req *http.Request, id *string, reply *types.LayoutProposal) error {
+	proposal, err := r.layoutProposal(*id)
+	if err != nil {
+		return err
+	}
+	*reply = *proposal
+	return nil
+}
+
+// AcceptLayoutProposal assigns the layout a completed storage layout
+// inference proposes to its contract, in the same way as AddStorageABI.
+func (r *RPCAPIs) AcceptLayoutProposal(req *http.Request, id *string, reply *NullArgs) error {
+	proposal, err := r.layoutProposal(*id)
+	if err != nil {
+		return err
+	}
+	if !proposal.Complete {
+		return errors.New("storage layout inference has not completed")
+	}
+	if len(proposal.Variables) == 0 {
+		return errors.New("storage layout inference found no variables")
+	}
+	if err := r.contractTemplateManager.AddStorageLayout(proposal.Address, proposal.Layout); err != nil {
+		return err
+	}
+	return r.inference.Accepted(*id)
+}
+
+func (r *RPCAPIs) layoutProposal(id string) (*types.LayoutProposal, error) {
+	if r.inference == nil {
+		return nil, ErrLayoutInferenceNotEnabled
+	}
+	proposal, err := r.inference.GetProposal(id)
+	if err != nil {
+		return nil, err
+	}
+	if r.scope != nil && !r.scope.Contains(proposal.Address) {
+		return nil, scoped.ErrContractNotInScope
+	}
+	return proposal, nil
+}
+
+// DeleteBlockRange deletes the events, storage and token entries recorded in
+// the blocks of the range, other than those under legal hold, so that the
+// range can be backfilled cleanly. A dry run only counts them.
+func (r *RPCAPIs) DeleteBlockRange(req *http.Request, args *DeleteBlockRangeArgs, reply *types.BlockRangeDeletion) error {
+	if args.From > args.To {
+		return ErrInvalidBlockRange
+	}
+	deletion, err := r.db.DeleteBlockRange(args.From, args.To, args.DryRun)
+	if err != nil {
+		return err
+	}
+	*reply = *deletion
+	return nil
+}
+
+// PauseIngestion stops syncing and filtering new blocks, returning once the
+// blocks in flight have been persisted and filtered, until resumed. Queries
+// keep being served.
+func (r *RPCAPIs) PauseIngestion(req *http.Request, args *NullArgs, reply *NullArgs) error {
+	if r.ingestion == nil {
+		return ErrIngestionControlNotEnabled
+	}
+	return r.ingestion.PauseIngestion(req.Context())
+}
+
+// ResumeIngestion starts syncing and filtering new blocks again after a pause.
+func (r *RPCAPIs) ResumeIngestion(req *http.Request, args *NullArgs, reply *NullArgs) error {
+	if r.ingestion == nil {
+		return ErrIngestionControlNotEnabled
+	}
+	r.ingestion.ResumeIngestion()
+	return nil
+}
+
+// AddWebhook registers a webhook, returning its generated ID. Any ID given is
+// ignored, and a secret to sign its notifications with is generated if none
+// is given, which is only returned here.
+func (r *RPCAPIs) AddWebhook(req *http.Request, webhook *types.Webhook, reply *AddWebhookResp) error {
+	if err := webhook.Validate(); err != nil {
+		return err
+	}
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return err
+	}
+	webhook.ID = hex.EncodeToString(idBytes)
+	var generatedSecret string
+	if webhook.Secret == "" {
+		secretBytes := make([]byte, 32)
+		if _, err := rand.Read(secretBytes); err != nil {
+			return err
+		}
+		generatedSecret = hex.EncodeToString(secretBytes)
+		webhook.Secret = generatedSecret
+	}
+	if err := r.db.AddWebhook(webhook); err != nil {
+		return err
+	}
+	*reply = AddWebhookResp{Id: webhook.ID, Secret: generatedSecret}
+	return nil
+}
+
+// DeleteWebhook removes a webhook, dropping the events still waiting to be
+// sent to it.
+func (r *RPCAPIs) DeleteWebhook(req *http.Request, id *string, reply *NullArgs) error {
+	if err := r.db.DeleteWebhook(*id); err != nil {
+		return err
+	}
+	if r.webhooks != nil {
+		r.webhooks.RemoveWebhook(*id)
+	}
+	return nil
+}
+
+// GetWebhooks lists the registered webhooks, without their secrets.
+func (r *RPCAPIs) GetWebhooks(req *http.Request, args *NullArgs, reply *[]*types.Webhook) error {
+	webhooks, err := r.db.GetWebhooks()
+	if err != nil {
+		return err
+	}
+	redacted := make([]*types.Webhook, len(webhooks))
+	for i, webhook := range webhooks {
+		copied := *webhook
+		copied.Secret = ""
+		redacted[i] = &copied
+	}
+	*reply = redacted
+	return nil
+}
+
+// AddLegalHold places a legal hold, returning its generated ID. Any ID or
+// creation time given is ignored.
+func (r *RPCAPIs) AddLegalHold(req *http.Request, hold *types.LegalHold, reply *string) error {
+	if err := hold.Validate(); err != nil {
+		return err
+	}
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return err
+	}
+	hold.ID = hex.EncodeToString(idBytes)
+	hold.CreatedAt = uint64(time.Now().Unix())
+	if err := r.db.AddLegalHold(hold); err != nil {
+		return err
+	}
+	*reply = hold.ID
+	return nil
+}
+
+func (r *RPCAPIs) ReleaseLegalHold(req *http.Request, id *string, reply *NullArgs) error {
+	return r.db.DeleteLegalHold(*id)
+}
+
+func (r *RPCAPIs) GetLegalHolds(req *http.Request, args *NullArgs, reply *[]*types.LegalHold) error {
+	holds, err := r.db.GetLegalHolds()
+	if err != nil {
+		return err
+	}
+	*reply = holds
+	return nil
+}
+
+// AddTokenRule stores a token rule, returning its generated ID, and applies
+// it to the contracts created from then on. Any ID or creation time given is
+// ignored.
+func (r *RPCAPIs) AddTokenRule(req *http.Request, rule *types.TokenRule, reply *string) error {
+	if r.headersOnly {
+		return ErrContractIndexingDisabled
+	}
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return err
+	}
+	rule.ID = hex.EncodeToString(idBytes)
+	rule.CreatedAt = uint64(time.Now().Unix())
+	if err := r.db.AddTokenRule(rule); err != nil {
+		return err
+	}
+	if err := r.reloadTokenRules(); err != nil {
+		// a rule that can't be applied, such as one whose event is not in
+		// its event template, is not kept
+		if deleteErr := r.db.DeleteTokenRule(rule.ID); deleteErr != nil {
+			log.Error("Unable to delete token rule", "id", rule.ID, "err", deleteErr)
+		}
+		return err
+	}
+	*reply = rule.ID
+	return nil
+}
+
+func (r *RPCAPIs) DeleteTokenRule(req *http.Request, id *string, reply *NullArgs) error {
+	if err := r.db.DeleteTokenRule(*id); err != nil {
+		return err
+	}
+	return r.reloadTokenRules()
+}
+
+func (r *RPCAPIs) GetTokenRules(req *http.Request, args *NullArgs, reply *[]*types.TokenRule) error {
+	rules, err := r.db.GetTokenRules()
+	if err != nil {
+		return err
+	}
+	*reply = rules
+	return nil
+}
+
+func (r *RPCAPIs) reloadTokenRules() error {
+	if r.rules == nil {
+		return nil
+	}
+	return r.rules.ReloadTokenRules()
+}
+
 func (r *RPCAPIs) GetTemplates(req *http.Request, args *NullArgs, result *[]string) error {
 	templates, err := r.db.GetTemplates()
 	if err != nil {
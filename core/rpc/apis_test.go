@@ -1,12 +1,18 @@
 package rpc
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math/big"
 	"net/http"
+	"strings"
 	"testing"
 
+	"github.com/gorilla/rpc/v2/json"
 	"github.com/stretchr/testify/assert"
 
+	"quorumengineering/quorum-report/database"
 	"quorumengineering/quorum-report/database/memory"
 	"quorumengineering/quorum-report/types"
 )
@@ -80,6 +86,675 @@ func TestAPIValidation(t *testing.T) {
 
 	err := apis.AddAddress(dummyReq, &AddressWithOptionalBlock{}, nil)
 	assert.EqualError(t, err, "address not provided")
+
+	err = apis.SetContractEnrichment(dummyReq, &AddressWithEnrichment{Mapping: types.EnrichmentMapping{"orderId": "_orderId"}}, nil)
+	assert.EqualError(t, err, "address not provided")
+	err = apis.SetContractEnrichment(dummyReq, &AddressWithEnrichment{Address: &addr, Mapping: types.EnrichmentMapping{"hash": "_hash"}}, nil)
+	assert.EqualError(t, err, "invalid enrichment field name: hash")
+
+	apis.headersOnly = true
+	err = apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil)
+	assert.Equal(t, ErrContractIndexingDisabled, err)
+}
+
+func TestContractEnrichment(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+
+	var mapping types.EnrichmentMapping
+	assert.Nil(t, apis.GetContractEnrichment(dummyReq, &addr, &mapping))
+	assert.Equal(t, types.EnrichmentMapping{}, mapping)
+
+	set := types.EnrichmentMapping{"newValue": "_value"}
+	assert.Nil(t, apis.SetContractEnrichment(dummyReq, &AddressWithEnrichment{Address: &addr, Mapping: set}, nil))
+	assert.Nil(t, apis.GetContractEnrichment(dummyReq, &addr, &mapping))
+	assert.Equal(t, set, mapping)
+
+	// removed along with the address
+	assert.Nil(t, apis.DeleteAddress(dummyReq, &DeleteAddressArgs{Address: &addr, Purge: true}, nil))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, apis.GetContractEnrichment(dummyReq, &addr, &mapping))
+	assert.Equal(t, types.EnrichmentMapping{}, mapping)
+}
+
+func TestTerminalBlock(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {Root: types.NewHash("0x01"), Storage: map[types.Hash]string{}}}, 5))
+
+	terminalBlock := uint64(4)
+	assert.Nil(t, apis.SetTerminalBlock(dummyReq, &AddressWithOptionalBlock{Address: &addr, BlockNumber: &terminalBlock}, nil))
+	var stored uint64
+	assert.Nil(t, apis.GetTerminalBlock(dummyReq, &addr, &stored))
+	assert.EqualValues(t, 4, stored)
+
+	// queries after the terminal block return the frozen status as data
+	block := uint64(5)
+	var page StoragePage
+	err := apis.GetStorage(dummyReq, &StorageArgs{Address: &addr, BlockNumber: &block}, &page)
+	assert.Equal(t, &json.Error{Data: &ContractFrozenError{Message: "contract data frozen", Address: addr, TerminalBlock: 4}}, err)
+	var tokens []types.ERC721Token
+	err = NewTokenRPCAPIs(db).AllERC721TokensAtBlock(dummyReq, &ERC721TokenQuery{Contract: &addr, Block: 5}, &tokens)
+	assert.IsType(t, &json.Error{}, err)
+	assert.Nil(t, apis.GetStorage(dummyReq, &StorageArgs{Address: &addr, BlockNumber: &terminalBlock}, &page))
+
+	assert.Nil(t, apis.SetTerminalBlock(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, apis.GetStorage(dummyReq, &StorageArgs{Address: &addr, BlockNumber: &block}, &page))
+	assert.EqualValues(t, 5, page.BlockNumber)
+
+	err = apis.SetTerminalBlock(dummyReq, &AddressWithOptionalBlock{}, nil)
+	assert.Equal(t, ErrNoAddress, err)
+}
+
+func TestGetContractStatus(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+
+	var status types.ContractStatus
+	assert.Nil(t, apis.GetContractStatus(dummyReq, &addr, &status))
+	assert.Equal(t, types.ContractStatus{Address: addr, Status: types.ContractActive}, status)
+
+	assert.Nil(t, db.SetContractsDestroyed(map[types.Address]uint64{addr: 7}))
+	assert.Nil(t, apis.GetContractStatus(dummyReq, &addr, &status))
+	assert.Equal(t, types.ContractDestroyed, status.Status)
+	assert.EqualValues(t, 7, status.DestroyedAt)
+
+	unregistered := types.NewAddress("0x0000000000000000000000000000000000000099")
+	assert.EqualError(t, apis.GetContractStatus(dummyReq, &unregistered, &status), "address is not registered")
+}
+
+func TestAddStorageLayout(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+
+	layout := `{"storage":[{"label":"storedData","offset":0,"slot":"0","type":"t_uint256"}],"types":{"t_uint256":{"encoding":"inplace","label":"uint256","numberOfBytes":"32"}}}`
+	output := `{"contracts":{"simplestorage.sol:SimpleStorage":{"storage-layout":` + layout + `}}}`
+
+	err := apis.AddStorageLayout(dummyReq, &StorageLayoutArgs{Layout: output}, nil)
+	assert.Equal(t, ErrNoAddress, err)
+	err = apis.AddStorageLayout(dummyReq, &StorageLayoutArgs{Address: &addr, Layout: output, Contract: "Other"}, nil)
+	assert.EqualError(t, err, "no storage layout found for contract Other")
+
+	assert.Nil(t, apis.AddStorageLayout(dummyReq, &StorageLayoutArgs{Address: &addr, Layout: output, Contract: "SimpleStorage"}, nil))
+	var stored string
+	assert.Nil(t, apis.GetStorageABI(dummyReq, &addr, &stored))
+	assert.JSONEq(t, layout, stored)
+}
+
+func TestGetStorage(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	layout := `{"storage":[{"label":"counter","offset":0,"slot":"0","type":"t_uint256"},{"label":"owner","offset":0,"slot":"1","type":"t_uint256"}],"types":{"t_uint256":{"encoding":"inplace","label":"uint256","numberOfBytes":"32"}}}`
+	assert.Nil(t, apis.AddStorageABI(dummyReq, &AddressWithData{Address: &addr, Data: layout}, nil))
+
+	raw := map[types.Hash]string{
+		types.NewHash("0x00"): "05",
+		types.NewHash("0x01"): "06",
+		types.NewHash("0xff"): "07",
+	}
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {Root: types.NewHash("0x01"), Storage: raw}}, 5))
+	block := uint64(5)
+
+	// without filters or paging, the whole storage is returned
+	var page StoragePage
+	assert.Nil(t, apis.GetStorage(dummyReq, &StorageArgs{Address: &addr, BlockNumber: &block}, &page))
+	assert.Equal(t, raw, page.Storage)
+	assert.EqualValues(t, 3, page.Total)
+	assert.EqualValues(t, 5, page.BlockNumber)
+
+	// slots are paged in order
+	assert.Nil(t, apis.GetStorage(dummyReq, &StorageArgs{Address: &addr, BlockNumber: &block, Options: &types.PageOptions{PageSize: 2, PageNumber: 1}}, &page))
+	assert.Equal(t, map[types.Hash]string{types.NewHash("0xff"): "07"}, page.Storage)
+	assert.EqualValues(t, 3, page.Total)
+
+	prefix := "0x" + strings.Repeat("0", 63)
+	assert.Nil(t, apis.GetStorage(dummyReq, &StorageArgs{Address: &addr, BlockNumber: &block, SlotPrefix: prefix}, &page))
+	assert.Len(t, page.Storage, 2)
+	assert.EqualValues(t, 2, page.Total)
+
+	assert.Nil(t, apis.GetStorage(dummyReq, &StorageArgs{Address: &addr, BlockNumber: &block, Variable: "owner"}, &page))
+	assert.Equal(t, map[types.Hash]string{types.NewHash("0x01"): "06"}, page.Storage)
+	assert.EqualValues(t, 1, page.Total)
+
+	err := apis.GetStorage(dummyReq, &StorageArgs{Address: &addr, BlockNumber: &block, SlotPrefix: "0xzz"}, &page)
+	assert.EqualError(t, err, "invalid slot prefix: 0xzz")
+	err = apis.GetStorage(dummyReq, &StorageArgs{Address: &addr, BlockNumber: &block, Variable: "missing"}, &page)
+	assert.EqualError(t, err, "storage variable missing is not in the storage layout")
+}
+
+func TestHasActivity(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{addr}, []*types.Block{block}))
+
+	var active bool
+	assert.Nil(t, apis.HasActivity(dummyReq, &AddressWithBlockNumbers{Address: &addr, FromBlock: 1, ToBlock: 1}, &active))
+	assert.True(t, active)
+	assert.Nil(t, apis.HasActivity(dummyReq, &AddressWithBlockNumbers{Address: &addr, FromBlock: 2, ToBlock: 5}, &active))
+	assert.False(t, active)
+
+	err := apis.HasActivity(dummyReq, &AddressWithBlockNumbers{FromBlock: 1, ToBlock: 1}, &active)
+	assert.Equal(t, ErrNoAddress, err)
+	err = apis.HasActivity(dummyReq, &AddressWithBlockNumbers{Address: &addr, FromBlock: 2, ToBlock: 1}, &active)
+	assert.EqualError(t, err, "end block is before start block")
+}
+
+func TestGetCounterparties(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{addr}, []*types.Block{block}))
+
+	var counterparties []*types.Counterparty
+	assert.Nil(t, apis.GetCounterparties(dummyReq, &CounterpartiesArgs{Address: &addr}, &counterparties))
+	assert.Equal(t, []*types.Counterparty{{
+		Address:        types.NewAddress("0x0000000000000000000000000000000000000009"),
+		FirstSeenBlock: 1,
+		LastSeenBlock:  1,
+		Interactions:   2,
+	}}, counterparties)
+
+	err := apis.GetCounterparties(dummyReq, &CounterpartiesArgs{}, &counterparties)
+	assert.Equal(t, ErrNoAddress, err)
+	err = apis.GetCounterparties(dummyReq, &CounterpartiesArgs{Address: &addr, Options: &types.CounterpartyQueryOptions{SortBy: "value"}}, &counterparties)
+	assert.EqualError(t, err, `invalid sort "value", expected recency or volume`)
+}
+
+func TestJobs(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, apis.DeleteAddress(dummyReq, &DeleteAddressArgs{Address: &addr, Purge: true}, nil))
+
+	var jobs []*types.Job
+	assert.Nil(t, apis.GetJobs(dummyReq, nil, &jobs))
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, types.DeleteAddressJob, jobs[0].Type)
+	assert.Equal(t, addr, jobs[0].Address)
+	assert.Equal(t, types.JobCompleted, jobs[0].Status)
+
+	var job types.Job
+	assert.Nil(t, apis.GetJob(dummyReq, &jobs[0].ID, &job))
+	assert.Equal(t, *jobs[0], job)
+
+	assert.Equal(t, database.ErrJobNotFailed, apis.RetryJob(dummyReq, &jobs[0].ID, nil))
+
+	unknown := "deleteAddress-100"
+	assert.Equal(t, database.ErrNotFound, apis.GetJob(dummyReq, &unknown, &job))
+	assert.Equal(t, database.ErrNotFound, apis.RetryJob(dummyReq, &unknown, nil))
+}
+
+func TestDeleteAddress_WithoutPurge(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, apis.DeleteAddress(dummyReq, &DeleteAddressArgs{Address: &addr}, nil))
+
+	var addresses []types.Address
+	assert.Nil(t, apis.GetAddresses(dummyReq, nil, &addresses))
+	assert.Empty(t, addresses)
+	var jobs []*types.Job
+	assert.Nil(t, apis.GetJobs(dummyReq, nil, &jobs))
+	assert.Empty(t, jobs)
+
+	assert.Equal(t, ErrNoAddress, apis.DeleteAddress(dummyReq, &DeleteAddressArgs{}, nil))
+}
+
+func TestGetProcessingJournal(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, db.WriteJournalEntries([]*types.JournalEntry{
+		{BlockNumber: 1, Stage: types.IngestStage, Timestamp: 10, Duration: 5},
+		{BlockNumber: 2, Stage: types.IngestStage, Timestamp: 11, Duration: 500, Errors: []string{"node unavailable"}},
+		{BlockNumber: 2, Stage: types.FilterStage, Timestamp: 12, Duration: 20, TokenRecords: 3},
+		{BlockNumber: 3, Stage: types.IngestStage, Timestamp: 13, Duration: 5},
+	}))
+
+	var entries []*types.JournalEntry
+	assert.Nil(t, apis.GetProcessingJournal(dummyReq, &JournalArgs{}, &entries))
+	assert.Len(t, entries, 4)
+	assert.EqualValues(t, 3, entries[0].BlockNumber)
+	// later entries for the same block come first
+	assert.Equal(t, types.FilterStage, entries[1].Stage)
+
+	args := &JournalArgs{Options: &types.PageOptions{BeginBlockNumber: big.NewInt(2), EndBlockNumber: big.NewInt(2)}}
+	assert.Nil(t, apis.GetProcessingJournal(dummyReq, args, &entries))
+	assert.Len(t, entries, 2)
+
+	args = &JournalArgs{JournalQuery: types.JournalQuery{Stage: types.IngestStage, MinDuration: 100}}
+	assert.Nil(t, apis.GetProcessingJournal(dummyReq, args, &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, []string{"node unavailable"}, entries[0].Errors)
+
+	args = &JournalArgs{JournalQuery: types.JournalQuery{ErrorsOnly: true}}
+	assert.Nil(t, apis.GetProcessingJournal(dummyReq, args, &entries))
+	assert.Len(t, entries, 1)
+
+	args = &JournalArgs{JournalQuery: types.JournalQuery{Stage: "unknown"}}
+	assert.EqualError(t, apis.GetProcessingJournal(dummyReq, args, &entries), "invalid journal stage")
+}
+
+// fakeBackfiller tracks backfills without running them
+type fakeBackfiller struct {
+	jobs []*types.Job
+}
+
+func (f *fakeBackfiller) Backfill(from, to uint64) (string, error) {
+	job := &types.Job{ID: fmt.Sprintf("backfill-%d", len(f.jobs)+1), Type: types.BackfillJob, StartBlock: from, EndBlock: to, Status: types.JobFailed, StartedAt: 1}
+	f.jobs = append(f.jobs, job)
+	return job.ID, nil
+}
+
+func (f *fakeBackfiller) Retry(id string) error {
+	for _, job := range f.jobs {
+		if job.ID == id {
+			job.Status = types.JobRunning
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+func (f *fakeBackfiller) GetJobs() []*types.Job {
+	return f.jobs
+}
+
+func (f *fakeBackfiller) GetJob(id string) (*types.Job, error) {
+	for _, job := range f.jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func TestBackfill(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	var id string
+	assert.Equal(t, ErrBackfillNotEnabled, apis.Backfill(dummyReq, &BlockRangeArgs{From: 1, To: 2}, &id))
+
+	apis.backfills = &fakeBackfiller{}
+	assert.Nil(t, apis.Backfill(dummyReq, &BlockRangeArgs{From: 1, To: 2}, &id))
+	assert.Equal(t, "backfill-1", id)
+
+	// backfill jobs are listed with the database jobs, newest first
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, apis.DeleteAddress(dummyReq, &DeleteAddressArgs{Address: &addr, Purge: true}, nil))
+	var jobs []*types.Job
+	assert.Nil(t, apis.GetJobs(dummyReq, nil, &jobs))
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, types.DeleteAddressJob, jobs[0].Type)
+	assert.Equal(t, types.BackfillJob, jobs[1].Type)
+
+	var job types.Job
+	assert.Nil(t, apis.GetJob(dummyReq, &id, &job))
+	assert.EqualValues(t, 1, job.StartBlock)
+	assert.EqualValues(t, 2, job.EndBlock)
+
+	assert.Nil(t, apis.RetryJob(dummyReq, &id, nil))
+	assert.Nil(t, apis.GetJob(dummyReq, &id, &job))
+	assert.Equal(t, types.JobRunning, job.Status)
+}
+
+// fakeExporter tracks exports without running them
+type fakeExporter struct {
+	fakeBackfiller
+}
+
+func (f *fakeExporter) Export(request *types.ExportRequest) (string, error) {
+	job := &types.Job{ID: fmt.Sprintf("export-%d", len(f.jobs)+1), Type: types.ExportJob, Address: request.Address, StartBlock: request.StartBlock, EndBlock: request.EndBlock, Status: types.JobFailed, StartedAt: 1}
+	f.jobs = append(f.jobs, job)
+	return job.ID, nil
+}
+
+func TestExport(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	var id string
+	request := &types.ExportRequest{Address: addr, StartBlock: 1, EndBlock: 2}
+	assert.Equal(t, ErrExportNotEnabled, apis.Export(dummyReq, request, &id))
+
+	apis.backfills = &fakeBackfiller{}
+	apis.exports = &fakeExporter{}
+	assert.Nil(t, apis.Export(dummyReq, request, &id))
+	assert.Equal(t, "export-1", id)
+	var backfillID string
+	assert.Nil(t, apis.Backfill(dummyReq, &BlockRangeArgs{From: 1, To: 2}, &backfillID))
+
+	// export jobs are listed with the backfill jobs, and found by their ID
+	var jobs []*types.Job
+	assert.Nil(t, apis.GetJobs(dummyReq, nil, &jobs))
+	assert.Len(t, jobs, 2)
+	var job types.Job
+	assert.Nil(t, apis.GetJob(dummyReq, &id, &job))
+	assert.Equal(t, types.ExportJob, job.Type)
+	assert.Equal(t, addr, job.Address)
+
+	assert.Nil(t, apis.RetryJob(dummyReq, &id, nil))
+	assert.Nil(t, apis.GetJob(dummyReq, &id, &job))
+	assert.Equal(t, types.JobRunning, job.Status)
+	assert.Nil(t, apis.GetJob(dummyReq, &backfillID, &job))
+	assert.Equal(t, types.JobFailed, job.Status)
+}
+
+// fakeMatcher tracks template assignments by code without running them
+type fakeMatcher struct {
+	fakeBackfiller
+}
+
+func (f *fakeMatcher) Assign(request *types.CodeMatchRequest) (string, error) {
+	job := &types.Job{ID: fmt.Sprintf("assignTemplateByCode-%d", len(f.jobs)+1), Type: types.CodeMatchJob, Template: request.Template, Status: types.JobFailed, StartedAt: 1}
+	f.jobs = append(f.jobs, job)
+	return job.ID, nil
+}
+
+func TestAssignTemplateByCode(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	var id string
+	request := &types.CodeMatchRequest{Template: "token", Address: addr}
+	assert.Equal(t, ErrCodeMatchNotEnabled, apis.AssignTemplateByCode(dummyReq, request, &id))
+
+	apis.matcher = &fakeMatcher{}
+	assert.Nil(t, apis.AssignTemplateByCode(dummyReq, request, &id))
+	assert.Equal(t, "assignTemplateByCode-1", id)
+
+	// assignment jobs are listed with the other jobs, found by their ID and
+	// retried
+	var jobs []*types.Job
+	assert.Nil(t, apis.GetJobs(dummyReq, nil, &jobs))
+	assert.Len(t, jobs, 1)
+	var job types.Job
+	assert.Nil(t, apis.GetJob(dummyReq, &id, &job))
+	assert.Equal(t, "token", job.Template)
+	assert.Nil(t, apis.RetryJob(dummyReq, &id, nil))
+	assert.Nil(t, apis.GetJob(dummyReq, &id, &job))
+	assert.Equal(t, types.JobRunning, job.Status)
+}
+
+// fakeVerifier tracks verifications without running them, reporting a
+// mismatch for each
+type fakeVerifier struct {
+	fakeBackfiller
+}
+
+func (f *fakeVerifier) Verify(from, to uint64) (string, error) {
+	job := &types.Job{ID: fmt.Sprintf("verifyIntegrity-%d", len(f.jobs)+1), Type: types.IntegrityJob, StartBlock: from, EndBlock: to, Status: types.JobCompleted, StartedAt: 1}
+	f.jobs = append(f.jobs, job)
+	return job.ID, nil
+}
+
+func (f *fakeVerifier) GetReport(id string) (*types.IntegrityReport, error) {
+	job, err := f.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	return &types.IntegrityReport{
+		JobID:         job.ID,
+		StartBlock:    job.StartBlock,
+		EndBlock:      job.EndBlock,
+		Verified:      1,
+		MismatchCount: 1,
+		Mismatches:    []*types.ChecksumMismatch{{Kind: types.BlockDocument, ID: "1", BlockNumber: 1}},
+		Complete:      true,
+	}, nil
+}
+
+func TestVerifyIntegrity(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	var id string
+	assert.Equal(t, ErrIntegrityNotEnabled, apis.VerifyIntegrity(dummyReq, &BlockRangeArgs{From: 1, To: 2}, &id))
+
+	apis.integrity = &fakeVerifier{}
+	assert.Nil(t, apis.VerifyIntegrity(dummyReq, &BlockRangeArgs{From: 1, To: 2}, &id))
+	assert.Equal(t, "verifyIntegrity-1", id)
+
+	var report types.IntegrityReport
+	assert.Nil(t, apis.GetIntegrityReport(dummyReq, &id, &report))
+	assert.Equal(t, id, report.JobID)
+	assert.EqualValues(t, 2, report.EndBlock)
+	assert.Len(t, report.Mismatches, 1)
+	missing := "verifyIntegrity-2"
+	assert.Equal(t, database.ErrNotFound, apis.GetIntegrityReport(dummyReq, &missing, &report))
+
+	// verification jobs are listed with the other jobs, and found by their ID
+	var jobs []*types.Job
+	assert.Nil(t, apis.GetJobs(dummyReq, nil, &jobs))
+	assert.Len(t, jobs, 1)
+	var job types.Job
+	assert.Nil(t, apis.GetJob(dummyReq, &id, &job))
+	assert.Equal(t, types.IntegrityJob, job.Type)
+}
+
+// fakeInferrer tracks inferences without running them, each proposing a
+// layout with one variable, once completed
+type fakeInferrer struct {
+	fakeBackfiller
+	proposals map[string]*types.LayoutProposal
+}
+
+func (f *fakeInferrer) Infer(address types.Address) (string, error) {
+	job := &types.Job{ID: fmt.Sprintf("inferStorageLayout-%d", len(f.jobs)+1), Type: types.InferLayoutJob, Address: address, Status: types.JobRunning, StartedAt: 1}
+	f.jobs = append(f.jobs, job)
+	f.proposals[job.ID] = &types.LayoutProposal{JobID: job.ID, Address: address, Variables: []*types.InferredVariable{}}
+	return job.ID, nil
+}
+
+func (f *fakeInferrer) complete(id string) {
+	proposal := f.proposals[id]
+	proposal.Variables = []*types.InferredVariable{{Label: "slot0", Slot: 0, Type: "uint256", Confidence: types.LowConfidence}}
+	proposal.Layout = `{"storage":[{"label":"slot0","slot":"0","type":"t_uint256"}],"types":{"t_uint256":{"encoding":"inplace","label":"uint256","numberOfBytes":"32"}}}`
+	proposal.Complete = true
+}
+
+func (f *fakeInferrer) GetProposal(id string) (*types.LayoutProposal, error) {
+	proposal, ok := f.proposals[id]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	copied := *proposal
+	return &copied, nil
+}
+
+func (f *fakeInferrer) Accepted(id string) error {
+	f.proposals[id].Accepted = true
+	return nil
+}
+
+func TestInferStorageLayout(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	var id string
+	assert.Equal(t, ErrLayoutInferenceNotEnabled, apis.InferStorageLayout(dummyReq, &addr, &id))
+
+	inferrer := &fakeInferrer{proposals: make(map[string]*types.LayoutProposal)}
+	apis.inference = inferrer
+	assert.Nil(t, apis.InferStorageLayout(dummyReq, &addr, &id))
+	assert.Equal(t, "inferStorageLayout-1", id)
+
+	// inference jobs are listed with the other jobs, and found by their ID
+	var jobs []*types.Job
+	assert.Nil(t, apis.GetJobs(dummyReq, nil, &jobs))
+	assert.Len(t, jobs, 1)
+	var job types.Job
+	assert.Nil(t, apis.GetJob(dummyReq, &id, &job))
+	assert.Equal(t, types.InferLayoutJob, job.Type)
+	assert.Equal(t, addr, job.Address)
+
+	// a proposal can only be accepted once the inference completes
+	var proposal types.LayoutProposal
+	assert.Nil(t, apis.GetLayoutProposal(dummyReq, &id, &proposal))
+	assert.False(t, proposal.Complete)
+	assert.EqualError(t, apis.AcceptLayoutProposal(dummyReq, &id, nil), "storage layout inference has not completed")
+
+	inferrer.complete(id)
+	assert.Nil(t, apis.AcceptLayoutProposal(dummyReq, &id, nil))
+	layout, err := db.GetStorageLayout(addr)
+	assert.Nil(t, err)
+	assert.Equal(t, inferrer.proposals[id].Layout, layout)
+	assert.Nil(t, apis.GetLayoutProposal(dummyReq, &id, &proposal))
+	assert.True(t, proposal.Accepted)
+
+	missing := "inferStorageLayout-2"
+	assert.Equal(t, database.ErrNotFound, apis.GetLayoutProposal(dummyReq, &missing, &proposal))
+}
+
+func TestDeleteBlockRange(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {}}, 3))
+
+	var deletion types.BlockRangeDeletion
+	assert.Equal(t, ErrInvalidBlockRange, apis.DeleteBlockRange(dummyReq, &DeleteBlockRangeArgs{From: 4, To: 2}, &deletion))
+
+	assert.Nil(t, apis.DeleteBlockRange(dummyReq, &DeleteBlockRangeArgs{From: 2, To: 4, DryRun: true}, &deletion))
+	assert.True(t, deletion.DryRun)
+	assert.EqualValues(t, 1, deletion.Documents["storage"])
+	assert.EqualValues(t, 1, deletion.Total)
+
+	assert.Nil(t, apis.DeleteBlockRange(dummyReq, &DeleteBlockRangeArgs{From: 2, To: 4}, &deletion))
+	assert.False(t, deletion.DryRun)
+	assert.EqualValues(t, 1, deletion.Total)
+	assert.Nil(t, apis.DeleteBlockRange(dummyReq, &DeleteBlockRangeArgs{From: 2, To: 4, DryRun: true}, &deletion))
+	assert.EqualValues(t, 0, deletion.Total)
+}
+
+func TestWebhooks(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+
+	var added AddWebhookResp
+	webhook := &types.Webhook{ID: "ignored", URL: "https://example.com/hook", Address: &addr, EventSignature: "Transfer(address,address,uint256)"}
+	assert.Nil(t, apis.AddWebhook(dummyReq, webhook, &added))
+	assert.Len(t, added.Id, 32)
+
+	// a secret is generated for the webhook, and only returned when it is
+	// added
+	assert.Len(t, added.Secret, 64)
+	stored, err := db.GetWebhooks()
+	assert.Nil(t, err)
+	assert.Equal(t, added.Secret, stored[0].Secret)
+	var webhooks []*types.Webhook
+	assert.Nil(t, apis.GetWebhooks(dummyReq, nil, &webhooks))
+	assert.Len(t, webhooks, 1)
+	assert.Equal(t, &types.Webhook{ID: added.Id, URL: "https://example.com/hook", Address: &addr, EventSignature: "Transfer(address,address,uint256)"}, webhooks[0])
+
+	// or the secret given is kept
+	var signed AddWebhookResp
+	assert.Nil(t, apis.AddWebhook(dummyReq, &types.Webhook{URL: "https://example.com/signed", Secret: "shared"}, &signed))
+	assert.Empty(t, signed.Secret)
+	stored, err = db.GetWebhooks()
+	assert.Nil(t, err)
+	assert.Len(t, stored, 2)
+	for _, webhook := range stored {
+		if webhook.ID == signed.Id {
+			assert.Equal(t, "shared", webhook.Secret)
+		}
+	}
+	assert.Nil(t, apis.DeleteWebhook(dummyReq, &signed.Id, nil))
+	assert.Nil(t, apis.GetWebhooks(dummyReq, nil, &webhooks))
+
+	err = apis.AddWebhook(dummyReq, &types.Webhook{URL: "example.com"}, &added)
+	assert.EqualError(t, err, "webhook URL must be an absolute http or https URL")
+
+	assert.Nil(t, apis.DeleteWebhook(dummyReq, &webhooks[0].ID, nil))
+	assert.Equal(t, database.ErrNotFound, apis.DeleteWebhook(dummyReq, &webhooks[0].ID, nil))
+	assert.Nil(t, apis.GetWebhooks(dummyReq, nil, &webhooks))
+	assert.Empty(t, webhooks)
+}
+
+func TestLegalHolds(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+
+	var id string
+	hold := &types.LegalHold{ID: "ignored", Address: &addr, Reason: "litigation"}
+	assert.Nil(t, apis.AddLegalHold(dummyReq, hold, &id))
+	assert.Len(t, id, 32)
+
+	var holds []*types.LegalHold
+	assert.Nil(t, apis.GetLegalHolds(dummyReq, nil, &holds))
+	assert.Len(t, holds, 1)
+	assert.Equal(t, id, holds[0].ID)
+	assert.Equal(t, &addr, holds[0].Address)
+	assert.NotZero(t, holds[0].CreatedAt)
+
+	err := apis.AddLegalHold(dummyReq, &types.LegalHold{Address: &addr}, &id)
+	assert.EqualError(t, err, "legal hold reason not provided")
+
+	assert.Nil(t, apis.ReleaseLegalHold(dummyReq, &holds[0].ID, nil))
+	assert.Equal(t, database.ErrNotFound, apis.ReleaseLegalHold(dummyReq, &holds[0].ID, nil))
+	assert.Nil(t, apis.GetLegalHolds(dummyReq, nil, &holds))
+	assert.Empty(t, holds)
+}
+
+// fakeRuleReloader fails to reload while failing is set
+type fakeRuleReloader struct {
+	reloads int
+	failing bool
+}
+
+func (f *fakeRuleReloader) ReloadTokenRules() error {
+	if f.failing {
+		return errors.New("event WalletRemoved with parameter wallet not found in template WalletFactory")
+	}
+	f.reloads++
+	return nil
+}
+
+func TestTokenRules(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	reloader := &fakeRuleReloader{}
+	apis.rules = reloader
+
+	var id string
+	rule := &types.TokenRule{ID: "ignored", Scope: types.ExternalScope, TemplateName: "ERC20", EIP165: "36372b07"}
+	assert.Nil(t, apis.AddTokenRule(dummyReq, rule, &id))
+	assert.Len(t, id, 32)
+	assert.Equal(t, 1, reloader.reloads)
+
+	var rules []*types.TokenRule
+	assert.Nil(t, apis.GetTokenRules(dummyReq, nil, &rules))
+	assert.Len(t, rules, 1)
+	assert.Equal(t, id, rules[0].ID)
+	assert.Equal(t, "ERC20", rules[0].TemplateName)
+	assert.NotZero(t, rules[0].CreatedAt)
+
+	err := apis.AddTokenRule(dummyReq, &types.TokenRule{Scope: types.ExternalScope}, &id)
+	assert.EqualError(t, err, "token rule template name not provided")
+
+	// a rule that can't be applied is not kept
+	reloader.failing = true
+	walletRule := &types.TokenRule{Scope: types.EventScope, TemplateName: "Wallet", EventTemplate: "WalletFactory", Event: "WalletRemoved", Parameter: "wallet"}
+	err = apis.AddTokenRule(dummyReq, walletRule, &id)
+	assert.EqualError(t, err, "event WalletRemoved with parameter wallet not found in template WalletFactory")
+	assert.Nil(t, apis.GetTokenRules(dummyReq, nil, &rules))
+	assert.Len(t, rules, 1)
+	reloader.failing = false
+
+	assert.Nil(t, apis.DeleteTokenRule(dummyReq, &rules[0].ID, nil))
+	assert.Equal(t, 2, reloader.reloads)
+	assert.Equal(t, database.ErrNotFound, apis.DeleteTokenRule(dummyReq, &rules[0].ID, nil))
+	assert.Nil(t, apis.GetTokenRules(dummyReq, nil, &rules))
+	assert.Empty(t, rules)
+
+	apis.headersOnly = true
+	assert.Equal(t, ErrContractIndexingDisabled, apis.AddTokenRule(dummyReq, rule, &id))
 }
 
 func TestAPIParsing(t *testing.T) {
@@ -130,6 +805,58 @@ func TestAPIParsing(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "event valueSet(uint256 _value)", eventsResp.Events[0].Sig)
 	assert.Equal(t, big.NewInt(1000), eventsResp.Events[0].ParsedData["_value"])
+
+	// Test GetEventsByTopics parse event, across all contracts.
+	eventsResp = &EventsResp{}
+	err = apis.GetEventsByTopics(dummyReq, &EventsByTopicsArgs{EventSignature: "valueSet(uint256)"}, eventsResp)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), eventsResp.Total)
+	assert.Equal(t, "event valueSet(uint256 _value)", eventsResp.Events[0].Sig)
+	assert.Equal(t, big.NewInt(1000), eventsResp.Events[0].ParsedData["_value"])
+
+	otherTopic := types.NewHash("0x01")
+	err = apis.GetEventsByTopics(dummyReq, &EventsByTopicsArgs{Address: &addr, Topics: []*types.Hash{&otherTopic}}, eventsResp)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), eventsResp.Total)
+	assert.Empty(t, eventsResp.Events)
+
+	err = apis.GetEventsByTopics(dummyReq, &EventsByTopicsArgs{Address: &addr}, eventsResp)
+	assert.EqualError(t, err, "event signature or topic0 not provided")
+}
+
+func TestEventSeverity(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, apis.AddABI(dummyReq, &AddressWithData{&addr, validABI}, nil))
+
+	err := apis.SetContractSeverityRules(dummyReq, &AddressWithSeverityRules{Address: &addr, Rules: types.SeverityRules{{Event: "valueSet", Severity: "urgent"}}}, nil)
+	assert.EqualError(t, err, "severity rule severity must be one of info, warning or critical")
+	err = apis.SetContractSeverityRules(dummyReq, &AddressWithSeverityRules{Address: &addr, Rules: types.SeverityRules{{Event: "valueRemoved", Severity: types.InfoSeverity}}}, nil)
+	assert.EqualError(t, err, "event valueRemoved not found in the contract ABI")
+
+	rules := types.SeverityRules{{Event: "valueSet", Parameter: "_value", Operator: types.GreaterOrEqualOperator, Value: "1000", Severity: types.CriticalSeverity}}
+	assert.Nil(t, apis.SetContractSeverityRules(dummyReq, &AddressWithSeverityRules{Address: &addr, Rules: rules}, nil))
+	var set types.SeverityRules
+	assert.Nil(t, apis.GetContractSeverityRules(dummyReq, &addr, &set))
+	assert.Equal(t, rules, set)
+
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{addr}, []*types.Block{block}))
+
+	eventsResp := &EventsResp{}
+	assert.Nil(t, apis.GetEventsBySeverity(dummyReq, &EventsBySeverityArgs{Severity: types.CriticalSeverity}, eventsResp))
+	assert.Equal(t, uint64(1), eventsResp.Total)
+	assert.Equal(t, big.NewInt(1000), eventsResp.Events[0].ParsedData["_value"])
+	assert.Nil(t, apis.GetEventsBySeverity(dummyReq, &EventsBySeverityArgs{Address: &addr, Severity: types.WarningSeverity}, eventsResp))
+	assert.Empty(t, eventsResp.Events)
+	err = apis.GetEventsBySeverity(dummyReq, &EventsBySeverityArgs{Address: &addr}, eventsResp)
+	assert.EqualError(t, err, "severity must be one of info, warning or critical")
+
+	var counts types.SeverityCounts
+	assert.Nil(t, apis.GetEventSeverityCounts(dummyReq, &AddressWithOptions{Address: &addr}, &counts))
+	assert.Equal(t, types.SeverityCounts{types.InfoSeverity: 0, types.WarningSeverity: 0, types.CriticalSeverity: 1}, counts)
 }
 
 func TestAddAddressWithFrom(t *testing.T) {
@@ -149,3 +876,290 @@ func TestAddAddressWithFrom(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, from-1, lastFiltered)
 }
+
+func TestGetBlockForTransaction(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+
+	var summary BlockSummary
+	err := apis.GetBlockForTransaction(dummyReq, &tx2.Hash, &summary)
+	assert.Nil(t, err)
+	assert.Equal(t, BlockSummary{Number: 1, Hash: block.Hash, ParentHash: block.ParentHash, TransactionCount: 3}, summary)
+
+	empty := types.NewHash("")
+	err = apis.GetBlockForTransaction(dummyReq, &empty, &summary)
+	assert.EqualError(t, err, "no transaction hash given")
+}
+
+func TestGetBlocksByTimeRange(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	blocks := []*types.Block{
+		{Hash: types.NewHash("0x01"), Number: 1, Timestamp: 1600000000},
+		{Hash: types.NewHash("0x02"), Number: 2, Timestamp: 1600000005, Transactions: []types.Hash{tx1.Hash}},
+		{Hash: types.NewHash("0x03"), Number: 3, Timestamp: 1600000010},
+	}
+	assert.Nil(t, db.WriteBlocks(blocks))
+
+	var resp BlockSummariesResp
+	err := apis.GetBlocksByTimeRange(dummyReq, &TimeRangeWithOptions{From: 1600000001, To: 1600000010, Options: &types.PageOptions{PageSize: 1}}, &resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, resp.Total)
+	assert.Equal(t, []BlockSummary{{
+		Number:           2,
+		Hash:             blocks[1].Hash,
+		Timestamp:        1600000005,
+		TimestampISO:     "2020-09-13T12:26:45Z",
+		TransactionCount: 1,
+	}}, resp.Blocks)
+
+	err = apis.GetBlocksByTimeRange(dummyReq, &TimeRangeWithOptions{From: 1700000000, To: 1800000000}, &resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, resp.Total)
+	assert.Empty(t, resp.Blocks)
+
+	err = apis.GetBlocksByTimeRange(dummyReq, &TimeRangeWithOptions{From: 2, To: 1}, &resp)
+	assert.EqualError(t, err, "end timestamp is before start timestamp")
+}
+
+func TestGetTransactionCallTree(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	nested := &types.Transaction{
+		Hash:          types.NewHash("0x01"),
+		BlockNumber:   1,
+		InternalCalls: []*types.InternalCall{{To: addr, Type: "CALL"}, {To: addr, Type: "STATICCALL"}},
+		CallTree: []*types.CallFrame{
+			{InternalCall: types.InternalCall{To: addr, Type: "CALL"}, Calls: []*types.CallFrame{
+				{InternalCall: types.InternalCall{To: addr, Type: "STATICCALL"}, Calls: []*types.CallFrame{}},
+			}},
+		},
+	}
+	noCalls := &types.Transaction{Hash: types.NewHash("0x02"), BlockNumber: 1}
+	// indexed before call trees were stored
+	untraced := &types.Transaction{Hash: types.NewHash("0x03"), BlockNumber: 1, InternalCalls: nested.InternalCalls}
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{nested, noCalls, untraced}))
+
+	var tree types.CallTree
+	assert.Nil(t, apis.GetTransactionCallTree(dummyReq, &nested.Hash, &tree))
+	assert.Equal(t, nested.Hash, tree.TransactionHash)
+	assert.Equal(t, nested.CallTree, tree.Calls)
+
+	assert.Nil(t, apis.GetTransactionCallTree(dummyReq, &noCalls.Hash, &tree))
+	assert.Equal(t, noCalls.Hash, tree.TransactionHash)
+	assert.Empty(t, tree.Calls)
+
+	err := apis.GetTransactionCallTree(dummyReq, &untraced.Hash, &tree)
+	assert.EqualError(t, err, "no call tree stored, as the transaction was indexed before call trees were")
+
+	unknown := types.NewHash("0x04")
+	assert.NotNil(t, apis.GetTransactionCallTree(dummyReq, &unknown, &tree))
+	empty := types.NewHash("")
+	assert.EqualError(t, apis.GetTransactionCallTree(dummyReq, &empty, &tree), "no transaction hash given")
+}
+
+func TestGetTransactionsForBlockRange(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	txs := make([]*types.Transaction, 3)
+	for i, tx := range []*types.Transaction{tx1, tx2, tx3} {
+		indexed := *tx
+		indexed.Index = uint64(i)
+		txs[i] = &indexed
+	}
+	later := &types.Transaction{Hash: types.NewHash("0x02"), BlockNumber: 2, Timestamp: 2000}
+	assert.Nil(t, db.WriteTransactions(append(txs, later)))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+
+	// the range is limited to the last persisted block
+	var resp TransactionSummariesResp
+	err := apis.GetTransactionsForBlockRange(dummyReq, &BlockRangeWithOptions{From: 1, To: 10000, Options: &types.PageOptions{PageSize: 2, PageNumber: 1}}, &resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, resp.Total)
+	assert.Equal(t, []TransactionSummary{{Hash: tx3.Hash, BlockNumber: 1, Index: 2, From: tx3.From, To: addr}}, resp.Transactions)
+
+	err = apis.GetTransactionsForBlockRange(dummyReq, &BlockRangeWithOptions{From: 2, To: 10}, &resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, resp.Total)
+	assert.Empty(t, resp.Transactions)
+
+	err = apis.GetTransactionsForBlockRange(dummyReq, &BlockRangeWithOptions{From: 2, To: 1}, &resp)
+	assert.EqualError(t, err, "end block is before start block")
+}
+
+func TestGetAddressTotals(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, db.AddAddresses([]types.Address{addr}))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{addr}, []*types.Block{block}))
+
+	var totals AddressTotals
+	err := apis.GetAddressTotals(dummyReq, &AddressWithOptions{Address: &addr}, &totals)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, totals.Transactions)
+	assert.EqualValues(t, 1, totals.InternalTransactions)
+	assert.EqualValues(t, 1, totals.Events)
+
+	err = apis.GetAddressTotals(dummyReq, &AddressWithOptions{}, &totals)
+	assert.Equal(t, ErrNoAddress, err)
+}
+
+type fakeAnomalyReporter []*types.Anomaly
+
+func (f fakeAnomalyReporter) Anomalies() []*types.Anomaly {
+	return f
+}
+
+func TestGetAnomalies(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+
+	var anomalies []*types.Anomaly
+	err := apis.GetAnomalies(dummyReq, &NullArgs{}, &anomalies)
+	assert.Equal(t, ErrAnomalyDetectionNotEnabled, err)
+
+	expected := fakeAnomalyReporter{{Address: addr, Metric: types.EventsMetric, Kind: types.SilenceAnomaly, Average: 12.5}}
+	apis.anomalies = expected
+	err = apis.GetAnomalies(dummyReq, &NullArgs{}, &anomalies)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Anomaly(expected), anomalies)
+}
+
+func TestTimestamps(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, db.AddAddresses([]types.Address{addr}))
+
+	// tx2 has its own timestamp, tx3 and its event were stored without one so
+	// it is taken from the block
+	timestampedBlock := *block
+	timestampedBlock.Timestamp = 1600000000
+	timestampedTx := *tx2
+	timestampedTx.Timestamp = 1500000000
+	untimestampedTx := *tx3
+	event := *tx3.Events[0]
+	event.BlockNumber = 1
+	untimestampedTx.Events = []*types.Event{&event}
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, &timestampedTx, &untimestampedTx}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{&timestampedBlock}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{addr}, []*types.Block{&timestampedBlock}))
+
+	var parsedTx types.ParsedTransaction
+	assert.Nil(t, apis.GetTransaction(dummyReq, &tx2.Hash, &parsedTx))
+	assert.EqualValues(t, 1500000000, parsedTx.Timestamp)
+	assert.Equal(t, "2017-07-14T02:40:00Z", parsedTx.TimestampISO)
+
+	assert.Nil(t, apis.GetTransaction(dummyReq, &tx3.Hash, &parsedTx))
+	assert.Equal(t, "2020-09-13T12:26:40Z", parsedTx.TimestampISO)
+	assert.Equal(t, "2020-09-13T12:26:40Z", parsedTx.ParsedEvents[0].TimestampISO)
+
+	var eventsResp EventsResp
+	assert.Nil(t, apis.GetAllEventsFromAddress(dummyReq, &AddressWithOptions{Address: &addr}, &eventsResp))
+	assert.EqualValues(t, 1600000000, eventsResp.Events[0].Timestamp)
+	assert.Equal(t, "2020-09-13T12:26:40Z", eventsResp.Events[0].TimestampISO)
+
+	var summary BlockSummary
+	assert.Nil(t, apis.GetBlockForTransaction(dummyReq, &tx2.Hash, &summary))
+	assert.Equal(t, "2020-09-13T12:26:40Z", summary.TimestampISO)
+}
+
+func TestParseStorageHistory(t *testing.T) {
+	// the layout is out of slot order, which the parser sorts
+	layout := types.SolidityStorageDocument{
+		Storage: types.SolidityStorageEntries{
+			{Label: "b", Slot: 1, Type: "t_uint256"},
+			{Label: "a", Slot: 0, Type: "t_uint256"},
+		},
+		Types: map[string]types.SolidityTypeEntry{
+			"t_uint256": {Encoding: "inplace", Label: "uint256", NumberOfBytes: 32},
+		},
+	}
+
+	var results []*types.StorageResult
+	for block := uint64(100); block > 0; block-- {
+		results = append(results, &types.StorageResult{
+			BlockNumber: block,
+			Storage: map[types.Hash]string{
+				types.NewHash("0x00"): fmt.Sprintf("%x", block),
+				types.NewHash("0x01"): "2a",
+			},
+		})
+	}
+	// missing storage is skipped
+	results[10] = nil
+
+	states, err := parseStorageHistory(results, layout, nil)
+	assert.Nil(t, err)
+	assert.Len(t, states, 99)
+	for i, state := range states {
+		expected := uint64(100 - i)
+		if i >= 10 {
+			expected--
+		}
+		assert.Equal(t, expected, state.BlockNumber)
+		assert.Equal(t, "a", state.HistoricStorage[0].VarName)
+		assert.Equal(t, fmt.Sprint(expected), fmt.Sprint(state.HistoricStorage[0].Value))
+	}
+
+	states, err = parseStorageHistory(nil, layout, nil)
+	assert.Nil(t, err)
+	assert.Len(t, states, 0)
+}
+
+// fakeIngestionController tracks whether ingestion is paused, and which
+// contracts are throttled
+type fakeIngestionController struct {
+	paused    bool
+	costs     []*types.ContractCost
+	throttled map[types.Address]bool
+
+	registered     types.Address
+	refilteredFrom uint64
+}
+
+func (f *fakeIngestionController) PauseIngestion(ctx context.Context) error {
+	f.paused = true
+	return nil
+}
+
+func (f *fakeIngestionController) ResumeIngestion() {
+	f.paused = false
+}
+
+func (f *fakeIngestionController) ContractCosts() ([]*types.ContractCost, error) {
+	return f.costs, nil
+}
+
+func (f *fakeIngestionController) ThrottleContract(address types.Address, throttled bool) error {
+	if f.throttled == nil {
+		f.throttled = make(map[types.Address]bool)
+	}
+	f.throttled[address] = throttled
+	return nil
+}
+
+func (f *fakeIngestionController) RefilterContract(ctx context.Context, address types.Address, from uint64) error {
+	if address != f.registered {
+		return database.ErrNotFound
+	}
+	f.refilteredFrom = from
+	return nil
+}
+
+func TestPauseIngestion(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Equal(t, ErrIngestionControlNotEnabled, apis.PauseIngestion(dummyReq, nil, nil))
+	assert.Equal(t, ErrIngestionControlNotEnabled, apis.ResumeIngestion(dummyReq, nil, nil))
+
+	ingestion := &fakeIngestionController{}
+	apis.ingestion = ingestion
+	assert.Nil(t, apis.PauseIngestion(dummyReq, nil, nil))
+	assert.True(t, ingestion.paused)
+	assert.Nil(t, apis.ResumeIngestion(dummyReq, nil, nil))
+	assert.False(t, ingestion.paused)
+}
@@ -0,0 +1,293 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"quorumengineering/quorum-report/types"
+)
+
+//go:generate go run ./bindgen -out ../../bindings
+
+// kinds of values in the API description
+const (
+	StringKind  = "string"
+	IntegerKind = "integer"
+	NumberKind  = "number"
+	BooleanKind = "boolean"
+	AnyKind     = "any"
+	ArrayKind   = "array"
+	MapKind     = "map"
+	// RefKind values are objects described in the types of the API
+	RefKind = "ref"
+)
+
+// APISpec describes the methods of the RPC API and the types they take and
+// return, so clients can be generated from it.
+type APISpec struct {
+	Services []*ServiceSpec      `json:"services"`
+	Types    map[string]*TypeSpec `json:"types"`
+}
+
+type ServiceSpec struct {
+	Name    string        `json:"name"`
+	Methods []*MethodSpec `json:"methods"`
+}
+
+type MethodSpec struct {
+	// Name is as sent in requests, e.g. "reporting.GetBlock"
+	Name string `json:"name"`
+	// Params and Result are nil if the method takes or returns nothing
+	Params *TypeRef `json:"params,omitempty"`
+	Result *TypeRef `json:"result,omitempty"`
+}
+
+// TypeRef is a value in the API, referring to the types of the API for objects
+type TypeRef struct {
+	Kind string `json:"kind"`
+	// Name of the type of RefKind values
+	Name string `json:"name,omitempty"`
+	// Elem is the type of the elements of arrays and the values of maps
+	Elem     *TypeRef `json:"elem,omitempty"`
+	Nullable bool     `json:"nullable,omitempty"`
+}
+
+type TypeSpec struct {
+	Fields []*FieldSpec `json:"fields"`
+	// Input types are sent in requests, where any field can be left out to
+	// take its zero value
+	Input bool `json:"input,omitempty"`
+}
+
+type FieldSpec struct {
+	Name string   `json:"name"`
+	Type *TypeRef `json:"type"`
+	// Optional fields may be left out
+	Optional bool `json:"optional,omitempty"`
+}
+
+var (
+	requestType   = reflect.TypeOf((*http.Request)(nil))
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+	nullArgsType  = reflect.TypeOf(NullArgs{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// apiServices are the services registered on the RPC server, by name
+var apiServices = []struct {
+	name string
+	api  interface{}
+}{
+	{"reporting", &RPCAPIs{}},
+	{"token", &TokenRPCAPIs{}},
+}
+
+// NewAPISpec describes the methods of the RPC services, as found by the RPC
+// server: exported methods taking a request, arguments and a reply.
+func NewAPISpec() (*APISpec, error) {
+	builder := &specBuilder{types: make(map[string]*TypeSpec), sources: make(map[string]reflect.Type)}
+	spec := &APISpec{Types: builder.types}
+	for _, service := range apiServices {
+		serviceSpec := &ServiceSpec{Name: service.name}
+		apiType := reflect.TypeOf(service.api)
+		for i := 0; i < apiType.NumMethod(); i++ {
+			method := apiType.Method(i)
+			mtype := method.Type
+			if mtype.NumIn() != 4 || mtype.In(1) != requestType || mtype.In(2).Kind() != reflect.Ptr ||
+				mtype.In(3).Kind() != reflect.Ptr || mtype.NumOut() != 1 || mtype.Out(0) != errorType {
+				continue
+			}
+			params, err := builder.ref(mtype.In(2).Elem())
+			if err != nil {
+				return nil, fmt.Errorf("params of %s.%s: %v", service.name, method.Name, err)
+			}
+			result, err := builder.ref(mtype.In(3).Elem())
+			if err != nil {
+				return nil, fmt.Errorf("result of %s.%s: %v", service.name, method.Name, err)
+			}
+			builder.markInput(params)
+			serviceSpec.Methods = append(serviceSpec.Methods, &MethodSpec{
+				Name:   service.name + "." + method.Name,
+				Params: params,
+				Result: result,
+			})
+		}
+		spec.Services = append(spec.Services, serviceSpec)
+	}
+	return spec, nil
+}
+
+// SortedTypes returns the names of the types in alphabetical order
+func (spec *APISpec) SortedTypes() []string {
+	names := make([]string, 0, len(spec.Types))
+	for name := range spec.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type specBuilder struct {
+	types map[string]*TypeSpec
+	// the Go type each type was described from, to catch names used twice
+	sources map[string]reflect.Type
+}
+
+// ref describes a Go type as it is marshalled to JSON, returning nil for
+// NullArgs
+func (b *specBuilder) ref(t reflect.Type) (*TypeRef, error) {
+	if t == nullArgsType {
+		return nil, nil
+	}
+	if t.Kind() == reflect.Ptr {
+		ref, err := b.ref(t.Elem())
+		if err != nil || ref == nil {
+			return ref, err
+		}
+		nullable := *ref
+		nullable.Nullable = true
+		return &nullable, nil
+	}
+
+	switch t {
+	case reflect.TypeOf(types.Address("")), reflect.TypeOf(types.Hash("")), reflect.TypeOf(types.HexData("")),
+		reflect.TypeOf(types.HexNumber(0)), reflect.TypeOf(time.Time{}):
+		return &TypeRef{Kind: StringKind}, nil
+	case reflect.TypeOf(big.Int{}):
+		return &TypeRef{Kind: IntegerKind}, nil
+	case reflect.TypeOf(types.ParsedData{}), reflect.TypeOf(json.RawMessage{}):
+		return &TypeRef{Kind: AnyKind}, nil
+	}
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return nil, fmt.Errorf("no description of how %v is marshalled", t)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &TypeRef{Kind: StringKind}, nil
+	case reflect.Bool:
+		return &TypeRef{Kind: BooleanKind}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &TypeRef{Kind: IntegerKind}, nil
+	case reflect.Float32, reflect.Float64:
+		return &TypeRef{Kind: NumberKind}, nil
+	case reflect.Interface:
+		return &TypeRef{Kind: AnyKind}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// base64
+			return &TypeRef{Kind: StringKind}, nil
+		}
+		elem, err := b.ref(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &TypeRef{Kind: ArrayKind, Elem: elem, Nullable: t.Kind() == reflect.Slice}, nil
+	case reflect.Map:
+		elem, err := b.ref(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &TypeRef{Kind: MapKind, Elem: elem, Nullable: true}, nil
+	case reflect.Struct:
+		if err := b.describe(t); err != nil {
+			return nil, err
+		}
+		return &TypeRef{Kind: RefKind, Name: t.Name()}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", t)
+}
+
+// markInput marks the types the value refers to as sent in requests
+func (b *specBuilder) markInput(ref *TypeRef) {
+	if ref == nil {
+		return
+	}
+	if ref.Elem != nil {
+		b.markInput(ref.Elem)
+	}
+	typeSpec, ok := b.types[ref.Name]
+	if ref.Kind != RefKind || !ok || typeSpec.Input {
+		return
+	}
+	typeSpec.Input = true
+	for _, field := range typeSpec.Fields {
+		b.markInput(field.Type)
+	}
+}
+
+// describe adds the fields of a struct to the types of the API
+func (b *specBuilder) describe(t reflect.Type) error {
+	if source, ok := b.sources[t.Name()]; ok {
+		if source != t {
+			return fmt.Errorf("type name %s used for both %v and %v", t.Name(), source, t)
+		}
+		return nil
+	}
+	b.sources[t.Name()] = t
+	typeSpec := &TypeSpec{}
+	b.types[t.Name()] = typeSpec
+
+	fields, err := b.fields(t)
+	if err != nil {
+		return err
+	}
+	typeSpec.Fields = fields
+	return nil
+}
+
+// fields lists the fields of a struct as they are marshalled, including the
+// fields of embedded structs
+func (b *specBuilder) fields(t reflect.Type) ([]*FieldSpec, error) {
+	var fields []*FieldSpec
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			embedded, err := b.fields(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name, options := field.Name, ""
+		if tag != "" {
+			parts := strings.SplitN(tag, ",", 2)
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			if len(parts) > 1 {
+				options = parts[1]
+			}
+		}
+		ref, err := b.ref(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %v: %v", field.Name, t, err)
+		}
+		if ref == nil {
+			ref = &TypeRef{Kind: AnyKind}
+		}
+		fields = append(fields, &FieldSpec{
+			Name:     name,
+			Type:     ref,
+			// nil pointers can be left out of requests
+			Optional: strings.Contains(options, "omitempty") || field.Type.Kind() == reflect.Ptr,
+		})
+	}
+	return fields, nil
+}
@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func findMethod(spec *APISpec, name string) *MethodSpec {
+	for _, service := range spec.Services {
+		for _, method := range service.Methods {
+			if method.Name == name {
+				return method
+			}
+		}
+	}
+	return nil
+}
+
+func TestNewAPISpec(t *testing.T) {
+	spec, err := NewAPISpec()
+	assert.Nil(t, err)
+	assert.Equal(t, "reporting", spec.Services[0].Name)
+	assert.Equal(t, "token", spec.Services[1].Name)
+
+	getBlock := findMethod(spec, "reporting.GetBlock")
+	assert.Equal(t, &MethodSpec{
+		Name:   "reporting.GetBlock",
+		Params: &TypeRef{Kind: IntegerKind},
+		Result: &TypeRef{Kind: RefKind, Name: "Block"},
+	}, getBlock)
+	assert.Nil(t, findMethod(spec, "reporting.GetAddresses").Params)
+	assert.Nil(t, findMethod(spec, "reporting.AddAddress").Result)
+	// only methods the RPC server serves
+	assert.Nil(t, findMethod(spec, "reporting.prepareExportOptions"))
+
+	assert.Equal(t, []*FieldSpec{
+		{Name: "Address", Type: &TypeRef{Kind: StringKind, Nullable: true}, Optional: true},
+		{Name: "BlockNumber", Type: &TypeRef{Kind: IntegerKind, Nullable: true}, Optional: true},
+	}, spec.Types["AddressWithOptionalBlock"].Fields)
+	// embedded fields are flattened
+	journalFields := spec.Types["JournalArgs"].Fields
+	assert.Equal(t, "Options", journalFields[len(journalFields)-1].Name)
+	assert.True(t, len(journalFields) > 1)
+}
+
+func TestNewAPISpec_Input(t *testing.T) {
+	spec, err := NewAPISpec()
+	assert.Nil(t, err)
+
+	// the types of params, and the types they refer to
+	assert.True(t, spec.Types["AddressWithOptions"].Input)
+	assert.True(t, spec.Types["QueryOptions"].Input)
+	assert.False(t, spec.Types["Block"].Input)
+}
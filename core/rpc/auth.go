@@ -0,0 +1,280 @@
+package rpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// APIKeyHeader is the HTTP header that clients send their API key in
+	APIKeyHeader = "X-API-Key"
+	// AuthorizationHeader carries JSON Web Tokens, as "Bearer <token>"
+	AuthorizationHeader = "Authorization"
+)
+
+var (
+	ErrInvalidAPIKey      = errors.New("invalid API key")
+	ErrNoCredentials      = errors.New("API key or bearer token required")
+	ErrMethodNotPermitted = errors.New("method not permitted for API key or token")
+	ErrMethodNotInScope   = errors.New("method not permitted for API key restricted to contract groups")
+)
+
+// aggregationMethods only return counts and statistics, never individual
+// blocks, transactions, events or storage
+var aggregationMethods = map[string]bool{
+	"reporting.GetLastPersistedBlockNumber": true,
+	"reporting.GetLastFiltered":             true,
+	"reporting.GetIndexStats":               true,
+	"reporting.GetStorageHistoryCount":      true,
+	"reporting.GetAddressTotals":            true,
+	"reporting.HasActivity":                 true,
+	"reporting.GetAnomalies":                true,
+	"reporting.GetStorageAverage":           true,
+	"reporting.GetGasUsageByContract":       true,
+	"reporting.GetGasUsageByFunction":       true,
+	"reporting.GetGasUsageByDay":            true,
+	"reporting.GetNetworkActivity":          true,
+	"reporting.GetEventSeverityCounts":      true,
+}
+
+// readMethods only read the indexed data, so can be called with the read
+// permission, and are served by standbys in high availability mode. With the
+// aggregation methods, they are all the read permission allows: any method
+// not listed, including those added later, changes state until shown
+// otherwise, and needs the full permission.
+var readMethods = map[string]bool{
+	// websocket subscriptions
+	SubscribeMethod: true,
+
+	"reporting.CloseSnapshot":                       true,
+	"reporting.DecodeLogs":                          true,
+	"reporting.GetABI":                              true,
+	"reporting.GetAddresses":                        true,
+	"reporting.GetAllEventsFromAddress":             true,
+	"reporting.GetAllTransactionsInternalToAddress": true,
+	"reporting.GetAllTransactionsToAddress":         true,
+	"reporting.GetBlock":                            true,
+	"reporting.GetBlockForTransaction":              true,
+	"reporting.GetBlocksByTimeRange":                true,
+	"reporting.GetContractCreationTransaction":      true,
+	"reporting.GetContractEnrichment":               true,
+	"reporting.GetContractSeverityRules":            true,
+	"reporting.GetContractStatus":                   true,
+	"reporting.GetContractTemplate":                 true,
+	"reporting.GetCounterparties":                   true,
+	"reporting.GetEventsBySeverity":                 true,
+	"reporting.GetEventsByTopics":                   true,
+	"reporting.GetJob":                              true,
+	"reporting.GetJobs":                             true,
+	"reporting.GetLayoutProposal":                   true,
+	"reporting.GetNames":                            true,
+	"reporting.GetPendingActivity":                  true,
+	"reporting.GetRegisteredNames":                  true,
+	"reporting.GetStorage":                          true,
+	"reporting.GetStorageABI":                       true,
+	"reporting.GetStorageHistory":                   true,
+	"reporting.GetTemplateDetails":                  true,
+	"reporting.GetTemplates":                        true,
+	"reporting.GetTerminalBlock":                    true,
+	"reporting.GetTokenRules":                       true,
+	"reporting.GetTokenTransfers":                   true,
+	"reporting.GetTransaction":                      true,
+	"reporting.GetTransactionCallTree":              true,
+	"reporting.GetTransactionsForBlockRange":        true,
+	"reporting.OpenSnapshot":                        true,
+	"reporting.ReplayEvents":                        true,
+	"reporting.ResolveName":                         true,
+	"reporting.ScreenAddresses":                     true,
+	"reporting.Search":                              true,
+	"reporting.SearchStorage":                       true,
+	"token.AllERC721HoldersAtBlock":                 true,
+	"token.AllERC721TokensAtBlock":                  true,
+	"token.ERC721TokensForAccountAtBlock":           true,
+	"token.GetERC1155TokenBalance":                  true,
+	"token.GetERC1155TokenBalanceAtBlock":           true,
+	"token.GetERC1155TokenHoldersAtBlock":           true,
+	"token.GetERC20Allowance":                       true,
+	"token.GetERC20Allowances":                      true,
+	"token.GetERC20TokenBalance":                    true,
+	"token.GetERC20TokenHolders":                    true,
+	"token.GetERC20TokenHoldersAtBlock":             true,
+	"token.GetERC721TokenHistory":                   true,
+	"token.GetHolderForERC721TokenAtBlock":          true,
+}
+
+// adminMethods report on or control the running of the service, and need
+// the full permission
+var adminMethods = map[string]bool{
+	"reporting.GetProcessingJournal":      true,
+	"reporting.PauseIngestion":            true,
+	"reporting.ResumeIngestion":           true,
+	"reporting.GetContractCosts":          true,
+	"reporting.ThrottleContract":          true,
+	"reporting.RefilterContract":          true,
+	"reporting.GetLegalHolds":             true,
+	"reporting.GetWebhooks":               true,
+	"reporting.GetSubscriptionStats":      true,
+	"reporting.Export":                    true,
+	"reporting.VerifyIntegrity":           true,
+	"reporting.GetIntegrityReport":        true,
+	"reporting.GetHighAvailabilityStatus": true,
+}
+
+// leaderMethods control ingestion, which only runs on the leader in high
+// availability mode; the write methods also need the leader
+var leaderMethods = map[string]bool{
+	"reporting.PauseIngestion":   true,
+	"reporting.ResumeIngestion":  true,
+	"reporting.ThrottleContract": true,
+	"reporting.RefilterContract": true,
+}
+
+// allContractsMethods act on or report about the data of all contracts at
+// once, so can't be called with a key restricted to contract groups
+var allContractsMethods = map[string]bool{
+	"reporting.GetJobs":                   true,
+	"reporting.GetJob":                    true,
+	"reporting.RetryJob":                  true,
+	"reporting.Backfill":                  true,
+	"reporting.DeleteBlockRange":          true,
+	"reporting.AddWebhook":                true,
+	"reporting.DeleteWebhook":             true,
+	"reporting.GetWebhooks":               true,
+	"reporting.AddLegalHold":              true,
+	"reporting.ReleaseLegalHold":          true,
+	"reporting.GetLegalHolds":             true,
+	"reporting.AddTokenRule":              true,
+	"reporting.DeleteTokenRule":           true,
+	"reporting.GetTokenRules":             true,
+	"reporting.GetProcessingJournal":      true,
+	"reporting.PauseIngestion":            true,
+	"reporting.ResumeIngestion":           true,
+	"reporting.GetContractCosts":          true,
+	"reporting.ThrottleContract":          true,
+	"reporting.RefilterContract":          true,
+	"reporting.AssignTemplateByCode":      true,
+	"reporting.GetSubscriptionStats":      true,
+	"reporting.VerifyIntegrity":           true,
+	"reporting.GetIntegrityReport":        true,
+	"reporting.GetNetworkActivity":        true,
+	"reporting.GetHighAvailabilityStatus": true,
+}
+
+// isWriteMethod checks if the method may change what is indexed or how it is
+// decoded, which it does unless it is known to only read or administer
+func isWriteMethod(method string) bool {
+	return !readMethods[method] && !aggregationMethods[method] && !adminMethods[method]
+}
+
+// Authoriser checks that requests carry a known API key or a valid JSON Web
+// Token, and that its permission allows calling the requested method. If
+// neither keys nor tokens are configured, all requests are allowed.
+//
+// Keys can also be restricted to contract groups, which limits the contracts
+// whose data they can query; the restriction itself is applied by the
+// database the request is served from.
+type Authoriser struct {
+	permissions map[string]string
+	groups      map[string][]string
+	jwt         *JWTVerifier
+}
+
+func NewAuthoriser(keys []*types.APIKeyConfig, jwtConfig *types.JWTConfig) (*Authoriser, error) {
+	permissions := make(map[string]string)
+	groups := make(map[string][]string)
+	for _, key := range keys {
+		permissions[key.Key] = key.Permission
+		if len(key.Groups) > 0 {
+			groups[key.Key] = key.Groups
+		}
+	}
+	authoriser := &Authoriser{permissions: permissions, groups: groups}
+	if jwtConfig != nil {
+		verifier, err := NewJWTVerifier(jwtConfig)
+		if err != nil {
+			return nil, err
+		}
+		authoriser.jwt = verifier
+	}
+	return authoriser, nil
+}
+
+func (a *Authoriser) Enabled() bool {
+	return len(a.permissions) > 0 || a.jwt != nil
+}
+
+// Authorise checks that the listener the request came in on exposes the
+// method, and that the request's API key or token permits it.
+func (a *Authoriser) Authorise(req *http.Request, method string) error {
+	if !exposes(requestExposure(req), method) {
+		return ErrMethodNotExposed
+	}
+	if !a.Enabled() {
+		return nil
+	}
+
+	permission, err := a.permission(req)
+	if err != nil {
+		return err
+	}
+	if !exposes(permission, method) {
+		return ErrMethodNotPermitted
+	}
+	if len(a.ContractGroups(req)) > 0 && allContractsMethods[method] {
+		return ErrMethodNotInScope
+	}
+	return nil
+}
+
+// ContractGroups returns the names of the contract groups the request's API
+// key is restricted to, or nil if it can query all contracts. Bearer tokens
+// are never restricted.
+func (a *Authoriser) ContractGroups(req *http.Request) []string {
+	if !a.Enabled() {
+		return nil
+	}
+	return a.groups[req.Header.Get(APIKeyHeader)]
+}
+
+// Client identifies who sent the request, by the API key or bearer token it
+// carries if authentication is enabled, or else by its IP address
+func (a *Authoriser) Client(req *http.Request) string {
+	if a.Enabled() {
+		if key := req.Header.Get(APIKeyHeader); key != "" {
+			return "key:" + key
+		}
+		if authorization := req.Header.Get(AuthorizationHeader); authorization != "" {
+			hash := sha256.Sum256([]byte(authorization))
+			return "token:" + hex.EncodeToString(hash[:])
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// permission returns the permission of the API key or bearer token the request
+// carries, preferring the API key if it has both
+func (a *Authoriser) permission(req *http.Request) (string, error) {
+	if key := req.Header.Get(APIKeyHeader); key != "" || a.jwt == nil {
+		permission, ok := a.permissions[key]
+		if !ok {
+			return "", ErrInvalidAPIKey
+		}
+		return permission, nil
+	}
+
+	authorization := req.Header.Get(AuthorizationHeader)
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return "", ErrNoCredentials
+	}
+	return a.jwt.Verify(strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer ")))
+}
@@ -0,0 +1,203 @@
+package rpc
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"quorumengineering/quorum-report/types"
+)
+
+func withKey(key string) *http.Request {
+	req := &http.Request{Header: http.Header{}}
+	if key != "" {
+		req.Header.Set(APIKeyHeader, key)
+	}
+	return req
+}
+
+func withToken(token string) *http.Request {
+	req := &http.Request{Header: http.Header{}}
+	req.Header.Set(AuthorizationHeader, "Bearer "+token)
+	return req
+}
+
+func signHS256(t *testing.T, secret string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func encodeSegment(t *testing.T, value interface{}) string {
+	encoded, err := json.Marshal(value)
+	require.Nil(t, err)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func TestAuthoriser_APIKeys(t *testing.T) {
+	authoriser, err := NewAuthoriser([]*types.APIKeyConfig{
+		{Key: "full-key", Permission: types.FullPermission},
+		{Key: "read-key", Permission: types.ReadPermission},
+		{Key: "aggregate-key", Permission: types.AggregatePermission},
+	}, nil)
+	require.Nil(t, err)
+
+	assert.Nil(t, authoriser.Authorise(withKey("full-key"), "reporting.GetAllEventsFromAddress"))
+	assert.Nil(t, authoriser.Authorise(withKey("full-key"), "reporting.AddAddress"))
+	assert.Nil(t, authoriser.Authorise(withKey("read-key"), "reporting.GetAllEventsFromAddress"))
+	assert.Equal(t, ErrMethodNotPermitted, authoriser.Authorise(withKey("read-key"), "reporting.AddAddress"))
+	assert.Equal(t, ErrMethodNotPermitted, authoriser.Authorise(withKey("read-key"), "reporting.GetProcessingJournal"))
+	assert.Nil(t, authoriser.Authorise(withKey("aggregate-key"), "reporting.GetAddressTotals"))
+	assert.Equal(t, ErrMethodNotPermitted, authoriser.Authorise(withKey("aggregate-key"), "reporting.GetAllEventsFromAddress"))
+	assert.Equal(t, ErrMethodNotPermitted, authoriser.Authorise(withKey("aggregate-key"), "token.GetERC20TokenBalance"))
+	assert.Equal(t, ErrInvalidAPIKey, authoriser.Authorise(withKey("unknown-key"), "reporting.GetIndexStats"))
+	assert.Equal(t, ErrInvalidAPIKey, authoriser.Authorise(withKey(""), "reporting.GetIndexStats"))
+
+	// no keys configured allows all requests
+	assert.Nil(t, (&Authoriser{}).Authorise(withKey(""), "reporting.GetAllEventsFromAddress"))
+}
+
+func TestAuthoriser_ContractGroups(t *testing.T) {
+	authoriser, err := NewAuthoriser([]*types.APIKeyConfig{
+		{Key: "team-key", Permission: types.FullPermission, Groups: []string{"payments", "lending"}},
+		{Key: "full-key", Permission: types.FullPermission},
+	}, nil)
+	require.Nil(t, err)
+
+	assert.Equal(t, []string{"payments", "lending"}, authoriser.ContractGroups(withKey("team-key")))
+	assert.Nil(t, authoriser.ContractGroups(withKey("full-key")))
+	assert.Nil(t, authoriser.Authorise(withKey("team-key"), "reporting.AddAddress"))
+	assert.Equal(t, ErrMethodNotInScope, authoriser.Authorise(withKey("team-key"), "reporting.DeleteBlockRange"))
+	// the jobs of every contract are listed together
+	assert.Equal(t, ErrMethodNotInScope, authoriser.Authorise(withKey("team-key"), "reporting.GetJobs"))
+	assert.Nil(t, authoriser.Authorise(withKey("full-key"), "reporting.DeleteBlockRange"))
+
+	// keys are ignored when authentication is disabled
+	assert.Nil(t, (&Authoriser{}).ContractGroups(withKey("team-key")))
+}
+
+func TestAuthoriser_HS256(t *testing.T) {
+	authoriser, err := NewAuthoriser([]*types.APIKeyConfig{{Key: "full-key", Permission: types.FullPermission}}, &types.JWTConfig{
+		Secret:          "secret",
+		Issuer:          "issuer",
+		Audience:        "reporting",
+		PermissionClaim: "permission",
+	})
+	require.Nil(t, err)
+	now := time.Unix(1600000000, 0)
+	authoriser.jwt.now = func() time.Time { return now }
+
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{"iss": "issuer", "aud": []string{"other", "reporting"}, "exp": now.Unix() + 60}
+		for k, v := range extra {
+			claims[k] = v
+		}
+		return claims
+	}
+
+	// tokens without a permission can only read
+	readToken := signHS256(t, "secret", claims(nil))
+	assert.Nil(t, authoriser.Authorise(withToken(readToken), "reporting.GetAllEventsFromAddress"))
+	assert.Equal(t, ErrMethodNotPermitted, authoriser.Authorise(withToken(readToken), "reporting.DeleteAddress"))
+
+	fullToken := signHS256(t, "secret", claims(map[string]interface{}{"permission": "full"}))
+	assert.Nil(t, authoriser.Authorise(withToken(fullToken), "reporting.DeleteAddress"))
+
+	aggregateToken := signHS256(t, "secret", claims(map[string]interface{}{"permission": "aggregate"}))
+	assert.Nil(t, authoriser.Authorise(withToken(aggregateToken), "reporting.GetAddressTotals"))
+	assert.Equal(t, ErrMethodNotPermitted, authoriser.Authorise(withToken(aggregateToken), "reporting.GetBlock"))
+
+	// API keys are still accepted
+	assert.Nil(t, authoriser.Authorise(withKey("full-key"), "reporting.DeleteAddress"))
+	assert.Equal(t, ErrNoCredentials, authoriser.Authorise(withKey(""), "reporting.GetBlock"))
+
+	invalid := map[string]string{
+		"invalid token: invalid signature":                 signHS256(t, "wrong secret", claims(nil)),
+		"invalid token: token expired":                     signHS256(t, "secret", claims(map[string]interface{}{"exp": now.Unix()})),
+		"invalid token: token not valid yet":               signHS256(t, "secret", claims(map[string]interface{}{"nbf": now.Unix() + 1})),
+		"invalid token: unexpected issuer":                 signHS256(t, "secret", claims(map[string]interface{}{"iss": "someone"})),
+		"invalid token: unexpected audience":               signHS256(t, "secret", claims(map[string]interface{}{"aud": "other"})),
+		"invalid token: invalid permission admin":          signHS256(t, "secret", claims(map[string]interface{}{"permission": "admin"})),
+		"invalid token: malformed token":                   "not a token",
+		"invalid token: unexpected signing algorithm none": encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, claims(nil)) + ".",
+	}
+	for expected, token := range invalid {
+		assert.EqualError(t, authoriser.Authorise(withToken(token), "reporting.GetBlock"), expected)
+	}
+}
+
+func TestAuthoriser_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.Nil(t, err)
+	dir, err := ioutil.TempDir("", "jwt")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key.pem")
+	require.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0600))
+
+	authoriser, err := NewAuthoriser(nil, &types.JWTConfig{PublicKeyFile: keyFile, PermissionClaim: "role"})
+	require.Nil(t, err)
+
+	signed := encodeSegment(t, map[string]string{"alg": "RS256"}) + "." + encodeSegment(t, map[string]string{"role": "full"})
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.Nil(t, err)
+	token := signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+	assert.Nil(t, authoriser.Authorise(withToken(token), "reporting.AddAddress"))
+
+	// a token signed with the public key as an HMAC secret is rejected
+	assert.EqualError(t, authoriser.Authorise(withToken(signHS256(t, string(publicKey), map[string]interface{}{"role": "full"})), "reporting.AddAddress"), "invalid token: unexpected signing algorithm HS256")
+
+	_, err = NewAuthoriser(nil, &types.JWTConfig{PublicKeyFile: filepath.Join(dir, "missing.pem")})
+	assert.NotNil(t, err)
+}
+
+func TestWriteMethods(t *testing.T) {
+	// methods that change state must not be callable with read permissions
+	methods := map[string]bool{SubscribeMethod: true}
+	for service, apis := range map[string]interface{}{"reporting": &RPCAPIs{}, "token": &TokenRPCAPIs{}} {
+		apisType := reflect.TypeOf(apis)
+		for i := 0; i < apisType.NumMethod(); i++ {
+			name := apisType.Method(i).Name
+			methods[service+"."+name] = true
+			for _, prefix := range []string{"Add", "Delete", "Set", "Assign", "Retry", "Backfill"} {
+				if strings.HasPrefix(name, prefix) {
+					assert.True(t, isWriteMethod(service+"."+name), "%s is not a write method", name)
+				}
+			}
+		}
+	}
+	// methods that aren't listed are writes, which a misspelling would make
+	// of a read method
+	for _, listed := range []map[string]bool{readMethods, aggregationMethods, adminMethods, leaderMethods, allContractsMethods} {
+		for method := range listed {
+			assert.True(t, methods[method], "%s is not a method", method)
+		}
+	}
+
+	assert.True(t, isWriteMethod("reporting.NewMethod"))
+	assert.False(t, exposes(types.ReadPermission, "reporting.NewMethod"))
+	assert.True(t, exposes(types.ReadPermission, "reporting.GetBlock"))
+	assert.True(t, exposes(types.ReadPermission, "reporting.GetAnomalies"))
+	assert.False(t, exposes(types.ReadPermission, "reporting.GetWebhooks"))
+}
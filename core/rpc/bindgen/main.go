@@ -0,0 +1,105 @@
+// bindgen writes the description of the RPC API, and the TypeScript and Python
+// clients generated from it.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"quorumengineering/quorum-report/core/rpc"
+)
+
+// generatedHeader starts every generated file, after the comment marker
+const generatedHeader = "Code generated by bindgen from the RPC API description. DO NOT EDIT."
+
+// outputs are the generated files, relative to the output directory
+var outputs = []struct {
+	path   string
+	render func(*rpc.APISpec) ([]byte, error)
+}{
+	{"api.json", renderSpec},
+	{filepath.Join("typescript", "reporting.ts"), renderTypeScript},
+	{filepath.Join("python", "reporting_client.py"), renderPython},
+}
+
+func main() {
+	out := flag.String("out", "bindings", "directory to write the API description and clients to")
+	flag.Parse()
+
+	spec, err := rpc.NewAPISpec()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "describe RPC API:", err)
+		os.Exit(1)
+	}
+	for _, output := range outputs {
+		rendered, err := output.render(spec)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "render", output.path+":", err)
+			os.Exit(1)
+		}
+		path := filepath.Join(*out, output.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := ioutil.WriteFile(path, rendered, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func renderSpec(spec *rpc.APISpec) ([]byte, error) {
+	rendered, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(rendered, '\n'), nil
+}
+
+// methodName is the name of the method without its service
+func methodName(method *rpc.MethodSpec) string {
+	return method.Name[strings.Index(method.Name, ".")+1:]
+}
+
+// lowerCamel lower cases the leading capitals of a name, leaving the last one
+// if it starts a word, e.g. GetABI is getABI and ERC721Tokens is erc721Tokens.
+func lowerCamel(name string) string {
+	runes := []rune(name)
+	for i := 0; i < len(runes) && unicode.IsUpper(runes[i]); i++ {
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// snakeCase splits a name into lower case words, e.g. GetERC20TokenBalance is
+// get_erc20_token_balance.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			startsWord := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && startsWord) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// serviceClass is the name of the class for the methods of a service
+func serviceClass(service *rpc.ServiceSpec) string {
+	return strings.Title(service.Name) + "API"
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/core/rpc"
+)
+
+func TestNames(t *testing.T) {
+	for name, expected := range map[string][2]string{
+		"GetBlock":                      {"getBlock", "get_block"},
+		"GetABI":                        {"getABI", "get_abi"},
+		"GetERC20TokenBalance":          {"getERC20TokenBalance", "get_erc20_token_balance"},
+		"ERC721TokensForAccountAtBlock": {"erc721TokensForAccountAtBlock", "erc721_tokens_for_account_at_block"},
+		"AllERC721HoldersAtBlock":       {"allERC721HoldersAtBlock", "all_erc721_holders_at_block"},
+	} {
+		assert.Equal(t, expected[0], lowerCamel(name))
+		assert.Equal(t, expected[1], snakeCase(name))
+	}
+}
+
+// The committed bindings must be regenerated with go generate when the RPC API
+// changes
+func TestBindingsUpToDate(t *testing.T) {
+	spec, err := rpc.NewAPISpec()
+	assert.Nil(t, err)
+	for _, output := range outputs {
+		rendered, err := output.render(spec)
+		assert.Nil(t, err)
+		committed, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "bindings", output.path))
+		assert.Nil(t, err)
+		assert.Equal(t, string(committed), string(rendered), "%s is out of date, run go generate ./core/rpc", output.path)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"quorumengineering/quorum-report/core/rpc"
+)
+
+const pythonClient = `
+
+class RPCError(Exception):
+    def __init__(self, error: Any) -> None:
+        super().__init__(error if isinstance(error, str) else json.dumps(error))
+        self.error = error
+
+
+class _Transport:
+    def __init__(self, url: str, headers: Dict[str, str], timeout: float) -> None:
+        self._url = url
+        self._headers = dict(headers, **{"Content-Type": "application/json"})
+        self._timeout = timeout
+        self._id = 0
+
+    def call(self, method: str, params: List[Any]) -> Any:
+        self._id += 1
+        body = json.dumps({"jsonrpc": "2.0", "id": self._id, "method": method, "params": params})
+        request = urllib.request.Request(self._url, data=body.encode(), headers=self._headers, method="POST")
+        try:
+            with urllib.request.urlopen(request, timeout=self._timeout) as response:
+                result = json.loads(response.read())
+        except urllib.error.HTTPError as e:
+            raise RPCError(e.read().decode()) from e
+        if result.get("error"):
+            raise RPCError(result["error"])
+        return result.get("result")
+`
+
+func renderPython(spec *rpc.APISpec) ([]byte, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", generatedHeader)
+	b.WriteString("import json\nimport urllib.error\nimport urllib.request\n")
+	b.WriteString("from typing import Any, Dict, List, Optional\n\n")
+	b.WriteString("try:\n    from typing import TypedDict\nexcept ImportError:  # Python < 3.8\n    from typing_extensions import TypedDict\n")
+
+	for _, name := range spec.SortedTypes() {
+		fields := spec.Types[name].Fields
+		fmt.Fprintf(&b, "\n%s = TypedDict(\"%s\", {", name, name)
+		for i, field := range fields {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, "\n    %q: %s", field.Name, pythonType(field.Type))
+		}
+		if len(fields) > 0 {
+			b.WriteString(",\n")
+		}
+		// fields left out of the JSON are not marked, so none are required
+		b.WriteString("}, total=False)\n")
+	}
+
+	b.WriteString(pythonClient)
+	for _, service := range spec.Services {
+		fmt.Fprintf(&b, "\n\nclass %s:\n", serviceClass(service))
+		b.WriteString("    def __init__(self, transport: _Transport) -> None:\n")
+		b.WriteString("        self._transport = transport\n")
+		for _, method := range service.Methods {
+			result := "None"
+			if method.Result != nil {
+				result = pythonType(method.Result)
+			}
+			params, args := "", "[]"
+			if method.Params != nil {
+				params, args = ", params: "+pythonType(method.Params), "[params]"
+			}
+			fmt.Fprintf(&b, "\n    def %s(self%s) -> %s:\n", snakeCase(methodName(method)), params, result)
+			fmt.Fprintf(&b, "        return self._transport.call(\"%s\", %s)\n", method.Name, args)
+		}
+	}
+
+	b.WriteString("\n\nclass Client:\n")
+	b.WriteString("    \"\"\"Calls the RPC API at the given URL, sending the headers with each request, e.g. an\n")
+	b.WriteString("    X-API-Key or Authorization header.\"\"\"\n\n")
+	b.WriteString("    def __init__(self, url: str, headers: Optional[Dict[str, str]] = None, timeout: float = 30) -> None:\n")
+	b.WriteString("        transport = _Transport(url, headers or {}, timeout)\n")
+	for _, service := range spec.Services {
+		fmt.Fprintf(&b, "        self.%s = %s(transport)\n", service.Name, serviceClass(service))
+	}
+	return []byte(b.String()), nil
+}
+
+func pythonType(ref *rpc.TypeRef) string {
+	var t string
+	switch ref.Kind {
+	case rpc.StringKind:
+		t = "str"
+	case rpc.IntegerKind:
+		t = "int"
+	case rpc.NumberKind:
+		t = "float"
+	case rpc.BooleanKind:
+		t = "bool"
+	case rpc.ArrayKind:
+		t = "List[" + pythonType(ref.Elem) + "]"
+	case rpc.MapKind:
+		t = "Dict[str, " + pythonType(ref.Elem) + "]"
+	case rpc.RefKind:
+		// the types are defined in alphabetical order, so may refer to later ones
+		t = "\"" + ref.Name + "\""
+	default:
+		return "Any"
+	}
+	if ref.Nullable {
+		return "Optional[" + t + "]"
+	}
+	return t
+}
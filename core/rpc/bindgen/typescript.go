@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"quorumengineering/quorum-report/core/rpc"
+)
+
+var identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+const typeScriptClient = `export class RPCError extends Error {
+  constructor(readonly error: unknown) {
+    super(typeof error === 'string' ? error : JSON.stringify(error));
+    this.name = 'RPCError';
+  }
+}
+
+class Transport {
+  private id = 0;
+
+  constructor(private readonly url: string, private readonly headers: Record<string, string>) {}
+
+  async call<T>(method: string, params: unknown[]): Promise<T> {
+    const response = await fetch(this.url, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', ...this.headers },
+      body: JSON.stringify({ jsonrpc: '2.0', id: ++this.id, method, params }),
+    });
+    if (!response.ok) {
+      throw new RPCError(await response.text());
+    }
+    const body = await response.json();
+    if (body.error) {
+      throw new RPCError(body.error);
+    }
+    return body.result as T;
+  }
+}
+`
+
+func renderTypeScript(spec *rpc.APISpec) ([]byte, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s\n\n", generatedHeader)
+
+	for _, name := range spec.SortedTypes() {
+		fmt.Fprintf(&b, "export interface %s {\n", name)
+		typeSpec := spec.Types[name]
+		for _, field := range typeSpec.Fields {
+			fieldName := field.Name
+			if !identifier.MatchString(fieldName) {
+				fieldName = fmt.Sprintf("%q", fieldName)
+			}
+			optional := ""
+			if field.Optional || typeSpec.Input {
+				optional = "?"
+			}
+			fmt.Fprintf(&b, "  %s%s: %s;\n", fieldName, optional, typeScriptType(field.Type))
+		}
+		b.WriteString("}\n\n")
+	}
+
+	b.WriteString(typeScriptClient)
+	for _, service := range spec.Services {
+		fmt.Fprintf(&b, "\nexport class %s {\n", serviceClass(service))
+		b.WriteString("  constructor(private readonly transport: Transport) {}\n")
+		for _, method := range service.Methods {
+			result := "null"
+			if method.Result != nil {
+				result = typeScriptType(method.Result)
+			}
+			params, args := "", "[]"
+			if method.Params != nil {
+				params, args = "params: "+typeScriptType(method.Params), "[params]"
+			}
+			fmt.Fprintf(&b, "\n  %s(%s): Promise<%s> {\n", lowerCamel(methodName(method)), params, result)
+			fmt.Fprintf(&b, "    return this.transport.call('%s', %s);\n", method.Name, args)
+			b.WriteString("  }\n")
+		}
+		b.WriteString("}\n")
+	}
+
+	b.WriteString("\n// Client calls the RPC API at the given URL, sending the headers with each request, e.g. an\n")
+	b.WriteString("// X-API-Key or Authorization header.\n")
+	b.WriteString("export class Client {\n")
+	for _, service := range spec.Services {
+		fmt.Fprintf(&b, "  readonly %s: %s;\n", service.Name, serviceClass(service))
+	}
+	b.WriteString("\n  constructor(url: string, headers: Record<string, string> = {}) {\n")
+	b.WriteString("    const transport = new Transport(url, headers);\n")
+	for _, service := range spec.Services {
+		fmt.Fprintf(&b, "    this.%s = new %s(transport);\n", service.Name, serviceClass(service))
+	}
+	b.WriteString("  }\n}\n")
+	return []byte(b.String()), nil
+}
+
+func typeScriptType(ref *rpc.TypeRef) string {
+	var t string
+	switch ref.Kind {
+	case rpc.StringKind:
+		t = "string"
+	case rpc.IntegerKind, rpc.NumberKind:
+		t = "number"
+	case rpc.BooleanKind:
+		t = "boolean"
+	case rpc.ArrayKind:
+		elem := typeScriptType(ref.Elem)
+		if ref.Elem.Nullable {
+			elem = "(" + elem + ")"
+		}
+		t = elem + "[]"
+	case rpc.MapKind:
+		t = "Record<string, " + typeScriptType(ref.Elem) + ">"
+	case rpc.RefKind:
+		t = ref.Name
+	default:
+		t = "any"
+	}
+	if ref.Nullable && ref.Kind != rpc.AnyKind {
+		t += " | null"
+	}
+	return t
+}
@@ -0,0 +1,330 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// CBORSeqContentType is a sequence of CBOR items (RFC 8742), one per result,
+// in the same way NDJSON is a sequence of JSON lines.
+const CBORSeqContentType = "application/cbor-seq"
+
+// IsCBORRequest reports whether the client asked for a CBOR sequence, either
+// with an Accept header or a format query parameter.
+func IsCBORRequest(req *http.Request) bool {
+	return req.URL.Query().Get("format") == "cbor" || strings.Contains(req.Header.Get("Accept"), CBORSeqContentType)
+}
+
+// CBOR major types
+const (
+	cborUnsigned byte = iota << 5
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+const (
+	cborFalse   byte = cborSimple | 20
+	cborTrue    byte = cborSimple | 21
+	cborNull    byte = cborSimple | 22
+	cborFloat64 byte = cborSimple | 27
+
+	// tags of positive and negative bignums
+	cborPositiveBignum = 2
+	cborNegativeBignum = 3
+)
+
+var (
+	bigIntType      = reflect.TypeOf(big.Int{})
+	addressType     = reflect.TypeOf(types.Address(""))
+	hashType        = reflect.TypeOf(types.Hash(""))
+	hexDataType     = reflect.TypeOf(types.HexData(""))
+	parsedDataType  = reflect.TypeOf(types.ParsedData{})
+	jsonMarshalType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// cborEncoder writes values as CBOR (RFC 8949), with the same fields and
+// names as their JSON encoding. Addresses, hashes and hex data are text, as
+// in JSON, but numbers are CBOR integers and floats, and integers too large
+// for 64 bits are bignums, rather than losing precision in a JSON number.
+type cborEncoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+func newCBOREncoder(w io.Writer) *cborEncoder {
+	return &cborEncoder{w: w}
+}
+
+// Encode writes the value as a single CBOR item.
+func (e *cborEncoder) Encode(value interface{}) error {
+	e.buf = e.buf[:0]
+	if err := e.encode(reflect.ValueOf(value)); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+func (e *cborEncoder) head(major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		e.buf = append(e.buf, major|byte(arg))
+	case arg <= math.MaxUint8:
+		e.buf = append(e.buf, major|24, byte(arg))
+	case arg <= math.MaxUint16:
+		e.buf = append(e.buf, major|25)
+		e.buf = append(e.buf, make([]byte, 2)...)
+		binary.BigEndian.PutUint16(e.buf[len(e.buf)-2:], uint16(arg))
+	case arg <= math.MaxUint32:
+		e.buf = append(e.buf, major|26)
+		e.buf = append(e.buf, make([]byte, 4)...)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], uint32(arg))
+	default:
+		e.buf = append(e.buf, major|27)
+		e.buf = append(e.buf, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], arg)
+	}
+}
+
+func (e *cborEncoder) integer(n int64) {
+	if n < 0 {
+		e.head(cborNegative, uint64(-1-n))
+		return
+	}
+	e.head(cborUnsigned, uint64(n))
+}
+
+func (e *cborEncoder) text(s string) {
+	e.head(cborText, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *cborEncoder) bigInt(n *big.Int) {
+	switch {
+	case n.IsUint64():
+		e.head(cborUnsigned, n.Uint64())
+	case n.IsInt64():
+		e.integer(n.Int64())
+	case n.Sign() > 0:
+		e.head(cborTag, cborPositiveBignum)
+		bytes := n.Bytes()
+		e.head(cborBytes, uint64(len(bytes)))
+		e.buf = append(e.buf, bytes...)
+	default:
+		// negative bignums hold -1 - n
+		e.head(cborTag, cborNegativeBignum)
+		bytes := new(big.Int).Sub(new(big.Int).Neg(n), big.NewInt(1)).Bytes()
+		e.head(cborBytes, uint64(len(bytes)))
+		e.buf = append(e.buf, bytes...)
+	}
+}
+
+func (e *cborEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, cborNull)
+		return nil
+	}
+
+	switch v.Type() {
+	case bigIntType:
+		if v.CanAddr() {
+			e.bigInt(v.Addr().Interface().(*big.Int))
+		} else {
+			n := v.Interface().(big.Int)
+			e.bigInt(&n)
+		}
+		return nil
+	case addressType, hashType, hexDataType:
+		e.text("0x" + v.String())
+		return nil
+	case parsedDataType:
+		// always a map, even if nothing was parsed
+		if v.IsNil() {
+			e.head(cborMap, 0)
+			return nil
+		}
+	default:
+		if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface && v.Type().Implements(jsonMarshalType) {
+			return e.encodeJSON(v)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, cborTrue)
+		} else {
+			e.buf = append(e.buf, cborFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.integer(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.head(cborUnsigned, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.buf = append(e.buf, cborFloat64)
+		e.buf = append(e.buf, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], math.Float64bits(v.Float()))
+	case reflect.String:
+		e.text(v.String())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, cborNull)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf = append(e.buf, cborNull)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.head(cborBytes, uint64(v.Len()))
+			e.buf = append(e.buf, v.Bytes()...)
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		e.head(cborArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, cborNull)
+			return nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cannot encode %v as CBOR", v.Type())
+		}
+		// keys are sorted, as they are in JSON
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		e.head(cborMap, uint64(len(keys)))
+		for _, key := range keys {
+			e.text(key.String())
+			if err := e.encode(v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := cborFields(v.Type())
+		var included []*cborField
+		for _, field := range fields {
+			if !field.omitEmpty || !isEmptyValue(v.FieldByIndex(field.index)) {
+				included = append(included, field)
+			}
+		}
+		e.head(cborMap, uint64(len(included)))
+		for _, field := range included {
+			e.text(field.name)
+			if err := e.encode(v.FieldByIndex(field.index)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode %v as CBOR", v.Type())
+	}
+	return nil
+}
+
+// encodeJSON encodes a value with its own JSON encoding, as the value that
+// encoding decodes to.
+func (e *cborEncoder) encodeJSON(v reflect.Value) error {
+	encoded, err := json.Marshal(v.Interface())
+	if err != nil {
+		return err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return err
+	}
+	return e.encode(reflect.ValueOf(decoded))
+}
+
+type cborField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// fields of struct types, named and ordered as they are in JSON
+var cborFieldCache sync.Map
+
+func cborFields(t reflect.Type) []*cborField {
+	if cached, ok := cborFieldCache.Load(t); ok {
+		return cached.([]*cborField)
+	}
+	var fields []*cborField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, options = tag[:comma], tag[comma+1:]
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			// the fields of embedded structs are promoted
+			for _, embedded := range cborFields(field.Type) {
+				fields = append(fields, &cborField{
+					name:      embedded.name,
+					index:     append([]int{i}, embedded.index...),
+					omitEmpty: embedded.omitEmpty,
+				})
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, &cborField{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: strings.Contains(","+options+",", ",omitempty,"),
+		})
+	}
+	cborFieldCache.Store(t, fields)
+	return fields
+}
+
+// isEmptyValue reports whether the value is left out of JSON with omitempty
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func encodeCBOR(t *testing.T, value interface{}) string {
+	var buf bytes.Buffer
+	assert.Nil(t, newCBOREncoder(&buf).Encode(value))
+	return hex.EncodeToString(buf.Bytes())
+}
+
+func TestCBOREncoder(t *testing.T) {
+	// examples from RFC 8949 appendix A
+	bignum, _ := new(big.Int).SetString("18446744073709551616", 10)
+	negativeBignum, _ := new(big.Int).SetString("-18446744073709551617", 10)
+	assert.Equal(t, "00", encodeCBOR(t, 0))
+	assert.Equal(t, "1a000f4240", encodeCBOR(t, 1000000))
+	assert.Equal(t, "1bffffffffffffffff", encodeCBOR(t, uint64(18446744073709551615)))
+	assert.Equal(t, "3903e7", encodeCBOR(t, -1000))
+	assert.Equal(t, "c249010000000000000000", encodeCBOR(t, bignum))
+	assert.Equal(t, "c349010000000000000000", encodeCBOR(t, negativeBignum))
+	assert.Equal(t, "1903e8", encodeCBOR(t, big.NewInt(1000)))
+	assert.Equal(t, "fb3ff8000000000000", encodeCBOR(t, 1.5))
+	assert.Equal(t, "f5", encodeCBOR(t, true))
+	assert.Equal(t, "f6", encodeCBOR(t, nil))
+	assert.Equal(t, "62c3bc", encodeCBOR(t, "ü"))
+	assert.Equal(t, "4401020304", encodeCBOR(t, []byte{1, 2, 3, 4}))
+	assert.Equal(t, "83010203", encodeCBOR(t, []int{1, 2, 3}))
+	assert.Equal(t, "a26161016162820203", encodeCBOR(t, map[string]interface{}{"b": []int{2, 3}, "a": 1}))
+
+	// structs are encoded with their JSON names, and addresses as hex text
+	type row struct {
+		Address  types.Address    `json:"address"`
+		Value    uint64           `json:"value"`
+		Number   types.HexNumber  `json:"number,omitempty"`
+		Data     types.ParsedData `json:"parsedData"`
+		Internal string           `json:"-"`
+	}
+	address := types.NewAddress("0x01")
+	encoded := encodeCBOR(t, &row{Address: address, Value: 24, Internal: "left out"})
+	expected := "a3" +
+		"67" + hex.EncodeToString([]byte("address")) +
+		"782a" + hex.EncodeToString([]byte(address.Hex())) +
+		"6576616c7565" + "1818" +
+		"6a" + hex.EncodeToString([]byte("parsedData")) + "a0"
+	assert.Equal(t, expected, encoded)
+
+	// values with their own JSON encoding are encoded as that JSON
+	encoded = encodeCBOR(t, &row{Number: 10})
+	assert.Contains(t, encoded, "66"+hex.EncodeToString([]byte("number"))+"63"+hex.EncodeToString([]byte("0xa")))
+
+	var buf bytes.Buffer
+	assert.EqualError(t, newCBOREncoder(&buf).Encode(map[int]string{1: "a"}), "cannot encode map[int]string as CBOR")
+}
+
+func TestNDJSONExporter_CBOR(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, apis.AddABI(dummyReq, &AddressWithData{&addr, validABI}, nil))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{addr}, []*types.Block{block}))
+	exporter := NewNDJSONExporter(apis, &Authoriser{}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/?method=reporting.GetAllEventsFromAddress&address="+addr.Hex(), nil)
+	req.Header.Set("Accept", CBORSeqContentType)
+	assert.True(t, IsCBORRequest(req))
+	assert.False(t, IsNDJSONRequest(req))
+	rec := httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, CBORSeqContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="events-`+addr.Hex()+`.cbor"`, rec.Header().Get("Content-Disposition"))
+
+	// a single event, a map of the same fields as the JSON, with the decoded
+	// value as an integer
+	body := rec.Body.Bytes()
+	assert.Equal(t, byte(0xa5), body[0])
+	assert.True(t, bytes.Contains(body, []byte("event valueSet(uint256 _value)")))
+	parsedData := append([]byte("parsedData"), 0xa1, 0x66)
+	parsedData = append(parsedData, "_value"...)
+	parsedData = append(parsedData, 0x19, 0x03, 0xe8)
+	assert.True(t, bytes.Contains(body, parsedData))
+
+	assert.True(t, IsCBORRequest(httptest.NewRequest(http.MethodGet, "/?format=cbor", nil)))
+	assert.False(t, IsCBORRequest(httptest.NewRequest(http.MethodGet, "/?format=ndjson", nil)))
+}
@@ -0,0 +1,128 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/types"
+)
+
+// GetContractCosts ranks the registered contracts by what ingesting them has
+// cost since the service started, most expensive first, so operators can find
+// the contracts that dominate resource usage.
+func (r *RPCAPIs) GetContractCosts(req *http.Request, args *ContractCostsArgs, reply *[]*types.ContractCost) error {
+	if r.ingestion == nil {
+		return ErrIngestionControlNotEnabled
+	}
+	if args.SortBy == "" {
+		args.SortBy = types.ProcessingTimeCost
+	}
+	var value func(cost *types.ContractCost) float64
+	switch args.SortBy {
+	case types.ProcessingTimeCost:
+		value = func(cost *types.ContractCost) float64 { return cost.ProcessingSeconds }
+	case types.NodeCallsCost:
+		value = func(cost *types.ContractCost) float64 { return float64(cost.NodeCalls) }
+	case types.DocumentsCost:
+		value = func(cost *types.ContractCost) float64 { return float64(cost.Documents) }
+	default:
+		return fmt.Errorf("unknown cost %q", args.SortBy)
+	}
+	if args.Limit < 0 {
+		return errors.New("limit can't be negative")
+	}
+
+	// registered contracts that haven't been filtered yet cost nothing so far
+	addresses, err := r.db.GetAddresses()
+	if err != nil {
+		return err
+	}
+	costs := make(map[types.Address]*types.ContractCost, len(addresses))
+	for _, address := range addresses {
+		costs[address] = &types.ContractCost{Address: address}
+	}
+	contractCosts, err := r.ingestion.ContractCosts()
+	if err != nil {
+		return err
+	}
+	for _, cost := range contractCosts {
+		if _, ok := costs[cost.Address]; ok {
+			costs[cost.Address] = cost
+		}
+	}
+
+	ranked := make([]*types.ContractCost, 0, len(costs))
+	for _, cost := range costs {
+		if cost.Documents, err = r.contractDocuments(cost.Address); err != nil {
+			return err
+		}
+		ranked = append(ranked, cost)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if value(ranked[i]) != value(ranked[j]) {
+			return value(ranked[i]) > value(ranked[j])
+		}
+		return ranked[i].Address < ranked[j].Address
+	})
+	if args.Limit > 0 && args.Limit < len(ranked) {
+		ranked = ranked[:args.Limit]
+	}
+	*reply = ranked
+	return nil
+}
+
+// contractDocuments counts the transactions to, events from and storage
+// states of a contract that are indexed
+func (r *RPCAPIs) contractDocuments(address types.Address) (uint64, error) {
+	queryOptions := &types.QueryOptions{}
+	queryOptions.SetDefaults()
+	transactions, err := r.db.GetTransactionsToAddressTotal(address, queryOptions)
+	if err != nil {
+		return 0, err
+	}
+	events, err := r.db.GetEventsFromAddressTotal(address, queryOptions)
+	if err != nil {
+		return 0, err
+	}
+	pageOptions := &types.PageOptions{}
+	pageOptions.SetDefaults()
+	storage, err := r.db.GetStorageTotal(address, pageOptions)
+	if err != nil {
+		return 0, err
+	}
+	return transactions + events + storage, nil
+}
+
+// ThrottleContract leaves a contract out of filtering new blocks, or includes
+// it again, catching up on the blocks it missed. Throttling is stored, so is
+// kept across restarts and followed by every instance.
+func (r *RPCAPIs) ThrottleContract(req *http.Request, args *ThrottleContractArgs, reply *NullArgs) error {
+	if r.ingestion == nil {
+		return ErrIngestionControlNotEnabled
+	}
+	if args.Address == nil {
+		return errors.New("no contract address provided")
+	}
+	return r.ingestion.ThrottleContract(*args.Address, args.Throttled)
+}
+
+// RefilterContract filters the blocks of a contract again, recording its
+// events, storage and tokens with its current template, for when its ABI or
+// template was fixed after the blocks were first filtered. It returns once
+// the blocks are queued up, and they are filtered in the background.
+func (r *RPCAPIs) RefilterContract(req *http.Request, args *RefilterContractArgs, reply *NullArgs) error {
+	if r.ingestion == nil {
+		return ErrIngestionControlNotEnabled
+	}
+	if args.Address == nil {
+		return errors.New("no contract address provided")
+	}
+	err := r.ingestion.RefilterContract(req.Context(), *args.Address, args.FromBlock)
+	if err == database.ErrNotFound {
+		return errors.New("address is not registered")
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestGetContractCosts(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	var costs []*types.ContractCost
+	assert.Equal(t, ErrIngestionControlNotEnabled, apis.GetContractCosts(dummyReq, &ContractCostsArgs{}, &costs))
+	assert.Equal(t, ErrIngestionControlNotEnabled, apis.ThrottleContract(dummyReq, &ThrottleContractArgs{Address: &addr}, nil))
+
+	busy := types.NewAddress("0x0000000000000000000000000000000000000001")
+	idle := types.NewAddress("0x0000000000000000000000000000000000000002")
+	unfiltered := types.NewAddress("0x0000000000000000000000000000000000000003")
+	unregistered := types.NewAddress("0x0000000000000000000000000000000000000004")
+	assert.Nil(t, db.AddAddresses([]types.Address{busy, idle, unfiltered}))
+	tx := &types.Transaction{
+		Hash:        types.NewHash("0x01"),
+		BlockNumber: 1,
+		To:          idle,
+		Events:      []*types.Event{{Address: idle, BlockNumber: 1, TransactionHash: types.NewHash("0x01")}},
+	}
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx}))
+	block := &types.Block{Number: 1, Transactions: []types.Hash{tx.Hash}}
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{busy, idle, unfiltered}, []*types.Block{block}))
+
+	ingestion := &fakeIngestionController{costs: []*types.ContractCost{
+		{Address: busy, BlocksFiltered: 1, ProcessingSeconds: 2, NodeCalls: 2},
+		{Address: idle, BlocksFiltered: 1, ProcessingSeconds: 1, NodeCalls: 3},
+		// no longer registered
+		{Address: unregistered, ProcessingSeconds: 10},
+	}}
+	apis.ingestion = ingestion
+
+	assert.Nil(t, apis.GetContractCosts(dummyReq, &ContractCostsArgs{}, &costs))
+	assert.Len(t, costs, 3)
+	assert.Equal(t, []types.Address{busy, idle, unfiltered}, []types.Address{costs[0].Address, costs[1].Address, costs[2].Address})
+	// the transaction to and event from the contract
+	assert.EqualValues(t, 2, costs[1].Documents)
+
+	assert.Nil(t, apis.GetContractCosts(dummyReq, &ContractCostsArgs{SortBy: types.NodeCallsCost, Limit: 1}, &costs))
+	assert.Len(t, costs, 1)
+	assert.Equal(t, idle, costs[0].Address)
+
+	assert.Nil(t, apis.GetContractCosts(dummyReq, &ContractCostsArgs{SortBy: types.DocumentsCost}, &costs))
+	assert.Equal(t, idle, costs[0].Address)
+
+	assert.EqualError(t, apis.GetContractCosts(dummyReq, &ContractCostsArgs{SortBy: "memory"}, &costs), `unknown cost "memory"`)
+
+	assert.Nil(t, apis.ThrottleContract(dummyReq, &ThrottleContractArgs{Address: &busy, Throttled: true}, nil))
+	assert.True(t, ingestion.throttled[busy])
+	assert.EqualError(t, apis.ThrottleContract(dummyReq, &ThrottleContractArgs{}, nil), "no contract address provided")
+}
+
+func TestRefilterContract(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Equal(t, ErrIngestionControlNotEnabled, apis.RefilterContract(dummyReq, &RefilterContractArgs{Address: &addr}, nil))
+
+	ingestion := &fakeIngestionController{registered: addr}
+	apis.ingestion = ingestion
+	assert.Nil(t, apis.RefilterContract(dummyReq, &RefilterContractArgs{Address: &addr, FromBlock: 100}, nil))
+	assert.EqualValues(t, 100, ingestion.refilteredFrom)
+
+	unregistered := types.NewAddress("0x0000000000000000000000000000000000000004")
+	assert.EqualError(t, apis.RefilterContract(dummyReq, &RefilterContractArgs{Address: &unregistered}, nil), "address is not registered")
+	assert.EqualError(t, apis.RefilterContract(dummyReq, &RefilterContractArgs{}, nil), "no contract address provided")
+}
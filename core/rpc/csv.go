@@ -0,0 +1,426 @@
+package rpc
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	CSVContentType = "text/csv"
+
+	eventsCSVMethod       = "reporting.GetAllEventsFromAddress"
+	transactionsCSVMethod = "reporting.GetAllTransactionsToAddress"
+
+	// csvPageSize is how many rows are read from the database at a time
+	csvPageSize = 500
+)
+
+var (
+	ErrCSVMethodNotSupported = errors.New("method is not available as CSV")
+
+	eventCSVColumns       = []string{"blockNumber", "timestamp", "timestampISO", "transactionHash", "transactionIndex", "index", "eventSig"}
+	transactionCSVColumns = []string{"blockNumber", "timestamp", "timestampISO", "hash", "index", "from", "to", "status", "txSig"}
+)
+
+// IsCSVRequest reports whether the client asked for CSV rather than JSON,
+// either with an Accept header or a format query parameter.
+func IsCSVRequest(req *http.Request) bool {
+	return req.URL.Query().Get("format") == "csv" || strings.Contains(req.Header.Get("Accept"), CSVContentType)
+}
+
+// CSVExporter streams the events or transactions of an address as CSV, one
+// row each with the decoded parameters flattened into columns, so they can be
+// loaded straight into a spreadsheet.
+//
+// Requests are either a normal JSON-RPC POST, or a GET with the method,
+// address and query options as URL parameters. Rows are read a page at a
+// time, moving the end block down rather than the page number so exports are
+// not limited by the database's pagination limit.
+type CSVExporter struct {
+	apis       *RPCAPIs
+	authoriser *Authoriser
+	limiter    *RateLimiter
+}
+
+func NewCSVExporter(apis *RPCAPIs, authoriser *Authoriser, limiter *RateLimiter) *CSVExporter {
+	return &CSVExporter{apis: apis, authoriser: authoriser, limiter: limiter}
+}
+
+func (e *CSVExporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	method, args, err := parseExportRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := e.authoriser.Authorise(req, method); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := e.limiter.Allow(e.authoriser.Client(req), method); err != nil {
+		writeRateLimited(w, err, http.StatusForbidden)
+		return
+	}
+
+	var export *csvExport
+	switch method {
+	case eventsCSVMethod:
+		export, err = e.apis.eventsCSVExport(args)
+	case transactionsCSVMethod:
+		export, err = e.apis.transactionsCSVExport(args)
+	default:
+		err = ErrCSVMethodNotSupported
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", CSVContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.filename))
+	writer := csv.NewWriter(w)
+	flush := func() error {
+		writer.Flush()
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return writer.Error()
+	}
+	if err := export.stream(writer, flush); err != nil {
+		// the status has already been sent, so abort the response to make
+		// sure the client doesn't take a partial export as complete
+		log.Error("CSV export failed", "method", method, "address", args.Address.Hex(), "err", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// parseExportRequest reads the method and arguments from either a JSON-RPC body
+// or URL parameters.
+func parseExportRequest(req *http.Request) (string, *AddressWithOptions, error) {
+	if req.Method == http.MethodPost {
+		var body struct {
+			Method string                `json:"method"`
+			Params []*AddressWithOptions `json:"params"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return "", nil, err
+		}
+		if len(body.Params) != 1 || body.Params[0] == nil || body.Params[0].Address == nil {
+			return "", nil, ErrNoAddress
+		}
+		return body.Method, body.Params[0], nil
+	}
+
+	query := req.URL.Query()
+	if query.Get("address") == "" {
+		return "", nil, ErrNoAddress
+	}
+	address := types.NewAddress(query.Get("address"))
+	options := &types.QueryOptions{SnapshotId: query.Get("snapshotId")}
+	for name, value := range map[string]**big.Int{
+		"beginBlockNumber": &options.BeginBlockNumber,
+		"endBlockNumber":   &options.EndBlockNumber,
+		"beginTimestamp":   &options.BeginTimestamp,
+		"endTimestamp":     &options.EndTimestamp,
+	} {
+		if query.Get(name) == "" {
+			continue
+		}
+		parsed, ok := new(big.Int).SetString(query.Get(name), 10)
+		if !ok {
+			return "", nil, fmt.Errorf("invalid %s", name)
+		}
+		*value = parsed
+	}
+	return query.Get("method"), &AddressWithOptions{Address: &address, Options: options}, nil
+}
+
+// csvExport is a prepared export; fetch reads a page of rows, returning the
+// block number of each, and a function to write the rows from an offset.
+type csvExport struct {
+	filename string
+	header   []string
+	options  *types.QueryOptions
+	total    uint64
+	fetch    func(options *types.QueryOptions) ([]uint64, func(writer *csv.Writer, from int) error, error)
+}
+
+func (export *csvExport) stream(writer *csv.Writer, flush func() error) error {
+	if err := writer.Write(export.header); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	pageOptions := *export.options
+	pageOptions.PageSize = csvPageSize
+	end := export.options.EndBlockNumber.Uint64()
+	// skip is how many rows of the end block have already been written
+	skip := 0
+	var written uint64
+	for written < export.total {
+		pageOptions.EndBlockNumber = new(big.Int).SetUint64(end)
+		pageOptions.PageNumber = skip / csvPageSize
+		blocks, write, err := export.fetch(&pageOptions)
+		if err != nil {
+			return err
+		}
+		from := skip % csvPageSize
+		if from >= len(blocks) {
+			return nil
+		}
+		if err := write(writer, from); err != nil {
+			return err
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		written += uint64(len(blocks) - from)
+		if len(blocks) < csvPageSize {
+			return nil
+		}
+
+		// rows are newest block first, so the page may have stopped part way
+		// through its last block
+		last := blocks[len(blocks)-1]
+		if last == end {
+			skip += len(blocks) - from
+			continue
+		}
+		end = last
+		skip = 0
+		for _, block := range blocks {
+			if block == last {
+				skip++
+			}
+		}
+	}
+	return nil
+}
+
+// prepareExportOptions applies the defaults and snapshot to the query options,
+// and pins the end block so rows indexed during the export don't shift pages.
+func (r *RPCAPIs) prepareExportOptions(args *AddressWithOptions) error {
+	if args.Address == nil {
+		return ErrNoAddress
+	}
+	if args.Options == nil {
+		args.Options = &types.QueryOptions{}
+	}
+	args.Options.SetDefaults()
+	endBlockNumber, err := r.snapshots.EndBlockNumber(args.Options.SnapshotId, *args.Address, args.Options.EndBlockNumber)
+	if err != nil {
+		return err
+	}
+	lastFiltered, err := r.db.GetLastFiltered(*args.Address)
+	if err != nil {
+		return err
+	}
+	if endBlockNumber.Sign() < 0 || endBlockNumber.Cmp(new(big.Int).SetUint64(lastFiltered)) > 0 {
+		endBlockNumber = new(big.Int).SetUint64(lastFiltered)
+	}
+	args.Options.EndBlockNumber = endBlockNumber
+	return nil
+}
+
+func (r *RPCAPIs) eventsCSVExport(args *AddressWithOptions) (*csvExport, error) {
+	if err := r.prepareExportOptions(args); err != nil {
+		return nil, err
+	}
+	address := *args.Address
+	total, err := r.db.GetEventsFromAddressTotal(address, args.Options)
+	if err != nil {
+		return nil, err
+	}
+	contractABI, err := r.db.GetContractABI(address)
+	if err != nil {
+		return nil, err
+	}
+	var paramNames []string
+	if contractABI != "" {
+		structure, err := types.NewABIStructureFromJSON(contractABI)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range structure.ToInternalABI().Events {
+			for _, input := range event.Inputs {
+				// indexed parameters are topics, and not decoded
+				if !input.Indexed {
+					paramNames = append(paramNames, input.Name)
+				}
+			}
+		}
+	}
+	layout, err := r.newCSVLayout(address, eventCSVColumns, paramNames, eventColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamps := newBlockTimestamps(r.db)
+	return &csvExport{
+		filename: fmt.Sprintf("events-%s.csv", address.Hex()),
+		header:   layout.header(),
+		options:  args.Options,
+		total:    total,
+		fetch: func(options *types.QueryOptions) ([]uint64, func(*csv.Writer, int) error, error) {
+			events, err := r.db.GetAllEventsFromAddress(address, options)
+			if err != nil {
+				return nil, nil, err
+			}
+			blocks := make([]uint64, len(events))
+			for i, e := range events {
+				blocks[i] = e.BlockNumber
+			}
+			write := func(writer *csv.Writer, from int) error {
+				for _, e := range events[from:] {
+					parsed := &types.ParsedEvent{RawEvent: e}
+					parsed.SetTimestamp(timestamps.lookup(e.BlockNumber, e.Timestamp))
+					if contractABI != "" {
+						if err := parsed.ParseEvent(contractABI); err != nil {
+							return err
+						}
+					}
+					row := []string{
+						fmt.Sprint(e.BlockNumber),
+						fmt.Sprint(parsed.Timestamp),
+						parsed.TimestampISO,
+						e.TransactionHash.Hex(),
+						fmt.Sprint(e.TransactionIndex),
+						fmt.Sprint(e.Index),
+						parsed.Sig,
+					}
+					if err := writer.Write(layout.row(row, parsed.ParsedData)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			return blocks, write, nil
+		},
+	}, nil
+}
+
+func (r *RPCAPIs) transactionsCSVExport(args *AddressWithOptions) (*csvExport, error) {
+	if err := r.prepareExportOptions(args); err != nil {
+		return nil, err
+	}
+	address := *args.Address
+	total, err := r.db.GetTransactionsToAddressTotal(address, args.Options)
+	if err != nil {
+		return nil, err
+	}
+	contractABI, err := r.db.GetContractABI(address)
+	if err != nil {
+		return nil, err
+	}
+	var paramNames []string
+	if contractABI != "" {
+		structure, err := types.NewABIStructureFromJSON(contractABI)
+		if err != nil {
+			return nil, err
+		}
+		internalABI := structure.ToInternalABI()
+		for _, input := range internalABI.Constructor.Inputs {
+			paramNames = append(paramNames, input.Name)
+		}
+		for _, function := range internalABI.Functions {
+			for _, input := range function.Inputs {
+				paramNames = append(paramNames, input.Name)
+			}
+		}
+	}
+	layout, err := r.newCSVLayout(address, transactionCSVColumns, paramNames, transactionColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &csvExport{
+		filename: fmt.Sprintf("transactions-%s.csv", address.Hex()),
+		header:   layout.header(),
+		options:  args.Options,
+		total:    total,
+		fetch: func(options *types.QueryOptions) ([]uint64, func(*csv.Writer, int) error, error) {
+			hashes, err := r.db.GetAllTransactionsToAddress(address, options)
+			if err != nil {
+				return nil, nil, err
+			}
+			txs := make([]*types.ParsedTransaction, len(hashes))
+			blocks := make([]uint64, len(hashes))
+			for i := range hashes {
+				txs[i] = &types.ParsedTransaction{}
+				if err := r.GetTransaction(nil, &hashes[i], txs[i]); err != nil {
+					return nil, nil, err
+				}
+				blocks[i] = txs[i].RawTransaction.BlockNumber
+			}
+			write := func(writer *csv.Writer, from int) error {
+				for _, parsed := range txs[from:] {
+					tx := parsed.RawTransaction
+					row := []string{
+						fmt.Sprint(tx.BlockNumber),
+						fmt.Sprint(parsed.Timestamp),
+						parsed.TimestampISO,
+						tx.Hash.Hex(),
+						fmt.Sprint(tx.Index),
+						tx.From.Hex(),
+						tx.To.Hex(),
+						fmt.Sprint(tx.Status),
+						parsed.Sig,
+					}
+					if err := writer.Write(layout.row(row, parsed.ParsedData)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			return blocks, write, nil
+		},
+	}, nil
+}
+
+// csvParams maps decoded parameters to columns. Parameters with the same name
+// in different functions or events share a column, and a parameter that has
+// the same name as a fixed column is prefixed with "param.".
+type csvParams struct {
+	names  []string
+	header []string
+}
+
+func newCSVParams(columns []string, names []string) *csvParams {
+	taken := make(map[string]bool)
+	for _, column := range columns {
+		taken[column] = true
+	}
+	seen := make(map[string]bool)
+	params := &csvParams{}
+	for _, name := range names {
+		// unnamed parameters can't be told apart
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		params.names = append(params.names, name)
+		if taken[name] {
+			params.header = append(params.header, "param."+name)
+		} else {
+			params.header = append(params.header, name)
+		}
+	}
+	return params
+}
+
+func (p *csvParams) values(data types.ParsedData) []string {
+	values := make([]string, len(p.names))
+	for i, name := range p.names {
+		values[i] = csvValue(data[name])
+	}
+	return values
+}
@@ -0,0 +1,181 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// paramFieldPrefix starts the fields of mapped columns that are decoded
+// parameters rather than default columns
+const paramFieldPrefix = "param."
+
+// csvLayout arranges the default columns and decoded parameters of each row,
+// either as the default layout, or as the columns mapped by the template of
+// the exported contract.
+type csvLayout struct {
+	defaults []string
+	params   *csvParams
+	// nil for the default layout
+	columns []*types.CSVColumnConfig
+}
+
+// newCSVLayout uses the columns the contract's template maps, if it has any,
+// from those given by columnsOf, or else the default columns followed by the
+// decoded parameters.
+func (r *RPCAPIs) newCSVLayout(address types.Address, defaults []string, paramNames []string, columnsOf func(*types.TemplateConfig) []*types.CSVColumnConfig) (*csvLayout, error) {
+	layout := &csvLayout{defaults: defaults, params: newCSVParams(defaults, paramNames)}
+	if len(r.csvTemplates) == 0 {
+		return layout, nil
+	}
+	templateName, err := r.db.GetContractTemplate(address)
+	if err != nil {
+		return nil, err
+	}
+	template, ok := r.csvTemplates[templateName]
+	if !ok || len(columnsOf(template)) == 0 {
+		return layout, nil
+	}
+
+	for _, column := range columnsOf(template) {
+		if !strings.HasPrefix(column.Field, paramFieldPrefix) && indexOf(defaults, column.Field) < 0 {
+			return nil, fmt.Errorf("unknown CSV column field %s in template %s", column.Field, templateName)
+		}
+	}
+	layout.columns = columnsOf(template)
+	return layout, nil
+}
+
+// csvTemplates returns the templates that map columns of either export
+func csvTemplates(templates []*types.TemplateConfig) map[string]*types.TemplateConfig {
+	mapped := make(map[string]*types.TemplateConfig)
+	for _, template := range templates {
+		if len(template.EventColumns) > 0 || len(template.TransactionColumns) > 0 {
+			mapped[template.TemplateName] = template
+		}
+	}
+	return mapped
+}
+
+func eventColumns(template *types.TemplateConfig) []*types.CSVColumnConfig {
+	return template.EventColumns
+}
+
+func transactionColumns(template *types.TemplateConfig) []*types.CSVColumnConfig {
+	return template.TransactionColumns
+}
+
+func (l *csvLayout) header() []string {
+	if l.columns == nil {
+		return append(append([]string{}, l.defaults...), l.params.header...)
+	}
+	header := make([]string, len(l.columns))
+	for i, column := range l.columns {
+		header[i] = column.Name
+	}
+	return header
+}
+
+// row returns the row with the given values of the default columns and
+// decoded parameters
+func (l *csvLayout) row(defaults []string, data types.ParsedData) []string {
+	if l.columns == nil {
+		return append(defaults, l.params.values(data)...)
+	}
+	row := make([]string, len(l.columns))
+	for i, column := range l.columns {
+		var value interface{}
+		if strings.HasPrefix(column.Field, paramFieldPrefix) {
+			value = lookupParam(data, strings.TrimPrefix(column.Field, paramFieldPrefix))
+		} else {
+			value = defaults[indexOf(l.defaults, column.Field)]
+		}
+		row[i] = formatCSVValue(csvValue(value), column.Format)
+	}
+	return row
+}
+
+// lookupParam follows a dot separated path through tuples and arrays, returning
+// nil if the parameter doesn't have it
+func lookupParam(data types.ParsedData, path string) interface{} {
+	var value interface{} = map[string]interface{}(data)
+	for _, part := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[part]
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil
+			}
+			value = v[index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// csvValue returns strings as they are, and other values as JSON
+func csvValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if str, ok := value.(string); ok {
+		return str
+	}
+	// numbers, booleans, arrays and tuples
+	marshalled, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(marshalled)
+}
+
+// formatCSVValue applies a column format, leaving values it doesn't apply to
+// as they are
+func formatCSVValue(value string, format string) string {
+	switch format {
+	case "":
+		return value
+	case types.CSVDateFormat, types.CSVDateTimeFormat:
+		timestamp, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return value
+		}
+		if format == types.CSVDateFormat {
+			return time.Unix(timestamp, 0).UTC().Format("2006-01-02")
+		}
+		return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+	}
+
+	decimals, ok := types.ParseCSVDecimals(format)
+	integer, isInteger := new(big.Int).SetString(value, 10)
+	if !ok || !isInteger || decimals == 0 {
+		return value
+	}
+	digits := new(big.Int).Abs(integer).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	point := len(digits) - decimals
+	formatted := digits[:point] + "." + digits[point:]
+	if integer.Sign() < 0 {
+		return "-" + formatted
+	}
+	return formatted
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
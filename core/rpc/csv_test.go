@@ -0,0 +1,198 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestCSVExporter(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, apis.AddABI(dummyReq, &AddressWithData{&addr, validABI}, nil))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{addr}, []*types.Block{block}))
+	exporter := NewCSVExporter(apis, &Authoriser{}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/?format=csv&method=reporting.GetAllEventsFromAddress&address="+addr.Hex(), nil)
+	assert.True(t, IsCSVRequest(req))
+	rec := httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, CSVContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "blockNumber,timestamp,timestampISO,transactionHash,transactionIndex,index,eventSig,_value\n"+
+		"0,0,,0x,0,0,event valueSet(uint256 _value),1000\n", rec.Body.String())
+
+	body := `{"jsonrpc":"2.0","method":"reporting.GetAllTransactionsToAddress","params":[{"address":"` + addr.Hex() + `"}],"id":1}`
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Accept", CSVContentType)
+	assert.True(t, IsCSVRequest(req))
+	rec = httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, []string{"blockNumber", "timestamp", "timestampISO", "hash", "index", "from", "to", "status", "txSig", "_initVal", "_x"}, rows[0])
+	assert.Equal(t, "set(uint256 _x)", rows[1][8])
+	assert.Equal(t, []string{"", "1000"}, rows[1][9:])
+
+	req = httptest.NewRequest(http.MethodGet, "/?format=csv&method=reporting.GetBlock&address="+addr.Hex(), nil)
+	rec = httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "method is not available as CSV\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/?format=csv&method=reporting.GetAllEventsFromAddress&address="+addr.Hex()+"&endBlockNumber=x", nil)
+	rec = httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+	assert.Equal(t, "invalid endBlockNumber\n", rec.Body.String())
+
+	assert.False(t, IsCSVRequest(httptest.NewRequest(http.MethodPost, "/", nil)))
+}
+
+func TestCSVExporter_MappedColumns(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, db.AddTemplate("settlement", validABI, ""))
+	assert.Nil(t, db.AssignTemplate(addr, "settlement"))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{addr}, []*types.Block{block}))
+	apis.csvTemplates = csvTemplates([]*types.TemplateConfig{{
+		TemplateName: "settlement",
+		EventColumns: []*types.CSVColumnConfig{
+			{Field: "transactionHash", Name: "Reference"},
+			{Field: "param._value", Name: "Amount", Format: "decimals:2"},
+			{Field: "blockNumber", Name: "Block"},
+		},
+	}})
+	exporter := NewCSVExporter(apis, &Authoriser{}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/?format=csv&method=reporting.GetAllEventsFromAddress&address="+addr.Hex(), nil)
+	rec := httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Reference,Amount,Block\n0x,10.00,0\n", rec.Body.String())
+
+	// transactions keep the default columns, as none are mapped
+	req = httptest.NewRequest(http.MethodGet, "/?format=csv&method=reporting.GetAllTransactionsToAddress&address="+addr.Hex(), nil)
+	rec = httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "blockNumber,timestamp,"))
+
+	apis.csvTemplates["settlement"].EventColumns[0].Field = "reference"
+	req = httptest.NewRequest(http.MethodGet, "/?format=csv&method=reporting.GetAllEventsFromAddress&address="+addr.Hex(), nil)
+	rec = httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+	assert.Contains(t, rec.Body.String(), "unknown CSV column field reference in template settlement")
+}
+
+func TestLookupParam(t *testing.T) {
+	data := types.ParsedData{
+		"amount": big.NewInt(5),
+		"order": map[string]interface{}{
+			"amounts": []interface{}{big.NewInt(1), big.NewInt(2)},
+		},
+	}
+	assert.Equal(t, big.NewInt(5), lookupParam(data, "amount"))
+	assert.Equal(t, big.NewInt(2), lookupParam(data, "order.amounts.1"))
+	assert.Nil(t, lookupParam(data, "order.amounts.2"))
+	assert.Nil(t, lookupParam(data, "order.amounts.x"))
+	assert.Nil(t, lookupParam(data, "amount.value"))
+	assert.Nil(t, lookupParam(data, "missing"))
+}
+
+func TestFormatCSVValue(t *testing.T) {
+	cases := []struct {
+		value    string
+		format   string
+		expected string
+	}{
+		{"1500000", "decimals:6", "1.500000"},
+		{"15", "decimals:6", "0.000015"},
+		{"-15", "decimals:2", "-0.15"},
+		{"15", "decimals:0", "15"},
+		{"0xabc", "decimals:2", "0xabc"},
+		{"1600000000", "date", "2020-09-13"},
+		{"1600000000", "datetime", "2020-09-13T12:26:40Z"},
+		{"", "date", ""},
+		{"value", "", "value"},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.expected, formatCSVValue(tc.value, tc.format), "%s as %s", tc.value, tc.format)
+	}
+}
+
+func TestCSVExport_Stream(t *testing.T) {
+	// block 9 has more rows than fit on a page, and pages end part way
+	// through blocks
+	var rows []uint64
+	for block := uint64(10); block > 0; block-- {
+		count := 70
+		if block == 9 {
+			count = 1100
+		}
+		for i := 0; i < count; i++ {
+			rows = append(rows, block)
+		}
+	}
+
+	export := &csvExport{
+		header:  []string{"blockNumber", "row"},
+		options: &types.QueryOptions{EndBlockNumber: big.NewInt(10)},
+		total:   uint64(len(rows)),
+		fetch: func(options *types.QueryOptions) ([]uint64, func(*csv.Writer, int) error, error) {
+			// the rows up to the end block, paged like the database
+			first := 0
+			for first < len(rows) && rows[first] > options.EndBlockNumber.Uint64() {
+				first++
+			}
+			start := first + options.PageNumber*options.PageSize
+			end := start + options.PageSize
+			if start > len(rows) {
+				start = len(rows)
+			}
+			if end > len(rows) {
+				end = len(rows)
+			}
+			page := rows[start:end]
+			return page, func(writer *csv.Writer, from int) error {
+				for i := from; i < len(page); i++ {
+					if err := writer.Write([]string{fmt.Sprint(page[i]), fmt.Sprint(start + i)}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}, nil
+		},
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	assert.Nil(t, export.stream(writer, func() error {
+		writer.Flush()
+		return writer.Error()
+	}))
+
+	written, err := csv.NewReader(&buf).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, written, len(rows)+1)
+	for i, row := range written[1:] {
+		assert.Equal(t, []string{fmt.Sprint(rows[i]), fmt.Sprint(i)}, row)
+	}
+}
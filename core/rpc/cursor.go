@@ -0,0 +1,29 @@
+package rpc
+
+import (
+	"quorumengineering/quorum-report/types"
+)
+
+// transactionsCursor returns the cursor of the page after a full page of
+// transactions, positioned at its last transaction. A page that isn't full
+// is the last, so has no cursor.
+func (r *RPCAPIs) transactionsCursor(txs []types.Hash, options *types.QueryOptions) (string, error) {
+	if len(txs) == 0 || len(txs) < options.PageSize {
+		return "", nil
+	}
+	last, err := r.db.ReadTransaction(txs[len(txs)-1])
+	if err != nil {
+		return "", err
+	}
+	return types.NewCursor(last.BlockNumber, last.Index), nil
+}
+
+// eventsCursor returns the cursor of the page after a full page of events,
+// positioned at its last event
+func eventsCursor(events []*types.Event, options *types.QueryOptions) string {
+	if len(events) == 0 || len(events) < options.PageSize {
+		return ""
+	}
+	last := events[len(events)-1]
+	return types.NewCursor(last.BlockNumber, last.Index)
+}
@@ -0,0 +1,36 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestTransactionsCursor(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	indexed := *tx2
+	indexed.Index = 4
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, &indexed}))
+
+	options := &types.QueryOptions{PageSize: 2}
+	cursor, err := apis.transactionsCursor([]types.Hash{tx1.Hash, indexed.Hash}, options)
+	assert.Nil(t, err)
+	assert.Equal(t, types.NewCursor(1, 4), cursor)
+
+	// a page that isn't full is the last
+	cursor, err = apis.transactionsCursor([]types.Hash{tx1.Hash}, options)
+	assert.Nil(t, err)
+	assert.Empty(t, cursor)
+}
+
+func TestEventsCursor(t *testing.T) {
+	events := []*types.Event{{BlockNumber: 8, Index: 1}, {BlockNumber: 5, Index: 3}}
+
+	assert.Equal(t, types.NewCursor(5, 3), eventsCursor(events, &types.QueryOptions{PageSize: 2}))
+	assert.Empty(t, eventsCursor(events, &types.QueryOptions{PageSize: 3}))
+	assert.Empty(t, eventsCursor(nil, &types.QueryOptions{PageSize: 0}))
+}
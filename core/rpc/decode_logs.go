@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"fmt"
+	"sort"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// MaxDecodeLogs is the most logs that can be decoded in a single DecodeLogs
+// request
+const MaxDecodeLogs = 1000
+
+// logDecoder decodes raw logs with the registered ABIs: the ABI of the
+// contract that emitted a log, or else the ABI of any template with an event
+// matching its first topic. Each ABI is fetched once per request.
+type logDecoder struct {
+	db   database.Database
+	abis map[types.Address]string
+	// template ABIs keyed by the signature hashes of their events, built when
+	// first needed
+	eventABIs map[string]string
+}
+
+func newLogDecoder(db database.Database) *logDecoder {
+	return &logDecoder{db: db, abis: make(map[types.Address]string)}
+}
+
+// decode decodes a log, leaving the event signature empty if no registered
+// ABI has an event matching it. Data that doesn't match the event's
+// parameters gives an error in the parsed data rather than failing the others.
+func (d *logDecoder) decode(raw *types.Event) (*types.ParsedEvent, error) {
+	parsed := &types.ParsedEvent{RawEvent: raw, ParsedData: types.ParsedData{}}
+	parsed.SetTimestamp(raw.Timestamp)
+	// anonymous events have no signature to match on
+	if len(raw.Topics) == 0 {
+		return parsed, nil
+	}
+
+	contractABI, ok := d.abis[raw.Address]
+	if !ok {
+		var err error
+		if contractABI, err = d.db.GetContractABI(raw.Address); err != nil {
+			return nil, err
+		}
+		d.abis[raw.Address] = contractABI
+	}
+	if contractABI == "" || !hasEvent(contractABI, raw.Topics[0]) {
+		if d.eventABIs == nil {
+			if err := d.loadEventABIs(); err != nil {
+				return nil, err
+			}
+		}
+		contractABI = d.eventABIs[raw.Topics[0].String()]
+	}
+	if contractABI == "" {
+		return parsed, nil
+	}
+	if err := parseLog(parsed, contractABI); err != nil {
+		parsed.ParsedData = types.ParsedData{"error": "unable to parse data"}
+	}
+	return parsed, nil
+}
+
+// parseLog parses a log with the ABI. The ABI parser doesn't check the data
+// is long enough for the parameters, and logs from the caller can be cut short,
+// so reading past the end is turned into an error.
+func parseLog(parsed *types.ParsedEvent, contractABI string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("data too short: %v", r)
+		}
+	}()
+	return parsed.ParseEvent(contractABI)
+}
+
+// loadEventABIs indexes the ABIs of all templates by their events, the first
+// template by name winning when several have the same event
+func (d *logDecoder) loadEventABIs() error {
+	names, err := d.db.GetTemplates()
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	d.eventABIs = make(map[string]string)
+	for _, name := range names {
+		template, err := d.db.GetTemplateDetails(name)
+		if err != nil {
+			return err
+		}
+		structure, err := types.NewABIStructureFromJSON(template.ABI)
+		if err != nil {
+			log.Warn("Skipping template with an invalid ABI", "template", name, "err", err)
+			continue
+		}
+		for _, event := range structure.ToInternalABI().Events {
+			signature := "0x" + event.Signature()
+			if _, ok := d.eventABIs[signature]; !ok {
+				d.eventABIs[signature] = template.ABI
+			}
+		}
+	}
+	return nil
+}
+
+// hasEvent returns whether the ABI has an event with the signature hash
+func hasEvent(rawABI string, signature types.Hash) bool {
+	structure, err := types.NewABIStructureFromJSON(rawABI)
+	if err != nil {
+		return false
+	}
+	for _, event := range structure.ToInternalABI().Events {
+		if "0x"+event.Signature() == signature.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func validateDecodeLogs(logs []*types.Event) error {
+	if len(logs) > MaxDecodeLogs {
+		return fmt.Errorf("at most %d logs can be decoded at a time", MaxDecodeLogs)
+	}
+	for i, raw := range logs {
+		if raw == nil {
+			return fmt.Errorf("log %d is empty", i)
+		}
+	}
+	return nil
+}
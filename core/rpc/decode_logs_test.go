@@ -0,0 +1,63 @@
+package rpc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestDecodeLogs(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, apis.AddABI(dummyReq, &AddressWithData{&addr, validABI}, nil))
+
+	valueSet := types.NewHash("0xefe5cb8d23d632b5d2cdd9f0a151c4b1a84ccb7afa1c57331009aa922d5e4f36")
+	value := types.NewHexData("0x00000000000000000000000000000000000000000000000000000000000003e8")
+	logs := []*types.Event{
+		// from the registered contract
+		{Address: addr, Topics: []types.Hash{valueSet}, Data: value, Timestamp: 1600000000},
+		// from an unregistered contract, matched by the event signature
+		{Address: types.NewAddress("0x0000000000000000000000000000000000000002"), Topics: []types.Hash{valueSet}, Data: value},
+		// no registered ABI has the event
+		{Address: addr, Topics: []types.Hash{types.NewHash("0x01")}, Data: value},
+		// data that doesn't match the event's parameters
+		{Address: addr, Topics: []types.Hash{valueSet}, Data: types.NewHexData("0x01")},
+		// anonymous
+		{Address: addr, Data: value},
+	}
+
+	var decoded []*types.ParsedEvent
+	err := apis.DecodeLogs(dummyReq, &DecodeLogsArgs{Logs: logs}, &decoded)
+	assert.Nil(t, err)
+	assert.Len(t, decoded, 5)
+	for i, parsed := range decoded {
+		assert.Equal(t, logs[i], parsed.RawEvent)
+	}
+
+	assert.Equal(t, "event valueSet(uint256 _value)", decoded[0].Sig)
+	assert.Equal(t, big.NewInt(1000), decoded[0].ParsedData["_value"])
+	assert.EqualValues(t, 1600000000, decoded[0].Timestamp)
+	assert.Equal(t, "event valueSet(uint256 _value)", decoded[1].Sig)
+	assert.Equal(t, big.NewInt(1000), decoded[1].ParsedData["_value"])
+	assert.Empty(t, decoded[2].Sig)
+	assert.Empty(t, decoded[2].ParsedData)
+	assert.Equal(t, types.ParsedData{"error": "unable to parse data"}, decoded[3].ParsedData)
+	assert.Empty(t, decoded[4].Sig)
+}
+
+func TestDecodeLogs_Validation(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+
+	var decoded []*types.ParsedEvent
+	err := apis.DecodeLogs(dummyReq, &DecodeLogsArgs{Logs: make([]*types.Event, MaxDecodeLogs+1)}, &decoded)
+	assert.EqualError(t, err, "at most 1000 logs can be decoded at a time")
+
+	err = apis.DecodeLogs(dummyReq, &DecodeLogsArgs{Logs: []*types.Event{{Address: addr}, nil}}, &decoded)
+	assert.EqualError(t, err, "log 1 is empty")
+}
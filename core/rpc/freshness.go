@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+)
+
+const (
+	LastPersistedBlockHeader     = "X-Last-Persisted-Block"
+	LastPersistedTimestampHeader = "X-Last-Persisted-Timestamp"
+	StaleHeader                  = "X-Data-Stale"
+
+	// staleWarning is the standard warning for a response that is stale
+	staleWarning = `110 - "Response is Stale"`
+)
+
+// freshnessHeaders are the headers browsers are allowed to read from
+// cross-origin responses
+var freshnessHeaders = []string{LastPersistedBlockHeader, LastPersistedTimestampHeader, StaleHeader, "Warning"}
+
+// freshness adds the last persisted block, and its block time, to the headers
+// of API responses, so consumers can tell how far the data they read is
+// behind the chain. Once the block is older than staleAfter, responses are
+// also flagged as stale, unless staleAfter is 0.
+type freshness struct {
+	db         database.Database
+	staleAfter time.Duration
+	now        func() time.Time
+
+	// the timestamp of the last persisted block, read once per block
+	mux       sync.Mutex
+	block     uint64
+	timestamp uint64
+}
+
+func newFreshness(db database.Database, staleAfter time.Duration) *freshness {
+	return &freshness{db: db, staleAfter: staleAfter, now: time.Now}
+}
+
+func (f *freshness) lastPersisted() (uint64, uint64, error) {
+	number, err := f.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		return 0, 0, err
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if number != f.block || f.timestamp == 0 {
+		block, err := f.db.ReadBlock(number)
+		if err != nil {
+			return 0, 0, err
+		}
+		f.block, f.timestamp = number, block.Timestamp
+	}
+	return f.block, f.timestamp, nil
+}
+
+func (f *freshness) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		number, timestamp, err := f.lastPersisted()
+		if err != nil {
+			// nothing has been persisted yet, or the database is unavailable,
+			// which the request itself will report
+			log.Debug("Unable to read last persisted block", "err", err)
+			next.ServeHTTP(w, req)
+			return
+		}
+		header := w.Header()
+		header.Set(LastPersistedBlockHeader, strconv.FormatUint(number, 10))
+		header.Set(LastPersistedTimestampHeader, strconv.FormatUint(timestamp, 10))
+		if f.staleAfter > 0 && f.now().Sub(time.Unix(int64(timestamp), 0)) > f.staleAfter {
+			header.Set(StaleHeader, "true")
+			header.Set("Warning", staleWarning)
+		}
+		next.ServeHTTP(w, req)
+	})
+}
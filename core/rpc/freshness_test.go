@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestFreshness(t *testing.T) {
+	db := memory.NewMemoryDB()
+	f := newFreshness(db, time.Minute)
+	f.now = func() time.Time { return time.Unix(1000, 0) }
+	handler := f.handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func() http.Header {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		return rec.Header()
+	}
+
+	// nothing persisted yet
+	header := serve()
+	assert.Empty(t, header.Get(LastPersistedBlockHeader))
+
+	assert.Nil(t, db.WriteBlocks([]*types.Block{{Number: 1, Timestamp: 980}}))
+	header = serve()
+	assert.Equal(t, "1", header.Get(LastPersistedBlockHeader))
+	assert.Equal(t, "980", header.Get(LastPersistedTimestampHeader))
+	assert.Empty(t, header.Get(StaleHeader))
+	assert.Empty(t, header.Get("Warning"))
+
+	// the node falls behind
+	f.now = func() time.Time { return time.Unix(1100, 0) }
+	header = serve()
+	assert.Equal(t, "true", header.Get(StaleHeader))
+	assert.Equal(t, staleWarning, header.Get("Warning"))
+
+	assert.Nil(t, db.WriteBlocks([]*types.Block{{Number: 2, Timestamp: 1090}}))
+	header = serve()
+	assert.Equal(t, "2", header.Get(LastPersistedBlockHeader))
+	assert.Equal(t, "1090", header.Get(LastPersistedTimestampHeader))
+	assert.Empty(t, header.Get(StaleHeader))
+
+	// never stale without a threshold
+	f.staleAfter = 0
+	f.now = func() time.Time { return time.Unix(100000, 0) }
+	assert.Empty(t, serve().Get(StaleHeader))
+}
@@ -0,0 +1,41 @@
+package rpc
+
+import (
+	"fmt"
+
+	"github.com/gorilla/rpc/v2/json"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// ContractFrozenError is returned when a contract's data is queried at a
+// block after its terminal block, after which no more of its data is expected.
+// It is the error data of JSON-RPC responses, so clients can tell a frozen
+// contract from missing data.
+type ContractFrozenError struct {
+	Message       string        `json:"message"`
+	Address       types.Address `json:"address"`
+	TerminalBlock uint64        `json:"terminalBlock"`
+}
+
+func (e *ContractFrozenError) Error() string {
+	return fmt.Sprintf("%s: contract %s is frozen at block %d", e.Message, e.Address.Hex(), e.TerminalBlock)
+}
+
+type terminalBlockReader interface {
+	GetTerminalBlock(types.Address) (uint64, error)
+}
+
+// checkFrozen returns a ContractFrozenError if the block is after the terminal
+// block of the contract
+func checkFrozen(db terminalBlockReader, address types.Address, block uint64) error {
+	terminalBlock, err := db.GetTerminalBlock(address)
+	if err != nil {
+		return err
+	}
+	if terminalBlock > 0 && block > terminalBlock {
+		// the error data is returned as an object, not only its message
+		return &json.Error{Data: &ContractFrozenError{Message: "contract data frozen", Address: address, TerminalBlock: terminalBlock}}
+	}
+	return nil
+}
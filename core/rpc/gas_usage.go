@@ -0,0 +1,42 @@
+package rpc
+
+import (
+	"net/http"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// GetGasUsageByContract totals the gas used by the transactions sent to, or
+// creating, each contract, most expensive first
+func (r *RPCAPIs) GetGasUsageByContract(req *http.Request, args *types.GasUsageQuery, reply *[]*types.GasUsage) error {
+	return r.gasUsage(types.GasUsageByContract, args, reply)
+}
+
+// GetGasUsageByFunction totals the gas used by the transactions calling each
+// function selector, most expensive first
+func (r *RPCAPIs) GetGasUsageByFunction(req *http.Request, args *types.GasUsageQuery, reply *[]*types.GasUsage) error {
+	return r.gasUsage(types.GasUsageByFunction, args, reply)
+}
+
+// GetGasUsageByDay totals the gas used by the transactions of each UTC day,
+// oldest first
+func (r *RPCAPIs) GetGasUsageByDay(req *http.Request, args *types.GasUsageQuery, reply *[]*types.GasUsage) error {
+	return r.gasUsage(types.GasUsageByDay, args, reply)
+}
+
+func (r *RPCAPIs) gasUsage(groupBy string, args *types.GasUsageQuery, reply *[]*types.GasUsage) error {
+	args.GroupBy = groupBy
+	args.SetDefaults()
+	if err := args.Validate(); err != nil {
+		return err
+	}
+	if err := r.guardGasUsage(args); err != nil {
+		return err
+	}
+	usage, err := r.db.GetGasUsage(args)
+	if err != nil {
+		return err
+	}
+	*reply = usage
+	return nil
+}
@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/database/scoped"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestGetGasUsage(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+
+	token := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	registry := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	transfer := types.NewHexData("0xa9059cbb000000000000000000000000000000000000000000000000000000000000000a")
+	approve := types.NewHexData("0x095ea7b3")
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{
+		{Hash: types.NewHash("0x01"), BlockNumber: 1, Timestamp: 86399, CreatedContract: token, Data: types.NewHexData("0x6080"), GasUsed: 500000},
+		{Hash: types.NewHash("0x02"), BlockNumber: 2, Timestamp: 86400, To: token, Data: transfer, GasUsed: 50000},
+		{Hash: types.NewHash("0x03"), BlockNumber: 3, Timestamp: 86500, To: token, Data: transfer, GasUsed: 30000},
+		{Hash: types.NewHash("0x04"), BlockNumber: 4, Timestamp: 200000, To: registry, Data: approve, GasUsed: 45000},
+		// private transactions are grouped by their private input
+		{Hash: types.NewHash("0x05"), BlockNumber: 5, Timestamp: 200001, To: registry, IsPrivate: true, Data: types.NewHexData("0xffff0000"), PrivateData: approve, GasUsed: 25000},
+	}))
+
+	var usage []*types.GasUsage
+	assert.Nil(t, apis.GetGasUsageByContract(dummyReq, &types.GasUsageQuery{}, &usage))
+	assert.Equal(t, []*types.GasUsage{
+		{Key: token.String(), Transactions: 3, TotalGasUsed: 580000, AverageGasUsed: 193333},
+		{Key: registry.String(), Transactions: 2, TotalGasUsed: 70000, AverageGasUsed: 35000},
+	}, usage)
+
+	// contract creations have no function selector
+	assert.Nil(t, apis.GetGasUsageByFunction(dummyReq, &types.GasUsageQuery{StartBlock: 2, Limit: 1}, &usage))
+	assert.Equal(t, []*types.GasUsage{{Key: "0xa9059cbb", Transactions: 2, TotalGasUsed: 80000, AverageGasUsed: 40000}}, usage)
+	assert.Nil(t, apis.GetGasUsageByFunction(dummyReq, &types.GasUsageQuery{Contract: &registry}, &usage))
+	assert.Equal(t, []*types.GasUsage{{Key: "0x095ea7b3", Transactions: 2, TotalGasUsed: 70000, AverageGasUsed: 35000}}, usage)
+
+	// the latest days are kept
+	assert.Nil(t, apis.GetGasUsageByDay(dummyReq, &types.GasUsageQuery{EndBlock: 4}, &usage))
+	assert.Equal(t, []*types.GasUsage{
+		{Key: "1970-01-01", Transactions: 1, TotalGasUsed: 500000, AverageGasUsed: 500000},
+		{Key: "1970-01-02", Transactions: 2, TotalGasUsed: 80000, AverageGasUsed: 40000},
+		{Key: "1970-01-03", Transactions: 1, TotalGasUsed: 45000, AverageGasUsed: 45000},
+	}, usage)
+	assert.Nil(t, apis.GetGasUsageByDay(dummyReq, &types.GasUsageQuery{Limit: 1}, &usage))
+	assert.Equal(t, []*types.GasUsage{{Key: "1970-01-03", Transactions: 2, TotalGasUsed: 70000, AverageGasUsed: 35000}}, usage)
+
+	assert.EqualError(t, apis.GetGasUsageByDay(dummyReq, &types.GasUsageQuery{StartBlock: 5, EndBlock: 4}, &usage), "end block 4 is before start block 5")
+	assert.EqualError(t, apis.GetGasUsageByDay(dummyReq, &types.GasUsageQuery{Limit: 1001}, &usage), "limit must be between 1 and 1000")
+
+	// keys restricted to contract groups only see their contracts
+	scopedAPIs := NewRPCAPIs(scoped.NewDatabase(db, []types.Address{registry}), NewDefaultContractManager(db))
+	assert.Nil(t, scopedAPIs.GetGasUsageByContract(dummyReq, &types.GasUsageQuery{}, &usage))
+	assert.Equal(t, []*types.GasUsage{{Key: registry.String(), Transactions: 2, TotalGasUsed: 70000, AverageGasUsed: 35000}}, usage)
+	assert.Equal(t, scoped.ErrContractNotInScope, scopedAPIs.GetGasUsageByFunction(dummyReq, &types.GasUsageQuery{Contract: &token}, &usage))
+}
@@ -0,0 +1,151 @@
+package rpc
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/rpc/v2/json"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+// QueryTooExpensiveError is returned for a query estimated to be over a limit
+// of the query guard. It is the error data of JSON-RPC responses, so clients
+// can retry with the suggested parameters.
+type QueryTooExpensiveError struct {
+	Message string `json:"message"`
+	// What was estimated: "blocks", "storageStates" or "seconds"
+	Measure  string `json:"measure"`
+	Estimate uint64 `json:"estimate"`
+	Limit    uint64 `json:"limit"`
+	// Narrower parameters within the limit, by their name in the request
+	Suggested map[string]uint64 `json:"suggested"`
+}
+
+func (e *QueryTooExpensiveError) Error() string {
+	names := make([]string, 0, len(e.Suggested))
+	for name := range e.Suggested {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	suggested := make([]string, len(names))
+	for i, name := range names {
+		suggested[i] = fmt.Sprintf("%s %d", name, e.Suggested[name])
+	}
+	return fmt.Sprintf("%s: %d %s over the limit of %d, try %s", e.Message, e.Estimate, e.Measure, e.Limit, strings.Join(suggested, ", "))
+}
+
+func queryTooExpensive(measure string, estimate uint64, limit uint64, suggested map[string]uint64) error {
+	// the error data is returned as an object, not only its message
+	return &json.Error{Data: &QueryTooExpensiveError{
+		Message:   "query too expensive",
+		Measure:   measure,
+		Estimate:  estimate,
+		Limit:     limit,
+		Suggested: suggested,
+	}}
+}
+
+// guardStorage checks a query of the address's storage over the block range of
+// the options, which have their defaults set, against the limits on storage
+// queries. The block span is checked first, then the number of storage states
+// in the range, which is counted by the database. A range over a limit is
+// narrowed to the newest blocks within it if the guard degrades queries, or
+// else the query is rejected with the narrower range.
+func (r *RPCAPIs) guardStorage(address types.Address, options *types.PageOptions) error {
+	if r.queryGuard == nil {
+		return nil
+	}
+	begin, end := options.BeginBlockNumber.Uint64(), options.EndBlockNumber.Uint64()
+	if options.EndBlockNumber.Sign() < 0 {
+		lastFiltered, err := r.db.GetLastFiltered(address)
+		if err != nil {
+			return err
+		}
+		end = lastFiltered
+	}
+	if begin > end {
+		return nil
+	}
+
+	if limit := r.queryGuard.MaxStorageBlocks; limit > 0 && end-begin+1 > limit {
+		if err := r.narrowStorage(options, "blocks", end-begin+1, limit, end-limit+1, end); err != nil {
+			return err
+		}
+		begin = end - limit + 1
+	}
+	if limit := r.queryGuard.MaxStorageStates; limit > 0 {
+		states, err := r.db.GetStorageTotal(address, options)
+		if err != nil {
+			return err
+		}
+		if states > limit {
+			// the states are taken to be spread evenly over the range
+			span := new(big.Int).SetUint64(end - begin + 1)
+			span.Mul(span, new(big.Int).SetUint64(limit))
+			span.Div(span, new(big.Int).SetUint64(states))
+			narrowed := span.Uint64()
+			if narrowed == 0 {
+				narrowed = 1
+			}
+			return r.narrowStorage(options, "storageStates", states, limit, end-narrowed+1, end)
+		}
+	}
+	return nil
+}
+
+// narrowStorage sets the options to the narrower range if the guard degrades
+// queries, or else returns the error rejecting the query
+func (r *RPCAPIs) narrowStorage(options *types.PageOptions, measure string, estimate, limit, begin, end uint64) error {
+	if !r.queryGuard.Degrade {
+		return queryTooExpensive(measure, estimate, limit, map[string]uint64{"beginBlockNumber": begin, "endBlockNumber": end})
+	}
+	log.Debug("Narrowing storage query", "measure", measure, "estimate", estimate, "limit", limit, "begin", begin, "end", end)
+	options.BeginBlockNumber = new(big.Int).SetUint64(begin)
+	options.EndBlockNumber = new(big.Int).SetUint64(end)
+	return nil
+}
+
+// guardGasUsage rejects totalling gas usage over more blocks than the limit,
+// up to the last persisted block if no end is given
+func (r *RPCAPIs) guardGasUsage(query *types.GasUsageQuery) error {
+	if r.queryGuard == nil || r.queryGuard.MaxAggregationBlocks == 0 {
+		return nil
+	}
+	end := query.EndBlock
+	if end == 0 {
+		lastPersisted, err := r.db.GetLastPersistedBlockNumber()
+		if err != nil {
+			return err
+		}
+		end = lastPersisted
+	}
+	limit := r.queryGuard.MaxAggregationBlocks
+	if end < query.StartBlock || end-query.StartBlock+1 <= limit {
+		return nil
+	}
+	return queryTooExpensive("blocks", end-query.StartBlock+1, limit, map[string]uint64{"startBlock": end - limit + 1, "endBlock": end})
+}
+
+// guardNetworkActivity rejects totalling network activity over more days than
+// the limit, counting up to now for ranges ending in the future
+func (r *RPCAPIs) guardNetworkActivity(args *TimeRange) error {
+	if r.queryGuard == nil || r.queryGuard.MaxActivityDays == 0 {
+		return nil
+	}
+	to := args.To
+	if now := uint64(time.Now().Unix()); to > now {
+		to = now
+	}
+	limit := r.queryGuard.MaxActivityDays * secondsPerDay
+	if to < args.From || to-args.From+1 <= limit {
+		return nil
+	}
+	return queryTooExpensive("seconds", to-args.From+1, limit, map[string]uint64{"from": to - limit + 1, "to": to})
+}
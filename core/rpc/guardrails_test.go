@@ -0,0 +1,114 @@
+package rpc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/gorilla/rpc/v2/json"
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func tooExpensive(t *testing.T, err error) *QueryTooExpensiveError {
+	jsonErr, ok := err.(*json.Error)
+	if !assert.True(t, ok, "%v", err) {
+		return nil
+	}
+	return jsonErr.Data.(*QueryTooExpensiveError)
+}
+
+func TestGuardStorage(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	layout := `{"storage":[{"label":"counter","offset":0,"slot":"0","type":"t_uint256"}],"types":{"t_uint256":{"encoding":"inplace","label":"uint256","numberOfBytes":"32"}}}`
+	assert.Nil(t, apis.AddStorageABI(dummyReq, &AddressWithData{Address: &addr, Data: layout}, nil))
+	for i := uint64(1); i <= 10; i++ {
+		decoded := []*types.StorageValue{{Variable: "counter", Value: big.NewInt(int64(i)).String()}}
+		assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {Root: types.NewHash(big.NewInt(int64(i)).Text(16)), Decoded: decoded}}, i*10))
+	}
+
+	history := func(begin int64, end int64) (*types.ReportingResponseTemplate, error) {
+		var reply types.ReportingResponseTemplate
+		err := apis.GetStorageHistory(dummyReq, &StorageHistoryArgs{
+			Address: &addr,
+			Options: &types.PageOptions{BeginBlockNumber: big.NewInt(begin), EndBlockNumber: big.NewInt(end)},
+		}, &reply)
+		return &reply, err
+	}
+
+	// queries aren't guarded unless configured
+	_, err := history(0, 100)
+	assert.Nil(t, err)
+
+	apis.queryGuard = &types.QueryGuardConfig{MaxStorageBlocks: 50}
+	_, err = history(0, 100)
+	assert.Equal(t, &QueryTooExpensiveError{
+		Message:   "query too expensive",
+		Measure:   "blocks",
+		Estimate:  101,
+		Limit:     50,
+		Suggested: map[string]uint64{"beginBlockNumber": 51, "endBlockNumber": 100},
+	}, tooExpensive(t, err))
+	assert.EqualError(t, err, "query too expensive: 101 blocks over the limit of 50, try beginBlockNumber 51, endBlockNumber 100")
+	_, err = history(51, 100)
+	assert.Nil(t, err)
+
+	// the states are estimated to be spread evenly over the range
+	apis.queryGuard = &types.QueryGuardConfig{MaxStorageStates: 4}
+	var ranges RangeQueryResult
+	err = apis.GetStorageHistoryCount(dummyReq, &AddressWithBlockRange{Address: &addr, Options: &types.PageOptions{EndBlockNumber: big.NewInt(100)}}, &ranges)
+	assert.Equal(t, &QueryTooExpensiveError{
+		Message:   "query too expensive",
+		Measure:   "storageStates",
+		Estimate:  10,
+		Limit:     4,
+		Suggested: map[string]uint64{"beginBlockNumber": 61, "endBlockNumber": 100},
+	}, tooExpensive(t, err))
+
+	// or the range is narrowed to the newest blocks within the limits
+	apis.queryGuard = &types.QueryGuardConfig{MaxStorageBlocks: 80, MaxStorageStates: 4, Degrade: true}
+	reply, err := history(0, 100)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 61, reply.Options.BeginBlockNumber.Uint64())
+	assert.EqualValues(t, 100, reply.Options.EndBlockNumber.Uint64())
+	assert.EqualValues(t, 4, reply.Total)
+
+	var average StorageAverageResp
+	assert.Nil(t, apis.GetStorageAverage(dummyReq, &StorageAverageArgs{
+		Address:  &addr,
+		Variable: "counter",
+		Options:  &types.PageOptions{EndBlockNumber: big.NewInt(100)},
+	}, &average))
+	assert.EqualValues(t, 61, average.Options.BeginBlockNumber.Uint64())
+}
+
+func TestGuardAggregations(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	blocks := make([]*types.Block, 1001)
+	for i := range blocks {
+		blocks[i] = &types.Block{Number: uint64(i), Timestamp: uint64(i)}
+	}
+	assert.Nil(t, db.WriteBlocks(blocks))
+	apis.queryGuard = &types.QueryGuardConfig{MaxAggregationBlocks: 100, MaxActivityDays: 7}
+
+	// up to the last persisted block if no end is given
+	var usage []*types.GasUsage
+	err := apis.GetGasUsageByDay(dummyReq, &types.GasUsageQuery{}, &usage)
+	assert.Equal(t, &QueryTooExpensiveError{
+		Message:   "query too expensive",
+		Measure:   "blocks",
+		Estimate:  1001,
+		Limit:     100,
+		Suggested: map[string]uint64{"startBlock": 901, "endBlock": 1000},
+	}, tooExpensive(t, err))
+	assert.Nil(t, apis.GetGasUsageByDay(dummyReq, &types.GasUsageQuery{StartBlock: 901}, &usage))
+
+	var activity types.NetworkActivity
+	err = apis.GetNetworkActivity(dummyReq, &TimeRange{From: 0, To: 30 * secondsPerDay}, &activity)
+	assert.Equal(t, map[string]uint64{"from": 23*secondsPerDay + 1, "to": 30 * secondsPerDay}, tooExpensive(t, err).Suggested)
+	assert.Nil(t, apis.GetNetworkActivity(dummyReq, &TimeRange{From: 0, To: 7*secondsPerDay - 1}, &activity))
+}
@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// IsHealthRequest checks if the request is for the liveness or readiness
+// endpoint, which are served without authentication so orchestrators can probe
+// them
+func IsHealthRequest(req *http.Request) bool {
+	return req.Method == http.MethodGet && (req.URL.Path == LivenessPath || req.URL.Path == ReadinessPath)
+}
+
+// ServeHealth writes the health report, with a 503 status if the service isn't
+// live, for the liveness endpoint, or ready, for the readiness endpoint. All
+// is well if there is no checker.
+func ServeHealth(checker HealthChecker, w http.ResponseWriter, req *http.Request) {
+	report := &types.HealthReport{Live: true, Ready: true, Components: []*types.ComponentHealth{}}
+	if checker != nil {
+		report = checker.Health()
+	}
+
+	ok := report.Live
+	if req.URL.Path == ReadinessPath {
+		ok = report.Ready
+	}
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Warn("Writing health report failed", "err", err)
+	}
+}
@@ -0,0 +1,62 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+type fakeHealthChecker struct {
+	report *types.HealthReport
+}
+
+func (f *fakeHealthChecker) Health() *types.HealthReport {
+	return f.report
+}
+
+func serveHealthRequest(checker HealthChecker, path string) (int, *types.HealthReport) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	recorder := httptest.NewRecorder()
+	ServeHealth(checker, recorder, req)
+
+	var report types.HealthReport
+	_ = json.Unmarshal(recorder.Body.Bytes(), &report)
+	return recorder.Code, &report
+}
+
+func TestIsHealthRequest(t *testing.T) {
+	assert.True(t, IsHealthRequest(httptest.NewRequest(http.MethodGet, "/healthz", nil)))
+	assert.True(t, IsHealthRequest(httptest.NewRequest(http.MethodGet, "/readyz", nil)))
+	assert.False(t, IsHealthRequest(httptest.NewRequest(http.MethodPost, "/healthz", nil)))
+	assert.False(t, IsHealthRequest(httptest.NewRequest(http.MethodPost, "/", nil)))
+}
+
+func TestServeHealth(t *testing.T) {
+	checker := &fakeHealthChecker{report: &types.HealthReport{
+		Live:       true,
+		Components: []*types.ComponentHealth{{Name: types.FilterComponent, Error: "lag unknown"}},
+	}}
+
+	status, report := serveHealthRequest(checker, LivenessPath)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, checker.report, report)
+
+	status, report = serveHealthRequest(checker, ReadinessPath)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, checker.report, report)
+
+	checker.report.Live = false
+	status, _ = serveHealthRequest(checker, LivenessPath)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	// without a checker, e.g. in preview mode
+	status, report = serveHealthRequest(nil, ReadinessPath)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, report.Live)
+	assert.True(t, report.Ready)
+}
@@ -0,0 +1,182 @@
+package rpc
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// JWTVerifier validates JSON Web Tokens signed with HS256 using a shared
+// secret, or with RS256 using an RSA key pair, and returns the permission they
+// grant. Only the algorithm matching the configured key is accepted.
+type JWTVerifier struct {
+	secret          []byte
+	publicKey       *rsa.PublicKey
+	issuer          string
+	audience        string
+	permissionClaim string
+
+	now func() time.Time
+}
+
+func NewJWTVerifier(config *types.JWTConfig) (*JWTVerifier, error) {
+	verifier := &JWTVerifier{
+		secret:          []byte(config.Secret),
+		issuer:          config.Issuer,
+		audience:        config.Audience,
+		permissionClaim: config.PermissionClaim,
+		now:             time.Now,
+	}
+	if config.PublicKeyFile != "" {
+		encoded, err := ioutil.ReadFile(config.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := parseRSAPublicKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT public key: %v", err)
+		}
+		verifier.publicKey = publicKey
+		verifier.secret = nil
+	}
+	return verifier, nil
+}
+
+func parseRSAPublicKey(encoded []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(encoded)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return publicKey, nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA public key")
+	}
+	return publicKey, nil
+}
+
+// Verify checks the signature and registered claims of the token, and returns
+// the permission it grants
+func (v *JWTVerifier) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", invalidToken("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", invalidToken("malformed header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", invalidToken("malformed signature")
+	}
+	if err := v.verifySignature(header.Alg, parts[0]+"."+parts[1], signature); err != nil {
+		return "", err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", invalidToken("malformed claims")
+	}
+	if err := v.verifyClaims(claims); err != nil {
+		return "", err
+	}
+
+	permission, ok := claims[v.permissionClaim]
+	if !ok {
+		return types.ReadPermission, nil
+	}
+	if asString, ok := permission.(string); ok && types.IsValidPermission(asString) {
+		return asString, nil
+	}
+	return "", invalidToken(fmt.Sprintf("invalid permission %v", permission))
+}
+
+func (v *JWTVerifier) verifySignature(alg string, signed string, signature []byte) error {
+	switch {
+	case v.publicKey != nil && alg == "RS256":
+		digest := sha256.Sum256([]byte(signed))
+		if rsa.VerifyPKCS1v15(v.publicKey, crypto.SHA256, digest[:], signature) != nil {
+			return invalidToken("invalid signature")
+		}
+		return nil
+	case v.publicKey == nil && alg == "HS256":
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return invalidToken("invalid signature")
+		}
+		return nil
+	}
+	return invalidToken(fmt.Sprintf("unexpected signing algorithm %s", alg))
+}
+
+func (v *JWTVerifier) verifyClaims(claims map[string]interface{}) error {
+	now := float64(v.now().Unix())
+	if exp, ok := claims["exp"]; ok {
+		if expiry, ok := exp.(float64); !ok || now >= expiry {
+			return invalidToken("token expired")
+		}
+	}
+	if nbf, ok := claims["nbf"]; ok {
+		if notBefore, ok := nbf.(float64); !ok || now < notBefore {
+			return invalidToken("token not valid yet")
+		}
+	}
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return invalidToken("unexpected issuer")
+	}
+	if v.audience != "" && !hasAudience(claims["aud"], v.audience) {
+		return invalidToken("unexpected audience")
+	}
+	return nil
+}
+
+// hasAudience checks the audience claim, which is either a single audience or
+// a list of them
+func hasAudience(claim interface{}, audience string) bool {
+	switch aud := claim.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, each := range aud {
+			if each == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, out interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, out)
+}
+
+func invalidToken(reason string) error {
+	return errors.New("invalid token: " + reason)
+}
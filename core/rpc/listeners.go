@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"quorumengineering/quorum-report/types"
+)
+
+var (
+	ErrMethodNotExposed = errors.New("method not available on this address")
+	ErrIPNotAllowed     = errors.New("IP address not allowed")
+)
+
+type exposureContextKey struct{}
+
+// listener is an address the RPC server is served on. It only exposes the
+// methods of its exposure, and only to clients in its allow-list.
+type listener struct {
+	addr       string
+	exposure   string
+	allowedIPs []*net.IPNet
+}
+
+// newListeners returns the listener of rpcAddr, which exposes every method,
+// followed by the other configured listeners
+func newListeners(addr string, allowedIPs []string, configs []*types.ListenerConfig) ([]*listener, error) {
+	main, err := newListener(&types.ListenerConfig{Addr: addr, Exposure: types.FullPermission, AllowedIPs: allowedIPs})
+	if err != nil {
+		return nil, err
+	}
+	listeners := []*listener{main}
+	for _, config := range configs {
+		l, err := newListener(config)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func newListener(config *types.ListenerConfig) (*listener, error) {
+	l := &listener{addr: config.Addr, exposure: config.Exposure}
+	for _, entry := range config.AllowedIPs {
+		ipRange, err := types.ParseIPRange(entry)
+		if err != nil {
+			return nil, err
+		}
+		l.allowedIPs = append(l.allowedIPs, ipRange)
+	}
+	return l, nil
+}
+
+// handler rejects clients outside the allow-list, and passes the exposure of
+// the listener to next with the request
+func (l *listener) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !l.allows(req.RemoteAddr) {
+			http.Error(w, ErrIPNotAllowed.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), exposureContextKey{}, l.exposure)))
+	})
+}
+
+// allows checks the IP address of a client against the allow-list, allowing
+// all clients if it is empty
+func (l *listener) allows(remoteAddr string) bool {
+	if len(l.allowedIPs) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipRange := range l.allowedIPs {
+		if ipRange.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestExposure returns the exposure of the listener the request came in
+// on, exposing every method if it didn't come through one
+func requestExposure(req *http.Request) string {
+	if exposure, ok := req.Context().Value(exposureContextKey{}).(string); ok {
+		return exposure
+	}
+	return types.FullPermission
+}
+
+// exposes checks if the exposure, or permission, covers the method
+func exposes(exposure string, method string) bool {
+	switch exposure {
+	case types.FullPermission:
+		return true
+	case types.WriteExposure:
+		return !adminMethods[method]
+	case types.ReadPermission:
+		return readMethods[method] || aggregationMethods[method]
+	case types.AggregatePermission:
+		return aggregationMethods[method]
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+func TestListener_Allows(t *testing.T) {
+	l, err := newListener(&types.ListenerConfig{AllowedIPs: []string{"10.0.0.0/8", "192.168.1.5", "::1"}})
+	assert.Nil(t, err)
+	assert.True(t, l.allows("10.1.2.3:51000"))
+	assert.True(t, l.allows("192.168.1.5:51000"))
+	assert.False(t, l.allows("192.168.1.6:51000"))
+	assert.True(t, l.allows("[::1]:51000"))
+	assert.False(t, l.allows("invalid"))
+
+	// no allow-list allows all
+	l, err = newListener(&types.ListenerConfig{})
+	assert.Nil(t, err)
+	assert.True(t, l.allows("192.168.1.6:51000"))
+
+	_, err = newListener(&types.ListenerConfig{AllowedIPs: []string{"10.0.0.0/33"}})
+	assert.NotNil(t, err)
+}
+
+func TestListener_Handler(t *testing.T) {
+	l, err := newListener(&types.ListenerConfig{Exposure: types.ReadPermission, AllowedIPs: []string{"10.0.0.0/8"}})
+	assert.Nil(t, err)
+	authoriser := &Authoriser{}
+	var authorised error
+	handler := l.handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		authorised = authoriser.Authorise(req, "reporting.AddAddress")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.RemoteAddr = "172.16.0.1:51000"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// a read-only listener doesn't expose write methods, even if no
+	// credentials are needed
+	req.RemoteAddr = "10.0.0.1:51000"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ErrMethodNotExposed, authorised)
+}
+
+func TestExposes(t *testing.T) {
+	assert.True(t, exposes(types.FullPermission, "reporting.GetProcessingJournal"))
+
+	assert.True(t, exposes(types.WriteExposure, "reporting.AddAddress"))
+	assert.False(t, exposes(types.WriteExposure, "reporting.PauseIngestion"))
+
+	assert.True(t, exposes(types.ReadPermission, "reporting.GetBlock"))
+	assert.False(t, exposes(types.ReadPermission, "reporting.AddAddress"))
+
+	assert.True(t, exposes(types.AggregatePermission, "reporting.GetAddressTotals"))
+	assert.False(t, exposes(types.AggregatePermission, "reporting.GetBlock"))
+
+	assert.False(t, exposes("unknown", "reporting.GetBlock"))
+}
@@ -55,10 +55,18 @@ func TestMain(m *testing.M) {
 func SetupRpcServer(db database.Database) *RPCService {
 	errorChan := make(chan error)
 	serverConfig := struct {
-		RPCAddr     string   `toml:"rpcAddr"`
-		RPCCorsList []string `toml:"rpcCorsList,omitempty"`
-		RPCVHosts   []string `toml:"rpcvHosts,omitempty"`
-		UIPort      int      `toml:"uiPort,omitempty"`
+		RPCAddr        string                       `toml:"rpcAddr"`
+		RPCCorsList    []string                     `toml:"rpcCorsList,omitempty"`
+		RPCVHosts      []string                     `toml:"rpcvHosts,omitempty"`
+		AllowedIPs     []string                     `toml:"allowedIPs,omitempty"`
+		Listeners      []*types.ListenerConfig      `toml:"listeners,omitempty"`
+		UIPort         int                          `toml:"uiPort,omitempty"`
+		APIKeys        []*types.APIKeyConfig        `toml:"apiKeys,omitempty"`
+		JWT            *types.JWTConfig             `toml:"jwt,omitempty"`
+		ContractGroups []*types.ContractGroupConfig `toml:"contractGroups,omitempty"`
+		RateLimit      *types.RateLimitConfig       `toml:"rateLimit,omitempty"`
+		Health         types.HealthConfig           `toml:"health,omitempty"`
+		QueryGuard     *types.QueryGuardConfig      `toml:"queryGuard,omitempty"`
 	}{
 		RPCAddr:     "localhost:30000",
 		RPCCorsList: []string{"*"},
@@ -67,7 +75,7 @@ func SetupRpcServer(db database.Database) *RPCService {
 	}
 	config := types.ReportingConfig{Server: serverConfig}
 
-	return NewRPCService(db, config, errorChan)
+	return NewRPCService(db, config, Dependencies{}, errorChan)
 }
 
 //TODO: error case
@@ -283,7 +291,7 @@ func TestNewRPCAPIs_AddAddress(t *testing.T) {
 		Version: "2.0",
 		ID:      "67",
 		Method:  "reporting.DeleteAddress",
-		Params:  json.RawMessage(fmt.Sprintf(`["0x1349f3e1b8d71effb47b840594ff27da7e603d17"]`)),
+		Params:  json.RawMessage(`[{"address":"0x1349f3e1b8d71effb47b840594ff27da7e603d17","purge":true}]`),
 	}
 	rpcResponseDelete, err := doRequest(msgDelete)
 	assert.Nil(t, err)
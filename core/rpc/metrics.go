@@ -0,0 +1,128 @@
+package rpc
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const MetricsPath = "/metrics"
+
+// SubscriptionReporter provides the stats of the websocket subscribers
+type SubscriptionReporter interface {
+	Stats() *types.SubscriptionStats
+}
+
+// RetentionReporter provides the totals of what the retention policies have
+// deleted
+type RetentionReporter interface {
+	Stats() *types.RetentionStats
+}
+
+// IsMetricsRequest checks if the request is for the metrics endpoint, which is
+// served without authentication, like the health endpoints, so it can be
+// scraped
+func IsMetricsRequest(req *http.Request) bool {
+	return req.Method == http.MethodGet && req.URL.Path == MetricsPath
+}
+
+// ServeMetrics writes the subscription stats, and the retention stats if
+// retention policies are applied, in the Prometheus text format. Subscribers
+// are only identified by their ID, not their address.
+func ServeMetrics(reporter SubscriptionReporter, retention RetentionReporter, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	var retentionStats *types.RetentionStats
+	if retention != nil {
+		retentionStats = retention.Stats()
+	}
+	if err := writeMetrics(w, reporter.Stats(), retentionStats); err != nil {
+		log.Warn("Writing metrics failed", "err", err)
+	}
+}
+
+func writeMetrics(w io.Writer, stats *types.SubscriptionStats, retention *types.RetentionStats) error {
+	kinds := []string{NewBlocksSubscription, TransactionsSubscription, EventsSubscription}
+	sort.Strings(kinds)
+
+	metrics := []struct {
+		name, kind, help string
+		write            func(name string) string
+	}{
+		{"reporting_ws_connections", "gauge", "Connected websocket subscribers.", func(name string) string {
+			return fmt.Sprintf("%s %d\n", name, stats.Connections)
+		}},
+		{"reporting_ws_subscriptions", "gauge", "Active subscriptions by type.", func(name string) string {
+			out := ""
+			for _, kind := range kinds {
+				out += fmt.Sprintf("%s{type=%q} %d\n", name, kind, stats.Subscriptions[kind])
+			}
+			return out
+		}},
+		{"reporting_ws_notifications_sent_total", "counter", "Notifications written to subscribers.", func(name string) string {
+			return fmt.Sprintf("%s %d\n", name, stats.Sent)
+		}},
+		{"reporting_ws_notifications_dropped_total", "counter", "Notifications dropped because a subscriber's queue was full.", func(name string) string {
+			return fmt.Sprintf("%s %d\n", name, stats.Dropped)
+		}},
+		{"reporting_ws_subscriber_queued", "gauge", "Notifications waiting to be written to each subscriber.", func(name string) string {
+			out := ""
+			for _, subscriber := range stats.Subscribers {
+				out += fmt.Sprintf("%s{subscriber=%q} %d\n", name, subscriber.ID, subscriber.Queued)
+			}
+			return out
+		}},
+		{"reporting_ws_subscriber_lag_blocks", "gauge", "Blocks each subscriber's oldest queued notification is behind.", func(name string) string {
+			out := ""
+			for _, subscriber := range stats.Subscribers {
+				out += fmt.Sprintf("%s{subscriber=%q} %d\n", name, subscriber.ID, subscriber.LagBlocks)
+			}
+			return out
+		}},
+	}
+	if retention != nil {
+		indices := make([]string, 0, len(retention.Indices))
+		for index := range retention.Indices {
+			indices = append(indices, index)
+		}
+		sort.Strings(indices)
+		byIndex := func(value func(*types.IndexRetention) uint64) func(name string) string {
+			return func(name string) string {
+				out := ""
+				for _, index := range indices {
+					out += fmt.Sprintf("%s{index=%q} %d\n", name, index, value(retention.Indices[index]))
+				}
+				return out
+			}
+		}
+		metrics = append(metrics, []struct {
+			name, kind, help string
+			write            func(name string) string
+		}{
+			{"reporting_retention_runs_total", "counter", "Times the retention policies have been applied.", func(name string) string {
+				return fmt.Sprintf("%s %d\n", name, retention.Runs)
+			}},
+			{"reporting_retention_failures_total", "counter", "Retention policies that failed to be applied.", func(name string) string {
+				return fmt.Sprintf("%s %d\n", name, retention.Failures)
+			}},
+			{"reporting_retention_deleted_documents_total", "counter", "Documents deleted by the retention policy of each index.", byIndex(func(r *types.IndexRetention) uint64 {
+				return r.Deleted
+			})},
+			{"reporting_retention_reclaimed_bytes_total", "counter", "Estimated storage reclaimed by the retention policy of each index, once compacted.", byIndex(func(r *types.IndexRetention) uint64 {
+				return r.ReclaimedBytes
+			})},
+			{"reporting_retention_before_block", "gauge", "The block each index's documents were last deleted before.", byIndex(func(r *types.IndexRetention) uint64 {
+				return r.BeforeBlock
+			})},
+		}...)
+	}
+	for _, metric := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s", metric.name, metric.help, metric.name, metric.kind, metric.write(metric.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+type fakeSubscriptionReporter struct {
+	stats *types.SubscriptionStats
+}
+
+func (f *fakeSubscriptionReporter) Stats() *types.SubscriptionStats {
+	return f.stats
+}
+
+func TestIsMetricsRequest(t *testing.T) {
+	assert.True(t, IsMetricsRequest(httptest.NewRequest(http.MethodGet, "/metrics", nil)))
+	assert.False(t, IsMetricsRequest(httptest.NewRequest(http.MethodPost, "/metrics", nil)))
+	assert.False(t, IsMetricsRequest(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
+
+func TestServeMetrics(t *testing.T) {
+	reporter := &fakeSubscriptionReporter{stats: &types.SubscriptionStats{
+		Connections:   1,
+		Subscriptions: map[string]int{EventsSubscription: 2},
+		Sent:          10,
+		Dropped:       3,
+		Subscribers:   []*types.SubscriberStats{{ID: "ab12", RemoteAddress: "10.0.0.1:5000", Queued: 7, LagBlocks: 4}},
+	}}
+	recorder := httptest.NewRecorder()
+
+	ServeMetrics(reporter, nil, recorder)
+
+	assert.Equal(t, "text/plain; version=0.0.4", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP reporting_ws_connections Connected websocket subscribers.
+# TYPE reporting_ws_connections gauge
+reporting_ws_connections 1
+# HELP reporting_ws_subscriptions Active subscriptions by type.
+# TYPE reporting_ws_subscriptions gauge
+reporting_ws_subscriptions{type="events"} 2
+reporting_ws_subscriptions{type="newBlocks"} 0
+reporting_ws_subscriptions{type="transactions"} 0
+# HELP reporting_ws_notifications_sent_total Notifications written to subscribers.
+# TYPE reporting_ws_notifications_sent_total counter
+reporting_ws_notifications_sent_total 10
+# HELP reporting_ws_notifications_dropped_total Notifications dropped because a subscriber's queue was full.
+# TYPE reporting_ws_notifications_dropped_total counter
+reporting_ws_notifications_dropped_total 3
+# HELP reporting_ws_subscriber_queued Notifications waiting to be written to each subscriber.
+# TYPE reporting_ws_subscriber_queued gauge
+reporting_ws_subscriber_queued{subscriber="ab12"} 7
+# HELP reporting_ws_subscriber_lag_blocks Blocks each subscriber's oldest queued notification is behind.
+# TYPE reporting_ws_subscriber_lag_blocks gauge
+reporting_ws_subscriber_lag_blocks{subscriber="ab12"} 4
+`, recorder.Body.String())
+}
+
+type fakeRetentionReporter struct {
+	stats *types.RetentionStats
+}
+
+func (f *fakeRetentionReporter) Stats() *types.RetentionStats {
+	return f.stats
+}
+
+func TestServeMetrics_Retention(t *testing.T) {
+	reporter := &fakeSubscriptionReporter{stats: &types.SubscriptionStats{Subscriptions: map[string]int{}}}
+	retention := &fakeRetentionReporter{stats: &types.RetentionStats{
+		Runs:     3,
+		Failures: 1,
+		Indices: map[string]*types.IndexRetention{
+			"storage": {MaxAgeDays: 90, BeforeBlock: 500, Deleted: 20, ReclaimedBytes: 4096},
+			"event":   {MaxAgeDays: 30, BeforeBlock: 900, Deleted: 5, ReclaimedBytes: 1024},
+		},
+	}}
+	recorder := httptest.NewRecorder()
+
+	ServeMetrics(reporter, retention, recorder)
+
+	assert.Contains(t, recorder.Body.String(), `# HELP reporting_retention_runs_total Times the retention policies have been applied.
+# TYPE reporting_retention_runs_total counter
+reporting_retention_runs_total 3
+# HELP reporting_retention_failures_total Retention policies that failed to be applied.
+# TYPE reporting_retention_failures_total counter
+reporting_retention_failures_total 1
+# HELP reporting_retention_deleted_documents_total Documents deleted by the retention policy of each index.
+# TYPE reporting_retention_deleted_documents_total counter
+reporting_retention_deleted_documents_total{index="event"} 5
+reporting_retention_deleted_documents_total{index="storage"} 20
+# HELP reporting_retention_reclaimed_bytes_total Estimated storage reclaimed by the retention policy of each index, once compacted.
+# TYPE reporting_retention_reclaimed_bytes_total counter
+reporting_retention_reclaimed_bytes_total{index="event"} 1024
+reporting_retention_reclaimed_bytes_total{index="storage"} 4096
+# HELP reporting_retention_before_block The block each index's documents were last deleted before.
+# TYPE reporting_retention_before_block gauge
+reporting_retention_before_block{index="event"} 900
+reporting_retention_before_block{index="storage"} 500
+`)
+}
@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+var addressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+
+// bufferedResponseWriter holds back the response, so fields can be added to
+// it before it is written
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+// annotated passes the responses of the handler through annotate before they
+// are written
+func annotated(annotate func(body []byte) []byte, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		buffered := &bufferedResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(buffered, req)
+
+		body := annotate(buffered.body.Bytes())
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(buffered.status)
+		if _, err := w.Write(body); err != nil {
+			log.Debug("Writing response failed", "err", err)
+		}
+	})
+}
+
+// resultAddresses decodes a JSON-RPC response, returning it with the
+// addresses in its result, as they are written there. ok is false if it isn't
+// a JSON-RPC response, such as the error for a request that isn't a POST.
+func resultAddresses(body []byte) (response map[string]json.RawMessage, addresses []string, ok bool) {
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, nil, false
+	}
+	result, ok := response["result"]
+	if !ok {
+		return nil, nil, false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(result))
+	// numbers aren't needed, so don't lose precision parsing them
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, nil, false
+	}
+
+	found := make(map[string]bool)
+	var walk func(interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case string:
+			if found[v] || !addressPattern.MatchString(v) {
+				return
+			}
+			found[v] = true
+			addresses = append(addresses, v)
+		case []interface{}:
+			for _, element := range v {
+				walk(element)
+			}
+		case map[string]interface{}:
+			for _, element := range v {
+				walk(element)
+			}
+		}
+	}
+	walk(value)
+	return response, addresses, true
+}
+
+// withField returns the response with the field added, or the body as it was
+// if the field can't be encoded
+func withField(response map[string]json.RawMessage, name string, value interface{}, body []byte) []byte {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+	response[name] = encoded
+	if annotated, err := json.Marshal(response); err == nil {
+		return annotated
+	}
+	return body
+}
+
+// withNames adds a "names" field to JSON-RPC responses, with the registered
+// names of each address in the result, so clients don't need to look them
+// up. Responses without registered addresses are unchanged.
+func withNames(names NameDirectory, next http.Handler) http.Handler {
+	return annotated(func(body []byte) []byte {
+		return addNames(names, body)
+	}, next)
+}
+
+// addNames returns the response with the names of the addresses in its
+// result, or the response as it was if there are none or it isn't a JSON-RPC
+// response
+func addNames(names NameDirectory, body []byte) []byte {
+	response, addresses, ok := resultAddresses(body)
+	if !ok {
+		return body
+	}
+	named := make(map[string][]string)
+	for _, address := range addresses {
+		if addressNames := names.Names(types.NewAddress(address)); len(addressNames) > 0 {
+			named[address] = addressNames
+		}
+	}
+	if len(named) == 0 {
+		return body
+	}
+	return withField(response, "names", named, body)
+}
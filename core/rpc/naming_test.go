@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+type fakeNameDirectory map[string]types.Address
+
+func (f fakeNameDirectory) Resolve(name string) (types.Address, bool) {
+	address, ok := f[name]
+	return address, ok
+}
+
+func (f fakeNameDirectory) Names(address types.Address) []string {
+	names := []string{}
+	for name, named := range f {
+		if named == address {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f fakeNameDirectory) All() []*types.RegisteredName {
+	var all []*types.RegisteredName
+	for name, address := range f {
+		all = append(all, &types.RegisteredName{Name: name, Address: address})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+func TestNameAPIs(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+
+	name := "token.quorum"
+	var address types.Address
+	assert.Equal(t, ErrNamingNotEnabled, apis.ResolveName(dummyReq, &name, &address))
+
+	apis.names = fakeNameDirectory{"token.quorum": addr, "erc20.quorum": addr}
+	assert.Nil(t, apis.ResolveName(dummyReq, &name, &address))
+	assert.Equal(t, addr, address)
+	name = "missing.quorum"
+	assert.Equal(t, ErrNameNotFound, apis.ResolveName(dummyReq, &name, &address))
+
+	var names []string
+	assert.Nil(t, apis.GetNames(dummyReq, &addr, &names))
+	assert.Equal(t, []string{"erc20.quorum", "token.quorum"}, names)
+
+	var all []*types.RegisteredName
+	assert.Nil(t, apis.GetRegisteredNames(dummyReq, &NullArgs{}, &all))
+	assert.Equal(t, []*types.RegisteredName{{Name: "erc20.quorum", Address: addr}, {Name: "token.quorum", Address: addr}}, all)
+}
+
+func TestWithNames(t *testing.T) {
+	names := fakeNameDirectory{"token.quorum": addr}
+	tests := []struct {
+		name     string
+		response string
+		expected string
+	}{
+		{
+			"named addresses",
+			`{"result":{"to":"` + addr.String() + `","value":123456789012345678901234567890,"events":[{"address":"` + addr.String() + `"},{"address":"0x0000000000000000000000000000000000000002"}]},"error":null,"id":1}`,
+			`{"error":null,"id":1,"names":{"` + addr.String() + `":["token.quorum"]},"result":{"to":"` + addr.String() + `","value":123456789012345678901234567890,"events":[{"address":"` + addr.String() + `"},{"address":"0x0000000000000000000000000000000000000002"}]}}`,
+		},
+		{
+			"no named addresses",
+			`{"result":["0x0000000000000000000000000000000000000002"],"error":null,"id":1}`,
+			`{"result":["0x0000000000000000000000000000000000000002"],"error":null,"id":1}`,
+		},
+		{
+			"error",
+			`{"result":null,"error":"address not provided","id":1}`,
+			`{"result":null,"error":"address not provided","id":1}`,
+		},
+		{
+			"not JSON",
+			`rpc: POST method required`,
+			`rpc: POST method required`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := withNames(names, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = w.Write([]byte(tc.response))
+			}))
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}")))
+
+			assert.Equal(t, http.StatusAccepted, recorder.Code)
+			assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+			assert.Equal(t, tc.expected, recorder.Body.String())
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	NDJSONContentType = "application/x-ndjson"
+
+	// ndjsonFlushInterval is how many lines are written between flushes
+	ndjsonFlushInterval = 500
+)
+
+var ErrNDJSONMethodNotSupported = errors.New("method is not available as NDJSON")
+
+// streamEncoding is a format the exporter can stream results in, one item
+// per result
+type streamEncoding struct {
+	contentType string
+	extension   string
+	newEncoder  func(io.Writer) func(interface{}) error
+}
+
+var (
+	ndjsonEncoding = &streamEncoding{
+		contentType: NDJSONContentType,
+		extension:   "ndjson",
+		newEncoder: func(w io.Writer) func(interface{}) error {
+			return json.NewEncoder(w).Encode
+		},
+	}
+	cborEncoding = &streamEncoding{
+		contentType: CBORSeqContentType,
+		extension:   "cbor",
+		newEncoder: func(w io.Writer) func(interface{}) error {
+			return newCBOREncoder(w).Encode
+		},
+	}
+)
+
+// IsNDJSONRequest reports whether the client asked for newline delimited
+// JSON, either with an Accept header or a format query parameter.
+func IsNDJSONRequest(req *http.Request) bool {
+	return req.URL.Query().Get("format") == "ndjson" || strings.Contains(req.Header.Get("Accept"), NDJSONContentType)
+}
+
+// NDJSONExporter streams all the events or transactions of an address as
+// newline delimited JSON, one decoded event or transaction per line, oldest
+// first. Clients asking for a CBOR sequence get the same results encoded as
+// CBOR instead, which is smaller and cheaper to encode and decode for large
+// exports.
+//
+// Requests are the same as for the CSV export. The results are read from the
+// database in a single pass rather than page by page, so there is no limit to
+// how many can be exported.
+type NDJSONExporter struct {
+	apis       *RPCAPIs
+	authoriser *Authoriser
+	limiter    *RateLimiter
+}
+
+func NewNDJSONExporter(apis *RPCAPIs, authoriser *Authoriser, limiter *RateLimiter) *NDJSONExporter {
+	return &NDJSONExporter{apis: apis, authoriser: authoriser, limiter: limiter}
+}
+
+func (e *NDJSONExporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	method, args, err := parseExportRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := e.authoriser.Authorise(req, method); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := e.limiter.Allow(e.authoriser.Client(req), method); err != nil {
+		writeRateLimited(w, err, http.StatusForbidden)
+		return
+	}
+
+	var export func(write func(interface{}) error) error
+	var filename string
+	switch method {
+	case eventsCSVMethod:
+		export, err = e.apis.eventsNDJSONExport(args)
+		filename = "events"
+	case transactionsCSVMethod:
+		export, err = e.apis.transactionsNDJSONExport(args)
+		filename = "transactions"
+	default:
+		err = ErrNDJSONMethodNotSupported
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	encoding := ndjsonEncoding
+	if IsCBORRequest(req) {
+		encoding = cborEncoding
+	}
+	w.Header().Set("Content-Type", encoding.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.%s", filename, args.Address.Hex(), encoding.extension)))
+	encode := encoding.newEncoder(w)
+	flush := func() {
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+	written := 0
+	err = export(func(line interface{}) error {
+		if err := encode(line); err != nil {
+			return err
+		}
+		written++
+		if written%ndjsonFlushInterval == 0 {
+			flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if written == 0 {
+			// nothing has been sent yet, so the error can still be returned
+			w.Header().Del("Content-Disposition")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// the status has already been sent, so abort the response to make
+		// sure the client doesn't take a partial export as complete
+		log.Error("Streamed export failed", "format", encoding.extension, "method", method, "address", args.Address.Hex(), "err", err)
+		panic(http.ErrAbortHandler)
+	}
+	flush()
+}
+
+func (r *RPCAPIs) eventsNDJSONExport(args *AddressWithOptions) (func(func(interface{}) error) error, error) {
+	if err := r.prepareExportOptions(args); err != nil {
+		return nil, err
+	}
+	address := *args.Address
+	contractABI, err := r.db.GetContractABI(address)
+	if err != nil {
+		return nil, err
+	}
+	timestamps := newBlockTimestamps(r.db)
+	return func(write func(interface{}) error) error {
+		return r.db.ExportEventsFromAddress(address, args.Options, func(e *types.Event) error {
+			parsed := &types.ParsedEvent{RawEvent: e}
+			parsed.SetTimestamp(timestamps.lookup(e.BlockNumber, e.Timestamp))
+			if contractABI != "" {
+				if err := parsed.ParseEvent(contractABI); err != nil {
+					return err
+				}
+			}
+			return write(parsed)
+		})
+	}, nil
+}
+
+func (r *RPCAPIs) transactionsNDJSONExport(args *AddressWithOptions) (func(func(interface{}) error) error, error) {
+	if err := r.prepareExportOptions(args); err != nil {
+		return nil, err
+	}
+	address := *args.Address
+	timestamps := newBlockTimestamps(r.db)
+	return func(write func(interface{}) error) error {
+		return r.db.ExportTransactionsToAddress(address, args.Options, func(tx *types.Transaction) error {
+			parsed, err := r.parseTransaction(tx, timestamps)
+			if err != nil {
+				return err
+			}
+			return write(parsed)
+		})
+	}, nil
+}
@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestNDJSONExporter(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, apis.AddABI(dummyReq, &AddressWithData{&addr, validABI}, nil))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{addr}, []*types.Block{block}))
+	exporter := NewNDJSONExporter(apis, &Authoriser{}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/?format=ndjson&method=reporting.GetAllEventsFromAddress&address="+addr.Hex(), nil)
+	assert.True(t, IsNDJSONRequest(req))
+	rec := httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, NDJSONContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="events-`+addr.Hex()+`.ndjson"`, rec.Header().Get("Content-Disposition"))
+	lines := readNDJSON(t, rec.Body.String())
+	assert.Len(t, lines, 1)
+	assert.Equal(t, "event valueSet(uint256 _value)", lines[0]["eventSig"])
+	assert.Equal(t, map[string]interface{}{"_value": float64(1000)}, lines[0]["parsedData"])
+
+	body := `{"jsonrpc":"2.0","method":"reporting.GetAllTransactionsToAddress","params":[{"address":"` + addr.Hex() + `"}],"id":1}`
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Accept", NDJSONContentType)
+	assert.True(t, IsNDJSONRequest(req))
+	rec = httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	lines = readNDJSON(t, rec.Body.String())
+	assert.Len(t, lines, 2)
+	sigs := []interface{}{lines[0]["txSig"], lines[1]["txSig"]}
+	assert.Contains(t, sigs, "set(uint256 _x)")
+
+	req = httptest.NewRequest(http.MethodGet, "/?format=ndjson&method=reporting.GetBlock&address="+addr.Hex(), nil)
+	rec = httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "method is not available as NDJSON\n", rec.Body.String())
+
+	// errors before anything is written are still returned to the client
+	unknown := types.NewAddress("0x0000000000000000000000000000000000000099")
+	req = httptest.NewRequest(http.MethodGet, "/?format=ndjson&method=reporting.GetAllEventsFromAddress&address="+unknown.Hex(), nil)
+	rec = httptest.NewRecorder()
+	exporter.ServeHTTP(rec, req)
+	assert.NotEqual(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Disposition"))
+
+	assert.False(t, IsNDJSONRequest(httptest.NewRequest(http.MethodGet, "/?format=csv", nil)))
+}
+
+func readNDJSON(t *testing.T, body string) []map[string]interface{} {
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	return lines
+}
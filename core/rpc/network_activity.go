@@ -0,0 +1,27 @@
+package rpc
+
+import (
+	"errors"
+	"net/http"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// GetNetworkActivity totals the transactions, active contracts and accounts,
+// gas used and share of private transactions of the whole network, for the
+// blocks with a timestamp in the inclusive range
+func (r *RPCAPIs) GetNetworkActivity(req *http.Request, args *TimeRange, reply *types.NetworkActivity) error {
+	if args.To < args.From {
+		return errors.New("end timestamp is before start timestamp")
+	}
+	if err := r.guardNetworkActivity(args); err != nil {
+		return err
+	}
+	activity, err := r.db.GetNetworkActivity(args.From, args.To)
+	if err != nil {
+		return err
+	}
+	activity.SetRatios()
+	*reply = *activity
+	return nil
+}
@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestGetNetworkActivity(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+
+	alice := types.NewAddress("0x0000000000000000000000000000000000000a11")
+	bob := types.NewAddress("0x0000000000000000000000000000000000000b0b")
+	token := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	transfer := types.NewHexData("0xa9059cbb")
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{
+		{Hash: types.NewHash("0x01"), Timestamp: 100, From: alice, CreatedContract: token, Data: types.NewHexData("0x6080"), GasUsed: 500000},
+		{Hash: types.NewHash("0x02"), Timestamp: 200, From: alice, To: token, Data: transfer, GasUsed: 50000},
+		{Hash: types.NewHash("0x03"), Timestamp: 300, From: bob, To: token, IsPrivate: true, PrivateData: transfer, GasUsed: 30000},
+		// a plain transfer shows no contract to be active
+		{Hash: types.NewHash("0x04"), Timestamp: 400, From: bob, To: alice, GasUsed: 21000},
+		{Hash: types.NewHash("0x05"), Timestamp: 500, From: alice, To: token, Data: transfer, GasUsed: 50000},
+	}))
+
+	var activity types.NetworkActivity
+	assert.Nil(t, apis.GetNetworkActivity(dummyReq, &TimeRange{From: 100, To: 400}, &activity))
+	assert.Equal(t, types.NetworkActivity{
+		From:                100,
+		To:                  400,
+		Transactions:        4,
+		PrivateTransactions: 1,
+		PublicTransactions:  3,
+		PrivateRatio:        0.25,
+		ActiveContracts:     1,
+		ActiveAccounts:      2,
+		GasUsed:             601000,
+	}, activity)
+
+	assert.Nil(t, apis.GetNetworkActivity(dummyReq, &TimeRange{From: 600, To: 700}, &activity))
+	assert.Equal(t, types.NetworkActivity{From: 600, To: 700}, activity)
+
+	assert.EqualError(t, apis.GetNetworkActivity(dummyReq, &TimeRange{From: 2, To: 1}, &activity), "end timestamp is before start timestamp")
+}
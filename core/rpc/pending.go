@@ -0,0 +1,32 @@
+package rpc
+
+import (
+	"net/http"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// GetPendingActivity returns the transactions to registered contracts waiting
+// in the node's transaction pool, in the order they were seen, optionally
+// only those to one contract
+func (r *RPCAPIs) GetPendingActivity(req *http.Request, args *PendingActivityArgs, reply *[]*types.PendingTransaction) error {
+	if r.pending == nil {
+		return ErrPendingNotEnabled
+	}
+	var address types.Address
+	if args.Address != nil {
+		address = *args.Address
+	}
+	pending := r.pending.Pending(address)
+	if r.scope != nil {
+		inScope := make([]*types.PendingTransaction, 0, len(pending))
+		for _, tx := range pending {
+			if r.scope.Contains(tx.To) {
+				inScope = append(inScope, tx)
+			}
+		}
+		pending = inScope
+	}
+	*reply = pending
+	return nil
+}
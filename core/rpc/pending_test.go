@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/core/pending"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/database/scoped"
+	"quorumengineering/quorum-report/types"
+)
+
+var other = types.NewAddress("0x0000000000000000000000000000000000000020")
+
+type fakePendingMonitor []*types.PendingTransaction
+
+func (f fakePendingMonitor) Pending(address types.Address) []*types.PendingTransaction {
+	var pending []*types.PendingTransaction
+	for _, tx := range f {
+		if address.IsEmpty() || tx.To == address {
+			pending = append(pending, tx)
+		}
+	}
+	return pending
+}
+
+func (f fakePendingMonitor) AddListener(pending.Listener) {}
+
+func TestGetPendingActivity(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+
+	var pending []*types.PendingTransaction
+	assert.Equal(t, ErrPendingNotEnabled, apis.GetPendingActivity(dummyReq, &PendingActivityArgs{}, &pending))
+
+	monitor := fakePendingMonitor{
+		{Hash: types.NewHash("0x01"), To: addr, Sig: "transfer(address to,uint256 value)"},
+		{Hash: types.NewHash("0x02"), To: other},
+	}
+	apis.pending = monitor
+	assert.Nil(t, apis.GetPendingActivity(dummyReq, &PendingActivityArgs{}, &pending))
+	assert.Len(t, pending, 2)
+	assert.Nil(t, apis.GetPendingActivity(dummyReq, &PendingActivityArgs{Address: &other}, &pending))
+	assert.Equal(t, []*types.PendingTransaction{monitor[1]}, pending)
+
+	// keys restricted to contract groups only see their contracts
+	apis.scope = scoped.NewDatabase(db, []types.Address{addr})
+	assert.Nil(t, apis.GetPendingActivity(dummyReq, &PendingActivityArgs{}, &pending))
+	assert.Equal(t, []*types.PendingTransaction{monitor[0]}, pending)
+}
+
+func TestPendingTransactionsSubscription(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	service := &RPCService{
+		authoriser:    &Authoriser{},
+		upgrader:      newUpgrader(nil),
+		subscriptions: NewSubscriptionManager(db, apis),
+	}
+	server := httptest.NewServer(http.HandlerFunc(service.serveWebsocket))
+	defer server.Close()
+	defer service.subscriptions.CloseAll()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	allID := subscribe(t, conn, PendingTransactionsSubscription)
+	addrID := subscribe(t, conn, PendingTransactionsSubscription, addr)
+
+	service.subscriptions.NotifyPending(&types.PendingTransaction{Hash: types.NewHash("0x02"), To: other})
+	service.subscriptions.NotifyPending(&types.PendingTransaction{Hash: types.NewHash("0x01"), To: addr})
+
+	var tx types.PendingTransaction
+	assert.Equal(t, allID, readNotification(t, conn, &tx))
+	assert.Equal(t, other, tx.To)
+	// the second transaction goes to both subscriptions, in any order
+	ids := []string{readNotification(t, conn, &tx), readNotification(t, conn, &tx)}
+	assert.ElementsMatch(t, []string{allID, addrID}, ids)
+	assert.Equal(t, addr, tx.To)
+}
@@ -0,0 +1,152 @@
+package rpc
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// sweepInterval is how often buckets that have refilled are dropped, so that
+// clients that stopped sending requests are forgotten
+const sweepInterval = time.Minute
+
+// RateLimitedError is returned when a request goes over a rate limit. It is the
+// error data of JSON-RPC responses, so clients can tell when to retry.
+type RateLimitedError struct {
+	Message string `json:"message"`
+	// The limit that was exceeded: "global", "perClient" or the method name
+	Limit string `json:"limit"`
+	// Seconds until a request would be within the limit
+	RetryAfter float64 `json:"retryAfter"`
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("%s: %s limit exceeded, retry after %.3gs", e.Message, e.Limit, e.RetryAfter)
+}
+
+// writeRateLimited responds to a plain HTTP request that went over a rate
+// limit, or with the given status for any other error
+func writeRateLimited(w http.ResponseWriter, err error, status int) {
+	if limited, ok := err.(*RateLimitedError); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter))))
+		status = http.StatusTooManyRequests
+	}
+	http.Error(w, err.Error(), status)
+}
+
+type tokenBucket struct {
+	limit   *types.RateLimit
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens gained since the bucket was last updated, returning
+// whether the bucket is full
+func (b *tokenBucket) refill(now time.Time) bool {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate)
+	b.updated = now
+	return b.tokens >= float64(b.limit.Burst)
+}
+
+// RateLimiter checks requests against token buckets for all clients, for each
+// client and for each client calling a method. A request takes a token from
+// every bucket that applies to it, or from none if any are empty.
+type RateLimiter struct {
+	global    *types.RateLimit
+	perClient *types.RateLimit
+	methods   map[string]*types.RateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+// NewRateLimiter returns a limiter for the given limits, or nil if none are
+// given, which allows all requests.
+func NewRateLimiter(config *types.RateLimitConfig) *RateLimiter {
+	if config == nil {
+		return nil
+	}
+	return &RateLimiter{
+		global:    config.Global,
+		perClient: config.PerClient,
+		methods:   config.Methods,
+		buckets:   make(map[string]*tokenBucket),
+		now:       time.Now,
+	}
+}
+
+// Allow takes a token for a request from the client to the method, or returns
+// a RateLimitedError if that would go over a limit
+func (l *RateLimiter) Allow(client string, method string) error {
+	if l == nil {
+		return nil
+	}
+
+	type check struct {
+		name  string
+		key   string
+		limit *types.RateLimit
+	}
+	var checks []check
+	if l.global != nil {
+		checks = append(checks, check{"global", "global", l.global})
+	}
+	if l.perClient != nil {
+		checks = append(checks, check{"perClient", "client/" + client, l.perClient})
+	}
+	if limit, ok := l.methods[method]; ok && limit != nil {
+		checks = append(checks, check{method, "method/" + method + "/" + client, limit})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	var limited *RateLimitedError
+	buckets := make([]*tokenBucket, len(checks))
+	for i, c := range checks {
+		bucket, ok := l.buckets[c.key]
+		if !ok {
+			bucket = &tokenBucket{limit: c.limit, tokens: float64(c.limit.Burst), updated: now}
+			l.buckets[c.key] = bucket
+		}
+		bucket.refill(now)
+		buckets[i] = bucket
+
+		if bucket.tokens < 1 {
+			retryAfter := (1 - bucket.tokens) / c.limit.Rate
+			if limited == nil || retryAfter > limited.RetryAfter {
+				limited = &RateLimitedError{Message: "rate limited", Limit: c.name, RetryAfter: retryAfter}
+			}
+		}
+	}
+	if limited != nil {
+		return limited
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return nil
+}
+
+// sweep drops the buckets that have refilled, as they are the same as new ones
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if bucket.refill(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+func newTestRateLimiter(config *types.RateLimitConfig) (*RateLimiter, *time.Time) {
+	now := time.Date(2020, time.September, 10, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(config)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestRateLimiter_Disabled(t *testing.T) {
+	var limiter *RateLimiter
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, limiter.Allow("client", "reporting.GetStorageHistory"))
+	}
+}
+
+func TestRateLimiter_PerClient(t *testing.T) {
+	limiter, now := newTestRateLimiter(&types.RateLimitConfig{
+		PerClient: &types.RateLimit{Rate: 2, Burst: 2},
+	})
+
+	assert.Nil(t, limiter.Allow("a", "reporting.GetBlock"))
+	assert.Nil(t, limiter.Allow("a", "reporting.GetBlock"))
+	assert.Equal(t, &RateLimitedError{Message: "rate limited", Limit: "perClient", RetryAfter: 0.5}, limiter.Allow("a", "reporting.GetBlock"))
+	// other clients have their own bucket
+	assert.Nil(t, limiter.Allow("b", "reporting.GetBlock"))
+
+	*now = now.Add(500 * time.Millisecond)
+	assert.Nil(t, limiter.Allow("a", "reporting.GetBlock"))
+	assert.NotNil(t, limiter.Allow("a", "reporting.GetBlock"))
+}
+
+func TestRateLimiter_Method(t *testing.T) {
+	limiter, now := newTestRateLimiter(&types.RateLimitConfig{
+		Global:  &types.RateLimit{Rate: 10, Burst: 3},
+		Methods: map[string]*types.RateLimit{"reporting.GetStorageHistory": {Rate: 0.1, Burst: 1}},
+	})
+
+	assert.Nil(t, limiter.Allow("a", "reporting.GetStorageHistory"))
+	err := limiter.Allow("a", "reporting.GetStorageHistory")
+	assert.Equal(t, &RateLimitedError{Message: "rate limited", Limit: "reporting.GetStorageHistory", RetryAfter: 10}, err)
+	assert.EqualError(t, err, "rate limited: reporting.GetStorageHistory limit exceeded, retry after 10s")
+
+	// a limited request does not take from the global bucket
+	assert.Nil(t, limiter.Allow("b", "reporting.GetStorageHistory"))
+	assert.Nil(t, limiter.Allow("a", "reporting.GetBlock"))
+	limited, ok := limiter.Allow("c", "reporting.GetBlock").(*RateLimitedError)
+	assert.True(t, ok)
+	assert.Equal(t, "global", limited.Limit)
+
+	*now = now.Add(10 * time.Second)
+	assert.Nil(t, limiter.Allow("a", "reporting.GetStorageHistory"))
+}
+
+func TestRateLimiter_Sweep(t *testing.T) {
+	limiter, now := newTestRateLimiter(&types.RateLimitConfig{
+		PerClient: &types.RateLimit{Rate: 1, Burst: 5},
+	})
+
+	assert.Nil(t, limiter.Allow("a", "reporting.GetBlock"))
+	assert.Nil(t, limiter.Allow("b", "reporting.GetBlock"))
+	assert.Len(t, limiter.buckets, 2)
+
+	*now = now.Add(sweepInterval)
+	assert.Nil(t, limiter.Allow("c", "reporting.GetBlock"))
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestAuthoriser_Client(t *testing.T) {
+	req := withKey("key1")
+	req.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "10.0.0.1", (&Authoriser{}).Client(req))
+
+	authoriser, err := NewAuthoriser([]*types.APIKeyConfig{{Key: "key1", Permission: types.FullPermission}}, &types.JWTConfig{Secret: "secret"})
+	assert.Nil(t, err)
+	assert.Equal(t, "key:key1", authoriser.Client(req))
+	token := withToken("abc")
+	assert.Equal(t, authoriser.Client(token), authoriser.Client(withToken("abc")))
+	assert.NotEqual(t, authoriser.Client(token), authoriser.Client(withToken("abd")))
+}
+
+func TestWriteRateLimited(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writeRateLimited(recorder, &RateLimitedError{Message: "rate limited", Limit: "perClient", RetryAfter: 1.2}, http.StatusForbidden)
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+
+	recorder = httptest.NewRecorder()
+	writeRateLimited(recorder, ErrInvalidAPIKey, http.StatusForbidden)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
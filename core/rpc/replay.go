@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// DefaultReplayBatchSize and MaxReplayBatchSize bound how many events are
+	// returned by each call to ReplayEvents
+	DefaultReplayBatchSize = 100
+	MaxReplayBatchSize     = 1000
+)
+
+// ReplayEvents returns the decoded events of a contract or contract group
+// oldest first, in block and log index order, a batch at a time. Each batch
+// returns the sequence the next starts after, which can be kept to resume
+// the replay later, including once new blocks have been filtered.
+//
+// Only the blocks all the contracts have been filtered up to are replayed, so
+// no event can be indexed behind a sequence that has already been returned.
+func (r *RPCAPIs) ReplayEvents(req *http.Request, args *ReplayEventsArgs, reply *ReplayEventsResp) error {
+	contracts, err := r.replayContracts(args)
+	if err != nil {
+		return err
+	}
+	batchSize := args.BatchSize
+	if batchSize == 0 {
+		batchSize = DefaultReplayBatchSize
+	}
+	if batchSize < 0 || batchSize > MaxReplayBatchSize {
+		return fmt.Errorf("batch size must be between 1 and %d", MaxReplayBatchSize)
+	}
+	var after *types.Cursor
+	if args.FromSequence != "" {
+		if after, err = types.ParseCursor(args.FromSequence); err != nil {
+			return errors.New("invalid sequence")
+		}
+	}
+
+	var toBlock uint64
+	for i, contract := range contracts {
+		lastFiltered, err := r.db.GetLastFiltered(contract)
+		if err != nil {
+			return err
+		}
+		if i == 0 || lastFiltered < toBlock {
+			toBlock = lastFiltered
+		}
+	}
+
+	events, err := r.db.GetEventsInOrder(contracts, after, toBlock, batchSize)
+	if err != nil {
+		return err
+	}
+	abis := make(map[types.Address]string)
+	timestamps := newBlockTimestamps(r.db)
+	parsedEvents := make([]*types.ParsedEvent, len(events))
+	for i, e := range events {
+		contractABI, ok := abis[e.Address]
+		if !ok {
+			if contractABI, err = r.db.GetContractABI(e.Address); err != nil {
+				return err
+			}
+			abis[e.Address] = contractABI
+		}
+		parsedEvents[i] = &types.ParsedEvent{RawEvent: e}
+		parsedEvents[i].SetTimestamp(timestamps.lookup(e.BlockNumber, e.Timestamp))
+		if contractABI != "" {
+			if err := parsedEvents[i].ParseEvent(contractABI); err != nil {
+				return err
+			}
+		}
+	}
+
+	// without new events, the replay resumes from the same place
+	nextSequence := args.FromSequence
+	if len(events) > 0 {
+		last := events[len(events)-1]
+		nextSequence = types.NewCursor(last.BlockNumber, last.Index)
+	}
+	*reply = ReplayEventsResp{
+		Events:       parsedEvents,
+		NextSequence: nextSequence,
+		FilteredTo:   toBlock,
+		CaughtUp:     len(events) < batchSize,
+	}
+	return nil
+}
+
+// replayContracts returns the contract, or the contracts of the group, to
+// replay the events of
+func (r *RPCAPIs) replayContracts(args *ReplayEventsArgs) ([]types.Address, error) {
+	if args.Address != nil && args.Group != "" {
+		return nil, errors.New("give either an address or a contract group, not both")
+	}
+	if args.Address != nil {
+		return []types.Address{*args.Address}, nil
+	}
+	if args.Group == "" {
+		return nil, errors.New("no address or contract group given")
+	}
+	for _, group := range r.contractGroups {
+		if group.Name == args.Group {
+			if len(group.Addresses) == 0 {
+				return nil, fmt.Errorf("contract group %v has no contracts", args.Group)
+			}
+			return group.Addresses, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown contract group: %v", args.Group)
+}
@@ -0,0 +1,88 @@
+package rpc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestReplayEvents(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	other := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	apis.contractGroups = []*types.ContractGroupConfig{
+		{Name: "settlement", Addresses: []types.Address{addr, other}},
+		{Name: "empty"},
+	}
+	assert.Nil(t, db.AddAddresses([]types.Address{addr, other}))
+
+	// an event from each contract in each block, the later one first in the
+	// transaction list
+	for number := uint64(1); number <= 3; number++ {
+		tx := &types.Transaction{Hash: types.NewHash(fmt.Sprintf("0x%x", number)), BlockNumber: number}
+		for i, address := range []types.Address{other, addr} {
+			tx.Events = append(tx.Events, &types.Event{Address: address, BlockNumber: number, Index: uint64(i), TransactionHash: tx.Hash})
+		}
+		block := &types.Block{Number: number, Transactions: []types.Hash{tx.Hash}}
+		assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx}))
+		assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+		assert.Nil(t, db.IndexBlocks([]types.Address{addr}, []*types.Block{block}))
+		if number < 3 {
+			assert.Nil(t, db.IndexBlocks([]types.Address{other}, []*types.Block{block}))
+		}
+	}
+
+	// the group is only replayed to block 2, which both have been filtered to
+	var resp ReplayEventsResp
+	assert.Nil(t, apis.ReplayEvents(dummyReq, &ReplayEventsArgs{Group: "settlement", BatchSize: 3}, &resp))
+	assert.Len(t, resp.Events, 3)
+	var positions []string
+	for _, event := range resp.Events {
+		positions = append(positions, fmt.Sprintf("%d:%d", event.RawEvent.BlockNumber, event.RawEvent.Index))
+	}
+	assert.Equal(t, []string{"1:0", "1:1", "2:0"}, positions)
+	assert.Equal(t, types.NewCursor(2, 0), resp.NextSequence)
+	assert.EqualValues(t, 2, resp.FilteredTo)
+	assert.False(t, resp.CaughtUp)
+
+	sequence := resp.NextSequence
+	assert.Nil(t, apis.ReplayEvents(dummyReq, &ReplayEventsArgs{Group: "settlement", FromSequence: sequence, BatchSize: 3}, &resp))
+	assert.Len(t, resp.Events, 1)
+	assert.Equal(t, addr, resp.Events[0].RawEvent.Address)
+	assert.True(t, resp.CaughtUp)
+
+	// caught up, the replay resumes from the same place
+	sequence = resp.NextSequence
+	assert.Nil(t, apis.ReplayEvents(dummyReq, &ReplayEventsArgs{Group: "settlement", FromSequence: sequence}, &resp))
+	assert.Empty(t, resp.Events)
+	assert.Equal(t, sequence, resp.NextSequence)
+
+	// a single contract is replayed to the block it has been filtered to
+	assert.Nil(t, apis.ReplayEvents(dummyReq, &ReplayEventsArgs{Address: &addr, FromSequence: sequence}, &resp))
+	assert.Len(t, resp.Events, 1)
+	assert.Equal(t, types.NewCursor(3, 1), resp.NextSequence)
+}
+
+func TestReplayEvents_InvalidArgs(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	apis.contractGroups = []*types.ContractGroupConfig{{Name: "empty"}}
+	var resp ReplayEventsResp
+
+	err := apis.ReplayEvents(dummyReq, &ReplayEventsArgs{}, &resp)
+	assert.EqualError(t, err, "no address or contract group given")
+	err = apis.ReplayEvents(dummyReq, &ReplayEventsArgs{Address: &addr, Group: "empty"}, &resp)
+	assert.EqualError(t, err, "give either an address or a contract group, not both")
+	err = apis.ReplayEvents(dummyReq, &ReplayEventsArgs{Group: "unknown"}, &resp)
+	assert.EqualError(t, err, "unknown contract group: unknown")
+	err = apis.ReplayEvents(dummyReq, &ReplayEventsArgs{Group: "empty"}, &resp)
+	assert.EqualError(t, err, "contract group empty has no contracts")
+	err = apis.ReplayEvents(dummyReq, &ReplayEventsArgs{Address: &addr, BatchSize: MaxReplayBatchSize + 1}, &resp)
+	assert.EqualError(t, err, "batch size must be between 1 and 1000")
+	err = apis.ReplayEvents(dummyReq, &ReplayEventsArgs{Address: &addr, FromSequence: "not a sequence"}, &resp)
+	assert.EqualError(t, err, "invalid sequence")
+}
@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"net/http"
+	"strings"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// withScreening adds a "screening" field to JSON-RPC responses, with the
+// matches of each address in the result that is on a screening list, so
+// clients can flag them. Responses without listed addresses are unchanged.
+// Those whose addresses couldn't be screened have a "screeningError" field
+// instead, so clients don't take them to be clear.
+func withScreening(screening AddressScreener, next http.Handler) http.Handler {
+	return annotated(func(body []byte) []byte {
+		return addScreening(screening, body)
+	}, next)
+}
+
+// addScreening returns the response with the matches of the addresses in its
+// result, or with the screening error if they couldn't be screened, or the
+// response as it was if there are none or it isn't a JSON-RPC response
+func addScreening(screening AddressScreener, body []byte) []byte {
+	response, found, ok := resultAddresses(body)
+	if !ok || len(found) == 0 {
+		return body
+	}
+	// matched by address, whatever the case of the hex in the result
+	written := make(map[types.Address][]string, len(found))
+	addresses := make([]types.Address, 0, len(found))
+	for _, address := range found {
+		parsed := types.NewAddress(strings.ToLower(address))
+		if _, ok := written[parsed]; !ok {
+			addresses = append(addresses, parsed)
+		}
+		written[parsed] = append(written[parsed], address)
+	}
+	matches, err := screening.Screen(addresses)
+	if err != nil {
+		log.Warn("Screening the addresses of a response failed", "err", err)
+		return withField(response, "screeningError", true, body)
+	}
+	if len(matches) == 0 {
+		return body
+	}
+
+	flagged := make(map[string][]*types.ScreeningMatch)
+	for _, match := range matches {
+		for _, address := range written[match.Address] {
+			flagged[address] = append(flagged[address], match)
+		}
+	}
+	return withField(response, "screening", flagged, body)
+}
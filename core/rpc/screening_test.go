@@ -0,0 +1,103 @@
+package rpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+// fakeScreener flags the addresses it lists, or fails with err if set
+type fakeScreener struct {
+	listed map[types.Address]string
+	err    error
+}
+
+func (f *fakeScreener) Screen(addresses []types.Address) ([]*types.ScreeningMatch, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var matches []*types.ScreeningMatch
+	for _, address := range addresses {
+		if reason, ok := f.listed[address]; ok {
+			matches = append(matches, &types.ScreeningMatch{Address: address, List: "sanctions.txt", Reason: reason})
+		}
+	}
+	return matches, nil
+}
+
+func TestScreenAddresses(t *testing.T) {
+	apis := NewRPCAPIs(memory.NewMemoryDB(), nil)
+	var matches []*types.ScreeningMatch
+	assert.Equal(t, ErrScreeningNotEnabled, apis.ScreenAddresses(dummyReq, &ScreenAddressesArgs{Addresses: []types.Address{addr}}, &matches))
+
+	apis.screening = &fakeScreener{listed: map[types.Address]string{addr: "sanctioned"}}
+	assert.Nil(t, apis.ScreenAddresses(dummyReq, &ScreenAddressesArgs{Addresses: []types.Address{addr, types.NewAddress("2")}}, &matches))
+	assert.Equal(t, []*types.ScreeningMatch{{Address: addr, List: "sanctions.txt", Reason: "sanctioned"}}, matches)
+
+	assert.Nil(t, apis.ScreenAddresses(dummyReq, &ScreenAddressesArgs{Addresses: []types.Address{types.NewAddress("2")}}, &matches))
+	assert.Equal(t, []*types.ScreeningMatch{}, matches)
+}
+
+func TestWithScreening(t *testing.T) {
+	screener := &fakeScreener{listed: map[types.Address]string{addr: "sanctioned"}}
+	upper := "0x000000000000000000000000000000000000000A"
+	tests := []struct {
+		name     string
+		err      error
+		response string
+		expected string
+	}{
+		{
+			"listed addresses",
+			nil,
+			`{"result":{"from":"` + addr.String() + `","to":"` + upper + `"},"error":null,"id":1}`,
+			`{"error":null,"id":1,"result":{"from":"` + addr.String() + `","to":"` + upper + `"},"screening":{"` + addr.String() + `":[{"address":"` + addr.String() + `","list":"sanctions.txt","reason":"sanctioned"}]}}`,
+		},
+		{
+			"no listed addresses",
+			nil,
+			`{"result":["` + upper + `"],"error":null,"id":1}`,
+			`{"result":["` + upper + `"],"error":null,"id":1}`,
+		},
+		{
+			"screening failed",
+			errors.New("screening service unavailable"),
+			`{"result":["` + addr.String() + `"],"error":null,"id":1}`,
+			`{"error":null,"id":1,"result":["` + addr.String() + `"],"screeningError":true}`,
+		},
+		{
+			"not JSON",
+			nil,
+			`rpc: POST method required`,
+			`rpc: POST method required`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			screener.err = tc.err
+			handler := withScreening(screener, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tc.response))
+			}))
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}")))
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, tc.expected, recorder.Body.String())
+		})
+	}
+
+	// the addresses are matched whatever the case of their hex
+	screener.err = nil
+	screener.listed[types.NewAddress("a")] = "listed"
+	body := addScreening(screener, []byte(`{"result":"`+upper+`","error":null,"id":1}`))
+	assert.Contains(t, string(body), `"screening":{"`+upper+`":[{"address":"0x000000000000000000000000000000000000000a"`)
+}
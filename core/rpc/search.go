@@ -0,0 +1,27 @@
+package rpc
+
+import (
+	"fmt"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// DefaultSearchResults and MaxSearchResults bound how many results a
+	// search returns, mostly the events of a transaction
+	DefaultSearchResults = 20
+	MaxSearchResults     = 100
+)
+
+var ErrInvalidSearchLimit = fmt.Errorf("search limit must be between 1 and %d", MaxSearchResults)
+
+// searchQuery recognises the search term, looking it up as a name in the
+// naming registry if there is one
+func (r *RPCAPIs) searchQuery(term string) (*types.SearchQuery, error) {
+	if r.names != nil {
+		if address, ok := r.names.Resolve(term); ok {
+			return &types.SearchQuery{Address: &address}, nil
+		}
+	}
+	return types.NewSearchQuery(term)
+}
@@ -0,0 +1,32 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestSearch(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, db.AddAddresses([]types.Address{addr}))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1}))
+
+	var results []*types.SearchResult
+	assert.Nil(t, apis.Search(dummyReq, &SearchArgs{Term: tx1.Hash.String()}, &results))
+	assert.Equal(t, []*types.SearchResult{types.NewTransactionSearchResult(tx1.BlockNumber, tx1.Hash)}, results)
+
+	assert.Nil(t, apis.Search(dummyReq, &SearchArgs{Term: addr.String()}, &results))
+	assert.Equal(t, []*types.SearchResult{types.NewContractSearchResult(addr, "")}, results)
+
+	// names are looked up when naming is enabled
+	assert.EqualError(t, apis.Search(dummyReq, &SearchArgs{Term: "token.quorum"}, &results), "search term must be a block number, a hash or an address")
+	apis.names = fakeNameDirectory{"token.quorum": addr}
+	assert.Nil(t, apis.Search(dummyReq, &SearchArgs{Term: "token.quorum"}, &results))
+	assert.Equal(t, []*types.SearchResult{types.NewContractSearchResult(addr, "")}, results)
+
+	assert.Equal(t, ErrInvalidSearchLimit, apis.Search(dummyReq, &SearchArgs{Term: "1", Limit: MaxSearchResults + 1}, &results))
+}
@@ -3,15 +3,20 @@ package rpc
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/rpc/v2"
 	"github.com/gorilla/rpc/v2/json"
+	"github.com/gorilla/websocket"
 	"github.com/rs/cors"
 
 	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/database/scoped"
 	"quorumengineering/quorum-report/log"
 	"quorumengineering/quorum-report/types"
 )
@@ -24,72 +29,376 @@ const (
 
 type RPCService struct {
 	cors        []string
+	vhosts      []string
 	httpAddress string
+	allowedIPs  []string
+	listeners   []*types.ListenerConfig
 	db          database.Database
+	apiKeys     []*types.APIKeyConfig
+	jwt         *types.JWTConfig
+	groups      []*types.ContractGroupConfig
+	authoriser  *Authoriser
+	limiter     *RateLimiter
+	anomalies   AnomalyReporter
+	backfills   Backfiller
+	exports     Exporter
+	integrity   IntegrityVerifier
+	inference   LayoutInferrer
+	matcher     TemplateMatcher
+	health      HealthChecker
+	ingestion   IngestionController
+	names       NameDirectory
+	pending     PendingMonitor
+	screening   AddressScreener
+	retention   RetentionReporter
+	rules       RuleReloader
+	leadership  Leadership
+	webhooks    WebhookNotifier
+	profile     string
+	templates   []*types.TemplateConfig
+	staleAfter  time.Duration
+	queryGuard  *types.QueryGuardConfig
 
-	httpServer *http.Server
+	// a server for each listener
+	httpServers   []*http.Server
+	subscriptions *SubscriptionManager
+	// requests with keys restricted to contract groups are served from a
+	// database limited to their contracts, by the set of groups
+	scopes map[string]*contractScope
+	// the origins and hosts requests are accepted from, which can be updated
+	// while the server is running
+	originsMux   sync.RWMutex
+	apiHandler   http.Handler
+	corsHandler  http.Handler
+	upgrader     *websocket.Upgrader
+	allowedHosts map[string]bool
 
 	httpServerErrorChannel chan error
+	shutdownChan           chan struct{}
 	shutdownWg             sync.WaitGroup
 }
 
-func NewRPCService(db database.Database, config types.ReportingConfig, backendErrorChan chan error) *RPCService {
+type contractScope struct {
+	db      *scoped.Database
+	handler http.Handler
+}
+
+// Dependencies are the services the APIs call on. Any left nil isn't running,
+// and the APIs that need it return an error saying so.
+type Dependencies struct {
+	Anomalies  AnomalyReporter
+	Backfills  Backfiller
+	Exports    Exporter
+	Integrity  IntegrityVerifier
+	Inference  LayoutInferrer
+	Matcher    TemplateMatcher
+	Health     HealthChecker
+	Ingestion  IngestionController
+	Names      NameDirectory
+	Pending    PendingMonitor
+	Retention  RetentionReporter
+	Rules      RuleReloader
+	Leadership Leadership
+	Screening  AddressScreener
+	Webhooks   WebhookNotifier
+}
+
+func NewRPCService(db database.Database, config types.ReportingConfig, deps Dependencies, backendErrorChan chan error) *RPCService {
 	return &RPCService{
 		cors:        config.Server.RPCCorsList,
+		vhosts:      config.Server.RPCVHosts,
 		httpAddress: config.Server.RPCAddr,
+		allowedIPs:  config.Server.AllowedIPs,
+		listeners:   config.Server.Listeners,
 		db:          db,
+		apiKeys:     config.Server.APIKeys,
+		jwt:         config.Server.JWT,
+		groups:      config.Server.ContractGroups,
+		limiter:     NewRateLimiter(config.Server.RateLimit),
+		anomalies:   deps.Anomalies,
+		backfills:   deps.Backfills,
+		exports:     deps.Exports,
+		integrity:   deps.Integrity,
+		inference:   deps.Inference,
+		matcher:     deps.Matcher,
+		health:      deps.Health,
+		ingestion:   deps.Ingestion,
+		names:       deps.Names,
+		pending:     deps.Pending,
+		screening:   deps.Screening,
+		retention:   deps.Retention,
+		rules:       deps.Rules,
+		leadership:  deps.Leadership,
+		webhooks:    deps.Webhooks,
+		profile:     config.Profile,
+		templates:   config.Templates,
+		staleAfter:  time.Duration(config.Server.Health.StaleAfter) * time.Second,
+		queryGuard:  config.Server.QueryGuard,
 
 		httpServerErrorChannel: backendErrorChan,
+		shutdownChan:           make(chan struct{}),
 	}
 }
 
 func (r *RPCService) Start() error {
 	log.Info("Starting JSON-RPC server")
 
-	jsonrpcServer := rpc.NewServer()
-	jsonrpcServer.RegisterCodec(json.NewCodec(), "application/json")
-	if err := jsonrpcServer.RegisterService(NewRPCAPIs(r.db, NewDefaultContractManager(r.db)), "reporting"); err != nil {
+	authoriser, err := NewAuthoriser(r.apiKeys, r.jwt)
+	if err != nil {
 		return err
 	}
-	if err := jsonrpcServer.RegisterService(NewTokenRPCAPIs(r.db), "token"); err != nil {
+	r.authoriser = authoriser
+	listeners, err := newListeners(r.httpAddress, r.allowedIPs, r.listeners)
+	if err != nil {
 		return err
 	}
 
-	serverWithCors := cors.New(cors.Options{AllowedOrigins: r.cors}).Handler(jsonrpcServer)
-	r.httpServer = &http.Server{
-		Addr:    r.httpAddress,
-		Handler: serverWithCors,
+	apis, apiHandler, err := r.newAPIHandler(r.db)
+	if err != nil {
+		return err
+	}
+	// websocket subscriptions are served on the same address
+	r.subscriptions = NewSubscriptionManager(r.db, apis)
+	apis.subscriptions = r.subscriptions
+	if r.pending != nil {
+		r.pending.AddListener(r.subscriptions.NotifyPending)
+	}
 
-		ReadTimeout:  ReadTimeout,
-		WriteTimeout: WriteTimeout,
-		IdleTimeout:  IdleTimeout,
+	r.scopes = make(map[string]*contractScope)
+	for _, key := range r.apiKeys {
+		id := scopeID(key.Groups)
+		if len(key.Groups) == 0 || r.scopes[id] != nil {
+			continue
+		}
+		db := scoped.NewDatabase(r.db, r.contracts(key.Groups))
+		scopedAPIs, handler, err := r.newAPIHandler(db)
+		if err != nil {
+			return err
+		}
+		scopedAPIs.scope = db
+		scopedAPIs.snapshots = apis.snapshots
+		scopedAPIs.subscriptions = r.subscriptions
+		r.scopes[id] = &contractScope{db: db, handler: handler}
 	}
+	// responses say how far behind the chain their data may be
+	r.apiHandler = newFreshness(r.db, r.staleAfter).handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if scope := r.scope(req); scope != nil {
+			scope.handler.ServeHTTP(w, req)
+			return
+		}
+		apiHandler.ServeHTTP(w, req)
+	}))
+	r.UpdateOrigins(r.cors, r.vhosts)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// probes are sent to whatever address the orchestrator uses
+		if IsHealthRequest(req) {
+			ServeHealth(r.health, w, req)
+			return
+		}
+		if IsMetricsRequest(req) {
+			ServeMetrics(r.subscriptions, r.retention, w)
+			return
+		}
+		r.originsMux.RLock()
+		hostAllowed, corsHandler := r.hostAllowed(req.Host), r.corsHandler
+		r.originsMux.RUnlock()
+		if !hostAllowed {
+			http.Error(w, "invalid host specified", http.StatusForbidden)
+			return
+		}
+		if websocket.IsWebSocketUpgrade(req) {
+			r.serveWebsocket(w, req)
+			return
+		}
+		corsHandler.ServeHTTP(w, req)
+	})
 
 	r.shutdownWg.Add(1)
 	go func() {
 		defer r.shutdownWg.Done()
-		if err := r.httpServer.ListenAndServe(); err != http.ErrServerClosed {
-			log.Error("Unable to start JSON-RPC server", "err", err)
-			r.httpServerErrorChannel <- err
-		}
+		r.subscriptions.Run(r.shutdownChan)
 	}()
 
-	log.Info("JSON-RPC HTTP endpoint opened", "url", fmt.Sprintf("http://%s", r.httpServer.Addr))
+	for _, l := range listeners {
+		httpServer := &http.Server{
+			Addr:    l.addr,
+			Handler: l.handler(handler),
+
+			ReadTimeout:  ReadTimeout,
+			WriteTimeout: WriteTimeout,
+			IdleTimeout:  IdleTimeout,
+		}
+		r.httpServers = append(r.httpServers, httpServer)
+
+		r.shutdownWg.Add(1)
+		go func() {
+			defer r.shutdownWg.Done()
+			if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.Error("Unable to start JSON-RPC server", "addr", httpServer.Addr, "err", err)
+				r.httpServerErrorChannel <- err
+			}
+		}()
+
+		log.Info("JSON-RPC HTTP endpoint opened", "url", fmt.Sprintf("http://%s", httpServer.Addr), "exposure", l.exposure)
+		log.Info("JSON-RPC websocket endpoint opened", "url", fmt.Sprintf("ws://%s", httpServer.Addr), "exposure", l.exposure)
+	}
 	return nil
 }
 
+// newAPIHandler serves the JSON-RPC API, and the CSV, NDJSON and CBOR exports,
+// from the database
+func (r *RPCService) newAPIHandler(db database.Database) (*RPCAPIs, http.Handler, error) {
+	jsonrpcServer := rpc.NewServer()
+	jsonrpcServer.RegisterCodec(json.NewCodec(), "application/json")
+	jsonrpcServer.RegisterValidateRequestFunc(func(info *rpc.RequestInfo, args interface{}) error {
+		if err := r.authoriser.Authorise(info.Request, info.Method); err != nil {
+			return err
+		}
+		if err := r.limiter.Allow(r.authoriser.Client(info.Request), info.Method); err != nil {
+			// the error data is returned as an object, not only its message
+			return &json.Error{Data: err}
+		}
+		if (isWriteMethod(info.Method) || leaderMethods[info.Method]) && r.leadership != nil && !r.leadership.IsLeader() {
+			return ErrStandby
+		}
+		return nil
+	})
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	apis.anomalies = r.anomalies
+	apis.backfills = r.backfills
+	apis.exports = r.exports
+	apis.integrity = r.integrity
+	apis.inference = r.inference
+	apis.matcher = r.matcher
+	apis.ingestion = r.ingestion
+	apis.names = r.names
+	apis.pending = r.pending
+	apis.screening = r.screening
+	apis.rules = r.rules
+	apis.leadership = r.leadership
+	apis.webhooks = r.webhooks
+	apis.headersOnly = r.profile == types.HeadersProfile
+	apis.csvTemplates = csvTemplates(r.templates)
+	apis.contractGroups = r.groups
+	apis.queryGuard = r.queryGuard
+	if err := jsonrpcServer.RegisterService(apis, "reporting"); err != nil {
+		return nil, nil, err
+	}
+	if err := jsonrpcServer.RegisterService(NewTokenRPCAPIs(db), "token"); err != nil {
+		return nil, nil, err
+	}
+
+	// addresses in results are annotated with their registered names, and
+	// flagged if on a screening list
+	var jsonrpcAnnotated http.Handler = jsonrpcServer
+	if r.names != nil {
+		jsonrpcAnnotated = withNames(r.names, jsonrpcAnnotated)
+	}
+	if r.screening != nil {
+		jsonrpcAnnotated = withScreening(r.screening, jsonrpcAnnotated)
+	}
+
+	// event and transaction lists can also be streamed as CSV, NDJSON or CBOR
+	csvExporter := NewCSVExporter(apis, r.authoriser, r.limiter)
+	ndjsonExporter := NewNDJSONExporter(apis, r.authoriser, r.limiter)
+	return apis, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if IsNDJSONRequest(req) || IsCBORRequest(req) {
+			ndjsonExporter.ServeHTTP(w, req)
+			return
+		}
+		if IsCSVRequest(req) {
+			csvExporter.ServeHTTP(w, req)
+			return
+		}
+		jsonrpcAnnotated.ServeHTTP(w, req)
+	}), nil
+}
+
+// contracts returns the contracts of the groups
+func (r *RPCService) contracts(groups []string) []types.Address {
+	var contracts []types.Address
+	for _, group := range r.groups {
+		for _, name := range groups {
+			if group.Name == name {
+				contracts = append(contracts, group.Addresses...)
+			}
+		}
+	}
+	return contracts
+}
+
+// scope returns the contracts the request's API key is restricted to, or nil
+// if it isn't
+func (r *RPCService) scope(req *http.Request) *contractScope {
+	groups := r.authoriser.ContractGroups(req)
+	if len(groups) == 0 {
+		return nil
+	}
+	return r.scopes[scopeID(groups)]
+}
+
+// scopeID identifies a set of contract groups, in any order
+func scopeID(groups []string) string {
+	sorted := append([]string{}, groups...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// UpdateOrigins replaces the origins cross-origin and websocket requests are
+// accepted from, and the hosts all requests are accepted for, without
+// restarting the server.
+func (r *RPCService) UpdateOrigins(corsList []string, vhosts []string) {
+	r.originsMux.Lock()
+	defer r.originsMux.Unlock()
+
+	r.cors, r.vhosts = corsList, vhosts
+	r.upgrader = newUpgrader(corsList)
+	r.allowedHosts = make(map[string]bool, len(vhosts))
+	for _, host := range vhosts {
+		r.allowedHosts[strings.ToLower(host)] = true
+	}
+	if r.apiHandler != nil {
+		r.corsHandler = cors.New(cors.Options{
+			AllowedOrigins: corsList,
+			AllowedHeaders: []string{"Accept", "Content-Type", "X-Requested-With", APIKeyHeader, AuthorizationHeader},
+			ExposedHeaders: freshnessHeaders,
+		}).Handler(r.apiHandler)
+	}
+}
+
+// hostAllowed checks the host a request was sent to, without its port,
+// against the configured virtual hosts. Any host is allowed if none are
+// configured, or if "*" is.
+func (r *RPCService) hostAllowed(host string) bool {
+	if len(r.allowedHosts) == 0 || r.allowedHosts["*"] {
+		return true
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return r.allowedHosts[strings.ToLower(host)]
+}
+
 func (r *RPCService) Stop() {
 	log.Info("Stopping JSON-RPC server")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if r.httpServer != nil {
-		if err := r.httpServer.Shutdown(ctx); err != nil {
-			log.Error("JSON-RPC server shutdown failed", "err", err)
+	if len(r.httpServers) > 0 {
+		for _, httpServer := range r.httpServers {
+			if err := httpServer.Shutdown(ctx); err != nil {
+				log.Error("JSON-RPC server shutdown failed", "addr", httpServer.Addr, "err", err)
+			}
 		}
+		// hijacked websocket connections are not closed by the HTTP server
+		close(r.shutdownChan)
+		r.subscriptions.CloseAll()
 		r.shutdownWg.Wait()
 
-		log.Info("RPC HTTP endpoint closed", "url", fmt.Sprintf("http://%s", r.httpServer.Addr))
+		for _, httpServer := range r.httpServers {
+			log.Info("RPC HTTP endpoint closed", "url", fmt.Sprintf("http://%s", httpServer.Addr))
+		}
 	}
 
 	log.Info("RPC service stopped")
@@ -0,0 +1,171 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/database/scoped"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestUpdateOrigins_Hosts(t *testing.T) {
+	r := &RPCService{}
+	r.UpdateOrigins(nil, nil)
+	assert.True(t, r.hostAllowed("example.com:4000"))
+
+	r.UpdateOrigins(nil, []string{"localhost", "Reporting.internal"})
+	assert.True(t, r.hostAllowed("localhost:4000"))
+	assert.True(t, r.hostAllowed("reporting.internal"))
+	assert.False(t, r.hostAllowed("example.com:4000"))
+
+	r.UpdateOrigins(nil, []string{"*"})
+	assert.True(t, r.hostAllowed("example.com:4000"))
+}
+
+func TestUpdateOrigins_CORS(t *testing.T) {
+	r := &RPCService{apiHandler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})}
+	allowedOrigin := func(origin string) string {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		r.corsHandler.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	r.UpdateOrigins([]string{"http://a.example.com"}, nil)
+	assert.Equal(t, "http://a.example.com", allowedOrigin("http://a.example.com"))
+	assert.Equal(t, "", allowedOrigin("http://b.example.com"))
+
+	// websocket origins are updated with them
+	r.UpdateOrigins([]string{"http://b.example.com"}, nil)
+	assert.Equal(t, "", allowedOrigin("http://a.example.com"))
+	assert.Equal(t, "http://b.example.com", allowedOrigin("http://b.example.com"))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "http://b.example.com")
+	assert.True(t, r.upgrader.CheckOrigin(req))
+}
+
+func TestRPCService_ContractGroups(t *testing.T) {
+	other := types.NewAddress("0x0000000000000000000000000000000000000002")
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{addr, other}))
+
+	config := types.ReportingConfig{}
+	config.Server.RPCAddr = "localhost:0"
+	config.Server.ContractGroups = []*types.ContractGroupConfig{
+		{Name: "payments", Addresses: []types.Address{addr}},
+		{Name: "lending", Addresses: []types.Address{other}},
+	}
+	config.Server.APIKeys = []*types.APIKeyConfig{
+		{Key: "payments-key", Permission: types.FullPermission, Groups: []string{"payments"}},
+		{Key: "full-key", Permission: types.FullPermission},
+	}
+	r := NewRPCService(db, config, Dependencies{}, make(chan error, 1))
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	call := func(key string, method string, params interface{}, result interface{}) string {
+		body, _ := json.Marshal(map[string]interface{}{"id": 1, "method": method, "params": []interface{}{params}})
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		r.apiHandler.ServeHTTP(w, req)
+		var resp struct {
+			Result json.RawMessage
+			Error  *string
+		}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		if resp.Error != nil {
+			return *resp.Error
+		}
+		assert.Nil(t, json.Unmarshal(resp.Result, result))
+		return ""
+	}
+
+	var addresses []types.Address
+	assert.Empty(t, call("payments-key", "reporting.GetAddresses", struct{}{}, &addresses))
+	assert.Equal(t, []types.Address{addr}, addresses)
+	assert.Empty(t, call("full-key", "reporting.GetAddresses", struct{}{}, &addresses))
+	assert.Len(t, addresses, 2)
+
+	var events EventsResp
+	assert.Empty(t, call("payments-key", "reporting.GetAllEventsFromAddress", &AddressWithOptions{Address: &addr}, &events))
+	assert.Equal(t, scoped.ErrContractNotInScope.Error(), call("payments-key", "reporting.GetAllEventsFromAddress", &AddressWithOptions{Address: &other}, &events))
+	assert.Equal(t, scoped.ErrContractNotInScope.Error(), call("payments-key", "reporting.DeleteAddress", &DeleteAddressArgs{Address: &other}, nil))
+	assert.Equal(t, ErrMethodNotInScope.Error(), call("payments-key", "reporting.DeleteBlockRange", &DeleteBlockRangeArgs{From: 1, To: 2}, nil))
+}
+
+type fakeLeadership struct {
+	leader bool
+}
+
+func (l *fakeLeadership) IsLeader() bool {
+	return l.leader
+}
+
+func (l *fakeLeadership) Status() *types.HighAvailabilityStatus {
+	return &types.HighAvailabilityStatus{InstanceID: "reporting-1", Leader: l.leader}
+}
+
+func TestRPCService_Standby(t *testing.T) {
+	db := memory.NewMemoryDB()
+	config := types.ReportingConfig{}
+	config.Server.RPCAddr = "localhost:0"
+	leadership := &fakeLeadership{}
+	r := NewRPCService(db, config, Dependencies{Leadership: leadership}, make(chan error, 1))
+	assert.Nil(t, r.Start())
+	defer r.Stop()
+
+	call := func(method string, params interface{}, result interface{}) string {
+		body, _ := json.Marshal(map[string]interface{}{"id": 1, "method": method, "params": []interface{}{params}})
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.apiHandler.ServeHTTP(w, req)
+		var resp struct {
+			Result json.RawMessage
+			Error  *string
+		}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		if resp.Error != nil {
+			return *resp.Error
+		}
+		assert.Nil(t, json.Unmarshal(resp.Result, result))
+		return ""
+	}
+
+	// a standby serves reads, but not writes
+	var addresses []types.Address
+	assert.Empty(t, call("reporting.GetAddresses", struct{}{}, &addresses))
+	assert.Equal(t, ErrStandby.Error(), call("reporting.AddAddress", &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Equal(t, ErrStandby.Error(), call("reporting.PauseIngestion", struct{}{}, nil))
+	var status types.HighAvailabilityStatus
+	assert.Empty(t, call("reporting.GetHighAvailabilityStatus", struct{}{}, &status))
+	assert.False(t, status.Leader)
+
+	leadership.leader = true
+	var null interface{}
+	assert.Empty(t, call("reporting.AddAddress", &AddressWithOptionalBlock{Address: &addr}, &null))
+	assert.Empty(t, call("reporting.GetAddresses", struct{}{}, &addresses))
+	assert.Equal(t, []types.Address{addr}, addresses)
+}
+
+func TestDeleteAddressArgs_UnmarshalJSON(t *testing.T) {
+	var args DeleteAddressArgs
+	assert.Nil(t, json.Unmarshal([]byte(`{"address":"`+addr.String()+`","purge":true}`), &args))
+	assert.Equal(t, DeleteAddressArgs{Address: &addr, Purge: true}, args)
+
+	// the bare address taken before purging was added
+	args = DeleteAddressArgs{}
+	assert.Nil(t, json.Unmarshal([]byte(` "`+addr.String()+`"`), &args))
+	assert.Equal(t, DeleteAddressArgs{Address: &addr}, args)
+
+	assert.NotNil(t, json.Unmarshal([]byte(`"0xnotanaddress"`), &args))
+}
@@ -0,0 +1,159 @@
+package rpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	DefaultSnapshotTTL = 5 * time.Minute
+	MaxSnapshotTTL     = 30 * time.Minute
+)
+
+var ErrSnapshotNotFound = errors.New("snapshot not found or expired")
+
+type snapshot struct {
+	blockNumber uint64
+	// the block each queried address was pinned at, which may be lower than
+	// blockNumber if the address had not been filtered up to it yet
+	addressBlocks map[types.Address]uint64
+	expiresAt     time.Time
+}
+
+// SnapshotManager keeps track of short-lived snapshots, which pin paginated
+// queries to the blocks that were indexed when the snapshot was opened, so
+// that pages stay consistent while new blocks are indexed.
+type SnapshotManager struct {
+	db        database.Database
+	snapshots map[string]*snapshot
+	now       func() time.Time
+	mux       sync.Mutex
+}
+
+func NewSnapshotManager(db database.Database) *SnapshotManager {
+	return &SnapshotManager{
+		db:        db,
+		snapshots: make(map[string]*snapshot),
+		now:       time.Now,
+	}
+}
+
+// Open creates a new snapshot at the last persisted block, returning its ID
+// and the time it expires at.
+func (sm *SnapshotManager) Open(ttl time.Duration) (string, uint64, time.Time, error) {
+	if ttl <= 0 {
+		ttl = DefaultSnapshotTTL
+	}
+	if ttl > MaxSnapshotTTL {
+		ttl = MaxSnapshotTTL
+	}
+
+	lastPersisted, err := sm.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		return "", 0, time.Time{}, err
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", 0, time.Time{}, err
+	}
+	id := hex.EncodeToString(idBytes)
+
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	sm.removeExpired()
+
+	expiresAt := sm.now().Add(ttl)
+	sm.snapshots[id] = &snapshot{
+		blockNumber:   lastPersisted,
+		addressBlocks: make(map[types.Address]uint64),
+		expiresAt:     expiresAt,
+	}
+	return id, lastPersisted, expiresAt, nil
+}
+
+func (sm *SnapshotManager) Close(id string) error {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	sm.removeExpired()
+
+	if _, ok := sm.snapshots[id]; !ok {
+		return ErrSnapshotNotFound
+	}
+	delete(sm.snapshots, id)
+	return nil
+}
+
+// EndBlockNumber limits the given end block of a query for an address to
+// the block the snapshot pinned that address at. An empty ID leaves the end
+// block unchanged.
+func (sm *SnapshotManager) EndBlockNumber(id string, address types.Address, end *big.Int) (*big.Int, error) {
+	if id == "" {
+		return end, nil
+	}
+
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	sm.removeExpired()
+
+	snap, ok := sm.snapshots[id]
+	if !ok {
+		return nil, ErrSnapshotNotFound
+	}
+
+	pinned, ok := snap.addressBlocks[address]
+	if !ok {
+		lastFiltered, err := sm.db.GetLastFiltered(address)
+		if err != nil {
+			return nil, err
+		}
+		pinned = snap.blockNumber
+		if lastFiltered < pinned {
+			pinned = lastFiltered
+		}
+		snap.addressBlocks[address] = pinned
+	}
+	return capEndBlockNumber(end, pinned), nil
+}
+
+// GlobalEndBlockNumber is EndBlockNumber for queries across all contracts,
+// which are pinned at the block the snapshot was opened at.
+func (sm *SnapshotManager) GlobalEndBlockNumber(id string, end *big.Int) (*big.Int, error) {
+	if id == "" {
+		return end, nil
+	}
+
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	sm.removeExpired()
+
+	snap, ok := sm.snapshots[id]
+	if !ok {
+		return nil, ErrSnapshotNotFound
+	}
+	return capEndBlockNumber(end, snap.blockNumber), nil
+}
+
+func capEndBlockNumber(end *big.Int, pinned uint64) *big.Int {
+	pinnedBig := new(big.Int).SetUint64(pinned)
+	if end == nil || end.Cmp(big.NewInt(-1)) == 0 || end.Cmp(pinnedBig) > 0 {
+		return pinnedBig
+	}
+	return end
+}
+
+func (sm *SnapshotManager) removeExpired() {
+	now := sm.now()
+	for id, snap := range sm.snapshots {
+		if now.After(snap.expiresAt) {
+			delete(sm.snapshots, id)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package rpc
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestSnapshotManager_PinsEndBlockNumber(t *testing.T) {
+	db := memory.NewMemoryDB()
+	_ = db.AddAddresses([]types.Address{addr})
+	_ = db.WriteBlocks([]*types.Block{{Number: 1}, {Number: 2}})
+	_ = db.IndexBlocks([]types.Address{addr}, []*types.Block{{Number: 1}})
+
+	sm := NewSnapshotManager(db)
+	id, blockNumber, _, err := sm.Open(0)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, blockNumber)
+
+	// address has only been filtered up to block 1
+	end, err := sm.EndBlockNumber(id, addr, big.NewInt(-1))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, end.Uint64())
+
+	// further indexing doesn't move the pinned block
+	_ = db.WriteBlocks([]*types.Block{{Number: 3}})
+	_ = db.IndexBlocks([]types.Address{addr}, []*types.Block{{Number: 2}, {Number: 3}})
+	end, err = sm.EndBlockNumber(id, addr, big.NewInt(10))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, end.Uint64())
+
+	// lower end blocks are kept
+	end, err = sm.EndBlockNumber(id, addr, big.NewInt(0))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, end.Uint64())
+
+	// no snapshot leaves the end block as is
+	end, err = sm.EndBlockNumber("", addr, big.NewInt(-1))
+	assert.Nil(t, err)
+	assert.EqualValues(t, -1, end.Int64())
+
+	// queries across all contracts are pinned at the snapshot's block
+	end, err = sm.GlobalEndBlockNumber(id, big.NewInt(-1))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, end.Uint64())
+	_, err = sm.GlobalEndBlockNumber("missing", big.NewInt(-1))
+	assert.Equal(t, ErrSnapshotNotFound, err)
+}
+
+func TestSnapshotManager_ExpiryAndClose(t *testing.T) {
+	db := memory.NewMemoryDB()
+	_ = db.AddAddresses([]types.Address{addr})
+
+	now := time.Now()
+	sm := NewSnapshotManager(db)
+	sm.now = func() time.Time { return now }
+
+	id, _, expiresAt, err := sm.Open(time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(MaxSnapshotTTL), expiresAt)
+
+	now = now.Add(MaxSnapshotTTL + time.Second)
+	_, err = sm.EndBlockNumber(id, addr, big.NewInt(-1))
+	assert.EqualError(t, err, ErrSnapshotNotFound.Error())
+
+	id, _, _, err = sm.Open(0)
+	assert.Nil(t, err)
+	assert.Nil(t, sm.Close(id))
+	assert.EqualError(t, sm.Close(id), ErrSnapshotNotFound.Error())
+}
@@ -0,0 +1,104 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// averageDecimals is how many decimal places averages are given to
+const averageDecimals = 18
+
+var (
+	ErrInvalidWeighting = errors.New("invalid weighting, must be blocks or seconds")
+	ErrNoStorageInRange = errors.New("no storage indexed for the contract by the end of the range")
+)
+
+// valueSpan is the value a variable held from a block, and how much the
+// value counts towards an average
+type valueSpan struct {
+	from   uint64
+	value  *big.Int
+	weight uint64
+}
+
+// numericSpans returns the value of the variable in each entry of storage,
+// weighted by the number of blocks between begin and end inclusive it held
+// for. Blocks before the first entry have no value, so aren't counted.
+func numericSpans(storage []*types.StorageValues, variable string, layout func() (*types.SolidityStorageDocument, error), begin uint64, end uint64) ([]*valueSpan, error) {
+	var spans []*valueSpan
+	err := eachStorageRange(storage, layout, begin, end, func(from uint64, to uint64, values []*types.StorageValue) error {
+		for _, value := range values {
+			if value.Variable != variable {
+				continue
+			}
+			number, ok := new(big.Int).SetString(value.Value, 10)
+			if !ok {
+				return fmt.Errorf("storage variable %s is not a number at block %d: %q", variable, from, value.Value)
+			}
+			spans = append(spans, &valueSpan{from: from, value: number, weight: to - from + 1})
+			return nil
+		}
+		return fmt.Errorf("storage variable %s not found at block %d", variable, from)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(spans) == 0 {
+		return nil, ErrNoStorageInRange
+	}
+	return spans, nil
+}
+
+// weighBySeconds weighs each span by the seconds from its first block to the
+// first block of the next span, and the last span by the seconds to the end
+// block
+func (r *RPCAPIs) weighBySeconds(spans []*valueSpan, end uint64) error {
+	timestamp := func(number uint64) (uint64, error) {
+		block, err := r.db.ReadBlock(number)
+		if err != nil {
+			return 0, fmt.Errorf("reading timestamp of block %d: %v", number, err)
+		}
+		return block.Timestamp, nil
+	}
+	for i, span := range spans {
+		start, err := timestamp(span.from)
+		if err != nil {
+			return err
+		}
+		next := end
+		if i+1 < len(spans) {
+			next = spans[i+1].from
+		}
+		finish, err := timestamp(next)
+		if err != nil {
+			return err
+		}
+		span.weight = 0
+		if finish > start {
+			span.weight = finish - start
+		}
+	}
+	return nil
+}
+
+// weightedAverage returns the average of the values by their weights, and
+// the total weight. When nothing has any weight, such as a range of one
+// block weighted by seconds, the average is the last value.
+func weightedAverage(spans []*valueSpan) (string, uint64) {
+	sum := new(big.Int)
+	var total uint64
+	for _, span := range spans {
+		sum.Add(sum, new(big.Int).Mul(span.value, new(big.Int).SetUint64(span.weight)))
+		total += span.weight
+	}
+	if total == 0 {
+		return spans[len(spans)-1].value.String(), 0
+	}
+	average := new(big.Rat).SetFrac(sum, new(big.Int).SetUint64(total)).FloatString(averageDecimals)
+	average = strings.TrimRight(strings.TrimRight(average, "0"), ".")
+	return average, total
+}
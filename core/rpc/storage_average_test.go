@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestGetStorageAverage(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	layout := `{"storage":[{"label":"paused","offset":0,"slot":"0","type":"t_bool"},{"label":"counter","offset":0,"slot":"1","type":"t_uint256"}],"types":{"t_bool":{"encoding":"inplace","label":"bool","numberOfBytes":"1"},"t_uint256":{"encoding":"inplace","label":"uint256","numberOfBytes":"32"}}}`
+	assert.Nil(t, apis.AddStorageABI(dummyReq, &AddressWithData{Address: &addr, Data: layout}, nil))
+
+	decoded := func(paused string, counter string) []*types.StorageValue {
+		return []*types.StorageValue{{Variable: "paused", Value: paused}, {Variable: "counter", Value: counter}}
+	}
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {Root: types.NewHash("0x01"), Decoded: decoded("false", "1")}}, 5))
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {Root: types.NewHash("0x02"), Decoded: decoded("true", "3")}}, 10))
+	// indexed without decoded values, so decoded with the stored layout
+	raw := map[types.Hash]string{types.NewHash("0x00"): "01", types.NewHash("0x01"): "07"}
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {Root: types.NewHash("0x03"), Storage: raw}}, 15))
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {Root: types.NewHash("0x04"), Decoded: decoded("false", "7")}}, 18))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{
+		{Number: 5, Timestamp: 100},
+		{Number: 7, Timestamp: 104},
+		{Number: 10, Timestamp: 110},
+		{Number: 15, Timestamp: 170},
+		{Number: 18, Timestamp: 200},
+		{Number: 20, Timestamp: 220},
+	}))
+
+	average := func(variable string, weightBy string, begin int64, end int64) (StorageAverageResp, error) {
+		var reply StorageAverageResp
+		err := apis.GetStorageAverage(dummyReq, &StorageAverageArgs{
+			Address:  &addr,
+			Variable: variable,
+			WeightBy: weightBy,
+			Options:  &types.PageOptions{BeginBlockNumber: big.NewInt(begin), EndBlockNumber: big.NewInt(end)},
+		}, &reply)
+		return reply, err
+	}
+
+	// blocks before the first storage have no value, so aren't counted
+	reply, err := average("counter", "", 0, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, "3.875", reply.Average)
+	assert.Equal(t, uint64(16), reply.Weight)
+	assert.Equal(t, WeightByBlocks, reply.WeightBy)
+
+	reply, err = average("counter", WeightBySeconds, 0, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, "4.5", reply.Average)
+	assert.Equal(t, uint64(120), reply.Weight)
+
+	// the storage at the start of the range is from the change before it
+	reply, err = average("counter", WeightByBlocks, 7, 13)
+	assert.Nil(t, err)
+	assert.Equal(t, "2.142857142857142857", reply.Average)
+
+	// no time passes within a single block
+	reply, err = average("counter", WeightBySeconds, 7, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", reply.Average)
+	assert.Equal(t, uint64(0), reply.Weight)
+
+	_, err = average("counter", WeightBySeconds, 7, 8)
+	assert.EqualError(t, err, "reading timestamp of block 8: block does not exist")
+	_, err = average("counter", "", 0, 3)
+	assert.Equal(t, ErrNoStorageInRange, err)
+	_, err = average("paused", "", 0, 20)
+	assert.EqualError(t, err, `storage variable paused is not a number at block 5: "false"`)
+	_, err = average("missing", "", 0, 20)
+	assert.EqualError(t, err, "storage variable missing not found at block 5")
+	_, err = average("counter", "days", 0, 20)
+	assert.Equal(t, ErrInvalidWeighting, err)
+	_, err = average("", "", 0, 20)
+	assert.Equal(t, ErrNoVariable, err)
+	err = apis.GetStorageAverage(dummyReq, &StorageAverageArgs{Variable: "counter"}, &StorageAverageResp{})
+	assert.Equal(t, ErrNoAddress, err)
+}
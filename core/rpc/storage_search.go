@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"quorumengineering/quorum-report/core/storageparsing"
+	"quorumengineering/quorum-report/types"
+)
+
+var (
+	ErrNoVariable      = errors.New("storage variable not provided")
+	ErrInvalidOperator = errors.New("invalid comparison operator, must be one of eq, gt, gte, lt or lte")
+)
+
+// storageMatcher compares the decoded value of a storage variable to a target
+type storageMatcher struct {
+	variable string
+	operator string
+	value    string
+	number   *big.Int
+}
+
+func newStorageMatcher(variable string, operator string, value string) (*storageMatcher, error) {
+	if variable == "" {
+		return nil, ErrNoVariable
+	}
+	if operator == "" {
+		operator = "eq"
+	}
+	m := &storageMatcher{variable: variable, operator: operator, value: value}
+	m.number, _ = new(big.Int).SetString(value, 10)
+	switch operator {
+	case "eq":
+	case "gt", "gte", "lt", "lte":
+		if m.number == nil {
+			return nil, fmt.Errorf("value %q must be a number to compare with %s", value, operator)
+		}
+	default:
+		return nil, ErrInvalidOperator
+	}
+	return m, nil
+}
+
+// matches checks the value of the variable in the storage. Numbers compare by
+// value, and anything else by case-insensitive equality, so that addresses
+// and hex strings match however they are written.
+func (m *storageMatcher) matches(values []*types.StorageValue) bool {
+	for _, value := range values {
+		if value.Variable != m.variable {
+			continue
+		}
+		number, isNumber := new(big.Int).SetString(value.Value, 10)
+		if m.operator == "eq" {
+			if isNumber && m.number != nil {
+				return number.Cmp(m.number) == 0
+			}
+			return strings.EqualFold(strings.TrimPrefix(value.Value, "0x"), strings.TrimPrefix(m.value, "0x"))
+		}
+		if !isNumber {
+			return false
+		}
+		cmp := number.Cmp(m.number)
+		switch m.operator {
+		case "gt":
+			return cmp > 0
+		case "gte":
+			return cmp >= 0
+		case "lt":
+			return cmp < 0
+		default:
+			return cmp <= 0
+		}
+	}
+	return false
+}
+
+// matchingRanges returns the block ranges between begin and end inclusive in
+// which the storage matched, merging ranges next to each other.
+func matchingRanges(storage []*types.StorageValues, matcher *storageMatcher, layout func() (*types.SolidityStorageDocument, error), begin uint64, end uint64) ([]*BlockRange, error) {
+	ranges := []*BlockRange{}
+	err := eachStorageRange(storage, layout, begin, end, func(from uint64, to uint64, values []*types.StorageValue) error {
+		if !matcher.matches(values) {
+			return nil
+		}
+		if last := len(ranges) - 1; last >= 0 && ranges[last].To+1 == from {
+			ranges[last].To = to
+			return nil
+		}
+		ranges = append(ranges, &BlockRange{From: from, To: to})
+		return nil
+	})
+	return ranges, err
+}
+
+// eachStorageRange calls fn with the decoded values of each entry of storage,
+// and the blocks between begin and end inclusive that it holds for. Each
+// entry holds from its block until the block before the next entry.
+func eachStorageRange(storage []*types.StorageValues, layout func() (*types.SolidityStorageDocument, error), begin uint64, end uint64, fn func(from uint64, to uint64, values []*types.StorageValue) error) error {
+	var storageLayout *types.SolidityStorageDocument
+	for i, entry := range storage {
+		from := entry.BlockNumber
+		if from < begin {
+			from = begin
+		}
+		to := end
+		if i+1 < len(storage) && storage[i+1].BlockNumber <= end {
+			to = storage[i+1].BlockNumber - 1
+		}
+		if from > to {
+			continue
+		}
+
+		values := entry.Values
+		if values == nil {
+			// indexed without a layout, so decoded with the current one
+			var err error
+			if storageLayout == nil {
+				if storageLayout, err = layout(); err != nil {
+					return err
+				}
+			}
+			if values, err = storageparsing.DecodeStorageValues(entry.Storage, *storageLayout); err != nil {
+				return err
+			}
+		}
+		if err := fn(from, to, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package rpc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestSearchStorage(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	layout := `{"storage":[{"label":"paused","offset":0,"slot":"0","type":"t_bool"},{"label":"counter","offset":0,"slot":"1","type":"t_uint256"}],"types":{"t_bool":{"encoding":"inplace","label":"bool","numberOfBytes":"1"},"t_uint256":{"encoding":"inplace","label":"uint256","numberOfBytes":"32"}}}`
+	assert.Nil(t, apis.AddStorageABI(dummyReq, &AddressWithData{Address: &addr, Data: layout}, nil))
+
+	decoded := func(paused string, counter string) []*types.StorageValue {
+		return []*types.StorageValue{{Variable: "paused", Value: paused}, {Variable: "counter", Value: counter}}
+	}
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {Root: types.NewHash("0x01"), Decoded: decoded("false", "1")}}, 5))
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {Root: types.NewHash("0x02"), Decoded: decoded("true", "3")}}, 10))
+	// indexed without decoded values, so decoded with the stored layout
+	raw := map[types.Hash]string{types.NewHash("0x00"): "01", types.NewHash("0x01"): "07"}
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {Root: types.NewHash("0x03"), Storage: raw}}, 15))
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {Root: types.NewHash("0x04"), Decoded: decoded("false", "7")}}, 18))
+
+	search := func(variable string, operator string, value string, begin int64, end int64) ([]*BlockRange, error) {
+		var reply StorageSearchResp
+		err := apis.SearchStorage(dummyReq, &StorageSearchArgs{
+			Address:  &addr,
+			Variable: variable,
+			Operator: operator,
+			Value:    value,
+			Options:  &types.PageOptions{BeginBlockNumber: big.NewInt(begin), EndBlockNumber: big.NewInt(end)},
+		}, &reply)
+		return reply.Ranges, err
+	}
+
+	ranges, err := search("paused", "", "true", 0, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, []*BlockRange{{From: 10, To: 17}}, ranges)
+
+	ranges, err = search("counter", "gte", "3", 0, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, []*BlockRange{{From: 10, To: 20}}, ranges)
+
+	// the storage at the start of the range is from the change before it
+	ranges, err = search("counter", "lt", "3", 7, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, []*BlockRange{{From: 7, To: 9}}, ranges)
+
+	ranges, err = search("paused", "eq", "false", 11, 16)
+	assert.Nil(t, err)
+	assert.Equal(t, []*BlockRange{}, ranges)
+
+	ranges, err = search("missing", "eq", "1", 0, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, []*BlockRange{}, ranges)
+
+	_, err = search("", "eq", "1", 0, 20)
+	assert.Equal(t, ErrNoVariable, err)
+	_, err = search("counter", "ne", "1", 0, 20)
+	assert.Equal(t, ErrInvalidOperator, err)
+	_, err = search("counter", "gt", "abc", 0, 20)
+	assert.EqualError(t, err, `value "abc" must be a number to compare with gt`)
+	err = apis.SearchStorage(dummyReq, &StorageSearchArgs{Variable: "counter"}, &StorageSearchResp{})
+	assert.Equal(t, ErrNoAddress, err)
+}
+
+func TestStorageMatcher(t *testing.T) {
+	values := []*types.StorageValue{{Variable: "owner", Value: "0xdcad3a6d3569df655070ded06cb7a1b2ccd1d3af"}, {Variable: "total", Value: "0100"}}
+
+	matcher, err := newStorageMatcher("owner", "eq", "0xDCAD3A6D3569DF655070DED06CB7A1B2CCD1D3AF")
+	assert.Nil(t, err)
+	assert.True(t, matcher.matches(values))
+
+	// numbers compare by value
+	matcher, err = newStorageMatcher("total", "eq", "100")
+	assert.Nil(t, err)
+	assert.True(t, matcher.matches(values))
+	matcher, err = newStorageMatcher("total", "lte", "99")
+	assert.Nil(t, err)
+	assert.False(t, matcher.matches(values))
+
+	// values that aren't numbers never compare as greater or less
+	matcher, err = newStorageMatcher("owner", "gt", "0")
+	assert.Nil(t, err)
+	assert.False(t, matcher.matches(values))
+}
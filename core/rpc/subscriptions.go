@@ -0,0 +1,453 @@
+package rpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// subscription types
+const (
+	NewBlocksSubscription    = "newBlocks"
+	TransactionsSubscription = "transactions"
+	EventsSubscription       = "events"
+	// transactions waiting in the node's pool, when they are monitored
+	PendingTransactionsSubscription = "pendingTransactions"
+)
+
+// SubscriptionPollPeriod is how often newly persisted blocks are checked for
+const SubscriptionPollPeriod = time.Second
+
+// MaxResumeBlocks is the furthest a subscription can be resumed from behind
+// the last block subscribers were notified of
+const MaxResumeBlocks = 1000
+
+var (
+	ErrUnknownSubscriptionType = errors.New("unknown subscription type")
+	ErrSubscriptionNotFound    = errors.New("subscription not found")
+	ErrInvalidResumeToken      = errors.New("invalid resume token")
+	ErrResumeTooOld            = fmt.Errorf("resume token is more than %d blocks behind", MaxResumeBlocks)
+	ErrResumeTooManyMissed     = errors.New("too many notifications were missed to resume the subscription")
+	ErrPendingNotResumable     = errors.New("pending transaction subscriptions can't be resumed")
+)
+
+type subscription struct {
+	id      string
+	kind    string
+	address types.Address
+	conn    *wsConnection
+
+	// notifications at or before the resume token were already sent
+	resumeAfter *types.Cursor
+	// the notifications missed before a subscription was resumed, and any
+	// since, are held back until the subscriber has been sent its ID
+	held    []*heldNotification
+	holding bool
+	mux     sync.Mutex
+}
+
+type heldNotification struct {
+	blockNumber uint64
+	token       string
+	result      interface{}
+}
+
+// notify sends the subscriber the notification at the position in the block,
+// along with the token to resume the subscription after it
+func (sub *subscription) notify(blockNumber uint64, index uint64, result interface{}) {
+	sub.mux.Lock()
+	defer sub.mux.Unlock()
+	if sub.resumeAfter != nil && !sub.resumeAfter.Precedes(blockNumber, index) {
+		return
+	}
+	token := types.NewCursor(blockNumber, index)
+	if sub.holding {
+		sub.held = append(sub.held, &heldNotification{blockNumber: blockNumber, token: token, result: result})
+		return
+	}
+	sub.conn.Notify(sub.id, blockNumber, token, result)
+}
+
+// release sends the notifications held back whilst resuming
+func (sub *subscription) release() {
+	sub.mux.Lock()
+	defer sub.mux.Unlock()
+	for _, held := range sub.held {
+		sub.conn.Notify(sub.id, held.blockNumber, held.token, held.result)
+	}
+	sub.held = nil
+	sub.holding = false
+}
+
+// SubscriptionManager keeps track of the subscriptions of all websocket
+// connections, and notifies them of each block once it is persisted, along
+// with the transactions and events in the block that they subscribed to.
+type SubscriptionManager struct {
+	db   database.Database
+	apis *RPCAPIs
+
+	subscriptions map[string]*subscription
+	connections   map[*wsConnection]bool
+	// the last block subscribers were notified of
+	lastNotified uint64
+	initialised  bool
+	// notifications sent and dropped by connections that have closed, where
+	// those still queued when closing count as dropped
+	closedSent    uint64
+	closedDropped uint64
+	mux           sync.Mutex
+	// held whilst notifying subscribers of new blocks, or replaying them to a
+	// resumed subscription
+	notifyMux sync.Mutex
+}
+
+func NewSubscriptionManager(db database.Database, apis *RPCAPIs) *SubscriptionManager {
+	return &SubscriptionManager{
+		db:            db,
+		apis:          apis,
+		subscriptions: make(map[string]*subscription),
+		connections:   make(map[*wsConnection]bool),
+	}
+}
+
+func (sm *SubscriptionManager) Run(stopChan <-chan struct{}) {
+	ticker := time.NewTicker(SubscriptionPollPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := sm.NotifyNewBlocks(); err != nil {
+				log.Warn("Notifying subscribers of new blocks failed", "err", err)
+			}
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+// Subscribe adds a subscription for the connection, returning its ID. The
+// transactions and events subscriptions are for the given address, and the
+// pending transactions subscription for all registered contracts if none is
+// given.
+//
+// Each notification of a block, transaction or event carries a resume token,
+// its position in the persisted chain. Subscribing with the last token
+// received, such as after reconnecting, replays the notifications since from
+// the database before carrying on with new blocks. The replayed notifications
+// are held back until Release is called, once the subscriber has been sent
+// the subscription's ID.
+func (sm *SubscriptionManager) Subscribe(conn *wsConnection, kind string, address types.Address, resumeToken string) (string, error) {
+	if kind != NewBlocksSubscription && kind != TransactionsSubscription && kind != EventsSubscription && kind != PendingTransactionsSubscription {
+		return "", ErrUnknownSubscriptionType
+	}
+	if kind != NewBlocksSubscription && kind != PendingTransactionsSubscription && address.IsEmpty() {
+		return "", ErrNoAddress
+	}
+	if kind == PendingTransactionsSubscription && resumeToken != "" {
+		return "", ErrPendingNotResumable
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", err
+	}
+	id := "0x" + hex.EncodeToString(idBytes)
+	sub := &subscription{id: id, kind: kind, address: address, conn: conn}
+
+	if resumeToken != "" {
+		after, err := types.ParseCursor(resumeToken)
+		if err != nil {
+			return "", ErrInvalidResumeToken
+		}
+		// no new blocks are notified until the subscription is added, so
+		// none are missed or sent twice
+		sm.notifyMux.Lock()
+		defer sm.notifyMux.Unlock()
+		if err := sm.replay(sub, after); err != nil {
+			return "", err
+		}
+	}
+
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	sm.subscriptions[id] = sub
+	return id, nil
+}
+
+// replay holds the notifications after the resume token, up to the last block
+// notified, for the subscription
+func (sm *SubscriptionManager) replay(sub *subscription, after *types.Cursor) error {
+	lastNotified, err := sm.syncLastNotified()
+	if err != nil {
+		return err
+	}
+	if after.BlockNumber+MaxResumeBlocks < lastNotified {
+		return ErrResumeTooOld
+	}
+
+	sub.resumeAfter = after
+	sub.holding = true
+	from := after.BlockNumber
+	if from == 0 {
+		from = 1
+	}
+	for blockNumber := from; blockNumber <= lastNotified; blockNumber++ {
+		block, err := sm.db.ReadBlock(blockNumber)
+		if err != nil {
+			return err
+		}
+		if err := sm.notifyBlock(block, []*subscription{sub}); err != nil {
+			return err
+		}
+		// more than would fit in the subscriber's queue
+		if len(sub.held) > wsQueueSize {
+			return ErrResumeTooManyMissed
+		}
+	}
+	return nil
+}
+
+// Release sends a resumed subscription the notifications it missed.
+func (sm *SubscriptionManager) Release(conn *wsConnection, id string) {
+	sm.mux.Lock()
+	sub, ok := sm.subscriptions[id]
+	sm.mux.Unlock()
+	if ok && sub.conn == conn {
+		sub.release()
+	}
+}
+
+// AddConnection tracks an open connection, so it can be closed on shutdown.
+func (sm *SubscriptionManager) AddConnection(conn *wsConnection) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	sm.connections[conn] = true
+}
+
+func (sm *SubscriptionManager) Unsubscribe(conn *wsConnection, id string) error {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	if sub, ok := sm.subscriptions[id]; !ok || sub.conn != conn {
+		return ErrSubscriptionNotFound
+	}
+	delete(sm.subscriptions, id)
+	return nil
+}
+
+// RemoveConnection removes all subscriptions of a closed connection.
+func (sm *SubscriptionManager) RemoveConnection(conn *wsConnection) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	for id, sub := range sm.subscriptions {
+		if sub.conn == conn {
+			delete(sm.subscriptions, id)
+		}
+	}
+	if sm.connections[conn] {
+		stats := conn.stats(sm.lastNotified)
+		sm.closedSent += stats.Sent
+		sm.closedDropped += stats.Dropped + uint64(stats.Queued)
+	}
+	delete(sm.connections, conn)
+}
+
+// Stats reports the connected subscribers and their subscriptions, along with
+// how far behind each of them is.
+func (sm *SubscriptionManager) Stats() *types.SubscriptionStats {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+
+	stats := &types.SubscriptionStats{
+		Connections:   len(sm.connections),
+		Subscriptions: make(map[string]int),
+		Sent:          sm.closedSent,
+		Dropped:       sm.closedDropped,
+		Subscribers:   make([]*types.SubscriberStats, 0, len(sm.connections)),
+	}
+	subscribers := make(map[*wsConnection]*types.SubscriberStats, len(sm.connections))
+	for conn := range sm.connections {
+		subscriber := conn.stats(sm.lastNotified)
+		subscribers[conn] = subscriber
+		stats.Subscribers = append(stats.Subscribers, subscriber)
+		stats.Sent += subscriber.Sent
+		stats.Dropped += subscriber.Dropped
+	}
+	for _, sub := range sm.subscriptions {
+		stats.Subscriptions[sub.kind]++
+		if subscriber, ok := subscribers[sub.conn]; ok {
+			subscriber.Subscriptions[sub.kind]++
+		}
+	}
+	sort.Slice(stats.Subscribers, func(i, j int) bool {
+		return stats.Subscribers[i].ConnectedAt < stats.Subscribers[j].ConnectedAt ||
+			(stats.Subscribers[i].ConnectedAt == stats.Subscribers[j].ConnectedAt && stats.Subscribers[i].ID < stats.Subscribers[j].ID)
+	})
+	return stats
+}
+
+// CloseAll closes all websocket connections.
+func (sm *SubscriptionManager) CloseAll() {
+	sm.mux.Lock()
+	connections := make([]*wsConnection, 0, len(sm.connections))
+	for conn := range sm.connections {
+		connections = append(connections, conn)
+	}
+	sm.mux.Unlock()
+
+	for _, conn := range connections {
+		conn.Close()
+	}
+}
+
+// NotifyNewBlocks sends notifications for all blocks persisted since the last
+// check. Subscriptions only receive blocks that are persisted after they are
+// made.
+func (sm *SubscriptionManager) NotifyNewBlocks() error {
+	sm.notifyMux.Lock()
+	defer sm.notifyMux.Unlock()
+	lastPersisted, err := sm.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		return err
+	}
+	lastNotified := sm.resetLastNotified(lastPersisted)
+
+	sm.mux.Lock()
+	subs := make([]*subscription, 0, len(sm.subscriptions))
+	for _, sub := range sm.subscriptions {
+		subs = append(subs, sub)
+	}
+	sm.mux.Unlock()
+
+	for blockNumber := lastNotified + 1; blockNumber <= lastPersisted; blockNumber++ {
+		if len(subs) > 0 {
+			block, err := sm.db.ReadBlock(blockNumber)
+			if err != nil {
+				return err
+			}
+			if err := sm.notifyBlock(block, subs); err != nil {
+				return err
+			}
+		}
+
+		sm.mux.Lock()
+		sm.lastNotified = blockNumber
+		sm.mux.Unlock()
+	}
+	return nil
+}
+
+// syncLastNotified returns the last block notified, which is the last block
+// persisted before any have been
+func (sm *SubscriptionManager) syncLastNotified() (uint64, error) {
+	lastPersisted, err := sm.db.GetLastPersistedBlockNumber()
+	if err != nil {
+		return 0, err
+	}
+	return sm.resetLastNotified(lastPersisted), nil
+}
+
+// resetLastNotified moves the last block notified to the last persisted on
+// startup, or if blocks were rolled back after a reorg, and returns it
+func (sm *SubscriptionManager) resetLastNotified(lastPersisted uint64) uint64 {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	if !sm.initialised || sm.lastNotified > lastPersisted {
+		sm.lastNotified = lastPersisted
+		sm.initialised = true
+	}
+	return sm.lastNotified
+}
+
+// notifyBlock sends the subscriptions the block, or its transactions and
+// events, positioned by their index in the block
+func (sm *SubscriptionManager) notifyBlock(block *types.Block, subs []*subscription) error {
+	var txSubs, eventSubs []*subscription
+	for _, sub := range subs {
+		switch sub.kind {
+		case NewBlocksSubscription:
+			sub.notify(block.Number, 0, block)
+		case TransactionsSubscription:
+			txSubs = append(txSubs, sub)
+		case EventsSubscription:
+			eventSubs = append(eventSubs, sub)
+		}
+	}
+	if len(txSubs) == 0 && len(eventSubs) == 0 {
+		return nil
+	}
+
+	for i, txHash := range block.Transactions {
+		tx, err := sm.db.ReadTransaction(txHash)
+		if err != nil {
+			return err
+		}
+
+		var parsedTx *types.ParsedTransaction
+		for _, sub := range txSubs {
+			if tx.To != sub.address {
+				continue
+			}
+			if parsedTx == nil {
+				parsedTx = &types.ParsedTransaction{}
+				if err := sm.apis.GetTransaction(nil, &txHash, parsedTx); err != nil {
+					return err
+				}
+			}
+			sub.notify(block.Number, uint64(i), sub.conn.scopeTransaction(parsedTx))
+		}
+
+		for _, sub := range eventSubs {
+			for _, event := range tx.Events {
+				if event.Address != sub.address {
+					continue
+				}
+				parsedEvent, err := sm.parseEvent(event)
+				if err != nil {
+					return err
+				}
+				sub.notify(block.Number, event.Index, parsedEvent)
+			}
+		}
+	}
+	return nil
+}
+
+// NotifyPending sends a pending transaction to the subscriptions for it,
+// leaving out those to contracts outside of a subscriber's scope.
+func (sm *SubscriptionManager) NotifyPending(tx *types.PendingTransaction) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	for _, sub := range sm.subscriptions {
+		if sub.kind != PendingTransactionsSubscription || (!sub.address.IsEmpty() && sub.address != tx.To) {
+			continue
+		}
+		if sub.conn.scope != nil && !sub.conn.scope.Contains(tx.To) {
+			continue
+		}
+		// pending transactions have no place in the chain to resume from
+		sub.conn.Notify(sub.id, sm.lastNotified, "", tx)
+	}
+}
+
+func (sm *SubscriptionManager) parseEvent(event *types.Event) (*types.ParsedEvent, error) {
+	parsedEvent := &types.ParsedEvent{RawEvent: event}
+	parsedEvent.SetTimestamp(newBlockTimestamps(sm.db).lookup(event.BlockNumber, event.Timestamp))
+	contractABI, err := sm.db.GetContractABI(event.Address)
+	if err != nil {
+		return nil, err
+	}
+	if contractABI != "" {
+		if err := parsedEvent.ParseEvent(contractABI); err != nil {
+			return nil, err
+		}
+	}
+	return parsedEvent, nil
+}
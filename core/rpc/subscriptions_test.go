@@ -0,0 +1,267 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/database/scoped"
+	"quorumengineering/quorum-report/types"
+)
+
+func subscribe(t *testing.T, conn *websocket.Conn, params ...interface{}) string {
+	assert.Nil(t, conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": SubscribeMethod, "params": params}))
+	var resp struct {
+		Result string
+		Error  *wsError
+	}
+	assert.Nil(t, conn.ReadJSON(&resp))
+	assert.Nil(t, resp.Error)
+	return resp.Result
+}
+
+func readNotification(t *testing.T, conn *websocket.Conn, result interface{}) string {
+	id, _ := readResumableNotification(t, conn, result)
+	return id
+}
+
+func readResumableNotification(t *testing.T, conn *websocket.Conn, result interface{}) (string, string) {
+	assert.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var notification struct {
+		Method string
+		Params struct {
+			Subscription string
+			Result       json.RawMessage
+			ResumeToken  string
+		}
+	}
+	assert.Nil(t, conn.ReadJSON(&notification))
+	assert.Equal(t, NotificationMethod, notification.Method)
+	assert.Nil(t, json.Unmarshal(notification.Params.Result, result))
+	return notification.Params.Subscription, notification.Params.ResumeToken
+}
+
+func TestSubscriptions(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, apis.AddABI(dummyReq, &AddressWithData{&addr, validABI}, nil))
+
+	service := &RPCService{
+		authoriser:    &Authoriser{},
+		upgrader:      newUpgrader(nil),
+		subscriptions: NewSubscriptionManager(db, apis),
+	}
+	server := httptest.NewServer(http.HandlerFunc(service.serveWebsocket))
+	defer server.Close()
+	defer service.subscriptions.CloseAll()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// only blocks persisted after subscribing are sent
+	assert.Nil(t, service.subscriptions.NotifyNewBlocks())
+	blocksID := subscribe(t, conn, NewBlocksSubscription)
+	txsID := subscribe(t, conn, TransactionsSubscription, addr)
+	eventsID := subscribe(t, conn, EventsSubscription, addr)
+
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, service.subscriptions.NotifyNewBlocks())
+
+	var notifiedBlock types.Block
+	assert.Equal(t, blocksID, readNotification(t, conn, &notifiedBlock))
+	assert.Equal(t, block.Hash, notifiedBlock.Hash)
+
+	// tx2 and tx3 are sent to the address, and tx3 emits an event
+	var parsedTx types.ParsedTransaction
+	assert.Equal(t, txsID, readNotification(t, conn, &parsedTx))
+	assert.Equal(t, "set(uint256 _x)", parsedTx.Sig)
+	assert.Equal(t, txsID, readNotification(t, conn, &parsedTx))
+	assert.Equal(t, tx3.Hash, parsedTx.RawTransaction.Hash)
+
+	var parsedEvent struct {
+		Sig string `json:"eventSig"`
+	}
+	assert.Equal(t, eventsID, readNotification(t, conn, &parsedEvent))
+	assert.Equal(t, "event valueSet(uint256 _value)", parsedEvent.Sig)
+
+	// the last notification is counted once its write returns
+	assert.Eventually(t, func() bool { return service.subscriptions.Stats().Sent == 4 }, time.Second, 10*time.Millisecond)
+	stats := service.subscriptions.Stats()
+	assert.Equal(t, 1, stats.Connections)
+	assert.Equal(t, map[string]int{NewBlocksSubscription: 1, TransactionsSubscription: 1, EventsSubscription: 1}, stats.Subscriptions)
+	assert.Len(t, stats.Subscribers, 1)
+	assert.Len(t, stats.Subscribers[0].ID, 16)
+	assert.Equal(t, 0, stats.Subscribers[0].Queued)
+	assert.Equal(t, uint64(0), stats.Subscribers[0].LagBlocks)
+
+	// unsubscribe from new blocks
+	assert.Nil(t, conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": UnsubscribeMethod, "params": []string{blocksID}}))
+	var resp struct {
+		Result bool
+	}
+	assert.Nil(t, conn.ReadJSON(&resp))
+	assert.True(t, resp.Result)
+
+	assert.Nil(t, conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 3, "method": SubscribeMethod, "params": []string{"unknown"}}))
+	var errResp struct {
+		Error *wsError
+	}
+	assert.Nil(t, conn.ReadJSON(&errResp))
+	assert.Equal(t, ErrUnknownSubscriptionType.Error(), errResp.Error.Message)
+}
+
+func TestSubscriptions_Resume(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, apis.AddAddress(dummyReq, &AddressWithOptionalBlock{Address: &addr}, nil))
+	assert.Nil(t, apis.AddABI(dummyReq, &AddressWithData{&addr, validABI}, nil))
+
+	service := &RPCService{
+		authoriser:    &Authoriser{},
+		upgrader:      newUpgrader(nil),
+		subscriptions: NewSubscriptionManager(db, apis),
+	}
+	server := httptest.NewServer(http.HandlerFunc(service.serveWebsocket))
+	defer server.Close()
+	defer service.subscriptions.CloseAll()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, service.subscriptions.NotifyNewBlocks())
+	subscribe(t, conn, TransactionsSubscription, addr)
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, service.subscriptions.NotifyNewBlocks())
+
+	// the subscriber disconnects having only received tx2
+	var parsedTx types.ParsedTransaction
+	_, token := readResumableNotification(t, conn, &parsedTx)
+	assert.Equal(t, tx2.Hash, parsedTx.RawTransaction.Hash)
+	assert.Equal(t, types.NewCursor(1, 1), token)
+	conn.Close()
+
+	conn, _, err = websocket.DefaultDialer.Dial(url, nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	subscribe(t, conn, TransactionsSubscription, addr, token)
+	_, token = readResumableNotification(t, conn, &parsedTx)
+	assert.Equal(t, tx3.Hash, parsedTx.RawTransaction.Hash)
+	assert.Equal(t, types.NewCursor(1, 2), token)
+
+	// a new blocks subscription resumed from before the first block replays it
+	blocksID := subscribe(t, conn, NewBlocksSubscription, nil, types.NewCursor(0, 0))
+	var notifiedBlock types.Block
+	assert.Equal(t, blocksID, readNotification(t, conn, &notifiedBlock))
+	assert.Equal(t, block.Hash, notifiedBlock.Hash)
+
+	// live notifications carry on after those replayed
+	block2 := &types.Block{Hash: types.NewHash("0x02"), Number: 2}
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block2}))
+	assert.Nil(t, service.subscriptions.NotifyNewBlocks())
+	assert.Equal(t, blocksID, readNotification(t, conn, &notifiedBlock))
+	assert.Equal(t, block2.Hash, notifiedBlock.Hash)
+
+	for _, tc := range []struct {
+		params []interface{}
+		err    error
+	}{
+		{[]interface{}{NewBlocksSubscription, nil, "invalid"}, ErrInvalidResumeToken},
+		{[]interface{}{PendingTransactionsSubscription, nil, token}, ErrPendingNotResumable},
+	} {
+		assert.Nil(t, conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": SubscribeMethod, "params": tc.params}))
+		var errResp struct {
+			Error *wsError
+		}
+		assert.Nil(t, conn.ReadJSON(&errResp))
+		assert.Equal(t, tc.err.Error(), errResp.Error.Message)
+	}
+}
+
+func TestSubscriptions_ContractScope(t *testing.T) {
+	db := memory.NewMemoryDB()
+	authoriser, err := NewAuthoriser([]*types.APIKeyConfig{{Key: "team-key", Permission: types.ReadPermission, Groups: []string{"team"}}}, nil)
+	assert.Nil(t, err)
+	service := &RPCService{
+		authoriser:    authoriser,
+		upgrader:      newUpgrader(nil),
+		subscriptions: NewSubscriptionManager(db, nil),
+		scopes:        map[string]*contractScope{"team": {db: scoped.NewDatabase(db, []types.Address{addr})}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(service.serveWebsocket))
+	defer server.Close()
+	defer service.subscriptions.CloseAll()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), http.Header{APIKeyHeader: []string{"team-key"}})
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	subscribe(t, conn, EventsSubscription, addr)
+	other := types.NewAddress("0x0000000000000000000000000000000000000002")
+	assert.Nil(t, conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": SubscribeMethod, "params": []interface{}{EventsSubscription, other}}))
+	var errResp struct {
+		Error *wsError
+	}
+	assert.Nil(t, conn.ReadJSON(&errResp))
+	assert.Equal(t, scoped.ErrContractNotInScope.Error(), errResp.Error.Message)
+
+	// the events of other contracts are left out of transactions
+	wsConn := &wsConnection{scope: service.scopes["team"].db}
+	tx := &types.ParsedTransaction{
+		RawTransaction: &types.Transaction{Events: []*types.Event{{Address: other}, {Address: addr}}},
+		ParsedEvents:   []*types.ParsedEvent{{RawEvent: &types.Event{Address: other}}, {RawEvent: &types.Event{Address: addr}}},
+	}
+	scopedTx := wsConn.scopeTransaction(tx)
+	assert.Len(t, scopedTx.RawTransaction.Events, 1)
+	assert.Len(t, scopedTx.ParsedEvents, 1)
+	assert.Equal(t, addr, scopedTx.ParsedEvents[0].RawEvent.Address)
+	assert.Len(t, tx.RawTransaction.Events, 2)
+}
+
+func TestSubscriptions_FullQueue(t *testing.T) {
+	conns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := newUpgrader(nil).Upgrade(w, req, nil)
+		assert.Nil(t, err)
+		conns <- conn
+	}))
+	defer server.Close()
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// without the write loop running, nothing leaves the queue
+	sm := NewSubscriptionManager(memory.NewMemoryDB(), nil)
+	wsConn := &wsConnection{id: "slow", conn: <-conns, closed: make(chan struct{}), queueSignal: make(chan struct{}, 1)}
+	sm.AddConnection(wsConn)
+	_, err = sm.Subscribe(wsConn, NewBlocksSubscription, "", "")
+	assert.Nil(t, err)
+	for i := uint64(0); i < wsQueueSize+2; i++ {
+		wsConn.Notify("0x01", 5+i, "", i)
+	}
+	sm.lastNotified = 20
+
+	stats := sm.Stats()
+	assert.Equal(t, uint64(2), stats.Dropped)
+	assert.Equal(t, wsQueueSize, stats.Subscribers[0].Queued)
+	assert.Equal(t, uint64(15), stats.Subscribers[0].LagBlocks)
+	assert.Equal(t, map[string]int{NewBlocksSubscription: 1}, stats.Subscribers[0].Subscriptions)
+
+	// notifications still queued when the subscriber disconnects are never sent
+	sm.RemoveConnection(wsConn)
+	wsConn.Close()
+	stats = sm.Stats()
+	assert.Equal(t, 0, stats.Connections)
+	assert.Equal(t, uint64(wsQueueSize+2), stats.Dropped)
+	assert.Empty(t, stats.Subscriptions)
+}
@@ -0,0 +1,35 @@
+package rpc
+
+import (
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+)
+
+// blockTimestamps finds the block time of transactions and events. It is
+// stored on them when they are written, but data written by older versions
+// doesn't have it, so it is then joined from the block, once per block.
+type blockTimestamps struct {
+	db     database.Database
+	blocks map[uint64]uint64
+}
+
+func newBlockTimestamps(db database.Database) *blockTimestamps {
+	return &blockTimestamps{db: db, blocks: make(map[uint64]uint64)}
+}
+
+func (bt *blockTimestamps) lookup(blockNumber uint64, timestamp uint64) uint64 {
+	if timestamp != 0 {
+		return timestamp
+	}
+	if blockTimestamp, ok := bt.blocks[blockNumber]; ok {
+		return blockTimestamp
+	}
+	block, err := bt.db.ReadBlock(blockNumber)
+	if err != nil {
+		// the timestamp is extra information, so not worth failing the request for
+		log.Debug("Unable to read block for timestamp", "number", blockNumber, "err", err)
+		return 0
+	}
+	bt.blocks[blockNumber] = block.Timestamp
+	return block.Timestamp
+}
@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"errors"
+	"math"
 	"math/big"
 	"net/http"
 
@@ -9,11 +10,18 @@ import (
 	"quorumengineering/quorum-report/types"
 )
 
+// TokenAPIDB reads the tokens of contracts, and the blocks their data is
+// frozen at
+type TokenAPIDB interface {
+	database.TokenDB
+	GetTerminalBlock(types.Address) (uint64, error)
+}
+
 type TokenRPCAPIs struct {
-	db database.TokenDB
+	db TokenAPIDB
 }
 
-func NewTokenRPCAPIs(db database.TokenDB) *TokenRPCAPIs {
+func NewTokenRPCAPIs(db TokenAPIDB) *TokenRPCAPIs {
 	return &TokenRPCAPIs{db}
 }
 
@@ -45,6 +53,9 @@ func (r *TokenRPCAPIs) GetERC20TokenHoldersAtBlock(req *http.Request, query *ERC
 	if query.Block == 0 {
 		return errors.New("block must be provided and not 0")
 	}
+	if err := checkFrozen(r.db, *query.Contract, query.Block); err != nil {
+		return err
+	}
 	if query.Options == nil {
 		query.Options = &types.TokenQueryOptions{}
 	}
@@ -59,6 +70,87 @@ func (r *TokenRPCAPIs) GetERC20TokenHoldersAtBlock(req *http.Request, query *ERC
 	return nil
 }
 
+// GetERC20TokenHolders lists the holders of a token with a non-zero balance at
+// a block, and their balances
+func (r *TokenRPCAPIs) GetERC20TokenHolders(req *http.Request, query *ERC20TokenHoldersQuery, reply *[]*types.ERC20Holding) error {
+	if query.Contract == nil {
+		return errors.New("no token contract provided")
+	}
+	if query.Block == 0 {
+		return errors.New("block must be provided and not 0")
+	}
+	if err := checkFrozen(r.db, *query.Contract, query.Block); err != nil {
+		return err
+	}
+	if query.Options == nil {
+		query.Options = &types.QueryOptions{}
+	}
+	query.Options.SetDefaults()
+
+	holdings, err := r.db.GetERC20TokenHolders(*query.Contract, query.Block, query.Options)
+	if err != nil {
+		return err
+	}
+
+	*reply = holdings
+	return nil
+}
+
+// GetERC20Allowance returns the allowance of a spender approved by an owner at
+// each block it was approved in the range, and at the start of the range
+func (r *TokenRPCAPIs) GetERC20Allowance(req *http.Request, query *ERC20AllowanceQuery, reply *map[uint64]*big.Int) error {
+	if query.Contract == nil {
+		return errors.New("no token contract provided")
+	}
+	if query.Owner == nil {
+		return errors.New("no token owner provided")
+	}
+	if query.Spender == nil {
+		return errors.New("no spender provided")
+	}
+	if query.Options == nil {
+		query.Options = &types.TokenQueryOptions{}
+	}
+	query.Options.SetDefaults()
+
+	allowances, err := r.db.GetERC20Allowance(*query.Contract, *query.Owner, *query.Spender, query.Options)
+	if err != nil {
+		return err
+	}
+
+	*reply = allowances
+	return nil
+}
+
+// GetERC20Allowances lists the non-zero allowances an owner has approved at a
+// block, or the current allowances if no block is given
+func (r *TokenRPCAPIs) GetERC20Allowances(req *http.Request, query *ERC20AllowancesQuery, reply *[]*types.ERC20Allowance) error {
+	if query.Contract == nil {
+		return errors.New("no token contract provided")
+	}
+	if query.Owner == nil {
+		return errors.New("no token owner provided")
+	}
+	block := query.Block
+	if block == 0 {
+		block = math.MaxInt64
+	} else if err := checkFrozen(r.db, *query.Contract, block); err != nil {
+		return err
+	}
+	if query.Options == nil {
+		query.Options = &types.QueryOptions{}
+	}
+	query.Options.SetDefaults()
+
+	allowances, err := r.db.GetERC20Allowances(*query.Contract, *query.Owner, block, query.Options)
+	if err != nil {
+		return err
+	}
+
+	*reply = allowances
+	return nil
+}
+
 func (r *TokenRPCAPIs) GetHolderForERC721TokenAtBlock(req *http.Request, query *ERC721TokenQuery, reply *types.Address) error {
 	if query.Contract == nil {
 		return errors.New("no token contract provided")
@@ -69,6 +161,9 @@ func (r *TokenRPCAPIs) GetHolderForERC721TokenAtBlock(req *http.Request, query *
 	if query.Block == 0 {
 		return errors.New("no block given")
 	}
+	if err := checkFrozen(r.db, *query.Contract, query.Block); err != nil {
+		return err
+	}
 
 	result, err := r.db.ERC721TokenByTokenID(*query.Contract, query.Block, query.TokenId)
 	if err != nil {
@@ -79,6 +174,29 @@ func (r *TokenRPCAPIs) GetHolderForERC721TokenAtBlock(req *http.Request, query *
 	return nil
 }
 
+// GetERC721TokenHistory lists the holders of a token in the block range,
+// oldest first, with the blocks each held it from and until
+func (r *TokenRPCAPIs) GetERC721TokenHistory(req *http.Request, query *ERC721TokenQuery, reply *[]types.ERC721Token) error {
+	if query.Contract == nil {
+		return errors.New("no token contract provided")
+	}
+	if query.TokenId == nil {
+		return errors.New("no token ID provided")
+	}
+	if query.Options == nil {
+		query.Options = &types.TokenQueryOptions{}
+	}
+	query.Options.SetDefaults()
+
+	results, err := r.db.ERC721TokenHistory(*query.Contract, query.TokenId, query.Options)
+	if err != nil {
+		return err
+	}
+
+	*reply = results
+	return nil
+}
+
 func (r *TokenRPCAPIs) ERC721TokensForAccountAtBlock(req *http.Request, query *ERC721TokenQuery, reply *[]types.ERC721Token) error {
 	if query.Contract == nil {
 		return errors.New("no token contract provided")
@@ -89,6 +207,9 @@ func (r *TokenRPCAPIs) ERC721TokensForAccountAtBlock(req *http.Request, query *E
 	if query.Block == 0 {
 		return errors.New("no block given")
 	}
+	if err := checkFrozen(r.db, *query.Contract, query.Block); err != nil {
+		return err
+	}
 	if query.Options == nil {
 		query.Options = &types.TokenQueryOptions{}
 	}
@@ -110,6 +231,9 @@ func (r *TokenRPCAPIs) AllERC721TokensAtBlock(req *http.Request, query *ERC721To
 	if query.Block == 0 {
 		return errors.New("no block given")
 	}
+	if err := checkFrozen(r.db, *query.Contract, query.Block); err != nil {
+		return err
+	}
 	if query.Options == nil {
 		query.Options = &types.TokenQueryOptions{}
 	}
@@ -131,6 +255,9 @@ func (r *TokenRPCAPIs) AllERC721HoldersAtBlock(req *http.Request, query *ERC721T
 	if query.Block == 0 {
 		return errors.New("no block given")
 	}
+	if err := checkFrozen(r.db, *query.Contract, query.Block); err != nil {
+		return err
+	}
 	if query.Options == nil {
 		query.Options = &types.TokenQueryOptions{}
 	}
@@ -144,3 +271,88 @@ func (r *TokenRPCAPIs) AllERC721HoldersAtBlock(req *http.Request, query *ERC721T
 	*reply = results
 	return nil
 }
+
+func (r *TokenRPCAPIs) GetERC1155TokenBalance(req *http.Request, query *ERC1155TokenQuery, reply *map[uint64]*big.Int) error {
+	if query.Contract == nil {
+		return errors.New("no token contract provided")
+	}
+	if query.Holder == nil {
+		return errors.New("no token holder provided")
+	}
+	if query.TokenId == nil {
+		return errors.New("no token ID provided")
+	}
+	if query.Options == nil {
+		query.Options = &types.TokenQueryOptions{}
+	}
+	query.Options.SetDefaults()
+
+	bal, err := r.db.GetERC1155Balance(*query.Contract, *query.Holder, query.TokenId, query.Options)
+	if err != nil {
+		return err
+	}
+
+	*reply = bal
+	return nil
+}
+
+func (r *TokenRPCAPIs) GetERC1155TokenBalanceAtBlock(req *http.Request, query *ERC1155TokenQuery, reply *big.Int) error {
+	if query.Contract == nil {
+		return errors.New("no token contract provided")
+	}
+	if query.Holder == nil {
+		return errors.New("no token holder provided")
+	}
+	if query.TokenId == nil {
+		return errors.New("no token ID provided")
+	}
+	if query.Block == 0 {
+		return errors.New("no block given")
+	}
+	if err := checkFrozen(r.db, *query.Contract, query.Block); err != nil {
+		return err
+	}
+
+	// the balance at a block is the latest balance at the start of a single block range
+	blockNumber := new(big.Int).SetUint64(query.Block)
+	options := &types.TokenQueryOptions{BeginBlockNumber: blockNumber, EndBlockNumber: blockNumber}
+	options.SetDefaults()
+
+	bal, err := r.db.GetERC1155Balance(*query.Contract, *query.Holder, query.TokenId, options)
+	if err != nil {
+		return err
+	}
+
+	reply.SetInt64(0)
+	if amount, ok := bal[query.Block]; ok {
+		reply.Set(amount)
+	}
+	return nil
+}
+
+func (r *TokenRPCAPIs) GetERC1155TokenHoldersAtBlock(req *http.Request, query *ERC1155TokenQuery, reply *[]types.Address) error {
+	if query.Contract == nil {
+		return errors.New("no token contract provided")
+	}
+	if query.TokenId == nil {
+		return errors.New("no token ID provided")
+	}
+	if query.Block == 0 {
+		return errors.New("no block given")
+	}
+	if err := checkFrozen(r.db, *query.Contract, query.Block); err != nil {
+		return err
+	}
+	if query.Options == nil {
+		query.Options = &types.TokenQueryOptions{}
+	}
+	query.Options.SetDefaults()
+
+	holders, err := r.db.GetAllERC1155TokenHolders(*query.Contract, query.TokenId, query.Block, query.Options)
+	if err != nil {
+		return err
+	}
+
+	*reply = holders
+	return nil
+}
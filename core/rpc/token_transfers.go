@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"quorumengineering/quorum-report/core/filter/token"
+	"quorumengineering/quorum-report/types"
+)
+
+// transferEventSignature is the Transfer event of both ERC20 and ERC721,
+// which differ only in whether the last parameter is indexed
+const transferEventSignature = "Transfer(address,address,uint256)"
+
+// GetTokenTransfers lists the ERC20 and ERC721 transfers of a token contract,
+// decoded from its Transfer events, newest first. If a holder is given, only
+// the transfers from or to the holder are listed.
+func (r *RPCAPIs) GetTokenTransfers(req *http.Request, args *TokenTransfersArgs, reply *TokenTransfersResp) error {
+	if args.Contract == nil {
+		return errors.New("no token contract provided")
+	}
+	if args.Options == nil {
+		args.Options = &types.QueryOptions{}
+	}
+	args.Options.SetDefaults()
+	if _, err := args.Options.After(); err != nil {
+		return err
+	}
+	endBlockNumber, err := r.snapshots.EndBlockNumber(args.Options.SnapshotId, *args.Contract, args.Options.EndBlockNumber)
+	if err != nil {
+		return err
+	}
+	args.Options.EndBlockNumber = endBlockNumber
+
+	query := &types.EventTopicQuery{Address: args.Contract, EventSignature: transferEventSignature}
+	if err := query.Resolve(); err != nil {
+		return err
+	}
+	var events []*types.Event
+	if args.Holder == nil {
+		if events, err = r.db.GetEventsByTopics(query, args.Options); err != nil {
+			return err
+		}
+	} else if events, err = r.holderTransferEvents(query.Topics[0], *args.Contract, *args.Holder, args.Options); err != nil {
+		return err
+	}
+
+	timestamps := newBlockTimestamps(r.db)
+	transfers := []*types.TokenTransfer{}
+	for _, e := range events {
+		for _, transfer := range token.TokenTransfers(e) {
+			transfer.Timestamp = timestamps.lookup(e.BlockNumber, e.Timestamp)
+			transfers = append(transfers, transfer)
+		}
+	}
+	*reply = TokenTransfersResp{
+		Transfers:  transfers,
+		Options:    args.Options,
+		NextCursor: eventsCursor(events, args.Options),
+	}
+	return nil
+}
+
+// holderTransferEvents returns the page of Transfer events from or to the
+// holder. The events from and to the holder are read separately, each up to
+// the end of the page, and merged, so the page is the same as if they were
+// read together.
+func (r *RPCAPIs) holderTransferEvents(topic0 *types.Hash, contract types.Address, holder types.Address, options *types.QueryOptions) ([]*types.Event, error) {
+	holderTopic := types.NewHash(string(holder))
+	merged := options
+	if options.PageNumber != 0 {
+		copied := *options
+		copied.PageSize = (options.PageNumber + 1) * options.PageSize
+		copied.PageNumber = 0
+		merged = &copied
+	}
+
+	type position struct {
+		block uint64
+		index uint64
+	}
+	seen := make(map[position]bool)
+	var events []*types.Event
+	for _, topics := range [][]*types.Hash{{topic0, &holderTopic}, {topic0, nil, &holderTopic}} {
+		query := &types.EventTopicQuery{Address: &contract, Topics: topics}
+		found, err := r.db.GetEventsByTopics(query, merged)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range found {
+			// transfers from the holder to themselves are found twice
+			if !seen[position{e.BlockNumber, e.Index}] {
+				seen[position{e.BlockNumber, e.Index}] = true
+				events = append(events, e)
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].BlockNumber != events[j].BlockNumber {
+			return events[i].BlockNumber > events[j].BlockNumber
+		}
+		return events[i].Index < events[j].Index
+	})
+
+	start := options.PageNumber * options.PageSize
+	if start > len(events) {
+		return nil, nil
+	}
+	end := start + options.PageSize
+	if end > len(events) {
+		end = len(events)
+	}
+	return events[start:end], nil
+}
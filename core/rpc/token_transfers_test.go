@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestGetTokenTransfers(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+	assert.Nil(t, db.AddAddresses([]types.Address{addr}))
+
+	query := &types.EventTopicQuery{EventSignature: transferEventSignature}
+	assert.Nil(t, query.Resolve())
+	transferTopic := *query.Topics[0]
+	alice := types.NewAddress("0x0000000000000000000000000000000000000001")
+	bob := types.NewAddress("0x0000000000000000000000000000000000000002")
+	carol := types.NewAddress("0x0000000000000000000000000000000000000003")
+	transfers := [][]types.Address{{alice, bob}, {bob, carol}, {carol, alice}, {bob, bob}}
+	for i, transfer := range transfers {
+		number := uint64(i) + 1
+		tx := &types.Transaction{Hash: types.NewHash(fmt.Sprintf("0x%x", number)), BlockNumber: number, Timestamp: 1000 + number}
+		tx.Events = []*types.Event{
+			{
+				Address:         addr,
+				BlockNumber:     number,
+				TransactionHash: tx.Hash,
+				Topics:          []types.Hash{transferTopic, types.NewHash(string(transfer[0])), types.NewHash(string(transfer[1]))},
+				Data:            types.NewHexData(fmt.Sprintf("%064x", number*100)),
+				Timestamp:       tx.Timestamp,
+			},
+			// not a transfer
+			{Address: addr, BlockNumber: number, Index: 1, TransactionHash: tx.Hash, Topics: []types.Hash{types.NewHash("0x01")}},
+		}
+		block := &types.Block{Number: number, Transactions: []types.Hash{tx.Hash}}
+		assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx}))
+		assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+		assert.Nil(t, db.IndexBlocks([]types.Address{addr}, []*types.Block{block}))
+	}
+
+	var resp TokenTransfersResp
+	assert.Nil(t, apis.GetTokenTransfers(dummyReq, &TokenTransfersArgs{Contract: &addr}, &resp))
+	assert.Len(t, resp.Transfers, 4)
+	assert.Equal(t, types.ERC20Standard, resp.Transfers[0].Standard)
+	assert.Equal(t, bob, resp.Transfers[0].From)
+	assert.Equal(t, bob, resp.Transfers[0].To)
+	assert.Equal(t, big.NewInt(400), resp.Transfers[0].Amount)
+	assert.Nil(t, resp.Transfers[0].TokenId)
+	assert.EqualValues(t, 4, resp.Transfers[0].BlockNumber)
+	assert.Equal(t, types.NewHash("0x4"), resp.Transfers[0].TransactionHash)
+	assert.EqualValues(t, 1004, resp.Transfers[0].Timestamp)
+
+	// the transfers from and to a holder, paged together, and a transfer to
+	// themselves listed once
+	args := &TokenTransfersArgs{Contract: &addr, Holder: &bob, Options: &types.QueryOptions{PageSize: 2}}
+	assert.Nil(t, apis.GetTokenTransfers(dummyReq, args, &resp))
+	assert.Len(t, resp.Transfers, 2)
+	assert.EqualValues(t, 4, resp.Transfers[0].BlockNumber)
+	assert.EqualValues(t, 2, resp.Transfers[1].BlockNumber)
+	assert.Equal(t, types.NewCursor(2, 0), resp.NextCursor)
+
+	args.Options.PageNumber = 1
+	assert.Nil(t, apis.GetTokenTransfers(dummyReq, args, &resp))
+	assert.Len(t, resp.Transfers, 1)
+	assert.EqualValues(t, 1, resp.Transfers[0].BlockNumber)
+	assert.Equal(t, "", resp.NextCursor)
+
+	args.Options = &types.QueryOptions{PageSize: 2, Cursor: types.NewCursor(2, 0)}
+	assert.Nil(t, apis.GetTokenTransfers(dummyReq, args, &resp))
+	assert.Len(t, resp.Transfers, 1)
+	assert.Equal(t, alice, resp.Transfers[0].From)
+
+	err := apis.GetTokenTransfers(dummyReq, &TokenTransfersArgs{Holder: &bob}, &resp)
+	assert.EqualError(t, err, "no token contract provided")
+}
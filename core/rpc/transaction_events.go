@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"fmt"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// DefaultEventsPerTransaction and MaxEventsPerTransaction bound how many
+	// events are returned with each transaction of a list
+	DefaultEventsPerTransaction = 10
+	MaxEventsPerTransaction     = 100
+)
+
+// transactionEvents fetches and decodes the events of the transactions, if
+// they are asked for, in a single query rather than one per transaction. Only
+// events from registered contracts are indexed, so only those are returned.
+func (r *RPCAPIs) transactionEvents(hashes []types.Hash, args *IncludeEventsArgs) (map[types.Hash][]*types.ParsedEvent, error) {
+	if !args.IncludeEvents {
+		return nil, nil
+	}
+	limit := args.EventsPerTransaction
+	if limit == 0 {
+		limit = DefaultEventsPerTransaction
+	}
+	if limit < 0 || limit > MaxEventsPerTransaction {
+		return nil, fmt.Errorf("events per transaction must be between 1 and %d", MaxEventsPerTransaction)
+	}
+
+	events, err := r.db.GetEventsForTransactions(hashes, nil, limit)
+	if err != nil {
+		return nil, err
+	}
+	abis := make(map[types.Address]string)
+	timestamps := newBlockTimestamps(r.db)
+	parsed := make(map[types.Hash][]*types.ParsedEvent, len(events))
+	for hash, txEvents := range events {
+		parsedEvents := make([]*types.ParsedEvent, len(txEvents))
+		for i, e := range txEvents {
+			contractABI, ok := abis[e.Address]
+			if !ok {
+				if contractABI, err = r.db.GetContractABI(e.Address); err != nil {
+					return nil, err
+				}
+				abis[e.Address] = contractABI
+			}
+			parsedEvents[i] = &types.ParsedEvent{RawEvent: e}
+			parsedEvents[i].SetTimestamp(timestamps.lookup(e.BlockNumber, e.Timestamp))
+			if contractABI != "" {
+				if err := parsedEvents[i].ParseEvent(contractABI); err != nil {
+					return nil, err
+				}
+			}
+		}
+		parsed[hash] = parsedEvents
+	}
+	return parsed, nil
+}
+
+// eventsByHex keys the events of each transaction by its hex hash, as it is
+// written elsewhere in responses
+func eventsByHex(events map[types.Hash][]*types.ParsedEvent) map[string][]*types.ParsedEvent {
+	if events == nil {
+		return nil
+	}
+	byHex := make(map[string][]*types.ParsedEvent, len(events))
+	for hash, txEvents := range events {
+		byHex[hash.Hex()] = txEvents
+	}
+	return byHex
+}
@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestTransactionsWithEvents(t *testing.T) {
+	db := memory.NewMemoryDB()
+	apis := NewRPCAPIs(db, NewDefaultContractManager(db))
+
+	// two events from the contract in the private transaction
+	txWithEvents := *tx3
+	txWithEvents.Events = nil
+	for i := 0; i < 2; i++ {
+		event := *tx3.Events[0]
+		event.Index = uint64(i)
+		event.BlockNumber = 1
+		event.TransactionHash = tx3.Hash
+		txWithEvents.Events = append(txWithEvents.Events, &event)
+	}
+	assert.Nil(t, db.AddAddresses([]types.Address{addr}))
+	assert.Nil(t, db.AddTemplate("simple", validABI, ""))
+	assert.Nil(t, db.AssignTemplate(addr, "simple"))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, &txWithEvents}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{addr}, []*types.Block{block}))
+
+	// not returned unless asked for
+	var resp TransactionsResp
+	assert.Nil(t, apis.GetAllTransactionsToAddress(dummyReq, &TransactionsArgs{Address: &addr}, &resp))
+	assert.Len(t, resp.Transactions, 2)
+	assert.Nil(t, resp.Events)
+
+	args := &TransactionsArgs{Address: &addr, IncludeEventsArgs: IncludeEventsArgs{IncludeEvents: true, EventsPerTransaction: 1}}
+	assert.Nil(t, apis.GetAllTransactionsToAddress(dummyReq, args, &resp))
+	assert.Len(t, resp.Events, 1)
+	events := resp.Events[tx3.Hash.Hex()]
+	assert.Len(t, events, 1)
+	assert.EqualValues(t, 0, events[0].RawEvent.Index)
+	assert.Equal(t, "event valueSet(uint256 _value)", events[0].Sig)
+	assert.Equal(t, big.NewInt(1000), events[0].ParsedData["_value"])
+
+	args.EventsPerTransaction = MaxEventsPerTransaction + 1
+	err := apis.GetAllTransactionsToAddress(dummyReq, args, &resp)
+	assert.EqualError(t, err, "events per transaction must be between 1 and 100")
+
+	// inlined in transaction summaries
+	var summaries TransactionSummariesResp
+	rangeArgs := &BlockRangeWithOptions{From: 1, To: 1, IncludeEventsArgs: IncludeEventsArgs{IncludeEvents: true}}
+	assert.Nil(t, apis.GetTransactionsForBlockRange(dummyReq, rangeArgs, &summaries))
+	assert.Len(t, summaries.Transactions, 3)
+	assert.Empty(t, summaries.Transactions[0].Events)
+	assert.Empty(t, summaries.Transactions[1].Events)
+	assert.Len(t, summaries.Transactions[2].Events, 2)
+}
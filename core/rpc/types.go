@@ -1,44 +1,336 @@
 package rpc
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"math/big"
 
+	"quorumengineering/quorum-report/core/pending"
+	"quorumengineering/quorum-report/core/storageparsing"
 	"quorumengineering/quorum-report/types"
 )
 
-var ErrNoAddress = errors.New("address not provided")
+var (
+	ErrNoAddress                  = errors.New("address not provided")
+	ErrAnomalyDetectionNotEnabled = errors.New("anomaly detection not enabled")
+	ErrContractIndexingDisabled   = errors.New("contracts can't be registered with the headers profile")
+	ErrBackfillNotEnabled         = errors.New("backfill not enabled")
+	ErrExportNotEnabled           = errors.New("export not enabled")
+	ErrIntegrityNotEnabled        = errors.New("integrity verification not enabled")
+	ErrLayoutInferenceNotEnabled  = errors.New("storage layout inference not enabled")
+	ErrCodeMatchNotEnabled        = errors.New("template assignment by code not enabled")
+	ErrIngestionControlNotEnabled = errors.New("ingestion can't be paused in this mode")
+	ErrSubscriptionsNotRunning    = errors.New("websocket subscriptions are not running")
+	ErrNamingNotEnabled           = errors.New("naming registry not enabled")
+	ErrNameNotFound               = errors.New("name not registered")
+	ErrPendingNotEnabled          = errors.New("pending transaction monitoring not enabled")
+	ErrHighAvailabilityNotEnabled = errors.New("high availability not enabled")
+	ErrScreeningNotEnabled        = errors.New("address screening not enabled")
+	ErrStandby                    = errors.New("this instance is a standby, send changes to the leader")
+	ErrInvalidBlockRange          = errors.New("block range must not end before it starts")
+)
+
+// AnomalyReporter provides the current contract activity anomalies
+type AnomalyReporter interface {
+	Anomalies() []*types.Anomaly
+}
+
+// RuleReloader applies the token rules stored in the database to the
+// contracts created from then on
+type RuleReloader interface {
+	ReloadTokenRules() error
+}
+
+// WebhookNotifier sends events to the registered webhooks
+type WebhookNotifier interface {
+	RemoveWebhook(id string)
+}
+
+// NameDirectory provides the names set in the naming registry
+type NameDirectory interface {
+	Resolve(name string) (types.Address, bool)
+	Names(address types.Address) []string
+	All() []*types.RegisteredName
+}
+
+// AddressScreener checks addresses against deny lists, such as of sanctioned
+// addresses
+type AddressScreener interface {
+	Screen(addresses []types.Address) ([]*types.ScreeningMatch, error)
+}
+
+// Leadership reports whether the instance is the one of several sharing the
+// database that writes to it
+type Leadership interface {
+	IsLeader() bool
+	Status() *types.HighAvailabilityStatus
+}
+
+// PendingMonitor provides the transactions to registered contracts waiting in
+// the node's transaction pool
+type PendingMonitor interface {
+	Pending(address types.Address) []*types.PendingTransaction
+	AddListener(listener pending.Listener)
+}
+
+// Backfiller re-processes ranges of blocks as background jobs
+type Backfiller interface {
+	Backfill(from, to uint64) (string, error)
+	Retry(id string) error
+	GetJobs() []*types.Job
+	GetJob(id string) (*types.Job, error)
+}
+
+// Exporter writes the data of contracts to files as background jobs
+type Exporter interface {
+	Export(request *types.ExportRequest) (string, error)
+	Retry(id string) error
+	GetJobs() []*types.Job
+	GetJob(id string) (*types.Job, error)
+}
+
+// IntegrityVerifier verifies the checksums of stored documents as background
+// jobs
+type IntegrityVerifier interface {
+	Verify(from, to uint64) (string, error)
+	Retry(id string) error
+	GetJobs() []*types.Job
+	GetJob(id string) (*types.Job, error)
+	GetReport(id string) (*types.IntegrityReport, error)
+}
+
+// LayoutInferrer infers the storage layouts of contracts without one as
+// background jobs
+type LayoutInferrer interface {
+	Infer(address types.Address) (string, error)
+	Retry(id string) error
+	GetJobs() []*types.Job
+	GetJob(id string) (*types.Job, error)
+	GetProposal(id string) (*types.LayoutProposal, error)
+	Accepted(id string) error
+}
+
+// TemplateMatcher assigns a template to the contracts with matching bytecode
+// as background jobs
+type TemplateMatcher interface {
+	Assign(request *types.CodeMatchRequest) (string, error)
+	Retry(id string) error
+	GetJobs() []*types.Job
+	GetJob(id string) (*types.Job, error)
+}
+
+// HealthChecker reports the status of the service and its components
+type HealthChecker interface {
+	Health() *types.HealthReport
+}
+
+// IngestionController pauses and resumes syncing and filtering new blocks,
+// and reports and limits what ingesting each contract costs
+type IngestionController interface {
+	PauseIngestion(ctx context.Context) error
+	ResumeIngestion()
+	ContractCosts() ([]*types.ContractCost, error)
+	ThrottleContract(address types.Address, throttled bool) error
+	RefilterContract(ctx context.Context, address types.Address, from uint64) error
+}
 
 //Inputs
 
 type NullArgs struct{}
 
+type JournalArgs struct {
+	types.JournalQuery
+	Options *types.PageOptions
+}
+
+type PendingActivityArgs struct {
+	// all registered contracts if not given
+	Address *types.Address
+}
+
+type ScreenAddressesArgs struct {
+	Addresses []types.Address
+}
+
+type BlockRangeArgs struct {
+	From uint64
+	To   uint64
+}
+
+type DeleteBlockRangeArgs struct {
+	From uint64
+	To   uint64
+	// count what would be deleted, without deleting it
+	DryRun bool
+}
+
 type AddressWithOptions struct {
 	Address *types.Address
 	Options *types.QueryOptions
 }
 
+// EventsByTopicsArgs selects events by topic0, given directly or as the event
+// signature, and optionally topic1 to topic3, from one contract or, if no
+// address is given, from all registered contracts
+type EventsByTopicsArgs struct {
+	Address        *types.Address
+	EventSignature string
+	Topics         []*types.Hash
+	Options        *types.QueryOptions
+}
+
+// EventsBySeverityArgs selects the events classified with the severity, one
+// of info, warning or critical, from one contract or, if no address is
+// given, from all registered contracts
+type EventsBySeverityArgs struct {
+	Address  *types.Address
+	Severity string
+	Options  *types.QueryOptions
+}
+
+// IncludeEventsArgs asks for the decoded events of each listed transaction to
+// be returned with it, up to EventsPerTransaction, which defaults to
+// DefaultEventsPerTransaction
+type IncludeEventsArgs struct {
+	IncludeEvents        bool
+	EventsPerTransaction int
+}
+
+type TransactionsArgs struct {
+	Address *types.Address
+	Options *types.QueryOptions
+	IncludeEventsArgs
+}
+
 type AddressWithData struct {
 	Address *types.Address
 	Data    string
 }
 
+// StorageLayoutArgs is the storage layout output of solc for a contract.
+// Contract names the contract the layout is for if the output has several.
+type StorageLayoutArgs struct {
+	Address  *types.Address
+	Layout   string
+	Contract string
+}
+
 type TemplateArgs struct {
 	Name          string
 	Abi           string
 	StorageLayout string
 }
 
+type AddressWithEnrichment struct {
+	Address *types.Address
+	Mapping types.EnrichmentMapping
+}
+
+type AddressWithSeverityRules struct {
+	Address *types.Address
+	Rules   types.SeverityRules
+}
+
 type AddressWithOptionalBlock struct {
 	Address     *types.Address
 	BlockNumber *uint64
 }
 
+// StorageArgs selects the storage of a contract at a block, by default the
+// last block it has been indexed at. The slots can be narrowed down to those
+// starting with a hex prefix, and those holding the value of a variable of the
+// contract's storage layout, looking up mappings by their MappingKeys as with
+// GetStorageHistory. Options return a page of the slots, in slot order.
+type StorageArgs struct {
+	Address     *types.Address
+	BlockNumber *uint64
+	SlotPrefix  string
+	Variable    string
+	MappingKeys storageparsing.MappingKeys
+	Options     *types.PageOptions // only the page size and number are used
+}
+
+// StoragePage is the storage of a contract at a block, or the page of it
+// asked for, with how many slots there are in all pages
+type StoragePage struct {
+	types.StorageResult
+	Total uint64
+}
+
+type DeleteAddressArgs struct {
+	Address *types.Address
+	// also delete the contract's events, storage, tokens and counterparties
+	Purge bool
+}
+
+// UnmarshalJSON also accepts a bare address, as deleteAddress took before it
+// could purge, which deletes the address without purging its data
+func (args *DeleteAddressArgs) UnmarshalJSON(input []byte) error {
+	if trimmed := bytes.TrimSpace(input); len(trimmed) > 0 && trimmed[0] == '"' {
+		var address types.Address
+		if err := json.Unmarshal(trimmed, &address); err != nil {
+			return err
+		}
+		*args = DeleteAddressArgs{Address: &address}
+		return nil
+	}
+	type plain DeleteAddressArgs
+	return json.Unmarshal(input, (*plain)(args))
+}
+
+type CounterpartiesArgs struct {
+	Address *types.Address
+	Options *types.CounterpartyQueryOptions
+}
+
+type AddressWithBlockNumbers struct {
+	Address   *types.Address
+	FromBlock uint64
+	ToBlock   uint64
+}
+
 type AddressWithBlockRange struct {
 	Address *types.Address
 	Options *types.PageOptions
 }
 
+type StorageHistoryArgs struct {
+	Address     *types.Address
+	Options     *types.PageOptions
+	MappingKeys storageparsing.MappingKeys
+}
+
+type DecodeLogsArgs struct {
+	Logs []*types.Event
+}
+
+type StorageSearchArgs struct {
+	Address  *types.Address
+	Variable string
+	// one of eq, gt, gte, lt or lte, defaulting to eq
+	Operator string
+	Value    string
+	Options  *types.PageOptions
+}
+
+const (
+	// WeightByBlocks weighs each value by the number of blocks it held for
+	WeightByBlocks = "blocks"
+	// WeightBySeconds weighs each value by the seconds it held for, from the
+	// timestamps of the blocks it changed at
+	WeightBySeconds = "seconds"
+)
+
+type StorageAverageArgs struct {
+	Address  *types.Address
+	Variable string
+	// blocks or seconds, defaulting to blocks
+	WeightBy string
+	Options  *types.PageOptions
+}
+
 type ERC20TokenQuery struct {
 	Contract *types.Address
 	Holder   *types.Address
@@ -46,6 +338,26 @@ type ERC20TokenQuery struct {
 	Options  *types.TokenQueryOptions
 }
 
+type ERC20TokenHoldersQuery struct {
+	Contract *types.Address
+	Block    uint64
+	Options  *types.QueryOptions // only the page size and number are used
+}
+
+type ERC20AllowanceQuery struct {
+	Contract *types.Address
+	Owner    *types.Address
+	Spender  *types.Address
+	Options  *types.TokenQueryOptions
+}
+
+type ERC20AllowancesQuery struct {
+	Contract *types.Address
+	Owner    *types.Address
+	Block    uint64              // the current allowances if 0
+	Options  *types.QueryOptions // only the page size and number are used
+}
+
 type ERC721TokenQuery struct {
 	Contract *types.Address
 	Holder   *types.Address
@@ -54,20 +366,196 @@ type ERC721TokenQuery struct {
 	Options  *types.TokenQueryOptions
 }
 
+type ERC1155TokenQuery struct {
+	Contract *types.Address
+	Holder   *types.Address
+	TokenId  *big.Int
+	Block    uint64
+	Options  *types.TokenQueryOptions
+}
+
+type BlockRangeWithOptions struct {
+	From    uint64
+	To      uint64
+	Options *types.PageOptions // only the page size and number are used
+	IncludeEventsArgs
+}
+
+// TimeRangeWithOptions is an inclusive range of block timestamps
+type TimeRangeWithOptions struct {
+	From    uint64
+	To      uint64
+	Options *types.PageOptions // only the page size and number are used
+}
+
+// TimeRange is an inclusive range of block timestamps
+type TimeRange struct {
+	From uint64
+	To   uint64
+}
+
+// SearchArgs looks up a block number, a block or transaction hash, a contract
+// address or a registered name, returning up to Limit results, which defaults
+// to DefaultSearchResults
+type SearchArgs struct {
+	Term  string
+	Limit int
+}
+
+type SnapshotArgs struct {
+	TTL uint64 // seconds
+}
+
+// ContractCostsArgs ranks contracts by SortBy, one of types.ProcessingTimeCost
+// (the default), types.NodeCallsCost or types.DocumentsCost, returning the
+// top Limit contracts, or all of them if Limit is 0
+type ContractCostsArgs struct {
+	SortBy string
+	Limit  int
+}
+
+type ThrottleContractArgs struct {
+	Address   *types.Address
+	Throttled bool
+}
+
+// RefilterContractArgs filters the blocks of Address again from FromBlock, or
+// from the first block if it is 0
+type RefilterContractArgs struct {
+	Address   *types.Address
+	FromBlock uint64
+}
+
 //Outputs
 
+type SnapshotResp struct {
+	Id          string `json:"id"`
+	BlockNumber uint64 `json:"blockNumber"`
+	ExpiresAt   int64  `json:"expiresAt"`
+}
+
+type AddWebhookResp struct {
+	Id string `json:"id"`
+	// the generated secret, if none was given, which can't be fetched again
+	Secret string `json:"secret,omitempty"`
+}
+
+type BlockSummary struct {
+	Number           uint64     `json:"number"`
+	Hash             types.Hash `json:"hash"`
+	ParentHash       types.Hash `json:"parentHash"`
+	Timestamp        uint64     `json:"timestamp"`
+	TimestampISO     string     `json:"timestampISO"`
+	TransactionCount int        `json:"transactionCount"`
+}
+
+type TransactionSummary struct {
+	Hash            types.Hash    `json:"hash"`
+	BlockNumber     uint64        `json:"blockNumber"`
+	Index           uint64        `json:"index"`
+	From            types.Address `json:"from"`
+	To              types.Address `json:"to"`
+	CreatedContract types.Address `json:"createdContract"`
+	Status          bool          `json:"status"`
+	Timestamp       uint64        `json:"timestamp"`
+	TimestampISO    string        `json:"timestampISO"`
+	// only if asked for
+	Events []*types.ParsedEvent `json:"events,omitempty"`
+}
+
+type BlockSummariesResp struct {
+	Blocks  []BlockSummary     `json:"blocks"`
+	Total   uint64             `json:"total"`
+	Options *types.PageOptions `json:"options"`
+}
+
+type TransactionSummariesResp struct {
+	Transactions []TransactionSummary `json:"transactions"`
+	Total        uint64               `json:"total"`
+	Options      *types.PageOptions   `json:"options"`
+}
+
 type TransactionsResp struct {
 	Transactions []types.Hash        `json:"transactions"`
 	Total        uint64              `json:"total"`
 	Options      *types.QueryOptions `json:"options"`
+	// the cursor of the next page, if this page is full
+	NextCursor string `json:"nextCursor,omitempty"`
+	// the events of the listed transactions that have any, keyed by hash,
+	// if asked for
+	Events map[string][]*types.ParsedEvent `json:"events,omitempty"`
+}
+
+type ReplayEventsArgs struct {
+	// either a contract, or the name of a contract group
+	Address *types.Address
+	Group   string
+	// the nextSequence of the previous batch; the replay starts from the
+	// first event if empty
+	FromSequence string
+	BatchSize    int
+}
+
+type TokenTransfersArgs struct {
+	Contract *types.Address
+	// only the transfers from or to the holder, if given
+	Holder  *types.Address
+	Options *types.QueryOptions
+}
+
+type TokenTransfersResp struct {
+	Transfers []*types.TokenTransfer `json:"transfers"`
+	Options   *types.QueryOptions    `json:"options"`
+	// the cursor of the next page, if this page is full
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type ReplayEventsResp struct {
+	Events []*types.ParsedEvent `json:"events"`
+	// the sequence to resume the replay from, after the last event returned
+	NextSequence string `json:"nextSequence"`
+	// the block the contracts have all been filtered up to, which the replay
+	// doesn't go past
+	FilteredTo uint64 `json:"filteredTo"`
+	// whether all events filtered so far have been replayed
+	CaughtUp bool `json:"caughtUp"`
 }
 
 type EventsResp struct {
 	Events  []*types.ParsedEvent `json:"events"`
 	Total   uint64               `json:"total"`
 	Options *types.QueryOptions  `json:"options"`
+	// the cursor of the next page, if this page is full
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type AddressTotals struct {
+	Transactions         uint64              `json:"transactions"`
+	InternalTransactions uint64              `json:"internalTransactions"`
+	Events               uint64              `json:"events"`
+	Options              *types.QueryOptions `json:"options"`
 }
 
 type RangeQueryResult struct {
 	Ranges []types.RangeResult `json:"ranges"`
 }
+
+// BlockRange is a range of blocks, inclusive of both ends
+type BlockRange struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+type StorageSearchResp struct {
+	Ranges  []*BlockRange      `json:"ranges"`
+	Options *types.PageOptions `json:"options"`
+}
+
+type StorageAverageResp struct {
+	// decimal, to up to 18 places
+	Average string `json:"average"`
+	// the blocks or seconds the average is over
+	Weight   uint64             `json:"weight"`
+	WeightBy string             `json:"weightBy"`
+	Options  *types.PageOptions `json:"options"`
+}
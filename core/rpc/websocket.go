@@ -0,0 +1,357 @@
+package rpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"quorumengineering/quorum-report/database/scoped"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// websocket JSON-RPC methods
+const (
+	SubscribeMethod    = "reporting_subscribe"
+	UnsubscribeMethod  = "reporting_unsubscribe"
+	NotificationMethod = "reporting_subscription"
+)
+
+const wsWriteTimeout = 10 * time.Second
+
+// wsQueueSize is the most notifications waiting to be written to a subscriber
+// before further ones are dropped
+const wsQueueSize = 1000
+
+// JSON-RPC error codes
+const (
+	errCodeParse          = -32700
+	errCodeMethodNotFound = -32601
+	errCodeInvalidParams  = -32602
+)
+
+type wsRequest struct {
+	Version string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type wsResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *wsError        `json:"error,omitempty"`
+	// run once the response has been written
+	written func()
+}
+
+type wsError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type wsNotification struct {
+	Version string               `json:"jsonrpc"`
+	Method  string               `json:"method"`
+	Params  wsSubscriptionResult `json:"params"`
+}
+
+type wsSubscriptionResult struct {
+	Subscription string      `json:"subscription"`
+	Result       interface{} `json:"result"`
+	// the token to resume the subscription after this notification
+	ResumeToken string `json:"resumeToken,omitempty"`
+}
+
+type queuedNotification struct {
+	blockNumber  uint64
+	notification wsNotification
+}
+
+type wsConnection struct {
+	id          string
+	conn        *websocket.Conn
+	connectedAt time.Time
+	writeMux    sync.Mutex
+	closeOnce   sync.Once
+	closed      chan struct{}
+	// the contracts the subscriber's API key is restricted to, nil if it
+	// isn't
+	scope *scoped.Database
+
+	// notifications are queued so a slow subscriber doesn't hold up the
+	// others, and written in order by writeLoop
+	queue       []*queuedNotification
+	queueMux    sync.Mutex
+	queueSignal chan struct{}
+	sent        uint64
+	dropped     uint64
+}
+
+func newWsConnection(id string, conn *websocket.Conn) *wsConnection {
+	c := &wsConnection{
+		id:          id,
+		conn:        conn,
+		connectedAt: time.Now(),
+		closed:      make(chan struct{}),
+		queueSignal: make(chan struct{}, 1),
+	}
+	go c.writeLoop()
+	return c
+}
+
+func (c *wsConnection) write(msg interface{}) error {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	if err := c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	return c.conn.WriteJSON(msg)
+}
+
+// Notify queues a subscription notification for the block. It is dropped if
+// the subscriber already has a full queue.
+func (c *wsConnection) Notify(subscriptionID string, blockNumber uint64, resumeToken string, result interface{}) {
+	c.queueMux.Lock()
+	if len(c.queue) >= wsQueueSize {
+		c.dropped++
+		c.queueMux.Unlock()
+		log.Debug("Websocket subscriber queue full, dropping notification", "subscriber", c.id, "subscription", subscriptionID)
+		return
+	}
+	c.queue = append(c.queue, &queuedNotification{
+		blockNumber: blockNumber,
+		notification: wsNotification{
+			Version: "2.0",
+			Method:  NotificationMethod,
+			Params:  wsSubscriptionResult{Subscription: subscriptionID, Result: result, ResumeToken: resumeToken},
+		},
+	})
+	c.queueMux.Unlock()
+
+	select {
+	case c.queueSignal <- struct{}{}:
+	default:
+	}
+}
+
+// writeLoop writes the queued notifications until the connection is closed. A
+// client that can't be written to is disconnected, which also removes its
+// subscriptions.
+func (c *wsConnection) writeLoop() {
+	for {
+		select {
+		case <-c.queueSignal:
+		case <-c.closed:
+			return
+		}
+		for {
+			c.queueMux.Lock()
+			if len(c.queue) == 0 {
+				c.queueMux.Unlock()
+				break
+			}
+			next := c.queue[0]
+			c.queueMux.Unlock()
+
+			if err := c.write(next.notification); err != nil {
+				log.Warn("Unable to notify websocket subscriber, closing connection", "subscriber", c.id, "err", err)
+				c.Close()
+				return
+			}
+
+			c.queueMux.Lock()
+			c.queue[0] = nil
+			c.queue = c.queue[1:]
+			c.sent++
+			c.queueMux.Unlock()
+		}
+	}
+}
+
+// stats reports the subscriber's counters, with the lag measured against the
+// last block subscribers were notified of.
+func (c *wsConnection) stats(lastNotified uint64) *types.SubscriberStats {
+	c.queueMux.Lock()
+	defer c.queueMux.Unlock()
+	stats := &types.SubscriberStats{
+		ID:            c.id,
+		ConnectedAt:   uint64(c.connectedAt.Unix()),
+		Subscriptions: make(map[string]int),
+		Sent:          c.sent,
+		Dropped:       c.dropped,
+		Queued:        len(c.queue),
+		RemoteAddress: c.conn.RemoteAddr().String(),
+	}
+	if len(c.queue) > 0 && lastNotified > c.queue[0].blockNumber {
+		stats.LagBlocks = lastNotified - c.queue[0].blockNumber
+	}
+	return stats
+}
+
+// scopeTransaction leaves the events of contracts outside of the subscriber's
+// scope out of the transaction.
+func (c *wsConnection) scopeTransaction(tx *types.ParsedTransaction) *types.ParsedTransaction {
+	if c.scope == nil {
+		return tx
+	}
+	scopedTx := *tx
+	scopedTx.ParsedEvents = make([]*types.ParsedEvent, 0, len(tx.ParsedEvents))
+	for _, event := range tx.ParsedEvents {
+		if c.scope.Contains(event.RawEvent.Address) {
+			scopedTx.ParsedEvents = append(scopedTx.ParsedEvents, event)
+		}
+	}
+	if tx.RawTransaction != nil {
+		raw := *tx.RawTransaction
+		raw.Events = make([]*types.Event, 0, len(tx.RawTransaction.Events))
+		for _, event := range tx.RawTransaction.Events {
+			if c.scope.Contains(event.Address) {
+				raw.Events = append(raw.Events, event)
+			}
+		}
+		scopedTx.RawTransaction = &raw
+	}
+	return &scopedTx
+}
+
+func (c *wsConnection) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.conn.Close()
+	})
+}
+
+// newUpgrader returns a websocket upgrader that accepts the same origins as
+// the HTTP CORS configuration.
+func newUpgrader(corsList []string) *websocket.Upgrader {
+	origins := make(map[string]bool)
+	for _, origin := range corsList {
+		origins[origin] = true
+	}
+	return &websocket.Upgrader{
+		CheckOrigin: func(req *http.Request) bool {
+			origin := req.Header.Get("Origin")
+			if origin == "" || origins["*"] || origins[origin] {
+				return true
+			}
+			// same origin requests are always allowed
+			u, err := url.Parse(origin)
+			return err == nil && u.Host == req.Host
+		},
+	}
+}
+
+func (r *RPCService) serveWebsocket(w http.ResponseWriter, req *http.Request) {
+	// aggregate only keys can't subscribe to individual blocks or transactions
+	if err := r.authoriser.Authorise(req, SubscribeMethod); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := r.limiter.Allow(r.authoriser.Client(req), SubscribeMethod); err != nil {
+		writeRateLimited(w, err, http.StatusUnauthorized)
+		return
+	}
+	r.originsMux.RLock()
+	upgrader := r.upgrader
+	r.originsMux.RUnlock()
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		log.Debug("Websocket upgrade failed", "err", err)
+		return
+	}
+
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		log.Warn("Unable to generate websocket subscriber ID", "err", err)
+		conn.Close()
+		return
+	}
+	wsConn := newWsConnection(hex.EncodeToString(idBytes), conn)
+	if scope := r.scope(req); scope != nil {
+		wsConn.scope = scope.db
+	}
+	r.subscriptions.AddConnection(wsConn)
+	r.shutdownWg.Add(1)
+	go func() {
+		defer r.shutdownWg.Done()
+		defer r.subscriptions.RemoveConnection(wsConn)
+		defer wsConn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			resp := r.handleWsRequest(wsConn, data)
+			if err := wsConn.write(resp); err != nil {
+				return
+			}
+			if resp.written != nil {
+				resp.written()
+			}
+		}
+	}()
+}
+
+func (r *RPCService) handleWsRequest(conn *wsConnection, data []byte) *wsResponse {
+	var req wsRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return &wsResponse{Version: "2.0", Error: &wsError{Code: errCodeParse, Message: err.Error()}}
+	}
+	resp := &wsResponse{Version: "2.0", ID: req.ID}
+
+	switch req.Method {
+	case SubscribeMethod:
+		var kind, resumeToken string
+		var address types.Address
+		if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &kind) != nil {
+			resp.Error = &wsError{Code: errCodeInvalidParams, Message: ErrUnknownSubscriptionType.Error()}
+			return resp
+		}
+		if len(req.Params) > 1 {
+			if err := json.Unmarshal(req.Params[1], &address); err != nil {
+				resp.Error = &wsError{Code: errCodeInvalidParams, Message: err.Error()}
+				return resp
+			}
+		}
+		if len(req.Params) > 2 && json.Unmarshal(req.Params[2], &resumeToken) != nil {
+			resp.Error = &wsError{Code: errCodeInvalidParams, Message: ErrInvalidResumeToken.Error()}
+			return resp
+		}
+		if conn.scope != nil && !address.IsEmpty() && !conn.scope.Contains(address) {
+			resp.Error = &wsError{Code: errCodeInvalidParams, Message: scoped.ErrContractNotInScope.Error()}
+			return resp
+		}
+		id, err := r.subscriptions.Subscribe(conn, kind, address, resumeToken)
+		if err != nil {
+			resp.Error = &wsError{Code: errCodeInvalidParams, Message: err.Error()}
+			return resp
+		}
+		resp.Result = id
+		// the missed notifications follow the subscription's ID
+		resp.written = func() {
+			r.subscriptions.Release(conn, id)
+		}
+	case UnsubscribeMethod:
+		var id string
+		if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &id) != nil {
+			resp.Error = &wsError{Code: errCodeInvalidParams, Message: ErrSubscriptionNotFound.Error()}
+			return resp
+		}
+		if err := r.subscriptions.Unsubscribe(conn, id); err != nil {
+			resp.Error = &wsError{Code: errCodeInvalidParams, Message: err.Error()}
+			return resp
+		}
+		resp.Result = true
+	default:
+		resp.Error = &wsError{Code: errCodeMethodNotFound, Message: "method " + req.Method + " not found"}
+	}
+	return resp
+}
@@ -0,0 +1,221 @@
+package screening
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Screener checks addresses against a deny list, returning the matches of
+// those on it
+type Screener interface {
+	Name() string
+	Screen([]types.Address) ([]*types.ScreeningMatch, error)
+}
+
+// ListScreener screens addresses against a local list file, which lists an
+// address on each line, optionally followed by a comma and the reason it is
+// listed. Blank lines and lines starting with # are skipped.
+type ListScreener struct {
+	path string
+
+	listed map[types.Address]string
+	mux    sync.RWMutex
+}
+
+func NewListScreener(path string) *ListScreener {
+	return &ListScreener{path: path, listed: make(map[types.Address]string)}
+}
+
+func (s *ListScreener) Name() string {
+	return s.path
+}
+
+// Load reads the list file again, replacing the addresses listed. The list is
+// left as it was if the file can't be read.
+func (s *ListScreener) Load() error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	listed := make(map[types.Address]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		reason := ""
+		if i := strings.Index(entry, ","); i >= 0 {
+			entry, reason = strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		}
+		var address types.Address
+		if err := address.UnmarshalJSON([]byte(`"` + entry + `"`)); err != nil || address.IsEmpty() {
+			return fmt.Errorf("%s:%d: invalid address %q", s.path, line, entry)
+		}
+		listed[address] = reason
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	s.listed = listed
+	s.mux.Unlock()
+	return nil
+}
+
+func (s *ListScreener) Screen(addresses []types.Address) ([]*types.ScreeningMatch, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	var matches []*types.ScreeningMatch
+	for _, address := range addresses {
+		if reason, ok := s.listed[address]; ok {
+			matches = append(matches, &types.ScreeningMatch{Address: address, List: s.path, Reason: reason})
+		}
+	}
+	return matches, nil
+}
+
+// ScreeningRequest is the body POSTed to a screening service
+type ScreeningRequest struct {
+	Addresses []types.Address `json:"addresses"`
+}
+
+// ScreeningResponse is the body a screening service responds with, matching
+// the addresses it flags. Matches that don't name a list are given the URL
+// of the service.
+type ScreeningResponse struct {
+	Matches []*types.ScreeningMatch `json:"matches"`
+}
+
+// cachedVerdict is the match of an address, or nil if it wasn't flagged, and
+// when it is asked for again
+type cachedVerdict struct {
+	match     *types.ScreeningMatch
+	expiresAt time.Time
+}
+
+// ServiceScreener screens addresses with an external screening service. Its
+// verdict on each address is cached, so the service is only asked about
+// addresses it hasn't screened lately.
+type ServiceScreener struct {
+	url     string
+	headers map[string]string
+	ttl     time.Duration
+	client  *http.Client
+
+	cache    map[types.Address]*cachedVerdict
+	cacheMux sync.Mutex
+}
+
+func NewServiceScreener(url string, headers map[string]string, ttl time.Duration) *ServiceScreener {
+	return &ServiceScreener{
+		url:     url,
+		headers: headers,
+		ttl:     ttl,
+		client:  &http.Client{Timeout: requestTimeout},
+		cache:   make(map[types.Address]*cachedVerdict),
+	}
+}
+
+func (s *ServiceScreener) Name() string {
+	return s.url
+}
+
+func (s *ServiceScreener) Screen(addresses []types.Address) ([]*types.ScreeningMatch, error) {
+	now := time.Now()
+	var (
+		matches  []*types.ScreeningMatch
+		uncached []types.Address
+	)
+	s.cacheMux.Lock()
+	for _, address := range addresses {
+		verdict, ok := s.cache[address]
+		if !ok || !now.Before(verdict.expiresAt) {
+			uncached = append(uncached, address)
+		} else if verdict.match != nil {
+			matches = append(matches, verdict.match)
+		}
+	}
+	s.cacheMux.Unlock()
+	if len(uncached) == 0 {
+		return matches, nil
+	}
+
+	flagged, err := s.request(uncached)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheMux.Lock()
+	defer s.cacheMux.Unlock()
+	for _, address := range uncached {
+		match := flagged[address]
+		s.cache[address] = &cachedVerdict{match: match, expiresAt: now.Add(s.ttl)}
+		if match != nil {
+			matches = append(matches, match)
+		}
+	}
+	// verdicts that have run out are dropped, so the cache doesn't grow with
+	// every address ever screened
+	for address, verdict := range s.cache {
+		if !now.Before(verdict.expiresAt) {
+			delete(s.cache, address)
+		}
+	}
+	return matches, nil
+}
+
+// request asks the service about the addresses, returning the matches of
+// those it flags
+func (s *ServiceScreener) request(addresses []types.Address) (map[types.Address]*types.ScreeningMatch, error) {
+	body, err := json.Marshal(&ScreeningRequest{Addresses: addresses})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("screening service responded with status %d", resp.StatusCode)
+	}
+	var response ScreeningResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	flagged := make(map[types.Address]*types.ScreeningMatch, len(response.Matches))
+	for _, match := range response.Matches {
+		if match == nil {
+			return nil, errors.New("screening service responded with an empty match")
+		}
+		if match.List == "" {
+			match.List = s.url
+		}
+		flagged[match.Address] = match
+	}
+	return flagged, nil
+}
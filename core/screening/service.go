@@ -0,0 +1,349 @@
+package screening
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// alertQueueSize is how many alerts can wait to be sent, after which new
+	// alerts are dropped so a slow sink can't hold up screening
+	alertQueueSize = 1000
+	// screenQueueSize is how many batches of indexed blocks can wait to be
+	// screened, after which new batches aren't screened so a slow screening
+	// service can't hold up filtering
+	screenQueueSize = 100
+	// screening a batch is retried with exponential backoff, starting from
+	// initialBackoff and capped at maxBackoff
+	maxScreenAttempts = 5
+	initialBackoff    = time.Second
+	maxBackoff        = time.Minute
+)
+
+type ServiceDB interface {
+	ReadTransaction(types.Hash) (*types.Transaction, error)
+	WriteJournalEntries([]*types.JournalEntry) error
+}
+
+// screenBatch is a batch of indexed blocks, to screen the counterparties of
+// the addresses in
+type screenBatch struct {
+	addresses []types.Address
+	blocks    []*types.Block
+}
+
+// Service screens addresses against the configured deny lists, which are
+// local list files and an external screening service, never flagging the
+// allowed addresses. It screens the counterparties of registered contracts
+// as their blocks are indexed, sending an alert to the sinks for each
+// transaction a flagged counterparty interacts in, and the addresses in
+// query results as they are served.
+//
+// Indexed blocks are screened in the background, retrying failed attempts,
+// and each block gets a journal entry once screened. Blocks that couldn't be
+// screened, and alerts dropped because the sinks fell behind, are recorded as
+// errors of the entries. Batches still queued at shutdown are not screened.
+//
+// List files are reloaded periodically, so they can be updated without a
+// restart.
+type Service struct {
+	db              ServiceDB
+	screeners       []Screener
+	lists           []*ListScreener
+	allowed         map[types.Address]bool
+	sinks           []AlertSink
+	refreshInterval time.Duration
+
+	screens        chan *screenBatch
+	alerts         chan *types.ScreeningAlert
+	maxAttempts    int
+	initialBackoff time.Duration
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewService(db ServiceDB, config *types.ScreeningConfig) *Service {
+	s := &Service{
+		db:              db,
+		allowed:         make(map[types.Address]bool, len(config.Allowed)),
+		sinks:           []AlertSink{&LogSink{}},
+		refreshInterval: time.Duration(config.RefreshInterval) * time.Second,
+		screens:         make(chan *screenBatch, screenQueueSize),
+		alerts:          make(chan *types.ScreeningAlert, alertQueueSize),
+		maxAttempts:     maxScreenAttempts,
+		initialBackoff:  initialBackoff,
+		shutdownChan:    make(chan struct{}),
+	}
+	for _, path := range config.Lists {
+		list := NewListScreener(path)
+		s.lists = append(s.lists, list)
+		s.screeners = append(s.screeners, list)
+	}
+	if config.URL != "" {
+		s.screeners = append(s.screeners, NewServiceScreener(config.URL, config.Headers, time.Duration(config.CacheTTL)*time.Second))
+	}
+	for _, address := range config.Allowed {
+		s.allowed[address] = true
+	}
+	for _, url := range config.Webhooks {
+		s.sinks = append(s.sinks, NewWebhookSink(url))
+	}
+	return s
+}
+
+// Start loads the list files, failing if any can't be read, then reloads
+// them periodically, screens the blocks queued and sends alerts as they are
+// raised
+func (s *Service) Start() error {
+	log.Info("Starting address screening", "lists", len(s.lists), "refresh interval", s.refreshInterval)
+	for _, list := range s.lists {
+		if err := list.Load(); err != nil {
+			return err
+		}
+	}
+
+	s.shutdownWg.Add(3)
+	go func() {
+		defer s.shutdownWg.Done()
+		ticker := time.NewTicker(s.refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.reload()
+			case <-s.shutdownChan:
+				return
+			}
+		}
+	}()
+	go func() {
+		defer s.shutdownWg.Done()
+		for {
+			select {
+			case batch := <-s.screens:
+				s.screenWithRetries(batch)
+			case <-s.shutdownChan:
+				return
+			}
+		}
+	}()
+	go func() {
+		defer s.shutdownWg.Done()
+		for {
+			select {
+			case alert := <-s.alerts:
+				s.send(alert)
+			case <-s.shutdownChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *Service) Stop() {
+	close(s.shutdownChan)
+	s.shutdownWg.Wait()
+	log.Info("Address screening stopped")
+}
+
+// reload reads the list files again, keeping the last list read of any that
+// fail
+func (s *Service) reload() {
+	for _, list := range s.lists {
+		if err := list.Load(); err != nil {
+			log.Warn("Reloading screening list failed", "list", list.Name(), "err", err)
+		}
+	}
+}
+
+// Screen returns the matches of the addresses on any of the lists, by
+// address and then list. An address on several lists has a match for each.
+func (s *Service) Screen(addresses []types.Address) ([]*types.ScreeningMatch, error) {
+	seen := make(map[types.Address]bool, len(addresses))
+	var screened []types.Address
+	for _, address := range addresses {
+		if !seen[address] && !s.allowed[address] {
+			seen[address] = true
+			screened = append(screened, address)
+		}
+	}
+	if len(screened) == 0 {
+		return nil, nil
+	}
+
+	var matches []*types.ScreeningMatch
+	for _, screener := range s.screeners {
+		found, err := screener.Screen(screened)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range found {
+			// a service may flag addresses it wasn't asked about
+			if seen[match.Address] {
+				matches = append(matches, match)
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Address != matches[j].Address {
+			return matches[i].Address < matches[j].Address
+		}
+		return matches[i].List < matches[j].List
+	})
+	return matches, nil
+}
+
+// Notify queues the blocks to have the counterparties of the addresses in
+// them screened, so filtering isn't held up by screening. If the queue is
+// full, the blocks are journaled as not screened.
+func (s *Service) Notify(addresses []types.Address, blocks []*types.Block) error {
+	select {
+	case s.screens <- &screenBatch{addresses: addresses, blocks: blocks}:
+	default:
+		log.Error("Screening queue full, blocks not screened", "start", blocks[0].Number, "end", blocks[len(blocks)-1].Number)
+		s.writeJournal(blocks, time.Now(), nil, []string{"not screened: screening queue full"}, nil)
+	}
+	return nil
+}
+
+// screenWithRetries screens the batch, retrying failed attempts with
+// exponential backoff, and journals the outcome for each of its blocks
+func (s *Service) screenWithRetries(batch *screenBatch) {
+	start, end := batch.blocks[0].Number, batch.blocks[len(batch.blocks)-1].Number
+	started := time.Now()
+	backoff := s.initialBackoff
+	var failures []string
+	for attempt := 1; ; attempt++ {
+		screened, alerts, err := s.screenBlocks(batch.addresses, batch.blocks)
+		if err == nil {
+			dropped := s.raise(alerts)
+			s.writeJournal(batch.blocks, started, screened, failures, dropped)
+			return
+		}
+		failures = append(failures, err.Error())
+		if attempt >= s.maxAttempts {
+			log.Error("Screening blocks failed, blocks not screened", "start", start, "end", end, "attempts", attempt, "err", err)
+			failures = append(failures, fmt.Sprintf("not screened after %d attempts", attempt))
+			s.writeJournal(batch.blocks, started, nil, failures, nil)
+			return
+		}
+		log.Warn("Screening blocks failed, retrying", "start", start, "end", end, "attempt", attempt, "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-s.shutdownChan:
+			log.Warn("Screening stopped, blocks not screened", "start", start, "end", end)
+			return
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// screenBlocks screens the counterparties of the addresses in the blocks,
+// returning how many transactions had counterparties to screen in each
+// block, and an alert for each transaction a flagged counterparty interacts
+// with one of the addresses in
+func (s *Service) screenBlocks(addresses []types.Address, blocks []*types.Block) (map[uint64]int, []*types.ScreeningAlert, error) {
+	type interaction struct {
+		contract types.Address
+		tx       types.Hash
+		block    uint64
+	}
+	interactions := make(map[types.Address][]interaction)
+	var counterparties []types.Address
+	screened := make(map[uint64]int)
+	for _, block := range blocks {
+		for _, txHash := range block.Transactions {
+			tx, err := s.db.ReadTransaction(txHash)
+			if err != nil {
+				return nil, nil, err
+			}
+			found := false
+			for _, address := range addresses {
+				for _, counterparty := range tx.Counterparties(address) {
+					if _, ok := interactions[counterparty]; !ok {
+						counterparties = append(counterparties, counterparty)
+					}
+					interactions[counterparty] = append(interactions[counterparty], interaction{contract: address, tx: tx.Hash, block: block.Number})
+					found = true
+				}
+			}
+			if found {
+				screened[block.Number]++
+			}
+		}
+	}
+	if len(counterparties) == 0 {
+		return screened, nil, nil
+	}
+
+	matches, err := s.Screen(counterparties)
+	if err != nil {
+		return nil, nil, err
+	}
+	var alerts []*types.ScreeningAlert
+	for _, match := range matches {
+		for _, i := range interactions[match.Address] {
+			alerts = append(alerts, &types.ScreeningAlert{Match: match, Contract: i.contract, Transaction: i.tx, BlockNumber: i.block})
+		}
+	}
+	return screened, alerts, nil
+}
+
+// raise queues the alerts to be sent, returning those dropped because the
+// queue is full as errors for the journal entries of their blocks
+func (s *Service) raise(alerts []*types.ScreeningAlert) map[uint64][]string {
+	dropped := make(map[uint64][]string)
+	for _, alert := range alerts {
+		select {
+		case s.alerts <- alert:
+		default:
+			log.Error("Screening alert queue full, dropping alert", "address", alert.Match.Address.Hex(), "tx", alert.Transaction.Hex())
+			dropped[alert.BlockNumber] = append(dropped[alert.BlockNumber], fmt.Sprintf("alert dropped: %v flagged in transaction %v", alert.Match.Address.Hex(), alert.Transaction.Hex()))
+		}
+	}
+	return dropped
+}
+
+// writeJournal records a screen stage entry for each block, with the failed
+// attempts to screen the batch and the alerts dropped for the block as its
+// errors. Failing to write the journal is only logged, as the blocks have
+// been screened.
+func (s *Service) writeJournal(blocks []*types.Block, started time.Time, screened map[uint64]int, failures []string, dropped map[uint64][]string) {
+	finished := time.Now()
+	entries := make([]*types.JournalEntry, 0, len(blocks))
+	for _, block := range blocks {
+		var errs []string
+		if len(failures) > 0 || len(dropped[block.Number]) > 0 {
+			errs = append(append([]string{}, failures...), dropped[block.Number]...)
+		}
+		entries = append(entries, &types.JournalEntry{
+			BlockNumber:  block.Number,
+			Stage:        types.ScreenStage,
+			Timestamp:    uint64(finished.Unix()),
+			Duration:     uint64(finished.Sub(started) / time.Millisecond),
+			Transactions: screened[block.Number],
+			Errors:       errs,
+		})
+	}
+	if err := s.db.WriteJournalEntries(entries); err != nil {
+		log.Warn("Writing screening journal failed", "start", blocks[0].Number, "end", blocks[len(blocks)-1].Number, "err", err)
+	}
+}
+
+func (s *Service) send(alert *types.ScreeningAlert) {
+	for _, sink := range s.sinks {
+		if err := sink.Send(alert); err != nil {
+			log.Warn("Unable to send screening alert", "sink", sink.Name(), "err", err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package screening
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+var (
+	contract   = types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	sanctioned = types.NewAddress("0x0000000000000000000000000000000000000bad")
+	other      = types.NewAddress("0x0000000000000000000000000000000000000002")
+)
+
+func writeList(t *testing.T, dir string, contents string) string {
+	path := filepath.Join(dir, "sanctions.txt")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestListScreener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "screening")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeList(t, dir, "# sanctioned addresses\n\n0x0000000000000000000000000000000000000BAD, OFAC SDN\n0x0000000000000000000000000000000000000003\n")
+	list := NewListScreener(path)
+	assert.Nil(t, list.Load())
+	matches, err := list.Screen([]types.Address{sanctioned, other, types.NewAddress("3")})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.ScreeningMatch{
+		{Address: sanctioned, List: path, Reason: "OFAC SDN"},
+		{Address: types.NewAddress("3"), List: path},
+	}, matches)
+
+	// a list that can't be read leaves the last one read
+	writeList(t, dir, "0xnotanaddress\n")
+	assert.EqualError(t, list.Load(), path+`:1: invalid address "0xnotanaddress"`)
+	matches, err = list.Screen([]types.Address{sanctioned})
+	assert.Nil(t, err)
+	assert.Len(t, matches, 1)
+}
+
+func TestServiceScreener(t *testing.T) {
+	var requests []*ScreeningRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		var request ScreeningRequest
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, &request)
+		var response ScreeningResponse
+		for _, address := range request.Addresses {
+			if address == sanctioned {
+				response.Matches = append(response.Matches, &types.ScreeningMatch{Address: address, Reason: "sanctioned"})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(&response)
+	}))
+	defer server.Close()
+
+	screener := NewServiceScreener(server.URL, map[string]string{"Authorization": "Bearer token"}, time.Hour)
+	matches, err := screener.Screen([]types.Address{sanctioned, other})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.ScreeningMatch{{Address: sanctioned, List: server.URL, Reason: "sanctioned"}}, matches)
+
+	// only addresses without a cached verdict are sent
+	matches, err = screener.Screen([]types.Address{sanctioned, other, contract})
+	assert.Nil(t, err)
+	assert.Len(t, matches, 1)
+	assert.Len(t, requests, 2)
+	assert.Equal(t, []types.Address{contract}, requests[1].Addresses)
+}
+
+func TestService_Notify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "screening")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := writeList(t, dir, sanctioned.String()+",sanctioned\n"+other.String()+"\n")
+
+	db := memory.NewMemoryDB()
+	txs := []*types.Transaction{
+		{Hash: types.NewHash("0x1"), BlockNumber: 1, From: sanctioned, To: contract},
+		{Hash: types.NewHash("0x2"), BlockNumber: 1, From: other, To: contract},
+		// interactions with other contracts aren't screened
+		{Hash: types.NewHash("0x3"), BlockNumber: 1, From: sanctioned, To: types.NewAddress("4")},
+	}
+	assert.Nil(t, db.WriteTransactions(txs))
+	blocks := []*types.Block{{Number: 1, Transactions: []types.Hash{txs[0].Hash, txs[1].Hash, txs[2].Hash}}}
+
+	s := NewService(db, &types.ScreeningConfig{Lists: []string{path}, Allowed: []types.Address{other}, RefreshInterval: 300})
+	sink := &fakeSink{alerts: make(chan *types.ScreeningAlert, 10)}
+	s.sinks = []AlertSink{sink}
+	assert.Nil(t, s.Start())
+	defer s.Stop()
+
+	assert.Nil(t, s.Notify([]types.Address{contract}, blocks))
+	select {
+	case alert := <-sink.alerts:
+		assert.Equal(t, &types.ScreeningAlert{
+			Match:       &types.ScreeningMatch{Address: sanctioned, List: path, Reason: "sanctioned"},
+			Contract:    contract,
+			Transaction: txs[0].Hash,
+			BlockNumber: 1,
+		}, alert)
+	case <-time.After(time.Second):
+		t.Fatal("no alert sent")
+	}
+	select {
+	case alert := <-sink.alerts:
+		t.Fatalf("unexpected alert for %v", alert.Match.Address)
+	case <-time.After(100 * time.Millisecond):
+	}
+	// the block is journaled with the transactions whose counterparties were
+	// screened
+	entries := screeningJournal(t, db)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, 2, entries[0].Transactions)
+	assert.Empty(t, entries[0].Errors)
+
+	// allowed addresses aren't flagged, whichever list they are on
+	matches, err := s.Screen([]types.Address{other, sanctioned, sanctioned})
+	assert.Nil(t, err)
+	assert.Len(t, matches, 1)
+}
+
+func TestService_NotifyRetries(t *testing.T) {
+	db := memory.NewMemoryDB()
+	tx := &types.Transaction{Hash: types.NewHash("0x1"), BlockNumber: 1, From: sanctioned, To: contract}
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx}))
+
+	s := NewService(db, &types.ScreeningConfig{RefreshInterval: 300})
+	screener := &failingScreener{failures: 2}
+	s.screeners = []Screener{screener}
+	s.sinks = nil
+	s.maxAttempts = 3
+	s.initialBackoff = time.Millisecond
+	assert.Nil(t, s.Start())
+	defer s.Stop()
+
+	// screening succeeds on the last attempt, after the failed ones
+	assert.Nil(t, s.Notify([]types.Address{contract}, []*types.Block{{Number: 1, Transactions: []types.Hash{tx.Hash}}}))
+	var entries []*types.JournalEntry
+	assert.Eventually(t, func() bool {
+		entries = screeningJournal(t, db)
+		return len(entries) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, entries[0].Transactions)
+	assert.Equal(t, []string{"service unavailable", "service unavailable"}, entries[0].Errors)
+
+	// blocks still failing after every attempt are journaled as not screened
+	screener.mux.Lock()
+	screener.failures = 3
+	screener.mux.Unlock()
+	assert.Nil(t, s.Notify([]types.Address{contract}, []*types.Block{{Number: 2, Transactions: []types.Hash{tx.Hash}}}))
+	assert.Eventually(t, func() bool {
+		entries = screeningJournal(t, db)
+		return len(entries) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 2, entries[0].BlockNumber)
+	assert.Equal(t, 0, entries[0].Transactions)
+	assert.Equal(t, []string{"service unavailable", "service unavailable", "service unavailable", "not screened after 3 attempts"}, entries[0].Errors)
+}
+
+func TestService_DroppedAlerts(t *testing.T) {
+	s := NewService(memory.NewMemoryDB(), &types.ScreeningConfig{})
+	s.alerts = make(chan *types.ScreeningAlert, 1)
+	match := &types.ScreeningMatch{Address: sanctioned}
+	dropped := types.NewHash("0x2")
+	alerts := []*types.ScreeningAlert{
+		{Match: match, Contract: contract, Transaction: types.NewHash("0x1"), BlockNumber: 1},
+		{Match: match, Contract: contract, Transaction: dropped, BlockNumber: 2},
+	}
+
+	assert.Equal(t, map[uint64][]string{
+		2: {"alert dropped: " + sanctioned.Hex() + " flagged in transaction " + dropped.Hex()},
+	}, s.raise(alerts))
+	assert.Len(t, s.alerts, 1)
+}
+
+func screeningJournal(t *testing.T, db *memory.MemoryDB) []*types.JournalEntry {
+	options := &types.PageOptions{}
+	options.SetDefaults()
+	entries, err := db.GetJournalEntries(&types.JournalQuery{Stage: types.ScreenStage}, options)
+	assert.Nil(t, err)
+	return entries
+}
+
+// failingScreener fails the given number of times before screening nothing
+type failingScreener struct {
+	failures int
+	mux      sync.Mutex
+}
+
+func (s *failingScreener) Name() string {
+	return "failing"
+}
+
+func (s *failingScreener) Screen([]types.Address) ([]*types.ScreeningMatch, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("service unavailable")
+	}
+	return nil, nil
+}
+
+type fakeSink struct {
+	alerts chan *types.ScreeningAlert
+}
+
+func (s *fakeSink) Name() string {
+	return "fake"
+}
+
+func (s *fakeSink) Send(alert *types.ScreeningAlert) error {
+	s.alerts <- alert
+	return nil
+}
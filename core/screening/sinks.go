@@ -0,0 +1,60 @@
+package screening
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// AlertSink delivers alerts somewhere they will be seen.
+type AlertSink interface {
+	Name() string
+	Send(alert *types.ScreeningAlert) error
+}
+
+// LogSink writes alerts to the application log.
+type LogSink struct{}
+
+func (s *LogSink) Name() string {
+	return "log"
+}
+
+func (s *LogSink) Send(alert *types.ScreeningAlert) error {
+	log.Warn("Counterparty flagged by address screening", "address", alert.Match.Address.Hex(), "list", alert.Match.List, "reason", alert.Match.Reason,
+		"contract", alert.Contract.Hex(), "tx", alert.Transaction.Hex(), "block", alert.BlockNumber)
+	return nil
+}
+
+// WebhookSink POSTs alerts as JSON to a URL.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: requestTimeout}}
+}
+
+func (s *WebhookSink) Name() string {
+	return s.url
+}
+
+func (s *WebhookSink) Send(alert *types.ScreeningAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package sharding
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// Sharder splits the registered contracts between the instances sharing a
+// database, by the hash of their address, so each filters a disjoint set of
+// them and records how far it has filtered them itself.
+//
+// In hash mode the shard of each instance is fixed by its index. In lease
+// mode each running instance holds a member lease, and claims shards through
+// a lease for each of them, up to its fair share of the shards between the
+// members. Shards beyond that share are given up, once instances join, and
+// the shards of instances that stop are taken over once their leases are
+// released or expire. A shard is drained before its lease is released, so no
+// batch for its contracts is still being written once another instance
+// takes it.
+type Sharder struct {
+	db            database.LeaseDB
+	instanceID    string
+	mode          string
+	shards        int
+	leaseDuration time.Duration
+	renewInterval time.Duration
+	// waits for the batch being filtered, once a shard is no longer owned
+	drain func()
+
+	// the shards owned, with when the lease of each runs out unless renewed,
+	// and the number of instances sharing them as last seen
+	owned     map[int]time.Time
+	instances int
+	mux       sync.RWMutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+// NewSharder shares the contracts out as the instance, calling drain once it
+// stops owning a shard.
+func NewSharder(db database.LeaseDB, instanceID string, config *types.HighAvailabilityConfig, drain func()) *Sharder {
+	s := &Sharder{
+		db:            db,
+		instanceID:    instanceID,
+		mode:          config.Sharding.Mode,
+		shards:        config.Sharding.Shards,
+		leaseDuration: time.Duration(config.LeaseDuration) * time.Second,
+		renewInterval: time.Duration(config.RenewInterval) * time.Second,
+		drain:         drain,
+		owned:         make(map[int]time.Time),
+		instances:     1,
+		shutdownChan:  make(chan struct{}),
+	}
+	if s.mode == types.HashSharding {
+		// the fixed share of the instance never expires
+		s.shards = config.Sharding.Instances
+		s.instances = config.Sharding.Instances
+		s.owned[config.Sharding.Index] = time.Time{}
+	}
+	return s
+}
+
+func (s *Sharder) Start() error {
+	if s.mode == types.HashSharding {
+		log.Info("Filtering shard of contracts", "instance", s.instanceID, "shard", s.Status().Owned, "shards", s.shards)
+		return nil
+	}
+	log.Info("Starting contract sharding", "instance", s.instanceID, "shards", s.shards, "lease", s.leaseDuration, "renew interval", s.renewInterval)
+
+	s.shutdownWg.Add(1)
+	go func() {
+		defer s.shutdownWg.Done()
+		ticker := time.NewTicker(s.renewInterval)
+		defer ticker.Stop()
+		for {
+			s.balance(time.Now())
+			select {
+			case <-ticker.C:
+			case <-s.shutdownChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop releases the shards, and the membership of the instance, so the other
+// instances take them over without waiting for them to expire. Filtering
+// must have stopped first.
+func (s *Sharder) Stop() {
+	if s.mode == types.HashSharding {
+		return
+	}
+	close(s.shutdownChan)
+	s.shutdownWg.Wait()
+	for _, shard := range s.ownedShards() {
+		s.release(shard)
+	}
+	if err := s.db.ReleaseLease(memberLease(s.instanceID), s.instanceID); err != nil {
+		log.Warn("Releasing the shard member lease failed", "err", err)
+	}
+	log.Info("Contract sharding stopped")
+}
+
+// Owns checks whether the instance filters the contract
+func (s *Sharder) Owns(address types.Address) bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	_, ok := s.owned[ShardOf(address, s.shards)]
+	return ok
+}
+
+func (s *Sharder) Status() *types.ShardingStatus {
+	return &types.ShardingStatus{
+		Mode:      s.mode,
+		Shards:    s.shards,
+		Owned:     s.ownedShards(),
+		Instances: s.currentInstances(),
+	}
+}
+
+// ShardOf returns the shard of the contract, of the given number of shards
+func ShardOf(address types.Address, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(address.String())))
+	return int(h.Sum32() % uint32(shards))
+}
+
+func memberLease(instanceID string) string {
+	return types.ShardMemberLeasePrefix + instanceID
+}
+
+func shardLease(shard int) string {
+	return types.ShardLeasePrefix + strconv.Itoa(shard)
+}
+
+// balance renews the membership of the instance and the shards it owns as of
+// the given time, then gives up or takes shards to bring it to its fair share
+func (s *Sharder) balance(now time.Time) {
+	if _, err := s.db.AcquireLease(memberLease(s.instanceID), s.instanceID, s.leaseDuration); err != nil {
+		log.Warn("Renewing the shard member lease failed", "err", err)
+		s.expire(now)
+		return
+	}
+	members, err := s.db.GetLeases(types.ShardMemberLeasePrefix)
+	if err != nil {
+		log.Warn("Fetching the shard members failed", "err", err)
+		s.expire(now)
+		return
+	}
+	instances := 0
+	for _, member := range members {
+		if !member.Expired(now) {
+			instances++
+		}
+	}
+	if instances == 0 {
+		// the lease of the instance was just renewed
+		instances = 1
+	}
+	s.mux.Lock()
+	s.instances = instances
+	s.mux.Unlock()
+	share := (s.shards + instances - 1) / instances
+
+	for _, shard := range s.ownedShards() {
+		lease, err := s.db.AcquireLease(shardLease(shard), s.instanceID, s.leaseDuration)
+		if err != nil {
+			log.Warn("Renewing the shard lease failed", "shard", shard, "err", err)
+			continue
+		}
+		if lease.Holder != s.instanceID {
+			log.Warn("Shard taken by another instance", "shard", shard, "holder", lease.Holder)
+			s.giveUp(shard)
+			continue
+		}
+		s.mux.Lock()
+		// timed from before the request, as the lease may have been written
+		// any time after
+		s.owned[shard] = now.Add(s.leaseDuration)
+		s.mux.Unlock()
+	}
+	s.expire(now)
+
+	owned := s.ownedShards()
+	for len(owned) > share {
+		// the highest shards are given up, for the instances that joined
+		s.release(owned[len(owned)-1])
+		owned = owned[:len(owned)-1]
+	}
+	if len(owned) < share {
+		s.claim(now, share-len(owned))
+	}
+}
+
+// claim takes up to count of the shards no other instance holds
+func (s *Sharder) claim(now time.Time, count int) {
+	leases, err := s.db.GetLeases(types.ShardLeasePrefix)
+	if err != nil {
+		log.Warn("Fetching the shard leases failed", "err", err)
+		return
+	}
+	held := make(map[string]bool)
+	for _, lease := range leases {
+		if !lease.Expired(now) {
+			held[lease.Name] = true
+		}
+	}
+	for shard := 0; shard < s.shards && count > 0; shard++ {
+		s.mux.RLock()
+		_, owned := s.owned[shard]
+		s.mux.RUnlock()
+		if owned || held[shardLease(shard)] {
+			continue
+		}
+		lease, err := s.db.AcquireLease(shardLease(shard), s.instanceID, s.leaseDuration)
+		if err != nil {
+			log.Warn("Acquiring the shard lease failed", "shard", shard, "err", err)
+			return
+		}
+		if lease.Holder != s.instanceID {
+			continue
+		}
+		s.mux.Lock()
+		s.owned[shard] = now.Add(s.leaseDuration)
+		s.mux.Unlock()
+		log.Info("Claimed shard of contracts", "shard", shard, "instance", s.instanceID)
+		count--
+	}
+}
+
+// expire gives up the shards whose leases would run out before they could
+// next be renewed, as another instance may then take them
+func (s *Sharder) expire(now time.Time) {
+	for _, shard := range s.ownedShards() {
+		s.mux.RLock()
+		expiresAt := s.owned[shard]
+		s.mux.RUnlock()
+		if !now.Add(s.renewInterval).Before(expiresAt) {
+			log.Warn("Shard lease couldn't be renewed before expiring", "shard", shard)
+			s.giveUp(shard)
+		}
+	}
+}
+
+// release gives up the shard and its lease, once drained
+func (s *Sharder) release(shard int) {
+	s.giveUp(shard)
+	if err := s.db.ReleaseLease(shardLease(shard), s.instanceID); err != nil {
+		log.Warn("Releasing the shard lease failed", "shard", shard, "err", err)
+		return
+	}
+	log.Info("Released shard of contracts", "shard", shard, "instance", s.instanceID)
+}
+
+// giveUp stops the shard's contracts being filtered, returning once the batch
+// being filtered is done
+func (s *Sharder) giveUp(shard int) {
+	s.mux.Lock()
+	delete(s.owned, shard)
+	s.mux.Unlock()
+	s.drain()
+}
+
+func (s *Sharder) ownedShards() []int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	shards := make([]int, 0, len(s.owned))
+	for shard := range s.owned {
+		shards = append(shards, shard)
+	}
+	sort.Ints(shards)
+	return shards
+}
+
+func (s *Sharder) currentInstances() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.instances
+}
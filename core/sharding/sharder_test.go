@@ -0,0 +1,122 @@
+package sharding
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+// fakeDB fails to acquire leases while err is set
+type fakeDB struct {
+	*memory.MemoryDB
+	err error
+}
+
+func (f *fakeDB) AcquireLease(name string, holder string, duration time.Duration) (*types.Lease, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.MemoryDB.AcquireLease(name, holder, duration)
+}
+
+type instance struct {
+	*Sharder
+	drained int
+}
+
+func newInstance(db *fakeDB, instanceID string, sharding *types.ShardingConfig) *instance {
+	i := &instance{}
+	i.Sharder = NewSharder(db, instanceID, &types.HighAvailabilityConfig{LeaseDuration: 15, RenewInterval: 5, Sharding: sharding}, func() {
+		i.drained++
+	})
+	return i
+}
+
+func addresses() []types.Address {
+	addresses := make([]types.Address, 100)
+	for i := range addresses {
+		addresses[i] = types.NewAddress(fmt.Sprintf("%x", i+1))
+	}
+	return addresses
+}
+
+// assertDisjoint checks each address is owned by exactly one of the instances
+func assertDisjoint(t *testing.T, instances ...*instance) {
+	for _, address := range addresses() {
+		owners := 0
+		for _, i := range instances {
+			if i.Owns(address) {
+				owners++
+			}
+		}
+		assert.Equal(t, 1, owners, address.String())
+	}
+}
+
+func TestSharder_Hash(t *testing.T) {
+	db := &fakeDB{MemoryDB: memory.NewMemoryDB()}
+	var instances []*instance
+	for index := 0; index < 3; index++ {
+		i := newInstance(db, fmt.Sprintf("reporting-%d", index), &types.ShardingConfig{Mode: types.HashSharding, Instances: 3, Index: index})
+		assert.Nil(t, i.Start())
+		instances = append(instances, i)
+	}
+	assertDisjoint(t, instances...)
+	assert.Equal(t, &types.ShardingStatus{Mode: types.HashSharding, Shards: 3, Owned: []int{1}, Instances: 3}, instances[1].Status())
+}
+
+func TestSharder_Rebalance(t *testing.T) {
+	db := &fakeDB{MemoryDB: memory.NewMemoryDB()}
+	sharding := &types.ShardingConfig{Mode: types.LeaseSharding, Shards: 8}
+	first := newInstance(db, "reporting-1", sharding)
+	second := newInstance(db, "reporting-2", sharding)
+	now := time.Now()
+
+	first.balance(now)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7}, first.Status().Owned)
+
+	// the shards of the first are held until it gives them up
+	second.balance(now)
+	assert.Empty(t, second.Status().Owned)
+	assert.Equal(t, 2, second.Status().Instances)
+
+	first.balance(now)
+	assert.Equal(t, []int{0, 1, 2, 3}, first.Status().Owned)
+	assert.Equal(t, 4, first.drained)
+	second.balance(now)
+	assert.Equal(t, []int{4, 5, 6, 7}, second.Status().Owned)
+	assertDisjoint(t, first, second)
+
+	// the shards of an instance that stops are taken over
+	second.Stop()
+	lease, err := db.GetLease(shardLease(4))
+	assert.Equal(t, database.ErrNotFound, err)
+	assert.Nil(t, lease)
+	first.balance(now)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7}, first.Status().Owned)
+	assert.Equal(t, 1, first.Status().Instances)
+}
+
+func TestSharder_Expiring(t *testing.T) {
+	db := &fakeDB{MemoryDB: memory.NewMemoryDB()}
+	i := newInstance(db, "reporting-1", &types.ShardingConfig{Mode: types.LeaseSharding, Shards: 4})
+	now := time.Now()
+	i.balance(now)
+	assert.Len(t, i.Status().Owned, 4)
+
+	// the shards are kept while there is still time to renew them
+	db.err = errors.New("cluster unavailable")
+	i.balance(now.Add(5 * time.Second))
+	assert.Len(t, i.Status().Owned, 4)
+	i.balance(now.Add(10 * time.Second))
+	assert.Empty(t, i.Status().Owned)
+	assert.Equal(t, 4, i.drained)
+	assert.False(t, i.Owns(types.NewAddress("1")))
+}
@@ -0,0 +1,89 @@
+package storageparsing
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"quorumengineering/quorum-report/types"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata with the current output")
+
+// goldenOutput is what is compared against the golden file of a case
+type goldenOutput struct {
+	Storage []*types.StorageItem  `json:"storage"`
+	Values  []*types.StorageValue `json:"values"`
+}
+
+// TestGolden parses the storage of each contract in testdata with the layout
+// solc gave for it, and compares the result with the golden file of the case.
+// After a change to the parsers, run `go test -run TestGolden -update` and
+// review the changes to the golden files.
+func TestGolden(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "*"))
+	require.Nil(t, err)
+	require.NotEmpty(t, dirs)
+
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		dir := dir
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			layout, storage, keys := readGoldenCase(t, dir)
+
+			var out goldenOutput
+			out.Storage, err = ParseRawStorageWithKeys(storage, layout, keys)
+			require.Nil(t, err)
+			out.Values, err = DecodeStorageValues(storage, layout)
+			require.Nil(t, err)
+			actual, err := json.MarshalIndent(out, "", "  ")
+			require.Nil(t, err)
+
+			goldenFile := filepath.Join(dir, "golden.json")
+			if *update {
+				require.Nil(t, ioutil.WriteFile(goldenFile, append(actual, '\n'), 0644))
+				return
+			}
+			expected, err := ioutil.ReadFile(goldenFile)
+			require.Nil(t, err, "run with -update to create the golden file")
+			assert.JSONEq(t, string(expected), string(actual))
+		})
+	}
+}
+
+// readGoldenCase reads the layout from the solc output in layout.txt, the raw
+// storage from storage.json and the mapping keys from keys.json, if it exists
+func readGoldenCase(t *testing.T, dir string) (types.SolidityStorageDocument, map[types.Hash]string, MappingKeys) {
+	output, err := ioutil.ReadFile(filepath.Join(dir, "layout.txt"))
+	require.Nil(t, err)
+	rawLayout, err := ImportStorageLayout(string(output), "")
+	require.Nil(t, err)
+	var layout types.SolidityStorageDocument
+	require.Nil(t, json.Unmarshal([]byte(rawLayout), &layout))
+
+	rawStorage, err := ioutil.ReadFile(filepath.Join(dir, "storage.json"))
+	require.Nil(t, err)
+	var decodedStorage map[string]string
+	require.Nil(t, json.Unmarshal(rawStorage, &decodedStorage))
+	storage := make(map[types.Hash]string)
+	for slot, value := range decodedStorage {
+		storage[types.NewHash(slot)] = value
+	}
+
+	var keys MappingKeys
+	rawKeys, err := ioutil.ReadFile(filepath.Join(dir, "keys.json"))
+	if err == nil {
+		require.Nil(t, json.Unmarshal(rawKeys, &keys))
+	} else {
+		require.True(t, os.IsNotExist(err), err)
+	}
+	return layout, storage, keys
+}
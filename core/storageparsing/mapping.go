@@ -0,0 +1,134 @@
+package storageparsing
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// ParseMapping returns the values in a mapping for the keys given for its key
+// type, leaving out keys that have never been set. The values are named by
+// their key. It returns nil if no keys were given for the key type.
+func (p *Parser) ParseMapping(entry types.SolidityStorageEntry, namedType types.SolidityTypeEntry) ([]*types.StorageItem, error) {
+	keyType := p.template.Types[namedType.Key]
+	keys, ok := p.mappingKeys[keyType.Label]
+	if !ok {
+		return nil, nil
+	}
+
+	mappingSlot, _ := hex.DecodeString(string(p.ResolveSlot(bigN(entry.Slot))))
+
+	entries := make([]*types.StorageItem, 0)
+	for _, key := range keys {
+		encodedKey, err := encodeMappingKey(namedType.Key, key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s mapping key %s: %v", keyType.Label, key, err)
+		}
+		// the value is stored at keccak256(key . slot)
+		valueSlot := hashBytes(append(encodedKey, mappingSlot...))
+
+		newTemplate := types.SolidityStorageDocument{
+			Storage: types.SolidityStorageEntries{{Label: key, Type: namedType.Value}},
+			Types:   p.template.Types,
+		}
+		tracker := &usageTracker{StorageManager: p.storageManager}
+		valueParser := p.newChildParser(tracker, newTemplate, valueSlot)
+		out, err := valueParser.ParseRawStorage()
+		if err != nil {
+			return nil, err
+		}
+		if tracker.used && len(out) > 0 {
+			entries = append(entries, out[0])
+		}
+	}
+	return entries, nil
+}
+
+// encodeMappingKey returns the key as it is hashed with the slot of a mapping.
+// Value types are padded to 32 bytes, while strings and bytes are used as is.
+func encodeMappingKey(keyType string, key string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(keyType, "t_string"):
+		return []byte(key), nil
+
+	case strings.HasPrefix(keyType, "t_bytes_"):
+		return hex.DecodeString(strings.TrimPrefix(key, "0x"))
+
+	case strings.HasPrefix(keyType, bytesPrefix):
+		decoded, err := hex.DecodeString(strings.TrimPrefix(key, "0x"))
+		if err != nil {
+			return nil, err
+		}
+		if len(decoded) > 32 {
+			return nil, errors.New("longer than 32 bytes")
+		}
+		// fixed size bytes are aligned to the left
+		return append(decoded, make([]byte, 32-len(decoded))...), nil
+
+	case strings.HasPrefix(keyType, addressPrefix), strings.HasPrefix(keyType, contractPrefix):
+		decoded, err := hex.DecodeString(strings.TrimPrefix(key, "0x"))
+		if err != nil {
+			return nil, err
+		}
+		if len(decoded) != 20 {
+			return nil, errors.New("not a 20 byte address")
+		}
+		return leftPad32(decoded), nil
+
+	case strings.HasPrefix(keyType, boolPrefix):
+		value, err := strconv.ParseBool(key)
+		if err != nil {
+			return nil, err
+		}
+		if value {
+			return leftPad32([]byte{1}), nil
+		}
+		return leftPad32(nil), nil
+
+	case strings.HasPrefix(keyType, intPrefix), strings.HasPrefix(keyType, uintPrefix), strings.HasPrefix(keyType, enumPrefix):
+		value, ok := new(big.Int).SetString(key, 0)
+		if !ok {
+			return nil, errors.New("not an integer")
+		}
+		if value.Sign() < 0 {
+			if !strings.HasPrefix(keyType, intPrefix) {
+				return nil, errors.New("negative key for unsigned type")
+			}
+			// two's complement
+			value.Add(value, maxSlot)
+		}
+		if value.Sign() < 0 || value.Cmp(maxSlot) >= 0 {
+			return nil, errors.New("out of range")
+		}
+		return leftPad32(value.Bytes()), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", keyType)
+}
+
+func leftPad32(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+// usageTracker records whether any storage read through it is set, to tell
+// mapping keys that have a value from those that were never set
+type usageTracker struct {
+	StorageManager
+	used bool
+}
+
+func (ut *usageTracker) Get(hash types.Hash) []byte {
+	value := ut.StorageManager.Get(hash)
+	for _, b := range value {
+		if b != 0 {
+			ut.used = true
+			break
+		}
+	}
+	return value
+}
@@ -0,0 +1,168 @@
+package storageparsing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const mappingLayout = `{
+	"storage":[
+		{"label":"balances","offset":0,"slot":"0","type":"t_mapping(t_address,t_uint256)"},
+		{"label":"allowed","offset":0,"slot":"1","type":"t_mapping(t_address,t_mapping(t_uint256,t_uint256))"},
+		{"label":"funders","offset":0,"slot":"2","type":"t_array(t_struct(Funder)_storage)dyn_storage"},
+		{"label":"names","offset":0,"slot":"3","type":"t_mapping(t_string_memory_ptr,t_bool)"}
+	],
+	"types":{
+		"t_address":{"encoding":"inplace","label":"address","numberOfBytes":"20"},
+		"t_bool":{"encoding":"inplace","label":"bool","numberOfBytes":"1"},
+		"t_uint256":{"encoding":"inplace","label":"uint256","numberOfBytes":"32"},
+		"t_string_memory_ptr":{"encoding":"bytes","label":"string","numberOfBytes":"32"},
+		"t_mapping(t_address,t_uint256)":{"encoding":"mapping","key":"t_address","label":"mapping(address => uint256)","numberOfBytes":"32","value":"t_uint256"},
+		"t_mapping(t_uint256,t_uint256)":{"encoding":"mapping","key":"t_uint256","label":"mapping(uint256 => uint256)","numberOfBytes":"32","value":"t_uint256"},
+		"t_mapping(t_address,t_mapping(t_uint256,t_uint256))":{"encoding":"mapping","key":"t_address","label":"mapping(address => mapping(uint256 => uint256))","numberOfBytes":"32","value":"t_mapping(t_uint256,t_uint256)"},
+		"t_mapping(t_string_memory_ptr,t_bool)":{"encoding":"mapping","key":"t_string_memory_ptr","label":"mapping(string => bool)","numberOfBytes":"32","value":"t_bool"},
+		"t_struct(Funder)_storage":{"encoding":"inplace","label":"struct Funder","numberOfBytes":"64","members":[
+			{"label":"addr","offset":0,"slot":"0","type":"t_address"},
+			{"label":"amount","offset":0,"slot":"1","type":"t_uint256"}
+		]},
+		"t_array(t_struct(Funder)_storage)dyn_storage":{"base":"t_struct(Funder)_storage","encoding":"dynamic_array","label":"struct Funder[]","numberOfBytes":"32"}
+	}
+}`
+
+var (
+	holder  = "1349f3e1b8d71effb47b840594ff27da7e603d17"
+	spender = "9d13c6d3afe1721beef56b55d303b09e021e27ab"
+)
+
+func slotHex(n uint64) []byte {
+	return leftPad32(new(big.Int).SetUint64(n).Bytes())
+}
+
+func addressHex(address string) []byte {
+	decoded, _ := hex.DecodeString(address)
+	return leftPad32(decoded)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func offsetSlot(slot types.Hash, offset int64) types.Hash {
+	asBytes, _ := hex.DecodeString(string(slot))
+	asBig := new(big.Int).SetBytes(asBytes)
+	return types.NewHash(hex.EncodeToString(asBig.Add(asBig, big.NewInt(offset)).Bytes()))
+}
+
+func mappingStorage() map[types.Hash]string {
+	allowedSlot, _ := hex.DecodeString(string(hashBytes(concat(addressHex(holder), slotHex(1)))))
+	funders := hashBytes(slotHex(2))
+
+	return map[types.Hash]string{
+		hashBytes(concat(addressHex(holder), slotHex(0))): "64",
+		hashBytes(concat(slotHex(7), allowedSlot)):        "0a",
+		types.NewHash("2"):     "2",
+		funders:                holder,
+		offsetSlot(funders, 1): "1",
+		offsetSlot(funders, 2): spender,
+		offsetSlot(funders, 3): "2",
+		hashBytes(concat([]byte("alice"), slotHex(3))):        "1",
+		hashBytes(concat(addressHex(spender), slotHex(1000))): "ff",
+	}
+}
+
+func parseMappingLayout(t *testing.T, keys MappingKeys) map[string]interface{} {
+	var layout types.SolidityStorageDocument
+	require.Nil(t, json.Unmarshal([]byte(mappingLayout), &layout))
+
+	parsed, err := ParseRawStorageWithKeys(mappingStorage(), layout, keys)
+	require.Nil(t, err)
+
+	byName := make(map[string]interface{})
+	for _, item := range parsed {
+		byName[item.VarName] = item.Value
+	}
+	return byName
+}
+
+func TestParseMapping(t *testing.T) {
+	parsed := parseMappingLayout(t, MappingKeys{
+		"address": {"0x" + holder, "0x" + spender},
+		"uint256": {"7", "8"},
+		"string":  {"alice", "bob"},
+	})
+
+	assert.Equal(t, []*types.StorageItem{
+		{VarName: "0x" + holder, VarType: "uint256", Value: "100"},
+	}, parsed["balances"])
+	assert.Equal(t, []*types.StorageItem{
+		{VarName: "0x" + holder, VarType: "mapping(uint256 => uint256)", Value: []*types.StorageItem{
+			{VarName: "7", VarType: "uint256", Value: "10"},
+		}},
+	}, parsed["allowed"])
+	assert.Equal(t, []*types.StorageItem{
+		{VarName: "alice", VarType: "bool", Value: true},
+	}, parsed["names"])
+}
+
+func TestParseMapping_NoKeys(t *testing.T) {
+	parsed := parseMappingLayout(t, nil)
+
+	_, ok := parsed["balances"]
+	assert.False(t, ok)
+	_, ok = parsed["allowed"]
+	assert.False(t, ok)
+}
+
+func TestParseArray_DynamicStructs(t *testing.T) {
+	parsed := parseMappingLayout(t, nil)
+
+	assert.Equal(t, []interface{}{
+		[]*types.StorageItem{
+			{VarName: "addr", VarType: "address", Value: types.NewAddress(holder)},
+			{VarName: "amount", VarType: "uint256", Value: "1"},
+		},
+		[]*types.StorageItem{
+			{VarName: "addr", VarType: "address", Value: types.NewAddress(spender)},
+			{VarName: "amount", VarType: "uint256", Value: "2"},
+		},
+	}, parsed["funders"])
+}
+
+func TestEncodeMappingKey(t *testing.T) {
+	encoded, err := encodeMappingKey("t_int256", "-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", hex.EncodeToString(encoded))
+
+	encoded, err = encodeMappingKey("t_bytes4", "0x12345678")
+	assert.Nil(t, err)
+	assert.Equal(t, "1234567800000000000000000000000000000000000000000000000000000000", hex.EncodeToString(encoded))
+
+	encoded, err = encodeMappingKey("t_bytes_memory_ptr", "0x1234")
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", hex.EncodeToString(encoded))
+
+	_, err = encodeMappingKey("t_uint256", "-1")
+	assert.EqualError(t, err, "negative key for unsigned type")
+
+	_, err = encodeMappingKey("t_address", "0x1234")
+	assert.EqualError(t, err, "not a 20 byte address")
+}
+
+func TestParseMapping_InvalidKey(t *testing.T) {
+	var layout types.SolidityStorageDocument
+	require.Nil(t, json.Unmarshal([]byte(mappingLayout), &layout))
+
+	_, err := ParseRawStorageWithKeys(mappingStorage(), layout, MappingKeys{"address": {holder}, "uint256": {"abc"}})
+	assert.EqualError(t, err, "invalid uint256 mapping key abc: not an integer")
+}
@@ -5,7 +5,14 @@ import (
 )
 
 func ParseRawStorage(rawStorage map[types.Hash]string, template types.SolidityStorageDocument) ([]*types.StorageItem, error) {
+	return ParseRawStorageWithKeys(rawStorage, template, nil)
+}
+
+// ParseRawStorageWithKeys parses the storage like ParseRawStorage, and also
+// returns the values of mappings for the given keys
+func ParseRawStorageWithKeys(rawStorage map[types.Hash]string, template types.SolidityStorageDocument, mappingKeys MappingKeys) ([]*types.StorageItem, error) {
 	initialStorageManager := NewDefaultStorageHandler(rawStorage)
 	parser := NewParser(initialStorageManager, template, types.NewHash(""))
+	parser.mappingKeys = mappingKeys
 	return parser.ParseRawStorage()
 }
@@ -0,0 +1,50 @@
+package storageparsing
+
+import (
+	"fmt"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// slotRecorder records the slots read through it
+type slotRecorder struct {
+	StorageManager
+	slots map[types.Hash]bool
+}
+
+func (r *slotRecorder) Get(hash types.Hash) []byte {
+	r.slots[hash] = true
+	return r.StorageManager.Get(hash)
+}
+
+// VariableSlots returns the slots of the raw storage that hold the value of
+// the named variable of the layout: the slots it starts in, the elements of
+// dynamic arrays, the data of long strings and bytes, and the values of
+// mappings for the given keys. The keys of mappings aren't stored, so no
+// values are found for mappings without keys.
+func VariableSlots(rawStorage map[types.Hash]string, layout types.SolidityStorageDocument, variable string, mappingKeys MappingKeys) (map[types.Hash]bool, error) {
+	var template types.SolidityStorageDocument
+	for _, entry := range layout.Storage {
+		if entry.Label == variable {
+			template = types.SolidityStorageDocument{Storage: types.SolidityStorageEntries{entry}, Types: layout.Types}
+			break
+		}
+	}
+	if template.Storage == nil {
+		return nil, fmt.Errorf("storage variable %s is not in the storage layout", variable)
+	}
+
+	recorder := &slotRecorder{StorageManager: NewDefaultStorageHandler(rawStorage), slots: make(map[types.Hash]bool)}
+	parser := NewParser(recorder, template, types.NewHash(""))
+	parser.mappingKeys = mappingKeys
+	if _, err := parser.ParseRawStorage(); err != nil {
+		return nil, err
+	}
+	// slots that were read but never set aren't stored
+	for slot := range recorder.slots {
+		if _, ok := rawStorage[slot]; !ok {
+			delete(recorder.slots, slot)
+		}
+	}
+	return recorder.slots, nil
+}
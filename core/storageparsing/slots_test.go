@@ -0,0 +1,59 @@
+package storageparsing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const slotsLayout = `{"storage":[
+	{"label":"counter","offset":0,"slot":"0","type":"t_uint256"},
+	{"label":"values","offset":0,"slot":"1","type":"t_array(t_uint256)dyn_storage"},
+	{"label":"balances","offset":0,"slot":"2","type":"t_mapping(t_address,t_uint256)"}
+],"types":{
+	"t_uint256":{"encoding":"inplace","label":"uint256","numberOfBytes":"32"},
+	"t_address":{"encoding":"inplace","label":"address","numberOfBytes":"20"},
+	"t_array(t_uint256)dyn_storage":{"base":"t_uint256","encoding":"dynamic_array","label":"uint256[]","numberOfBytes":"32"},
+	"t_mapping(t_address,t_uint256)":{"encoding":"mapping","key":"t_address","label":"mapping(address => uint256)","numberOfBytes":"32","value":"t_uint256"}
+}}`
+
+func TestVariableSlots(t *testing.T) {
+	var layout types.SolidityStorageDocument
+	assert.Nil(t, json.Unmarshal([]byte(slotsLayout), &layout))
+
+	holder := "0x1349f3e1b8d71effb47b840594ff27da7e603d17"
+	holderKey, _ := encodeMappingKey("t_address", holder)
+	mappingSlot, _ := hex.DecodeString(string(types.NewHash("0x02")))
+	balanceSlot := hashBytes(append(holderKey, mappingSlot...))
+	elements := hash(types.NewHash("0x01"))
+	storage := map[types.Hash]string{
+		types.NewHash("0x00"): "05",
+		types.NewHash("0x01"): "01",
+		elements:              "2a",
+		balanceSlot:           "64",
+	}
+
+	slots, err := VariableSlots(storage, layout, "counter", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[types.Hash]bool{types.NewHash("0x00"): true}, slots)
+
+	// the length of a dynamic array and its elements
+	slots, err = VariableSlots(storage, layout, "values", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[types.Hash]bool{types.NewHash("0x01"): true, elements: true}, slots)
+
+	// mapping values are only found for the keys given
+	slots, err = VariableSlots(storage, layout, "balances", nil)
+	assert.Nil(t, err)
+	assert.Empty(t, slots)
+	slots, err = VariableSlots(storage, layout, "balances", MappingKeys{"address": {holder, "0x0000000000000000000000000000000000000001"}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[types.Hash]bool{balanceSlot: true}, slots)
+
+	_, err = VariableSlots(storage, layout, "missing", nil)
+	assert.EqualError(t, err, "storage variable missing is not in the storage layout")
+}
@@ -0,0 +1,187 @@
+package storageparsing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// solc --storage-layout prints the layout of each contract after a header
+	// naming it, and this line
+	storageLayoutHeader = "Contract Storage Layout:"
+	contractHeader      = "======="
+)
+
+var ErrNoStorageLayout = errors.New("no storage layout found in solc output")
+
+// ImportStorageLayout extracts the storage layout of a contract from the output
+// of solc, returning it in the format stored in templates. The output may be
+// the layout itself, the output of `solc --storage-layout`, of
+// `solc --combined-json storage-layout`, or of the standard JSON interface.
+// If the output has the layouts of several contracts, contractName selects
+// which one is returned, either as the contract name or as
+// "<source file>:<contract name>".
+func ImportStorageLayout(output string, contractName string) (string, error) {
+	layouts, err := extractStorageLayouts(output)
+	if err != nil {
+		return "", err
+	}
+	if len(layouts) == 0 {
+		return "", ErrNoStorageLayout
+	}
+
+	var matched []string
+	for name := range layouts {
+		if contractName == "" || name == contractName || strings.HasSuffix(name, ":"+contractName) {
+			matched = append(matched, name)
+		}
+	}
+	sort.Strings(matched)
+	if len(matched) == 0 {
+		return "", fmt.Errorf("no storage layout found for contract %s", contractName)
+	}
+	if len(matched) > 1 {
+		return "", fmt.Errorf("storage layouts found for several contracts, one must be chosen from: %s", strings.Join(matched, ", "))
+	}
+
+	layout := layouts[matched[0]]
+	if err := validateStorageLayout(layout); err != nil {
+		if matched[0] == "" {
+			return "", fmt.Errorf("invalid storage layout: %v", err)
+		}
+		return "", fmt.Errorf("invalid storage layout for contract %s: %v", matched[0], err)
+	}
+	return layout, nil
+}
+
+// extractStorageLayouts returns each storage layout in the output, keyed by
+// the name of its contract
+func extractStorageLayouts(output string) (map[string]string, error) {
+	output = strings.TrimSpace(output)
+	if !strings.HasPrefix(output, "{") {
+		return extractTextStorageLayouts(output), nil
+	}
+
+	var document struct {
+		Storage   json.RawMessage            `json:"storage"`
+		Contracts map[string]json.RawMessage `json:"contracts"`
+	}
+	if err := json.Unmarshal([]byte(output), &document); err != nil {
+		return nil, errors.New("invalid JSON: " + err.Error())
+	}
+	if document.Storage != nil {
+		// the layout itself, which does not name the contract
+		return map[string]string{"": output}, nil
+	}
+
+	layouts := make(map[string]string)
+	for name, contract := range document.Contracts {
+		// combined JSON has a layout for each "<source file>:<contract name>"
+		var combined struct {
+			StorageLayout json.RawMessage `json:"storage-layout"`
+		}
+		if err := json.Unmarshal(contract, &combined); err == nil && combined.StorageLayout != nil {
+			layout, err := unquoteLayout(combined.StorageLayout)
+			if err != nil {
+				return nil, err
+			}
+			layouts[name] = layout
+			continue
+		}
+
+		// standard JSON has the contracts of each source file
+		var source map[string]struct {
+			StorageLayout json.RawMessage `json:"storageLayout"`
+		}
+		if err := json.Unmarshal(contract, &source); err != nil {
+			continue
+		}
+		for contractName, sourceContract := range source {
+			if sourceContract.StorageLayout != nil {
+				layouts[name+":"+contractName] = string(sourceContract.StorageLayout)
+			}
+		}
+	}
+	return layouts, nil
+}
+
+// extractTextStorageLayouts returns the layouts printed by
+// solc --storage-layout, each on the line after the layout header
+func extractTextStorageLayouts(output string) map[string]string {
+	layouts := make(map[string]string)
+	var contract string
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, contractHeader) {
+			contract = strings.TrimSpace(strings.Trim(line, "="))
+		}
+		if line == storageLayoutHeader && i+1 < len(lines) {
+			layouts[contract] = strings.TrimSpace(lines[i+1])
+		}
+	}
+	return layouts
+}
+
+// unquoteLayout returns the layout as JSON, as older versions of solc give it
+// as a string in combined JSON output
+func unquoteLayout(layout json.RawMessage) (string, error) {
+	if !strings.HasPrefix(string(layout), `"`) {
+		return string(layout), nil
+	}
+	var unquoted string
+	if err := json.Unmarshal(layout, &unquoted); err != nil {
+		return "", err
+	}
+	return unquoted, nil
+}
+
+// validateStorageLayout checks the layout can be parsed, and that all types it
+// refers to are described in it
+func validateStorageLayout(layout string) error {
+	var document types.SolidityStorageDocument
+	if err := json.Unmarshal([]byte(layout), &document); err != nil {
+		return errors.New("invalid JSON: " + err.Error())
+	}
+
+	checkType := func(name string) error {
+		if name == "" {
+			return nil
+		}
+		if _, ok := document.Types[name]; !ok {
+			return fmt.Errorf("unknown type %s", name)
+		}
+		return nil
+	}
+	checkEntries := func(entries types.SolidityStorageEntries) error {
+		for _, entry := range entries {
+			if entry.Type == "" {
+				return fmt.Errorf("no type given for variable %s", entry.Label)
+			}
+			if err := checkType(entry.Type); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := checkEntries(document.Storage); err != nil {
+		return err
+	}
+	for _, typeEntry := range document.Types {
+		for _, name := range []string{typeEntry.Base, typeEntry.Key, typeEntry.Value} {
+			if err := checkType(name); err != nil {
+				return err
+			}
+		}
+		if err := checkEntries(typeEntry.Members); err != nil {
+			return err
+		}
+	}
+	return nil
+}
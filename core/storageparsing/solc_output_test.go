@@ -0,0 +1,63 @@
+package storageparsing
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const simpleLayout = `{"storage":[{"astId":3,"contract":"simplestorage.sol:SimpleStorage","label":"storedData","offset":0,"slot":"0","type":"t_uint256"}],"types":{"t_uint256":{"encoding":"inplace","label":"uint256","numberOfBytes":"32"}}}`
+
+const otherLayout = `{"storage":[{"astId":5,"contract":"other.sol:Other","label":"owner","offset":0,"slot":"0","type":"t_address"}],"types":{"t_address":{"encoding":"inplace","label":"address","numberOfBytes":"20"}}}`
+
+func TestImportStorageLayout(t *testing.T) {
+	cases := []struct {
+		name   string
+		output string
+	}{
+		{"layout", simpleLayout},
+		{"text", "\n======= simplestorage.sol:SimpleStorage =======\nContract Storage Layout:\n" + simpleLayout + "\n"},
+		{"combined JSON", `{"contracts":{"simplestorage.sol:SimpleStorage":{"storage-layout":` + simpleLayout + `}},"version":"0.7.0"}`},
+		{"combined JSON as string", `{"contracts":{"simplestorage.sol:SimpleStorage":{"storage-layout":` + strconv.Quote(simpleLayout) + `}},"version":"0.6.7"}`},
+		{"standard JSON", `{"contracts":{"simplestorage.sol":{"SimpleStorage":{"storageLayout":` + simpleLayout + `}}},"sources":{}}`},
+	}
+	for _, tc := range cases {
+		layout, err := ImportStorageLayout(tc.output, "")
+		assert.Nil(t, err, tc.name)
+		assert.JSONEq(t, simpleLayout, layout, tc.name)
+	}
+}
+
+func TestImportStorageLayout_SeveralContracts(t *testing.T) {
+	output := `{"contracts":{"simplestorage.sol:SimpleStorage":{"storage-layout":` + simpleLayout + `},"other.sol:Other":{"storage-layout":` + otherLayout + `}}}`
+
+	_, err := ImportStorageLayout(output, "")
+	assert.EqualError(t, err, "storage layouts found for several contracts, one must be chosen from: other.sol:Other, simplestorage.sol:SimpleStorage")
+
+	layout, err := ImportStorageLayout(output, "Other")
+	assert.Nil(t, err)
+	assert.JSONEq(t, otherLayout, layout)
+	layout, err = ImportStorageLayout(output, "simplestorage.sol:SimpleStorage")
+	assert.Nil(t, err)
+	assert.JSONEq(t, simpleLayout, layout)
+
+	_, err = ImportStorageLayout(output, "Missing")
+	assert.EqualError(t, err, "no storage layout found for contract Missing")
+}
+
+func TestImportStorageLayout_Invalid(t *testing.T) {
+	_, err := ImportStorageLayout("Compiler run successful, no output requested.", "")
+	assert.Equal(t, ErrNoStorageLayout, err)
+
+	_, err = ImportStorageLayout(`{"contracts":`, "")
+	assert.EqualError(t, err, "invalid JSON: unexpected end of JSON input")
+
+	missingType := `{"storage":[{"label":"storedData","offset":0,"slot":"0","type":"t_uint256"}],"types":{}}`
+	_, err = ImportStorageLayout(missingType, "")
+	assert.EqualError(t, err, "invalid storage layout: unknown type t_uint256")
+
+	missingBase := `{"storage":[{"label":"values","offset":0,"slot":"0","type":"t_array(t_uint256)dyn_storage"}],"types":{"t_array(t_uint256)dyn_storage":{"base":"t_uint256","encoding":"dynamic_array","label":"uint256[]","numberOfBytes":"32"}}}`
+	_, err = ImportStorageLayout("======= a.sol:A =======\nContract Storage Layout:\n"+missingBase, "")
+	assert.EqualError(t, err, "invalid storage layout for contract a.sol:A: unknown type t_uint256")
+}
@@ -0,0 +1,30 @@
+pragma solidity ^0.6.5;
+
+contract Arrays {
+    uint256[] values;
+    uint8[5] packedFixed;
+    address[] holders;
+    uint16[] packedDynamic;
+    int256[][] nested;
+    bytes data;
+    string label;
+    bool[40] flags;
+
+    constructor() public {
+        values = [1, 2, 3];
+        packedFixed = [1, 2, 3, 4, 5];
+        holders.push(0x1349F3e1B8D71eFfb47B840594Ff27dA7E603d17);
+        holders.push(0x9D13C6D3aFE1721BEef56B55D303B09E021E27ab);
+        for (uint16 i = 0; i < 18; i++) {
+            packedDynamic.push(1000 + i);
+        }
+        nested.push([int256(1), -1]);
+        nested.push();
+        nested.push([int256(7)]);
+        for (uint8 i = 0; i < 40; i++) {
+            data.push(byte(i));
+            flags[i] = i % 3 == 0;
+        }
+        label = "short label";
+    }
+}
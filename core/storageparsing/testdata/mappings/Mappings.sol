@@ -0,0 +1,28 @@
+pragma solidity ^0.6.5;
+
+contract Mappings {
+    struct Member {
+        string name;
+        uint64 joined;
+        bool active;
+    }
+
+    mapping(address => uint256) balances;
+    mapping(address => mapping(address => uint256)) allowances;
+    mapping(string => Member) members;
+    mapping(uint256 => address[]) groups;
+    mapping(bytes32 => bool) seen;
+    uint256 count;
+
+    constructor() public {
+        address holder = 0x1349F3e1B8D71eFfb47B840594Ff27dA7E603d17;
+        address spender = 0x9D13C6D3aFE1721BEef56B55D303B09E021E27ab;
+        balances[holder] = 100;
+        allowances[holder][spender] = 50;
+        members["alice"] = Member("Alice", 1600000000, true);
+        groups[1].push(holder);
+        groups[1].push(spender);
+        seen[keccak256("tx")] = true;
+        count = 2;
+    }
+}
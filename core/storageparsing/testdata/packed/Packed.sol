@@ -0,0 +1,35 @@
+pragma solidity ^0.6.5;
+
+contract Packed {
+    enum Status { Pending, Active, Closed }
+
+    uint8 small;
+    uint16 medium;
+    bool flag;
+    address owner;
+    int24 delta;
+    bytes4 selector;
+    Status status;
+
+    uint128 low;
+    uint128 high;
+
+    int64 negative;
+    uint256 total;
+    bytes32 id;
+
+    constructor() public {
+        small = 7;
+        medium = 513;
+        flag = true;
+        owner = 0x1349F3e1B8D71eFfb47B840594Ff27dA7E603d17;
+        delta = -1000;
+        selector = 0xa9059cbb;
+        status = Status.Closed;
+        low = 1 ether;
+        high = uint128(-1);
+        negative = -42;
+        total = 12345678901234567890;
+        id = keccak256("packed");
+    }
+}
@@ -0,0 +1,29 @@
+pragma solidity ^0.6.5;
+
+contract Structs {
+    struct Position {
+        int32 x;
+        int32 y;
+        bool visible;
+    }
+
+    struct Account {
+        address owner;
+        uint96 balance;
+        string name;
+        Position position;
+        uint64[3] history;
+    }
+
+    Account admin;
+    Account[2] accounts;
+    Position origin;
+    uint8 version;
+
+    constructor() public {
+        admin = Account(0x1349F3e1B8D71eFfb47B840594Ff27dA7E603d17, 1000, "administrator", Position(-5, 12, true), [uint64(1), 2, 3]);
+        accounts[0] = Account(0x9D13C6D3aFE1721BEef56B55D303B09E021E27ab, 5, "a name that is longer than thirty one bytes, so it is stored apart", Position(3, -4, false), [uint64(10), 0, 30]);
+        origin.visible = true;
+        version = 3;
+    }
+}
@@ -21,15 +21,21 @@ var (
 	bytesStoragePrefix = "t_bytes_storage"
 	stringPrefix       = "t_string_storage"
 
-	arrayPrefix  = "t_array"
-	structPrefix = "t_struct"
+	arrayPrefix   = "t_array"
+	structPrefix  = "t_struct"
+	mappingPrefix = "t_mapping"
 )
 
+// MappingKeys are the keys looked up in mappings, by the label of the key type,
+// such as "address" or "uint256", as the keys of a mapping are not stored
+type MappingKeys map[string][]string
+
 type Parser struct {
 	storageManager StorageManager
 	template       types.SolidityStorageDocument
 
-	slotOffset types.Hash
+	slotOffset  types.Hash
+	mappingKeys MappingKeys
 }
 
 func NewParser(sm StorageManager, template types.SolidityStorageDocument, slotOffset types.Hash) *Parser {
@@ -44,6 +50,14 @@ func NewParser(sm StorageManager, template types.SolidityStorageDocument, slotOf
 	return parser
 }
 
+// newChildParser returns a parser for storage nested in the variables of this
+// parser, looking up the same mapping keys
+func (p *Parser) newChildParser(sm StorageManager, template types.SolidityStorageDocument, slotOffset types.Hash) *Parser {
+	child := NewParser(sm, template, slotOffset)
+	child.mappingKeys = p.mappingKeys
+	return child
+}
+
 func (p *Parser) ParseRawStorage() ([]*types.StorageItem, error) {
 	parsedStorage := []*types.StorageItem{}
 
@@ -127,6 +141,15 @@ func (p *Parser) parseSingle(storageItem types.SolidityStorageEntry) (interface{
 			return nil, err
 		}
 		result = res
+
+	case strings.HasPrefix(storageItem.Type, mappingPrefix):
+		res, err := p.ParseMapping(storageItem, namedType)
+		if err != nil {
+			return nil, err
+		}
+		if res != nil {
+			result = res
+		}
 	}
 
 	return result, nil
@@ -135,5 +158,7 @@ func (p *Parser) parseSingle(storageItem types.SolidityStorageEntry) (interface{
 func (p *Parser) ResolveSlot(givenSlot *big.Int) types.Hash {
 	offsetBytes, _ := hex.DecodeString(string(p.slotOffset))
 	combined := bigN(0).Add(new(big.Int).SetBytes(offsetBytes), givenSlot)
+	// slots wrap around, as the offset may be a hash near the end of storage
+	combined.Mod(combined, maxSlot)
 	return types.NewHash(hex.EncodeToString(combined.Bytes()))
 }
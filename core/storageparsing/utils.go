@@ -13,12 +13,18 @@ var (
 	BigOne       = new(big.Int).SetUint64(1)
 	BigTwo       = new(big.Int).SetUint64(2)
 	BigThirtyTwo = new(big.Int).SetUint64(32)
+
+	maxSlot = new(big.Int).Lsh(BigOne, 256)
 )
 
 func hash(slot types.Hash) types.Hash {
 	asBytes, _ := hex.DecodeString(string(slot))
+	return hashBytes(asBytes)
+}
+
+func hashBytes(data []byte) types.Hash {
 	hasher := sha3.NewLegacyKeccak256()
-	hasher.Write(asBytes)
+	hasher.Write(data)
 	return types.NewHash(hex.EncodeToString(hasher.Sum(nil)))
 }
 
@@ -0,0 +1,37 @@
+package storageparsing
+
+import (
+	"fmt"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// DecodeStorageValues parses the raw storage with the layout, and flattens it
+// into the values of its single-valued variables, naming the members of
+// structs by their path, e.g. "owner.name". Arrays, mappings and dynamic bytes
+// are left out, as they don't have one value to compare against.
+func DecodeStorageValues(rawStorage map[types.Hash]string, layout types.SolidityStorageDocument) ([]*types.StorageValue, error) {
+	// the parser sorts the storage layout in place, so it gets its own copy
+	layout.Storage = append(layout.Storage[:0:0], layout.Storage...)
+	items, err := ParseRawStorage(rawStorage, layout)
+	if err != nil {
+		return nil, err
+	}
+	return flattenStorage("", items), nil
+}
+
+func flattenStorage(prefix string, items []*types.StorageItem) []*types.StorageValue {
+	values := []*types.StorageValue{}
+	for _, item := range items {
+		name := prefix + item.VarName
+		switch value := item.Value.(type) {
+		case []*types.StorageItem:
+			values = append(values, flattenStorage(name+".", value)...)
+		case string, bool, uint64:
+			values = append(values, &types.StorageValue{Variable: name, Value: fmt.Sprint(value)})
+		case types.Address:
+			values = append(values, &types.StorageValue{Variable: name, Value: value.String()})
+		}
+	}
+	return values
+}
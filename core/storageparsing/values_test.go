@@ -0,0 +1,51 @@
+package storageparsing
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+func TestDecodeStorageValues(t *testing.T) {
+	var layout types.SolidityStorageDocument
+	assert.Nil(t, json.Unmarshal([]byte(storageABI), &layout))
+	var decodedStorage map[string]string
+	assert.Nil(t, json.Unmarshal([]byte(rawStorage), &decodedStorage))
+	storage := make(map[types.Hash]string)
+	for k, v := range decodedStorage {
+		storage[types.NewHash(k)] = v
+	}
+	labels := make([]string, len(layout.Storage))
+	for i, entry := range layout.Storage {
+		labels[i] = entry.Label
+	}
+
+	values, err := DecodeStorageValues(storage, layout)
+	assert.Nil(t, err)
+
+	decoded := make(map[string]string)
+	for _, value := range values {
+		decoded[value.Variable] = value.Value
+	}
+	assert.Equal(t, "42", decoded["a"])
+	assert.Equal(t, "-42", decoded["d"])
+	assert.Equal(t, "true", decoded["e"])
+	assert.Equal(t, "0xdcad3a6d3569df655070ded06cb7a1b2ccd1d3af", decoded["f"])
+	assert.Equal(t, "0x01", decoded["h1"])
+	assert.Equal(t, "mystring", decoded["i2"])
+	// struct members are named by their path
+	assert.Equal(t, "some addr", decoded["funder1.addr"])
+	assert.Equal(t, "56", decoded["funder1.amount"])
+	assert.Equal(t, "some addr fixed 1", decoded["longstruct2.otherStruct.addr"])
+	// arrays and mappings have no single value
+	assert.NotContains(t, decoded, "h6")
+	assert.NotContains(t, decoded, "map")
+
+	// the layout is left in its original order
+	for i, entry := range layout.Storage {
+		assert.Equal(t, labels[i], entry.Label)
+	}
+}
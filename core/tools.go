@@ -0,0 +1,232 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/core/backfill"
+	"quorumengineering/quorum-report/core/export"
+	"quorumengineering/quorum-report/core/filter"
+	"quorumengineering/quorum-report/core/monitor"
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/database/elasticsearch"
+	"quorumengineering/quorum-report/database/factory"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// Tools runs one-off maintenance tasks against the configured node and
+// database, without syncing new blocks or serving the API.
+type Tools struct {
+	monitor      *monitor.MonitorService
+	filter       *filter.FilterService
+	backfills    *backfill.Service
+	db           database.Database
+	quorumClient client.Client
+}
+
+func NewTools(config types.ReportingConfig) (*Tools, error) {
+	quorumClient, err := newClient(config)
+	if err != nil {
+		return nil, err
+	}
+	consensus, err := client.Consensus(quorumClient)
+	if err != nil {
+		quorumClient.Stop()
+		return nil, err
+	}
+
+	db, err := factory.NewFactory().Database(config.Database)
+	if err != nil {
+		quorumClient.Stop()
+		return nil, err
+	}
+	if err := registerConfigured(db, config); err != nil {
+		quorumClient.Stop()
+		return nil, err
+	}
+
+	monitorService, err := monitor.NewMonitorService(db, quorumClient, consensus, config)
+	if err != nil {
+		quorumClient.Stop()
+		return nil, err
+	}
+	filterService := filter.NewFilterService(db, quorumClient, nil)
+	return &Tools{
+		monitor:      monitorService,
+		filter:       filterService,
+		backfills:    backfill.NewService(db, monitorService, filterService),
+		db:           db,
+		quorumClient: quorumClient,
+	}, nil
+}
+
+// Backfill processes the blocks from and to (inclusive) again, returning once
+// it is done.
+func (t *Tools) Backfill(from, to uint64) error {
+	return t.backfills.Run(from, to)
+}
+
+// Reindex filters the blocks from and to (inclusive) again for a registered
+// address. A to of 0, or past the block the address has been filtered to,
+// reindexes up to that block.
+func (t *Tools) Reindex(address types.Address, from, to uint64) error {
+	addresses, err := t.db.GetAddresses()
+	if err != nil {
+		return err
+	}
+	if !containsAddress(addresses, address) {
+		return fmt.Errorf("address %s is not registered", address.String())
+	}
+	lastFiltered, err := t.db.GetLastFiltered(address)
+	if err != nil {
+		return err
+	}
+	if to == 0 || to > lastFiltered {
+		to = lastFiltered
+	}
+	if from == 0 || from > to {
+		return fmt.Errorf("nothing to reindex: address %s has been filtered to block %d", address.String(), lastFiltered)
+	}
+	return t.filter.Reindex(address, from, to, func(done uint64) {
+		log.Info("Reindex progress", "address", address.String(), "block", done, "end", to)
+	})
+}
+
+// Export writes the data of a contract in a block range to files in the
+// directory, one per dataset, returning the files once it is done.
+func (t *Tools) Export(request *types.ExportRequest, directory string) ([]string, error) {
+	exports := export.NewService(t.db, directory)
+	defer exports.Stop()
+	return exports.Run(request)
+}
+
+// Stop flushes the database writes and closes the connections, unless the
+// context is done first.
+func (t *Tools) Stop(ctx context.Context) {
+	t.monitor.Stop(ctx)
+	t.filter.Stop(ctx)
+	t.backfills.Stop()
+	if err := t.db.Stop(ctx); err != nil {
+		log.Error("Flushing database writes failed", "err", err)
+	}
+	t.quorumClient.Stop()
+}
+
+// Migrate brings the indices of the configured Elasticsearch database up to
+// date, reindexing any at an older version, and returns a description of each
+// change made.
+func Migrate(ctx context.Context, config types.ReportingConfig) ([]string, error) {
+	if config.Database == nil || config.Database.Elasticsearch == nil {
+		return nil, errors.New("only an Elasticsearch database can be migrated")
+	}
+	db, err := factory.NewFactory().NewElasticsearchDatabase(config.Database.Elasticsearch)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Stop(ctx)
+	return db.Migrate()
+}
+
+// Restore bootstraps a new Elasticsearch database from a snapshot of another
+// deployment's, then checks the restored data can be synced on from: it must
+// have the current schema version, every block up to its last persisted one,
+// and that block must be on the node's chain.
+func Restore(ctx context.Context, config types.ReportingConfig, repository, snapshot string) (*elasticsearch.SnapshotMetadata, error) {
+	if config.Database == nil || config.Database.Elasticsearch == nil {
+		return nil, errors.New("a snapshot can only be restored into an Elasticsearch database")
+	}
+	quorumClient, err := newClient(config)
+	if err != nil {
+		return nil, err
+	}
+	defer quorumClient.Stop()
+
+	dbFactory := factory.NewFactory()
+	apiClient, err := dbFactory.NewElasticsearchAPIClient(config.Database.Elasticsearch)
+	if err != nil {
+		return nil, err
+	}
+	if err := elasticsearch.RestoreSnapshot(apiClient, repository, snapshot); err != nil {
+		return nil, err
+	}
+	db, err := elasticsearch.New(apiClient)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Stop(ctx)
+
+	metadata, err := db.GetSnapshotMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return metadata, validateSnapshot(metadata, db.ReadBlock, quorumClient)
+}
+
+// DumpIndex writes every document of an index of the configured Elasticsearch
+// database to w as newline-delimited JSON, returning the number written.
+func DumpIndex(ctx context.Context, config types.ReportingConfig, index string, w io.Writer) (uint64, error) {
+	if config.Database == nil || config.Database.Elasticsearch == nil {
+		return 0, errors.New("only an Elasticsearch database can be dumped")
+	}
+	db, err := factory.NewFactory().NewElasticsearchDatabase(config.Database.Elasticsearch)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Stop(ctx)
+	return db.DumpIndex(index, w)
+}
+
+// LoadIndex writes the documents of an index dump into the configured
+// Elasticsearch database, returning the dump's header and the number loaded.
+func LoadIndex(ctx context.Context, config types.ReportingConfig, r io.Reader) (*elasticsearch.DumpHeader, uint64, error) {
+	if config.Database == nil || config.Database.Elasticsearch == nil {
+		return nil, 0, errors.New("a dump can only be loaded into an Elasticsearch database")
+	}
+	db, err := factory.NewFactory().NewElasticsearchDatabase(config.Database.Elasticsearch)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer db.Stop(ctx)
+	return db.LoadIndex(r)
+}
+
+func validateSnapshot(metadata *elasticsearch.SnapshotMetadata, readBlock func(uint64) (*types.Block, error), quorumClient client.Client) error {
+	if metadata.SchemaVersion < elasticsearch.SchemaVersion {
+		return fmt.Errorf("snapshot has schema version %d, run migrate to bring it up to version %d", metadata.SchemaVersion, elasticsearch.SchemaVersion)
+	}
+	if metadata.SchemaVersion > elasticsearch.SchemaVersion {
+		return fmt.Errorf("snapshot has schema version %d, newer than the supported version %d", metadata.SchemaVersion, elasticsearch.SchemaVersion)
+	}
+	if metadata.LastPersisted == 0 {
+		return errors.New("snapshot has no persisted blocks")
+	}
+	if metadata.Blocks != metadata.LastPersisted {
+		return fmt.Errorf("snapshot is missing %d of the blocks up to its last persisted block %d", metadata.LastPersisted-metadata.Blocks, metadata.LastPersisted)
+	}
+
+	stored, err := readBlock(metadata.LastPersisted)
+	if err != nil {
+		return fmt.Errorf("reading last persisted block %d: %v", metadata.LastPersisted, err)
+	}
+	onChain, err := client.BlockByNumber(quorumClient, metadata.LastPersisted)
+	if err != nil {
+		return fmt.Errorf("fetching block %d from the node: %v", metadata.LastPersisted, err)
+	}
+	if stored.Hash != onChain.Hash {
+		return fmt.Errorf("last persisted block %d of the snapshot is not on the node's chain", metadata.LastPersisted)
+	}
+	return nil
+}
+
+func containsAddress(addresses []types.Address, address types.Address) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
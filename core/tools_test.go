@@ -0,0 +1,59 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/client"
+	"quorumengineering/quorum-report/database/elasticsearch"
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestTools_Reindex_NotRegistered(t *testing.T) {
+	tools := &Tools{db: memory.NewMemoryDB()}
+
+	err := tools.Reindex(types.NewAddress("1"), 1, 0)
+	assert.EqualError(t, err, "address 0x0000000000000000000000000000000000000001 is not registered")
+}
+
+func TestValidateSnapshot(t *testing.T) {
+	quorumClient := client.NewStubQuorumClient(nil, map[string]interface{}{
+		"eth_getBlockByNumber0x64<bool Value>": types.RawBlock{Hash: types.NewHash("0xaa"), Number: 100},
+	})
+	readBlock := func(number uint64) (*types.Block, error) {
+		if number != 100 {
+			return nil, errors.New("not found")
+		}
+		return &types.Block{Hash: types.NewHash("0xaa"), Number: number}, nil
+	}
+	valid := elasticsearch.SnapshotMetadata{SchemaVersion: elasticsearch.SchemaVersion, LastPersisted: 100, Blocks: 100}
+
+	assert.Nil(t, validateSnapshot(&valid, readBlock, quorumClient))
+
+	old := valid
+	old.SchemaVersion = 0
+	assert.EqualError(t, validateSnapshot(&old, readBlock, quorumClient), "snapshot has schema version 0, run migrate to bring it up to version 2")
+
+	newer := valid
+	newer.SchemaVersion = 3
+	assert.EqualError(t, validateSnapshot(&newer, readBlock, quorumClient), "snapshot has schema version 3, newer than the supported version 2")
+
+	empty := elasticsearch.SnapshotMetadata{SchemaVersion: elasticsearch.SchemaVersion}
+	assert.EqualError(t, validateSnapshot(&empty, readBlock, quorumClient), "snapshot has no persisted blocks")
+
+	missing := valid
+	missing.Blocks = 97
+	assert.EqualError(t, validateSnapshot(&missing, readBlock, quorumClient), "snapshot is missing 3 of the blocks up to its last persisted block 100")
+
+	forked := func(number uint64) (*types.Block, error) {
+		return &types.Block{Hash: types.NewHash("0xbb"), Number: number}, nil
+	}
+	assert.EqualError(t, validateSnapshot(&valid, forked, quorumClient), "last persisted block 100 of the snapshot is not on the node's chain")
+
+	ahead := valid
+	ahead.LastPersisted, ahead.Blocks = 101, 101
+	assert.EqualError(t, validateSnapshot(&ahead, forked, quorumClient), "fetching block 101 from the node: not found")
+}
@@ -0,0 +1,345 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+	// queueSize is how many events can wait to be sent to each webhook, after
+	// which new events are dropped so a slow webhook can't hold up filtering
+	queueSize = 1000
+	// deliveries are retried with exponential backoff, starting from
+	// initialBackoff and capped at maxBackoff
+	maxDeliveryAttempts = 5
+	initialBackoff      = time.Second
+	maxBackoff          = time.Minute
+
+	// SignatureHeader carries the signature of a notification, as
+	// sha256=<hex HMAC-SHA256 of the body>
+	SignatureHeader = "X-Webhook-Signature"
+	signaturePrefix = "sha256="
+)
+
+var (
+	ErrInvalidSignature  = errors.New("webhook notification signature is not valid")
+	ErrStaleNotification = errors.New("webhook notification is too old")
+)
+
+type NotifierDB interface {
+	GetWebhooks() ([]*types.Webhook, error)
+	ReadTransaction(types.Hash) (*types.Transaction, error)
+	GetContractABI(types.Address) (string, error)
+}
+
+// delivery is an event to send, with the webhook as it was when the event
+// matched it
+type delivery struct {
+	webhook  types.Webhook
+	event    *types.ParsedEvent
+	sequence uint64
+}
+
+// webhookQueue holds the events waiting to be sent to a webhook, until the
+// webhook is removed
+type webhookQueue struct {
+	deliveries chan *delivery
+	removed    chan struct{}
+}
+
+// Notification is the body POSTed to a webhook for each matching event.
+type Notification struct {
+	WebhookID string `json:"webhookId"`
+	// the time the notifier started, in unix nanoseconds, which sequences
+	// start again from 1 at
+	Epoch uint64 `json:"epoch"`
+	// counts the events matched by the webhook since the notifier started,
+	// from 1, so receivers can tell events that were dropped or arrive out of
+	// order; retries keep the sequence of the event
+	Sequence uint64 `json:"sequence"`
+	// unix seconds the notification was sent at, set again on each retry
+	Timestamp uint64             `json:"timestamp"`
+	Event     *types.ParsedEvent `json:"event"`
+}
+
+// Notifier sends the parsed events of registered contracts to the webhooks
+// whose filter they match. Each webhook has its own queue, so its events are
+// sent in order, and a failing webhook doesn't delay the others. Events are
+// only kept in memory until sent, so those still queued at shutdown are lost.
+//
+// Notifications to webhooks with a secret are signed with it, so receivers
+// can check that they were sent by the notifier and, from their timestamp,
+// epoch and sequence, that they aren't being replayed.
+type Notifier struct {
+	db     NotifierDB
+	client *http.Client
+	epoch  uint64
+
+	maxAttempts    int
+	initialBackoff time.Duration
+
+	queues    map[string]*webhookQueue
+	sequences map[string]uint64
+	queueMux  sync.Mutex
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewNotifier(db NotifierDB) *Notifier {
+	return &Notifier{
+		db:             db,
+		client:         &http.Client{Timeout: requestTimeout},
+		epoch:          uint64(time.Now().UnixNano()),
+		maxAttempts:    maxDeliveryAttempts,
+		initialBackoff: initialBackoff,
+		queues:         make(map[string]*webhookQueue),
+		sequences:      make(map[string]uint64),
+		shutdownChan:   make(chan struct{}),
+	}
+}
+
+func (n *Notifier) Start() error {
+	log.Info("Starting webhook notifier")
+	return nil
+}
+
+func (n *Notifier) Stop() {
+	close(n.shutdownChan)
+	n.shutdownWg.Wait()
+	log.Info("Webhook notifier stopped")
+}
+
+// Notify queues the events of the given addresses in the blocks to be sent
+// to each webhook they match.
+func (n *Notifier) Notify(addresses []types.Address, blocks []*types.Block) error {
+	webhooks, err := n.db.GetWebhooks()
+	if err != nil {
+		return err
+	}
+	// webhooks can be deleted through any instance sharing the database
+	n.removeDeleted(webhooks)
+	if len(webhooks) == 0 {
+		return nil
+	}
+	registered := make(map[types.Address]bool, len(addresses))
+	for _, address := range addresses {
+		registered[address] = true
+	}
+
+	abis := make(map[types.Address]string)
+	for _, block := range blocks {
+		for _, txHash := range block.Transactions {
+			tx, err := n.db.ReadTransaction(txHash)
+			if err != nil {
+				return err
+			}
+			for _, event := range tx.Events {
+				if !registered[event.Address] {
+					continue
+				}
+				var parsedEvent *types.ParsedEvent
+				for _, webhook := range webhooks {
+					if !webhook.Matches(event) {
+						continue
+					}
+					if parsedEvent == nil {
+						if parsedEvent, err = n.parseEvent(event, block.Timestamp, abis); err != nil {
+							return err
+						}
+					}
+					n.enqueue(webhook, parsedEvent)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseEvent decodes the event with its contract's ABI, if it has one
+func (n *Notifier) parseEvent(event *types.Event, timestamp uint64, abis map[types.Address]string) (*types.ParsedEvent, error) {
+	parsedEvent := &types.ParsedEvent{RawEvent: event}
+	parsedEvent.SetTimestamp(timestamp)
+	contractABI, ok := abis[event.Address]
+	if !ok {
+		var err error
+		if contractABI, err = n.db.GetContractABI(event.Address); err != nil {
+			return nil, err
+		}
+		abis[event.Address] = contractABI
+	}
+	if contractABI != "" {
+		if err := parsedEvent.ParseEvent(contractABI); err != nil {
+			// an event the ABI doesn't describe is still sent undecoded
+			log.Debug("Unable to parse event", "address", event.Address.Hex(), "tx", event.TransactionHash.Hex(), "err", err)
+		}
+	}
+	return parsedEvent, nil
+}
+
+// RemoveWebhook stops sending events to a deleted webhook, dropping those
+// still queued for it.
+func (n *Notifier) RemoveWebhook(id string) {
+	n.queueMux.Lock()
+	defer n.queueMux.Unlock()
+	n.remove(id)
+}
+
+// removeDeleted removes the queues of webhooks that are no longer registered
+func (n *Notifier) removeDeleted(webhooks []*types.Webhook) {
+	registered := make(map[string]bool, len(webhooks))
+	for _, webhook := range webhooks {
+		registered[webhook.ID] = true
+	}
+	n.queueMux.Lock()
+	defer n.queueMux.Unlock()
+	for id := range n.queues {
+		if !registered[id] {
+			n.remove(id)
+		}
+	}
+}
+
+// remove must be called holding queueMux
+func (n *Notifier) remove(id string) {
+	if queue, ok := n.queues[id]; ok {
+		close(queue.removed)
+		delete(n.queues, id)
+	}
+	delete(n.sequences, id)
+}
+
+func (n *Notifier) enqueue(webhook *types.Webhook, event *types.ParsedEvent) {
+	n.queueMux.Lock()
+	defer n.queueMux.Unlock()
+	queue, ok := n.queues[webhook.ID]
+	if !ok {
+		queue = &webhookQueue{deliveries: make(chan *delivery, queueSize), removed: make(chan struct{})}
+		n.queues[webhook.ID] = queue
+		n.shutdownWg.Add(1)
+		go n.deliverAll(queue)
+	}
+	// an event dropped from a full queue still takes a sequence number, so
+	// the webhook sees the gap
+	n.sequences[webhook.ID]++
+	sequence := n.sequences[webhook.ID]
+
+	select {
+	case queue.deliveries <- &delivery{webhook: *webhook, event: event, sequence: sequence}:
+	default:
+		log.Warn("Webhook queue full, dropping event", "webhook", webhook.ID, "tx", event.RawEvent.TransactionHash.Hex(), "index", event.RawEvent.Index)
+	}
+}
+
+// deliverAll sends the queued events of a webhook, one at a time, until the
+// webhook is removed or shutdown
+func (n *Notifier) deliverAll(queue *webhookQueue) {
+	defer n.shutdownWg.Done()
+	for {
+		select {
+		case next := <-queue.deliveries:
+			// events queued before the webhook was removed aren't sent
+			select {
+			case <-queue.removed:
+				return
+			default:
+			}
+			if err := n.deliver(&next.webhook, next.event, next.sequence, queue.removed); err != nil {
+				log.Warn("Sending event to webhook failed", "webhook", next.webhook.ID, "url", next.webhook.URL,
+					"tx", next.event.RawEvent.TransactionHash.Hex(), "index", next.event.RawEvent.Index, "err", err)
+			}
+		case <-queue.removed:
+			return
+		case <-n.shutdownChan:
+			return
+		}
+	}
+}
+
+// deliver POSTs the event, retrying with backoff until it is accepted, the
+// attempts run out or the webhook is removed
+func (n *Notifier) deliver(webhook *types.Webhook, event *types.ParsedEvent, sequence uint64, removed <-chan struct{}) error {
+	notification := &Notification{WebhookID: webhook.ID, Epoch: n.epoch, Sequence: sequence, Event: event}
+	backoff := n.initialBackoff
+	for attempt := 1; ; attempt++ {
+		notification.Timestamp = uint64(time.Now().Unix())
+		body, err := json.Marshal(notification)
+		if err != nil {
+			return err
+		}
+		err = n.post(webhook, body)
+		if err == nil || attempt == n.maxAttempts {
+			return err
+		}
+		log.Debug("Retrying webhook", "webhook", webhook.ID, "attempt", attempt, "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-removed:
+			return err
+		case <-n.shutdownChan:
+			return err
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (n *Notifier) post(webhook *types.Webhook, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if webhook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign is the signature header of a notification body sent with the secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a notification received by a webhook, and
+// that it was sent no longer than maxAge ago, returning the notification. A
+// maxAge of 0 accepts notifications of any age. Receivers should also reject
+// sequences they have already seen in the same epoch, to guard against
+// replays within maxAge.
+func Verify(secret string, body []byte, signature string, maxAge time.Duration) (*Notification, error) {
+	if !hmac.Equal([]byte(Sign(secret, body)), []byte(signature)) {
+		return nil, ErrInvalidSignature
+	}
+	var notification Notification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return nil, err
+	}
+	if maxAge > 0 && time.Since(time.Unix(int64(notification.Timestamp), 0)) > maxAge {
+		return nil, ErrStaleNotification
+	}
+	return &notification, nil
+}
@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+var (
+	contract      = types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	otherContract = types.NewAddress("0x9d13c6d3afe1721beef56b55d303b09e021e27ab")
+	transferTopic = types.NewHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+)
+
+func TestNotifier_Notify(t *testing.T) {
+	var (
+		mux      sync.Mutex
+		received []Notification
+		requests int
+		done     = make(chan struct{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		requests++
+		if requests == 1 {
+			// the first attempt fails, and is retried
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		assert.Nil(t, err)
+		notification, err := Verify("secret", body, req.Header.Get(SignatureHeader), time.Minute)
+		assert.Nil(t, err)
+		received = append(received, *notification)
+		if len(received) == 2 {
+			close(done)
+		}
+	}))
+	defer server.Close()
+
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{contract, otherContract}))
+	assert.Nil(t, db.AddWebhook(&types.Webhook{ID: "transfers", URL: server.URL, Address: &contract, EventSignature: "Transfer(address,address,uint256)", Secret: "secret"}))
+
+	newEvent := func(index uint64, address types.Address, topic types.Hash, txHash string) *types.Event {
+		return &types.Event{
+			Index:           index,
+			Address:         address,
+			Topics:          []types.Hash{topic},
+			BlockHash:       types.NewHash(""),
+			TransactionHash: types.NewHash(txHash),
+		}
+	}
+	transfer := newEvent(0, contract, transferTopic, "1")
+	other := newEvent(1, contract, types.NewHash("2"), "1")
+	otherContractTransfer := newEvent(2, otherContract, transferTopic, "1")
+	secondTransfer := newEvent(0, contract, transferTopic, "2")
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{
+		{Hash: types.NewHash("1"), BlockNumber: 1, Events: []*types.Event{transfer, other, otherContractTransfer}},
+		{Hash: types.NewHash("2"), BlockNumber: 2, Events: []*types.Event{secondTransfer}},
+	}))
+	blocks := []*types.Block{
+		{Number: 1, Timestamp: 1000, Transactions: []types.Hash{types.NewHash("1")}},
+		{Number: 2, Timestamp: 2000, Transactions: []types.Hash{types.NewHash("2")}},
+	}
+
+	notifier := NewNotifier(db)
+	notifier.initialBackoff = 0
+	assert.Nil(t, notifier.Start())
+
+	// only the contract being indexed is notified about
+	assert.Nil(t, notifier.Notify([]types.Address{contract}, blocks))
+	<-done
+	notifier.Stop()
+
+	assert.Equal(t, 3, requests)
+	assert.Len(t, received, 2)
+	assert.Equal(t, "transfers", received[0].WebhookID)
+	// the retried event keeps its sequence number
+	assert.EqualValues(t, 1, received[0].Sequence)
+	// sequences are numbered within the run of the notifier
+	assert.Equal(t, notifier.epoch, received[0].Epoch)
+	assert.True(t, received[0].Epoch > 0)
+	assert.True(t, received[0].Timestamp > 0)
+	assert.Equal(t, transfer, received[0].Event.RawEvent)
+	assert.EqualValues(t, 1000, received[0].Event.Timestamp)
+	assert.EqualValues(t, 2, received[1].Sequence)
+	assert.Equal(t, received[0].Epoch, received[1].Epoch)
+	assert.Equal(t, secondTransfer, received[1].Event.RawEvent)
+	assert.EqualValues(t, 2000, received[1].Event.Timestamp)
+}
+
+func TestNotifier_RemoveWebhook(t *testing.T) {
+	var (
+		requests int
+		started  = make(chan struct{})
+		release  = make(chan struct{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	db := memory.NewMemoryDB()
+	webhook := &types.Webhook{ID: "transfers", URL: server.URL}
+	assert.Nil(t, db.AddWebhook(webhook))
+	notifier := NewNotifier(db)
+	// the failed delivery is only retried after the webhook is removed
+	notifier.initialBackoff = time.Hour
+
+	event := &types.ParsedEvent{RawEvent: &types.Event{Address: contract}}
+	notifier.enqueue(webhook, event)
+	notifier.enqueue(webhook, event)
+	<-started
+	notifier.RemoveWebhook("transfers")
+	close(release)
+
+	// the queued event isn't sent, and its goroutine has finished
+	notifier.Stop()
+	assert.Equal(t, 1, requests)
+	assert.Empty(t, notifier.queues)
+	assert.Empty(t, notifier.sequences)
+}
+
+func TestNotifier_Notify_RemovesDeletedWebhooks(t *testing.T) {
+	db := memory.NewMemoryDB()
+	notifier := NewNotifier(db)
+	notifier.initialBackoff = time.Hour
+
+	// a webhook deleted through another instance
+	webhook := &types.Webhook{ID: "deleted", URL: "http://127.0.0.1:0"}
+	notifier.enqueue(webhook, &types.ParsedEvent{RawEvent: &types.Event{Address: contract}})
+	assert.Len(t, notifier.queues, 1)
+
+	assert.Nil(t, notifier.Notify([]types.Address{contract}, nil))
+	assert.Empty(t, notifier.queues)
+	notifier.Stop()
+}
+
+func TestNotifier_Deliver_GivesUp(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	notifier := NewNotifier(memory.NewMemoryDB())
+	notifier.initialBackoff = 0
+
+	event := &types.ParsedEvent{RawEvent: &types.Event{Address: contract}}
+	err := notifier.deliver(&types.Webhook{ID: "failing", URL: server.URL}, event, 1, nil)
+
+	assert.EqualError(t, err, "webhook responded with status 500")
+	assert.Equal(t, maxDeliveryAttempts, requests)
+}
+
+func TestNotifier_Deliver_Unsigned(t *testing.T) {
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		signature = req.Header.Get(SignatureHeader)
+	}))
+	defer server.Close()
+
+	// webhooks registered before secrets were added have none
+	notifier := NewNotifier(memory.NewMemoryDB())
+	event := &types.ParsedEvent{RawEvent: &types.Event{Address: contract}}
+	assert.Nil(t, notifier.deliver(&types.Webhook{ID: "unsigned", URL: server.URL}, event, 1, nil))
+	assert.Empty(t, signature)
+}
+
+func TestVerify(t *testing.T) {
+	sent := func(age time.Duration) []byte {
+		body, _ := json.Marshal(&Notification{WebhookID: "transfers", Sequence: 7, Timestamp: uint64(time.Now().Add(-age).Unix())})
+		return body
+	}
+	body := sent(0)
+	signature := Sign("secret", body)
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", signature)
+
+	notification, err := Verify("secret", body, signature, time.Minute)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 7, notification.Sequence)
+
+	_, err = Verify("other secret", body, signature, time.Minute)
+	assert.Equal(t, ErrInvalidSignature, err)
+	_, err = Verify("secret", append(body, ' '), signature, time.Minute)
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	old := sent(time.Hour)
+	_, err = Verify("secret", old, Sign("secret", old), time.Minute)
+	assert.Equal(t, ErrStaleNotification, err)
+	_, err = Verify("secret", old, Sign("secret", old), 0)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,46 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// BatchKey is the key of the object holding the blocks from start to end
+// (inclusive)
+func BatchKey(prefix string, start uint64, end uint64) string {
+	return fmt.Sprintf("%sblocks-%d-%d.json.gz", prefix, start, end)
+}
+
+// EncodeBatch encodes the content of a batch as gzipped JSON
+func EncodeBatch(content *types.ArchivedBlocks) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(writer).Encode(content); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func DecodeBatch(encoded []byte) (*types.ArchivedBlocks, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	decompressed, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	var content types.ArchivedBlocks
+	if err := json.Unmarshal(decompressed, &content); err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
@@ -0,0 +1,124 @@
+package archive
+
+import (
+	"fmt"
+
+	"github.com/bluele/gcache"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// Database reads the blocks and transactions that have been archived back
+// from the object store when they are no longer in the database, so that they
+// are fetched the same as before they were archived. Batches that have been
+// read are kept in memory, as the blocks near one that is asked for usually
+// are too.
+//
+// Only blocks and transactions fetched one at a time, and the transactions of
+// blocks being indexed, are read back. Queries over ranges of blocks or
+// transactions only cover those in the database.
+type Database struct {
+	database.Database
+	store ObjectStore
+	// batches by key, holding the blocks by number and the transactions by
+	// hash
+	batches gcache.Cache
+}
+
+type archivedBatch struct {
+	blocks       map[uint64]*types.Block
+	transactions map[types.Hash]*types.Transaction
+}
+
+func NewDatabase(db database.Database, store ObjectStore, cacheSize int) *Database {
+	archiveDB := &Database{
+		Database: db,
+		store:    store,
+		batches:  gcache.New(cacheSize).LRU().Build(),
+	}
+	// blocks indexed for contracts registered from before the last archived
+	// block need their transactions back
+	db.SetArchiveReader(archiveDB.readArchivedTransaction)
+	return archiveDB
+}
+
+func (db *Database) ReadBlock(number uint64) (*types.Block, error) {
+	block, err := db.Database.ReadBlock(number)
+	if err == nil {
+		return block, nil
+	}
+	batch, archiveErr := db.Database.GetArchivedBatch(number)
+	if archiveErr == database.ErrNotFound {
+		return nil, err
+	}
+	if archiveErr != nil {
+		return nil, archiveErr
+	}
+	content, err := db.read(batch)
+	if err != nil {
+		return nil, err
+	}
+	if block, ok := content.blocks[number]; ok {
+		return block, nil
+	}
+	return nil, fmt.Errorf("block %d is missing from archived batch %s", number, batch.Key)
+}
+
+func (db *Database) ReadTransaction(hash types.Hash) (*types.Transaction, error) {
+	tx, err := db.Database.ReadTransaction(hash)
+	if err == nil {
+		return tx, nil
+	}
+	tx, archiveErr := db.readArchivedTransaction(hash)
+	if archiveErr == database.ErrNotFound {
+		return nil, err
+	}
+	return tx, archiveErr
+}
+
+// readArchivedTransaction reads a transaction that is no longer in the
+// database from the archive, returning ErrNotFound if it wasn't archived
+func (db *Database) readArchivedTransaction(hash types.Hash) (*types.Transaction, error) {
+	batch, err := db.Database.GetArchivedBatchForTransaction(hash)
+	if err != nil {
+		return nil, err
+	}
+	content, err := db.read(batch)
+	if err != nil {
+		return nil, err
+	}
+	if tx, ok := content.transactions[hash]; ok {
+		return tx, nil
+	}
+	return nil, fmt.Errorf("transaction %s is missing from archived batch %s", hash.String(), batch.Key)
+}
+
+// read fetches the batch from the object store, unless it is cached
+func (db *Database) read(batch *types.ArchivedBatch) (*archivedBatch, error) {
+	if cached, err := db.batches.Get(batch.Key); err == nil {
+		return cached.(*archivedBatch), nil
+	}
+	encoded, err := db.store.Get(batch.Key)
+	if err != nil {
+		return nil, fmt.Errorf("reading archived batch %s: %v", batch.Key, err)
+	}
+	content, err := DecodeBatch(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding archived batch %s: %v", batch.Key, err)
+	}
+	read := &archivedBatch{
+		blocks:       make(map[uint64]*types.Block, len(content.Blocks)),
+		transactions: make(map[types.Hash]*types.Transaction, len(content.Transactions)),
+	}
+	for _, block := range content.Blocks {
+		read.blocks[block.Number] = block
+	}
+	for _, tx := range content.Transactions {
+		read.transactions[tx.Hash] = tx
+	}
+	db.batches.Set(batch.Key, read)
+	log.Debug("Read archived batch", "key", batch.Key, "blocks", len(content.Blocks), "transactions", len(content.Transactions))
+	return read, nil
+}
@@ -0,0 +1,122 @@
+package archive
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+// fakeStore keeps the objects in memory, counting the reads
+type fakeStore struct {
+	objects map[string][]byte
+	gets    int
+}
+
+func (s *fakeStore) Put(key string, content []byte) error {
+	s.objects[key] = content
+	return nil
+}
+
+func (s *fakeStore) Get(key string) ([]byte, error) {
+	s.gets++
+	content, ok := s.objects[key]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	return content, nil
+}
+
+// sameContent checks that the content read back is what was archived, which
+// fills in the empty hashes and addresses
+func sameContent(t *testing.T, expected interface{}, actual interface{}) {
+	expectedChecksum, _ := types.Checksum(expected)
+	actualChecksum, _ := types.Checksum(actual)
+	assert.Equal(t, expectedChecksum, actualChecksum)
+}
+
+func TestDatabase_ReadArchived(t *testing.T) {
+	tx := &types.Transaction{Hash: types.NewHash("0x01"), BlockNumber: 1}
+	blocks := []*types.Block{{Number: 1, Transactions: []types.Hash{tx.Hash}}, {Number: 2}}
+	mem := memory.NewMemoryDB()
+	assert.Nil(t, mem.WriteTransactions([]*types.Transaction{tx}))
+	assert.Nil(t, mem.WriteBlocks(append(blocks, &types.Block{Number: 3})))
+
+	store := &fakeStore{objects: make(map[string][]byte)}
+	encoded, err := EncodeBatch(&types.ArchivedBlocks{Blocks: blocks, Transactions: []*types.Transaction{tx}})
+	assert.Nil(t, err)
+	key := BatchKey("reporting/", 1, 2)
+	assert.Equal(t, "reporting/blocks-1-2.json.gz", key)
+	assert.Nil(t, store.Put(key, encoded))
+	assert.Nil(t, mem.ArchiveBlocks(&types.ArchivedBatch{Key: key, StartBlock: 1, EndBlock: 2, Transactions: []types.Hash{tx.Hash}}))
+
+	db := NewDatabase(mem, store, 10)
+
+	block, err := db.ReadBlock(2)
+	assert.Nil(t, err)
+	sameContent(t, blocks[1], block)
+	block, err = db.ReadBlock(1)
+	assert.Nil(t, err)
+	sameContent(t, blocks[0], block)
+	readTx, err := db.ReadTransaction(tx.Hash)
+	assert.Nil(t, err)
+	sameContent(t, tx, readTx)
+	// the batch is only fetched once
+	assert.Equal(t, 1, store.gets)
+
+	// blocks still in the database are read from it, and those that are in
+	// neither aren't found
+	block, err = db.ReadBlock(3)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, block.Number)
+	_, err = db.ReadBlock(4)
+	assert.EqualError(t, err, "block does not exist")
+	_, err = db.ReadTransaction(types.NewHash("0x02"))
+	assert.EqualError(t, err, "transaction does not exist")
+	assert.Equal(t, 1, store.gets)
+}
+
+func TestDatabase_ReadArchived_MissingObject(t *testing.T) {
+	mem := memory.NewMemoryDB()
+	assert.Nil(t, mem.ArchiveBlocks(&types.ArchivedBatch{Key: "blocks-1-2.json.gz", StartBlock: 1, EndBlock: 2}))
+
+	db := NewDatabase(mem, &fakeStore{objects: make(map[string][]byte)}, 10)
+
+	_, err := db.ReadBlock(1)
+	assert.EqualError(t, err, "reading archived batch blocks-1-2.json.gz: no such key")
+}
+
+func TestDatabase_IndexArchivedBlocks(t *testing.T) {
+	contract := types.NewAddress("0x0000000000000000000000000000000000000001")
+	event := &types.Event{Address: contract, BlockNumber: 1, TransactionHash: types.NewHash("0x01")}
+	tx := &types.Transaction{Hash: types.NewHash("0x01"), BlockNumber: 1, To: contract, Events: []*types.Event{event}}
+	blocks := []*types.Block{{Number: 1, Transactions: []types.Hash{tx.Hash}}}
+	mem := memory.NewMemoryDB()
+	assert.Nil(t, mem.WriteTransactions([]*types.Transaction{tx}))
+	assert.Nil(t, mem.WriteBlocks(blocks))
+
+	store := &fakeStore{objects: make(map[string][]byte)}
+	encoded, err := EncodeBatch(&types.ArchivedBlocks{Blocks: blocks, Transactions: []*types.Transaction{tx}})
+	assert.Nil(t, err)
+	key := BatchKey("reporting/", 1, 1)
+	assert.Nil(t, store.Put(key, encoded))
+	assert.Nil(t, mem.ArchiveBlocks(&types.ArchivedBatch{Key: key, StartBlock: 1, EndBlock: 1, Transactions: []types.Hash{tx.Hash}}))
+
+	// without the archive, the block's transactions can't be indexed
+	assert.Nil(t, mem.AddAddresses([]types.Address{contract}))
+	assert.EqualError(t, mem.IndexBlocks([]types.Address{contract}, blocks), "transaction "+tx.Hash.Hex()+" does not exist")
+
+	// a contract registered from an archived block has it indexed from the
+	// archive
+	db := NewDatabase(mem, store, 10)
+	assert.Nil(t, db.IndexBlocks([]types.Address{contract}, blocks))
+	lastFiltered, err := db.GetLastFiltered(contract)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, lastFiltered)
+	events, err := db.GetAllEventsFromAddress(contract, &types.QueryOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	"quorumengineering/quorum-report/database"
 	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
 	"quorumengineering/quorum-report/types"
 )
@@ -44,6 +45,28 @@ func TestElasticsearchDB_AddTemplate(t *testing.T) {
 	assert.Nil(t, err, "expected error to be nil")
 }
 
+func TestElasticsearchDB_DeleteTemplate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	ex := esapi.DeleteRequest{
+		Index:      TemplateIndex,
+		DocumentID: "test template",
+		Refresh:    "true",
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewDeleteRequestMatcher(ex)).Return(nil, database.ErrNotFound)
+
+	db, _ := New(mockedClient)
+
+	err := db.DeleteTemplate("test template")
+
+	assert.Nil(t, err, "expected a missing template to be ignored")
+}
+
 func TestElasticsearchDB_AssignTemplate(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
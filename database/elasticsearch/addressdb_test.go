@@ -12,6 +12,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	"quorumengineering/quorum-report/database"
 	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
 	"quorumengineering/quorum-report/types"
 )
@@ -221,15 +222,77 @@ func TestElasticsearchDB_DeleteAddress_Delegates(t *testing.T) {
 	// simulate calling point of actually deleting address
 	// in the live app, this is done by GetLastPersistedBlockNumber()
 	go func() {
-		for len(db.deleteQueue) == 0 {
+		for {
+			db.deleteMux.Lock()
+			request, ok := db.deleteQueue[addr]
+			db.deleteMux.Unlock()
+			if ok {
+				request.wg.Done()
+				return
+			}
 		}
-		db.deleteQueue[addr].Done()
 	}()
 
-	err := db.DeleteAddress(addr)
+	err := db.DeleteAddress(addr, true)
 	assert.Nil(t, err, "expected error to be nil")
 }
 
+func TestElasticsearchDB_DeleteAddress_WithoutPurge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedDeleter := elasticsearchmocks.NewMockDeletionCoordinator(ctrl)
+
+	addr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().ScrollAllResults(ContractIndex, QueryDeletingAddressesTemplate).Return([]interface{}{}, nil)
+	mockedDeleter.EXPECT().Remove(addr)
+
+	db, _ := NewWithDeps(mockedClient, mockedDeleter)
+
+	go func() {
+		for {
+			db.deleteMux.Lock()
+			_, ok := db.deleteQueue[addr]
+			db.deleteMux.Unlock()
+			if ok {
+				db.processDeletions()
+				return
+			}
+		}
+	}()
+
+	err := db.DeleteAddress(addr, false)
+	assert.Nil(t, err)
+	assert.Empty(t, db.jobs.All())
+}
+
+func TestElasticsearchDB_DeleteAddress_AlreadyBeingDeleted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedDeleter := elasticsearchmocks.NewMockDeletionCoordinator(ctrl)
+
+	addr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+
+	db, _ := NewWithDeps(mockedClient, mockedDeleter)
+	db.jobs.Start(types.DeleteAddressJob, addr)
+
+	err := db.DeleteAddress(addr, true)
+	assert.Equal(t, database.ErrAddressBeingDeleted, err)
+
+	err = db.AddAddresses([]types.Address{addr})
+	assert.Equal(t, database.ErrAddressBeingDeleted, err)
+
+	err = db.AddAddressFrom(addr, 5)
+	assert.Equal(t, database.ErrAddressBeingDeleted, err)
+}
+
 func TestElasticsearchDB_GetAddresses_NoAddresses(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
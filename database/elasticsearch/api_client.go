@@ -2,11 +2,16 @@ package elasticsearch
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	elasticsearch7 "github.com/elastic/go-elasticsearch/v7"
@@ -14,6 +19,7 @@ import (
 	"github.com/elastic/go-elasticsearch/v7/esutil"
 
 	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/tracing"
 	"quorumengineering/quorum-report/types"
 )
 
@@ -24,40 +30,63 @@ type APIClient interface {
 	// DoRequest executes any operation type for ElasticSearch
 	DoRequest(req esapi.Request) ([]byte, error)
 	GetBulkHandler(index string) esutil.BulkIndexer
-	// CloseIndexers close all bulk update indexers
-	CloseIndexers()
+	// CloseIndexers flushes and closes all bulk update indexers, giving up
+	// once the context is done
+	CloseIndexers(ctx context.Context) error
 }
 
 type DefaultAPIClient struct {
 	client   *elasticsearch7.Client
-	indexers map[string]esutil.BulkIndexer
+	indexers map[string]*closableIndexer
+
+	// once the indexers are closed, writes queued on them are turned away,
+	// as a writer still running past a shutdown deadline would otherwise
+	// send on their closed queues
+	closed    bool
+	closedMux sync.RWMutex
 }
 
-func NewAPIClient(client *elasticsearch7.Client) (*DefaultAPIClient, error) {
+func NewAPIClient(client *elasticsearch7.Client, config *types.ElasticsearchConfig) (*DefaultAPIClient, error) {
 	apiClient := &DefaultAPIClient{
 		client:   client,
-		indexers: make(map[string]esutil.BulkIndexer),
+		indexers: make(map[string]*closableIndexer),
 	}
 
 	for _, idx := range AllIndexes {
 		indexer, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
-			Index:         idx,         // The default index name
-			Client:        client,      // The Elasticsearch client
-			NumWorkers:    1,           // The number of worker goroutines
-			FlushBytes:    1024 * 1024, // The flush threshold in bytes
-			FlushInterval: time.Second,
+			Index:         idx,                                                        // The default index name
+			Client:        client,                                                     // The Elasticsearch client
+			NumWorkers:    config.BulkWorkers,                                         // The number of worker goroutines
+			FlushBytes:    config.BulkFlushBytes,                                      // The flush threshold in bytes
+			FlushInterval: time.Duration(config.BulkFlushInterval) * time.Millisecond, // The periodic flush interval
+			OnFlushStart:  traceFlushStart(idx),
+			OnFlushEnd:    traceFlushEnd,
 		})
 		if err != nil {
 			return nil, err
 		}
 
-		apiClient.indexers[idx] = indexer
+		apiClient.indexers[idx] = &closableIndexer{BulkIndexer: indexer, client: apiClient}
 	}
 
 	return apiClient, nil
 }
 
 func NewClient(config elasticsearch7.Config) (*elasticsearch7.Client, error) {
+	if config.Transport == nil {
+		// requests made as part of a trace pass its context on to
+		// Elasticsearch, so the transport is set up here rather than by the
+		// client, which only adds the CA certificate to its own
+		httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+		if len(config.CACert) > 0 {
+			httpTransport.TLSClientConfig = &tls.Config{RootCAs: x509.NewCertPool()}
+			if !httpTransport.TLSClientConfig.RootCAs.AppendCertsFromPEM(config.CACert) {
+				return nil, errors.New("unable to add CA certificate")
+			}
+			config.CACert = nil
+		}
+		config.Transport = tracing.Transport(httpTransport)
+	}
 	return elasticsearch7.NewClient(config)
 }
 
@@ -83,6 +112,20 @@ func NewConfig(config *types.ElasticsearchConfig) (elasticsearch7.Config, error)
 	}, nil
 }
 
+// traceFlushStart starts a span for each flush of a bulk indexer. A flush
+// carries the documents of any writes queued since the last, so it is traced
+// on its own rather than as part of any of them.
+func traceFlushStart(index string) func(context.Context) context.Context {
+	return func(ctx context.Context) context.Context {
+		ctx, _ = tracing.StartClient(ctx, "elasticsearch bulk", tracing.String("db.system", "elasticsearch"), tracing.String("db.elasticsearch.index", index))
+		return ctx
+	}
+}
+
+func traceFlushEnd(ctx context.Context) {
+	tracing.FromContext(ctx).End()
+}
+
 func (c *DefaultAPIClient) ScrollAllResults(index string, query string) ([]interface{}, error) {
 	var (
 		scrollID string
@@ -159,13 +202,45 @@ func (c *DefaultAPIClient) DoRequest(req esapi.Request) ([]byte, error) {
 }
 
 func (c *DefaultAPIClient) GetBulkHandler(index string) esutil.BulkIndexer {
-	return c.indexers[index]
+	indexer, ok := c.indexers[index]
+	if !ok {
+		return nil
+	}
+	return indexer
 }
 
-func (c *DefaultAPIClient) CloseIndexers() {
-	for _, index := range c.indexers {
-		index.Close(context.Background())
+func (c *DefaultAPIClient) CloseIndexers(ctx context.Context) error {
+	// waits for any writes being queued
+	c.closedMux.Lock()
+	defer c.closedMux.Unlock()
+	if c.closed {
+		return nil
 	}
+	c.closed = true
+
+	var firstErr error
+	for name, index := range c.indexers {
+		if err := index.BulkIndexer.Close(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("closing %s indexer: %v", name, err)
+		}
+	}
+	return firstErr
+}
+
+// closableIndexer turns away the writes queued once its client's indexers
+// are closed
+type closableIndexer struct {
+	esutil.BulkIndexer
+	client *DefaultAPIClient
+}
+
+func (i *closableIndexer) Add(ctx context.Context, item esutil.BulkIndexerItem) error {
+	i.client.closedMux.RLock()
+	defer i.client.closedMux.RUnlock()
+	if i.client.closed {
+		return ErrClientClosed
+	}
+	return i.BulkIndexer.Add(ctx, item)
 }
 
 func (c *DefaultAPIClient) extractError(statusCode int, body io.ReadCloser) error {
@@ -182,6 +257,9 @@ func (c *DefaultAPIClient) extractError(statusCode int, body io.ReadCloser) erro
 			if errorObj["type"] == "index_not_found_exception" {
 				return ErrIndexNotFound
 			}
+			if errorObj["type"] == "version_conflict_engine_exception" {
+				return ErrVersionConflict
+			}
 			errorStr := fmt.Sprintf("[%d] %s: %s", statusCode, errorObj["type"], errorObj["reason"])
 			return fmt.Errorf("error response from Elasticsearch: %s", errorStr)
 		}
@@ -1,12 +1,15 @@
 package elasticsearch
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	elasticsearch7 "github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
 	"github.com/stretchr/testify/assert"
 
 	"quorumengineering/quorum-report/types"
@@ -90,3 +93,18 @@ func Test_NewConfigWithCertReadError(t *testing.T) {
 
 	assert.EqualError(t, err, fmt.Sprintf("open %s: no such file or directory", tmpfile.Name()))
 }
+
+func TestDefaultAPIClient_CloseIndexers_TurnsAwayWrites(t *testing.T) {
+	client, err := NewClient(elasticsearch7.Config{Addresses: []string{"http://localhost:9200"}})
+	assert.Nil(t, err)
+	apiClient, err := NewAPIClient(client, &types.ElasticsearchConfig{BulkWorkers: 1, BulkFlushInterval: 1000})
+	assert.Nil(t, err)
+
+	assert.Nil(t, apiClient.CloseIndexers(context.Background()))
+	// closing again doesn't close the queues twice
+	assert.Nil(t, apiClient.CloseIndexers(context.Background()))
+
+	// a write queued after closing fails rather than sending on a closed queue
+	err = apiClient.GetBulkHandler(BlockIndex).Add(context.Background(), esutil.BulkIndexerItem{Action: "index", DocumentID: "1", Body: strings.NewReader("{}")})
+	assert.Equal(t, ErrClientClosed, err)
+}
@@ -0,0 +1,113 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// ArchiveDB
+
+func (es *ElasticsearchDB) SetArchiveReader(reader func(types.Hash) (*types.Transaction, error)) {
+	es.archiveReader = reader
+}
+
+// readIndexedTransaction reads a transaction of a block being indexed, from
+// the archive if its block has been archived
+func (es *ElasticsearchDB) readIndexedTransaction(hash types.Hash) (*types.Transaction, error) {
+	tx, err := es.ReadTransaction(hash)
+	if err == database.ErrNotFound && es.archiveReader != nil {
+		return es.archiveReader(hash)
+	}
+	return tx, err
+}
+
+// ArchiveBlocks records the batch before deleting its blocks and
+// transactions, so that they can always be found, in the database or the
+// archive.
+func (es *ElasticsearchDB) ArchiveBlocks(batch *types.ArchivedBatch) error {
+	req := esapi.IndexRequest{
+		Index:      ArchiveIndex,
+		DocumentID: strconv.FormatUint(batch.StartBlock, 10),
+		Body:       esutil.NewJSONReader(batch),
+		Refresh:    "true",
+	}
+	if _, err := es.apiClient.DoRequest(req); err != nil {
+		return err
+	}
+
+	deletions := []struct {
+		index string
+		field string
+	}{
+		{BlockIndex, "number"},
+		{TransactionIndex, "blockNumber"},
+	}
+	for _, deletion := range deletions {
+		deleteReq := esapi.DeleteByQueryRequest{
+			Index:             []string{deletion.index},
+			Body:              strings.NewReader(fmt.Sprintf(QueryBlockRangeTemplate, deletion.field, batch.StartBlock, batch.EndBlock)),
+			Refresh:           &RequestParameterTrue,
+			WaitForCompletion: &RequestParameterTrue,
+		}
+		if _, err := es.apiClient.DoRequest(deleteReq); err != nil {
+			return fmt.Errorf("deleting archived %s documents: %v", deletion.index, err)
+		}
+	}
+	log.Info("Archived blocks", "start", batch.StartBlock, "end", batch.EndBlock, "key", batch.Key)
+	return nil
+}
+
+func (es *ElasticsearchDB) GetArchivedBatch(blockNumber uint64) (*types.ArchivedBatch, error) {
+	return es.findArchivedBatch(fmt.Sprintf(QueryArchivedBatchTemplate, blockNumber, blockNumber), nil)
+}
+
+func (es *ElasticsearchDB) GetArchivedBatchForTransaction(hash types.Hash) (*types.ArchivedBatch, error) {
+	return es.findArchivedBatch(fmt.Sprintf(QueryArchivedTransactionTemplate, hash.String()), nil)
+}
+
+func (es *ElasticsearchDB) GetLastArchivedBatch() (*types.ArchivedBatch, error) {
+	return es.findArchivedBatch(QueryAllArchivedBatchesTemplate, []string{"endBlock:desc"})
+}
+
+// findArchivedBatch returns the first batch the query matches in the sort
+// order
+func (es *ElasticsearchDB) findArchivedBatch(query string, sort []string) (*types.ArchivedBatch, error) {
+	size := 1
+	req := esapi.SearchRequest{
+		Index: []string{ArchiveIndex},
+		Body:  strings.NewReader(query),
+		Size:  &size,
+		Sort:  sort,
+	}
+	body, err := es.apiClient.DoRequest(req)
+	if err == ErrIndexNotFound {
+		// databases created before archiving was added have no index until
+		// the first batch is archived
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var results SearchQueryResult
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, err
+	}
+	if len(results.Hits.Hits) == 0 {
+		return nil, database.ErrNotFound
+	}
+	marshalled, _ := json.Marshal(results.Hits.Hits[0].Source)
+	var batch types.ArchivedBatch
+	if err := json.Unmarshal(marshalled, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
@@ -0,0 +1,126 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database"
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestElasticsearchDB_ArchiveBlocks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	batch := &types.ArchivedBatch{
+		Key:          "blocks-1000-1999.json.gz",
+		StartBlock:   1000,
+		EndBlock:     1999,
+		Transactions: []types.Hash{types.NewHash("0x01")},
+		ArchivedAt:   1600000000,
+	}
+	indexReq := esapi.IndexRequest{
+		Index:      ArchiveIndex,
+		DocumentID: "1000",
+		Body:       esutil.NewJSONReader(batch),
+		Refresh:    "true",
+	}
+	deleteBlocksReq := esapi.DeleteByQueryRequest{
+		Index: []string{BlockIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryBlockRangeTemplate, "number", 1000, 1999)),
+	}
+	deleteTransactionsReq := esapi.DeleteByQueryRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryBlockRangeTemplate, "blockNumber", 1000, 1999)),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(NewIndexRequestMatcher(indexReq)),
+		mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(deleteBlocksReq)),
+		mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(deleteTransactionsReq)),
+	)
+
+	db, _ := New(mockedClient)
+
+	assert.Nil(t, db.ArchiveBlocks(batch))
+}
+
+func TestElasticsearchDB_GetArchivedBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	size := 1
+	blockReq := esapi.SearchRequest{
+		Index: []string{ArchiveIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryArchivedBatchTemplate, 1500, 1500)),
+		Size:  &size,
+	}
+	transactionReq := esapi.SearchRequest{
+		Index: []string{ArchiveIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryArchivedTransactionTemplate, "0x0000000000000000000000000000000000000000000000000000000000000001")),
+		Size:  &size,
+	}
+	found := `{"hits":{"hits":[{"_source":{"key":"blocks-1000-1999.json.gz","startBlock":1000,"endBlock":1999,"transactions":["0x0000000000000000000000000000000000000000000000000000000000000001"],"archivedAt":1600000000}}]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(blockReq)).Return([]byte(found), nil),
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(transactionReq)).Return([]byte(`{"hits":{"hits":[]}}`), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return(nil, ErrIndexNotFound),
+	)
+
+	db, _ := New(mockedClient)
+
+	batch, err := db.GetArchivedBatch(1500)
+	assert.Nil(t, err)
+	assert.Equal(t, &types.ArchivedBatch{
+		Key:          "blocks-1000-1999.json.gz",
+		StartBlock:   1000,
+		EndBlock:     1999,
+		Transactions: []types.Hash{types.NewHash("0x01")},
+		ArchivedAt:   1600000000,
+	}, batch)
+
+	_, err = db.GetArchivedBatchForTransaction(types.NewHash("0x01"))
+	assert.Equal(t, database.ErrNotFound, err)
+
+	// nothing has been archived before the index is created
+	_, err = db.GetLastArchivedBatch()
+	assert.Equal(t, database.ErrNotFound, err)
+}
+
+func TestElasticsearchDB_ReadIndexedTransaction_Archived(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	hash := types.NewHash("0x01")
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(esapi.GetRequest{Index: TransactionIndex, DocumentID: hash.String()})).Return(nil, database.ErrNotFound).Times(2)
+
+	db, _ := New(mockedClient)
+
+	// without an archive, the transaction isn't found
+	_, err := db.readIndexedTransaction(hash)
+	assert.Equal(t, database.ErrNotFound, err)
+
+	archived := &types.Transaction{Hash: hash, BlockNumber: 1}
+	db.SetArchiveReader(func(types.Hash) (*types.Transaction, error) {
+		return archived, nil
+	})
+	tx, err := db.readIndexedTransaction(hash)
+	assert.Nil(t, err)
+	assert.Equal(t, archived, tx)
+}
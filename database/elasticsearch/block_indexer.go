@@ -1,6 +1,7 @@
 package elasticsearch
 
 import (
+	"quorumengineering/quorum-report/log"
 	"quorumengineering/quorum-report/types"
 )
 
@@ -11,6 +12,11 @@ type DefaultBlockIndexer struct {
 	// TODO: May convert all functions into an interface. DefaultBlockIndexer can then accept all database implementation and move to a util package.
 	createEvents    func([]*types.Event) error
 	readTransaction func(types.Hash) (*types.Transaction, error)
+	// optional, adds the enrichment fields of contracts to their documents;
+	// the documents are indexed without them if it fails
+	enrichDocuments func(map[types.Address]bool, []*types.Transaction) error
+	// optional, records who interacted with the contracts
+	recordCounterparties func(map[types.Address]bool, []*types.Transaction) error
 }
 
 func NewBlockIndexer(addresses []types.Address, blocks []*types.Block, db *ElasticsearchDB) *DefaultBlockIndexer {
@@ -20,10 +26,12 @@ func NewBlockIndexer(addresses []types.Address, blocks []*types.Block, db *Elast
 	}
 
 	return &DefaultBlockIndexer{
-		addresses:       addressMap,
-		blocks:          blocks,
-		createEvents:    db.createEvents,
-		readTransaction: db.ReadTransaction,
+		addresses:            addressMap,
+		blocks:               blocks,
+		createEvents:         db.createEvents,
+		readTransaction:      db.readIndexedTransaction,
+		enrichDocuments:      db.enrichDocuments,
+		recordCounterparties: db.recordCounterparties,
 	}
 }
 
@@ -33,7 +41,23 @@ func (indexer *DefaultBlockIndexer) Index() error {
 		return err
 	}
 
-	return indexer.indexEvents(allTransactions)
+	if err := indexer.indexEvents(allTransactions); err != nil {
+		return err
+	}
+	if indexer.recordCounterparties != nil {
+		if err := indexer.recordCounterparties(indexer.addresses, allTransactions); err != nil {
+			return err
+		}
+	}
+	if indexer.enrichDocuments == nil {
+		return nil
+	}
+	// the documents are already indexed, and a failure to enrich them must not
+	// hold up filtering the contracts
+	if err := indexer.enrichDocuments(indexer.addresses, allTransactions); err != nil {
+		log.Warn("Enriching indexed documents failed", "blocks", len(indexer.blocks), "err", err)
+	}
+	return nil
 }
 
 func (indexer *DefaultBlockIndexer) indexEvents(transactions []*types.Transaction) error {
@@ -116,3 +116,31 @@ func TestDefaultBlockIndexer_IndexTransaction_IndexEventsError(t *testing.T) {
 
 	assert.EqualError(t, err, "test error: createEvents")
 }
+
+func TestDefaultBlockIndexer_Index_EnrichmentErrorIgnored(t *testing.T) {
+	var indexedEvents []*types.Event
+
+	blockIndexer := &DefaultBlockIndexer{
+		addresses: map[types.Address]bool{types.NewAddress("0x9d13c6d3afe1721beef56b55d303b09e021e27ab"): true},
+		blocks:    []*types.Block{testIndexBlock},
+		createEvents: func(events []*types.Event) error {
+			indexedEvents = events
+			return nil
+		},
+		readTransaction: func(hash types.Hash) (*types.Transaction, error) {
+			if tx, ok := indexTransactionMap[hash.String()]; ok {
+				return tx, nil
+			}
+			return nil, errors.New("test error: not found")
+		},
+		enrichDocuments: func(map[types.Address]bool, []*types.Transaction) error {
+			return errors.New("test error: mapping conflict")
+		},
+	}
+
+	err := blockIndexer.Index()
+
+	// the events are indexed without their enrichment fields
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(indexedEvents))
+}
@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"strings"
-	"sync"
 	"testing"
 
 	"github.com/elastic/go-elasticsearch/v7/esapi"
@@ -14,6 +14,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	"quorumengineering/quorum-report/database"
 	elasticsearch_mocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
 	"quorumengineering/quorum-report/types"
 )
@@ -38,6 +39,12 @@ var testBlock = types.Block{
 	},
 }
 
+// blockDocument is the document a block is written as
+func blockDocument(block *types.Block) *Block {
+	document, _ := newBlockDocument(block)
+	return document
+}
+
 func TestElasticsearchDB_WriteBlock_WithError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -47,7 +54,7 @@ func TestElasticsearchDB_WriteBlock_WithError(t *testing.T) {
 	req := esapi.IndexRequest{
 		Index:      BlockIndex,
 		DocumentID: "10",
-		Body:       esutil.NewJSONReader(testBlock),
+		Body:       esutil.NewJSONReader(blockDocument(&testBlock)),
 		Refresh:    "true",
 	}
 
@@ -71,7 +78,7 @@ func TestElasticsearchDB_WriteBlock_ErrorFetchingLastPersisted(t *testing.T) {
 	req := esapi.IndexRequest{
 		Index:      BlockIndex,
 		DocumentID: "10",
-		Body:       esutil.NewJSONReader(testBlock),
+		Body:       esutil.NewJSONReader(blockDocument(&testBlock)),
 		Refresh:    "true",
 	}
 	lastPersistedRequest := esapi.GetRequest{
@@ -104,7 +111,7 @@ func TestElasticsearchDB_WriteBlock_NotSequential(t *testing.T) {
 	req := esapi.IndexRequest{
 		Index:      BlockIndex,
 		DocumentID: "10",
-		Body:       esutil.NewJSONReader(testBlock),
+		Body:       esutil.NewJSONReader(blockDocument(&testBlock)),
 		Refresh:    "true",
 	}
 	lastPersistedRequest := esapi.GetRequest{
@@ -137,7 +144,7 @@ func TestElasticsearchDB_WriteBlock_IsSequentialNotCaughtUp(t *testing.T) {
 	req := esapi.IndexRequest{
 		Index:      BlockIndex,
 		DocumentID: "10",
-		Body:       esutil.NewJSONReader(testBlock),
+		Body:       esutil.NewJSONReader(blockDocument(&testBlock)),
 		Refresh:    "true",
 	}
 	lastPersistedRequest := esapi.GetRequest{
@@ -183,7 +190,7 @@ func TestElasticsearchDB_WriteBlock_IsSequentialAndCaughtUp(t *testing.T) {
 	req := esapi.IndexRequest{
 		Index:      BlockIndex,
 		DocumentID: "10",
-		Body:       esutil.NewJSONReader(testBlock),
+		Body:       esutil.NewJSONReader(blockDocument(&testBlock)),
 		Refresh:    "true",
 	}
 	lastPersistedRequest := esapi.GetRequest{
@@ -238,7 +245,7 @@ func TestElasticsearchDB_WriteBlock_ErrorWritingLastPersisted(t *testing.T) {
 	req := esapi.IndexRequest{
 		Index:      BlockIndex,
 		DocumentID: "10",
-		Body:       esutil.NewJSONReader(testBlock),
+		Body:       esutil.NewJSONReader(blockDocument(&testBlock)),
 		Refresh:    "true",
 	}
 	lastPersistedRequest := esapi.GetRequest{
@@ -332,6 +339,68 @@ func TestElasticsearchDB_ReadBlock(t *testing.T) {
 	assert.Equal(t, &testBlock, block, "unexpected block output")
 }
 
+func TestElasticsearchDB_GetBlocksByTimeRange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+
+	options := &types.PageOptions{PageSize: 10, PageNumber: 2}
+	from := 20
+	req := esapi.SearchRequest{
+		Index: []string{BlockIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryBlocksByTimeRangeTemplate, 50, 150)),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"number:asc"},
+	}
+	source, _ := json.Marshal(blockDocument(&testBlock))
+	result := fmt.Sprintf(`{"hits":{"hits":[{"_source":%s}]}}`, source)
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(req)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+	blocks, err := db.GetBlocksByTimeRange(50, 150, options)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Block{&testBlock}, blocks)
+}
+
+func TestElasticsearchDB_GetBlocksByTimeRange_PaginationLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+
+	db, _ := New(mockedClient)
+	_, err := db.GetBlocksByTimeRange(50, 150, &types.PageOptions{PageSize: 100, PageNumber: 100})
+
+	assert.Equal(t, ErrPaginationLimitExceeded, err)
+}
+
+func TestElasticsearchDB_GetBlocksByTimeRangeTotal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+
+	req := esapi.CountRequest{
+		Index: []string{BlockIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryBlocksByTimeRangeTemplate, 50, 150)),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewCountRequestMatcher(req)).Return([]byte(`{"count": 12}`), nil)
+
+	db, _ := New(mockedClient)
+	total, err := db.GetBlocksByTimeRangeTotal(50, 150)
+
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(12), total)
+}
+
 func TestElasticsearchDB_WriteBlocks_NoBlock(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -355,7 +424,7 @@ func TestElasticsearchDB_WriteBlocks_SingleBlock(t *testing.T) {
 	req := esapi.IndexRequest{
 		Index:      BlockIndex,
 		DocumentID: "10",
-		Body:       esutil.NewJSONReader(testBlock),
+		Body:       esutil.NewJSONReader(blockDocument(&testBlock)),
 		Refresh:    "true",
 	}
 	lastPersistedRequest := esapi.GetRequest{
@@ -388,14 +457,14 @@ func TestElasticsearchDB_WriteBlocks_WithErrorOnLastPersisted(t *testing.T) {
 	p.Number = testBlock.Number + 1
 
 	req := esutil.BulkIndexerItem{
-		Action:     "create",
+		Action:     "index",
 		DocumentID: "10",
-		Body:       esutil.NewJSONReader(&testBlock),
+		Body:       esutil.NewJSONReader(blockDocument(&testBlock)),
 	}
 	req2 := esutil.BulkIndexerItem{
-		Action:     "create",
+		Action:     "index",
 		DocumentID: "11",
-		Body:       esutil.NewJSONReader(p),
+		Body:       esutil.NewJSONReader(blockDocument(p)),
 	}
 	lastPersistedRequest := esapi.GetRequest{
 		Index:      MetaIndex,
@@ -437,14 +506,14 @@ func TestElasticsearchDB_WriteBlocks_WithErrorOnBlockSave(t *testing.T) {
 	p.Number = testBlock.Number + 1
 
 	req := esutil.BulkIndexerItem{
-		Action:     "create",
+		Action:     "index",
 		DocumentID: "10",
-		Body:       esutil.NewJSONReader(&testBlock),
+		Body:       esutil.NewJSONReader(blockDocument(&testBlock)),
 	}
 	req2 := esutil.BulkIndexerItem{
-		Action:     "create",
+		Action:     "index",
 		DocumentID: "11",
-		Body:       esutil.NewJSONReader(p),
+		Body:       esutil.NewJSONReader(blockDocument(p)),
 	}
 
 	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
@@ -464,7 +533,7 @@ func TestElasticsearchDB_WriteBlocks_WithErrorOnBlockSave(t *testing.T) {
 
 	err := db.WriteBlocks([]*types.Block{&testBlock, p})
 
-	assert.EqualError(t, err, "test error")
+	assert.EqualError(t, err, "2 documents failed to be written, first error: test error")
 }
 
 func TestElasticsearchDB_WriteBlocks_MultipleBlocks(t *testing.T) {
@@ -479,14 +548,14 @@ func TestElasticsearchDB_WriteBlocks_MultipleBlocks(t *testing.T) {
 	p.Number = testBlock.Number + 1
 
 	req := esutil.BulkIndexerItem{
-		Action:     "create",
+		Action:     "index",
 		DocumentID: "10",
-		Body:       esutil.NewJSONReader(&testBlock),
+		Body:       esutil.NewJSONReader(blockDocument(&testBlock)),
 	}
 	req2 := esutil.BulkIndexerItem{
-		Action:     "create",
+		Action:     "index",
 		DocumentID: "11",
-		Body:       esutil.NewJSONReader(p),
+		Body:       esutil.NewJSONReader(blockDocument(p)),
 	}
 	lastPersistedRequest := esapi.GetRequest{
 		Index:      MetaIndex,
@@ -527,6 +596,9 @@ func TestElasticsearchDB_GetLastPersistedBlockNumber_NothingToDelete(t *testing.
 		DocumentID: "lastPersisted",
 	}
 	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().
+		ScrollAllResults(ContractIndex, QueryDeletingAddressesTemplate).
+		Return(nil, nil)
 	mockedClient.EXPECT().
 		DoRequest(NewGetRequestMatcher(lastPersistedRequest)).
 		Return([]byte(`{"_source":{"lastPersisted": 5}}`), nil)
@@ -547,27 +619,44 @@ func TestElasticsearchDB_GetLastPersistedBlockNumber_DeletingContractData(t *tes
 	mockedDeleter := elasticsearch_mocks.NewMockDeletionCoordinator(ctrl)
 
 	addressToDelete := types.NewAddress("1")
-	var deletionWg sync.WaitGroup
-	deletionWg.Add(1)
+	request := &deletionRequest{purge: true}
+	request.wg.Add(1)
 
 	lastPersistedRequest := esapi.GetRequest{
 		Index:      MetaIndex,
 		DocumentID: "lastPersisted",
 	}
 	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
-	mockedDeleter.EXPECT().Delete(addressToDelete).Return(nil)
+	mockedClient.EXPECT().
+		ScrollAllResults(ContractIndex, QueryDeletingAddressesTemplate).
+		Return(nil, nil)
+	mockedDeleter.EXPECT().Unregister(addressToDelete).Return(nil)
+	mockedDeleter.EXPECT().Delete(addressToDelete, gomock.Any()).
+		DoAndReturn(func(address types.Address, progress func(types.JobProgress)) error {
+			progress(types.JobProgress{Step: "events", Deleted: 3, Total: 4})
+			return nil
+		})
 	mockedClient.EXPECT().
 		DoRequest(NewGetRequestMatcher(lastPersistedRequest)).
 		Return([]byte(`{"_source":{"lastPersisted": 5}}`), nil)
 
 	db, _ := NewWithDeps(mockedClient, mockedDeleter)
-	db.deleteQueue[addressToDelete] = &deletionWg
+	db.deleteQueue[addressToDelete] = request
 
 	lastNum, err := db.GetLastPersistedBlockNumber()
+	db.deletions.Wait()
 
 	assert.Nil(t, err)
 	assert.EqualValues(t, 5, lastNum)
 	assert.Len(t, db.deleteQueue, 0)
+	assert.Nil(t, request.err)
+
+	jobs, _ := db.GetJobs()
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, types.JobCompleted, jobs[0].Status)
+	assert.Equal(t, addressToDelete, jobs[0].Address)
+	assert.EqualValues(t, 3, jobs[0].Deleted)
+	assert.EqualValues(t, 4, jobs[0].Total)
 }
 
 func TestElasticsearchDB_GetLastPersistedBlockNumber_DeletingContractData_WithError(t *testing.T) {
@@ -578,17 +667,231 @@ func TestElasticsearchDB_GetLastPersistedBlockNumber_DeletingContractData_WithEr
 	mockedDeleter := elasticsearch_mocks.NewMockDeletionCoordinator(ctrl)
 
 	addressToDelete := types.NewAddress("1")
-	var deletionWg sync.WaitGroup
+	request := &deletionRequest{purge: true}
+	request.wg.Add(1)
 
+	lastPersistedRequest := esapi.GetRequest{
+		Index:      MetaIndex,
+		DocumentID: "lastPersisted",
+	}
 	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
-	mockedDeleter.EXPECT().Delete(addressToDelete).Return(errors.New("test error"))
+	mockedClient.EXPECT().
+		ScrollAllResults(ContractIndex, QueryDeletingAddressesTemplate).
+		Return(nil, nil)
+	mockedDeleter.EXPECT().Unregister(addressToDelete).Return(errors.New("test error"))
+	mockedClient.EXPECT().
+		DoRequest(NewGetRequestMatcher(lastPersistedRequest)).
+		Return([]byte(`{"_source":{"lastPersisted": 5}}`), nil)
 
 	db, _ := NewWithDeps(mockedClient, mockedDeleter)
-	db.deleteQueue[addressToDelete] = &deletionWg
+	db.deleteQueue[addressToDelete] = request
 
 	lastNum, err := db.GetLastPersistedBlockNumber()
 
-	assert.EqualError(t, err, "error performing deletion of contract 0x0000000000000000000000000000000000000001")
-	assert.EqualValues(t, 0, lastNum)
-	assert.Len(t, db.deleteQueue, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 5, lastNum)
+	assert.Len(t, db.deleteQueue, 0)
+	assert.EqualError(t, request.err, "test error")
+
+	jobs, _ := db.GetJobs()
+	assert.Len(t, jobs, 0)
+}
+
+func TestElasticsearchDB_GetLastPersistedBlockNumber_ResumesDeletions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+	mockedDeleter := elasticsearch_mocks.NewMockDeletionCoordinator(ctrl)
+
+	addressToDelete := types.NewAddress("1")
+
+	lastPersistedRequest := esapi.GetRequest{
+		Index:      MetaIndex,
+		DocumentID: "lastPersisted",
+	}
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().
+		ScrollAllResults(ContractIndex, QueryDeletingAddressesTemplate).
+		Return([]interface{}{
+			map[string]interface{}{"_source": map[string]interface{}{"address": addressToDelete.String()}},
+		}, nil)
+	// fails first, and succeeds when retried
+	gomock.InOrder(
+		mockedDeleter.EXPECT().Delete(addressToDelete, gomock.Any()).Return(errors.New("test error")),
+		mockedDeleter.EXPECT().Delete(addressToDelete, gomock.Any()).Return(nil),
+	)
+	mockedClient.EXPECT().
+		DoRequest(NewGetRequestMatcher(lastPersistedRequest)).
+		Return([]byte(`{"_source":{"lastPersisted": 5}}`), nil).
+		Times(2)
+
+	db, _ := NewWithDeps(mockedClient, mockedDeleter)
+
+	_, err := db.GetLastPersistedBlockNumber()
+	assert.Nil(t, err)
+	db.deletions.Wait()
+
+	jobs, _ := db.GetJobs()
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, types.JobFailed, jobs[0].Status)
+	assert.Equal(t, "test error", jobs[0].Error)
+
+	// interrupted deletions are only looked for once
+	_, err = db.GetLastPersistedBlockNumber()
+	assert.Nil(t, err)
+
+	err = db.RetryJob(jobs[0].ID)
+	assert.Nil(t, err)
+	db.deletions.Wait()
+
+	job, _ := db.GetJob(jobs[0].ID)
+	assert.Equal(t, types.JobCompleted, job.Status)
+	assert.Equal(t, "", job.Error)
+
+	err = db.RetryJob(jobs[0].ID)
+	assert.Equal(t, database.ErrJobNotFailed, err)
+}
+
+func TestElasticsearchDB_RollbackToBlock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+
+	size := counterpartyRollbackPageSize
+	counterpartiesRequest := esapi.SearchRequest{
+		Index: []string{CounterpartyIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryCounterpartiesSeenAcrossBlockTemplate, 8, 8)),
+		Size:  &size,
+	}
+	deleteBlocksRequest := esapi.DeleteByQueryRequest{
+		Index: []string{BlockIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryAfterBlockTemplate, "number", 8)),
+	}
+	deleteBlockDataRequest := esapi.DeleteByQueryRequest{
+		Index: []string{TransactionIndex, EventIndex, StorageIndex, ERC20TokenIndex, ERC1155TokenIndex, ERC20AllowanceIndex, CallTreeIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryAfterBlockTemplate, "blockNumber", 8)),
+	}
+	deleteERC721Request := esapi.DeleteByQueryRequest{
+		Index: []string{ERC721TokenIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryAfterBlockTemplate, "heldFrom", 8)),
+	}
+	deleteCounterpartiesRequest := esapi.DeleteByQueryRequest{
+		Index: []string{CounterpartyIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryAfterBlockTemplate, "firstSeenBlock", 8)),
+	}
+	heldUntilRequest := esapi.UpdateByQueryRequest{
+		Index: []string{ERC20TokenIndex, ERC721TokenIndex, ERC1155TokenIndex, ERC20AllowanceIndex},
+		Body:  strings.NewReader(fmt.Sprintf(UpdateRemoveHeldUntilTemplate, 8)),
+	}
+	lastFilteredRequest := esapi.UpdateByQueryRequest{
+		Index: []string{ContractIndex},
+		Body:  strings.NewReader(fmt.Sprintf(UpdateLastFilteredAfterBlockTemplate, 8, 8)),
+	}
+	lastPersistedRequest := esapi.GetRequest{
+		Index:      MetaIndex,
+		DocumentID: "lastPersisted",
+	}
+	updateLastPersistedRequest := esapi.IndexRequest{
+		Index:      MetaIndex,
+		DocumentID: "lastPersisted",
+		Body:       strings.NewReader(`{"lastPersisted": 8}`),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().
+			DoRequest(NewSearchRequestMatcher(counterpartiesRequest)).
+			Return([]byte(`{"hits": {"hits": []}}`), nil),
+		mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(deleteBlocksRequest)),
+		mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(deleteBlockDataRequest)),
+		mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(deleteERC721Request)),
+		mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(deleteCounterpartiesRequest)),
+		mockedClient.EXPECT().DoRequest(NewUpdateByQueryRequestMatcher(heldUntilRequest)),
+		mockedClient.EXPECT().DoRequest(NewUpdateByQueryRequestMatcher(lastFilteredRequest)),
+		mockedClient.EXPECT().
+			DoRequest(NewGetRequestMatcher(lastPersistedRequest)).
+			Return([]byte(`{"_source": {"lastPersisted": 10}}`), nil),
+		mockedClient.EXPECT().DoRequest(NewIndexRequestMatcher(updateLastPersistedRequest)),
+	)
+
+	db, _ := New(mockedClient)
+
+	err := db.RollbackToBlock(8)
+
+	assert.Nil(t, err)
+}
+
+func TestElasticsearchDB_DeleteBlockRange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+
+	legalHolds := `{"hits":{"hits":[{"_source":{"id":"abc","fromBlock":5,"toBlock":6,"reason":"audit"}}]}}`
+	var requests []esapi.DeleteByQueryRequest
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return([]byte(legalHolds), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.DeleteByQueryRequest{})).
+			Do(func(req esapi.DeleteByQueryRequest) { requests = append(requests, req) }).
+			Return([]byte(`{"total": 3, "deleted": 3, "version_conflicts": 0}`), nil).
+			Times(6),
+	)
+
+	db, _ := New(mockedClient)
+
+	deletion, err := db.DeleteBlockRange(2, 8, false)
+	assert.Nil(t, err)
+	assert.Equal(t, &types.BlockRangeDeletion{
+		FromBlock: 2,
+		ToBlock:   8,
+		Documents: map[string]uint64{EventIndex: 3, StorageIndex: 3, ERC20TokenIndex: 3, ERC721TokenIndex: 3, ERC1155TokenIndex: 3, ERC20AllowanceIndex: 3},
+		Total:     18,
+	}, deletion)
+
+	assert.Len(t, requests, 6)
+	fields := map[string]string{EventIndex: "blockNumber", StorageIndex: "blockNumber", ERC20TokenIndex: "blockNumber", ERC721TokenIndex: "heldFrom", ERC1155TokenIndex: "blockNumber", ERC20AllowanceIndex: "blockNumber"}
+	for _, req := range requests {
+		field := fields[req.Index[0]]
+		body, _ := ioutil.ReadAll(req.Body)
+		// the blocks under legal hold are left out
+		assert.JSONEq(t, fmt.Sprintf(`{"query":{"bool":{
+			"must":{"range":{"%s":{"gte":2,"lte":8}}},
+			"must_not":[{"range":{"%s":{"gte":5,"lte":6}}}]
+		}}}`, field, field), string(body), req.Index[0])
+		assert.True(t, *req.WaitForCompletion)
+	}
+}
+
+func TestElasticsearchDB_DeleteBlockRange_DryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+
+	countRequest := esapi.CountRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryBlockRangeTemplate, "blockNumber", 2, 8)),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return(nil, ErrIndexNotFound),
+		mockedClient.EXPECT().DoRequest(NewCountRequestMatcher(countRequest)).Return([]byte(`{"count": 7}`), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.CountRequest{})).Return([]byte(`{"count": 1}`), nil).Times(5),
+	)
+
+	db, _ := New(mockedClient)
+
+	deletion, err := db.DeleteBlockRange(2, 8, true)
+	assert.Nil(t, err)
+	assert.Equal(t, &types.BlockRangeDeletion{
+		FromBlock: 2,
+		ToBlock:   8,
+		DryRun:    true,
+		Documents: map[string]uint64{EventIndex: 7, StorageIndex: 1, ERC20TokenIndex: 1, ERC721TokenIndex: 1, ERC1155TokenIndex: 1, ERC20AllowanceIndex: 1},
+		Total:     12,
+	}, deletion)
 }
@@ -0,0 +1,134 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+)
+
+// bulkDocument is a document to be written by a bulk write
+type bulkDocument struct {
+	id   string
+	body interface{}
+}
+
+// BulkItemError is the failure to write a single document of a bulk write,
+// either because the request failed or because Elasticsearch rejected it.
+type BulkItemError struct {
+	Index      string
+	DocumentID string
+	Status     int
+	Reason     string
+	Err        error
+}
+
+func (e *BulkItemError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("[%d] %s (%s/%s)", e.Status, e.Reason, e.Index, e.DocumentID)
+}
+
+// BulkError holds all the documents of a bulk write that failed.
+type BulkError struct {
+	Failures []*BulkItemError
+}
+
+func (e *BulkError) Error() string {
+	if len(e.Failures) == 1 {
+		return e.Failures[0].Error()
+	}
+	return fmt.Sprintf("%d documents failed to be written, first error: %s", len(e.Failures), e.Failures[0].Error())
+}
+
+// bulkCreate queues all documents on the bulk indexer for the index, and
+// waits until all of them have been flushed. Documents that already exist are
+// not counted as failures, so that retrying a partly written batch succeeds.
+func (es *ElasticsearchDB) bulkCreate(index string, documents []bulkDocument) error {
+	return es.bulkWrite(index, "create", documents)
+}
+
+// bulkIndex queues all documents on the bulk indexer for the index, replacing
+// any that already exist, and waits until all of them have been flushed. Chain
+// data is written this way, like single blocks and transactions are, so
+// writing a range again replaces what was there.
+func (es *ElasticsearchDB) bulkIndex(index string, documents []bulkDocument) error {
+	return es.bulkWrite(index, "index", documents)
+}
+
+// bulkUpdate sets the fields of each document body on the existing documents,
+// leaving their other fields as they are.
+func (es *ElasticsearchDB) bulkUpdate(index string, documents []bulkDocument) error {
+	updates := make([]bulkDocument, len(documents))
+	for i, document := range documents {
+		updates[i] = bulkDocument{id: document.id, body: map[string]interface{}{"doc": document.body}}
+	}
+	return es.bulkWrite(index, "update", updates)
+}
+
+func (es *ElasticsearchDB) bulkWrite(index string, action string, documents []bulkDocument) error {
+	if len(documents) == 0 {
+		return nil
+	}
+	bi := es.apiClient.GetBulkHandler(index)
+
+	var (
+		wg       sync.WaitGroup
+		mux      sync.Mutex
+		failures []*BulkItemError
+	)
+
+	wg.Add(len(documents))
+	for _, document := range documents {
+		// each document is finished exactly once, by its callback or by a
+		// failure to queue it
+		var once sync.Once
+		finish := func(failure *BulkItemError) {
+			once.Do(func() {
+				if failure != nil {
+					mux.Lock()
+					failures = append(failures, failure)
+					mux.Unlock()
+				}
+				wg.Done()
+			})
+		}
+
+		err := bi.Add(
+			context.Background(),
+			esutil.BulkIndexerItem{
+				Action:     action,
+				DocumentID: document.id,
+				Body:       esutil.NewJSONReader(document.body),
+				OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
+					finish(nil)
+				},
+				OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+					if err == nil && action == "create" && res.Status == http.StatusConflict {
+						finish(nil)
+						return
+					}
+					finish(&BulkItemError{
+						Index:      index,
+						DocumentID: item.DocumentID,
+						Status:     res.Status,
+						Reason:     res.Error.Type + ": " + res.Error.Reason,
+						Err:        err,
+					})
+				},
+			},
+		)
+		if err != nil {
+			finish(&BulkItemError{Index: index, DocumentID: document.id, Err: err})
+		}
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return &BulkError{Failures: failures}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+)
+
+// CheckpointDB
+
+// checkpoints are kept in the meta index, alongside the last persisted block
+func checkpointID(service string) string {
+	return "checkpoint-" + service
+}
+
+func (es *ElasticsearchDB) SetCheckpoint(service string, checkpoint string) error {
+	req := esapi.IndexRequest{
+		Index:      MetaIndex,
+		DocumentID: checkpointID(service),
+		Body:       esutil.NewJSONReader(map[string]string{"checkpoint": checkpoint}),
+		Refresh:    "true",
+	}
+	_, err := es.apiClient.DoRequest(req)
+	return err
+}
+
+func (es *ElasticsearchDB) GetCheckpoint(service string) (string, error) {
+	req := esapi.GetRequest{
+		Index:      MetaIndex,
+		DocumentID: checkpointID(service),
+	}
+	body, err := es.apiClient.DoRequest(req)
+	if err != nil {
+		return "", err
+	}
+	var result CheckpointResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	return result.Source.Checkpoint, nil
+}
@@ -0,0 +1,58 @@
+package elasticsearch
+
+import (
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database"
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+)
+
+func TestElasticsearchDB_SetCheckpoint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	ex := esapi.IndexRequest{
+		Index:      MetaIndex,
+		DocumentID: "checkpoint-configsync",
+		Body:       esutil.NewJSONReader(map[string]string{"checkpoint": "applied"}),
+		Refresh:    "true",
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewIndexRequestMatcher(ex))
+
+	db, _ := New(mockedClient)
+
+	err := db.SetCheckpoint("configsync", "applied")
+	assert.Nil(t, err)
+}
+
+func TestElasticsearchDB_GetCheckpoint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	ex := esapi.GetRequest{Index: MetaIndex, DocumentID: "checkpoint-configsync"}
+	missing := esapi.GetRequest{Index: MetaIndex, DocumentID: "checkpoint-kafka"}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(ex)).Return([]byte(`{"_source": {"checkpoint": "applied"}}`), nil)
+	mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(missing)).Return(nil, database.ErrNotFound)
+
+	db, _ := New(mockedClient)
+
+	checkpoint, err := db.GetCheckpoint("configsync")
+	assert.Nil(t, err)
+	assert.Equal(t, "applied", checkpoint)
+
+	_, err = db.GetCheckpoint("kafka")
+	assert.Equal(t, database.ErrNotFound, err)
+}
@@ -4,21 +4,71 @@ import "errors"
 
 // indices
 const (
-	MetaIndex        = "meta"
-	ContractIndex    = "contract"
-	TemplateIndex    = "template"
-	BlockIndex       = "block"
-	StorageIndex     = "storage"
-	TransactionIndex = "transaction"
-	EventIndex       = "event"
-	ERC20TokenIndex  = "erc20token"
-	ERC721TokenIndex = "erc721token"
+	MetaIndex           = "meta"
+	ContractIndex       = "contract"
+	TemplateIndex       = "template"
+	BlockIndex          = "block"
+	StorageIndex        = "storage"
+	TransactionIndex    = "transaction"
+	EventIndex          = "event"
+	ERC20TokenIndex     = "erc20token"
+	ERC721TokenIndex    = "erc721token"
+	ERC1155TokenIndex   = "erc1155token"
+	ERC20AllowanceIndex = "erc20allowance"
+	WebhookIndex        = "webhook"
+	JournalIndex        = "journal"
+	CounterpartyIndex   = "counterparty"
+	LegalHoldIndex      = "legalhold"
+	ArchiveIndex        = "archive"
+	CallTreeIndex       = "calltree"
+	TokenRuleIndex      = "tokenrule"
+	LeaseIndex          = "lease"
 )
 
+// SchemaVersion is the version of the indices and their mappings, recorded
+// when a database is created or migrated
+const SchemaVersion = 2
+
+// maxWebhooks is how many webhooks are fetched, which is the most a single
+// search can return
+const maxWebhooks = 10000
+
+// maxLegalHolds is how many legal holds are fetched, which is the most a
+// single search can return
+const maxLegalHolds = 10000
+
+// maxLeases is how many leases are fetched, which is the most a single search
+// can return
+const maxLeases = 10000
+
+// maxTokenRules is how many token rules are fetched, which is the most a
+// single search can return
+const maxTokenRules = 10000
+
+// maxTransactionRangeResults is the deepest page of transactions in a block
+// range that can be fetched, the default result window of Elasticsearch
+const maxTransactionRangeResults = 10000
+
+// maxBlockRangeResults is the deepest page of blocks in a time range that can
+// be fetched, the default result window of Elasticsearch
+const maxBlockRangeResults = 10000
+
+// storageValuesPageSize is how many storage documents are fetched at a time
+// when searching storage values
+const storageValuesPageSize = 1000
+
 var (
-	AllIndexes = []string{MetaIndex, ContractIndex, TemplateIndex, BlockIndex, StorageIndex, TransactionIndex, EventIndex, ERC20TokenIndex, ERC721TokenIndex}
+	AllIndexes = []string{MetaIndex, ContractIndex, TemplateIndex, BlockIndex, StorageIndex, TransactionIndex, EventIndex, ERC20TokenIndex, ERC721TokenIndex, ERC1155TokenIndex, ERC20AllowanceIndex, WebhookIndex, JournalIndex, CounterpartyIndex, LegalHoldIndex, ArchiveIndex, CallTreeIndex, TokenRuleIndex, LeaseIndex}
+	// indices reported on by GetIndexStats
+	StatsIndexes = []string{TransactionIndex, EventIndex, StorageIndex, ERC20TokenIndex, ERC721TokenIndex, ERC1155TokenIndex}
+	// indices compacted by Compact
+	// the same as types.CompactIndices, which configured merges are checked
+	// against
+	CompactIndexes = []string{BlockIndex, TransactionIndex, EventIndex, StorageIndex, ERC20TokenIndex, ERC721TokenIndex, ERC1155TokenIndex}
 	// errors
 	ErrCouldNotResolveResp     = errors.New("could not resolve response body")
 	ErrIndexNotFound           = errors.New("index not found")
+	ErrVersionConflict         = errors.New("version conflict")
 	ErrPaginationLimitExceeded = errors.New("pagination limit exceeded")
+	ErrClientClosed            = errors.New("elasticsearch client closed")
 )
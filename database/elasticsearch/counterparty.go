@@ -0,0 +1,267 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// maxCounterpartiesResults is the furthest into the counterparties of a
+// contract that can be paged, which is the most a search can return
+const maxCounterpartiesResults = 10000
+
+// counterpartyRollbackPageSize is how many counterparties are corrected at a
+// time when rolling back
+const counterpartyRollbackPageSize = 1000
+
+// counterpartySeenScript records the interactions in each block that hasn't
+// been recorded yet. Blocks are filtered in contiguous ranges for a contract,
+// so only blocks outside the first and last seen blocks can have unrecorded
+// interactions, and blocks indexed again aren't counted twice.
+const counterpartySeenScript = `
+def doc = ctx._source;
+if (doc.interactions == null) {
+	doc.contract = params.contract;
+	doc.address = params.address;
+	doc.interactions = 0;
+}
+def first = doc.firstSeenBlock;
+def last = doc.lastSeenBlock;
+boolean changed = false;
+for (seen in params.seen) {
+	if (first != null && seen.block >= first && seen.block <= last) {
+		continue;
+	}
+	changed = true;
+	doc.interactions += seen.interactions;
+	if (doc.firstSeenBlock == null || seen.block < doc.firstSeenBlock) {
+		doc.firstSeenBlock = seen.block;
+		doc.firstSeenTimestamp = seen.timestamp;
+	}
+	if (doc.lastSeenBlock == null || seen.block > doc.lastSeenBlock) {
+		doc.lastSeenBlock = seen.block;
+		doc.lastSeenTimestamp = seen.timestamp;
+	}
+}
+if (!changed) {
+	ctx.op = 'noop';
+}
+`
+
+// Counterparty is an address that has interacted with a registered contract
+type Counterparty struct {
+	Contract types.Address `json:"contract"`
+	types.Counterparty
+}
+
+// counterpartySeen is the interactions of a counterparty in a single block
+type counterpartySeen struct {
+	Block        uint64 `json:"block"`
+	Timestamp    uint64 `json:"timestamp"`
+	Interactions uint64 `json:"interactions"`
+}
+
+func counterpartyDocumentID(contract types.Address, counterparty types.Address) string {
+	return contract.String() + "-" + counterparty.String()
+}
+
+// recordCounterparties updates the first and last seen blocks and the
+// interactions of everyone that interacted with the filtered contracts in the
+// transactions
+func (es *ElasticsearchDB) recordCounterparties(addresses map[types.Address]bool, transactions []*types.Transaction) error {
+	type pair struct{ contract, counterparty types.Address }
+	seen := make(map[pair]map[uint64]*counterpartySeen)
+	var pairs []pair
+	for _, tx := range transactions {
+		contracts := map[types.Address]bool{tx.To: true}
+		for _, call := range tx.InternalCalls {
+			contracts[call.To] = true
+		}
+		for contract := range contracts {
+			if !addresses[contract] {
+				continue
+			}
+			for _, counterparty := range tx.Counterparties(contract) {
+				key := pair{contract, counterparty}
+				if seen[key] == nil {
+					seen[key] = make(map[uint64]*counterpartySeen)
+					pairs = append(pairs, key)
+				}
+				if block, ok := seen[key][tx.BlockNumber]; ok {
+					block.Interactions++
+					continue
+				}
+				seen[key][tx.BlockNumber] = &counterpartySeen{Block: tx.BlockNumber, Timestamp: tx.Timestamp, Interactions: 1}
+			}
+		}
+	}
+
+	documents := make([]bulkDocument, 0, len(pairs))
+	for _, key := range pairs {
+		blocks := make([]*counterpartySeen, 0, len(seen[key]))
+		for _, block := range seen[key] {
+			blocks = append(blocks, block)
+		}
+		sort.Slice(blocks, func(i, j int) bool { return blocks[i].Block < blocks[j].Block })
+
+		body := map[string]interface{}{
+			"scripted_upsert": true,
+			"upsert":          map[string]interface{}{},
+			"script": map[string]interface{}{
+				"source": counterpartySeenScript,
+				"lang":   "painless",
+				"params": map[string]interface{}{
+					"contract": key.contract.String(),
+					"address":  key.counterparty.String(),
+					"seen":     blocks,
+				},
+			},
+		}
+		documents = append(documents, bulkDocument{id: counterpartyDocumentID(key.contract, key.counterparty), body: body})
+	}
+	return es.bulkWrite(CounterpartyIndex, "update", documents)
+}
+
+func (es *ElasticsearchDB) GetCounterparties(address types.Address, options *types.CounterpartyQueryOptions) ([]*types.Counterparty, error) {
+	from := options.PageSize * options.PageNumber
+	if from+options.PageSize > maxCounterpartiesResults {
+		return nil, ErrPaginationLimitExceeded
+	}
+	sortBy := []string{"lastSeenBlock:desc", "address.keyword:asc"}
+	if options.SortBy == types.SortByVolume {
+		sortBy = append([]string{"interactions:desc"}, sortBy...)
+	}
+	req := esapi.SearchRequest{
+		Index: []string{CounterpartyIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryByContractTemplate, address.String())),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  sortBy,
+	}
+	results, err := es.doSearchRequest(req)
+	if err == ErrIndexNotFound {
+		// databases created before counterparties were recorded have no index
+		// until the first is recorded
+		return []*types.Counterparty{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	counterparties := make([]*types.Counterparty, 0, len(results.Hits.Hits))
+	for _, result := range results.Hits.Hits {
+		counterparty, err := decodeCounterparty(result.Source)
+		if err != nil {
+			return nil, err
+		}
+		counterparties = append(counterparties, &counterparty.Counterparty)
+	}
+	return counterparties, nil
+}
+
+// rollbackCounterparties removes the interactions after the block from the
+// counterparties last seen after it, using the transactions still stored, so
+// it must run before they are deleted. Counterparties first seen after the
+// block are deleted along with the other documents after it.
+func (es *ElasticsearchDB) rollbackCounterparties(blockNumber uint64) error {
+	size := counterpartyRollbackPageSize
+	for {
+		// corrected counterparties no longer match
+		req := esapi.SearchRequest{
+			Index: []string{CounterpartyIndex},
+			Body:  strings.NewReader(fmt.Sprintf(QueryCounterpartiesSeenAcrossBlockTemplate, blockNumber, blockNumber)),
+			Size:  &size,
+		}
+		results, err := es.doSearchRequest(req)
+		if err == ErrIndexNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(results.Hits.Hits) == 0 {
+			return nil
+		}
+		for _, result := range results.Hits.Hits {
+			counterparty, err := decodeCounterparty(result.Source)
+			if err != nil {
+				return err
+			}
+			if err := es.rollbackCounterparty(counterparty, blockNumber); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (es *ElasticsearchDB) rollbackCounterparty(counterparty *Counterparty, blockNumber uint64) error {
+	contract, address := counterparty.Contract.String(), counterparty.Address.String()
+	countReq := esapi.CountRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryCounterpartyInteractionsTemplate, blockNumber, counterparty.LastSeenBlock, contract, address, contract, address)),
+	}
+	removed, err := es.doCountRequest(countReq)
+	if err != nil {
+		return err
+	}
+
+	// the latest interaction left is the last seen
+	size := 1
+	searchReq := esapi.SearchRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryCounterpartyInteractionsTemplate, 0, blockNumber, contract, address, contract, address)),
+		Size:  &size,
+		Sort:  []string{"blockNumber:desc"},
+	}
+	results, err := es.doSearchRequest(searchReq)
+	if err != nil {
+		return err
+	}
+	counterparty.LastSeenBlock = counterparty.FirstSeenBlock
+	counterparty.LastSeenTimestamp = counterparty.FirstSeenTimestamp
+	if len(results.Hits.Hits) > 0 {
+		marshalled, _ := json.Marshal(results.Hits.Hits[0].Source)
+		var tx types.Transaction
+		if err := json.Unmarshal(marshalled, &tx); err != nil {
+			return err
+		}
+		counterparty.LastSeenBlock = tx.BlockNumber
+		counterparty.LastSeenTimestamp = tx.Timestamp
+	}
+	if removed.Count < counterparty.Interactions {
+		counterparty.Interactions -= removed.Count
+	} else {
+		// the interaction it was first seen at is still there
+		counterparty.Interactions = 1
+	}
+
+	body, err := json.Marshal(counterparty)
+	if err != nil {
+		return err
+	}
+	req := esapi.IndexRequest{
+		Index:      CounterpartyIndex,
+		DocumentID: counterpartyDocumentID(counterparty.Contract, counterparty.Address),
+		Body:       strings.NewReader(string(body)),
+		Refresh:    "true",
+	}
+	if _, err := es.apiClient.DoRequest(req); err != nil {
+		return err
+	}
+	log.Debug("Rolled back counterparty", "contract", contract, "counterparty", address, "lastSeen", counterparty.LastSeenBlock)
+	return nil
+}
+
+func decodeCounterparty(source map[string]interface{}) (*Counterparty, error) {
+	marshalled, _ := json.Marshal(source)
+	var counterparty Counterparty
+	if err := json.Unmarshal(marshalled, &counterparty); err != nil {
+		return nil, err
+	}
+	return &counterparty, nil
+}
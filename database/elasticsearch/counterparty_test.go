@@ -0,0 +1,170 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestElasticsearchDB_RecordCounterparties(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedBulkIndexer := elasticsearchmocks.NewMockBulkIndexer(ctrl)
+
+	contract := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	other := types.NewAddress("0x9d13c6d3afe1721beef56b55d303b09e021e27ab")
+	sender := types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d")
+	caller := types.NewAddress("0xca843569e3427144cead5e4d5999a3d0ccf92b8e")
+	transactions := []*types.Transaction{
+		{BlockNumber: 5, Timestamp: 500, From: sender, To: contract},
+		// a second transaction in the same block, which calls the contract back
+		{BlockNumber: 5, Timestamp: 500, From: sender, To: contract, InternalCalls: []*types.InternalCall{{From: contract, To: contract}}},
+		{BlockNumber: 6, Timestamp: 600, From: sender, To: other, InternalCalls: []*types.InternalCall{{From: caller, To: contract}, {From: caller, To: contract}}},
+		{BlockNumber: 7, Timestamp: 700, From: sender, To: contract},
+	}
+
+	documents := make(map[string]map[string]interface{})
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().GetBulkHandler(CounterpartyIndex).Return(mockedBulkIndexer)
+	mockedBulkIndexer.EXPECT().Add(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, item esutil.BulkIndexerItem) error {
+		assert.Equal(t, "update", item.Action)
+		var body map[string]interface{}
+		raw, _ := ioutil.ReadAll(item.Body)
+		assert.Nil(t, json.Unmarshal(raw, &body))
+		documents[item.DocumentID] = body
+		item.OnSuccess(context.Background(), item, esutil.BulkIndexerResponseItem{})
+		return nil
+	}).Times(2)
+
+	db, _ := New(mockedClient)
+
+	err := db.recordCounterparties(map[types.Address]bool{contract: true}, transactions)
+	assert.Nil(t, err)
+
+	assert.Len(t, documents, 2)
+	senderDoc := documents[counterpartyDocumentID(contract, sender)]
+	assert.Equal(t, true, senderDoc["scripted_upsert"])
+	params := senderDoc["script"].(map[string]interface{})["params"].(map[string]interface{})
+	assert.Equal(t, contract.String(), params["contract"])
+	assert.Equal(t, sender.String(), params["address"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"block": float64(5), "timestamp": float64(500), "interactions": float64(2)},
+		map[string]interface{}{"block": float64(7), "timestamp": float64(700), "interactions": float64(1)},
+	}, params["seen"])
+
+	callerDoc := documents[counterpartyDocumentID(contract, caller)]
+	params = callerDoc["script"].(map[string]interface{})["params"].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"block": float64(6), "timestamp": float64(600), "interactions": float64(1)},
+	}, params["seen"])
+}
+
+func TestElasticsearchDB_GetCounterparties(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	contract := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	result := `{"hits":{"hits":[{"_source":{"contract":"0x1349f3e1b8d71effb47b840594ff27da7e603d17","address":"0xed9d02e382b34818e88b88a309c7fe71e65f419d","firstSeenBlock":5,"firstSeenTimestamp":500,"lastSeenBlock":7,"lastSeenTimestamp":700,"interactions":3}}]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(gomock.Any()).DoAndReturn(func(req esapi.Request) ([]byte, error) {
+		searchReq := req.(esapi.SearchRequest)
+		assert.Equal(t, []string{CounterpartyIndex}, searchReq.Index)
+		assert.Equal(t, []string{"interactions:desc", "lastSeenBlock:desc", "address.keyword:asc"}, searchReq.Sort)
+		assert.Equal(t, 20, *searchReq.From)
+		body, _ := ioutil.ReadAll(searchReq.Body)
+		assert.Equal(t, fmt.Sprintf(QueryByContractTemplate, contract.String()), string(body))
+		return []byte(result), nil
+	})
+
+	db, _ := New(mockedClient)
+
+	counterparties, err := db.GetCounterparties(contract, &types.CounterpartyQueryOptions{SortBy: types.SortByVolume, PageSize: 10, PageNumber: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Counterparty{{
+		Address:            types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d"),
+		FirstSeenBlock:     5,
+		FirstSeenTimestamp: 500,
+		LastSeenBlock:      7,
+		LastSeenTimestamp:  700,
+		Interactions:       3,
+	}}, counterparties)
+}
+
+func TestElasticsearchDB_GetCounterparties_NoIndex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(gomock.Any()).Return(nil, ErrIndexNotFound)
+
+	db, _ := New(mockedClient)
+
+	counterparties, err := db.GetCounterparties(types.NewAddress("1"), &types.CounterpartyQueryOptions{SortBy: types.SortByRecency, PageSize: 10})
+	assert.Nil(t, err)
+	assert.Empty(t, counterparties)
+}
+
+func TestElasticsearchDB_RollbackCounterparties(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	contract := "0x1349f3e1b8d71effb47b840594ff27da7e603d17"
+	address := "0xed9d02e382b34818e88b88a309c7fe71e65f419d"
+	size := counterpartyRollbackPageSize
+	counterpartiesRequest := func() esapi.SearchRequest {
+		return esapi.SearchRequest{
+			Index: []string{CounterpartyIndex},
+			Body:  strings.NewReader(fmt.Sprintf(QueryCounterpartiesSeenAcrossBlockTemplate, 8, 8)),
+			Size:  &size,
+		}
+	}
+	counterparties := `{"hits":{"hits":[{"_source":{"contract":"` + contract + `","address":"` + address + `","firstSeenBlock":5,"firstSeenTimestamp":500,"lastSeenBlock":10,"lastSeenTimestamp":1000,"interactions":4}}]}}`
+	countRequest := esapi.CountRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryCounterpartyInteractionsTemplate, 8, 10, contract, address, contract, address)),
+	}
+	latestSize := 1
+	latestRequest := esapi.SearchRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryCounterpartyInteractionsTemplate, 0, 8, contract, address, contract, address)),
+		Size:  &latestSize,
+	}
+	updateRequest := esapi.IndexRequest{
+		Index:      CounterpartyIndex,
+		DocumentID: contract + "-" + address,
+		Body:       strings.NewReader(`{"contract":"` + contract + `","address":"` + address + `","firstSeenBlock":5,"firstSeenTimestamp":500,"lastSeenBlock":7,"lastSeenTimestamp":700,"interactions":2}`),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(counterpartiesRequest())).Return([]byte(counterparties), nil),
+		mockedClient.EXPECT().DoRequest(NewCountRequestMatcher(countRequest)).Return([]byte(`{"count": 2}`), nil),
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(latestRequest)).Return([]byte(`{"hits":{"hits":[{"_source":{"blockNumber":7,"timestamp":700}}]}}`), nil),
+		mockedClient.EXPECT().DoRequest(NewIndexRequestMatcher(updateRequest)),
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(counterpartiesRequest())).Return([]byte(`{"hits":{"hits":[]}}`), nil),
+	)
+
+	db, _ := New(mockedClient)
+
+	err := db.rollbackCounterparties(8)
+	assert.Nil(t, err)
+}
@@ -22,7 +22,22 @@ type ElasticsearchDB struct {
 	deleter   DeletionCoordinator
 
 	deleteMux   sync.Mutex
-	deleteQueue map[types.Address]*sync.WaitGroup
+	deleteQueue map[types.Address]*deletionRequest
+	// whether deletions interrupted by a restart have been restarted
+	deletionsResumed bool
+	jobs             *database.JobTracker
+	// running deletions, so tests can wait for them
+	deletions sync.WaitGroup
+	// reads back the transactions of archived blocks, if any are archived
+	archiveReader func(types.Hash) (*types.Transaction, error)
+}
+
+// deletionRequest waits for an address to be unregistered, which happens
+// between filtering blocks
+type deletionRequest struct {
+	purge bool
+	wg    sync.WaitGroup
+	err   error
 }
 
 func New(client APIClient) (*ElasticsearchDB, error) {
@@ -33,7 +48,8 @@ func NewWithDeps(client APIClient, dataDeleter DeletionCoordinator) (*Elasticsea
 	db := &ElasticsearchDB{
 		apiClient:   client,
 		deleter:     dataDeleter,
-		deleteQueue: make(map[types.Address]*sync.WaitGroup),
+		deleteQueue: make(map[types.Address]*deletionRequest),
+		jobs:        database.NewJobTracker(),
 	}
 
 	initialized, err := db.checkIsInitialized()
@@ -51,23 +67,18 @@ func NewWithDeps(client APIClient, dataDeleter DeletionCoordinator) (*Elasticsea
 }
 
 func (es *ElasticsearchDB) init() error {
-	mapping := `{"mappings":{"properties": {"internalCalls": {"type": "nested" }}}}`
-	createRequest := esapi.IndicesCreateRequest{
-		Index: TransactionIndex,
-		Body:  strings.NewReader(mapping),
-	}
-
 	//TODO: check error scenarios
-	es.apiClient.DoRequest(createRequest)
-
-	es.apiClient.DoRequest(esapi.IndicesCreateRequest{Index: ContractIndex})
-	es.apiClient.DoRequest(esapi.IndicesCreateRequest{Index: TemplateIndex})
-	es.apiClient.DoRequest(esapi.IndicesCreateRequest{Index: StorageIndex})
-	es.apiClient.DoRequest(esapi.IndicesCreateRequest{Index: EventIndex})
-	es.apiClient.DoRequest(esapi.IndicesCreateRequest{Index: MetaIndex})
-	es.apiClient.DoRequest(esapi.IndicesCreateRequest{Index: ERC20TokenIndex})
-	es.apiClient.DoRequest(esapi.IndicesCreateRequest{Index: ERC721TokenIndex})
+	for _, m := range indexMappings {
+		es.apiClient.DoRequest(m.createRequest(true))
+	}
+	es.createLastPersisted()
+	es.setSchemaVersion()
+	return nil
+}
 
+// createLastPersisted starts the last persisted block at 0, unless it has
+// already been set
+func (es *ElasticsearchDB) createLastPersisted() error {
 	req := esapi.IndexRequest{
 		Index:      MetaIndex,
 		DocumentID: "lastPersisted",
@@ -75,9 +86,8 @@ func (es *ElasticsearchDB) init() error {
 		Refresh:    "true",
 		OpType:     "create",
 	}
-	es.apiClient.DoRequest(req)
-
-	return nil
+	_, err := es.apiClient.DoRequest(req)
+	return err
 }
 
 //AddressDB
@@ -85,14 +95,14 @@ func (es *ElasticsearchDB) AddAddresses(addresses []types.Address) error {
 	if len(addresses) == 0 {
 		return nil
 	}
+	for _, address := range addresses {
+		if es.jobs.Unfinished(types.DeleteAddressJob, address) {
+			return database.ErrAddressBeingDeleted
+		}
+	}
 	// Only use bulk update if more than one address is given
 	if len(addresses) > 1 {
-		bi := es.apiClient.GetBulkHandler(ContractIndex)
-
-		var (
-			wg        sync.WaitGroup
-			returnErr error
-		)
+		documents := make([]bulkDocument, 0, len(addresses))
 		for _, address := range addresses {
 			contract := Contract{
 				Address:             address,
@@ -100,26 +110,9 @@ func (es *ElasticsearchDB) AddAddresses(addresses []types.Address) error {
 				CreationTransaction: "",
 				LastFiltered:        0,
 			}
-			wg.Add(1)
-			bi.Add(
-				context.Background(),
-				esutil.BulkIndexerItem{
-					Action:     "create",
-					DocumentID: address.String(),
-					Body:       esutil.NewJSONReader(contract),
-					OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, item2 esutil.BulkIndexerResponseItem) {
-						wg.Done()
-					},
-					OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, item2 esutil.BulkIndexerResponseItem, err error) {
-						returnErr = err
-						wg.Done()
-					},
-				},
-			)
-		}
-
-		wg.Wait()
-		return returnErr
+			documents = append(documents, bulkDocument{id: address.String(), body: contract})
+		}
+		return es.bulkCreate(ContractIndex, documents)
 	}
 	// add single address
 	contract := Contract{
@@ -141,6 +134,9 @@ func (es *ElasticsearchDB) AddAddresses(addresses []types.Address) error {
 }
 
 func (es *ElasticsearchDB) AddAddressFrom(address types.Address, from uint64) error {
+	if es.jobs.Unfinished(types.DeleteAddressJob, address) {
+		return database.ErrAddressBeingDeleted
+	}
 	contract := Contract{
 		Address:             address,
 		TemplateName:        address.String(),
@@ -159,14 +155,19 @@ func (es *ElasticsearchDB) AddAddressFrom(address types.Address, from uint64) er
 	return err
 }
 
-func (es *ElasticsearchDB) DeleteAddress(address types.Address) error {
-	var wg sync.WaitGroup
-	wg.Add(1)
+// DeleteAddress returns once the address is unregistered. When purging, its
+// data is then deleted by a background job.
+func (es *ElasticsearchDB) DeleteAddress(address types.Address, purge bool) error {
+	if es.jobs.Unfinished(types.DeleteAddressJob, address) {
+		return database.ErrAddressBeingDeleted
+	}
+	request := &deletionRequest{purge: purge}
+	request.wg.Add(1)
 	es.deleteMux.Lock()
-	es.deleteQueue[address] = &wg
+	es.deleteQueue[address] = request
 	es.deleteMux.Unlock()
-	wg.Wait()
-	return nil
+	request.wg.Wait()
+	return request.err
 }
 
 func (es *ElasticsearchDB) GetAddresses() ([]types.Address, error) {
@@ -192,6 +193,75 @@ func (es *ElasticsearchDB) GetContractTemplate(address types.Address) (string, e
 	return contract.TemplateName, nil
 }
 
+func (es *ElasticsearchDB) SetContractEnrichment(address types.Address, mapping types.EnrichmentMapping) error {
+	encoded := ""
+	if len(mapping) > 0 {
+		encodedMapping, err := json.Marshal(mapping)
+		if err != nil {
+			return err
+		}
+		encoded = string(encodedMapping)
+	}
+	return es.updateContract(address, "enrichment", encoded)
+}
+
+func (es *ElasticsearchDB) GetContractEnrichment(address types.Address) (types.EnrichmentMapping, error) {
+	contract, err := es.getContractByAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if contract.Enrichment == "" {
+		return nil, nil
+	}
+	var mapping types.EnrichmentMapping
+	if err := json.Unmarshal([]byte(contract.Enrichment), &mapping); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+func (es *ElasticsearchDB) SetContractSeverityRules(address types.Address, rules types.SeverityRules) error {
+	encoded := ""
+	if len(rules) > 0 {
+		encodedRules, err := json.Marshal(rules)
+		if err != nil {
+			return err
+		}
+		encoded = string(encodedRules)
+	}
+	return es.updateContract(address, "severityRules", encoded)
+}
+
+func (es *ElasticsearchDB) GetContractSeverityRules(address types.Address) (types.SeverityRules, error) {
+	contract, err := es.getContractByAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if contract.SeverityRules == "" {
+		return nil, nil
+	}
+	var rules types.SeverityRules
+	if err := json.Unmarshal([]byte(contract.SeverityRules), &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (es *ElasticsearchDB) SetTerminalBlock(address types.Address, terminalBlock uint64) error {
+	return es.updateContract(address, "terminalBlock", terminalBlock)
+}
+
+func (es *ElasticsearchDB) GetTerminalBlock(address types.Address) (uint64, error) {
+	contract, err := es.getContractByAddress(address)
+	if err == database.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return contract.TerminalBlock, nil
+}
+
 //TemplateDB
 func (es *ElasticsearchDB) GetContractABI(address types.Address) (string, error) {
 
@@ -246,6 +316,19 @@ func (es *ElasticsearchDB) AddTemplate(name string, abi string, layout string) e
 	return err
 }
 
+func (es *ElasticsearchDB) DeleteTemplate(name string) error {
+	req := esapi.DeleteRequest{
+		Index:      TemplateIndex,
+		DocumentID: name,
+		Refresh:    "true",
+	}
+	_, err := es.apiClient.DoRequest(req)
+	if err == database.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
 func (es *ElasticsearchDB) AssignTemplate(address types.Address, name string) error {
 	return es.updateContract(address, "templateName", name)
 }
@@ -277,10 +360,14 @@ func (es *ElasticsearchDB) GetTemplateDetails(templateName string) (*types.Templ
 
 // BlockDB
 func (es *ElasticsearchDB) WriteBlock(block *types.Block) error {
+	document, err := newBlockDocument(block)
+	if err != nil {
+		return err
+	}
 	req := esapi.IndexRequest{
 		Index:      BlockIndex,
 		DocumentID: strconv.FormatUint(block.Number, 10),
-		Body:       esutil.NewJSONReader(block),
+		Body:       esutil.NewJSONReader(document),
 		Refresh:    "true",
 	}
 
@@ -298,29 +385,16 @@ func (es *ElasticsearchDB) WriteBlocks(blocks []*types.Block) error {
 		return es.WriteBlock(blocks[0])
 	}
 
-	bi := es.apiClient.GetBulkHandler(BlockIndex)
-	var (
-		wg        sync.WaitGroup
-		returnErr error
-	)
-	wg.Add(len(blocks))
+	documents := make([]bulkDocument, 0, len(blocks))
 	for _, block := range blocks {
-		_ = bi.Add(context.Background(), esutil.BulkIndexerItem{
-			Action:     "create",
-			DocumentID: strconv.FormatUint(block.Number, 10),
-			Body:       esutil.NewJSONReader(block),
-			OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, item2 esutil.BulkIndexerResponseItem) {
-				wg.Done()
-			},
-			OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, item2 esutil.BulkIndexerResponseItem, err error) {
-				returnErr = err
-				wg.Done()
-			},
-		})
+		document, err := newBlockDocument(block)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, bulkDocument{id: strconv.FormatUint(block.Number, 10), body: document})
 	}
-	wg.Wait()
-	if returnErr != nil {
-		return returnErr
+	if err := es.bulkIndex(BlockIndex, documents); err != nil {
+		return err
 	}
 
 	//find lowest block number
@@ -351,20 +425,55 @@ func (es *ElasticsearchDB) ReadBlock(number uint64) (*types.Block, error) {
 	return blockResult.Source, nil
 }
 
-func (es *ElasticsearchDB) GetLastPersistedBlockNumber() (uint64, error) {
-	// At this point, we know no data insertions are happening so we can safely
-	// delete data
-	es.deleteMux.Lock()
-	for address, wg := range es.deleteQueue {
-		if err := es.deleter.Delete(address); err != nil {
-			log.Warn("Error when servicing deletion request", "address", address.String(), "err", err)
-			return 0, errors.New("error performing deletion of contract " + address.String())
+func (es *ElasticsearchDB) GetBlocksByTimeRange(from uint64, to uint64, options *types.PageOptions) ([]*types.Block, error) {
+	start := options.PageSize * options.PageNumber
+	if start+options.PageSize > maxBlockRangeResults {
+		return nil, ErrPaginationLimitExceeded
+	}
+	req := esapi.SearchRequest{
+		Index: []string{BlockIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryBlocksByTimeRangeTemplate, from, to)),
+		From:  &start,
+		Size:  &options.PageSize,
+		Sort:  []string{"number:asc"},
+	}
+	results, err := es.doSearchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*types.Block, len(results.Hits.Hits))
+	for i, result := range results.Hits.Hits {
+		marshalled, _ := json.Marshal(result.Source)
+		var block types.Block
+		if err = json.Unmarshal(marshalled, &block); err != nil {
+			return nil, err
 		}
-		delete(es.deleteQueue, address)
-		wg.Done()
+		blocks[i] = &block
 	}
-	es.deleteMux.Unlock()
+	return blocks, nil
+}
+
+func (es *ElasticsearchDB) GetBlocksByTimeRangeTotal(from uint64, to uint64) (uint64, error) {
+	req := esapi.CountRequest{
+		Index: []string{BlockIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryBlocksByTimeRangeTemplate, from, to)),
+	}
+	results, err := es.doCountRequest(req)
+	if err != nil {
+		return 0, err
+	}
+	return results.Count, nil
+}
 
+func (es *ElasticsearchDB) GetLastPersistedBlockNumber() (uint64, error) {
+	// At this point, we know no data insertions are happening so we can safely
+	// unregister contracts, after which their data isn't written to any more
+	es.processDeletions()
+	return es.getLastPersisted()
+}
+
+func (es *ElasticsearchDB) getLastPersisted() (uint64, error) {
 	fetchReq := esapi.GetRequest{
 		Index:      MetaIndex,
 		DocumentID: "lastPersisted",
@@ -384,15 +493,21 @@ func (es *ElasticsearchDB) GetLastPersistedBlockNumber() (uint64, error) {
 
 // TransactionDB
 func (es *ElasticsearchDB) WriteTransaction(transaction *types.Transaction) error {
+	document, err := newTransactionDocument(transaction)
+	if err != nil {
+		return err
+	}
 	req := esapi.IndexRequest{
 		Index:      TransactionIndex,
 		DocumentID: transaction.Hash.String(),
-		Body:       esutil.NewJSONReader(transaction),
+		Body:       esutil.NewJSONReader(document),
 		Refresh:    "true",
 	}
 
-	_, err := es.apiClient.DoRequest(req)
-	return err
+	if _, err = es.apiClient.DoRequest(req); err != nil {
+		return err
+	}
+	return es.writeCallTrees([]*types.Transaction{transaction})
 }
 
 func (es *ElasticsearchDB) WriteTransactions(transactions []*types.Transaction) error {
@@ -403,32 +518,48 @@ func (es *ElasticsearchDB) WriteTransactions(transactions []*types.Transaction)
 		return es.WriteTransaction(transactions[0])
 	}
 
-	bi := es.apiClient.GetBulkHandler(TransactionIndex)
+	documents := make([]bulkDocument, 0, len(transactions))
+	for _, transaction := range transactions {
+		document, err := newTransactionDocument(transaction)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, bulkDocument{id: transaction.Hash.String(), body: document})
+	}
+	if err := es.bulkIndex(TransactionIndex, documents); err != nil {
+		return err
+	}
+	return es.writeCallTrees(transactions)
+}
 
-	var (
-		wg        sync.WaitGroup
-		returnErr error
-	)
-	wg.Add(len(transactions))
+// writeCallTrees stores the call trees of the transactions that made internal
+// calls in their own index, so transactions stay small
+func (es *ElasticsearchDB) writeCallTrees(transactions []*types.Transaction) error {
+	var documents []bulkDocument
 	for _, transaction := range transactions {
-		_ = bi.Add(
-			context.Background(),
-			esutil.BulkIndexerItem{
-				Action:     "create",
-				DocumentID: transaction.Hash.String(),
-				Body:       esutil.NewJSONReader(transaction),
-				OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, item2 esutil.BulkIndexerResponseItem) {
-					wg.Done()
-				},
-				OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, item2 esutil.BulkIndexerResponseItem, err error) {
-					returnErr = err
-					wg.Done()
-				},
-			})
+		if len(transaction.CallTree) == 0 {
+			continue
+		}
+		tree := &types.CallTree{TransactionHash: transaction.Hash, BlockNumber: transaction.BlockNumber, Calls: transaction.CallTree}
+		documents = append(documents, bulkDocument{id: transaction.Hash.String(), body: tree})
 	}
+	return es.bulkIndex(CallTreeIndex, documents)
+}
 
-	wg.Wait()
-	return returnErr
+func (es *ElasticsearchDB) GetTransactionCallTree(hash types.Hash) (*types.CallTree, error) {
+	fetchReq := esapi.GetRequest{
+		Index:      CallTreeIndex,
+		DocumentID: hash.String(),
+	}
+	body, err := es.apiClient.DoRequest(fetchReq)
+	if err != nil {
+		return nil, err
+	}
+	var result CallTreeQueryResult
+	if err = json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return result.Source, nil
 }
 
 func (es *ElasticsearchDB) ReadTransaction(hash types.Hash) (*types.Transaction, error) {
@@ -449,6 +580,47 @@ func (es *ElasticsearchDB) ReadTransaction(hash types.Hash) (*types.Transaction,
 	return transactionResult.Source, nil
 }
 
+func (es *ElasticsearchDB) GetTransactionsInBlockRange(start uint64, end uint64, options *types.PageOptions) ([]*types.Transaction, error) {
+	from := options.PageSize * options.PageNumber
+	if from+options.PageSize > maxTransactionRangeResults {
+		return nil, ErrPaginationLimitExceeded
+	}
+	req := esapi.SearchRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryTransactionsInBlockRangeTemplate, start, end)),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"blockNumber:asc", "index:asc"},
+	}
+	results, err := es.doSearchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	txs := make([]*types.Transaction, len(results.Hits.Hits))
+	for i, result := range results.Hits.Hits {
+		marshalled, _ := json.Marshal(result.Source)
+		var tx types.Transaction
+		if err = json.Unmarshal(marshalled, &tx); err != nil {
+			return nil, err
+		}
+		txs[i] = &tx
+	}
+	return txs, nil
+}
+
+func (es *ElasticsearchDB) GetTransactionsInBlockRangeTotal(start uint64, end uint64) (uint64, error) {
+	req := esapi.CountRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryTransactionsInBlockRangeTemplate, start, end)),
+	}
+	results, err := es.doCountRequest(req)
+	if err != nil {
+		return 0, err
+	}
+	return results.Count, nil
+}
+
 // IndexDB
 
 func (es *ElasticsearchDB) IndexBlocks(addresses []types.Address, blocks []*types.Block) error {
@@ -459,15 +631,24 @@ func (es *ElasticsearchDB) IndexBlocks(addresses []types.Address, blocks []*type
 	return es.updateAllLastFiltered(addresses, blocks[len(blocks)-1].Number)
 }
 
-func (es *ElasticsearchDB) IndexStorage(rawStorage map[types.Address]*types.AccountState, blockNumber uint64) error {
-	biStorage := es.apiClient.GetBulkHandler(StorageIndex)
+func (es *ElasticsearchDB) IndexBlocksAhead(addresses []types.Address, blocks []*types.Block) error {
+	indexer := NewBlockIndexer(addresses, blocks, es)
+	// counterparties assume contiguous ranges, so are recorded when the blocks
+	// are indexed again in order
+	indexer.recordCounterparties = nil
+	return indexer.Index()
+}
+
+// ReindexBlocks indexes the blocks like IndexBlocks, replacing the documents
+// already stored for them. Last filtered blocks are only ever raised, so they
+// aren't updated at all.
+func (es *ElasticsearchDB) ReindexBlocks(addresses []types.Address, blocks []*types.Block) error {
+	return NewBlockIndexer(addresses, blocks, es).Index()
+}
 
-	var (
-		wg        sync.WaitGroup
-		returnErr error
-	)
+func (es *ElasticsearchDB) IndexStorage(rawStorage map[types.Address]*types.AccountState, blockNumber uint64) error {
+	documents := make([]bulkDocument, 0, len(rawStorage))
 	for address, dumpAccount := range rawStorage {
-		wg.Add(1)
 		converted := make([]StorageEntry, 0, len(dumpAccount.Storage))
 		for slot, val := range dumpAccount.Storage {
 			converted = append(converted, StorageEntry{slot, val})
@@ -477,26 +658,12 @@ func (es *ElasticsearchDB) IndexStorage(rawStorage map[types.Address]*types.Acco
 			BlockNumber: blockNumber,
 			StorageRoot: dumpAccount.Root,
 			StorageMap:  converted,
-		}
 
-		_ = biStorage.Add(
-			context.Background(),
-			esutil.BulkIndexerItem{
-				Action:     "create",
-				DocumentID: address.String() + "-" + strconv.FormatUint(blockNumber, 10),
-				Body:       esutil.NewJSONReader(storageMap),
-				OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, item2 esutil.BulkIndexerResponseItem) {
-					wg.Done()
-				},
-				OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, item2 esutil.BulkIndexerResponseItem, err error) {
-					returnErr = err
-					wg.Done()
-				},
-			},
-		)
+			DecodedStorage: dumpAccount.Decoded,
+		}
+		documents = append(documents, bulkDocument{id: address.String() + "-" + strconv.FormatUint(blockNumber, 10), body: storageMap})
 	}
-	wg.Wait()
-	return returnErr
+	return es.bulkIndex(StorageIndex, documents)
 }
 
 func (es *ElasticsearchDB) SetContractCreationTransaction(creationTxns map[types.Hash][]types.Address) error {
@@ -512,6 +679,25 @@ func (es *ElasticsearchDB) SetContractCreationTransaction(creationTxns map[types
 	return nil
 }
 
+func (es *ElasticsearchDB) SetContractsDestroyed(destroyed map[types.Address]uint64) error {
+	for address, blockNumber := range destroyed {
+		if err := es.updateContract(address, "destroyedAt", blockNumber); err != nil {
+			log.Error("Failed to index contract self-destruct", "block", blockNumber, "contract", address, "err", err)
+			return err
+		}
+		log.Info("Indexed self-destruct of contract", "block", blockNumber, "contract", address)
+	}
+	return nil
+}
+
+func (es *ElasticsearchDB) GetContractDestroyed(address types.Address) (uint64, error) {
+	contract, err := es.getContractByAddress(address)
+	if err != nil {
+		return 0, err
+	}
+	return contract.DestroyedAt, nil
+}
+
 func (es *ElasticsearchDB) GetContractCreationTransaction(address types.Address) (types.Hash, error) {
 	contract, err := es.getContractByAddress(address)
 	if err != nil {
@@ -523,13 +709,13 @@ func (es *ElasticsearchDB) GetContractCreationTransaction(address types.Address)
 func (es *ElasticsearchDB) GetAllTransactionsToAddress(address types.Address, options *types.QueryOptions) ([]types.Hash, error) {
 	queryString := fmt.Sprintf(QueryByToAddressWithOptionsTemplate(options), address.String())
 
-	from := options.PageSize * options.PageNumber
-	if from+options.PageSize > 1000 {
-		return nil, ErrPaginationLimitExceeded
+	from, cursor, err := pageStart(options)
+	if err != nil {
+		return nil, err
 	}
 	req := esapi.SearchRequest{
 		Index: []string{TransactionIndex},
-		Body:  strings.NewReader(queryString),
+		Body:  strings.NewReader(withSearchAfter(queryString, cursor)),
 		From:  &from,
 		Size:  &options.PageSize,
 		Sort:  []string{"blockNumber:desc", "index:asc"},
@@ -565,13 +751,13 @@ func (es *ElasticsearchDB) GetTransactionsToAddressTotal(address types.Address,
 func (es *ElasticsearchDB) GetAllTransactionsInternalToAddress(address types.Address, options *types.QueryOptions) ([]types.Hash, error) {
 	queryString := fmt.Sprintf(QueryInternalTransactionsWithOptionsTemplate(options), address.String())
 
-	from := options.PageSize * options.PageNumber
-	if from+options.PageSize > 1000 {
-		return nil, ErrPaginationLimitExceeded
+	from, cursor, err := pageStart(options)
+	if err != nil {
+		return nil, err
 	}
 	req := esapi.SearchRequest{
 		Index: []string{TransactionIndex},
-		Body:  strings.NewReader(queryString),
+		Body:  strings.NewReader(withSearchAfter(queryString, cursor)),
 		From:  &from,
 		Size:  &options.PageSize,
 		Sort:  []string{"blockNumber:desc", "index:asc"},
@@ -607,13 +793,13 @@ func (es *ElasticsearchDB) GetTransactionsInternalToAddressTotal(address types.A
 func (es *ElasticsearchDB) GetAllEventsFromAddress(address types.Address, options *types.QueryOptions) ([]*types.Event, error) {
 	queryString := fmt.Sprintf(QueryByAddressWithOptionsTemplate(options), address.String())
 
-	from := options.PageSize * options.PageNumber
-	if from+options.PageSize > 1000 {
-		return nil, ErrPaginationLimitExceeded
+	from, cursor, err := pageStart(options)
+	if err != nil {
+		return nil, err
 	}
 	req := esapi.SearchRequest{
 		Index: []string{EventIndex},
-		Body:  strings.NewReader(queryString),
+		Body:  strings.NewReader(withSearchAfter(queryString, cursor)),
 		From:  &from,
 		Size:  &options.PageSize,
 		Sort:  []string{"blockNumber:desc", "index:asc"},
@@ -654,6 +840,84 @@ func (es *ElasticsearchDB) GetEventsFromAddressTotal(address types.Address, opti
 	return results.Count, nil
 }
 
+func (es *ElasticsearchDB) HasActivity(address types.Address, from uint64, to uint64) (bool, error) {
+	options := &types.QueryOptions{
+		BeginBlockNumber: new(big.Int).SetUint64(from),
+		EndBlockNumber:   new(big.Int).SetUint64(to),
+	}
+	options.SetDefaults()
+
+	// each count stops at the first match, checking events first as contracts
+	// usually emit them when called
+	queries := []struct {
+		index string
+		query string
+	}{
+		{EventIndex, QueryByAddressWithOptionsTemplate(options)},
+		{TransactionIndex, QueryByToAddressWithOptionsTemplate(options)},
+		{TransactionIndex, QueryInternalTransactionsWithOptionsTemplate(options)},
+	}
+	terminateAfter := 1
+	for _, query := range queries {
+		req := esapi.CountRequest{
+			Index:          []string{query.index},
+			Body:           strings.NewReader(fmt.Sprintf(query.query, address.String())),
+			TerminateAfter: &terminateAfter,
+		}
+		results, err := es.doCountRequest(req)
+		if err != nil {
+			return false, err
+		}
+		if results.Count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (es *ElasticsearchDB) GetEventsForTransactions(hashes []types.Hash, contracts []types.Address, limit int) (map[types.Hash][]*types.Event, error) {
+	events := make(map[types.Hash][]*types.Event, len(hashes))
+	if len(hashes) == 0 || (contracts != nil && len(contracts) == 0) {
+		return events, nil
+	}
+	hexHashes := make([]string, len(hashes))
+	for i, hash := range hashes {
+		hexHashes[i] = hash.Hex()
+	}
+	encodedHashes, _ := json.Marshal(hexHashes)
+
+	queryString := fmt.Sprintf(QueryEventsForTransactionsTemplate, encodedHashes, len(hashes), limit)
+	if contracts != nil {
+		hexContracts := make([]string, len(contracts))
+		for i, contract := range contracts {
+			hexContracts[i] = contract.String()
+		}
+		encodedContracts, _ := json.Marshal(hexContracts)
+		queryString = fmt.Sprintf(QueryContractEventsForTransactionsTemplate, encodedHashes, encodedContracts, len(hashes), limit)
+	}
+	req := esapi.SearchRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(queryString),
+	}
+	results, err := es.doSearchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	marshalled, _ := json.Marshal(results.Aggregations.Results)
+	var aggResult TransactionEventsAggregateResult
+	if err := json.Unmarshal(marshalled, &aggResult); err != nil {
+		return nil, err
+	}
+	for _, bucket := range aggResult.Buckets {
+		hash := types.NewHash(bucket.Key)
+		for _, hit := range bucket.Events.Hits.Hits {
+			events[hash] = append(events[hash], hit.Source)
+		}
+	}
+	return events, nil
+}
+
 func (es *ElasticsearchDB) GetStorageTotal(address types.Address, options *types.PageOptions) (uint64, error) {
 	queryString := fmt.Sprintf(QueryByAddressWithBlockRangeOptionsTemplate(options), address.String())
 
@@ -706,6 +970,72 @@ func (es *ElasticsearchDB) GetStorage(address types.Address, blockNumber uint64)
 	}, nil
 }
 
+func (es *ElasticsearchDB) GetStorageValues(contract types.Address, options *types.PageOptions) ([]*types.StorageValues, error) {
+	var values []*types.StorageValues
+
+	// the storage at the start of the range is from the last change before it
+	begin := options.BeginBlockNumber.Uint64()
+	if begin > 0 {
+		before, err := es.searchStorageValues(fmt.Sprintf(QueryMatchContract, contract.String(), begin-1), 1, "blockNumber:desc")
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, before...)
+	}
+
+	for {
+		page := &types.PageOptions{
+			BeginBlockNumber: new(big.Int).SetUint64(begin),
+			EndBlockNumber:   options.EndBlockNumber,
+		}
+		query := fmt.Sprintf(QueryByAddressWithBlockRangeOptionsTemplate(page), contract.String())
+		res, err := es.searchStorageValues(query, storageValuesPageSize, "blockNumber:asc")
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, res...)
+		if len(res) < storageValuesPageSize {
+			return values, nil
+		}
+		begin = res[len(res)-1].BlockNumber + 1
+	}
+}
+
+func (es *ElasticsearchDB) searchStorageValues(query string, size int, sort string) ([]*types.StorageValues, error) {
+	req := esapi.SearchRequest{
+		Index: []string{StorageIndex},
+		Body:  strings.NewReader(query),
+		Size:  &size,
+		Sort:  []string{sort},
+	}
+	results, err := es.doSearchRequest(req)
+	if err != nil {
+		if err == database.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	values := make([]*types.StorageValues, len(results.Hits.Hits))
+	for i, result := range results.Hits.Hits {
+		marshalled, _ := json.Marshal(result)
+		var storageResult StorageQueryResult
+		if err := json.Unmarshal(marshalled, &storageResult); err != nil {
+			return nil, err
+		}
+		values[i] = &types.StorageValues{BlockNumber: storageResult.Source.BlockNumber}
+		if storageResult.Source.DecodedStorage != nil {
+			values[i].Values = storageResult.Source.DecodedStorage
+			continue
+		}
+		values[i].Storage = make(map[types.Hash]string)
+		for _, storageEntry := range storageResult.Source.StorageMap {
+			values[i].Storage[storageEntry.Key] = storageEntry.Value
+		}
+	}
+	return values, nil
+}
+
 func (es *ElasticsearchDB) GetStorageRanges(contract types.Address, options *types.PageOptions) ([]types.RangeResult, error) {
 	end := options.EndBlockNumber
 	if big.NewInt(-1).Cmp(end) == 0 {
@@ -768,11 +1098,121 @@ func (es *ElasticsearchDB) GetLastFiltered(address types.Address) (uint64, error
 	return contract.LastFiltered, nil
 }
 
+// ResetLastFiltered only lowers the last filtered block, as the documents of
+// the blocks after it are replaced when they are indexed again
+func (es *ElasticsearchDB) ResetLastFiltered(address types.Address, lastFiltered uint64) error {
+	if _, err := es.getContractByAddress(address); err != nil {
+		return err
+	}
+	updateRequest := esapi.UpdateRequest{
+		Index:      ContractIndex,
+		DocumentID: address.String(),
+		Body:       strings.NewReader(fmt.Sprintf(LowerLastFilteredTemplate, lastFiltered)),
+		Refresh:    "true",
+	}
+	_, err := es.apiClient.DoRequest(updateRequest)
+	return err
+}
+
+// StatsDB
+
+func (es *ElasticsearchDB) GetIndexStats() ([]types.IndexStats, error) {
+	statsReq := esapi.IndicesStatsRequest{
+		Index:  StatsIndexes,
+		Metric: []string{"store"},
+	}
+	body, err := es.apiClient.DoRequest(statsReq)
+	if err != nil {
+		return nil, err
+	}
+	var indicesStats IndicesStatsResult
+	if err = json.Unmarshal(body, &indicesStats); err != nil {
+		return nil, err
+	}
+
+	// versioned indices are reported under the alias they are stored behind
+	storageSizes := make(map[string]uint64, len(indicesStats.Indices))
+	for name, stats := range indicesStats.Indices {
+		storageSizes[unversionedIndex(name)] += stats.Total.Store.SizeInBytes
+	}
+
+	results := make([]types.IndexStats, len(StatsIndexes))
+	for i, index := range StatsIndexes {
+		// ERC721 tokens are recorded against the block they are held from
+		blockField := "blockNumber"
+		if index == ERC721TokenIndex {
+			blockField = "heldFrom"
+		}
+		searchReq := esapi.SearchRequest{
+			Index: []string{index},
+			Body:  strings.NewReader(fmt.Sprintf(QueryBlockRangeStatsTemplate, blockField, blockField)),
+		}
+		body, err := es.apiClient.DoRequest(searchReq)
+		if err != nil {
+			return nil, err
+		}
+		var blockRange BlockRangeQueryResult
+		if err = json.Unmarshal(body, &blockRange); err != nil {
+			return nil, err
+		}
+
+		results[i] = types.IndexStats{
+			Name:          index,
+			DocumentCount: blockRange.Hits.Total.Value,
+			StorageSize:   storageSizes[index],
+		}
+		if blockRange.Aggregations.Oldest.Value != nil {
+			results[i].OldestBlock = uint64(*blockRange.Aggregations.Oldest.Value)
+		}
+		if blockRange.Aggregations.Newest.Value != nil {
+			results[i].NewestBlock = uint64(*blockRange.Aggregations.Newest.Value)
+		}
+	}
+	return results, nil
+}
+
+// RefreshIndexed refreshes all the indices, as the bulk writes indexing
+// blocks aren't refreshed when made
+func (es *ElasticsearchDB) RefreshIndexed() error {
+	_, err := es.apiClient.DoRequest(esapi.IndicesRefreshRequest{Index: AllIndexes})
+	return err
+}
+
+func (es *ElasticsearchDB) Compact(mergeIndices []string, maxNumSegments int) error {
+	compactable := make(map[string]bool, len(CompactIndexes))
+	for _, index := range CompactIndexes {
+		compactable[index] = true
+	}
+	merge := make(map[string]bool, len(mergeIndices))
+	for _, index := range mergeIndices {
+		if !compactable[index] {
+			return fmt.Errorf("index %s can not be compacted", index)
+		}
+		merge[index] = true
+	}
+
+	// indices are merged one at a time, to limit the load on the cluster
+	onlyExpungeDeletes := true
+	for _, index := range CompactIndexes {
+		req := esapi.IndicesForcemergeRequest{Index: []string{index}}
+		if merge[index] {
+			req.MaxNumSegments = &maxNumSegments
+		} else {
+			req.OnlyExpungeDeletes = &onlyExpungeDeletes
+		}
+		log.Info("Compacting index", "index", index, "merge", merge[index])
+		if _, err := es.apiClient.DoRequest(req); err != nil {
+			return fmt.Errorf("compacting index %s failed: %v", index, err)
+		}
+	}
+	return nil
+}
+
 // Internal functions
 
 func (es *ElasticsearchDB) checkIsInitialized() (bool, error) {
 	fetchReq := esapi.CatIndicesRequest{
-		Index: []string{MetaIndex, ContractIndex, BlockIndex, StorageIndex, TransactionIndex, EventIndex, ERC20TokenIndex, ERC721TokenIndex},
+		Index: []string{MetaIndex, ContractIndex, BlockIndex, StorageIndex, TransactionIndex, EventIndex, ERC20TokenIndex, ERC721TokenIndex, ERC1155TokenIndex},
 	}
 
 	if _, err := es.apiClient.DoRequest(fetchReq); err != nil {
@@ -829,7 +1269,7 @@ func (es *ElasticsearchDB) updateAllLastFiltered(addresses []types.Address, last
 			esutil.BulkIndexerItem{
 				Action:     "update",
 				DocumentID: address.String(),
-				Body:       strings.NewReader(fmt.Sprintf(`{"doc":{"lastFiltered":%d}}`, lastFiltered)),
+				Body:       strings.NewReader(fmt.Sprintf(RaiseLastFilteredTemplate, lastFiltered)),
 			},
 		)
 	}
@@ -861,37 +1301,365 @@ func (es *ElasticsearchDB) updateContract(address types.Address, property string
 }
 
 func (es *ElasticsearchDB) createEvents(events []*types.Event) error {
-	bi := es.apiClient.GetBulkHandler(EventIndex)
-
-	var (
-		wg        sync.WaitGroup
-		returnErr error
-	)
+	documents := make([]bulkDocument, 0, len(events))
 	for _, event := range events {
-		wg.Add(1)
-		_ = bi.Add(
-			context.Background(),
-			esutil.BulkIndexerItem{
-				Action:     "create",
-				DocumentID: strconv.FormatUint(event.BlockNumber, 10) + "-" + strconv.FormatUint(event.Index, 10),
-				Body:       esutil.NewJSONReader(event),
-				OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, item2 esutil.BulkIndexerResponseItem) {
-					wg.Done()
-				},
-				OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, item2 esutil.BulkIndexerResponseItem, err error) {
-					returnErr = err
-					wg.Done()
-				},
-			},
-		)
+		document, err := newEventDocument(event)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, bulkDocument{id: eventDocumentID(event), body: document})
+	}
+	return es.bulkIndex(EventIndex, documents)
+}
+
+func eventDocumentID(event *types.Event) string {
+	return strconv.FormatUint(event.BlockNumber, 10) + "-" + strconv.FormatUint(event.Index, 10)
+}
+
+// enrichDocuments adds the fields of each contract's enrichment mapping to
+// the documents of the transactions sent to it, and the events it emitted,
+// along with the severity its rules classify the events with
+func (es *ElasticsearchDB) enrichDocuments(addresses map[types.Address]bool, transactions []*types.Transaction) error {
+	enricher := newDocumentEnricher(es.GetContractEnrichment, es.GetContractSeverityRules, es.GetContractABI)
+	var txDocuments, eventDocuments []bulkDocument
+	for _, transaction := range transactions {
+		if addresses[transaction.To] {
+			fields, err := enricher.transactionFields(transaction)
+			if err != nil {
+				return err
+			}
+			if len(fields) > 0 {
+				txDocuments = append(txDocuments, bulkDocument{id: transaction.Hash.String(), body: fields})
+			}
+		}
+		for _, event := range transaction.Events {
+			if !addresses[event.Address] {
+				continue
+			}
+			fields, err := enricher.eventFields(event)
+			if err != nil {
+				return err
+			}
+			if len(fields) > 0 {
+				eventDocuments = append(eventDocuments, bulkDocument{id: eventDocumentID(event), body: fields})
+			}
+		}
+	}
+	if err := es.bulkUpdate(TransactionIndex, txDocuments); err != nil {
+		return err
+	}
+	return es.bulkUpdate(EventIndex, eventDocuments)
+}
+
+// processDeletions unregisters the queued addresses, and starts deleting
+// the data of those being purged in the background
+func (es *ElasticsearchDB) processDeletions() {
+	es.deleteMux.Lock()
+	defer es.deleteMux.Unlock()
+
+	if !es.deletionsResumed {
+		es.resumeDeletions()
+	}
+	for address, request := range es.deleteQueue {
+		if !request.purge {
+			if err := es.deleter.Remove(address); err != nil {
+				log.Warn("Error when servicing deletion request", "address", address.String(), "err", err)
+				request.err = err
+			}
+		} else if err := es.deleter.Unregister(address); err != nil {
+			log.Warn("Error when servicing deletion request", "address", address.String(), "err", err)
+			request.err = err
+		} else {
+			es.runDeletion(es.jobs.Start(types.DeleteAddressJob, address), address)
+		}
+		delete(es.deleteQueue, address)
+		request.wg.Done()
+	}
+}
+
+// resumeDeletions restarts the deletion of contracts that are still marked
+// as being deleted after a restart
+func (es *ElasticsearchDB) resumeDeletions() {
+	results, err := es.apiClient.ScrollAllResults(ContractIndex, QueryDeletingAddressesTemplate)
+	if err != nil {
+		log.Warn("Unable to find interrupted contract deletions", "err", err)
+		return
+	}
+	for _, result := range results {
+		data := result.(map[string]interface{})["_source"].(map[string]interface{})
+		address := types.NewAddress(data["address"].(string))
+		if !es.jobs.Unfinished(types.DeleteAddressJob, address) {
+			es.runDeletion(es.jobs.Start(types.DeleteAddressJob, address), address)
+		}
 	}
-	wg.Wait()
-	return returnErr
+	es.deletionsResumed = true
 }
 
-func (es *ElasticsearchDB) Stop() {
-	es.apiClient.CloseIndexers()
+func (es *ElasticsearchDB) runDeletion(id string, address types.Address) {
+	log.Info("Deleting contract data", "address", address.Hex(), "job", id)
+	es.deletions.Add(1)
+	go func() {
+		defer es.deletions.Done()
+		err := es.deleter.Delete(address, func(progress types.JobProgress) {
+			es.jobs.Update(id, func(job *types.Job) {
+				job.JobProgress = progress
+			})
+		})
+		if err != nil {
+			log.Warn("Deleting contract data failed", "address", address.Hex(), "job", id, "err", err)
+		} else {
+			log.Info("Deleted contract data", "address", address.Hex(), "job", id)
+		}
+		es.jobs.Finish(id, err)
+	}()
+}
+
+// JobDB
+
+func (es *ElasticsearchDB) GetJobs() ([]*types.Job, error) {
+	return es.jobs.All(), nil
+}
+
+func (es *ElasticsearchDB) GetJob(id string) (*types.Job, error) {
+	return es.jobs.Get(id)
+}
+
+// RetryJob runs a failed deletion again. Data that was already deleted is
+// not found again, so it carries on from where it failed.
+func (es *ElasticsearchDB) RetryJob(id string) error {
+	job, err := es.jobs.Restart(id)
+	if err != nil {
+		return err
+	}
+	es.runDeletion(id, job.Address)
+	return nil
+}
+
+// WebhookDB
+
+func (es *ElasticsearchDB) AddWebhook(webhook *types.Webhook) error {
+	req := esapi.IndexRequest{
+		Index:      WebhookIndex,
+		DocumentID: webhook.ID,
+		Body:       esutil.NewJSONReader(webhook),
+		Refresh:    "true",
+	}
+	_, err := es.apiClient.DoRequest(req)
+	return err
+}
+
+func (es *ElasticsearchDB) DeleteWebhook(id string) error {
+	req := esapi.DeleteRequest{
+		Index:      WebhookIndex,
+		DocumentID: id,
+		Refresh:    "true",
+	}
+	_, err := es.apiClient.DoRequest(req)
+	return err
+}
+
+func (es *ElasticsearchDB) GetWebhooks() ([]*types.Webhook, error) {
+	size := maxWebhooks
+	req := esapi.SearchRequest{
+		Index: []string{WebhookIndex},
+		Body:  strings.NewReader(QueryAllWebhooksTemplate),
+		Size:  &size,
+	}
+	results, err := es.doSearchRequest(req)
+	if err == ErrIndexNotFound {
+		// databases created before webhooks were added have no index until
+		// the first webhook is registered
+		return []*types.Webhook{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	webhooks := make([]*types.Webhook, 0, len(results.Hits.Hits))
+	for _, result := range results.Hits.Hits {
+		marshalled, _ := json.Marshal(result.Source)
+		var webhook types.Webhook
+		if err := json.Unmarshal(marshalled, &webhook); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	return webhooks, nil
+}
+
+// JournalDB
+
+func (es *ElasticsearchDB) WriteJournalEntries(entries []*types.JournalEntry) error {
+	documents := make([]bulkDocument, 0, len(entries))
+	for _, entry := range entries {
+		// a block can be processed by a stage several times, but a retried
+		// write of the same entry is only stored once
+		id := fmt.Sprintf("%s-%d-%d", entry.Stage, entry.BlockNumber, entry.Timestamp)
+		documents = append(documents, bulkDocument{id: id, body: entry})
+	}
+	return es.bulkCreate(JournalIndex, documents)
+}
+
+func (es *ElasticsearchDB) GetJournalEntries(query *types.JournalQuery, options *types.PageOptions) ([]*types.JournalEntry, error) {
+	from := options.PageSize * options.PageNumber
+	if from+options.PageSize > 1000 {
+		return nil, ErrPaginationLimitExceeded
+	}
+	req := esapi.SearchRequest{
+		Index: []string{JournalIndex},
+		Body:  strings.NewReader(QueryJournalTemplate(query, options)),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"blockNumber:desc", "timestamp:desc"},
+	}
+	results, err := es.doSearchRequest(req)
+	if err == ErrIndexNotFound {
+		// databases created before the journal was added have no index until
+		// the first entry is written
+		return []*types.JournalEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*types.JournalEntry, 0, len(results.Hits.Hits))
+	for _, result := range results.Hits.Hits {
+		marshalled, _ := json.Marshal(result.Source)
+		var entry types.JournalEntry
+		if err := json.Unmarshal(marshalled, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
+
+// ReorgDB
+func (es *ElasticsearchDB) RollbackToBlock(blockNumber uint64) error {
+	log.Info("Rolling back to block", "number", blockNumber)
+
+	if err := es.rollbackCounterparties(blockNumber); err != nil {
+		return err
+	}
+
+	deletions := []struct {
+		indices []string
+		field   string
+	}{
+		{[]string{BlockIndex}, "number"},
+		{[]string{TransactionIndex, EventIndex, StorageIndex, ERC20TokenIndex, ERC1155TokenIndex, ERC20AllowanceIndex, CallTreeIndex}, "blockNumber"},
+		{[]string{ERC721TokenIndex}, "heldFrom"},
+		{[]string{CounterpartyIndex}, "firstSeenBlock"},
+	}
+	for _, deletion := range deletions {
+		deleteReq := esapi.DeleteByQueryRequest{
+			Index:             deletion.indices,
+			Body:              strings.NewReader(fmt.Sprintf(QueryAfterBlockTemplate, deletion.field, blockNumber)),
+			Refresh:           &RequestParameterTrue,
+			WaitForCompletion: &RequestParameterTrue,
+		}
+		if _, err := es.apiClient.DoRequest(deleteReq); err != nil {
+			return err
+		}
+	}
+
+	// the token entries that were replaced after the block are the latest again
+	heldUntilReq := esapi.UpdateByQueryRequest{
+		Index:             []string{ERC20TokenIndex, ERC721TokenIndex, ERC1155TokenIndex, ERC20AllowanceIndex},
+		Body:              strings.NewReader(fmt.Sprintf(UpdateRemoveHeldUntilTemplate, blockNumber)),
+		Refresh:           &RequestParameterTrue,
+		WaitForCompletion: &RequestParameterTrue,
+	}
+	if _, err := es.apiClient.DoRequest(heldUntilReq); err != nil {
+		return err
+	}
+
+	lastFilteredReq := esapi.UpdateByQueryRequest{
+		Index:             []string{ContractIndex},
+		Body:              strings.NewReader(fmt.Sprintf(UpdateLastFilteredAfterBlockTemplate, blockNumber, blockNumber)),
+		Refresh:           &RequestParameterTrue,
+		WaitForCompletion: &RequestParameterTrue,
+	}
+	if _, err := es.apiClient.DoRequest(lastFilteredReq); err != nil {
+		return err
+	}
+
+	last, err := es.getLastPersisted()
+	if err != nil {
+		return err
+	}
+	if last <= blockNumber {
+		return nil
+	}
+	req := esapi.IndexRequest{
+		Index:      MetaIndex,
+		DocumentID: "lastPersisted",
+		Body:       strings.NewReader(fmt.Sprintf(`{"lastPersisted": %d}`, blockNumber)),
+		Refresh:    "true",
+	}
+	_, err = es.apiClient.DoRequest(req)
+	return err
+}
+
+func (es *ElasticsearchDB) DeleteBlockRange(from uint64, to uint64, dryRun bool) (*types.BlockRangeDeletion, error) {
+	holds, err := getLegalHolds(es.apiClient)
+	if err != nil {
+		return nil, fmt.Errorf("reading legal holds: %v", err)
+	}
+
+	deletion := &types.BlockRangeDeletion{FromBlock: from, ToBlock: to, DryRun: dryRun, Documents: make(map[string]uint64)}
+	indices := []struct {
+		index string
+		field string
+	}{
+		{EventIndex, "blockNumber"},
+		{StorageIndex, "blockNumber"},
+		{ERC20TokenIndex, "blockNumber"},
+		{ERC721TokenIndex, "heldFrom"},
+		{ERC1155TokenIndex, "blockNumber"},
+		{ERC20AllowanceIndex, "blockNumber"},
+	}
+	for _, index := range indices {
+		query := excludeLegalHoldsOn(fmt.Sprintf(QueryBlockRangeTemplate, index.field, from, to), holds, index.field)
+		var count uint64
+		if dryRun {
+			countReq := esapi.CountRequest{
+				Index: []string{index.index},
+				Body:  strings.NewReader(query),
+			}
+			result, err := es.doCountRequest(countReq)
+			if err != nil {
+				return nil, fmt.Errorf("counting %s documents: %v", index.index, err)
+			}
+			count = result.Count
+		} else {
+			deleteReq := esapi.DeleteByQueryRequest{
+				Index:             []string{index.index},
+				Body:              strings.NewReader(query),
+				Refresh:           &RequestParameterTrue,
+				WaitForCompletion: &RequestParameterTrue,
+			}
+			body, err := es.apiClient.DoRequest(deleteReq)
+			if err != nil {
+				return nil, fmt.Errorf("deleting %s documents: %v", index.index, err)
+			}
+			var status DeleteByQueryStatus
+			if err := json.Unmarshal(body, &status); err != nil {
+				return nil, err
+			}
+			count = status.Deleted
+		}
+		deletion.Documents[index.index] = count
+		deletion.Total += count
+	}
+	log.Info("Deleted block range", "from", from, "to", to, "dryRun", dryRun, "documents", deletion.Total)
+	return deletion, nil
+}
+
+func (es *ElasticsearchDB) Stop(ctx context.Context) error {
+	if err := es.apiClient.CloseIndexers(ctx); err != nil {
+		return err
+	}
 	log.Info("Elasticsearch indexers closed")
+	return nil
 }
 
 func (es *ElasticsearchDB) doSearchRequest(req esapi.SearchRequest) (*SearchQueryResult, error) {
@@ -907,6 +1675,35 @@ func (es *ElasticsearchDB) doSearchRequest(req esapi.SearchRequest) (*SearchQuer
 	return &ret, nil
 }
 
+// pageStart returns where a page of transactions or events starts: the
+// offset of the page number, which only reaches the first 1000 results, or
+// the position of the cursor, if one is given, which reaches any depth.
+func pageStart(options *types.QueryOptions) (int, *types.Cursor, error) {
+	cursor, err := options.After()
+	if err != nil {
+		return 0, nil, err
+	}
+	from := 0
+	if cursor == nil {
+		from = options.PageSize * options.PageNumber
+	}
+	if from+options.PageSize > 1000 {
+		return 0, nil, ErrPaginationLimitExceeded
+	}
+	return from, cursor, nil
+}
+
+// withSearchAfter starts the results of the query after the cursor, using
+// the blockNumber and index they are sorted by
+func withSearchAfter(queryString string, cursor *types.Cursor) string {
+	if cursor == nil {
+		return queryString
+	}
+	searchAfter := fmt.Sprintf(`{
+	"search_after": [%d, %d],`, cursor.BlockNumber, cursor.Index)
+	return strings.Replace(queryString, "{", searchAfter, 1)
+}
+
 func (es *ElasticsearchDB) doCountRequest(req esapi.CountRequest) (*CountQueryResult, error) {
 	body, err := es.apiClient.DoRequest(req)
 	if err != nil {
@@ -921,7 +1718,7 @@ func (es *ElasticsearchDB) doCountRequest(req esapi.CountRequest) (*CountQueryRe
 }
 
 func (es *ElasticsearchDB) updateLastPersisted(startingBlockNumber uint64) error {
-	last, err := es.GetLastPersistedBlockNumber()
+	last, err := es.getLastPersisted()
 	if err != nil {
 		return err
 	}
@@ -1,82 +1,121 @@
 package elasticsearch
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+
 	"github.com/elastic/go-elasticsearch/v7/esapi"
+
 	"quorumengineering/quorum-report/database"
 	"quorumengineering/quorum-report/log"
 	"quorumengineering/quorum-report/types"
-	"strings"
 )
 
 const (
 	DeleteQueryContract = `{ "query": { "match": { "contract": "%s" } } }`
 	DeleteQueryAddress  = `{ "query": { "match": { "address": "%s" } } }`
+
+	// maxDeleteAttempts is how many times a delete by query is run before
+	// giving up on documents that keep changing while being deleted
+	maxDeleteAttempts = 5
 )
 
 // Delete requests need a pointer value, so this is used instead of creating a new variable every request
-var RequestParameterTrue = true
+var (
+	RequestParameterTrue  = true
+	RequestParameterFalse = false
+)
 
 //go:generate mockgen -destination=./mocks/deletion_coordiantor_mock.go -package elasticsearch_mocks . DeletionCoordinator
 type DeletionCoordinator interface {
-	Delete(contract types.Address) error
+	// Unregister marks the contract as being deleted, so that it is no longer
+	// filtered while its data is deleted
+	Unregister(contract types.Address) error
+	// Delete removes all data of an unregistered contract that isn't under
+	// legal hold, and then the contract itself, reporting progress as it goes
+	Delete(contract types.Address, progress func(types.JobProgress)) error
+	// Remove deletes the contract and its template, leaving the rest of its
+	// data in place
+	Remove(contract types.Address) error
 }
 
 type DefaultDeletionCoordinator struct {
 	apiClient APIClient
+	// how often running deletions are checked on
+	pollInterval time.Duration
 }
 
 func NewDefaultDeletionCoordinator(apiClient APIClient) *DefaultDeletionCoordinator {
 	return &DefaultDeletionCoordinator{
-		apiClient: apiClient,
+		apiClient:    apiClient,
+		pollInterval: time.Second,
 	}
 }
 
-func (coordinator *DefaultDeletionCoordinator) Delete(contract types.Address) error {
-	deleteByAddressQuery := fmt.Sprintf(DeleteQueryAddress, contract.String())
-	deleteByContractQuery := fmt.Sprintf(DeleteQueryContract, contract.String())
-
-	// delete ERC20 & ERC721 tokens
-	log.Debug("Deleting ERC20/ERC721 token data", "contract", contract.String())
-	erc20Req := esapi.DeleteByQueryRequest{
-		Index:             []string{ERC20TokenIndex, ERC721TokenIndex},
-		Body:              strings.NewReader(deleteByContractQuery),
-		Refresh:           &RequestParameterTrue,
-		WaitForCompletion: &RequestParameterTrue,
-	}
-	_, err := coordinator.apiClient.DoRequest(erc20Req)
-	if err != nil {
-		return err
+func (coordinator *DefaultDeletionCoordinator) Unregister(contract types.Address) error {
+	updateRequest := esapi.UpdateRequest{
+		Index:      ContractIndex,
+		DocumentID: contract.String(),
+		Body:       strings.NewReader(`{"doc":{"deleting":true}}`),
+		Refresh:    "true",
 	}
-	log.Debug("Deleted ERC20/ERC721 token data", "contract", contract.String())
+	_, err := coordinator.apiClient.DoRequest(updateRequest)
+	return err
+}
 
-	//delete event
-	log.Debug("Deleting contract events", "contract", contract.String())
-	eventReq := esapi.DeleteByQueryRequest{
-		Index:             []string{EventIndex},
-		Body:              strings.NewReader(deleteByAddressQuery),
-		Refresh:           &RequestParameterTrue,
-		WaitForCompletion: &RequestParameterTrue,
-	}
-	_, err = coordinator.apiClient.DoRequest(eventReq)
+func (coordinator *DefaultDeletionCoordinator) Delete(contract types.Address, progress func(types.JobProgress)) error {
+	// holds are checked when the deletion runs, so that retried and resumed
+	// deletions respect holds placed since it was requested
+	holds, err := getLegalHolds(coordinator.apiClient)
 	if err != nil {
-		return err
+		return fmt.Errorf("reading legal holds: %v", err)
 	}
-	log.Debug("Deleted contract events", "contract", contract.String())
+	if holds.HoldsContract(contract) {
+		log.Warn("Keeping data of contract under legal hold", "contract", contract.String())
+		progress(types.JobProgress{Step: "contract"})
+		return coordinator.Remove(contract)
+	}
+	deleteByAddressQuery := excludeLegalHolds(fmt.Sprintf(DeleteQueryAddress, contract.String()), holds)
+	deleteByContractQuery := excludeLegalHolds(fmt.Sprintf(DeleteQueryContract, contract.String()), holds)
 
-	log.Debug("Deleting contract storage", "contract", contract.String())
-	storageDeleteReq := esapi.DeleteByQueryRequest{
-		Index:             []string{StorageIndex},
-		Body:              strings.NewReader(deleteByContractQuery),
-		Refresh:           &RequestParameterTrue,
-		WaitForCompletion: &RequestParameterTrue,
+	steps := []struct {
+		name    string
+		indices []string
+		query   string
+	}{
+		{"tokens", []string{ERC20TokenIndex, ERC721TokenIndex, ERC1155TokenIndex, ERC20AllowanceIndex}, deleteByContractQuery},
+		{"events", []string{EventIndex}, deleteByAddressQuery},
+		{"storage", []string{StorageIndex}, deleteByContractQuery},
+		{"counterparties", []string{CounterpartyIndex}, deleteByContractQuery},
 	}
-	_, err = coordinator.apiClient.DoRequest(storageDeleteReq)
-	if err != nil {
-		return err
+	var done types.JobProgress
+	for _, step := range steps {
+		log.Debug("Deleting contract data", "contract", contract.String(), "step", step.name)
+		stepProgress, err := coordinator.deleteByQuery(step.indices, step.query, func(status DeleteByQueryStatus) {
+			progress(types.JobProgress{
+				Step:             step.name,
+				Deleted:          done.Deleted + status.Deleted,
+				Total:            done.Total + status.Total,
+				VersionConflicts: done.VersionConflicts + status.VersionConflicts,
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("deleting %s: %v", step.name, err)
+		}
+		done.Deleted += stepProgress.Deleted
+		done.Total += stepProgress.Total
+		done.VersionConflicts += stepProgress.VersionConflicts
+		log.Debug("Deleted contract data", "contract", contract.String(), "step", step.name, "deleted", stepProgress.Deleted)
 	}
-	log.Debug("Deleted contract storage", "contract", contract.String())
 
+	progress(types.JobProgress{Step: "contract", Deleted: done.Deleted, Total: done.Total, VersionConflicts: done.VersionConflicts})
+	return coordinator.Remove(contract)
+}
+
+func (coordinator *DefaultDeletionCoordinator) Remove(contract types.Address) error {
 	//delete template if specialised
 	log.Debug("Deleting contract template", "contract", contract.String())
 	deleteRequest := esapi.DeleteRequest{
@@ -84,7 +123,7 @@ func (coordinator *DefaultDeletionCoordinator) Delete(contract types.Address) er
 		DocumentID: contract.String(),
 		Refresh:    "true",
 	}
-	_, err = coordinator.apiClient.DoRequest(deleteRequest)
+	_, err := coordinator.apiClient.DoRequest(deleteRequest)
 	if err != nil && err != database.ErrNotFound {
 		return err
 	}
@@ -98,6 +137,82 @@ func (coordinator *DefaultDeletionCoordinator) Delete(contract types.Address) er
 		Refresh:    "true",
 	}
 	_, err = coordinator.apiClient.DoRequest(deleteContractRequest)
+	if err != nil && err != database.ErrNotFound {
+		return err
+	}
 	log.Debug("Deleted contract", "contract", contract.String())
-	return err
+	return nil
+}
+
+// deleteByQuery runs the delete as an Elasticsearch task, and waits for it to
+// finish. Documents that change while being deleted are skipped by the task,
+// so it is run again until there are none. The returned counts are over all
+// runs, as are those reported while it is running.
+func (coordinator *DefaultDeletionCoordinator) deleteByQuery(indices []string, query string, progress func(DeleteByQueryStatus)) (DeleteByQueryStatus, error) {
+	var done DeleteByQueryStatus
+	for attempt := 1; ; attempt++ {
+		status, err := coordinator.runDeleteTask(indices, query, func(status DeleteByQueryStatus) {
+			progress(DeleteByQueryStatus{
+				Total:            done.Total + status.Total,
+				Deleted:          done.Deleted + status.Deleted,
+				VersionConflicts: done.VersionConflicts + status.VersionConflicts,
+			})
+		})
+		if err != nil {
+			return done, err
+		}
+		// conflicting documents are found again by the next run, so only
+		// count them once
+		done.Total += status.Total - status.VersionConflicts
+		done.Deleted += status.Deleted
+		done.VersionConflicts += status.VersionConflicts
+		if status.VersionConflicts == 0 {
+			return done, nil
+		}
+		if attempt == maxDeleteAttempts {
+			return done, fmt.Errorf("%d documents still changing after %d attempts", status.VersionConflicts, attempt)
+		}
+		log.Debug("Retrying delete after version conflicts", "indices", indices, "conflicts", status.VersionConflicts, "attempt", attempt)
+	}
+}
+
+func (coordinator *DefaultDeletionCoordinator) runDeleteTask(indices []string, query string, progress func(DeleteByQueryStatus)) (DeleteByQueryStatus, error) {
+	deleteRequest := esapi.DeleteByQueryRequest{
+		Index:             indices,
+		Body:              strings.NewReader(query),
+		Conflicts:         "proceed",
+		Refresh:           &RequestParameterTrue,
+		WaitForCompletion: &RequestParameterFalse,
+	}
+	body, err := coordinator.apiClient.DoRequest(deleteRequest)
+	if err != nil {
+		return DeleteByQueryStatus{}, err
+	}
+	var started DeleteByQueryTask
+	if err := json.Unmarshal(body, &started); err != nil {
+		return DeleteByQueryStatus{}, err
+	}
+
+	for {
+		body, err := coordinator.apiClient.DoRequest(esapi.TasksGetRequest{TaskID: started.Task})
+		if err != nil {
+			return DeleteByQueryStatus{}, err
+		}
+		var result DeleteByQueryTaskResult
+		if err := json.Unmarshal(body, &result); err != nil {
+			return DeleteByQueryStatus{}, err
+		}
+		progress(result.Task.Status)
+		if !result.Completed {
+			time.Sleep(coordinator.pollInterval)
+			continue
+		}
+		if result.Error != nil {
+			return DeleteByQueryStatus{}, errors.New(result.Error.Type + ": " + result.Error.Reason)
+		}
+		if len(result.Response.Failures) > 0 {
+			return DeleteByQueryStatus{}, fmt.Errorf("%d documents failed to be deleted, first failure: %s", len(result.Response.Failures), result.Response.Failures[0])
+		}
+		return result.Response.DeleteByQueryStatus, nil
+	}
 }
@@ -9,9 +9,29 @@ import (
 
 	"github.com/golang/mock/gomock"
 
+	"quorumengineering/quorum-report/database"
 	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
 )
 
+func TestDefaultDeletionCoordinator_Unregister(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	deleter := NewDefaultDeletionCoordinator(mockedClient)
+
+	unregister := esapi.UpdateRequest{
+		Index:      ContractIndex,
+		DocumentID: "0x0000000000000000000000000000000000000001",
+		Body:       strings.NewReader(`{"doc":{"deleting":true}}`),
+	}
+	mockedClient.EXPECT().DoRequest(NewUpdateRequestMatcher(unregister)).Return(nil, nil)
+
+	err := deleter.Unregister(types.NewAddress("1"))
+	assert.Nil(t, err)
+}
+
 func TestDefaultDeletionCoordinator_Delete(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -19,35 +39,110 @@ func TestDefaultDeletionCoordinator_Delete(t *testing.T) {
 	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
 
 	deleter := NewDefaultDeletionCoordinator(mockedClient)
+	deleter.pollInterval = 0
 
 	addressToDelete := types.NewAddress("1")
+	// no legal holds have been placed
+	mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return(nil, ErrIndexNotFound)
 
 	ercDelete := esapi.DeleteByQueryRequest{
-		Index: []string{ERC20TokenIndex, ERC721TokenIndex},
+		Index: []string{ERC20TokenIndex, ERC721TokenIndex, ERC1155TokenIndex, ERC20AllowanceIndex},
 		Body:  strings.NewReader(`{ "query": { "match": { "contract": "0x0000000000000000000000000000000000000001" } } }`),
 	}
-	mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(ercDelete)).Return(nil, nil)
+	mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(ercDelete)).Return([]byte(`{"task":"node:1"}`), nil)
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(NewTasksGetRequestMatcher(esapi.TasksGetRequest{TaskID: "node:1"})).
+			Return([]byte(`{"completed":false,"task":{"status":{"total":4,"deleted":1}}}`), nil),
+		mockedClient.EXPECT().DoRequest(NewTasksGetRequestMatcher(esapi.TasksGetRequest{TaskID: "node:1"})).
+			Return([]byte(`{"completed":true,"task":{"status":{"total":4,"deleted":4}},"response":{"total":4,"deleted":4}}`), nil),
+	)
 	eventDelete := esapi.DeleteByQueryRequest{
 		Index: []string{EventIndex},
 		Body:  strings.NewReader(`{ "query": { "match": { "address": "0x0000000000000000000000000000000000000001" } } }`),
 	}
-	mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(eventDelete)).Return(nil, nil)
+	mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(eventDelete)).Return([]byte(`{"task":"node:2"}`), nil)
+	mockedClient.EXPECT().DoRequest(NewTasksGetRequestMatcher(esapi.TasksGetRequest{TaskID: "node:2"})).
+		Return([]byte(`{"completed":true,"task":{"status":{"total":2,"deleted":2}},"response":{"total":2,"deleted":2}}`), nil)
 	storageDelete := esapi.DeleteByQueryRequest{
 		Index: []string{StorageIndex},
 		Body:  strings.NewReader(`{ "query": { "match": { "contract": "0x0000000000000000000000000000000000000001" } } }`),
 	}
-	mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(storageDelete)).Return(nil, nil)
+	mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(storageDelete)).Return([]byte(`{"task":"node:3"}`), nil)
+	mockedClient.EXPECT().DoRequest(NewTasksGetRequestMatcher(esapi.TasksGetRequest{TaskID: "node:3"})).
+		Return([]byte(`{"completed":true,"task":{"status":{"total":0,"deleted":0}},"response":{"total":0,"deleted":0}}`), nil)
+	counterpartyDelete := esapi.DeleteByQueryRequest{
+		Index: []string{CounterpartyIndex},
+		Body:  strings.NewReader(`{ "query": { "match": { "contract": "0x0000000000000000000000000000000000000001" } } }`),
+	}
+	mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(counterpartyDelete)).Return([]byte(`{"task":"node:4"}`), nil)
+	mockedClient.EXPECT().DoRequest(NewTasksGetRequestMatcher(esapi.TasksGetRequest{TaskID: "node:4"})).
+		Return([]byte(`{"completed":true,"task":{"status":{"total":3,"deleted":3}},"response":{"total":3,"deleted":3}}`), nil)
 	templateDelete := esapi.DeleteRequest{
 		Index:      TemplateIndex,
 		DocumentID: addressToDelete.String(),
 	}
-	mockedClient.EXPECT().DoRequest(NewDeleteRequestMatcher(templateDelete)).Return(nil, nil)
+	mockedClient.EXPECT().DoRequest(NewDeleteRequestMatcher(templateDelete)).Return(nil, database.ErrNotFound)
 	contractDelete := esapi.DeleteRequest{
 		Index:      ContractIndex,
 		DocumentID: addressToDelete.String(),
 	}
 	mockedClient.EXPECT().DoRequest(NewDeleteRequestMatcher(contractDelete)).Return(nil, nil)
 
-	err := deleter.Delete(addressToDelete)
+	var reported []types.JobProgress
+	err := deleter.Delete(addressToDelete, func(progress types.JobProgress) {
+		reported = append(reported, progress)
+	})
+
 	assert.Nil(t, err)
+	assert.Equal(t, []types.JobProgress{
+		{Step: "tokens", Deleted: 1, Total: 4},
+		{Step: "tokens", Deleted: 4, Total: 4},
+		{Step: "events", Deleted: 6, Total: 6},
+		{Step: "storage", Deleted: 6, Total: 6},
+		{Step: "counterparties", Deleted: 9, Total: 9},
+		{Step: "contract", Deleted: 9, Total: 9},
+	}, reported)
+}
+
+func TestDefaultDeletionCoordinator_Delete_RetriesVersionConflicts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	deleter := NewDefaultDeletionCoordinator(mockedClient)
+	deleter.pollInterval = 0
+
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.DeleteByQueryRequest{})).Return([]byte(`{"task":"node:1"}`), nil),
+		mockedClient.EXPECT().DoRequest(NewTasksGetRequestMatcher(esapi.TasksGetRequest{TaskID: "node:1"})).
+			Return([]byte(`{"completed":true,"response":{"total":5,"deleted":3,"version_conflicts":2}}`), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.DeleteByQueryRequest{})).Return([]byte(`{"task":"node:2"}`), nil),
+		mockedClient.EXPECT().DoRequest(NewTasksGetRequestMatcher(esapi.TasksGetRequest{TaskID: "node:2"})).
+			Return([]byte(`{"completed":true,"response":{"total":2,"deleted":2}}`), nil),
+	)
+
+	status, err := deleter.deleteByQuery([]string{EventIndex}, "{}", func(DeleteByQueryStatus) {})
+
+	assert.Nil(t, err)
+	assert.Equal(t, DeleteByQueryStatus{Total: 5, Deleted: 5, VersionConflicts: 2}, status)
+}
+
+func TestDefaultDeletionCoordinator_Delete_TaskFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	deleter := NewDefaultDeletionCoordinator(mockedClient)
+	deleter.pollInterval = 0
+
+	mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return(nil, ErrIndexNotFound)
+	mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.DeleteByQueryRequest{})).Return([]byte(`{"task":"node:1"}`), nil)
+	mockedClient.EXPECT().DoRequest(NewTasksGetRequestMatcher(esapi.TasksGetRequest{TaskID: "node:1"})).
+		Return([]byte(`{"completed":true,"error":{"type":"search_phase_execution_exception","reason":"all shards failed"}}`), nil)
+
+	err := deleter.Delete(types.NewAddress("1"), func(types.JobProgress) {})
+
+	assert.EqualError(t, err, "deleting tokens: search_phase_execution_exception: all shards failed")
 }
@@ -0,0 +1,209 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"quorumengineering/quorum-report/log"
+)
+
+// loadBatchSize is how many documents of a dump are written in each bulk
+// request when loading it
+const loadBatchSize = 1000
+
+// DumpHeader is the first line of an index dump, describing the documents on
+// the lines after it
+type DumpHeader struct {
+	Index string `json:"index"`
+	// the version of the index's mappings the documents fit
+	Version       int             `json:"version"`
+	SchemaVersion int             `json:"schemaVersion"`
+	Mappings      json.RawMessage `json:"mappings,omitempty"`
+}
+
+// DumpedDocument is a document of an index dump, as stored
+type DumpedDocument struct {
+	ID     string          `json:"_id"`
+	Source json.RawMessage `json:"_source"`
+}
+
+// DumpableIndexes are the indices that can be dumped and loaded
+func DumpableIndexes() []string {
+	indices := make([]string, len(indexMappings))
+	for i, m := range indexMappings {
+		indices[i] = m.index
+	}
+	return indices
+}
+
+func findIndexMapping(index string) (indexMapping, error) {
+	for _, m := range indexMappings {
+		if m.index == index {
+			return m, nil
+		}
+	}
+	return indexMapping{}, fmt.Errorf("unknown index %q", index)
+}
+
+// DumpIndex writes every document of an index to w as newline-delimited JSON,
+// after a header giving the version of the index, so it can be loaded into
+// another database, or read with standard tools. It returns the number of
+// documents written.
+func (es *ElasticsearchDB) DumpIndex(index string, w io.Writer) (uint64, error) {
+	m, err := findIndexMapping(index)
+	if err != nil {
+		return 0, err
+	}
+	_, version, err := es.indexVersion(index)
+	if err != nil {
+		return 0, err
+	}
+	if version == 0 {
+		return 0, ErrIndexNotFound
+	}
+	schemaVersion, err := es.GetSchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+	header := DumpHeader{Index: index, Version: version, SchemaVersion: schemaVersion}
+	// the mappings of older versions are not kept
+	if version == m.version && m.mappings != "" {
+		header.Mappings = json.RawMessage(m.mappings)
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(header); err != nil {
+		return 0, err
+	}
+	var count uint64
+	err = es.scrollWithIDs(index, QueryAllDocumentsTemplate, []string{"_doc"}, func(id string, source json.RawMessage) error {
+		count++
+		return encoder.Encode(DumpedDocument{ID: id, Source: source})
+	})
+	return count, err
+}
+
+// LoadIndex writes the documents of an index dump into the index it was taken
+// from, creating the index if it doesn't exist. Documents already in the index
+// with the same IDs are replaced. The dump must be of the version of the index
+// this version of the reporting tool uses. It returns the header of the dump,
+// and the number of documents loaded.
+func (es *ElasticsearchDB) LoadIndex(r io.Reader) (*DumpHeader, uint64, error) {
+	decoder := json.NewDecoder(r)
+	var header DumpHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, 0, fmt.Errorf("reading dump header: %v", err)
+	}
+	m, err := findIndexMapping(header.Index)
+	if err != nil {
+		return nil, 0, err
+	}
+	if header.Version != m.version {
+		return nil, 0, fmt.Errorf("dump of index %s is at version %d, but this version of the reporting tool uses version %d", header.Index, header.Version, m.version)
+	}
+
+	_, version, err := es.indexVersion(header.Index)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case version == 0:
+		if _, err := es.apiClient.DoRequest(m.createRequest(true)); err != nil {
+			return nil, 0, fmt.Errorf("creating index %s: %v", header.Index, err)
+		}
+		log.Info("Created index", "index", header.Index, "version", m.version)
+	case version != m.version:
+		return nil, 0, fmt.Errorf("index %s is at version %d, run migrate before loading a dump of version %d", header.Index, version, m.version)
+	}
+
+	var (
+		count uint64
+		batch bytes.Buffer
+		size  int
+	)
+	for {
+		var document DumpedDocument
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &header, count, fmt.Errorf("reading document %d of the dump: %v", count+uint64(size)+1, err)
+		}
+		if err := appendBulkIndex(&batch, document); err != nil {
+			return &header, count, err
+		}
+		size++
+		if size == loadBatchSize {
+			if err := es.loadBatch(header.Index, &batch); err != nil {
+				return &header, count, err
+			}
+			count += uint64(size)
+			size = 0
+		}
+	}
+	if size > 0 {
+		if err := es.loadBatch(header.Index, &batch); err != nil {
+			return &header, count, err
+		}
+		count += uint64(size)
+	}
+
+	if _, err := es.apiClient.DoRequest(esapi.IndicesRefreshRequest{Index: []string{header.Index}}); err != nil {
+		return &header, count, err
+	}
+	return &header, count, nil
+}
+
+// appendBulkIndex adds the action indexing the document, and the document, to
+// the body of a bulk request
+func appendBulkIndex(batch *bytes.Buffer, document DumpedDocument) error {
+	if document.ID == "" || len(document.Source) == 0 {
+		return fmt.Errorf("document without an ID or source in the dump")
+	}
+	action, err := json.Marshal(map[string]interface{}{"index": map[string]string{"_id": document.ID}})
+	if err != nil {
+		return err
+	}
+	batch.Write(action)
+	batch.WriteByte('\n')
+	if err := json.Compact(batch, document.Source); err != nil {
+		return err
+	}
+	batch.WriteByte('\n')
+	return nil
+}
+
+// loadBatch writes the documents of the bulk request body into the index,
+// emptying the body
+func (es *ElasticsearchDB) loadBatch(index string, batch *bytes.Buffer) error {
+	defer batch.Reset()
+	body, err := es.apiClient.DoRequest(esapi.BulkRequest{Index: index, Body: bytes.NewReader(batch.Bytes())})
+	if err != nil {
+		return err
+	}
+	var result BulkResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	if !result.Errors {
+		return nil
+	}
+	var failed int
+	var first json.RawMessage
+	for _, item := range result.Items {
+		for _, outcome := range item {
+			if len(outcome.Error) > 0 {
+				if failed == 0 {
+					first = outcome.Error
+				}
+				failed++
+			}
+		}
+	}
+	return fmt.Errorf("%d documents failed to load into index %s, the first with %s", failed, index, first)
+}
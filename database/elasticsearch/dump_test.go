@@ -0,0 +1,137 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+)
+
+func TestElasticsearchDB_DumpIndex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	db, _ := New(mockedClient)
+
+	var search esapi.SearchRequest
+	mockedClient.EXPECT().DoRequest(gomock.Any()).DoAndReturn(func(req esapi.Request) ([]byte, error) {
+		switch r := req.(type) {
+		case esapi.CatAliasesRequest:
+			return []byte(`[{"alias":"transaction","index":"transaction_v2"}]`), nil
+		case esapi.GetRequest:
+			return []byte(`{"_source": {"schemaVersion": 2}}`), nil
+		case esapi.SearchRequest:
+			search = r
+			return []byte(`{"_scroll_id": "scroll1", "hits": {"hits": [
+				{"_id": "0x01", "_source": {"hash": "0x01", "blockNumber": 1}},
+				{"_id": "0x02", "_source": {"hash": "0x02", "blockNumber": 2}}
+			]}}`), nil
+		case esapi.ScrollRequest:
+			return []byte(`{"_scroll_id": "scroll1", "hits": {"hits": []}}`), nil
+		case esapi.ClearScrollRequest:
+		default:
+			t.Fatalf("unexpected request %T", req)
+		}
+		return nil, nil
+	}).AnyTimes()
+
+	var out bytes.Buffer
+	count, err := db.DumpIndex(TransactionIndex, &out)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, count)
+	assert.Equal(t, []string{TransactionIndex}, search.Index)
+	assert.Equal(t, []string{"_doc"}, search.Sort)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, []string{
+		`{"index":"transaction","version":2,"schemaVersion":2,"mappings":{"properties":{"internalCalls":{"type":"nested"},"contract":{"type":"keyword"},"selector":{"type":"keyword"}}}}`,
+		`{"_id":"0x01","_source":{"hash":"0x01","blockNumber":1}}`,
+		`{"_id":"0x02","_source":{"hash":"0x02","blockNumber":2}}`,
+	}, lines)
+
+	_, err = db.DumpIndex("unknown", &out)
+	assert.EqualError(t, err, `unknown index "unknown"`)
+}
+
+func TestElasticsearchDB_LoadIndex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	db, _ := New(mockedClient)
+
+	var requests []string
+	mockedClient.EXPECT().DoRequest(gomock.Any()).DoAndReturn(func(req esapi.Request) ([]byte, error) {
+		switch r := req.(type) {
+		case esapi.CatAliasesRequest:
+			return []byte(`[]`), nil
+		case esapi.CatIndicesRequest:
+			return nil, ErrIndexNotFound
+		case esapi.IndicesCreateRequest:
+			requests = append(requests, "create "+r.Index)
+		case esapi.BulkRequest:
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, "bulk "+r.Index+"\n"+string(body))
+			return []byte(`{"errors": false, "items": []}`), nil
+		case esapi.IndicesRefreshRequest:
+			requests = append(requests, "refresh "+r.Index[0])
+		default:
+			t.Fatalf("unexpected request %T", req)
+		}
+		return nil, nil
+	}).AnyTimes()
+
+	dump := `{"index":"block","version":1,"schemaVersion":2}
+{"_id":"1","_source":{"number": 1}}
+{"_id":"2","_source":{"number": 2}}
+`
+	header, count, err := db.LoadIndex(strings.NewReader(dump))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, count)
+	assert.Equal(t, BlockIndex, header.Index)
+	assert.Equal(t, []string{
+		"create block_v1",
+		"bulk block\n" + `{"index":{"_id":"1"}}` + "\n" + `{"number":1}` + "\n" + `{"index":{"_id":"2"}}` + "\n" + `{"number":2}` + "\n",
+		"refresh block",
+	}, requests)
+}
+
+func TestElasticsearchDB_LoadIndex_Rejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	db, _ := New(mockedClient)
+
+	_, _, err := db.LoadIndex(strings.NewReader(`{"index":"event","version":1,"schemaVersion":1}`))
+	assert.EqualError(t, err, "dump of index event is at version 1, but this version of the reporting tool uses version 2")
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()).DoAndReturn(func(req esapi.Request) ([]byte, error) {
+		switch req.(type) {
+		case esapi.CatAliasesRequest:
+			return []byte(`[{"alias":"block","index":"block_v1"}]`), nil
+		case esapi.BulkRequest:
+			return []byte(`{"errors": true, "items": [
+				{"index": {"_id": "1", "status": 201}},
+				{"index": {"_id": "2", "status": 400, "error": {"type": "mapper_parsing_exception"}}}
+			]}`), nil
+		}
+		t.Fatalf("unexpected request %T", req)
+		return nil, nil
+	}).AnyTimes()
+	_, count, err := db.LoadIndex(strings.NewReader(`{"index":"block","version":1,"schemaVersion":2}
+{"_id":"1","_source":{"number": 1}}
+{"_id":"2","_source":{"number": "two"}}`))
+	assert.EqualError(t, err, `1 documents failed to load into index block, the first with {"type": "mapper_parsing_exception"}`)
+	assert.EqualValues(t, 0, count)
+}
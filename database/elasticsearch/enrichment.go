@@ -0,0 +1,122 @@
+package elasticsearch
+
+import (
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+type contractEnrichment struct {
+	mapping    types.EnrichmentMapping
+	abi        string
+	classifier *types.SeverityClassifier
+}
+
+// documentEnricher decodes transactions and events of contracts that have an
+// enrichment mapping, and picks out the mapped fields, and classifies the
+// events of contracts that have severity rules. The mapping, rules and ABI of
+// each contract are only looked up once.
+type documentEnricher struct {
+	getEnrichment    func(types.Address) (types.EnrichmentMapping, error)
+	getSeverityRules func(types.Address) (types.SeverityRules, error)
+	getABI           func(types.Address) (string, error)
+	contracts        map[types.Address]*contractEnrichment
+}
+
+func newDocumentEnricher(getEnrichment func(types.Address) (types.EnrichmentMapping, error), getSeverityRules func(types.Address) (types.SeverityRules, error), getABI func(types.Address) (string, error)) *documentEnricher {
+	return &documentEnricher{
+		getEnrichment:    getEnrichment,
+		getSeverityRules: getSeverityRules,
+		getABI:           getABI,
+		contracts:        make(map[types.Address]*contractEnrichment),
+	}
+}
+
+func (de *documentEnricher) contract(address types.Address) (*contractEnrichment, error) {
+	if contract, ok := de.contracts[address]; ok {
+		return contract, nil
+	}
+	contract := &contractEnrichment{}
+	mapping, err := de.getEnrichment(address)
+	if err != nil && err != database.ErrNotFound {
+		return nil, err
+	}
+	rules, err := de.getSeverityRules(address)
+	if err != nil && err != database.ErrNotFound {
+		return nil, err
+	}
+	if len(mapping) > 0 || len(rules) > 0 {
+		// neither can be applied without an ABI to decode with
+		abi, err := de.getABI(address)
+		if err != nil {
+			return nil, err
+		}
+		if abi != "" && len(mapping) > 0 {
+			contract.mapping = mapping
+			contract.abi = abi
+		}
+		if abi != "" && len(rules) > 0 {
+			contract.classifier = newClassifier(address, rules, abi)
+		}
+	}
+	de.contracts[address] = contract
+	return contract, nil
+}
+
+// newClassifier returns the classifier of the rules, or nil if they no
+// longer fit the contract's ABI, such as after it was changed
+func newClassifier(address types.Address, rules types.SeverityRules, abi string) *types.SeverityClassifier {
+	structure, err := types.NewABIStructureFromJSON(abi)
+	if err != nil {
+		return nil
+	}
+	classifier, err := types.NewSeverityClassifier(rules, structure.ToInternalABI())
+	if err != nil {
+		log.Warn("Severity rules don't fit the contract ABI", "address", address.Hex(), "err", err)
+		return nil
+	}
+	return classifier
+}
+
+func (de *documentEnricher) transactionFields(transaction *types.Transaction) (map[string]interface{}, error) {
+	contract, err := de.contract(transaction.To)
+	if err != nil || contract.mapping == nil {
+		return nil, err
+	}
+	data := transaction.Data
+	if len(transaction.PrivateData) > 0 {
+		data = transaction.PrivateData
+	}
+	if len(data.AsBytes()) < 4 {
+		// a plain value transfer, with no function call to decode
+		return nil, nil
+	}
+	parsedTx := &types.ParsedTransaction{RawTransaction: transaction}
+	if err := parsedTx.ParseTransaction(contract.abi); err != nil {
+		log.Debug("Unable to parse transaction for enrichment", "tx", transaction.Hash.Hex(), "err", err)
+		return nil, nil
+	}
+	return contract.mapping.Fields(parsedTx.ParsedData), nil
+}
+
+func (de *documentEnricher) eventFields(event *types.Event) (map[string]interface{}, error) {
+	contract, err := de.contract(event.Address)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	if contract.mapping != nil {
+		parsedEvent := &types.ParsedEvent{RawEvent: event}
+		if err := parsedEvent.ParseEvent(contract.abi); err != nil {
+			log.Debug("Unable to parse event for enrichment", "address", event.Address.Hex(), "tx", event.TransactionHash.Hex(), "err", err)
+		} else {
+			fields = contract.mapping.Fields(parsedEvent.ParsedData)
+		}
+	}
+	if contract.classifier != nil {
+		if severity := contract.classifier.Classify(event); severity != "" {
+			fields[types.SeverityField] = severity
+		}
+	}
+	return fields, nil
+}
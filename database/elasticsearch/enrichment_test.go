@@ -0,0 +1,85 @@
+package elasticsearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/types"
+)
+
+const enrichmentABI = `[
+	{"constant":false,"inputs":[{"name":"_x","type":"uint256"}],"name":"set","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},
+	{"anonymous":false,"inputs":[{"indexed":false,"name":"_value","type":"uint256"}],"name":"valueSet","type":"event"}
+]`
+
+func TestDocumentEnricher(t *testing.T) {
+	enriched := types.NewAddress("0x0000000000000000000000000000000000000001")
+	plain := types.NewAddress("0x0000000000000000000000000000000000000002")
+	lookups := 0
+	enricher := newDocumentEnricher(func(address types.Address) (types.EnrichmentMapping, error) {
+		lookups++
+		switch address {
+		case enriched:
+			return types.EnrichmentMapping{"x": "_x", "newValue": "_value"}, nil
+		case plain:
+			return nil, nil
+		}
+		return nil, database.ErrNotFound
+	}, func(address types.Address) (types.SeverityRules, error) {
+		return nil, nil
+	}, func(address types.Address) (string, error) {
+		return enrichmentABI, nil
+	})
+
+	tx := &types.Transaction{To: enriched, Data: types.NewHexData("0x60fe47b100000000000000000000000000000000000000000000000000000000000003e7")}
+	fields, err := enricher.transactionFields(tx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"x": "999"}, fields)
+
+	event := &types.Event{
+		Address: enriched,
+		Topics:  []types.Hash{types.NewHash("0xefe5cb8d23d632b5d2cdd9f0a151c4b1a84ccb7afa1c57331009aa922d5e4f36")},
+		Data:    types.NewHexData("0x00000000000000000000000000000000000000000000000000000000000003e8"),
+	}
+	fields, err = enricher.eventFields(event)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"newValue": "1000"}, fields)
+
+	// value transfers have nothing to decode
+	fields, err = enricher.transactionFields(&types.Transaction{To: enriched})
+	assert.Nil(t, err)
+	assert.Len(t, fields, 0)
+
+	// contracts without a mapping, or that have been deleted
+	for _, address := range []types.Address{plain, types.NewAddress("0x0000000000000000000000000000000000000003")} {
+		fields, err = enricher.eventFields(&types.Event{Address: address, Topics: event.Topics, Data: event.Data})
+		assert.Nil(t, err)
+		assert.Len(t, fields, 0)
+	}
+	assert.Equal(t, 3, lookups)
+}
+
+func TestDocumentEnricher_Severity(t *testing.T) {
+	classified := types.NewAddress("0x0000000000000000000000000000000000000001")
+	enricher := newDocumentEnricher(func(address types.Address) (types.EnrichmentMapping, error) {
+		return nil, nil
+	}, func(address types.Address) (types.SeverityRules, error) {
+		return types.SeverityRules{
+			{Event: "valueSet", Severity: types.InfoSeverity},
+			{Event: "valueSet(uint256)", Parameter: "_value", Operator: types.GreaterOperator, Value: "999", Severity: types.CriticalSeverity},
+		}, nil
+	}, func(address types.Address) (string, error) {
+		return enrichmentABI, nil
+	})
+
+	topics := []types.Hash{types.NewHash("0xefe5cb8d23d632b5d2cdd9f0a151c4b1a84ccb7afa1c57331009aa922d5e4f36")}
+	fields, err := enricher.eventFields(&types.Event{Address: classified, Topics: topics, Data: types.NewHexData("0x00000000000000000000000000000000000000000000000000000000000003e8")})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"severity": types.CriticalSeverity}, fields)
+
+	fields, err = enricher.eventFields(&types.Event{Address: classified, Topics: topics, Data: types.NewHexData("0x00000000000000000000000000000000000000000000000000000000000003e7")})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"severity": types.InfoSeverity}, fields)
+}
@@ -0,0 +1,170 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// eventMappings stores the topics of events by position as keywords, as the
+// topics array can only match a topic in any position, and the severity
+// events are classified with, to be counted by
+const eventMappings = `{"properties": {"topic0": {"type": "keyword"}, "topic1": {"type": "keyword"}, "topic2": {"type": "keyword"}, "topic3": {"type": "keyword"}, "severity": {"type": "keyword"}}}`
+
+// eventTopicsScript fills in the topics by position of events indexed before
+// they were stored
+const eventTopicsScript = `
+def topics = ctx._source.topics;
+if (topics != null) {
+	for (int i = 0; i < topics.size() && i < 4; i++) {
+		ctx._source['topic' + i] = topics[i];
+	}
+}
+`
+
+// Event is the document of an event, with its topics also stored by position
+type Event struct {
+	*types.Event
+	Topic0 types.Hash `json:"topic0,omitempty"`
+	Topic1 types.Hash `json:"topic1,omitempty"`
+	Topic2 types.Hash `json:"topic2,omitempty"`
+	Topic3 types.Hash `json:"topic3,omitempty"`
+	// the checksum of the event, without the topics by position
+	Checksum string `json:"checksum,omitempty"`
+}
+
+func newEventDocument(event *types.Event) (*Event, error) {
+	checksum, err := types.Checksum(event)
+	if err != nil {
+		return nil, err
+	}
+	document := &Event{Event: event, Checksum: checksum}
+	positions := []*types.Hash{&document.Topic0, &document.Topic1, &document.Topic2, &document.Topic3}
+	for i, topic := range event.Topics {
+		if i < len(positions) {
+			*positions[i] = topic
+		}
+	}
+	return document, nil
+}
+
+func (es *ElasticsearchDB) GetEventsByTopics(query *types.EventTopicQuery, options *types.QueryOptions) ([]*types.Event, error) {
+	from, cursor, err := pageStart(options)
+	if err != nil {
+		return nil, err
+	}
+	queryString, err := es.eventsByTopicsQuery(query, options)
+	if err != nil || queryString == "" {
+		return []*types.Event{}, err
+	}
+	req := esapi.SearchRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(withSearchAfter(queryString, cursor)),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"blockNumber:desc", "index:asc"},
+	}
+	results, err := es.doSearchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*types.Event, len(results.Hits.Hits))
+	for i, result := range results.Hits.Hits {
+		marshalled, _ := json.Marshal(result.Source)
+		var event types.Event
+		if err = json.Unmarshal(marshalled, &event); err != nil {
+			return nil, err
+		}
+		events[i] = &event
+	}
+	return events, nil
+}
+
+func (es *ElasticsearchDB) GetEventsByTopicsTotal(query *types.EventTopicQuery, options *types.QueryOptions) (uint64, error) {
+	queryString, err := es.eventsByTopicsQuery(query, options)
+	if err != nil || queryString == "" {
+		return 0, err
+	}
+	req := esapi.CountRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(queryString),
+	}
+	results, err := es.doCountRequest(req)
+	if err != nil {
+		return 0, err
+	}
+	return results.Count, nil
+}
+
+func (es *ElasticsearchDB) GetEventsInOrder(contracts []types.Address, after *types.Cursor, toBlock uint64, limit int) ([]*types.Event, error) {
+	if len(contracts) == 0 {
+		return []*types.Event{}, nil
+	}
+	// the events of the contracts in the block range, with any topics
+	options := &types.QueryOptions{EndBlockNumber: new(big.Int).SetUint64(toBlock)}
+	options.SetDefaults()
+	req := esapi.SearchRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(withSearchAfter(QueryEventsByTopicsTemplate(contracts, nil, options), after)),
+		Size:  &limit,
+		Sort:  []string{"blockNumber:asc", "index:asc"},
+	}
+	results, err := es.doSearchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*types.Event, len(results.Hits.Hits))
+	for i, result := range results.Hits.Hits {
+		marshalled, _ := json.Marshal(result.Source)
+		var event types.Event
+		if err = json.Unmarshal(marshalled, &event); err != nil {
+			return nil, err
+		}
+		events[i] = &event
+	}
+	return events, nil
+}
+
+// eventsByTopicsQuery builds the query for the events, which is empty if no
+// contracts are registered, so nothing can match
+func (es *ElasticsearchDB) eventsByTopicsQuery(query *types.EventTopicQuery, options *types.QueryOptions) (string, error) {
+	addresses, err := es.queriedContracts(query.Address, query.Contracts)
+	if err != nil || len(addresses) == 0 {
+		return "", err
+	}
+	return QueryEventsByTopicsTemplate(addresses, query.Topics, options), nil
+}
+
+// queriedContracts returns the contract of a query, or the registered
+// contracts, or those of the contracts if not nil
+func (es *ElasticsearchDB) queriedContracts(contract *types.Address, contracts []types.Address) ([]types.Address, error) {
+	if contract != nil {
+		return []types.Address{*contract}, nil
+	}
+	registered, err := es.GetAddresses()
+	if err != nil {
+		return nil, err
+	}
+	var addresses []types.Address
+	for _, address := range registered {
+		if contracts == nil || containsAddress(contracts, address) {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses, nil
+}
+
+func containsAddress(addresses []types.Address, address types.Address) bool {
+	for _, a := range addresses {
+		if address == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package elasticsearch
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestNewEventDocument(t *testing.T) {
+	event := &types.Event{
+		Address: types.NewAddress("1"),
+		Topics:  []types.Hash{types.NewHash("0x01"), types.NewHash("0x02")},
+	}
+
+	document, err := newEventDocument(event)
+
+	assert.Nil(t, err)
+	assert.Equal(t, event, document.Event)
+	assert.Equal(t, types.NewHash("0x01"), document.Topic0)
+	assert.Equal(t, types.NewHash("0x02"), document.Topic1)
+	assert.True(t, document.Topic2.IsEmpty())
+	assert.True(t, document.Topic3.IsEmpty())
+	checksum, _ := types.Checksum(event)
+	assert.Equal(t, checksum, document.Checksum)
+}
+
+func TestQueryEventsByTopicsTemplate(t *testing.T) {
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	topic0, topic2 := types.NewHash("0x01"), types.NewHash("0x02")
+	topics := []*types.Hash{&topic0, nil, &topic2}
+
+	single := QueryEventsByTopicsTemplate([]types.Address{types.NewAddress("1")}, topics, options)
+	assert.Contains(t, single, `{ "match": { "address": "0x0000000000000000000000000000000000000001" } }`)
+	assert.Contains(t, single, `{ "term": { "topic0": "0x0000000000000000000000000000000000000000000000000000000000000001" } }`)
+	assert.NotContains(t, single, "topic1")
+	assert.Contains(t, single, `{ "term": { "topic2": "0x0000000000000000000000000000000000000000000000000000000000000002" } }`)
+
+	several := QueryEventsByTopicsTemplate([]types.Address{types.NewAddress("1"), types.NewAddress("2")}, topics, options)
+	assert.Contains(t, several, `{ "terms": { "address.keyword": ["0x0000000000000000000000000000000000000001","0x0000000000000000000000000000000000000002"] } }`)
+}
+
+func TestElasticsearchDB_GetEventsByTopics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	address := types.NewAddress("1")
+	topic0 := types.NewHash("0x01")
+	query := &types.EventTopicQuery{Address: &address, Topics: []*types.Hash{&topic0}}
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	from := 0
+	ex := esapi.SearchRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(QueryEventsByTopicsTemplate([]types.Address{address}, query.Topics, options)),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"blockNumber:desc", "index:asc"},
+	}
+	result := `{"hits":{"hits":[{"_source":{"address":"0x0000000000000000000000000000000000000001","blockNumber":5,"topics":["0x0000000000000000000000000000000000000000000000000000000000000001"],"topic0":"0x0000000000000000000000000000000000000000000000000000000000000001"}}]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(ex)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+
+	events, err := db.GetEventsByTopics(query, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Event{{Address: address, BlockNumber: 5, Topics: []types.Hash{topic0}}}, events)
+}
+
+func TestElasticsearchDB_GetEventsInOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	contracts := []types.Address{types.NewAddress("1"), types.NewAddress("2")}
+	options := &types.QueryOptions{EndBlockNumber: big.NewInt(20)}
+	options.SetDefaults()
+	limit := 2
+	ex := esapi.SearchRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(withSearchAfter(QueryEventsByTopicsTemplate(contracts, nil, options), &types.Cursor{BlockNumber: 5, Index: 1})),
+		Size:  &limit,
+		Sort:  []string{"blockNumber:asc", "index:asc"},
+	}
+	result := `{"hits":{"hits":[
+		{"_source":{"address":"0x0000000000000000000000000000000000000002","blockNumber":5,"index":2}},
+		{"_source":{"address":"0x0000000000000000000000000000000000000001","blockNumber":7,"index":0}}
+	]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(ex)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+
+	events, err := db.GetEventsInOrder(contracts, &types.Cursor{BlockNumber: 5, Index: 1}, 20, limit)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Event{
+		{Address: contracts[1], BlockNumber: 5, Index: 2},
+		{Address: contracts[0], BlockNumber: 7, Index: 0},
+	}, events)
+}
+
+func TestElasticsearchDB_GetEventsByTopicsTotal_AllContracts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	topic0 := types.NewHash("0x01")
+	query := &types.EventTopicQuery{Topics: []*types.Hash{&topic0}}
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	addresses := []types.Address{types.NewAddress("1"), types.NewAddress("2")}
+	ex := esapi.CountRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(QueryEventsByTopicsTemplate(addresses, query.Topics, options)),
+	}
+	contracts := []interface{}{
+		map[string]interface{}{"_source": map[string]interface{}{"address": "0x0000000000000000000000000000000000000001"}},
+		map[string]interface{}{"_source": map[string]interface{}{"address": "0x0000000000000000000000000000000000000002"}},
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().ScrollAllResults(ContractIndex, QueryAllAddressesTemplate).Return(contracts, nil)
+	mockedClient.EXPECT().DoRequest(NewCountRequestMatcher(ex)).Return([]byte(`{"count": 7}`), nil)
+
+	db, _ := New(mockedClient)
+
+	total, err := db.GetEventsByTopicsTotal(query, options)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7), total)
+}
+
+func TestElasticsearchDB_GetEventsByTopics_NoContracts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	topic0 := types.NewHash("0x01")
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().ScrollAllResults(ContractIndex, QueryAllAddressesTemplate).Return([]interface{}{}, nil)
+
+	db, _ := New(mockedClient)
+
+	events, err := db.GetEventsByTopics(&types.EventTopicQuery{Topics: []*types.Hash{&topic0}}, options)
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+}
+
+func TestElasticsearchDB_GetEventsByTopics_PaginationLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+
+	db, _ := New(mockedClient)
+
+	topic0 := types.NewHash("0x01")
+	options := &types.QueryOptions{PageSize: 100, PageNumber: 10}
+	_, err := db.GetEventsByTopics(&types.EventTopicQuery{Topics: []*types.Hash{&topic0}}, options)
+	assert.Equal(t, ErrPaginationLimitExceeded, err)
+}
@@ -0,0 +1,98 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// exportPageSize is how many documents each page of an export scroll has
+	exportPageSize = 1000
+	// exportScrollKeepAlive is how long a scroll is kept open between pages,
+	// which is how long a client can take to read a page of an export
+	exportScrollKeepAlive = 5 * time.Minute
+)
+
+// blockOrder sorts the documents of transactions and events oldest first
+var blockOrder = []string{"blockNumber:asc", "index:asc"}
+
+func (es *ElasticsearchDB) ExportTransactionsToAddress(address types.Address, options *types.QueryOptions, fn func(*types.Transaction) error) error {
+	query := fmt.Sprintf(QueryByToAddressWithOptionsTemplate(options), address.String())
+	return es.scroll(TransactionIndex, query, blockOrder, func(source json.RawMessage) error {
+		var tx types.Transaction
+		if err := json.Unmarshal(source, &tx); err != nil {
+			return err
+		}
+		return fn(&tx)
+	})
+}
+
+func (es *ElasticsearchDB) ExportEventsFromAddress(address types.Address, options *types.QueryOptions, fn func(*types.Event) error) error {
+	query := fmt.Sprintf(QueryByAddressWithOptionsTemplate(options), address.String())
+	return es.scroll(EventIndex, query, blockOrder, func(source json.RawMessage) error {
+		var event types.Event
+		if err := json.Unmarshal(source, &event); err != nil {
+			return err
+		}
+		return fn(&event)
+	})
+}
+
+// scroll passes every document matching the query to fn, in the sort order, a
+// page at a time. The scroll reads the index as it was when it started, so
+// documents indexed during the export don't shift the pages.
+func (es *ElasticsearchDB) scroll(index string, query string, sort []string, fn func(json.RawMessage) error) error {
+	return es.scrollWithIDs(index, query, sort, func(id string, source json.RawMessage) error {
+		return fn(source)
+	})
+}
+
+// scrollWithIDs is scroll, also passing the ID of each document
+func (es *ElasticsearchDB) scrollWithIDs(index string, query string, sort []string, fn func(string, json.RawMessage) error) error {
+	size := exportPageSize
+	req := esapi.SearchRequest{
+		Index:  []string{index},
+		Body:   strings.NewReader(query),
+		Size:   &size,
+		Sort:   sort,
+		Scroll: exportScrollKeepAlive,
+	}
+	body, err := es.apiClient.DoRequest(req)
+	for {
+		if err != nil {
+			return err
+		}
+		var page ScrollQueryResult
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		if len(page.Hits.Hits) == 0 {
+			es.clearScroll(page.ScrollID)
+			return nil
+		}
+		for _, hit := range page.Hits.Hits {
+			if err := fn(hit.ID, hit.Source); err != nil {
+				es.clearScroll(page.ScrollID)
+				return err
+			}
+		}
+		body, err = es.apiClient.DoRequest(esapi.ScrollRequest{ScrollID: page.ScrollID, Scroll: exportScrollKeepAlive})
+	}
+}
+
+// clearScroll frees the scroll straight away, rather than when it expires
+func (es *ElasticsearchDB) clearScroll(scrollID string) {
+	if scrollID == "" {
+		return
+	}
+	if _, err := es.apiClient.DoRequest(esapi.ClearScrollRequest{ScrollID: []string{scrollID}}); err != nil {
+		log.Debug("Unable to clear scroll", "err", err)
+	}
+}
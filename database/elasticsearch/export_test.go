@@ -0,0 +1,96 @@
+package elasticsearch
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestElasticsearchDB_ExportEventsFromAddress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	firstPage := `{"_scroll_id": "scroll1", "hits": {"hits": [
+		{"_source": {"address": "0x0000000000000000000000000000000000000001", "blockNumber": 1, "index": 0}},
+		{"_source": {"address": "0x0000000000000000000000000000000000000001", "blockNumber": 2, "index": 3}}
+	]}}`
+	secondPage := `{"_scroll_id": "scroll2", "hits": {"hits": [
+		{"_source": {"address": "0x0000000000000000000000000000000000000001", "blockNumber": 5, "index": 1}}
+	]}}`
+	lastPage := `{"_scroll_id": "scroll2", "hits": {"hits": []}}`
+
+	var search esapi.SearchRequest
+	var scrolls []string
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).
+			Do(func(req esapi.SearchRequest) { search = req }).
+			Return([]byte(firstPage), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.ScrollRequest{})).
+			Do(func(req esapi.ScrollRequest) { scrolls = append(scrolls, req.ScrollID) }).
+			Return([]byte(secondPage), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.ScrollRequest{})).
+			Do(func(req esapi.ScrollRequest) { scrolls = append(scrolls, req.ScrollID) }).
+			Return([]byte(lastPage), nil),
+		mockedClient.EXPECT().DoRequest(esapi.ClearScrollRequest{ScrollID: []string{"scroll2"}}),
+	)
+
+	db, _ := New(mockedClient)
+
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	var blocks []uint64
+	err := db.ExportEventsFromAddress(types.NewAddress("1"), options, func(event *types.Event) error {
+		blocks = append(blocks, event.BlockNumber)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2, 5}, blocks)
+	assert.Equal(t, []string{"scroll1", "scroll2"}, scrolls)
+
+	assert.Equal(t, []string{EventIndex}, search.Index)
+	assert.Equal(t, []string{"blockNumber:asc", "index:asc"}, search.Sort)
+	assert.Equal(t, exportScrollKeepAlive, search.Scroll)
+	body, _ := ioutil.ReadAll(search.Body)
+	assert.Contains(t, string(body), "0x0000000000000000000000000000000000000001")
+}
+
+func TestElasticsearchDB_ExportTransactionsToAddress_Stopped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	page := `{"_scroll_id": "scroll1", "hits": {"hits": [
+		{"_source": {"hash": "0x01", "blockNumber": 1}},
+		{"_source": {"hash": "0x02", "blockNumber": 2}}
+	]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return([]byte(page), nil),
+		// the scroll is freed when the export stops early
+		mockedClient.EXPECT().DoRequest(esapi.ClearScrollRequest{ScrollID: []string{"scroll1"}}),
+	)
+
+	db, _ := New(mockedClient)
+
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	var count int
+	err := db.ExportTransactionsToAddress(types.NewAddress("1"), options, func(tx *types.Transaction) error {
+		count++
+		return errors.New("client went away")
+	})
+	assert.EqualError(t, err, "client went away")
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,138 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// transactionMappings maps the contract and function selector of transactions
+// as keywords, so gas used can be grouped by them
+const transactionMappings = `{"properties": {"internalCalls": {"type": "nested" }, "contract": {"type": "keyword"}, "selector": {"type": "keyword"}}}`
+
+// transactionContractScript fills in the contract and function selector of
+// transactions indexed before they were stored
+const transactionContractScript = `
+def tx = ctx._source;
+boolean created = tx.createdContract != null && tx.createdContract != '0x' && tx.createdContract != '0x0000000000000000000000000000000000000000';
+if (created) {
+	tx.contract = tx.createdContract;
+} else if (tx.to != null && tx.to != '0x' && tx.to != '0x0000000000000000000000000000000000000000') {
+	tx.contract = tx.to;
+}
+def data = tx.privateData;
+if (data == null || data.length() <= 2) {
+	data = tx.data;
+}
+if (!created && data != null && data.length() >= 10) {
+	tx.selector = data.substring(0, 10);
+}
+`
+
+// secondsPerDay is the interval transactions are grouped into by day, from
+// the start of the first UTC day
+const secondsPerDay = 86400
+
+// GasUsageAggregateResult is the gas used by each group of transactions
+type GasUsageAggregateResult struct {
+	Aggregations struct {
+		Results struct {
+			Buckets []struct {
+				// a string for contracts and selectors, and a number for days
+				Key          interface{} `json:"key"`
+				DocCount     uint64      `json:"doc_count"`
+				TotalGasUsed struct {
+					Value float64 `json:"value"`
+				} `json:"totalGasUsed"`
+			} `json:"buckets"`
+		} `json:"result_buckets"`
+	} `json:"aggregations"`
+}
+
+func (es *ElasticsearchDB) GetGasUsage(query *types.GasUsageQuery) ([]*types.GasUsage, error) {
+	if query.Contract == nil && query.Contracts != nil && len(query.Contracts) == 0 {
+		return []*types.GasUsage{}, nil
+	}
+	searchReq := esapi.SearchRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(QueryGasUsageTemplate(query)),
+	}
+	body, err := es.apiClient.DoRequest(searchReq)
+	if err != nil {
+		return nil, err
+	}
+	var result GasUsageAggregateResult
+	if err = json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	usage := make([]*types.GasUsage, 0, len(result.Aggregations.Results.Buckets))
+	for _, bucket := range result.Aggregations.Results.Buckets {
+		u := &types.GasUsage{Transactions: bucket.DocCount, TotalGasUsed: uint64(bucket.TotalGasUsed.Value)}
+		switch key := bucket.Key.(type) {
+		case float64:
+			u.Key = types.GasUsageDay(uint64(key))
+		case string:
+			u.Key = key
+		default:
+			return nil, fmt.Errorf("unexpected gas usage group %v", bucket.Key)
+		}
+		usage = append(usage, u)
+	}
+	return types.SortGasUsage(usage, query.GroupBy, query.Limit), nil
+}
+
+// QueryGasUsageTemplate totals the gas used by the transactions of the query,
+// in its groups. Contracts and selectors are limited to the most expensive;
+// days all need returning to keep the latest.
+func QueryGasUsageTemplate(query *types.GasUsageQuery) string {
+	var clauses []string
+	if query.Contract != nil {
+		clauses = append(clauses, fmt.Sprintf(`{ "term": { "contract": "%s" } }`, query.Contract.String()))
+	} else if query.Contracts != nil {
+		quoted := make([]string, len(query.Contracts))
+		for i := range query.Contracts {
+			quoted[i] = `"` + query.Contracts[i].String() + `"`
+		}
+		clauses = append(clauses, fmt.Sprintf(`{ "terms": { "contract": [%s] } }`, strings.Join(quoted, ",")))
+	}
+	if query.EndBlock == 0 {
+		clauses = append(clauses, fmt.Sprintf(`{ "range": { "blockNumber": { "gte": %d } } }`, query.StartBlock))
+	} else {
+		clauses = append(clauses, fmt.Sprintf(`{ "range": { "blockNumber": { "gte": %d, "lte": %d } } }`, query.StartBlock, query.EndBlock))
+	}
+
+	var grouping string
+	switch query.GroupBy {
+	case types.GasUsageByDay:
+		grouping = fmt.Sprintf(`"histogram": { "field": "timestamp", "interval": %d, "min_doc_count": 1 }`, secondsPerDay)
+	case types.GasUsageByFunction:
+		grouping = fmt.Sprintf(`"terms": { "field": "selector", "size": %d, "order": { "totalGasUsed": "desc" } }`, query.Limit)
+	default:
+		grouping = fmt.Sprintf(`"terms": { "field": "contract", "size": %d, "order": { "totalGasUsed": "desc" } }`, query.Limit)
+	}
+	return `
+{
+	"query": {
+		"bool": {
+			"must": [
+				` + strings.Join(clauses, ",\n\t\t\t\t") + `
+			]
+		}
+	},
+	"size": 0,
+	"aggs": {
+		"result_buckets": {
+			` + grouping + `,
+			"aggs": {
+				"totalGasUsed": { "sum": { "field": "gasUsed" } }
+			}
+		}
+	}
+}
+`
+}
@@ -3,6 +3,7 @@ package elasticsearch
 import (
 	"errors"
 	"fmt"
+	"math/big"
 	"strings"
 	"testing"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	"quorumengineering/quorum-report/database"
 	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
 	"quorumengineering/quorum-report/types"
 )
@@ -276,6 +278,52 @@ func TestElasticsearchDB_GetAllTransactionsToAddress_MultipleResults(t *testing.
 	assert.Nil(t, err, "unexpected error")
 }
 
+func TestElasticsearchDB_GetAllTransactionsToAddress_Cursor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	addr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+
+	result := `{"hits": {"hits": [{"_source": {"hash": "0xd838a0eaccb60b0f0c65e55dd8cc36aea9576b8cdf0c947b0a974814d536e891"}}]}}`
+
+	// a cursor reaches past the first 1000 results, starting after its position
+	from := 0
+	size := 1000
+	options := &types.QueryOptions{PageSize: 1000, Cursor: types.NewCursor(2500, 3)}
+	options.SetDefaults()
+
+	query := strings.Replace(fmt.Sprintf(QueryByToAddressWithOptionsTemplate(options), addr.String()), "{", "{\n\t\"search_after\": [2500, 3],", 1)
+	expectedRequest := esapi.SearchRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(query),
+		From:  &from,
+		Size:  &size,
+		Sort:  []string{"blockNumber:desc", "index:asc"},
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(expectedRequest)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+	txns, err := db.GetAllTransactionsToAddress(addr, options)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Hash{types.NewHash("0xd838a0eaccb60b0f0c65e55dd8cc36aea9576b8cdf0c947b0a974814d536e891")}, txns)
+
+	// pages are still at most 1000 results, and a cursor replaces the page number
+	options.PageSize = 1001
+	_, err = db.GetAllTransactionsToAddress(addr, options)
+	assert.Equal(t, ErrPaginationLimitExceeded, err)
+	options.PageSize, options.PageNumber = 10, 1
+	_, err = db.GetAllTransactionsInternalToAddress(addr, options)
+	assert.EqualError(t, err, "give either a cursor or a page number, not both")
+	options.PageNumber, options.Cursor = 0, "invalid"
+	_, err = db.GetAllEventsFromAddress(addr, options)
+	assert.EqualError(t, err, "invalid cursor")
+}
+
 func TestElasticsearchDB_GetAllEventsByAddress_WithError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -505,3 +553,208 @@ func TestElasticsearchDB_GetLastFiltered_ContractDoesntExist(t *testing.T) {
 	assert.Equal(t, uint64(0), num, "unexpected error")
 	assert.EqualError(t, err, "not found", "unexpected error message")
 }
+
+func TestElasticsearchDB_ResetLastFiltered(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	addr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+
+	searchRequest := esapi.GetRequest{
+		Index:      ContractIndex,
+		DocumentID: addr.String(),
+	}
+	contractSearchReturnValue := `{
+        "_source": {
+          "address" : "0x1932c48b2bf8102ba33b4a6b545c32236e342f34",
+          "lastFiltered" : 20
+        }
+}`
+	updateRequest := esapi.UpdateRequest{
+		Index:      ContractIndex,
+		DocumentID: addr.String(),
+		Body:       strings.NewReader(fmt.Sprintf(LowerLastFilteredTemplate, 9)),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(searchRequest)).Return([]byte(contractSearchReturnValue), nil)
+	mockedClient.EXPECT().DoRequest(NewUpdateRequestMatcher(updateRequest))
+
+	db, _ := New(mockedClient)
+
+	assert.Nil(t, db.ResetLastFiltered(addr, 9))
+}
+
+func TestElasticsearchDB_ResetLastFiltered_ContractDoesntExist(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	addr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+
+	searchRequest := esapi.GetRequest{
+		Index:      ContractIndex,
+		DocumentID: addr.String(),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(searchRequest)).Return(nil, database.ErrNotFound)
+
+	db, _ := New(mockedClient)
+
+	assert.Equal(t, database.ErrNotFound, db.ResetLastFiltered(addr, 9))
+}
+
+func TestElasticsearchDB_HasActivity(t *testing.T) {
+	addr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	options := &types.QueryOptions{BeginBlockNumber: big.NewInt(10), EndBlockNumber: big.NewInt(20)}
+	options.SetDefaults()
+	terminateAfter := 1
+	countRequest := func(index string, template string) *CountRequestMatcher {
+		return NewCountRequestMatcher(esapi.CountRequest{
+			Index:          []string{index},
+			Body:           strings.NewReader(fmt.Sprintf(template, addr.String())),
+			TerminateAfter: &terminateAfter,
+		})
+	}
+	eventsRequest := func() *CountRequestMatcher {
+		return countRequest(EventIndex, QueryByAddressWithOptionsTemplate(options))
+	}
+
+	t.Run("event found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+		mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+		// no further counts once one is found
+		mockedClient.EXPECT().DoRequest(eventsRequest()).Return([]byte(`{"count": 1}`), nil)
+
+		db, _ := New(mockedClient)
+		active, err := db.HasActivity(addr, 10, 20)
+		assert.Nil(t, err)
+		assert.True(t, active)
+	})
+
+	t.Run("no activity", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+		mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+		gomock.InOrder(
+			mockedClient.EXPECT().DoRequest(eventsRequest()).Return([]byte(`{"count": 0}`), nil),
+			mockedClient.EXPECT().DoRequest(countRequest(TransactionIndex, QueryByToAddressWithOptionsTemplate(options))).Return([]byte(`{"count": 0}`), nil),
+			mockedClient.EXPECT().DoRequest(countRequest(TransactionIndex, QueryInternalTransactionsWithOptionsTemplate(options))).Return([]byte(`{"count": 0}`), nil),
+		)
+
+		db, _ := New(mockedClient)
+		active, err := db.HasActivity(addr, 10, 20)
+		assert.Nil(t, err)
+		assert.False(t, active)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+		mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+		mockedClient.EXPECT().DoRequest(eventsRequest()).Return(nil, errors.New("test error"))
+
+		db, _ := New(mockedClient)
+		_, err := db.HasActivity(addr, 10, 20)
+		assert.EqualError(t, err, "test error")
+	})
+}
+
+func TestElasticsearchDB_GetEventsForTransactions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	tx1 := types.NewHash("0x223df44de450551b9281d8091913ba7f5aa4ce655f478355be0fc84f39920bc0")
+	tx2 := types.NewHash("0x1a6f4292bac138df9a7854a07c93fd14ca7de53265e8fe01b6c986f97d6c1ee7")
+	response := `{"hits": {"hits": []}, "aggregations": {"result_buckets": {"buckets": [
+  {
+    "key": "0x223df44de450551b9281d8091913ba7f5aa4ce655f478355be0fc84f39920bc0",
+    "doc_count": 3,
+    "events": {"hits": {"hits": [
+      {"_source": {"address": "0x1932c48b2bf8102ba33b4a6b545c32236e342f34", "blockNumber": 9, "index": 0, "transactionHash": "0x223df44de450551b9281d8091913ba7f5aa4ce655f478355be0fc84f39920bc0"}},
+      {"_source": {"address": "0x1932c48b2bf8102ba33b4a6b545c32236e342f34", "blockNumber": 9, "index": 1, "transactionHash": "0x223df44de450551b9281d8091913ba7f5aa4ce655f478355be0fc84f39920bc0"}}
+    ]}}
+  }
+]}}}`
+
+	queryString := fmt.Sprintf(QueryEventsForTransactionsTemplate, `["`+tx1.Hex()+`","`+tx2.Hex()+`"]`, 2, 2)
+	req := esapi.SearchRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(queryString),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(req)).Return([]byte(response), nil)
+
+	db, _ := New(mockedClient)
+	events, err := db.GetEventsForTransactions([]types.Hash{tx1, tx2}, nil, 2)
+
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+	assert.Len(t, events[tx1], 2)
+	assert.EqualValues(t, 1, events[tx1][1].Index)
+	assert.Equal(t, tx1, events[tx1][1].TransactionHash)
+
+	// only the events of the given contracts, and none without any
+	contract := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	req.Body = strings.NewReader(fmt.Sprintf(QueryContractEventsForTransactionsTemplate, `["`+tx1.Hex()+`"]`, `["`+contract.String()+`"]`, 1, 2))
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(req)).Return([]byte(response), nil)
+	events, err = db.GetEventsForTransactions([]types.Hash{tx1}, []types.Address{contract}, 2)
+	assert.Nil(t, err)
+	assert.Len(t, events[tx1], 2)
+
+	events, err = db.GetEventsForTransactions([]types.Hash{tx1}, []types.Address{}, 2)
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+}
+
+func TestElasticsearchDB_GetStorageValues(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	addr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	options := &types.PageOptions{BeginBlockNumber: big.NewInt(10), EndBlockNumber: big.NewInt(20)}
+
+	one := 1
+	pageSize := storageValuesPageSize
+	beforeRequest := esapi.SearchRequest{
+		Index: []string{StorageIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryMatchContract, addr.String(), 9)),
+		Size:  &one,
+	}
+	rangeRequest := esapi.SearchRequest{
+		Index: []string{StorageIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryByAddressWithBlockRangeOptionsTemplate(options), addr.String())),
+		Size:  &pageSize,
+	}
+	before := `{"hits": {"hits": [{"_source": {"blockNumber": 5, "decodedStorage": [{"variable": "paused", "value": "true"}]}}]}}`
+	// indexed before storage was decoded
+	inRange := `{"hits": {"hits": [{"_source": {"blockNumber": 12, "storageMap": [{"Key": "0x0000000000000000000000000000000000000000000000000000000000000000", "Value": "01"}]}}]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(beforeRequest)).Return([]byte(before), nil),
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(rangeRequest)).Return([]byte(inRange), nil),
+	)
+
+	db, _ := New(mockedClient)
+	values, err := db.GetStorageValues(addr, options)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.StorageValues{
+		{BlockNumber: 5, Values: []*types.StorageValue{{Variable: "paused", Value: "true"}}},
+		{BlockNumber: 12, Storage: map[types.Hash]string{types.NewHash("0x00"): "01"}},
+	}, values)
+}
@@ -0,0 +1,102 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// Block is the document of a block, with the checksum of the block
+type Block struct {
+	*types.Block
+	Checksum string `json:"checksum,omitempty"`
+}
+
+func newBlockDocument(block *types.Block) (*Block, error) {
+	checksum, err := types.Checksum(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Block{Block: block, Checksum: checksum}, nil
+}
+
+// Transaction is the document of a transaction, with the checksum of the
+// transaction as it was written, before any enrichment fields were added
+type Transaction struct {
+	*types.Transaction
+	// the contract the transaction was sent to or created, and the function
+	// it called, to group gas used by
+	Contract types.Address `json:"contract,omitempty"`
+	Selector string        `json:"selector,omitempty"`
+	Checksum string        `json:"checksum,omitempty"`
+}
+
+func newTransactionDocument(transaction *types.Transaction) (*Transaction, error) {
+	checksum, err := types.Checksum(transaction)
+	if err != nil {
+		return nil, err
+	}
+	document := &Transaction{Transaction: transaction, Contract: transaction.Contract(), Checksum: checksum}
+	if selector := transaction.Selector(); selector != "" {
+		document.Selector = selector.String()
+	}
+	return document, nil
+}
+
+// ExportStoredDocuments scrolls through the blocks, then the transactions, then
+// the events in the range. Fields the documents hold besides the data they were
+// written with, such as the topics of events by position and enrichment
+// fields, are not part of the checksummed content.
+func (es *ElasticsearchDB) ExportStoredDocuments(start uint64, end uint64, fn func(*types.StoredDocument) error) error {
+	blocks := fmt.Sprintf(QueryBlockRangeTemplate, "number", start, end)
+	err := es.scroll(BlockIndex, blocks, []string{"number:asc"}, func(source json.RawMessage) error {
+		document := Block{Block: &types.Block{}}
+		if err := json.Unmarshal(source, &document); err != nil {
+			return err
+		}
+		return fn(&types.StoredDocument{
+			Kind:        types.BlockDocument,
+			ID:          strconv.FormatUint(document.Number, 10),
+			BlockNumber: document.Number,
+			Content:     document.Block,
+			Checksum:    document.Checksum,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	inRange := fmt.Sprintf(QueryBlockRangeTemplate, "blockNumber", start, end)
+	err = es.scroll(TransactionIndex, inRange, blockOrder, func(source json.RawMessage) error {
+		document := Transaction{Transaction: &types.Transaction{}}
+		if err := json.Unmarshal(source, &document); err != nil {
+			return err
+		}
+		return fn(&types.StoredDocument{
+			Kind:        types.TransactionDocument,
+			ID:          document.Hash.String(),
+			BlockNumber: document.BlockNumber,
+			Content:     document.Transaction,
+			Checksum:    document.Checksum,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return es.scroll(EventIndex, inRange, blockOrder, func(source json.RawMessage) error {
+		document := Event{Event: &types.Event{}}
+		if err := json.Unmarshal(source, &document); err != nil {
+			return err
+		}
+		return fn(&types.StoredDocument{
+			Kind:        types.EventDocument,
+			ID:          eventDocumentID(document.Event),
+			BlockNumber: document.BlockNumber,
+			Content:     document.Event,
+			Checksum:    document.Checksum,
+		})
+	})
+}
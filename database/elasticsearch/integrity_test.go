@@ -0,0 +1,103 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestElasticsearchDB_ExportStoredDocuments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	event := &types.Event{
+		Address:         types.NewAddress("1"),
+		Topics:          []types.Hash{types.NewHash("0x01")},
+		Data:            types.NewHexData("0x02"),
+		BlockNumber:     10,
+		TransactionHash: testTransaction.Hash,
+		Index:           3,
+	}
+	eventDocument, _ := newEventDocument(event)
+	page := func(documents ...interface{}) []byte {
+		hits := make([]map[string]interface{}, len(documents))
+		for i, document := range documents {
+			hits[i] = map[string]interface{}{"_source": document}
+		}
+		body, _ := json.Marshal(map[string]interface{}{"_scroll_id": "scroll", "hits": map[string]interface{}{"hits": hits}})
+		return body
+	}
+	// a transaction written by an older version, without a checksum, and
+	// enrichment fields added to the event after it was written
+	enrichedEvent, _ := json.Marshal(eventDocument)
+	enrichedEvent = append(enrichedEvent[:len(enrichedEvent)-1], []byte(`,"enriched_amount":5}`)...)
+
+	var searches []esapi.SearchRequest
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).
+			Do(func(req esapi.SearchRequest) { searches = append(searches, req) }).
+			Return(page(blockDocument(&testBlock)), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.ScrollRequest{})).Return(page(), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.ClearScrollRequest{})),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).
+			Do(func(req esapi.SearchRequest) { searches = append(searches, req) }).
+			Return(page(&testTransaction), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.ScrollRequest{})).Return(page(), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.ClearScrollRequest{})),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).
+			Do(func(req esapi.SearchRequest) { searches = append(searches, req) }).
+			Return(page(json.RawMessage(enrichedEvent)), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.ScrollRequest{})).Return(page(), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.ClearScrollRequest{})),
+	)
+
+	db, _ := New(mockedClient)
+
+	var documents []*types.StoredDocument
+	err := db.ExportStoredDocuments(10, 20, func(document *types.StoredDocument) error {
+		documents = append(documents, document)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Len(t, documents, 3)
+
+	// the content read back hashes to the checksum it was written with
+	assert.Equal(t, types.BlockDocument, documents[0].Kind)
+	assert.Equal(t, "10", documents[0].ID)
+	assert.Equal(t, &testBlock, documents[0].Content)
+	checksum, _ := types.Checksum(documents[0].Content)
+	assert.Equal(t, blockDocument(&testBlock).Checksum, checksum)
+	assert.Equal(t, checksum, documents[0].Checksum)
+
+	assert.Equal(t, types.TransactionDocument, documents[1].Kind)
+	assert.Equal(t, testTransaction.Hash.String(), documents[1].ID)
+	assert.EqualValues(t, 1, documents[1].BlockNumber)
+	assert.Empty(t, documents[1].Checksum)
+
+	assert.Equal(t, types.EventDocument, documents[2].Kind)
+	assert.Equal(t, "10-3", documents[2].ID)
+	checksum, _ = types.Checksum(documents[2].Content)
+	assert.Equal(t, eventDocument.Checksum, checksum)
+	assert.Equal(t, checksum, documents[2].Checksum)
+
+	assert.Equal(t, []string{BlockIndex}, searches[0].Index)
+	assert.Equal(t, []string{"number:asc"}, searches[0].Sort)
+	assert.Equal(t, []string{TransactionIndex}, searches[1].Index)
+	assert.Equal(t, []string{EventIndex}, searches[2].Index)
+	assert.Equal(t, blockOrder, searches[2].Sort)
+	for i, field := range []string{"number", "blockNumber", "blockNumber"} {
+		body := make([]byte, 256)
+		n, _ := searches[i].Body.Read(body)
+		assert.JSONEq(t, fmt.Sprintf(QueryBlockRangeTemplate, field, 10, 20), string(body[:n]))
+	}
+}
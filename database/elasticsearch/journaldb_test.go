@@ -0,0 +1,110 @@
+package elasticsearch
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestElasticsearchDB_WriteJournalEntries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedBulkIndexer := elasticsearchmocks.NewMockBulkIndexer(ctrl)
+
+	entry := &types.JournalEntry{BlockNumber: 10, Stage: types.IngestStage, Timestamp: 1600000000, Duration: 25, Transactions: 2, Events: 3}
+	req := esutil.BulkIndexerItem{
+		Action:     "create",
+		DocumentID: "ingest-10-1600000000",
+		Body:       esutil.NewJSONReader(entry),
+	}
+	reqMatcher := NewBulkIndexerItemMatcher(req)
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().GetBulkHandler(JournalIndex).Return(mockedBulkIndexer)
+	mockedBulkIndexer.EXPECT().
+		Add(gomock.Any(), reqMatcher).
+		Do(func(ctx context.Context, item esutil.BulkIndexerItem) {
+			item.OnSuccess(context.Background(), req, esutil.BulkIndexerResponseItem{})
+		})
+	// a retried write of an entry already stored is not an error
+	mockedBulkIndexer.EXPECT().
+		Add(gomock.Any(), reqMatcher).
+		Do(func(ctx context.Context, item esutil.BulkIndexerItem) {
+			item.OnFailure(context.Background(), req, esutil.BulkIndexerResponseItem{Status: 409}, nil)
+		})
+
+	db, _ := New(mockedClient)
+
+	err := db.WriteJournalEntries([]*types.JournalEntry{entry, entry})
+	assert.Nil(t, err)
+}
+
+func TestElasticsearchDB_GetJournalEntries(t *testing.T) {
+	query := &types.JournalQuery{Stage: types.FilterStage, ErrorsOnly: true, MinDuration: 100}
+	options := &types.PageOptions{BeginBlockNumber: big.NewInt(5), EndBlockNumber: big.NewInt(10), PageSize: 10, PageNumber: 1}
+	from := 10
+	ex := esapi.SearchRequest{
+		Index: []string{JournalIndex},
+		Body:  strings.NewReader(QueryJournalTemplate(query, options)),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"blockNumber:desc", "timestamp:desc"},
+	}
+
+	t.Run("entries found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+		result := `{"hits":{"hits":[{"_id":"filter-8-1600000000","_source":{"blockNumber":8,"stage":"filter","timestamp":1600000000,"duration":150,"tokenRecords":4,"errors":["node unavailable"]}}]}}`
+		mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(ex)).Return([]byte(result), nil)
+
+		db, _ := New(mockedClient)
+
+		entries, err := db.GetJournalEntries(query, options)
+		assert.Nil(t, err)
+		assert.Equal(t, []*types.JournalEntry{
+			{BlockNumber: 8, Stage: types.FilterStage, Timestamp: 1600000000, Duration: 150, TokenRecords: 4, Errors: []string{"node unavailable"}},
+		}, entries)
+	})
+
+	t.Run("no journal index", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+		mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+		mockedClient.EXPECT().DoRequest(gomock.Any()).Return(nil, ErrIndexNotFound)
+
+		db, _ := New(mockedClient)
+
+		entries, err := db.GetJournalEntries(query, options)
+		assert.Nil(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestQueryJournalTemplate(t *testing.T) {
+	options := &types.PageOptions{BeginBlockNumber: big.NewInt(0), EndBlockNumber: big.NewInt(-1)}
+
+	query := QueryJournalTemplate(&types.JournalQuery{}, options)
+	assert.Contains(t, query, `{ "range": { "blockNumber": { "gte": 0 } } }`)
+	assert.NotContains(t, query, "stage")
+
+	query = QueryJournalTemplate(&types.JournalQuery{Stage: types.IngestStage, ErrorsOnly: true, MinDuration: 100}, options)
+	assert.Contains(t, query, `{ "match": { "stage": "ingest" } }`)
+	assert.Contains(t, query, `{ "exists": { "field": "errors" } }`)
+	assert.Contains(t, query, `{ "range": { "duration": { "gte": 100 } } }`)
+}
@@ -0,0 +1,134 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/types"
+)
+
+// LeaseDB
+
+// AcquireLease writes the lease conditionally on the version read, so of the
+// instances trying to take it at the same time only one succeeds.
+func (es *ElasticsearchDB) AcquireLease(name string, holder string, duration time.Duration) (*types.Lease, error) {
+	current, err := es.getLease(name)
+	if err != nil && err != database.ErrNotFound {
+		return nil, err
+	}
+	now := time.Now()
+	if current != nil && current.Source.Holder != holder && !current.Source.Expired(now) {
+		return &current.Source, nil
+	}
+
+	lease := &types.Lease{Name: name, Holder: holder, AcquiredAt: types.UnixMillis(now), ExpiresAt: types.UnixMillis(now.Add(duration))}
+	req := esapi.IndexRequest{
+		Index:      LeaseIndex,
+		DocumentID: name,
+		Body:       esutil.NewJSONReader(lease),
+		Refresh:    "true",
+	}
+	if current == nil {
+		req.OpType = "create"
+	} else {
+		if current.Source.Holder == holder {
+			lease.AcquiredAt = current.Source.AcquiredAt
+			req.Body = esutil.NewJSONReader(lease)
+		}
+		req.IfSeqNo = &current.SeqNo
+		req.IfPrimaryTerm = &current.PrimaryTerm
+	}
+	if _, err := es.apiClient.DoRequest(req); err == ErrVersionConflict {
+		// another instance wrote the lease since it was read
+		return es.GetLease(name)
+	} else if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+func (es *ElasticsearchDB) GetLease(name string) (*types.Lease, error) {
+	current, err := es.getLease(name)
+	if err != nil {
+		return nil, err
+	}
+	return &current.Source, nil
+}
+
+func (es *ElasticsearchDB) GetLeases(prefix string) ([]*types.Lease, error) {
+	size := maxLeases
+	req := esapi.SearchRequest{
+		Index: []string{LeaseIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryLeasesTemplate, prefix)),
+		Size:  &size,
+	}
+	results, err := es.doSearchRequest(req)
+	if err == ErrIndexNotFound {
+		return []*types.Lease{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	leases := make([]*types.Lease, 0, len(results.Hits.Hits))
+	for _, result := range results.Hits.Hits {
+		marshalled, _ := json.Marshal(result.Source)
+		var lease types.Lease
+		if err := json.Unmarshal(marshalled, &lease); err != nil {
+			return nil, err
+		}
+		leases = append(leases, &lease)
+	}
+	return leases, nil
+}
+
+func (es *ElasticsearchDB) ReleaseLease(name string, holder string) error {
+	current, err := es.getLease(name)
+	if err == database.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current.Source.Holder != holder {
+		return nil
+	}
+	req := esapi.DeleteRequest{
+		Index:         LeaseIndex,
+		DocumentID:    name,
+		IfSeqNo:       &current.SeqNo,
+		IfPrimaryTerm: &current.PrimaryTerm,
+		Refresh:       "true",
+	}
+	if _, err := es.apiClient.DoRequest(req); err != nil && err != ErrVersionConflict && err != database.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// getLease reads the lease with the version it was last written at
+func (es *ElasticsearchDB) getLease(name string) (*LeaseResult, error) {
+	req := esapi.GetRequest{
+		Index:      LeaseIndex,
+		DocumentID: name,
+	}
+	body, err := es.apiClient.DoRequest(req)
+	if err == ErrIndexNotFound {
+		// databases created before leases were added have no index until one
+		// is first acquired
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result LeaseResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,135 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database"
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func leaseBody(lease types.Lease) []byte {
+	source, _ := json.Marshal(lease)
+	return []byte(fmt.Sprintf(`{"_seq_no": 7, "_primary_term": 2, "_source": %s}`, source))
+}
+
+func TestElasticsearchDB_AcquireLease_Free(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(esapi.GetRequest{Index: LeaseIndex, DocumentID: types.LeaderLease})).Return(nil, ErrIndexNotFound)
+	mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.IndexRequest{})).DoAndReturn(func(req esapi.Request) ([]byte, error) {
+		indexReq := req.(esapi.IndexRequest)
+		assert.Equal(t, LeaseIndex, indexReq.Index)
+		assert.Equal(t, "create", indexReq.OpType)
+		assert.Nil(t, indexReq.IfSeqNo)
+		return nil, nil
+	})
+
+	db, _ := New(mockedClient)
+
+	lease, err := db.AcquireLease(types.LeaderLease, "reporting-1", 15*time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, "reporting-1", lease.Holder)
+	assert.InDelta(t, 15000, lease.ExpiresAt-lease.AcquiredAt, 1)
+}
+
+func TestElasticsearchDB_AcquireLease_HeldByAnother(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	held := types.Lease{Name: types.LeaderLease, Holder: "reporting-2", ExpiresAt: types.UnixMillis(time.Now().Add(time.Minute))}
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(esapi.GetRequest{Index: LeaseIndex, DocumentID: types.LeaderLease})).Return(leaseBody(held), nil)
+
+	db, _ := New(mockedClient)
+
+	lease, err := db.AcquireLease(types.LeaderLease, "reporting-1", 15*time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, &held, lease)
+}
+
+func TestElasticsearchDB_AcquireLease_Expired(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	expired := types.Lease{Name: types.LeaderLease, Holder: "reporting-2", ExpiresAt: types.UnixMillis(time.Now().Add(-time.Second))}
+	taken := types.Lease{Name: types.LeaderLease, Holder: "reporting-3", ExpiresAt: types.UnixMillis(time.Now().Add(time.Minute))}
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(esapi.GetRequest{Index: LeaseIndex, DocumentID: types.LeaderLease})).Return(leaseBody(expired), nil),
+		// another instance takes the expired lease first
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.IndexRequest{})).DoAndReturn(func(req esapi.Request) ([]byte, error) {
+			indexReq := req.(esapi.IndexRequest)
+			assert.Equal(t, 7, *indexReq.IfSeqNo)
+			assert.Equal(t, 2, *indexReq.IfPrimaryTerm)
+			return nil, ErrVersionConflict
+		}),
+		mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(esapi.GetRequest{Index: LeaseIndex, DocumentID: types.LeaderLease})).Return(leaseBody(taken), nil),
+	)
+
+	db, _ := New(mockedClient)
+
+	lease, err := db.AcquireLease(types.LeaderLease, "reporting-1", 15*time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, &taken, lease)
+}
+
+func TestElasticsearchDB_ReleaseLease(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	held := types.Lease{Name: types.LeaderLease, Holder: "reporting-1", ExpiresAt: types.UnixMillis(time.Now().Add(time.Minute))}
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(esapi.GetRequest{Index: LeaseIndex, DocumentID: types.LeaderLease})).Return(leaseBody(held), nil).Times(2)
+	mockedClient.EXPECT().DoRequest(NewDeleteRequestMatcher(esapi.DeleteRequest{Index: LeaseIndex, DocumentID: types.LeaderLease})).Return(nil, database.ErrNotFound)
+
+	db, _ := New(mockedClient)
+
+	// only the holder's release deletes the lease
+	assert.Nil(t, db.ReleaseLease(types.LeaderLease, "reporting-2"))
+	assert.Nil(t, db.ReleaseLease(types.LeaderLease, "reporting-1"))
+}
+
+func TestElasticsearchDB_GetLeases(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	size := maxLeases
+	ex := esapi.SearchRequest{
+		Index: []string{LeaseIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryLeasesTemplate, types.ShardLeasePrefix)),
+		Size:  &size,
+	}
+	result := `{"hits":{"hits":[{"_id":"shard-3","_source":{"name":"shard-3","holder":"reporting-1","acquiredAt":1000,"expiresAt":16000}}]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(ex)).Return([]byte(result), nil)
+	mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return(nil, ErrIndexNotFound)
+
+	db, _ := New(mockedClient)
+
+	leases, err := db.GetLeases(types.ShardLeasePrefix)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Lease{{Name: "shard-3", Holder: "reporting-1", AcquiredAt: 1000, ExpiresAt: 16000}}, leases)
+
+	// databases created before leases were added have none
+	leases, err = db.GetLeases(types.ShardLeasePrefix)
+	assert.Nil(t, err)
+	assert.Empty(t, leases)
+}
@@ -0,0 +1,112 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// LegalHoldDB
+
+func (es *ElasticsearchDB) AddLegalHold(hold *types.LegalHold) error {
+	req := esapi.IndexRequest{
+		Index:      LegalHoldIndex,
+		DocumentID: hold.ID,
+		Body:       esutil.NewJSONReader(hold),
+		Refresh:    "true",
+	}
+	_, err := es.apiClient.DoRequest(req)
+	return err
+}
+
+func (es *ElasticsearchDB) DeleteLegalHold(id string) error {
+	req := esapi.DeleteRequest{
+		Index:      LegalHoldIndex,
+		DocumentID: id,
+		Refresh:    "true",
+	}
+	_, err := es.apiClient.DoRequest(req)
+	return err
+}
+
+func (es *ElasticsearchDB) GetLegalHolds() ([]*types.LegalHold, error) {
+	return getLegalHolds(es.apiClient)
+}
+
+func getLegalHolds(apiClient APIClient) (types.LegalHolds, error) {
+	size := maxLegalHolds
+	req := esapi.SearchRequest{
+		Index: []string{LegalHoldIndex},
+		Body:  strings.NewReader(QueryAllLegalHoldsTemplate),
+		Size:  &size,
+		Sort:  []string{"createdAt:asc"},
+	}
+	body, err := apiClient.DoRequest(req)
+	if err == ErrIndexNotFound {
+		// databases created before legal holds were added have no index
+		// until the first hold is placed
+		return types.LegalHolds{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var results SearchQueryResult
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, err
+	}
+	holds := make(types.LegalHolds, 0, len(results.Hits.Hits))
+	for _, result := range results.Hits.Hits {
+		marshalled, _ := json.Marshal(result.Source)
+		var hold types.LegalHold
+		if err := json.Unmarshal(marshalled, &hold); err != nil {
+			return nil, err
+		}
+		holds = append(holds, &hold)
+	}
+	return holds, nil
+}
+
+// excludeLegalHolds narrows the delete query to leave out the documents
+// recorded in the blocks or by the transactions under legal hold
+func excludeLegalHolds(query string, holds types.LegalHolds) string {
+	return excludeLegalHoldsOn(query, holds, "blockNumber")
+}
+
+// excludeLegalHoldsOn is excludeLegalHolds for documents that record their
+// block in the given field
+func excludeLegalHoldsOn(query string, holds types.LegalHolds, blockField string) string {
+	var exclusions []map[string]interface{}
+	for _, hold := range holds {
+		if hold.TransactionHash != nil {
+			exclusions = append(exclusions, map[string]interface{}{
+				"match": map[string]interface{}{"transactionHash": hold.TransactionHash.String()},
+			})
+		}
+		if hold.FromBlock != nil {
+			exclusions = append(exclusions, map[string]interface{}{
+				"range": map[string]interface{}{blockField: map[string]interface{}{"gte": *hold.FromBlock, "lte": *hold.ToBlock}},
+			})
+		}
+	}
+	if len(exclusions) == 0 {
+		return query
+	}
+	var parsed struct {
+		Query json.RawMessage `json:"query"`
+	}
+	_ = json.Unmarshal([]byte(query), &parsed)
+	narrowed := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":     parsed.Query,
+				"must_not": exclusions,
+			},
+		},
+	}
+	marshalled, _ := json.Marshal(narrowed)
+	return string(marshalled)
+}
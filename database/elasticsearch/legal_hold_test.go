@@ -0,0 +1,145 @@
+package elasticsearch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database"
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestElasticsearchDB_AddLegalHold(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	address := types.NewAddress("1")
+	hold := &types.LegalHold{ID: "abc", Address: &address, Reason: "litigation", CreatedAt: 100}
+	ex := esapi.IndexRequest{
+		Index:      LegalHoldIndex,
+		DocumentID: "abc",
+		Body:       esutil.NewJSONReader(hold),
+		Refresh:    "true",
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewIndexRequestMatcher(ex))
+
+	db, _ := New(mockedClient)
+
+	err := db.AddLegalHold(hold)
+	assert.Nil(t, err)
+}
+
+func TestElasticsearchDB_DeleteLegalHold(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	ex := esapi.DeleteRequest{
+		Index:      LegalHoldIndex,
+		DocumentID: "abc",
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewDeleteRequestMatcher(ex)).Return(nil, database.ErrNotFound)
+
+	db, _ := New(mockedClient)
+
+	err := db.DeleteLegalHold("abc")
+	assert.Equal(t, database.ErrNotFound, err)
+}
+
+func TestElasticsearchDB_GetLegalHolds(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	size := maxLegalHolds
+	ex := esapi.SearchRequest{
+		Index: []string{LegalHoldIndex},
+		Body:  strings.NewReader(QueryAllLegalHoldsTemplate),
+		Size:  &size,
+	}
+	result := `{"hits":{"hits":[{"_id":"abc","_source":{"id":"abc","fromBlock":5,"toBlock":10,"reason":"audit","createdAt":100}}]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(ex)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+
+	holds, err := db.GetLegalHolds()
+	assert.Nil(t, err)
+	from, to := uint64(5), uint64(10)
+	assert.Equal(t, []*types.LegalHold{{ID: "abc", FromBlock: &from, ToBlock: &to, Reason: "audit", CreatedAt: 100}}, holds)
+}
+
+func TestElasticsearchDB_GetLegalHolds_NoIndex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return(nil, ErrIndexNotFound)
+
+	db, _ := New(mockedClient)
+
+	holds, err := db.GetLegalHolds()
+	assert.Nil(t, err)
+	assert.Empty(t, holds)
+}
+
+func TestExcludeLegalHolds(t *testing.T) {
+	query := `{ "query": { "match": { "contract": "0x0000000000000000000000000000000000000001" } } }`
+	address := types.NewAddress("2")
+	tx := types.NewHash("0x01")
+	from, to := uint64(5), uint64(10)
+
+	// holds of other contracts don't narrow the query
+	assert.Equal(t, query, excludeLegalHolds(query, types.LegalHolds{{Address: &address}}))
+
+	narrowed := excludeLegalHolds(query, types.LegalHolds{{TransactionHash: &tx}, {FromBlock: &from, ToBlock: &to}})
+	assert.JSONEq(t, `{"query":{"bool":{
+		"must":{"match":{"contract":"0x0000000000000000000000000000000000000001"}},
+		"must_not":[
+			{"match":{"transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000001"}},
+			{"range":{"blockNumber":{"gte":5,"lte":10}}}
+		]
+	}}}`, narrowed)
+}
+
+func TestDefaultDeletionCoordinator_Delete_ContractUnderLegalHold(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	deleter := NewDefaultDeletionCoordinator(mockedClient)
+	contract := types.NewAddress("1")
+	holds := `{"hits":{"hits":[{"_source":{"id":"abc","address":"0x0000000000000000000000000000000000000001","reason":"litigation"}}]}}`
+
+	// only the registration is deleted
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return([]byte(holds), nil),
+		mockedClient.EXPECT().DoRequest(NewDeleteRequestMatcher(esapi.DeleteRequest{Index: TemplateIndex, DocumentID: contract.String()})),
+		mockedClient.EXPECT().DoRequest(NewDeleteRequestMatcher(esapi.DeleteRequest{Index: ContractIndex, DocumentID: contract.String()})),
+	)
+
+	var reported []types.JobProgress
+	err := deleter.Delete(contract, func(progress types.JobProgress) {
+		reported = append(reported, progress)
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []types.JobProgress{{Step: "contract"}}, reported)
+}
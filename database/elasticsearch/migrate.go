@@ -0,0 +1,268 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+)
+
+// indexMapping is an index created when the database is initialized, with
+// the mappings it needs set up front, if any. Each version of an index is
+// stored in its own index, <index>_v<version>, behind an alias named after
+// it, so everything else reads and writes the alias. Bump the version when
+// the mappings change in a way existing documents don't fit, such as changing
+// the type of a field, and Migrate copies the documents into a new index with
+// the new mappings; mappings that are only added to can be changed in place.
+type indexMapping struct {
+	index    string
+	version  int
+	mappings string
+	// painless script run on each document copied from an older version,
+	// to fill in fields the new version adds
+	reindexScript string
+}
+
+// blockMappings map the block number and timestamp as numbers up front, so
+// blocks can be sorted by number and found by time range before dynamic
+// mapping has seen a block
+const blockMappings = `{"properties": {"number": {"type": "long"}, "timestamp": {"type": "long"}}}`
+
+var indexMappings = []indexMapping{
+	{index: BlockIndex, version: 1, mappings: blockMappings},
+	// version 2 stores the contract and function selector, to group gas used by
+	{index: TransactionIndex, version: 2, mappings: transactionMappings, reindexScript: transactionContractScript},
+	{index: ContractIndex, version: 1},
+	{index: TemplateIndex, version: 1},
+	{index: StorageIndex, version: 1},
+	// version 2 stores the topics by position, to be matched by position
+	{index: EventIndex, version: 2, mappings: eventMappings, reindexScript: eventTopicsScript},
+	{index: MetaIndex, version: 1},
+	{index: ERC20TokenIndex, version: 1},
+	{index: ERC721TokenIndex, version: 1},
+	{index: ERC1155TokenIndex, version: 1},
+	{index: ERC20AllowanceIndex, version: 1},
+	{index: WebhookIndex, version: 1},
+	{index: JournalIndex, version: 1},
+	{index: CounterpartyIndex, version: 1},
+	{index: LegalHoldIndex, version: 1},
+	{index: ArchiveIndex, version: 1, mappings: `{"properties": {"transactions": {"type": "keyword"}}}`},
+	// call trees are only fetched by transaction, and are nested too deeply
+	// to map each level
+	{index: CallTreeIndex, version: 1, mappings: `{"properties": {"calls": {"type": "object", "enabled": false}}}`},
+	{index: TokenRuleIndex, version: 1},
+	{index: LeaseIndex, version: 1},
+}
+
+// versionedName is the name of the index storing the given version
+func (m indexMapping) versionedName(version int) string {
+	return fmt.Sprintf("%s_v%d", m.index, version)
+}
+
+// createRequest creates the index for the current version, with the alias
+// pointing at it if withAlias is set
+func (m indexMapping) createRequest(withAlias bool) esapi.IndicesCreateRequest {
+	var settings []string
+	if withAlias {
+		settings = append(settings, fmt.Sprintf(`"aliases":{"%s":{}}`, m.index))
+	}
+	if m.mappings != "" {
+		settings = append(settings, `"mappings":`+m.mappings)
+	}
+	req := esapi.IndicesCreateRequest{Index: m.versionedName(m.version)}
+	if len(settings) > 0 {
+		req.Body = strings.NewReader("{" + strings.Join(settings, ",") + "}")
+	}
+	return req
+}
+
+// unversionedIndex returns the index an index name stores a version of, or
+// the name itself if it isn't versioned
+func unversionedIndex(name string) string {
+	i := strings.LastIndex(name, "_v")
+	if i == -1 {
+		return name
+	}
+	if _, err := strconv.Atoi(name[i+2:]); err != nil {
+		return name
+	}
+	return name[:i]
+}
+
+// Migrate brings the indices of a database created by an older version up to
+// date: missing indices are created, the mappings of existing ones are
+// updated, and indices at an older version are reindexed into a new index
+// that their alias is then moved to. The service must not be running while
+// indices are reindexed, or the documents it writes in the meantime are lost.
+// It returns a description of each change made.
+func (es *ElasticsearchDB) Migrate() ([]string, error) {
+	var changes []string
+	for _, m := range indexMappings {
+		current, version, err := es.indexVersion(m.index)
+		if err != nil {
+			return changes, err
+		}
+
+		switch {
+		case version == 0:
+			if _, err := es.apiClient.DoRequest(m.createRequest(true)); err != nil {
+				return changes, fmt.Errorf("creating index %s: %v", m.index, err)
+			}
+			log.Info("Created index", "index", m.index, "version", m.version)
+			changes = append(changes, "created index "+m.index)
+		case version < m.version:
+			if err := es.reindex(m, current); err != nil {
+				return changes, fmt.Errorf("reindexing index %s: %v", m.index, err)
+			}
+			changes = append(changes, fmt.Sprintf("reindexed index %s from version %d to %d", m.index, version, m.version))
+		case version > m.version:
+			return changes, fmt.Errorf("index %s is at version %d, but this version of the reporting tool only supports up to %d", m.index, version, m.version)
+		case m.mappings != "":
+			putReq := esapi.IndicesPutMappingRequest{
+				Index: []string{m.index},
+				Body:  strings.NewReader(m.mappings),
+			}
+			if _, err := es.apiClient.DoRequest(putReq); err != nil {
+				return changes, fmt.Errorf("updating mappings of index %s: %v", m.index, err)
+			}
+			log.Info("Updated index mappings", "index", m.index)
+			changes = append(changes, "updated mappings of index "+m.index)
+		}
+	}
+
+	if err := es.createLastPersisted(); err != nil && err != ErrVersionConflict {
+		return changes, err
+	}
+
+	version, err := es.GetSchemaVersion()
+	if err != nil {
+		return changes, err
+	}
+	if version != SchemaVersion {
+		if err := es.setSchemaVersion(); err != nil {
+			return changes, err
+		}
+		changes = append(changes, fmt.Sprintf("set schema version to %d", SchemaVersion))
+	}
+	return changes, nil
+}
+
+// indexVersion returns the index currently stored under an index's name, and
+// its version. An index created before indices were versioned isn't behind an
+// alias, and counts as version 1; version 0 means the index doesn't exist.
+func (es *ElasticsearchDB) indexVersion(index string) (string, int, error) {
+	body, err := es.apiClient.DoRequest(esapi.CatAliasesRequest{Name: []string{index}, Format: "json"})
+	if err != nil {
+		return "", 0, err
+	}
+	var aliases []CatAliasResult
+	if err := json.Unmarshal(body, &aliases); err != nil {
+		return "", 0, err
+	}
+	if len(aliases) > 0 {
+		current := aliases[0].Index
+		version, err := strconv.Atoi(strings.TrimPrefix(current, index+"_v"))
+		if err != nil {
+			return "", 0, fmt.Errorf("alias %s points at unversioned index %s", index, current)
+		}
+		return current, version, nil
+	}
+
+	_, err = es.apiClient.DoRequest(esapi.CatIndicesRequest{Index: []string{index}})
+	if err == ErrIndexNotFound {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return index, 1, nil
+}
+
+// reindex copies the documents of the current index into a new one for the
+// latest version, then atomically moves the alias to it and deletes the old
+// index. If copying fails, the alias is left on the old index.
+func (es *ElasticsearchDB) reindex(m indexMapping, current string) error {
+	target := m.versionedName(m.version)
+
+	// a failed migration may have left the target behind
+	_, err := es.apiClient.DoRequest(esapi.IndicesDeleteRequest{Index: []string{target}})
+	if err != nil && err != ErrIndexNotFound {
+		return err
+	}
+	if _, err := es.apiClient.DoRequest(m.createRequest(false)); err != nil {
+		return err
+	}
+
+	log.Info("Reindexing index", "index", m.index, "from", current, "to", target)
+	reindexBody := fmt.Sprintf(ReindexTemplate, current, target)
+	if m.reindexScript != "" {
+		script, _ := json.Marshal(m.reindexScript)
+		reindexBody = fmt.Sprintf(ReindexWithScriptTemplate, current, target, script)
+	}
+	waitForCompletion, refresh := true, true
+	reindexReq := esapi.ReindexRequest{
+		Body:              strings.NewReader(reindexBody),
+		WaitForCompletion: &waitForCompletion,
+		Refresh:           &refresh,
+	}
+	body, err := es.apiClient.DoRequest(reindexReq)
+	if err != nil {
+		return err
+	}
+	var result ReindexResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	if len(result.Failures) > 0 {
+		return fmt.Errorf("%d documents failed to copy, the first with %s", len(result.Failures), result.Failures[0])
+	}
+
+	// removing the old index removes its alias, and frees the name of an
+	// unversioned index for the alias
+	aliasesReq := esapi.IndicesUpdateAliasesRequest{
+		Body: strings.NewReader(fmt.Sprintf(UpdateAliasTemplate, target, m.index, current)),
+	}
+	if _, err := es.apiClient.DoRequest(aliasesReq); err != nil {
+		return err
+	}
+	log.Info("Reindexed index", "index", m.index, "documents", result.Total, "version", m.version)
+	return nil
+}
+
+// GetSchemaVersion returns the schema version of the database, which is 0 if
+// it was created before versions were recorded
+func (es *ElasticsearchDB) GetSchemaVersion() (int, error) {
+	fetchReq := esapi.GetRequest{
+		Index:      MetaIndex,
+		DocumentID: "schemaVersion",
+	}
+	body, err := es.apiClient.DoRequest(fetchReq)
+	if err == database.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var result SchemaVersionResult
+	if err = json.Unmarshal(body, &result); err != nil {
+		return 0, err
+	}
+	return result.Source.SchemaVersion, nil
+}
+
+func (es *ElasticsearchDB) setSchemaVersion() error {
+	req := esapi.IndexRequest{
+		Index:      MetaIndex,
+		DocumentID: "schemaVersion",
+		Body:       strings.NewReader(fmt.Sprintf(`{"schemaVersion": %d}`, SchemaVersion)),
+		Refresh:    "true",
+	}
+	_, err := es.apiClient.DoRequest(req)
+	return err
+}
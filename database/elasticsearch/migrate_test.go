@@ -0,0 +1,214 @@
+package elasticsearch
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database"
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+)
+
+func TestElasticsearchDB_Migrate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	db, _ := New(mockedClient)
+
+	// an older database without the webhook, journal, archive, call tree and
+	// token rule indices
+	var created []string
+	var putMappings []string
+	var reindexed []string
+	mockedClient.EXPECT().DoRequest(gomock.Any()).DoAndReturn(func(req esapi.Request) ([]byte, error) {
+		switch r := req.(type) {
+		case esapi.CatAliasesRequest:
+			// unversioned indices
+			return []byte(`[]`), nil
+		case esapi.CatIndicesRequest:
+			if r.Index[0] == WebhookIndex || r.Index[0] == JournalIndex || r.Index[0] == ArchiveIndex || r.Index[0] == CallTreeIndex || r.Index[0] == TokenRuleIndex {
+				return nil, ErrIndexNotFound
+			}
+		case esapi.IndicesCreateRequest:
+			created = append(created, r.Index)
+		case esapi.IndicesDeleteRequest:
+			return nil, ErrIndexNotFound
+		case esapi.ReindexRequest:
+			body, _ := ioutil.ReadAll(r.Body)
+			reindexed = append(reindexed, string(body))
+			return []byte(`{"total": 20, "failures": []}`), nil
+		case esapi.IndicesUpdateAliasesRequest:
+		case esapi.IndicesPutMappingRequest:
+			body, _ := ioutil.ReadAll(r.Body)
+			putMappings = append(putMappings, r.Index[0]+" "+string(body))
+		case esapi.GetRequest:
+			assert.Equal(t, "schemaVersion", r.DocumentID)
+			return nil, database.ErrNotFound
+		case esapi.IndexRequest:
+			if r.DocumentID == "lastPersisted" {
+				return nil, ErrVersionConflict
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Equal(t, `{"schemaVersion": 2}`, string(body))
+		default:
+			t.Fatalf("unexpected request %T", req)
+		}
+		return nil, nil
+	}).AnyTimes()
+
+	changes, err := db.Migrate()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"transaction_v2", "event_v2", "webhook_v1", "journal_v1", "archive_v1", "calltree_v1", "tokenrule_v1"}, created)
+	// the block number and timestamp are mapped in place
+	assert.Equal(t, []string{BlockIndex + " " + blockMappings}, putMappings)
+	// transactions indexed before their contract and selector were stored, and
+	// events indexed before topics were stored by position, get them filled in
+	assert.Len(t, reindexed, 2)
+	assert.Contains(t, reindexed[0], `"source":{"index":"transaction"},"dest":{"index":"transaction_v2"},"script":{"lang":"painless"`)
+	assert.Contains(t, reindexed[1], `"source":{"index":"event"},"dest":{"index":"event_v2"},"script":{"lang":"painless"`)
+	assert.Equal(t, []string{"updated mappings of index block", "reindexed index transaction from version 1 to 2", "reindexed index event from version 1 to 2", "created index webhook", "created index journal", "created index archive", "created index calltree", "created index tokenrule", "set schema version to 2"}, changes)
+}
+
+func TestElasticsearchDB_Migrate_Reindex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	db, _ := New(mockedClient)
+
+	defer func(mappings []indexMapping) { indexMappings = mappings }(indexMappings)
+	indexMappings = []indexMapping{
+		{index: TransactionIndex, version: 3, mappings: `{"properties": {"to": {"type": "keyword"}}}`},
+		{index: EventIndex, version: 2},
+		{index: MetaIndex, version: 1},
+	}
+
+	var requests []string
+	mockedClient.EXPECT().DoRequest(gomock.Any()).DoAndReturn(func(req esapi.Request) ([]byte, error) {
+		switch r := req.(type) {
+		case esapi.CatAliasesRequest:
+			switch r.Name[0] {
+			case TransactionIndex:
+				return []byte(`[{"alias":"transaction","index":"transaction_v2"}]`), nil
+			case MetaIndex:
+				return []byte(`[{"alias":"meta","index":"meta_v1"}]`), nil
+			}
+			return []byte(`[]`), nil
+		case esapi.CatIndicesRequest:
+			return []byte("green open event"), nil
+		case esapi.IndicesDeleteRequest:
+			requests = append(requests, "delete "+r.Index[0])
+			return nil, ErrIndexNotFound
+		case esapi.IndicesCreateRequest:
+			if r.Body == nil {
+				requests = append(requests, "create "+r.Index)
+				break
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, "create "+r.Index+" "+string(body))
+		case esapi.ReindexRequest:
+			assert.True(t, *r.WaitForCompletion)
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, "reindex "+string(body))
+			return []byte(`{"total": 20, "failures": []}`), nil
+		case esapi.IndicesUpdateAliasesRequest:
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, "aliases "+string(body))
+		case esapi.GetRequest:
+			return []byte(`{"_source": {"schemaVersion": 2}}`), nil
+		case esapi.IndexRequest:
+			return nil, ErrVersionConflict
+		default:
+			t.Fatalf("unexpected request %T", req)
+		}
+		return nil, nil
+	}).AnyTimes()
+
+	changes, err := db.Migrate()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"delete transaction_v3",
+		`create transaction_v3 {"mappings":{"properties": {"to": {"type": "keyword"}}}}`,
+		`reindex {"source":{"index":"transaction_v2"},"dest":{"index":"transaction_v3"}}`,
+		`aliases {"actions":[{"add":{"index":"transaction_v3","alias":"transaction"}},{"remove_index":{"index":"transaction_v2"}}]}`,
+		"delete event_v2",
+		"create event_v2",
+		`reindex {"source":{"index":"event"},"dest":{"index":"event_v2"}}`,
+		`aliases {"actions":[{"add":{"index":"event_v2","alias":"event"}},{"remove_index":{"index":"event"}}]}`,
+	}, requests)
+	assert.Equal(t, []string{"reindexed index transaction from version 2 to 3", "reindexed index event from version 1 to 2"}, changes)
+}
+
+func TestElasticsearchDB_Migrate_ReindexFailures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	db, _ := New(mockedClient)
+
+	defer func(mappings []indexMapping) { indexMappings = mappings }(indexMappings)
+	indexMappings = []indexMapping{{index: EventIndex, version: 2}}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()).DoAndReturn(func(req esapi.Request) ([]byte, error) {
+		switch req.(type) {
+		case esapi.CatAliasesRequest:
+			return []byte(`[{"alias":"event","index":"event_v1"}]`), nil
+		case esapi.ReindexRequest:
+			return []byte(`{"total": 20, "failures": [{"id": "1", "status": 400}]}`), nil
+		case esapi.IndicesUpdateAliasesRequest:
+			t.Fatal("alias moved after failed reindex")
+		}
+		return nil, nil
+	}).AnyTimes()
+
+	changes, err := db.Migrate()
+	assert.EqualError(t, err, `reindexing index event: 1 documents failed to copy, the first with {"id": "1", "status": 400}`)
+	assert.Empty(t, changes)
+}
+
+func TestElasticsearchDB_Migrate_NewerVersion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	db, _ := New(mockedClient)
+
+	defer func(mappings []indexMapping) { indexMappings = mappings }(indexMappings)
+	indexMappings = []indexMapping{{index: EventIndex, version: 1}}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()).Return([]byte(`[{"alias":"event","index":"event_v2"}]`), nil)
+
+	_, err := db.Migrate()
+	assert.EqualError(t, err, "index event is at version 2, but this version of the reporting tool only supports up to 1")
+}
+
+func TestUnversionedIndex(t *testing.T) {
+	assert.Equal(t, "transaction", unversionedIndex("transaction_v12"))
+	assert.Equal(t, "transaction", unversionedIndex("transaction"))
+	assert.Equal(t, "erc20token", unversionedIndex("erc20token"))
+	assert.Equal(t, "my_vault", unversionedIndex("my_vault"))
+}
+
+func TestElasticsearchDB_Migrate_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	db, _ := New(mockedClient)
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()).Return(nil, errors.New("connection refused"))
+
+	changes, err := db.Migrate()
+	assert.EqualError(t, err, "connection refused")
+	assert.Empty(t, changes)
+}
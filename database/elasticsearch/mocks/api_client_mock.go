@@ -5,6 +5,7 @@
 package elasticsearch_mocks
 
 import (
+	context "context"
 	esapi "github.com/elastic/go-elasticsearch/v7/esapi"
 	esutil "github.com/elastic/go-elasticsearch/v7/esutil"
 	gomock "github.com/golang/mock/gomock"
@@ -35,15 +36,17 @@ func (m *MockAPIClient) EXPECT() *MockAPIClientMockRecorder {
 }
 
 // CloseIndexers mocks base method
-func (m *MockAPIClient) CloseIndexers() {
+func (m *MockAPIClient) CloseIndexers(arg0 context.Context) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "CloseIndexers")
+	ret := m.ctrl.Call(m, "CloseIndexers", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // CloseIndexers indicates an expected call of CloseIndexers
-func (mr *MockAPIClientMockRecorder) CloseIndexers() *gomock.Call {
+func (mr *MockAPIClientMockRecorder) CloseIndexers(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseIndexers", reflect.TypeOf((*MockAPIClient)(nil).CloseIndexers))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseIndexers", reflect.TypeOf((*MockAPIClient)(nil).CloseIndexers), arg0)
 }
 
 // DoRequest mocks base method
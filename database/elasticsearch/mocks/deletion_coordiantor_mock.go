@@ -34,15 +34,43 @@ func (m *MockDeletionCoordinator) EXPECT() *MockDeletionCoordinatorMockRecorder
 }
 
 // Delete mocks base method
-func (m *MockDeletionCoordinator) Delete(arg0 types.Address) error {
+func (m *MockDeletionCoordinator) Delete(arg0 types.Address, arg1 func(types.JobProgress)) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Delete", arg0)
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Delete indicates an expected call of Delete
-func (mr *MockDeletionCoordinatorMockRecorder) Delete(arg0 interface{}) *gomock.Call {
+func (mr *MockDeletionCoordinatorMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDeletionCoordinator)(nil).Delete), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDeletionCoordinator)(nil).Delete), arg0, arg1)
+}
+
+// Remove mocks base method
+func (m *MockDeletionCoordinator) Remove(arg0 types.Address) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Remove", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Remove indicates an expected call of Remove
+func (mr *MockDeletionCoordinatorMockRecorder) Remove(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockDeletionCoordinator)(nil).Remove), arg0)
+}
+
+// Unregister mocks base method
+func (m *MockDeletionCoordinator) Unregister(arg0 types.Address) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unregister", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unregister indicates an expected call of Unregister
+func (mr *MockDeletionCoordinatorMockRecorder) Unregister(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unregister", reflect.TypeOf((*MockDeletionCoordinator)(nil).Unregister), arg0)
 }
@@ -0,0 +1,92 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// NetworkActivityAggregateResult is the totals of the transactions of a period
+type NetworkActivityAggregateResult struct {
+	Hits struct {
+		Total struct {
+			Value uint64 `json:"value"`
+		} `json:"total"`
+	} `json:"hits"`
+	Aggregations struct {
+		GasUsed struct {
+			Value float64 `json:"value"`
+		} `json:"gasUsed"`
+		Private struct {
+			DocCount uint64 `json:"doc_count"`
+		} `json:"private"`
+		Accounts struct {
+			Value uint64 `json:"value"`
+		} `json:"accounts"`
+		Contracts struct {
+			Distinct struct {
+				Value uint64 `json:"value"`
+			} `json:"distinct"`
+		} `json:"contracts"`
+	} `json:"aggregations"`
+}
+
+func (es *ElasticsearchDB) GetNetworkActivity(from uint64, to uint64) (*types.NetworkActivity, error) {
+	searchReq := esapi.SearchRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryNetworkActivityTemplate, from, to)),
+	}
+	body, err := es.apiClient.DoRequest(searchReq)
+	if err != nil {
+		return nil, err
+	}
+	var result NetworkActivityAggregateResult
+	if err = json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return &types.NetworkActivity{
+		From:                from,
+		To:                  to,
+		Transactions:        result.Hits.Total.Value,
+		PrivateTransactions: result.Aggregations.Private.DocCount,
+		ActiveContracts:     result.Aggregations.Contracts.Distinct.Value,
+		ActiveAccounts:      result.Aggregations.Accounts.Value,
+		GasUsed:             uint64(result.Aggregations.GasUsed.Value),
+	}, nil
+}
+
+// QueryNetworkActivityTemplate totals the transactions with a timestamp in
+// the range. Active contracts are those whose functions were called, or that
+// were created with no recipient. Distinct counts are exact up to 40000, and
+// approximate above.
+const QueryNetworkActivityTemplate = `
+{
+	"query": {
+		"range": { "timestamp": { "gte": %d, "lte": %d } }
+	},
+	"size": 0,
+	"track_total_hits": true,
+	"aggs": {
+		"gasUsed": { "sum": { "field": "gasUsed" } },
+		"private": { "filter": { "term": { "isPrivate": true } } },
+		"accounts": { "cardinality": { "field": "from.keyword", "precision_threshold": 40000 } },
+		"contracts": {
+			"filter": {
+				"bool": {
+					"should": [
+						{ "exists": { "field": "selector" } },
+						{ "terms": { "to.keyword": ["0x", "0x0000000000000000000000000000000000000000"] } }
+					]
+				}
+			},
+			"aggs": {
+				"distinct": { "cardinality": { "field": "contract", "precision_threshold": 40000 } }
+			}
+		}
+	}
+}
+`
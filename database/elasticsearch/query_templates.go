@@ -4,14 +4,49 @@ import (
 	"fmt"
 	"math/big"
 	"strconv"
+	"strings"
 
 	"quorumengineering/quorum-report/types"
 )
 
 // constant query template strings for ES
+// QueryAllAddressesTemplate finds all registered addresses, except those
+// being deleted
 const QueryAllAddressesTemplate = `
 {
 	"_source": ["address"],
+	"query": {
+		"bool": {
+			"must_not": { "term": { "deleting": true } }
+		}
+	}
+}
+`
+
+// QueryDeletingAddressesTemplate finds the addresses whose deletion was
+// interrupted
+const QueryDeletingAddressesTemplate = `
+{
+	"_source": ["address"],
+	"query": {
+		"term": { "deleting": true }
+	}
+}
+`
+
+// QueryLeasesTemplate finds the leases whose names, which are their IDs,
+// start with a prefix
+const QueryLeasesTemplate = `
+{
+	"query": {
+		"prefix": { "_id": "%s" }
+	}
+}
+`
+
+// QueryAllWebhooksTemplate finds all registered webhooks
+const QueryAllWebhooksTemplate = `
+{
 	"query": {
 		"match_all": {}
 	}
@@ -27,6 +62,170 @@ const QueryAllTemplateNamesTemplate = `
 }
 `
 
+// QueryBlocksUpToTemplate finds the blocks after the genesis block, up to the
+// given block number
+const QueryBlocksUpToTemplate = `
+{
+	"query": {
+		"range": { "number": { "gte": 1, "lte": %d } }
+	}
+}
+`
+
+// QueryBlockRangeStatsTemplate counts all documents in an index, and finds the
+// lowest and highest value of the given block number field
+const QueryBlockRangeStatsTemplate = `
+{
+	"size": 0,
+	"track_total_hits": true,
+	"aggs": {
+		"oldest": { "min": { "field": "%s" } },
+		"newest": { "max": { "field": "%s" } }
+	}
+}
+`
+
+// QueryAfterBlockTemplate matches all documents where the given block number
+// field is after the given block
+const QueryAfterBlockTemplate = `
+{
+	"query": {
+		"range": { "%s": { "gt": %d } }
+	}
+}
+`
+
+// QueryBeforeBlockTemplate matches all documents where the given block number
+// field is before the given block
+const QueryBeforeBlockTemplate = `
+{
+	"query": {
+		"range": { "%s": { "lt": %d } }
+	}
+}
+`
+
+// QueryContractBeforeBlockTemplate matches the documents of the contract
+// recorded before the given block
+const QueryContractBeforeBlockTemplate = `
+{
+	"query": {
+		"bool": {
+			"must": [
+				{ "match": { "contract": "%s" } },
+				{ "range": { "blockNumber": { "lt": %d } } }
+			]
+		}
+	}
+}
+`
+
+// QueryBlockRangeTemplate matches all documents where the given block number
+// field is within the given blocks, inclusive
+const QueryBlockRangeTemplate = `
+{
+	"query": {
+		"range": { "%s": { "gte": %d, "lte": %d } }
+	}
+}
+`
+
+// UpdateRemoveHeldUntilTemplate marks token entries that ended at or after the
+// given block as held again
+const UpdateRemoveHeldUntilTemplate = `
+{
+	"query": {
+		"range": { "heldUntil": { "gte": %d } }
+	},
+	"script": {
+		"source": "ctx._source.remove('heldUntil')",
+		"lang": "painless"
+	}
+}
+`
+
+// RaiseLastFilteredTemplate sets the last filtered block of a contract, unless
+// it has already been filtered further, as when earlier blocks are indexed again
+const RaiseLastFilteredTemplate = `{"script":{"source":"if (ctx._source.lastFiltered == null || ctx._source.lastFiltered < params.block) { ctx._source.lastFiltered = params.block } else { ctx.op = 'noop' }","lang":"painless","params":{"block":%d}}}`
+
+// LowerLastFilteredTemplate sets the last filtered block of a contract, unless
+// it hasn't been filtered that far yet, so the blocks after it are filtered
+// again
+const LowerLastFilteredTemplate = `{"script":{"source":"if (ctx._source.lastFiltered != null && ctx._source.lastFiltered > params.block) { ctx._source.lastFiltered = params.block } else { ctx.op = 'noop' }","lang":"painless","params":{"block":%d}}}`
+
+// QueryByContractTemplate matches all documents of a contract
+const QueryByContractTemplate = `{ "query": { "match": { "contract": "%s" } } }`
+
+// QueryCounterpartiesSeenAcrossBlockTemplate matches the counterparties first
+// seen at or before the given block and last seen after it
+const QueryCounterpartiesSeenAcrossBlockTemplate = `
+{
+	"query": {
+		"bool": {
+			"filter": [
+				{ "range": { "firstSeenBlock": { "lte": %d } } },
+				{ "range": { "lastSeenBlock": { "gt": %d } } }
+			]
+		}
+	}
+}
+`
+
+// QueryCounterpartyInteractionsTemplate matches the transactions in a block
+// range, after the first block and up to the second, that a counterparty sent
+// to a contract or called it in
+const QueryCounterpartyInteractionsTemplate = `
+{
+	"query": {
+		"bool": {
+			"filter": [
+				{ "range": { "blockNumber": { "gt": %d, "lte": %d } } }
+			],
+			"should": [
+				{ "bool": { "filter": [
+					{ "match": { "to": "%s" } },
+					{ "match": { "from": "%s" } }
+				] } },
+				{ "nested": {
+					"path": "internalCalls",
+					"query": { "bool": { "filter": [
+						{ "match": { "internalCalls.to": "%s" } },
+						{ "match": { "internalCalls.from": "%s" } }
+					] } }
+				} }
+			],
+			"minimum_should_match": 1
+		}
+	}
+}
+`
+
+// ReindexTemplate copies every document of one index into another
+const ReindexTemplate = `{"source":{"index":"%s"},"dest":{"index":"%s"}}`
+
+// ReindexWithScriptTemplate copies every document of one index into another,
+// changing each with a painless script
+const ReindexWithScriptTemplate = `{"source":{"index":"%s"},"dest":{"index":"%s"},"script":{"lang":"painless","source":%s}}`
+
+// UpdateAliasTemplate points an alias at a new index and deletes the index it
+// pointed at
+const UpdateAliasTemplate = `{"actions":[{"add":{"index":"%s","alias":"%s"}},{"remove_index":{"index":"%s"}}]}`
+
+// UpdateLastFilteredAfterBlockTemplate resets all contracts that have been
+// filtered past the given block to that block
+const UpdateLastFilteredAfterBlockTemplate = `
+{
+	"query": {
+		"range": { "lastFiltered": { "gt": %d } }
+	},
+	"script": {
+		"source": "ctx._source.lastFiltered = params.block",
+		"lang": "painless",
+		"params": { "block": %d }
+	}
+}
+`
+
 func QueryByToAddressWithOptionsTemplate(options *types.QueryOptions) string {
 	return `
 {
@@ -43,6 +242,73 @@ func QueryByToAddressWithOptionsTemplate(options *types.QueryOptions) string {
 `
 }
 
+// QueryTransactionsInBlockRangeTemplate finds the transactions in an
+// inclusive block range
+const QueryTransactionsInBlockRangeTemplate = `
+{
+	"query": {
+		"range": { "blockNumber": { "gte": %d, "lte": %d } }
+	}
+}
+`
+
+// QueryBlocksByTimeRangeTemplate finds the blocks in an inclusive timestamp
+// range
+const QueryBlocksByTimeRangeTemplate = `
+{
+	"query": {
+		"range": { "timestamp": { "gte": %d, "lte": %d } }
+	}
+}
+`
+
+// QueryEventsForTransactionsTemplate groups the events of the given
+// transactions by transaction, keeping the first events of each in log order
+const QueryEventsForTransactionsTemplate = `
+{
+	"query": {
+		"terms": { "transactionHash.keyword": %s }
+	},
+	"size": 0,
+	"aggs": {
+		"result_buckets": {
+			"terms": { "field": "transactionHash.keyword", "size": %d },
+			"aggs": {
+				"events": {
+					"top_hits": { "size": %d, "sort": [{ "index": "asc" }] }
+				}
+			}
+		}
+	}
+}
+`
+
+// QueryContractEventsForTransactionsTemplate is
+// QueryEventsForTransactionsTemplate for the events of the given contracts
+const QueryContractEventsForTransactionsTemplate = `
+{
+	"query": {
+		"bool": {
+			"must": [
+				{ "terms": { "transactionHash.keyword": %s } },
+				{ "terms": { "address.keyword": %s } }
+			]
+		}
+	},
+	"size": 0,
+	"aggs": {
+		"result_buckets": {
+			"terms": { "field": "transactionHash.keyword", "size": %d },
+			"aggs": {
+				"events": {
+					"top_hits": { "size": %d, "sort": [{ "index": "asc" }] }
+				}
+			}
+		}
+	}
+}
+`
+
 func QueryByAddressWithOptionsTemplate(options *types.QueryOptions) string {
 	return `
 {
@@ -74,6 +340,32 @@ func QueryByAddressWithBlockRangeOptionsTemplate(opt *types.PageOptions) string
 `
 }
 
+// QueryJournalTemplate finds the journal entries for blocks in the range that
+// match the query
+func QueryJournalTemplate(query *types.JournalQuery, options *types.PageOptions) string {
+	must := []string{createRangeQuery("blockNumber", options.BeginBlockNumber, options.EndBlockNumber)}
+	if query.Stage != "" {
+		must = append(must, fmt.Sprintf(`{ "match": { "stage": "%s" } }`, query.Stage))
+	}
+	if query.ErrorsOnly {
+		must = append(must, `{ "exists": { "field": "errors" } }`)
+	}
+	if query.MinDuration > 0 {
+		must = append(must, fmt.Sprintf(`{ "range": { "duration": { "gte": %d } } }`, query.MinDuration))
+	}
+	return `
+{
+	"query": {
+		"bool": {
+			"must": [
+				` + strings.Join(must, ",\n\t\t\t\t") + `
+			]
+		}
+	}
+}
+`
+}
+
 const QueryMatchContract = `
 {
 	"query": {
@@ -124,6 +416,41 @@ func QueryInternalTransactionsWithOptionsTemplate(options *types.QueryOptions) s
 // This query will get all the balances between a certain block range, as well as the
 // last balance before the starting block IF there was no balance update ON the starting block
 func QueryTokenBalanceAtBlockRange(options *types.TokenQueryOptions) string {
+	return `
+{
+  "query": {
+    "bool": {
+` + createBalanceRangeQuery(options) + `
+      "must": [
+        {"match": {"contract": "%s"}},
+        {"match": {"holder": "%s"}}
+      ]
+    }
+  }
+}
+`
+}
+
+// QueryERC1155TokenBalanceAtBlockRange is the same as QueryTokenBalanceAtBlockRange,
+// limited to a single token ID
+func QueryERC1155TokenBalanceAtBlockRange(options *types.TokenQueryOptions) string {
+	return `
+{
+  "query": {
+    "bool": {
+` + createBalanceRangeQuery(options) + `
+      "must": [
+        {"match": {"contract": "%s"}},
+        {"match": {"holder": "%s"}},
+        {"match": {"tokenId": "%s"}}
+      ]
+    }
+  }
+}
+`
+}
+
+func createBalanceRangeQuery(options *types.TokenQueryOptions) string {
 	rangeQuery := `
       "filter": [
         {
@@ -150,16 +477,134 @@ func QueryTokenBalanceAtBlockRange(options *types.TokenQueryOptions) string {
         }
       ],
 `
-	rangeQuery = fmt.Sprintf(rangeQuery, options.BeginBlockNumber.Uint64(), options.BeginBlockNumber.Uint64())
+	return fmt.Sprintf(rangeQuery, options.BeginBlockNumber.Uint64(), options.BeginBlockNumber.Uint64())
+}
 
+func QueryERC20TokenBalanceAtBlock() string {
+	return `
+{
+	"query": {
+		"bool": {
+			"must": [
+				{ "match": { "contract": "%s"} },
+				{ "match": { "holder": "%s" } },
+				{ "range": { "blockNumber": { "lte": %d } } }
+			]
+		}
+	},
+	"sort": [
+			{
+				"blockNumber": {
+					"order": "desc",
+					"unmapped_type": "long"
+				}
+			}
+	]
+}
+`
+}
+
+func QueryERC20TokenHoldersAtBlock() string {
+	return `
+{
+	"query": {
+		"bool": {
+			"must": [
+				{ "match": { "contract": "%s"} },
+				{ "range": { "blockNumber": { "lte": %d } } }
+			],
+			"filter": [{
+                "bool": {
+                    "should": [
+						{ "range": { "heldUntil": { "gte": %d } } }, 
+						{ "bool": { "must_not": { "exists": { "field": "heldUntil" } } } }
+					]
+                }
+            }]
+		}
+	},
+	"size": 0,
+	"aggs" : {
+		"result_buckets": {
+			"composite" : {
+				"size": %d,
+				%s
+				"sources" : [
+					{ "holder": { "terms" : { "field": "holder.keyword" } } }
+				]
+		  	}
+		}
+	}
+}
+`
+}
+
+func QueryERC20TokenHoldersWithBalanceAtBlock() string {
+	return `
+{
+	"query": {
+		"bool": {
+			"must": [
+				{ "match": { "contract": "%s"} },
+				{ "range": { "blockNumber": { "lte": %d } } }
+			],
+			"must_not": [
+				{ "term": { "amount.keyword": "0" } },
+				{ "match": { "holder": "0x0000000000000000000000000000000000000000" } }
+			],
+			"filter": [{
+                "bool": {
+                    "should": [
+						{ "range": { "heldUntil": { "gte": %d } } }, 
+						{ "bool": { "must_not": { "exists": { "field": "heldUntil" } } } }
+					]
+                }
+            }]
+		}
+	}
+}
+`
+}
+
+// QueryERC20AllowanceAtBlock finds the last approval of the spender by the
+// owner at or before the block
+func QueryERC20AllowanceAtBlock() string {
+	return `
+{
+	"query": {
+		"bool": {
+			"must": [
+				{ "match": { "contract": "%s"} },
+				{ "match": { "owner": "%s" } },
+				{ "match": { "spender": "%s" } },
+				{ "range": { "blockNumber": { "lte": %d } } }
+			]
+		}
+	},
+	"sort": [
+			{
+				"blockNumber": {
+					"order": "desc",
+					"unmapped_type": "long"
+				}
+			}
+	]
+}
+`
+}
+
+// QueryERC20AllowanceAtBlockRange is the same as QueryTokenBalanceAtBlockRange,
+// for the allowance of a spender approved by an owner
+func QueryERC20AllowanceAtBlockRange(options *types.TokenQueryOptions) string {
 	return `
 {
   "query": {
     "bool": {
-` + rangeQuery + `
+` + createBalanceRangeQuery(options) + `
       "must": [
         {"match": {"contract": "%s"}},
-        {"match": {"holder": "%s"}}
+        {"match": {"owner": "%s"}},
+        {"match": {"spender": "%s"}}
       ]
     }
   }
@@ -167,7 +612,36 @@ func QueryTokenBalanceAtBlockRange(options *types.TokenQueryOptions) string {
 `
 }
 
-func QueryERC20TokenBalanceAtBlock() string {
+// QueryERC20AllowancesAtBlock finds the non-zero allowances approved by an
+// owner that are in place at the block
+func QueryERC20AllowancesAtBlock() string {
+	return `
+{
+	"query": {
+		"bool": {
+			"must": [
+				{ "match": { "contract": "%s"} },
+				{ "match": { "owner": "%s" } },
+				{ "range": { "blockNumber": { "lte": %d } } }
+			],
+			"must_not": [
+				{ "term": { "amount.keyword": "0" } }
+			],
+			"filter": [{
+				"bool": {
+					"should": [
+						{ "range": { "heldUntil": { "gte": %d } } },
+						{ "bool": { "must_not": { "exists": { "field": "heldUntil" } } } }
+					]
+				}
+			}]
+		}
+	}
+}
+`
+}
+
+func QueryERC1155TokenBalanceAtBlock() string {
 	return `
 {
 	"query": {
@@ -175,6 +649,7 @@ func QueryERC20TokenBalanceAtBlock() string {
 			"must": [
 				{ "match": { "contract": "%s"} },
 				{ "match": { "holder": "%s" } },
+				{ "match": { "tokenId": "%s" } },
 				{ "range": { "blockNumber": { "lte": %d } } }
 			]
 		}
@@ -191,13 +666,14 @@ func QueryERC20TokenBalanceAtBlock() string {
 `
 }
 
-func QueryERC20TokenHoldersAtBlock() string {
+func QueryERC1155TokenHoldersAtBlock() string {
 	return `
 {
 	"query": {
 		"bool": {
 			"must": [
 				{ "match": { "contract": "%s"} },
+				{ "match": { "tokenId": "%s"} },
 				{ "range": { "blockNumber": { "lte": %d } } }
 			],
 			"filter": [{
@@ -233,6 +709,41 @@ func createRangeQuery(name string, start *big.Int, end *big.Int) string {
 	return fmt.Sprintf(`{ "range": { "%s": { "gte": %s, "lte": %s } } }`, name, start.String(), end.String())
 }
 
+// QueryEventsByTopicsTemplate finds the events of the addresses that have each
+// of the topics given, by position
+func QueryEventsByTopicsTemplate(addresses []types.Address, topics []*types.Hash, options *types.QueryOptions) string {
+	clauses := make([]string, 0, len(topics)+3)
+	if len(addresses) == 1 {
+		clauses = append(clauses, fmt.Sprintf(`{ "match": { "address": "%s" } }`, addresses[0].String()))
+	} else {
+		quoted := make([]string, len(addresses))
+		for i := range addresses {
+			quoted[i] = `"` + addresses[i].String() + `"`
+		}
+		clauses = append(clauses, fmt.Sprintf(`{ "terms": { "address.keyword": [%s] } }`, strings.Join(quoted, ",")))
+	}
+	for i, topic := range topics {
+		if topic != nil {
+			clauses = append(clauses, fmt.Sprintf(`{ "term": { "topic%d": "%s" } }`, i, topic.String()))
+		}
+	}
+	clauses = append(clauses,
+		createRangeQuery("blockNumber", options.BeginBlockNumber, options.EndBlockNumber),
+		createRangeQuery("timestamp", options.BeginTimestamp, options.EndTimestamp),
+	)
+	return `
+{
+	"query": {
+		"bool": {
+			"must": [
+				` + strings.Join(clauses, ",\n\t\t\t\t") + `
+			]
+		}
+	}
+}
+`
+}
+
 func QueryERC721TokenAtBlock() string {
 	return `
 {
@@ -257,6 +768,36 @@ func QueryERC721TokenAtBlock() string {
 `
 }
 
+// QueryERC721TokenHistory finds the holdings of a token that overlap the block
+// range
+func QueryERC721TokenHistory(options *types.TokenQueryOptions) string {
+	held := `{ "range": { "heldFrom": { "gte": 0 } } }`
+	if options.EndBlockNumber.Cmp(big.NewInt(-1)) != 0 {
+		held = fmt.Sprintf(`{ "range": { "heldFrom": { "lte": %s } } }`, options.EndBlockNumber.String())
+	}
+	return `
+{
+	"query": {
+		"bool": {
+			"must": [
+				{ "match": { "contract": "%s"} },
+				{ "match": { "token": "%s"} },
+				` + held + `
+			],
+			"filter": [{
+				"bool": {
+					"should": [
+						{ "range": { "heldUntil": { "gte": ` + options.BeginBlockNumber.String() + ` } } },
+						{ "bool": { "must_not": { "exists": { "field": "heldUntil" } } } }
+					]
+				}
+			}]
+		}
+	}
+}
+`
+}
+
 func QueryERC721HolderAtBlock(start *big.Int) string {
 	return `
 {
@@ -361,3 +902,107 @@ func createTokenRangeQuery(start *big.Int) string {
 		fmt.Sprintf(`{ "range": { "%s": { "gte": %d } } }`, "fifth", startFifth),
 	)
 }
+
+// QueryAllLegalHoldsTemplate finds all legal holds
+const QueryAllLegalHoldsTemplate = `
+{
+	"query": {
+		"match_all": {}
+	}
+}
+`
+
+// QueryAllTokenRulesTemplate finds all token rules
+const QueryAllTokenRulesTemplate = `
+{
+	"query": {
+		"match_all": {}
+	}
+}
+`
+
+// QueryAllDocumentsTemplate finds every document of an index
+const QueryAllDocumentsTemplate = `
+{
+	"query": {
+		"match_all": {}
+	}
+}
+`
+
+// QueryAllArchivedBatchesTemplate finds all archived batches
+const QueryAllArchivedBatchesTemplate = `
+{
+	"query": {
+		"match_all": {}
+	}
+}
+`
+
+// QueryArchivedBatchTemplate finds the archived batch holding the given block
+const QueryArchivedBatchTemplate = `
+{
+	"query": {
+		"bool": {
+			"filter": [
+				{ "range": { "startBlock": { "lte": %d } } },
+				{ "range": { "endBlock": { "gte": %d } } }
+			]
+		}
+	}
+}
+`
+
+// QueryArchivedTransactionTemplate finds the archived batch holding the given
+// transaction
+const QueryArchivedTransactionTemplate = `
+{
+	"query": {
+		"term": { "transactions": "%s" }
+	}
+}
+`
+
+// QuerySearchBlockNumberTemplate finds the block with the given number
+const QuerySearchBlockNumberTemplate = `
+{
+	"query": {
+		"term": { "number": %d }
+	}
+}
+`
+
+// QuerySearchHashTemplate finds the block or transaction with the given hash,
+// and the events emitted by the transaction, across the block, transaction
+// and event indices. A hash is either a block's or a transaction's, so
+// sorting by index name puts the transaction before its events, which are in
+// log order.
+const QuerySearchHashTemplate = `
+{
+	"query": {
+		"bool": {
+			"should": [
+				{ "match": { "hash": "%s" } },
+				{ "match": { "transactionHash": "%s" } }
+			]
+		}
+	},
+	"sort": [
+		{ "_index": "desc" },
+		{ "index": { "order": "asc", "unmapped_type": "long" } }
+	]
+}
+`
+
+// QuerySearchAddressTemplate finds the registered contract with the given
+// address, unless it is being deleted
+const QuerySearchAddressTemplate = `
+{
+	"query": {
+		"bool": {
+			"must": { "match": { "address": "%s" } },
+			"must_not": { "term": { "deleting": true } }
+		}
+	}
+}
+`
@@ -0,0 +1,108 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+// RetentionDB
+
+// ApplyRetention deletes the documents with delete by query. The indices
+// aren't split by time, so ILM policies, which delete whole indices once they
+// are old enough, can't be used for them.
+func (es *ElasticsearchDB) ApplyRetention(index string, beforeBlock uint64) (*types.RetentionDeletion, error) {
+	holds, err := getLegalHolds(es.apiClient)
+	if err != nil {
+		return nil, fmt.Errorf("reading legal holds: %v", err)
+	}
+
+	deletion := &types.RetentionDeletion{Index: index, BeforeBlock: beforeBlock}
+	switch index {
+	case EventIndex:
+		query := excludeLegalHolds(fmt.Sprintf(QueryBeforeBlockTemplate, "blockNumber", beforeBlock), holds)
+		deletion.Deleted, err = es.deleteForRetention(index, query)
+	case StorageIndex:
+		deletion.Deleted, err = es.deleteStorageForRetention(beforeBlock, holds)
+	case ERC20TokenIndex, ERC721TokenIndex, ERC1155TokenIndex, ERC20AllowanceIndex:
+		// ERC721 tokens are recorded against the block they are held from
+		blockField := "blockNumber"
+		if index == ERC721TokenIndex {
+			blockField = "heldFrom"
+		}
+		query := excludeLegalHoldsOn(fmt.Sprintf(QueryBeforeBlockTemplate, "heldUntil", beforeBlock), holds, blockField)
+		deletion.Deleted, err = es.deleteForRetention(index, query)
+	default:
+		return nil, fmt.Errorf("index %s can not have a retention policy", index)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Applied retention", "index", index, "before block", beforeBlock, "deleted", deletion.Deleted)
+	return deletion, nil
+}
+
+// deleteStorageForRetention deletes the storage of each registered contract
+// from before its last change before the block, which is the storage at the
+// block
+func (es *ElasticsearchDB) deleteStorageForRetention(beforeBlock uint64, holds types.LegalHolds) (uint64, error) {
+	if beforeBlock == 0 {
+		return 0, nil
+	}
+	addresses, err := es.GetAddresses()
+	if err != nil {
+		return 0, err
+	}
+	var deleted uint64
+	for _, address := range addresses {
+		size := 1
+		searchReq := esapi.SearchRequest{
+			Index:  []string{StorageIndex},
+			Body:   strings.NewReader(fmt.Sprintf(QueryMatchContract, address.String(), beforeBlock-1)),
+			Size:   &size,
+			Source: []string{"blockNumber"},
+		}
+		result, err := es.doSearchRequest(searchReq)
+		if err != nil {
+			return deleted, err
+		}
+		if len(result.Hits.Hits) == 0 {
+			continue
+		}
+		marshalled, _ := json.Marshal(result.Hits.Hits[0])
+		var kept StorageQueryResult
+		if err := json.Unmarshal(marshalled, &kept); err != nil {
+			return deleted, err
+		}
+		query := excludeLegalHolds(fmt.Sprintf(QueryContractBeforeBlockTemplate, address.String(), kept.Source.BlockNumber), holds)
+		contractDeleted, err := es.deleteForRetention(StorageIndex, query)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += contractDeleted
+	}
+	return deleted, nil
+}
+
+func (es *ElasticsearchDB) deleteForRetention(index string, query string) (uint64, error) {
+	deleteReq := esapi.DeleteByQueryRequest{
+		Index:             []string{index},
+		Body:              strings.NewReader(query),
+		Refresh:           &RequestParameterTrue,
+		WaitForCompletion: &RequestParameterTrue,
+	}
+	body, err := es.apiClient.DoRequest(deleteReq)
+	if err != nil {
+		return 0, fmt.Errorf("deleting %s documents: %v", index, err)
+	}
+	var status DeleteByQueryStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		return 0, err
+	}
+	return status.Deleted, nil
+}
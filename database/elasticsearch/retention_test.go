@@ -0,0 +1,130 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestElasticsearchDB_ApplyRetention_Events(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	legalHolds := `{"hits":{"hits":[{"_source":{"id":"abc","fromBlock":5,"toBlock":6,"reason":"audit"}}]}}`
+	var request esapi.DeleteByQueryRequest
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return([]byte(legalHolds), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.DeleteByQueryRequest{})).
+			Do(func(req esapi.DeleteByQueryRequest) { request = req }).
+			Return([]byte(`{"total": 4, "deleted": 4, "version_conflicts": 0}`), nil),
+	)
+
+	db, _ := New(mockedClient)
+
+	deletion, err := db.ApplyRetention(EventIndex, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, &types.RetentionDeletion{Index: EventIndex, BeforeBlock: 100, Deleted: 4}, deletion)
+
+	assert.Equal(t, []string{EventIndex}, request.Index)
+	body, _ := ioutil.ReadAll(request.Body)
+	// the blocks under legal hold are left out
+	assert.JSONEq(t, `{"query":{"bool":{
+		"must":{"range":{"blockNumber":{"lt":100}}},
+		"must_not":[{"range":{"blockNumber":{"gte":5,"lte":6}}}]
+	}}}`, string(body))
+}
+
+func TestElasticsearchDB_ApplyRetention_Storage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	addr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	var address map[string]interface{}
+	_ = json.Unmarshal([]byte(fmt.Sprintf(`{"_source": {"address": "%s"}}`, addr.String())), &address)
+	size := 1
+	lastChange := esapi.SearchRequest{
+		Index: []string{StorageIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryMatchContract, addr.String(), 99)),
+		Size:  &size,
+	}
+	deleteReq := esapi.DeleteByQueryRequest{
+		Index: []string{StorageIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryContractBeforeBlockTemplate, addr.String(), 90)),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return(nil, ErrIndexNotFound),
+		mockedClient.EXPECT().ScrollAllResults(ContractIndex, QueryAllAddressesTemplate).Return([]interface{}{address}, nil),
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(lastChange)).
+			Return([]byte(`{"hits":{"hits":[{"_source":{"blockNumber":90}}]}}`), nil),
+		mockedClient.EXPECT().DoRequest(NewDeleteByQueryRequestMatcher(deleteReq)).
+			Return([]byte(`{"total": 2, "deleted": 2, "version_conflicts": 0}`), nil),
+	)
+
+	db, _ := New(mockedClient)
+
+	// the storage at block 100 is from block 90, so is kept
+	deletion, err := db.ApplyRetention(StorageIndex, 100)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, deletion.Deleted)
+}
+
+func TestElasticsearchDB_ApplyRetention_Tokens(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	legalHolds := `{"hits":{"hits":[{"_source":{"id":"abc","fromBlock":5,"toBlock":6,"reason":"audit"}}]}}`
+	var request esapi.DeleteByQueryRequest
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return([]byte(legalHolds), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.DeleteByQueryRequest{})).
+			Do(func(req esapi.DeleteByQueryRequest) { request = req }).
+			Return([]byte(`{"total": 1, "deleted": 1, "version_conflicts": 0}`), nil),
+	)
+
+	db, _ := New(mockedClient)
+
+	deletion, err := db.ApplyRetention(ERC721TokenIndex, 100)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, deletion.Deleted)
+
+	// tokens replaced before the block are deleted, unless recorded in a
+	// block under legal hold
+	body, _ := ioutil.ReadAll(request.Body)
+	assert.JSONEq(t, `{"query":{"bool":{
+		"must":{"range":{"heldUntil":{"lt":100}}},
+		"must_not":[{"range":{"heldFrom":{"gte":5,"lte":6}}}]
+	}}}`, string(body))
+}
+
+func TestElasticsearchDB_ApplyRetention_InvalidIndex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return(nil, ErrIndexNotFound)
+
+	db, _ := New(mockedClient)
+
+	_, err := db.ApplyRetention(BlockIndex, 100)
+	assert.EqualError(t, err, "index block can not have a retention policy")
+}
@@ -0,0 +1,73 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"quorumengineering/quorum-report/types"
+)
+
+func (es *ElasticsearchDB) Search(query *types.SearchQuery, limit int) ([]*types.SearchResult, error) {
+	var (
+		indices     []string
+		queryString string
+	)
+	switch {
+	case query.BlockNumber != nil:
+		indices = []string{BlockIndex}
+		queryString = fmt.Sprintf(QuerySearchBlockNumberTemplate, *query.BlockNumber)
+	case query.Hash != nil:
+		indices = []string{BlockIndex, TransactionIndex, EventIndex}
+		queryString = fmt.Sprintf(QuerySearchHashTemplate, query.Hash.String(), query.Hash.String())
+	case query.Address != nil:
+		indices = []string{ContractIndex}
+		queryString = fmt.Sprintf(QuerySearchAddressTemplate, query.Address.String())
+	default:
+		return []*types.SearchResult{}, nil
+	}
+
+	req := esapi.SearchRequest{
+		Index: indices,
+		Body:  strings.NewReader(queryString),
+		Size:  &limit,
+	}
+	results, err := es.doSearchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]*types.SearchResult, 0, len(results.Hits.Hits))
+	for _, result := range results.Hits.Hits {
+		marshalled, _ := json.Marshal(result.Source)
+		switch unversionedIndex(result.Index) {
+		case BlockIndex:
+			var block types.Block
+			if err := json.Unmarshal(marshalled, &block); err != nil {
+				return nil, err
+			}
+			found = append(found, types.NewBlockSearchResult(block.Number, block.Hash))
+		case TransactionIndex:
+			var tx types.Transaction
+			if err := json.Unmarshal(marshalled, &tx); err != nil {
+				return nil, err
+			}
+			found = append(found, types.NewTransactionSearchResult(tx.BlockNumber, tx.Hash))
+		case EventIndex:
+			var event types.Event
+			if err := json.Unmarshal(marshalled, &event); err != nil {
+				return nil, err
+			}
+			found = append(found, types.NewEventSearchResult(event))
+		case ContractIndex:
+			var contract Contract
+			if err := json.Unmarshal(marshalled, &contract); err != nil {
+				return nil, err
+			}
+			found = append(found, types.NewContractSearchResult(contract.Address, contract.CreationTransaction))
+		}
+	}
+	return found, nil
+}
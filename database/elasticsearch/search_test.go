@@ -0,0 +1,96 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestElasticsearchDB_Search_Hash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	hash := types.NewHash("0xf4f803b8d6c6b38e0b15d6cfe80fd1dcea4270ad24e93385fca36512bb9c2c59")
+	limit := 10
+	ex := esapi.SearchRequest{
+		Index: []string{BlockIndex, TransactionIndex, EventIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QuerySearchHashTemplate, hash.String(), hash.String())),
+		Size:  &limit,
+	}
+	// the indices are versioned behind their aliases
+	result := `{"hits":{"hits":[
+		{"_index":"transaction_v2","_source":{"hash":"0xf4f803b8d6c6b38e0b15d6cfe80fd1dcea4270ad24e93385fca36512bb9c2c59","blockNumber":7,"index":2}},
+		{"_index":"event","_source":{"address":"0x0000000000000000000000000000000000000001","blockNumber":7,"transactionHash":"0xf4f803b8d6c6b38e0b15d6cfe80fd1dcea4270ad24e93385fca36512bb9c2c59","index":4}}
+	]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(ex)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+
+	results, err := db.Search(&types.SearchQuery{Hash: &hash}, limit)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.SearchResult{
+		types.NewTransactionSearchResult(7, hash),
+		types.NewEventSearchResult(types.Event{Address: types.NewAddress("1"), BlockNumber: 7, TransactionHash: hash, Index: 4}),
+	}, results)
+}
+
+func TestElasticsearchDB_Search_BlockNumber(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	number := uint64(12)
+	limit := 10
+	ex := esapi.SearchRequest{
+		Index: []string{BlockIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QuerySearchBlockNumberTemplate, number)),
+		Size:  &limit,
+	}
+	result := `{"hits":{"hits":[{"_index":"block_v1","_source":{"number":12,"hash":"0x0000000000000000000000000000000000000000000000000000000000000012"}}]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(ex)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+
+	results, err := db.Search(&types.SearchQuery{BlockNumber: &number}, limit)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.SearchResult{types.NewBlockSearchResult(12, types.NewHash("0x12"))}, results)
+}
+
+func TestElasticsearchDB_Search_Address(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	address := types.NewAddress("1")
+	limit := 10
+	ex := esapi.SearchRequest{
+		Index: []string{ContractIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QuerySearchAddressTemplate, address.String())),
+		Size:  &limit,
+	}
+	result := `{"hits":{"hits":[{"_index":"contract","_source":{"address":"0x0000000000000000000000000000000000000001","creationTx":"0x0000000000000000000000000000000000000000000000000000000000000003","lastFiltered":20}}]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(ex)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+
+	results, err := db.Search(&types.SearchQuery{Address: &address}, limit)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.SearchResult{types.NewContractSearchResult(address, types.NewHash("0x03"))}, results)
+}
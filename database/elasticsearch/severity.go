@@ -0,0 +1,151 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// SeverityCountsResult is the number of events classified with each severity
+type SeverityCountsResult struct {
+	Aggregations struct {
+		Severities struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount uint64 `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"severities"`
+	} `json:"aggregations"`
+}
+
+func (es *ElasticsearchDB) GetEventsBySeverity(query *types.EventSeverityQuery, options *types.QueryOptions) ([]*types.Event, error) {
+	from, cursor, err := pageStart(options)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := es.queriedContracts(query.Address, query.Contracts)
+	if err != nil || len(addresses) == 0 {
+		return []*types.Event{}, err
+	}
+	req := esapi.SearchRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(withSearchAfter(QueryEventsBySeverityTemplate(addresses, query.Severity, options), cursor)),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"blockNumber:desc", "index:asc"},
+	}
+	results, err := es.doSearchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*types.Event, len(results.Hits.Hits))
+	for i, result := range results.Hits.Hits {
+		marshalled, _ := json.Marshal(result.Source)
+		var event types.Event
+		if err = json.Unmarshal(marshalled, &event); err != nil {
+			return nil, err
+		}
+		events[i] = &event
+	}
+	return events, nil
+}
+
+func (es *ElasticsearchDB) GetEventsBySeverityTotal(query *types.EventSeverityQuery, options *types.QueryOptions) (uint64, error) {
+	addresses, err := es.queriedContracts(query.Address, query.Contracts)
+	if err != nil || len(addresses) == 0 {
+		return 0, err
+	}
+	req := esapi.CountRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(QueryEventsBySeverityTemplate(addresses, query.Severity, options)),
+	}
+	results, err := es.doCountRequest(req)
+	if err != nil {
+		return 0, err
+	}
+	return results.Count, nil
+}
+
+func (es *ElasticsearchDB) GetEventSeverityCounts(query *types.EventSeverityQuery, options *types.QueryOptions) (types.SeverityCounts, error) {
+	counts := types.NewSeverityCounts()
+	addresses, err := es.queriedContracts(query.Address, query.Contracts)
+	if err != nil || len(addresses) == 0 {
+		return counts, err
+	}
+	req := esapi.SearchRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(QueryEventSeverityCountsTemplate(addresses, options)),
+	}
+	body, err := es.apiClient.DoRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var result SeverityCountsResult
+	if err = json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	for _, bucket := range result.Aggregations.Severities.Buckets {
+		counts[bucket.Key] = bucket.DocCount
+	}
+	return counts, nil
+}
+
+// QueryEventsBySeverityTemplate finds the events of the addresses classified
+// with the severity
+func QueryEventsBySeverityTemplate(addresses []types.Address, severity string, options *types.QueryOptions) string {
+	return `
+{
+	"query": {
+		"bool": {
+			"must": [
+				` + strings.Join(severityClauses(addresses, severity, options), ",\n\t\t\t\t") + `
+			]
+		}
+	}
+}
+`
+}
+
+// QueryEventSeverityCountsTemplate counts the events of the addresses
+// classified with each severity
+func QueryEventSeverityCountsTemplate(addresses []types.Address, options *types.QueryOptions) string {
+	return `
+{
+	"query": {
+		"bool": {
+			"must": [
+				` + strings.Join(severityClauses(addresses, "", options), ",\n\t\t\t\t") + `
+			]
+		}
+	},
+	"size": 0,
+	"aggs": {
+		"severities": {
+			"terms": { "field": "` + types.SeverityField + `" }
+		}
+	}
+}
+`
+}
+
+// severityClauses matches the events of the addresses in the range of the
+// options, with the severity if given
+func severityClauses(addresses []types.Address, severity string, options *types.QueryOptions) []string {
+	quoted := make([]string, len(addresses))
+	for i := range addresses {
+		quoted[i] = `"` + addresses[i].String() + `"`
+	}
+	clauses := []string{fmt.Sprintf(`{ "terms": { "address.keyword": [%s] } }`, strings.Join(quoted, ","))}
+	if severity != "" {
+		clauses = append(clauses, fmt.Sprintf(`{ "term": { "%s": "%s" } }`, types.SeverityField, severity))
+	}
+	return append(clauses,
+		createRangeQuery("blockNumber", options.BeginBlockNumber, options.EndBlockNumber),
+		createRangeQuery("timestamp", options.BeginTimestamp, options.EndTimestamp),
+	)
+}
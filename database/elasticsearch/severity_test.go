@@ -0,0 +1,52 @@
+package elasticsearch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestQueryEventsBySeverityTemplate(t *testing.T) {
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	addresses := []types.Address{types.NewAddress("1"), types.NewAddress("2")}
+
+	query := QueryEventsBySeverityTemplate(addresses, types.CriticalSeverity, options)
+	assert.Contains(t, query, `{ "terms": { "address.keyword": ["0x0000000000000000000000000000000000000001","0x0000000000000000000000000000000000000002"] } }`)
+	assert.Contains(t, query, `{ "term": { "severity": "critical" } }`)
+
+	counts := QueryEventSeverityCountsTemplate(addresses, options)
+	assert.NotContains(t, counts, `"term"`)
+	assert.Contains(t, counts, `"terms": { "field": "severity" }`)
+}
+
+func TestElasticsearchDB_GetEventSeverityCounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	address := types.NewAddress("1")
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	ex := esapi.SearchRequest{
+		Index: []string{EventIndex},
+		Body:  strings.NewReader(QueryEventSeverityCountsTemplate([]types.Address{address}, options)),
+	}
+	result := `{"aggregations":{"severities":{"buckets":[{"key":"critical","doc_count":2},{"key":"info","doc_count":7}]}}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(ex)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+
+	counts, err := db.GetEventSeverityCounts(&types.EventSeverityQuery{Address: &address}, options)
+	assert.Nil(t, err)
+	assert.Equal(t, types.SeverityCounts{types.InfoSeverity: 7, types.WarningSeverity: 0, types.CriticalSeverity: 2}, counts)
+}
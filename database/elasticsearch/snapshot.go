@@ -0,0 +1,115 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
+)
+
+// SnapshotMetadata describes the data of a database restored from a snapshot
+type SnapshotMetadata struct {
+	SchemaVersion int
+	LastPersisted uint64
+	// how many blocks are stored up to the last persisted one, in the
+	// database or archived
+	Blocks uint64
+}
+
+// snapshotIndices are the indices restored from a snapshot, whether a
+// snapshot of versioned indices behind aliases or of unversioned ones
+func snapshotIndices() []string {
+	var indices []string
+	for _, m := range indexMappings {
+		// the lease belongs to the instances of the deployment the snapshot
+		// was taken of
+		if m.index == LeaseIndex {
+			continue
+		}
+		indices = append(indices, m.index, m.index+"_v*")
+	}
+	return indices
+}
+
+// RestoreSnapshot restores the indices of a snapshot taken of another
+// deployment's database, returning once it is done. It must be run before the
+// database is created with New, as restoring fails if any index exists.
+func RestoreSnapshot(client APIClient, repository, snapshot string) error {
+	for _, m := range indexMappings {
+		index := m.index
+		_, err := client.DoRequest(esapi.CatIndicesRequest{Index: []string{index}})
+		if err == nil {
+			return fmt.Errorf("index %s already exists, a snapshot can only be restored into a new database", index)
+		}
+		if err != ErrIndexNotFound {
+			return err
+		}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"indices":              strings.Join(snapshotIndices(), ","),
+		"ignore_unavailable":   true,
+		"include_global_state": false,
+	})
+	if err != nil {
+		return err
+	}
+	waitForCompletion := true
+	restoreReq := esapi.SnapshotRestoreRequest{
+		Repository:        repository,
+		Snapshot:          snapshot,
+		Body:              strings.NewReader(string(body)),
+		WaitForCompletion: &waitForCompletion,
+	}
+	log.Info("Restoring snapshot", "repository", repository, "snapshot", snapshot)
+	if _, err := client.DoRequest(restoreReq); err != nil {
+		return fmt.Errorf("restoring snapshot %s: %v", snapshot, err)
+	}
+	log.Info("Restored snapshot", "repository", repository, "snapshot", snapshot)
+	return nil
+}
+
+// GetSnapshotMetadata returns what is needed to check that the data restored
+// from a snapshot can be synced on from
+func (es *ElasticsearchDB) GetSnapshotMetadata() (*SnapshotMetadata, error) {
+	schemaVersion, err := es.GetSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	lastPersisted, err := es.getLastPersisted()
+	if err != nil {
+		return nil, err
+	}
+
+	// blocks are archived in order from the first block after the genesis
+	// block, so those up to the last archived block are no longer in the
+	// database
+	query := fmt.Sprintf(QueryBlocksUpToTemplate, lastPersisted)
+	var archived uint64
+	batch, err := es.GetLastArchivedBatch()
+	switch {
+	case err == nil:
+		archived = batch.EndBlock
+		query = fmt.Sprintf(QueryBlockRangeTemplate, "number", batch.EndBlock+1, lastPersisted)
+	case err != database.ErrNotFound:
+		return nil, err
+	}
+
+	req := esapi.CountRequest{
+		Index: []string{BlockIndex},
+		Body:  strings.NewReader(query),
+	}
+	results, err := es.doCountRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotMetadata{
+		SchemaVersion: schemaVersion,
+		LastPersisted: lastPersisted,
+		Blocks:        archived + results.Count,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package elasticsearch
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+)
+
+func TestRestoreSnapshot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	var restored esapi.SnapshotRestoreRequest
+	var restoreBody string
+	mockedClient.EXPECT().DoRequest(gomock.Any()).DoAndReturn(func(req esapi.Request) ([]byte, error) {
+		switch r := req.(type) {
+		case esapi.CatIndicesRequest:
+			return nil, ErrIndexNotFound
+		case esapi.SnapshotRestoreRequest:
+			restored = r
+			body, _ := ioutil.ReadAll(r.Body)
+			restoreBody = string(body)
+			return []byte(`{}`), nil
+		default:
+			t.Fatalf("unexpected request %T", req)
+		}
+		return nil, nil
+	}).AnyTimes()
+
+	err := RestoreSnapshot(mockedClient, "backups", "nightly-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "backups", restored.Repository)
+	assert.Equal(t, "nightly-1", restored.Snapshot)
+	assert.True(t, *restored.WaitForCompletion)
+	assert.Equal(t, `{"ignore_unavailable":true,"include_global_state":false,"indices":"block,block_v*,transaction,transaction_v*,contract,contract_v*,template,template_v*,storage,storage_v*,event,event_v*,meta,meta_v*,erc20token,erc20token_v*,erc721token,erc721token_v*,erc1155token,erc1155token_v*,erc20allowance,erc20allowance_v*,webhook,webhook_v*,journal,journal_v*,counterparty,counterparty_v*,legalhold,legalhold_v*,archive,archive_v*,calltree,calltree_v*,tokenrule,tokenrule_v*"}`, restoreBody)
+}
+
+func TestRestoreSnapshot_ExistingIndex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(gomock.Any()).Return(nil, ErrIndexNotFound),
+		mockedClient.EXPECT().DoRequest(gomock.Any()).Return([]byte("green open transaction"), nil),
+	)
+
+	err := RestoreSnapshot(mockedClient, "backups", "nightly-1")
+	assert.EqualError(t, err, "index transaction already exists, a snapshot can only be restored into a new database")
+}
+
+func TestRestoreSnapshot_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()).DoAndReturn(func(req esapi.Request) ([]byte, error) {
+		if _, ok := req.(esapi.SnapshotRestoreRequest); ok {
+			return nil, errors.New("error response from Elasticsearch: [404] snapshot_missing_exception: missing")
+		}
+		return nil, ErrIndexNotFound
+	}).AnyTimes()
+
+	err := RestoreSnapshot(mockedClient, "backups", "nightly-1")
+	assert.EqualError(t, err, "restoring snapshot nightly-1: error response from Elasticsearch: [404] snapshot_missing_exception: missing")
+}
+
+func TestElasticsearchDB_GetSnapshotMetadata(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	countReq := esapi.CountRequest{
+		Index: []string{BlockIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryBlocksUpToTemplate, 250)),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(esapi.GetRequest{Index: MetaIndex, DocumentID: "schemaVersion"})).
+			Return([]byte(`{"_source":{"schemaVersion":1}}`), nil),
+		mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(esapi.GetRequest{Index: MetaIndex, DocumentID: "lastPersisted"})).
+			Return([]byte(`{"_source":{"lastPersisted":250}}`), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return(nil, ErrIndexNotFound),
+		mockedClient.EXPECT().DoRequest(NewCountRequestMatcher(countReq)).Return([]byte(`{"count":248}`), nil),
+	)
+
+	db, _ := New(mockedClient)
+
+	metadata, err := db.GetSnapshotMetadata()
+	assert.Nil(t, err)
+	assert.Equal(t, &SnapshotMetadata{SchemaVersion: 1, LastPersisted: 250, Blocks: 248}, metadata)
+}
+
+func TestElasticsearchDB_GetSnapshotMetadata_Archived(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	countReq := esapi.CountRequest{
+		Index: []string{BlockIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryBlockRangeTemplate, "number", 100, 250)),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(esapi.GetRequest{Index: MetaIndex, DocumentID: "schemaVersion"})).
+			Return([]byte(`{"_source":{"schemaVersion":2}}`), nil),
+		mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(esapi.GetRequest{Index: MetaIndex, DocumentID: "lastPersisted"})).
+			Return([]byte(`{"_source":{"lastPersisted":250}}`), nil),
+		mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).
+			Return([]byte(`{"hits":{"hits":[{"_source":{"key":"blocks-1-99.json.gz","startBlock":1,"endBlock":99}}]}}`), nil),
+		mockedClient.EXPECT().DoRequest(NewCountRequestMatcher(countReq)).Return([]byte(`{"count":151}`), nil),
+	)
+
+	db, _ := New(mockedClient)
+
+	metadata, err := db.GetSnapshotMetadata()
+	assert.Nil(t, err)
+	assert.Equal(t, &SnapshotMetadata{SchemaVersion: 2, LastPersisted: 250, Blocks: 250}, metadata)
+}
@@ -0,0 +1,204 @@
+package elasticsearch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestElasticsearchDB_GetIndexStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	statsResult := `{"indices": {
+		"transaction_v2": {"total": {"store": {"size_in_bytes": 2048}}},
+		"event_v1": {"total": {"store": {"size_in_bytes": 1024}}},
+		"storage": {"total": {"store": {"size_in_bytes": 512}}},
+		"erc20token": {"total": {"store": {"size_in_bytes": 256}}},
+		"erc721token": {"total": {"store": {"size_in_bytes": 128}}},
+		"erc1155token": {"total": {"store": {"size_in_bytes": 64}}}
+	}}`
+	populatedResult := `{"hits": {"total": {"value": 20}}, "aggregations": {"oldest": {"value": 1.0}, "newest": {"value": 150.0}}}`
+	emptyResult := `{"hits": {"total": {"value": 0}}, "aggregations": {"oldest": {"value": null}, "newest": {"value": null}}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.IndicesStatsRequest{})).Return([]byte(statsResult), nil)
+	for _, index := range StatsIndexes {
+		blockField := "blockNumber"
+		if index == ERC721TokenIndex {
+			blockField = "heldFrom"
+		}
+		expectedRequest := esapi.SearchRequest{
+			Index: []string{index},
+			Body:  strings.NewReader(fmt.Sprintf(QueryBlockRangeStatsTemplate, blockField, blockField)),
+		}
+		result := populatedResult
+		if index == ERC721TokenIndex {
+			result = emptyResult
+		}
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(expectedRequest)).Return([]byte(result), nil)
+	}
+
+	db, _ := New(mockedClient)
+	stats, err := db.GetIndexStats()
+
+	assert.Nil(t, err, "unexpected error")
+	assert.Equal(t, []types.IndexStats{
+		{Name: TransactionIndex, DocumentCount: 20, StorageSize: 2048, OldestBlock: 1, NewestBlock: 150},
+		{Name: EventIndex, DocumentCount: 20, StorageSize: 1024, OldestBlock: 1, NewestBlock: 150},
+		{Name: StorageIndex, DocumentCount: 20, StorageSize: 512, OldestBlock: 1, NewestBlock: 150},
+		{Name: ERC20TokenIndex, DocumentCount: 20, StorageSize: 256, OldestBlock: 1, NewestBlock: 150},
+		{Name: ERC721TokenIndex, DocumentCount: 0, StorageSize: 128},
+		{Name: ERC1155TokenIndex, DocumentCount: 20, StorageSize: 64, OldestBlock: 1, NewestBlock: 150},
+	}, stats)
+}
+
+func TestElasticsearchDB_GetIndexStats_WithError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.IndicesStatsRequest{})).Return(nil, errors.New("test error"))
+
+	db, _ := New(mockedClient)
+	stats, err := db.GetIndexStats()
+
+	assert.EqualError(t, err, "test error", "unexpected error message")
+	assert.Nil(t, stats, "unexpected stats")
+}
+
+func TestElasticsearchDB_Compact(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+
+	var requests []esapi.IndicesForcemergeRequest
+	mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.IndicesForcemergeRequest{})).
+		Do(func(req esapi.IndicesForcemergeRequest) { requests = append(requests, req) }).
+		Return([]byte(`{}`), nil).
+		Times(len(CompactIndexes))
+
+	db, _ := New(mockedClient)
+	err := db.Compact([]string{BlockIndex}, 1)
+	assert.Nil(t, err)
+
+	assert.Len(t, requests, len(CompactIndexes))
+	for i, req := range requests {
+		assert.Equal(t, []string{CompactIndexes[i]}, req.Index)
+		if CompactIndexes[i] == BlockIndex {
+			assert.EqualValues(t, 1, *req.MaxNumSegments)
+			assert.Nil(t, req.OnlyExpungeDeletes)
+		} else {
+			assert.Nil(t, req.MaxNumSegments)
+			assert.True(t, *req.OnlyExpungeDeletes)
+		}
+	}
+}
+
+func TestElasticsearchDB_Compact_WithError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(gomock.Any()).Return(nil, errors.New("test error"))
+
+	db, _ := New(mockedClient)
+	err := db.Compact([]string{MetaIndex}, 1)
+	assert.EqualError(t, err, "index meta can not be compacted")
+
+	// stops at the first index that fails
+	err = db.Compact(nil, 1)
+	assert.EqualError(t, err, "compacting index block failed: test error")
+}
+
+func TestElasticsearchDB_GetGasUsage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	db, _ := New(mockedClient)
+
+	contract := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	query := &types.GasUsageQuery{GroupBy: types.GasUsageByFunction, Contract: &contract, StartBlock: 10, Limit: 5}
+	expectedRequest := esapi.SearchRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(QueryGasUsageTemplate(query)),
+	}
+	result := `{"aggregations": {"result_buckets": {"buckets": [
+		{"key": "0xa9059cbb", "doc_count": 4, "totalGasUsed": {"value": 200000.0}},
+		{"key": "0x095ea7b3", "doc_count": 2, "totalGasUsed": {"value": 90000.0}}
+	]}}}`
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(expectedRequest)).Return([]byte(result), nil)
+
+	usage, err := db.GetGasUsage(query)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.GasUsage{
+		{Key: "0xa9059cbb", Transactions: 4, TotalGasUsed: 200000, AverageGasUsed: 50000},
+		{Key: "0x095ea7b3", Transactions: 2, TotalGasUsed: 90000, AverageGasUsed: 45000},
+	}, usage)
+	body := QueryGasUsageTemplate(query)
+	assert.Contains(t, body, `{ "term": { "contract": "0x1932c48b2bf8102ba33b4a6b545c32236e342f34" } }`)
+	assert.Contains(t, body, `"terms": { "field": "selector", "size": 5, "order": { "totalGasUsed": "desc" } }`)
+
+	// days are keyed by the start of the day in seconds
+	query = &types.GasUsageQuery{GroupBy: types.GasUsageByDay, Limit: 1}
+	expectedRequest.Body = strings.NewReader(QueryGasUsageTemplate(query))
+	result = `{"aggregations": {"result_buckets": {"buckets": [
+		{"key": 1593475200.0, "doc_count": 1, "totalGasUsed": {"value": 21000.0}},
+		{"key": 1593561600.0, "doc_count": 3, "totalGasUsed": {"value": 90000.0}}
+	]}}}`
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(expectedRequest)).Return([]byte(result), nil)
+
+	usage, err = db.GetGasUsage(query)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.GasUsage{{Key: "2020-07-01", Transactions: 3, TotalGasUsed: 90000, AverageGasUsed: 30000}}, usage)
+}
+
+func TestElasticsearchDB_GetNetworkActivity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	db, _ := New(mockedClient)
+
+	expectedRequest := esapi.SearchRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryNetworkActivityTemplate, 100, 400)),
+	}
+	result := `{"hits": {"total": {"value": 4, "relation": "eq"}}, "aggregations": {
+		"gasUsed": {"value": 601000.0},
+		"private": {"doc_count": 1},
+		"accounts": {"value": 2},
+		"contracts": {"doc_count": 3, "distinct": {"value": 1}}
+	}}`
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(expectedRequest)).Return([]byte(result), nil)
+
+	activity, err := db.GetNetworkActivity(100, 400)
+	assert.Nil(t, err)
+	assert.Equal(t, &types.NetworkActivity{
+		From:                100,
+		To:                  400,
+		Transactions:        4,
+		PrivateTransactions: 1,
+		ActiveContracts:     1,
+		ActiveAccounts:      2,
+		GasUsed:             601000,
+	}, activity)
+}
@@ -45,8 +45,7 @@ func NewSearchRequestMatcher(req esapi.SearchRequest) *SearchRequestMatcher {
 func (rm *SearchRequestMatcher) Matches(x interface{}) bool {
 	if val, ok := x.(esapi.SearchRequest); ok {
 		actualBody, _ := ioutil.ReadAll(val.Body)
-		//only ever expect one item here, and to always be populated
-		return val.Index[0] == rm.req.Index[0] &&
+		return assert.ObjectsAreEqualValues(val.Index, rm.req.Index) &&
 			assert.ObjectsAreEqualValues(val.From, rm.req.From) &&
 			assert.ObjectsAreEqualValues(val.Size, rm.req.Size) &&
 			// check contents of "sort" field
@@ -59,6 +58,30 @@ func (rm *SearchRequestMatcher) String() string {
 	return fmt.Sprintf("SearchRequestMatcher{%s/%d/%d/%s/%s}", rm.req.Index, rm.req.From, rm.req.Size, rm.req.Sort, rm.body)
 }
 
+type CountRequestMatcher struct {
+	req  esapi.CountRequest
+	body string
+}
+
+func NewCountRequestMatcher(req esapi.CountRequest) *CountRequestMatcher {
+	body, _ := ioutil.ReadAll(req.Body)
+	return &CountRequestMatcher{req: req, body: string(body)}
+}
+
+func (rm *CountRequestMatcher) Matches(x interface{}) bool {
+	if val, ok := x.(esapi.CountRequest); ok {
+		actualBody, _ := ioutil.ReadAll(val.Body)
+		return val.Index[0] == rm.req.Index[0] &&
+			assert.ObjectsAreEqualValues(val.TerminateAfter, rm.req.TerminateAfter) &&
+			string(actualBody) == rm.body
+	}
+	return false
+}
+
+func (rm *CountRequestMatcher) String() string {
+	return fmt.Sprintf("CountRequestMatcher{%s/%s}", rm.req.Index, rm.body)
+}
+
 type DeleteRequestMatcher struct {
 	req esapi.DeleteRequest
 }
@@ -101,6 +124,29 @@ func (rm *DeleteByQueryRequestMatcher) String() string {
 	return fmt.Sprintf("DeleteByQueryRequestMatcher{%s}", rm.req.Index)
 }
 
+type UpdateByQueryRequestMatcher struct {
+	req esapi.UpdateByQueryRequest
+}
+
+func NewUpdateByQueryRequestMatcher(req esapi.UpdateByQueryRequest) *UpdateByQueryRequestMatcher {
+	return &UpdateByQueryRequestMatcher{req: req}
+}
+
+func (rm *UpdateByQueryRequestMatcher) Matches(x interface{}) bool {
+	if val, ok := x.(esapi.UpdateByQueryRequest); ok {
+		expectedBody, _ := ioutil.ReadAll(rm.req.Body)
+		actualBody, _ := ioutil.ReadAll(val.Body)
+		a := string(expectedBody)
+		b := string(actualBody)
+		return len(rm.req.Index) == len(val.Index) && a == b
+	}
+	return false
+}
+
+func (rm *UpdateByQueryRequestMatcher) String() string {
+	return fmt.Sprintf("UpdateByQueryRequestMatcher{%s}", rm.req.Index)
+}
+
 type UpdateRequestMatcher struct {
 	req esapi.UpdateRequest
 }
@@ -124,6 +170,25 @@ func (rm *UpdateRequestMatcher) String() string {
 	return fmt.Sprintf("UpdateRequestMatcher{%s}", rm.req.Index)
 }
 
+type TasksGetRequestMatcher struct {
+	req esapi.TasksGetRequest
+}
+
+func NewTasksGetRequestMatcher(req esapi.TasksGetRequest) *TasksGetRequestMatcher {
+	return &TasksGetRequestMatcher{req: req}
+}
+
+func (rm *TasksGetRequestMatcher) Matches(x interface{}) bool {
+	if val, ok := x.(esapi.TasksGetRequest); ok {
+		return val.TaskID == rm.req.TaskID
+	}
+	return false
+}
+
+func (rm *TasksGetRequestMatcher) String() string {
+	return fmt.Sprintf("TasksGetRequestMatcher{%s}", rm.req.TaskID)
+}
+
 type GetRequestMatcher struct {
 	req esapi.GetRequest
 }
@@ -160,6 +225,7 @@ func (bim *BulkIndexItemMatcher) Matches(x interface{}) bool {
 	if val, ok := x.(esutil.BulkIndexerItem); ok {
 		valBody, _ := ioutil.ReadAll(val.Body)
 		return val.Index == bim.item.Index &&
+			val.Action == bim.item.Action &&
 			val.DocumentID == bim.item.DocumentID &&
 			string(valBody) == bim.body
 	}
@@ -39,7 +39,10 @@ func (es *ElasticsearchDB) RecordNewERC20Balance(contract types.Address, holder
 		OpType:     "create",
 	}
 
-	if _, err := es.apiClient.DoRequest(req); err != nil {
+	if _, err := es.apiClient.DoRequest(req); err == ErrVersionConflict {
+		// already recorded, when the block is indexed again
+		return nil
+	} else if err != nil {
 		return err
 	}
 
@@ -165,6 +168,193 @@ func (es *ElasticsearchDB) GetAllTokenHolders(contract types.Address, block uint
 	return convertedResults, nil
 }
 
+func (es *ElasticsearchDB) GetERC20TokenHolders(contract types.Address, block uint64, options *types.QueryOptions) ([]*types.ERC20Holding, error) {
+	from := options.PageSize * options.PageNumber
+	if from+options.PageSize > 1000 {
+		return nil, ErrPaginationLimitExceeded
+	}
+
+	// there is one entry per holder that covers the block
+	formattedQuery := fmt.Sprintf(QueryERC20TokenHoldersWithBalanceAtBlock(), contract.String(), block, block)
+	req := esapi.SearchRequest{
+		Index: []string{ERC20TokenIndex},
+		Body:  strings.NewReader(formattedQuery),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"holder.keyword:asc"},
+	}
+	results, err := es.doSearchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	holdings := make([]*types.ERC20Holding, 0, len(results.Hits.Hits))
+	for _, result := range results.Hits.Hits {
+		var entry ERC20TokenHolder
+		if err := mapstructure.Decode(result.Source, &entry); err != nil {
+			return nil, err
+		}
+		balance, success := new(big.Int).SetString(entry.Amount, 10)
+		if !success {
+			return nil, errors.New("could not parse token value")
+		}
+		holdings = append(holdings, &types.ERC20Holding{Holder: types.NewAddress(string(entry.Holder)), Balance: balance})
+	}
+	return holdings, nil
+}
+
+func (es *ElasticsearchDB) RecordERC20Allowance(contract types.Address, owner types.Address, spender types.Address, block uint64, amount *big.Int) error {
+	//find the approval being replaced
+	existing, errExisting := es.getERC20AllowanceAtBlock(contract, owner, spender, block-1)
+	if errExisting != nil && errExisting != database.ErrNotFound {
+		return errExisting
+	}
+
+	allowance := ERC20Allowance{
+		Contract:    contract,
+		Owner:       owner,
+		Spender:     spender,
+		BlockNumber: block,
+		Amount:      amount.String(),
+	}
+	req := esapi.IndexRequest{
+		Index:      ERC20AllowanceIndex,
+		DocumentID: fmt.Sprintf("%s-%s-%s-%d", contract.String(), owner.String(), spender.String(), block),
+		Body:       esutil.NewJSONReader(allowance),
+		Refresh:    "true",
+		OpType:     "create",
+	}
+	if _, err := es.apiClient.DoRequest(req); err == ErrVersionConflict {
+		// already recorded, when the block is indexed again
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if errExisting == database.ErrNotFound {
+		return nil
+	}
+
+	//the replaced approval holds until the block before
+	updateRequest := esapi.UpdateRequest{
+		Index:      ERC20AllowanceIndex,
+		DocumentID: fmt.Sprintf("%s-%s-%s-%d", contract.String(), owner.String(), spender.String(), existing.BlockNumber),
+		Body: esutil.NewJSONReader(map[string]interface{}{
+			"doc": map[string]interface{}{
+				"heldUntil": block - 1,
+			},
+		}),
+		Refresh: "true",
+	}
+	_, err := es.apiClient.DoRequest(updateRequest)
+	return err
+}
+
+func (es *ElasticsearchDB) getERC20AllowanceAtBlock(contract types.Address, owner types.Address, spender types.Address, block uint64) (ERC20Allowance, error) {
+	size := 1
+	req := esapi.SearchRequest{
+		Index: []string{ERC20AllowanceIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryERC20AllowanceAtBlock(), contract.String(), owner.String(), spender.String(), block)),
+		Size:  &size,
+	}
+	results, err := es.doSearchRequest(req)
+	if err == ErrIndexNotFound {
+		// databases created before allowances were recorded have no index
+		// until the first is recorded
+		return ERC20Allowance{}, database.ErrNotFound
+	}
+	if err != nil {
+		return ERC20Allowance{}, err
+	}
+	if len(results.Hits.Hits) == 0 {
+		return ERC20Allowance{}, database.ErrNotFound
+	}
+
+	var allowance ERC20Allowance
+	err = mapstructure.Decode(results.Hits.Hits[0].Source, &allowance)
+	return allowance, err
+}
+
+func (es *ElasticsearchDB) GetERC20Allowance(contract types.Address, owner types.Address, spender types.Address, options *types.TokenQueryOptions) (map[uint64]*big.Int, error) {
+	from := options.PageSize * options.PageNumber
+	if from+options.PageSize > 1000 {
+		return nil, ErrPaginationLimitExceeded
+	}
+	req := esapi.SearchRequest{
+		Index: []string{ERC20AllowanceIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryERC20AllowanceAtBlockRange(options), contract.String(), owner.String(), spender.String())),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"blockNumber:desc"},
+	}
+	results, err := es.doSearchRequest(req)
+	if err == ErrIndexNotFound {
+		return map[uint64]*big.Int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	allowanceMap := make(map[uint64]*big.Int)
+	for _, result := range results.Hits.Hits {
+		blockNumber := uint64(result.Source["blockNumber"].(float64))
+		amount, success := new(big.Int).SetString(result.Source["amount"].(string), 10)
+		if !success {
+			return nil, errors.New("could not parse token value")
+		}
+
+		// the approval before the range is the allowance at its start
+		if blockNumber < options.BeginBlockNumber.Uint64() {
+			allowanceMap[options.BeginBlockNumber.Uint64()] = amount
+		} else {
+			allowanceMap[blockNumber] = amount
+		}
+	}
+	return allowanceMap, nil
+}
+
+func (es *ElasticsearchDB) GetERC20Allowances(contract types.Address, owner types.Address, block uint64, options *types.QueryOptions) ([]*types.ERC20Allowance, error) {
+	from := options.PageSize * options.PageNumber
+	if from+options.PageSize > 1000 {
+		return nil, ErrPaginationLimitExceeded
+	}
+
+	// there is one approval per spender that covers the block
+	req := esapi.SearchRequest{
+		Index: []string{ERC20AllowanceIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryERC20AllowancesAtBlock(), contract.String(), owner.String(), block, block)),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"spender.keyword:asc"},
+	}
+	results, err := es.doSearchRequest(req)
+	if err == ErrIndexNotFound {
+		return []*types.ERC20Allowance{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	allowances := make([]*types.ERC20Allowance, 0, len(results.Hits.Hits))
+	for _, result := range results.Hits.Hits {
+		var entry ERC20Allowance
+		if err := mapstructure.Decode(result.Source, &entry); err != nil {
+			return nil, err
+		}
+		amount, success := new(big.Int).SetString(entry.Amount, 10)
+		if !success {
+			return nil, errors.New("could not parse token value")
+		}
+		allowances = append(allowances, &types.ERC20Allowance{
+			Owner:       types.NewAddress(string(entry.Owner)),
+			Spender:     types.NewAddress(string(entry.Spender)),
+			Amount:      amount,
+			BlockNumber: entry.BlockNumber,
+		})
+	}
+	return allowances, nil
+}
+
 func (es *ElasticsearchDB) RecordERC721Token(contract types.Address, holder types.Address, block uint64, tokenId *big.Int) error {
 	//find old entry
 	existingTokenEntry, errExisting := es.ERC721TokenByTokenID(contract, block-1, tokenId)
@@ -199,7 +389,10 @@ func (es *ElasticsearchDB) RecordERC721Token(contract types.Address, holder type
 		OpType:     "create", //This will only create if the contract does not exist
 	}
 
-	if _, err := es.apiClient.DoRequest(req); err != nil {
+	if _, err := es.apiClient.DoRequest(req); err == ErrVersionConflict {
+		// already recorded, when the block is indexed again
+		return nil
+	} else if err != nil {
 		return err
 	}
 
@@ -255,6 +448,38 @@ func (es *ElasticsearchDB) ERC721TokenByTokenID(contract types.Address, block ui
 	return &tokenResult, nil
 }
 
+func (es *ElasticsearchDB) ERC721TokenHistory(contract types.Address, tokenId *big.Int, options *types.TokenQueryOptions) ([]types.ERC721Token, error) {
+	from := options.PageSize * options.PageNumber
+	if from+options.PageSize > 1000 {
+		return nil, ErrPaginationLimitExceeded
+	}
+
+	searchReq := esapi.SearchRequest{
+		Index: []string{ERC721TokenIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryERC721TokenHistory(options), contract.String(), tokenId.String())),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"heldFrom:asc"},
+	}
+
+	results, err := es.doSearchRequest(searchReq)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]types.ERC721Token, 0, len(results.Hits.Hits))
+	for _, result := range results.Hits.Hits {
+		var tokenResult types.ERC721Token
+		if err := mapstructure.Decode(result.Source, &tokenResult); err != nil {
+			return nil, err
+		}
+		tokenResult.Contract = contract
+		tokenResult.Holder = types.NewAddress(string(tokenResult.Holder))
+		history = append(history, tokenResult)
+	}
+	return history, nil
+}
+
 func (es *ElasticsearchDB) ERC721TokensForAccountAtBlock(contract types.Address, holder types.Address, block uint64, options *types.TokenQueryOptions) ([]types.ERC721Token, error) {
 	startTokenId := big.NewInt(-1)
 	if options.After != "" {
@@ -374,3 +599,156 @@ func (es *ElasticsearchDB) AllHoldersAtBlock(contract types.Address, block uint6
 	}
 	return convertedResults, nil
 }
+
+func (es *ElasticsearchDB) RecordNewERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, block uint64, amount *big.Int) error {
+	//find old entry
+	existingTokenEntry, errExisting := es.GetERC1155EntryAtBlock(contract, holder, tokenId, block-1)
+	if errExisting != nil && errExisting != database.ErrNotFound {
+		return errExisting
+	}
+
+	//add new entry
+	tokenInfo := ERC1155TokenHolder{
+		Contract:    contract,
+		Holder:      holder,
+		TokenId:     tokenId.String(),
+		BlockNumber: block,
+		Amount:      amount.String(),
+	}
+
+	req := esapi.IndexRequest{
+		Index:      ERC1155TokenIndex,
+		DocumentID: fmt.Sprintf("%s-%s-%s-%d", contract.String(), holder.String(), tokenId.String(), block),
+		Body:       esutil.NewJSONReader(tokenInfo),
+		Refresh:    "true",
+		OpType:     "create",
+	}
+
+	if _, err := es.apiClient.DoRequest(req); err == ErrVersionConflict {
+		// already recorded, when the block is indexed again
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	/////
+
+	if errExisting == database.ErrNotFound {
+		return nil
+	}
+
+	//update the older entry
+	query := map[string]interface{}{
+		"doc": map[string]interface{}{
+			"heldUntil": block - 1,
+		},
+	}
+
+	updateRequest := esapi.UpdateRequest{
+		Index:      ERC1155TokenIndex,
+		DocumentID: fmt.Sprintf("%s-%s-%s-%d", contract.String(), holder.String(), tokenId.String(), existingTokenEntry.BlockNumber),
+		Body:       esutil.NewJSONReader(query),
+		Refresh:    "true",
+	}
+
+	_, err := es.apiClient.DoRequest(updateRequest)
+	return err
+}
+
+func (es *ElasticsearchDB) GetERC1155EntryAtBlock(contract types.Address, holder types.Address, tokenId *big.Int, block uint64) (ERC1155TokenHolder, error) {
+	queryString := fmt.Sprintf(QueryERC1155TokenBalanceAtBlock(), contract.String(), holder.String(), tokenId.String(), block)
+
+	size := 1
+	req := esapi.SearchRequest{
+		Index: []string{ERC1155TokenIndex},
+		Body:  strings.NewReader(queryString),
+		Size:  &size,
+	}
+	results, err := es.doSearchRequest(req)
+	if err != nil {
+		return ERC1155TokenHolder{}, err
+	}
+
+	if len(results.Hits.Hits) == 0 {
+		return ERC1155TokenHolder{}, database.ErrNotFound
+	}
+
+	var tokenResult ERC1155TokenHolder
+	err = mapstructure.Decode(results.Hits.Hits[0].Source, &tokenResult)
+	return tokenResult, err
+}
+
+func (es *ElasticsearchDB) GetERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, options *types.TokenQueryOptions) (map[uint64]*big.Int, error) {
+	queryString := fmt.Sprintf(QueryERC1155TokenBalanceAtBlockRange(options), contract.String(), holder.String(), tokenId.String())
+
+	from := options.PageSize * options.PageNumber
+	if from+options.PageSize > 1000 {
+		return nil, ErrPaginationLimitExceeded
+	}
+	req := esapi.SearchRequest{
+		Index: []string{ERC1155TokenIndex},
+		Body:  strings.NewReader(queryString),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"blockNumber:desc"},
+	}
+	results, err := es.doSearchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	balanceMap := make(map[uint64]*big.Int)
+	for _, result := range results.Hits.Hits {
+		blockNumber := uint64(result.Source["blockNumber"].(float64))
+		tokenAmount, success := new(big.Int).SetString(result.Source["amount"].(string), 10)
+		if !success {
+			return nil, errors.New("could not parse token value")
+		}
+
+		if blockNumber < options.BeginBlockNumber.Uint64() {
+			balanceMap[options.BeginBlockNumber.Uint64()] = tokenAmount
+		} else {
+			balanceMap[blockNumber] = tokenAmount
+		}
+	}
+
+	return balanceMap, nil
+}
+
+func (es *ElasticsearchDB) GetAllERC1155TokenHolders(contract types.Address, tokenId *big.Int, block uint64, options *types.TokenQueryOptions) ([]types.Address, error) {
+	if options.PageSize > 1000 {
+		return nil, ErrPaginationLimitExceeded
+	}
+
+	afterQuery := ""
+	if options.After != "" {
+		afterQuery = fmt.Sprintf(`"after": { "holder": "%s"},`, options.After)
+	}
+
+	formattedQuery := fmt.Sprintf(QueryERC1155TokenHoldersAtBlock(), contract.String(), tokenId.String(), block, block, options.PageSize, afterQuery)
+
+	searchReq := esapi.SearchRequest{
+		Index: []string{ERC1155TokenIndex},
+		Body:  strings.NewReader(formattedQuery),
+	}
+
+	results, err := es.doSearchRequest(searchReq)
+	if err != nil {
+		return nil, err
+	}
+
+	var aggResult ERC721HolderAggregateResult
+	rawAggResult := results.Aggregations.Results
+	if err := mapstructure.Decode(rawAggResult, &aggResult); err != nil {
+		return nil, err
+	}
+
+	convertedResults := make([]types.Address, 0, len(aggResult.Buckets))
+	for _, result := range aggResult.Buckets {
+		holder := types.NewAddress(result.Key.Holder)
+		if holder != "0000000000000000000000000000000000000000" {
+			convertedResults = append(convertedResults, holder)
+		}
+	}
+	return convertedResults, nil
+}
@@ -0,0 +1,63 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// TokenRuleDB
+
+func (es *ElasticsearchDB) AddTokenRule(rule *types.TokenRule) error {
+	req := esapi.IndexRequest{
+		Index:      TokenRuleIndex,
+		DocumentID: rule.ID,
+		Body:       esutil.NewJSONReader(rule),
+		Refresh:    "true",
+	}
+	_, err := es.apiClient.DoRequest(req)
+	return err
+}
+
+func (es *ElasticsearchDB) DeleteTokenRule(id string) error {
+	req := esapi.DeleteRequest{
+		Index:      TokenRuleIndex,
+		DocumentID: id,
+		Refresh:    "true",
+	}
+	_, err := es.apiClient.DoRequest(req)
+	return err
+}
+
+func (es *ElasticsearchDB) GetTokenRules() ([]*types.TokenRule, error) {
+	size := maxTokenRules
+	req := esapi.SearchRequest{
+		Index: []string{TokenRuleIndex},
+		Body:  strings.NewReader(QueryAllTokenRulesTemplate),
+		Size:  &size,
+		Sort:  []string{"createdAt:asc"},
+	}
+	results, err := es.doSearchRequest(req)
+	if err == ErrIndexNotFound {
+		// databases created before token rules were added have no index
+		// until the first rule is added
+		return []*types.TokenRule{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]*types.TokenRule, 0, len(results.Hits.Hits))
+	for _, result := range results.Hits.Hits {
+		marshalled, _ := json.Marshal(result.Source)
+		var rule types.TokenRule
+		if err := json.Unmarshal(marshalled, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+	return rules, nil
+}
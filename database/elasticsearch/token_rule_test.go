@@ -0,0 +1,105 @@
+package elasticsearch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database"
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestElasticsearchDB_AddTokenRule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	rule := &types.TokenRule{ID: "abc", Scope: types.ExternalScope, TemplateName: "ERC20", EIP165: "36372b07", CreatedAt: 100}
+	ex := esapi.IndexRequest{
+		Index:      TokenRuleIndex,
+		DocumentID: "abc",
+		Body:       esutil.NewJSONReader(rule),
+		Refresh:    "true",
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewIndexRequestMatcher(ex))
+
+	db, _ := New(mockedClient)
+
+	err := db.AddTokenRule(rule)
+	assert.Nil(t, err)
+}
+
+func TestElasticsearchDB_DeleteTokenRule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	ex := esapi.DeleteRequest{
+		Index:      TokenRuleIndex,
+		DocumentID: "abc",
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewDeleteRequestMatcher(ex)).Return(nil, database.ErrNotFound)
+
+	db, _ := New(mockedClient)
+
+	err := db.DeleteTokenRule("abc")
+	assert.Equal(t, database.ErrNotFound, err)
+}
+
+func TestElasticsearchDB_GetTokenRules(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	size := maxTokenRules
+	ex := esapi.SearchRequest{
+		Index: []string{TokenRuleIndex},
+		Body:  strings.NewReader(QueryAllTokenRulesTemplate),
+		Size:  &size,
+	}
+	result := `{"hits":{"hits":[{"_id":"abc","_source":{"id":"abc","scope":"all","deployer":"0x8a5e2a6343108babed07899510fb42297938d41f","templateName":"ERC721","eip165":"80ac58cd","createdAt":100}}]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(ex)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+
+	rules, err := db.GetTokenRules()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.TokenRule{{
+		ID:           "abc",
+		Scope:        types.AllScope,
+		Deployer:     types.NewAddress("0x8a5e2a6343108babed07899510fb42297938d41f"),
+		TemplateName: "ERC721",
+		EIP165:       "80ac58cd",
+		CreatedAt:    100,
+	}}, rules)
+}
+
+func TestElasticsearchDB_GetTokenRules_NoIndex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return(nil, ErrIndexNotFound)
+
+	db, _ := New(mockedClient)
+
+	rules, err := db.GetTokenRules()
+	assert.Nil(t, err)
+	assert.Empty(t, rules)
+}
@@ -1,6 +1,7 @@
 package elasticsearch
 
 import (
+	"fmt"
 	"math/big"
 	"strings"
 	"testing"
@@ -77,6 +78,68 @@ func TestElasticsearchDB_RecordNewERC20Balance_NoPrevious(t *testing.T) {
 	assert.Nil(t, err, "expected error to be nil")
 }
 
+func TestElasticsearchDB_RecordNewERC20Balance_AlreadyRecorded(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	tokenContractAddress := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	holderAddress := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	blockNumber := uint64(10)
+	balance := big.NewInt(1989)
+
+	token := ERC20TokenHolder{
+		Contract:    tokenContractAddress,
+		Holder:      holderAddress,
+		BlockNumber: blockNumber,
+		Amount:      balance.String(),
+	}
+	ex := esapi.IndexRequest{
+		Index:      ERC20TokenIndex,
+		DocumentID: "0x1932c48b2bf8102ba33b4a6b545c32236e342f34-0x1349f3e1b8d71effb47b840594ff27da7e603d17-10",
+		Body:       esutil.NewJSONReader(token),
+	}
+
+	searchQuery := `
+{
+	"query": {
+		"bool": {
+			"must": [
+				{ "match": { "contract": "0x1932c48b2bf8102ba33b4a6b545c32236e342f34"} },
+				{ "match": { "holder": "0x1349f3e1b8d71effb47b840594ff27da7e603d17" } },
+				{ "range": { "blockNumber": { "lte": 9 } } }
+			]
+		}
+	},
+	"sort": [
+			{
+				"blockNumber": {
+					"order": "desc",
+					"unmapped_type": "long"
+				}
+			}
+	]
+}
+`
+	size := 1
+	req := esapi.SearchRequest{
+		Index: []string{ERC20TokenIndex},
+		Body:  strings.NewReader(searchQuery),
+		Size:  &size,
+	}
+	searchResult := `{"hits": {"hits": []}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(req)).Return([]byte(searchResult), nil)
+	// the balance was recorded when the block was first filtered
+	mockedClient.EXPECT().DoRequest(NewIndexRequestMatcher(ex)).Return(nil, ErrVersionConflict)
+
+	db, _ := New(mockedClient)
+	err := db.RecordNewERC20Balance(tokenContractAddress, holderAddress, blockNumber, balance)
+	assert.Nil(t, err, "expected error to be nil")
+}
+
 func TestElasticsearchDB_RecordNewERC20Balance_WithPrevious(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -399,6 +462,134 @@ func TestElasticsearchDB_GetERC20Balance_ResultBeforeBeginBlock(t *testing.T) {
 	assert.EqualValues(t, 500, results[1].Int64())
 }
 
+func TestElasticsearchDB_GetERC20TokenHolders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	tokenContractAddress := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	options := &types.QueryOptions{PageSize: 5, PageNumber: 1}
+
+	expectedQuery := fmt.Sprintf(QueryERC20TokenHoldersWithBalanceAtBlock(), tokenContractAddress.String(), 10, 10)
+
+	from := 5
+	size := 5
+	req := esapi.SearchRequest{
+		Index: []string{ERC20TokenIndex},
+		Body:  strings.NewReader(expectedQuery),
+		From:  &from,
+		Size:  &size,
+		Sort:  []string{"holder.keyword:asc"},
+	}
+
+	result := `{"hits": {"hits": [
+  {"_source": {"holder": "0x1349f3e1b8d71effb47b840594ff27da7e603d17", "blockNumber": 1, "amount": "500"}},
+  {"_source": {"holder": "0xed9d02e382b34818e88b88a309c7fe71e65f419d", "blockNumber": 8, "amount": "2000"}}
+]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(req)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+	results, err := db.GetERC20TokenHolders(tokenContractAddress, 10, options)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.ERC20Holding{
+		{Holder: types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17"), Balance: big.NewInt(500)},
+		{Holder: types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d"), Balance: big.NewInt(2000)},
+	}, results)
+}
+
+func TestElasticsearchDB_RecordERC20Allowance_WithPrevious(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	tokenContractAddress := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	owner := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	spender := types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d")
+
+	size := 1
+	searchReq := esapi.SearchRequest{
+		Index: []string{ERC20AllowanceIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryERC20AllowanceAtBlock(), tokenContractAddress.String(), owner.String(), spender.String(), 9)),
+		Size:  &size,
+	}
+	searchResult := `{"hits": {"hits": [{"_source": {"owner": "0x1349f3e1b8d71effb47b840594ff27da7e603d17", "spender": "0xed9d02e382b34818e88b88a309c7fe71e65f419d", "blockNumber": 7, "amount": "100"}}]}}`
+	indexReq := esapi.IndexRequest{
+		Index:      ERC20AllowanceIndex,
+		DocumentID: "0x1932c48b2bf8102ba33b4a6b545c32236e342f34-0x1349f3e1b8d71effb47b840594ff27da7e603d17-0xed9d02e382b34818e88b88a309c7fe71e65f419d-10",
+		Body: esutil.NewJSONReader(ERC20Allowance{
+			Contract:    tokenContractAddress,
+			Owner:       owner,
+			Spender:     spender,
+			BlockNumber: 10,
+			Amount:      "0",
+		}),
+	}
+	updateReq := esapi.UpdateRequest{
+		Index:      ERC20AllowanceIndex,
+		DocumentID: "0x1932c48b2bf8102ba33b4a6b545c32236e342f34-0x1349f3e1b8d71effb47b840594ff27da7e603d17-0xed9d02e382b34818e88b88a309c7fe71e65f419d-7",
+		Body: strings.NewReader(`{"doc":{"heldUntil":9}}
+`),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(searchReq)).Return([]byte(searchResult), nil),
+		mockedClient.EXPECT().DoRequest(NewIndexRequestMatcher(indexReq)).Do(func(input esapi.IndexRequest) {
+			assert.Equal(t, "create", input.OpType)
+		}),
+		mockedClient.EXPECT().DoRequest(NewUpdateRequestMatcher(updateReq)).Return(nil, nil),
+	)
+
+	db, _ := New(mockedClient)
+	err := db.RecordERC20Allowance(tokenContractAddress, owner, spender, 10, big.NewInt(0))
+	assert.Nil(t, err)
+}
+
+func TestElasticsearchDB_GetERC20Allowances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	tokenContractAddress := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	owner := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	spender := types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d")
+	options := &types.QueryOptions{PageSize: 5, PageNumber: 0}
+
+	from := 0
+	size := 5
+	req := func() esapi.SearchRequest {
+		return esapi.SearchRequest{
+			Index: []string{ERC20AllowanceIndex},
+			Body:  strings.NewReader(fmt.Sprintf(QueryERC20AllowancesAtBlock(), tokenContractAddress.String(), owner.String(), 10, 10)),
+			From:  &from,
+			Size:  &size,
+			Sort:  []string{"spender.keyword:asc"},
+		}
+	}
+	result := `{"hits": {"hits": [
+  {"_source": {"owner": "0x1349f3e1b8d71effb47b840594ff27da7e603d17", "spender": "0xed9d02e382b34818e88b88a309c7fe71e65f419d", "blockNumber": 8, "amount": "2000"}}
+]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	gomock.InOrder(
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(req())).Return([]byte(result), nil),
+		// databases created before allowances were recorded have no index
+		mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(req())).Return(nil, ErrIndexNotFound),
+	)
+
+	db, _ := New(mockedClient)
+	results, err := db.GetERC20Allowances(tokenContractAddress, owner, 10, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.ERC20Allowance{{Owner: owner, Spender: spender, Amount: big.NewInt(2000), BlockNumber: 8}}, results)
+
+	results, err = db.GetERC20Allowances(tokenContractAddress, owner, 10, options)
+	assert.Nil(t, err)
+	assert.Empty(t, results)
+}
+
 func TestElasticsearchDB_ERC721TokenByTokenID_NotFound(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -505,3 +696,147 @@ func TestElasticsearchDB_ERC721TokenByTokenID(t *testing.T) {
 	assert.Nil(t, err)
 	assert.EqualValues(t, expected, *result)
 }
+
+func TestElasticsearchDB_ERC721TokenHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	tokenContractAddress := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	holder0 := types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d")
+	holder1 := types.NewAddress("0xca843569e3427144cead5e4d5999a3d0ccf92b8e")
+
+	expectedQuery := `
+{
+	"query": {
+		"bool": {
+			"must": [
+				{ "match": { "contract": "0x1932c48b2bf8102ba33b4a6b545c32236e342f34"} },
+				{ "match": { "token": "2000"} },
+				{ "range": { "heldFrom": { "gte": 0 } } }
+			],
+			"filter": [{
+				"bool": {
+					"should": [
+						{ "range": { "heldUntil": { "gte": 5 } } },
+						{ "bool": { "must_not": { "exists": { "field": "heldUntil" } } } }
+					]
+				}
+			}]
+		}
+	}
+}
+`
+	from, size := 0, 10
+	req := esapi.SearchRequest{
+		Index: []string{ERC721TokenIndex},
+		Body:  strings.NewReader(expectedQuery),
+		From:  &from,
+		Size:  &size,
+		Sort:  []string{"heldFrom:asc"},
+	}
+
+	resultJson := `{"hits": {"hits": [
+{"_source": {"contract": "0x1932c48b2bf8102ba33b4a6b545c32236e342f34", "holder": "0xed9d02e382b34818e88b88a309c7fe71e65f419d", "token": "2000", "heldFrom": 1, "heldUntil": 6}},
+{"_source": {"contract": "0x1932c48b2bf8102ba33b4a6b545c32236e342f34", "holder": "0xca843569e3427144cead5e4d5999a3d0ccf92b8e", "token": "2000", "heldFrom": 7}}
+]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(req)).Return([]byte(resultJson), nil)
+
+	db, _ := New(mockedClient)
+	options := &types.TokenQueryOptions{BeginBlockNumber: big.NewInt(5)}
+	options.SetDefaults()
+	history, err := db.ERC721TokenHistory(tokenContractAddress, big.NewInt(2000), options)
+
+	heldUntil := uint64(6)
+	expected := []types.ERC721Token{
+		{Contract: tokenContractAddress, Holder: holder0, Token: "2000", HeldFrom: 1, HeldUntil: &heldUntil},
+		{Contract: tokenContractAddress, Holder: holder1, Token: "2000", HeldFrom: 7},
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, expected, history)
+}
+
+func TestElasticsearchDB_RecordNewERC1155Balance_WithPrevious(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	tokenContractAddress := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	holderAddress := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	tokenId := big.NewInt(42)
+	blockNumber := uint64(10)
+	balance := big.NewInt(1989)
+
+	token := ERC1155TokenHolder{
+		Contract:    tokenContractAddress,
+		Holder:      holderAddress,
+		TokenId:     "42",
+		BlockNumber: blockNumber,
+		Amount:      balance.String(),
+	}
+	ex := esapi.IndexRequest{
+		Index:      ERC1155TokenIndex,
+		DocumentID: "0x1932c48b2bf8102ba33b4a6b545c32236e342f34-0x1349f3e1b8d71effb47b840594ff27da7e603d17-42-10",
+		Body:       esutil.NewJSONReader(token),
+	}
+
+	searchQuery := `
+{
+	"query": {
+		"bool": {
+			"must": [
+				{ "match": { "contract": "0x1932c48b2bf8102ba33b4a6b545c32236e342f34"} },
+				{ "match": { "holder": "0x1349f3e1b8d71effb47b840594ff27da7e603d17" } },
+				{ "match": { "tokenId": "42" } },
+				{ "range": { "blockNumber": { "lte": 9 } } }
+			]
+		}
+	},
+	"sort": [
+			{
+				"blockNumber": {
+					"order": "desc",
+					"unmapped_type": "long"
+				}
+			}
+	]
+}
+`
+	size := 1
+	req := esapi.SearchRequest{
+		Index: []string{ERC1155TokenIndex},
+		Body:  strings.NewReader(searchQuery),
+		Size:  &size,
+	}
+	searchResult := `{"hits": {"hits": [
+{"_source": {
+		"contract": "0x1932c48b2bf8102ba33b4a6b545c32236e342f34",
+		"holder": "0x1349f3e1b8d71effb47b840594ff27da7e603d17",
+		"tokenId": "42",
+		"amount": "500",
+		"blockNumber": 7
+	}
+}
+]}}`
+
+	oldTokenUpdateReq := esapi.UpdateRequest{
+		Index:      ERC1155TokenIndex,
+		DocumentID: "0x1932c48b2bf8102ba33b4a6b545c32236e342f34-0x1349f3e1b8d71effb47b840594ff27da7e603d17-42-7",
+		Body: strings.NewReader(`{"doc":{"heldUntil":9}}
+`),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(req)).Return([]byte(searchResult), nil)
+	mockedClient.EXPECT().DoRequest(NewIndexRequestMatcher(ex)).Do(func(input esapi.IndexRequest) {
+		assert.Equal(t, "create", input.OpType)
+	})
+	mockedClient.EXPECT().DoRequest(NewUpdateRequestMatcher(oldTokenUpdateReq)).Return(nil, nil)
+
+	db, _ := New(mockedClient)
+	err := db.RecordNewERC1155Balance(tokenContractAddress, holderAddress, tokenId, blockNumber, balance)
+	assert.Nil(t, err, "expected error to be nil")
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/elastic/go-elasticsearch/v7/esapi"
@@ -40,6 +41,12 @@ var testTransaction = types.Transaction{
 	InternalCalls:     nil,
 }
 
+// transactionDocument is the document a transaction is written as
+func transactionDocument(transaction *types.Transaction) *Transaction {
+	document, _ := newTransactionDocument(transaction)
+	return document
+}
+
 func TestElasticsearchDB_WriteSingleTransaction(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -49,7 +56,7 @@ func TestElasticsearchDB_WriteSingleTransaction(t *testing.T) {
 	req := esapi.IndexRequest{
 		Index:      TransactionIndex,
 		DocumentID: testTransaction.Hash.String(),
-		Body:       esutil.NewJSONReader(&testTransaction),
+		Body:       esutil.NewJSONReader(transactionDocument(&testTransaction)),
 		Refresh:    "true",
 	}
 
@@ -69,9 +76,9 @@ func TestElasticsearchDB_WriteTransactions_WithError(t *testing.T) {
 	mockedBulkIndexer := elasticsearch_mocks.NewMockBulkIndexer(ctrl)
 
 	req := esutil.BulkIndexerItem{
-		Action:     "create",
+		Action:     "index",
 		DocumentID: testTransaction.Hash.String(),
-		Body:       esutil.NewJSONReader(&testTransaction),
+		Body:       esutil.NewJSONReader(transactionDocument(&testTransaction)),
 	}
 	reqMatcher := NewBulkIndexerItemMatcher(req)
 
@@ -91,6 +98,45 @@ func TestElasticsearchDB_WriteTransactions_WithError(t *testing.T) {
 	assert.EqualError(t, err, "test error")
 }
 
+func TestElasticsearchDB_WriteTransactions_ItemRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+	mockedBulkIndexer := elasticsearch_mocks.NewMockBulkIndexer(ctrl)
+
+	req := esutil.BulkIndexerItem{
+		Action:     "index",
+		DocumentID: testTransaction.Hash.String(),
+		Body:       esutil.NewJSONReader(transactionDocument(&testTransaction)),
+	}
+	reqMatcher := NewBulkIndexerItemMatcher(req)
+
+	// existing documents are replaced, so only a rejected one is an error
+	rejected := esutil.BulkIndexerResponseItem{Status: 400}
+	rejected.Error.Type = "mapper_parsing_exception"
+	rejected.Error.Reason = "failed to parse"
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().GetBulkHandler(TransactionIndex).Return(mockedBulkIndexer)
+	mockedBulkIndexer.EXPECT().Add(gomock.Any(), reqMatcher).
+		Do(func(ctx context.Context, item esutil.BulkIndexerItem) {
+			item.OnSuccess(context.Background(), req, esutil.BulkIndexerResponseItem{Status: 200})
+		})
+	mockedBulkIndexer.EXPECT().Add(gomock.Any(), reqMatcher).
+		Do(func(ctx context.Context, item esutil.BulkIndexerItem) {
+			item.OnFailure(context.Background(), req, rejected, nil)
+		})
+
+	db, _ := New(mockedClient)
+	err := db.WriteTransactions([]*types.Transaction{&testTransaction, &testTransaction})
+	assert.EqualError(t, err, "[400] mapper_parsing_exception: failed to parse (transaction/"+testTransaction.Hash.String()+")")
+
+	bulkErr, ok := err.(*BulkError)
+	assert.True(t, ok)
+	assert.Len(t, bulkErr.Failures, 1)
+}
+
 func TestElasticsearchDB_WriteTransactions(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -99,9 +145,9 @@ func TestElasticsearchDB_WriteTransactions(t *testing.T) {
 	mockedBulkIndexer := elasticsearch_mocks.NewMockBulkIndexer(ctrl)
 
 	req := esutil.BulkIndexerItem{
-		Action:     "create",
+		Action:     "index",
 		DocumentID: testTransaction.Hash.String(),
-		Body:       esutil.NewJSONReader(&testTransaction),
+		Body:       esutil.NewJSONReader(transactionDocument(&testTransaction)),
 	}
 	reqMatcher := NewBulkIndexerItemMatcher(req)
 
@@ -121,6 +167,65 @@ func TestElasticsearchDB_WriteTransactions(t *testing.T) {
 	assert.Nil(t, err, "unexpected error")
 }
 
+func TestElasticsearchDB_WriteTransactions_CallTree(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+	mockedBulkIndexer := elasticsearch_mocks.NewMockBulkIndexer(ctrl)
+
+	withCalls := testTransaction
+	withCalls.CallTree = []*types.CallFrame{{InternalCall: types.InternalCall{To: withCalls.To, Type: "CALL"}, Calls: []*types.CallFrame{}}}
+	txReq := esapi.IndexRequest{
+		Index:      TransactionIndex,
+		DocumentID: testTransaction.Hash.String(),
+		Body:       esutil.NewJSONReader(transactionDocument(&withCalls)),
+		Refresh:    "true",
+	}
+	// the tree isn't part of the transaction document
+	treeReq := esutil.BulkIndexerItem{
+		Action:     "index",
+		DocumentID: testTransaction.Hash.String(),
+		Body:       esutil.NewJSONReader(&types.CallTree{TransactionHash: withCalls.Hash, BlockNumber: 1, Calls: withCalls.CallTree}),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewIndexRequestMatcher(txReq)).Return(nil, nil)
+	mockedClient.EXPECT().GetBulkHandler(CallTreeIndex).Return(mockedBulkIndexer)
+	mockedBulkIndexer.EXPECT().Add(gomock.Any(), NewBulkIndexerItemMatcher(treeReq)).
+		Do(func(ctx context.Context, item esutil.BulkIndexerItem) {
+			item.OnSuccess(context.Background(), treeReq, esutil.BulkIndexerResponseItem{})
+		})
+
+	db, _ := New(mockedClient)
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{&withCalls}))
+}
+
+func TestElasticsearchDB_GetTransactionCallTree(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+
+	req := esapi.GetRequest{
+		Index:      CallTreeIndex,
+		DocumentID: testTransaction.Hash.String(),
+	}
+	body := `{"_source": {"transactionHash": "0xf4f803b8d6c6b38e0b15d6cfe80fd1dcea4270ad24e93385fca36512bb9c2c59", "blockNumber": 1, "calls": [{"to": "0xcc11df45aba0a4ff198b18300d0b148ad2468834", "type": "CALL", "calls": [{"to": "0x67bb49f7bd40b6a1226d77dc07fb38f03680c94f", "type": "CREATE", "calls": []}]}]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewGetRequestMatcher(req)).Return([]byte(body), nil)
+
+	db, _ := New(mockedClient)
+	tree, err := db.GetTransactionCallTree(testTransaction.Hash)
+	assert.Nil(t, err)
+	assert.Equal(t, testTransaction.Hash, tree.TransactionHash)
+	assert.Len(t, tree.Calls, 1)
+	assert.Equal(t, testTransaction.To, tree.Calls[0].To)
+	assert.Len(t, tree.Calls[0].Calls, 1)
+	assert.Equal(t, "CREATE", tree.Calls[0].Calls[0].Type)
+}
+
 func TestElasticsearchDB_ReadTransaction_WithError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -190,3 +295,65 @@ func TestElasticsearchDB_ReadTransaction(t *testing.T) {
 	assert.Nil(t, err, "unexpected error")
 	assert.Equal(t, tx, &testTransaction, "unexpected transaction returned")
 }
+
+func TestElasticsearchDB_GetTransactionsInBlockRange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+
+	options := &types.PageOptions{PageSize: 10, PageNumber: 2}
+	from := 20
+	req := esapi.SearchRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryTransactionsInBlockRangeTemplate, 1, 100)),
+		From:  &from,
+		Size:  &options.PageSize,
+		Sort:  []string{"blockNumber:asc", "index:asc"},
+	}
+	source, _ := json.Marshal(&testTransaction)
+	result := fmt.Sprintf(`{"hits":{"hits":[{"_source":%s}]}}`, source)
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(req)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+	txs, err := db.GetTransactionsInBlockRange(1, 100, options)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Transaction{&testTransaction}, txs)
+}
+
+func TestElasticsearchDB_GetTransactionsInBlockRange_PaginationLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+
+	db, _ := New(mockedClient)
+	_, err := db.GetTransactionsInBlockRange(1, 100, &types.PageOptions{PageSize: 100, PageNumber: 100})
+
+	assert.Equal(t, ErrPaginationLimitExceeded, err)
+}
+
+func TestElasticsearchDB_GetTransactionsInBlockRangeTotal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearch_mocks.NewMockAPIClient(ctrl)
+
+	req := esapi.CountRequest{
+		Index: []string{TransactionIndex},
+		Body:  strings.NewReader(fmt.Sprintf(QueryTransactionsInBlockRangeTemplate, 1, 100)),
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewCountRequestMatcher(req)).Return([]byte(`{"count": 42}`), nil)
+
+	db, _ := New(mockedClient)
+	total, err := db.GetTransactionsInBlockRangeTotal(1, 100)
+
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(42), total)
+}
@@ -1,6 +1,8 @@
 package elasticsearch
 
 import (
+	"encoding/json"
+
 	"quorumengineering/quorum-report/types"
 )
 
@@ -9,6 +11,17 @@ type Contract struct {
 	TemplateName        string        `json:"templateName"`
 	CreationTransaction types.Hash    `json:"creationTx"`
 	LastFiltered        uint64        `json:"lastFiltered"`
+	// JSON encoded types.EnrichmentMapping, so that updates replace it
+	// instead of merging with it
+	Enrichment string `json:"enrichment,omitempty"`
+	// JSON encoded types.SeverityRules, for the same reason
+	SeverityRules string `json:"severityRules,omitempty"`
+	// the block after which no more data is expected, 0 if there is none
+	TerminalBlock uint64 `json:"terminalBlock,omitempty"`
+	// the block the contract self-destructed at, 0 if it hasn't
+	DestroyedAt uint64 `json:"destroyedAt,omitempty"`
+	// set while the contract's data is being deleted
+	Deleting bool `json:"deleting,omitempty"`
 }
 
 type Template struct {
@@ -22,6 +35,9 @@ type Storage struct {
 	BlockNumber uint64         `json:"blockNumber"`
 	StorageRoot types.Hash     `json:"storageRoot"`
 	StorageMap  []StorageEntry `json:"storageMap"`
+	// DecodedStorage is the storage decoded with the storage layout of the
+	// contract when indexed, absent if it had none
+	DecodedStorage []*types.StorageValue `json:"decodedStorage,omitempty"`
 }
 
 type StorageEntry struct {
@@ -37,6 +53,24 @@ type ERC20TokenHolder struct {
 	HeldUntil   *uint64       `json:"heldUntil"`
 }
 
+type ERC20Allowance struct {
+	Contract    types.Address `json:"contract"`
+	Owner       types.Address `json:"owner"`
+	Spender     types.Address `json:"spender"`
+	BlockNumber uint64        `json:"blockNumber"`
+	Amount      string        `json:"amount"`
+	HeldUntil   *uint64       `json:"heldUntil"`
+}
+
+type ERC1155TokenHolder struct {
+	Contract    types.Address `json:"contract"`
+	Holder      types.Address `json:"holder"`
+	TokenId     string        `json:"tokenId"`
+	BlockNumber uint64        `json:"blockNumber"`
+	Amount      string        `json:"amount"`
+	HeldUntil   *uint64       `json:"heldUntil"`
+}
+
 type SortableERC721Token struct {
 	types.ERC721Token
 
@@ -62,6 +96,10 @@ type TransactionQueryResult struct {
 	Source *types.Transaction `json:"_source"`
 }
 
+type CallTreeQueryResult struct {
+	Source *types.CallTree `json:"_source"`
+}
+
 type BlockQueryResult struct {
 	Source *types.Block `json:"_source"`
 }
@@ -80,6 +118,34 @@ type LastPersistedResult struct {
 	} `json:"_source"`
 }
 
+type CheckpointResult struct {
+	Source struct {
+		Checkpoint string `json:"checkpoint"`
+	} `json:"_source"`
+}
+
+type LeaseResult struct {
+	SeqNo       int         `json:"_seq_no"`
+	PrimaryTerm int         `json:"_primary_term"`
+	Source      types.Lease `json:"_source"`
+}
+
+type SchemaVersionResult struct {
+	Source struct {
+		SchemaVersion int `json:"schemaVersion"`
+	} `json:"_source"`
+}
+
+type CatAliasResult struct {
+	Alias string `json:"alias"`
+	Index string `json:"index"`
+}
+
+type ReindexResult struct {
+	Total    uint64            `json:"total"`
+	Failures []json.RawMessage `json:"failures"`
+}
+
 type SearchQueryResult struct {
 	Hits struct {
 		Hits []IndividualResult `json:"hits"`
@@ -89,15 +155,80 @@ type SearchQueryResult struct {
 	} `json:"aggregations"`
 }
 
+// ScrollQueryResult is a page of a scroll, with the ID to fetch the next page
+// with
+type ScrollQueryResult struct {
+	ScrollID string `json:"_scroll_id"`
+	Hits     struct {
+		Hits []struct {
+			ID     string          `json:"_id"`
+			Source json.RawMessage `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// BulkResult is the outcome of a bulk request, with an item for each action
+// keyed by the action
+type BulkResult struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string          `json:"_id"`
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
 type CountQueryResult struct {
 	Count uint64 `json:"count"`
 }
 
+type BlockRangeQueryResult struct {
+	Hits struct {
+		Total struct {
+			Value uint64 `json:"value"`
+		} `json:"total"`
+	} `json:"hits"`
+	Aggregations struct {
+		Oldest struct {
+			Value *float64 `json:"value"`
+		} `json:"oldest"`
+		Newest struct {
+			Value *float64 `json:"value"`
+		} `json:"newest"`
+	} `json:"aggregations"`
+}
+
+type IndicesStatsResult struct {
+	Indices map[string]struct {
+		Total struct {
+			Store struct {
+				SizeInBytes uint64 `json:"size_in_bytes"`
+			} `json:"store"`
+		} `json:"total"`
+	} `json:"indices"`
+}
+
 type IndividualResult struct {
 	Id     string                 `json:"_id"`
+	Index  string                 `json:"_index"`
 	Source map[string]interface{} `json:"_source"`
 }
 
+// TransactionEventsAggregateResult is the events of each transaction, grouped
+// by QueryEventsForTransactionsTemplate
+type TransactionEventsAggregateResult struct {
+	Buckets []struct {
+		Key    string `json:"key"`
+		Events struct {
+			Hits struct {
+				Hits []struct {
+					Source *types.Event `json:"_source"`
+				} `json:"hits"`
+			} `json:"hits"`
+		} `json:"events"`
+	} `json:"buckets"`
+}
+
 type ERC721HolderAggregateResult struct {
 	AfterKey struct {
 		Holder string
@@ -108,3 +239,32 @@ type ERC721HolderAggregateResult struct {
 		}
 	}
 }
+
+// DeleteByQueryTask is the response to starting a delete by query without
+// waiting for it to complete.
+type DeleteByQueryTask struct {
+	Task string `json:"task"`
+}
+
+type DeleteByQueryStatus struct {
+	Total            uint64 `json:"total"`
+	Deleted          uint64 `json:"deleted"`
+	VersionConflicts uint64 `json:"version_conflicts"`
+}
+
+// DeleteByQueryTaskResult is the state of a delete by query task, with the
+// final response once it has completed.
+type DeleteByQueryTaskResult struct {
+	Completed bool `json:"completed"`
+	Task      struct {
+		Status DeleteByQueryStatus `json:"status"`
+	} `json:"task"`
+	Response struct {
+		DeleteByQueryStatus
+		Failures []json.RawMessage `json:"failures"`
+	} `json:"response"`
+	Error *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
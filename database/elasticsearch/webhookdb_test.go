@@ -0,0 +1,99 @@
+package elasticsearch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database"
+	elasticsearchmocks "quorumengineering/quorum-report/database/elasticsearch/mocks"
+	"quorumengineering/quorum-report/types"
+)
+
+func TestElasticsearchDB_AddWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	webhook := &types.Webhook{ID: "abc", URL: "https://example.com/hook", EventSignature: "Transfer(address,address,uint256)"}
+	ex := esapi.IndexRequest{
+		Index:      WebhookIndex,
+		DocumentID: "abc",
+		Body:       esutil.NewJSONReader(webhook),
+		Refresh:    "true",
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewIndexRequestMatcher(ex))
+
+	db, _ := New(mockedClient)
+
+	err := db.AddWebhook(webhook)
+	assert.Nil(t, err)
+}
+
+func TestElasticsearchDB_DeleteWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	ex := esapi.DeleteRequest{
+		Index:      WebhookIndex,
+		DocumentID: "abc",
+	}
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewDeleteRequestMatcher(ex)).Return(nil, database.ErrNotFound)
+
+	db, _ := New(mockedClient)
+
+	err := db.DeleteWebhook("abc")
+	assert.Equal(t, database.ErrNotFound, err)
+}
+
+func TestElasticsearchDB_GetWebhooks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	size := maxWebhooks
+	ex := esapi.SearchRequest{
+		Index: []string{WebhookIndex},
+		Body:  strings.NewReader(QueryAllWebhooksTemplate),
+		Size:  &size,
+	}
+	result := `{"hits":{"hits":[{"_id":"abc","_source":{"id":"abc","url":"https://example.com/hook","address":"0x0000000000000000000000000000000000000001"}}]}}`
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(NewSearchRequestMatcher(ex)).Return([]byte(result), nil)
+
+	db, _ := New(mockedClient)
+
+	webhooks, err := db.GetWebhooks()
+	assert.Nil(t, err)
+	address := types.NewAddress("1")
+	assert.Equal(t, []*types.Webhook{{ID: "abc", URL: "https://example.com/hook", Address: &address}}, webhooks)
+}
+
+func TestElasticsearchDB_GetWebhooks_NoIndex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockedClient := elasticsearchmocks.NewMockAPIClient(ctrl)
+
+	mockedClient.EXPECT().DoRequest(gomock.Any()) //for setup, not relevant to test
+	mockedClient.EXPECT().DoRequest(gomock.AssignableToTypeOf(esapi.SearchRequest{})).Return(nil, ErrIndexNotFound)
+
+	db, _ := New(mockedClient)
+
+	webhooks, err := db.GetWebhooks()
+	assert.Nil(t, err)
+	assert.Empty(t, webhooks)
+}
@@ -32,17 +32,23 @@ func (dbFactory *Factory) NewInMemoryDatabase() *memory.MemoryDB {
 }
 
 func (dbFactory *Factory) NewElasticsearchDatabase(config *types.ElasticsearchConfig) (*elasticsearch.ElasticsearchDB, error) {
-	esConfig, err := elasticsearch.NewConfig(config)
+	apiClient, err := dbFactory.NewElasticsearchAPIClient(config)
 	if err != nil {
 		return nil, err
 	}
-	client, err := elasticsearch.NewClient(esConfig)
+	return elasticsearch.New(apiClient)
+}
+
+// NewElasticsearchAPIClient connects to Elasticsearch without setting up the
+// indices of the database
+func (dbFactory *Factory) NewElasticsearchAPIClient(config *types.ElasticsearchConfig) (elasticsearch.APIClient, error) {
+	esConfig, err := elasticsearch.NewConfig(config)
 	if err != nil {
 		return nil, err
 	}
-	apiClient, err := elasticsearch.NewAPIClient(client)
+	client, err := elasticsearch.NewClient(esConfig)
 	if err != nil {
 		return nil, err
 	}
-	return elasticsearch.New(apiClient)
+	return elasticsearch.NewAPIClient(client, config)
 }
@@ -1,12 +1,15 @@
 package factory
 
 import (
+	"context"
 	"math/big"
 	"sync"
+	"time"
 
 	"github.com/bluele/gcache"
 
 	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/log"
 	"quorumengineering/quorum-report/types"
 )
 
@@ -17,9 +20,16 @@ type DatabaseWithCache struct {
 	transactionCache      gcache.Cache
 	storageCache          gcache.Cache
 	contractCreationCache gcache.Cache
+	// results of queries up to a block that has been persisted
+	historicCache gcache.Cache
 	// mutex lock
 	blockMux   sync.RWMutex
 	addressMux sync.RWMutex
+	// guards invalidating historic results against caching ones that were
+	// queried before the invalidation
+	historicMux          sync.RWMutex
+	historicGeneration   uint64
+	highestHistoricBlock uint64
 }
 
 func NewDatabaseWithCache(db database.Database, cacheSize int) (database.Database, error) {
@@ -42,6 +52,7 @@ func NewDatabaseWithCache(db database.Database, cacheSize int) (database.Databas
 		transactionCache:      gcache.New(cacheSize).LRU().Build(),
 		storageCache:          gcache.New(cacheSize).LRU().Build(),
 		contractCreationCache: gcache.New(cacheSize).LRU().Build(),
+		historicCache:         gcache.New(cacheSize).LRU().Build(),
 	}, nil
 }
 
@@ -61,6 +72,7 @@ func (cachingDB *DatabaseWithCache) AddAddresses(addresses []types.Address) erro
 		for _, newAddress := range newAddresses {
 			cachingDB.addressCache[newAddress] = true
 		}
+		cachingDB.invalidateHistoric(newAddresses, 0)
 	}
 	return nil
 }
@@ -71,21 +83,24 @@ func (cachingDB *DatabaseWithCache) AddAddressFrom(address types.Address, from u
 	if err := cachingDB.db.AddAddressFrom(address, from); err != nil {
 		return err
 	}
+	// the address is indexed again
+	cachingDB.invalidateHistoric([]types.Address{address}, 0)
 	if !cachingDB.addressCache[address] {
 		cachingDB.addressCache[address] = true
 	}
 	return nil
 }
 
-func (cachingDB *DatabaseWithCache) DeleteAddress(address types.Address) error {
+func (cachingDB *DatabaseWithCache) DeleteAddress(address types.Address, purge bool) error {
 	cachingDB.addressMux.Lock()
 	defer cachingDB.addressMux.Unlock()
 	if !cachingDB.addressCache[address] {
 		return nil
 	}
-	if err := cachingDB.db.DeleteAddress(address); err != nil {
+	if err := cachingDB.db.DeleteAddress(address, purge); err != nil {
 		return err
 	}
+	cachingDB.invalidateHistoric([]types.Address{address}, 0)
 	delete(cachingDB.addressCache, address)
 	return nil
 }
@@ -104,6 +119,36 @@ func (cachingDB *DatabaseWithCache) GetContractTemplate(address types.Address) (
 	return cachingDB.db.GetContractTemplate(address)
 }
 
+func (cachingDB *DatabaseWithCache) SetContractEnrichment(address types.Address, mapping types.EnrichmentMapping) error {
+	return cachingDB.db.SetContractEnrichment(address, mapping)
+}
+
+func (cachingDB *DatabaseWithCache) GetContractEnrichment(address types.Address) (types.EnrichmentMapping, error) {
+	return cachingDB.db.GetContractEnrichment(address)
+}
+
+func (cachingDB *DatabaseWithCache) SetContractSeverityRules(address types.Address, rules types.SeverityRules) error {
+	return cachingDB.db.SetContractSeverityRules(address, rules)
+}
+
+func (cachingDB *DatabaseWithCache) GetContractSeverityRules(address types.Address) (types.SeverityRules, error) {
+	return cachingDB.db.GetContractSeverityRules(address)
+}
+
+func (cachingDB *DatabaseWithCache) SetTerminalBlock(address types.Address, terminalBlock uint64) error {
+	if err := cachingDB.db.SetTerminalBlock(address, terminalBlock); err != nil {
+		return err
+	}
+	// the terminal block may have been moved either way, so any result for the
+	// address may be cut off at the wrong block
+	cachingDB.invalidateHistoric([]types.Address{address}, 0)
+	return nil
+}
+
+func (cachingDB *DatabaseWithCache) GetTerminalBlock(address types.Address) (uint64, error) {
+	return cachingDB.db.GetTerminalBlock(address)
+}
+
 func (cachingDB *DatabaseWithCache) GetContractABI(address types.Address) (string, error) {
 	return cachingDB.db.GetContractABI(address)
 }
@@ -116,6 +161,10 @@ func (cachingDB *DatabaseWithCache) AddTemplate(name string, abi string, layout
 	return cachingDB.db.AddTemplate(name, abi, layout)
 }
 
+func (cachingDB *DatabaseWithCache) DeleteTemplate(name string) error {
+	return cachingDB.db.DeleteTemplate(name)
+}
+
 func (cachingDB *DatabaseWithCache) AssignTemplate(address types.Address, name string) error {
 	return cachingDB.db.AssignTemplate(address, name)
 }
@@ -169,6 +218,26 @@ func (cachingDB *DatabaseWithCache) WriteTransactions(txns []*types.Transaction)
 	return nil
 }
 
+func (cachingDB *DatabaseWithCache) GetBlocksByTimeRange(from uint64, to uint64, options *types.PageOptions) ([]*types.Block, error) {
+	return cachingDB.db.GetBlocksByTimeRange(from, to, options)
+}
+
+func (cachingDB *DatabaseWithCache) GetBlocksByTimeRangeTotal(from uint64, to uint64) (uint64, error) {
+	return cachingDB.db.GetBlocksByTimeRangeTotal(from, to)
+}
+
+func (cachingDB *DatabaseWithCache) GetTransactionsInBlockRange(start uint64, end uint64, options *types.PageOptions) ([]*types.Transaction, error) {
+	return cachingDB.db.GetTransactionsInBlockRange(start, end, options)
+}
+
+func (cachingDB *DatabaseWithCache) GetTransactionCallTree(hash types.Hash) (*types.CallTree, error) {
+	return cachingDB.db.GetTransactionCallTree(hash)
+}
+
+func (cachingDB *DatabaseWithCache) GetTransactionsInBlockRangeTotal(start uint64, end uint64) (uint64, error) {
+	return cachingDB.db.GetTransactionsInBlockRangeTotal(start, end)
+}
+
 func (cachingDB *DatabaseWithCache) ReadTransaction(hash types.Hash) (*types.Transaction, error) {
 	if cachedTx, err := cachingDB.transactionCache.Get(hash.String()); err == nil {
 		return cachedTx.(*types.Transaction), nil
@@ -182,17 +251,83 @@ func (cachingDB *DatabaseWithCache) ReadTransaction(hash types.Hash) (*types.Tra
 }
 
 func (cachingDB *DatabaseWithCache) IndexBlocks(addresses []types.Address, blocks []*types.Block) error {
-	return cachingDB.db.IndexBlocks(addresses, blocks)
+	if err := cachingDB.db.IndexBlocks(addresses, blocks); err != nil {
+		return err
+	}
+	cachingDB.indexedBlocks(addresses, blocks)
+	return nil
+}
+
+func (cachingDB *DatabaseWithCache) IndexBlocksAhead(addresses []types.Address, blocks []*types.Block) error {
+	if err := cachingDB.db.IndexBlocksAhead(addresses, blocks); err != nil {
+		return err
+	}
+	cachingDB.indexedBlocks(addresses, blocks)
+	return nil
+}
+
+func (cachingDB *DatabaseWithCache) ReindexBlocks(addresses []types.Address, blocks []*types.Block) error {
+	if err := cachingDB.db.ReindexBlocks(addresses, blocks); err != nil {
+		return err
+	}
+	cachingDB.indexedBlocks(addresses, blocks)
+	return nil
+}
+
+func (cachingDB *DatabaseWithCache) RefreshIndexed() error {
+	return cachingDB.db.RefreshIndexed()
+}
+
+// indexedBlocks removes the cached results for the addresses that cover the
+// indexed blocks. What was indexed is made visible to queries first, as a
+// query run before then would cache an incomplete result after the others
+// were removed.
+func (cachingDB *DatabaseWithCache) indexedBlocks(addresses []types.Address, blocks []*types.Block) {
+	if len(blocks) == 0 {
+		return
+	}
+	if err := cachingDB.db.RefreshIndexed(); err != nil {
+		log.Warn("Refreshing indexed blocks failed, cached queries may miss them", "err", err)
+	}
+	fromBlock := blocks[0].Number
+	for _, block := range blocks {
+		if block.Number < fromBlock {
+			fromBlock = block.Number
+		}
+	}
+	cachingDB.invalidateHistoric(addresses, fromBlock)
 }
 
 func (cachingDB *DatabaseWithCache) IndexStorage(rawStorage map[types.Address]*types.AccountState, blockNumber uint64) error {
-	return cachingDB.db.IndexStorage(rawStorage, blockNumber)
+	if err := cachingDB.db.IndexStorage(rawStorage, blockNumber); err != nil {
+		return err
+	}
+	addresses := make([]types.Address, 0, len(rawStorage))
+	for address := range rawStorage {
+		addresses = append(addresses, address)
+	}
+	cachingDB.invalidateHistoric(addresses, blockNumber)
+	return nil
 }
 
 func (cachingDB *DatabaseWithCache) SetContractCreationTransaction(creationTxns map[types.Hash][]types.Address) error {
 	return cachingDB.db.SetContractCreationTransaction(creationTxns)
 }
 
+func (cachingDB *DatabaseWithCache) SetContractsDestroyed(destroyed map[types.Address]uint64) error {
+	if err := cachingDB.db.SetContractsDestroyed(destroyed); err != nil {
+		return err
+	}
+	for address, block := range destroyed {
+		cachingDB.invalidateHistoric([]types.Address{address}, block)
+	}
+	return nil
+}
+
+func (cachingDB *DatabaseWithCache) GetContractDestroyed(address types.Address) (uint64, error) {
+	return cachingDB.db.GetContractDestroyed(address)
+}
+
 func (cachingDB *DatabaseWithCache) GetContractCreationTransaction(address types.Address) (types.Hash, error) {
 	if cachedHash, err := cachingDB.contractCreationCache.Get(address); err == nil {
 		return cachedHash.(types.Hash), nil
@@ -208,27 +343,95 @@ func (cachingDB *DatabaseWithCache) GetContractCreationTransaction(address types
 }
 
 func (cachingDB *DatabaseWithCache) GetAllTransactionsToAddress(address types.Address, options *types.QueryOptions) ([]types.Hash, error) {
-	return cachingDB.db.GetAllTransactionsToAddress(address, options)
+	result, err := cachingDB.historicQuery("transactionsTo", address, queryMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetAllTransactionsToAddress(address, options)
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]types.Hash), nil
 }
 
 func (cachingDB *DatabaseWithCache) GetAllTransactionsInternalToAddress(address types.Address, options *types.QueryOptions) ([]types.Hash, error) {
-	return cachingDB.db.GetAllTransactionsInternalToAddress(address, options)
+	result, err := cachingDB.historicQuery("transactionsInternalTo", address, queryMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetAllTransactionsInternalToAddress(address, options)
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]types.Hash), nil
 }
 
 func (cachingDB *DatabaseWithCache) GetAllEventsFromAddress(address types.Address, options *types.QueryOptions) ([]*types.Event, error) {
-	return cachingDB.db.GetAllEventsFromAddress(address, options)
+	result, err := cachingDB.historicQuery("eventsFrom", address, queryMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetAllEventsFromAddress(address, options)
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*types.Event), nil
 }
 
 func (cachingDB *DatabaseWithCache) GetTransactionsToAddressTotal(address types.Address, options *types.QueryOptions) (uint64, error) {
-	return cachingDB.db.GetTransactionsToAddressTotal(address, options)
+	result, err := cachingDB.historicQuery("transactionsToTotal", address, queryMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetTransactionsToAddressTotal(address, options)
+	}, options)
+	if err != nil {
+		return 0, err
+	}
+	return result.(uint64), nil
 }
 
 func (cachingDB *DatabaseWithCache) GetTransactionsInternalToAddressTotal(address types.Address, options *types.QueryOptions) (uint64, error) {
-	return cachingDB.db.GetTransactionsInternalToAddressTotal(address, options)
+	result, err := cachingDB.historicQuery("transactionsInternalToTotal", address, queryMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetTransactionsInternalToAddressTotal(address, options)
+	}, options)
+	if err != nil {
+		return 0, err
+	}
+	return result.(uint64), nil
 }
 
 func (cachingDB *DatabaseWithCache) GetEventsFromAddressTotal(address types.Address, options *types.QueryOptions) (uint64, error) {
-	return cachingDB.db.GetEventsFromAddressTotal(address, options)
+	result, err := cachingDB.historicQuery("eventsFromTotal", address, queryMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetEventsFromAddressTotal(address, options)
+	}, options)
+	if err != nil {
+		return 0, err
+	}
+	return result.(uint64), nil
+}
+
+func (cachingDB *DatabaseWithCache) HasActivity(address types.Address, from uint64, to uint64) (bool, error) {
+	return cachingDB.db.HasActivity(address, from, to)
+}
+
+func (cachingDB *DatabaseWithCache) GetEventsByTopics(query *types.EventTopicQuery, options *types.QueryOptions) ([]*types.Event, error) {
+	return cachingDB.db.GetEventsByTopics(query, options)
+}
+
+func (cachingDB *DatabaseWithCache) GetEventsByTopicsTotal(query *types.EventTopicQuery, options *types.QueryOptions) (uint64, error) {
+	return cachingDB.db.GetEventsByTopicsTotal(query, options)
+}
+
+func (cachingDB *DatabaseWithCache) GetEventsBySeverity(query *types.EventSeverityQuery, options *types.QueryOptions) ([]*types.Event, error) {
+	return cachingDB.db.GetEventsBySeverity(query, options)
+}
+
+func (cachingDB *DatabaseWithCache) GetEventsBySeverityTotal(query *types.EventSeverityQuery, options *types.QueryOptions) (uint64, error) {
+	return cachingDB.db.GetEventsBySeverityTotal(query, options)
+}
+
+func (cachingDB *DatabaseWithCache) GetEventSeverityCounts(query *types.EventSeverityQuery, options *types.QueryOptions) (types.SeverityCounts, error) {
+	return cachingDB.db.GetEventSeverityCounts(query, options)
+}
+
+func (cachingDB *DatabaseWithCache) GetEventsInOrder(contracts []types.Address, after *types.Cursor, toBlock uint64, limit int) ([]*types.Event, error) {
+	return cachingDB.db.GetEventsInOrder(contracts, after, toBlock, limit)
+}
+
+func (cachingDB *DatabaseWithCache) GetEventsForTransactions(hashes []types.Hash, contracts []types.Address, limit int) (map[types.Hash][]*types.Event, error) {
+	return cachingDB.db.GetEventsForTransactions(hashes, contracts, limit)
 }
 
 func (cachingDB *DatabaseWithCache) GetStorage(address types.Address, blockNumber uint64) (*types.StorageResult, error) {
@@ -236,53 +439,388 @@ func (cachingDB *DatabaseWithCache) GetStorage(address types.Address, blockNumbe
 }
 
 func (cachingDB *DatabaseWithCache) GetStorageWithOptions(address types.Address, options *types.PageOptions) ([]*types.StorageResult, error) {
-	return cachingDB.db.GetStorageWithOptions(address, options)
+	result, err := cachingDB.historicQuery("storage", address, pageMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetStorageWithOptions(address, options)
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*types.StorageResult), nil
 }
 
 func (cachingDB *DatabaseWithCache) GetStorageTotal(address types.Address, options *types.PageOptions) (uint64, error) {
-	return cachingDB.db.GetStorageTotal(address, options)
+	result, err := cachingDB.historicQuery("storageTotal", address, pageMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetStorageTotal(address, options)
+	}, options)
+	if err != nil {
+		return 0, err
+	}
+	return result.(uint64), nil
 }
 
 func (cachingDB *DatabaseWithCache) GetStorageRanges(contract types.Address, options *types.PageOptions) ([]types.RangeResult, error) {
-	return cachingDB.db.GetStorageRanges(contract, options)
+	result, err := cachingDB.historicQuery("storageRanges", contract, pageMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetStorageRanges(contract, options)
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]types.RangeResult), nil
+}
+
+func (cachingDB *DatabaseWithCache) GetStorageValues(contract types.Address, options *types.PageOptions) ([]*types.StorageValues, error) {
+	result, err := cachingDB.historicQuery("storageValues", contract, pageMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetStorageValues(contract, options)
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*types.StorageValues), nil
+}
+
+func (cachingDB *DatabaseWithCache) GetCounterparties(address types.Address, options *types.CounterpartyQueryOptions) ([]*types.Counterparty, error) {
+	return cachingDB.db.GetCounterparties(address, options)
 }
 
 func (cachingDB *DatabaseWithCache) GetLastFiltered(address types.Address) (uint64, error) {
 	return cachingDB.db.GetLastFiltered(address)
 }
 
+func (cachingDB *DatabaseWithCache) ResetLastFiltered(address types.Address, lastFiltered uint64) error {
+	if err := cachingDB.db.ResetLastFiltered(address, lastFiltered); err != nil {
+		return err
+	}
+	// the blocks after it are filtered again
+	cachingDB.invalidateHistoric([]types.Address{address}, lastFiltered+1)
+	return nil
+}
+
 func (cachingDB *DatabaseWithCache) RecordNewERC20Balance(contract types.Address, holder types.Address, block uint64, amount *big.Int) error {
-	return cachingDB.db.RecordNewERC20Balance(contract, holder, block, amount)
+	if err := cachingDB.db.RecordNewERC20Balance(contract, holder, block, amount); err != nil {
+		return err
+	}
+	cachingDB.invalidateHistoric([]types.Address{contract}, block)
+	return nil
 }
 
 func (cachingDB *DatabaseWithCache) GetERC20Balance(contract types.Address, holder types.Address, options *types.TokenQueryOptions) (map[uint64]*big.Int, error) {
-	return cachingDB.db.GetERC20Balance(contract, holder, options)
+	result, err := cachingDB.historicQuery("erc20Balance", contract, tokenMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetERC20Balance(contract, holder, options)
+	}, holder, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[uint64]*big.Int), nil
 }
 
 func (cachingDB *DatabaseWithCache) GetAllTokenHolders(contract types.Address, block uint64, options *types.TokenQueryOptions) ([]types.Address, error) {
-	return cachingDB.db.GetAllTokenHolders(contract, block, options)
+	result, err := cachingDB.historicQuery("tokenHolders", contract, blockNumber(block), func() (interface{}, error) {
+		return cachingDB.db.GetAllTokenHolders(contract, block, options)
+	}, block, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]types.Address), nil
+}
+
+func (cachingDB *DatabaseWithCache) GetERC20TokenHolders(contract types.Address, block uint64, options *types.QueryOptions) ([]*types.ERC20Holding, error) {
+	result, err := cachingDB.historicQuery("erc20TokenHolders", contract, blockNumber(block), func() (interface{}, error) {
+		return cachingDB.db.GetERC20TokenHolders(contract, block, options)
+	}, block, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*types.ERC20Holding), nil
+}
+
+func (cachingDB *DatabaseWithCache) RecordERC20Allowance(contract types.Address, owner types.Address, spender types.Address, block uint64, amount *big.Int) error {
+	if err := cachingDB.db.RecordERC20Allowance(contract, owner, spender, block, amount); err != nil {
+		return err
+	}
+	cachingDB.invalidateHistoric([]types.Address{contract}, block)
+	return nil
+}
+
+func (cachingDB *DatabaseWithCache) GetERC20Allowance(contract types.Address, owner types.Address, spender types.Address, options *types.TokenQueryOptions) (map[uint64]*big.Int, error) {
+	result, err := cachingDB.historicQuery("erc20Allowance", contract, tokenMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetERC20Allowance(contract, owner, spender, options)
+	}, owner, spender, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[uint64]*big.Int), nil
+}
+
+func (cachingDB *DatabaseWithCache) GetERC20Allowances(contract types.Address, owner types.Address, block uint64, options *types.QueryOptions) ([]*types.ERC20Allowance, error) {
+	result, err := cachingDB.historicQuery("erc20Allowances", contract, blockNumber(block), func() (interface{}, error) {
+		return cachingDB.db.GetERC20Allowances(contract, owner, block, options)
+	}, owner, block, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*types.ERC20Allowance), nil
 }
 
 func (cachingDB *DatabaseWithCache) RecordERC721Token(contract types.Address, holder types.Address, block uint64, tokenId *big.Int) error {
-	return cachingDB.db.RecordERC721Token(contract, holder, block, tokenId)
+	if err := cachingDB.db.RecordERC721Token(contract, holder, block, tokenId); err != nil {
+		return err
+	}
+	cachingDB.invalidateHistoric([]types.Address{contract}, block)
+	return nil
 }
 
 func (cachingDB *DatabaseWithCache) ERC721TokenByTokenID(contract types.Address, block uint64, tokenId *big.Int) (*types.ERC721Token, error) {
-	return cachingDB.db.ERC721TokenByTokenID(contract, block, tokenId)
+	result, err := cachingDB.historicQuery("erc721Token", contract, blockNumber(block), func() (interface{}, error) {
+		return cachingDB.db.ERC721TokenByTokenID(contract, block, tokenId)
+	}, block, tokenId)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*types.ERC721Token), nil
+}
+
+func (cachingDB *DatabaseWithCache) ERC721TokenHistory(contract types.Address, tokenId *big.Int, options *types.TokenQueryOptions) ([]types.ERC721Token, error) {
+	result, err := cachingDB.historicQuery("erc721TokenHistory", contract, tokenMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.ERC721TokenHistory(contract, tokenId, options)
+	}, tokenId, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]types.ERC721Token), nil
 }
 
 func (cachingDB *DatabaseWithCache) ERC721TokensForAccountAtBlock(contract types.Address, holder types.Address, block uint64, options *types.TokenQueryOptions) ([]types.ERC721Token, error) {
-	return cachingDB.db.ERC721TokensForAccountAtBlock(contract, holder, block, options)
+	result, err := cachingDB.historicQuery("erc721TokensForAccount", contract, blockNumber(block), func() (interface{}, error) {
+		return cachingDB.db.ERC721TokensForAccountAtBlock(contract, holder, block, options)
+	}, holder, block, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]types.ERC721Token), nil
 }
 
 func (cachingDB *DatabaseWithCache) AllERC721TokensAtBlock(contract types.Address, block uint64, options *types.TokenQueryOptions) ([]types.ERC721Token, error) {
-	return cachingDB.db.AllERC721TokensAtBlock(contract, block, options)
+	result, err := cachingDB.historicQuery("erc721Tokens", contract, blockNumber(block), func() (interface{}, error) {
+		return cachingDB.db.AllERC721TokensAtBlock(contract, block, options)
+	}, block, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]types.ERC721Token), nil
 }
 
 func (cachingDB *DatabaseWithCache) AllHoldersAtBlock(contract types.Address, block uint64, options *types.TokenQueryOptions) ([]types.Address, error) {
-	return cachingDB.db.AllHoldersAtBlock(contract, block, options)
+	result, err := cachingDB.historicQuery("erc721Holders", contract, blockNumber(block), func() (interface{}, error) {
+		return cachingDB.db.AllHoldersAtBlock(contract, block, options)
+	}, block, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]types.Address), nil
+}
+
+func (cachingDB *DatabaseWithCache) RecordNewERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, block uint64, amount *big.Int) error {
+	if err := cachingDB.db.RecordNewERC1155Balance(contract, holder, tokenId, block, amount); err != nil {
+		return err
+	}
+	cachingDB.invalidateHistoric([]types.Address{contract}, block)
+	return nil
+}
+
+func (cachingDB *DatabaseWithCache) GetERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, options *types.TokenQueryOptions) (map[uint64]*big.Int, error) {
+	result, err := cachingDB.historicQuery("erc1155Balance", contract, tokenMaxBlock(options), func() (interface{}, error) {
+		return cachingDB.db.GetERC1155Balance(contract, holder, tokenId, options)
+	}, holder, tokenId, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[uint64]*big.Int), nil
+}
+
+func (cachingDB *DatabaseWithCache) GetAllERC1155TokenHolders(contract types.Address, tokenId *big.Int, block uint64, options *types.TokenQueryOptions) ([]types.Address, error) {
+	result, err := cachingDB.historicQuery("erc1155TokenHolders", contract, blockNumber(block), func() (interface{}, error) {
+		return cachingDB.db.GetAllERC1155TokenHolders(contract, tokenId, block, options)
+	}, tokenId, block, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]types.Address), nil
+}
+
+func (cachingDB *DatabaseWithCache) GetIndexStats() ([]types.IndexStats, error) {
+	return cachingDB.db.GetIndexStats()
+}
+
+func (cachingDB *DatabaseWithCache) GetGasUsage(query *types.GasUsageQuery) ([]*types.GasUsage, error) {
+	return cachingDB.db.GetGasUsage(query)
+}
+
+func (cachingDB *DatabaseWithCache) GetNetworkActivity(from uint64, to uint64) (*types.NetworkActivity, error) {
+	return cachingDB.db.GetNetworkActivity(from, to)
+}
+
+func (cachingDB *DatabaseWithCache) ApplyRetention(index string, beforeBlock uint64) (*types.RetentionDeletion, error) {
+	deletion, err := cachingDB.db.ApplyRetention(index, beforeBlock)
+	if err != nil {
+		return nil, err
+	}
+	// cached storage may be from the deleted blocks
+	cachingDB.storageCache.Purge()
+	cachingDB.purgeHistoric()
+	return deletion, nil
+}
+
+func (cachingDB *DatabaseWithCache) Compact(mergeIndices []string, maxNumSegments int) error {
+	return cachingDB.db.Compact(mergeIndices, maxNumSegments)
+}
+
+func (cachingDB *DatabaseWithCache) WriteJournalEntries(entries []*types.JournalEntry) error {
+	return cachingDB.db.WriteJournalEntries(entries)
+}
+
+func (cachingDB *DatabaseWithCache) GetJournalEntries(query *types.JournalQuery, options *types.PageOptions) ([]*types.JournalEntry, error) {
+	return cachingDB.db.GetJournalEntries(query, options)
+}
+
+func (cachingDB *DatabaseWithCache) RollbackToBlock(blockNumber uint64) error {
+	if err := cachingDB.db.RollbackToBlock(blockNumber); err != nil {
+		return err
+	}
+	// cached entries may belong to the removed blocks
+	cachingDB.blockCache.Purge()
+	cachingDB.transactionCache.Purge()
+	cachingDB.storageCache.Purge()
+	cachingDB.contractCreationCache.Purge()
+	cachingDB.purgeHistoric()
+	return nil
+}
+
+func (cachingDB *DatabaseWithCache) DeleteBlockRange(from uint64, to uint64, dryRun bool) (*types.BlockRangeDeletion, error) {
+	deletion, err := cachingDB.db.DeleteBlockRange(from, to, dryRun)
+	if err != nil || dryRun {
+		return deletion, err
+	}
+	// cached storage may be from the deleted blocks
+	cachingDB.storageCache.Purge()
+	cachingDB.purgeHistoric()
+	return deletion, nil
+}
+
+func (cachingDB *DatabaseWithCache) Stop(ctx context.Context) error {
+	return cachingDB.db.Stop(ctx)
+}
+
+func (cachingDB *DatabaseWithCache) GetJobs() ([]*types.Job, error) {
+	return cachingDB.db.GetJobs()
+}
+
+func (cachingDB *DatabaseWithCache) GetJob(id string) (*types.Job, error) {
+	return cachingDB.db.GetJob(id)
+}
+
+func (cachingDB *DatabaseWithCache) RetryJob(id string) error {
+	return cachingDB.db.RetryJob(id)
+}
+
+func (cachingDB *DatabaseWithCache) AddWebhook(webhook *types.Webhook) error {
+	return cachingDB.db.AddWebhook(webhook)
+}
+
+func (cachingDB *DatabaseWithCache) DeleteWebhook(id string) error {
+	return cachingDB.db.DeleteWebhook(id)
+}
+
+func (cachingDB *DatabaseWithCache) GetWebhooks() ([]*types.Webhook, error) {
+	return cachingDB.db.GetWebhooks()
+}
+
+func (cachingDB *DatabaseWithCache) AddLegalHold(hold *types.LegalHold) error {
+	return cachingDB.db.AddLegalHold(hold)
+}
+
+func (cachingDB *DatabaseWithCache) DeleteLegalHold(id string) error {
+	return cachingDB.db.DeleteLegalHold(id)
+}
+
+func (cachingDB *DatabaseWithCache) GetLegalHolds() ([]*types.LegalHold, error) {
+	return cachingDB.db.GetLegalHolds()
+}
+
+func (cachingDB *DatabaseWithCache) AcquireLease(name string, holder string, duration time.Duration) (*types.Lease, error) {
+	return cachingDB.db.AcquireLease(name, holder, duration)
+}
+
+func (cachingDB *DatabaseWithCache) GetLease(name string) (*types.Lease, error) {
+	return cachingDB.db.GetLease(name)
+}
+
+func (cachingDB *DatabaseWithCache) GetLeases(prefix string) ([]*types.Lease, error) {
+	return cachingDB.db.GetLeases(prefix)
+}
+
+func (cachingDB *DatabaseWithCache) ReleaseLease(name string, holder string) error {
+	return cachingDB.db.ReleaseLease(name, holder)
+}
+
+func (cachingDB *DatabaseWithCache) SetArchiveReader(reader func(types.Hash) (*types.Transaction, error)) {
+	cachingDB.db.SetArchiveReader(reader)
+}
+
+func (cachingDB *DatabaseWithCache) SetCheckpoint(service string, checkpoint string) error {
+	return cachingDB.db.SetCheckpoint(service, checkpoint)
+}
+
+func (cachingDB *DatabaseWithCache) GetCheckpoint(service string) (string, error) {
+	return cachingDB.db.GetCheckpoint(service)
+}
+
+func (cachingDB *DatabaseWithCache) AddTokenRule(rule *types.TokenRule) error {
+	return cachingDB.db.AddTokenRule(rule)
+}
+
+func (cachingDB *DatabaseWithCache) DeleteTokenRule(id string) error {
+	return cachingDB.db.DeleteTokenRule(id)
+}
+
+func (cachingDB *DatabaseWithCache) GetTokenRules() ([]*types.TokenRule, error) {
+	return cachingDB.db.GetTokenRules()
+}
+
+func (cachingDB *DatabaseWithCache) Search(query *types.SearchQuery, limit int) ([]*types.SearchResult, error) {
+	return cachingDB.db.Search(query, limit)
+}
+
+func (cachingDB *DatabaseWithCache) ExportTransactionsToAddress(address types.Address, options *types.QueryOptions, fn func(*types.Transaction) error) error {
+	return cachingDB.db.ExportTransactionsToAddress(address, options, fn)
+}
+
+func (cachingDB *DatabaseWithCache) ExportEventsFromAddress(address types.Address, options *types.QueryOptions, fn func(*types.Event) error) error {
+	return cachingDB.db.ExportEventsFromAddress(address, options, fn)
+}
+
+func (cachingDB *DatabaseWithCache) ExportStoredDocuments(start uint64, end uint64, fn func(*types.StoredDocument) error) error {
+	return cachingDB.db.ExportStoredDocuments(start, end, fn)
+}
+
+// ArchiveBlocks keeps the cached blocks and transactions, which are read back
+// the same from the archive
+func (cachingDB *DatabaseWithCache) ArchiveBlocks(batch *types.ArchivedBatch) error {
+	if err := cachingDB.db.ArchiveBlocks(batch); err != nil {
+		return err
+	}
+	// cached results may hold documents of the archived blocks
+	cachingDB.purgeHistoric()
+	return nil
+}
+
+func (cachingDB *DatabaseWithCache) GetArchivedBatch(blockNumber uint64) (*types.ArchivedBatch, error) {
+	return cachingDB.db.GetArchivedBatch(blockNumber)
+}
+
+func (cachingDB *DatabaseWithCache) GetArchivedBatchForTransaction(hash types.Hash) (*types.ArchivedBatch, error) {
+	return cachingDB.db.GetArchivedBatchForTransaction(hash)
 }
 
-func (cachingDB *DatabaseWithCache) Stop() {
-	cachingDB.db.Stop()
+func (cachingDB *DatabaseWithCache) GetLastArchivedBatch() (*types.ArchivedBatch, error) {
+	return cachingDB.db.GetLastArchivedBatch()
 }
@@ -0,0 +1,111 @@
+package factory
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// historicKey identifies a query for the data of an address up to maxBlock
+type historicKey struct {
+	address  types.Address
+	maxBlock uint64
+	query    string
+}
+
+// historicQuery returns the cached result of the query, or runs it. Results are
+// only cached if maxBlock is at or below the last persisted block, as the data
+// up to there only changes on reorg or when it is indexed again, which removes
+// the cached results for the address.
+func (cachingDB *DatabaseWithCache) historicQuery(name string, address types.Address, maxBlock *big.Int, query func() (interface{}, error), args ...interface{}) (interface{}, error) {
+	if maxBlock == nil || maxBlock.Sign() < 0 || !maxBlock.IsUint64() {
+		return query()
+	}
+	marshalled, err := json.Marshal(args)
+	if err != nil {
+		return query()
+	}
+	key := historicKey{address: address, maxBlock: maxBlock.Uint64(), query: name + string(marshalled)}
+	if cached, err := cachingDB.historicCache.Get(key); err == nil {
+		return cached, nil
+	}
+
+	cachingDB.historicMux.RLock()
+	generation := cachingDB.historicGeneration
+	cachingDB.historicMux.RUnlock()
+	lastPersisted, err := cachingDB.GetLastPersistedBlockNumber()
+	if err != nil {
+		return nil, err
+	}
+	result, err := query()
+	if err != nil || key.maxBlock > lastPersisted {
+		return result, err
+	}
+
+	cachingDB.historicMux.Lock()
+	defer cachingDB.historicMux.Unlock()
+	// the result may be out of date if data was invalidated whilst querying
+	if generation == cachingDB.historicGeneration {
+		cachingDB.historicCache.Set(key, result)
+		if key.maxBlock > cachingDB.highestHistoricBlock {
+			cachingDB.highestHistoricBlock = key.maxBlock
+		}
+	}
+	return result, nil
+}
+
+// invalidateHistoric removes the cached results for the addresses that cover
+// the given block or later
+func (cachingDB *DatabaseWithCache) invalidateHistoric(addresses []types.Address, fromBlock uint64) {
+	cachingDB.historicMux.Lock()
+	defer cachingDB.historicMux.Unlock()
+	cachingDB.historicGeneration++
+	if fromBlock > cachingDB.highestHistoricBlock {
+		// no cached result includes the block
+		return
+	}
+	invalidated := make(map[types.Address]bool)
+	for _, address := range addresses {
+		invalidated[address] = true
+	}
+	for _, k := range cachingDB.historicCache.Keys(false) {
+		key := k.(historicKey)
+		if invalidated[key.address] && key.maxBlock >= fromBlock {
+			cachingDB.historicCache.Remove(key)
+		}
+	}
+}
+
+func (cachingDB *DatabaseWithCache) purgeHistoric() {
+	cachingDB.historicMux.Lock()
+	defer cachingDB.historicMux.Unlock()
+	cachingDB.historicGeneration++
+	cachingDB.historicCache.Purge()
+	cachingDB.highestHistoricBlock = 0
+}
+
+func queryMaxBlock(options *types.QueryOptions) *big.Int {
+	if options == nil {
+		return nil
+	}
+	return options.EndBlockNumber
+}
+
+func pageMaxBlock(options *types.PageOptions) *big.Int {
+	if options == nil {
+		return nil
+	}
+	return options.EndBlockNumber
+}
+
+func tokenMaxBlock(options *types.TokenQueryOptions) *big.Int {
+	if options == nil {
+		return nil
+	}
+	return options.EndBlockNumber
+}
+
+func blockNumber(block uint64) *big.Int {
+	return new(big.Int).SetUint64(block)
+}
@@ -0,0 +1,168 @@
+package factory
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/types"
+)
+
+var (
+	historicAddress = types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	otherAddress    = types.NewAddress("0x9d13c6d3afe1721beef56b55d303b09e021e27ab")
+)
+
+// countingDB counts the queries that reach the database. Indexed blocks are
+// only seen by queries once refreshed.
+type countingDB struct {
+	database.Database
+	lastPersisted uint64
+	queries       int
+	indexed       bool
+	refreshed     bool
+}
+
+func (db *countingDB) GetAddresses() ([]types.Address, error) {
+	return nil, nil
+}
+
+func (db *countingDB) GetLastPersistedBlockNumber() (uint64, error) {
+	return db.lastPersisted, nil
+}
+
+func (db *countingDB) GetAllTransactionsToAddress(types.Address, *types.QueryOptions) ([]types.Hash, error) {
+	db.queries++
+	if db.refreshed {
+		return []types.Hash{types.NewHash("0x1"), types.NewHash("0x2")}, nil
+	}
+	return []types.Hash{types.NewHash("0x1")}, nil
+}
+
+func (db *countingDB) IndexBlocks([]types.Address, []*types.Block) error {
+	db.indexed = true
+	return nil
+}
+
+func (db *countingDB) RefreshIndexed() error {
+	db.refreshed = db.indexed
+	return nil
+}
+
+func (db *countingDB) RollbackToBlock(uint64) error {
+	return nil
+}
+
+func (db *countingDB) ResetLastFiltered(types.Address, uint64) error {
+	return nil
+}
+
+func (db *countingDB) SetTerminalBlock(types.Address, uint64) error {
+	return nil
+}
+
+func (db *countingDB) SetContractsDestroyed(map[types.Address]uint64) error {
+	return nil
+}
+
+func (db *countingDB) ArchiveBlocks(*types.ArchivedBatch) error {
+	return nil
+}
+
+func newHistoricTestDB(t *testing.T) (*DatabaseWithCache, *countingDB) {
+	db := &countingDB{lastPersisted: 100}
+	cachingDB, err := NewDatabaseWithCache(db, 10)
+	assert.Nil(t, err)
+	return cachingDB.(*DatabaseWithCache), db
+}
+
+func queryUpTo(endBlock int64) *types.QueryOptions {
+	options := &types.QueryOptions{EndBlockNumber: big.NewInt(endBlock)}
+	options.SetDefaults()
+	return options
+}
+
+func TestHistoricQuery_Cached(t *testing.T) {
+	cachingDB, db := newHistoricTestDB(t)
+
+	for i := 0; i < 3; i++ {
+		hashes, err := cachingDB.GetAllTransactionsToAddress(historicAddress, queryUpTo(50))
+		assert.Nil(t, err)
+		assert.Equal(t, []types.Hash{types.NewHash("0x1")}, hashes)
+	}
+	assert.Equal(t, 1, db.queries)
+
+	// other options are another query
+	options := queryUpTo(50)
+	options.PageNumber = 1
+	_, _ = cachingDB.GetAllTransactionsToAddress(historicAddress, options)
+	assert.Equal(t, 2, db.queries)
+}
+
+func TestHistoricQuery_NotPersisted(t *testing.T) {
+	cachingDB, db := newHistoricTestDB(t)
+
+	// up to the chain head, or past the last persisted block
+	for _, options := range []*types.QueryOptions{queryUpTo(-1), queryUpTo(101), nil} {
+		_, _ = cachingDB.GetAllTransactionsToAddress(historicAddress, options)
+		_, _ = cachingDB.GetAllTransactionsToAddress(historicAddress, options)
+	}
+	assert.Equal(t, 6, db.queries)
+}
+
+func TestHistoricQuery_Invalidated(t *testing.T) {
+	cachingDB, db := newHistoricTestDB(t)
+	_, _ = cachingDB.GetAllTransactionsToAddress(historicAddress, queryUpTo(50))
+
+	// new blocks and other addresses don't change the result
+	assert.Nil(t, cachingDB.IndexBlocks([]types.Address{historicAddress}, []*types.Block{{Number: 101}}))
+	assert.Nil(t, cachingDB.IndexBlocks([]types.Address{otherAddress}, []*types.Block{{Number: 20}}))
+	_, _ = cachingDB.GetAllTransactionsToAddress(historicAddress, queryUpTo(50))
+	assert.Equal(t, 1, db.queries)
+
+	// indexing the blocks again does
+	assert.Nil(t, cachingDB.IndexBlocks([]types.Address{historicAddress}, []*types.Block{{Number: 30}, {Number: 20}}))
+	_, _ = cachingDB.GetAllTransactionsToAddress(historicAddress, queryUpTo(50))
+	assert.Equal(t, 2, db.queries)
+
+	// as does a reorg
+	assert.Nil(t, cachingDB.RollbackToBlock(90))
+	_, _ = cachingDB.GetAllTransactionsToAddress(historicAddress, queryUpTo(50))
+	assert.Equal(t, 3, db.queries)
+}
+
+func TestHistoricQuery_IndexedBlocksRefreshed(t *testing.T) {
+	cachingDB, _ := newHistoricTestDB(t)
+	_, _ = cachingDB.GetAllTransactionsToAddress(historicAddress, queryUpTo(50))
+
+	// the result cached once indexing returns includes the indexed blocks
+	assert.Nil(t, cachingDB.IndexBlocks([]types.Address{historicAddress}, []*types.Block{{Number: 30}}))
+	for i := 0; i < 2; i++ {
+		hashes, err := cachingDB.GetAllTransactionsToAddress(historicAddress, queryUpTo(50))
+		assert.Nil(t, err)
+		assert.Equal(t, []types.Hash{types.NewHash("0x1"), types.NewHash("0x2")}, hashes)
+	}
+}
+
+func TestHistoricQuery_InvalidatedByContractChanges(t *testing.T) {
+	cachingDB, db := newHistoricTestDB(t)
+	changes := []func() error{
+		func() error { return cachingDB.ResetLastFiltered(historicAddress, 40) },
+		func() error { return cachingDB.SetTerminalBlock(historicAddress, 80) },
+		func() error { return cachingDB.SetContractsDestroyed(map[types.Address]uint64{historicAddress: 45}) },
+		func() error { return cachingDB.ArchiveBlocks(&types.ArchivedBatch{StartBlock: 1, EndBlock: 10}) },
+	}
+	_, _ = cachingDB.GetAllTransactionsToAddress(historicAddress, queryUpTo(50))
+	for i, change := range changes {
+		assert.Nil(t, change())
+		_, _ = cachingDB.GetAllTransactionsToAddress(historicAddress, queryUpTo(50))
+		assert.Equal(t, i+2, db.queries)
+	}
+
+	// a reset after the query doesn't change its result
+	assert.Nil(t, cachingDB.ResetLastFiltered(historicAddress, 60))
+	_, _ = cachingDB.GetAllTransactionsToAddress(historicAddress, queryUpTo(50))
+	assert.Equal(t, 5, db.queries)
+}
@@ -1,7 +1,10 @@
 package database
 
 import (
+	"context"
 	"math/big"
+	"time"
+
 	"quorumengineering/quorum-report/types"
 )
 
@@ -12,21 +15,60 @@ type Database interface {
 	TransactionDB
 	IndexDB
 	TokenDB
-	Stop()
+	StatsDB
+	ReorgDB
+	JobDB
+	WebhookDB
+	LegalHoldDB
+	TokenRuleDB
+	SearchDB
+	ExportDB
+	IntegrityDB
+	ArchiveDB
+	RetentionDB
+	MaintenanceDB
+	JournalDB
+	LeaseDB
+	CheckpointDB
+	// Stop flushes any writes still buffered, giving up once the context is
+	// done
+	Stop(ctx context.Context) error
 }
 
 // AddressDB stores registered addresses
 type AddressDB interface {
 	AddAddresses([]types.Address) error
 	AddAddressFrom(types.Address, uint64) error
-	DeleteAddress(types.Address) error
+	// DeleteAddress unregisters the address, and when purging also deletes
+	// its events, storage, tokens and counterparties. Removing the data can
+	// continue in the background, as a deleteAddress job. Transactions are
+	// shared with other contracts, so are never deleted.
+	DeleteAddress(address types.Address, purge bool) error
 	GetAddresses() ([]types.Address, error)
 	GetContractTemplate(types.Address) (string, error)
+	// SetContractEnrichment replaces the fields copied from the contract's
+	// decoded events and transactions into their documents; an empty mapping
+	// removes them for data indexed from then on
+	SetContractEnrichment(types.Address, types.EnrichmentMapping) error
+	GetContractEnrichment(types.Address) (types.EnrichmentMapping, error)
+	// SetContractSeverityRules replaces the rules classifying the contract's
+	// events by severity; no rules stop classifying events indexed from then
+	// on
+	SetContractSeverityRules(types.Address, types.SeverityRules) error
+	GetContractSeverityRules(types.Address) (types.SeverityRules, error)
+	// SetTerminalBlock freezes the contract's data at the block, after which
+	// no more of its data is expected, such as when it was migrated; 0
+	// unfreezes it
+	SetTerminalBlock(types.Address, uint64) error
+	// GetTerminalBlock returns the block the contract's data is frozen at, or
+	// 0 if it isn't frozen
+	GetTerminalBlock(types.Address) (uint64, error)
 }
 
 // TemplateDB stores contract ABI/ Storage Layout of registered address
 type TemplateDB interface {
 	AddTemplate(string, string, string) error
+	DeleteTemplate(string) error
 	AssignTemplate(types.Address, string) error
 	GetContractABI(types.Address) (string, error)
 	GetStorageLayout(types.Address) (string, error)
@@ -39,17 +81,43 @@ type BlockDB interface {
 	WriteBlocks([]*types.Block) error
 	ReadBlock(uint64) (*types.Block, error)
 	GetLastPersistedBlockNumber() (uint64, error)
+	// GetBlocksByTimeRange returns a page of the blocks with a timestamp in
+	// the inclusive range, oldest first. Only the page size and number of the
+	// options are used.
+	GetBlocksByTimeRange(from uint64, to uint64, options *types.PageOptions) ([]*types.Block, error)
+	GetBlocksByTimeRangeTotal(from uint64, to uint64) (uint64, error)
 }
 
 // TransactionDB stores all transactions change a contract's state.
 type TransactionDB interface {
 	WriteTransactions([]*types.Transaction) error
 	ReadTransaction(types.Hash) (*types.Transaction, error)
+	// GetTransactionCallTree returns the internal calls made by a transaction
+	// as a tree, or ErrNotFound if it made none, or was indexed before call
+	// trees were stored
+	GetTransactionCallTree(types.Hash) (*types.CallTree, error)
+	// GetTransactionsInBlockRange returns a page of the transactions in the
+	// inclusive block range, in block and transaction order. Only the page
+	// size and number of the options are used.
+	GetTransactionsInBlockRange(start uint64, end uint64, options *types.PageOptions) ([]*types.Transaction, error)
+	GetTransactionsInBlockRangeTotal(start uint64, end uint64) (uint64, error)
 }
 
 // IndexDB stores the location to find all transactions/ events/ storage for a contract.
 type IndexDB interface {
 	IndexBlocks([]types.Address, []*types.Block) error
+	// IndexBlocksAhead indexes the blocks for the addresses without raising
+	// their last filtered block, so newer blocks can be indexed before the
+	// ones in between. The blocks are indexed again once the addresses are
+	// filtered up to them, which doesn't duplicate anything.
+	IndexBlocksAhead([]types.Address, []*types.Block) error
+	// ReindexBlocks indexes the blocks again for the addresses that have been
+	// filtered past them, replacing what was indexed for them before, without
+	// changing their last filtered block.
+	ReindexBlocks([]types.Address, []*types.Block) error
+	// RefreshIndexed makes everything indexed so far visible to queries,
+	// rather than once the database gets round to it
+	RefreshIndexed() error
 	IndexStorage(map[types.Address]*types.AccountState, uint64) error
 
 	// SetContractCreationTransaction sets the transaction hash that a contract was created at
@@ -58,6 +126,12 @@ type IndexDB interface {
 	// GetContractCreationTransaction fetches the transaction hash of the transaction that
 	// the given contract address was created at
 	GetContractCreationTransaction(types.Address) (types.Hash, error)
+	// SetContractsDestroyed sets the block each contract self-destructed at,
+	// after which it is no longer filtered
+	SetContractsDestroyed(map[types.Address]uint64) error
+	// GetContractDestroyed returns the block the contract self-destructed at,
+	// or 0 if it hasn't
+	GetContractDestroyed(types.Address) (uint64, error)
 
 	GetAllTransactionsToAddress(types.Address, *types.QueryOptions) ([]types.Hash, error)
 	GetTransactionsToAddressTotal(types.Address, *types.QueryOptions) (uint64, error)
@@ -65,23 +139,252 @@ type IndexDB interface {
 	GetTransactionsInternalToAddressTotal(types.Address, *types.QueryOptions) (uint64, error)
 	GetAllEventsFromAddress(types.Address, *types.QueryOptions) ([]*types.Event, error)
 	GetEventsFromAddressTotal(types.Address, *types.QueryOptions) (uint64, error)
+	// GetEventsByTopics returns the events of the query's contract, or of all
+	// registered contracts, or those of its contracts if it has any, that have
+	// the query's topics, newest first
+	GetEventsByTopics(*types.EventTopicQuery, *types.QueryOptions) ([]*types.Event, error)
+	GetEventsByTopicsTotal(*types.EventTopicQuery, *types.QueryOptions) (uint64, error)
+	// GetEventsBySeverity returns the events of the query's contract, or of
+	// all registered contracts, or those of its contracts if it has any, that
+	// were classified with the query's severity when indexed, newest first
+	GetEventsBySeverity(*types.EventSeverityQuery, *types.QueryOptions) ([]*types.Event, error)
+	GetEventsBySeverityTotal(*types.EventSeverityQuery, *types.QueryOptions) (uint64, error)
+	// GetEventSeverityCounts counts the events of the query's contracts
+	// classified with each severity, ignoring the query's severity
+	GetEventSeverityCounts(*types.EventSeverityQuery, *types.QueryOptions) (types.SeverityCounts, error)
+	// GetEventsInOrder returns the events of the contracts after the cursor,
+	// or from the first if it is nil, to the block (inclusive), oldest first
+	// in block and log index order, at most limit of them
+	GetEventsInOrder(contracts []types.Address, after *types.Cursor, toBlock uint64, limit int) ([]*types.Event, error)
+	// HasActivity returns whether there are any transactions or internal calls
+	// to the address, or events from it, indexed between the given blocks
+	// inclusive. It stops at the first found, so is cheaper than the totals.
+	HasActivity(address types.Address, from uint64, to uint64) (bool, error)
+	// GetEventsForTransactions returns the indexed events emitted by each of
+	// the transactions, in log order, keeping at most limit for each. If
+	// contracts is not nil, only the events of those contracts are returned.
+	GetEventsForTransactions(hashes []types.Hash, contracts []types.Address, limit int) (map[types.Hash][]*types.Event, error)
+	// GetCounterparties returns the addresses that have sent transactions or
+	// made internal calls to the contract in the blocks it has been filtered
+	// for, with when they were first and last seen and how often
+	GetCounterparties(types.Address, *types.CounterpartyQueryOptions) ([]*types.Counterparty, error)
 
 	GetStorage(types.Address, uint64) (*types.StorageResult, error)
 	GetStorageTotal(types.Address, *types.PageOptions) (uint64, error)
 	GetStorageWithOptions(types.Address, *types.PageOptions) ([]*types.StorageResult, error)
 	GetStorageRanges(types.Address, *types.PageOptions) ([]types.RangeResult, error)
+	// GetStorageValues returns the storage at each block in the range the
+	// storage changed at, and at the last change before the range, in block
+	// order, as decoded values where they were indexed
+	GetStorageValues(types.Address, *types.PageOptions) ([]*types.StorageValues, error)
 
 	GetLastFiltered(types.Address) (uint64, error)
+	// ResetLastFiltered lowers the block the address has been filtered up
+	// to, if it is past it, so that the filter service filters the blocks
+	// after it again. The data indexed for those blocks is not duplicated when
+	// they are. Returns ErrNotFound if the address isn't registered.
+	ResetLastFiltered(address types.Address, lastFiltered uint64) error
 }
 
 type TokenDB interface {
 	RecordNewERC20Balance(contract types.Address, holder types.Address, block uint64, amount *big.Int) error
 	GetERC20Balance(contract types.Address, holder types.Address, options *types.TokenQueryOptions) (map[uint64]*big.Int, error)
 	GetAllTokenHolders(contract types.Address, block uint64, options *types.TokenQueryOptions) ([]types.Address, error)
+	// GetERC20TokenHolders returns the holders with a non-zero balance at the
+	// block, ordered by holder address
+	GetERC20TokenHolders(contract types.Address, block uint64, options *types.QueryOptions) ([]*types.ERC20Holding, error)
+	// RecordERC20Allowance records the allowance of a spender approved by an
+	// owner at the block, replacing the allowance approved before it
+	RecordERC20Allowance(contract types.Address, owner types.Address, spender types.Address, block uint64, amount *big.Int) error
+	// GetERC20Allowance returns the allowance of the spender at each block it
+	// was approved in the range, and the allowance in place at the start of it
+	GetERC20Allowance(contract types.Address, owner types.Address, spender types.Address, options *types.TokenQueryOptions) (map[uint64]*big.Int, error)
+	// GetERC20Allowances returns the non-zero allowances the owner has
+	// approved in place at the block, ordered by spender address
+	GetERC20Allowances(contract types.Address, owner types.Address, block uint64, options *types.QueryOptions) ([]*types.ERC20Allowance, error)
 
 	RecordERC721Token(contract types.Address, holder types.Address, block uint64, tokenId *big.Int) error
 	ERC721TokenByTokenID(contract types.Address, block uint64, tokenId *big.Int) (*types.ERC721Token, error)
+	// ERC721TokenHistory returns the holders of a token that held it in the
+	// block range, oldest first, with the blocks each held it from and until
+	ERC721TokenHistory(contract types.Address, tokenId *big.Int, options *types.TokenQueryOptions) ([]types.ERC721Token, error)
 	ERC721TokensForAccountAtBlock(contract types.Address, holder types.Address, block uint64, options *types.TokenQueryOptions) ([]types.ERC721Token, error)
 	AllERC721TokensAtBlock(contract types.Address, block uint64, options *types.TokenQueryOptions) ([]types.ERC721Token, error)
 	AllHoldersAtBlock(contract types.Address, block uint64, options *types.TokenQueryOptions) ([]types.Address, error)
+
+	RecordNewERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, block uint64, amount *big.Int) error
+	GetERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, options *types.TokenQueryOptions) (map[uint64]*big.Int, error)
+	GetAllERC1155TokenHolders(contract types.Address, tokenId *big.Int, block uint64, options *types.TokenQueryOptions) ([]types.Address, error)
+}
+
+// StatsDB reports on the size and block coverage of the stored data.
+type StatsDB interface {
+	// GetIndexStats returns the document count, storage size and oldest/ newest
+	// block covered for each of the transaction, event, storage and token indices
+	GetIndexStats() ([]types.IndexStats, error)
+	// GetGasUsage returns the transactions and gas used of each group of the
+	// query: the most expensive contracts or function selectors, or the
+	// latest days
+	GetGasUsage(*types.GasUsageQuery) ([]*types.GasUsage, error)
+	// GetNetworkActivity totals the transactions of the whole network with a
+	// timestamp in the inclusive range; the public transactions and private
+	// ratio are left for the caller to fill in
+	GetNetworkActivity(from uint64, to uint64) (*types.NetworkActivity, error)
+}
+
+// RetentionDB deletes documents that are older than an index's retention
+// policy.
+type RetentionDB interface {
+	// ApplyRetention deletes the documents of the index that aren't needed to
+	// answer queries at or after the given block, other than those under
+	// legal hold. Events are deleted if they were recorded before the block;
+	// the storage of a contract is kept from the last change before it; token
+	// entries are deleted once they were replaced before it.
+	ApplyRetention(index string, beforeBlock uint64) (*types.RetentionDeletion, error)
+}
+
+// MaintenanceDB compacts the stored data to keep queries fast.
+type MaintenanceDB interface {
+	// Compact removes deleted documents from the data indices, and merges the
+	// given indices down to at most maxNumSegments segments
+	Compact(mergeIndices []string, maxNumSegments int) error
+}
+
+// JournalDB records how each block was processed.
+type JournalDB interface {
+	WriteJournalEntries([]*types.JournalEntry) error
+	// GetJournalEntries returns the entries for blocks in the range that
+	// match the query, newest block first
+	GetJournalEntries(*types.JournalQuery, *types.PageOptions) ([]*types.JournalEntry, error)
+}
+
+// LeaseDB grants named leases to one holder at a time, so that only one of
+// several instances sharing the database writes to it. Leases expire by the
+// clocks of the instances, which need to be kept in sync to well within the
+// lease duration.
+// CheckpointDB stores how far services that work outside of the filter got,
+// so they carry on from there after a restart.
+type CheckpointDB interface {
+	// SetCheckpoint records the service's checkpoint, replacing any before
+	SetCheckpoint(service string, checkpoint string) error
+	// GetCheckpoint returns the service's checkpoint, or ErrNotFound if it
+	// has never been set
+	GetCheckpoint(service string) (string, error)
+}
+
+type LeaseDB interface {
+	// AcquireLease takes the lease for the holder for the duration, if no
+	// one holds it or it has expired, or renews it if the holder already
+	// does. It returns the lease as it then stands, held by the holder or by
+	// another instance.
+	AcquireLease(name string, holder string, duration time.Duration) (*types.Lease, error)
+	// GetLease returns the lease, or ErrNotFound if it has never been held
+	GetLease(name string) (*types.Lease, error)
+	// GetLeases returns the leases whose names start with the prefix, expired
+	// or not
+	GetLeases(prefix string) ([]*types.Lease, error)
+	// ReleaseLease gives up the lease if the holder holds it, so another
+	// instance can take it without waiting for it to expire
+	ReleaseLease(name string, holder string) error
+}
+
+// ReorgDB removes the data of blocks that are no longer part of the chain, or
+// that need to be indexed again.
+type ReorgDB interface {
+	// RollbackToBlock deletes all blocks, transactions, indexed data and token
+	// balances after the given block, so that they can be synced again
+	RollbackToBlock(uint64) error
+	// DeleteBlockRange deletes the events, storage and token entries recorded
+	// in the blocks from and to (inclusive), other than those under legal
+	// hold, so the range can be backfilled cleanly. Blocks, transactions and
+	// counterparty totals are kept. On a dry run nothing is deleted, and the
+	// documents that would be are counted.
+	DeleteBlockRange(from uint64, to uint64, dryRun bool) (*types.BlockRangeDeletion, error)
+}
+
+// JobDB reports on long running operations happening in the background.
+type JobDB interface {
+	// GetJobs returns all jobs, newest first
+	GetJobs() ([]*types.Job, error)
+	GetJob(id string) (*types.Job, error)
+	// RetryJob restarts a failed job
+	RetryJob(id string) error
+}
+
+// WebhookDB stores the webhooks that matching events are sent to.
+type WebhookDB interface {
+	// AddWebhook registers the webhook, replacing any with the same ID
+	AddWebhook(*types.Webhook) error
+	DeleteWebhook(id string) error
+	GetWebhooks() ([]*types.Webhook, error)
+}
+
+// LegalHoldDB stores the legal holds that exempt data from being deleted.
+type LegalHoldDB interface {
+	// AddLegalHold places the hold, replacing any with the same ID
+	AddLegalHold(*types.LegalHold) error
+	// DeleteLegalHold releases the hold
+	DeleteLegalHold(id string) error
+	GetLegalHolds() ([]*types.LegalHold, error)
+}
+
+// TokenRuleDB stores the token rules added through the RPC API, which are
+// used alongside the rules of the configuration.
+type TokenRuleDB interface {
+	// AddTokenRule stores the rule, replacing any with the same ID
+	AddTokenRule(*types.TokenRule) error
+	DeleteTokenRule(id string) error
+	GetTokenRules() ([]*types.TokenRule, error)
+}
+
+// ExportDB reads all the transactions or events of a contract in one pass,
+// without the pagination limit of the list queries.
+type ExportDB interface {
+	// ExportTransactionsToAddress passes each transaction sent to the address
+	// within the block and time range of the options to fn, oldest first,
+	// stopping at the first error fn returns
+	ExportTransactionsToAddress(address types.Address, options *types.QueryOptions, fn func(*types.Transaction) error) error
+	// ExportEventsFromAddress passes each event emitted by the address within
+	// the block and time range of the options to fn, oldest first, stopping
+	// at the first error fn returns
+	ExportEventsFromAddress(address types.Address, options *types.QueryOptions, fn func(*types.Event) error) error
+}
+
+// IntegrityDB reads back the stored blocks, transactions and events with the
+// checksums they were stored with, to detect documents that have been changed
+// outside of the application.
+type IntegrityDB interface {
+	// ExportStoredDocuments passes each block, transaction and event stored in
+	// the block range to fn, stopping at the first error fn returns
+	ExportStoredDocuments(start uint64, end uint64, fn func(*types.StoredDocument) error) error
+}
+
+// ArchiveDB records the blocks that have been moved out of the database into
+// cold storage.
+type ArchiveDB interface {
+	// ArchiveBlocks records the batch, then deletes its blocks and their
+	// transactions, which have been copied to cold storage
+	ArchiveBlocks(batch *types.ArchivedBatch) error
+	// GetArchivedBatch returns the batch the block was archived in, or
+	// ErrNotFound if it hasn't been archived
+	GetArchivedBatch(blockNumber uint64) (*types.ArchivedBatch, error)
+	// GetArchivedBatchForTransaction returns the batch the transaction was
+	// archived in, or ErrNotFound if it hasn't been archived
+	GetArchivedBatchForTransaction(hash types.Hash) (*types.ArchivedBatch, error)
+	// GetLastArchivedBatch returns the batch archived last, which ends at the
+	// newest archived block, or ErrNotFound if nothing has been archived
+	GetLastArchivedBatch() (*types.ArchivedBatch, error)
+	// SetArchiveReader sets how the transactions of archived blocks are read
+	// back when the blocks are indexed, such as for a contract registered
+	// from an archived block
+	SetArchiveReader(reader func(types.Hash) (*types.Transaction, error))
+}
+
+// SearchDB finds what a search term identifies across the stored data.
+type SearchDB interface {
+	// Search returns the block with the number or hash, the transaction with
+	// the hash and the indexed events it emitted, or the registered contract
+	// with the address, keeping at most limit results. Blocks come first,
+	// then transactions, then events in log order.
+	Search(query *types.SearchQuery, limit int) ([]*types.SearchResult, error)
 }
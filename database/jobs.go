@@ -0,0 +1,143 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/types"
+)
+
+// maxFinishedJobs is how many completed jobs are remembered
+const maxFinishedJobs = 100
+
+// JobTracker keeps the state of background jobs, for reporting through the
+// jobs API. Jobs are only tracked in memory, so are forgotten on restart.
+type JobTracker struct {
+	jobs map[string]*types.Job
+	// job IDs, oldest first
+	order   []string
+	counter uint64
+	mux     sync.RWMutex
+}
+
+func NewJobTracker() *JobTracker {
+	return &JobTracker{jobs: make(map[string]*types.Job)}
+}
+
+// Start tracks a new running job, returning its ID.
+func (jt *JobTracker) Start(jobType string, address types.Address) string {
+	jt.mux.Lock()
+	defer jt.mux.Unlock()
+	jt.counter++
+	id := fmt.Sprintf("%s-%d", jobType, jt.counter)
+	jt.jobs[id] = &types.Job{
+		ID:        id,
+		Type:      jobType,
+		Address:   address,
+		Status:    types.JobRunning,
+		StartedAt: uint64(time.Now().Unix()),
+	}
+	jt.order = append(jt.order, id)
+	jt.prune()
+	return id
+}
+
+// prune forgets the oldest completed jobs beyond the limit. Failed jobs are
+// kept so they can still be retried.
+func (jt *JobTracker) prune() {
+	completed := 0
+	for _, id := range jt.order {
+		if jt.jobs[id].Status == types.JobCompleted {
+			completed++
+		}
+	}
+	kept := jt.order[:0]
+	for _, id := range jt.order {
+		if completed > maxFinishedJobs && jt.jobs[id].Status == types.JobCompleted {
+			delete(jt.jobs, id)
+			completed--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	jt.order = kept
+}
+
+// Update changes the job while holding the lock.
+func (jt *JobTracker) Update(id string, update func(job *types.Job)) {
+	jt.mux.Lock()
+	defer jt.mux.Unlock()
+	if job, ok := jt.jobs[id]; ok {
+		update(job)
+	}
+}
+
+// Finish marks the job as completed, or as failed with the error.
+func (jt *JobTracker) Finish(id string, err error) {
+	jt.Update(id, func(job *types.Job) {
+		job.FinishedAt = uint64(time.Now().Unix())
+		if err != nil {
+			job.Status = types.JobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = types.JobCompleted
+		job.Step = ""
+	})
+}
+
+// Restart marks a failed job as running again, returning a copy of it.
+func (jt *JobTracker) Restart(id string) (*types.Job, error) {
+	jt.mux.Lock()
+	defer jt.mux.Unlock()
+	job, ok := jt.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if job.Status != types.JobFailed {
+		return nil, ErrJobNotFailed
+	}
+	job.Status = types.JobRunning
+	job.Error = ""
+	job.FinishedAt = 0
+	restarted := *job
+	return &restarted, nil
+}
+
+// Get returns a copy of the job.
+func (jt *JobTracker) Get(id string) (*types.Job, error) {
+	jt.mux.RLock()
+	defer jt.mux.RUnlock()
+	job, ok := jt.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+// All returns copies of all jobs, newest first.
+func (jt *JobTracker) All() []*types.Job {
+	jt.mux.RLock()
+	defer jt.mux.RUnlock()
+	jobs := make([]*types.Job, 0, len(jt.order))
+	for i := len(jt.order) - 1; i >= 0; i-- {
+		copied := *jt.jobs[jt.order[i]]
+		jobs = append(jobs, &copied)
+	}
+	return jobs
+}
+
+// Unfinished reports whether a job of the type for the address is running,
+// or has failed and not been retried.
+func (jt *JobTracker) Unfinished(jobType string, address types.Address) bool {
+	jt.mux.RLock()
+	defer jt.mux.RUnlock()
+	for _, job := range jt.jobs {
+		if job.Type == jobType && job.Address == address && job.Status != types.JobCompleted {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,15 @@
 package memory
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math/big"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"quorumengineering/quorum-report/database"
 	"quorumengineering/quorum-report/log"
@@ -16,19 +21,49 @@ type MemoryDB struct {
 	// registered contract data
 	addressDB       []types.Address
 	templateDB      map[types.Address]string
+	enrichmentDB    map[types.Address]types.EnrichmentMapping
+	severityRuleDB  map[types.Address]types.SeverityRules
+	terminalDB      map[types.Address]uint64
+	destroyedDB     map[types.Address]uint64
 	abiDB           map[string]string
 	storageLayoutDB map[string]string
 	// blockchain data
 	blockDB                  map[uint64]*types.Block
 	txDB                     map[types.Hash]*types.Transaction
 	lastPersistedBlockNumber uint64
+	// the checksums of the blocks and transactions when they were written
+	blockChecksums map[uint64]string
+	txChecksums    map[types.Hash]string
 	// index data
-	txIndexDB        map[types.Address]*TxIndexer
-	eventIndexDB     map[types.Address][]*types.Event
-	storageIndexDB   map[types.Address]*StorageIndexer
-	lastFiltered     map[types.Address]uint64
-	erc20BalancesDB  []ERC20TokenHolder
-	erc721BalancesDB []types.ERC721Token
+	txIndexDB      map[types.Address]*TxIndexer
+	eventIndexDB   map[types.Address][]*types.Event
+	storageIndexDB map[types.Address]*StorageIndexer
+	lastFiltered   map[types.Address]uint64
+	// blocks indexed ahead of the last filtered block of each address, which
+	// are skipped when it is filtered up to them
+	indexedAhead      map[types.Address]map[uint64]bool
+	erc20BalancesDB   []ERC20TokenHolder
+	erc721BalancesDB  []types.ERC721Token
+	erc1155BalancesDB []ERC1155TokenHolder
+	erc20Allowances   []ERC20AllowanceEntry
+	// the severity each event was classified with when indexed, if any
+	eventSeverities map[*types.Event]string
+	// deletions happen immediately, so jobs are only recorded for reporting
+	jobs *database.JobTracker
+	// webhooks, in the order they were added
+	webhookDB []*types.Webhook
+	// legal holds, in the order they were placed
+	legalHoldDB []*types.LegalHold
+	// token rules, in the order they were added
+	tokenRuleDB []*types.TokenRule
+	// processing journal, in the order it was written
+	journalDB []*types.JournalEntry
+	// batches of blocks moved to cold storage, oldest first
+	archivedBatches []*types.ArchivedBatch
+	leaseDB         map[string]*types.Lease
+	checkpointDB    map[string]string
+	// reads back the transactions of archived blocks, if any are archived
+	archiveReader func(types.Hash) (*types.Transaction, error)
 	// mutex lock
 	mux sync.RWMutex
 }
@@ -37,15 +72,29 @@ func NewMemoryDB() *MemoryDB {
 	return &MemoryDB{
 		addressDB:                []types.Address{},
 		templateDB:               make(map[types.Address]string),
+		enrichmentDB:             make(map[types.Address]types.EnrichmentMapping),
+		severityRuleDB:           make(map[types.Address]types.SeverityRules),
+		terminalDB:               make(map[types.Address]uint64),
+		destroyedDB:              make(map[types.Address]uint64),
 		abiDB:                    make(map[string]string),
 		storageLayoutDB:          make(map[string]string),
 		blockDB:                  make(map[uint64]*types.Block),
 		txDB:                     make(map[types.Hash]*types.Transaction),
+		blockChecksums:           make(map[uint64]string),
+		txChecksums:              make(map[types.Hash]string),
 		txIndexDB:                make(map[types.Address]*TxIndexer),
 		eventIndexDB:             make(map[types.Address][]*types.Event),
+		eventSeverities:          make(map[*types.Event]string),
 		storageIndexDB:           make(map[types.Address]*StorageIndexer),
 		lastPersistedBlockNumber: 0,
 		lastFiltered:             make(map[types.Address]uint64),
+		indexedAhead:             make(map[types.Address]map[uint64]bool),
+		jobs:                     database.NewJobTracker(),
+		webhookDB:                []*types.Webhook{},
+		legalHoldDB:              []*types.LegalHold{},
+		tokenRuleDB:              []*types.TokenRule{},
+		leaseDB:                  make(map[string]*types.Lease),
+		checkpointDB:             make(map[string]string),
 	}
 }
 
@@ -63,6 +112,25 @@ type ERC20TokenHolder struct {
 	HeldUntil   *uint64
 }
 
+// ERC20AllowanceEntry is an allowance approved at a block, which holds until
+// the next approval of the same spender by the same owner
+type ERC20AllowanceEntry struct {
+	Contract    types.Address
+	Owner       types.Address
+	Spender     types.Address
+	BlockNumber uint64
+	Amount      string
+}
+
+type ERC1155TokenHolder struct {
+	Contract    types.Address
+	Holder      types.Address
+	TokenId     string
+	BlockNumber uint64
+	Amount      string
+	HeldUntil   *uint64
+}
+
 func NewTxIndexer() *TxIndexer {
 	return &TxIndexer{
 		contractCreationTx: "",
@@ -74,12 +142,14 @@ func NewTxIndexer() *TxIndexer {
 type StorageIndexer struct {
 	root    map[uint64]string
 	storage map[string]map[types.Hash]string
+	decoded map[string][]*types.StorageValue
 }
 
 func NewStorageIndexer() *StorageIndexer {
 	return &StorageIndexer{
 		root:    make(map[uint64]string),
 		storage: make(map[string]map[types.Hash]string),
+		decoded: make(map[string][]*types.StorageValue),
 	}
 }
 
@@ -128,7 +198,7 @@ func (db *MemoryDB) AddAddressFrom(address types.Address, from uint64) error {
 	return nil
 }
 
-func (db *MemoryDB) DeleteAddress(address types.Address) error {
+func (db *MemoryDB) DeleteAddress(address types.Address, purge bool) error {
 	db.mux.Lock()
 	defer db.mux.Unlock()
 	index := -1
@@ -139,9 +209,25 @@ func (db *MemoryDB) DeleteAddress(address types.Address) error {
 		}
 	}
 	if index != -1 {
-		err := db.removeAllIndices(address)
-		if err != nil {
-			return err
+		holds := types.LegalHolds(db.legalHoldDB)
+		if purge && holds.HoldsContract(address) {
+			log.Warn("Keeping data of contract under legal hold", "address", address.Hex())
+			purge = false
+		}
+		if purge {
+			id := db.jobs.Start(types.DeleteAddressJob, address)
+			err := db.removeAllIndices(address, holds)
+			db.jobs.Finish(id, err)
+			if err != nil {
+				return err
+			}
+		} else {
+			// the registration only, leaving the indexed data
+			delete(db.enrichmentDB, address)
+			delete(db.severityRuleDB, address)
+			delete(db.terminalDB, address)
+			delete(db.destroyedDB, address)
+			db.lastFiltered[address] = 0
 		}
 		db.addressDB = append(db.addressDB[:index], db.addressDB[index+1:]...)
 		return nil
@@ -161,6 +247,72 @@ func (db *MemoryDB) GetContractTemplate(address types.Address) (string, error) {
 	return db.templateDB[address], nil
 }
 
+func (db *MemoryDB) SetContractEnrichment(address types.Address, mapping types.EnrichmentMapping) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	if !db.addressIsRegistered(address) {
+		return errors.New("address is not registered")
+	}
+	if len(mapping) == 0 {
+		delete(db.enrichmentDB, address)
+		return nil
+	}
+	db.enrichmentDB[address] = mapping
+	return nil
+}
+
+func (db *MemoryDB) GetContractEnrichment(address types.Address) (types.EnrichmentMapping, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	if !db.addressIsRegistered(address) {
+		return nil, errors.New("address is not registered")
+	}
+	return db.enrichmentDB[address], nil
+}
+
+func (db *MemoryDB) SetContractSeverityRules(address types.Address, rules types.SeverityRules) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	if !db.addressIsRegistered(address) {
+		return errors.New("address is not registered")
+	}
+	if len(rules) == 0 {
+		delete(db.severityRuleDB, address)
+		return nil
+	}
+	db.severityRuleDB[address] = rules
+	return nil
+}
+
+func (db *MemoryDB) GetContractSeverityRules(address types.Address) (types.SeverityRules, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	if !db.addressIsRegistered(address) {
+		return nil, errors.New("address is not registered")
+	}
+	return db.severityRuleDB[address], nil
+}
+
+func (db *MemoryDB) SetTerminalBlock(address types.Address, terminalBlock uint64) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	if !db.addressIsRegistered(address) {
+		return errors.New("address is not registered")
+	}
+	if terminalBlock == 0 {
+		delete(db.terminalDB, address)
+		return nil
+	}
+	db.terminalDB[address] = terminalBlock
+	return nil
+}
+
+func (db *MemoryDB) GetTerminalBlock(address types.Address) (uint64, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	return db.terminalDB[address], nil
+}
+
 func (db *MemoryDB) GetContractABI(address types.Address) (string, error) {
 	db.mux.RLock()
 	defer db.mux.RUnlock()
@@ -181,6 +333,14 @@ func (db *MemoryDB) AddTemplate(name string, abi string, layout string) error {
 	return nil
 }
 
+func (db *MemoryDB) DeleteTemplate(name string) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	delete(db.abiDB, name)
+	delete(db.storageLayoutDB, name)
+	return nil
+}
+
 func (db *MemoryDB) AssignTemplate(address types.Address, name string) error {
 	db.mux.Lock()
 	defer db.mux.Unlock()
@@ -229,8 +389,13 @@ func (db *MemoryDB) WriteBlocks(blocks []*types.Block) error {
 		if block == nil {
 			return errors.New("block is nil")
 		}
+		checksum, err := types.Checksum(block)
+		if err != nil {
+			return err
+		}
 		blockNumber := block.Number
 		db.blockDB[blockNumber] = block
+		db.blockChecksums[blockNumber] = checksum
 		// Update last persisted block number.
 		if blockNumber == db.lastPersistedBlockNumber+1 {
 			for {
@@ -257,6 +422,38 @@ func (db *MemoryDB) ReadBlock(blockNumber uint64) (*types.Block, error) {
 	return nil, errors.New("block does not exist")
 }
 
+func (db *MemoryDB) GetBlocksByTimeRange(from uint64, to uint64, options *types.PageOptions) ([]*types.Block, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	blocks := db.blocksInTimeRange(from, to)
+	start := options.PageSize * options.PageNumber
+	if start >= len(blocks) {
+		return []*types.Block{}, nil
+	}
+	end := start + options.PageSize
+	if end > len(blocks) {
+		end = len(blocks)
+	}
+	return blocks[start:end], nil
+}
+
+func (db *MemoryDB) GetBlocksByTimeRangeTotal(from uint64, to uint64) (uint64, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	return uint64(len(db.blocksInTimeRange(from, to))), nil
+}
+
+func (db *MemoryDB) blocksInTimeRange(from uint64, to uint64) []*types.Block {
+	var blocks []*types.Block
+	for _, block := range db.blockDB {
+		if block.Timestamp >= from && block.Timestamp <= to {
+			blocks = append(blocks, block)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Number < blocks[j].Number })
+	return blocks
+}
+
 func (db *MemoryDB) GetLastPersistedBlockNumber() (uint64, error) {
 	db.mux.RLock()
 	defer db.mux.RUnlock()
@@ -271,7 +468,12 @@ func (db *MemoryDB) WriteTransactions(transactions []*types.Transaction) error {
 		if tx == nil {
 			return errors.New("transaction is nil")
 		}
+		checksum, err := types.Checksum(tx)
+		if err != nil {
+			return err
+		}
 		db.txDB[tx.Hash] = tx
+		db.txChecksums[tx.Hash] = checksum
 		log.Debug("Transaction stored", "hash", tx.Hash.Hex())
 	}
 	return nil
@@ -286,6 +488,53 @@ func (db *MemoryDB) ReadTransaction(hash types.Hash) (*types.Transaction, error)
 	return nil, errors.New("transaction does not exist")
 }
 
+func (db *MemoryDB) GetTransactionCallTree(hash types.Hash) (*types.CallTree, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	tx, ok := db.txDB[hash]
+	if !ok || len(tx.CallTree) == 0 {
+		return nil, database.ErrNotFound
+	}
+	return &types.CallTree{TransactionHash: tx.Hash, BlockNumber: tx.BlockNumber, Calls: tx.CallTree}, nil
+}
+
+func (db *MemoryDB) GetTransactionsInBlockRange(start uint64, end uint64, options *types.PageOptions) ([]*types.Transaction, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	txs := db.transactionsInBlockRange(start, end)
+	from := options.PageSize * options.PageNumber
+	if from >= len(txs) {
+		return []*types.Transaction{}, nil
+	}
+	to := from + options.PageSize
+	if to > len(txs) {
+		to = len(txs)
+	}
+	return txs[from:to], nil
+}
+
+func (db *MemoryDB) GetTransactionsInBlockRangeTotal(start uint64, end uint64) (uint64, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	return uint64(len(db.transactionsInBlockRange(start, end))), nil
+}
+
+func (db *MemoryDB) transactionsInBlockRange(start uint64, end uint64) []*types.Transaction {
+	var txs []*types.Transaction
+	for _, tx := range db.txDB {
+		if tx.BlockNumber >= start && tx.BlockNumber <= end {
+			txs = append(txs, tx)
+		}
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].BlockNumber != txs[j].BlockNumber {
+			return txs[i].BlockNumber < txs[j].BlockNumber
+		}
+		return txs[i].Index < txs[j].Index
+	})
+	return txs
+}
+
 func (db *MemoryDB) IndexStorage(rawStorage map[types.Address]*types.AccountState, blockNumber uint64) error {
 	db.mux.Lock()
 	defer db.mux.Unlock()
@@ -294,17 +543,172 @@ func (db *MemoryDB) IndexStorage(rawStorage map[types.Address]*types.AccountStat
 		if _, ok := db.storageIndexDB[address].storage[dumpAccount.Root.String()]; !ok {
 			db.storageIndexDB[address].storage[dumpAccount.Root.String()] = dumpAccount.Storage
 		}
+		if dumpAccount.Decoded != nil {
+			db.storageIndexDB[address].decoded[dumpAccount.Root.String()] = dumpAccount.Decoded
+		}
 	}
 	return nil
 }
 
 func (db *MemoryDB) IndexBlocks(addresses []types.Address, blocks []*types.Block) error {
+	txs, err := db.blockTransactions(blocks)
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		db.indexBlock(addresses, block, txs)
+	}
+	return nil
+}
+
+func (db *MemoryDB) IndexBlocksAhead(addresses []types.Address, blocks []*types.Block) error {
+	txs, err := db.blockTransactions(blocks)
+	if err != nil {
+		return err
+	}
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	for _, block := range blocks {
+		filteredAddresses := map[types.Address]bool{}
+		for _, address := range addresses {
+			if db.addressIsRegistered(address) && db.lastFiltered[address] < block.Number && !db.indexedAhead[address][block.Number] {
+				filteredAddresses[address] = true
+			}
+		}
+		for _, txHash := range block.Transactions {
+			db.indexTransaction(filteredAddresses, txs[txHash])
+		}
+		for address := range filteredAddresses {
+			if db.indexedAhead[address] == nil {
+				db.indexedAhead[address] = make(map[uint64]bool)
+			}
+			db.indexedAhead[address][block.Number] = true
+		}
+	}
+	return nil
+}
+
+// RefreshIndexed has nothing to do, as indexed blocks can be queried straight
+// away
+func (db *MemoryDB) RefreshIndexed() error {
+	return nil
+}
+
+func (db *MemoryDB) ReindexBlocks(addresses []types.Address, blocks []*types.Block) error {
+	txs, err := db.blockTransactions(blocks)
+	if err != nil {
+		return err
+	}
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	reindexed := map[types.Address]bool{}
 	for _, block := range blocks {
-		db.indexBlock(addresses, block)
+		filteredAddresses := map[types.Address]bool{}
+		for _, address := range addresses {
+			if db.addressIsRegistered(address) && db.lastFiltered[address] >= block.Number {
+				filteredAddresses[address] = true
+				reindexed[address] = true
+			}
+		}
+		if len(filteredAddresses) == 0 {
+			continue
+		}
+
+		// drop what was indexed for the block, including transactions that
+		// are no longer in it
+		removedTxs := make(map[types.Hash]bool)
+		for address := range filteredAddresses {
+			txIndexer := db.txIndexDB[address]
+			for _, hash := range append(append([]types.Hash{}, txIndexer.txsTo...), txIndexer.txsInternalTo...) {
+				if tx, ok := db.txDB[hash]; (!ok && txs[hash] == nil) || (ok && tx.BlockNumber == block.Number) {
+					removedTxs[hash] = true
+				}
+			}
+			txIndexer.txsTo = removeHashes(txIndexer.txsTo, removedTxs)
+			txIndexer.txsInternalTo = removeHashes(txIndexer.txsInternalTo, removedTxs)
+
+			keptEvents := []*types.Event{}
+			for _, event := range db.eventIndexDB[address] {
+				if event.BlockNumber == block.Number {
+					delete(db.eventSeverities, event)
+					continue
+				}
+				keptEvents = append(keptEvents, event)
+			}
+			db.eventIndexDB[address] = keptEvents
+		}
+
+		for _, txHash := range block.Transactions {
+			db.indexTransaction(filteredAddresses, txs[txHash])
+		}
+	}
+
+	// the transactions indexed again go back in chain order
+	for address := range reindexed {
+		txIndexer := db.txIndexDB[address]
+		db.sortByChainOrder(txIndexer.txsTo, txs)
+		db.sortByChainOrder(txIndexer.txsInternalTo, txs)
 	}
 	return nil
 }
 
+// sortByChainOrder sorts the transaction hashes by their block and position
+// in it, looking up those no longer in the database in archived; the lock
+// must be held
+func (db *MemoryDB) sortByChainOrder(hashes []types.Hash, archived map[types.Hash]*types.Transaction) {
+	position := func(hash types.Hash) (uint64, uint64) {
+		tx, ok := db.txDB[hash]
+		if !ok {
+			tx = archived[hash]
+		}
+		if tx == nil {
+			// archived before any block being indexed, so comes first
+			return 0, 0
+		}
+		return tx.BlockNumber, tx.Index
+	}
+	sort.SliceStable(hashes, func(i, j int) bool {
+		aBlock, aIndex := position(hashes[i])
+		bBlock, bIndex := position(hashes[j])
+		if aBlock != bBlock {
+			return aBlock < bBlock
+		}
+		return aIndex < bIndex
+	})
+}
+
+// blockTransactions returns the transactions of the blocks by hash, reading
+// those of archived blocks back through the archive reader. The lock must not
+// be held, as the archive reader reads from the database.
+func (db *MemoryDB) blockTransactions(blocks []*types.Block) (map[types.Hash]*types.Transaction, error) {
+	txs := make(map[types.Hash]*types.Transaction)
+	var missing []types.Hash
+	db.mux.RLock()
+	for _, block := range blocks {
+		for _, txHash := range block.Transactions {
+			if tx, ok := db.txDB[txHash]; ok {
+				txs[txHash] = tx
+			} else {
+				missing = append(missing, txHash)
+			}
+		}
+	}
+	archiveReader := db.archiveReader
+	db.mux.RUnlock()
+
+	for _, txHash := range missing {
+		if archiveReader == nil {
+			return nil, fmt.Errorf("transaction %s does not exist", txHash.Hex())
+		}
+		tx, err := archiveReader(txHash)
+		if err != nil {
+			return nil, fmt.Errorf("reading transaction %s: %v", txHash.Hex(), err)
+		}
+		txs[txHash] = tx
+	}
+	return txs, nil
+}
+
 func (db *MemoryDB) SetContractCreationTransaction(creationTxns map[types.Hash][]types.Address) error {
 	db.mux.Lock()
 	defer db.mux.Unlock()
@@ -323,6 +727,30 @@ func (db *MemoryDB) SetContractCreationTransaction(creationTxns map[types.Hash][
 	return nil
 }
 
+func (db *MemoryDB) SetContractsDestroyed(destroyed map[types.Address]uint64) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	for address, blockNumber := range destroyed {
+		if !db.addressIsRegistered(address) {
+			log.Debug("Ignored deleted address self-destruct", "block", blockNumber, "contract", address)
+			continue
+		}
+		db.destroyedDB[address] = blockNumber
+		log.Debug("Indexed self-destruct of contract", "block", blockNumber, "contract", address)
+	}
+	return nil
+}
+
+func (db *MemoryDB) GetContractDestroyed(address types.Address) (uint64, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	if !db.addressIsRegistered(address) {
+		return 0, errors.New("address is not registered")
+	}
+	return db.destroyedDB[address], nil
+}
+
 func (db *MemoryDB) GetContractCreationTransaction(address types.Address) (types.Hash, error) {
 	db.mux.RLock()
 	defer db.mux.RUnlock()
@@ -346,7 +774,7 @@ func (db *MemoryDB) GetAllTransactionsToAddress(address types.Address, options *
 		txs = append(txs, db.txIndexDB[address].txsTo[txIndex])
 		txIndex--
 	}
-	return txs, nil
+	return db.transactionsAfter(txs, options)
 }
 
 func (db *MemoryDB) GetTransactionsToAddressTotal(address types.Address, options *types.QueryOptions) (uint64, error) {
@@ -373,7 +801,39 @@ func (db *MemoryDB) GetAllTransactionsInternalToAddress(address types.Address, o
 		txIndex--
 	}
 
-	return txs, nil
+	return db.transactionsAfter(txs, options)
+}
+
+// transactionsAfter keeps the transactions that come after the cursor of the
+// options, if there is one
+func (db *MemoryDB) transactionsAfter(txs []types.Hash, options *types.QueryOptions) ([]types.Hash, error) {
+	cursor, err := options.After()
+	if err != nil || cursor == nil {
+		return txs, err
+	}
+	var after []types.Hash
+	for _, hash := range txs {
+		if tx, ok := db.txDB[hash]; ok && cursor.Follows(tx.BlockNumber, tx.Index) {
+			after = append(after, hash)
+		}
+	}
+	return after, nil
+}
+
+// eventsAfter keeps the events that come after the cursor of the options, if
+// there is one
+func eventsAfter(events []*types.Event, options *types.QueryOptions) ([]*types.Event, error) {
+	cursor, err := options.After()
+	if err != nil || cursor == nil {
+		return events, err
+	}
+	var after []*types.Event
+	for _, event := range events {
+		if cursor.Follows(event.BlockNumber, event.Index) {
+			after = append(after, event)
+		}
+	}
+	return after, nil
 }
 
 func (db *MemoryDB) GetTransactionsInternalToAddressTotal(address types.Address, options *types.QueryOptions) (uint64, error) {
@@ -395,7 +855,7 @@ func (db *MemoryDB) GetAllEventsFromAddress(address types.Address, options *type
 	sort.SliceStable(events, func(i, j int) bool {
 		return events[i].BlockNumber > events[j].BlockNumber
 	})
-	return events, nil
+	return eventsAfter(events, options)
 }
 
 func (db *MemoryDB) GetEventsFromAddressTotal(address types.Address, options *types.QueryOptions) (uint64, error) {
@@ -407,60 +867,361 @@ func (db *MemoryDB) GetEventsFromAddressTotal(address types.Address, options *ty
 	return uint64(len(db.eventIndexDB[address])), nil
 }
 
-func (db *MemoryDB) GetStorageWithOptions(address types.Address, options *types.PageOptions) ([]*types.StorageResult, error) {
+func (db *MemoryDB) GetEventsByTopics(query *types.EventTopicQuery, options *types.QueryOptions) ([]*types.Event, error) {
 	db.mux.RLock()
 	defer db.mux.RUnlock()
-	if !db.addressIsRegistered(address) {
-		return nil, errors.New("address is not registered")
+	events, err := db.eventsByTopics(query, options)
+	if err != nil {
+		return nil, err
 	}
-	var convertedList []*types.StorageResult
-
-	fromBlockNum := options.BeginBlockNumber.Uint64()
-	endBlockNum := options.EndBlockNumber.Int64()
-
-	storageIndexer, ok := db.storageIndexDB[address]
-	if ok {
-		for blkNum, storageRoot := range storageIndexer.root {
-			if blkNum >= fromBlockNum && (blkNum <= uint64(endBlockNum) || endBlockNum == -1) {
-				convertedList = append(convertedList, &types.StorageResult{
-					Storage:     storageIndexer.storage[storageRoot],
-					StorageRoot: types.NewHash(storageRoot),
-					BlockNumber: blkNum,
-				})
-			}
-		}
+	if events, err = eventsAfter(events, options); err != nil {
+		return nil, err
 	}
+	start := options.PageSize * options.PageNumber
+	if start >= len(events) {
+		return []*types.Event{}, nil
+	}
+	end := start + options.PageSize
+	if end > len(events) {
+		end = len(events)
+	}
+	return events[start:end], nil
+}
 
-	sort.SliceStable(convertedList, func(i, j int) bool {
-		return convertedList[i].BlockNumber > convertedList[j].BlockNumber
-	})
-	return convertedList, nil
+func (db *MemoryDB) GetEventsByTopicsTotal(query *types.EventTopicQuery, options *types.QueryOptions) (uint64, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	events, err := db.eventsByTopics(query, options)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(events)), nil
 }
 
-func (db *MemoryDB) GetStorageTotal(address types.Address, options *types.PageOptions) (uint64, error) {
+func (db *MemoryDB) GetEventsBySeverity(query *types.EventSeverityQuery, options *types.QueryOptions) ([]*types.Event, error) {
 	db.mux.RLock()
 	defer db.mux.RUnlock()
-	if !db.addressIsRegistered(address) {
-		return 0, errors.New("address is not registered")
+	events, err := db.findEvents(query.Address, query.Contracts, options, func(event *types.Event) bool {
+		return db.eventSeverities[event] == query.Severity
+	})
+	if err != nil {
+		return nil, err
 	}
-	fromBlockNum := options.BeginBlockNumber.Uint64()
-	endBlockNum := options.EndBlockNumber.Int64()
-	toBlockNum := options.EndBlockNumber.Uint64()
-	var total uint64
-	blockNum := fromBlockNum
-	for v := range db.storageIndexDB[address].root {
-		if v >= fromBlockNum && (endBlockNum == -1 || blockNum <= toBlockNum) {
-			total++
-		}
+	if events, err = eventsAfter(events, options); err != nil {
+		return nil, err
 	}
-	return total, nil
+	start := options.PageSize * options.PageNumber
+	if start >= len(events) {
+		return []*types.Event{}, nil
+	}
+	end := start + options.PageSize
+	if end > len(events) {
+		end = len(events)
+	}
+	return events[start:end], nil
 }
 
-func (db *MemoryDB) GetStorageRanges(contract types.Address, options *types.PageOptions) ([]types.RangeResult, error) {
+func (db *MemoryDB) GetEventsBySeverityTotal(query *types.EventSeverityQuery, options *types.QueryOptions) (uint64, error) {
 	db.mux.RLock()
 	defer db.mux.RUnlock()
-	if !db.addressIsRegistered(contract) {
-		return nil, errors.New("address is not registered")
+	events, err := db.findEvents(query.Address, query.Contracts, options, func(event *types.Event) bool {
+		return db.eventSeverities[event] == query.Severity
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(events)), nil
+}
+
+func (db *MemoryDB) GetEventSeverityCounts(query *types.EventSeverityQuery, options *types.QueryOptions) (types.SeverityCounts, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	events, err := db.findEvents(query.Address, query.Contracts, options, func(event *types.Event) bool {
+		return db.eventSeverities[event] != ""
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := types.NewSeverityCounts()
+	for _, event := range events {
+		counts[db.eventSeverities[event]]++
+	}
+	return counts, nil
+}
+
+func (db *MemoryDB) GetEventsInOrder(contracts []types.Address, after *types.Cursor, toBlock uint64, limit int) ([]*types.Event, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	var events []*types.Event
+	for _, address := range contracts {
+		if !db.addressIsRegistered(address) {
+			return nil, errors.New("address is not registered")
+		}
+		for _, event := range db.eventIndexDB[address] {
+			if event.BlockNumber <= toBlock && (after == nil || after.Precedes(event.BlockNumber, event.Index)) {
+				events = append(events, event)
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].BlockNumber != events[j].BlockNumber {
+			return events[i].BlockNumber < events[j].BlockNumber
+		}
+		return events[i].Index < events[j].Index
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	if events == nil {
+		return []*types.Event{}, nil
+	}
+	return events, nil
+}
+
+// eventsByTopics finds all the events matching the query in the block and
+// time range of the options, newest first
+func (db *MemoryDB) eventsByTopics(query *types.EventTopicQuery, options *types.QueryOptions) ([]*types.Event, error) {
+	return db.findEvents(query.Address, query.Contracts, options, query.Matches)
+}
+
+// findEvents finds all the events of the contract, or of the registered
+// contracts, or those of the contracts if not nil, that match in the block
+// and time range of the options, newest first
+func (db *MemoryDB) findEvents(contract *types.Address, contracts []types.Address, options *types.QueryOptions, matches func(*types.Event) bool) ([]*types.Event, error) {
+	addresses := db.addressDB
+	if contract != nil {
+		if !db.addressIsRegistered(*contract) {
+			return nil, errors.New("address is not registered")
+		}
+		addresses = []types.Address{*contract}
+	} else if contracts != nil {
+		addresses = []types.Address{}
+		for _, address := range db.addressDB {
+			if containsAddress(contracts, address) {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	inRange := func(value uint64, begin *big.Int, end *big.Int) bool {
+		return value >= begin.Uint64() && (end.Cmp(big.NewInt(-1)) == 0 || value <= end.Uint64())
+	}
+	var events []*types.Event
+	for _, address := range addresses {
+		for _, event := range db.eventIndexDB[address] {
+			if matches(event) &&
+				inRange(event.BlockNumber, options.BeginBlockNumber, options.EndBlockNumber) &&
+				inRange(event.Timestamp, options.BeginTimestamp, options.EndTimestamp) {
+				events = append(events, event)
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].BlockNumber != events[j].BlockNumber {
+			return events[i].BlockNumber > events[j].BlockNumber
+		}
+		return events[i].Index < events[j].Index
+	})
+	return events, nil
+}
+
+func (db *MemoryDB) GetEventsForTransactions(hashes []types.Hash, contracts []types.Address, limit int) (map[types.Hash][]*types.Event, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	wanted := make(map[types.Hash]bool, len(hashes))
+	for _, hash := range hashes {
+		wanted[hash] = true
+	}
+	events := make(map[types.Hash][]*types.Event, len(hashes))
+	for address, addressEvents := range db.eventIndexDB {
+		if contracts != nil && !containsAddress(contracts, address) {
+			continue
+		}
+		for _, event := range addressEvents {
+			if wanted[event.TransactionHash] {
+				events[event.TransactionHash] = append(events[event.TransactionHash], event)
+			}
+		}
+	}
+	for hash, txEvents := range events {
+		sort.Slice(txEvents, func(i, j int) bool {
+			return txEvents[i].Index < txEvents[j].Index
+		})
+		if len(txEvents) > limit {
+			events[hash] = txEvents[:limit]
+		}
+	}
+	return events, nil
+}
+
+func (db *MemoryDB) GetCounterparties(address types.Address, options *types.CounterpartyQueryOptions) ([]*types.Counterparty, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	if !db.addressIsRegistered(address) {
+		return nil, errors.New("address is not registered")
+	}
+
+	// a transaction can be indexed both as sent to and as calling the contract
+	txIndexer := db.txIndexDB[address]
+	indexed := make(map[types.Hash]bool)
+	byAddress := make(map[types.Address]*types.Counterparty)
+	for _, hash := range append(append([]types.Hash{}, txIndexer.txsTo...), txIndexer.txsInternalTo...) {
+		if indexed[hash] {
+			continue
+		}
+		indexed[hash] = true
+		tx := db.txDB[hash]
+		for _, from := range tx.Counterparties(address) {
+			counterparty, ok := byAddress[from]
+			if !ok {
+				counterparty = &types.Counterparty{Address: from, FirstSeenBlock: tx.BlockNumber, FirstSeenTimestamp: tx.Timestamp}
+				byAddress[from] = counterparty
+			}
+			if tx.BlockNumber < counterparty.FirstSeenBlock {
+				counterparty.FirstSeenBlock = tx.BlockNumber
+				counterparty.FirstSeenTimestamp = tx.Timestamp
+			}
+			if tx.BlockNumber >= counterparty.LastSeenBlock {
+				counterparty.LastSeenBlock = tx.BlockNumber
+				counterparty.LastSeenTimestamp = tx.Timestamp
+			}
+			counterparty.Interactions++
+		}
+	}
+
+	counterparties := make([]*types.Counterparty, 0, len(byAddress))
+	for _, counterparty := range byAddress {
+		counterparties = append(counterparties, counterparty)
+	}
+	types.SortCounterparties(counterparties, options.SortBy)
+
+	from := options.PageSize * options.PageNumber
+	if from >= len(counterparties) {
+		return []*types.Counterparty{}, nil
+	}
+	to := from + options.PageSize
+	if to > len(counterparties) {
+		to = len(counterparties)
+	}
+	return counterparties[from:to], nil
+}
+
+func (db *MemoryDB) HasActivity(address types.Address, from uint64, to uint64) (bool, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	if !db.addressIsRegistered(address) {
+		return false, errors.New("address is not registered")
+	}
+	inRange := func(blockNumber uint64) bool {
+		return blockNumber >= from && blockNumber <= to
+	}
+	for _, event := range db.eventIndexDB[address] {
+		if inRange(event.BlockNumber) {
+			return true, nil
+		}
+	}
+	txIndex := db.txIndexDB[address]
+	for _, txHashes := range [][]types.Hash{txIndex.txsTo, txIndex.txsInternalTo} {
+		for _, txHash := range txHashes {
+			if tx, ok := db.txDB[txHash]; ok && inRange(tx.BlockNumber) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (db *MemoryDB) GetStorageWithOptions(address types.Address, options *types.PageOptions) ([]*types.StorageResult, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	if !db.addressIsRegistered(address) {
+		return nil, errors.New("address is not registered")
+	}
+	var convertedList []*types.StorageResult
+
+	fromBlockNum := options.BeginBlockNumber.Uint64()
+	endBlockNum := options.EndBlockNumber.Int64()
+
+	storageIndexer, ok := db.storageIndexDB[address]
+	if ok {
+		for blkNum, storageRoot := range storageIndexer.root {
+			if blkNum >= fromBlockNum && (blkNum <= uint64(endBlockNum) || endBlockNum == -1) {
+				convertedList = append(convertedList, &types.StorageResult{
+					Storage:     storageIndexer.storage[storageRoot],
+					StorageRoot: types.NewHash(storageRoot),
+					BlockNumber: blkNum,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(convertedList, func(i, j int) bool {
+		return convertedList[i].BlockNumber > convertedList[j].BlockNumber
+	})
+	return convertedList, nil
+}
+
+func (db *MemoryDB) GetStorageValues(address types.Address, options *types.PageOptions) ([]*types.StorageValues, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	if !db.addressIsRegistered(address) {
+		return nil, errors.New("address is not registered")
+	}
+
+	fromBlockNum := options.BeginBlockNumber.Uint64()
+	endBlockNum := options.EndBlockNumber.Int64()
+
+	storageIndexer := db.storageIndexDB[address]
+	blocks := make([]uint64, 0, len(storageIndexer.root))
+	for blkNum := range storageIndexer.root {
+		if endBlockNum == -1 || blkNum <= uint64(endBlockNum) {
+			blocks = append(blocks, blkNum)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+
+	var values []*types.StorageValues
+	for i, blkNum := range blocks {
+		// keep the last change before the range, as the storage then holds
+		// at the start of it
+		if blkNum < fromBlockNum && (i+1 < len(blocks) && blocks[i+1] <= fromBlockNum) {
+			continue
+		}
+		root := storageIndexer.root[blkNum]
+		result := &types.StorageValues{BlockNumber: blkNum}
+		if decoded, ok := storageIndexer.decoded[root]; ok {
+			result.Values = decoded
+		} else {
+			result.Storage = storageIndexer.storage[root]
+		}
+		values = append(values, result)
+	}
+	return values, nil
+}
+
+func (db *MemoryDB) GetStorageTotal(address types.Address, options *types.PageOptions) (uint64, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	if !db.addressIsRegistered(address) {
+		return 0, errors.New("address is not registered")
+	}
+	fromBlockNum := options.BeginBlockNumber.Uint64()
+	endBlockNum := options.EndBlockNumber.Int64()
+	toBlockNum := options.EndBlockNumber.Uint64()
+	var total uint64
+	blockNum := fromBlockNum
+	for v := range db.storageIndexDB[address].root {
+		if v >= fromBlockNum && (endBlockNum == -1 || blockNum <= toBlockNum) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (db *MemoryDB) GetStorageRanges(contract types.Address, options *types.PageOptions) ([]types.RangeResult, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	if !db.addressIsRegistered(contract) {
+		return nil, errors.New("address is not registered")
 	}
 
 	end := options.EndBlockNumber
@@ -542,102 +1303,675 @@ func (db *MemoryDB) GetLastFiltered(address types.Address) (uint64, error) {
 	return db.lastFiltered[address], nil
 }
 
-func (db *MemoryDB) Stop() {}
+// ResetLastFiltered removes what was indexed for the address after the block,
+// including blocks indexed ahead, as indexing appends to it
+func (db *MemoryDB) ResetLastFiltered(address types.Address, lastFiltered uint64) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	if !db.addressIsRegistered(address) {
+		return database.ErrNotFound
+	}
+	if db.lastFiltered[address] <= lastFiltered {
+		return nil
+	}
 
-// internal functions
+	removedTxs := make(map[types.Hash]bool)
+	txIndexer := db.txIndexDB[address]
+	for _, hash := range append(append([]types.Hash{}, txIndexer.txsTo...), txIndexer.txsInternalTo...) {
+		if tx, ok := db.txDB[hash]; ok && tx.BlockNumber > lastFiltered {
+			removedTxs[hash] = true
+		}
+	}
+	txIndexer.txsTo = removeHashes(txIndexer.txsTo, removedTxs)
+	txIndexer.txsInternalTo = removeHashes(txIndexer.txsInternalTo, removedTxs)
 
-func (db *MemoryDB) addressIsRegistered(address types.Address) bool {
-	for _, a := range db.addressDB {
-		if address == a {
-			return true
+	keptEvents := []*types.Event{}
+	for _, event := range db.eventIndexDB[address] {
+		if event.BlockNumber <= lastFiltered {
+			keptEvents = append(keptEvents, event)
 		}
 	}
-	return false
+	db.eventIndexDB[address] = keptEvents
+	delete(db.indexedAhead, address)
+	db.lastFiltered[address] = lastFiltered
+	return nil
 }
 
-func (db *MemoryDB) indexBlock(addresses []types.Address, block *types.Block) error {
-	db.mux.Lock()
-	defer db.mux.Unlock()
-	// filter out registered and unfiltered address only
-	filteredAddresses := map[types.Address]bool{}
-	for _, address := range addresses {
-		if db.addressIsRegistered(address) && db.lastFiltered[address] < block.Number {
-			filteredAddresses[address] = true
-			log.Info("Index registered address ", "address", address.Hex(), "blocknumber", block.Number)
+func (db *MemoryDB) GetIndexStats() ([]types.IndexStats, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	// storage size is not tracked for the in-memory database
+	txStats := types.IndexStats{Name: "transaction"}
+	for _, tx := range db.txDB {
+		addToIndexStats(&txStats, tx.BlockNumber)
+	}
+	eventStats := types.IndexStats{Name: "event"}
+	for _, events := range db.eventIndexDB {
+		for _, event := range events {
+			addToIndexStats(&eventStats, event.BlockNumber)
+		}
+	}
+	storageStats := types.IndexStats{Name: "storage"}
+	for _, storageIndexer := range db.storageIndexDB {
+		for blockNumber := range storageIndexer.root {
+			addToIndexStats(&storageStats, blockNumber)
 		}
 	}
+	erc20Stats := types.IndexStats{Name: "erc20token"}
+	for _, entry := range db.erc20BalancesDB {
+		addToIndexStats(&erc20Stats, entry.BlockNumber)
+	}
+	erc721Stats := types.IndexStats{Name: "erc721token"}
+	for _, token := range db.erc721BalancesDB {
+		addToIndexStats(&erc721Stats, token.HeldFrom)
+	}
+	erc1155Stats := types.IndexStats{Name: "erc1155token"}
+	for _, entry := range db.erc1155BalancesDB {
+		addToIndexStats(&erc1155Stats, entry.BlockNumber)
+	}
+	return []types.IndexStats{txStats, eventStats, storageStats, erc20Stats, erc721Stats, erc1155Stats}, nil
+}
 
-	// index transactions and events
-	for _, txHash := range block.Transactions {
-		db.indexTransaction(filteredAddresses, db.txDB[txHash])
+func (db *MemoryDB) GetGasUsage(query *types.GasUsageQuery) ([]*types.GasUsage, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	groups := make(map[string]*types.GasUsage)
+	for _, tx := range db.txDB {
+		if !query.Matches(tx) {
+			continue
+		}
+		var key string
+		switch query.GroupBy {
+		case types.GasUsageByContract:
+			contract := tx.Contract()
+			if contract == "" {
+				continue
+			}
+			key = contract.String()
+		case types.GasUsageByFunction:
+			selector := tx.Selector()
+			if selector == "" {
+				continue
+			}
+			key = selector.String()
+		case types.GasUsageByDay:
+			key = types.GasUsageDay(tx.Timestamp)
+		}
+		if groups[key] == nil {
+			groups[key] = &types.GasUsage{Key: key}
+		}
+		groups[key].Transactions++
+		groups[key].TotalGasUsed += tx.GasUsed
 	}
 
-	for address := range filteredAddresses {
-		db.lastFiltered[address] = block.Number
+	usage := make([]*types.GasUsage, 0, len(groups))
+	for _, u := range groups {
+		usage = append(usage, u)
 	}
-	return nil
+	return types.SortGasUsage(usage, query.GroupBy, query.Limit), nil
 }
 
-func (db *MemoryDB) indexTransaction(filteredAddresses map[types.Address]bool, tx *types.Transaction) {
-	if filteredAddresses[tx.To] {
-		db.txIndexDB[tx.To].txsTo = append(db.txIndexDB[tx.To].txsTo, tx.Hash)
-		log.Debug("Indexed tx recipient", "tx", tx.Hash.Hex(), "recipient", tx.To.Hex())
-	}
+func (db *MemoryDB) GetNetworkActivity(from uint64, to uint64) (*types.NetworkActivity, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
 
-	for _, internalCall := range tx.InternalCalls {
-		if filteredAddresses[internalCall.To] {
-			db.txIndexDB[internalCall.To].txsInternalTo = append(db.txIndexDB[internalCall.To].txsInternalTo, tx.Hash)
-			log.Debug("Indexed transactions internal calls", "tx", tx.Hash.Hex(), "internal-recipient", internalCall.To.Hex())
+	activity := &types.NetworkActivity{From: from, To: to}
+	contracts := make(map[types.Address]bool)
+	accounts := make(map[types.Address]bool)
+	for _, tx := range db.txDB {
+		if tx.Timestamp < from || tx.Timestamp > to {
+			continue
 		}
-	}
-	// Index events emitted by the given address
-	for _, event := range tx.Events {
-		addr := event.Address
-		if filteredAddresses[addr] {
-			db.eventIndexDB[addr] = append(db.eventIndexDB[addr], event)
-			log.Debug("Indexed emitted event", "tx", event.TransactionHash.Hex(), "address", event.Address.Hex())
+		activity.Transactions++
+		if tx.IsPrivate {
+			activity.PrivateTransactions++
+		}
+		activity.GasUsed += tx.GasUsed
+		if contract := tx.ActiveContract(); contract != "" {
+			contracts[contract] = true
 		}
+		accounts[tx.From] = true
 	}
+	activity.ActiveContracts = uint64(len(contracts))
+	activity.ActiveAccounts = uint64(len(accounts))
+	return activity, nil
 }
 
-func (db *MemoryDB) removeAllIndices(address types.Address) error {
-	delete(db.txIndexDB, address)
-	delete(db.eventIndexDB, address)
-	delete(db.storageIndexDB, address)
-	db.lastFiltered[address] = 0
+// Compact does nothing, as there is nothing to reclaim in memory
+func (db *MemoryDB) Compact(mergeIndices []string, maxNumSegments int) error {
 	return nil
 }
 
-func (db *MemoryDB) getERC20EntryAtBlock(contract types.Address, holder types.Address, block uint64) (*ERC20TokenHolder, error) {
+func (db *MemoryDB) WriteJournalEntries(entries []*types.JournalEntry) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	for _, entry := range entries {
+		stored := *entry
+		db.journalDB = append(db.journalDB, &stored)
+	}
+	return nil
+}
+
+func (db *MemoryDB) GetJournalEntries(query *types.JournalQuery, options *types.PageOptions) ([]*types.JournalEntry, error) {
 	db.mux.RLock()
 	defer db.mux.RUnlock()
-	var tmpItem *ERC20TokenHolder
-	found := false
-	for i, item := range db.erc20BalancesDB {
-		if item.BlockNumber <= block && item.Contract == contract && item.Holder == holder {
-			if !found {
-				tmpItem = &db.erc20BalancesDB[i]
-				found = true
-			} else {
-				if item.BlockNumber > tmpItem.BlockNumber {
-					tmpItem = &db.erc20BalancesDB[i]
-				}
-			}
+
+	fromBlockNum := options.BeginBlockNumber.Uint64()
+	endBlockNum := options.EndBlockNumber.Int64()
+
+	entries := []*types.JournalEntry{}
+	for _, entry := range db.journalDB {
+		if entry.BlockNumber < fromBlockNum || (endBlockNum != -1 && entry.BlockNumber > uint64(endBlockNum)) {
+			continue
+		}
+		if query.Matches(entry) {
+			copied := *entry
+			entries = append(entries, &copied)
 		}
 	}
-	if !found {
-		return nil, database.ErrNotFound
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].BlockNumber != entries[j].BlockNumber {
+			return entries[i].BlockNumber > entries[j].BlockNumber
+		}
+		return entries[i].Timestamp > entries[j].Timestamp
+	})
+
+	from := options.PageSize * options.PageNumber
+	if from >= len(entries) {
+		return []*types.JournalEntry{}, nil
 	}
-	return tmpItem, nil
+	to := from + options.PageSize
+	if to > len(entries) {
+		to = len(entries)
+	}
+	return entries[from:to], nil
 }
 
-func (db *MemoryDB) RecordNewERC20Balance(contract types.Address, holder types.Address, block uint64, amount *big.Int) error {
-	existingTokenEntry, errExisting := db.getERC20EntryAtBlock(contract, holder, block-1)
+func (db *MemoryDB) RollbackToBlock(blockNumber uint64) error {
 	db.mux.Lock()
 	defer db.mux.Unlock()
-	if errExisting != nil && errExisting != database.ErrNotFound {
-		return errExisting
-	}
+
+	removedTxs := make(map[types.Hash]bool)
+	for number, block := range db.blockDB {
+		if number > blockNumber {
+			for _, txHash := range block.Transactions {
+				removedTxs[txHash] = true
+				delete(db.txDB, txHash)
+				delete(db.txChecksums, txHash)
+			}
+			delete(db.blockDB, number)
+			delete(db.blockChecksums, number)
+		}
+	}
+	if db.lastPersistedBlockNumber > blockNumber {
+		db.lastPersistedBlockNumber = blockNumber
+	}
+
+	for address, txIndexer := range db.txIndexDB {
+		txIndexer.txsTo = removeHashes(txIndexer.txsTo, removedTxs)
+		txIndexer.txsInternalTo = removeHashes(txIndexer.txsInternalTo, removedTxs)
+		if removedTxs[txIndexer.contractCreationTx] {
+			txIndexer.contractCreationTx = ""
+		}
+		if db.lastFiltered[address] > blockNumber {
+			db.lastFiltered[address] = blockNumber
+		}
+	}
+	for _, blocks := range db.indexedAhead {
+		for number := range blocks {
+			if number > blockNumber {
+				delete(blocks, number)
+			}
+		}
+	}
+	for address, events := range db.eventIndexDB {
+		keptEvents := []*types.Event{}
+		for _, event := range events {
+			if event.BlockNumber <= blockNumber {
+				keptEvents = append(keptEvents, event)
+			}
+		}
+		db.eventIndexDB[address] = keptEvents
+	}
+	for _, storageIndexer := range db.storageIndexDB {
+		for number := range storageIndexer.root {
+			if number > blockNumber {
+				delete(storageIndexer.root, number)
+			}
+		}
+	}
+
+	// token entries recorded after the block are removed, and the entries
+	// they replaced become the latest again
+	erc20Balances := []ERC20TokenHolder{}
+	for _, entry := range db.erc20BalancesDB {
+		if entry.BlockNumber <= blockNumber {
+			if entry.HeldUntil != nil && *entry.HeldUntil >= blockNumber {
+				entry.HeldUntil = nil
+			}
+			erc20Balances = append(erc20Balances, entry)
+		}
+	}
+	db.erc20BalancesDB = erc20Balances
+	erc721Tokens := []types.ERC721Token{}
+	for _, token := range db.erc721BalancesDB {
+		if token.HeldFrom <= blockNumber {
+			if token.HeldUntil != nil && *token.HeldUntil >= blockNumber {
+				token.HeldUntil = nil
+			}
+			erc721Tokens = append(erc721Tokens, token)
+		}
+	}
+	db.erc721BalancesDB = erc721Tokens
+	erc1155Balances := []ERC1155TokenHolder{}
+	for _, entry := range db.erc1155BalancesDB {
+		if entry.BlockNumber <= blockNumber {
+			if entry.HeldUntil != nil && *entry.HeldUntil >= blockNumber {
+				entry.HeldUntil = nil
+			}
+			erc1155Balances = append(erc1155Balances, entry)
+		}
+	}
+	db.erc1155BalancesDB = erc1155Balances
+	erc20Allowances := []ERC20AllowanceEntry{}
+	for _, entry := range db.erc20Allowances {
+		if entry.BlockNumber <= blockNumber {
+			erc20Allowances = append(erc20Allowances, entry)
+		}
+	}
+	db.erc20Allowances = erc20Allowances
+
+	log.Info("Rolled back to block", "number", blockNumber)
+	return nil
+}
+
+func (db *MemoryDB) DeleteBlockRange(from uint64, to uint64, dryRun bool) (*types.BlockRangeDeletion, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	holds := types.LegalHolds(db.legalHoldDB)
+	deleted := func(blockNumber uint64, txHash types.Hash) bool {
+		return blockNumber >= from && blockNumber <= to && !holds.Holds(blockNumber, txHash)
+	}
+	documents := map[string]uint64{"event": 0, "storage": 0, "erc20token": 0, "erc721token": 0, "erc1155token": 0, "erc20allowance": 0}
+
+	for address, events := range db.eventIndexDB {
+		keptEvents := []*types.Event{}
+		for _, event := range events {
+			if deleted(event.BlockNumber, event.TransactionHash) {
+				documents["event"]++
+			} else {
+				keptEvents = append(keptEvents, event)
+			}
+		}
+		if !dryRun {
+			db.eventIndexDB[address] = keptEvents
+		}
+	}
+	for _, storageIndexer := range db.storageIndexDB {
+		for number := range storageIndexer.root {
+			if deleted(number, "") {
+				documents["storage"]++
+				if !dryRun {
+					delete(storageIndexer.root, number)
+				}
+			}
+		}
+	}
+
+	erc20Balances := []ERC20TokenHolder{}
+	for _, entry := range db.erc20BalancesDB {
+		if deleted(entry.BlockNumber, "") {
+			documents["erc20token"]++
+		} else {
+			erc20Balances = append(erc20Balances, entry)
+		}
+	}
+	erc721Tokens := []types.ERC721Token{}
+	for _, token := range db.erc721BalancesDB {
+		if deleted(token.HeldFrom, "") {
+			documents["erc721token"]++
+		} else {
+			erc721Tokens = append(erc721Tokens, token)
+		}
+	}
+	erc1155Balances := []ERC1155TokenHolder{}
+	for _, entry := range db.erc1155BalancesDB {
+		if deleted(entry.BlockNumber, "") {
+			documents["erc1155token"]++
+		} else {
+			erc1155Balances = append(erc1155Balances, entry)
+		}
+	}
+	erc20Allowances := []ERC20AllowanceEntry{}
+	for _, entry := range db.erc20Allowances {
+		if deleted(entry.BlockNumber, "") {
+			documents["erc20allowance"]++
+		} else {
+			erc20Allowances = append(erc20Allowances, entry)
+		}
+	}
+	if !dryRun {
+		db.erc20BalancesDB = erc20Balances
+		db.erc721BalancesDB = erc721Tokens
+		db.erc1155BalancesDB = erc1155Balances
+		db.erc20Allowances = erc20Allowances
+	}
+
+	deletion := &types.BlockRangeDeletion{FromBlock: from, ToBlock: to, DryRun: dryRun, Documents: documents}
+	for _, count := range documents {
+		deletion.Total += count
+	}
+	return deletion, nil
+}
+
+func (db *MemoryDB) ApplyRetention(index string, beforeBlock uint64) (*types.RetentionDeletion, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	holds := types.LegalHolds(db.legalHoldDB)
+	// token entries are replaced by the next entry of the same holding, so
+	// those from before the last entry at or before the block are no longer
+	// needed
+	lastEntries := make(map[string]uint64)
+	recordEntry := func(key string, recorded uint64) {
+		if recorded <= beforeBlock && recorded > lastEntries[key] {
+			lastEntries[key] = recorded
+		}
+	}
+	replaced := func(key string, recorded uint64) bool {
+		return recorded < lastEntries[key] && !holds.Holds(recorded, "")
+	}
+	deletion := &types.RetentionDeletion{Index: index, BeforeBlock: beforeBlock}
+	switch index {
+	case "event":
+		for address, events := range db.eventIndexDB {
+			keptEvents := []*types.Event{}
+			for _, event := range events {
+				if event.BlockNumber < beforeBlock && !holds.Holds(event.BlockNumber, event.TransactionHash) {
+					deletion.Deleted++
+				} else {
+					keptEvents = append(keptEvents, event)
+				}
+			}
+			db.eventIndexDB[address] = keptEvents
+		}
+	case "storage":
+		for _, storageIndexer := range db.storageIndexDB {
+			// the storage at the block is from the last change before it
+			var kept uint64
+			for number := range storageIndexer.root {
+				if number < beforeBlock && number > kept {
+					kept = number
+				}
+			}
+			for number := range storageIndexer.root {
+				if number < kept && !holds.Holds(number, "") {
+					delete(storageIndexer.root, number)
+					deletion.Deleted++
+				}
+			}
+		}
+	case "erc20token":
+		key := func(entry ERC20TokenHolder) string {
+			return entry.Contract.String() + entry.Holder.String()
+		}
+		for _, entry := range db.erc20BalancesDB {
+			recordEntry(key(entry), entry.BlockNumber)
+		}
+		erc20Balances := []ERC20TokenHolder{}
+		for _, entry := range db.erc20BalancesDB {
+			if replaced(key(entry), entry.BlockNumber) {
+				deletion.Deleted++
+			} else {
+				erc20Balances = append(erc20Balances, entry)
+			}
+		}
+		db.erc20BalancesDB = erc20Balances
+	case "erc721token":
+		key := func(token types.ERC721Token) string {
+			return token.Contract.String() + token.Token
+		}
+		for _, token := range db.erc721BalancesDB {
+			recordEntry(key(token), token.HeldFrom)
+		}
+		erc721Tokens := []types.ERC721Token{}
+		for _, token := range db.erc721BalancesDB {
+			if replaced(key(token), token.HeldFrom) {
+				deletion.Deleted++
+			} else {
+				erc721Tokens = append(erc721Tokens, token)
+			}
+		}
+		db.erc721BalancesDB = erc721Tokens
+	case "erc1155token":
+		key := func(entry ERC1155TokenHolder) string {
+			return entry.Contract.String() + entry.Holder.String() + entry.TokenId
+		}
+		for _, entry := range db.erc1155BalancesDB {
+			recordEntry(key(entry), entry.BlockNumber)
+		}
+		erc1155Balances := []ERC1155TokenHolder{}
+		for _, entry := range db.erc1155BalancesDB {
+			if replaced(key(entry), entry.BlockNumber) {
+				deletion.Deleted++
+			} else {
+				erc1155Balances = append(erc1155Balances, entry)
+			}
+		}
+		db.erc1155BalancesDB = erc1155Balances
+	case "erc20allowance":
+		key := func(entry ERC20AllowanceEntry) string {
+			return entry.Contract.String() + entry.Owner.String() + entry.Spender.String()
+		}
+		for _, entry := range db.erc20Allowances {
+			recordEntry(key(entry), entry.BlockNumber)
+		}
+		erc20Allowances := []ERC20AllowanceEntry{}
+		for _, entry := range db.erc20Allowances {
+			if replaced(key(entry), entry.BlockNumber) {
+				deletion.Deleted++
+			} else {
+				erc20Allowances = append(erc20Allowances, entry)
+			}
+		}
+		db.erc20Allowances = erc20Allowances
+	default:
+		return nil, errors.New("index " + index + " can not have a retention policy")
+	}
+	return deletion, nil
+}
+
+func (db *MemoryDB) Stop(context.Context) error {
+	return nil
+}
+
+// internal functions
+
+func containsAddress(addresses []types.Address, address types.Address) bool {
+	for _, a := range addresses {
+		if address == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *MemoryDB) addressIsRegistered(address types.Address) bool {
+	for _, a := range db.addressDB {
+		if address == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *MemoryDB) indexBlock(addresses []types.Address, block *types.Block, txs map[types.Hash]*types.Transaction) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	// filter out registered and unfiltered address only
+	filteredAddresses := map[types.Address]bool{}
+	var raised []types.Address
+	for _, address := range addresses {
+		if db.addressIsRegistered(address) && db.lastFiltered[address] < block.Number {
+			raised = append(raised, address)
+			if db.indexedAhead[address][block.Number] {
+				delete(db.indexedAhead[address], block.Number)
+				continue
+			}
+			filteredAddresses[address] = true
+			log.Info("Index registered address ", "address", address.Hex(), "blocknumber", block.Number)
+		}
+	}
+
+	// index transactions and events
+	for _, txHash := range block.Transactions {
+		db.indexTransaction(filteredAddresses, txs[txHash])
+	}
+
+	for _, address := range raised {
+		db.lastFiltered[address] = block.Number
+	}
+	return nil
+}
+
+func (db *MemoryDB) indexTransaction(filteredAddresses map[types.Address]bool, tx *types.Transaction) {
+	if filteredAddresses[tx.To] {
+		db.txIndexDB[tx.To].txsTo = append(db.txIndexDB[tx.To].txsTo, tx.Hash)
+		log.Debug("Indexed tx recipient", "tx", tx.Hash.Hex(), "recipient", tx.To.Hex())
+	}
+
+	for _, internalCall := range tx.InternalCalls {
+		if filteredAddresses[internalCall.To] {
+			db.txIndexDB[internalCall.To].txsInternalTo = append(db.txIndexDB[internalCall.To].txsInternalTo, tx.Hash)
+			log.Debug("Indexed transactions internal calls", "tx", tx.Hash.Hex(), "internal-recipient", internalCall.To.Hex())
+		}
+	}
+	// Index events emitted by the given address
+	for _, event := range tx.Events {
+		addr := event.Address
+		if filteredAddresses[addr] {
+			db.eventIndexDB[addr] = append(db.eventIndexDB[addr], event)
+			if severity := db.classify(event); severity != "" {
+				db.eventSeverities[event] = severity
+			}
+			log.Debug("Indexed emitted event", "tx", event.TransactionHash.Hex(), "address", event.Address.Hex())
+		}
+	}
+}
+
+// classify returns the severity of the event by the rules of its contract,
+// which are ignored if they no longer fit the contract's ABI
+func (db *MemoryDB) classify(event *types.Event) string {
+	rules := db.severityRuleDB[event.Address]
+	abi := db.abiDB[db.templateDB[event.Address]]
+	if len(rules) == 0 || abi == "" {
+		return ""
+	}
+	structure, err := types.NewABIStructureFromJSON(abi)
+	if err != nil {
+		return ""
+	}
+	classifier, err := types.NewSeverityClassifier(rules, structure.ToInternalABI())
+	if err != nil {
+		log.Warn("Severity rules don't fit the contract ABI", "address", event.Address.Hex(), "err", err)
+		return ""
+	}
+	return classifier.Classify(event)
+}
+
+func removeHashes(hashes []types.Hash, removed map[types.Hash]bool) []types.Hash {
+	kept := []types.Hash{}
+	for _, hash := range hashes {
+		if !removed[hash] {
+			kept = append(kept, hash)
+		}
+	}
+	return kept
+}
+
+func addToIndexStats(stats *types.IndexStats, blockNumber uint64) {
+	if stats.DocumentCount == 0 || blockNumber < stats.OldestBlock {
+		stats.OldestBlock = blockNumber
+	}
+	if blockNumber > stats.NewestBlock {
+		stats.NewestBlock = blockNumber
+	}
+	stats.DocumentCount++
+}
+
+// removeAllIndices deletes the data of the address, other than the events
+// and storage under legal hold
+func (db *MemoryDB) removeAllIndices(address types.Address, holds types.LegalHolds) error {
+	delete(db.txIndexDB, address)
+	var heldEvents []*types.Event
+	for _, event := range db.eventIndexDB[address] {
+		if holds.Holds(event.BlockNumber, event.TransactionHash) {
+			heldEvents = append(heldEvents, event)
+		}
+	}
+	if len(heldEvents) > 0 {
+		db.eventIndexDB[address] = heldEvents
+	} else {
+		delete(db.eventIndexDB, address)
+	}
+	if storage, ok := db.storageIndexDB[address]; ok {
+		for blockNumber := range storage.root {
+			if !holds.Holds(blockNumber, "") {
+				delete(storage.root, blockNumber)
+			}
+		}
+		if len(storage.root) == 0 {
+			delete(db.storageIndexDB, address)
+		}
+	}
+	delete(db.enrichmentDB, address)
+	delete(db.severityRuleDB, address)
+	delete(db.terminalDB, address)
+	delete(db.destroyedDB, address)
+	delete(db.indexedAhead, address)
+	db.lastFiltered[address] = 0
+	return nil
+}
+
+func (db *MemoryDB) getERC20EntryAtBlock(contract types.Address, holder types.Address, block uint64) (*ERC20TokenHolder, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	var tmpItem *ERC20TokenHolder
+	found := false
+	for i, item := range db.erc20BalancesDB {
+		if item.BlockNumber <= block && item.Contract == contract && item.Holder == holder {
+			if !found {
+				tmpItem = &db.erc20BalancesDB[i]
+				found = true
+			} else {
+				if item.BlockNumber > tmpItem.BlockNumber {
+					tmpItem = &db.erc20BalancesDB[i]
+				}
+			}
+		}
+	}
+	if !found {
+		return nil, database.ErrNotFound
+	}
+	return tmpItem, nil
+}
+
+func (db *MemoryDB) RecordNewERC20Balance(contract types.Address, holder types.Address, block uint64, amount *big.Int) error {
+	existingTokenEntry, errExisting := db.getERC20EntryAtBlock(contract, holder, block-1)
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	if errExisting != nil && errExisting != database.ErrNotFound {
+		return errExisting
+	}
+	for _, entry := range db.erc20BalancesDB {
+		if entry.Contract == contract && entry.Holder == holder && entry.BlockNumber == block {
+			// already recorded, when the block is indexed again
+			return nil
+		}
+	}
 
 	//add new entry
 	tokenInfo := ERC20TokenHolder{
@@ -701,9 +2035,10 @@ func (db *MemoryDB) GetERC20Balance(contract types.Address, holder types.Address
 func (db *MemoryDB) GetAllTokenHolders(contract types.Address, block uint64, options *types.TokenQueryOptions) ([]types.Address, error) {
 	db.mux.RLock()
 	defer db.mux.RUnlock()
+	after := types.NewAddress(options.After)
 	var holderMap = make(map[types.Address]bool)
 	for _, k := range db.erc20BalancesDB {
-		if k.Contract == contract && k.BlockNumber <= block && k.Holder != "0000000000000000000000000000000000000000" {
+		if k.Contract == contract && k.BlockNumber <= block && k.Holder != "0000000000000000000000000000000000000000" && (options.After == "" || k.Holder > after) {
 			holderMap[k.Holder] = true
 		}
 	}
@@ -711,37 +2046,178 @@ func (db *MemoryDB) GetAllTokenHolders(contract types.Address, block uint64, opt
 	for holdr := range holderMap {
 		holderArr = append(holderArr, holdr)
 	}
+	// ordered by address, a page at a time like the Elasticsearch aggregation
+	sort.Slice(holderArr, func(i, j int) bool { return holderArr[i] < holderArr[j] })
+	if options.PageSize > 0 && len(holderArr) > options.PageSize {
+		holderArr = holderArr[:options.PageSize]
+	}
 	return holderArr, nil
 }
 
-func (db *MemoryDB) RecordERC721Token(contract types.Address, holder types.Address, block uint64, tokenId *big.Int) error {
-	//find old entry
-	existingTokenEntry, errExisting := db.ERC721TokenByTokenID(contract, block-1, tokenId)
-	db.mux.Lock()
-	defer db.mux.Unlock()
-	if errExisting != nil && errExisting != database.ErrNotFound {
-		return errExisting
+func (db *MemoryDB) GetERC20TokenHolders(contract types.Address, block uint64, options *types.QueryOptions) ([]*types.ERC20Holding, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	// the latest entry for each holder at the block is their balance
+	latest := make(map[types.Address]ERC20TokenHolder)
+	for _, k := range db.erc20BalancesDB {
+		if k.Contract == contract && k.BlockNumber <= block {
+			if existing, ok := latest[k.Holder]; !ok || k.BlockNumber > existing.BlockNumber {
+				latest[k.Holder] = k
+			}
+		}
 	}
 
-	//add new entry
-	tokenHolderInfo :=
-		types.ERC721Token{
-			Contract:  contract,
-			Holder:    holder,
-			Token:     tokenId.String(),
-			HeldFrom:  block,
-			HeldUntil: nil,
+	holdings := make([]*types.ERC20Holding, 0, len(latest))
+	for holder, entry := range latest {
+		if holder.IsEmpty() || entry.Amount == "0" {
+			continue
 		}
-	db.erc721BalancesDB = append(db.erc721BalancesDB, tokenHolderInfo)
-	/////
-	if errExisting == database.ErrNotFound {
-		return nil
+		balance, success := new(big.Int).SetString(entry.Amount, 10)
+		if !success {
+			return nil, errors.New("could not parse token value")
+		}
+		holdings = append(holdings, &types.ERC20Holding{Holder: holder, Balance: balance})
 	}
+	sort.Slice(holdings, func(i, j int) bool {
+		return holdings[i].Holder < holdings[j].Holder
+	})
 
-	blk := block - 1
-	existingTokenEntry.HeldUntil = &blk
-	return nil
-}
+	from := options.PageSize * options.PageNumber
+	if from >= len(holdings) {
+		return []*types.ERC20Holding{}, nil
+	}
+	to := from + options.PageSize
+	if to > len(holdings) {
+		to = len(holdings)
+	}
+	return holdings[from:to], nil
+}
+
+func (db *MemoryDB) RecordERC20Allowance(contract types.Address, owner types.Address, spender types.Address, block uint64, amount *big.Int) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	for _, entry := range db.erc20Allowances {
+		if entry.Contract == contract && entry.Owner == owner && entry.Spender == spender && entry.BlockNumber == block {
+			// already recorded, when the block is indexed again
+			return nil
+		}
+	}
+	db.erc20Allowances = append(db.erc20Allowances, ERC20AllowanceEntry{
+		Contract:    contract,
+		Owner:       owner,
+		Spender:     spender,
+		BlockNumber: block,
+		Amount:      amount.String(),
+	})
+	return nil
+}
+
+func (db *MemoryDB) GetERC20Allowance(contract types.Address, owner types.Address, spender types.Address, options *types.TokenQueryOptions) (map[uint64]*big.Int, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	frmBlkNum := options.BeginBlockNumber.Uint64()
+	endBlkNum := options.EndBlockNumber.Int64()
+	allowanceMap := make(map[uint64]*big.Int)
+	// the allowance at the start of the range is from the last approval
+	// before it, unless there is one at the start
+	var before *ERC20AllowanceEntry
+	for i, entry := range db.erc20Allowances {
+		if entry.Contract != contract || entry.Owner != owner || entry.Spender != spender {
+			continue
+		}
+		if entry.BlockNumber >= frmBlkNum && (endBlkNum == -1 || entry.BlockNumber <= uint64(endBlkNum)) {
+			amount, success := new(big.Int).SetString(entry.Amount, 10)
+			if !success {
+				return nil, errors.New("could not parse token value")
+			}
+			allowanceMap[entry.BlockNumber] = amount
+		} else if entry.BlockNumber < frmBlkNum && (before == nil || entry.BlockNumber > before.BlockNumber) {
+			before = &db.erc20Allowances[i]
+		}
+	}
+	if _, ok := allowanceMap[frmBlkNum]; !ok && before != nil {
+		amount, success := new(big.Int).SetString(before.Amount, 10)
+		if !success {
+			return nil, errors.New("could not parse token value")
+		}
+		allowanceMap[frmBlkNum] = amount
+	}
+	return allowanceMap, nil
+}
+
+func (db *MemoryDB) GetERC20Allowances(contract types.Address, owner types.Address, block uint64, options *types.QueryOptions) ([]*types.ERC20Allowance, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	// the latest approval of each spender at the block is their allowance
+	latest := make(map[types.Address]ERC20AllowanceEntry)
+	for _, entry := range db.erc20Allowances {
+		if entry.Contract == contract && entry.Owner == owner && entry.BlockNumber <= block {
+			if existing, ok := latest[entry.Spender]; !ok || entry.BlockNumber > existing.BlockNumber {
+				latest[entry.Spender] = entry
+			}
+		}
+	}
+
+	allowances := make([]*types.ERC20Allowance, 0, len(latest))
+	for spender, entry := range latest {
+		if entry.Amount == "0" {
+			continue
+		}
+		amount, success := new(big.Int).SetString(entry.Amount, 10)
+		if !success {
+			return nil, errors.New("could not parse token value")
+		}
+		allowances = append(allowances, &types.ERC20Allowance{Owner: owner, Spender: spender, Amount: amount, BlockNumber: entry.BlockNumber})
+	}
+	sort.Slice(allowances, func(i, j int) bool {
+		return allowances[i].Spender < allowances[j].Spender
+	})
+
+	from := options.PageSize * options.PageNumber
+	if from >= len(allowances) {
+		return []*types.ERC20Allowance{}, nil
+	}
+	to := from + options.PageSize
+	if to > len(allowances) {
+		to = len(allowances)
+	}
+	return allowances[from:to], nil
+}
+
+func (db *MemoryDB) RecordERC721Token(contract types.Address, holder types.Address, block uint64, tokenId *big.Int) error {
+	//find old entry
+	existingTokenEntry, errExisting := db.ERC721TokenByTokenID(contract, block-1, tokenId)
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	if errExisting != nil && errExisting != database.ErrNotFound {
+		return errExisting
+	}
+	for _, entry := range db.erc721BalancesDB {
+		if entry.Contract == contract && entry.Token == tokenId.String() && entry.HeldFrom == block {
+			// already recorded, when the block is indexed again
+			return nil
+		}
+	}
+
+	// the previous holder's entry is ended before adding the new one, which
+	// may move the entries it points into
+	if errExisting != database.ErrNotFound {
+		blk := block - 1
+		existingTokenEntry.HeldUntil = &blk
+	}
+
+	//add new entry
+	tokenHolderInfo :=
+		types.ERC721Token{
+			Contract:  contract,
+			Holder:    holder,
+			Token:     tokenId.String(),
+			HeldFrom:  block,
+			HeldUntil: nil,
+		}
+	db.erc721BalancesDB = append(db.erc721BalancesDB, tokenHolderInfo)
+	return nil
+}
 
 func (db *MemoryDB) ERC721TokenByTokenID(contract types.Address, block uint64, tokenId *big.Int) (*types.ERC721Token, error) {
 	db.mux.RLock()
@@ -767,6 +2243,35 @@ func (db *MemoryDB) ERC721TokenByTokenID(contract types.Address, block uint64, t
 	return &db.erc721BalancesDB[tmpItem], nil
 }
 
+func (db *MemoryDB) ERC721TokenHistory(contract types.Address, tokenId *big.Int, options *types.TokenQueryOptions) ([]types.ERC721Token, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	history := []types.ERC721Token{}
+	for _, item := range db.erc721BalancesDB {
+		if item.Contract != contract || item.Token != tokenId.String() {
+			continue
+		}
+		if options.EndBlockNumber.Int64() != -1 && item.HeldFrom > options.EndBlockNumber.Uint64() {
+			continue
+		}
+		if item.HeldUntil != nil && *item.HeldUntil < options.BeginBlockNumber.Uint64() {
+			continue
+		}
+		history = append(history, item)
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].HeldFrom < history[j].HeldFrom })
+
+	from := options.PageSize * options.PageNumber
+	if from > len(history) {
+		from = len(history)
+	}
+	to := from + options.PageSize
+	if to > len(history) {
+		to = len(history)
+	}
+	return history[from:to], nil
+}
+
 func (db *MemoryDB) ERC721TokensForAccountAtBlock(contract types.Address, holder types.Address, block uint64, options *types.TokenQueryOptions) ([]types.ERC721Token, error) {
 	return db.erc721TokensAtBlock(contract, &holder, block, options)
 }
@@ -833,3 +2338,521 @@ func (db *MemoryDB) AllHoldersAtBlock(contract types.Address, block uint64, opti
 	}
 	return holders, nil
 }
+
+// getERC1155EntryAtBlock returns the index of the latest balance entry of the
+// holder's token at or before the block, which stays valid until the entries
+// are next changed, or -1 if there is none. The lock must be held.
+func (db *MemoryDB) getERC1155EntryAtBlock(contract types.Address, holder types.Address, tokenId *big.Int, block uint64) int {
+	found := -1
+	for i, item := range db.erc1155BalancesDB {
+		if item.BlockNumber <= block && item.Contract == contract && item.Holder == holder && item.TokenId == tokenId.String() {
+			if found == -1 || item.BlockNumber > db.erc1155BalancesDB[found].BlockNumber {
+				found = i
+			}
+		}
+	}
+	return found
+}
+
+func (db *MemoryDB) RecordNewERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, block uint64, amount *big.Int) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	// an index rather than a pointer, as appending may move the entries
+	existing := db.getERC1155EntryAtBlock(contract, holder, tokenId, block-1)
+	for _, entry := range db.erc1155BalancesDB {
+		if entry.Contract == contract && entry.Holder == holder && entry.TokenId == tokenId.String() && entry.BlockNumber == block {
+			// already recorded, when the block is indexed again
+			return nil
+		}
+	}
+
+	//add new entry
+	tokenInfo := ERC1155TokenHolder{
+		Contract:    contract,
+		Holder:      holder,
+		TokenId:     tokenId.String(),
+		BlockNumber: block,
+		Amount:      amount.String(),
+	}
+	db.erc1155BalancesDB = append(db.erc1155BalancesDB, tokenInfo)
+	/////
+	if existing == -1 {
+		return nil
+	}
+	blk := block - 1
+	db.erc1155BalancesDB[existing].HeldUntil = &blk
+
+	return nil
+}
+
+func (db *MemoryDB) GetERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, options *types.TokenQueryOptions) (map[uint64]*big.Int, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	balanceMap := make(map[uint64]*big.Int)
+	frmBlkNum := options.BeginBlockNumber.Uint64()
+	endBlkNum := options.EndBlockNumber.Int64()
+	var maxEntry *ERC1155TokenHolder
+	for i, b := range db.erc1155BalancesDB {
+		if contract != b.Contract || holder != b.Holder || tokenId.String() != b.TokenId {
+			continue
+		}
+		if b.BlockNumber >= frmBlkNum && (b.BlockNumber <= uint64(endBlkNum) || endBlkNum == -1) {
+			tokAmt, success := new(big.Int).SetString(b.Amount, 10)
+			if !success {
+				return nil, errors.New("could not parse token value")
+			}
+			balanceMap[b.BlockNumber] = tokAmt
+		}
+		if b.BlockNumber < frmBlkNum && (maxEntry == nil || maxEntry.BlockNumber < b.BlockNumber) {
+			maxEntry = &db.erc1155BalancesDB[i]
+		}
+	}
+
+	if _, ok := balanceMap[frmBlkNum]; !ok && maxEntry != nil {
+		tokAmt, success := new(big.Int).SetString(maxEntry.Amount, 10)
+		if !success {
+			return nil, errors.New("could not parse token value")
+		}
+		balanceMap[frmBlkNum] = tokAmt
+	}
+
+	return balanceMap, nil
+}
+
+func (db *MemoryDB) GetAllERC1155TokenHolders(contract types.Address, tokenId *big.Int, block uint64, options *types.TokenQueryOptions) ([]types.Address, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	var holderMap = make(map[types.Address]bool)
+	for _, k := range db.erc1155BalancesDB {
+		heldAtBlock := k.BlockNumber <= block && (k.HeldUntil == nil || *k.HeldUntil >= block)
+		if k.Contract == contract && k.TokenId == tokenId.String() && heldAtBlock && k.Holder != "0000000000000000000000000000000000000000" {
+			holderMap[k.Holder] = true
+		}
+	}
+	holderArr := make([]types.Address, 0, len(holderMap))
+	for holdr := range holderMap {
+		holderArr = append(holderArr, holdr)
+	}
+	return holderArr, nil
+}
+
+// JobDB
+
+func (db *MemoryDB) GetJobs() ([]*types.Job, error) {
+	return db.jobs.All(), nil
+}
+
+func (db *MemoryDB) GetJob(id string) (*types.Job, error) {
+	return db.jobs.Get(id)
+}
+
+func (db *MemoryDB) RetryJob(id string) error {
+	// deletions in memory can't fail part way, so there is never anything to retry
+	_, err := db.jobs.Restart(id)
+	return err
+}
+
+// WebhookDB
+
+func (db *MemoryDB) AddWebhook(webhook *types.Webhook) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	stored := *webhook
+	for i, existing := range db.webhookDB {
+		if existing.ID == webhook.ID {
+			db.webhookDB[i] = &stored
+			return nil
+		}
+	}
+	db.webhookDB = append(db.webhookDB, &stored)
+	return nil
+}
+
+func (db *MemoryDB) DeleteWebhook(id string) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	for i, webhook := range db.webhookDB {
+		if webhook.ID == id {
+			db.webhookDB = append(db.webhookDB[:i], db.webhookDB[i+1:]...)
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+func (db *MemoryDB) GetWebhooks() ([]*types.Webhook, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	webhooks := make([]*types.Webhook, len(db.webhookDB))
+	for i, webhook := range db.webhookDB {
+		copied := *webhook
+		webhooks[i] = &copied
+	}
+	return webhooks, nil
+}
+
+// ArchiveDB
+
+func (db *MemoryDB) SetArchiveReader(reader func(types.Hash) (*types.Transaction, error)) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	db.archiveReader = reader
+}
+
+func (db *MemoryDB) ArchiveBlocks(batch *types.ArchivedBatch) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	stored := *batch
+	db.archivedBatches = append(db.archivedBatches, &stored)
+	for number := batch.StartBlock; number <= batch.EndBlock; number++ {
+		delete(db.blockDB, number)
+		delete(db.blockChecksums, number)
+	}
+	for _, hash := range batch.Transactions {
+		delete(db.txDB, hash)
+		delete(db.txChecksums, hash)
+	}
+	return nil
+}
+
+func (db *MemoryDB) GetArchivedBatch(blockNumber uint64) (*types.ArchivedBatch, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	for _, batch := range db.archivedBatches {
+		if blockNumber >= batch.StartBlock && blockNumber <= batch.EndBlock {
+			copied := *batch
+			return &copied, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func (db *MemoryDB) GetArchivedBatchForTransaction(hash types.Hash) (*types.ArchivedBatch, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	for _, batch := range db.archivedBatches {
+		for _, archived := range batch.Transactions {
+			if archived == hash {
+				copied := *batch
+				return &copied, nil
+			}
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func (db *MemoryDB) GetLastArchivedBatch() (*types.ArchivedBatch, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	if len(db.archivedBatches) == 0 {
+		return nil, database.ErrNotFound
+	}
+	copied := *db.archivedBatches[len(db.archivedBatches)-1]
+	return &copied, nil
+}
+
+// LegalHoldDB
+
+func (db *MemoryDB) AddLegalHold(hold *types.LegalHold) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	stored := *hold
+	for i, existing := range db.legalHoldDB {
+		if existing.ID == hold.ID {
+			db.legalHoldDB[i] = &stored
+			return nil
+		}
+	}
+	db.legalHoldDB = append(db.legalHoldDB, &stored)
+	return nil
+}
+
+func (db *MemoryDB) DeleteLegalHold(id string) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	for i, hold := range db.legalHoldDB {
+		if hold.ID == id {
+			db.legalHoldDB = append(db.legalHoldDB[:i], db.legalHoldDB[i+1:]...)
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+func (db *MemoryDB) GetLegalHolds() ([]*types.LegalHold, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	holds := make([]*types.LegalHold, len(db.legalHoldDB))
+	for i, hold := range db.legalHoldDB {
+		copied := *hold
+		holds[i] = &copied
+	}
+	return holds, nil
+}
+
+// TokenRuleDB
+
+func (db *MemoryDB) AddTokenRule(rule *types.TokenRule) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	stored := *rule
+	for i, existing := range db.tokenRuleDB {
+		if existing.ID == rule.ID {
+			db.tokenRuleDB[i] = &stored
+			return nil
+		}
+	}
+	db.tokenRuleDB = append(db.tokenRuleDB, &stored)
+	return nil
+}
+
+func (db *MemoryDB) DeleteTokenRule(id string) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	for i, rule := range db.tokenRuleDB {
+		if rule.ID == id {
+			db.tokenRuleDB = append(db.tokenRuleDB[:i], db.tokenRuleDB[i+1:]...)
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+func (db *MemoryDB) GetTokenRules() ([]*types.TokenRule, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	rules := make([]*types.TokenRule, len(db.tokenRuleDB))
+	for i, rule := range db.tokenRuleDB {
+		copied := *rule
+		rules[i] = &copied
+	}
+	return rules, nil
+}
+
+// CheckpointDB
+
+func (db *MemoryDB) SetCheckpoint(service string, checkpoint string) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	db.checkpointDB[service] = checkpoint
+	return nil
+}
+
+func (db *MemoryDB) GetCheckpoint(service string) (string, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	checkpoint, ok := db.checkpointDB[service]
+	if !ok {
+		return "", database.ErrNotFound
+	}
+	return checkpoint, nil
+}
+
+// LeaseDB
+
+func (db *MemoryDB) AcquireLease(name string, holder string, duration time.Duration) (*types.Lease, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	now := time.Now()
+	lease, ok := db.leaseDB[name]
+	if ok && lease.Holder != holder && !lease.Expired(now) {
+		copied := *lease
+		return &copied, nil
+	}
+	acquired := &types.Lease{Name: name, Holder: holder, AcquiredAt: types.UnixMillis(now), ExpiresAt: types.UnixMillis(now.Add(duration))}
+	if ok && lease.Holder == holder {
+		acquired.AcquiredAt = lease.AcquiredAt
+	}
+	db.leaseDB[name] = acquired
+	copied := *acquired
+	return &copied, nil
+}
+
+func (db *MemoryDB) GetLease(name string) (*types.Lease, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	lease, ok := db.leaseDB[name]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	copied := *lease
+	return &copied, nil
+}
+
+func (db *MemoryDB) GetLeases(prefix string) ([]*types.Lease, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	leases := make([]*types.Lease, 0)
+	for name, lease := range db.leaseDB {
+		if strings.HasPrefix(name, prefix) {
+			copied := *lease
+			leases = append(leases, &copied)
+		}
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].Name < leases[j].Name })
+	return leases, nil
+}
+
+func (db *MemoryDB) ReleaseLease(name string, holder string) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	if lease, ok := db.leaseDB[name]; ok && lease.Holder == holder {
+		delete(db.leaseDB, name)
+	}
+	return nil
+}
+
+func (db *MemoryDB) ExportTransactionsToAddress(address types.Address, options *types.QueryOptions, fn func(*types.Transaction) error) error {
+	db.mux.RLock()
+	if !db.addressIsRegistered(address) {
+		db.mux.RUnlock()
+		return errors.New("address is not registered")
+	}
+	// the transactions are copied out so fn can read the database
+	var txs []*types.Transaction
+	for _, hash := range db.txIndexDB[address].txsTo {
+		if tx, ok := db.txDB[hash]; ok && inExportRange(options, tx.BlockNumber, tx.Timestamp) {
+			txs = append(txs, tx)
+		}
+	}
+	db.mux.RUnlock()
+
+	sort.SliceStable(txs, func(i, j int) bool {
+		if txs[i].BlockNumber != txs[j].BlockNumber {
+			return txs[i].BlockNumber < txs[j].BlockNumber
+		}
+		return txs[i].Index < txs[j].Index
+	})
+	for _, tx := range txs {
+		if err := fn(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *MemoryDB) ExportEventsFromAddress(address types.Address, options *types.QueryOptions, fn func(*types.Event) error) error {
+	db.mux.RLock()
+	if !db.addressIsRegistered(address) {
+		db.mux.RUnlock()
+		return errors.New("address is not registered")
+	}
+	var events []*types.Event
+	for _, event := range db.eventIndexDB[address] {
+		if inExportRange(options, event.BlockNumber, event.Timestamp) {
+			events = append(events, event)
+		}
+	}
+	db.mux.RUnlock()
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].BlockNumber != events[j].BlockNumber {
+			return events[i].BlockNumber < events[j].BlockNumber
+		}
+		return events[i].Index < events[j].Index
+	})
+	for _, event := range events {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportStoredDocuments passes the blocks and transactions in the range to fn,
+// block by block. Events are only stored as part of their transactions, so
+// are covered by the transactions' checksums.
+func (db *MemoryDB) ExportStoredDocuments(start uint64, end uint64, fn func(*types.StoredDocument) error) error {
+	// the documents are copied out so fn can read the database
+	db.mux.RLock()
+	var blocks []*types.Block
+	for number, block := range db.blockDB {
+		if number >= start && number <= end {
+			blocks = append(blocks, block)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Number < blocks[j].Number })
+	var documents []*types.StoredDocument
+	for _, block := range blocks {
+		number := block.Number
+		documents = append(documents, &types.StoredDocument{
+			Kind:        types.BlockDocument,
+			ID:          strconv.FormatUint(number, 10),
+			BlockNumber: number,
+			Content:     block,
+			Checksum:    db.blockChecksums[number],
+		})
+		for _, hash := range block.Transactions {
+			if tx, ok := db.txDB[hash]; ok {
+				documents = append(documents, &types.StoredDocument{
+					Kind:        types.TransactionDocument,
+					ID:          hash.String(),
+					BlockNumber: number,
+					Content:     tx,
+					Checksum:    db.txChecksums[hash],
+				})
+			}
+		}
+	}
+	db.mux.RUnlock()
+
+	for _, document := range documents {
+		if err := fn(document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inExportRange checks whether data recorded in the block at the time is
+// within the block and time range of the options, where a negative end is
+// unbounded
+func inExportRange(options *types.QueryOptions, blockNumber uint64, timestamp uint64) bool {
+	within := func(value uint64, begin *big.Int, end *big.Int) bool {
+		v := new(big.Int).SetUint64(value)
+		return (begin == nil || v.Cmp(begin) >= 0) && (end == nil || end.Sign() < 0 || v.Cmp(end) <= 0)
+	}
+	return within(blockNumber, options.BeginBlockNumber, options.EndBlockNumber) &&
+		within(timestamp, options.BeginTimestamp, options.EndTimestamp)
+}
+
+func (db *MemoryDB) Search(query *types.SearchQuery, limit int) ([]*types.SearchResult, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+	var results []*types.SearchResult
+	switch {
+	case query.BlockNumber != nil:
+		if block, ok := db.blockDB[*query.BlockNumber]; ok {
+			results = append(results, types.NewBlockSearchResult(block.Number, block.Hash))
+		}
+	case query.Hash != nil:
+		for _, block := range db.blockDB {
+			if block.Hash == *query.Hash {
+				results = append(results, types.NewBlockSearchResult(block.Number, block.Hash))
+			}
+		}
+		if tx, ok := db.txDB[*query.Hash]; ok {
+			results = append(results, types.NewTransactionSearchResult(tx.BlockNumber, tx.Hash))
+		}
+		var events []*types.Event
+		for _, address := range db.addressDB {
+			for _, event := range db.eventIndexDB[address] {
+				if event.TransactionHash == *query.Hash {
+					events = append(events, event)
+				}
+			}
+		}
+		sort.Slice(events, func(i, j int) bool { return events[i].Index < events[j].Index })
+		for _, event := range events {
+			results = append(results, types.NewEventSearchResult(*event))
+		}
+	case query.Address != nil:
+		if db.addressIsRegistered(*query.Address) {
+			results = append(results, types.NewContractSearchResult(*query.Address, db.txIndexDB[*query.Address].contractCreationTx))
+		}
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
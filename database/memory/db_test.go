@@ -1,8 +1,10 @@
 package memory
 
 import (
+	"errors"
 	"math/big"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -80,6 +82,66 @@ func TestMemoryDB_WriteTransactions(t *testing.T) {
 	assert.Equal(t, tx3, retrievedTx3, "unexpected tx from db: %s", retrievedTx3)
 }
 
+func TestMemoryDB_GetTransactionsInBlockRange(t *testing.T) {
+	db := NewMemoryDB()
+	txs := []*types.Transaction{
+		{Hash: types.NewHash("0x01"), BlockNumber: 3, Index: 1},
+		{Hash: types.NewHash("0x02"), BlockNumber: 1, Index: 0},
+		{Hash: types.NewHash("0x03"), BlockNumber: 3, Index: 0},
+		{Hash: types.NewHash("0x04"), BlockNumber: 2, Index: 0},
+		{Hash: types.NewHash("0x05"), BlockNumber: 5, Index: 0},
+	}
+	assert.Nil(t, db.WriteTransactions(txs))
+
+	// in block and transaction order
+	page, err := db.GetTransactionsInBlockRange(2, 4, &types.PageOptions{PageSize: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Transaction{txs[3], txs[2]}, page)
+	page, err = db.GetTransactionsInBlockRange(2, 4, &types.PageOptions{PageSize: 2, PageNumber: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Transaction{txs[0]}, page)
+	page, err = db.GetTransactionsInBlockRange(2, 4, &types.PageOptions{PageSize: 2, PageNumber: 2})
+	assert.Nil(t, err)
+	assert.Empty(t, page)
+
+	total, err := db.GetTransactionsInBlockRangeTotal(2, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), total)
+	total, err = db.GetTransactionsInBlockRangeTotal(6, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), total)
+}
+
+func TestMemoryDB_GetBlocksByTimeRange(t *testing.T) {
+	db := NewMemoryDB()
+	blocks := []*types.Block{
+		{Hash: types.NewHash("0x01"), Number: 1, Timestamp: 100},
+		{Hash: types.NewHash("0x02"), Number: 2, Timestamp: 105},
+		{Hash: types.NewHash("0x03"), Number: 3, Timestamp: 110},
+		{Hash: types.NewHash("0x04"), Number: 4, Timestamp: 115},
+		{Hash: types.NewHash("0x05"), Number: 5, Timestamp: 120},
+	}
+	assert.Nil(t, db.WriteBlocks(blocks))
+
+	// oldest first, with both ends of the range included
+	page, err := db.GetBlocksByTimeRange(105, 115, &types.PageOptions{PageSize: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Block{blocks[1], blocks[2]}, page)
+	page, err = db.GetBlocksByTimeRange(105, 115, &types.PageOptions{PageSize: 2, PageNumber: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Block{blocks[3]}, page)
+	page, err = db.GetBlocksByTimeRange(105, 115, &types.PageOptions{PageSize: 2, PageNumber: 2})
+	assert.Nil(t, err)
+	assert.Empty(t, page)
+
+	total, err := db.GetBlocksByTimeRangeTotal(101, 119)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), total)
+	total, err = db.GetBlocksByTimeRangeTotal(200, 300)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), total)
+}
+
 func TestMemoryDB_WriteBlocks(t *testing.T) {
 	db := NewMemoryDB()
 
@@ -153,7 +215,7 @@ func testAddAddresses(t *testing.T, db database.Database, addresses []types.Addr
 }
 
 func testDeleteAddress(t *testing.T, db database.Database, address types.Address, expectedErr bool) {
-	err := db.DeleteAddress(address)
+	err := db.DeleteAddress(address, true)
 	if err != nil && !expectedErr {
 		t.Fatalf("expected no error, but got %v", err)
 	}
@@ -429,6 +491,54 @@ func TestMemoryDB_ContractCreationTransactions_DeletedAddress(t *testing.T) {
 	assert.EqualValues(t, "", actualTxHash)
 }
 
+func TestMemoryDB_DeleteAddress_WithoutPurge(t *testing.T) {
+	db := NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{addr}))
+	db.eventIndexDB[addr] = []*types.Event{{Address: addr}}
+
+	assert.Nil(t, db.DeleteAddress(addr, false))
+
+	addresses, _ := db.GetAddresses()
+	assert.Empty(t, addresses)
+	assert.Len(t, db.eventIndexDB[addr], 1)
+	jobs, _ := db.GetJobs()
+	assert.Empty(t, jobs)
+}
+
+func TestMemoryDB_DeleteAddress_LegalHolds(t *testing.T) {
+	db := NewMemoryDB()
+	held := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	assert.Nil(t, db.AddAddresses([]types.Address{addr, held}))
+	heldTx := types.NewHash("0x01")
+	from, to := uint64(5), uint64(10)
+	assert.Nil(t, db.AddLegalHold(&types.LegalHold{ID: "1", Address: &held, Reason: "litigation"}))
+	assert.Nil(t, db.AddLegalHold(&types.LegalHold{ID: "2", TransactionHash: &heldTx, Reason: "litigation"}))
+	assert.Nil(t, db.AddLegalHold(&types.LegalHold{ID: "3", FromBlock: &from, ToBlock: &to, Reason: "audit"}))
+
+	db.eventIndexDB[addr] = []*types.Event{
+		{Address: addr, BlockNumber: 1, TransactionHash: types.NewHash("0x02")},
+		{Address: addr, BlockNumber: 2, TransactionHash: heldTx},
+		{Address: addr, BlockNumber: 7, TransactionHash: types.NewHash("0x03")},
+	}
+	for _, block := range []uint64{1, 6, 12} {
+		assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{addr: {Root: types.NewHash("0x01")}}, block))
+	}
+	db.eventIndexDB[held] = []*types.Event{{Address: held, BlockNumber: 1}}
+
+	assert.Nil(t, db.DeleteAddress(addr, true))
+	assert.Nil(t, db.DeleteAddress(held, true))
+
+	assert.Len(t, db.eventIndexDB[addr], 2)
+	assert.Equal(t, uint64(2), db.eventIndexDB[addr][0].BlockNumber)
+	assert.Equal(t, uint64(7), db.eventIndexDB[addr][1].BlockNumber)
+	assert.Len(t, db.storageIndexDB[addr].root, 1)
+	assert.Contains(t, db.storageIndexDB[addr].root, uint64(6))
+	// the held contract is unregistered, but its data is kept
+	assert.Len(t, db.eventIndexDB[held], 1)
+	addresses, _ := db.GetAddresses()
+	assert.Empty(t, addresses)
+}
+
 func TestMemoryDB_GetStorageRanges(t *testing.T) {
 	db := NewMemoryDB()
 	contract := types.NewAddress("0x8a5e2a6343108babed07899510fb42297938d41f")
@@ -483,6 +593,36 @@ func TestMemoryDB_GetStorageRanges(t *testing.T) {
 	}
 }
 
+func TestMemoryDB_GetStorageValues(t *testing.T) {
+	db := NewMemoryDB()
+	contract := types.NewAddress("0x8a5e2a6343108babed07899510fb42297938d41f")
+	db.AddAddressFrom(contract, 0)
+
+	paused := func(value string) []*types.StorageValue {
+		return []*types.StorageValue{{Variable: "paused", Value: value}}
+	}
+	raw := map[types.Hash]string{types.NewHash("0x00"): "01"}
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{contract: {Root: types.NewHash("0x01"), Decoded: paused("false")}}, 5))
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{contract: {Root: types.NewHash("0x02"), Decoded: paused("true")}}, 10))
+	assert.Nil(t, db.IndexStorage(map[types.Address]*types.AccountState{contract: {Root: types.NewHash("0x03"), Storage: raw}}, 15))
+
+	// the last change before the range is included
+	values, err := db.GetStorageValues(contract, &types.PageOptions{BeginBlockNumber: big.NewInt(7), EndBlockNumber: big.NewInt(-1)})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.StorageValues{
+		{BlockNumber: 5, Values: paused("false")},
+		{BlockNumber: 10, Values: paused("true")},
+		{BlockNumber: 15, Storage: raw},
+	}, values)
+
+	values, err = db.GetStorageValues(contract, &types.PageOptions{BeginBlockNumber: big.NewInt(10), EndBlockNumber: big.NewInt(12)})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.StorageValues{{BlockNumber: 10, Values: paused("true")}}, values)
+
+	_, err = db.GetStorageValues(types.NewAddress("0x01"), &types.PageOptions{BeginBlockNumber: big.NewInt(0), EndBlockNumber: big.NewInt(-1)})
+	assert.EqualError(t, err, "address is not registered")
+}
+
 func TestMemorydb_erc20Balance(t *testing.T) {
 	db := NewMemoryDB()
 	contrAddr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
@@ -598,6 +738,99 @@ func TestMemorydb_erc20Balance(t *testing.T) {
 
 }
 
+func TestMemoryDB_GetERC20TokenHolders(t *testing.T) {
+	db := NewMemoryDB()
+	contrAddr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	holder0 := types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d")
+	holder1 := types.NewAddress("0xca843569e3427144cead5e4d5999a3d0ccf92b8e")
+	holder2 := types.NewAddress("0xca843569e3427144cead5e4d5999a3d0ccf92bac")
+
+	assert.Nil(t, db.RecordNewERC20Balance(contrAddr, holder0, 1, big.NewInt(1000)))
+	assert.Nil(t, db.RecordNewERC20Balance(contrAddr, holder1, 2, big.NewInt(100)))
+	assert.Nil(t, db.RecordNewERC20Balance(contrAddr, holder2, 2, big.NewInt(50)))
+	assert.Nil(t, db.RecordNewERC20Balance(contrAddr, holder1, 3, big.NewInt(0)))
+
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	holdings, err := db.GetERC20TokenHolders(contrAddr, 2, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.ERC20Holding{
+		{Holder: holder1, Balance: big.NewInt(100)},
+		{Holder: holder2, Balance: big.NewInt(50)},
+		{Holder: holder0, Balance: big.NewInt(1000)},
+	}, holdings)
+
+	// holder1 has sold all their tokens
+	holdings, err = db.GetERC20TokenHolders(contrAddr, 3, options)
+	assert.Nil(t, err)
+	assert.Len(t, holdings, 2)
+
+	holdings, err = db.GetERC20TokenHolders(contrAddr, 3, &types.QueryOptions{PageSize: 1, PageNumber: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.ERC20Holding{{Holder: holder0, Balance: big.NewInt(1000)}}, holdings)
+
+	holdings, err = db.GetERC20TokenHolders(contrAddr, 3, &types.QueryOptions{PageSize: 1, PageNumber: 2})
+	assert.Nil(t, err)
+	assert.Len(t, holdings, 0)
+}
+
+func TestMemoryDB_ERC20Allowances(t *testing.T) {
+	db := NewMemoryDB()
+	contrAddr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	owner := types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d")
+	spender0 := types.NewAddress("0xca843569e3427144cead5e4d5999a3d0ccf92b8e")
+	spender1 := types.NewAddress("0xca843569e3427144cead5e4d5999a3d0ccf92bac")
+
+	assert.Nil(t, db.RecordERC20Allowance(contrAddr, owner, spender0, 1, big.NewInt(1000)))
+	assert.Nil(t, db.RecordERC20Allowance(contrAddr, owner, spender1, 2, big.NewInt(50)))
+	assert.Nil(t, db.RecordERC20Allowance(contrAddr, owner, spender0, 4, big.NewInt(0)))
+	// recording the same approval again changes nothing
+	assert.Nil(t, db.RecordERC20Allowance(contrAddr, owner, spender0, 4, big.NewInt(0)))
+
+	history, err := db.GetERC20Allowance(contrAddr, owner, spender0, &types.TokenQueryOptions{BeginBlockNumber: big.NewInt(2), EndBlockNumber: big.NewInt(-1)})
+	assert.Nil(t, err)
+	assert.Equal(t, map[uint64]*big.Int{2: big.NewInt(1000), 4: big.NewInt(0)}, history)
+
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	allowances, err := db.GetERC20Allowances(contrAddr, owner, 3, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.ERC20Allowance{
+		{Owner: owner, Spender: spender0, Amount: big.NewInt(1000), BlockNumber: 1},
+		{Owner: owner, Spender: spender1, Amount: big.NewInt(50), BlockNumber: 2},
+	}, allowances)
+
+	// the allowance of spender0 has been revoked
+	allowances, err = db.GetERC20Allowances(contrAddr, owner, 4, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.ERC20Allowance{{Owner: owner, Spender: spender1, Amount: big.NewInt(50), BlockNumber: 2}}, allowances)
+
+	allowances, err = db.GetERC20Allowances(contrAddr, spender0, 4, options)
+	assert.Nil(t, err)
+	assert.Empty(t, allowances)
+
+	assert.Nil(t, db.RollbackToBlock(3))
+	allowances, err = db.GetERC20Allowances(contrAddr, owner, 4, options)
+	assert.Nil(t, err)
+	assert.Len(t, allowances, 2)
+}
+
+func TestMemoryDB_RecordTokensTwice(t *testing.T) {
+	db := NewMemoryDB()
+	contrAddr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	holder := types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d")
+
+	// blocks filtered again record the same balances and tokens
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, db.RecordNewERC20Balance(contrAddr, holder, 1, big.NewInt(1000)))
+		assert.Nil(t, db.RecordERC721Token(contrAddr, holder, 1, big.NewInt(7)))
+		assert.Nil(t, db.RecordNewERC1155Balance(contrAddr, holder, big.NewInt(7), 1, big.NewInt(10)))
+	}
+	assert.Len(t, db.erc20BalancesDB, 1)
+	assert.Len(t, db.erc721BalancesDB, 1)
+	assert.Len(t, db.erc1155BalancesDB, 1)
+}
+
 func TestMemorydb_erc721Balance(t *testing.T) {
 	db := NewMemoryDB()
 	contrAddr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
@@ -673,3 +906,772 @@ func TestMemorydb_erc721Balance(t *testing.T) {
 	assert.Equal(t, holder1Found, true)
 
 }
+
+func TestMemoryDB_ERC721TokenHistory(t *testing.T) {
+	db := NewMemoryDB()
+	contract := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	holder0 := types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d")
+	holder1 := types.NewAddress("0xca843569e3427144cead5e4d5999a3d0ccf92b8e")
+	assert.Nil(t, db.RecordERC721Token(contract, holder0, 1, big.NewInt(1)))
+	assert.Nil(t, db.RecordERC721Token(contract, holder1, 1, big.NewInt(2)))
+	assert.Nil(t, db.RecordERC721Token(contract, holder1, 5, big.NewInt(1)))
+	assert.Nil(t, db.RecordERC721Token(contract, holder0, 9, big.NewInt(1)))
+
+	options := &types.TokenQueryOptions{}
+	options.SetDefaults()
+	history, err := db.ERC721TokenHistory(contract, big.NewInt(1), options)
+	assert.Nil(t, err)
+	assert.Len(t, history, 3)
+	assert.Equal(t, holder0, history[0].Holder)
+	assert.EqualValues(t, 1, history[0].HeldFrom)
+	assert.EqualValues(t, 4, *history[0].HeldUntil)
+	assert.Equal(t, holder1, history[1].Holder)
+	assert.EqualValues(t, 5, history[1].HeldFrom)
+	assert.EqualValues(t, 8, *history[1].HeldUntil)
+	assert.Equal(t, holder0, history[2].Holder)
+	assert.Nil(t, history[2].HeldUntil)
+
+	// only the holders in the block range
+	options = &types.TokenQueryOptions{BeginBlockNumber: big.NewInt(5), EndBlockNumber: big.NewInt(8)}
+	options.SetDefaults()
+	history, err = db.ERC721TokenHistory(contract, big.NewInt(1), options)
+	assert.Nil(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, holder1, history[0].Holder)
+
+	options = &types.TokenQueryOptions{PageSize: 2, PageNumber: 1}
+	options.SetDefaults()
+	history, err = db.ERC721TokenHistory(contract, big.NewInt(1), options)
+	assert.Nil(t, err)
+	assert.Len(t, history, 1)
+	assert.EqualValues(t, 9, history[0].HeldFrom)
+}
+
+func TestMemorydb_erc1155Balance(t *testing.T) {
+	db := NewMemoryDB()
+	contrAddr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	holder0 := types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d")
+	holder1 := types.NewAddress("0xca843569e3427144cead5e4d5999a3d0ccf92b8e")
+	tokenId := big.NewInt(7)
+
+	assert.Nil(t, db.RecordNewERC1155Balance(contrAddr, holder0, tokenId, 1, big.NewInt(1000)))
+	assert.Nil(t, db.RecordNewERC1155Balance(contrAddr, holder0, tokenId, 3, big.NewInt(900)))
+	assert.Nil(t, db.RecordNewERC1155Balance(contrAddr, holder1, tokenId, 3, big.NewInt(100)))
+	assert.Nil(t, db.RecordNewERC1155Balance(contrAddr, holder1, big.NewInt(8), 4, big.NewInt(5)))
+	assert.Nil(t, db.RecordNewERC1155Balance(contrAddr, holder1, tokenId, 5, big.NewInt(0)))
+
+	options := &types.TokenQueryOptions{BeginBlockNumber: big.NewInt(2), EndBlockNumber: big.NewInt(-1)}
+	options.SetDefaults()
+	balances, err := db.GetERC1155Balance(contrAddr, holder0, tokenId, options)
+	assert.Nil(t, err)
+	assert.Equal(t, map[uint64]*big.Int{2: big.NewInt(1000), 3: big.NewInt(900)}, balances)
+
+	options = &types.TokenQueryOptions{BeginBlockNumber: big.NewInt(4), EndBlockNumber: big.NewInt(4)}
+	options.SetDefaults()
+	balances, err = db.GetERC1155Balance(contrAddr, holder1, tokenId, options)
+	assert.Nil(t, err)
+	assert.Equal(t, map[uint64]*big.Int{4: big.NewInt(100)}, balances)
+
+	holders, err := db.GetAllERC1155TokenHolders(contrAddr, tokenId, 2, &types.TokenQueryOptions{})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []types.Address{holder0}, holders)
+
+	holders, err = db.GetAllERC1155TokenHolders(contrAddr, tokenId, 4, &types.TokenQueryOptions{})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []types.Address{holder0, holder1}, holders)
+}
+
+func TestMemorydb_erc1155BalanceHeldUntil(t *testing.T) {
+	db := NewMemoryDB()
+	contrAddr := types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	holder := types.NewAddress("0xed9d02e382b34818e88b88a309c7fe71e65f419d")
+
+	// the entries are moved as they grow, and each previous balance must
+	// still be closed off
+	for block := uint64(1); block <= 20; block++ {
+		assert.Nil(t, db.RecordNewERC1155Balance(contrAddr, holder, big.NewInt(7), block, big.NewInt(int64(block))))
+	}
+	for i, entry := range db.erc1155BalancesDB[:19] {
+		if assert.NotNil(t, entry.HeldUntil, "entry %d", i) {
+			assert.EqualValues(t, entry.BlockNumber, *entry.HeldUntil)
+		}
+	}
+	assert.Nil(t, db.erc1155BalancesDB[19].HeldUntil)
+}
+
+func TestMemoryDB_GetIndexStats(t *testing.T) {
+	db := NewMemoryDB()
+	tx4 := &types.Transaction{
+		Hash:        types.NewHash("0x5c83fa5955aff33c61813105851777bcd2adc85deb9af6286ba42c05cd768de0"),
+		BlockNumber: 5,
+	}
+
+	testAddAddresses(t, db, []types.Address{addr}, false)
+	testWriteTransactions(t, db, tx1, tx2, tx3, tx4)
+	testIndexBlock(t, db, addr, block)
+	testIndexStorage(t, db, 2, map[types.Address]*types.AccountState{addr: {}})
+	err := db.RecordNewERC20Balance(addr, uselessAddress, 3, big.NewInt(100))
+	assert.Nil(t, err)
+
+	stats, err := db.GetIndexStats()
+	assert.Nil(t, err)
+	assert.Equal(t, []types.IndexStats{
+		{Name: "transaction", DocumentCount: 4, OldestBlock: 1, NewestBlock: 5},
+		{Name: "event", DocumentCount: 1},
+		{Name: "storage", DocumentCount: 1, OldestBlock: 2, NewestBlock: 2},
+		{Name: "erc20token", DocumentCount: 1, OldestBlock: 3, NewestBlock: 3},
+		{Name: "erc721token"},
+		{Name: "erc1155token"},
+	}, stats)
+}
+
+func TestMemoryDB_RollbackToBlock(t *testing.T) {
+	db := NewMemoryDB()
+	tx4 := &types.Transaction{
+		Hash:        types.NewHash("0x5c83fa5955aff33c61813105851777bcd2adc85deb9af6286ba42c05cd768de0"),
+		BlockNumber: 2,
+		To:          addr,
+	}
+	block2 := &types.Block{Hash: types.NewHash("dummy2"), Number: 2, Transactions: []types.Hash{tx4.Hash}}
+
+	testAddAddresses(t, db, []types.Address{addr}, false)
+	testWriteTransactions(t, db, tx1, tx2, tx3, tx4)
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block, block2}))
+	testIndexBlock(t, db, addr, block)
+	testIndexBlock(t, db, addr, block2)
+	testIndexStorage(t, db, 2, map[types.Address]*types.AccountState{addr: {}})
+	assert.Nil(t, db.RecordNewERC20Balance(addr, uselessAddress, 1, big.NewInt(100)))
+	assert.Nil(t, db.RecordNewERC20Balance(addr, uselessAddress, 2, big.NewInt(50)))
+
+	err := db.RollbackToBlock(1)
+	assert.Nil(t, err)
+
+	lastPersisted, _ := db.GetLastPersistedBlockNumber()
+	assert.EqualValues(t, 1, lastPersisted)
+	lastFiltered, _ := db.GetLastFiltered(addr)
+	assert.EqualValues(t, 1, lastFiltered)
+	_, err = db.ReadBlock(2)
+	assert.EqualError(t, err, "block does not exist")
+	_, err = db.ReadTransaction(tx4.Hash)
+	assert.EqualError(t, err, "transaction does not exist")
+
+	txs, err := db.GetAllTransactionsToAddress(addr, &types.QueryOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Hash{tx3.Hash}, txs)
+	storage, err := db.GetStorage(addr, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, types.NewHash(""), storage.StorageRoot)
+
+	balances, err := db.GetERC20Balance(addr, uselessAddress, &types.TokenQueryOptions{BeginBlockNumber: big.NewInt(0), EndBlockNumber: big.NewInt(10)})
+	assert.Nil(t, err)
+	assert.Equal(t, map[uint64]*big.Int{1: big.NewInt(100)}, balances)
+}
+
+func TestMemoryDB_DeleteBlockRange(t *testing.T) {
+	db := NewMemoryDB()
+	testAddAddresses(t, db, []types.Address{addr}, false)
+	heldTx := types.NewHash("0x01")
+	assert.Nil(t, db.AddLegalHold(&types.LegalHold{ID: "1", TransactionHash: &heldTx, Reason: "litigation"}))
+	db.eventIndexDB[addr] = []*types.Event{
+		{Address: addr, BlockNumber: 1, TransactionHash: types.NewHash("0x02")},
+		{Address: addr, BlockNumber: 2, TransactionHash: types.NewHash("0x03")},
+		{Address: addr, BlockNumber: 3, TransactionHash: heldTx},
+		{Address: addr, BlockNumber: 5, TransactionHash: types.NewHash("0x04")},
+	}
+	for _, block := range []uint64{1, 3, 5} {
+		testIndexStorage(t, db, block, map[types.Address]*types.AccountState{addr: {}})
+	}
+	assert.Nil(t, db.RecordNewERC20Balance(addr, uselessAddress, 1, big.NewInt(100)))
+	assert.Nil(t, db.RecordNewERC20Balance(addr, uselessAddress, 3, big.NewInt(50)))
+	testWriteTransactions(t, db, tx1)
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+
+	expected := &types.BlockRangeDeletion{
+		FromBlock: 2,
+		ToBlock:   4,
+		DryRun:    true,
+		Documents: map[string]uint64{"event": 1, "storage": 1, "erc20token": 1, "erc721token": 0, "erc1155token": 0, "erc20allowance": 0},
+		Total:     3,
+	}
+	deletion, err := db.DeleteBlockRange(2, 4, true)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, deletion)
+	assert.Len(t, db.eventIndexDB[addr], 4)
+
+	expected.DryRun = false
+	deletion, err = db.DeleteBlockRange(2, 4, false)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, deletion)
+
+	// the held event and the data outside the range are kept
+	var eventBlocks []uint64
+	for _, event := range db.eventIndexDB[addr] {
+		eventBlocks = append(eventBlocks, event.BlockNumber)
+	}
+	assert.Equal(t, []uint64{1, 3, 5}, eventBlocks)
+	assert.Len(t, db.storageIndexDB[addr].root, 2)
+	assert.NotContains(t, db.storageIndexDB[addr].root, uint64(3))
+	assert.Len(t, db.erc20BalancesDB, 1)
+	// blocks and transactions are kept
+	_, err = db.ReadBlock(block.Number)
+	assert.Nil(t, err)
+	_, err = db.ReadTransaction(tx1.Hash)
+	assert.Nil(t, err)
+}
+
+func TestMemoryDB_ApplyRetention(t *testing.T) {
+	db := NewMemoryDB()
+	testAddAddresses(t, db, []types.Address{addr}, false)
+	heldTx := types.NewHash("0x01")
+	assert.Nil(t, db.AddLegalHold(&types.LegalHold{ID: "1", TransactionHash: &heldTx, Reason: "litigation"}))
+	db.eventIndexDB[addr] = []*types.Event{
+		{Address: addr, BlockNumber: 1, TransactionHash: types.NewHash("0x02")},
+		{Address: addr, BlockNumber: 2, TransactionHash: heldTx},
+		{Address: addr, BlockNumber: 4, TransactionHash: types.NewHash("0x03")},
+	}
+	for _, block := range []uint64{1, 2, 3, 5} {
+		testIndexStorage(t, db, block, map[types.Address]*types.AccountState{addr: {}})
+	}
+	assert.Nil(t, db.RecordNewERC20Balance(addr, uselessAddress, 1, big.NewInt(100)))
+	assert.Nil(t, db.RecordNewERC20Balance(addr, uselessAddress, 3, big.NewInt(50)))
+	assert.Nil(t, db.RecordNewERC20Balance(addr, uselessAddress, 6, big.NewInt(20)))
+
+	deletion, err := db.ApplyRetention("event", 4)
+	assert.Nil(t, err)
+	assert.Equal(t, &types.RetentionDeletion{Index: "event", BeforeBlock: 4, Deleted: 1}, deletion)
+	assert.Len(t, db.eventIndexDB[addr], 2)
+
+	// the storage at block 4 is from block 3
+	deletion, err = db.ApplyRetention("storage", 4)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, deletion.Deleted)
+	assert.Len(t, db.storageIndexDB[addr].root, 2)
+	assert.Contains(t, db.storageIndexDB[addr].root, uint64(3))
+
+	// the balance from block 3 is still held at block 4
+	deletion, err = db.ApplyRetention("erc20token", 4)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, deletion.Deleted)
+	assert.Len(t, db.erc20BalancesDB, 2)
+
+	_, err = db.ApplyRetention("block", 4)
+	assert.EqualError(t, err, "index block can not have a retention policy")
+}
+
+func TestMemoryDB_HasActivity(t *testing.T) {
+	db := NewMemoryDB()
+	idleTx := &types.Transaction{Hash: types.NewHash("0x02"), BlockNumber: 2, To: uselessAddress}
+	eventTx := &types.Transaction{
+		Hash:        types.NewHash("0x03"),
+		BlockNumber: 3,
+		To:          uselessAddress,
+		Events:      []*types.Event{{Address: addr, BlockNumber: 3}},
+	}
+	toTx := &types.Transaction{Hash: types.NewHash("0x04"), BlockNumber: 4, To: addr}
+	blocks := []*types.Block{
+		{Hash: types.NewHash("dummy1"), Number: 1, Transactions: []types.Hash{tx2.Hash}},
+		{Hash: types.NewHash("dummy2"), Number: 2, Transactions: []types.Hash{idleTx.Hash}},
+		{Hash: types.NewHash("dummy3"), Number: 3, Transactions: []types.Hash{eventTx.Hash}},
+		{Hash: types.NewHash("dummy4"), Number: 4, Transactions: []types.Hash{toTx.Hash}},
+	}
+
+	testAddAddresses(t, db, []types.Address{addr}, false)
+	testWriteTransactions(t, db, tx2, idleTx, eventTx, toTx)
+	assert.Nil(t, db.WriteBlocks(blocks))
+	assert.Nil(t, db.IndexBlocks([]types.Address{addr}, blocks))
+
+	cases := []struct {
+		from, to uint64
+		expected bool
+	}{
+		{1, 1, true}, // internal call
+		{2, 2, false},
+		{3, 3, true}, // event
+		{4, 4, true}, // transaction
+		{2, 4, true},
+		{5, 10, false},
+	}
+	for _, tc := range cases {
+		active, err := db.HasActivity(addr, tc.from, tc.to)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expected, active, "blocks %d to %d", tc.from, tc.to)
+	}
+
+	_, err := db.HasActivity(uselessAddress, 1, 4)
+	assert.EqualError(t, err, "address is not registered")
+}
+
+func TestMemoryDB_GetCounterparties(t *testing.T) {
+	db := NewMemoryDB()
+	sender := types.NewAddress("0x0000000000000000000000000000000000000009")
+	caller := types.NewAddress("0x0000000000000000000000000000000000000010")
+	txs := []*types.Transaction{
+		{Hash: types.NewHash("0x01"), BlockNumber: 1, Timestamp: 100, From: sender, To: addr},
+		// sent to the contract and calling it back counts once
+		{Hash: types.NewHash("0x02"), BlockNumber: 2, Timestamp: 200, From: sender, To: addr, InternalCalls: []*types.InternalCall{{From: addr, To: addr}}},
+		{Hash: types.NewHash("0x03"), BlockNumber: 3, Timestamp: 300, From: sender, To: uselessAddress, InternalCalls: []*types.InternalCall{{From: caller, To: addr}}},
+		{Hash: types.NewHash("0x04"), BlockNumber: 4, Timestamp: 400, From: caller, To: uselessAddress},
+	}
+	var blocks []*types.Block
+	for _, tx := range txs {
+		blocks = append(blocks, &types.Block{Hash: types.NewHash(tx.Hash.Hex()), Number: tx.BlockNumber, Transactions: []types.Hash{tx.Hash}})
+	}
+
+	testAddAddresses(t, db, []types.Address{addr}, false)
+	testWriteTransactions(t, db, txs...)
+	assert.Nil(t, db.WriteBlocks(blocks))
+	assert.Nil(t, db.IndexBlocks([]types.Address{addr}, blocks))
+
+	senderCounterparty := &types.Counterparty{Address: sender, FirstSeenBlock: 1, FirstSeenTimestamp: 100, LastSeenBlock: 2, LastSeenTimestamp: 200, Interactions: 2}
+	callerCounterparty := &types.Counterparty{Address: caller, FirstSeenBlock: 3, FirstSeenTimestamp: 300, LastSeenBlock: 3, LastSeenTimestamp: 300, Interactions: 1}
+
+	counterparties, err := db.GetCounterparties(addr, &types.CounterpartyQueryOptions{SortBy: types.SortByRecency, PageSize: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Counterparty{callerCounterparty, senderCounterparty}, counterparties)
+
+	counterparties, err = db.GetCounterparties(addr, &types.CounterpartyQueryOptions{SortBy: types.SortByVolume, PageSize: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Counterparty{senderCounterparty}, counterparties)
+
+	counterparties, err = db.GetCounterparties(addr, &types.CounterpartyQueryOptions{SortBy: types.SortByVolume, PageSize: 1, PageNumber: 2})
+	assert.Nil(t, err)
+	assert.Empty(t, counterparties)
+
+	// rolled back interactions are no longer counted
+	assert.Nil(t, db.RollbackToBlock(1))
+	counterparties, err = db.GetCounterparties(addr, &types.CounterpartyQueryOptions{SortBy: types.SortByRecency, PageSize: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Counterparty{{Address: sender, FirstSeenBlock: 1, FirstSeenTimestamp: 100, LastSeenBlock: 1, LastSeenTimestamp: 100, Interactions: 1}}, counterparties)
+
+	_, err = db.GetCounterparties(uselessAddress, &types.CounterpartyQueryOptions{SortBy: types.SortByRecency, PageSize: 10})
+	assert.EqualError(t, err, "address is not registered")
+}
+
+func TestMemoryDB_GetEventsByTopics(t *testing.T) {
+	db := NewMemoryDB()
+	other := types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	assert.Nil(t, db.AddAddresses([]types.Address{addr, other}))
+	transfer, approval := types.NewHash("0x01"), types.NewHash("0x02")
+	alice, bob := types.NewHash("0x0a"), types.NewHash("0x0b")
+	db.eventIndexDB[addr] = []*types.Event{
+		{Address: addr, BlockNumber: 1, Index: 0, Topics: []types.Hash{transfer, alice, bob}},
+		{Address: addr, BlockNumber: 2, Index: 1, Topics: []types.Hash{approval, alice, bob}},
+		{Address: addr, BlockNumber: 3, Index: 0, Topics: []types.Hash{transfer, bob, alice}},
+	}
+	db.eventIndexDB[other] = []*types.Event{
+		{Address: other, BlockNumber: 3, Index: 1, Topics: []types.Hash{transfer, alice, bob}},
+		{Address: other, BlockNumber: 4, Index: 0, Topics: []types.Hash{transfer}},
+	}
+	// events of contracts no longer registered aren't found
+	db.eventIndexDB[uselessAddress] = []*types.Event{{Address: uselessAddress, BlockNumber: 5, Topics: []types.Hash{transfer}}}
+
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	blocks := func(events []*types.Event) []uint64 {
+		numbers := make([]uint64, len(events))
+		for i, event := range events {
+			numbers[i] = event.BlockNumber
+		}
+		return numbers
+	}
+
+	// all contracts, newest first
+	query := &types.EventTopicQuery{Topics: []*types.Hash{&transfer}}
+	events, err := db.GetEventsByTopics(query, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{4, 3, 3, 1}, blocks(events))
+	assert.Equal(t, addr, events[1].Address)
+	total, err := db.GetEventsByTopicsTotal(query, options)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), total)
+
+	// topics are matched by position, skipping the null ones
+	query = &types.EventTopicQuery{Topics: []*types.Hash{&transfer, nil, &bob}}
+	events, err = db.GetEventsByTopics(query, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{3, 1}, blocks(events))
+	assert.Equal(t, other, events[0].Address)
+
+	query = &types.EventTopicQuery{Address: &addr, Topics: []*types.Hash{&transfer}}
+	events, err = db.GetEventsByTopics(query, &types.QueryOptions{BeginBlockNumber: big.NewInt(2), EndBlockNumber: big.NewInt(-1), BeginTimestamp: big.NewInt(0), EndTimestamp: big.NewInt(-1), PageSize: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{3}, blocks(events))
+
+	query = &types.EventTopicQuery{Topics: []*types.Hash{&transfer}}
+	events, err = db.GetEventsByTopics(query, &types.QueryOptions{BeginBlockNumber: big.NewInt(0), EndBlockNumber: big.NewInt(-1), BeginTimestamp: big.NewInt(0), EndTimestamp: big.NewInt(-1), PageSize: 3, PageNumber: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1}, blocks(events))
+
+	// a cursor starts the page after its position
+	events, err = db.GetEventsByTopics(query, &types.QueryOptions{BeginBlockNumber: big.NewInt(0), EndBlockNumber: big.NewInt(-1), BeginTimestamp: big.NewInt(0), EndTimestamp: big.NewInt(-1), PageSize: 3, Cursor: types.NewCursor(3, 0)})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{3, 1}, blocks(events))
+	assert.Equal(t, other, events[0].Address)
+
+	// restricted to some of the registered contracts
+	query = &types.EventTopicQuery{Topics: []*types.Hash{&transfer}, Contracts: []types.Address{other, uselessAddress}}
+	events, err = db.GetEventsByTopics(query, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{4, 3}, blocks(events))
+	total, err = db.GetEventsByTopicsTotal(query, options)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), total)
+	events, err = db.GetEventsByTopics(&types.EventTopicQuery{Topics: []*types.Hash{&transfer}, Contracts: []types.Address{}}, options)
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+
+	_, err = db.GetEventsByTopics(&types.EventTopicQuery{Address: &uselessAddress, Topics: []*types.Hash{&transfer}}, options)
+	assert.EqualError(t, err, "address is not registered")
+}
+
+func TestMemoryDB_LegalHolds(t *testing.T) {
+	db := NewMemoryDB()
+	first := &types.LegalHold{ID: "1", Address: &addr, Reason: "litigation"}
+	second := &types.LegalHold{ID: "2", TransactionHash: &tx1.Hash, Reason: "audit"}
+
+	assert.Nil(t, db.AddLegalHold(first))
+	assert.Nil(t, db.AddLegalHold(second))
+	holds, err := db.GetLegalHolds()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.LegalHold{first, second}, holds)
+
+	assert.Nil(t, db.DeleteLegalHold("1"))
+	assert.Equal(t, database.ErrNotFound, db.DeleteLegalHold("1"))
+	holds, _ = db.GetLegalHolds()
+	assert.Equal(t, []*types.LegalHold{second}, holds)
+}
+
+func TestMemoryDB_TokenRules(t *testing.T) {
+	db := NewMemoryDB()
+	first := &types.TokenRule{ID: "1", Scope: types.ExternalScope, TemplateName: "ERC20", EIP165: "36372b07"}
+	second := &types.TokenRule{ID: "2", Scope: types.AllScope, TemplateName: "ERC721", Deployer: addr}
+
+	assert.Nil(t, db.AddTokenRule(first))
+	assert.Nil(t, db.AddTokenRule(second))
+	rules, err := db.GetTokenRules()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.TokenRule{first, second}, rules)
+
+	assert.Nil(t, db.DeleteTokenRule("1"))
+	assert.Equal(t, database.ErrNotFound, db.DeleteTokenRule("1"))
+	rules, _ = db.GetTokenRules()
+	assert.Equal(t, []*types.TokenRule{second}, rules)
+}
+
+func TestMemoryDB_Checkpoints(t *testing.T) {
+	db := NewMemoryDB()
+	_, err := db.GetCheckpoint("configsync")
+	assert.Equal(t, database.ErrNotFound, err)
+
+	assert.Nil(t, db.SetCheckpoint("configsync", "first"))
+	assert.Nil(t, db.SetCheckpoint("configsync", "second"))
+	checkpoint, err := db.GetCheckpoint("configsync")
+	assert.Nil(t, err)
+	assert.Equal(t, "second", checkpoint)
+}
+
+func TestMemoryDB_Leases(t *testing.T) {
+	db := NewMemoryDB()
+	_, err := db.GetLease(types.LeaderLease)
+	assert.Equal(t, database.ErrNotFound, err)
+
+	lease, err := db.AcquireLease(types.LeaderLease, "reporting-1", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, "reporting-1", lease.Holder)
+
+	// held until it expires or is released
+	lease, _ = db.AcquireLease(types.LeaderLease, "reporting-2", time.Minute)
+	assert.Equal(t, "reporting-1", lease.Holder)
+	assert.Nil(t, db.ReleaseLease(types.LeaderLease, "reporting-2"))
+	assert.Nil(t, db.ReleaseLease(types.LeaderLease, "reporting-1"))
+	lease, _ = db.AcquireLease(types.LeaderLease, "reporting-2", -time.Second)
+	assert.Equal(t, "reporting-2", lease.Holder)
+	lease, _ = db.AcquireLease(types.LeaderLease, "reporting-1", time.Minute)
+	assert.Equal(t, "reporting-1", lease.Holder)
+}
+
+func TestMemoryDB_Webhooks(t *testing.T) {
+	db := NewMemoryDB()
+	first := &types.Webhook{ID: "1", URL: "https://example.com/first", Address: &addr}
+	second := &types.Webhook{ID: "2", URL: "https://example.com/second", EventSignature: "Transfer(address,address,uint256)"}
+
+	assert.Nil(t, db.AddWebhook(first))
+	assert.Nil(t, db.AddWebhook(second))
+	webhooks, err := db.GetWebhooks()
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Webhook{first, second}, webhooks)
+
+	// replaces the webhook with the same ID
+	replaced := &types.Webhook{ID: "1", URL: "https://example.com/replaced"}
+	assert.Nil(t, db.AddWebhook(replaced))
+	webhooks, _ = db.GetWebhooks()
+	assert.Equal(t, []*types.Webhook{replaced, second}, webhooks)
+
+	assert.Nil(t, db.DeleteWebhook("1"))
+	assert.Equal(t, database.ErrNotFound, db.DeleteWebhook("1"))
+	webhooks, _ = db.GetWebhooks()
+	assert.Equal(t, []*types.Webhook{second}, webhooks)
+}
+
+func TestMemoryDB_Search(t *testing.T) {
+	db := NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{addr}))
+	assert.Nil(t, db.SetContractCreationTransaction(map[types.Hash][]types.Address{tx1.Hash: {addr}}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	db.eventIndexDB[addr] = []*types.Event{
+		{Address: addr, BlockNumber: 1, TransactionHash: tx3.Hash, Index: 5},
+		{Address: addr, BlockNumber: 1, TransactionHash: tx3.Hash, Index: 2},
+		{Address: addr, BlockNumber: 1, TransactionHash: tx2.Hash, Index: 1},
+	}
+
+	number := uint64(1)
+	results, err := db.Search(&types.SearchQuery{BlockNumber: &number}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.SearchResult{types.NewBlockSearchResult(1, block.Hash)}, results)
+
+	results, err = db.Search(&types.SearchQuery{Hash: &block.Hash}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.SearchResult{types.NewBlockSearchResult(1, block.Hash)}, results)
+
+	// the transaction comes before its events, in log order
+	results, err = db.Search(&types.SearchQuery{Hash: &tx3.Hash}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.SearchResult{
+		types.NewTransactionSearchResult(1, tx3.Hash),
+		types.NewEventSearchResult(types.Event{Address: addr, BlockNumber: 1, TransactionHash: tx3.Hash, Index: 2}),
+		types.NewEventSearchResult(types.Event{Address: addr, BlockNumber: 1, TransactionHash: tx3.Hash, Index: 5}),
+	}, results)
+	results, err = db.Search(&types.SearchQuery{Hash: &tx3.Hash}, 2)
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+
+	results, err = db.Search(&types.SearchQuery{Address: &addr}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.SearchResult{types.NewContractSearchResult(addr, tx1.Hash)}, results)
+
+	// only registered contracts are found
+	results, err = db.Search(&types.SearchQuery{Address: &uselessAddress}, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, results)
+}
+
+func TestMemoryDB_ExportEventsFromAddress(t *testing.T) {
+	db := NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{addr}))
+	db.eventIndexDB[addr] = []*types.Event{
+		{Address: addr, BlockNumber: 3, Index: 0},
+		{Address: addr, BlockNumber: 1, Index: 5},
+		{Address: addr, BlockNumber: 1, Index: 2},
+		{Address: addr, BlockNumber: 2, Index: 1},
+	}
+
+	// all events, oldest first
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	var exported []*types.Event
+	err := db.ExportEventsFromAddress(addr, options, func(event *types.Event) error {
+		exported = append(exported, event)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Event{
+		{Address: addr, BlockNumber: 1, Index: 2},
+		{Address: addr, BlockNumber: 1, Index: 5},
+		{Address: addr, BlockNumber: 2, Index: 1},
+		{Address: addr, BlockNumber: 3, Index: 0},
+	}, exported)
+
+	// the block range is applied, and the export stops at the first error
+	options = &types.QueryOptions{BeginBlockNumber: big.NewInt(2), EndBlockNumber: big.NewInt(3)}
+	options.SetDefaults()
+	exported = nil
+	err = db.ExportEventsFromAddress(addr, options, func(event *types.Event) error {
+		exported = append(exported, event)
+		return errors.New("stopped")
+	})
+	assert.EqualError(t, err, "stopped")
+	assert.Equal(t, []*types.Event{{Address: addr, BlockNumber: 2, Index: 1}}, exported)
+
+	err = db.ExportEventsFromAddress(uselessAddress, options, func(*types.Event) error { return nil })
+	assert.EqualError(t, err, "address is not registered")
+}
+
+func TestMemoryDB_ExportStoredDocuments(t *testing.T) {
+	db := NewMemoryDB()
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	block2 := &types.Block{Number: 2}
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block2, block}))
+
+	var documents []*types.StoredDocument
+	err := db.ExportStoredDocuments(0, 1, func(document *types.StoredDocument) error {
+		documents = append(documents, document)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Len(t, documents, 4)
+	assert.Equal(t, types.BlockDocument, documents[0].Kind)
+	assert.Equal(t, "1", documents[0].ID)
+	assert.Equal(t, block, documents[0].Content)
+	for i, tx := range []*types.Transaction{tx1, tx2, tx3} {
+		checksum, _ := types.Checksum(tx)
+		assert.Equal(t, &types.StoredDocument{
+			Kind:        types.TransactionDocument,
+			ID:          tx.Hash.String(),
+			BlockNumber: 1,
+			Content:     tx,
+			Checksum:    checksum,
+		}, documents[i+1])
+	}
+
+	// blocks are passed in order, and the export stops at the first error
+	documents = nil
+	err = db.ExportStoredDocuments(0, 10, func(document *types.StoredDocument) error {
+		documents = append(documents, document)
+		if document.Kind == types.BlockDocument && document.BlockNumber == 2 {
+			return errors.New("stopped")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "stopped")
+	assert.Len(t, documents, 5)
+}
+
+func TestMemoryDB_ArchiveBlocks(t *testing.T) {
+	db := NewMemoryDB()
+	_, err := db.GetLastArchivedBatch()
+	assert.Equal(t, database.ErrNotFound, err)
+
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	block2 := &types.Block{Number: 2}
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block, block2}))
+
+	batch := &types.ArchivedBatch{Key: "blocks-1-1.json.gz", StartBlock: 1, EndBlock: 1, Transactions: block.Transactions}
+	assert.Nil(t, db.ArchiveBlocks(batch))
+
+	_, err = db.ReadBlock(1)
+	assert.EqualError(t, err, "block does not exist")
+	_, err = db.ReadTransaction(tx2.Hash)
+	assert.EqualError(t, err, "transaction does not exist")
+	_, err = db.ReadBlock(2)
+	assert.Nil(t, err)
+
+	archived, err := db.GetArchivedBatch(1)
+	assert.Nil(t, err)
+	assert.Equal(t, batch, archived)
+	archived, err = db.GetArchivedBatchForTransaction(tx2.Hash)
+	assert.Nil(t, err)
+	assert.Equal(t, batch, archived)
+	archived, err = db.GetLastArchivedBatch()
+	assert.Nil(t, err)
+	assert.Equal(t, batch, archived)
+
+	_, err = db.GetArchivedBatch(2)
+	assert.Equal(t, database.ErrNotFound, err)
+	_, err = db.GetArchivedBatchForTransaction(types.NewHash("0xabcd"))
+	assert.Equal(t, database.ErrNotFound, err)
+}
+
+func TestMemoryDB_IndexBlocksAhead(t *testing.T) {
+	db := NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{addr}))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+
+	// indexed, without raising the last filtered block
+	assert.Nil(t, db.IndexBlocksAhead([]types.Address{addr}, []*types.Block{block}))
+	testGetLastFiltered(t, db, addr, 0)
+	testGetTransactionsToAddressTotal(t, db, addr, 1)
+	testGetAllEventsByAddress(t, db, addr, 1)
+	assert.Nil(t, db.IndexBlocksAhead([]types.Address{addr}, []*types.Block{block}))
+	testGetTransactionsToAddressTotal(t, db, addr, 1)
+
+	// indexing the block in order only raises the last filtered block
+	testIndexBlock(t, db, addr, block)
+	testGetLastFiltered(t, db, addr, 1)
+	testGetTransactionsToAddressTotal(t, db, addr, 1)
+	testGetAllEventsByAddress(t, db, addr, 1)
+	assert.Empty(t, db.indexedAhead[addr])
+}
+
+func TestMemoryDB_ReindexBlocks(t *testing.T) {
+	stale := &types.Transaction{
+		Hash:        types.NewHash("0x4f1e3d6c8a2b9e7f0c5d4a3b2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f"),
+		BlockNumber: 2,
+		To:          addr,
+		Events:      []*types.Event{{Address: addr, BlockNumber: 2, Data: types.NewHexData("0x01")}},
+	}
+	block2 := &types.Block{Hash: types.NewHash("dummy2"), Number: 2, Transactions: []types.Hash{stale.Hash}}
+	db := NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{addr}))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3, stale}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block, block2}))
+	testIndexBlock(t, db, addr, block)
+	testIndexBlock(t, db, addr, block2)
+
+	// the block is fetched again with a different transaction in place of the
+	// one stored
+	replacement := &types.Transaction{
+		Hash:        types.NewHash("0x9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b"),
+		BlockNumber: 2,
+		To:          addr,
+		Events: []*types.Event{
+			{Address: addr, BlockNumber: 2, Data: types.NewHexData("0x02")},
+			{Address: addr, BlockNumber: 2, Index: 1, Data: types.NewHexData("0x03")},
+		},
+	}
+	refetched := &types.Block{Hash: types.NewHash("dummy2"), Number: 2, Transactions: []types.Hash{replacement.Hash}}
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{replacement}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{refetched}))
+
+	// what was indexed for the block is replaced, without duplicating the rest
+	assert.Nil(t, db.ReindexBlocks([]types.Address{addr}, []*types.Block{refetched}))
+	testGetLastFiltered(t, db, addr, 2)
+	txs, err := db.GetAllTransactionsToAddress(addr, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Hash{replacement.Hash, tx3.Hash}, txs)
+	events, err := db.GetAllEventsFromAddress(addr, nil)
+	assert.Nil(t, err)
+	assert.Len(t, events, 3)
+	assert.Equal(t, types.NewHexData("0x02"), events[0].Data)
+	assert.Equal(t, types.NewHexData("0x03"), events[1].Data)
+
+	// blocks the address hasn't been filtered up to are left alone
+	block3 := &types.Block{Hash: types.NewHash("dummy3"), Number: 3}
+	assert.Nil(t, db.ReindexBlocks([]types.Address{addr}, []*types.Block{block3}))
+	testGetLastFiltered(t, db, addr, 2)
+}
+
+func TestMemoryDB_ResetLastFiltered(t *testing.T) {
+	tx4 := &types.Transaction{
+		Hash:        types.NewHash("0xf4f803b8d6c6b38e0b15d6cfe80fd1dcd4b7ba8a4cc9db3b5f5a4d4d1a1d7e42"),
+		BlockNumber: 2,
+		To:          addr,
+		Events:      []*types.Event{{Address: addr, BlockNumber: 2}},
+	}
+	block2 := &types.Block{Hash: types.NewHash("dummy2"), Number: 2, Transactions: []types.Hash{tx4.Hash}}
+	db := NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{addr}))
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx1, tx2, tx3, tx4}))
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block, block2}))
+	testIndexBlock(t, db, addr, block)
+	testIndexBlock(t, db, addr, block2)
+
+	// not lowered if it hasn't been filtered past the block
+	assert.Nil(t, db.ResetLastFiltered(addr, 2))
+	testGetLastFiltered(t, db, addr, 2)
+	testGetAllEventsByAddress(t, db, addr, 2)
+
+	assert.Nil(t, db.ResetLastFiltered(addr, 1))
+	testGetLastFiltered(t, db, addr, 1)
+	testGetTransactionsToAddressTotal(t, db, addr, 1)
+	testGetAllEventsByAddress(t, db, addr, 1)
+
+	// filtering the block again doesn't duplicate anything
+	testIndexBlock(t, db, addr, block2)
+	testGetLastFiltered(t, db, addr, 2)
+	testGetTransactionsToAddressTotal(t, db, addr, 2)
+	testGetAllEventsByAddress(t, db, addr, 2)
+
+	assert.Equal(t, database.ErrNotFound, db.ResetLastFiltered(types.NewAddress("0x0000000000000000000000000000000000000002"), 0))
+}
@@ -0,0 +1,557 @@
+package scoped
+
+import (
+	"errors"
+	"math/big"
+
+	"quorumengineering/quorum-report/database"
+	"quorumengineering/quorum-report/types"
+)
+
+var ErrContractNotInScope = errors.New("contract is not in the contract groups of the API key")
+
+// Database limits the contract data that can be read or changed to a set of
+// contracts, those of the contract groups an API key is scoped to. Queries for
+// a single contract outside of the set fail before reaching the database;
+// queries across contracts are restricted to the set by the database itself,
+// so pages and totals only ever count the contracts in it.
+//
+// Blocks and transactions are shared by all contracts, so are not restricted,
+// but the events they hold from contracts outside of the set are left out. The
+// ABI of a contract outside of the set is reported as unknown, so that the
+// transactions sent to it are returned undecoded.
+type Database struct {
+	database.Database
+	contracts map[types.Address]bool
+}
+
+func NewDatabase(db database.Database, contracts []types.Address) *Database {
+	scope := make(map[types.Address]bool, len(contracts))
+	for _, address := range contracts {
+		scope[address] = true
+	}
+	return &Database{
+		Database:  db,
+		contracts: scope,
+	}
+}
+
+// Contains reports whether the contract is in scope.
+func (db *Database) Contains(address types.Address) bool {
+	return db.contracts[address]
+}
+
+// Contracts returns the contracts in scope that are registered.
+func (db *Database) Contracts() ([]types.Address, error) {
+	addresses, err := db.Database.GetAddresses()
+	if err != nil {
+		return nil, err
+	}
+	contracts := make([]types.Address, 0, len(addresses))
+	for _, address := range addresses {
+		if db.contracts[address] {
+			contracts = append(contracts, address)
+		}
+	}
+	return contracts, nil
+}
+
+func (db *Database) check(addresses ...types.Address) error {
+	for _, address := range addresses {
+		if !db.contracts[address] {
+			return ErrContractNotInScope
+		}
+	}
+	return nil
+}
+
+// withoutOtherEvents returns a copy of the transaction without the events of
+// the contracts outside of the scope
+func (db *Database) withoutOtherEvents(tx *types.Transaction) *types.Transaction {
+	if tx == nil {
+		return nil
+	}
+	copied := *tx
+	copied.Events = make([]*types.Event, 0, len(tx.Events))
+	for _, event := range tx.Events {
+		if db.contracts[event.Address] {
+			copied.Events = append(copied.Events, event)
+		}
+	}
+	return &copied
+}
+
+func (db *Database) AddAddresses(addresses []types.Address) error {
+	if err := db.check(addresses...); err != nil {
+		return err
+	}
+	return db.Database.AddAddresses(addresses)
+}
+
+func (db *Database) AddAddressFrom(address types.Address, from uint64) error {
+	if err := db.check(address); err != nil {
+		return err
+	}
+	return db.Database.AddAddressFrom(address, from)
+}
+
+func (db *Database) DeleteAddress(address types.Address, purge bool) error {
+	if err := db.check(address); err != nil {
+		return err
+	}
+	return db.Database.DeleteAddress(address, purge)
+}
+
+// GetAddresses returns the registered contracts in scope.
+func (db *Database) GetAddresses() ([]types.Address, error) {
+	return db.Contracts()
+}
+
+func (db *Database) GetContractTemplate(address types.Address) (string, error) {
+	if err := db.check(address); err != nil {
+		return "", err
+	}
+	return db.Database.GetContractTemplate(address)
+}
+
+func (db *Database) SetContractEnrichment(address types.Address, mapping types.EnrichmentMapping) error {
+	if err := db.check(address); err != nil {
+		return err
+	}
+	return db.Database.SetContractEnrichment(address, mapping)
+}
+
+func (db *Database) GetContractEnrichment(address types.Address) (types.EnrichmentMapping, error) {
+	if err := db.check(address); err != nil {
+		return nil, err
+	}
+	return db.Database.GetContractEnrichment(address)
+}
+
+func (db *Database) SetContractSeverityRules(address types.Address, rules types.SeverityRules) error {
+	if err := db.check(address); err != nil {
+		return err
+	}
+	return db.Database.SetContractSeverityRules(address, rules)
+}
+
+func (db *Database) GetContractSeverityRules(address types.Address) (types.SeverityRules, error) {
+	if err := db.check(address); err != nil {
+		return nil, err
+	}
+	return db.Database.GetContractSeverityRules(address)
+}
+
+func (db *Database) SetTerminalBlock(address types.Address, terminalBlock uint64) error {
+	if err := db.check(address); err != nil {
+		return err
+	}
+	return db.Database.SetTerminalBlock(address, terminalBlock)
+}
+
+func (db *Database) GetTerminalBlock(address types.Address) (uint64, error) {
+	if err := db.check(address); err != nil {
+		return 0, err
+	}
+	return db.Database.GetTerminalBlock(address)
+}
+
+func (db *Database) AssignTemplate(address types.Address, name string) error {
+	if err := db.check(address); err != nil {
+		return err
+	}
+	return db.Database.AssignTemplate(address, name)
+}
+
+// GetContractABI returns no ABI for contracts outside of the scope.
+func (db *Database) GetContractABI(address types.Address) (string, error) {
+	if !db.contracts[address] {
+		return "", nil
+	}
+	return db.Database.GetContractABI(address)
+}
+
+func (db *Database) GetStorageLayout(address types.Address) (string, error) {
+	if err := db.check(address); err != nil {
+		return "", err
+	}
+	return db.Database.GetStorageLayout(address)
+}
+
+func (db *Database) ReadTransaction(hash types.Hash) (*types.Transaction, error) {
+	tx, err := db.Database.ReadTransaction(hash)
+	if err != nil {
+		return nil, err
+	}
+	return db.withoutOtherEvents(tx), nil
+}
+
+func (db *Database) GetTransactionsInBlockRange(start uint64, end uint64, options *types.PageOptions) ([]*types.Transaction, error) {
+	txs, err := db.Database.GetTransactionsInBlockRange(start, end, options)
+	if err != nil {
+		return nil, err
+	}
+	scoped := make([]*types.Transaction, len(txs))
+	for i, tx := range txs {
+		scoped[i] = db.withoutOtherEvents(tx)
+	}
+	return scoped, nil
+}
+
+func (db *Database) GetContractCreationTransaction(address types.Address) (types.Hash, error) {
+	if err := db.check(address); err != nil {
+		return "", err
+	}
+	return db.Database.GetContractCreationTransaction(address)
+}
+
+func (db *Database) GetContractDestroyed(address types.Address) (uint64, error) {
+	if err := db.check(address); err != nil {
+		return 0, err
+	}
+	return db.Database.GetContractDestroyed(address)
+}
+
+func (db *Database) GetAllTransactionsToAddress(address types.Address, options *types.QueryOptions) ([]types.Hash, error) {
+	if err := db.check(address); err != nil {
+		return nil, err
+	}
+	return db.Database.GetAllTransactionsToAddress(address, options)
+}
+
+func (db *Database) GetTransactionsToAddressTotal(address types.Address, options *types.QueryOptions) (uint64, error) {
+	if err := db.check(address); err != nil {
+		return 0, err
+	}
+	return db.Database.GetTransactionsToAddressTotal(address, options)
+}
+
+func (db *Database) GetAllTransactionsInternalToAddress(address types.Address, options *types.QueryOptions) ([]types.Hash, error) {
+	if err := db.check(address); err != nil {
+		return nil, err
+	}
+	return db.Database.GetAllTransactionsInternalToAddress(address, options)
+}
+
+func (db *Database) GetTransactionsInternalToAddressTotal(address types.Address, options *types.QueryOptions) (uint64, error) {
+	if err := db.check(address); err != nil {
+		return 0, err
+	}
+	return db.Database.GetTransactionsInternalToAddressTotal(address, options)
+}
+
+func (db *Database) GetAllEventsFromAddress(address types.Address, options *types.QueryOptions) ([]*types.Event, error) {
+	if err := db.check(address); err != nil {
+		return nil, err
+	}
+	return db.Database.GetAllEventsFromAddress(address, options)
+}
+
+func (db *Database) GetEventsFromAddressTotal(address types.Address, options *types.QueryOptions) (uint64, error) {
+	if err := db.check(address); err != nil {
+		return 0, err
+	}
+	return db.Database.GetEventsFromAddressTotal(address, options)
+}
+
+// scopeEventQuery checks the contract of the query, or restricts a query
+// across contracts to those in scope
+func (db *Database) scopeEventQuery(query *types.EventTopicQuery) (*types.EventTopicQuery, error) {
+	if query.Address != nil {
+		return query, db.check(*query.Address)
+	}
+	scoped := *query
+	scoped.Contracts = make([]types.Address, 0, len(db.contracts))
+	for address := range db.contracts {
+		if query.Contracts == nil || containsAddress(query.Contracts, address) {
+			scoped.Contracts = append(scoped.Contracts, address)
+		}
+	}
+	return &scoped, nil
+}
+
+func (db *Database) GetEventsByTopics(query *types.EventTopicQuery, options *types.QueryOptions) ([]*types.Event, error) {
+	scoped, err := db.scopeEventQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return db.Database.GetEventsByTopics(scoped, options)
+}
+
+func (db *Database) GetEventsByTopicsTotal(query *types.EventTopicQuery, options *types.QueryOptions) (uint64, error) {
+	scoped, err := db.scopeEventQuery(query)
+	if err != nil {
+		return 0, err
+	}
+	return db.Database.GetEventsByTopicsTotal(scoped, options)
+}
+
+// scopeSeverityQuery checks the contract of the query, or restricts a query
+// across contracts to those in scope
+func (db *Database) scopeSeverityQuery(query *types.EventSeverityQuery) (*types.EventSeverityQuery, error) {
+	if query.Address != nil {
+		return query, db.check(*query.Address)
+	}
+	scoped := *query
+	scoped.Contracts = make([]types.Address, 0, len(db.contracts))
+	for address := range db.contracts {
+		if query.Contracts == nil || containsAddress(query.Contracts, address) {
+			scoped.Contracts = append(scoped.Contracts, address)
+		}
+	}
+	return &scoped, nil
+}
+
+func (db *Database) GetEventsBySeverity(query *types.EventSeverityQuery, options *types.QueryOptions) ([]*types.Event, error) {
+	scoped, err := db.scopeSeverityQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return db.Database.GetEventsBySeverity(scoped, options)
+}
+
+func (db *Database) GetEventsBySeverityTotal(query *types.EventSeverityQuery, options *types.QueryOptions) (uint64, error) {
+	scoped, err := db.scopeSeverityQuery(query)
+	if err != nil {
+		return 0, err
+	}
+	return db.Database.GetEventsBySeverityTotal(scoped, options)
+}
+
+func (db *Database) GetEventSeverityCounts(query *types.EventSeverityQuery, options *types.QueryOptions) (types.SeverityCounts, error) {
+	scoped, err := db.scopeSeverityQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return db.Database.GetEventSeverityCounts(scoped, options)
+}
+
+func (db *Database) GetEventsInOrder(contracts []types.Address, after *types.Cursor, toBlock uint64, limit int) ([]*types.Event, error) {
+	if err := db.check(contracts...); err != nil {
+		return nil, err
+	}
+	return db.Database.GetEventsInOrder(contracts, after, toBlock, limit)
+}
+
+func (db *Database) HasActivity(address types.Address, from uint64, to uint64) (bool, error) {
+	if err := db.check(address); err != nil {
+		return false, err
+	}
+	return db.Database.HasActivity(address, from, to)
+}
+
+// GetEventsForTransactions returns only the events of contracts in scope, or
+// of those of the given contracts that are.
+func (db *Database) GetEventsForTransactions(hashes []types.Hash, contracts []types.Address, limit int) (map[types.Hash][]*types.Event, error) {
+	scoped := make([]types.Address, 0, len(db.contracts))
+	for address := range db.contracts {
+		if contracts == nil || containsAddress(contracts, address) {
+			scoped = append(scoped, address)
+		}
+	}
+	return db.Database.GetEventsForTransactions(hashes, scoped, limit)
+}
+
+func (db *Database) GetCounterparties(address types.Address, options *types.CounterpartyQueryOptions) ([]*types.Counterparty, error) {
+	if err := db.check(address); err != nil {
+		return nil, err
+	}
+	return db.Database.GetCounterparties(address, options)
+}
+
+// GetGasUsage only totals the transactions sent to, or creating, contracts in
+// scope
+func (db *Database) GetGasUsage(query *types.GasUsageQuery) ([]*types.GasUsage, error) {
+	if query.Contract != nil {
+		if err := db.check(*query.Contract); err != nil {
+			return nil, err
+		}
+		return db.Database.GetGasUsage(query)
+	}
+	scoped := *query
+	scoped.Contracts = make([]types.Address, 0, len(db.contracts))
+	for address := range db.contracts {
+		if query.Contracts == nil || containsAddress(query.Contracts, address) {
+			scoped.Contracts = append(scoped.Contracts, address)
+		}
+	}
+	return db.Database.GetGasUsage(&scoped)
+}
+
+func (db *Database) GetStorage(address types.Address, block uint64) (*types.StorageResult, error) {
+	if err := db.check(address); err != nil {
+		return nil, err
+	}
+	return db.Database.GetStorage(address, block)
+}
+
+func (db *Database) GetStorageTotal(address types.Address, options *types.PageOptions) (uint64, error) {
+	if err := db.check(address); err != nil {
+		return 0, err
+	}
+	return db.Database.GetStorageTotal(address, options)
+}
+
+func (db *Database) GetStorageWithOptions(address types.Address, options *types.PageOptions) ([]*types.StorageResult, error) {
+	if err := db.check(address); err != nil {
+		return nil, err
+	}
+	return db.Database.GetStorageWithOptions(address, options)
+}
+
+func (db *Database) GetStorageRanges(address types.Address, options *types.PageOptions) ([]types.RangeResult, error) {
+	if err := db.check(address); err != nil {
+		return nil, err
+	}
+	return db.Database.GetStorageRanges(address, options)
+}
+
+func (db *Database) GetStorageValues(address types.Address, options *types.PageOptions) ([]*types.StorageValues, error) {
+	if err := db.check(address); err != nil {
+		return nil, err
+	}
+	return db.Database.GetStorageValues(address, options)
+}
+
+func (db *Database) GetLastFiltered(address types.Address) (uint64, error) {
+	if err := db.check(address); err != nil {
+		return 0, err
+	}
+	return db.Database.GetLastFiltered(address)
+}
+
+func (db *Database) ResetLastFiltered(address types.Address, lastFiltered uint64) error {
+	if err := db.check(address); err != nil {
+		return err
+	}
+	return db.Database.ResetLastFiltered(address, lastFiltered)
+}
+
+func (db *Database) GetERC20Balance(contract types.Address, holder types.Address, options *types.TokenQueryOptions) (map[uint64]*big.Int, error) {
+	if err := db.check(contract); err != nil {
+		return nil, err
+	}
+	return db.Database.GetERC20Balance(contract, holder, options)
+}
+
+func (db *Database) GetAllTokenHolders(contract types.Address, block uint64, options *types.TokenQueryOptions) ([]types.Address, error) {
+	if err := db.check(contract); err != nil {
+		return nil, err
+	}
+	return db.Database.GetAllTokenHolders(contract, block, options)
+}
+
+func (db *Database) GetERC20TokenHolders(contract types.Address, block uint64, options *types.QueryOptions) ([]*types.ERC20Holding, error) {
+	if err := db.check(contract); err != nil {
+		return nil, err
+	}
+	return db.Database.GetERC20TokenHolders(contract, block, options)
+}
+
+func (db *Database) GetERC20Allowance(contract types.Address, owner types.Address, spender types.Address, options *types.TokenQueryOptions) (map[uint64]*big.Int, error) {
+	if err := db.check(contract); err != nil {
+		return nil, err
+	}
+	return db.Database.GetERC20Allowance(contract, owner, spender, options)
+}
+
+func (db *Database) GetERC20Allowances(contract types.Address, owner types.Address, block uint64, options *types.QueryOptions) ([]*types.ERC20Allowance, error) {
+	if err := db.check(contract); err != nil {
+		return nil, err
+	}
+	return db.Database.GetERC20Allowances(contract, owner, block, options)
+}
+
+func (db *Database) ERC721TokenByTokenID(contract types.Address, block uint64, tokenId *big.Int) (*types.ERC721Token, error) {
+	if err := db.check(contract); err != nil {
+		return nil, err
+	}
+	return db.Database.ERC721TokenByTokenID(contract, block, tokenId)
+}
+
+func (db *Database) ERC721TokenHistory(contract types.Address, tokenId *big.Int, options *types.TokenQueryOptions) ([]types.ERC721Token, error) {
+	if err := db.check(contract); err != nil {
+		return nil, err
+	}
+	return db.Database.ERC721TokenHistory(contract, tokenId, options)
+}
+
+func (db *Database) ERC721TokensForAccountAtBlock(contract types.Address, holder types.Address, block uint64, options *types.TokenQueryOptions) ([]types.ERC721Token, error) {
+	if err := db.check(contract); err != nil {
+		return nil, err
+	}
+	return db.Database.ERC721TokensForAccountAtBlock(contract, holder, block, options)
+}
+
+func (db *Database) AllERC721TokensAtBlock(contract types.Address, block uint64, options *types.TokenQueryOptions) ([]types.ERC721Token, error) {
+	if err := db.check(contract); err != nil {
+		return nil, err
+	}
+	return db.Database.AllERC721TokensAtBlock(contract, block, options)
+}
+
+func (db *Database) AllHoldersAtBlock(contract types.Address, block uint64, options *types.TokenQueryOptions) ([]types.Address, error) {
+	if err := db.check(contract); err != nil {
+		return nil, err
+	}
+	return db.Database.AllHoldersAtBlock(contract, block, options)
+}
+
+func (db *Database) GetERC1155Balance(contract types.Address, holder types.Address, tokenId *big.Int, options *types.TokenQueryOptions) (map[uint64]*big.Int, error) {
+	if err := db.check(contract); err != nil {
+		return nil, err
+	}
+	return db.Database.GetERC1155Balance(contract, holder, tokenId, options)
+}
+
+func (db *Database) GetAllERC1155TokenHolders(contract types.Address, tokenId *big.Int, block uint64, options *types.TokenQueryOptions) ([]types.Address, error) {
+	if err := db.check(contract); err != nil {
+		return nil, err
+	}
+	return db.Database.GetAllERC1155TokenHolders(contract, tokenId, block, options)
+}
+
+func (db *Database) ExportTransactionsToAddress(address types.Address, options *types.QueryOptions, fn func(*types.Transaction) error) error {
+	if err := db.check(address); err != nil {
+		return err
+	}
+	return db.Database.ExportTransactionsToAddress(address, options, func(tx *types.Transaction) error {
+		return fn(db.withoutOtherEvents(tx))
+	})
+}
+
+func (db *Database) ExportEventsFromAddress(address types.Address, options *types.QueryOptions, fn func(*types.Event) error) error {
+	if err := db.check(address); err != nil {
+		return err
+	}
+	return db.Database.ExportEventsFromAddress(address, options, fn)
+}
+
+// Search finds nothing for a contract outside of the scope, and leaves out
+// the events of those contracts.
+func (db *Database) Search(query *types.SearchQuery, limit int) ([]*types.SearchResult, error) {
+	if query.Address != nil && !db.contracts[*query.Address] {
+		return []*types.SearchResult{}, nil
+	}
+	results, err := db.Database.Search(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	scoped := make([]*types.SearchResult, 0, len(results))
+	for _, result := range results {
+		if result.Address != nil && !db.contracts[*result.Address] {
+			continue
+		}
+		scoped = append(scoped, result)
+	}
+	return scoped, nil
+}
+
+func containsAddress(addresses []types.Address, address types.Address) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
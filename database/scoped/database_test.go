@@ -0,0 +1,120 @@
+package scoped
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/database/memory"
+	"quorumengineering/quorum-report/types"
+)
+
+var (
+	owned      = types.NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	notOwned   = types.NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	unassigned = types.NewAddress("0x9d13c6d3afe1721beef56b55d303b09e021e27ab")
+	transfer   = types.NewHash("0x01")
+	txHash     = types.NewHash("0xf4f803b8d6c6b38e0b15d6cfe80fd1dcea4270ad24e93385fca36512bb9c2c59")
+)
+
+func setupDatabase(t *testing.T) (*memory.MemoryDB, *Database) {
+	db := memory.NewMemoryDB()
+	assert.Nil(t, db.AddAddresses([]types.Address{owned, notOwned}))
+	tx := &types.Transaction{
+		Hash:        txHash,
+		BlockNumber: 1,
+		To:          notOwned,
+		Events: []*types.Event{
+			{Address: notOwned, BlockNumber: 1, Index: 0, TransactionHash: txHash, Topics: []types.Hash{transfer}},
+			{Address: owned, BlockNumber: 1, Index: 1, TransactionHash: txHash, Topics: []types.Hash{transfer}},
+		},
+	}
+	assert.Nil(t, db.WriteTransactions([]*types.Transaction{tx}))
+	block := &types.Block{Number: 1, Transactions: []types.Hash{txHash}}
+	assert.Nil(t, db.WriteBlocks([]*types.Block{block}))
+	assert.Nil(t, db.IndexBlocks([]types.Address{owned, notOwned}, []*types.Block{block}))
+	return db, NewDatabase(db, []types.Address{owned, unassigned})
+}
+
+func TestDatabase_Contracts(t *testing.T) {
+	db, scoped := setupDatabase(t)
+
+	addresses, err := scoped.GetAddresses()
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Address{owned}, addresses)
+	assert.True(t, scoped.Contains(unassigned))
+	assert.False(t, scoped.Contains(notOwned))
+
+	// contracts outside of the scope can't be read or changed
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+	_, err = scoped.GetAllEventsFromAddress(notOwned, options)
+	assert.Equal(t, ErrContractNotInScope, err)
+	_, err = scoped.GetStorage(notOwned, 1)
+	assert.Equal(t, ErrContractNotInScope, err)
+	assert.Equal(t, ErrContractNotInScope, scoped.DeleteAddress(notOwned, true))
+	assert.Equal(t, ErrContractNotInScope, scoped.AddAddresses([]types.Address{unassigned, notOwned}))
+	addresses, _ = db.GetAddresses()
+	assert.Len(t, addresses, 2)
+
+	events, err := scoped.GetAllEventsFromAddress(owned, options)
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+
+	// the ABI of other contracts is unknown
+	assert.Nil(t, db.AddTemplate("token", "[]", ""))
+	assert.Nil(t, db.AssignTemplate(notOwned, "token"))
+	abi, err := scoped.GetContractABI(notOwned)
+	assert.Nil(t, err)
+	assert.Empty(t, abi)
+}
+
+func TestDatabase_Events(t *testing.T) {
+	db, scoped := setupDatabase(t)
+	options := &types.QueryOptions{}
+	options.SetDefaults()
+
+	query := &types.EventTopicQuery{Topics: []*types.Hash{&transfer}}
+	events, err := scoped.GetEventsByTopics(query, options)
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, owned, events[0].Address)
+	total, err := scoped.GetEventsByTopicsTotal(query, options)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, total)
+	_, err = scoped.GetEventsByTopics(&types.EventTopicQuery{Address: &notOwned, Topics: []*types.Hash{&transfer}}, options)
+	assert.Equal(t, ErrContractNotInScope, err)
+
+	byTx, err := scoped.GetEventsForTransactions([]types.Hash{txHash}, nil, 10)
+	assert.Nil(t, err)
+	assert.Len(t, byTx[txHash], 1)
+	byTx, err = scoped.GetEventsForTransactions([]types.Hash{txHash}, []types.Address{notOwned}, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, byTx)
+
+	// the events of other contracts are left out of transactions, without
+	// changing what is stored
+	tx, err := scoped.ReadTransaction(txHash)
+	assert.Nil(t, err)
+	assert.Len(t, tx.Events, 1)
+	assert.Equal(t, owned, tx.Events[0].Address)
+	stored, _ := db.ReadTransaction(txHash)
+	assert.Len(t, stored.Events, 2)
+	txs, err := scoped.GetTransactionsInBlockRange(1, 1, &types.PageOptions{PageSize: 10})
+	assert.Nil(t, err)
+	assert.Len(t, txs[0].Events, 1)
+}
+
+func TestDatabase_Search(t *testing.T) {
+	_, scoped := setupDatabase(t)
+
+	results, err := scoped.Search(&types.SearchQuery{Address: &notOwned}, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, results)
+
+	results, err = scoped.Search(&types.SearchQuery{Hash: &txHash}, 10)
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, types.TransactionSearchResult, results[0].Type)
+	assert.Equal(t, owned, *results[1].Address)
+}
@@ -5,4 +5,7 @@ import "errors"
 var (
 	ErrNotFound       = errors.New("not found")
 	ErrNotImplemented = errors.New("not implemented")
+
+	ErrJobNotFailed        = errors.New("only failed jobs can be retried")
+	ErrAddressBeingDeleted = errors.New("address is being deleted")
 )
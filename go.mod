@@ -17,7 +17,9 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rakyll/statik v0.1.7
 	github.com/rs/cors v1.7.0
+	github.com/segmentio/kafka-go v0.4.8
 	github.com/sirupsen/logrus v1.6.0
 	github.com/stretchr/testify v1.4.0
-	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
+	golang.org/x/crypto v0.0.0-20190506204251-e1dfcc566284
+	gopkg.in/yaml.v2 v2.2.8
 )
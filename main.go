@@ -1,23 +1,28 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"quorumengineering/quorum-report/core"
+	"quorumengineering/quorum-report/database/elasticsearch"
 	"quorumengineering/quorum-report/log"
 	"quorumengineering/quorum-report/types"
 	"quorumengineering/quorum-report/ui"
 )
 
 func main() {
-	err := run()
+	err := run(os.Args[1:])
 	log.Info("Exiting")
 	if err != nil {
 		log.Error("error occurred in startup", "err", err.Error())
@@ -25,17 +30,83 @@ func main() {
 	}
 }
 
-func run() error {
+// commands run by the first argument, with serve run when it is left out
+var commands = map[string]func(args []string) error{
+	"serve":           serve,
+	"backfill":        backfillCommand,
+	"reindex":         reindexCommand,
+	"export":          exportCommand,
+	"migrate":         migrateCommand,
+	"restore":         restoreCommand,
+	"dump-index":      dumpIndexCommand,
+	"load-index":      loadIndexCommand,
+	"validate-config": validateConfigCommand,
+}
+
+func run(args []string) error {
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	runCommand, ok := commands[command]
+	if !ok {
+		return fmt.Errorf("unknown command %q, expected one of serve, backfill, reindex, export, migrate, restore, dump-index, load-index or validate-config", command)
+	}
+	return runCommand(args)
+}
+
+// newFlagSet returns the flags for a command, including the ones every
+// command takes
+func newFlagSet(command string, configFile *string, verbosity *int) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
 	// Set up logging with given verbosity
-	var verbosity int
-	flag.IntVar(&verbosity, "verbosity", log.InfoLevel, "logging verbosity")
+	flags.IntVar(verbosity, "verbosity", log.InfoLevel, "logging verbosity")
 	// Read config file path
-	var configFile string
-	flag.StringVar(&configFile, "config", "config.toml", "config file")
+	flags.StringVar(configFile, "config", "config.toml", "config file")
+	return flags
+}
+
+// readConfig sets the logging verbosity and reads the config file
+func readConfig(configFile string, verbosity int) (types.ReportingConfig, error) {
+	logrus.SetLevel(logrus.Level(verbosity + 2))
+	if configFile == "" {
+		return types.ReportingConfig{}, errors.New("config file path not given")
+	}
+	log.Info("Config file found", "filename", configFile)
+
+	// read the given config file
+	config, err := types.ReadConfig(configFile)
+	if err != nil {
+		log.Error("Unable to read configuration", "err", err)
+		return types.ReportingConfig{}, errors.New("unable to read configuration")
+	}
+	return config, nil
+}
+
+// serve syncs and indexes blocks, and serves the API, until interrupted
+func serve(args []string) error {
+	var (
+		configFile string
+		verbosity  int
+	)
+	flags := newFlagSet("serve", &configFile, &verbosity)
 	// Get Licenses
 	var showLicenses bool
-	flag.BoolVar(&showLicenses, "licenses", false, "show licenses")
-	flag.Parse()
+	flags.BoolVar(&showLicenses, "licenses", false, "show licenses")
+	// Backfill a block range once started
+	var backfillRange string
+	flags.StringVar(&backfillRange, "backfill", "", "block range to process again once started, as from-to")
+	// Preview templates against synthetic data
+	var preview bool
+	flags.BoolVar(&preview, "preview", false, "serve synthetic data generated from the configured templates, without connecting to a node")
+	// Serve realistic mock data for UI development
+	var (
+		mock       bool
+		mockBlocks uint64
+	)
+	flags.BoolVar(&mock, "mock", false, "serve mock data resembling a live network of the configured templates, without connecting to a node")
+	flags.Uint64Var(&mockBlocks, "mock-blocks", 1000, "number of blocks of mock history generated before serving")
+	flags.Parse(args)
 
 	if showLicenses {
 		fmt.Println("Copyright 2020 JP Morgan Chase Company")
@@ -57,38 +128,85 @@ func run() error {
 		fmt.Println("github.com/naoina/toml                  check license at: https://github.com/naoina/toml/blob/master/LICENSE")
 		fmt.Println("github.com/pkg/errors                   check license at: https://github.com/pkg/errors/blob/master/LICENSE")
 		fmt.Println("github.com/rs/cors                      check license at: https://github.com/rs/cors/blob/master/LICENSE")
+		fmt.Println("github.com/segmentio/kafka-go           check license at: https://github.com/segmentio/kafka-go/blob/master/LICENSE")
 		fmt.Println("github.com/sirupsen/logrus              check license at: https://github.com/sirupsen/logrus/blob/master/LICENSE")
 		fmt.Println("github.com/stretchr/testify             check license at: https://github.com/stretchr/testify/blob/master/LICENSE")
 		fmt.Println("golang.org/x/crypto                     check license at: https://golang.org/LICENSE")
+		fmt.Println("gopkg.in/yaml.v2                        check license at: https://github.com/go-yaml/yaml/blob/v2/LICENSE")
 		os.Exit(0)
 	}
 
-	logrus.SetLevel(logrus.Level(verbosity + 2))
-	if configFile == "" {
-		return errors.New("config file path not given")
+	if preview && mock {
+		return errors.New("preview and mock modes can not be combined")
 	}
-
-	log.Info("Config file found", "filename", configFile)
-
-	// read the given config file
-	config, err := types.ReadConfig(configFile)
-	if err != nil {
-		log.Error("Unable to read configuration", "err", err)
-		return errors.New("unable to read configuration")
+	if mock && mockBlocks == 0 {
+		return errors.New("at least one block of mock history must be generated")
 	}
-
-	// start the back end with given config
-	backend, err := core.New(config)
-	if err != nil {
-		return fmt.Errorf("initialize backend error: %v", err)
+	var backfillFrom, backfillTo uint64
+	if backfillRange != "" {
+		if preview || mock {
+			return errors.New("a backfill can not be run in preview or mock mode")
+		}
+		var err error
+		if backfillFrom, backfillTo, err = parseBlockRange(backfillRange); err != nil {
+			return err
+		}
 	}
 
-	err = backend.Start()
-	defer backend.Stop()
+	config, err := readConfig(configFile, verbosity)
 	if err != nil {
 		return err
 	}
 
+	var (
+		backendErrorChan chan error
+		reload           func(types.ReportingConfig) error
+	)
+	if preview || mock {
+		// serve generated data instead of starting the back end
+		var templatePreview *core.Preview
+		if mock {
+			templatePreview, err = core.NewMock(config, mockBlocks)
+		} else {
+			templatePreview, err = core.NewPreview(config)
+		}
+		if err != nil {
+			return fmt.Errorf("initialize preview error: %v", err)
+		}
+		err = templatePreview.Start()
+		defer templatePreview.Stop()
+		if err != nil {
+			return err
+		}
+		backendErrorChan = templatePreview.GetBackendErrorChannel()
+	} else {
+		// start the back end with given config
+		backend, err := core.New(config)
+		if err != nil {
+			return fmt.Errorf("initialize backend error: %v", err)
+		}
+
+		err = backend.Start()
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Tuning.ShutdownTimeout)*time.Second)
+			defer cancel()
+			backend.Stop(ctx)
+		}()
+		if err != nil {
+			return err
+		}
+		backendErrorChan = backend.GetBackendErrorChannel()
+		reload = backend.Reload
+
+		if backfillRange != "" {
+			jobID, err := backend.Backfill(backfillFrom, backfillTo)
+			if err != nil {
+				return fmt.Errorf("backfill error: %v", err)
+			}
+			log.Info("Backfill started", "job", jobID, "start", backfillFrom, "end", backfillTo)
+		}
+	}
+
 	log.Debug("UI Port", "port number", config.Server.UIPort)
 	if config.Server.UIPort > 0 {
 		// start a light weighted sample sample ui
@@ -103,10 +221,345 @@ func run() error {
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
 	defer signal.Stop(sigc)
-	select {
-	case <-sigc:
-	case <-backend.GetBackendErrorChannel(): //Check for errors that will warrant an application shutdown
+	// SIGHUP reloads the configuration file
+	hupc := make(chan os.Signal, 1)
+	signal.Notify(hupc, syscall.SIGHUP)
+	defer signal.Stop(hupc)
+	for {
+		select {
+		case <-sigc:
+			log.Info("Received interrupt signal, shutting down...")
+			return nil
+		case <-backendErrorChan: //Check for errors that will warrant an application shutdown
+			log.Info("Received backend error, shutting down...")
+			return nil
+		case <-hupc:
+			reloadConfig(configFile, reload)
+		}
+	}
+}
+
+// backfillCommand processes a block range again and exits once it is done
+func backfillCommand(args []string) error {
+	var (
+		configFile string
+		verbosity  int
+	)
+	flags := newFlagSet("backfill", &configFile, &verbosity)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: backfill [flags] from-to")
+	}
+	from, to, err := parseBlockRange(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	config, err := readConfig(configFile, verbosity)
+	if err != nil {
+		return err
+	}
+	return withTools(config, func(tools *core.Tools) error {
+		if err := tools.Backfill(from, to); err != nil {
+			return fmt.Errorf("backfill error: %v", err)
+		}
+		log.Info("Backfill completed", "start", from, "end", to)
+		return nil
+	})
+}
+
+// reindexCommand filters blocks again for one address and exits once it is
+// done
+func reindexCommand(args []string) error {
+	var (
+		configFile string
+		verbosity  int
+	)
+	flags := newFlagSet("reindex", &configFile, &verbosity)
+	var address string
+	flags.StringVar(&address, "address", "", "registered address to reindex")
+	var from, to uint64
+	flags.Uint64Var(&from, "from", 1, "first block to reindex")
+	flags.Uint64Var(&to, "to", 0, "last block to reindex, up to the block the address has been filtered to if 0")
+	flags.Parse(args)
+	if address == "" {
+		return errors.New("address to reindex not given")
+	}
+
+	config, err := readConfig(configFile, verbosity)
+	if err != nil {
+		return err
+	}
+	return withTools(config, func(tools *core.Tools) error {
+		if err := tools.Reindex(types.NewAddress(address), from, to); err != nil {
+			return fmt.Errorf("reindex error: %v", err)
+		}
+		log.Info("Reindex completed", "address", address)
+		return nil
+	})
+}
+
+// exportCommand writes the data of a registered address to files and exits
+// once it is done
+func exportCommand(args []string) error {
+	var (
+		configFile string
+		verbosity  int
+	)
+	flags := newFlagSet("export", &configFile, &verbosity)
+	var address string
+	flags.StringVar(&address, "address", "", "registered address to export")
+	var from, to uint64
+	flags.Uint64Var(&from, "from", 0, "first block to export")
+	flags.Uint64Var(&to, "to", 0, "last block to export, up to the block the address has been filtered to if 0")
+	var datasets string
+	flags.StringVar(&datasets, "datasets", strings.Join(types.ExportDatasets, ","), "comma separated datasets to export")
+	var format string
+	flags.StringVar(&format, "format", types.CSVFormat, "file format, csv or parquet")
+	var directory string
+	flags.StringVar(&directory, "dir", "", "directory to write the files to, the configured export directory if not given")
+	flags.Parse(args)
+	if address == "" {
+		return errors.New("address to export not given")
+	}
+
+	config, err := readConfig(configFile, verbosity)
+	if err != nil {
+		return err
+	}
+	if directory == "" {
+		directory = "."
+		if config.Export != nil {
+			directory = config.Export.Directory
+		}
+	}
+	request := &types.ExportRequest{
+		Address:    types.NewAddress(address),
+		StartBlock: from,
+		EndBlock:   to,
+		Datasets:   strings.Split(datasets, ","),
+		Format:     format,
+	}
+	return withTools(config, func(tools *core.Tools) error {
+		files, err := tools.Export(request, directory)
+		if err != nil {
+			return fmt.Errorf("export error: %v", err)
+		}
+		for _, file := range files {
+			log.Info("Exported", "file", file)
+		}
+		return nil
+	})
+}
+
+// withTools runs a maintenance task, flushing the database writes afterwards
+func withTools(config types.ReportingConfig, task func(tools *core.Tools) error) error {
+	tools, err := core.NewTools(config)
+	if err != nil {
+		return fmt.Errorf("initialize error: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Tuning.ShutdownTimeout)*time.Second)
+		defer cancel()
+		tools.Stop(ctx)
+	}()
+	return task(tools)
+}
+
+// migrateCommand brings the database indices up to date
+func migrateCommand(args []string) error {
+	var (
+		configFile string
+		verbosity  int
+	)
+	flags := newFlagSet("migrate", &configFile, &verbosity)
+	flags.Parse(args)
+
+	config, err := readConfig(configFile, verbosity)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Tuning.ShutdownTimeout)*time.Second)
+	defer cancel()
+	changes, err := core.Migrate(ctx, config)
+	if err != nil {
+		return fmt.Errorf("migrate error: %v", err)
+	}
+	if len(changes) == 0 {
+		fmt.Println("Database is up to date")
+	}
+	for _, change := range changes {
+		fmt.Println(change)
 	}
-	log.Info("Received interrupt signal, shutting down...")
 	return nil
 }
+
+// restoreCommand bootstraps a new database from a snapshot, optionally
+// serving from the restored last persisted block once it is done
+func restoreCommand(args []string) error {
+	var (
+		configFile string
+		verbosity  int
+	)
+	flags := newFlagSet("restore", &configFile, &verbosity)
+	var repository, snapshot string
+	flags.StringVar(&repository, "repository", "", "Elasticsearch snapshot repository")
+	flags.StringVar(&snapshot, "snapshot", "", "snapshot to restore")
+	var serveAfter bool
+	flags.BoolVar(&serveAfter, "serve", false, "start syncing and serving from the restored data once it is checked")
+	flags.Parse(args)
+	if repository == "" || snapshot == "" {
+		return errors.New("snapshot repository and name not given")
+	}
+
+	config, err := readConfig(configFile, verbosity)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Tuning.ShutdownTimeout)*time.Second)
+	defer cancel()
+	metadata, err := core.Restore(ctx, config, repository, snapshot)
+	if err != nil {
+		return fmt.Errorf("restore error: %v", err)
+	}
+	fmt.Printf("Restored snapshot %s with schema version %d, up to block %d\n", snapshot, metadata.SchemaVersion, metadata.LastPersisted)
+
+	if !serveAfter {
+		return nil
+	}
+	return serve([]string{"-config", configFile, "-verbosity", strconv.Itoa(verbosity)})
+}
+
+// dumpIndexCommand writes an index to a file, or stdout, as newline-delimited
+// JSON
+func dumpIndexCommand(args []string) error {
+	var (
+		configFile string
+		verbosity  int
+	)
+	flags := newFlagSet("dump-index", &configFile, &verbosity)
+	var index, out string
+	flags.StringVar(&index, "index", "", "index to dump, one of "+strings.Join(elasticsearch.DumpableIndexes(), ", "))
+	flags.StringVar(&out, "out", "", "file to write the dump to, instead of stdout")
+	flags.Parse(args)
+	if index == "" {
+		return errors.New("index to dump not given")
+	}
+
+	config, err := readConfig(configFile, verbosity)
+	if err != nil {
+		return err
+	}
+	w := os.Stdout
+	if out != "" {
+		if w, err = os.Create(out); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Tuning.ShutdownTimeout)*time.Second)
+	defer cancel()
+	count, err := core.DumpIndex(ctx, config, index, w)
+	if out != "" {
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("dump error: %v", err)
+	}
+	// stdout may hold the dump
+	fmt.Fprintf(os.Stderr, "Dumped %d documents of index %s\n", count, index)
+	return nil
+}
+
+// loadIndexCommand writes a dump of an index, from a file or stdin, back into
+// the database
+func loadIndexCommand(args []string) error {
+	var (
+		configFile string
+		verbosity  int
+	)
+	flags := newFlagSet("load-index", &configFile, &verbosity)
+	var in string
+	flags.StringVar(&in, "in", "", "file to read the dump from, instead of stdin")
+	flags.Parse(args)
+
+	config, err := readConfig(configFile, verbosity)
+	if err != nil {
+		return err
+	}
+	r := os.Stdin
+	if in != "" {
+		if r, err = os.Open(in); err != nil {
+			return err
+		}
+		defer r.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Tuning.ShutdownTimeout)*time.Second)
+	defer cancel()
+	header, count, err := core.LoadIndex(ctx, config, r)
+	if err != nil {
+		return fmt.Errorf("load error after %d documents: %v", count, err)
+	}
+	fmt.Printf("Loaded %d documents into index %s\n", count, header.Index)
+	return nil
+}
+
+// validateConfigCommand checks the config file, listing every problem found
+func validateConfigCommand(args []string) error {
+	var (
+		configFile string
+		verbosity  int
+	)
+	flags := newFlagSet("validate-config", &configFile, &verbosity)
+	flags.Parse(args)
+	logrus.SetLevel(logrus.Level(verbosity + 2))
+
+	if _, err := types.ReadConfig(configFile); err != nil {
+		if errs, ok := err.(types.ConfigErrors); ok {
+			for _, err := range errs {
+				fmt.Println(err)
+			}
+		} else {
+			fmt.Println(err)
+		}
+		return fmt.Errorf("config file %s is not valid", configFile)
+	}
+	fmt.Printf("config file %s is valid\n", configFile)
+	return nil
+}
+
+// reloadConfig reads the config file again and applies it, keeping the
+// current configuration if it can't be read or applied
+func reloadConfig(configFile string, reload func(types.ReportingConfig) error) {
+	if reload == nil {
+		log.Warn("Reloading the configuration is not supported in preview or mock mode")
+		return
+	}
+	log.Info("Received hangup signal, reloading configuration", "filename", configFile)
+	config, err := types.ReadConfig(configFile)
+	if err != nil {
+		log.Error("Unable to read configuration, keeping the current one", "err", err)
+		return
+	}
+	if err := reload(config); err != nil {
+		log.Error("Unable to apply configuration", "err", err)
+	}
+}
+
+// parseBlockRange parses a block range given as from-to
+func parseBlockRange(blockRange string) (uint64, uint64, error) {
+	parts := strings.Split(blockRange, "-")
+	if len(parts) != 2 {
+		return 0, 0, errors.New("block range must be given as from-to")
+	}
+	from, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start of block range: %v", err)
+	}
+	to, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid end of block range: %v", err)
+	}
+	return from, to, nil
+}
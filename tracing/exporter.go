@@ -0,0 +1,286 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"quorumengineering/quorum-report/log"
+	"quorumengineering/quorum-report/types"
+)
+
+const (
+	// spans are exported in batches of up to this many, or on each interval
+	exportBatchSize = 512
+	exportInterval  = 5 * time.Second
+	// spans ended whilst this many are waiting to be exported are dropped
+	maxQueuedSpans = 4096
+)
+
+var (
+	running   *Exporter
+	runningMu sync.RWMutex
+)
+
+func current() *Exporter {
+	runningMu.RLock()
+	defer runningMu.RUnlock()
+	return running
+}
+
+// Exporter posts finished spans to an OpenTelemetry collector, in the JSON
+// encoding of OTLP/HTTP. Spans are only created whilst it is running.
+type Exporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	// traces with an ID below the threshold are sampled
+	threshold uint64
+	client    *http.Client
+
+	queued  []*Span
+	dropped int
+	mux     sync.Mutex
+	// signalled when a full batch is waiting
+	batchChan chan struct{}
+
+	// To check we have actually shut down before returning
+	shutdownChan chan struct{}
+	shutdownWg   sync.WaitGroup
+}
+
+func NewExporter(config *types.TracingConfig) *Exporter {
+	threshold := uint64(math.MaxUint64)
+	if config.SampleRatio < 1 {
+		threshold = uint64(config.SampleRatio * math.MaxUint64)
+	}
+	return &Exporter{
+		endpoint:     strings.TrimSuffix(config.Endpoint, "/") + "/v1/traces",
+		headers:      config.Headers,
+		serviceName:  config.ServiceName,
+		threshold:    threshold,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		batchChan:    make(chan struct{}, 1),
+		shutdownChan: make(chan struct{}),
+	}
+}
+
+func (e *Exporter) Start() error {
+	log.Info("Starting trace exporter", "endpoint", e.endpoint)
+	runningMu.Lock()
+	running = e
+	runningMu.Unlock()
+
+	e.shutdownWg.Add(1)
+	go func() {
+		defer e.shutdownWg.Done()
+		ticker := time.NewTicker(exportInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-e.batchChan:
+			case <-e.shutdownChan:
+				e.flush()
+				return
+			}
+			e.flush()
+		}
+	}()
+	return nil
+}
+
+// Stop stops new spans being created, and exports those already ended.
+func (e *Exporter) Stop() {
+	runningMu.Lock()
+	if running == e {
+		running = nil
+	}
+	runningMu.Unlock()
+	close(e.shutdownChan)
+	e.shutdownWg.Wait()
+	log.Info("Trace exporter stopped")
+}
+
+// sampled decides whether a trace is recorded from its ID, so every span of a
+// trace is, whichever process starts it
+func (e *Exporter) sampled(traceID [16]byte) bool {
+	return e.threshold == math.MaxUint64 || binary.BigEndian.Uint64(traceID[8:]) < e.threshold
+}
+
+func (e *Exporter) queue(span *Span) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if len(e.queued) >= maxQueuedSpans {
+		e.dropped++
+		return
+	}
+	e.queued = append(e.queued, span)
+	if len(e.queued) == exportBatchSize {
+		select {
+		case e.batchChan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush exports the spans queued so far, in batches. Spans that fail to be
+// exported are dropped.
+func (e *Exporter) flush() {
+	e.mux.Lock()
+	spans := e.queued
+	dropped := e.dropped
+	e.queued = nil
+	e.dropped = 0
+	e.mux.Unlock()
+
+	if dropped > 0 {
+		log.Warn("Dropped spans whilst the export queue was full", "count", dropped)
+	}
+	for len(spans) > 0 {
+		batch := spans
+		if len(batch) > exportBatchSize {
+			batch = batch[:exportBatchSize]
+		}
+		spans = spans[len(batch):]
+		if err := e.export(batch); err != nil {
+			log.Warn("Exporting spans failed", "count", len(batch), "err", err)
+		}
+	}
+}
+
+func (e *Exporter) export(spans []*Span) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// The JSON encoding of an OTLP ExportTraceServiceRequest. IDs are hex
+// encoded, and 64 bit integers are strings.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Links             []otlpLink      `json:"links,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func (e *Exporter) encode(spans []*Span) *otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		span.mux.Lock()
+		s := otlpSpan{
+			TraceID:           hex.EncodeToString(span.context.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.context.SpanID[:]),
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        encodeAttributes(span.attributes),
+		}
+		if span.parent != ([8]byte{}) {
+			s.ParentSpanID = hex.EncodeToString(span.parent[:])
+		}
+		for _, link := range span.links {
+			s.Links = append(s.Links, otlpLink{TraceID: hex.EncodeToString(link.TraceID[:]), SpanID: hex.EncodeToString(link.SpanID[:])})
+		}
+		if span.err != nil {
+			s.Status = &otlpStatus{Code: 2, Message: span.err.Error()}
+		}
+		span.mux.Unlock()
+		encoded = append(encoded, s)
+	}
+
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttributes([]Attribute{String("service.name", e.serviceName)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "quorumengineering/quorum-report"}, Spans: encoded}},
+	}}}
+}
+
+func encodeAttributes(attributes []Attribute) []otlpAttribute {
+	encoded := make([]otlpAttribute, 0, len(attributes))
+	for _, attribute := range attributes {
+		var value map[string]interface{}
+		switch v := attribute.Value.(type) {
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, otlpAttribute{Key: attribute.Key, Value: value})
+	}
+	return encoded
+}
@@ -0,0 +1,235 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader carries the trace context of a request, as described by
+// https://www.w3.org/TR/trace-context/
+const TraceparentHeader = "traceparent"
+
+const (
+	kindInternal = 1
+	kindClient   = 3
+)
+
+// SpanContext identifies a span within its trace
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// Traceparent returns the value of the traceparent header for a request made
+// as part of the span
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]))
+}
+
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attribute {
+	return Attribute{key, value}
+}
+
+func Int(key string, value int) Attribute {
+	return Attribute{key, int64(value)}
+}
+
+func Uint64(key string, value uint64) Attribute {
+	return Attribute{key, int64(value)}
+}
+
+func Bool(key string, value bool) Attribute {
+	return Attribute{key, value}
+}
+
+// Span times an operation. Spans are only created whilst an exporter is
+// running, and the trace they are part of is sampled; all methods of a nil
+// span do nothing, so callers don't need to check.
+type Span struct {
+	exporter   *Exporter
+	context    SpanContext
+	parent     [8]byte
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes []Attribute
+	links      []SpanContext
+	err        error
+	mux        sync.Mutex
+}
+
+// Context returns the identity of the span, to link other spans to it
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.attributes = append(s.attributes, attributes...)
+}
+
+// Link records the span as related to another, such as a write of several
+// blocks to the processing of each of them
+func (s *Span) Link(other *Span) {
+	if s == nil || other == nil {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.links = append(s.links, other.context)
+}
+
+// RecordError marks the span as failed, if the error isn't nil
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.err = err
+}
+
+// End finishes the span and queues it to be exported. Only the first call
+// has any effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mux.Lock()
+	if !s.end.IsZero() {
+		s.mux.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mux.Unlock()
+	s.exporter.queue(s)
+}
+
+type spanKey struct{}
+
+// FromContext returns the span the context was started for, if any
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start starts a span as a child of the span in the context, or as the root
+// of a new trace if there is none. The returned context carries the new span.
+func Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	return start(ctx, name, kindInternal, attributes)
+}
+
+// StartClient starts a span for a request to another service, such as the
+// node or Elasticsearch
+func StartClient(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	return start(ctx, name, kindClient, attributes)
+}
+
+// StartWithID starts the root span of a trace whose identity is derived from
+// the given ID, such as a block hash, so spans recorded separately for the
+// same ID, with IDContext, end up in the same trace.
+func StartWithID(id []byte, name string, attributes ...Attribute) (context.Context, *Span) {
+	exporter := current()
+	sc := derive(id)
+	if exporter == nil || !exporter.sampled(sc.TraceID) {
+		return context.Background(), nil
+	}
+	span := newSpan(exporter, sc, [8]byte{}, name, kindInternal, attributes)
+	return context.WithValue(context.Background(), spanKey{}, span), span
+}
+
+// IDContext returns a context carrying the root span StartWithID starts for
+// the ID, so spans can be added to its trace before or after it is started.
+func IDContext(id []byte) context.Context {
+	exporter := current()
+	sc := derive(id)
+	if exporter == nil || !exporter.sampled(sc.TraceID) {
+		return context.Background()
+	}
+	return context.WithValue(context.Background(), spanKey{}, &Span{exporter: exporter, context: sc})
+}
+
+// Record exports a span that has already finished, from the given start time
+// until now, as a child of the span in the context.
+func Record(ctx context.Context, name string, started time.Time, attributes ...Attribute) {
+	_, span := Start(ctx, name, attributes...)
+	if span != nil {
+		span.start = started
+		span.End()
+	}
+}
+
+func start(ctx context.Context, name string, kind int, attributes []Attribute) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		exporter := current()
+		if exporter == nil {
+			return ctx, nil
+		}
+		sc := SpanContext{TraceID: randomTraceID(), SpanID: randomSpanID()}
+		if !exporter.sampled(sc.TraceID) {
+			return ctx, nil
+		}
+		span := newSpan(exporter, sc, [8]byte{}, name, kind, attributes)
+		return context.WithValue(ctx, spanKey{}, span), span
+	}
+	sc := SpanContext{TraceID: parent.context.TraceID, SpanID: randomSpanID()}
+	span := newSpan(parent.exporter, sc, parent.context.SpanID, name, kind, attributes)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func newSpan(exporter *Exporter, sc SpanContext, parent [8]byte, name string, kind int, attributes []Attribute) *Span {
+	return &Span{
+		exporter:   exporter,
+		context:    sc,
+		parent:     parent,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: attributes,
+	}
+}
+
+// derive returns the span context of the root span for an ID
+func derive(id []byte) SpanContext {
+	sum := sha256.Sum256(id)
+	var sc SpanContext
+	copy(sc.TraceID[:], sum[:16])
+	copy(sc.SpanID[:], sum[16:24])
+	return sc
+}
+
+func randomTraceID() [16]byte {
+	var id [16]byte
+	rand.Read(id[:])
+	return id
+}
+
+func randomSpanID() [8]byte {
+	var id [8]byte
+	rand.Read(id[:])
+	// an all zero span ID is invalid
+	if binary.BigEndian.Uint64(id[:]) == 0 {
+		id[7] = 1
+	}
+	return id
+}
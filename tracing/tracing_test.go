@@ -0,0 +1,164 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"quorumengineering/quorum-report/types"
+)
+
+type collector struct {
+	server   *httptest.Server
+	requests []otlpRequest
+	headers  []http.Header
+	mux      sync.Mutex
+}
+
+func newCollector(t *testing.T) *collector {
+	c := &collector{}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		var request otlpRequest
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+		c.mux.Lock()
+		defer c.mux.Unlock()
+		c.requests = append(c.requests, request)
+		c.headers = append(c.headers, r.Header)
+	}))
+	return c
+}
+
+func (c *collector) spans() map[string]otlpSpan {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	spans := make(map[string]otlpSpan)
+	for _, request := range c.requests {
+		for _, span := range request.ResourceSpans[0].ScopeSpans[0].Spans {
+			spans[span.Name] = span
+		}
+	}
+	return spans
+}
+
+func startExporter(t *testing.T, c *collector, sampleRatio float64) *Exporter {
+	exporter := NewExporter(&types.TracingConfig{
+		Endpoint:    c.server.URL + "/",
+		Headers:     map[string]string{"Authorization": "Bearer token"},
+		ServiceName: "reporting",
+		SampleRatio: sampleRatio,
+	})
+	assert.Nil(t, exporter.Start())
+	return exporter
+}
+
+func TestStart_NotRunning(t *testing.T) {
+	ctx, span := Start(context.Background(), "fetch block")
+	assert.Nil(t, span)
+	assert.Nil(t, FromContext(ctx))
+	// a nil span can be used as any other
+	span.SetAttributes(Int("count", 1))
+	span.RecordError(errors.New("failed"))
+	span.End()
+}
+
+func TestExporter_ExportsSpans(t *testing.T) {
+	c := newCollector(t)
+	defer c.server.Close()
+	exporter := startExporter(t, c, 1)
+
+	blockID := []byte("0xabc")
+	started := time.Now()
+	Record(IDContext(blockID), "fetch block", started, Uint64("block.number", 5))
+	ctx, block := StartWithID(blockID, "process block")
+	_, tx := Start(ctx, "fetch transaction", String("tx.hash", "0x01"), Bool("private", true))
+	tx.RecordError(errors.New("not found"))
+	tx.End()
+	_, write := Start(context.Background(), "write batch")
+	write.Link(block)
+	write.End()
+	block.End()
+	exporter.Stop()
+
+	spans := c.spans()
+	assert.Len(t, spans, 4)
+	assert.Equal(t, "Bearer token", c.headers[0].Get("Authorization"))
+	assert.Equal(t, "reporting", c.requests[0].ResourceSpans[0].Resource.Attributes[0].Value["stringValue"])
+
+	// the fetch recorded before the block span started is part of its trace
+	processing := spans["process block"]
+	assert.Empty(t, processing.ParentSpanID)
+	assert.Equal(t, processing.TraceID, spans["fetch block"].TraceID)
+	assert.Equal(t, processing.SpanID, spans["fetch block"].ParentSpanID)
+	assert.Equal(t, "5", spans["fetch block"].Attributes[0].Value["intValue"])
+
+	assert.Equal(t, processing.TraceID, spans["fetch transaction"].TraceID)
+	assert.Equal(t, processing.SpanID, spans["fetch transaction"].ParentSpanID)
+	assert.Equal(t, &otlpStatus{Code: 2, Message: "not found"}, spans["fetch transaction"].Status)
+	assert.Equal(t, true, spans["fetch transaction"].Attributes[1].Value["boolValue"])
+
+	assert.NotEqual(t, processing.TraceID, spans["write batch"].TraceID)
+	assert.Equal(t, []otlpLink{{TraceID: processing.TraceID, SpanID: processing.SpanID}}, spans["write batch"].Links)
+
+	// no more spans are created once stopped
+	_, span := Start(context.Background(), "fetch block")
+	assert.Nil(t, span)
+}
+
+func TestExporter_Sampling(t *testing.T) {
+	c := newCollector(t)
+	defer c.server.Close()
+	exporter := startExporter(t, c, 0.5)
+	defer exporter.Stop()
+
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		ctx, span := Start(context.Background(), "process block")
+		if span == nil {
+			assert.Nil(t, FromContext(ctx))
+			continue
+		}
+		sampled++
+		// the children of a sampled span always are
+		_, child := Start(ctx, "fetch transaction")
+		assert.NotNil(t, child)
+	}
+	assert.InDelta(t, 500, sampled, 100)
+
+	// traces derived from the same ID are sampled alike
+	_, span := StartWithID([]byte("0xabc"), "process block")
+	assert.Equal(t, span != nil, FromContext(IDContext([]byte("0xabc"))) != nil)
+}
+
+func TestTransport(t *testing.T) {
+	c := newCollector(t)
+	defer c.server.Close()
+	exporter := startExporter(t, c, 1)
+	defer exporter.Stop()
+
+	var traceparents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get(TraceparentHeader))
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: Transport(nil)}
+
+	ctx, span := StartClient(context.Background(), "elasticsearch bulk")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, nil)
+	_, err := client.Do(req)
+	assert.Nil(t, err)
+	// requests made outside a trace are left as they are
+	req, _ = http.NewRequest(http.MethodPost, server.URL, nil)
+	_, err = client.Do(req)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{span.Context().Traceparent(), ""}, traceparents)
+	assert.Regexp(t, "^00-[0-9a-f]{32}-[0-9a-f]{16}-01$", traceparents[0])
+}
@@ -0,0 +1,30 @@
+package tracing
+
+import (
+	"net/http"
+)
+
+type transport struct {
+	base http.RoundTripper
+}
+
+// Transport sets the traceparent header of the requests made in a context
+// carrying a span, so the service receiving them can continue the trace.
+// Other requests are sent as they are.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span := FromContext(req.Context())
+	if span == nil {
+		return t.base.RoundTrip(req)
+	}
+	// a round tripper must not modify the request it is given
+	req = req.Clone(req.Context())
+	req.Header.Set(TraceparentHeader, span.context.Traceparent())
+	return t.base.RoundTrip(req)
+}
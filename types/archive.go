@@ -0,0 +1,20 @@
+package types
+
+// ArchivedBatch is a range of blocks that has been moved, with their
+// transactions, out of the database into an object in cold storage.
+type ArchivedBatch struct {
+	// the key of the object in the bucket
+	Key        string `json:"key"`
+	StartBlock uint64 `json:"startBlock"`
+	EndBlock   uint64 `json:"endBlock"`
+	// the transactions of the blocks, to find the batch a transaction is in
+	Transactions []Hash `json:"transactions"`
+	// unix timestamp
+	ArchivedAt uint64 `json:"archivedAt"`
+}
+
+// ArchivedBlocks is the content of an archived batch, in block order.
+type ArchivedBlocks struct {
+	Blocks       []*Block       `json:"blocks"`
+	Transactions []*Transaction `json:"transactions"`
+}
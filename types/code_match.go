@@ -0,0 +1,13 @@
+package types
+
+// CodeMatchRequest assigns a template to every registered contract whose
+// runtime bytecode matches: either has the hash given, or the same code as
+// the reference address, such as an instance whose ABI has been verified.
+type CodeMatchRequest struct {
+	Template string  `json:"template"`
+	CodeHash Hash    `json:"codeHash,omitempty"`
+	Address  Address `json:"address,omitempty"`
+	// compare the code without the metadata hash Solidity appends to it,
+	// which differs between builds of the same source from other paths
+	IgnoreMetadata bool `json:"ignoreMetadata,omitempty"`
+}
@@ -1,11 +1,21 @@
 package types
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"io/ioutil"
+	"math"
+	"net"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/naoina/toml"
+	"gopkg.in/yaml.v2"
 
 	"quorumengineering/quorum-report/log"
 )
@@ -20,6 +30,12 @@ type ElasticsearchConfig struct {
 
 	// Path to PEM-encoded certificate authorities file
 	CACert string `toml:"cacert"`
+
+	// Bulk writes are flushed once either threshold is reached
+	BulkFlushBytes int `toml:"bulkFlushBytes,omitempty"`
+	// in milliseconds
+	BulkFlushInterval int `toml:"bulkFlushInterval,omitempty"`
+	BulkWorkers       int `toml:"bulkWorkers,omitempty"`
 }
 
 type DatabaseConfig struct {
@@ -30,18 +46,82 @@ type DatabaseConfig struct {
 type TuningConfig struct {
 	BlockProcessingQueueSize   int `toml:"blockProcessingQueueSize"`
 	BlockProcessingFlushPeriod int `toml:"blockProcessingFlushPeriod"`
+	// Number of blocks fetched at once while syncing historic blocks, and
+	// number of blocks processed at once
+	BlockFetchWorkers      int `toml:"blockFetchWorkers,omitempty"`
+	BlockProcessingWorkers int `toml:"blockProcessingWorkers,omitempty"`
+	// Maximum number of bytes of transaction input/ return data to store, 0 means no limit
+	MaxInputDataSize  int `toml:"maxInputDataSize,omitempty"`
+	MaxReturnDataSize int `toml:"maxReturnDataSize,omitempty"`
+	// Seconds to wait on shutdown for blocks in flight to be persisted and
+	// indexed, and again for buffered database writes to be flushed
+	ShutdownTimeout int `toml:"shutdownTimeout,omitempty"`
+}
+
+// HealthConfig sets when the service is reported as not ready or not alive by
+// the health endpoints of the RPC server
+type HealthConfig struct {
+	// Blocks the last persisted block can be behind the chain head, and the
+	// indexed blocks behind the last persisted block, while still ready
+	MaxMonitorLag uint64 `toml:"maxMonitorLag,omitempty"`
+	MaxFilterLag  uint64 `toml:"maxFilterLag,omitempty"`
+	// Seconds without a new block persisted while behind the chain head
+	// before the service is no longer alive
+	StallTimeout int `toml:"stallTimeout,omitempty"`
+	// Seconds the last persisted block can be older than before API
+	// responses are flagged as stale; never flagged if 0
+	StaleAfter int `toml:"staleAfter,omitempty"`
 }
 
 type AddressConfig struct {
 	Address      Address `toml:"address,omitempty"`
 	TemplateName string  `toml:"templateName,omitempty"`
 	From         uint64  `toml:"from,omitempty"`
+	// The block after which no more data of the contract is expected, such as
+	// when it was migrated, at which its data is frozen
+	TerminalBlock uint64 `toml:"terminalBlock,omitempty"`
 }
 
 type TemplateConfig struct {
 	TemplateName  string `toml:"templateName,omitempty"`
 	ABI           string `toml:"abi,omitempty"`
 	StorageLayout string `toml:"storageLayout,omitempty"`
+	// The columns of CSV exports of contracts using the template, in order,
+	// instead of the default columns
+	EventColumns       []*CSVColumnConfig `toml:"eventColumns,omitempty"`
+	TransactionColumns []*CSVColumnConfig `toml:"transactionColumns,omitempty"`
+}
+
+// CSVColumnConfig maps a field to a column of CSV exports
+type CSVColumnConfig struct {
+	// A default column, e.g. "blockNumber", or "param." followed by the path of
+	// a decoded parameter, with tuple members and array indices separated by
+	// dots, e.g. "param.order.amounts.0"
+	Field  string `toml:"field"`
+	Name   string `toml:"name,omitempty"`   // defaults to the field
+	Format string `toml:"format,omitempty"` // "date", "datetime" or "decimals:<n>"
+}
+
+func (c *CSVColumnConfig) validate() error {
+	if c.Field == "" {
+		return errors.New("empty CSV column field")
+	}
+	if _, ok := ParseCSVDecimals(c.Format); c.Format != "" && c.Format != CSVDateFormat && c.Format != CSVDateTimeFormat && !ok {
+		return errors.New(fmt.Sprintf("invalid CSV column format: %v", c.Format))
+	}
+	return nil
+}
+
+// ParseCSVDecimals returns the number of decimals of a "decimals:<n>" format
+func ParseCSVDecimals(format string) (int, bool) {
+	if !strings.HasPrefix(format, CSVDecimalsFormat) {
+		return 0, false
+	}
+	decimals, err := strconv.Atoi(strings.TrimPrefix(format, CSVDecimalsFormat))
+	if err != nil || decimals < 0 || decimals > 77 {
+		return 0, false
+	}
+	return decimals, true
 }
 
 type RuleConfig struct {
@@ -49,10 +129,357 @@ type RuleConfig struct {
 	Deployer     Address `toml:"deployer,omitempty"`
 	TemplateName string  `toml:"templateName,omitempty"`
 	EIP165       string  `toml:"eip165,omitempty"`
+	// The functions and events of the ABI, if given, are looked for in the
+	// bytecode of created contracts, instead of those of the template
+	ABI string `toml:"abi,omitempty"`
+	// With the event scope, the addresses in the parameter of the event,
+	// which is looked up in the ABI of the event template, are registered
+	// with the rule's template. If the emitter is given, only its events are
+	// checked.
+	EventTemplate string  `toml:"eventTemplate,omitempty"`
+	Event         string  `toml:"event,omitempty"`
+	Parameter     string  `toml:"parameter,omitempty"`
+	Emitter       Address `toml:"emitter,omitempty"`
+}
+
+type AnomalyDetectionConfig struct {
+	// Seconds between samples of each contract's event and transaction counts
+	Interval int `toml:"interval,omitempty"`
+	// Number of samples the moving average is taken over
+	Window int `toml:"window,omitempty"`
+	// Number of samples needed before anything is flagged
+	MinSamples int `toml:"minSamples,omitempty"`
+	// Number of standard deviations from the average that counts as an anomaly
+	Threshold float64 `toml:"threshold,omitempty"`
+	// URLs that alerts are POSTed to as JSON
+	Webhooks []string `toml:"webhooks,omitempty"`
+}
+
+type ConfigSyncConfig struct {
+	// Directory of TOML files that declare addresses, templates and rules
+	Directory string `toml:"directory"`
+	// Seconds between checks of the directory for changes
+	PollInterval int `toml:"pollInterval,omitempty"`
+}
+
+type KafkaConfig struct {
+	Brokers []string `toml:"brokers"`
+	// Topics that each kind of data is published to as JSON
+	BlocksTopic         string `toml:"blocksTopic,omitempty"`
+	TransactionsTopic   string `toml:"transactionsTopic,omitempty"`
+	EventsTopic         string `toml:"eventsTopic,omitempty"`
+	TokenTransfersTopic string `toml:"tokenTransfersTopic,omitempty"`
+	// Seconds between checks for newly persisted blocks
+	PollInterval int `toml:"pollInterval,omitempty"`
+}
+
+// ABIFetchConfig looks up the verified ABIs of registered contracts that don't
+// have one, and stores them as the contracts' templates
+type ABIFetchConfig struct {
+	// "sourcify" (default) or "registry"
+	Source string `toml:"source,omitempty"`
+	// Defaults to the Sourcify repository, https://repo.sourcify.dev
+	URL string `toml:"url,omitempty"`
+	// The network's chain ID on Sourcify, asked of the node if not given
+	ChainID uint64 `toml:"chainId,omitempty"`
+	// Seconds between checks for registered contracts without an ABI
+	PollInterval int `toml:"pollInterval,omitempty"`
+}
+
+// NamingConfig resolves the names set in a naming registry contract, which
+// must be registered with an ABI that has the event, so its events are indexed
+type NamingConfig struct {
+	Registry Address `toml:"registry"`
+	// The event, by name or signature, that sets the address of a name.
+	// Setting the zero address removes the name.
+	Event string `toml:"event,omitempty"`
+	// The parameters of the event holding the name, a string that is not
+	// indexed, and the address
+	NameParameter    string `toml:"nameParameter,omitempty"`
+	AddressParameter string `toml:"addressParameter,omitempty"`
+	// Seconds between checks for new registry events
+	PollInterval int `toml:"pollInterval,omitempty"`
+}
+
+// PendingConfig follows the transactions waiting in the node's pool, keeping
+// those sent to registered contracts until they are mined or expire
+type PendingConfig struct {
+	// Seconds between checks for new pending transactions and blocks
+	PollInterval int `toml:"pollInterval,omitempty"`
+	// Seconds a pending transaction is kept for if it isn't mined
+	Expiry int `toml:"expiry,omitempty"`
+	// The most pending transactions kept, dropping the oldest first
+	MaxTransactions int `toml:"maxTransactions,omitempty"`
+}
+
+// ExportConfig lets contract data be exported to files through the API
+type ExportConfig struct {
+	// The directory the files are written to, which must already exist
+	Directory string `toml:"directory"`
+}
+
+// ArchiveConfig moves old blocks and their transactions out of the database
+// into compressed batches in S3-compatible object storage, from where they are
+// read back when asked for
+type ArchiveConfig struct {
+	// The S3 endpoint, e.g. https://s3.eu-west-1.amazonaws.com, or that of
+	// another S3-compatible store, such as MinIO
+	Endpoint string `toml:"endpoint"`
+	Region   string `toml:"region,omitempty"` // defaults to "us-east-1"
+	Bucket   string `toml:"bucket"`
+	// Prepended to the keys of the batches, e.g. "reporting/"
+	Prefix          string `toml:"prefix,omitempty"`
+	AccessKeyID     string `toml:"accessKeyId"`
+	SecretAccessKey string `toml:"secretAccessKey"`
+	// Blocks are archived once they are older than this many days
+	MaxAgeDays int `toml:"maxAgeDays"`
+	// Number of blocks archived together in one batch
+	BatchSize int `toml:"batchSize,omitempty"`
+	// Seconds between checks for blocks old enough to archive
+	Interval int `toml:"interval,omitempty"`
+	// Number of archived batches kept in memory after being read back
+	CacheSize int `toml:"cacheSize,omitempty"`
+}
+
+// TracingConfig exports traces of block processing to an OpenTelemetry
+// collector over OTLP/HTTP
+type TracingConfig struct {
+	// The base URL of the collector, e.g. http://localhost:4318, which spans
+	// are posted to at /v1/traces
+	Endpoint string `toml:"endpoint"`
+	// Added to each request, e.g. for the collector's authentication
+	Headers map[string]string `toml:"headers,omitempty"`
+	// The service.name resource attribute of the spans
+	ServiceName string `toml:"serviceName,omitempty"`
+	// The share of traces recorded, from 0 to 1, defaulting to all of them
+	SampleRatio float64 `toml:"sampleRatio,omitempty"`
+}
+
+// HighAvailabilityConfig runs the instance as one of several sharing an
+// Elasticsearch cluster, of which only the one holding the leader lease
+// writes to it. The others serve reads until the lease expires, and then one
+// of them takes over.
+type HighAvailabilityConfig struct {
+	// Identifies the instance as the holder of the lease, defaulting to the
+	// hostname
+	InstanceID string `toml:"instanceId,omitempty"`
+	// Seconds the lease is held for without being renewed, so the longest a
+	// failed leader goes unnoticed
+	LeaseDuration int `toml:"leaseDuration,omitempty"`
+	// Seconds between the leader renewing the lease, and standbys trying to
+	// take it
+	RenewInterval int `toml:"renewInterval,omitempty"`
+	// Splits filtering the registered contracts between all the instances,
+	// instead of leaving it to the leader
+	Sharding *ShardingConfig `toml:"sharding,omitempty"`
+}
+
+// modes of splitting the registered contracts between instances
+const (
+	// instances claim shards of the contracts through leases, taking over
+	// those of instances that stop
+	LeaseSharding = "lease"
+	// each instance filters the fixed share given by its index
+	HashSharding = "hash"
+)
+
+// ShardingConfig splits the registered contracts into shards by the hash of
+// their address, so each instance filters a disjoint set of them.
+type ShardingConfig struct {
+	// lease (default) or hash
+	Mode string `toml:"mode,omitempty"`
+	// lease mode: the number of shards the instances share out between them
+	Shards int `toml:"shards,omitempty"`
+	// hash mode: the number of instances, and the position of this one among
+	// them, from 0
+	Instances int `toml:"instances,omitempty"`
+	Index     int `toml:"index"`
+}
+
+// ScreeningConfig checks the counterparties of registered contracts, and the
+// addresses in query results, against deny lists, such as of sanctioned
+// addresses, flagging those on them.
+type ScreeningConfig struct {
+	// Files listing an address on each line, optionally followed by a comma
+	// and the reason it is listed. Blank lines and lines starting with # are
+	// skipped.
+	Lists []string `toml:"lists,omitempty"`
+	// An external screening service, which addresses are POSTed to as
+	// {"addresses":[...]}, and which responds with {"matches":[...]} for
+	// those it flags
+	URL string `toml:"url,omitempty"`
+	// Added to each request, e.g. for the service's authentication
+	Headers map[string]string `toml:"headers,omitempty"`
+	// Addresses never flagged, whichever list they are on
+	Allowed []Address `toml:"allowed,omitempty"`
+	// Seconds the service's verdict on an address is cached for
+	CacheTTL int `toml:"cacheTTL,omitempty"`
+	// Seconds between reloading the list files
+	RefreshInterval int `toml:"refreshInterval,omitempty"`
+	// URLs that alerts are POSTed to as JSON when a counterparty is flagged
+	Webhooks []string `toml:"webhooks,omitempty"`
+}
+
+// RetentionConfig deletes the documents of an index once the block they were
+// recorded in is older than the maximum age of the index's policy. Indices
+// without a policy are kept forever.
+type RetentionConfig struct {
+	Policies []RetentionPolicy `toml:"policies"`
+	// Seconds between applying the policies
+	Interval int `toml:"interval,omitempty"`
+}
+
+type RetentionPolicy struct {
+	Index      string `toml:"index"` // one of RetentionIndices
+	MaxAgeDays int    `toml:"maxAgeDays"`
+}
+
+// RetentionIndices are the indices that can have a retention policy. Blocks
+// and transactions are moved out of the database by archiving them instead.
+var RetentionIndices = []string{"event", "storage", "erc20token", "erc721token", "erc1155token", "erc20allowance"}
+
+// CompactIndices are the indices maintenance compacts, and so those that can
+// be merged
+var CompactIndices = []string{"block", "transaction", "event", "storage", "erc20token", "erc721token", "erc1155token"}
+
+type MaintenanceConfig struct {
+	// Hours of the day (UTC) between which indices are compacted, once a day.
+	// The quiet hours run past midnight if they end before they start.
+	QuietHoursStart int `toml:"quietHoursStart"`
+	QuietHoursEnd   int `toml:"quietHoursEnd"`
+	// Indices merged down to at most maxNumSegments segments, which should be
+	// ones that are rarely written to. Deleted documents are expunged from all
+	// other indices. Any of CompactIndices.
+	MergeIndices   []string `toml:"mergeIndices,omitempty"`
+	MaxNumSegments int      `toml:"maxNumSegments,omitempty"`
+}
+
+type APIKeyConfig struct {
+	Key        string `toml:"key"`
+	Permission string `toml:"permission,omitempty"` // "full" (default), "read" or "aggregate"
+	// Names of the contract groups whose contracts the key can query, all
+	// contracts if none are given
+	Groups []string `toml:"groups,omitempty"`
+}
+
+// ContractGroupConfig names a set of contracts, such as those owned by a team,
+// which API keys can be restricted to
+type ContractGroupConfig struct {
+	Name      string    `toml:"name"`
+	Addresses []Address `toml:"addresses,omitempty"`
+}
+
+// JWTConfig accepts JSON Web Tokens signed with either a shared secret
+// (HS256) or an RSA key (RS256), sent as a bearer token
+type JWTConfig struct {
+	Secret        string `toml:"secret,omitempty"`
+	PublicKeyFile string `toml:"publicKeyFile,omitempty"` // PEM-encoded RSA public key
+	// If given, tokens must have been issued by and for these
+	Issuer   string `toml:"issuer,omitempty"`
+	Audience string `toml:"audience,omitempty"`
+	// The claim holding the permission of the token, which is "read" if the
+	// token does not have it
+	PermissionClaim string `toml:"permissionClaim,omitempty"`
+}
+
+// RateLimitConfig limits how often the RPC server can be called, so one client
+// can't starve the others. A request must be within every limit that applies
+// to it.
+type RateLimitConfig struct {
+	// Requests from all clients together
+	Global *RateLimit `toml:"global,omitempty"`
+	// Requests from each client, identified by its API key or token if
+	// authentication is enabled, or else its IP address
+	PerClient *RateLimit `toml:"perClient,omitempty"`
+	// Requests from each client to a method, keyed by the method name, e.g.
+	// "reporting.GetStorageHistory"
+	Methods map[string]*RateLimit `toml:"methods,omitempty"`
+}
+
+// RateLimit is a token bucket, refilled at rate requests per second and
+// holding at most burst requests
+type RateLimit struct {
+	Rate  float64 `toml:"rate"`
+	Burst int     `toml:"burst,omitempty"` // defaults to the rate, rounded up
+}
+
+// limits returns all limits that are given
+func (rl *RateLimitConfig) limits() []*RateLimit {
+	var limits []*RateLimit
+	for _, limit := range []*RateLimit{rl.Global, rl.PerClient} {
+		if limit != nil {
+			limits = append(limits, limit)
+		}
+	}
+	for _, limit := range rl.Methods {
+		if limit != nil {
+			limits = append(limits, limit)
+		}
+	}
+	return limits
+}
+
+// QueryGuardConfig rejects queries estimated to be too expensive for the
+// database, such as the storage history of a contract over millions of
+// blocks, with narrower parameters that would be within the limits. Limits
+// left at 0 aren't applied.
+type QueryGuardConfig struct {
+	// The most blocks the storage history of a contract is queried over
+	MaxStorageBlocks uint64 `toml:"maxStorageBlocks,omitempty"`
+	// The most storage states of a contract a storage query covers,
+	// estimated by counting them before they are read
+	MaxStorageStates uint64 `toml:"maxStorageStates,omitempty"`
+	// The most blocks gas usage is totalled over
+	MaxAggregationBlocks uint64 `toml:"maxAggregationBlocks,omitempty"`
+	// The most days network activity is totalled over
+	MaxActivityDays uint64 `toml:"maxActivityDays,omitempty"`
+	// Narrow storage queries over the limits to the newest blocks within
+	// them, instead of rejecting them
+	Degrade bool `toml:"degrade,omitempty"`
+}
+
+func IsValidPermission(permission string) bool {
+	return permission == FullPermission || permission == ReadPermission || permission == AggregatePermission
+}
+
+// ListenerConfig is another address the RPC server is served on, exposing
+// only some of the RPC API, such as read-only access for a DMZ.
+type ListenerConfig struct {
+	Addr string `toml:"addr"`
+	// "full" (default), "write" (all but the admin methods), "read" or
+	// "aggregate", on top of what API keys and tokens permit
+	Exposure string `toml:"exposure,omitempty"`
+	// IP addresses and CIDR ranges that can connect, any if none are given
+	AllowedIPs []string `toml:"allowedIPs,omitempty"`
+}
+
+func IsValidExposure(exposure string) bool {
+	return exposure == WriteExposure || IsValidPermission(exposure)
+}
+
+// ParseIPRange parses an entry of an IP allow-list, which is either a CIDR
+// range or a single IP address
+func ParseIPRange(entry string) (*net.IPNet, error) {
+	if strings.Contains(entry, "/") {
+		_, ipRange, err := net.ParseCIDR(entry)
+		return ipRange, err
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", entry)
+	}
+	bits := net.IPv6len * 8
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, net.IPv4len*8
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
 }
 
 type ReportingConfig struct {
-	Title     string
+	Title string
+	// What is indexed: "full" (default), or "headers" for only block headers
+	// and transaction summaries
+	Profile   string            `toml:"profile,omitempty"`
 	Addresses []*AddressConfig  `toml:"addresses,omitempty"`
 	Templates []*TemplateConfig `toml:"templates,omitempty"`
 	Rules     []*RuleConfig     `toml:"rules,omitempty"`
@@ -61,36 +488,141 @@ type ReportingConfig struct {
 		RPCAddr     string   `toml:"rpcAddr"`
 		RPCCorsList []string `toml:"rpcCorsList,omitempty"`
 		RPCVHosts   []string `toml:"rpcvHosts,omitempty"`
-		UIPort      int      `toml:"uiPort,omitempty"` // Serve a sample UI if provided
+		// IP addresses and CIDR ranges that can connect to rpcAddr, any if
+		// none are given
+		AllowedIPs []string `toml:"allowedIPs,omitempty"`
+		// Other addresses to serve on, each exposing some of the RPC API
+		Listeners []*ListenerConfig `toml:"listeners,omitempty"`
+		UIPort    int               `toml:"uiPort,omitempty"` // Serve a sample UI if provided
+		// If any keys or JWT validation are given, every RPC request must
+		// provide a key or a valid token
+		APIKeys []*APIKeyConfig `toml:"apiKeys,omitempty"`
+		JWT     *JWTConfig      `toml:"jwt,omitempty"`
+		// Groups of contracts that API keys can be restricted to
+		ContractGroups []*ContractGroupConfig `toml:"contractGroups,omitempty"`
+		// Limits on requests, none if not given
+		RateLimit *RateLimitConfig `toml:"rateLimit,omitempty"`
+		Health    HealthConfig     `toml:"health,omitempty"`
+		// Limits on how expensive a query can be, none if not given
+		QueryGuard *QueryGuardConfig `toml:"queryGuard,omitempty"`
 	}
 	Connection struct {
+		NodeType          string `toml:"nodeType,omitempty"` // "quorum" (default) or "besu"
 		WSUrl             string `toml:"wsUrl"`
 		GraphQLUrl        string `toml:"graphQLUrl"`
 		ReconnectInterval int    `toml:"reconnectInterval,omitempty"`
 		MaxReconnectTries int    `toml:"maxReconnectTries,omitempty"`
+		// Nodes of the same network to use instead of the URLs above, failing
+		// over between them
+		Nodes               []*NodeConfig `toml:"nodes,omitempty"`
+		LoadBalancing       string        `toml:"loadBalancing,omitempty"`       // "failover" (default) or "roundRobin"
+		HealthCheckInterval int           `toml:"healthCheckInterval,omitempty"` // seconds
+		// Don't fetch the payloads of private transactions from the private
+		// transaction manager when the node doesn't return them
+		DisablePrivatePayloads bool `toml:"disablePrivatePayloads,omitempty"`
+	}
+	Tuning           TuningConfig            `toml:"tuning,omitempty"`
+	ConfigSync       *ConfigSyncConfig       `toml:"configSync,omitempty"`
+	AnomalyDetection *AnomalyDetectionConfig `toml:"anomalyDetection,omitempty"`
+	Kafka            *KafkaConfig            `toml:"kafka,omitempty"`
+	Maintenance      *MaintenanceConfig      `toml:"maintenance,omitempty"`
+	ABIFetch         *ABIFetchConfig         `toml:"abiFetch,omitempty"`
+	Naming           *NamingConfig           `toml:"naming,omitempty"`
+	Pending          *PendingConfig          `toml:"pending,omitempty"`
+	Export           *ExportConfig           `toml:"export,omitempty"`
+	Archive          *ArchiveConfig          `toml:"archive,omitempty"`
+	Retention        *RetentionConfig        `toml:"retention,omitempty"`
+	Tracing          *TracingConfig          `toml:"tracing,omitempty"`
+	HighAvailability *HighAvailabilityConfig `toml:"highAvailability,omitempty"`
+	Screening        *ScreeningConfig        `toml:"screening,omitempty"`
+}
+
+type NodeConfig struct {
+	WSUrl      string `toml:"wsUrl"`
+	GraphQLUrl string `toml:"graphQLUrl"`
+}
+
+// ConfigErrors are all the problems found with a config
+type ConfigErrors []error
+
+func (errs ConfigErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
 	}
-	Tuning TuningConfig `toml:"tuning,omitempty"`
+	return fmt.Sprintf("%d configuration errors: %s", len(errs), strings.Join(messages, "; "))
 }
 
+// ReadConfig reads a TOML config file, or a YAML one if it has a .yaml or .yml
+// extension, then applies the overrides from environment variables
 func ReadConfig(configFile string) (ReportingConfig, error) {
-	f, err := os.Open(configFile)
+	contents, err := ioutil.ReadFile(configFile)
 	if err != nil {
 		return ReportingConfig{}, err
 	}
-	defer f.Close()
 	var input ReportingConfig
-	if err = toml.NewDecoder(f).Decode(&input); err != nil {
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".yaml", ".yml":
+		err = decodeYAMLConfig(contents, &input)
+	default:
+		err = toml.Unmarshal(contents, &input)
+	}
+	if err != nil {
 		return ReportingConfig{}, err
 	}
-	// validate config rules
+
+	// validate config rules, reporting bad overrides along with the rest
+	errs := input.applyEnvOverrides(lookupEnv)
 	if err = input.Validate(); err != nil {
-		return ReportingConfig{}, err
+		errs = append(errs, err.(ConfigErrors)...)
+	}
+	if len(errs) > 0 {
+		return ReportingConfig{}, errs
 	}
 
 	input.SetDefaults()
 	return input, nil
 }
 
+// decodeYAMLConfig decodes YAML using the same keys as the TOML config
+func decodeYAMLConfig(contents []byte, input *ReportingConfig) error {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(contents, &raw); err != nil {
+		return err
+	}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		TagName:     "toml",
+		ErrorUnused: true,
+		DecodeHook:  unmarshalTOMLHook,
+		Result:      input,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(raw)
+}
+
+// unmarshalTOMLHook decodes strings into the types that parse themselves from
+// TOML, such as addresses, the same way as the TOML decoder
+func unmarshalTOMLHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String {
+		return data, nil
+	}
+	target := reflect.New(to)
+	unmarshaler, ok := target.Interface().(interface{ UnmarshalTOML([]byte) error })
+	if !ok {
+		return data, nil
+	}
+	quoted, _ := json.Marshal(data)
+	if err := unmarshaler.UnmarshalTOML(quoted); err != nil {
+		return nil, err
+	}
+	return target.Elem().Interface(), nil
+}
+
 func (rc *ReportingConfig) SetDefaults() {
 	if rc.Tuning.BlockProcessingQueueSize < 1 {
 		log.Warn("tuning.BlockProcessingQueueSize below limit", "old value", rc.Tuning.BlockProcessingQueueSize, "new value", 100)
@@ -99,32 +631,452 @@ func (rc *ReportingConfig) SetDefaults() {
 	if rc.Tuning.BlockProcessingFlushPeriod < 1 {
 		rc.Tuning.BlockProcessingFlushPeriod = 3
 	}
+	if rc.Tuning.BlockFetchWorkers < 1 {
+		rc.Tuning.BlockFetchWorkers = 4
+	}
+	if rc.Tuning.BlockProcessingWorkers < 1 {
+		rc.Tuning.BlockProcessingWorkers = 3 * runtime.NumCPU()
+	}
+	if rc.Tuning.MaxInputDataSize < 0 {
+		log.Warn("tuning.MaxInputDataSize below limit", "old value", rc.Tuning.MaxInputDataSize, "new value", 0)
+		rc.Tuning.MaxInputDataSize = 0
+	}
+	if rc.Tuning.MaxReturnDataSize < 0 {
+		log.Warn("tuning.MaxReturnDataSize below limit", "old value", rc.Tuning.MaxReturnDataSize, "new value", 0)
+		rc.Tuning.MaxReturnDataSize = 0
+	}
+	if rc.Tuning.ShutdownTimeout < 1 {
+		rc.Tuning.ShutdownTimeout = 30
+	}
 	if rc.Database != nil && rc.Database.CacheSize < 1 {
 		log.Warn("Database cache size below limit", "old value", rc.Database.CacheSize, "new value", 10)
 		rc.Database.CacheSize = 10
 	}
+	if rc.Database != nil && rc.Database.Elasticsearch != nil {
+		esConfig := rc.Database.Elasticsearch
+		if esConfig.BulkFlushBytes < 1 {
+			esConfig.BulkFlushBytes = 1024 * 1024
+		}
+		if esConfig.BulkFlushInterval < 1 {
+			esConfig.BulkFlushInterval = 1000
+		}
+		if esConfig.BulkWorkers < 1 {
+			esConfig.BulkWorkers = 1
+		}
+	}
+	if rc.Connection.NodeType == "" {
+		rc.Connection.NodeType = QuorumNodeType
+	}
+	if len(rc.Connection.Nodes) > 0 {
+		if rc.Connection.LoadBalancing == "" {
+			rc.Connection.LoadBalancing = FailoverLoadBalancing
+		}
+		if rc.Connection.HealthCheckInterval < 1 {
+			rc.Connection.HealthCheckInterval = 5
+		}
+	}
+	if rc.Profile == "" {
+		rc.Profile = FullProfile
+	}
+	for _, apiKey := range rc.Server.APIKeys {
+		if apiKey.Permission == "" {
+			apiKey.Permission = FullPermission
+		}
+	}
+	for _, listener := range rc.Server.Listeners {
+		if listener.Exposure == "" {
+			listener.Exposure = FullPermission
+		}
+	}
+	if rc.Server.JWT != nil && rc.Server.JWT.PermissionClaim == "" {
+		rc.Server.JWT.PermissionClaim = "permission"
+	}
+	if rc.Server.Health.MaxMonitorLag < 1 {
+		rc.Server.Health.MaxMonitorLag = 10
+	}
+	if rc.Server.Health.MaxFilterLag < 1 {
+		rc.Server.Health.MaxFilterLag = 100
+	}
+	if rc.Server.Health.StallTimeout < 1 {
+		rc.Server.Health.StallTimeout = 300
+	}
+	if rl := rc.Server.RateLimit; rl != nil {
+		for _, limit := range rl.limits() {
+			if limit.Burst < 1 {
+				limit.Burst = int(math.Ceil(limit.Rate))
+			}
+			if limit.Burst < 1 {
+				limit.Burst = 1
+			}
+		}
+	}
+	for _, template := range rc.Templates {
+		for _, column := range append(append([]*CSVColumnConfig{}, template.EventColumns...), template.TransactionColumns...) {
+			if column.Name == "" {
+				column.Name = column.Field
+			}
+		}
+	}
+	if rc.ConfigSync != nil && rc.ConfigSync.PollInterval < 1 {
+		rc.ConfigSync.PollInterval = 10
+	}
+	if rc.AnomalyDetection != nil {
+		if rc.AnomalyDetection.Interval < 1 {
+			rc.AnomalyDetection.Interval = 60
+		}
+		if rc.AnomalyDetection.Window < 2 {
+			rc.AnomalyDetection.Window = 30
+		}
+		if rc.AnomalyDetection.MinSamples < 2 || rc.AnomalyDetection.MinSamples > rc.AnomalyDetection.Window {
+			rc.AnomalyDetection.MinSamples = rc.AnomalyDetection.Window / 3
+			if rc.AnomalyDetection.MinSamples < 2 {
+				rc.AnomalyDetection.MinSamples = 2
+			}
+		}
+		if rc.AnomalyDetection.Threshold <= 0 {
+			rc.AnomalyDetection.Threshold = 3
+		}
+	}
+	if rc.Kafka != nil {
+		if rc.Kafka.BlocksTopic == "" {
+			rc.Kafka.BlocksTopic = "reporting.blocks"
+		}
+		if rc.Kafka.TransactionsTopic == "" {
+			rc.Kafka.TransactionsTopic = "reporting.transactions"
+		}
+		if rc.Kafka.EventsTopic == "" {
+			rc.Kafka.EventsTopic = "reporting.events"
+		}
+		if rc.Kafka.TokenTransfersTopic == "" {
+			rc.Kafka.TokenTransfersTopic = "reporting.tokenTransfers"
+		}
+		if rc.Kafka.PollInterval < 1 {
+			rc.Kafka.PollInterval = 1
+		}
+	}
+	if rc.ABIFetch != nil {
+		if rc.ABIFetch.Source == "" {
+			rc.ABIFetch.Source = SourcifySource
+		}
+		if rc.ABIFetch.Source == SourcifySource && rc.ABIFetch.URL == "" {
+			rc.ABIFetch.URL = "https://repo.sourcify.dev"
+		}
+		if rc.ABIFetch.PollInterval < 1 {
+			rc.ABIFetch.PollInterval = 60
+		}
+	}
+	if rc.Naming != nil {
+		if rc.Naming.Event == "" {
+			rc.Naming.Event = "AddrChanged"
+		}
+		if rc.Naming.NameParameter == "" {
+			rc.Naming.NameParameter = "name"
+		}
+		if rc.Naming.AddressParameter == "" {
+			rc.Naming.AddressParameter = "addr"
+		}
+		if rc.Naming.PollInterval < 1 {
+			rc.Naming.PollInterval = 10
+		}
+	}
+	if rc.Pending != nil {
+		if rc.Pending.PollInterval < 1 {
+			rc.Pending.PollInterval = 1
+		}
+		if rc.Pending.Expiry < 1 {
+			rc.Pending.Expiry = 60
+		}
+		if rc.Pending.MaxTransactions < 1 {
+			rc.Pending.MaxTransactions = 1000
+		}
+	}
+	if rc.Tracing != nil {
+		if rc.Tracing.ServiceName == "" {
+			rc.Tracing.ServiceName = "quorum-reporting"
+		}
+		if rc.Tracing.SampleRatio == 0 {
+			rc.Tracing.SampleRatio = 1
+		}
+	}
+	if rc.HighAvailability != nil {
+		if rc.HighAvailability.LeaseDuration < 1 {
+			rc.HighAvailability.LeaseDuration = 15
+		}
+		if rc.HighAvailability.RenewInterval < 1 {
+			rc.HighAvailability.RenewInterval = 5
+		}
+		if s := rc.HighAvailability.Sharding; s != nil {
+			if s.Mode == "" {
+				s.Mode = LeaseSharding
+			}
+			if s.Mode == LeaseSharding && s.Shards < 1 {
+				s.Shards = 64
+			}
+		}
+	}
+	if rc.Screening != nil {
+		if rc.Screening.CacheTTL < 1 {
+			rc.Screening.CacheTTL = 3600
+		}
+		if rc.Screening.RefreshInterval < 1 {
+			rc.Screening.RefreshInterval = 300
+		}
+	}
+	if rc.Archive != nil {
+		if rc.Archive.Region == "" {
+			rc.Archive.Region = "us-east-1"
+		}
+		if rc.Archive.BatchSize < 1 {
+			rc.Archive.BatchSize = 1000
+		}
+		if rc.Archive.Interval < 1 {
+			rc.Archive.Interval = 3600
+		}
+		if rc.Archive.CacheSize < 1 {
+			rc.Archive.CacheSize = 10
+		}
+	}
+	if rc.Retention != nil && rc.Retention.Interval < 1 {
+		rc.Retention.Interval = 3600
+	}
+	if rc.Maintenance != nil && rc.Maintenance.MaxNumSegments < 1 {
+		rc.Maintenance.MaxNumSegments = 1
+	}
 	if rc.Connection.MaxReconnectTries > 0 && rc.Connection.ReconnectInterval < 1 {
 		log.Warn("Quorum client reconnect interval below limit", "old value", rc.Connection.ReconnectInterval, "new value", 5)
 		rc.Connection.ReconnectInterval = 5
 	}
 }
 
+func isRetentionIndex(index string) bool {
+	for _, retained := range RetentionIndices {
+		if index == retained {
+			return true
+		}
+	}
+	return false
+}
+
+func isCompactIndex(index string) bool {
+	for _, compacted := range CompactIndices {
+		if index == compacted {
+			return true
+		}
+	}
+	return false
+}
+
+// allowLists returns the IP allow-lists of rpcAddr and each listener
+func (rc *ReportingConfig) allowLists() [][]string {
+	allowLists := [][]string{rc.Server.AllowedIPs}
+	for _, listener := range rc.Server.Listeners {
+		allowLists = append(allowLists, listener.AllowedIPs)
+	}
+	return allowLists
+}
+
+// Validate checks the config, returning all the problems found at once as
+// ConfigErrors
 func (rc *ReportingConfig) Validate() error {
+	var errs ConfigErrors
+	if nodeType := rc.Connection.NodeType; nodeType != "" && nodeType != QuorumNodeType && nodeType != BesuNodeType {
+		errs = append(errs, errors.New(fmt.Sprintf("invalid node type: %v", nodeType)))
+	}
+	for _, node := range rc.Connection.Nodes {
+		if node.WSUrl == "" || node.GraphQLUrl == "" {
+			errs = append(errs, errors.New(fmt.Sprintf("node needs a WebSocket and a GraphQL URL: %v", *node)))
+		}
+	}
+	if lb := rc.Connection.LoadBalancing; lb != "" && lb != FailoverLoadBalancing && lb != RoundRobinLoadBalancing {
+		errs = append(errs, errors.New(fmt.Sprintf("invalid load balancing: %v", lb)))
+	}
+	if profile := rc.Profile; profile != "" && profile != FullProfile && profile != HeadersProfile {
+		errs = append(errs, errors.New(fmt.Sprintf("invalid profile: %v", profile)))
+	}
+	if rc.Profile == HeadersProfile && (len(rc.Addresses) > 0 || len(rc.Rules) > 0 || rc.ConfigSync != nil) {
+		errs = append(errs, errors.New("contracts can't be registered with the headers profile"))
+	}
+	if rc.ConfigSync != nil && rc.ConfigSync.Directory == "" {
+		errs = append(errs, errors.New("empty config sync directory"))
+	}
+	if rc.Kafka != nil && len(rc.Kafka.Brokers) == 0 {
+		errs = append(errs, errors.New("no Kafka brokers"))
+	}
+	if f := rc.ABIFetch; f != nil {
+		if f.Source != "" && f.Source != SourcifySource && f.Source != RegistrySource {
+			errs = append(errs, errors.New(fmt.Sprintf("invalid ABI fetch source: %v", f.Source)))
+		}
+		if f.Source == RegistrySource && f.URL == "" {
+			errs = append(errs, errors.New("no ABI registry URL"))
+		}
+	}
+	if rc.Naming != nil && rc.Naming.Registry.IsEmpty() {
+		errs = append(errs, errors.New("no naming registry address"))
+	}
+	if rc.Export != nil && rc.Export.Directory == "" {
+		errs = append(errs, errors.New("empty export directory"))
+	}
+	if t := rc.Tracing; t != nil {
+		if t.Endpoint == "" {
+			errs = append(errs, errors.New("no tracing endpoint"))
+		}
+		if t.SampleRatio < 0 || t.SampleRatio > 1 {
+			errs = append(errs, errors.New("tracing sample ratio must be between 0 and 1"))
+		}
+	}
+	if ha := rc.HighAvailability; ha != nil {
+		if rc.Database == nil || rc.Database.Elasticsearch == nil {
+			errs = append(errs, errors.New("high availability needs an Elasticsearch database"))
+		}
+		// compared as they will be once defaulted
+		leaseDuration, renewInterval := ha.LeaseDuration, ha.RenewInterval
+		if leaseDuration < 1 {
+			leaseDuration = 15
+		}
+		if renewInterval < 1 {
+			renewInterval = 5
+		}
+		if renewInterval >= leaseDuration {
+			errs = append(errs, errors.New("high availability renew interval must be shorter than the lease duration"))
+		}
+		if s := ha.Sharding; s != nil {
+			switch s.Mode {
+			case "", LeaseSharding:
+				if s.Shards < 0 {
+					errs = append(errs, errors.New("sharding shards must be positive"))
+				}
+			case HashSharding:
+				if s.Instances < 1 || s.Index < 0 || s.Index >= s.Instances {
+					errs = append(errs, errors.New("hash sharding needs the number of instances, and an index below it"))
+				}
+			default:
+				errs = append(errs, errors.New("sharding mode must be lease or hash"))
+			}
+		}
+	}
+	if s := rc.Screening; s != nil && len(s.Lists) == 0 && s.URL == "" {
+		errs = append(errs, errors.New("screening needs a list file or a service URL"))
+	}
+	if a := rc.Archive; a != nil {
+		if a.Endpoint == "" || a.Bucket == "" {
+			errs = append(errs, errors.New("archive needs an endpoint and a bucket"))
+		}
+		if a.AccessKeyID == "" || a.SecretAccessKey == "" {
+			errs = append(errs, errors.New("archive needs an access key ID and a secret access key"))
+		}
+		if a.MaxAgeDays < 1 {
+			errs = append(errs, errors.New("archive max age must be at least 1 day"))
+		}
+	}
+	if r := rc.Retention; r != nil {
+		seen := make(map[string]bool, len(r.Policies))
+		for _, policy := range r.Policies {
+			if !isRetentionIndex(policy.Index) {
+				errs = append(errs, errors.New(fmt.Sprintf("index %v can't have a retention policy", policy.Index)))
+			} else if seen[policy.Index] {
+				errs = append(errs, errors.New(fmt.Sprintf("index %v has more than one retention policy", policy.Index)))
+			}
+			seen[policy.Index] = true
+			if policy.MaxAgeDays < 1 {
+				errs = append(errs, errors.New(fmt.Sprintf("retention max age of index %v must be at least 1 day", policy.Index)))
+			}
+		}
+	}
+	if m := rc.Maintenance; m != nil {
+		if m.QuietHoursStart < 0 || m.QuietHoursStart > 23 || m.QuietHoursEnd < 0 || m.QuietHoursEnd > 23 {
+			errs = append(errs, errors.New("maintenance quiet hours must be between 0 and 23"))
+		}
+		if m.QuietHoursStart == m.QuietHoursEnd {
+			errs = append(errs, errors.New("maintenance quiet hours must start and end at different hours"))
+		}
+		for _, index := range m.MergeIndices {
+			if !isCompactIndex(index) {
+				errs = append(errs, errors.New(fmt.Sprintf("index %v can't be merged", index)))
+			}
+		}
+	}
+	groups := make(map[string]bool)
+	for _, group := range rc.Server.ContractGroups {
+		if group.Name == "" {
+			errs = append(errs, errors.New("empty contract group name"))
+		} else if groups[group.Name] {
+			errs = append(errs, errors.New(fmt.Sprintf("contract group name used more than once: %v", group.Name)))
+		}
+		groups[group.Name] = true
+	}
+	for _, apiKey := range rc.Server.APIKeys {
+		if apiKey.Key == "" {
+			errs = append(errs, errors.New("empty API key"))
+		}
+		if apiKey.Permission != "" && !IsValidPermission(apiKey.Permission) {
+			errs = append(errs, errors.New(fmt.Sprintf("invalid API key permission: %v", apiKey.Permission)))
+		}
+		for _, group := range apiKey.Groups {
+			if !groups[group] {
+				errs = append(errs, errors.New(fmt.Sprintf("unknown contract group of API key: %v", group)))
+			}
+		}
+	}
+	addrs := map[string]bool{rc.Server.RPCAddr: true}
+	for _, listener := range rc.Server.Listeners {
+		if listener.Addr == "" {
+			errs = append(errs, errors.New("empty RPC listener address"))
+			continue
+		}
+		if addrs[listener.Addr] {
+			errs = append(errs, errors.New(fmt.Sprintf("RPC address used more than once: %v", listener.Addr)))
+		}
+		addrs[listener.Addr] = true
+		if listener.Exposure != "" && !IsValidExposure(listener.Exposure) {
+			errs = append(errs, errors.New(fmt.Sprintf("invalid RPC listener exposure: %v", listener.Exposure)))
+		}
+	}
+	for _, allowedIPs := range rc.allowLists() {
+		for _, entry := range allowedIPs {
+			if _, err := ParseIPRange(entry); err != nil {
+				errs = append(errs, errors.New(fmt.Sprintf("invalid allowed IP %v: %v", entry, err)))
+			}
+		}
+	}
+	if jwt := rc.Server.JWT; jwt != nil && (jwt.Secret == "") == (jwt.PublicKeyFile == "") {
+		errs = append(errs, errors.New("JWT validation needs either a secret or a public key file"))
+	}
+	if qg := rc.Server.QueryGuard; qg != nil && qg.MaxStorageBlocks == 0 && qg.MaxStorageStates == 0 && qg.MaxAggregationBlocks == 0 && qg.MaxActivityDays == 0 {
+		errs = append(errs, errors.New("query guard needs at least one limit"))
+	}
+	if rl := rc.Server.RateLimit; rl != nil {
+		for _, limit := range rl.limits() {
+			if limit.Rate <= 0 {
+				errs = append(errs, errors.New(fmt.Sprintf("rate limit must be above 0: %v", limit.Rate)))
+			}
+		}
+	}
 	for _, template := range rc.Templates {
 		if template.TemplateName == "" {
-			return errors.New(fmt.Sprintf("empty template name: %v", template))
+			errs = append(errs, errors.New(fmt.Sprintf("empty template name: %v", template)))
 		}
 		if template.ABI == "" {
-			return errors.New(fmt.Sprintf("empty template ABI: %v", template))
+			errs = append(errs, errors.New(fmt.Sprintf("empty template ABI: %v", template)))
+		}
+		for _, column := range append(append([]*CSVColumnConfig{}, template.EventColumns...), template.TransactionColumns...) {
+			if err := column.validate(); err != nil {
+				errs = append(errs, err)
+			}
 		}
 	}
 	for _, rule := range rc.Rules {
-		if rule.Scope != AllScope && rule.Scope != InternalScope && rule.Scope != ExternalScope {
-			return errors.New(fmt.Sprintf("invalid rule scope: %v", rule))
+		if rule.Scope != AllScope && rule.Scope != InternalScope && rule.Scope != ExternalScope && rule.Scope != EventScope {
+			errs = append(errs, errors.New(fmt.Sprintf("invalid rule scope: %v", rule)))
 		}
 		if rule.TemplateName == "" {
-			return errors.New(fmt.Sprintf("invalid rule template name: %v", rule))
+			errs = append(errs, errors.New(fmt.Sprintf("invalid rule template name: %v", rule)))
+		}
+		if rule.Scope == EventScope && (rule.EventTemplate == "" || rule.Event == "" || rule.Parameter == "") {
+			errs = append(errs, errors.New(fmt.Sprintf("event rules need an event template, event and parameter: %v", rule)))
 		}
 	}
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
@@ -0,0 +1,151 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// envOverride is an environment variable that overrides a config setting
+type envOverride struct {
+	name string
+	set  func(rc *ReportingConfig, value string) error
+}
+
+// envOverrides are applied in order after the config file is read, so that
+// containerised deployments can share a file and vary the endpoints and
+// credentials. Lists are comma separated.
+var envOverrides = []envOverride{
+	{"REPORTING_PROFILE", func(rc *ReportingConfig, value string) error {
+		rc.Profile = value
+		return nil
+	}},
+	{"REPORTING_NODE_TYPE", func(rc *ReportingConfig, value string) error {
+		rc.Connection.NodeType = value
+		return nil
+	}},
+	{"REPORTING_WS_URL", func(rc *ReportingConfig, value string) error {
+		rc.Connection.WSUrl = value
+		return nil
+	}},
+	{"REPORTING_GRAPHQL_URL", func(rc *ReportingConfig, value string) error {
+		rc.Connection.GraphQLUrl = value
+		return nil
+	}},
+	{"REPORTING_RPC_ADDR", func(rc *ReportingConfig, value string) error {
+		rc.Server.RPCAddr = value
+		return nil
+	}},
+	{"REPORTING_RPC_CORS_LIST", func(rc *ReportingConfig, value string) error {
+		rc.Server.RPCCorsList = splitEnvList(value)
+		return nil
+	}},
+	{"REPORTING_RPC_VHOSTS", func(rc *ReportingConfig, value string) error {
+		rc.Server.RPCVHosts = splitEnvList(value)
+		return nil
+	}},
+	{"REPORTING_RPC_ALLOWED_IPS", func(rc *ReportingConfig, value string) error {
+		rc.Server.AllowedIPs = splitEnvList(value)
+		return nil
+	}},
+	{"REPORTING_UI_PORT", func(rc *ReportingConfig, value string) error {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		rc.Server.UIPort = port
+		return nil
+	}},
+	{"REPORTING_ES_ADDRESSES", func(rc *ReportingConfig, value string) error {
+		rc.elasticsearch().Addresses = splitEnvList(value)
+		return nil
+	}},
+	{"REPORTING_ES_CLOUD_ID", func(rc *ReportingConfig, value string) error {
+		rc.elasticsearch().CloudID = value
+		return nil
+	}},
+	{"REPORTING_ES_USERNAME", func(rc *ReportingConfig, value string) error {
+		rc.elasticsearch().Username = value
+		return nil
+	}},
+	{"REPORTING_ES_PASSWORD", func(rc *ReportingConfig, value string) error {
+		rc.elasticsearch().Password = value
+		return nil
+	}},
+	{"REPORTING_ES_API_KEY", func(rc *ReportingConfig, value string) error {
+		rc.elasticsearch().APIKey = value
+		return nil
+	}},
+	{"REPORTING_ES_CA_CERT", func(rc *ReportingConfig, value string) error {
+		rc.elasticsearch().CACert = value
+		return nil
+	}},
+	{"REPORTING_ARCHIVE_ACCESS_KEY_ID", func(rc *ReportingConfig, value string) error {
+		rc.archive().AccessKeyID = value
+		return nil
+	}},
+	{"REPORTING_ARCHIVE_SECRET_ACCESS_KEY", func(rc *ReportingConfig, value string) error {
+		rc.archive().SecretAccessKey = value
+		return nil
+	}},
+	{"REPORTING_KAFKA_BROKERS", func(rc *ReportingConfig, value string) error {
+		if rc.Kafka == nil {
+			rc.Kafka = &KafkaConfig{}
+		}
+		rc.Kafka.Brokers = splitEnvList(value)
+		return nil
+	}},
+}
+
+func lookupEnv(name string) (string, bool) {
+	return os.LookupEnv(name)
+}
+
+// applyEnvOverrides sets the config from the environment variables that are
+// set, returning the problems with any of their values
+func (rc *ReportingConfig) applyEnvOverrides(lookup func(string) (string, bool)) ConfigErrors {
+	var errs ConfigErrors
+	for _, override := range envOverrides {
+		value, ok := lookup(override.name)
+		if !ok {
+			continue
+		}
+		if err := override.set(rc, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %v: %v", override.name, err))
+		}
+	}
+	return errs
+}
+
+// elasticsearch returns the Elasticsearch config, adding one if there is none,
+// which switches the database from memory to Elasticsearch
+func (rc *ReportingConfig) elasticsearch() *ElasticsearchConfig {
+	if rc.Database == nil {
+		rc.Database = &DatabaseConfig{}
+	}
+	if rc.Database.Elasticsearch == nil {
+		rc.Database.Elasticsearch = &ElasticsearchConfig{}
+	}
+	return rc.Database.Elasticsearch
+}
+
+// archive returns the archive config, adding one if there is none, which
+// enables archiving
+func (rc *ReportingConfig) archive() *ArchiveConfig {
+	if rc.Archive == nil {
+		rc.Archive = &ArchiveConfig{}
+	}
+	return rc.Archive
+}
+
+func splitEnvList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
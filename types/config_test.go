@@ -95,3 +95,380 @@ func TestConfigFile(t *testing.T) {
 	_, err = ReadConfig("../config.sample.toml")
 	assert.Nil(t, err, "error reading sample config file")
 }
+
+func TestValidateProfile(t *testing.T) {
+	config := ReportingConfig{Profile: "invalid"}
+	assert.EqualError(t, config.Validate(), "invalid profile: invalid")
+
+	config.Profile = HeadersProfile
+	assert.Nil(t, config.Validate())
+
+	config.Rules = []*RuleConfig{{Scope: AllScope, TemplateName: "ERC20"}}
+	assert.EqualError(t, config.Validate(), "contracts can't be registered with the headers profile")
+
+	config.Rules = nil
+	config.SetDefaults()
+	assert.Equal(t, HeadersProfile, config.Profile)
+
+	defaulted := ReportingConfig{}
+	defaulted.SetDefaults()
+	assert.Equal(t, FullProfile, defaulted.Profile)
+}
+
+func TestKafkaConfig(t *testing.T) {
+	config := ReportingConfig{Kafka: &KafkaConfig{}}
+	assert.EqualError(t, config.Validate(), "no Kafka brokers")
+
+	config.Kafka.Brokers = []string{"localhost:9092"}
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, &KafkaConfig{
+		Brokers:             []string{"localhost:9092"},
+		BlocksTopic:         "reporting.blocks",
+		TransactionsTopic:   "reporting.transactions",
+		EventsTopic:         "reporting.events",
+		TokenTransfersTopic: "reporting.tokenTransfers",
+		PollInterval:        1,
+	}, config.Kafka)
+}
+
+func TestABIFetchConfig(t *testing.T) {
+	config := ReportingConfig{ABIFetch: &ABIFetchConfig{Source: "etherscan"}}
+	assert.EqualError(t, config.Validate(), "invalid ABI fetch source: etherscan")
+	config.ABIFetch.Source = RegistrySource
+	assert.EqualError(t, config.Validate(), "no ABI registry URL")
+
+	config.ABIFetch = &ABIFetchConfig{}
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, &ABIFetchConfig{Source: SourcifySource, URL: "https://repo.sourcify.dev", PollInterval: 60}, config.ABIFetch)
+}
+
+func TestNamingConfig(t *testing.T) {
+	config := ReportingConfig{Naming: &NamingConfig{}}
+	assert.EqualError(t, config.Validate(), "no naming registry address")
+
+	registry := NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	config.Naming.Registry = registry
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, &NamingConfig{Registry: registry, Event: "AddrChanged", NameParameter: "name", AddressParameter: "addr", PollInterval: 10}, config.Naming)
+}
+
+func TestPendingConfig(t *testing.T) {
+	config := ReportingConfig{Pending: &PendingConfig{}}
+	config.SetDefaults()
+	assert.Equal(t, &PendingConfig{PollInterval: 1, Expiry: 60, MaxTransactions: 1000}, config.Pending)
+}
+
+func TestTracingConfig(t *testing.T) {
+	config := ReportingConfig{Tracing: &TracingConfig{SampleRatio: 2}}
+	assert.EqualError(t, config.Validate(), "2 configuration errors: no tracing endpoint; tracing sample ratio must be between 0 and 1")
+
+	config.Tracing = &TracingConfig{Endpoint: "http://localhost:4318"}
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, &TracingConfig{Endpoint: "http://localhost:4318", ServiceName: "quorum-reporting", SampleRatio: 1}, config.Tracing)
+}
+
+func TestHighAvailabilityConfig(t *testing.T) {
+	config := ReportingConfig{HighAvailability: &HighAvailabilityConfig{LeaseDuration: 5}}
+	assert.EqualError(t, config.Validate(), "2 configuration errors: high availability needs an Elasticsearch database; high availability renew interval must be shorter than the lease duration")
+
+	config.Database = &DatabaseConfig{Elasticsearch: &ElasticsearchConfig{Addresses: []string{"http://localhost:9200"}}}
+	config.HighAvailability = &HighAvailabilityConfig{InstanceID: "reporting-1"}
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, &HighAvailabilityConfig{InstanceID: "reporting-1", LeaseDuration: 15, RenewInterval: 5}, config.HighAvailability)
+}
+
+func TestShardingConfig(t *testing.T) {
+	config := ReportingConfig{
+		Database:         &DatabaseConfig{Elasticsearch: &ElasticsearchConfig{Addresses: []string{"http://localhost:9200"}}},
+		HighAvailability: &HighAvailabilityConfig{Sharding: &ShardingConfig{Mode: "range"}},
+	}
+	assert.EqualError(t, config.Validate(), "sharding mode must be lease or hash")
+	config.HighAvailability.Sharding = &ShardingConfig{Mode: HashSharding, Instances: 3, Index: 3}
+	assert.EqualError(t, config.Validate(), "hash sharding needs the number of instances, and an index below it")
+
+	config.HighAvailability.Sharding.Index = 2
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, &ShardingConfig{Mode: HashSharding, Instances: 3, Index: 2}, config.HighAvailability.Sharding)
+
+	config.HighAvailability.Sharding = &ShardingConfig{}
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, &ShardingConfig{Mode: LeaseSharding, Shards: 64}, config.HighAvailability.Sharding)
+}
+
+func TestScreeningConfig(t *testing.T) {
+	config := ReportingConfig{Screening: &ScreeningConfig{}}
+	assert.EqualError(t, config.Validate(), "screening needs a list file or a service URL")
+
+	config.Screening.Lists = []string{"sanctions.txt"}
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, &ScreeningConfig{Lists: []string{"sanctions.txt"}, CacheTTL: 3600, RefreshInterval: 300}, config.Screening)
+}
+
+func TestExportConfig(t *testing.T) {
+	config := ReportingConfig{Export: &ExportConfig{}}
+	assert.EqualError(t, config.Validate(), "empty export directory")
+
+	config.Export.Directory = "exports"
+	assert.Nil(t, config.Validate())
+}
+
+func TestArchiveConfig(t *testing.T) {
+	config := ReportingConfig{Archive: &ArchiveConfig{Endpoint: "https://s3.eu-west-1.amazonaws.com", AccessKeyID: "key", SecretAccessKey: "secret", MaxAgeDays: 0}}
+	assert.EqualError(t, config.Validate(), "2 configuration errors: archive needs an endpoint and a bucket; archive max age must be at least 1 day")
+
+	config.Archive.Bucket = "reporting"
+	config.Archive.MaxAgeDays = 90
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, &ArchiveConfig{
+		Endpoint:        "https://s3.eu-west-1.amazonaws.com",
+		Region:          "us-east-1",
+		Bucket:          "reporting",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		MaxAgeDays:      90,
+		BatchSize:       1000,
+		Interval:        3600,
+		CacheSize:       10,
+	}, config.Archive)
+}
+
+func TestRetentionConfig(t *testing.T) {
+	config := ReportingConfig{Retention: &RetentionConfig{Policies: []RetentionPolicy{
+		{Index: "storage", MaxAgeDays: 90},
+		{Index: "block", MaxAgeDays: 30},
+		{Index: "storage", MaxAgeDays: 0},
+	}}}
+	assert.EqualError(t, config.Validate(), "3 configuration errors: index block can't have a retention policy; index storage has more than one retention policy; retention max age of index storage must be at least 1 day")
+
+	config.Retention.Policies = []RetentionPolicy{{Index: "storage", MaxAgeDays: 90}, {Index: "event", MaxAgeDays: 365}}
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, 3600, config.Retention.Interval)
+}
+
+func TestContractGroupConfig(t *testing.T) {
+	config := ReportingConfig{}
+	config.Server.ContractGroups = []*ContractGroupConfig{{Name: "payments"}, {Name: "payments"}, {}}
+	config.Server.APIKeys = []*APIKeyConfig{{Key: "key", Groups: []string{"payments", "lending"}}}
+	assert.EqualError(t, config.Validate(), "3 configuration errors: contract group name used more than once: payments; empty contract group name; unknown contract group of API key: lending")
+
+	config.Server.ContractGroups = []*ContractGroupConfig{{Name: "payments"}, {Name: "lending"}}
+	assert.Nil(t, config.Validate())
+}
+
+func TestMaintenanceConfig(t *testing.T) {
+	config := ReportingConfig{Maintenance: &MaintenanceConfig{QuietHoursStart: 2, QuietHoursEnd: 24}}
+	assert.EqualError(t, config.Validate(), "maintenance quiet hours must be between 0 and 23")
+	config.Maintenance.QuietHoursEnd = 2
+	assert.EqualError(t, config.Validate(), "maintenance quiet hours must start and end at different hours")
+
+	config.Maintenance.QuietHoursEnd = 5
+	config.Maintenance.MergeIndices = []string{"block", "webhook"}
+	assert.EqualError(t, config.Validate(), "index webhook can't be merged")
+
+	config.Maintenance.MergeIndices = []string{"block"}
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, &MaintenanceConfig{QuietHoursStart: 2, QuietHoursEnd: 5, MergeIndices: []string{"block"}, MaxNumSegments: 1}, config.Maintenance)
+}
+
+func TestJWTConfig(t *testing.T) {
+	config := ReportingConfig{}
+	config.Server.JWT = &JWTConfig{}
+	assert.EqualError(t, config.Validate(), "JWT validation needs either a secret or a public key file")
+	config.Server.JWT = &JWTConfig{Secret: "secret", PublicKeyFile: "key.pem"}
+	assert.EqualError(t, config.Validate(), "JWT validation needs either a secret or a public key file")
+
+	config.Server.JWT = &JWTConfig{Secret: "secret"}
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, &JWTConfig{Secret: "secret", PermissionClaim: "permission"}, config.Server.JWT)
+}
+
+func TestQueryGuardConfig(t *testing.T) {
+	config := ReportingConfig{}
+	config.Server.QueryGuard = &QueryGuardConfig{Degrade: true}
+	assert.EqualError(t, config.Validate(), "query guard needs at least one limit")
+
+	config.Server.QueryGuard.MaxStorageBlocks = 100000
+	assert.Nil(t, config.Validate())
+}
+
+func TestRateLimitConfig(t *testing.T) {
+	config := ReportingConfig{}
+	config.Server.RateLimit = &RateLimitConfig{
+		PerClient: &RateLimit{Rate: 0},
+	}
+	assert.EqualError(t, config.Validate(), "rate limit must be above 0: 0")
+
+	config.Server.RateLimit = &RateLimitConfig{
+		Global:    &RateLimit{Rate: 100, Burst: 200},
+		PerClient: &RateLimit{Rate: 2.5},
+		Methods:   map[string]*RateLimit{"reporting.GetStorageHistory": {Rate: 0.1}},
+	}
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, &RateLimitConfig{
+		Global:    &RateLimit{Rate: 100, Burst: 200},
+		PerClient: &RateLimit{Rate: 2.5, Burst: 3},
+		Methods:   map[string]*RateLimit{"reporting.GetStorageHistory": {Rate: 0.1, Burst: 1}},
+	}, config.Server.RateLimit)
+}
+
+func TestCSVColumnConfig(t *testing.T) {
+	template := &TemplateConfig{TemplateName: "settlement", ABI: "[]"}
+	config := ReportingConfig{Templates: []*TemplateConfig{template}}
+
+	template.EventColumns = []*CSVColumnConfig{{Name: "Amount"}}
+	assert.EqualError(t, config.Validate(), "empty CSV column field")
+	template.EventColumns = []*CSVColumnConfig{{Field: "param.amount", Format: "decimals:x"}}
+	assert.EqualError(t, config.Validate(), "invalid CSV column format: decimals:x")
+	template.EventColumns = []*CSVColumnConfig{{Field: "param.amount", Format: "decimals:78"}}
+	assert.EqualError(t, config.Validate(), "invalid CSV column format: decimals:78")
+
+	template.EventColumns = []*CSVColumnConfig{{Field: "param.amount", Format: "decimals:18"}}
+	template.TransactionColumns = []*CSVColumnConfig{{Field: "timestamp", Name: "Date", Format: CSVDateFormat}}
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, "param.amount", template.EventColumns[0].Name)
+	assert.Equal(t, "Date", template.TransactionColumns[0].Name)
+}
+
+func TestEventRuleConfig(t *testing.T) {
+	config := ReportingConfig{Rules: []*RuleConfig{{Scope: EventScope, TemplateName: "Wallet", EventTemplate: "WalletFactory", Event: "WalletCreated"}}}
+	assert.EqualError(t, config.Validate(), "event rules need an event template, event and parameter: &{event  Wallet   WalletFactory WalletCreated  }")
+
+	config.Rules[0].Parameter = "wallet"
+	assert.Nil(t, config.Validate())
+}
+
+func TestNodesConfig(t *testing.T) {
+	config := ReportingConfig{}
+	config.Connection.Nodes = []*NodeConfig{{WSUrl: "ws://localhost:23000"}}
+	assert.EqualError(t, config.Validate(), "node needs a WebSocket and a GraphQL URL: {ws://localhost:23000 }")
+
+	config.Connection.Nodes[0].GraphQLUrl = "http://localhost:8547/graphql"
+	config.Connection.LoadBalancing = "random"
+	assert.EqualError(t, config.Validate(), "invalid load balancing: random")
+
+	config.Connection.LoadBalancing = ""
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, FailoverLoadBalancing, config.Connection.LoadBalancing)
+	assert.Equal(t, 5, config.Connection.HealthCheckInterval)
+}
+
+func TestHealthConfig(t *testing.T) {
+	config := ReportingConfig{}
+	config.Server.Health.MaxFilterLag = 500
+	config.SetDefaults()
+	assert.Equal(t, HealthConfig{MaxMonitorLag: 10, MaxFilterLag: 500, StallTimeout: 300}, config.Server.Health)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	config := ReportingConfig{}
+	config.SetDefaults()
+	assert.Equal(t, 30, config.Tuning.ShutdownTimeout)
+
+	config.Tuning.ShutdownTimeout = 5
+	config.SetDefaults()
+	assert.Equal(t, 5, config.Tuning.ShutdownTimeout)
+}
+
+func TestListenerConfig(t *testing.T) {
+	config := ReportingConfig{}
+	config.Server.RPCAddr = "localhost:4000"
+	config.Server.AllowedIPs = []string{"127.0.0.1"}
+	config.Server.Listeners = []*ListenerConfig{
+		{Addr: "10.0.0.5:4000", Exposure: WriteExposure, AllowedIPs: []string{"10.0.0.0/8"}},
+		{Addr: "192.168.0.5:4000"},
+	}
+	assert.Nil(t, config.Validate())
+	config.SetDefaults()
+	assert.Equal(t, FullPermission, config.Server.Listeners[1].Exposure)
+
+	config.Server.Listeners[1].Addr = "localhost:4000"
+	assert.EqualError(t, config.Validate(), "RPC address used more than once: localhost:4000")
+	config.Server.Listeners[1].Addr = "192.168.0.5:4000"
+
+	config.Server.Listeners[1].Exposure = "admin"
+	assert.EqualError(t, config.Validate(), "invalid RPC listener exposure: admin")
+	config.Server.Listeners[1].Exposure = ReadPermission
+
+	config.Server.Listeners[1].AllowedIPs = []string{"not an ip"}
+	assert.EqualError(t, config.Validate(), "invalid allowed IP not an ip: invalid IP address: not an ip")
+}
+
+func TestParseIPRange(t *testing.T) {
+	ipRange, err := ParseIPRange("10.0.0.1")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1/32", ipRange.String())
+
+	ipRange, err = ParseIPRange("fd00::/8")
+	assert.Nil(t, err)
+	assert.Equal(t, "fd00::/8", ipRange.String())
+
+	ipRange, err = ParseIPRange("::1")
+	assert.Nil(t, err)
+	assert.Equal(t, "::1/128", ipRange.String())
+}
+
+func TestYAMLConfig(t *testing.T) {
+	tomlConfig, err := ReadConfig("../config.docker.sample.toml")
+	assert.Nil(t, err)
+	yamlConfig, err := ReadConfig("../config.docker.sample.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, tomlConfig, yamlConfig)
+
+	d, _ := ioutil.TempDir("", "test")
+	defer os.RemoveAll(d)
+	fileName := d + "/config.yml"
+	assert.Nil(t, ioutil.WriteFile(fileName, []byte("server:\n  rpcAddr: localhost:4000\n  unknown: true\n"), 0644))
+	_, err = ReadConfig(fileName)
+	assert.Contains(t, err.Error(), "invalid keys: unknown")
+}
+
+func TestEnvOverrides(t *testing.T) {
+	env := map[string]string{
+		"REPORTING_WS_URL":                    "ws://node:8546",
+		"REPORTING_ES_ADDRESSES":              "http://es1:9200, http://es2:9200",
+		"REPORTING_RPC_CORS_LIST":             "",
+		"REPORTING_UI_PORT":                   "3000",
+		"REPORTING_ARCHIVE_SECRET_ACCESS_KEY": "secret",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	config := ReportingConfig{}
+	config.Server.RPCCorsList = []string{"*"}
+	assert.Nil(t, config.applyEnvOverrides(lookup))
+	assert.Equal(t, "ws://node:8546", config.Connection.WSUrl)
+	assert.Equal(t, []string{"http://es1:9200", "http://es2:9200"}, config.Database.Elasticsearch.Addresses)
+	assert.Nil(t, config.Server.RPCCorsList)
+	assert.Equal(t, 3000, config.Server.UIPort)
+	assert.Equal(t, "secret", config.Archive.SecretAccessKey)
+
+	env["REPORTING_UI_PORT"] = "ui"
+	assert.EqualError(t, config.applyEnvOverrides(lookup), "invalid REPORTING_UI_PORT: must be a number")
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	config := ReportingConfig{Profile: "invalid"}
+	config.Connection.LoadBalancing = "random"
+	config.Kafka = &KafkaConfig{}
+
+	err := config.Validate()
+	assert.Len(t, err, 3)
+	assert.EqualError(t, err, "3 configuration errors: invalid load balancing: random; invalid profile: invalid; no Kafka brokers")
+}
@@ -4,4 +4,87 @@ const (
 	AllScope      = "all"
 	InternalScope = "internal"
 	ExternalScope = "external"
+	// EventScope rules register the addresses emitted in an event parameter
+	EventScope = "event"
+)
+
+// node types
+const (
+	QuorumNodeType = "quorum"
+	BesuNodeType   = "besu"
+)
+
+// how calls are spread over several nodes
+const (
+	// FailoverLoadBalancing sends calls to the first healthy node
+	FailoverLoadBalancing = "failover"
+	// RoundRobinLoadBalancing sends calls to each healthy node in turn
+	RoundRobinLoadBalancing = "roundRobin"
+)
+
+// API key and token permissions
+const (
+	FullPermission      = "full"
+	ReadPermission      = "read"
+	AggregatePermission = "aggregate"
+)
+
+// WriteExposure is how much of the RPC API a listener can expose besides the
+// permissions: every method except the admin ones
+const WriteExposure = "write"
+
+// formats of CSV export columns
+const (
+	// CSVDateFormat and CSVDateTimeFormat format Unix timestamps in UTC, as
+	// 2006-01-02 and RFC 3339
+	CSVDateFormat     = "date"
+	CSVDateTimeFormat = "datetime"
+	// CSVDecimalsFormat is followed by a number of decimals, shifting the
+	// decimal point of integers left by that many places, e.g. "decimals:18"
+	CSVDecimalsFormat = "decimals:"
+)
+
+// ingestion profiles
+const (
+	// FullProfile indexes everything, including traces and contract storage
+	FullProfile = "full"
+	// HeadersProfile indexes only block headers and transaction summaries
+	HeadersProfile = "headers"
+)
+
+// where the ABIs of registered contracts are looked up
+const (
+	// SourcifySource looks contracts up on Sourcify by chain ID and address
+	SourcifySource = "sourcify"
+	// RegistrySource looks contracts up by the metadata hash the compiler
+	// appends to their bytecode
+	RegistrySource = "registry"
+)
+
+// token standards
+const (
+	ERC20Standard   = "erc20"
+	ERC721Standard  = "erc721"
+	ERC1155Standard = "erc1155"
+)
+
+// background job types and statuses
+const (
+	DeleteAddressJob = "deleteAddress"
+	BackfillJob      = "backfill"
+	ExportJob        = "export"
+	IntegrityJob     = "verifyIntegrity"
+	InferLayoutJob   = "inferStorageLayout"
+	CodeMatchJob     = "assignTemplateByCode"
+
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// processing journal stages
+const (
+	IngestStage = "ingest"
+	FilterStage = "filter"
+	ScreenStage = "screen"
 )
@@ -0,0 +1,24 @@
+package types
+
+// kinds of resource contracts can be ranked by
+const (
+	ProcessingTimeCost = "processingTime"
+	NodeCallsCost      = "nodeCalls"
+	DocumentsCost      = "documents"
+)
+
+// ContractCost is what filtering a contract has consumed since the service
+// started, and how many documents are stored for it.
+type ContractCost struct {
+	Address        Address `json:"address"`
+	BlocksFiltered uint64  `json:"blocksFiltered"`
+	// time spent fetching and decoding the contract's storage, and its share
+	// of indexing the blocks it was filtered with
+	ProcessingSeconds float64 `json:"processingSeconds"`
+	// storage roots and dumps read from the node
+	NodeCalls uint64 `json:"nodeCalls"`
+	// transactions to, events from and storage of the contract
+	Documents uint64 `json:"documents"`
+	// left out of filtering until unthrottled
+	Throttled bool `json:"throttled"`
+}
@@ -0,0 +1,16 @@
+package types
+
+// lifecycle statuses of contracts
+const (
+	ContractActive    = "active"
+	ContractDestroyed = "destroyed"
+)
+
+// ContractStatus is where a registered contract is in its lifecycle
+type ContractStatus struct {
+	Address             Address `json:"address"`
+	Status              string  `json:"status"`
+	CreationTransaction Hash    `json:"creationTransaction"`
+	// the block the contract self-destructed at, 0 while it is active
+	DestroyedAt uint64 `json:"destroyedAt"`
+}
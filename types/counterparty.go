@@ -0,0 +1,96 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// SortByRecency lists the counterparties that interacted last first
+	SortByRecency = "recency"
+	// SortByVolume lists the counterparties with the most interactions first
+	SortByVolume = "volume"
+)
+
+// Counterparty is an address that has interacted with a registered contract,
+// by sending it a transaction or calling it from another contract. Each
+// transaction counts as one interaction, however many calls it makes.
+type Counterparty struct {
+	Address            Address `json:"address"`
+	FirstSeenBlock     uint64  `json:"firstSeenBlock"`
+	FirstSeenTimestamp uint64  `json:"firstSeenTimestamp"`
+	LastSeenBlock      uint64  `json:"lastSeenBlock"`
+	LastSeenTimestamp  uint64  `json:"lastSeenTimestamp"`
+	Interactions       uint64  `json:"interactions"`
+}
+
+// Counterparties returns the addresses that interact with the contract in
+// the transaction, as its sender or as the caller of an internal call, other
+// than the contract itself
+func (tx *Transaction) Counterparties(contract Address) []Address {
+	seen := make(map[Address]bool)
+	var counterparties []Address
+	add := func(from Address) {
+		if from != contract && !from.IsEmpty() && !seen[from] {
+			seen[from] = true
+			counterparties = append(counterparties, from)
+		}
+	}
+	if tx.To == contract {
+		add(tx.From)
+	}
+	for _, call := range tx.InternalCalls {
+		if call.To == contract {
+			add(call.From)
+		}
+	}
+	return counterparties
+}
+
+// SortCounterparties orders counterparties by the given sort, breaking ties
+// by the most recent interaction and then by address
+func SortCounterparties(counterparties []*Counterparty, sortBy string) {
+	sort.Slice(counterparties, func(i, j int) bool {
+		a, b := counterparties[i], counterparties[j]
+		if sortBy == SortByVolume && a.Interactions != b.Interactions {
+			return a.Interactions > b.Interactions
+		}
+		if a.LastSeenBlock != b.LastSeenBlock {
+			return a.LastSeenBlock > b.LastSeenBlock
+		}
+		return a.Address < b.Address
+	})
+}
+
+var defaultCounterpartyQueryOptions = &CounterpartyQueryOptions{
+	SortBy:     SortByRecency,
+	PageSize:   10,
+	PageNumber: 0,
+}
+
+type CounterpartyQueryOptions struct {
+	// "recency" (default) or "volume"
+	SortBy string `json:"sortBy"`
+
+	PageSize   int `json:"pageSize"`
+	PageNumber int `json:"pageNumber"`
+}
+
+func (opts *CounterpartyQueryOptions) SetDefaults() {
+	if opts.SortBy == "" {
+		opts.SortBy = defaultCounterpartyQueryOptions.SortBy
+	}
+	if opts.PageSize == 0 {
+		opts.PageSize = defaultCounterpartyQueryOptions.PageSize
+	}
+	if opts.PageNumber == 0 {
+		opts.PageNumber = defaultCounterpartyQueryOptions.PageNumber
+	}
+}
+
+func (opts *CounterpartyQueryOptions) Validate() error {
+	if opts.SortBy != SortByRecency && opts.SortBy != SortByVolume {
+		return fmt.Errorf("invalid sort %q, expected recency or volume", opts.SortBy)
+	}
+	return nil
+}
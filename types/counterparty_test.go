@@ -0,0 +1,50 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction_Counterparties(t *testing.T) {
+	contract := NewAddress("0x1")
+	sender := NewAddress("0x2")
+	caller := NewAddress("0x3")
+	tx := &Transaction{
+		From: sender,
+		To:   contract,
+		InternalCalls: []*InternalCall{
+			{From: contract, To: caller},
+			{From: caller, To: contract},
+			{From: contract, To: contract},
+			{From: caller, To: contract},
+			{To: contract},
+		},
+	}
+	assert.Equal(t, []Address{sender, caller}, tx.Counterparties(contract))
+	assert.Equal(t, []Address{contract}, tx.Counterparties(caller))
+	assert.Empty(t, tx.Counterparties(sender))
+}
+
+func TestSortCounterparties(t *testing.T) {
+	a := &Counterparty{Address: NewAddress("0x1"), LastSeenBlock: 10, Interactions: 1}
+	b := &Counterparty{Address: NewAddress("0x2"), LastSeenBlock: 5, Interactions: 7}
+	c := &Counterparty{Address: NewAddress("0x3"), LastSeenBlock: 10, Interactions: 7}
+
+	counterparties := []*Counterparty{a, b, c}
+	SortCounterparties(counterparties, SortByRecency)
+	assert.Equal(t, []*Counterparty{a, c, b}, counterparties)
+
+	SortCounterparties(counterparties, SortByVolume)
+	assert.Equal(t, []*Counterparty{c, b, a}, counterparties)
+}
+
+func TestCounterpartyQueryOptions(t *testing.T) {
+	options := &CounterpartyQueryOptions{}
+	options.SetDefaults()
+	assert.Equal(t, &CounterpartyQueryOptions{SortBy: SortByRecency, PageSize: 10}, options)
+	assert.Nil(t, options.Validate())
+
+	options.SortBy = "value"
+	assert.EqualError(t, options.Validate(), `invalid sort "value", expected recency or volume`)
+}
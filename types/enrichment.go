@@ -0,0 +1,74 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// EnrichmentMapping copies decoded parameters of a contract's events and
+// transactions into top-level fields of their indexed documents, so they can
+// be filtered and sorted on directly. It maps each document field name to the
+// name of the decoded parameter it is copied from.
+type EnrichmentMapping map[string]string
+
+// reservedFields are the fields transaction and event documents already have,
+// which enriched fields can't replace
+var reservedFields = jsonFieldNames(Transaction{}, Event{})
+
+func jsonFieldNames(documents ...interface{}) map[string]bool {
+	names := make(map[string]bool)
+	for _, document := range documents {
+		documentType := reflect.TypeOf(document)
+		for i := 0; i < documentType.NumField(); i++ {
+			name := strings.Split(documentType.Field(i).Tag.Get("json"), ",")[0]
+			names[name] = true
+		}
+	}
+	return names
+}
+
+func (em EnrichmentMapping) Validate() error {
+	for field, param := range em {
+		if field == "" || param == "" {
+			return errors.New("enrichment field and parameter names can't be empty")
+		}
+		if reservedFields[field] || field == SeverityField || strings.ContainsAny(field, ".*") {
+			return errors.New(fmt.Sprintf("invalid enrichment field name: %v", field))
+		}
+	}
+	return nil
+}
+
+// Fields returns the mapped values found in the decoded data. Every value is
+// copied as a string, so a field has the same type in every document whatever
+// the parameters it is copied from: integers in decimal, addresses and bytes
+// in hex, and arrays and tuples as JSON.
+func (em EnrichmentMapping) Fields(data ParsedData) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for field, param := range em {
+		value, ok := data[param]
+		if !ok {
+			continue
+		}
+		fields[field] = enrichedValue(value)
+	}
+	return fields
+}
+
+func enrichedValue(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	var str string
+	if json.Unmarshal(encoded, &str) == nil {
+		return str
+	}
+	return string(encoded)
+}
@@ -0,0 +1,37 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrichmentMapping_Validate(t *testing.T) {
+	assert.Nil(t, EnrichmentMapping{"orderId": "_orderId"}.Validate())
+	assert.EqualError(t, EnrichmentMapping{"orderId": ""}.Validate(), "enrichment field and parameter names can't be empty")
+	assert.EqualError(t, EnrichmentMapping{"blockNumber": "_block"}.Validate(), "invalid enrichment field name: blockNumber")
+	assert.EqualError(t, EnrichmentMapping{"order.id": "_orderId"}.Validate(), "invalid enrichment field name: order.id")
+}
+
+func TestEnrichmentMapping_Fields(t *testing.T) {
+	large, _ := new(big.Int).SetString("100000000000000000000", 10)
+	data := ParsedData{
+		"_orderId":      big.NewInt(42),
+		"_amount":       large,
+		"_counterparty": NewAddress("0x0000000000000000000000000000000000000001"),
+		"_settled":      true,
+		"_reference":    "abc",
+		"_legs":         []*big.Int{big.NewInt(1), big.NewInt(2)},
+	}
+	mapping := EnrichmentMapping{"orderId": "_orderId", "amount": "_amount", "counterparty": "_counterparty", "settled": "_settled", "reference": "_reference", "legs": "_legs", "missing": "_missing"}
+	// all as strings, so each field has one type however large the number
+	assert.Equal(t, map[string]interface{}{
+		"orderId":      "42",
+		"amount":       "100000000000000000000",
+		"counterparty": "0x0000000000000000000000000000000000000001",
+		"settled":      "true",
+		"reference":    "abc",
+		"legs":         "[1,2]",
+	}, mapping.Fields(data))
+}
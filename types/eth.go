@@ -32,6 +32,10 @@ func (addr *Address) UnmarshalJSON(input []byte) error {
 	if err := json.Unmarshal(input, &unwrapped); err != nil {
 		return err
 	}
+	if resolved, ok := resolveName(unwrapped); ok {
+		*addr = resolved
+		return nil
+	}
 	bytes, err := fromHex(unwrapped)
 	if err != nil {
 		return err
@@ -119,6 +123,10 @@ type RawAccountState struct {
 type AccountState struct {
 	Root    Hash            `json:"root"`
 	Storage map[Hash]string `json:"storage,omitempty"`
+
+	// Decoded is the storage decoded with the contract's storage layout, nil
+	// if it has none
+	Decoded []*StorageValue `json:"-"`
 }
 
 type HexData string
@@ -28,6 +28,23 @@ func TestAddress_UnmarshalJSON(t *testing.T) {
 	assert.EqualValues(t, NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34"), addr)
 }
 
+func TestAddress_UnmarshalJSON_Name(t *testing.T) {
+	registered := NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	SetNameResolver(func(name string) (Address, bool) {
+		return registered, name == "treasury.quorum"
+	})
+	defer SetNameResolver(nil)
+
+	var addr Address
+	assert.Nil(t, json.Unmarshal([]byte(`"treasury.quorum"`), &addr))
+	assert.Equal(t, registered, addr)
+
+	// hex is never looked up, and unknown names aren't addresses
+	assert.Nil(t, json.Unmarshal([]byte(`"0x0000000000000000000000000000000000000001"`), &addr))
+	assert.Equal(t, NewAddress("0x01"), addr)
+	assert.NotNil(t, json.Unmarshal([]byte(`"unknown.quorum"`), &addr))
+}
+
 func TestAddress_UnmarshalTOML(t *testing.T) {
 	sampleAddress := `address = "0x1932c48b2bf8102ba33b4a6b545c32236e342f34"`
 
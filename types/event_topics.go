@@ -0,0 +1,61 @@
+package types
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+// EventTopicQuery selects events by their topics, from one contract or from
+// all registered contracts. Topics are matched by position, and a missing or
+// null topic matches anything; topic0 must be given, either directly or as
+// the event signature it is the hash of.
+type EventTopicQuery struct {
+	// the contract that emitted the events, or all registered contracts
+	Address *Address `json:"address,omitempty"`
+	// the canonical event signature, e.g. Transfer(address,address,uint256)
+	EventSignature string `json:"eventSignature,omitempty"`
+	// topic0 to topic3
+	Topics []*Hash `json:"topics,omitempty"`
+	// if not nil, the registered contracts searched when no address is given
+	Contracts []Address `json:"-"`
+}
+
+// Resolve checks the query, and replaces the event signature with the
+// topic0 it hashes to.
+func (q *EventTopicQuery) Resolve() error {
+	if len(q.Topics) > 4 {
+		return errors.New("events have at most 4 topics")
+	}
+	if q.EventSignature != "" {
+		if !eventSignaturePattern.MatchString(q.EventSignature) {
+			return errors.New("event signature must be of the form Name(type1,type2,...)")
+		}
+		if len(q.Topics) > 0 && q.Topics[0] != nil {
+			return errors.New("give either an event signature or topic0, not both")
+		}
+		topic0 := NewHash(hex.EncodeToString(hash(q.EventSignature)))
+		if len(q.Topics) == 0 {
+			q.Topics = []*Hash{nil}
+		}
+		q.Topics[0] = &topic0
+		q.EventSignature = ""
+	}
+	if len(q.Topics) == 0 || q.Topics[0] == nil {
+		return errors.New("event signature or topic0 not provided")
+	}
+	return nil
+}
+
+// Matches checks whether the event has the topics of the query. It doesn't
+// check the address.
+func (q *EventTopicQuery) Matches(event *Event) bool {
+	for i, topic := range q.Topics {
+		if topic == nil {
+			continue
+		}
+		if i >= len(event.Topics) || event.Topics[i] != *topic {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventTopicQuery_Resolve(t *testing.T) {
+	transfer := NewHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	holder := NewHash("0x0000000000000000000000009d13c6d3afe1721beef56b55d303b09e021e27ab")
+
+	query := &EventTopicQuery{EventSignature: "Transfer(address,address,uint256)"}
+	assert.Nil(t, query.Resolve())
+	assert.Equal(t, []*Hash{&transfer}, query.Topics)
+	assert.Empty(t, query.EventSignature)
+
+	// the signature fills in topic0, keeping the other topics
+	query = &EventTopicQuery{EventSignature: "Transfer(address,address,uint256)", Topics: []*Hash{nil, nil, &holder}}
+	assert.Nil(t, query.Resolve())
+	assert.Equal(t, []*Hash{&transfer, nil, &holder}, query.Topics)
+
+	assert.Nil(t, (&EventTopicQuery{Topics: []*Hash{&transfer}}).Resolve())
+
+	assert.EqualError(t, (&EventTopicQuery{}).Resolve(), "event signature or topic0 not provided")
+	assert.EqualError(t, (&EventTopicQuery{Topics: []*Hash{nil, &holder}}).Resolve(), "event signature or topic0 not provided")
+	assert.EqualError(t, (&EventTopicQuery{EventSignature: "Transfer", Topics: []*Hash{&transfer}}).Resolve(), "event signature must be of the form Name(type1,type2,...)")
+	assert.EqualError(t, (&EventTopicQuery{EventSignature: "Transfer(address,address,uint256)", Topics: []*Hash{&transfer}}).Resolve(), "give either an event signature or topic0, not both")
+	assert.EqualError(t, (&EventTopicQuery{Topics: []*Hash{&transfer, nil, nil, nil, nil}}).Resolve(), "events have at most 4 topics")
+}
+
+func TestEventTopicQuery_Matches(t *testing.T) {
+	transfer := NewHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	holder := NewHash("0x0000000000000000000000009d13c6d3afe1721beef56b55d303b09e021e27ab")
+	event := &Event{Topics: []Hash{transfer, holder}}
+
+	assert.True(t, (&EventTopicQuery{Topics: []*Hash{&transfer}}).Matches(event))
+	assert.True(t, (&EventTopicQuery{Topics: []*Hash{&transfer, &holder}}).Matches(event))
+	assert.True(t, (&EventTopicQuery{Topics: []*Hash{&transfer, nil}}).Matches(event))
+	assert.False(t, (&EventTopicQuery{Topics: []*Hash{&holder}}).Matches(event))
+	assert.False(t, (&EventTopicQuery{Topics: []*Hash{&transfer, &transfer}}).Matches(event))
+	// the event has no third topic to match
+	assert.False(t, (&EventTopicQuery{Topics: []*Hash{&transfer, nil, &holder}}).Matches(event))
+}
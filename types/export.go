@@ -0,0 +1,30 @@
+package types
+
+// export file formats
+const (
+	CSVFormat     = "csv"
+	ParquetFormat = "parquet"
+)
+
+// export datasets, each written to its own file
+const (
+	TransactionsDataset = "transactions"
+	EventsDataset       = "events"
+	StorageDataset      = "storage"
+	BalancesDataset     = "balances"
+)
+
+// ExportDatasets are all the datasets a contract's data can be exported as
+var ExportDatasets = []string{TransactionsDataset, EventsDataset, StorageDataset, BalancesDataset}
+
+// ExportRequest is the data of a contract in a block range to write to files,
+// one file per dataset. An end block of 0 exports up to the block the contract
+// has been filtered to, and no datasets exports all of them.
+type ExportRequest struct {
+	Address    Address  `json:"address"`
+	StartBlock uint64   `json:"startBlock"`
+	EndBlock   uint64   `json:"endBlock"`
+	Datasets   []string `json:"datasets,omitempty"`
+	// "csv" (default) or "parquet"
+	Format string `json:"format,omitempty"`
+}
@@ -0,0 +1,148 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// GasUsageByContract groups transactions by the contract they were sent
+	// to, or created
+	GasUsageByContract = "contract"
+	// GasUsageByFunction groups transactions by the function selector of
+	// their input
+	GasUsageByFunction = "function"
+	// GasUsageByDay groups transactions by the UTC day of their block
+	GasUsageByDay = "day"
+
+	defaultGasUsageLimit = 100
+	maxGasUsageLimit     = 1000
+)
+
+// GasUsageQuery selects the transactions whose gas used is totalled, and how
+// they are grouped
+type GasUsageQuery struct {
+	// "contract", "function" or "day"
+	GroupBy string `json:"-"`
+	// the contract the transactions were sent to, or all contracts
+	Contract *Address `json:"contract,omitempty"`
+	// if not nil, the contracts the transactions were sent to when no
+	// contract is given
+	Contracts []Address `json:"-"`
+	// the inclusive block range, to the latest block if the end is 0
+	StartBlock uint64 `json:"startBlock"`
+	EndBlock   uint64 `json:"endBlock"`
+	// the most groups returned, the most expensive, or for days the latest
+	Limit int `json:"limit"`
+}
+
+func (q *GasUsageQuery) SetDefaults() {
+	if q.Limit == 0 {
+		q.Limit = defaultGasUsageLimit
+	}
+}
+
+func (q *GasUsageQuery) Validate() error {
+	if q.GroupBy != GasUsageByContract && q.GroupBy != GasUsageByFunction && q.GroupBy != GasUsageByDay {
+		return fmt.Errorf("invalid grouping %q, expected contract, function or day", q.GroupBy)
+	}
+	if q.Limit < 0 || q.Limit > maxGasUsageLimit {
+		return fmt.Errorf("limit must be between 1 and %d", maxGasUsageLimit)
+	}
+	if q.EndBlock != 0 && q.EndBlock < q.StartBlock {
+		return fmt.Errorf("end block %d is before start block %d", q.EndBlock, q.StartBlock)
+	}
+	return nil
+}
+
+// Matches reports whether the transaction is one the query totals
+func (q *GasUsageQuery) Matches(tx *Transaction) bool {
+	if tx.BlockNumber < q.StartBlock || (q.EndBlock != 0 && tx.BlockNumber > q.EndBlock) {
+		return false
+	}
+	contract := tx.Contract()
+	if q.Contract != nil {
+		return contract == *q.Contract
+	}
+	if q.Contracts != nil {
+		for _, address := range q.Contracts {
+			if contract == address {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// GasUsage is the gas used by a group of transactions
+type GasUsage struct {
+	// the contract address, the function selector, or the day as YYYY-MM-DD
+	Key            string `json:"key"`
+	Transactions   uint64 `json:"transactions"`
+	TotalGasUsed   uint64 `json:"totalGasUsed"`
+	AverageGasUsed uint64 `json:"averageGasUsed"`
+}
+
+// GasUsageDay is the key of the day a block was produced in
+func GasUsageDay(timestamp uint64) string {
+	return time.Unix(int64(timestamp), 0).UTC().Format("2006-01-02")
+}
+
+// SortGasUsage orders days oldest first, and other groups by the gas they
+// used, most first, then keeps at most limit of them: the latest days, or the
+// most expensive groups. Averages are filled in from the totals.
+func SortGasUsage(usage []*GasUsage, groupBy string, limit int) []*GasUsage {
+	for _, u := range usage {
+		if u.Transactions > 0 {
+			u.AverageGasUsed = u.TotalGasUsed / u.Transactions
+		}
+	}
+	if groupBy == GasUsageByDay {
+		sort.Slice(usage, func(i, j int) bool { return usage[i].Key < usage[j].Key })
+		if len(usage) > limit {
+			usage = usage[len(usage)-limit:]
+		}
+		return usage
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].TotalGasUsed != usage[j].TotalGasUsed {
+			return usage[i].TotalGasUsed > usage[j].TotalGasUsed
+		}
+		return usage[i].Key < usage[j].Key
+	})
+	if len(usage) > limit {
+		usage = usage[:limit]
+	}
+	return usage
+}
+
+// Contract is the contract the transaction was sent to, or created, and is
+// empty for transactions to no one
+func (tx *Transaction) Contract() Address {
+	if !tx.CreatedContract.IsEmpty() {
+		return tx.CreatedContract
+	}
+	if tx.To.IsEmpty() {
+		return ""
+	}
+	return tx.To
+}
+
+// Selector is the function selector at the start of the transaction's input,
+// the private input of a private transaction, or empty if the transaction
+// created a contract or has no selector
+func (tx *Transaction) Selector() HexData {
+	if !tx.CreatedContract.IsEmpty() {
+		return ""
+	}
+	data := tx.Data
+	if len(tx.PrivateData) > 0 {
+		data = tx.PrivateData
+	}
+	if len(data) < 8 {
+		return ""
+	}
+	return data[:8]
+}
@@ -0,0 +1,30 @@
+package types
+
+// components checked by the health endpoints
+const (
+	QuorumComponent   = "quorum"
+	DatabaseComponent = "database"
+	MonitorComponent  = "monitor"
+	FilterComponent   = "filter"
+)
+
+// HealthReport is the status of the service and its components. It is live
+// unless it needs restarting, and ready if every component is healthy.
+type HealthReport struct {
+	Live  bool `json:"live"`
+	Ready bool `json:"ready"`
+	// set while ingestion is paused, when the monitor and filter are not
+	// expected to keep up
+	Paused bool `json:"paused,omitempty"`
+	// set on a standby in high availability mode, which doesn't filter
+	Standby    bool               `json:"standby,omitempty"`
+	Components []*ComponentHealth `json:"components"`
+}
+
+type ComponentHealth struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+	// blocks the component is behind, for the monitor and filter
+	Lag *uint64 `json:"lag,omitempty"`
+}
@@ -0,0 +1,76 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+)
+
+// kinds of document stored with a checksum
+const (
+	BlockDocument       = "block"
+	TransactionDocument = "transaction"
+	EventDocument       = "event"
+)
+
+// Checksum is the hex encoded SHA-256 hash of the JSON encoding of a
+// document's content, which is stored alongside it so that changes made to
+// the document outside of the application can be detected.
+//
+// Empty hashes and addresses are encoded as "0x" but read back as zeros, so
+// the content is hashed as it is read back from its encoding, which is the
+// same before and after it has been stored. Content that can't be read back
+// is hashed as it is encoded.
+func Checksum(content interface{}) (string, error) {
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	decoded := reflect.New(reflect.Indirect(reflect.ValueOf(content)).Type()).Interface()
+	if err := json.Unmarshal(encoded, decoded); err == nil {
+		if encoded, err = json.Marshal(decoded); err != nil {
+			return "", err
+		}
+	}
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// StoredDocument is a document read back from the database with the checksum
+// it was stored with, which is empty if it was stored by a version that
+// didn't compute checksums.
+type StoredDocument struct {
+	Kind        string
+	ID          string
+	BlockNumber uint64
+	// the *Block, *Transaction or *Event decoded from the document
+	Content  interface{}
+	Checksum string
+}
+
+// IntegrityReport is the outcome of verifying the checksums of the documents
+// stored in a block range.
+type IntegrityReport struct {
+	JobID      string `json:"jobId"`
+	StartBlock uint64 `json:"startBlock"`
+	EndBlock   uint64 `json:"endBlock"`
+	// documents whose checksum was verified, and those stored without one
+	Verified   uint64 `json:"verified"`
+	Unverified uint64 `json:"unverified"`
+	// all documents that don't match their checksum, of which only the first
+	// are listed
+	MismatchCount uint64              `json:"mismatchCount"`
+	Mismatches    []*ChecksumMismatch `json:"mismatches"`
+	Complete      bool                `json:"complete"`
+}
+
+// ChecksumMismatch is a document whose content doesn't match the checksum it
+// was stored with, having been corrupted or changed since.
+type ChecksumMismatch struct {
+	Kind        string `json:"kind"`
+	ID          string `json:"id"`
+	BlockNumber uint64 `json:"blockNumber"`
+	Stored      string `json:"stored"`
+	Computed    string `json:"computed"`
+}
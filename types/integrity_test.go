@@ -0,0 +1,29 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksum(t *testing.T) {
+	// empty hashes and addresses read back as zeros, with the same checksum
+	tx := &Transaction{Hash: NewHash("0x01"), BlockNumber: 1, Events: []*Event{{Index: 1}}}
+	encoded, _ := json.Marshal(tx)
+	var stored Transaction
+	assert.Nil(t, json.Unmarshal(encoded, &stored))
+	assert.NotEqual(t, tx.To, stored.To)
+
+	checksum, err := Checksum(tx)
+	assert.Nil(t, err)
+	assert.Len(t, checksum, 64)
+	storedChecksum, err := Checksum(&stored)
+	assert.Nil(t, err)
+	assert.Equal(t, checksum, storedChecksum)
+
+	stored.Events[0].Index = 2
+	changedChecksum, err := Checksum(&stored)
+	assert.Nil(t, err)
+	assert.NotEqual(t, checksum, changedChecksum)
+}
@@ -0,0 +1,39 @@
+package types
+
+// Job is a long running database operation that happens in the background,
+// such as deleting all the data of a contract.
+type Job struct {
+	ID      string  `json:"id"`
+	Type    string  `json:"type"`
+	Address Address `json:"address,omitempty"`
+	// the block range a backfill processes or an export covers
+	StartBlock uint64 `json:"startBlock,omitempty"`
+	EndBlock   uint64 `json:"endBlock,omitempty"`
+	// the template an assignment by code assigns, and the contracts it has
+	// been assigned to
+	Template string    `json:"template,omitempty"`
+	Matched  []Address `json:"matched,omitempty"`
+	// the files an export has written
+	Files  []string `json:"files,omitempty"`
+	Status string   `json:"status"`
+	JobProgress
+	Error string `json:"error,omitempty"`
+	// unix timestamps
+	StartedAt  uint64 `json:"startedAt"`
+	FinishedAt uint64 `json:"finishedAt,omitempty"`
+}
+
+// JobProgress is how far a job has got, counted over all its steps so far.
+type JobProgress struct {
+	// the step that is running, or that failed
+	Step string `json:"step,omitempty"`
+	// documents deleted so far, out of those found
+	Deleted uint64 `json:"deleted"`
+	Total   uint64 `json:"total"`
+	// documents that changed while being deleted, which are retried
+	VersionConflicts uint64 `json:"versionConflicts"`
+	// blocks processed so far in the step, out of those in the range, the
+	// rows an export has written of the dataset, or the documents an
+	// integrity verification has checked
+	Processed uint64 `json:"processed,omitempty"`
+}
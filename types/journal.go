@@ -0,0 +1,43 @@
+package types
+
+// JournalEntry records how a block was processed by a stage of the pipeline,
+// so operators can look back at what happened long after logs have rotated.
+// A block has an entry for each time a stage processed it, such as when it is
+// synced again after a reorg or backfilled.
+type JournalEntry struct {
+	BlockNumber uint64 `json:"blockNumber"`
+	// "ingest" for fetching and storing the block, "filter" for indexing it
+	// for registered contracts, or "screen" for screening the counterparties
+	// of registered contracts in it
+	Stage string `json:"stage"`
+	// unix timestamp the stage finished at
+	Timestamp uint64 `json:"timestamp"`
+	// how long the stage took, in milliseconds
+	Duration uint64 `json:"duration"`
+	// what the stage wrote for the block
+	Transactions int `json:"transactions"`
+	Events       int `json:"events"`
+	TokenRecords int `json:"tokenRecords"`
+	// failed attempts before the stage succeeded
+	Errors []string `json:"errors,omitempty"`
+}
+
+// JournalQuery filters journal entries, as well as by block range. Empty parts
+// match all entries.
+type JournalQuery struct {
+	Stage string `json:"stage,omitempty"`
+	// only entries with failed attempts
+	ErrorsOnly bool `json:"errorsOnly,omitempty"`
+	// only entries that took at least this many milliseconds
+	MinDuration uint64 `json:"minDuration,omitempty"`
+}
+
+func (q *JournalQuery) Matches(entry *JournalEntry) bool {
+	if q.Stage != "" && entry.Stage != q.Stage {
+		return false
+	}
+	if q.ErrorsOnly && len(entry.Errors) == 0 {
+		return false
+	}
+	return entry.Duration >= q.MinDuration
+}
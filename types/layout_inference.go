@@ -0,0 +1,40 @@
+package types
+
+// how sure storage layout inference is of a variable it proposes
+const (
+	// the slots of the variable were derived from data the contract was seen
+	// to use, such as the keys of a mapping
+	HighConfidence = "high"
+	// every value the contract wrote to the variable has the shape of its type
+	MediumConfidence = "medium"
+	// the values written are consistent with the type, but could be of others
+	LowConfidence = "low"
+)
+
+// InferredVariable is a storage variable proposed by storage layout inference
+type InferredVariable struct {
+	Label string `json:"label"`
+	Slot  uint64 `json:"slot"`
+	// the Solidity type, e.g. mapping(address => uint256)
+	Type       string `json:"type"`
+	Confidence string `json:"confidence"`
+	// what the variable was inferred from
+	Evidence string `json:"evidence"`
+}
+
+// LayoutProposal is a storage layout inferred for a contract without one,
+// from the storage it has been seen to write and the transactions and events
+// it has been seen in, for a user to review and accept.
+type LayoutProposal struct {
+	JobID   string  `json:"jobId"`
+	Address Address `json:"address"`
+	// the storage states analysed, and the slots they wrote that none of the
+	// variables account for
+	States           uint64              `json:"states"`
+	UnexplainedSlots uint64              `json:"unexplainedSlots"`
+	Variables        []*InferredVariable `json:"variables"`
+	// the proposed layout, in the storage layout format of solc
+	Layout   string `json:"layout"`
+	Complete bool   `json:"complete"`
+	Accepted bool   `json:"accepted"`
+}
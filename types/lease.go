@@ -0,0 +1,55 @@
+package types
+
+import "time"
+
+// LeaderLease is the lease held by the one instance that writes to a
+// database shared by several
+const LeaderLease = "leader"
+
+// prefixes of the leases held when filtering is sharded: each instance holds
+// a member lease while running, and a shard lease for each shard it filters
+const (
+	ShardMemberLeasePrefix = "shard-member-"
+	ShardLeasePrefix       = "shard-"
+)
+
+// Lease is held by one instance at a time, until it expires unless renewed.
+type Lease struct {
+	Name   string `json:"name"`
+	Holder string `json:"holder"`
+	// unix milliseconds; renewing the lease keeps when it was acquired
+	AcquiredAt uint64 `json:"acquiredAt"`
+	ExpiresAt  uint64 `json:"expiresAt"`
+}
+
+// Expired checks whether the lease has run out by the given time
+func (l *Lease) Expired(now time.Time) bool {
+	return UnixMillis(now) >= l.ExpiresAt
+}
+
+// UnixMillis returns the time in milliseconds since the unix epoch
+func UnixMillis(t time.Time) uint64 {
+	return uint64(t.UnixNano() / int64(time.Millisecond))
+}
+
+// HighAvailabilityStatus reports which of the instances sharing a database
+// is the leader.
+type HighAvailabilityStatus struct {
+	InstanceID string `json:"instanceId"`
+	Leader     bool   `json:"leader"`
+	// the leader lease as last seen, nil if no instance has held it
+	Lease *Lease `json:"lease"`
+	// the contracts the instance filters, if filtering is sharded
+	Sharding *ShardingStatus `json:"sharding,omitempty"`
+}
+
+// ShardingStatus reports which shards of the registered contracts an instance
+// filters
+type ShardingStatus struct {
+	Mode string `json:"mode"`
+	// the shards the contracts are split into, and those the instance owns
+	Shards int   `json:"shards"`
+	Owned  []int `json:"owned"`
+	// the instances sharing the shards, as last seen
+	Instances int `json:"instances"`
+}
@@ -0,0 +1,74 @@
+package types
+
+import "errors"
+
+// LegalHold exempts data from deletion, whatever would otherwise delete it.
+// A hold covers exactly one of a contract, a transaction or an inclusive
+// range of blocks.
+type LegalHold struct {
+	ID string `json:"id"`
+	// all the data of the contract
+	Address *Address `json:"address,omitempty"`
+	// the events of the transaction
+	TransactionHash *Hash `json:"transactionHash,omitempty"`
+	// the events, storage and token balances recorded in the blocks
+	FromBlock *uint64 `json:"fromBlock,omitempty"`
+	ToBlock   *uint64 `json:"toBlock,omitempty"`
+	Reason    string  `json:"reason"`
+	// unix seconds
+	CreatedAt uint64 `json:"createdAt"`
+}
+
+func (h *LegalHold) Validate() error {
+	kinds := 0
+	if h.Address != nil {
+		kinds++
+	}
+	if h.TransactionHash != nil {
+		kinds++
+	}
+	if h.FromBlock != nil || h.ToBlock != nil {
+		kinds++
+		if h.FromBlock == nil || h.ToBlock == nil {
+			return errors.New("legal hold block range needs both fromBlock and toBlock")
+		}
+		if *h.FromBlock > *h.ToBlock {
+			return errors.New("legal hold fromBlock must not be after toBlock")
+		}
+	}
+	if kinds != 1 {
+		return errors.New("legal hold must cover exactly one of an address, a transaction hash or a block range")
+	}
+	if h.Reason == "" {
+		return errors.New("legal hold reason not provided")
+	}
+	return nil
+}
+
+// LegalHolds are the holds in place, which data being deleted is checked
+// against.
+type LegalHolds []*LegalHold
+
+// HoldsContract checks whether all the data of the contract is held.
+func (holds LegalHolds) HoldsContract(address Address) bool {
+	for _, hold := range holds {
+		if hold.Address != nil && *hold.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Holds checks whether data recorded in the block, by the transaction if
+// there is one, is held.
+func (holds LegalHolds) Holds(blockNumber uint64, txHash Hash) bool {
+	for _, hold := range holds {
+		if hold.TransactionHash != nil && !txHash.IsEmpty() && *hold.TransactionHash == txHash {
+			return true
+		}
+		if hold.FromBlock != nil && blockNumber >= *hold.FromBlock && blockNumber <= *hold.ToBlock {
+			return true
+		}
+	}
+	return false
+}
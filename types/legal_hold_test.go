@@ -0,0 +1,44 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLegalHold_Validate(t *testing.T) {
+	contract := NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	tx := NewHash("0x86835cbb6c0502b5e67a30b20c4ad79a169d13782f74557775557f52307f0bdb")
+	from, to := uint64(5), uint64(10)
+
+	assert.Nil(t, (&LegalHold{Address: &contract, Reason: "litigation"}).Validate())
+	assert.Nil(t, (&LegalHold{TransactionHash: &tx, Reason: "litigation"}).Validate())
+	assert.Nil(t, (&LegalHold{FromBlock: &from, ToBlock: &to, Reason: "litigation"}).Validate())
+
+	kindErr := "legal hold must cover exactly one of an address, a transaction hash or a block range"
+	assert.EqualError(t, (&LegalHold{Reason: "litigation"}).Validate(), kindErr)
+	assert.EqualError(t, (&LegalHold{Address: &contract, TransactionHash: &tx, Reason: "litigation"}).Validate(), kindErr)
+	assert.EqualError(t, (&LegalHold{FromBlock: &from, Reason: "litigation"}).Validate(), "legal hold block range needs both fromBlock and toBlock")
+	assert.EqualError(t, (&LegalHold{FromBlock: &to, ToBlock: &from, Reason: "litigation"}).Validate(), "legal hold fromBlock must not be after toBlock")
+	assert.EqualError(t, (&LegalHold{Address: &contract}).Validate(), "legal hold reason not provided")
+}
+
+func TestLegalHolds(t *testing.T) {
+	contract := NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	tx := NewHash("0x86835cbb6c0502b5e67a30b20c4ad79a169d13782f74557775557f52307f0bdb")
+	from, to := uint64(5), uint64(10)
+	holds := LegalHolds{
+		{Address: &contract},
+		{TransactionHash: &tx},
+		{FromBlock: &from, ToBlock: &to},
+	}
+
+	assert.True(t, holds.HoldsContract(contract))
+	assert.False(t, holds.HoldsContract(NewAddress("1")))
+
+	assert.True(t, holds.Holds(20, tx))
+	assert.True(t, holds.Holds(5, ""))
+	assert.True(t, holds.Holds(10, ""))
+	assert.False(t, holds.Holds(11, ""))
+	assert.False(t, holds.Holds(4, NewHash("0x01")))
+}
@@ -0,0 +1,12 @@
+package types
+
+// BlockRangeDeletion is what was deleted from an inclusive range of blocks, or
+// on a dry run what would be deleted.
+type BlockRangeDeletion struct {
+	FromBlock uint64 `json:"fromBlock"`
+	ToBlock   uint64 `json:"toBlock"`
+	DryRun    bool   `json:"dryRun"`
+	// documents, keyed by index
+	Documents map[string]uint64 `json:"documents"`
+	Total     uint64            `json:"total"`
+}
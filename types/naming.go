@@ -0,0 +1,38 @@
+package types
+
+import "sync"
+
+// RegisteredName is a name set in the naming registry, and the address it
+// resolves to
+type RegisteredName struct {
+	Name    string  `json:"name"`
+	Address Address `json:"address"`
+}
+
+var (
+	nameResolver    func(name string) (Address, bool)
+	nameResolverMux sync.RWMutex
+)
+
+// SetNameResolver lets addresses decoded from JSON be given as a name the
+// resolver knows, as well as in hex. A nil resolver stops names being
+// accepted.
+func SetNameResolver(resolve func(name string) (Address, bool)) {
+	nameResolverMux.Lock()
+	defer nameResolverMux.Unlock()
+	nameResolver = resolve
+}
+
+// resolveName looks up a name with the resolver, if one is set. Strings with
+// the 0x prefix are always hex, so are never looked up.
+func resolveName(name string) (Address, bool) {
+	if len(name) >= 2 && name[:2] == "0x" {
+		return "", false
+	}
+	nameResolverMux.RLock()
+	defer nameResolverMux.RUnlock()
+	if nameResolver == nil {
+		return "", false
+	}
+	return nameResolver(name)
+}
@@ -0,0 +1,39 @@
+package types
+
+// NetworkActivity is how the whole network was used over a period of time,
+// for reports such as monthly consortium reports
+type NetworkActivity struct {
+	// the inclusive range of block timestamps, in seconds
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+
+	Transactions        uint64 `json:"transactions"`
+	PrivateTransactions uint64 `json:"privateTransactions"`
+	PublicTransactions  uint64 `json:"publicTransactions"`
+	// the share of the transactions that were private, 0 without transactions
+	PrivateRatio float64 `json:"privateRatio"`
+	// contracts whose functions were called, or that were created
+	ActiveContracts uint64 `json:"activeContracts"`
+	// externally owned accounts that sent transactions
+	ActiveAccounts uint64 `json:"activeAccounts"`
+	GasUsed        uint64 `json:"gasUsed"`
+}
+
+// SetRatios fills in the public transactions and private ratio from the
+// transaction counts
+func (a *NetworkActivity) SetRatios() {
+	a.PublicTransactions = a.Transactions - a.PrivateTransactions
+	a.PrivateRatio = 0
+	if a.Transactions > 0 {
+		a.PrivateRatio = float64(a.PrivateTransactions) / float64(a.Transactions)
+	}
+}
+
+// ActiveContract is the contract the transaction shows to be in use: the one
+// called a function of, or created, or empty for plain transfers
+func (tx *Transaction) ActiveContract() Address {
+	if !tx.CreatedContract.IsEmpty() || tx.Selector() != "" {
+		return tx.Contract()
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var ErrParameterNotFound = errors.New("parameter not found")
+
+// ParsedData holds the decoded parameters of a transaction or event, keyed by
+// parameter name. Integers are *big.Int, addresses and fixed size bytes are
+// 0x prefixed hex strings, and arrays and tuples are nested slices and maps.
+//
+// The accessors also accept values that have been through a JSON round trip,
+// where integers become JSON numbers.
+type ParsedData map[string]interface{}
+
+// MarshalJSON always outputs an object, even if nothing was parsed.
+func (pd ParsedData) MarshalJSON() ([]byte, error) {
+	if pd == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]interface{}(pd))
+}
+
+func (pd ParsedData) get(name string) (interface{}, error) {
+	value, ok := pd[name]
+	if !ok {
+		return nil, ErrParameterNotFound
+	}
+	return value, nil
+}
+
+func wrongType(name string, value interface{}, expected string) error {
+	return fmt.Errorf("parameter %s is %T, not %s", name, value, expected)
+}
+
+func (pd ParsedData) GetString(name string) (string, error) {
+	value, err := pd.get(name)
+	if err != nil {
+		return "", err
+	}
+	str, ok := value.(string)
+	if !ok {
+		return "", wrongType(name, value, "a string")
+	}
+	return str, nil
+}
+
+func (pd ParsedData) GetBool(name string) (bool, error) {
+	value, err := pd.get(name)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, wrongType(name, value, "a bool")
+	}
+	return b, nil
+}
+
+func (pd ParsedData) GetBigInt(name string) (*big.Int, error) {
+	value, err := pd.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case *big.Int:
+		return new(big.Int).Set(v), nil
+	case big.Int:
+		return new(big.Int).Set(&v), nil
+	case json.Number:
+		if i, ok := new(big.Int).SetString(v.String(), 10); ok {
+			return i, nil
+		}
+	case float64:
+		// large numbers lose precision when decoded as a float64
+		if f := big.NewFloat(v); f.IsInt() {
+			i, _ := f.Int(nil)
+			return i, nil
+		}
+	case string:
+		if i, ok := new(big.Int).SetString(v, 0); ok {
+			return i, nil
+		}
+	}
+	return nil, wrongType(name, value, "an integer")
+}
+
+func (pd ParsedData) GetAddress(name string) (Address, error) {
+	str, err := pd.GetString(name)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(str, "0x") || len(str) != 42 {
+		return "", fmt.Errorf("parameter %s is not an address", name)
+	}
+	return NewAddress(str), nil
+}
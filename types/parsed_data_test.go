@@ -0,0 +1,65 @@
+package types
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sampleParsedData = ParsedData{
+	"from":   "0x1932c48b2bf8102ba33b4a6b545c32236e342f34",
+	"value":  big.NewInt(1000),
+	"name":   "token",
+	"active": true,
+}
+
+func TestParsedData_Accessors(t *testing.T) {
+	from, err := sampleParsedData.GetAddress("from")
+	assert.Nil(t, err)
+	assert.Equal(t, NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34"), from)
+
+	value, err := sampleParsedData.GetBigInt("value")
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(1000), value)
+
+	name, err := sampleParsedData.GetString("name")
+	assert.Nil(t, err)
+	assert.Equal(t, "token", name)
+
+	active, err := sampleParsedData.GetBool("active")
+	assert.Nil(t, err)
+	assert.True(t, active)
+
+	_, err = sampleParsedData.GetBigInt("missing")
+	assert.Equal(t, ErrParameterNotFound, err)
+
+	_, err = sampleParsedData.GetString("value")
+	assert.EqualError(t, err, "parameter value is *big.Int, not a string")
+
+	_, err = sampleParsedData.GetAddress("name")
+	assert.EqualError(t, err, "parameter name is not an address")
+}
+
+func TestParsedData_JSONRoundTrip(t *testing.T) {
+	encoded, err := json.Marshal(&ParsedEvent{ParsedData: sampleParsedData})
+	assert.Nil(t, err)
+
+	var decoded ParsedEvent
+	assert.Nil(t, json.Unmarshal(encoded, &decoded))
+
+	value, err := decoded.GetBigInt("value")
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(1000), value)
+
+	from, err := decoded.GetAddress("from")
+	assert.Nil(t, err)
+	assert.Equal(t, NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34"), from)
+}
+
+func TestParsedData_MarshalJSONEmpty(t *testing.T) {
+	encoded, err := json.Marshal(&ParsedEvent{})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"eventSig":"","parsedData":{},"rawEvent":null,"timestamp":0,"timestampISO":""}`, string(encoded))
+}
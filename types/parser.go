@@ -3,17 +3,36 @@ package types
 import (
 	"encoding/hex"
 	"errors"
+	"math/big"
 	"strings"
+	"time"
 
 	"quorumengineering/quorum-report/log"
 )
 
 type ParsedTransaction struct {
-	Sig            string                 `json:"txSig"`
-	Func4Bytes     HexData                `json:"func4Bytes"`
-	ParsedData     map[string]interface{} `json:"parsedData"`
-	ParsedEvents   []*ParsedEvent         `json:"parsedEvents"`
-	RawTransaction *Transaction           `json:"rawTransaction"`
+	Sig            string         `json:"txSig"`
+	Func4Bytes     HexData        `json:"func4Bytes"`
+	ParsedData     ParsedData     `json:"parsedData"`
+	ParsedEvents   []*ParsedEvent `json:"parsedEvents"`
+	RawTransaction *Transaction   `json:"rawTransaction"`
+	// block time, as a unix timestamp and in ISO 8601 format
+	Timestamp    uint64 `json:"timestamp"`
+	TimestampISO string `json:"timestampISO"`
+}
+
+// FormatTimestamp formats a unix timestamp as ISO 8601, in UTC. A zero
+// timestamp is unknown, and is formatted as an empty string.
+func FormatTimestamp(timestamp uint64) string {
+	if timestamp == 0 {
+		return ""
+	}
+	return time.Unix(int64(timestamp), 0).UTC().Format(time.RFC3339)
+}
+
+func (ptx *ParsedTransaction) SetTimestamp(timestamp uint64) {
+	ptx.Timestamp = timestamp
+	ptx.TimestampISO = FormatTimestamp(timestamp)
 }
 
 func (ptx *ParsedTransaction) ParseTransaction(rawABI string) error {
@@ -37,7 +56,12 @@ func (ptx *ParsedTransaction) ParseTransaction(rawABI string) error {
 	} else {
 		data = ptx.RawTransaction.Data.AsBytes()
 	}
-	ptx.ParsedData = map[string]interface{}{}
+	ptx.ParsedData = ParsedData{}
+	// truncated input cannot be reliably decoded
+	if ptx.RawTransaction.DataTruncated {
+		ptx.ParsedData["error"] = "input data truncated, unable to parse params"
+		return nil
+	}
 	// parse transaction data
 	if !ptx.RawTransaction.To.IsEmpty() {
 		ptx.Func4Bytes = HexData(hex.EncodeToString(data[:4]))
@@ -81,10 +105,34 @@ func (ptx *ParsedTransaction) ParseTransaction(rawABI string) error {
 	return nil
 }
 
+func (ptx *ParsedTransaction) GetString(name string) (string, error) {
+	return ptx.ParsedData.GetString(name)
+}
+
+func (ptx *ParsedTransaction) GetBool(name string) (bool, error) {
+	return ptx.ParsedData.GetBool(name)
+}
+
+func (ptx *ParsedTransaction) GetBigInt(name string) (*big.Int, error) {
+	return ptx.ParsedData.GetBigInt(name)
+}
+
+func (ptx *ParsedTransaction) GetAddress(name string) (Address, error) {
+	return ptx.ParsedData.GetAddress(name)
+}
+
 type ParsedEvent struct {
-	Sig        string                 `json:"eventSig"`
-	ParsedData map[string]interface{} `json:"parsedData"`
-	RawEvent   *Event                 `json:"rawEvent"`
+	Sig        string     `json:"eventSig"`
+	ParsedData ParsedData `json:"parsedData"`
+	RawEvent   *Event     `json:"rawEvent"`
+	// block time, as a unix timestamp and in ISO 8601 format
+	Timestamp    uint64 `json:"timestamp"`
+	TimestampISO string `json:"timestampISO"`
+}
+
+func (pe *ParsedEvent) SetTimestamp(timestamp uint64) {
+	pe.Timestamp = timestamp
+	pe.TimestampISO = FormatTimestamp(timestamp)
 }
 
 func (pe *ParsedEvent) ParseEvent(rawABI string) error {
@@ -100,6 +148,7 @@ func (pe *ParsedEvent) ParseEvent(rawABI string) error {
 	internalAbi := structure.ToInternalABI()
 
 	log.Debug("Parse event", "event", pe.RawEvent.Topics[0].Hex())
+	pe.ParsedData = ParsedData{}
 	for _, ev := range internalAbi.Events {
 		if "0x"+ev.Signature() == pe.RawEvent.Topics[0].String() {
 			pe.Sig = "event " + ev.String()
@@ -112,3 +161,19 @@ func (pe *ParsedEvent) ParseEvent(rawABI string) error {
 	}
 	return nil
 }
+
+func (pe *ParsedEvent) GetString(name string) (string, error) {
+	return pe.ParsedData.GetString(name)
+}
+
+func (pe *ParsedEvent) GetBool(name string) (bool, error) {
+	return pe.ParsedData.GetBool(name)
+}
+
+func (pe *ParsedEvent) GetBigInt(name string) (*big.Int, error) {
+	return pe.ParsedData.GetBigInt(name)
+}
+
+func (pe *ParsedEvent) GetAddress(name string) (Address, error) {
+	return pe.ParsedData.GetAddress(name)
+}
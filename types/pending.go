@@ -0,0 +1,25 @@
+package types
+
+// PendingTransaction is a transaction to a registered contract waiting in the
+// node's transaction pool, with its call decoded by the contract's ABI
+type PendingTransaction struct {
+	Hash     Hash    `json:"hash"`
+	From     Address `json:"from"`
+	To       Address `json:"to"`
+	Nonce    uint64  `json:"nonce"`
+	Gas      uint64  `json:"gas"`
+	GasPrice uint64  `json:"gasPrice"`
+	// in wei, as a decimal string as it may not fit in 64 bits
+	Value     string  `json:"value"`
+	Data      HexData `json:"data"`
+	IsPrivate bool    `json:"isPrivate"`
+	// empty if the contract has no ABI, or the payload of a private
+	// transaction couldn't be fetched
+	Sig        string     `json:"txSig"`
+	Func4Bytes HexData    `json:"func4Bytes"`
+	ParsedData ParsedData `json:"parsedData"`
+	// when the transaction was first seen in the pool, as a unix timestamp
+	// and in ISO 8601 format
+	SeenAt    uint64 `json:"seenAt"`
+	SeenAtISO string `json:"seenAtISO"`
+}
@@ -1,6 +1,9 @@
 package types
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"math/big"
 )
 
@@ -29,6 +32,63 @@ type QueryOptions struct {
 
 	PageSize   int `json:"pageSize"`
 	PageNumber int `json:"pageNumber"`
+
+	// SnapshotId pins the query to the blocks indexed when the snapshot was opened
+	SnapshotId string `json:"snapshotId,omitempty"`
+	// Cursor is the nextCursor of the previous page, and replaces the page
+	// number, so results past the first 1000 can be read
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// Cursor is the position of the last result of a page, in the newest block
+// first, then log or transaction index order that results are listed in.
+type Cursor struct {
+	BlockNumber uint64
+	Index       uint64
+}
+
+// NewCursor returns the opaque cursor of the page ending at the result at
+// the block number and index
+func NewCursor(blockNumber uint64, index uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", blockNumber, index)))
+}
+
+// Follows checks whether the result at the block number and index comes after
+// the cursor.
+func (c *Cursor) Follows(blockNumber uint64, index uint64) bool {
+	return blockNumber < c.BlockNumber || (blockNumber == c.BlockNumber && index > c.Index)
+}
+
+// After returns the position the page starts after, or nil if no cursor is
+// given. A cursor can't be given with a page number.
+func (opts *QueryOptions) After() (*Cursor, error) {
+	if opts == nil || opts.Cursor == "" {
+		return nil, nil
+	}
+	if opts.PageNumber != 0 {
+		return nil, errors.New("give either a cursor or a page number, not both")
+	}
+	return ParseCursor(opts.Cursor)
+}
+
+// ParseCursor decodes a cursor returned by NewCursor
+func ParseCursor(encoded string) (*Cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor Cursor
+	_, err = fmt.Sscanf(string(decoded), "%d:%d", &cursor.BlockNumber, &cursor.Index)
+	if err != nil || NewCursor(cursor.BlockNumber, cursor.Index) != encoded {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// Precedes checks whether the result at the block number and index comes after
+// the cursor in oldest first order.
+func (c *Cursor) Precedes(blockNumber uint64, index uint64) bool {
+	return blockNumber > c.BlockNumber || (blockNumber == c.BlockNumber && index > c.Index)
 }
 
 func (opts *QueryOptions) SetDefaults() {
@@ -57,6 +117,9 @@ type PageOptions struct {
 	EndBlockNumber   *big.Int `json:"endBlockNumber"`
 	PageSize         int      `json:"pageSize"`
 	PageNumber       int      `json:"pageNumber"`
+
+	// SnapshotId pins the query to the blocks indexed when the snapshot was opened
+	SnapshotId string `json:"snapshotId,omitempty"`
 }
 
 func (opts *PageOptions) SetDefaults() {
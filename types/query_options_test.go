@@ -0,0 +1,40 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryOptions_After(t *testing.T) {
+	options := &QueryOptions{}
+	cursor, err := options.After()
+	assert.Nil(t, err)
+	assert.Nil(t, cursor)
+
+	options.Cursor = NewCursor(100, 2)
+	cursor, err = options.After()
+	assert.Nil(t, err)
+	assert.Equal(t, &Cursor{BlockNumber: 100, Index: 2}, cursor)
+
+	// newest block first, then in index order
+	assert.True(t, cursor.Follows(100, 3))
+	assert.True(t, cursor.Follows(99, 0))
+	assert.False(t, cursor.Follows(100, 2))
+	assert.False(t, cursor.Follows(101, 5))
+
+	options.PageNumber = 1
+	_, err = options.After()
+	assert.EqualError(t, err, "give either a cursor or a page number, not both")
+
+	// oldest block first, then in index order
+	assert.True(t, cursor.Precedes(100, 3))
+	assert.True(t, cursor.Precedes(101, 0))
+	assert.False(t, cursor.Precedes(100, 2))
+	assert.False(t, cursor.Precedes(99, 5))
+
+	for _, invalid := range []string{"not a cursor", NewCursor(1, 2) + "A", "MTo"} {
+		_, err = (&QueryOptions{Cursor: invalid}).After()
+		assert.EqualError(t, err, "invalid cursor", invalid)
+	}
+}
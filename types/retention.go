@@ -0,0 +1,28 @@
+package types
+
+// RetentionDeletion is what applying a retention policy to an index deleted
+type RetentionDeletion struct {
+	Index string
+	// documents no longer needed at or after this block were deleted
+	BeforeBlock uint64
+	Deleted     uint64
+}
+
+// RetentionStats are the totals of what each retention policy has deleted
+// since starting, by index
+type RetentionStats struct {
+	Runs     uint64                     `json:"runs"`
+	Failures uint64                     `json:"failures"`
+	Indices  map[string]*IndexRetention `json:"indices"`
+}
+
+type IndexRetention struct {
+	MaxAgeDays int `json:"maxAgeDays"`
+	// the block documents were last deleted before
+	BeforeBlock uint64 `json:"beforeBlock"`
+	Deleted     uint64 `json:"deleted"`
+	// estimated from the average size of the index's documents, as the space
+	// is only freed once the index's segments are merged
+	ReclaimedBytes uint64 `json:"reclaimedBytes"`
+	LastApplied    uint64 `json:"lastApplied"` // unix time
+}
@@ -0,0 +1,20 @@
+package types
+
+// ScreeningMatch is an address found on a deny list, such as of sanctioned
+// addresses, by address screening
+type ScreeningMatch struct {
+	Address Address `json:"address"`
+	// the list file, or the screening service, that flagged the address
+	List string `json:"list"`
+	// why the address is listed, if the list gives a reason
+	Reason string `json:"reason,omitempty"`
+}
+
+// ScreeningAlert is sent when a counterparty of a registered contract is
+// flagged by address screening, for each transaction it interacts in
+type ScreeningAlert struct {
+	Match       *ScreeningMatch `json:"match"`
+	Contract    Address         `json:"contract"`
+	Transaction Hash            `json:"transaction"`
+	BlockNumber uint64          `json:"blockNumber"`
+}
@@ -0,0 +1,82 @@
+package types
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	BlockSearchResult       = "block"
+	TransactionSearchResult = "transaction"
+	ContractSearchResult    = "contract"
+	EventSearchResult       = "event"
+)
+
+var (
+	searchHashPattern    = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+	searchAddressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+)
+
+// SearchQuery is what a search term was recognised as, exactly one of a
+// block number, a block or transaction hash, or an address.
+type SearchQuery struct {
+	BlockNumber *uint64
+	Hash        *Hash
+	Address     *Address
+}
+
+// NewSearchQuery recognises a search term as a block number in decimal, a
+// 32 byte hash or a 20 byte address, in hex with the 0x prefix.
+func NewSearchQuery(term string) (*SearchQuery, error) {
+	term = strings.TrimSpace(term)
+	switch {
+	case searchHashPattern.MatchString(term):
+		hash := NewHash(strings.ToLower(term))
+		return &SearchQuery{Hash: &hash}, nil
+	case searchAddressPattern.MatchString(term):
+		address := NewAddress(strings.ToLower(term))
+		return &SearchQuery{Address: &address}, nil
+	}
+	if number, err := strconv.ParseUint(term, 10, 64); err == nil {
+		return &SearchQuery{BlockNumber: &number}, nil
+	}
+	return nil, errors.New("search term must be a block number, a hash or an address")
+}
+
+// SearchResult is a block, transaction, registered contract or indexed event
+// found by a search, identified by the fields that apply to its type.
+type SearchResult struct {
+	// one of block, transaction, contract or event
+	Type        string  `json:"type"`
+	BlockNumber *uint64 `json:"blockNumber,omitempty"`
+	// of the block or transaction
+	Hash *Hash `json:"hash,omitempty"`
+	// of the contract, or the contract that emitted the event
+	Address *Address `json:"address,omitempty"`
+	// that emitted the event, or created the contract
+	TransactionHash *Hash `json:"transactionHash,omitempty"`
+	// of the event in its block
+	Index *uint64 `json:"index,omitempty"`
+}
+
+func NewBlockSearchResult(number uint64, hash Hash) *SearchResult {
+	return &SearchResult{Type: BlockSearchResult, BlockNumber: &number, Hash: &hash}
+}
+
+func NewTransactionSearchResult(blockNumber uint64, hash Hash) *SearchResult {
+	return &SearchResult{Type: TransactionSearchResult, BlockNumber: &blockNumber, Hash: &hash}
+}
+
+func NewContractSearchResult(address Address, creationTx Hash) *SearchResult {
+	result := &SearchResult{Type: ContractSearchResult, Address: &address}
+	if !creationTx.IsEmpty() {
+		result.TransactionHash = &creationTx
+	}
+	return result
+}
+
+func NewEventSearchResult(event Event) *SearchResult {
+	return &SearchResult{Type: EventSearchResult, BlockNumber: &event.BlockNumber, Address: &event.Address, TransactionHash: &event.TransactionHash, Index: &event.Index}
+}
@@ -0,0 +1,40 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSearchQuery(t *testing.T) {
+	query, err := NewSearchQuery(" 42 ")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 42, *query.BlockNumber)
+	assert.Nil(t, query.Hash)
+	assert.Nil(t, query.Address)
+
+	query, err = NewSearchQuery("0x1A6F4292BAC138DF9A7854A07C93FD14CA7DE53265E8FE01B6C986F97D6C1EE7")
+	assert.Nil(t, err)
+	assert.Equal(t, NewHash("0x1a6f4292bac138df9a7854a07c93fd14ca7de53265e8fe01b6c986f97d6c1ee7"), *query.Hash)
+
+	query, err = NewSearchQuery("0x1932c48b2bf8102ba33b4a6b545c32236e342f34")
+	assert.Nil(t, err)
+	assert.Equal(t, NewAddress("0x1932c48b2bf8102ba33b4a6b545c32236e342f34"), *query.Address)
+
+	for _, term := range []string{"", "-1", "0x1932", "1932c48b2bf8102ba33b4a6b545c32236e342f34", "treasury"} {
+		_, err = NewSearchQuery(term)
+		assert.EqualError(t, err, "search term must be a block number, a hash or an address", term)
+	}
+}
+
+func TestSearchResult_MarshalJSON(t *testing.T) {
+	contract, err := json.Marshal(NewContractSearchResult(NewAddress("0x01"), ""))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"type":"contract","address":"0x0000000000000000000000000000000000000001"}`, string(contract))
+
+	// the genesis block and first event are numbered 0
+	block, err := json.Marshal(NewBlockSearchResult(0, NewHash("0x01")))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"type":"block","blockNumber":0,"hash":"0x0000000000000000000000000000000000000000000000000000000000000001"}`, string(block))
+}
@@ -0,0 +1,284 @@
+package types
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// severities events can be classified with, from the least severe
+const (
+	InfoSeverity     = "info"
+	WarningSeverity  = "warning"
+	CriticalSeverity = "critical"
+)
+
+// SeverityField is the field of indexed event documents holding the severity
+// they were classified with
+const SeverityField = "severity"
+
+var severityLevels = map[string]int{InfoSeverity: 1, WarningSeverity: 2, CriticalSeverity: 3}
+
+// operators comparing an event parameter to the value of a severity rule;
+// parameters that aren't integers can only be compared for equality
+const (
+	EqualOperator          = "eq"
+	NotEqualOperator       = "ne"
+	GreaterOperator        = "gt"
+	GreaterOrEqualOperator = "gte"
+	LessOperator           = "lt"
+	LessOrEqualOperator    = "lte"
+)
+
+var orderOperators = map[string]bool{GreaterOperator: true, GreaterOrEqualOperator: true, LessOperator: true, LessOrEqualOperator: true}
+
+// Severities lists the severities from the least severe
+func Severities() []string {
+	return []string{InfoSeverity, WarningSeverity, CriticalSeverity}
+}
+
+// SeverityRule classifies the events of a contract with a severity. It
+// matches the events with the name or signature of the rule, and if a
+// parameter is given, only those where it compares to the value with the
+// operator, which defaults to eq.
+type SeverityRule struct {
+	// the event name, e.g. Transfer, or canonical signature, e.g.
+	// Transfer(address,address,uint256)
+	Event     string `json:"event"`
+	Parameter string `json:"parameter,omitempty"`
+	Operator  string `json:"operator,omitempty"`
+	// integers are given in decimal or 0x prefixed hex, and booleans as
+	// true or false
+	Value    string `json:"value,omitempty"`
+	Severity string `json:"severity"`
+}
+
+func (r *SeverityRule) Validate() error {
+	if r.Event == "" {
+		return errors.New("severity rule event not provided")
+	}
+	if severityLevels[r.Severity] == 0 {
+		return errors.New("severity rule severity must be one of info, warning or critical")
+	}
+	if r.Parameter == "" {
+		if r.Operator != "" || r.Value != "" {
+			return errors.New("severity rule operator and value need a parameter")
+		}
+		return nil
+	}
+	switch r.Operator {
+	case "", EqualOperator, NotEqualOperator:
+	case GreaterOperator, GreaterOrEqualOperator, LessOperator, LessOrEqualOperator:
+		if _, ok := new(big.Int).SetString(r.Value, 0); !ok {
+			return fmt.Errorf("severity rule operator %s needs an integer value", r.Operator)
+		}
+	default:
+		return errors.New("severity rule operator must be one of eq, ne, gt, gte, lt or lte")
+	}
+	return nil
+}
+
+// SeverityRules are the severity rules of a contract. An event matching
+// several is classified with the highest severity of those it matches.
+type SeverityRules []*SeverityRule
+
+func (rules SeverityRules) Validate() error {
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// severityCheck is a rule with its event looked up in the contract's ABI
+type severityCheck struct {
+	rule  *SeverityRule
+	event ContractABIEvent
+}
+
+// SeverityClassifier classifies the events of a contract with its rules
+type SeverityClassifier struct {
+	// the checks of each event, by topic0
+	checks map[Hash][]*severityCheck
+}
+
+// NewSeverityClassifier looks up the events and parameters of the rules in
+// the contract's ABI, failing if any are missing from it.
+func NewSeverityClassifier(rules SeverityRules, abi *ContractABI) (*SeverityClassifier, error) {
+	classifier := &SeverityClassifier{checks: make(map[Hash][]*severityCheck)}
+	for _, rule := range rules {
+		found := false
+		for _, event := range abi.Events {
+			if event.Name != rule.Event && event.StringNoName() != rule.Event {
+				continue
+			}
+			if rule.Parameter != "" && !event.hasInput(rule.Parameter) {
+				return nil, fmt.Errorf("event %s has no parameter %s", rule.Event, rule.Parameter)
+			}
+			topic := NewHash(event.Signature())
+			classifier.checks[topic] = append(classifier.checks[topic], &severityCheck{rule: rule, event: event})
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("event %s not found in the contract ABI", rule.Event)
+		}
+	}
+	return classifier, nil
+}
+
+func (event ContractABIEvent) hasInput(name string) bool {
+	for _, input := range event.Inputs {
+		if input.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify returns the highest severity of the rules the event matches, or
+// an empty string if it matches none.
+func (c *SeverityClassifier) Classify(event *Event) string {
+	if len(event.Topics) == 0 {
+		return ""
+	}
+	severity := ""
+	var data map[string]interface{}
+	for _, check := range c.checks[event.Topics[0]] {
+		if severityLevels[check.rule.Severity] <= severityLevels[severity] {
+			continue
+		}
+		if check.rule.Parameter != "" {
+			value, err := check.value(event, &data)
+			if err != nil || !check.compare(value) {
+				continue
+			}
+		}
+		severity = check.rule.Severity
+	}
+	return severity
+}
+
+// value decodes the rule's parameter of the event. Indexed parameters are
+// topics, after the event signature, which hold the hash of those of
+// dynamic types. The data is only decoded once for all the checks.
+func (check *severityCheck) value(event *Event, data *map[string]interface{}) (interface{}, error) {
+	topic := 1
+	for _, input := range check.event.Inputs {
+		if !input.Indexed {
+			continue
+		}
+		if input.Name == check.rule.Parameter {
+			if topic >= len(event.Topics) {
+				return nil, errors.New("indexed parameter is missing")
+			}
+			if input.IsDynamic() || strings.HasSuffix(input.Type, "]") || strings.HasPrefix(input.Type, "tuple") {
+				return event.Topics[topic].String(), nil
+			}
+			encoded, err := hex.DecodeString(string(event.Topics[topic]))
+			if err != nil {
+				return nil, err
+			}
+			parsed, err := ParseAllData([]ContractABIArgument{input.ContractABIArgument}, encoded)
+			if err != nil {
+				return nil, err
+			}
+			return parsed[input.Name], nil
+		}
+		topic++
+	}
+	if *data == nil {
+		parsed, err := check.event.Parse(event.Data.AsBytes())
+		if err != nil {
+			return nil, err
+		}
+		*data = parsed
+	}
+	return (*data)[check.rule.Parameter], nil
+}
+
+// compare checks the parameter value against the rule's
+func (check *severityCheck) compare(value interface{}) bool {
+	operator := check.rule.Operator
+	if operator == "" {
+		operator = EqualOperator
+	}
+	var cmp int
+	switch v := value.(type) {
+	case *big.Int:
+		expected, ok := new(big.Int).SetString(check.rule.Value, 0)
+		if !ok {
+			return false
+		}
+		cmp = v.Cmp(expected)
+	case bool:
+		expected, err := strconv.ParseBool(check.rule.Value)
+		if err != nil || orderOperators[operator] {
+			return false
+		}
+		if v != expected {
+			cmp = 1
+		}
+	default:
+		if orderOperators[operator] {
+			return false
+		}
+		actual := fmt.Sprint(v)
+		// addresses and bytes match whatever the case of their hex
+		if strings.HasPrefix(actual, "0x") && strings.EqualFold(actual, check.rule.Value) || actual == check.rule.Value {
+			cmp = 0
+		} else {
+			cmp = 1
+		}
+	}
+	switch operator {
+	case EqualOperator:
+		return cmp == 0
+	case NotEqualOperator:
+		return cmp != 0
+	case GreaterOperator:
+		return cmp > 0
+	case GreaterOrEqualOperator:
+		return cmp >= 0
+	case LessOperator:
+		return cmp < 0
+	case LessOrEqualOperator:
+		return cmp <= 0
+	}
+	return false
+}
+
+// EventSeverityQuery selects the events classified with a severity, from one
+// contract or from all registered contracts.
+type EventSeverityQuery struct {
+	// the contract that emitted the events, or all registered contracts
+	Address *Address `json:"address,omitempty"`
+	// the severity the events were classified with, which counts ignore
+	Severity string `json:"severity,omitempty"`
+	// if not nil, the registered contracts searched when no address is given
+	Contracts []Address `json:"-"`
+}
+
+// Validate checks the severity of the query, which must be given to select
+// events, but not to count them by severity.
+func (q *EventSeverityQuery) Validate() error {
+	if severityLevels[q.Severity] == 0 {
+		return errors.New("severity must be one of info, warning or critical")
+	}
+	return nil
+}
+
+// SeverityCounts is the number of events classified with each severity
+type SeverityCounts map[string]uint64
+
+// NewSeverityCounts returns counts of zero for each severity
+func NewSeverityCounts() SeverityCounts {
+	counts := make(SeverityCounts)
+	for _, severity := range Severities() {
+		counts[severity] = 0
+	}
+	return counts
+}
@@ -0,0 +1,64 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const transferABI = `[
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":false,"name":"paused","type":"bool"}],"name":"Paused","type":"event"}
+]`
+
+func TestSeverityRule_Validate(t *testing.T) {
+	assert.Nil(t, (&SeverityRule{Event: "Transfer", Severity: InfoSeverity}).Validate())
+	assert.Nil(t, (&SeverityRule{Event: "Transfer", Parameter: "value", Operator: GreaterOperator, Value: "0x10", Severity: WarningSeverity}).Validate())
+	assert.Nil(t, (&SeverityRule{Event: "Paused", Parameter: "paused", Value: "true", Severity: CriticalSeverity}).Validate())
+
+	assert.EqualError(t, (&SeverityRule{Severity: InfoSeverity}).Validate(), "severity rule event not provided")
+	assert.EqualError(t, (&SeverityRule{Event: "Transfer", Severity: "high"}).Validate(), "severity rule severity must be one of info, warning or critical")
+	assert.EqualError(t, (&SeverityRule{Event: "Transfer", Value: "1", Severity: InfoSeverity}).Validate(), "severity rule operator and value need a parameter")
+	assert.EqualError(t, (&SeverityRule{Event: "Transfer", Parameter: "value", Operator: "like", Severity: InfoSeverity}).Validate(), "severity rule operator must be one of eq, ne, gt, gte, lt or lte")
+	assert.EqualError(t, (&SeverityRule{Event: "Transfer", Parameter: "value", Operator: LessOperator, Value: "ten", Severity: InfoSeverity}).Validate(), "severity rule operator lt needs an integer value")
+}
+
+func TestSeverityClassifier(t *testing.T) {
+	structure, err := NewABIStructureFromJSON(transferABI)
+	assert.Nil(t, err)
+	abi := structure.ToInternalABI()
+
+	_, err = NewSeverityClassifier(SeverityRules{{Event: "Approval", Severity: InfoSeverity}}, abi)
+	assert.EqualError(t, err, "event Approval not found in the contract ABI")
+	_, err = NewSeverityClassifier(SeverityRules{{Event: "Transfer", Parameter: "amount", Severity: InfoSeverity}}, abi)
+	assert.EqualError(t, err, "event Transfer has no parameter amount")
+
+	classifier, err := NewSeverityClassifier(SeverityRules{
+		{Event: "Transfer(address,address,uint256)", Severity: InfoSeverity},
+		{Event: "Transfer", Parameter: "value", Operator: GreaterOrEqualOperator, Value: "1000", Severity: WarningSeverity},
+		{Event: "Transfer", Parameter: "to", Value: "0x000000000000000000000000000000000000DEAD", Severity: CriticalSeverity},
+		{Event: "Paused", Parameter: "paused", Value: "true", Severity: CriticalSeverity},
+	}, abi)
+	assert.Nil(t, err)
+
+	transfer := func(to string, value string) *Event {
+		return &Event{
+			Topics: []Hash{
+				NewHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"),
+				NewHash("0x0000000000000000000000000000000000000000000000000000000000000001"),
+				NewHash(to),
+			},
+			Data: NewHexData(value),
+		}
+	}
+	// the highest severity of the rules matched
+	assert.Equal(t, InfoSeverity, classifier.Classify(transfer("0x02", "0x00000000000000000000000000000000000000000000000000000000000003e7")))
+	assert.Equal(t, WarningSeverity, classifier.Classify(transfer("0x02", "0x00000000000000000000000000000000000000000000000000000000000003e8")))
+	assert.Equal(t, CriticalSeverity, classifier.Classify(transfer("0xdead", "0x00000000000000000000000000000000000000000000000000000000000003e8")))
+
+	paused := NewHash("0x0e2fb031ee032dc02d8011dc50b816eb450cf856abd8261680dac74f72165bd2")
+	assert.Equal(t, CriticalSeverity, classifier.Classify(&Event{Topics: []Hash{paused}, Data: NewHexData("0x0000000000000000000000000000000000000000000000000000000000000001")}))
+	assert.Equal(t, "", classifier.Classify(&Event{Topics: []Hash{paused}, Data: NewHexData("0x0000000000000000000000000000000000000000000000000000000000000000")}))
+	// events of other signatures
+	assert.Equal(t, "", classifier.Classify(&Event{Topics: []Hash{NewHash("0x01")}}))
+}
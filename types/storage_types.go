@@ -127,3 +127,18 @@ type StorageResult struct {
 	StorageRoot Hash
 	BlockNumber uint64
 }
+
+// StorageValue is the decoded value of a single-valued storage variable, such
+// as a number, bool, address or string, written as a string
+type StorageValue struct {
+	Variable string `json:"variable"`
+	Value    string `json:"value"`
+}
+
+// StorageValues is the storage of a contract at a block it changed at. Storage
+// indexed without a layout to decode it with only has the raw slots.
+type StorageValues struct {
+	BlockNumber uint64
+	Values      []*StorageValue
+	Storage     map[Hash]string
+}
@@ -0,0 +1,29 @@
+package types
+
+// SubscriptionStats describes the connected websocket subscribers, so slow
+// consumers can be spotted before their queued notifications build up.
+type SubscriptionStats struct {
+	Connections int `json:"connections"`
+	// active subscriptions, keyed by subscription type
+	Subscriptions map[string]int `json:"subscriptions"`
+	// notifications sent and dropped since startup, including to subscribers
+	// that have since disconnected
+	Sent        uint64             `json:"sent"`
+	Dropped     uint64             `json:"dropped"`
+	Subscribers []*SubscriberStats `json:"subscribers"`
+}
+
+type SubscriberStats struct {
+	ID            string `json:"id"`
+	RemoteAddress string `json:"remoteAddress"`
+	// unix seconds
+	ConnectedAt   uint64         `json:"connectedAt"`
+	Subscriptions map[string]int `json:"subscriptions"`
+	Sent          uint64         `json:"sent"`
+	// notifications dropped because the queue of the subscriber was full
+	Dropped uint64 `json:"dropped"`
+	// notifications waiting to be written
+	Queued int `json:"queued"`
+	// blocks between the last one notified and the oldest queued notification
+	LagBlocks uint64 `json:"lagBlocks"`
+}
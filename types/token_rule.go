@@ -0,0 +1,66 @@
+package types
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+// TokenRule is a rule added through the RPC API, which registers newly
+// created contracts, or the addresses emitted in an event, in the same way
+// as the rules of the configuration file.
+type TokenRule struct {
+	ID           string  `json:"id"`
+	Scope        string  `json:"scope"`
+	Deployer     Address `json:"deployer,omitempty"`
+	TemplateName string  `json:"templateName"`
+	// 4-byte EIP165 interface identifier, in hex
+	EIP165 string `json:"eip165,omitempty"`
+	// ABI whose functions and events are looked for in the bytecode of
+	// created contracts, instead of the template's
+	ABI string `json:"abi,omitempty"`
+	// set for event scope rules
+	EventTemplate string  `json:"eventTemplate,omitempty"`
+	Event         string  `json:"event,omitempty"`
+	Parameter     string  `json:"parameter,omitempty"`
+	Emitter       Address `json:"emitter,omitempty"`
+	// unix seconds
+	CreatedAt uint64 `json:"createdAt"`
+}
+
+func (r *TokenRule) Validate() error {
+	if r.Scope != AllScope && r.Scope != InternalScope && r.Scope != ExternalScope && r.Scope != EventScope {
+		return errors.New("token rule scope must be one of all, internal, external or event")
+	}
+	if r.TemplateName == "" {
+		return errors.New("token rule template name not provided")
+	}
+	if r.EIP165 != "" {
+		if id, err := hex.DecodeString(r.EIP165); err != nil || len(id) != 4 {
+			return errors.New("token rule eip165 must be a 4-byte interface identifier in hex")
+		}
+	}
+	if r.ABI != "" {
+		if _, err := NewABIStructureFromJSON(r.ABI); err != nil {
+			return errors.New("token rule ABI is not valid")
+		}
+	}
+	if r.Scope == EventScope && (r.EventTemplate == "" || r.Event == "" || r.Parameter == "") {
+		return errors.New("event token rules need an event template, event and parameter")
+	}
+	return nil
+}
+
+// RuleConfig is the rule as it would be given in the configuration file
+func (r *TokenRule) RuleConfig() *RuleConfig {
+	return &RuleConfig{
+		Scope:         r.Scope,
+		Deployer:      r.Deployer,
+		TemplateName:  r.TemplateName,
+		EIP165:        r.EIP165,
+		ABI:           r.ABI,
+		EventTemplate: r.EventTemplate,
+		Event:         r.Event,
+		Parameter:     r.Parameter,
+		Emitter:       r.Emitter,
+	}
+}
@@ -0,0 +1,21 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenRule_Validate(t *testing.T) {
+	assert.Nil(t, (&TokenRule{Scope: ExternalScope, TemplateName: "ERC20", EIP165: "36372b07"}).Validate())
+	assert.Nil(t, (&TokenRule{Scope: AllScope, TemplateName: "ERC20", ABI: `[{"inputs":[],"name":"totalSupply","type":"function"}]`}).Validate())
+	assert.Nil(t, (&TokenRule{Scope: EventScope, TemplateName: "Wallet", EventTemplate: "WalletFactory", Event: "WalletCreated", Parameter: "wallet"}).Validate())
+
+	assert.EqualError(t, (&TokenRule{Scope: "everything", TemplateName: "ERC20"}).Validate(), "token rule scope must be one of all, internal, external or event")
+	assert.EqualError(t, (&TokenRule{Scope: AllScope}).Validate(), "token rule template name not provided")
+	eip165Err := "token rule eip165 must be a 4-byte interface identifier in hex"
+	assert.EqualError(t, (&TokenRule{Scope: AllScope, TemplateName: "ERC20", EIP165: "36372b"}).Validate(), eip165Err)
+	assert.EqualError(t, (&TokenRule{Scope: AllScope, TemplateName: "ERC20", EIP165: "0x36372b07"}).Validate(), eip165Err)
+	assert.EqualError(t, (&TokenRule{Scope: AllScope, TemplateName: "ERC20", ABI: "not an abi"}).Validate(), "token rule ABI is not valid")
+	assert.EqualError(t, (&TokenRule{Scope: EventScope, TemplateName: "Wallet", EventTemplate: "WalletFactory"}).Validate(), "event token rules need an event template, event and parameter")
+}
@@ -1,5 +1,7 @@
 package types
 
+import "math/big"
+
 type ERC721Token struct {
 	Contract  Address `json:"contract"`
 	Holder    Address `json:"holder"`
@@ -7,3 +9,34 @@ type ERC721Token struct {
 	HeldFrom  uint64  `json:"heldFrom"`
 	HeldUntil *uint64 `json:"heldUntil"`
 }
+
+// ERC20Holding is the balance of one holder of an ERC20 token
+type ERC20Holding struct {
+	Holder  Address  `json:"holder"`
+	Balance *big.Int `json:"balance"`
+}
+
+// ERC20Allowance is the amount a spender is allowed to transfer on behalf of
+// an owner of an ERC20 token, as last approved at the block number
+type ERC20Allowance struct {
+	Owner       Address  `json:"owner"`
+	Spender     Address  `json:"spender"`
+	Amount      *big.Int `json:"amount"`
+	BlockNumber uint64   `json:"blockNumber"`
+}
+
+// TokenTransfer is a movement of tokens recorded by a Transfer, TransferSingle
+// or TransferBatch event. TokenId is nil for ERC20, and Amount is 1 for ERC721.
+type TokenTransfer struct {
+	Standard         string   `json:"standard"`
+	Contract         Address  `json:"contract"`
+	From             Address  `json:"from"`
+	To               Address  `json:"to"`
+	TokenId          *big.Int `json:"tokenId,omitempty"`
+	Amount           *big.Int `json:"amount"`
+	BlockNumber      uint64   `json:"blockNumber"`
+	TransactionHash  Hash     `json:"transactionHash"`
+	TransactionIndex uint64   `json:"transactionIndex"`
+	EventIndex       uint64   `json:"eventIndex"`
+	Timestamp        uint64   `json:"timestamp"`
+}
@@ -26,6 +26,23 @@ type RawBlock struct {
 	Transactions []Hash    `json:"transactions"`
 }
 
+// received from eth_getTransactionByHash, where the block number is nil while
+// the transaction is pending
+type RawPendingTransaction struct {
+	Hash        Hash       `json:"hash"`
+	BlockNumber *HexNumber `json:"blockNumber"`
+	From        Address    `json:"from"`
+	To          Address    `json:"to"`
+	Nonce       HexNumber  `json:"nonce"`
+	Gas         HexNumber  `json:"gas"`
+	GasPrice    HexNumber  `json:"gasPrice"`
+	Value       string     `json:"value"`
+	Input       HexData    `json:"input"`
+	// 37 or 38 for private transactions, whose input is the hash of their
+	// payload
+	V HexNumber `json:"v"`
+}
+
 type RawInnerCall struct {
 	Type    string
 	To      Address
@@ -39,7 +56,8 @@ type RawInnerCall struct {
 }
 
 type RawOuterCall struct {
-	Calls []RawInnerCall
+	Output HexData
+	Calls  []RawInnerCall
 }
 
 type Block struct {
@@ -73,10 +91,16 @@ type Transaction struct {
 	CreatedContract   Address         `json:"createdContract"`
 	Data              HexData         `json:"data"`
 	PrivateData       HexData         `json:"privateData"`
+	DataTruncated     bool            `json:"dataTruncated"`
+	ReturnData        HexData         `json:"returnData"`
+	ReturnTruncated   bool            `json:"returnTruncated"`
 	IsPrivate         bool            `json:"isPrivate"`
 	Timestamp         uint64          `json:"timestamp"`
 	Events            []*Event        `json:"events"`
 	InternalCalls     []*InternalCall `json:"internalCalls"`
+	// the internal calls nested under the calls that made them, which are
+	// stored apart from the transaction
+	CallTree []*CallFrame `json:"-"`
 }
 
 type InternalCall struct {
@@ -90,6 +114,19 @@ type InternalCall struct {
 	Type    string  `json:"type"`
 }
 
+// CallFrame is an internal call, with the calls it made in turn
+type CallFrame struct {
+	InternalCall
+	Calls []*CallFrame `json:"calls"`
+}
+
+// CallTree is the full tree of internal calls made by a transaction
+type CallTree struct {
+	TransactionHash Hash         `json:"transactionHash"`
+	BlockNumber     uint64       `json:"blockNumber"`
+	Calls           []*CallFrame `json:"calls"`
+}
+
 type Event struct {
 	Index            uint64  `json:"index"`
 	Address          Address `json:"address"`
@@ -107,3 +144,36 @@ type RangeResult struct {
 	End         uint64 `json:"end"`
 	ResultCount int    `json:"resultCount"`
 }
+
+// kinds of anomaly
+const (
+	SpikeAnomaly   = "spike"
+	SilenceAnomaly = "silence"
+)
+
+// metrics checked for anomalies
+const (
+	EventsMetric       = "events"
+	TransactionsMetric = "transactions"
+)
+
+// Anomaly is an unusual number of events or transactions for a contract in
+// the last sampling interval, compared to its moving average.
+type Anomaly struct {
+	Address Address `json:"address"`
+	Metric  string  `json:"metric"`
+	Kind    string  `json:"kind"`
+	Value   uint64  `json:"value"`
+	Average float64 `json:"average"`
+	StdDev  float64 `json:"stdDev"`
+	// unix timestamp of when the anomaly was first seen
+	Since int64 `json:"since"`
+}
+
+type IndexStats struct {
+	Name          string `json:"name"`
+	DocumentCount uint64 `json:"documentCount"`
+	StorageSize   uint64 `json:"storageSize"`
+	OldestBlock   uint64 `json:"oldestBlock"`
+	NewestBlock   uint64 `json:"newestBlock"`
+}
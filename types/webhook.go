@@ -0,0 +1,61 @@
+package types
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"regexp"
+)
+
+// eventSignaturePattern is the canonical form of an event signature, the
+// event name followed by its parameter types, e.g. Transfer(address,address,uint256)
+var eventSignaturePattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*\([A-Za-z0-9_,()\[\]]*\)$`)
+
+// Webhook receives the parsed events of registered contracts that match its
+// filter, POSTed as JSON to its URL. Empty parts of the filter match any
+// event; an event must match all the parts that are set.
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// the contract that emitted the event
+	Address *Address `json:"address,omitempty"`
+	// the canonical event signature, which is matched against the first topic
+	EventSignature string `json:"eventSignature,omitempty"`
+	// a value that must be one of the event's topics
+	Topic *Hash `json:"topic,omitempty"`
+	// the key notifications are signed with, using HMAC-SHA256
+	Secret string `json:"secret,omitempty"`
+}
+
+func (w *Webhook) Validate() error {
+	parsed, err := url.Parse(w.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("webhook URL must be an absolute http or https URL")
+	}
+	if w.EventSignature != "" && !eventSignaturePattern.MatchString(w.EventSignature) {
+		return errors.New("webhook event signature must be of the form Name(type1,type2,...)")
+	}
+	return nil
+}
+
+// Matches checks whether the event passes the webhook's filter.
+func (w *Webhook) Matches(event *Event) bool {
+	if w.Address != nil && *w.Address != event.Address {
+		return false
+	}
+	if w.EventSignature != "" {
+		topic := NewHash(hex.EncodeToString(hash(w.EventSignature)))
+		if len(event.Topics) == 0 || event.Topics[0] != topic {
+			return false
+		}
+	}
+	if w.Topic != nil {
+		for _, topic := range event.Topics {
+			if topic == *w.Topic {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
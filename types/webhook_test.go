@@ -0,0 +1,47 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook_Validate(t *testing.T) {
+	assert.Nil(t, (&Webhook{URL: "https://example.com/hook"}).Validate())
+	assert.Nil(t, (&Webhook{URL: "http://localhost:8080", EventSignature: "Transfer(address,address,uint256)"}).Validate())
+
+	urlErr := "webhook URL must be an absolute http or https URL"
+	assert.EqualError(t, (&Webhook{}).Validate(), urlErr)
+	assert.EqualError(t, (&Webhook{URL: "/hook"}).Validate(), urlErr)
+	assert.EqualError(t, (&Webhook{URL: "ftp://example.com"}).Validate(), urlErr)
+
+	sigErr := "webhook event signature must be of the form Name(type1,type2,...)"
+	assert.EqualError(t, (&Webhook{URL: "https://example.com", EventSignature: "Transfer"}).Validate(), sigErr)
+	assert.EqualError(t, (&Webhook{URL: "https://example.com", EventSignature: "event Transfer(address from)"}).Validate(), sigErr)
+}
+
+func TestWebhook_Matches(t *testing.T) {
+	contract := NewAddress("0x1349f3e1b8d71effb47b840594ff27da7e603d17")
+	other := NewAddress("0x9d13c6d3afe1721beef56b55d303b09e021e27ab")
+	holder := NewHash("0x0000000000000000000000009d13c6d3afe1721beef56b55d303b09e021e27ab")
+	event := &Event{
+		Address: contract,
+		Topics: []Hash{
+			NewHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"),
+			NewHash("0x0000000000000000000000000000000000000000000000000000000000000000"),
+			holder,
+		},
+	}
+	otherTopic := NewHash("1")
+
+	assert.True(t, (&Webhook{}).Matches(event))
+	assert.True(t, (&Webhook{Address: &contract}).Matches(event))
+	assert.False(t, (&Webhook{Address: &other}).Matches(event))
+	assert.True(t, (&Webhook{EventSignature: "Transfer(address,address,uint256)"}).Matches(event))
+	assert.False(t, (&Webhook{EventSignature: "Approval(address,address,uint256)"}).Matches(event))
+	assert.True(t, (&Webhook{Topic: &holder}).Matches(event))
+	assert.False(t, (&Webhook{Topic: &otherTopic}).Matches(event))
+	assert.True(t, (&Webhook{Address: &contract, EventSignature: "Transfer(address,address,uint256)", Topic: &holder}).Matches(event))
+	assert.False(t, (&Webhook{Address: &contract, EventSignature: "Transfer(address,address,uint256)", Topic: &otherTopic}).Matches(event))
+	assert.False(t, (&Webhook{EventSignature: "Transfer(address,address,uint256)"}).Matches(&Event{Address: contract}))
+}
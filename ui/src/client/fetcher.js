@@ -31,7 +31,7 @@ export function addContract(address) {
 }
 
 export function deleteContract(address) {
-  return deleteAddress(address)
+  return deleteAddress(address, true)
 }
 
 export function getContracts() {
@@ -40,8 +40,8 @@ export function addAddress(address) {
   return request('reporting.AddAddress', [{ address }])
 }
 
-export function deleteAddress(address) {
-  return request('reporting.DeleteAddress', [address])
+export function deleteAddress(address, purge) {
+  return request('reporting.DeleteAddress', [{ address, purge }])
 }
 
 export function getTemplates() {